@@ -0,0 +1,135 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// apiMounts are the kernel filesystems set up for the boot and moved to the
+// new root when switching to it
+var apiMounts = []struct {
+	source, target, fstype string
+	flags                  uintptr
+	data                   string
+}{
+	{"devtmpfs", "/dev", "devtmpfs", unix.MS_NOSUID, "mode=0755"},
+	{"proc", "/proc", "proc", unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC, ""},
+	{"sysfs", "/sys", "sysfs", unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC, ""},
+	{"tmpfs", "/run", "tmpfs", unix.MS_NOSUID | unix.MS_NODEV, "mode=0755"},
+}
+
+// mountAPIFilesystems mounts /dev, /proc, /sys and /run. Filesystems the
+// kernel already mounted (devtmpfs with CONFIG_DEVTMPFS_MOUNT) are kept.
+func mountAPIFilesystems() error {
+	for _, m := range apiMounts {
+		if err := os.MkdirAll(m.target, 0755); err != nil { // #nosec G301 -- API mount point
+			return err
+		}
+		err := unix.Mount(m.source, m.target, m.fstype, m.flags, m.data)
+		if err != nil && !errors.Is(err, unix.EBUSY) {
+			return fmt.Errorf("failed to mount %s: %w", m.target, err)
+		}
+	}
+	return nil
+}
+
+// openConsole makes /dev/console the standard input, output and error
+func openConsole() error {
+	fd, err := unix.Open("/dev/console", unix.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+	for target := 0; target <= 2; target++ {
+		if err := unix.Dup3(fd, target, 0); err != nil && fd != target {
+			return err
+		}
+	}
+	if fd > 2 {
+		_ = unix.Close(fd)
+	}
+	return nil
+}
+
+// switchRoot makes newRoot the root filesystem, like switch_root(8): the API
+// filesystems are moved into it, the initramfs is emptied to free its
+// memory, and newRoot is moved onto /. The caller then executes init.
+func switchRoot(newRoot string) error {
+	var rootStat unix.Statfs_t
+	if err := unix.Statfs("/", &rootStat); err != nil {
+		return err
+	}
+	// Refuse to empty anything but an initramfs. f_type is an int32 on
+	// 32-bit targets, where RAMFS_MAGIC does not fit, so compare as uint32.
+	if fsType := uint32(rootStat.Type); fsType != uint32(unix.RAMFS_MAGIC) && fsType != uint32(unix.TMPFS_MAGIC) {
+		return errors.New("/ is not an initramfs")
+	}
+	if _, err := os.Stat("/init"); err != nil {
+		return fmt.Errorf("/ is not an initramfs: %w", err)
+	}
+
+	var oldDev, newDev unix.Stat_t
+	if err := unix.Stat("/", &oldDev); err != nil {
+		return err
+	}
+	if err := unix.Stat(newRoot, &newDev); err != nil {
+		return err
+	}
+	if oldDev.Dev == newDev.Dev {
+		return fmt.Errorf("%s is not a mount point", newRoot)
+	}
+
+	for _, m := range apiMounts {
+		target := filepath.Join(newRoot, m.target)
+		if err := unix.Mount(m.target, target, "", unix.MS_MOVE, ""); err != nil {
+			// The new root has nowhere to put it
+			_ = unix.Unmount(m.target, unix.MNT_DETACH)
+		}
+	}
+
+	if err := unix.Chdir(newRoot); err != nil {
+		return err
+	}
+	removeTree("/", uint64(oldDev.Dev), newRoot) // #nosec G115 -- Dev is uint32 on some platforms
+
+	if err := unix.Mount(".", "/", "", unix.MS_MOVE, ""); err != nil {
+		return fmt.Errorf("failed to move %s to /: %w", newRoot, err)
+	}
+	if err := unix.Chroot("."); err != nil {
+		return err
+	}
+	return unix.Chdir("/")
+}
+
+// removeTree deletes the contents of dir that are on the filesystem dev,
+// leaving out skip and anything mounted from another filesystem. Errors are
+// ignored: whatever is left only wastes memory.
+func removeTree(dir string, dev uint64, skip string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if path == skip {
+			continue
+		}
+		var st unix.Stat_t
+		if err := unix.Lstat(path, &st); err != nil || uint64(st.Dev) != dev { // #nosec G115 -- Dev is uint32 on some platforms
+			continue
+		}
+		if e.IsDir() {
+			removeTree(path, dev, skip)
+		}
+		_ = os.Remove(path)
+	}
+}
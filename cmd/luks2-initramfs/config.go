@@ -0,0 +1,176 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultConfigPath is where the config is read from inside the initramfs
+const DefaultConfigPath = "/etc/luks2-initramfs.json"
+
+// Defaults for Config
+const (
+	DefaultInit          = "/sbin/init"
+	DefaultDeviceTimeout = 30 * time.Second
+	DefaultTries         = 3
+)
+
+// Config describes the volumes to unlock and the root filesystem to boot:
+//
+//	{
+//	  "volumes": [
+//	    {"name": "root", "device": "UUID=2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1"},
+//	    {"name": "swap", "device": "LABEL=swap", "key_file": "/etc/swap.key", "resume": true}
+//	  ],
+//	  "root": {"volume": "root", "fs_type": "ext4"}
+//	}
+type Config struct {
+	// Volumes are unlocked in order
+	Volumes []Volume `json:"volumes"`
+
+	// Root is the filesystem switched to
+	Root Root `json:"root"`
+
+	// Init is run on the new root (default: DefaultInit, or init= from the
+	// kernel command line)
+	Init string `json:"init,omitempty"`
+
+	// DeviceTimeout is how long to wait for each device to appear, in
+	// seconds (default: 30)
+	DeviceTimeout int `json:"device_timeout_sec,omitempty"`
+
+	// Tries is the number of passphrases asked for per volume (default: 3)
+	Tries int `json:"tries,omitempty"`
+}
+
+// Volume is a LUKS2 volume to unlock. Key sources are tried in order: the
+// key file, the PKCS#11 token, then a passphrase typed on the console.
+type Volume struct {
+	// Name is the device-mapper name
+	Name string `json:"name"`
+
+	// Device is a device path or UUID=/LABEL= of the LUKS2 header
+	Device string `json:"device"`
+
+	// KeyFile is a key file inside the initramfs
+	KeyFile string `json:"key_file,omitempty"`
+
+	// PKCS11URI unlocks with a smartcard or HSM enrolled with luks2 enroll;
+	// "auto" reads the URI from the volume. The PIN is asked for on the
+	// console, and pkcs11-tool must be in the image.
+	PKCS11URI string `json:"pkcs11_uri,omitempty"`
+
+	// AllowDiscards passes TRIM requests to the device
+	AllowDiscards bool `json:"allow_discards,omitempty"`
+
+	// Resume resumes from a hibernation image on this volume (swap)
+	Resume bool `json:"resume,omitempty"`
+}
+
+// Root is the root filesystem inside one of the volumes
+type Root struct {
+	Volume  string `json:"volume"`            // Name of the volume holding it
+	FSType  string `json:"fs_type,omitempty"` // "" = detect
+	Options string `json:"options,omitempty"` // Mount options (default: ro, or rw from the kernel command line)
+}
+
+// loadConfig reads and validates a config. Unknown fields are rejected.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- config path inside the initramfs
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// validate checks for missing fields and a root outside the volumes
+func (c *Config) validate() error {
+	if len(c.Volumes) == 0 {
+		return errors.New("no volumes")
+	}
+	names := make(map[string]bool)
+	for i, v := range c.Volumes {
+		switch {
+		case v.Name == "" || strings.ContainsAny(v.Name, "/ \t\n"):
+			return fmt.Errorf("volume %d: invalid name %q", i, v.Name)
+		case names[v.Name]:
+			return fmt.Errorf("volume %q is listed twice", v.Name)
+		case v.Device == "":
+			return fmt.Errorf("volume %q: device is required", v.Name)
+		case v.KeyFile != "" && !filepath.IsAbs(v.KeyFile):
+			return fmt.Errorf("volume %q: key_file must be absolute", v.Name)
+		}
+		names[v.Name] = true
+	}
+
+	if !names[c.Root.Volume] {
+		return fmt.Errorf("root volume %q is not in volumes", c.Root.Volume)
+	}
+	if c.Init != "" && !filepath.IsAbs(c.Init) {
+		return fmt.Errorf("init must be absolute: %q", c.Init)
+	}
+	if c.DeviceTimeout < 0 || c.Tries < 0 {
+		return errors.New("device_timeout_sec and tries must not be negative")
+	}
+	return nil
+}
+
+// deviceTimeout returns the device wait timeout
+func (c *Config) deviceTimeout() time.Duration {
+	if c.DeviceTimeout == 0 {
+		return DefaultDeviceTimeout
+	}
+	return time.Duration(c.DeviceTimeout) * time.Second
+}
+
+// tries returns the passphrase attempts per volume
+func (c *Config) tries() int {
+	if c.Tries == 0 {
+		return DefaultTries
+	}
+	return c.Tries
+}
+
+// kernelArgs holds the kernel command line parameters luks2-initramfs uses
+type kernelArgs struct {
+	init string // init=
+	rw   bool   // rw (root is mounted read-only otherwise)
+}
+
+// parseCmdline extracts init=, ro and rw from the kernel command line
+func parseCmdline(cmdline string) kernelArgs {
+	var args kernelArgs
+	for _, field := range strings.Fields(cmdline) {
+		switch {
+		case strings.HasPrefix(field, "init="):
+			args.init = strings.TrimPrefix(field, "init=")
+		case field == "rw":
+			args.rw = true
+		case field == "ro":
+			args.rw = false
+		}
+	}
+	return args
+}
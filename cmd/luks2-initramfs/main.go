@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Command luks2-initramfs is a minimal init for an initramfs with an
+// encrypted root. Run as /init (PID 1), it mounts the kernel filesystems,
+// unlocks the volumes listed in /etc/luks2-initramfs.json with a key file,
+// a PKCS#11 token or a passphrase typed on the console, resumes from
+// hibernation, mounts the root filesystem and switches to its init.
+//
+// It is pure Go: built with CGO_ENABLED=0 it is a single static binary, and
+// an image needs nothing else (pkcs11-tool and its module only for tokens).
+//
+// Run by hand, it validates a config before it is put into an image:
+//
+//	luks2-initramfs -check /etc/luks2-initramfs.json
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Version is set at build time via -ldflags
+var Version = "dev"
+
+func main() {
+	if os.Getpid() == 1 {
+		initMain()
+	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run handles invocations other than as PID 1
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("luks2-initramfs", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	check := fs.String("check", "", "validate a config file and exit")
+	version := fs.Bool("version", false, "print version and exit")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: luks2-initramfs -check <config>\n\n")
+		_, _ = fmt.Fprintf(stderr, "Runs as /init (PID 1) inside an initramfs, reading %s.\n\n", DefaultConfigPath)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	switch {
+	case *version:
+		_, _ = fmt.Fprintf(stdout, "luks2-initramfs %s\n", Version)
+		return 0
+	case *check != "":
+		cfg, err := loadConfig(*check)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		_, _ = fmt.Fprintf(stdout, "%s: %d volume(s), root on %s\n", *check, len(cfg.Volumes), cfg.Root.Volume)
+		return 0
+	default:
+		fs.Usage()
+		return 2
+	}
+}
+
+// initMain boots the system. PID 1 must never exit, so failures are shown
+// on the console and the boot is retried when Enter is pressed.
+func initMain() {
+	if err := mountAPIFilesystems(); err != nil {
+		fmt.Fprintf(os.Stderr, "luks2-initramfs: %v\n", err)
+	}
+	if err := openConsole(); err != nil {
+		fmt.Fprintf(os.Stderr, "luks2-initramfs: no console: %v\n", err)
+	}
+
+	console := &Console{
+		Out:          os.Stdout,
+		ReadPassword: func() ([]byte, error) { return term.ReadPassword(int(os.Stdin.Fd())) }, // #nosec G115 -- stdin
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	for {
+		err := boot(console)
+		console.Printf("luks2-initramfs: %v\nPress Enter to retry.\n", err)
+		_, _ = stdin.ReadString('\n')
+	}
+}
+
+// boot unlocks and mounts the root filesystem, switches to it and executes
+// its init. It only returns on failure.
+func boot(console *Console) error {
+	cfg, err := loadConfig(DefaultConfigPath)
+	if err != nil {
+		return err
+	}
+	cmdline, _ := os.ReadFile("/proc/cmdline")
+
+	b := &Booter{
+		Config:  cfg,
+		Ops:     &DefaultBootOperations{},
+		Console: console,
+		Args:    parseCmdline(strings.TrimSpace(string(cmdline))),
+		NewRoot: NewRoot,
+	}
+	init, err := b.Boot()
+	if err != nil {
+		return err
+	}
+	if err := switchRoot(NewRoot); err != nil {
+		return fmt.Errorf("failed to switch root: %w", err)
+	}
+	// Arguments the kernel did not recognize are meant for the real init
+	argv := append([]string{init}, os.Args[1:]...)
+	return fmt.Errorf("failed to execute %s: %w", init, unix.Exec(init, argv, os.Environ()))
+}
@@ -0,0 +1,410 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"golang.org/x/sys/unix"
+)
+
+// mockBootOps records the calls made by a Booter
+type mockBootOps struct {
+	devices  map[string]string // spec -> device
+	unlocked map[string]bool
+	keys     map[string]string // name -> accepted key, passphrase or PIN
+	mounted  *luks2.MountOptions
+	mountErr error
+	mapped   string
+	calls    []string
+}
+
+func newMockBootOps() *mockBootOps {
+	return &mockBootOps{
+		devices:  map[string]string{"UUID=root": "/dev/sda2", "/dev/sda3": "/dev/sda3"},
+		unlocked: map[string]bool{},
+		keys:     map[string]string{},
+	}
+}
+
+func (m *mockBootOps) ResolveDevice(spec string) (string, error) {
+	if dev, ok := m.devices[spec]; ok {
+		return dev, nil
+	}
+	return "", luks2.ErrDeviceNotFound
+}
+
+func (m *mockBootOps) IsUnlocked(name string) bool { return m.unlocked[name] }
+
+func (m *mockBootOps) check(call, name string, key []byte) error {
+	m.calls = append(m.calls, call+":"+name)
+	if m.keys[name] != string(key) {
+		return luks2.ErrInvalidPassphrase
+	}
+	m.unlocked[name] = true
+	return nil
+}
+
+func (m *mockBootOps) UnlockWithOptions(device string, key []byte, name string, opts *luks2.UnlockOptions) error {
+	return m.check("keyfile", name, key)
+}
+
+func (m *mockBootOps) UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+	for attempt := 1; attempt <= opts.MaxAttempts; attempt++ {
+		pass, err := prompt(attempt)
+		if err != nil {
+			return err
+		}
+		if err := m.check("passphrase", name, pass); err == nil {
+			return nil
+		}
+	}
+	return luks2.ErrInvalidPassphrase
+}
+
+func (m *mockBootOps) UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error {
+	return m.check("pkcs11", name, pin)
+}
+
+func (m *mockBootOps) GetMappedDevicePath(name string) (string, error) {
+	return m.mapped, nil
+}
+
+func (m *mockBootOps) Mount(opts luks2.MountOptions) error {
+	m.mounted = &opts
+	return m.mountErr
+}
+
+// newTestConsole returns a console answering prompts with answers in turn
+func newTestConsole(answers ...string) (*Console, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Console{
+		Out: out,
+		ReadPassword: func() ([]byte, error) {
+			if len(answers) == 0 {
+				return nil, errors.New("no input")
+			}
+			answer := answers[0]
+			answers = answers[1:]
+			return []byte(answer), nil
+		},
+	}, out
+}
+
+// newTestBooter returns a Booter over a new root holding /sbin/init
+func newTestBooter(t *testing.T, cfg *Config, ops BootOperations, console *Console) *Booter {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sbin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sbin", "init"), nil, 0755); err != nil { // #nosec G306 -- test file
+		t.Fatal(err)
+	}
+	return &Booter{Config: cfg, Ops: ops, Console: console, NewRoot: root}
+}
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "luks2-initramfs.json")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, `{
+		"volumes": [
+			{"name": "root", "device": "UUID=root", "pkcs11_uri": "auto"},
+			{"name": "swap", "device": "/dev/sda3", "key_file": "/etc/swap.key", "resume": true}
+		],
+		"root": {"volume": "root", "fs_type": "ext4"},
+		"tries": 5
+	}`))
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if len(cfg.Volumes) != 2 || !cfg.Volumes[1].Resume || cfg.tries() != 5 || cfg.deviceTimeout() != DefaultDeviceTimeout {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	if _, err := loadConfig(writeConfig(t, `{"volumes": [], "bogus": 1}`)); err == nil {
+		t.Error("Expected error for an unknown field")
+	}
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	ok := Volume{Name: "root", Device: "UUID=root"}
+	tests := map[string]func(c *Config){
+		"no volumes":     func(c *Config) { c.Volumes = nil },
+		"empty name":     func(c *Config) { c.Volumes[0].Name = "" },
+		"slash in name":  func(c *Config) { c.Volumes[0].Name = "a/b" },
+		"no device":      func(c *Config) { c.Volumes[0].Device = "" },
+		"relative key":   func(c *Config) { c.Volumes[0].KeyFile = "root.key" },
+		"duplicate name": func(c *Config) { c.Volumes = append(c.Volumes, ok) },
+		"unknown root":   func(c *Config) { c.Root.Volume = "other" },
+		"relative init":  func(c *Config) { c.Init = "sbin/init" },
+		"negative tries": func(c *Config) { c.Tries = -1 },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{Volumes: []Volume{ok}, Root: Root{Volume: "root"}}
+			mutate(cfg)
+			if err := cfg.validate(); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+}
+
+func TestParseCmdline(t *testing.T) {
+	args := parseCmdline("BOOT_IMAGE=/vmlinuz quiet rw init=/lib/systemd/systemd")
+	if args.init != "/lib/systemd/systemd" || !args.rw {
+		t.Errorf("args = %+v", args)
+	}
+	// The last of ro and rw wins, as in the kernel
+	if args := parseCmdline("rw ro"); args.rw {
+		t.Error("ro after rw should mount read-only")
+	}
+}
+
+func TestBoot(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "swap.key")
+	if err := os.WriteFile(keyFile, []byte("swapkey"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Volumes: []Volume{
+			{Name: "root", Device: "UUID=root", AllowDiscards: true},
+			{Name: "swap", Device: "/dev/sda3", KeyFile: keyFile},
+		},
+		Root: Root{Volume: "root", FSType: "ext4"},
+	}
+	ops := newMockBootOps()
+	ops.keys["root"] = "secret"
+	ops.keys["swap"] = "swapkey"
+	console, out := newTestConsole("wrong", "secret")
+
+	b := newTestBooter(t, cfg, ops, console)
+	init, err := b.Boot()
+	if err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+	if init != DefaultInit {
+		t.Errorf("init = %s", init)
+	}
+	want := "passphrase:root passphrase:root keyfile:swap"
+	if got := strings.Join(ops.calls, " "); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+	if !strings.Contains(out.String(), "Passphrase for root (UUID=root): ") {
+		t.Errorf("console output = %q", out.String())
+	}
+	if ops.mounted == nil || ops.mounted.Device != "root" || ops.mounted.MountPoint != b.NewRoot || ops.mounted.Data != "ro" {
+		t.Errorf("mounted = %+v", ops.mounted)
+	}
+
+	// rw on the kernel command line
+	b.Args = kernelArgs{rw: true}
+	if _, err := b.Boot(); err != nil || ops.mounted.Data != "rw" {
+		t.Errorf("Boot = %v, mount data %q", err, ops.mounted.Data)
+	}
+}
+
+func TestBoot_KeySources(t *testing.T) {
+	cfg := &Config{
+		Volumes: []Volume{{Name: "root", Device: "UUID=root", KeyFile: "/nonexistent/root.key", PKCS11URI: "auto"}},
+		Root:    Root{Volume: "root"},
+	}
+
+	// A missing key file falls back to the token
+	ops := newMockBootOps()
+	ops.keys["root"] = "1234"
+	console, out := newTestConsole("1234")
+	if _, err := newTestBooter(t, cfg, ops, console).Boot(); err != nil {
+		t.Fatalf("Boot failed: %v", err)
+	}
+	if got := strings.Join(ops.calls, " "); got != "pkcs11:root" {
+		t.Errorf("calls = %s", got)
+	}
+	if !strings.Contains(out.String(), "Key file for root failed") {
+		t.Errorf("console output = %q", out.String())
+	}
+
+	// A wrong PIN falls back to passphrases, which run out
+	ops = newMockBootOps()
+	ops.keys["root"] = "secret"
+	console, _ = newTestConsole("0000", "a", "b", "c")
+	if _, err := newTestBooter(t, cfg, ops, console).Boot(); !errors.Is(err, luks2.ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if len(ops.calls) != 1+DefaultTries {
+		t.Errorf("calls = %v", ops.calls)
+	}
+
+	// Unlocked volumes are not touched again
+	ops = newMockBootOps()
+	ops.unlocked["root"] = true
+	if _, err := newTestBooter(t, cfg, ops, console).Boot(); err != nil || len(ops.calls) != 0 {
+		t.Errorf("Boot = %v, calls %v", err, ops.calls)
+	}
+}
+
+func TestBoot_Errors(t *testing.T) {
+	saved := devicePollInterval
+	devicePollInterval = time.Millisecond
+	t.Cleanup(func() { devicePollInterval = saved })
+
+	cfg := &Config{
+		Volumes:       []Volume{{Name: "root", Device: "UUID=missing"}},
+		Root:          Root{Volume: "root"},
+		DeviceTimeout: 1,
+	}
+	ops := newMockBootOps()
+	console, out := newTestConsole()
+	b := newTestBooter(t, cfg, ops, console)
+	start := time.Now()
+	if _, err := b.Boot(); !errors.Is(err, luks2.ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+	if time.Since(start) < time.Second || !strings.Contains(out.String(), "Waiting for UUID=missing") {
+		t.Errorf("gave up after %v, output %q", time.Since(start), out.String())
+	}
+
+	// A missing init is reported before switching to the root
+	ops.unlocked["root"] = true
+	b.Args = kernelArgs{init: "/bin/missing"}
+	if _, err := b.Boot(); err == nil || !strings.Contains(err.Error(), "/bin/missing") {
+		t.Errorf("Expected a missing init error, got %v", err)
+	}
+
+	// A root mounted by an earlier attempt is fine; other mount errors are not
+	b.Args = kernelArgs{}
+	ops.mountErr = unix.EBUSY
+	if _, err := b.Boot(); err != nil {
+		t.Errorf("Boot with root already mounted = %v", err)
+	}
+	ops.mountErr = unix.EINVAL
+	if _, err := b.Boot(); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Expected EINVAL, got %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	ops := newMockBootOps()
+	b := &Booter{Ops: ops, resumePath: filepath.Join(t.TempDir(), "resume")}
+
+	ops.mapped = "/dev/null"
+	if err := b.resume("swap"); err == nil {
+		t.Error("Expected error for a character device")
+	}
+
+	// Any block device will do for the write
+	blocks, _ := filepath.Glob("/dev/loop[0-9]*")
+	if len(blocks) == 0 {
+		t.Skip("no block device to test with")
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(blocks[0], &st); err != nil || st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		t.Skipf("%s is not a block device", blocks[0])
+	}
+	ops.mapped = blocks[0]
+	if err := b.resume("swap"); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	data, _ := os.ReadFile(b.resumePath)
+	if want := "7:"; !strings.HasPrefix(string(data), want) {
+		t.Errorf("resume device = %q", data)
+	}
+}
+
+func TestRemoveTree(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"bin/sh", "etc/luks2-initramfs.json", "sysroot/sbin/init"} {
+		path := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	removeTree(dir, uint64(st.Dev), filepath.Join(dir, "sysroot")) // #nosec G115 -- test
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "sysroot" {
+		t.Errorf("left behind %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sysroot/sbin/init")); err != nil {
+		t.Errorf("new root was touched: %v", err)
+	}
+
+	// Nothing on another filesystem is removed
+	removeTree(dir, uint64(st.Dev)+1, "") // #nosec G115 -- test
+	if _, err := os.Stat(filepath.Join(dir, "sysroot/sbin/init")); err != nil {
+		t.Errorf("file on another filesystem removed: %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeConfig(t, `{"volumes": [{"name": "root", "device": "UUID=root"}], "root": {"volume": "root"}}`)
+	if code := run([]string{"-check", path}, &stdout, &stderr); code != 0 {
+		t.Errorf("check = %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "1 volume(s), root on root") {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+
+	stderr.Reset()
+	bad := writeConfig(t, `{"volumes": [{"name": "root", "device": "UUID=root"}], "root": {"volume": "usr"}}`)
+	if code := run([]string{"-check", bad}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "usr") {
+		t.Errorf("check of a bad config = %d: %s", code, stderr.String())
+	}
+
+	if code := run(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("run without arguments = %d", code)
+	}
+	stdout.Reset()
+	if code := run([]string{"-version"}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), Version) {
+		t.Errorf("version = %d: %s", code, stdout.String())
+	}
+}
+
+func TestDefaultResolveDevice(t *testing.T) {
+	ops := &DefaultBootOperations{}
+	missing := filepath.Join(t.TempDir(), "sda2")
+	if _, err := ops.ResolveDevice(missing); !errors.Is(err, luks2.ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound for a missing path, got %v", err)
+	}
+	if err := os.WriteFile(missing, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if dev, err := ops.ResolveDevice(missing); err != nil || dev != missing {
+		t.Errorf("ResolveDevice = %s, %v", dev, err)
+	}
+}
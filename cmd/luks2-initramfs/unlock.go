@@ -0,0 +1,281 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/pkcs11"
+	"golang.org/x/sys/unix"
+)
+
+// NewRoot is where the root filesystem is mounted before switching to it
+const NewRoot = "/sysroot"
+
+// devicePollInterval is how often a missing device is looked for
+var devicePollInterval = 250 * time.Millisecond
+
+// BootOperations are the library calls made while booting, so the boot
+// sequence can be tested without devices
+type BootOperations interface {
+	ResolveDevice(spec string) (string, error)
+	IsUnlocked(name string) bool
+	UnlockWithOptions(device string, key []byte, name string, opts *luks2.UnlockOptions) error
+	UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error
+	UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error
+	GetMappedDevicePath(name string) (string, error)
+	Mount(opts luks2.MountOptions) error
+}
+
+// DefaultBootOperations implements BootOperations with the luks2 package
+type DefaultBootOperations struct{}
+
+// ResolveDevice also fails for a path that does not exist yet, so plain
+// paths are waited for like UUID= and LABEL=
+func (d *DefaultBootOperations) ResolveDevice(spec string) (string, error) {
+	device, err := luks2.ResolveDevice(spec)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(device); err != nil {
+		return "", fmt.Errorf("%w: %s", luks2.ErrDeviceNotFound, device)
+	}
+	return device, nil
+}
+
+func (d *DefaultBootOperations) IsUnlocked(name string) bool {
+	return luks2.IsUnlocked(name)
+}
+
+func (d *DefaultBootOperations) UnlockWithOptions(device string, key []byte, name string, opts *luks2.UnlockOptions) error {
+	return luks2.UnlockWithOptions(device, key, name, opts)
+}
+
+func (d *DefaultBootOperations) UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+	return luks2.UnlockWithRetry(device, name, prompt, opts)
+}
+
+func (d *DefaultBootOperations) UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error {
+	if uri == "auto" {
+		var err error
+		if uri, err = luks2.PKCS11TokenURI(device); err != nil {
+			return err
+		}
+	}
+	key, err := pkcs11.Open(uri, pin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = key.Close() }()
+	return luks2.UnlockWithPKCS11(device, name, key, opts)
+}
+
+func (d *DefaultBootOperations) GetMappedDevicePath(name string) (string, error) {
+	return luks2.GetMappedDevicePath(name)
+}
+
+func (d *DefaultBootOperations) Mount(opts luks2.MountOptions) error {
+	return luks2.Mount(opts)
+}
+
+// Console is where prompts are shown and secrets typed
+type Console struct {
+	Out          io.Writer
+	ReadPassword func() ([]byte, error) // Reads a line without echo
+}
+
+// Printf writes a message to the console
+func (c *Console) Printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(c.Out, format, args...)
+}
+
+// prompt shows msg and reads a secret
+func (c *Console) prompt(msg string) ([]byte, error) {
+	c.Printf("%s", msg)
+	secret, err := c.ReadPassword()
+	c.Printf("\n")
+	return secret, err
+}
+
+// Booter unlocks the volumes of a Config and mounts its root filesystem
+type Booter struct {
+	Config  *Config
+	Ops     BootOperations
+	Console *Console
+	Args    kernelArgs
+	NewRoot string
+
+	// resumePath is the sysfs file a resume device is written to
+	resumePath string
+}
+
+// Boot unlocks every volume, resumes from hibernation if a resume volume
+// holds an image, then mounts the root filesystem at NewRoot. It returns
+// the init to execute on it.
+func (b *Booter) Boot() (string, error) {
+	for _, v := range b.Config.Volumes {
+		if err := b.unlock(v); err != nil {
+			return "", fmt.Errorf("failed to unlock %s: %w", v.Name, err)
+		}
+	}
+
+	// Resuming must happen before any filesystem is mounted
+	for _, v := range b.Config.Volumes {
+		if v.Resume {
+			if err := b.resume(v.Name); err != nil {
+				b.Console.Printf("Not resuming from %s: %v\n", v.Name, err)
+			}
+		}
+	}
+
+	if err := b.mountRoot(); err != nil {
+		return "", err
+	}
+
+	init := b.init()
+	if _, err := os.Stat(filepath.Join(b.NewRoot, init)); err != nil {
+		return "", fmt.Errorf("init %s not found on the root filesystem: %w", init, err)
+	}
+	return init, nil
+}
+
+// init returns the init to run: init= from the kernel command line, the
+// configured one, or DefaultInit
+func (b *Booter) init() string {
+	switch {
+	case b.Args.init != "":
+		return b.Args.init
+	case b.Config.Init != "":
+		return b.Config.Init
+	default:
+		return DefaultInit
+	}
+}
+
+// unlock opens a volume with the first key source that works: the key file,
+// the PKCS#11 token, then passphrases typed on the console
+func (b *Booter) unlock(v Volume) error {
+	if b.Ops.IsUnlocked(v.Name) {
+		return nil
+	}
+	device, err := b.waitDevice(v.Device)
+	if err != nil {
+		return err
+	}
+	opts := &luks2.UnlockOptions{AllowDiscards: v.AllowDiscards}
+
+	if v.KeyFile != "" {
+		key, err := os.ReadFile(v.KeyFile)
+		if err == nil {
+			err = b.Ops.UnlockWithOptions(device, key, v.Name, opts)
+			clear(key)
+		}
+		if err == nil {
+			return nil
+		}
+		b.Console.Printf("Key file for %s failed: %v\n", v.Name, err)
+	}
+
+	if v.PKCS11URI != "" {
+		pin, err := b.Console.prompt(fmt.Sprintf("Token PIN for %s: ", v.Name))
+		if err == nil {
+			err = b.Ops.UnlockWithPKCS11(device, v.Name, v.PKCS11URI, pin, opts)
+			clear(pin)
+		}
+		if err == nil {
+			return nil
+		}
+		b.Console.Printf("Token for %s failed: %v\n", v.Name, err)
+	}
+
+	prompt := func(attempt int) ([]byte, error) {
+		if attempt > 1 {
+			b.Console.Printf("No key available with this passphrase.\n")
+		}
+		return b.Console.prompt(fmt.Sprintf("Passphrase for %s (%s): ", v.Name, v.Device))
+	}
+	return b.Ops.UnlockWithRetry(device, v.Name, prompt, &luks2.RetryOptions{
+		MaxAttempts: b.Config.tries(),
+		Unlock:      opts,
+	})
+}
+
+// waitDevice resolves a device spec, waiting for the device to appear
+func (b *Booter) waitDevice(spec string) (string, error) {
+	deadline := time.Now().Add(b.Config.deviceTimeout())
+	waiting := false
+	for {
+		device, err := b.Ops.ResolveDevice(spec)
+		if err == nil {
+			return device, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("device %s did not appear: %w", spec, err)
+		}
+		if !waiting {
+			b.Console.Printf("Waiting for %s...\n", spec)
+			waiting = true
+		}
+		time.Sleep(devicePollInterval)
+	}
+}
+
+// resume hands an unlocked swap volume to the kernel, which restores the
+// hibernation image on it. Without an image the write returns and booting
+// continues.
+func (b *Booter) resume(name string) error {
+	path, err := b.Ops.GetMappedDevicePath(name)
+	if err != nil {
+		return err
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return fmt.Errorf("%s is not a block device", path)
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev))) // #nosec G115 -- Rdev is uint32 on some platforms
+
+	resumePath := b.resumePath
+	if resumePath == "" {
+		resumePath = "/sys/power/resume"
+	}
+	return os.WriteFile(resumePath, []byte(dev), 0)
+}
+
+// mountRoot mounts the root volume at NewRoot, read-only unless the kernel
+// command line says rw or the config sets its own options
+func (b *Booter) mountRoot() error {
+	if err := os.MkdirAll(b.NewRoot, 0755); err != nil { // #nosec G301 -- mount point
+		return err
+	}
+	data := b.Config.Root.Options
+	if data == "" {
+		data = "ro"
+		if b.Args.rw {
+			data = "rw"
+		}
+	}
+	err := b.Ops.Mount(luks2.MountOptions{
+		Device:     b.Config.Root.Volume,
+		MountPoint: b.NewRoot,
+		FSType:     b.Config.Root.FSType,
+		Data:       data,
+	})
+	// EBUSY: mounted by an earlier attempt that failed later on
+	if err != nil && !errors.Is(err, unix.EBUSY) {
+		return fmt.Errorf("failed to mount root: %w", err)
+	}
+	return nil
+}
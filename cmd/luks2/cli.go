@@ -2,35 +2,99 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/askpass"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/escrow"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/pkcs11"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/provision"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/udisks"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/unlockserver"
+	"golang.org/x/sys/unix"
 )
 
 // LuksOperations defines the interface for LUKS2 operations
 type LuksOperations interface {
 	Format(opts luks2.FormatOptions) error
 	Unlock(device string, passphrase []byte, name string) error
+	UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error
+	UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error
+	CreateEphemeral(name, device string, opts *luks2.EphemeralOptions) error
+	UnlockWithToken(device, name string, opts *luks2.TokenUnlockOptions) error
+	UnlockWithEscrow(device, name, service string, opts *luks2.UnlockOptions) error
+	EscrowKeyslot(device string, passphrase []byte, service string) (keyslot, tokenID int, err error)
+	EnrollPKCS11(device string, passphrase []byte, uri string, oaep bool) (keyslot, tokenID int, err error)
+	UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error
+	ServeUnlock(ctx context.Context, cfg unlockserver.Config) (pending []unlockserver.Volume, err error)
+	TestPassphrase(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error)
+	ListKeyslots(device string) ([]luks2.KeyslotInfo, error)
+	KillSlot(device string, passphrase []byte, keyslot int) error
+	SetKeyslotAnnotation(device string, keyslot int, ann luks2.KeyslotAnnotation) error
+	RemoveKeyslotAnnotation(device string, keyslot int) error
+	GetUUID(device string) (string, error)
+	ProbeSignatures(device string) ([]luks2.Signature, error)
+	SetUUID(device, uuid string) error
+	RegenerateUUID(device string) (string, error)
+	MatchUUID(device, uuid string) (bool, error)
+	SetLabel(device, label, subsystem string) error
 	Lock(name string) error
 	Mount(opts luks2.MountOptions) error
 	Unmount(mountPoint string, flags int) error
+	OpenAndMount(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error)
+	UnmountAndClose(mountPoint string) error
+	FindMountUsers(mountPoint string) ([]luks2.MountUser, error)
+	Trim(mountPoint string) (uint64, error)
+	ResizeWithOptions(name string, opts *luks2.ResizeOptions) error
 	GetVolumeInfo(device string) (*luks2.VolumeInfo, error)
 	Wipe(opts luks2.WipeOptions) error
 	SetupLoopDevice(filename string) (string, error)
+	SetupLoopPartition(filename string, partition int, opts *luks2.LoopOptions) (loop, device string, err error)
 	DetachLoopDevice(loopDev string) error
 	MakeFilesystem(volumeName, fstype, label string) error
 	IsMounted(mountPoint string) (bool, error)
 	IsUnlocked(name string) bool
+	ResolveDevice(spec string) (string, error)
+	Discover() ([]luks2.DiscoveredVolume, error)
+	Status(name string) (*luks2.VolumeStatus, error)
+	Validate(device string) (*luks2.ValidationReport, error)
+	Repair(device string) error
+	Audit(device string) (*luks2.AuditReport, error)
+	CheckTabFiles(crypttab, fstab string) (*luks2.TabReport, error)
+	FstabEntryFor(name string, opts *luks2.FstabOptions) (*luks2.FstabEntry, error)
+	RegisterVolume(vol luks2.ManagedVolume) error
+	SetVolumeMountPoint(name, mountPoint string) error
+	CloseVolume(name string, deferred bool) error
+	GCVolumes() ([]string, error)
+	Privileges() luks2.Privileges
+	UdisksOpenAndMount(device string, passphrase []byte, fsType, options string) (*udisks.Volume, error)
+	UdisksUnmountAndClose(mountPoint string) error
+	Provision(plan *provision.Plan, opts *provision.Options) *provision.Summary
 }
 
 // Terminal defines the interface for terminal operations
 type Terminal interface {
 	ReadPassword(fd int) ([]byte, error)
+	IsTerminal(fd int) bool
 }
 
 // FileSystem defines the interface for file system operations
@@ -53,6 +117,16 @@ type CLI struct {
 	ExitFunc   func(code int)
 	stdinFd    int
 	getStdinFd func() int
+
+	// Set by the global options (parseGlobalFlags)
+	assumeYes   bool   // --yes: skip confirmations
+	batch       bool   // --batch: --yes, and fail instead of prompting
+	keyFile     string // --key-file: passphrase file
+	envFile     string // --env-file: LUKS2_PASSPHRASE from a KEY=VALUE file
+	stdinPass   bool   // --stdin: passphrase on the first line of stdin
+	confirmUUID bool   // Destroying a LUKS volume needs its UUID (off with LUKS2_CONFIRM_UUID=0 unless --confirm-uuid)
+	knownUUID   string // --i-know-what-i-am-doing-<uuid>: confirms destroying that volume
+	passphrase  []byte // Scripted passphrase, read on first use
 }
 
 // DefaultLuksOperations implements LuksOperations using the actual luks2 package
@@ -66,6 +140,120 @@ func (d *DefaultLuksOperations) Unlock(device string, passphrase []byte, name st
 	return luks2.Unlock(device, passphrase, name)
 }
 
+func (d *DefaultLuksOperations) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	return luks2.UnlockWithOptions(device, passphrase, name, opts)
+}
+
+func (d *DefaultLuksOperations) UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+	return luks2.UnlockWithRetry(device, name, prompt, opts)
+}
+
+func (d *DefaultLuksOperations) UnlockWithToken(device, name string, opts *luks2.TokenUnlockOptions) error {
+	return luks2.UnlockWithToken(context.Background(), device, name, opts)
+}
+
+func (d *DefaultLuksOperations) UnlockWithEscrow(device, name, service string, opts *luks2.UnlockOptions) error {
+	e, err := escrow.FromEnv(service)
+	if err != nil {
+		return err
+	}
+	return luks2.UnlockWithEscrow(context.Background(), device, name, e, opts)
+}
+
+func (d *DefaultLuksOperations) EscrowKeyslot(device string, passphrase []byte, service string) (int, int, error) {
+	e, err := escrow.FromEnv(service)
+	if err != nil {
+		return -1, -1, err
+	}
+	recoveryKey, tokenID, err := luks2.EscrowRecoveryKey(context.Background(), device, passphrase, e, nil)
+	if recoveryKey == nil {
+		return -1, -1, err
+	}
+	ClearBytes(recoveryKey.Key)
+	return recoveryKey.Keyslot, tokenID, err
+}
+
+func (d *DefaultLuksOperations) EnrollPKCS11(device string, passphrase []byte, uri string, oaep bool) (int, int, error) {
+	key, err := pkcs11.Open(uri, nil)
+	if err != nil {
+		return -1, -1, err
+	}
+	defer func() { _ = key.Close() }()
+	return luks2.EnrollPKCS11(device, passphrase, key.URI(), key.Public(), &luks2.PKCS11Options{OAEP: oaep})
+}
+
+func (d *DefaultLuksOperations) UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error {
+	if uri == "auto" {
+		var err error
+		if uri, err = luks2.PKCS11TokenURI(device); err != nil {
+			return err
+		}
+	}
+	key, err := pkcs11.Open(uri, pin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = key.Close() }()
+	return luks2.UnlockWithPKCS11(device, name, key, opts)
+}
+
+func (d *DefaultLuksOperations) ServeUnlock(ctx context.Context, cfg unlockserver.Config) ([]unlockserver.Volume, error) {
+	server, err := unlockserver.New(cfg)
+	if err != nil {
+		return cfg.Volumes, err
+	}
+	err = server.ListenAndServe(ctx)
+	return server.Pending(), err
+}
+
+func (d *DefaultLuksOperations) TestPassphrase(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error) {
+	return luks2.TestPassphrase(device, passphrase, opts)
+}
+
+func (d *DefaultLuksOperations) ListKeyslots(device string) ([]luks2.KeyslotInfo, error) {
+	return luks2.ListKeyslots(device)
+}
+
+func (d *DefaultLuksOperations) KillSlot(device string, passphrase []byte, keyslot int) error {
+	return luks2.KillSlot(device, passphrase, keyslot)
+}
+
+func (d *DefaultLuksOperations) SetKeyslotAnnotation(device string, keyslot int, ann luks2.KeyslotAnnotation) error {
+	return luks2.SetKeyslotAnnotation(device, keyslot, ann)
+}
+
+func (d *DefaultLuksOperations) RemoveKeyslotAnnotation(device string, keyslot int) error {
+	return luks2.RemoveKeyslotAnnotation(device, keyslot)
+}
+
+func (d *DefaultLuksOperations) GetUUID(device string) (string, error) {
+	return luks2.GetUUID(device)
+}
+
+func (d *DefaultLuksOperations) ProbeSignatures(device string) ([]luks2.Signature, error) {
+	return luks2.ProbeSignatures(device)
+}
+
+func (d *DefaultLuksOperations) SetUUID(device, uuid string) error {
+	return luks2.SetUUID(device, uuid)
+}
+
+func (d *DefaultLuksOperations) RegenerateUUID(device string) (string, error) {
+	return luks2.RegenerateUUID(device)
+}
+
+func (d *DefaultLuksOperations) MatchUUID(device, uuid string) (bool, error) {
+	return luks2.MatchUUID(device, uuid)
+}
+
+func (d *DefaultLuksOperations) SetLabel(device, label, subsystem string) error {
+	return luks2.SetLabel(device, label, subsystem)
+}
+
+func (d *DefaultLuksOperations) CreateEphemeral(name, device string, opts *luks2.EphemeralOptions) error {
+	return luks2.CreateEphemeralWithOptions(name, device, opts)
+}
+
 func (d *DefaultLuksOperations) Lock(name string) error {
 	return luks2.Lock(name)
 }
@@ -78,6 +266,26 @@ func (d *DefaultLuksOperations) Unmount(mountPoint string, flags int) error {
 	return luks2.Unmount(mountPoint, flags)
 }
 
+func (d *DefaultLuksOperations) OpenAndMount(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error) {
+	return luks2.OpenAndMount(context.Background(), device, mountPoint, passphrase, opts)
+}
+
+func (d *DefaultLuksOperations) UnmountAndClose(mountPoint string) error {
+	return luks2.UnmountAndClose(mountPoint)
+}
+
+func (d *DefaultLuksOperations) FindMountUsers(mountPoint string) ([]luks2.MountUser, error) {
+	return luks2.FindMountUsers(mountPoint)
+}
+
+func (d *DefaultLuksOperations) Trim(mountPoint string) (uint64, error) {
+	return luks2.Trim(mountPoint)
+}
+
+func (d *DefaultLuksOperations) ResizeWithOptions(name string, opts *luks2.ResizeOptions) error {
+	return luks2.ResizeWithOptions(name, opts)
+}
+
 func (d *DefaultLuksOperations) GetVolumeInfo(device string) (*luks2.VolumeInfo, error) {
 	return luks2.GetVolumeInfo(device)
 }
@@ -90,6 +298,10 @@ func (d *DefaultLuksOperations) SetupLoopDevice(filename string) (string, error)
 	return luks2.SetupLoopDevice(filename)
 }
 
+func (d *DefaultLuksOperations) SetupLoopPartition(filename string, partition int, opts *luks2.LoopOptions) (string, string, error) {
+	return luks2.SetupLoopPartition(filename, partition, opts)
+}
+
 func (d *DefaultLuksOperations) DetachLoopDevice(loopDev string) error {
 	return luks2.DetachLoopDevice(loopDev)
 }
@@ -106,6 +318,83 @@ func (d *DefaultLuksOperations) IsUnlocked(name string) bool {
 	return luks2.IsUnlocked(name)
 }
 
+func (d *DefaultLuksOperations) ResolveDevice(spec string) (string, error) {
+	return luks2.ResolveDevice(spec)
+}
+
+func (d *DefaultLuksOperations) Discover() ([]luks2.DiscoveredVolume, error) {
+	return luks2.Discover()
+}
+
+func (d *DefaultLuksOperations) Status(name string) (*luks2.VolumeStatus, error) {
+	return luks2.Status(name)
+}
+
+func (d *DefaultLuksOperations) Validate(device string) (*luks2.ValidationReport, error) {
+	return luks2.Validate(device)
+}
+
+func (d *DefaultLuksOperations) Audit(device string) (*luks2.AuditReport, error) {
+	return luks2.Audit(device)
+}
+
+func (d *DefaultLuksOperations) CheckTabFiles(crypttab, fstab string) (*luks2.TabReport, error) {
+	return luks2.CheckTabFiles(crypttab, fstab)
+}
+
+func (d *DefaultLuksOperations) FstabEntryFor(name string, opts *luks2.FstabOptions) (*luks2.FstabEntry, error) {
+	return luks2.FstabEntryFor(name, opts)
+}
+
+func (d *DefaultLuksOperations) Repair(device string) error {
+	return luks2.Repair(device)
+}
+
+func (d *DefaultLuksOperations) RegisterVolume(vol luks2.ManagedVolume) error {
+	return luks2.NewVolumeManager("").Register(vol)
+}
+
+func (d *DefaultLuksOperations) SetVolumeMountPoint(name, mountPoint string) error {
+	return luks2.NewVolumeManager("").SetMountPoint(name, mountPoint)
+}
+
+func (d *DefaultLuksOperations) CloseVolume(name string, deferred bool) error {
+	if deferred {
+		return luks2.NewVolumeManager("").Close(name, luks2.WithDeferred())
+	}
+	return luks2.NewVolumeManager("").Close(name)
+}
+
+func (d *DefaultLuksOperations) GCVolumes() ([]string, error) {
+	return luks2.NewVolumeManager("").GC()
+}
+
+func (d *DefaultLuksOperations) Privileges() luks2.Privileges {
+	return luks2.ProbePrivileges()
+}
+
+func (d *DefaultLuksOperations) UdisksOpenAndMount(device string, passphrase []byte, fsType, options string) (*udisks.Volume, error) {
+	client, err := udisks.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+	return client.OpenAndMount(device, passphrase, fsType, options)
+}
+
+func (d *DefaultLuksOperations) UdisksUnmountAndClose(mountPoint string) error {
+	client, err := udisks.Connect()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	return client.UnmountAndClose(mountPoint)
+}
+
+func (d *DefaultLuksOperations) Provision(plan *provision.Plan, opts *provision.Options) *provision.Summary {
+	return provision.ApplyPlan(plan, opts)
+}
+
 // DefaultFileSystem implements FileSystem using the actual os package
 type DefaultFileSystem struct{}
 
@@ -142,41 +431,35 @@ func NewCLI() *CLI {
 
 // Run executes the CLI with the given arguments
 func (c *CLI) Run() int {
+	// Completion sees the command line as typed, global flags included
+	if len(c.Args) > 1 && c.Args[1] == "__complete" {
+		return c.cmdComplete(&cmdArgs{positional: c.Args[2:]})
+	}
+
+	if err := c.parseGlobalFlags(); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer func() { ClearBytes(c.passphrase) }()
+
 	if len(c.Args) < 2 {
 		c.showBanner()
-		_, _ = fmt.Fprint(c.Stdout, usage)
-		return 1
-	}
-
-	command := c.Args[1]
-
-	switch command {
-	case "create":
-		return c.cmdCreate()
-	case "open":
-		return c.cmdOpen()
-	case "close":
-		return c.cmdClose()
-	case "mount":
-		return c.cmdMount()
-	case "unmount":
-		return c.cmdUnmount()
-	case "info":
-		return c.cmdInfo()
-	case "wipe":
-		return c.cmdWipe()
-	case "help", "--help", "-h":
-		c.showBanner()
-		_, _ = fmt.Fprint(c.Stdout, usage)
-		return 0
-	case "version", "--version", "-v":
-		_, _ = fmt.Fprintf(c.Stdout, "luks2 version %s\n", Version)
-		return 0
-	default:
-		_, _ = fmt.Fprintf(c.Stderr, "Unknown command: %s\n\n", command)
-		_, _ = fmt.Fprint(c.Stdout, usage)
+		c.printUsage()
+		return 1
+	}
+
+	// Surface library warnings (e.g. network-backed devices) on stderr
+	luks2.SetWarningHandler(func(w luks2.Warning) {
+		_, _ = fmt.Fprintf(c.Stderr, "Warning: %s\n", w.Message)
+	})
+
+	cmd := findCommand(c.Args[1])
+	if cmd == nil || cmd.Hidden {
+		_, _ = fmt.Fprintf(c.Stderr, "Unknown command: %s\n\n", c.Args[1])
+		c.printUsage()
 		return 1
 	}
+	return c.runCommand(cmd, c.Args[2:])
 }
 
 func (c *CLI) showBanner() {
@@ -184,44 +467,68 @@ func (c *CLI) showBanner() {
 }
 
 // cmdCreate handles the create command
-func (c *CLI) cmdCreate() int {
-	if len(c.Args) < 3 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 create <path> [size] [filesystem]")
-		_, _ = fmt.Fprintln(c.Stdout, "\nFor block devices:")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 create /dev/sdb1")
-		_, _ = fmt.Fprintln(c.Stdout, "\nFor file volumes:")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 create encrypted.luks 100M")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 create encrypted.luks 1G ext4")
-		_, _ = fmt.Fprintln(c.Stdout, "\nSize suffixes: K, M, G, T")
-		_, _ = fmt.Fprintln(c.Stdout, "Filesystem types: ext4, ext3, ext2 (default: ext4)")
+func (c *CLI) cmdCreate(args *cmdArgs) int {
+	if args.Has("sparse") && args.Has("preallocate") {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --sparse and --preallocate are mutually exclusive")
+		return 1
+	}
+	alloc := luks2.AllocateSparse
+	if args.Has("preallocate") {
+		alloc = luks2.AllocatePreallocate
+	}
+	allocSet := args.Has("sparse") || args.Has("preallocate")
+	label := args.Value("label")
+
+	if len(args.positional) < 1 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: a device or file path is required")
 		return 1
 	}
 
-	path := c.Args[2]
+	path := args.positional[0]
 	isBlockDevice := len(path) >= 5 && path[:5] == "/dev/"
 
+	// A partition of an image file is formatted in place like a block device
+	if _, _, ok := luks2.SplitPartitionSpec(path); ok {
+		if allocSet || len(args.positional) > 1 {
+			_, _ = fmt.Fprintln(c.Stderr, "Error: a partition of an image file takes no size, filesystem, --sparse or --preallocate")
+			return 1
+		}
+		device, loop, err := c.imagePartition(path, false)
+		if err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer func() { _ = c.Luks.DetachLoopDevice(loop) }()
+		return c.cmdCreateBlockDevice(device, path, label)
+	}
+
 	if isBlockDevice {
-		return c.cmdCreateBlockDevice(path)
+		if allocSet {
+			_, _ = fmt.Fprintln(c.Stderr, "Error: --sparse and --preallocate only apply to file volumes")
+			return 1
+		}
+		return c.cmdCreateBlockDevice(path, path, label)
 	}
-	return c.cmdCreateFile(path)
+	return c.cmdCreateFile(path, args.positional[1:], alloc, label)
 }
 
-// cmdCreateFile creates a LUKS2 volume in a file with full automation
-func (c *CLI) cmdCreateFile(filename string) int {
-	if len(c.Args) < 4 {
+// cmdCreateFile creates a LUKS2 volume in a file with full automation. args
+// holds the size and optional filesystem type.
+func (c *CLI) cmdCreateFile(filename string, args []string, alloc luks2.Allocation, label string) int {
+	if len(args) < 1 {
 		_, _ = fmt.Fprintln(c.Stdout, "Error: Size required for file volumes")
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 create <file> <size> [filesystem]")
+		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 create [options] <file> <size> [filesystem]")
 		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 create encrypted.luks 100M ext4")
 		_, _ = fmt.Fprintln(c.Stdout, "\nSize suffixes: K, M, G, T")
 		_, _ = fmt.Fprintln(c.Stdout, "Filesystem types: ext4, ext3, ext2 (default: ext4)")
 		return 1
 	}
 
-	sizeStr := c.Args[3]
+	sizeStr := args[0]
 
 	fstype := "ext4"
-	if len(c.Args) > 4 {
-		fstype = c.Args[4]
+	if len(args) > 1 {
+		fstype = args[1]
 	}
 
 	c.showBanner()
@@ -242,18 +549,17 @@ func (c *CLI) cmdCreateFile(filename string) int {
 	}
 
 	// Create file
-	_, _ = fmt.Fprintf(c.Stdout, "Creating %s file...\n", sizeStr)
+	_, _ = fmt.Fprintf(c.Stdout, "Creating %s %s file...\n", sizeStr, alloc)
 	f, err := c.FS.Create(filename)
 	if err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "Failed to create file: %v\n", err)
 		return 1
 	}
 
-	// Truncate to desired size
-	if err := f.Truncate(size); err != nil {
+	if err := luks2.AllocateFile(f, size, alloc); err != nil {
 		_ = f.Close()
 		_ = c.FS.Remove(filename)
-		_, _ = fmt.Fprintf(c.Stderr, "Failed to set file size: %v\n", err)
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to allocate file: %v\n", err)
 		return 1
 	}
 	_ = f.Close()
@@ -272,10 +578,9 @@ func (c *CLI) cmdCreateFile(filename string) int {
 	}
 	defer ClearBytes(passphrase)
 
-	// Prompt for label
-	_, _ = fmt.Fprint(c.Stdout, "Enter volume label (optional, press Enter to skip): ")
-	var label string
-	_, _ = fmt.Fscanln(c.Stdin, &label)
+	if label == "" {
+		label = c.promptLabel()
+	}
 
 	// Create format options
 	opts := luks2.FormatOptions{
@@ -313,12 +618,15 @@ func (c *CLI) cmdCreateFile(filename string) int {
 	// Auto-unlock
 	_, _ = fmt.Fprintln(c.Stdout, "\nUnlocking volume...")
 	volumeName := "luks-auto"
-	if err := c.Luks.Unlock(loopDev, passphrase, volumeName); err != nil {
+	// The loop device goes away with the mapping on close
+	unlockOpts := &luks2.UnlockOptions{AutoDetachLoop: true}
+	if err := c.Luks.UnlockWithOptions(loopDev, passphrase, volumeName, unlockOpts); err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "Warning: Failed to unlock: %v\n", err)
 		_, _ = fmt.Fprintf(c.Stdout, "\nManual unlock: sudo luks2 open %s myvolume\n", loopDev)
 		return 0
 	}
 	_, _ = fmt.Fprintf(c.Stdout, "Volume unlocked as: /dev/mapper/%s\n", volumeName)
+	c.registerVolume(luks2.ManagedVolume{Name: volumeName, Device: filename, LoopDevice: loopDev})
 
 	// Auto-format filesystem
 	_, _ = fmt.Fprintf(c.Stdout, "\nCreating %s filesystem...\n", fstype)
@@ -336,6 +644,7 @@ func (c *CLI) cmdCreateFile(filename string) int {
 	_, _ = fmt.Fprintln(c.Stdout, "========================================")
 	_, _ = fmt.Fprintf(c.Stdout, "\nMount: sudo luks2 mount %s /mnt/encrypted\n", volumeName)
 	_, _ = fmt.Fprintln(c.Stdout, "Use:   ls /mnt/encrypted")
+	_, _ = fmt.Fprintf(c.Stdout, "fstab: sudo luks2 fstab %s /mnt/encrypted\n", volumeName)
 	_, _ = fmt.Fprintln(c.Stdout, "\nCleanup:")
 	_, _ = fmt.Fprintln(c.Stdout, "  sudo luks2 unmount /mnt/encrypted")
 	_, _ = fmt.Fprintf(c.Stdout, "  sudo luks2 close %s\n", volumeName)
@@ -343,11 +652,40 @@ func (c *CLI) cmdCreateFile(filename string) int {
 	return 0
 }
 
-// cmdCreateBlockDevice creates a LUKS2 volume on a block device
-func (c *CLI) cmdCreateBlockDevice(device string) int {
+// cmdCreateBlockDevice creates a LUKS2 volume on a block device. spec is the
+// device as the user named it, for the next steps.
+func (c *CLI) cmdCreateBlockDevice(device, spec, label string) int {
 	c.showBanner()
 	_, _ = fmt.Fprintf(c.Stdout, "Creating LUKS2 volume on block device: %s\n\n", device)
 
+	// Formatting over a volume or other data destroys it, so that needs
+	// confirming
+	force := false
+	uuid, err := c.Luks.GetUUID(device)
+	if err != nil {
+		uuid = ""
+	}
+	sigs, err := c.Luks.ProbeSignatures(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if uuid != "" || len(sigs) > 0 {
+		if uuid != "" {
+			_, _ = fmt.Fprintf(c.Stdout, "*** WARNING: %s already holds LUKS volume %s ***\n", device, uuid)
+		} else {
+			_, _ = fmt.Fprintf(c.Stdout, "*** WARNING: %s is not empty ***\n", device)
+		}
+		for _, sig := range sigs {
+			_, _ = fmt.Fprintf(c.Stdout, "  %s\n", sig)
+		}
+		_, _ = fmt.Fprintln(c.Stdout, "Formatting it PERMANENTLY DESTROYS that data.")
+		if ok, code := c.confirmDestroy(device, uuid, "format"); !ok {
+			return code
+		}
+		force = true
+	}
+
 	// Prompt for passphrase
 	passphrase, err := c.promptPassphrase("Enter passphrase for new volume: ", true)
 	if err != nil {
@@ -356,10 +694,9 @@ func (c *CLI) cmdCreateBlockDevice(device string) int {
 	}
 	defer ClearBytes(passphrase)
 
-	// Prompt for label
-	_, _ = fmt.Fprint(c.Stdout, "Enter volume label (optional, press Enter to skip): ")
-	var label string
-	_, _ = fmt.Fscanln(c.Stdin, &label)
+	if label == "" {
+		label = c.promptLabel()
+	}
 
 	// Create format options
 	opts := luks2.FormatOptions{
@@ -367,6 +704,7 @@ func (c *CLI) cmdCreateBlockDevice(device string) int {
 		Passphrase: passphrase,
 		Label:      label,
 		KDFType:    "argon2id",
+		Force:      force,
 	}
 
 	_, _ = fmt.Fprintln(c.Stdout, "\nCreating LUKS2 volume...")
@@ -382,41 +720,170 @@ func (c *CLI) cmdCreateBlockDevice(device string) int {
 
 	_, _ = fmt.Fprintln(c.Stdout, "\nLUKS2 volume created successfully!")
 	_, _ = fmt.Fprintln(c.Stdout, "\nNext steps:")
-	_, _ = fmt.Fprintf(c.Stdout, "  1. Open:  sudo luks2 open %s myvolume\n", device)
+	_, _ = fmt.Fprintf(c.Stdout, "  1. Open:  sudo luks2 open %s myvolume\n", spec)
 	_, _ = fmt.Fprintln(c.Stdout, "  2. Mount: sudo luks2 mount myvolume /mnt/encrypted")
+	_, _ = fmt.Fprintln(c.Stdout, "  3. fstab: sudo luks2 fstab myvolume /mnt/encrypted")
 
 	return 0
 }
 
 // cmdOpen unlocks a LUKS2 volume
-func (c *CLI) cmdOpen() int {
-	if len(c.Args) < 4 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 open <device> <name>")
-		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 open /dev/sdb1 my-encrypted-disk")
+func (c *CLI) cmdOpen(args *cmdArgs) int {
+	opts := &luks2.UnlockOptions{
+		AllowDiscards:       args.Has("allow-discards"),
+		SameCPUCrypt:        args.Has("perf-same_cpu_crypt"),
+		SubmitFromCryptCPUs: args.Has("perf-submit_from_crypt_cpus"),
+		NoReadWorkqueue:     args.Has("perf-no_read_workqueue"),
+		NoWriteWorkqueue:    args.Has("perf-no_write_workqueue"),
+	}
+	retry := &luks2.RetryOptions{
+		MaxAttempts: luks2.DefaultUnlockAttempts,
+		StateFile:   args.Value("retry-state"),
+		Unlock:      opts,
+	}
+	escrowService, pkcs11URI := args.Value("escrow"), args.Value("pkcs11-token-uri")
+	for _, name := range []string{"tries", "lockout"} {
+		v, ok := args.Lookup(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: invalid --%s value: %s\n", name, v)
+			return 1
+		}
+		if name == "tries" {
+			retry.MaxAttempts = n
+		} else {
+			retry.LockoutThreshold = n
+		}
+	}
+	keyslot, ok := c.keySlot(args)
+	if !ok {
 		return 1
 	}
+	opts.Keyslot = keyslot
+	tokenOpts := &luks2.TokenUnlockOptions{TokenType: args.Value("token-type"), External: true, Unlock: opts}
+	tokenOnly := args.Has("token-only") || tokenOpts.TokenType != ""
+	if v, ok := args.Lookup("token-id"); ok {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 || id >= luks2.MaxTokenSlots {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: invalid --token-id value: %s (must be 0-%d)\n", v, luks2.MaxTokenSlots-1)
+			return 1
+		}
+		tokenOpts.TokenID = &id
+		tokenOnly = true
+	}
+	positional := args.positional
 
-	device := c.Args[2]
-	name := c.Args[3]
-
-	c.showBanner()
-	_, _ = fmt.Fprintf(c.Stdout, "Opening LUKS2 volume: %s -> %s\n\n", device, name)
+	if len(positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device path and mapping name required")
+		return 1
+	}
+	if retry.LockoutThreshold > 0 && retry.StateFile == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --lockout requires --retry-state")
+		return 1
+	}
+	methods := 0
+	for _, set := range []bool{escrowService != "", pkcs11URI != "", tokenOnly} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --escrow, --pkcs11-token-uri and the --token-* options are mutually exclusive")
+		return 1
+	}
+	if opts.Keyslot != nil && methods > 0 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --key-slot applies to passphrases; tokens unlock their own keyslot")
+		return 1
+	}
+	device, err := c.Luks.ResolveDevice(positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	name := positional[1]
 
-	// Prompt for passphrase
-	passphrase, err := c.promptPassphrase("Enter passphrase: ", false)
+	// The loop device of an image partition goes away with the mapping
+	spec := device
+	device, loop, err := c.imagePartition(spec, false)
 	if err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
 		return 1
 	}
-	defer ClearBytes(passphrase)
+	opened := false
+	if loop != "" {
+		opts.AutoDetachLoop = true
+		defer func() {
+			if !opened {
+				_ = c.Luks.DetachLoopDevice(loop)
+			}
+		}()
+	}
 
-	_, _ = fmt.Fprintln(c.Stdout, "\nUnlocking volume...")
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Opening LUKS2 volume: %s -> %s\n\n", device, name)
+
+	if opts.AllowDiscards {
+		_, _ = fmt.Fprintln(c.Stderr, "WARNING: discards are enabled. TRIM reveals which blocks are unused,")
+		_, _ = fmt.Fprintln(c.Stderr, "         exposing filesystem type and usage patterns on the device.")
+	}
+
+	if methods > 0 {
+		switch {
+		case escrowService != "":
+			_, _ = fmt.Fprintf(c.Stdout, "Unwrapping escrowed key with %s...\n", escrowService)
+			err = c.Luks.UnlockWithEscrow(device, name, escrowService, opts)
+		case tokenOnly:
+			_, _ = fmt.Fprintln(c.Stdout, "Unlocking with token handlers...")
+			err = c.Luks.UnlockWithToken(device, name, tokenOpts)
+		default:
+			var pin []byte
+			if pin, err = c.promptSecret("Enter PIN for security token: ", false); err != nil {
+				_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			err = c.Luks.UnlockWithPKCS11(device, name, pkcs11URI, pin, opts)
+			ClearBytes(pin)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "\nFailed to unlock volume: %v\n", err)
+			return 1
+		}
+		opened = true
+		c.registerVolume(luks2.ManagedVolume{Name: name, Device: spec, LoopDevice: loop})
+		_, _ = fmt.Fprintln(c.Stdout, "\nVolume unlocked successfully!")
+		_, _ = fmt.Fprintf(c.Stdout, "\nDevice mapper created: /dev/mapper/%s\n", name)
+		return 0
+	}
+
+	// Prompt for the passphrase, re-prompting after a wrong one. The library
+	// clears each passphrase after its attempt.
+	prompt := func(attempt int) ([]byte, error) {
+		if attempt > 1 {
+			// A scripted passphrase would only be rejected again
+			if c.scripted() {
+				return nil, errors.New("no key available with this passphrase")
+			}
+			_, _ = fmt.Fprintf(c.Stderr, "No key available with this passphrase (attempt %d of %d).\n", attempt, retry.MaxAttempts)
+		}
+		passphrase, err := c.promptPassphrase("Enter passphrase: ", false)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintln(c.Stdout, "\nUnlocking volume...")
+		return passphrase, nil
+	}
 
-	if err := c.Luks.Unlock(device, passphrase, name); err != nil {
+	if err := c.Luks.UnlockWithRetry(device, name, prompt, retry); err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to unlock volume: %v\n", err)
 		return 1
 	}
 
+	opened = true
+	c.registerVolume(luks2.ManagedVolume{Name: name, Device: spec, LoopDevice: loop})
+
 	_, _ = fmt.Fprintln(c.Stdout, "\nVolume unlocked successfully!")
 	_, _ = fmt.Fprintf(c.Stdout, "\nDevice mapper created: /dev/mapper/%s\n", name)
 	_, _ = fmt.Fprintln(c.Stdout, "\nNext steps:")
@@ -426,22 +893,84 @@ func (c *CLI) cmdOpen() int {
 	return 0
 }
 
-// cmdClose locks a LUKS2 volume
-func (c *CLI) cmdClose() int {
-	if len(c.Args) < 3 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 close <name>")
-		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 close my-encrypted-disk")
+// keySlot parses --key-slot, returning nil when it is not given. An invalid
+// value is reported and ok is false.
+func (c *CLI) keySlot(args *cmdArgs) (keyslot *int, ok bool) {
+	v, set := args.Lookup("key-slot")
+	if !set {
+		return nil, true
+	}
+	slot, err := strconv.Atoi(v)
+	if err != nil || slot < 0 || slot >= luks2.MaxKeyslots {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: invalid --key-slot value: %s (must be 0-%d)\n", v, luks2.MaxKeyslots-1)
+		return nil, false
+	}
+	return &slot, true
+}
+
+// imagePartition attaches the image of a partition spec ("disk.img:1", see
+// luks2.SplitPartitionSpec) with its partitions scanned, and returns the
+// partition's device and the loop device to detach when done. Any other
+// spec is returned as the device, with no loop device.
+func (c *CLI) imagePartition(spec string, readOnly bool) (device, loop string, err error) {
+	file, partition, ok := luks2.SplitPartitionSpec(spec)
+	if !ok {
+		return spec, "", nil
+	}
+	loop, device, err = c.Luks.SetupLoopPartition(file, partition, &luks2.LoopOptions{ReadOnly: readOnly})
+	if err != nil {
+		return "", "", err
+	}
+	return device, loop, nil
+}
+
+// cmdTest checks a passphrase against the keyslots without unlocking
+func (c *CLI) cmdTest(args *cmdArgs) int {
+	keyslot, ok := c.keySlot(args)
+	if !ok {
+		return 1
+	}
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	passphrase, err := c.promptPassphrase("Enter passphrase: ", false)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer ClearBytes(passphrase)
+
+	slot, err := c.Luks.TestPassphrase(device, passphrase, &luks2.UnlockOptions{Keyslot: keyslot})
+	if errors.Is(err, luks2.ErrInvalidPassphrase) {
+		_, _ = fmt.Fprintln(c.Stderr, "No key available with this passphrase.")
 		return 1
 	}
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to test passphrase: %v\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Passphrase opens keyslot %d\n", slot)
+	return 0
+}
 
-	name := c.Args[2]
+// cmdClose locks a LUKS2 volume
+func (c *CLI) cmdClose(args *cmdArgs) int {
+	deferred := args.Has("deferred")
+	if len(args.positional) != 1 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: volume name required")
+		return 1
+	}
+	name := args.positional[0]
 
 	c.showBanner()
 	_, _ = fmt.Fprintf(c.Stdout, "Closing LUKS2 volume: %s\n\n", name)
 
-	// Check if mounted
+	// Check if mounted; a deferred close waits for the unmount instead
 	mounted, err := c.Luks.IsMounted("/dev/mapper/" + name)
-	if err == nil && mounted {
+	if err == nil && mounted && !deferred {
 		_, _ = fmt.Fprintln(c.Stderr, "Volume is still mounted!")
 		_, _ = fmt.Fprintln(c.Stderr, "Please unmount first: sudo luks2 unmount <mountpoint>")
 		return 1
@@ -449,37 +978,125 @@ func (c *CLI) cmdClose() int {
 
 	_, _ = fmt.Fprintln(c.Stdout, "Locking volume...")
 
-	if err := c.Luks.Lock(name); err != nil {
+	// Also unmounts and detaches whatever luks2 recorded for the volume
+	if err := c.Luks.CloseVolume(name, deferred); err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to lock volume: %v\n", err)
+		if errors.Is(err, unix.EBUSY) {
+			_, _ = fmt.Fprintf(c.Stderr, "\nThe volume is in use. Close it once it is released with: luks2 close --deferred %s\n", name)
+		}
 		return 1
 	}
 
+	if deferred && c.Luks.IsUnlocked(name) {
+		_, _ = fmt.Fprintln(c.Stdout, "\nVolume is in use; removal deferred.")
+		_, _ = fmt.Fprintf(c.Stdout, "/dev/mapper/%s is removed once its last user closes it.\n", name)
+		return 0
+	}
+
 	_, _ = fmt.Fprintln(c.Stdout, "\nVolume locked successfully!")
 	_, _ = fmt.Fprintf(c.Stdout, "\nDevice mapper removed: /dev/mapper/%s\n", name)
 
 	return 0
 }
 
-// cmdMount mounts an unlocked LUKS2 volume
-func (c *CLI) cmdMount() int {
-	if len(c.Args) < 4 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 mount <name> <mountpoint>")
-		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 mount my-encrypted-disk /mnt/encrypted")
+// cmdEphemeral maps a device with a fresh random key for swap or scratch space
+func (c *CLI) cmdEphemeral(args *cmdArgs) int {
+	if len(args.positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device path and mapping name required")
 		return 1
 	}
 
-	name := c.Args[2]
-	mountpoint := c.Args[3]
-
-	c.showBanner()
-	_, _ = fmt.Fprintf(c.Stdout, "Mounting volume: %s -> %s\n\n", name, mountpoint)
-
-	// Check if already mounted
-	mounted, _ := c.Luks.IsMounted(mountpoint)
-	if mounted {
-		_, _ = fmt.Fprintf(c.Stderr, "Mountpoint already in use: %s\n", mountpoint)
-		return 1
-	}
+	// crypttab options first; the dedicated flags override them
+	opts := &luks2.EphemeralOptions{Unlock: &luks2.UnlockOptions{}}
+	if v, ok := args.Lookup("options"); ok {
+		var err error
+		if opts, err = luks2.ParseEphemeralOptions(strings.Split(v, ",")); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if v, ok := args.Lookup("cipher"); ok {
+		opts.Cipher = v
+	}
+	if v, ok := args.Lookup("key-size"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: invalid --key-size value: %s\n", v)
+			return 1
+		}
+		opts.KeySize = n
+	}
+	if v, ok := args.Lookup("tmp"); ok {
+		opts.Filesystem = v
+	}
+	if v, ok := args.Lookup("label"); ok {
+		opts.Label = v
+	}
+	opts.Swap = opts.Swap || args.Has("swap")
+	opts.Force = args.Has("force")
+	opts.Unlock.AllowDiscards = opts.Unlock.AllowDiscards || args.Has("allow-discards")
+	if opts.Swap && opts.Filesystem != "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --swap and --tmp are mutually exclusive")
+		return 1
+	}
+
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	name := args.positional[1]
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Opening ephemeral volume: %s -> %s\n", device, name)
+	_, _ = fmt.Fprintln(c.Stdout, "The key is random and never stored: the contents are lost when it is closed.")
+
+	if err := c.Luks.CreateEphemeral(name, device, opts); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to open ephemeral volume: %v\n", err)
+		if errors.Is(err, luks2.ErrDeviceNotEmpty) {
+			_, _ = fmt.Fprintln(c.Stderr, "\nIts contents would be destroyed. Check the device, then pass --force.")
+		}
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(c.Stdout, "\nDevice mapper created: /dev/mapper/%s\n", name)
+	switch {
+	case opts.Swap:
+		_, _ = fmt.Fprintf(c.Stdout, "Swap area ready: swapon /dev/mapper/%s\n", name)
+	case opts.Filesystem != "":
+		_, _ = fmt.Fprintf(c.Stdout, "%s filesystem ready: luks2 mount %s <mountpoint>\n", opts.Filesystem, name)
+	}
+	return 0
+}
+
+// cmdMount mounts an unlocked LUKS2 volume
+func (c *CLI) cmdMount(args *cmdArgs) int {
+	opts := luks2.MountOptions{
+		FSType:     args.Value("type"),
+		Data:       args.Value("options"),
+		DataSafety: luks2.DataSafety(args.Value("data-safety")),
+	}
+	positional := args.positional
+
+	if len(positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: volume name and mountpoint required")
+		return 1
+	}
+
+	name := positional[0]
+	mountpoint := positional[1]
+	opts.Device = name
+	opts.MountPoint = mountpoint
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Mounting volume: %s -> %s\n\n", name, mountpoint)
+
+	// Check if already mounted
+	mounted, _ := c.Luks.IsMounted(mountpoint)
+	if mounted {
+		_, _ = fmt.Fprintf(c.Stderr, "Mountpoint already in use: %s\n", mountpoint)
+		return 1
+	}
 
 	// Create mountpoint if it doesn't exist
 	if _, err := c.FS.Stat(mountpoint); os.IsNotExist(err) {
@@ -490,14 +1107,6 @@ func (c *CLI) cmdMount() int {
 		}
 	}
 
-	opts := luks2.MountOptions{
-		Device:     name,
-		MountPoint: mountpoint,
-		FSType:     "ext4",
-		Flags:      0,
-		Data:       "",
-	}
-
 	_, _ = fmt.Fprintln(c.Stdout, "Mounting...")
 
 	if err := c.Luks.Mount(opts); err != nil {
@@ -507,6 +1116,10 @@ func (c *CLI) cmdMount() int {
 		return 1
 	}
 
+	if err := c.Luks.SetVolumeMountPoint(name, mountpoint); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Warning: failed to record mount point: %v\n", err)
+	}
+
 	_, _ = fmt.Fprintln(c.Stdout, "\nVolume mounted successfully!")
 	_, _ = fmt.Fprintf(c.Stdout, "\nYou can now use: %s\n", mountpoint)
 
@@ -514,14 +1127,19 @@ func (c *CLI) cmdMount() int {
 }
 
 // cmdUnmount unmounts a LUKS2 volume
-func (c *CLI) cmdUnmount() int {
-	if len(c.Args) < 3 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 unmount <mountpoint>")
-		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 unmount /mnt/encrypted")
+func (c *CLI) cmdUnmount(args *cmdArgs) int {
+	flags := 0
+	if args.Has("force") {
+		flags |= unix.MNT_FORCE
+	}
+	if args.Has("lazy") {
+		flags |= unix.MNT_DETACH
+	}
+	if len(args.positional) != 1 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: mountpoint required")
 		return 1
 	}
-
-	mountpoint := c.Args[2]
+	mountpoint := args.positional[0]
 
 	c.showBanner()
 	_, _ = fmt.Fprintf(c.Stdout, "Unmounting: %s\n\n", mountpoint)
@@ -535,207 +1153,1555 @@ func (c *CLI) cmdUnmount() int {
 
 	_, _ = fmt.Fprintln(c.Stdout, "Unmounting...")
 
-	if err := c.Luks.Unmount(mountpoint, 0); err != nil {
+	if err := c.Luks.Unmount(mountpoint, flags); err != nil {
 		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to unmount: %v\n", err)
-		_, _ = fmt.Fprintf(c.Stderr, "\nTry forcing unmount with: umount -l %s\n", mountpoint)
+		if errors.Is(err, unix.EBUSY) {
+			c.printMountUsers(mountpoint)
+		}
 		return 1
 	}
 
+	if flags&unix.MNT_DETACH != 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nVolume detached; it is released once no process uses it.")
+		_, _ = fmt.Fprintln(c.Stdout, "The volume cannot be closed until then.")
+		return 0
+	}
+
 	_, _ = fmt.Fprintln(c.Stdout, "\nVolume unmounted successfully!")
 
 	return 0
 }
 
-// cmdInfo displays volume information
-func (c *CLI) cmdInfo() int {
-	if len(c.Args) < 3 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 info <device>")
-		_, _ = fmt.Fprintln(c.Stdout, "Example: luks2 info /dev/sdb1")
+// printMountUsers reports the processes keeping a mount point busy
+func (c *CLI) printMountUsers(mountpoint string) {
+	users, err := c.Luks.FindMountUsers(mountpoint)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Could not list processes using %s: %v\n", mountpoint, err)
+		return
+	}
+	if len(users) == 0 {
+		_, _ = fmt.Fprintf(c.Stderr, "\nNo processes found using %s (run as root to see all processes).\n", mountpoint)
+	} else {
+		_, _ = fmt.Fprintf(c.Stderr, "\nProcesses using %s:\n", mountpoint)
+		w := tabwriter.NewWriter(c.Stderr, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  PID\tCOMMAND\tACCESS")
+		for _, u := range users {
+			_, _ = fmt.Fprintf(w, "  %d\t%s\t%s\n", u.PID, u.Command, strings.Join(u.Access, ","))
+		}
+		_ = w.Flush()
+	}
+	_, _ = fmt.Fprintf(c.Stderr, "\nStop these processes and retry, or detach now with: luks2 unmount --lazy %s\n", mountpoint)
+}
+
+// cmdTrim discards the free space of a mounted volume
+func (c *CLI) cmdTrim(args *cmdArgs) int {
+	mountpoint := args.positional[0]
+
+	trimmed, err := c.Luks.Trim(mountpoint)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to trim: %v\n", err)
 		return 1
 	}
 
-	device := c.Args[2]
+	_, _ = fmt.Fprintf(c.Stdout, "%s: %d bytes trimmed\n", mountpoint, trimmed)
+
+	return 0
+}
+
+// cmdUp opens a device or image file and mounts it in one step
+func (c *CLI) cmdUp(args *cmdArgs) int {
+	opts := &luks2.OpenMountOptions{
+		Name:             args.Value("name"),
+		FSType:           args.Value("type"),
+		Data:             args.Value("options"),
+		Unlock:           &luks2.UnlockOptions{AllowDiscards: args.Has("allow-discards")},
+		CreateMountPoint: true,
+	}
+	positional := args.positional
+
+	if len(positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device and mountpoint required")
+		return 1
+	}
+	device, mountpoint := positional[0], positional[1]
 
 	c.showBanner()
-	_, _ = fmt.Fprintf(c.Stdout, "Volume Information: %s\n", device)
-	_, _ = fmt.Fprintln(c.Stdout, "===========================================================")
+	_, _ = fmt.Fprintf(c.Stdout, "Opening and mounting: %s -> %s\n\n", device, mountpoint)
+
+	// Image files also need a loop device
+	isFile := !strings.HasPrefix(device, "/dev/") && !strings.Contains(device, "=")
+	privErr := c.Luks.Privileges().Check("up", isFile)
+	if privErr != nil {
+		_, _ = fmt.Fprintf(c.Stdout, "Not running as root (%v).\n", privErr)
+		_, _ = fmt.Fprintln(c.Stdout, "Opening through UDisks2; it chooses the mapping name and mount point.")
+		_, _ = fmt.Fprintln(c.Stdout, "")
+		if opts.Name != "" || opts.Unlock.AllowDiscards {
+			_, _ = fmt.Fprintln(c.Stderr, "Warning: --name and --allow-discards are ignored by UDisks2")
+		}
+	}
 
-	info, err := c.Luks.GetVolumeInfo(device)
+	passphrase, err := c.promptPassphrase("Enter passphrase: ", false)
 	if err != nil {
-		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to read volume: %v\n", err)
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	defer ClearBytes(passphrase)
 
-	_, _ = fmt.Fprintf(c.Stdout, "\nUUID:           %s\n", info.UUID)
-	_, _ = fmt.Fprintf(c.Stdout, "Label:          %s\n", info.Label)
-	_, _ = fmt.Fprintf(c.Stdout, "Version:        LUKS%d\n", info.Version)
-	_, _ = fmt.Fprintf(c.Stdout, "Cipher:         %s\n", info.Cipher)
-	_, _ = fmt.Fprintf(c.Stdout, "Sector Size:    %d bytes\n", info.SectorSize)
-	_, _ = fmt.Fprintf(c.Stdout, "Active Keyslots: %v\n", info.ActiveKeyslots)
+	if privErr != nil {
+		return c.upWithUdisks(device, passphrase, opts)
+	}
 
-	if len(info.ActiveKeyslots) > 0 {
-		_, _ = fmt.Fprintln(c.Stdout, "\nKeyslot Details:")
-		for _, slot := range info.ActiveKeyslots {
-			ks := info.Metadata.Keyslots[fmt.Sprintf("%d", slot)]
-			if ks != nil {
-				_, _ = fmt.Fprintf(c.Stdout, "  Slot %d: %s (key size: %d bytes)\n", slot, ks.KDF.Type, ks.KeySize)
+	vol, err := c.Luks.OpenAndMount(device, mountpoint, passphrase, opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to open volume: %v\n", err)
+		return 1
+	}
+
+	c.registerVolume(luks2.ManagedVolume{Name: vol.Name, Device: vol.Device, LoopDevice: vol.LoopDevice, MountPoint: vol.MountPoint})
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nVolume is up!")
+	if vol.LoopDevice != "" {
+		_, _ = fmt.Fprintf(c.Stdout, "\nLoop device:    %s\n", vol.LoopDevice)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Device mapper:  /dev/mapper/%s\n", vol.Name)
+	_, _ = fmt.Fprintf(c.Stdout, "Mounted on:     %s (%s)\n", vol.MountPoint, vol.FSType)
+	_, _ = fmt.Fprintf(c.Stdout, "\nTear down with: sudo luks2 down %s\n", vol.MountPoint)
+
+	return 0
+}
+
+// cmdDown unmounts and closes a volume brought up with cmdUp
+func (c *CLI) cmdDown(args *cmdArgs) int {
+	mountpoint := args.positional[0]
+
+	if c.Luks.Privileges().Check("down", false) != nil {
+		if err := c.Luks.UdisksUnmountAndClose(mountpoint); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Failed to close volume through UDisks2: %v\n", err)
+			if errors.Is(err, udisks.ErrNotAvailable) {
+				_, _ = fmt.Fprintln(c.Stderr, "Run it with sudo.")
 			}
+			return 1
 		}
+		_, _ = fmt.Fprintf(c.Stdout, "Volume at %s unmounted and closed\n", mountpoint)
+		return 0
 	}
 
-	_, _ = fmt.Fprintln(c.Stdout, "\nVolume is valid and accessible")
+	if err := c.Luks.UnmountAndClose(mountpoint); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to close volume: %v\n", err)
+		return 1
+	}
+	// Drop the registry record of the mapping that was just closed
+	_, _ = c.Luks.GCVolumes()
+
+	_, _ = fmt.Fprintf(c.Stdout, "Volume at %s unmounted and closed\n", mountpoint)
 
 	return 0
 }
 
-// cmdWipe securely wipes a LUKS2 volume
-func (c *CLI) cmdWipe() int {
-	if len(c.Args) < 3 {
-		_, _ = fmt.Fprintln(c.Stdout, "Usage: luks2 wipe [options] <device>")
-		_, _ = fmt.Fprintln(c.Stdout, "")
-		_, _ = fmt.Fprintln(c.Stdout, "Options:")
-		_, _ = fmt.Fprintln(c.Stdout, "  --full           Wipe entire device (default: headers only)")
-		_, _ = fmt.Fprintln(c.Stdout, "  --passes N       Number of overwrite passes (default: 1)")
-		_, _ = fmt.Fprintln(c.Stdout, "  --random         Use random data instead of zeros")
-		_, _ = fmt.Fprintln(c.Stdout, "  --trim           Issue TRIM/DISCARD after wipe (for SSDs)")
-		_, _ = fmt.Fprintln(c.Stdout, "")
-		_, _ = fmt.Fprintln(c.Stdout, "Examples:")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 wipe /dev/sdb1                    # Wipe headers only (fast)")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 wipe --full /dev/sdb1             # Wipe entire device")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 wipe --full --passes 3 /dev/sdb1  # DoD-style 3-pass wipe")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 wipe --full --random /dev/sdb1    # Random data wipe")
-		_, _ = fmt.Fprintln(c.Stdout, "  luks2 wipe --full --trim /dev/ssd1      # Full wipe + TRIM for SSD")
+// upWithUdisks opens and mounts a volume through UDisks2 for cmdUp when
+// running without root
+func (c *CLI) upWithUdisks(device string, passphrase []byte, opts *luks2.OpenMountOptions) int {
+	vol, err := c.Luks.UdisksOpenAndMount(device, passphrase, opts.FSType, opts.Data)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to open volume through UDisks2: %v\n", err)
+		if errors.Is(err, udisks.ErrNotAvailable) {
+			_, _ = fmt.Fprintln(c.Stderr, "Run it with sudo.")
+		}
 		return 1
 	}
 
-	// Parse options
-	opts := luks2.WipeOptions{
-		Passes:     1,
-		Random:     false,
-		HeaderOnly: true,
-		Trim:       false,
+	_, _ = fmt.Fprintln(c.Stdout, "\nVolume is up!")
+	if vol.LoopDevice != "" {
+		_, _ = fmt.Fprintf(c.Stdout, "\nLoop device:    %s\n", vol.LoopDevice)
 	}
+	_, _ = fmt.Fprintf(c.Stdout, "Unlocked as:    %s\n", vol.Cleartext)
+	_, _ = fmt.Fprintf(c.Stdout, "Mounted on:     %s\n", vol.MountPoint)
+	_, _ = fmt.Fprintf(c.Stdout, "\nTear down with: luks2 down %s\n", vol.MountPoint)
 
-	var device string
-	for i := 2; i < len(c.Args); i++ {
-		switch c.Args[i] {
-		case "--full":
-			opts.HeaderOnly = false
-		case "--random":
-			opts.Random = true
-		case "--trim":
-			opts.Trim = true
-		case "--passes":
-			if i+1 < len(c.Args) {
-				i++
-				var passes int
-				_, err := fmt.Sscanf(c.Args[i], "%d", &passes)
-				if err != nil || passes < 1 {
-					_, _ = fmt.Fprintf(c.Stderr, "Invalid passes value: %s (must be >= 1)\n", c.Args[i])
-					return 1
-				}
-				opts.Passes = passes
-			} else {
-				_, _ = fmt.Fprintln(c.Stderr, "--passes requires a value")
-				return 1
-			}
-		default:
-			if c.Args[i][0] == '-' {
-				_, _ = fmt.Fprintf(c.Stderr, "Unknown option: %s\n", c.Args[i])
-				return 1
-			}
-			device = c.Args[i]
-		}
+	return 0
+}
+
+// registerVolume records a volume opened by the CLI so close can tear it
+// down by name. Failing to record it only costs that cleanup.
+func (c *CLI) registerVolume(vol luks2.ManagedVolume) {
+	if err := c.Luks.RegisterVolume(vol); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Warning: failed to record volume %s: %v\n", vol.Name, err)
 	}
+}
 
-	if device == "" {
-		_, _ = fmt.Fprintln(c.Stderr, "Error: device path required")
+// cmdGC drops records of volumes that were closed or lost outside luks2
+func (c *CLI) cmdGC(_ *cmdArgs) int {
+	removed, err := c.Luks.GCVolumes()
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to clean up volumes: %v\n", err)
 		return 1
 	}
 
-	opts.Device = device
+	if len(removed) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "No stale volumes")
+		return 0
+	}
+	for _, name := range removed {
+		_, _ = fmt.Fprintf(c.Stdout, "Removed stale volume: %s\n", name)
+	}
 
-	c.showBanner()
-	_, _ = fmt.Fprintln(c.Stdout, "*** WARNING: DESTRUCTIVE OPERATION ***")
-	_, _ = fmt.Fprintf(c.Stdout, "\nThis will PERMANENTLY DESTROY all data on: %s\n", device)
-	_, _ = fmt.Fprintln(c.Stdout, "This action CANNOT be undone!")
+	return 0
+}
 
-	// Show wipe configuration
-	_, _ = fmt.Fprintln(c.Stdout, "")
-	if opts.HeaderOnly {
-		_, _ = fmt.Fprintln(c.Stdout, "Mode: Header wipe only (fast)")
-	} else {
-		_, _ = fmt.Fprintf(c.Stdout, "Mode: Full device wipe (%d pass", opts.Passes)
-		if opts.Passes > 1 {
-			_, _ = fmt.Fprint(c.Stdout, "es")
-		}
-		_, _ = fmt.Fprintln(c.Stdout, ")")
-		if opts.Random {
-			_, _ = fmt.Fprintln(c.Stdout, "Data: Random")
-		} else {
-			_, _ = fmt.Fprintln(c.Stdout, "Data: Zeros")
-		}
-		if opts.Trim {
-			_, _ = fmt.Fprintln(c.Stdout, "TRIM: Enabled (SSD)")
+// cmdProvision converges the volumes of a declarative JSON or YAML spec
+func (c *CLI) cmdProvision(args *cmdArgs) int {
+	opts := &provision.Options{Root: args.Value("root"), Force: args.Has("force")}
+	if v, ok := args.Lookup("parallel"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid parallel: %s\n", v)
+			return 1
 		}
+		opts.Parallel = n
+	}
+	specPath, hasSpec := args.Lookup("spec")
+	switch {
+	case hasSpec && len(args.positional) == 0:
+	case !hasSpec && len(args.positional) == 1:
+		specPath = args.positional[0]
+	default:
+		_, _ = fmt.Fprintln(c.Stderr, "Error: one spec file required")
+		return 1
 	}
 
-	// Confirmation
-	_, _ = fmt.Fprint(c.Stdout, "\nType 'YES' to confirm wipe: ")
-	var confirm string
-	_, _ = fmt.Fscanln(c.Stdin, &confirm)
+	plan, err := provision.LoadPlan(specPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
-	if confirm != "YES" {
-		_, _ = fmt.Fprintln(c.Stdout, "\nWipe cancelled")
-		return 0
+	summary := c.Luks.Provision(plan, opts)
+	code := 0
+	if summary.Failed > 0 {
+		code = 1
 	}
 
-	if opts.HeaderOnly {
-		_, _ = fmt.Fprintln(c.Stdout, "\nWiping LUKS headers...")
-	} else {
-		_, _ = fmt.Fprintln(c.Stdout, "\nWiping entire device (this may take a while)...")
+	if args.Has("json") {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return code
 	}
 
-	if err := c.Luks.Wipe(opts); err != nil {
-		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to wipe: %v\n", err)
+	for i, d := range summary.Devices {
+		if d.Result != nil {
+			c.printProvisionResult(d.Result, plan.Specs[i])
+		}
+		if d.Err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Failed to provision %s: %v\n", d.Spec, d.Err)
+		} else if !d.Result.Changed() {
+			_, _ = fmt.Fprintf(c.Stdout, "%s is up to date\n", d.Result.Device)
+		}
+	}
+	if len(summary.Devices) > 1 {
+		_, _ = fmt.Fprintf(c.Stdout, "\nProvisioned %d devices: %d changed, %d failed\n", len(summary.Devices), summary.Changed, summary.Failed)
+	}
+	return code
+}
+
+// cmdEscrow adds a keyslot whose random passphrase is wrapped by a key
+// escrow service, so the volume can later be opened with open --escrow
+func (c *CLI) cmdEscrow(args *cmdArgs) int {
+	if len(args.positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: a service and a device are required")
+		return 1
+	}
+	service := args.positional[0]
+	device, err := c.Luks.ResolveDevice(args.positional[1])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
-	_, _ = fmt.Fprintln(c.Stdout, "\nVolume wiped successfully!")
-	_, _ = fmt.Fprintln(c.Stdout, "\nThe device is no longer encrypted and cannot be unlocked.")
+	passphrase, err := c.promptPassphrase("Enter an existing passphrase: ", false)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer ClearBytes(passphrase)
+
+	keyslot, tokenID, err := c.Luks.EscrowKeyslot(device, passphrase, service)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to escrow a key for %s: %v\n", device, err)
+		if keyslot >= 0 {
+			_, _ = fmt.Fprintf(c.Stderr, "Keyslot %d was added but holds an unknown passphrase; remove it.\n", keyslot)
+		}
+		return 1
+	}
 
+	_, _ = fmt.Fprintf(c.Stdout, "\nAdded keyslot %d, escrowed in token %d\n", keyslot, tokenID)
+	_, _ = fmt.Fprintf(c.Stdout, "Open with: sudo luks2 open --escrow %s %s <name>\n", service, device)
+	_, _ = fmt.Fprintln(c.Stdout, "Revoke by removing the keyslot.")
 	return 0
 }
 
-// promptPassphrase prompts for passphrase with hidden input
-func (c *CLI) promptPassphrase(prompt string, confirm bool) ([]byte, error) {
-	_, _ = fmt.Fprint(c.Stdout, prompt)
+// cmdEnroll adds a keyslot unlocked by a hardware token, like
+// systemd-cryptenroll
+func (c *CLI) cmdEnroll(args *cmdArgs) int {
+	uri, oaep := args.Value("pkcs11-token-uri"), args.Has("rsa-oaep")
+	var spec string
+	if len(args.positional) == 1 {
+		spec = args.positional[0]
+	}
+	if uri == "" || spec == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --pkcs11-token-uri and a device are required")
+		return 1
+	}
+	device, err := c.Luks.ResolveDevice(spec)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
 
-	fd := c.stdinFd
-	if c.getStdinFd != nil {
-		fd = c.getStdinFd()
+	passphrase, err := c.promptPassphrase("Enter an existing passphrase: ", false)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
 	}
+	defer ClearBytes(passphrase)
 
-	passphrase, err := c.Terminal.ReadPassword(fd)
-	_, _ = fmt.Fprintln(c.Stdout)
+	keyslot, tokenID, err := c.Luks.EnrollPKCS11(device, passphrase, uri, oaep)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to enroll %s: %v\n", uri, err)
+		if keyslot >= 0 {
+			_, _ = fmt.Fprintf(c.Stderr, "Keyslot %d was added but has no token; remove it.\n", keyslot)
+		}
+		return 1
 	}
 
-	if confirm {
-		_, _ = fmt.Fprint(c.Stdout, "Confirm passphrase: ")
-		confirmation, err := c.Terminal.ReadPassword(fd)
-		_, _ = fmt.Fprintln(c.Stdout)
+	_, _ = fmt.Fprintf(c.Stdout, "\nAdded keyslot %d, unlocked by the security token (token %d)\n", keyslot, tokenID)
+	_, _ = fmt.Fprintf(c.Stdout, "Open with: sudo luks2 open --pkcs11-token-uri auto %s <name>\n", device)
+	return 0
+}
+
+// cmdUnlockServer accepts passphrases over TLS from clients with an
+// authorized key until every listed volume is unlocked, for unlocking
+// remote machines from the initramfs
+func (c *CLI) cmdUnlockServer(args *cmdArgs) int {
+	cfg := unlockserver.Config{Addr: args.Value("listen")}
+	certFile, keyFile, authorizedKeys := args.Value("cert"), args.Value("key"), args.Value("authorized-keys")
+	volumes := args.positional
+	if certFile == "" || keyFile == "" || authorizedKeys == "" || len(volumes) == 0 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --cert, --key, --authorized-keys and at least one volume are required")
+		return 1
+	}
+
+	for _, v := range volumes {
+		name, spec, ok := strings.Cut(v, "=")
+		if !ok || name == "" || spec == "" {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: invalid volume %q (expected <name>=<device>)\n", v)
+			return 1
+		}
+		device, err := c.Luks.ResolveDevice(spec)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read confirmation: %w", err)
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
 		}
+		cfg.Volumes = append(cfg.Volumes, unlockserver.Volume{Device: device, Name: name})
+	}
 
-		if string(passphrase) != string(confirmation) {
-			return nil, fmt.Errorf("passphrases do not match")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: failed to load server certificate: %v\n", err)
+		return 1
+	}
+	cfg.Certificate = cert
+	if cfg.AuthorizedKeys, err = unlockserver.LoadAuthorizedKeys(authorizedKeys); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	pin, err := unlockserver.PublicKeyPin(cert.Leaf.PublicKey)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	cfg.ErrorLog = log.New(c.Stderr, "unlock-server: ", log.LstdFlags)
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = ":4443"
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Waiting for passphrases on %s for %d volume(s)\n", addr, len(cfg.Volumes))
+	_, _ = fmt.Fprintf(c.Stdout, "Server key: %s\n", pin)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pending, err := c.Luks.ServeUnlock(ctx, cfg)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(pending) > 0 {
+		names := make([]string, len(pending))
+		for i, v := range pending {
+			names[i] = v.Name
 		}
+		_, _ = fmt.Fprintf(c.Stderr, "Stopped with volumes still locked: %s\n", strings.Join(names, ", "))
+		return 1
 	}
+	_, _ = fmt.Fprintln(c.Stdout, "All volumes unlocked")
+	return 0
+}
 
-	return passphrase, nil
+// cmdKeyslots lists the keyslots of a volume with their annotations, or
+// annotates one
+func (c *CLI) cmdKeyslots(args *cmdArgs) int {
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	slots, err := c.Luks.ListKeyslots(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to list keyslots: %v\n", err)
+		return 1
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].ID < slots[j].ID })
+
+	w := tabwriter.NewWriter(c.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SLOT\tKDF\tPRIORITY\tLABEL\tOWNER\tCREATED\tDESCRIPTION")
+	for _, ks := range slots {
+		label, owner, created, description := "-", "-", "-", ""
+		if ann := ks.Annotation; ann != nil {
+			label, owner, description = orDash(ann.Label), orDash(ann.Owner), ann.Description
+			if !ann.CreatedAt.IsZero() {
+				created = ann.CreatedAt.Local().Format("2006-01-02 15:04")
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", ks.ID, ks.KDFType, priorityName(ks.Priority), label, owner, created, description)
+	}
+	_ = w.Flush()
+	return 0
+}
+
+// cmdKillKeyslot removes a keyslot after authenticating with the passphrase
+// of any keyslot, like cryptsetup luksKillSlot
+func (c *CLI) cmdKillKeyslot(args *cmdArgs) int {
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	keyslot, err := strconv.Atoi(args.positional[1])
+	if err != nil || keyslot < 0 || keyslot >= luks2.MaxKeyslots {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: invalid keyslot: %s (must be 0-%d)\n", args.positional[1], luks2.MaxKeyslots-1)
+		return 1
+	}
+
+	uuid, _ := c.Luks.GetUUID(device)
+	_, _ = fmt.Fprintf(c.Stdout, "*** WARNING: keyslot %d of %s will be destroyed ***\n", keyslot, device)
+	_, _ = fmt.Fprintln(c.Stdout, "Its passphrase will no longer unlock the volume. This cannot be undone!")
+	if ok, code := c.confirmDestroy(device, uuid, "kill"); !ok {
+		return code
+	}
+
+	passphrase, err := c.promptPassphrase("Enter any remaining passphrase: ", false)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer ClearBytes(passphrase)
+
+	if err := c.Luks.KillSlot(device, passphrase, keyslot); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to kill keyslot: %v\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Keyslot %d destroyed\n", keyslot)
+	return 0
+}
+
+// cmdAnnotateKeyslot sets or clears the annotation of a keyslot
+func (c *CLI) cmdAnnotateKeyslot(args *cmdArgs) int {
+	ann := luks2.KeyslotAnnotation{
+		Label:       args.Value("label"),
+		Owner:       args.Value("owner"),
+		Description: args.Value("description"),
+	}
+	clearAnn := args.Has("clear")
+	set := args.Has("label") || args.Has("owner") || args.Has("description")
+	positional := args.positional
+	if len(positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: a device and a keyslot are required")
+		return 1
+	}
+	if set == clearAnn {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: give --label, --owner or --description, or --clear")
+		return 1
+	}
+	keyslot, err := strconv.Atoi(positional[1])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: invalid keyslot %q\n", positional[1])
+		return 1
+	}
+	device, err := c.Luks.ResolveDevice(positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if clearAnn {
+		err = c.Luks.RemoveKeyslotAnnotation(device, keyslot)
+	} else {
+		err = c.Luks.SetKeyslotAnnotation(device, keyslot, ann)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to annotate keyslot %d: %v\n", keyslot, err)
+		return 1
+	}
+	if clearAnn {
+		_, _ = fmt.Fprintf(c.Stdout, "Removed the annotation of keyslot %d\n", keyslot)
+	} else {
+		_, _ = fmt.Fprintf(c.Stdout, "Annotated keyslot %d\n", keyslot)
+	}
+	return 0
+}
+
+// cmdUUID shows, sets, regenerates or matches the header UUID of a volume
+func (c *CLI) cmdUUID(args *cmdArgs) int {
+	newUUID, set := args.Lookup("uuid")
+	matchUUID, match := args.Lookup("match")
+	random := args.Has("random")
+	if (set && match) || (set && random) || (match && random) {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: --uuid, --random and --match are mutually exclusive")
+		return 1
+	}
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch {
+	case match:
+		matched, err := c.Luks.MatchUUID(device, matchUUID)
+		if err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if !matched {
+			return 1
+		}
+	case set:
+		if err := c.Luks.SetUUID(device, newUUID); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Failed to set UUID: %v\n", err)
+			return 1
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "UUID of %s set to %s\n", device, newUUID)
+	case random:
+		id, err := c.Luks.RegenerateUUID(device)
+		if err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Failed to set UUID: %v\n", err)
+			return 1
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "UUID of %s set to %s\n", device, id)
+	default:
+		id, err := c.Luks.GetUUID(device)
+		if err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		_, _ = fmt.Fprintln(c.Stdout, id)
+	}
+	return 0
+}
+
+// cmdLabel shows or sets the label and subsystem of a volume. Whichever of
+// the two is not given keeps its current value.
+func (c *CLI) cmdLabel(args *cmdArgs) int {
+	device, err := c.Luks.ResolveDevice(args.positional[0])
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	info, err := c.Luks.GetVolumeInfo(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to read volume: %v\n", err)
+		return 1
+	}
+
+	subsystem, setSubsystem := args.Lookup("subsystem")
+	if len(args.positional) == 1 && !setSubsystem {
+		_, _ = fmt.Fprintf(c.Stdout, "Label:     %s\n", info.Label)
+		_, _ = fmt.Fprintf(c.Stdout, "Subsystem: %s\n", info.Subsystem)
+		return 0
+	}
+
+	label := info.Label
+	if len(args.positional) > 1 {
+		label = args.positional[1]
+	}
+	if !setSubsystem {
+		subsystem = info.Subsystem
+	}
+	if err := c.Luks.SetLabel(device, label, subsystem); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to set label: %v\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Label of %s set to %q (subsystem %q)\n", device, label, subsystem)
+	return 0
+}
+
+// kdfSummary describes the KDF of a keyslot and its cost parameters
+func kdfSummary(ks luks2.KeyslotInfo) string {
+	if ks.KDFType == "pbkdf2" {
+		return fmt.Sprintf("pbkdf2 %s, %d iterations", ks.KDFHash, ks.KDFIterations)
+	}
+	return fmt.Sprintf("%s, time %d, memory %d KiB, %d threads", ks.KDFType, ks.KDFTime, ks.KDFMemory, ks.KDFCPUs)
+}
+
+// priorityName returns the cryptsetup name of a keyslot priority
+func priorityName(priority int) string {
+	switch priority {
+	case luks2.KeyslotPriorityIgnore:
+		return "ignore"
+	case luks2.KeyslotPriorityPrefer:
+		return "prefer"
+	}
+	return "normal"
+}
+
+// orDash returns s, or "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printProvisionResult lists the changes made by provision
+func (c *CLI) printProvisionResult(res *provision.Result, spec *provision.Spec) {
+	if res.Formatted {
+		_, _ = fmt.Fprintf(c.Stdout, "Formatted %s (UUID %s)\n", res.Device, res.UUID)
+	}
+	for _, slot := range res.Enrolled {
+		_, _ = fmt.Fprintf(c.Stdout, "Enrolled keyslot %d on %s\n", slot, res.Device)
+	}
+	for _, path := range res.RecoveryKeys {
+		_, _ = fmt.Fprintf(c.Stdout, "Saved recovery key of %s to %s\n", res.Device, path)
+	}
+	if res.FilesystemCreated {
+		_, _ = fmt.Fprintf(c.Stdout, "Created %s filesystem on %s\n", spec.Filesystem.Type, res.Device)
+	}
+	if res.CrypttabChanged {
+		_, _ = fmt.Fprintf(c.Stdout, "Updated crypttab entry %s\n", res.Name)
+	}
+	if res.FstabChanged {
+		_, _ = fmt.Fprintf(c.Stdout, "Updated fstab entry %s\n", spec.Fstab.MountPoint)
+	}
+}
+
+// cmdResize resizes an active mapping, e.g. after the device grew
+func (c *CLI) cmdResize(args *cmdArgs) int {
+	opts := &luks2.ResizeOptions{GrowFilesystem: args.Has("grow-fs")}
+	if v, ok := args.Lookup("size"); ok {
+		size, err := ParseSize(v)
+		if err != nil || size <= 0 {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid size: %s\n", v)
+			return 1
+		}
+		opts.Size = uint64(size)
+	}
+	var name string
+	if len(args.positional) == 1 {
+		name = args.positional[0]
+	}
+
+	if name == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: volume name required")
+		return 1
+	}
+
+	if err := c.Luks.ResizeWithOptions(name, opts); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to resize: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(c.Stdout, "Volume %s resized successfully\n", name)
+	if opts.GrowFilesystem {
+		_, _ = fmt.Fprintln(c.Stdout, "Filesystem grown to fill the volume")
+	}
+
+	return 0
+}
+
+// cmdInfo displays volume information
+func (c *CLI) cmdInfo(args *cmdArgs) int {
+	spec := args.positional[0]
+	device, loop, err := c.imagePartition(spec, true)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if loop != "" {
+		defer func() { _ = c.Luks.DetachLoopDevice(loop) }()
+	}
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Volume Information: %s\n", spec)
+	_, _ = fmt.Fprintln(c.Stdout, "===========================================================")
+
+	info, err := c.Luks.GetVolumeInfo(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to read volume: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(c.Stdout, "\nUUID:           %s\n", info.UUID)
+	_, _ = fmt.Fprintf(c.Stdout, "Label:          %s\n", info.Label)
+	if info.Subsystem != "" {
+		_, _ = fmt.Fprintf(c.Stdout, "Subsystem:      %s\n", info.Subsystem)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Version:        LUKS%d\n", info.Version)
+	_, _ = fmt.Fprintf(c.Stdout, "Cipher:         %s\n", info.Cipher)
+	if info.KeySize > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "Key Size:       %d bits\n", info.KeySize*8)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Sector Size:    %d bytes\n", info.SectorSize)
+	if info.Integrity != nil {
+		_, _ = fmt.Fprintf(c.Stdout, "Integrity:      %s (journal encryption %s, journal integrity %s)\n",
+			info.Integrity.Type, info.Integrity.JournalEncryption, info.Integrity.JournalIntegrity)
+	}
+	dataSize := "dynamic"
+	if info.DataSize > 0 {
+		dataSize = fmt.Sprintf("%d bytes", info.DataSize)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Data Segment:   offset %d bytes, size %s\n", info.DataOffset, dataSize)
+	if info.HeaderSize > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "Header Size:    %d bytes per copy, %d bytes keyslots area\n", info.HeaderSize, info.KeyslotsSize)
+	}
+	if info.Headers != nil {
+		secondary := "ok"
+		switch {
+		case info.Headers.SecondaryErr != nil:
+			secondary = fmt.Sprintf("damaged (%v)", info.Headers.SecondaryErr)
+		case !info.SecondaryHeaderHealthy:
+			secondary = "out of date"
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "Backup Header:  %s\n", secondary)
+	}
+	if len(info.Flags) > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "Flags:          %s\n", strings.Join(info.Flags, " "))
+	}
+	if len(info.RequiresFlags) > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "Requirements:   %s\n", strings.Join(info.RequiresFlags, " "))
+	}
+	if info.DeviceLogicalBlockSize > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "Device Blocks:  %d logical / %d physical bytes\n", info.DeviceLogicalBlockSize, info.DevicePhysicalBlockSize)
+	}
+	if info.FileSize > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "File Size:      %d bytes apparent / %d bytes allocated\n", info.FileSize, info.FileAllocatedSize)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Active Keyslots: %v\n", info.ActiveKeyslots)
+
+	if len(info.Keyslots) > 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nKeyslot Details:")
+		for _, ks := range info.Keyslots {
+			_, _ = fmt.Fprintf(c.Stdout, "  Slot %d: %s (key size: %d bytes, priority %s)\n", ks.ID, kdfSummary(ks), ks.KeySize, priorityName(ks.Priority))
+			_, _ = fmt.Fprintf(c.Stdout, "          area %s, %d-byte key; af %s, %d stripes\n", ks.Encryption, ks.AreaKeySize, ks.AFHash, ks.AFStripes)
+		}
+	}
+
+	if len(info.Tokens) > 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nTokens:")
+		for _, token := range info.Tokens {
+			_, _ = fmt.Fprintf(c.Stdout, "  Token %d: %s (keyslots %v)\n", token.ID, token.Type, token.Keyslots)
+		}
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nVolume is valid and accessible")
+
+	return 0
+}
+
+// cmdList shows every LUKS volume found on the system
+func (c *CLI) cmdList(_ *cmdArgs) int {
+	volumes, err := c.Luks.Discover()
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to discover volumes: %v\n", err)
+		return 1
+	}
+
+	if len(volumes) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "No LUKS volumes found")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(c.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DEVICE\tVERSION\tUUID\tLABEL\tSTATUS")
+	for _, v := range volumes {
+		label := v.Label
+		if label == "" {
+			label = "-"
+		}
+		status := "locked"
+		if v.Unlocked {
+			status = "unlocked (/dev/mapper/" + v.MappedName + ")"
+		}
+		_, _ = fmt.Fprintf(w, "%s\tLUKS%d\t%s\t%s\t%s\n", v.Device, v.Version, v.UUID, label, status)
+	}
+	_ = w.Flush()
+
+	return 0
+}
+
+// cmdStatus shows the dm-crypt details of an active mapping
+func (c *CLI) cmdStatus(args *cmdArgs) int {
+	name := args.positional[0]
+
+	status, err := c.Luks.Status(name)
+	if err != nil {
+		if errors.Is(err, luks2.ErrVolumeNotUnlocked) {
+			_, _ = fmt.Fprintf(c.Stdout, "/dev/mapper/%s is inactive.\n", name)
+		} else {
+			_, _ = fmt.Fprintf(c.Stderr, "Failed to read status: %v\n", err)
+		}
+		return 1
+	}
+
+	usage := ""
+	if status.InUse() {
+		usage = " and is in use"
+	}
+	mode := "read/write"
+	if status.ReadOnly {
+		mode = "readonly"
+	}
+	if status.Suspended {
+		mode += " (suspended)"
+	}
+	if status.DeferredRemove {
+		mode += " (deferred remove)"
+	}
+
+	_, _ = fmt.Fprintf(c.Stdout, "/dev/mapper/%s is active%s.\n", name, usage)
+	_, _ = fmt.Fprintf(c.Stdout, "  type:         %s\n", status.Type)
+	_, _ = fmt.Fprintf(c.Stdout, "  cipher:       %s\n", status.Cipher)
+	_, _ = fmt.Fprintf(c.Stdout, "  keysize:      %d bits\n", status.KeySize)
+	_, _ = fmt.Fprintf(c.Stdout, "  key location: %s\n", status.KeyLocation)
+	_, _ = fmt.Fprintf(c.Stdout, "  device:       %s\n", status.Device)
+	_, _ = fmt.Fprintf(c.Stdout, "  sector size:  %d\n", status.SectorSize)
+	_, _ = fmt.Fprintf(c.Stdout, "  offset:       %d sectors\n", status.Offset)
+	_, _ = fmt.Fprintf(c.Stdout, "  size:         %d sectors\n", status.Size)
+	_, _ = fmt.Fprintf(c.Stdout, "  mode:         %s\n", mode)
+	_, _ = fmt.Fprintf(c.Stdout, "  open count:   %d\n", status.OpenCount)
+	if len(status.Flags) > 0 {
+		_, _ = fmt.Fprintf(c.Stdout, "  flags:        %s\n", strings.Join(status.Flags, " "))
+	}
+
+	return 0
+}
+
+// cmdWipe securely wipes a LUKS2 volume
+func (c *CLI) cmdWipe(args *cmdArgs) int {
+	opts := luks2.WipeOptions{
+		Passes:      1,
+		Random:      args.Has("random"),
+		HeaderOnly:  !args.Has("full") && !args.Has("crypto-erase"),
+		CryptoErase: args.Has("crypto-erase"),
+		Trim:        args.Has("trim"),
+		Direct:      args.Has("direct"),
+	}
+	if v, ok := args.Lookup("passes"); ok {
+		passes, err := strconv.Atoi(v)
+		if err != nil || passes < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid passes value: %s (must be >= 1)\n", v)
+			return 1
+		}
+		opts.Passes = passes
+	}
+	if v, ok := args.Lookup("workers"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid workers value: %s (must be >= 1)\n", v)
+			return 1
+		}
+		opts.Workers = n
+	}
+	if v, ok := args.Lookup("buffer-size"); ok {
+		size, err := ParseSize(v)
+		if err != nil || size < 1 || size > luks2.MaxWipeBufferSize {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid buffer size: %s\n", v)
+			return 1
+		}
+		opts.BufferSize = int(size)
+	}
+	if args.Has("io-uring") {
+		opts.IOEngine = luks2.IOEngineURing
+	}
+	if v, ok := args.Lookup("queue-depth"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			_, _ = fmt.Fprintf(c.Stderr, "Invalid queue depth: %s (must be >= 1)\n", v)
+			return 1
+		}
+		opts.IOEngine = luks2.IOEngineURing
+		opts.QueueDepth = n
+	}
+	var device string
+	if len(args.positional) == 1 {
+		device = args.positional[0]
+	}
+
+	if device == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device path required")
+		return 1
+	}
+
+	opts.Device = device
+
+	c.showBanner()
+	_, _ = fmt.Fprintln(c.Stdout, "*** WARNING: DESTRUCTIVE OPERATION ***")
+	_, _ = fmt.Fprintf(c.Stdout, "\nThis will PERMANENTLY DESTROY all data on: %s\n", device)
+	_, _ = fmt.Fprintln(c.Stdout, "This action CANNOT be undone!")
+
+	// Show wipe configuration
+	_, _ = fmt.Fprintln(c.Stdout, "")
+	if opts.CryptoErase {
+		_, _ = fmt.Fprintln(c.Stdout, "Mode: Crypto-erase (headers and all keyslots)")
+	} else if opts.HeaderOnly {
+		_, _ = fmt.Fprintln(c.Stdout, "Mode: Header wipe only (fast)")
+	} else {
+		_, _ = fmt.Fprintf(c.Stdout, "Mode: Full device wipe (%d pass", opts.Passes)
+		if opts.Passes > 1 {
+			_, _ = fmt.Fprint(c.Stdout, "es")
+		}
+		_, _ = fmt.Fprintln(c.Stdout, ")")
+		if opts.Random {
+			_, _ = fmt.Fprintln(c.Stdout, "Data: Random")
+		} else {
+			_, _ = fmt.Fprintln(c.Stdout, "Data: Zeros")
+		}
+		if opts.Trim {
+			_, _ = fmt.Fprintln(c.Stdout, "TRIM: Enabled (SSD)")
+		}
+		if opts.Direct {
+			_, _ = fmt.Fprintln(c.Stdout, "I/O: Direct (O_DIRECT)")
+		}
+		if opts.IOEngine == luks2.IOEngineURing {
+			depth := opts.QueueDepth
+			if depth == 0 {
+				depth = luks2.DefaultQueueDepth
+			}
+			_, _ = fmt.Fprintf(c.Stdout, "Engine: io_uring (queue depth %d)\n", depth)
+		}
+	}
+
+	uuid, _ := c.Luks.GetUUID(device)
+	if ok, code := c.confirmDestroy(device, uuid, "wipe"); !ok {
+		return code
+	}
+
+	if opts.CryptoErase {
+		_, _ = fmt.Fprintln(c.Stdout, "\nDestroying LUKS headers and keyslots...")
+	} else if opts.HeaderOnly {
+		_, _ = fmt.Fprintln(c.Stdout, "\nWiping LUKS headers...")
+	} else {
+		_, _ = fmt.Fprintln(c.Stdout, "\nWiping entire device (this may take a while)...")
+		opts.Progress = c.printWipeProgress
+	}
+
+	if err := c.Luks.Wipe(opts); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to wipe: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nVolume wiped successfully!")
+	_, _ = fmt.Fprintln(c.Stdout, "\nThe device is no longer encrypted and cannot be unlocked.")
+
+	return 0
+}
+
+// confirmUUIDEnv set to 0 lets YES and --yes confirm destroying a LUKS
+// volume again, for scripts written before the UUID was required.
+// --confirm-uuid overrides it.
+const confirmUUIDEnv = "LUKS2_CONFIRM_UUID"
+
+// iKnowFlag followed by a volume UUID confirms destroying that volume
+// without a prompt
+const iKnowFlag = "--i-know-what-i-am-doing-"
+
+// confirmDestroy asks before a command destroys the data on device, whose
+// LUKS UUID is uuid ("" = not a LUKS volume), and reports whether to go
+// ahead; code is the exit code otherwise. --i-know-what-i-am-doing-<uuid>
+// confirms that one volume. Otherwise a LUKS volume needs its UUID typed
+// and --yes is not enough, unless LUKS2_CONFIRM_UUID=0; anything else is
+// confirmed by --yes or by typing YES.
+func (c *CLI) confirmDestroy(device, uuid, what string) (ok bool, code int) {
+	if c.knownUUID != "" {
+		if uuid == "" || !strings.EqualFold(uuid, c.knownUUID) {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %s%s does not match %s (UUID %q)\n", iKnowFlag, c.knownUUID, device, uuid)
+			return false, 1
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "\nConfirmed by %s%s\n", iKnowFlag, uuid)
+		return true, 0
+	}
+
+	needUUID := c.confirmUUID && uuid != ""
+	switch {
+	case c.assumeYes && !needUUID:
+		_, _ = fmt.Fprintln(c.Stdout, "\nConfirmed by --yes")
+		return true, 0
+	case needUUID && (c.assumeYes || c.stdinPass):
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %s of a LUKS volume needs its UUID typed; pass %s%s to confirm without a prompt\n", what, iKnowFlag, uuid)
+		return false, 1
+	case c.stdinPass:
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %s reads its confirmation from stdin; pass --yes\n", what)
+		return false, 1
+	}
+
+	var confirm string
+	if needUUID {
+		_, _ = fmt.Fprintf(c.Stdout, "\nType the UUID of %s (%s) to confirm %s: ", device, uuid, what)
+		_, _ = fmt.Fscanln(c.Stdin, &confirm)
+		ok = strings.EqualFold(confirm, uuid)
+	} else {
+		_, _ = fmt.Fprintf(c.Stdout, "\nType 'YES' to confirm %s: ", what)
+		_, _ = fmt.Fscanln(c.Stdin, &confirm)
+		ok = confirm == "YES"
+	}
+	if !ok {
+		_, _ = fmt.Fprintf(c.Stdout, "\n%s%s cancelled\n", strings.ToUpper(what[:1]), what[1:])
+	}
+	return ok, 0
+}
+
+// cmdErase destroys the headers and keyslots of a LUKS volume, like
+// cryptsetup luksErase. Unlike wipe it refuses anything but a LUKS volume
+// and always needs the volume's UUID to confirm.
+func (c *CLI) cmdErase(args *cmdArgs) int {
+	var device string
+	if len(args.positional) == 1 {
+		device = args.positional[0]
+	}
+
+	if device == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device path required")
+		return 1
+	}
+
+	uuid, err := c.Luks.GetUUID(device)
+	if err != nil || uuid == "" {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %s does not hold a LUKS volume; use 'luks2 wipe' for other devices\n", device)
+		return 1
+	}
+
+	c.showBanner()
+	_, _ = fmt.Fprintln(c.Stdout, "*** WARNING: DESTRUCTIVE OPERATION ***")
+	_, _ = fmt.Fprintf(c.Stdout, "\nThis will PERMANENTLY DESTROY all data on: %s (UUID %s)\n", device, uuid)
+	_, _ = fmt.Fprintln(c.Stdout, "The headers and every keyslot are destroyed; without a header backup")
+	_, _ = fmt.Fprintln(c.Stdout, "or the volume key the data can never be decrypted again.")
+
+	// LUKS2_CONFIRM_UUID=0 does not apply: erase exists to be the safe path
+	c.confirmUUID = true
+	if ok, code := c.confirmDestroy(device, uuid, "erase"); !ok {
+		return code
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nDestroying LUKS headers and keyslots...")
+	opts := luks2.WipeOptions{Device: device, CryptoErase: true, Trim: args.Has("trim")}
+	if err := c.Luks.Wipe(opts); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to erase: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nVolume erased successfully!")
+	return 0
+}
+
+// printWipeProgress prints one progress line per update
+func (c *CLI) printWipeProgress(p luks2.WipeProgress) {
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Written) * 100 / float64(p.Total)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "Pass %d/%d: %5.1f%%  %.1f MiB/s\n",
+		p.Pass, p.Passes, percent, p.BytesPerSecond/(1024*1024))
+}
+
+// cmdRepair checks a volume's metadata and repairs damaged header copies
+func (c *CLI) cmdRepair(args *cmdArgs) int {
+	dryRun := args.Has("dry-run")
+	var device string
+	if len(args.positional) == 1 {
+		device = args.positional[0]
+	}
+
+	if device == "" {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: device path required")
+		return 1
+	}
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Checking LUKS2 metadata: %s\n", device)
+	_, _ = fmt.Fprintln(c.Stdout, "===========================================================")
+
+	report, err := c.Luks.Validate(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to check volume: %v\n", err)
+		return 1
+	}
+
+	if len(report.Problems) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nNo problems found")
+		return 0
+	}
+
+	c.printProblems(report)
+
+	if !report.Repairable() {
+		if report.OK() {
+			return 0
+		}
+		_, _ = fmt.Fprintln(c.Stdout, "\nNo automatically repairable problems; remaining errors need manual recovery")
+		return 1
+	}
+
+	if dryRun {
+		_, _ = fmt.Fprintln(c.Stdout, "\nDry run: run without --dry-run to repair problems marked [repairable]")
+		if report.OK() {
+			return 0
+		}
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nRepairing header...")
+	if err := c.Luks.Repair(device); err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to repair: %v\n", err)
+		return 1
+	}
+
+	report, err = c.Luks.Validate(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "\nFailed to re-check volume: %v\n", err)
+		return 1
+	}
+
+	if len(report.Problems) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nRepair complete, no problems remain")
+		return 0
+	}
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nRemaining problems after repair:")
+	c.printProblems(report)
+	if report.OK() {
+		return 0
+	}
+	return 1
+}
+
+// cmdAudit reviews the security of a volume's configuration. It fails when
+// a finding is high or critical.
+func (c *CLI) cmdAudit(args *cmdArgs) int {
+	spec := args.positional[0]
+	device, loop, err := c.imagePartition(spec, true)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if loop != "" {
+		defer func() { _ = c.Luks.DetachLoopDevice(loop) }()
+	}
+
+	report, err := c.Luks.Audit(device)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to audit volume: %v\n", err)
+		return 1
+	}
+	report.Device = spec
+	worst := report.Worst()
+	code := 0
+	if worst == luks2.AuditCritical || worst == luks2.AuditHigh {
+		code = 1
+	}
+
+	if args.Has("json") {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return code
+	}
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Security audit: %s\n", spec)
+	_, _ = fmt.Fprintln(c.Stdout, "===========================================================")
+	_, _ = fmt.Fprintf(c.Stdout, "\nUUID:           %s\n", report.UUID)
+	_, _ = fmt.Fprintf(c.Stdout, "Score:          %d/100\n", report.Score)
+
+	_, _ = fmt.Fprintln(c.Stdout, "\nKeyslots:")
+	for _, k := range report.Keyslots {
+		kdf := fmt.Sprintf("%s, time %d, memory %d KiB, %d CPUs", k.Type, k.Time, k.Memory, k.CPUs)
+		if k.Type == "pbkdf2" {
+			kdf = fmt.Sprintf("pbkdf2-%s, %d iterations", k.Hash, k.Iterations)
+		}
+		strength := "ok"
+		if k.Weak {
+			strength = "weak"
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "  %-3d %-50s %s\n", k.Keyslot, kdf, strength)
+	}
+
+	if len(report.Findings) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nNo findings")
+		return 0
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "\n%d finding(s):\n", len(report.Findings))
+	for _, f := range report.Findings {
+		_, _ = fmt.Fprintf(c.Stdout, "  %s\n", f)
+	}
+	return code
+}
+
+// cmdDoctor cross-checks crypttab, fstab and the volumes they name. It
+// fails when a finding is high or critical.
+func (c *CLI) cmdDoctor(args *cmdArgs) int {
+	crypttab, fstab := "/etc/crypttab", "/etc/fstab"
+	if v, ok := args.Lookup("crypttab"); ok {
+		crypttab = v
+	}
+	if v, ok := args.Lookup("fstab"); ok {
+		fstab = v
+	}
+
+	report, err := c.Luks.CheckTabFiles(crypttab, fstab)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Failed to check tables: %v\n", err)
+		return 1
+	}
+	worst := report.Worst()
+	code := 0
+	if worst == luks2.AuditCritical || worst == luks2.AuditHigh {
+		code = 1
+	}
+
+	if args.Has("json") {
+		enc := json.NewEncoder(c.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return code
+	}
+
+	c.showBanner()
+	_, _ = fmt.Fprintf(c.Stdout, "Checked %d crypttab entries (%s) and %d fstab entries (%s)\n", report.Crypttab, crypttab, report.Fstab, fstab)
+	if len(report.Findings) == 0 {
+		_, _ = fmt.Fprintln(c.Stdout, "\nNo problems found")
+		return 0
+	}
+	_, _ = fmt.Fprintf(c.Stdout, "\n%d problem(s) found:\n", len(report.Findings))
+	for _, f := range report.Findings {
+		_, _ = fmt.Fprintf(c.Stdout, "  %s\n", f)
+	}
+	return code
+}
+
+// cmdFstab prints the fstab line that mounts the filesystem of an unlocked
+// volume
+func (c *CLI) cmdFstab(args *cmdArgs) int {
+	if len(args.positional) != 2 {
+		_, _ = fmt.Fprintln(c.Stderr, "Error: volume name and mountpoint required")
+		return 1
+	}
+	opts := &luks2.FstabOptions{MountPoint: args.positional[1], ByUUID: args.Has("uuid")}
+	if v, ok := args.Lookup("options"); ok {
+		opts.Options = strings.Split(v, ",")
+	}
+	if v, ok := args.Lookup("pass"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 2 {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: invalid --pass value: %s (must be 0, 1 or 2)\n", v)
+			return 1
+		}
+		opts.Pass = n
+	}
+
+	entry, err := c.Luks.FstabEntryFor(args.positional[0], opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	_, _ = fmt.Fprintln(c.Stdout, entry)
+	return 0
+}
+
+// printProblems lists the problems of a validation report
+func (c *CLI) printProblems(report *luks2.ValidationReport) {
+	_, _ = fmt.Fprintf(c.Stdout, "\n%d problem(s) found:\n", len(report.Problems))
+	for _, p := range report.Problems {
+		suffix := ""
+		if p.Repairable {
+			suffix = " [repairable]"
+		}
+		_, _ = fmt.Fprintf(c.Stdout, "  %s%s\n", p, suffix)
+	}
+}
+
+// promptPassphrase returns the passphrase given by --key-file, --stdin or
+// --env-file, or prompts for it with hidden input
+func (c *CLI) promptPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if c.scripted() {
+		return c.scriptedPassphrase()
+	}
+	return c.promptSecret(prompt, confirm)
+}
+
+// promptSecret prompts on the terminal with hidden input, failing under
+// --batch
+func (c *CLI) promptSecret(prompt string, confirm bool) ([]byte, error) {
+	if c.batch {
+		return nil, fmt.Errorf("%q needs input, but --batch was given (use --key-file, --stdin or --env-file for passphrases)", strings.TrimSuffix(prompt, ": "))
+	}
+	fd := c.stdinFd
+	if c.getStdinFd != nil {
+		fd = c.getStdinFd()
+	}
+	if c.useAskpass(fd) {
+		return c.askpassSecret(prompt, confirm)
+	}
+
+	_, _ = fmt.Fprint(c.Stdout, prompt)
+	passphrase, err := c.Terminal.ReadPassword(fd)
+	_, _ = fmt.Fprintln(c.Stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	if confirm {
+		c.printStrength(passphrase)
+
+		_, _ = fmt.Fprint(c.Stdout, "Confirm passphrase: ")
+		confirmation, err := c.Terminal.ReadPassword(fd)
+		_, _ = fmt.Fprintln(c.Stdout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read confirmation: %w", err)
+		}
+
+		if string(passphrase) != string(confirmation) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// useAskpass reports whether secrets are asked for by an askpass program
+// instead of the terminal: always when $LUKS_ASKPASS is set, and through
+// systemd-ask-password when there is no terminal to read (e.g. at boot
+// under Plymouth, or started from a desktop session)
+func (c *CLI) useAskpass(fd int) bool {
+	if os.Getenv(askpass.EnvVar) != "" {
+		return true
+	}
+	return !c.Terminal.IsTerminal(fd) && askpass.SystemdAvailable()
+}
+
+// askpassSecret asks for a secret, and its confirmation, with askpass
+func (c *CLI) askpassSecret(prompt string, confirm bool) ([]byte, error) {
+	opts := &askpass.SystemdOptions{ID: "luks2"}
+	passphrase, err := askpass.Ask(context.Background(), strings.TrimSuffix(prompt, ": "), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	c.printStrength(passphrase)
+	confirmation, err := askpass.Ask(context.Background(), "Confirm passphrase", opts)
+	if err != nil {
+		ClearBytes(passphrase)
+		return nil, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	defer ClearBytes(confirmation)
+	if !bytes.Equal(passphrase, confirmation) {
+		ClearBytes(passphrase)
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// promptLabel asks for an optional volume label. Scripted runs get none,
+// as stdin may hold the passphrase or not be a terminal.
+func (c *CLI) promptLabel() string {
+	if c.batch || c.stdinPass {
+		return ""
+	}
+	_, _ = fmt.Fprint(c.Stdout, "Enter volume label (optional, press Enter to skip): ")
+	var label string
+	_, _ = fmt.Fscanln(c.Stdin, &label)
+	return label
+}
+
+// parseGlobalFlags removes the options every command accepts from c.Args,
+// wherever they appear
+func (c *CLI) parseGlobalFlags() error {
+	args := c.Args[:0:0]
+	c.confirmUUID = os.Getenv(confirmUUIDEnv) != "0"
+	sources := 0
+	for i := 0; i < len(c.Args); i++ {
+		switch arg := c.Args[i]; {
+		case i == 0:
+			args = append(args, arg)
+		case arg == "--yes" || arg == "-y":
+			c.assumeYes = true
+		case arg == "--batch":
+			c.assumeYes, c.batch = true, true
+		case arg == "--stdin":
+			c.stdinPass = true
+			sources++
+		case arg == "--confirm-uuid":
+			c.confirmUUID = true
+		case strings.HasPrefix(arg, iKnowFlag):
+			c.knownUUID = strings.TrimPrefix(arg, iKnowFlag)
+			if c.knownUUID == "" {
+				return fmt.Errorf("%s needs the UUID of the volume", strings.TrimSuffix(iKnowFlag, "-"))
+			}
+		case arg == "--key-file" || arg == "--env-file":
+			if i+1 >= len(c.Args) {
+				return fmt.Errorf("%s requires a file", arg)
+			}
+			i++
+			if arg == "--key-file" {
+				c.keyFile = c.Args[i]
+			} else {
+				c.envFile = c.Args[i]
+			}
+			sources++
+		default:
+			args = append(args, arg)
+		}
+	}
+	if sources > 1 {
+		return errors.New("--key-file, --stdin and --env-file are mutually exclusive")
+	}
+	c.Args = args
+	return nil
+}
+
+// scripted reports whether the passphrase comes from --key-file, --stdin or
+// --env-file
+func (c *CLI) scripted() bool {
+	return c.keyFile != "" || c.envFile != "" || c.stdinPass
+}
+
+// scriptedPassphrase returns a copy of the scripted passphrase, reading it
+// on first use. Callers own the copy, as the library clears passphrases.
+func (c *CLI) scriptedPassphrase() ([]byte, error) {
+	if c.passphrase == nil {
+		var pass []byte
+		var err error
+		switch {
+		case c.keyFile != "":
+			pass, err = readKeyFile(c.keyFile, c.Stderr)
+		case c.envFile != "":
+			pass, err = readEnvFilePassphrase(c.envFile)
+		default:
+			pass, err = readPassphraseLine(c.Stdin)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(pass) == 0 {
+			return nil, errors.New("empty passphrase")
+		}
+		c.passphrase = pass
+	}
+	return bytes.Clone(c.passphrase), nil
+}
+
+// readKeyFile reads a passphrase file. One trailing newline is dropped, so
+// files written with echo work. Files other users can read are warned about.
+func readKeyFile(path string, warn io.Writer) ([]byte, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode().Perm()&0077 != 0 {
+		_, _ = fmt.Fprintf(warn, "Warning: key file %s is accessible by other users (mode %04o)\n", path, fi.Mode().Perm())
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path given on the command line
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return trimNewline(data), nil
+}
+
+// readEnvFilePassphrase reads LUKS2_PASSPHRASE from a file of KEY=VALUE
+// lines, the format of systemd's EnvironmentFile= and docker --env-file.
+// Blank lines, # comments, an "export " prefix and quotes around the value
+// are accepted.
+func readEnvFilePassphrase(path string) ([]byte, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path given on the command line
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	defer ClearBytes(data)
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimPrefix(bytes.TrimSpace(line), []byte("export "))
+		key, value, ok := bytes.Cut(line, []byte("="))
+		if !ok || string(bytes.TrimSpace(key)) != "LUKS2_PASSPHRASE" {
+			continue
+		}
+		if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+			value = value[1 : n-1]
+		}
+		return bytes.Clone(value), nil
+	}
+	return nil, fmt.Errorf("%s does not set LUKS2_PASSPHRASE", path)
+}
+
+// readPassphraseLine reads the first line of r a byte at a time, leaving the
+// rest unread
+func readPassphraseLine(r io.Reader) ([]byte, error) {
+	line := make([]byte, 0, luks2.MaxPassphraseLength+2)
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			if len(line) == cap(line) {
+				ClearBytes(line)
+				return nil, errors.New("passphrase on stdin is too long")
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ClearBytes(line)
+			return nil, fmt.Errorf("failed to read passphrase from stdin: %w", err)
+		}
+	}
+	return trimNewline(line), nil
+}
+
+// trimNewline drops one trailing "\n" or "\r\n"
+func trimNewline(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
+
+// printStrength shows a strength meter for a new passphrase
+func (c *CLI) printStrength(passphrase []byte) {
+	s := luks2.EstimateStrength(passphrase)
+	meter := strings.Repeat("#", s.Score+1) + strings.Repeat("-", luks2.StrengthVeryStrong-s.Score)
+	_, _ = fmt.Fprintf(c.Stdout, "Strength: [%s] %s (~%.0f bits)\n", meter, s.Label(), s.Entropy)
+	for _, fb := range s.Feedback {
+		_, _ = fmt.Fprintf(c.Stdout, "  - %s\n", fb)
+	}
 }
 
 // ParseSize parses a size string like "100M" into bytes (exported for testing)
@@ -2,32 +2,91 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/provision"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/udisks"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/unlockserver"
+	"golang.org/x/sys/unix"
 )
 
 // MockLuksOperations implements LuksOperations for testing
 type MockLuksOperations struct {
-	FormatFunc           func(opts luks2.FormatOptions) error
-	UnlockFunc           func(device string, passphrase []byte, name string) error
-	LockFunc             func(name string) error
-	MountFunc            func(opts luks2.MountOptions) error
-	UnmountFunc          func(mountPoint string, flags int) error
-	GetVolumeInfoFunc    func(device string) (*luks2.VolumeInfo, error)
-	WipeFunc             func(opts luks2.WipeOptions) error
-	SetupLoopDeviceFunc  func(filename string) (string, error)
-	DetachLoopDeviceFunc func(loopDev string) error
-	MakeFilesystemFunc   func(volumeName, fstype, label string) error
-	IsMountedFunc        func(mountPoint string) (bool, error)
-	IsUnlockedFunc       func(name string) bool
+	FormatFunc                  func(opts luks2.FormatOptions) error
+	UnlockFunc                  func(device string, passphrase []byte, name string) error
+	UnlockWithOptionsFunc       func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error
+	UnlockWithRetryFunc         func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error
+	LockFunc                    func(name string) error
+	CreateEphemeralFunc         func(name, device string, opts *luks2.EphemeralOptions) error
+	MountFunc                   func(opts luks2.MountOptions) error
+	UnmountFunc                 func(mountPoint string, flags int) error
+	OpenAndMountFunc            func(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error)
+	UnmountAndCloseFunc         func(mountPoint string) error
+	FindMountUsersFunc          func(mountPoint string) ([]luks2.MountUser, error)
+	TrimFunc                    func(mountPoint string) (uint64, error)
+	ResizeFunc                  func(name string, opts *luks2.ResizeOptions) error
+	GetVolumeInfoFunc           func(device string) (*luks2.VolumeInfo, error)
+	WipeFunc                    func(opts luks2.WipeOptions) error
+	SetupLoopDeviceFunc         func(filename string) (string, error)
+	SetupLoopPartitionFunc      func(filename string, partition int, opts *luks2.LoopOptions) (string, string, error)
+	DetachLoopDeviceFunc        func(loopDev string) error
+	MakeFilesystemFunc          func(volumeName, fstype, label string) error
+	IsMountedFunc               func(mountPoint string) (bool, error)
+	IsUnlockedFunc              func(name string) bool
+	ResolveDeviceFunc           func(spec string) (string, error)
+	DiscoverFunc                func() ([]luks2.DiscoveredVolume, error)
+	StatusFunc                  func(name string) (*luks2.VolumeStatus, error)
+	ValidateFunc                func(device string) (*luks2.ValidationReport, error)
+	AuditFunc                   func(device string) (*luks2.AuditReport, error)
+	CheckTabFilesFunc           func(crypttab, fstab string) (*luks2.TabReport, error)
+	FstabEntryForFunc           func(name string, opts *luks2.FstabOptions) (*luks2.FstabEntry, error)
+	RepairFunc                  func(device string) error
+	RegisterVolumeFunc          func(vol luks2.ManagedVolume) error
+	CloseVolumeFunc             func(name string, deferred bool) error
+	GCVolumesFunc               func() ([]string, error)
+	PrivilegesFunc              func() luks2.Privileges
+	UdisksOpenAndMountFunc      func(device string, passphrase []byte, fsType, options string) (*udisks.Volume, error)
+	UdisksUnmountAndCloseFunc   func(mountPoint string) error
+	ProvisionFunc               func(plan *provision.Plan, opts *provision.Options) *provision.Summary
+	UnlockWithTokenFunc         func(device, name string, opts *luks2.TokenUnlockOptions) error
+	UnlockWithEscrowFunc        func(device, name, service string, opts *luks2.UnlockOptions) error
+	EscrowKeyslotFunc           func(device string, passphrase []byte, service string) (int, int, error)
+	EnrollPKCS11Func            func(device string, passphrase []byte, uri string, oaep bool) (int, int, error)
+	UnlockWithPKCS11Func        func(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error
+	ServeUnlockFunc             func(ctx context.Context, cfg unlockserver.Config) ([]unlockserver.Volume, error)
+	TestPassphraseFunc          func(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error)
+	ListKeyslotsFunc            func(device string) ([]luks2.KeyslotInfo, error)
+	KillSlotFunc                func(device string, passphrase []byte, keyslot int) error
+	SetKeyslotAnnotationFunc    func(device string, keyslot int, ann luks2.KeyslotAnnotation) error
+	RemoveKeyslotAnnotationFunc func(device string, keyslot int) error
+	GetUUIDFunc                 func(device string) (string, error)
+	ProbeSignaturesFunc         func(device string) ([]luks2.Signature, error)
+	SetUUIDFunc                 func(device, uuid string) error
+	RegenerateUUIDFunc          func(device string) (string, error)
+	MatchUUIDFunc               func(device, uuid string) (bool, error)
+	SetLabelFunc                func(device, label, subsystem string) error
 }
 
 func (m *MockLuksOperations) Format(opts luks2.FormatOptions) error {
@@ -44,6 +103,38 @@ func (m *MockLuksOperations) Unlock(device string, passphrase []byte, name strin
 	return nil
 }
 
+func (m *MockLuksOperations) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	if m.UnlockWithOptionsFunc != nil {
+		return m.UnlockWithOptionsFunc(device, passphrase, name, opts)
+	}
+	return m.Unlock(device, passphrase, name)
+}
+
+// UnlockWithRetry falls back to re-prompting without backoff
+func (m *MockLuksOperations) UnlockWithRetry(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+	if m.UnlockWithRetryFunc != nil {
+		return m.UnlockWithRetryFunc(device, name, prompt, opts)
+	}
+	var err error
+	for attempt := 1; attempt <= opts.MaxAttempts; attempt++ {
+		passphrase, perr := prompt(attempt)
+		if perr != nil {
+			return perr
+		}
+		if err = m.UnlockWithOptions(device, passphrase, name, opts.Unlock); !errors.Is(err, luks2.ErrInvalidPassphrase) {
+			return err
+		}
+	}
+	return err
+}
+
+func (m *MockLuksOperations) CreateEphemeral(name, device string, opts *luks2.EphemeralOptions) error {
+	if m.CreateEphemeralFunc != nil {
+		return m.CreateEphemeralFunc(name, device, opts)
+	}
+	return nil
+}
+
 func (m *MockLuksOperations) Lock(name string) error {
 	if m.LockFunc != nil {
 		return m.LockFunc(name)
@@ -65,6 +156,41 @@ func (m *MockLuksOperations) Unmount(mountPoint string, flags int) error {
 	return nil
 }
 
+func (m *MockLuksOperations) OpenAndMount(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error) {
+	if m.OpenAndMountFunc != nil {
+		return m.OpenAndMountFunc(device, mountPoint, passphrase, opts)
+	}
+	return &luks2.MountedVolume{Device: device, Name: "luks-test-uuid", MountPoint: mountPoint, FSType: luks2.FilesystemExt4}, nil
+}
+
+func (m *MockLuksOperations) UnmountAndClose(mountPoint string) error {
+	if m.UnmountAndCloseFunc != nil {
+		return m.UnmountAndCloseFunc(mountPoint)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) FindMountUsers(mountPoint string) ([]luks2.MountUser, error) {
+	if m.FindMountUsersFunc != nil {
+		return m.FindMountUsersFunc(mountPoint)
+	}
+	return nil, nil
+}
+
+func (m *MockLuksOperations) Trim(mountPoint string) (uint64, error) {
+	if m.TrimFunc != nil {
+		return m.TrimFunc(mountPoint)
+	}
+	return 0, nil
+}
+
+func (m *MockLuksOperations) ResizeWithOptions(name string, opts *luks2.ResizeOptions) error {
+	if m.ResizeFunc != nil {
+		return m.ResizeFunc(name, opts)
+	}
+	return nil
+}
+
 func (m *MockLuksOperations) GetVolumeInfo(device string) (*luks2.VolumeInfo, error) {
 	if m.GetVolumeInfoFunc != nil {
 		return m.GetVolumeInfoFunc(device)
@@ -102,6 +228,13 @@ func (m *MockLuksOperations) SetupLoopDevice(filename string) (string, error) {
 	return "/dev/loop0", nil
 }
 
+func (m *MockLuksOperations) SetupLoopPartition(filename string, partition int, opts *luks2.LoopOptions) (string, string, error) {
+	if m.SetupLoopPartitionFunc != nil {
+		return m.SetupLoopPartitionFunc(filename, partition, opts)
+	}
+	return "/dev/loop0", fmt.Sprintf("/dev/loop0p%d", partition), nil
+}
+
 func (m *MockLuksOperations) DetachLoopDevice(loopDev string) error {
 	if m.DetachLoopDeviceFunc != nil {
 		return m.DetachLoopDeviceFunc(loopDev)
@@ -123,6 +256,27 @@ func (m *MockLuksOperations) IsMounted(mountPoint string) (bool, error) {
 	return false, nil
 }
 
+func (m *MockLuksOperations) ResolveDevice(spec string) (string, error) {
+	if m.ResolveDeviceFunc != nil {
+		return m.ResolveDeviceFunc(spec)
+	}
+	return spec, nil
+}
+
+func (m *MockLuksOperations) Discover() ([]luks2.DiscoveredVolume, error) {
+	if m.DiscoverFunc != nil {
+		return m.DiscoverFunc()
+	}
+	return nil, nil
+}
+
+func (m *MockLuksOperations) Status(name string) (*luks2.VolumeStatus, error) {
+	if m.StatusFunc != nil {
+		return m.StatusFunc(name)
+	}
+	return &luks2.VolumeStatus{Name: name}, nil
+}
+
 func (m *MockLuksOperations) IsUnlocked(name string) bool {
 	if m.IsUnlockedFunc != nil {
 		return m.IsUnlockedFunc(name)
@@ -130,10 +284,224 @@ func (m *MockLuksOperations) IsUnlocked(name string) bool {
 	return false
 }
 
+func (m *MockLuksOperations) Validate(device string) (*luks2.ValidationReport, error) {
+	if m.ValidateFunc != nil {
+		return m.ValidateFunc(device)
+	}
+	return &luks2.ValidationReport{Device: device}, nil
+}
+
+func (m *MockLuksOperations) Audit(device string) (*luks2.AuditReport, error) {
+	if m.AuditFunc != nil {
+		return m.AuditFunc(device)
+	}
+	return &luks2.AuditReport{Device: device, Score: 100}, nil
+}
+
+func (m *MockLuksOperations) CheckTabFiles(crypttab, fstab string) (*luks2.TabReport, error) {
+	if m.CheckTabFilesFunc != nil {
+		return m.CheckTabFilesFunc(crypttab, fstab)
+	}
+	return &luks2.TabReport{Findings: []luks2.AuditFinding{}}, nil
+}
+
+func (m *MockLuksOperations) FstabEntryFor(name string, opts *luks2.FstabOptions) (*luks2.FstabEntry, error) {
+	if m.FstabEntryForFunc != nil {
+		return m.FstabEntryForFunc(name, opts)
+	}
+	return &luks2.FstabEntry{Device: "/dev/mapper/" + name, MountPoint: opts.MountPoint, Type: "ext4", Options: opts.Options, Pass: opts.Pass}, nil
+}
+
+func (m *MockLuksOperations) Repair(device string) error {
+	if m.RepairFunc != nil {
+		return m.RepairFunc(device)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) RegisterVolume(vol luks2.ManagedVolume) error {
+	if m.RegisterVolumeFunc != nil {
+		return m.RegisterVolumeFunc(vol)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) SetVolumeMountPoint(name, mountPoint string) error {
+	return nil
+}
+
+// CloseVolume falls back to a plain Lock
+func (m *MockLuksOperations) CloseVolume(name string, deferred bool) error {
+	if m.CloseVolumeFunc != nil {
+		return m.CloseVolumeFunc(name, deferred)
+	}
+	return m.Lock(name)
+}
+
+func (m *MockLuksOperations) GCVolumes() ([]string, error) {
+	if m.GCVolumesFunc != nil {
+		return m.GCVolumesFunc()
+	}
+	return nil, nil
+}
+
+// Privileges defaults to running as root
+func (m *MockLuksOperations) Privileges() luks2.Privileges {
+	if m.PrivilegesFunc != nil {
+		return m.PrivilegesFunc()
+	}
+	return luks2.Privileges{SysAdmin: true, MapperControl: true, LoopControl: true}
+}
+
+func (m *MockLuksOperations) UdisksOpenAndMount(device string, passphrase []byte, fsType, options string) (*udisks.Volume, error) {
+	if m.UdisksOpenAndMountFunc != nil {
+		return m.UdisksOpenAndMountFunc(device, passphrase, fsType, options)
+	}
+	return nil, udisks.ErrNotAvailable
+}
+
+func (m *MockLuksOperations) UdisksUnmountAndClose(mountPoint string) error {
+	if m.UdisksUnmountAndCloseFunc != nil {
+		return m.UdisksUnmountAndCloseFunc(mountPoint)
+	}
+	return udisks.ErrNotAvailable
+}
+
+func (m *MockLuksOperations) Provision(plan *provision.Plan, opts *provision.Options) *provision.Summary {
+	if m.ProvisionFunc != nil {
+		return m.ProvisionFunc(plan, opts)
+	}
+	summary := &provision.Summary{}
+	for _, spec := range plan.Specs {
+		summary.Devices = append(summary.Devices, provision.DeviceResult{Spec: spec.Device, Result: &provision.Result{Device: spec.Device}})
+	}
+	return summary
+}
+
+func (m *MockLuksOperations) UnlockWithToken(device, name string, opts *luks2.TokenUnlockOptions) error {
+	if m.UnlockWithTokenFunc != nil {
+		return m.UnlockWithTokenFunc(device, name, opts)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) UnlockWithEscrow(device, name, service string, opts *luks2.UnlockOptions) error {
+	if m.UnlockWithEscrowFunc != nil {
+		return m.UnlockWithEscrowFunc(device, name, service, opts)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) EscrowKeyslot(device string, passphrase []byte, service string) (int, int, error) {
+	if m.EscrowKeyslotFunc != nil {
+		return m.EscrowKeyslotFunc(device, passphrase, service)
+	}
+	return 1, 0, nil
+}
+
+func (m *MockLuksOperations) EnrollPKCS11(device string, passphrase []byte, uri string, oaep bool) (int, int, error) {
+	if m.EnrollPKCS11Func != nil {
+		return m.EnrollPKCS11Func(device, passphrase, uri, oaep)
+	}
+	return 1, 0, nil
+}
+
+func (m *MockLuksOperations) UnlockWithPKCS11(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error {
+	if m.UnlockWithPKCS11Func != nil {
+		return m.UnlockWithPKCS11Func(device, name, uri, pin, opts)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) ServeUnlock(ctx context.Context, cfg unlockserver.Config) ([]unlockserver.Volume, error) {
+	if m.ServeUnlockFunc != nil {
+		return m.ServeUnlockFunc(ctx, cfg)
+	}
+	return nil, nil
+}
+
+func (m *MockLuksOperations) TestPassphrase(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error) {
+	if m.TestPassphraseFunc != nil {
+		return m.TestPassphraseFunc(device, passphrase, opts)
+	}
+	return 0, nil
+}
+
+func (m *MockLuksOperations) KillSlot(device string, passphrase []byte, keyslot int) error {
+	if m.KillSlotFunc != nil {
+		return m.KillSlotFunc(device, passphrase, keyslot)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) ListKeyslots(device string) ([]luks2.KeyslotInfo, error) {
+	if m.ListKeyslotsFunc != nil {
+		return m.ListKeyslotsFunc(device)
+	}
+	return nil, nil
+}
+
+func (m *MockLuksOperations) SetKeyslotAnnotation(device string, keyslot int, ann luks2.KeyslotAnnotation) error {
+	if m.SetKeyslotAnnotationFunc != nil {
+		return m.SetKeyslotAnnotationFunc(device, keyslot, ann)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) RemoveKeyslotAnnotation(device string, keyslot int) error {
+	if m.RemoveKeyslotAnnotationFunc != nil {
+		return m.RemoveKeyslotAnnotationFunc(device, keyslot)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) GetUUID(device string) (string, error) {
+	if m.GetUUIDFunc != nil {
+		return m.GetUUIDFunc(device)
+	}
+	return "", nil
+}
+
+func (m *MockLuksOperations) ProbeSignatures(device string) ([]luks2.Signature, error) {
+	if m.ProbeSignaturesFunc != nil {
+		return m.ProbeSignaturesFunc(device)
+	}
+	return nil, nil
+}
+
+func (m *MockLuksOperations) SetUUID(device, uuid string) error {
+	if m.SetUUIDFunc != nil {
+		return m.SetUUIDFunc(device, uuid)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) RegenerateUUID(device string) (string, error) {
+	if m.RegenerateUUIDFunc != nil {
+		return m.RegenerateUUIDFunc(device)
+	}
+	return "", nil
+}
+
+func (m *MockLuksOperations) SetLabel(device, label, subsystem string) error {
+	if m.SetLabelFunc != nil {
+		return m.SetLabelFunc(device, label, subsystem)
+	}
+	return nil
+}
+
+func (m *MockLuksOperations) MatchUUID(device, uuid string) (bool, error) {
+	if m.MatchUUIDFunc != nil {
+		return m.MatchUUIDFunc(device, uuid)
+	}
+	return false, nil
+}
+
 // MockTerminal implements Terminal for testing
 type MockTerminal struct {
-	Password []byte
-	Err      error
+	Password    []byte
+	Err         error
+	NotTerminal bool
 }
 
 func (m *MockTerminal) ReadPassword(fd int) ([]byte, error) {
@@ -143,6 +511,10 @@ func (m *MockTerminal) ReadPassword(fd int) ([]byte, error) {
 	return m.Password, nil
 }
 
+func (m *MockTerminal) IsTerminal(fd int) bool {
+	return !m.NotTerminal
+}
+
 // MockFileSystem implements FileSystem for testing
 type MockFileSystem struct {
 	Files       map[string]bool
@@ -343,6 +715,78 @@ func TestCLI_Create_FileAlreadyExists(t *testing.T) {
 	}
 }
 
+func TestCLI_Create_FilePreallocate(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "create", "--preallocate", "test.luks", "1M"})
+	cli.Luks = &MockLuksOperations{
+		FormatFunc: func(opts luks2.FormatOptions) error {
+			if opts.Device != "test.luks" {
+				t.Errorf("Format device = %q, want test.luks", opts.Device)
+			}
+			return errors.New("stop after allocation")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Creating 1M preallocated file") {
+		t.Errorf("Expected preallocated file, got: %s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "stop after allocation") {
+		t.Errorf("Expected format to be reached, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Create_FileAutoDetachesLoop(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "create", "test.luks", "1M"})
+	var unlockOpts *luks2.UnlockOptions
+	var registered luks2.ManagedVolume
+	cli.Luks = &MockLuksOperations{
+		RegisterVolumeFunc: func(vol luks2.ManagedVolume) error {
+			registered = vol
+			return nil
+		},
+		SetupLoopDeviceFunc: func(filename string) (string, error) {
+			return "/dev/loop7", nil
+		},
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			if device != "/dev/loop7" {
+				t.Errorf("unlocked %s, want /dev/loop7", device)
+			}
+			unlockOpts = opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if unlockOpts == nil || !unlockOpts.AutoDetachLoop {
+		t.Errorf("Expected the loop device to detach on close, got %+v", unlockOpts)
+	}
+	if registered.Name != "luks-auto" || registered.Device != "test.luks" || registered.LoopDevice != "/dev/loop7" {
+		t.Errorf("Expected the volume to be registered, got %+v", registered)
+	}
+	if !strings.Contains(stdout.String(), "Volume unlocked as: /dev/mapper/luks-auto") {
+		t.Errorf("Expected unlock output, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Create_AllocationOnBlockDevice(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "create", "--sparse", "/dev/sda1"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "only apply to file volumes") {
+		t.Errorf("Expected file volume error, got: %s", stderr.String())
+	}
+}
+
 func TestCLI_Open_NoArgs(t *testing.T) {
 	cli, stdout, _ := newTestCLI([]string{"luks2", "open"})
 
@@ -404,105 +848,216 @@ func TestCLI_Open_Failure(t *testing.T) {
 	}
 }
 
-func TestCLI_Close_NoArgs(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "close"})
+func TestCLI_Open_AllowDiscards(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "open", "--allow-discards", "/dev/sda1", "myvolume"})
+	var got *luks2.UnlockOptions
+	cli.Luks = &MockLuksOperations{
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			if device != "/dev/sda1" || name != "myvolume" {
+				t.Errorf("unexpected arguments: %s %s", device, name)
+			}
+			got = opts
+			return nil
+		},
+	}
 
 	code := cli.Run()
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d: %s", code, stderr.String())
 	}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 close") {
-		t.Error("Expected close usage message")
+	if got == nil || !got.AllowDiscards {
+		t.Error("Expected AllowDiscards to be set")
 	}
-}
-
-func TestCLI_Close_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "close", "myvolume"})
-
-	code := cli.Run()
 
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if !strings.Contains(stderr.String(), "WARNING: discards are enabled") {
+		t.Error("Expected discard security warning")
 	}
 
-	if !strings.Contains(stdout.String(), "Volume locked successfully") {
+	if !strings.Contains(stdout.String(), "Volume unlocked successfully") {
 		t.Error("Expected success message")
 	}
 }
 
-func TestCLI_Close_StillMounted(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "close", "myvolume"})
+func TestCLI_Open_PerfFlags(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open",
+		"--perf-same_cpu_crypt", "--perf-submit_from_crypt_cpus",
+		"--perf-no_read_workqueue", "--perf-no_write_workqueue",
+		"/dev/nvme0n1p2", "fast"})
+	var got *luks2.UnlockOptions
 	cli.Luks = &MockLuksOperations{
-		IsMountedFunc: func(mountPoint string) (bool, error) {
-			return true, nil
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			got = opts
+			return nil
 		},
 	}
 
 	code := cli.Run()
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
 	}
 
-	if !strings.Contains(stderr.String(), "still mounted") {
-		t.Error("Expected still mounted error")
+	if !got.SameCPUCrypt || !got.SubmitFromCryptCPUs || !got.NoReadWorkqueue || !got.NoWriteWorkqueue {
+		t.Errorf("Expected all performance flags to be set, got %+v", got)
 	}
-}
 
-func TestCLI_Close_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "close", "myvolume"})
-	cli.Luks = &MockLuksOperations{
-		LockFunc: func(name string) error {
-			return errors.New("lock failed")
-		},
+	if got.AllowDiscards || strings.Contains(stderr.String(), "WARNING") {
+		t.Error("Performance flags should not enable discards")
 	}
+}
 
-	code := cli.Run()
-
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+func TestCLI_Open_KeySlot(t *testing.T) {
+	for _, args := range [][]string{{"--key-slot", "2"}, {"-S", "2"}} {
+		cli, _, stderr := newTestCLI(append(append([]string{"luks2", "open"}, args...), "/dev/sda1", "myvolume"))
+		var got *luks2.UnlockOptions
+		cli.Luks = &MockLuksOperations{
+			UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+				got = opts
+				return nil
+			},
+		}
+		if code := cli.Run(); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d: %s", args, code, stderr.String())
+		}
+		if got == nil || got.Keyslot == nil || *got.Keyslot != 2 {
+			t.Errorf("%v: expected keyslot 2, got %+v", args, got)
+		}
 	}
 
-	if !strings.Contains(stderr.String(), "Failed to lock") {
-		t.Error("Expected failure message")
+	for _, args := range [][]string{
+		{"--key-slot", "x", "/dev/sda1", "myvolume"},
+		{"--key-slot", "-1", "/dev/sda1", "myvolume"},
+		{"--key-slot", "32", "/dev/sda1", "myvolume"},
+		{"--key-slot", "1", "--escrow", "vault", "/dev/sda1", "myvolume"},
+	} {
+		cli, _, stderr := newTestCLI(append([]string{"luks2", "open"}, args...))
+		cli.Luks = &MockLuksOperations{}
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args, code)
+		}
+		if !strings.Contains(stderr.String(), "--key-slot") {
+			t.Errorf("%v: unexpected error output: %s", args, stderr.String())
+		}
 	}
 }
 
-func TestCLI_Mount_NoArgs(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "mount"})
+func TestCLI_Test(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "test", "-S", "3", "/dev/sda1"})
+	var gotPass string
+	var gotOpts *luks2.UnlockOptions
+	cli.Luks = &MockLuksOperations{
+		TestPassphraseFunc: func(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error) {
+			gotPass, gotOpts = string(passphrase), opts
+			return 3, nil
+		},
+	}
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if gotPass != "testpassword" || gotOpts == nil || gotOpts.Keyslot == nil || *gotOpts.Keyslot != 3 {
+		t.Errorf("unexpected call: %q %+v", gotPass, gotOpts)
+	}
+	if !strings.Contains(stdout.String(), "Passphrase opens keyslot 3") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
 
-	code := cli.Run()
+	cli, _, stderr = newTestCLI([]string{"luks2", "test", "/dev/sda1"})
+	cli.Luks = &MockLuksOperations{
+		TestPassphraseFunc: func(device string, passphrase []byte, opts *luks2.UnlockOptions) (int, error) {
+			if opts.Keyslot != nil {
+				t.Errorf("unexpected keyslot %d", *opts.Keyslot)
+			}
+			return -1, luks2.ErrInvalidPassphrase
+		},
+	}
+	if code := cli.Run(); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "No key available") {
+		t.Errorf("unexpected error output: %s", stderr.String())
+	}
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	cli, _, stderr = newTestCLI([]string{"luks2", "test", "--key-slot", "40", "/dev/sda1"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "--key-slot") {
+		t.Errorf("expected an invalid --key-slot error, got %d: %s", code, stderr.String())
 	}
+}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 mount") {
-		t.Error("Expected mount usage message")
+func TestCLI_KillKeyslot(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "--yes", "keyslots", "kill", "/dev/sda1", "2"})
+	var gotPass string
+	gotSlot := -1
+	cli.Luks = &MockLuksOperations{
+		KillSlotFunc: func(device string, passphrase []byte, keyslot int) error {
+			gotPass, gotSlot = string(passphrase), keyslot
+			return nil
+		},
+	}
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if gotPass != "testpassword" || gotSlot != 2 || !strings.Contains(stdout.String(), "Keyslot 2 destroyed") {
+		t.Errorf("unexpected kill: %q %d\n%s", gotPass, gotSlot, stdout.String())
+	}
+
+	// Cancelled, refused and invalid kills never reach the library
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"keyslots", "kill", "/dev/sda1", "2"}, 0},
+		{[]string{"--yes", "keyslots", "kill", "/dev/sda1", "2"}, 1},
+		{[]string{"--yes", "keyslots", "kill", "/dev/sda1", "32"}, 1},
+	} {
+		cli, _, _ := newTestCLI(append([]string{"luks2"}, tc.args...))
+		cli.Stdin = strings.NewReader("no\n")
+		cli.Luks = &MockLuksOperations{
+			GetUUIDFunc: func(device string) (string, error) { return "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", nil },
+			KillSlotFunc: func(device string, passphrase []byte, keyslot int) error {
+				t.Errorf("%v: keyslot killed", tc.args)
+				return nil
+			},
+		}
+		if code := cli.Run(); code != tc.code {
+			t.Errorf("%v: expected exit code %d, got %d", tc.args, tc.code, code)
+		}
 	}
 }
 
-func TestCLI_Mount_MissingMountpoint(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume"})
+func TestCLI_Open_ByUUID(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "UUID=1234", "myvolume"})
+	var unlocked string
+	cli.Luks = &MockLuksOperations{
+		ResolveDeviceFunc: func(spec string) (string, error) {
+			if spec != "UUID=1234" {
+				t.Errorf("unexpected spec: %s", spec)
+			}
+			return "/dev/sdc", nil
+		},
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			unlocked = device
+			return nil
+		},
+	}
 
 	code := cli.Run()
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
 	}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 mount") {
-		t.Error("Expected mount usage message")
+	if unlocked != "/dev/sdc" {
+		t.Errorf("Expected resolved device /dev/sdc, got %q", unlocked)
 	}
 }
 
-func TestCLI_Mount_AlreadyMounted(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
+func TestCLI_Open_ResolveFailure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "LABEL=missing", "myvolume"})
 	cli.Luks = &MockLuksOperations{
-		IsMountedFunc: func(mountPoint string) (bool, error) {
-			return true, nil
+		ResolveDeviceFunc: func(spec string) (string, error) {
+			return "", errors.New("no LUKS2 volume with label")
 		},
 	}
 
@@ -512,89 +1067,204 @@ func TestCLI_Mount_AlreadyMounted(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "already in use") {
-		t.Error("Expected already mounted error")
+	if !strings.Contains(stderr.String(), "no LUKS2 volume with label") {
+		t.Error("Expected resolve error message")
 	}
 }
 
-func TestCLI_Mount_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
-	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
+func TestCLI_Open_UnknownOption(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "--bogus", "/dev/sda1", "myvolume"})
 
 	code := cli.Run()
 
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Volume mounted successfully") {
-		t.Error("Expected success message")
+	if !strings.Contains(stderr.String(), "Unknown option: --bogus") {
+		t.Error("Expected unknown option message")
 	}
 }
 
-func TestCLI_Unmount_NoArgs(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "unmount"})
+func TestCLI_Open_RetriesWrongPassphrase(t *testing.T) {
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "open", "/dev/sda1", "myvolume"})
+	calls := 0
+	cli.Luks = &MockLuksOperations{
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("failed to unlock any keyslot: %w", luks2.ErrInvalidPassphrase)
+			}
+			return nil
+		},
+	}
 
-	code := cli.Run()
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 unlock attempts, got %d", calls)
+	}
+	if !strings.Contains(stderr.String(), "attempt 3 of 3") {
+		t.Errorf("Expected retry message, got: %s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Volume unlocked successfully") {
+		t.Error("Expected success message")
+	}
+}
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+func TestCLI_Open_RetryOptions(t *testing.T) {
+	cli, _, _ := newTestCLI([]string{"luks2", "open", "--tries", "5", "--retry-state", "/var/lib/luks2/retry.json", "--lockout", "10", "/dev/sda1", "myvolume"})
+	var got *luks2.RetryOptions
+	cli.Luks = &MockLuksOperations{
+		UnlockWithRetryFunc: func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+			got = opts
+			return nil
+		},
 	}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 unmount") {
-		t.Error("Expected unmount usage message")
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got == nil || got.MaxAttempts != 5 || got.StateFile != "/var/lib/luks2/retry.json" || got.LockoutThreshold != 10 || got.Unlock == nil {
+		t.Errorf("Unexpected retry options: %+v", got)
 	}
 }
 
-func TestCLI_Unmount_NotMounted(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
+func TestCLI_Open_RetryOptionErrors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "open", "--tries", "0", "/dev/sda1", "myvolume"},
+		{"luks2", "open", "--tries", "many", "/dev/sda1", "myvolume"},
+		{"luks2", "open", "/dev/sda1", "myvolume", "--retry-state"},
+		{"luks2", "open", "--lockout", "3", "/dev/sda1", "myvolume"},
+	}
+	for _, args := range tests {
+		cli, _, stderr := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[2:], code)
+		}
+		if !strings.Contains(stderr.String(), "Error:") {
+			t.Errorf("%v: expected error message, got %q", args[2:], stderr.String())
+		}
+	}
+}
 
-	code := cli.Run()
+func TestCLI_Open_Escrow(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "open", "--escrow", "vault", "--allow-discards", "/dev/sda1", "myvolume"})
+	var gotService string
+	var gotOpts *luks2.UnlockOptions
+	cli.Luks = &MockLuksOperations{
+		UnlockWithEscrowFunc: func(device, name, service string, opts *luks2.UnlockOptions) error {
+			gotService, gotOpts = service, opts
+			return nil
+		},
+		UnlockWithRetryFunc: func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+			t.Error("escrow unlock prompted for a passphrase")
+			return nil
+		},
+	}
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotService != "vault" || gotOpts == nil || !gotOpts.AllowDiscards {
+		t.Errorf("UnlockWithEscrow got service %q, opts %+v", gotService, gotOpts)
 	}
+	if !strings.Contains(stdout.String(), "Volume unlocked successfully") {
+		t.Error("Expected success message")
+	}
+}
 
-	if !strings.Contains(stderr.String(), "Not mounted") {
-		t.Error("Expected not mounted error")
+func TestCLI_Open_Token(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantID   int // -1 = any
+		wantType string
+	}{
+		{[]string{"--token-only"}, -1, ""},
+		{[]string{"--token-id", "4"}, 4, ""},
+		{[]string{"--token-type", "acme-hsm"}, -1, "acme-hsm"},
+	}
+
+	for _, tt := range tests {
+		cli, _, stderr := newTestCLI(append(append([]string{"luks2", "open", "--allow-discards"}, tt.args...), "/dev/sda1", "myvolume"))
+		var got *luks2.TokenUnlockOptions
+		cli.Luks = &MockLuksOperations{
+			UnlockWithTokenFunc: func(device, name string, opts *luks2.TokenUnlockOptions) error {
+				got = opts
+				return nil
+			},
+			UnlockWithRetryFunc: func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+				t.Errorf("%v: token unlock prompted for a passphrase", tt.args)
+				return nil
+			},
+		}
+		if code := cli.Run(); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d: %s", tt.args, code, stderr.String())
+		}
+		if got == nil || !got.External || got.TokenType != tt.wantType || got.Unlock == nil || !got.Unlock.AllowDiscards {
+			t.Fatalf("%v: unexpected options %+v", tt.args, got)
+		}
+		if (tt.wantID < 0) != (got.TokenID == nil) || (got.TokenID != nil && *got.TokenID != tt.wantID) {
+			t.Errorf("%v: token ID %v, want %d", tt.args, got.TokenID, tt.wantID)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--token-id", "32"},
+		{"--token-only", "--escrow", "vault"},
+		{"--token-type", "acme-hsm", "--key-slot", "1"},
+	} {
+		cli, _, stderr := newTestCLI(append(append([]string{"luks2", "open"}, args...), "/dev/sda1", "myvolume"))
+		if code := cli.Run(); code != 1 || stderr.Len() == 0 {
+			t.Errorf("%v: expected an error, got %d: %s", args, code, stderr.String())
+		}
 	}
 }
 
-func TestCLI_Unmount_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
+func TestCLI_Open_EscrowFailure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "--escrow", "kms", "/dev/sda1", "myvolume"})
 	cli.Luks = &MockLuksOperations{
-		IsMountedFunc: func(mountPoint string) (bool, error) {
-			return true, nil
+		UnlockWithEscrowFunc: func(device, name, service string, opts *luks2.UnlockOptions) error {
+			return luks2.ErrNoEscrow
 		},
 	}
 
-	code := cli.Run()
-
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
 	}
-
-	if !strings.Contains(stdout.String(), "Volume unmounted successfully") {
-		t.Error("Expected success message")
+	if !strings.Contains(stderr.String(), "no escrow token") {
+		t.Errorf("Expected escrow error, got: %s", stderr.String())
 	}
 }
 
-func TestCLI_Info_NoArgs(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "info"})
+func TestCLI_List(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "list"})
+	cli.Luks = &MockLuksOperations{
+		DiscoverFunc: func() ([]luks2.DiscoveredVolume, error) {
+			return []luks2.DiscoveredVolume{
+				{Device: "/dev/sdb1", UUID: "1111", Label: "backup", Version: 2, Unlocked: true, MappedName: "backup"},
+				{Device: "/dev/sdc", UUID: "2222", Version: 1},
+			}, nil
+		},
+	}
 
 	code := cli.Run()
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 info") {
-		t.Error("Expected info usage message")
+	out := stdout.String()
+	for _, want := range []string{"DEVICE", "/dev/sdb1", "LUKS2", "backup", "unlocked (/dev/mapper/backup)", "/dev/sdc", "LUKS1", "locked"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
 	}
 }
 
-func TestCLI_Info_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "info", "/dev/sda1"})
+func TestCLI_List_Empty(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "list"})
 
 	code := cli.Run()
 
@@ -602,20 +1272,16 @@ func TestCLI_Info_Success(t *testing.T) {
 		t.Errorf("Expected exit code 0, got %d", code)
 	}
 
-	output := stdout.String()
-	if !strings.Contains(output, "UUID:") {
-		t.Error("Expected UUID in output")
-	}
-	if !strings.Contains(output, "test-uuid") {
-		t.Error("Expected test-uuid in output")
+	if !strings.Contains(stdout.String(), "No LUKS volumes found") {
+		t.Error("Expected empty message")
 	}
 }
 
-func TestCLI_Info_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "info", "/dev/sda1"})
+func TestCLI_List_Error(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "list"})
 	cli.Luks = &MockLuksOperations{
-		GetVolumeInfoFunc: func(device string) (*luks2.VolumeInfo, error) {
-			return nil, errors.New("read failed")
+		DiscoverFunc: func() ([]luks2.DiscoveredVolume, error) {
+			return nil, errors.New("no sysfs")
 		},
 	}
 
@@ -625,13 +1291,13 @@ func TestCLI_Info_Failure(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "Failed to read volume") {
+	if !strings.Contains(stderr.String(), "Failed to discover volumes") {
 		t.Error("Expected failure message")
 	}
 }
 
-func TestCLI_Wipe_NoArgs(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe"})
+func TestCLI_Status_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "status"})
 
 	code := cli.Run()
 
@@ -639,14 +1305,22 @@ func TestCLI_Wipe_NoArgs(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Usage: luks2 wipe") {
-		t.Error("Expected wipe usage message")
+	if !strings.Contains(stdout.String(), "Usage: luks2 status") {
+		t.Error("Expected status usage message")
 	}
 }
 
-func TestCLI_Wipe_Cancelled(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("NO\n")
+func TestCLI_Status_Active(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "status", "data"})
+	cli.Luks = &MockLuksOperations{
+		StatusFunc: func(name string) (*luks2.VolumeStatus, error) {
+			return &luks2.VolumeStatus{
+				Name: name, Type: "LUKS2", Cipher: "aes-xts-plain64", KeySize: 512,
+				KeyLocation: "dm-crypt", Device: "/dev/sdb1", Offset: 32768, Size: 2048,
+				SectorSize: 4096, Flags: []string{"allow_discards"}, OpenCount: 1,
+			}, nil
+		},
+	}
 
 	code := cli.Run()
 
@@ -654,34 +1328,35 @@ func TestCLI_Wipe_Cancelled(t *testing.T) {
 		t.Errorf("Expected exit code 0, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Wipe cancelled") {
-		t.Error("Expected cancelled message")
+	out := stdout.String()
+	for _, want := range []string{"/dev/mapper/data is active and is in use.", "aes-xts-plain64", "512 bits", "/dev/sdb1", "32768 sectors", "read/write", "allow_discards"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
 	}
 }
 
-func TestCLI_Wipe_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
+func TestCLI_Status_Inactive(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "status", "data"})
+	cli.Luks = &MockLuksOperations{
+		StatusFunc: func(name string) (*luks2.VolumeStatus, error) {
+			return nil, fmt.Errorf("%w: %s", luks2.ErrVolumeNotUnlocked, name)
+		},
+	}
 
 	code := cli.Run()
 
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Volume wiped successfully") {
-		t.Error("Expected success message")
+	if !strings.Contains(stdout.String(), "/dev/mapper/data is inactive.") {
+		t.Error("Expected inactive message")
 	}
 }
 
-func TestCLI_Wipe_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
-	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			return errors.New("wipe failed")
-		},
-	}
+func TestCLI_Close_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "close"})
 
 	code := cli.Run()
 
@@ -689,21 +1364,13 @@ func TestCLI_Wipe_Failure(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "Failed to wipe") {
-		t.Error("Expected failure message")
+	if !strings.Contains(stdout.String(), "Usage: luks2 close") {
+		t.Error("Expected close usage message")
 	}
 }
 
-func TestCLI_Wipe_FullDevice(t *testing.T) {
-	var capturedOpts luks2.WipeOptions
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
-	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			capturedOpts = opts
-			return nil
-		},
-	}
+func TestCLI_Close_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "close", "myvolume"})
 
 	code := cli.Run()
 
@@ -711,129 +1378,142 @@ func TestCLI_Wipe_FullDevice(t *testing.T) {
 		t.Errorf("Expected exit code 0, got %d", code)
 	}
 
-	if capturedOpts.HeaderOnly {
-		t.Error("Expected HeaderOnly to be false for --full")
-	}
-
-	if !strings.Contains(stdout.String(), "Full device wipe") {
-		t.Error("Expected 'Full device wipe' in output")
+	if !strings.Contains(stdout.String(), "Volume locked successfully") {
+		t.Error("Expected success message")
 	}
 }
 
-func TestCLI_Wipe_WithPasses(t *testing.T) {
-	var capturedOpts luks2.WipeOptions
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--passes", "3", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
+func TestCLI_Close_ManagedVolume(t *testing.T) {
+	cli, _, _ := newTestCLI([]string{"luks2", "close", "luks-auto"})
+	var closed string
 	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			capturedOpts = opts
+		CloseVolumeFunc: func(name string, deferred bool) error {
+			if deferred {
+				t.Error("close without --deferred requested a deferred removal")
+			}
+			closed = name
+			return nil
+		},
+		LockFunc: func(name string) error {
+			t.Error("close should tear down through the volume registry")
 			return nil
 		},
 	}
 
-	code := cli.Run()
-
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
-	}
-
-	if capturedOpts.Passes != 3 {
-		t.Errorf("Expected 3 passes, got %d", capturedOpts.Passes)
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
 	}
-
-	if !strings.Contains(stdout.String(), "3 passes") {
-		t.Error("Expected '3 passes' in output")
+	if closed != "luks-auto" {
+		t.Errorf("closed %q, want luks-auto", closed)
 	}
 }
 
-func TestCLI_Wipe_WithRandom(t *testing.T) {
-	var capturedOpts luks2.WipeOptions
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--random", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
+func TestCLI_Close_Deferred(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "close", "--deferred", "busy"})
+	var deferred bool
 	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			capturedOpts = opts
+		CloseVolumeFunc: func(name string, d bool) error {
+			deferred = d
 			return nil
 		},
+		IsUnlockedFunc: func(name string) bool {
+			return true
+		},
 	}
 
-	code := cli.Run()
-
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
 	}
-
-	if !capturedOpts.Random {
-		t.Error("Expected Random to be true")
+	if !deferred {
+		t.Error("expected a deferred close")
 	}
-
-	if !strings.Contains(stdout.String(), "Data: Random") {
-		t.Error("Expected 'Data: Random' in output")
+	if !strings.Contains(stdout.String(), "removal deferred") {
+		t.Errorf("Expected deferred message, got %q", stdout.String())
 	}
 }
 
-func TestCLI_Wipe_WithTrim(t *testing.T) {
-	var capturedOpts luks2.WipeOptions
-	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--trim", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
+func TestCLI_Close_Busy(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "close", "busy"})
 	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			capturedOpts = opts
-			return nil
+		CloseVolumeFunc: func(name string, deferred bool) error {
+			return fmt.Errorf("failed to remove device-mapper: %w", unix.EBUSY)
 		},
 	}
 
-	code := cli.Run()
-
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
 	}
-
-	if !capturedOpts.Trim {
-		t.Error("Expected Trim to be true")
+	if !strings.Contains(stderr.String(), "luks2 close --deferred busy") {
+		t.Errorf("Expected --deferred hint, got %q", stderr.String())
 	}
+}
 
-	if !strings.Contains(stdout.String(), "TRIM: Enabled") {
-		t.Error("Expected 'TRIM: Enabled' in output")
+func TestCLI_Close_UnknownOption(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "close", "--later", "busy"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Unknown option: --later") {
+		t.Errorf("Expected unknown option error, got %q", stderr.String())
 	}
 }
 
-func TestCLI_Wipe_AllOptions(t *testing.T) {
-	var capturedOpts luks2.WipeOptions
-	cli, _, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--passes", "5", "--random", "--trim", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("YES\n")
+func TestCLI_Open_RegistersVolume(t *testing.T) {
+	cli, _, _ := newTestCLI([]string{"luks2", "open", "/dev/sdb1", "data"})
+	var got luks2.ManagedVolume
 	cli.Luks = &MockLuksOperations{
-		WipeFunc: func(opts luks2.WipeOptions) error {
-			capturedOpts = opts
+		RegisterVolumeFunc: func(vol luks2.ManagedVolume) error {
+			got = vol
 			return nil
 		},
 	}
 
-	code := cli.Run()
-
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got.Name != "data" || got.Device != "/dev/sdb1" {
+		t.Errorf("registered %+v", got)
 	}
+}
 
-	if capturedOpts.HeaderOnly {
-		t.Error("Expected HeaderOnly to be false")
+func TestCLI_GC(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "gc"})
+	cli.Luks = &MockLuksOperations{
+		GCVolumesFunc: func() ([]string, error) {
+			return []string{"luks-auto", "old"}, nil
+		},
 	}
-	if capturedOpts.Passes != 5 {
-		t.Errorf("Expected 5 passes, got %d", capturedOpts.Passes)
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
 	}
-	if !capturedOpts.Random {
-		t.Error("Expected Random to be true")
+	if !strings.Contains(stdout.String(), "Removed stale volume: luks-auto\nRemoved stale volume: old") {
+		t.Errorf("unexpected output: %s", stdout.String())
 	}
-	if !capturedOpts.Trim {
-		t.Error("Expected Trim to be true")
+
+	cli, stdout, _ = newTestCLI([]string{"luks2", "gc"})
+	if code := cli.Run(); code != 0 || !strings.Contains(stdout.String(), "No stale volumes") {
+		t.Errorf("Expected no stale volumes, got code %d: %s", code, stdout.String())
 	}
-	if capturedOpts.Device != "/dev/sda1" {
-		t.Errorf("Expected device /dev/sda1, got %s", capturedOpts.Device)
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "gc"})
+	cli.Luks = &MockLuksOperations{
+		GCVolumesFunc: func() ([]string, error) {
+			return nil, errors.New("registry locked")
+		},
+	}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "registry locked") {
+		t.Errorf("Expected gc failure, got code %d: %s", code, stderr.String())
 	}
 }
 
-func TestCLI_Wipe_InvalidPasses(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--passes", "invalid", "/dev/sda1"})
+func TestCLI_Close_StillMounted(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "close", "myvolume"})
+	cli.Luks = &MockLuksOperations{
+		IsMountedFunc: func(mountPoint string) (bool, error) {
+			return true, nil
+		},
+	}
 
 	code := cli.Run()
 
@@ -841,13 +1521,18 @@ func TestCLI_Wipe_InvalidPasses(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "Invalid passes value") {
-		t.Error("Expected 'Invalid passes value' error")
+	if !strings.Contains(stderr.String(), "still mounted") {
+		t.Error("Expected still mounted error")
 	}
 }
 
-func TestCLI_Wipe_MissingPassesValue(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--passes"})
+func TestCLI_Close_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "close", "myvolume"})
+	cli.Luks = &MockLuksOperations{
+		LockFunc: func(name string) error {
+			return errors.New("lock failed")
+		},
+	}
 
 	code := cli.Run()
 
@@ -855,27 +1540,64 @@ func TestCLI_Wipe_MissingPassesValue(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "--passes requires a value") {
-		t.Error("Expected '--passes requires a value' error")
+	if !strings.Contains(stderr.String(), "Failed to lock") {
+		t.Error("Expected failure message")
 	}
 }
 
-func TestCLI_Wipe_UnknownOption(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--unknown", "/dev/sda1"})
+func TestCLI_Ephemeral_Options(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "ephemeral", "-o", "swap,size=256,discard", "--cipher", "aes-cbc-essiv:sha256", "/dev/sda3", "cryptswap"})
+	var got *luks2.EphemeralOptions
+	cli.Luks = &MockLuksOperations{
+		CreateEphemeralFunc: func(name, device string, opts *luks2.EphemeralOptions) error {
+			if name != "cryptswap" || device != "/dev/sda3" {
+				t.Errorf("CreateEphemeral(%q, %q)", name, device)
+			}
+			got = opts
+			return nil
+		},
+	}
 
-	code := cli.Run()
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got == nil || !got.Swap || got.KeySize != 256 || got.Cipher != "aes-cbc-essiv:sha256" || !got.Unlock.AllowDiscards {
+		t.Errorf("Unexpected options: %+v", got)
+	}
+	if !strings.Contains(stdout.String(), "swapon /dev/mapper/cryptswap") {
+		t.Error("Expected swapon hint")
+	}
+}
 
-	if code != 1 {
+func TestCLI_Ephemeral_SwapAndTmp(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "ephemeral", "--swap", "--tmp", "ext4", "/dev/sda3", "scratch"})
+
+	if code := cli.Run(); code != 1 {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
+	if !strings.Contains(stderr.String(), "mutually exclusive") {
+		t.Error("Expected mutually exclusive error")
+	}
+}
 
-	if !strings.Contains(stderr.String(), "Unknown option") {
-		t.Error("Expected 'Unknown option' error")
+func TestCLI_Ephemeral_DeviceNotEmpty(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "ephemeral", "--swap", "/dev/sda3", "cryptswap"})
+	cli.Luks = &MockLuksOperations{
+		CreateEphemeralFunc: func(name, device string, opts *luks2.EphemeralOptions) error {
+			return fmt.Errorf("%w: %s holds a ext4 filesystem", luks2.ErrDeviceNotEmpty, device)
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "--force") {
+		t.Error("Expected --force hint")
 	}
 }
 
-func TestCLI_Wipe_MissingDevice(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--full"})
+func TestCLI_Mount_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "mount"})
 
 	code := cli.Run()
 
@@ -883,63 +1605,32 @@ func TestCLI_Wipe_MissingDevice(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "device path required") {
-		t.Error("Expected 'device path required' error")
+	if !strings.Contains(stdout.String(), "Usage: luks2 mount") {
+		t.Error("Expected mount usage message")
 	}
 }
 
-func TestParseSize(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-		hasError bool
-	}{
-		{"100", 100, false},
-		{"100K", 100 * 1024, false},
-		{"100k", 100 * 1024, false},
-		{"100M", 100 * 1024 * 1024, false},
-		{"100m", 100 * 1024 * 1024, false},
-		{"1G", 1024 * 1024 * 1024, false},
-		{"1g", 1024 * 1024 * 1024, false},
-		{"1T", 1024 * 1024 * 1024 * 1024, false},
-		{"1t", 1024 * 1024 * 1024 * 1024, false},
-		{"", 0, true},
-		{"invalid", 0, true},
-	}
+func TestCLI_Mount_MissingMountpoint(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume"})
 
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result, err := ParseSize(tt.input)
-			if tt.hasError {
-				if err == nil {
-					t.Error("Expected error, got nil")
-				}
-			} else {
-				if err != nil {
-					t.Errorf("Unexpected error: %v", err)
-				}
-				if result != tt.expected {
-					t.Errorf("Expected %d, got %d", tt.expected, result)
-				}
-			}
-		})
-	}
-}
+	code := cli.Run()
 
-func TestClearBytes(t *testing.T) {
-	data := []byte{1, 2, 3, 4, 5}
-	ClearBytes(data)
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
 
-	for i, b := range data {
-		if b != 0 {
-			t.Errorf("Byte at index %d is not zero: %d", i, b)
-		}
+	if !strings.Contains(stdout.String(), "Usage: luks2 mount") {
+		t.Error("Expected mount usage message")
 	}
 }
 
-func TestCLI_PasswordReadError(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "open", "/dev/sda1", "myvolume"})
-	cli.Terminal = &MockTerminal{Err: errors.New("read error")}
+func TestCLI_Mount_AlreadyMounted(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
+	cli.Luks = &MockLuksOperations{
+		IsMountedFunc: func(mountPoint string) (bool, error) {
+			return true, nil
+		},
+	}
 
 	code := cli.Run()
 
@@ -947,14 +1638,14 @@ func TestCLI_PasswordReadError(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "failed to read passphrase") {
-		t.Error("Expected password read error")
+	if !strings.Contains(stderr.String(), "already in use") {
+		t.Error("Expected already mounted error")
 	}
 }
 
-func TestCLI_CreateBlockDevice_Success(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("\n") // empty label
+func TestCLI_Mount_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
+	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
 
 	code := cli.Run()
 
@@ -962,19 +1653,13 @@ func TestCLI_CreateBlockDevice_Success(t *testing.T) {
 		t.Errorf("Expected exit code 0, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "LUKS2 volume created successfully") {
+	if !strings.Contains(stdout.String(), "Volume mounted successfully") {
 		t.Error("Expected success message")
 	}
 }
 
-func TestCLI_CreateBlockDevice_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
-	cli.Stdin = strings.NewReader("\n")
-	cli.Luks = &MockLuksOperations{
-		FormatFunc: func(opts luks2.FormatOptions) error {
-			return errors.New("format failed")
-		},
-	}
+func TestCLI_Unmount_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "unmount"})
 
 	code := cli.Run()
 
@@ -982,64 +1667,2473 @@ func TestCLI_CreateBlockDevice_Failure(t *testing.T) {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "Failed to create volume") {
-		t.Error("Expected failure message")
+	if !strings.Contains(stdout.String(), "Usage: luks2 unmount") {
+		t.Error("Expected unmount usage message")
 	}
 }
 
-func TestCLI_Mount_CreateMountpoint(t *testing.T) {
-	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/newdir"})
-	// Mountpoint doesn't exist, should be created
+func TestCLI_Unmount_NotMounted(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
 
 	code := cli.Run()
 
-	if code != 0 {
-		t.Errorf("Expected exit code 0, got %d", code)
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stdout.String(), "Creating mountpoint") {
-		t.Error("Expected creating mountpoint message")
+	if !strings.Contains(stderr.String(), "Not mounted") {
+		t.Error("Expected not mounted error")
 	}
 }
 
-func TestCLI_Mount_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
-	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
+func TestCLI_Unmount_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
 	cli.Luks = &MockLuksOperations{
-		MountFunc: func(opts luks2.MountOptions) error {
-			return errors.New("mount failed")
+		IsMountedFunc: func(mountPoint string) (bool, error) {
+			return true, nil
 		},
 	}
 
 	code := cli.Run()
 
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Volume unmounted successfully") {
+		t.Error("Expected success message")
+	}
+}
+
+func TestCLI_Info_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "info"})
+
+	code := cli.Run()
+
 	if code != 1 {
 		t.Errorf("Expected exit code 1, got %d", code)
 	}
 
-	if !strings.Contains(stderr.String(), "Failed to mount") {
-		t.Error("Expected failure message")
+	if !strings.Contains(stdout.String(), "Usage: luks2 info") {
+		t.Error("Expected info usage message")
 	}
 }
 
-func TestCLI_Unmount_Failure(t *testing.T) {
-	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
+func TestCLI_Info_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "info", "/dev/sda1"})
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	output := stdout.String()
+	if !strings.Contains(output, "UUID:") {
+		t.Error("Expected UUID in output")
+	}
+	if !strings.Contains(output, "test-uuid") {
+		t.Error("Expected test-uuid in output")
+	}
+}
+
+func TestCLI_Info_FileSize(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "info", "test.luks"})
 	cli.Luks = &MockLuksOperations{
-		IsMountedFunc: func(mountPoint string) (bool, error) {
-			return true, nil
-		},
-		UnmountFunc: func(mountPoint string, flags int) error {
-			return errors.New("unmount failed")
+		GetVolumeInfoFunc: func(device string) (*luks2.VolumeInfo, error) {
+			return &luks2.VolumeInfo{UUID: "test-uuid", Version: 2, FileSize: 1 << 30, FileAllocatedSize: 16 << 20}, nil
 		},
 	}
 
-	code := cli.Run()
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "File Size:      1073741824 bytes apparent / 16777216 bytes allocated") {
+		t.Errorf("Expected file sizes in output, got: %s", stdout.String())
+	}
+}
 
-	if code != 1 {
-		t.Errorf("Expected exit code 1, got %d", code)
+// imagePartitionMock records the loop devices attached and detached for
+// partitions of image files
+type imagePartitionMock struct {
+	MockLuksOperations
+	attached []string
+	readOnly bool
+	detached []string
+}
+
+func newImagePartitionMock() *imagePartitionMock {
+	m := &imagePartitionMock{}
+	m.SetupLoopPartitionFunc = func(filename string, partition int, opts *luks2.LoopOptions) (string, string, error) {
+		m.attached = append(m.attached, fmt.Sprintf("%s:%d", filename, partition))
+		m.readOnly = opts.ReadOnly
+		return "/dev/loop5", fmt.Sprintf("/dev/loop5p%d", partition), nil
 	}
+	m.DetachLoopDeviceFunc = func(loopDev string) error {
+		m.detached = append(m.detached, loopDev)
+		return nil
+	}
+	return m
+}
 
-	if !strings.Contains(stderr.String(), "Failed to unmount") {
-		t.Error("Expected failure message")
+func TestCLI_ImagePartition(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(image, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	spec := image + ":2"
+
+	t.Run("info", func(t *testing.T) {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "info", spec})
+		m := newImagePartitionMock()
+		var read string
+		m.GetVolumeInfoFunc = func(device string) (*luks2.VolumeInfo, error) {
+			read = device
+			return &luks2.VolumeInfo{UUID: "test-uuid", Version: 2}, nil
+		}
+		cli.Luks = m
+
+		if code := cli.Run(); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		if read != "/dev/loop5p2" || !m.readOnly || len(m.detached) != 1 {
+			t.Errorf("read %q (read-only %v), detached %v", read, m.readOnly, m.detached)
+		}
+		if !strings.Contains(stdout.String(), "Volume Information: "+spec) {
+			t.Errorf("Expected the spec in the output, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		for _, fail := range []bool{false, true} {
+			cli, _, _ := newTestCLI([]string{"luks2", "open", spec, "data"})
+			m := newImagePartitionMock()
+			var unlocked string
+			var autoDetach bool
+			m.UnlockWithRetryFunc = func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+				unlocked, autoDetach = device, opts.Unlock.AutoDetachLoop
+				if fail {
+					return luks2.ErrInvalidPassphrase
+				}
+				return nil
+			}
+			var registered luks2.ManagedVolume
+			m.RegisterVolumeFunc = func(vol luks2.ManagedVolume) error {
+				registered = vol
+				return nil
+			}
+			cli.Luks = m
+
+			code := cli.Run()
+			if unlocked != "/dev/loop5p2" || !autoDetach || m.readOnly {
+				t.Errorf("fail=%v: unlocked %q (auto-detach %v, read-only %v)", fail, unlocked, autoDetach, m.readOnly)
+			}
+			if fail {
+				if code != 1 || len(m.detached) != 1 {
+					t.Errorf("failed open: exit code %d, detached %v", code, m.detached)
+				}
+				continue
+			}
+			if code != 0 || len(m.detached) != 0 {
+				t.Errorf("open: exit code %d, detached %v", code, m.detached)
+			}
+			if registered.Device != spec || registered.LoopDevice != "/dev/loop5" {
+				t.Errorf("registered %+v", registered)
+			}
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "create", "--label", "data", spec})
+		cli.Stdin = strings.NewReader("\n")
+		m := newImagePartitionMock()
+		var formatted string
+		m.FormatFunc = func(opts luks2.FormatOptions) error {
+			formatted = opts.Device
+			return nil
+		}
+		cli.Luks = m
+
+		if code := cli.Run(); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		if formatted != "/dev/loop5p2" || len(m.detached) != 1 {
+			t.Errorf("formatted %q, detached %v", formatted, m.detached)
+		}
+		if !strings.Contains(stdout.String(), "luks2 open "+spec+" myvolume") {
+			t.Errorf("Expected the spec in the next steps, got:\n%s", stdout.String())
+		}
+
+		cli, _, stderr := newTestCLI([]string{"luks2", "create", spec, "1G"})
+		cli.Luks = newImagePartitionMock()
+		if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "takes no size") {
+			t.Errorf("Expected a size to be rejected, got %d: %s", code, stderr.String())
+		}
+	})
+}
+
+func TestCLI_Info_Details(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "info", "test.luks"})
+	cli.Luks = &MockLuksOperations{
+		GetVolumeInfoFunc: func(device string) (*luks2.VolumeInfo, error) {
+			return &luks2.VolumeInfo{
+				UUID:          "test-uuid",
+				Version:       2,
+				KeySize:       96,
+				RequiresFlags: []string{"online-reencrypt-v2"},
+				DataOffset:    16 << 20,
+				Integrity:     &luks2.IntegrityInfo{Type: "hmac(sha256)", JournalEncryption: "none", JournalIntegrity: "none"},
+				HeaderSize:    16384,
+				KeyslotsSize:  16744448,
+				Headers:       &luks2.HeaderStatus{SecondaryErr: errors.New("checksum mismatch")},
+				Keyslots: []luks2.KeyslotInfo{{
+					ID: 0, KeySize: 96, Priority: luks2.KeyslotPriorityNormal, KDFType: "argon2id", KDFTime: 4, KDFMemory: 1048576, KDFCPUs: 4,
+					Encryption: "aes-xts-plain64", AreaKeySize: 64, AFHash: "sha256", AFStripes: 4000,
+				}},
+				Tokens: []luks2.TokenSummary{{ID: 0, Type: "systemd-tpm2", Keyslots: []int{0}}},
+			}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	for _, want := range []string{
+		"Key Size:       768 bits",
+		"Integrity:      hmac(sha256)",
+		"Data Segment:   offset 16777216 bytes, size dynamic",
+		"Header Size:    16384 bytes per copy, 16744448 bytes keyslots area",
+		"Backup Header:  damaged (checksum mismatch)",
+		"Requirements:   online-reencrypt-v2",
+		"Slot 0: argon2id, time 4, memory 1048576 KiB, 4 threads (key size: 96 bytes, priority normal)",
+		"area aes-xts-plain64, 64-byte key; af sha256, 4000 stripes",
+		"Token 0: systemd-tpm2 (keyslots [0])",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q in output, got: %s", want, stdout.String())
+		}
+	}
+}
+
+func TestCLI_Info_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "info", "/dev/sda1"})
+	cli.Luks = &MockLuksOperations{
+		GetVolumeInfoFunc: func(device string) (*luks2.VolumeInfo, error) {
+			return nil, errors.New("read failed")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Failed to read volume") {
+		t.Error("Expected failure message")
+	}
+}
+
+func TestCLI_Trim_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "trim"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Usage: luks2 trim") {
+		t.Error("Expected trim usage message")
+	}
+}
+
+func TestCLI_Trim_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "trim", "/mnt/test"})
+	cli.Luks = &MockLuksOperations{
+		TrimFunc: func(mountPoint string) (uint64, error) {
+			if mountPoint != "/mnt/test" {
+				t.Errorf("unexpected mount point %q", mountPoint)
+			}
+			return 1048576, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "/mnt/test: 1048576 bytes trimmed") {
+		t.Errorf("Expected trimmed byte count, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Trim_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "trim", "/mnt/test"})
+	cli.Luks = &MockLuksOperations{
+		TrimFunc: func(mountPoint string) (uint64, error) {
+			return 0, luks2.ErrNotMounted
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to trim") {
+		t.Error("Expected trim failure message")
+	}
+}
+
+func TestCLI_Resize_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "resize"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Usage: luks2 resize") {
+		t.Error("Expected resize usage message")
+	}
+}
+
+func TestCLI_Resize_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "resize", "--size", "2G", "--grow-fs", "data"})
+	var gotName string
+	var gotOpts *luks2.ResizeOptions
+	cli.Luks = &MockLuksOperations{
+		ResizeFunc: func(name string, opts *luks2.ResizeOptions) error {
+			gotName, gotOpts = name, opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotName != "data" || gotOpts.Size != 2<<30 || !gotOpts.GrowFilesystem {
+		t.Errorf("unexpected resize call %q %+v", gotName, gotOpts)
+	}
+	if !strings.Contains(stdout.String(), "resized successfully") {
+		t.Error("Expected success message")
+	}
+}
+
+func TestCLI_Resize_Errors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--size", "abc", "data"},
+		{"--bogus", "data"},
+		{"--grow-fs"},
+	} {
+		cli, _, _ := newTestCLI(append([]string{"luks2", "resize"}, args...))
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args, code)
+		}
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "resize", "data"})
+	cli.Luks = &MockLuksOperations{
+		ResizeFunc: func(name string, opts *luks2.ResizeOptions) error {
+			return luks2.ErrVolumeNotUnlocked
+		},
+	}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "Failed to resize") {
+		t.Errorf("expected resize failure, got code %d: %s", code, stderr.String())
+	}
+}
+
+func TestCLI_Up_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "up"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Usage: luks2 up") {
+		t.Error("Expected up usage message")
+	}
+}
+
+func TestCLI_Up_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "up", "--name", "secret", "-o", "noatime", "--allow-discards", "encrypted.luks", "/mnt/x"})
+	var gotOpts *luks2.OpenMountOptions
+	cli.Luks = &MockLuksOperations{
+		OpenAndMountFunc: func(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error) {
+			if device != "encrypted.luks" || mountPoint != "/mnt/x" || string(passphrase) != "testpassword" {
+				t.Errorf("unexpected call %s %s %q", device, mountPoint, passphrase)
+			}
+			gotOpts = opts
+			return &luks2.MountedVolume{Device: device, LoopDevice: "/dev/loop4", Name: opts.Name, MountPoint: mountPoint, FSType: luks2.FilesystemExt4}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotOpts.Name != "secret" || gotOpts.Data != "noatime" || !gotOpts.Unlock.AllowDiscards || !gotOpts.CreateMountPoint {
+		t.Errorf("unexpected options %+v", gotOpts)
+	}
+	output := stdout.String()
+	for _, want := range []string{"Loop device:    /dev/loop4", "/dev/mapper/secret", "Mounted on:     /mnt/x (ext4)", "luks2 down /mnt/x"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output: %s", want, output)
+		}
+	}
+}
+
+// unprivileged reports a process running without root
+func unprivileged() luks2.Privileges {
+	return luks2.Privileges{}
+}
+
+func TestCLI_Unprivileged(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "/dev/sdb1", "data"})
+	cli.Luks = &MockLuksOperations{
+		PrivilegesFunc: unprivileged,
+		UnlockWithRetryFunc: func(device, name string, prompt luks2.PassphraseFunc, opts *luks2.RetryOptions) error {
+			t.Error("open should fail before unlocking")
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	for _, want := range []string{"permission denied: open requires CAP_SYS_ADMIN", "sudo", "luks2 up"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected %q in output: %s", want, stderr.String())
+		}
+	}
+}
+
+func TestCLI_Up_Udisks(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "up", "-t", "ext4", "encrypted.luks", "/mnt/x"})
+	cli.Luks = &MockLuksOperations{
+		PrivilegesFunc: unprivileged,
+		UdisksOpenAndMountFunc: func(device string, passphrase []byte, fsType, options string) (*udisks.Volume, error) {
+			if device != "encrypted.luks" || string(passphrase) != "testpassword" || fsType != "ext4" {
+				t.Errorf("unexpected call %s %q %s", device, passphrase, fsType)
+			}
+			return &udisks.Volume{Device: device, LoopDevice: "/dev/loop2", Cleartext: "/dev/dm-3", MountPoint: "/run/media/user/secret"}, nil
+		},
+		OpenAndMountFunc: func(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error) {
+			t.Error("unprivileged up should go through UDisks2")
+			return nil, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	output := stdout.String()
+	for _, want := range []string{"UDisks2", "Loop device:    /dev/loop2", "Mounted on:     /run/media/user/secret", "luks2 down /run/media/user/secret"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output: %s", want, output)
+		}
+	}
+}
+
+func TestCLI_Up_UdisksUnavailable(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "up", "/dev/sdb1", "/mnt/x"})
+	cli.Luks = &MockLuksOperations{PrivilegesFunc: unprivileged}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "udisks2 not available") || !strings.Contains(stderr.String(), "sudo") {
+		t.Errorf("unexpected output: %s", stderr.String())
+	}
+}
+
+func TestCLI_Down_Udisks(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "down", "/run/media/user/secret"})
+	var got string
+	cli.Luks = &MockLuksOperations{
+		PrivilegesFunc: unprivileged,
+		UdisksUnmountAndCloseFunc: func(mountPoint string) error {
+			got = mountPoint
+			return nil
+		},
+		UnmountAndCloseFunc: func(mountPoint string) error {
+			t.Error("unprivileged down should go through UDisks2")
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 || got != "/run/media/user/secret" {
+		t.Fatalf("code = %d, closed %q", code, got)
+	}
+	if !strings.Contains(stdout.String(), "unmounted and closed") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestCLI_Up_Errors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--bogus", "a.luks", "/mnt/x"},
+		{"--name"},
+		{"a.luks", "/mnt/x", "extra"},
+	} {
+		cli, _, _ := newTestCLI(append([]string{"luks2", "up"}, args...))
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args, code)
+		}
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "up", "a.luks", "/mnt/x"})
+	cli.Luks = &MockLuksOperations{
+		OpenAndMountFunc: func(device, mountPoint string, passphrase []byte, opts *luks2.OpenMountOptions) (*luks2.MountedVolume, error) {
+			return nil, luks2.ErrInvalidPassphrase
+		},
+	}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "Failed to open volume") {
+		t.Errorf("expected open failure, got code %d: %s", code, stderr.String())
+	}
+}
+
+func TestCLI_Down(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "down"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stdout.String(), "Usage: luks2 down") {
+		t.Errorf("Expected down usage, got code %d", code)
+	}
+
+	cli, stdout, _ = newTestCLI([]string{"luks2", "down", "/mnt/x"})
+	var got string
+	cli.Luks = &MockLuksOperations{
+		UnmountAndCloseFunc: func(mountPoint string) error {
+			got = mountPoint
+			return nil
+		},
+	}
+	if code := cli.Run(); code != 0 || got != "/mnt/x" {
+		t.Errorf("Expected teardown of /mnt/x, got code %d, %q", code, got)
+	}
+	if !strings.Contains(stdout.String(), "unmounted and closed") {
+		t.Error("Expected success message")
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "down", "/mnt/x"})
+	cli.Luks = &MockLuksOperations{
+		UnmountAndCloseFunc: func(mountPoint string) error {
+			return luks2.ErrNotMounted
+		},
+	}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "not mounted") {
+		t.Errorf("expected teardown failure, got code %d: %s", code, stderr.String())
+	}
+}
+
+func TestCLI_Wipe_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Usage: luks2 wipe") {
+		t.Error("Expected wipe usage message")
+	}
+}
+
+func TestCLI_Wipe_Cancelled(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("NO\n")
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Wipe cancelled") {
+		t.Error("Expected cancelled message")
+	}
+}
+
+func TestCLI_Wipe_ConfirmUUID(t *testing.T) {
+	const uuid = "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1"
+	tests := []struct {
+		name    string
+		args    []string
+		env     string
+		stdin   string
+		code    int
+		wiped   bool
+		message string
+	}{
+		{"uuid typed", nil, "", uuid + "\n", 0, true, "Type the UUID of /dev/sda1"},
+		{"uuid typed in upper case", nil, "", strings.ToUpper(uuid) + "\n", 0, true, "Type the UUID"},
+		{"YES is not the uuid", nil, "", "YES\n", 0, false, "Wipe cancelled"},
+		{"--yes is not enough", []string{"--yes"}, "", "", 1, false, iKnowFlag + uuid},
+		{"--batch is not enough", []string{"--batch"}, "1", "", 1, false, iKnowFlag + uuid},
+		{"i know the uuid", []string{iKnowFlag + uuid}, "", "", 0, true, "Confirmed by"},
+		{"i know the uuid with the environment off", []string{iKnowFlag + uuid}, "0", "", 0, true, "Confirmed by"},
+		{"i know another uuid", []string{"--yes", iKnowFlag + "0e41b0a6"}, "", "", 1, false, "does not match"},
+		{"YES with the environment off", nil, "0", "YES\n", 0, true, "Type 'YES'"},
+		{"--yes with the environment off", []string{"--yes"}, "0", "", 0, true, "Confirmed by --yes"},
+		{"--confirm-uuid overrides the environment", []string{"--confirm-uuid", "--yes"}, "0", "", 1, false, iKnowFlag + uuid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(confirmUUIDEnv, tt.env)
+			args := append(append([]string{"luks2"}, tt.args...), "wipe", "/dev/sda1")
+			cli, stdout, stderr := newTestCLI(args)
+			cli.Stdin = strings.NewReader(tt.stdin)
+			wiped := false
+			cli.Luks = &MockLuksOperations{
+				GetUUIDFunc: func(device string) (string, error) { return uuid, nil },
+				WipeFunc: func(opts luks2.WipeOptions) error {
+					wiped = true
+					return nil
+				},
+			}
+
+			if code := cli.Run(); code != tt.code {
+				t.Errorf("expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+			if wiped != tt.wiped {
+				t.Errorf("wiped = %v, want %v", wiped, tt.wiped)
+			}
+			if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.message) {
+				t.Errorf("expected %q in output:\n%s", tt.message, out)
+			}
+		})
+	}
+}
+
+func TestCLI_Erase(t *testing.T) {
+	const uuid = "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1"
+	tests := []struct {
+		name    string
+		args    []string
+		env     string
+		luks    bool
+		stdin   string
+		code    int
+		erased  bool
+		message string
+	}{
+		{"uuid typed", nil, "", true, uuid + "\n", 0, true, "Volume erased successfully"},
+		{"YES is not the uuid", nil, "", true, "YES\n", 0, false, "Erase cancelled"},
+		{"--yes is not enough", []string{"--yes"}, "", true, "", 1, false, iKnowFlag + uuid},
+		{"the environment does not apply", []string{"--yes"}, "0", true, "", 1, false, iKnowFlag + uuid},
+		{"i know the uuid", []string{"--batch", iKnowFlag + uuid}, "", true, "", 0, true, "Confirmed by"},
+		{"not a LUKS volume", []string{iKnowFlag + uuid}, "", false, "", 1, false, "does not hold a LUKS volume"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(confirmUUIDEnv, tt.env)
+			args := append(append([]string{"luks2"}, tt.args...), "erase", "--trim", "/dev/sda1")
+			cli, stdout, stderr := newTestCLI(args)
+			cli.Stdin = strings.NewReader(tt.stdin)
+			erased := false
+			cli.Luks = &MockLuksOperations{
+				GetUUIDFunc: func(device string) (string, error) {
+					if !tt.luks {
+						return "", errors.New("not a LUKS device")
+					}
+					return uuid, nil
+				},
+				WipeFunc: func(opts luks2.WipeOptions) error {
+					if !opts.CryptoErase || !opts.Trim || opts.Device != "/dev/sda1" {
+						t.Errorf("unexpected wipe options: %+v", opts)
+					}
+					erased = true
+					return nil
+				},
+			}
+
+			if code := cli.Run(); code != tt.code {
+				t.Errorf("expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+			if erased != tt.erased {
+				t.Errorf("erased = %v, want %v", erased, tt.erased)
+			}
+			if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.message) {
+				t.Errorf("expected %q in output:\n%s", tt.message, out)
+			}
+		})
+	}
+}
+
+func TestCLI_Wipe_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Volume wiped successfully") {
+		t.Error("Expected success message")
+	}
+}
+
+func TestCLI_Wipe_Tuning(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--direct", "--workers", "8", "--buffer-size", "16M", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	var got luks2.WipeOptions
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			got = opts
+			opts.Progress(luks2.WipeProgress{Pass: 1, Passes: 1, Written: 512, Total: 1024, BytesPerSecond: 2 << 20})
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !got.Direct || got.Workers != 8 || got.BufferSize != 16<<20 {
+		t.Errorf("unexpected wipe options %+v", got)
+	}
+	if !strings.Contains(stdout.String(), "Pass 1/1:  50.0%  2.0 MiB/s") {
+		t.Errorf("Expected progress line, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Wipe_IOURing(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--queue-depth", "64", "/dev/nvme0n1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	var got luks2.WipeOptions
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			got = opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got.IOEngine != luks2.IOEngineURing || got.QueueDepth != 64 {
+		t.Errorf("unexpected wipe options %+v", got)
+	}
+	if !strings.Contains(stdout.String(), "Engine: io_uring (queue depth 64)") {
+		t.Errorf("Expected engine line, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Wipe_CryptoErase(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--crypto-erase", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	var got luks2.WipeOptions
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			got = opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !got.CryptoErase || got.HeaderOnly {
+		t.Errorf("unexpected wipe options %+v", got)
+	}
+	if !strings.Contains(stdout.String(), "Mode: Crypto-erase") {
+		t.Errorf("Expected crypto-erase mode, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Wipe_InvalidTuning(t *testing.T) {
+	for _, args := range [][]string{
+		{"--workers", "0"},
+		{"--workers"},
+		{"--buffer-size", "1T"},
+		{"--buffer-size", "abc"},
+		{"--queue-depth", "0"},
+	} {
+		cli, _, _ := newTestCLI(append([]string{"luks2", "wipe", "--full"}, append(args, "/dev/sda1")...))
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args, code)
+		}
+	}
+}
+
+func TestCLI_Wipe_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			return errors.New("wipe failed")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Failed to wipe") {
+		t.Error("Expected failure message")
+	}
+}
+
+func TestCLI_Wipe_FullDevice(t *testing.T) {
+	var capturedOpts luks2.WipeOptions
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			capturedOpts = opts
+			return nil
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if capturedOpts.HeaderOnly {
+		t.Error("Expected HeaderOnly to be false for --full")
+	}
+
+	if !strings.Contains(stdout.String(), "Full device wipe") {
+		t.Error("Expected 'Full device wipe' in output")
+	}
+}
+
+func TestCLI_Wipe_WithPasses(t *testing.T) {
+	var capturedOpts luks2.WipeOptions
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--passes", "3", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			capturedOpts = opts
+			return nil
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if capturedOpts.Passes != 3 {
+		t.Errorf("Expected 3 passes, got %d", capturedOpts.Passes)
+	}
+
+	if !strings.Contains(stdout.String(), "3 passes") {
+		t.Error("Expected '3 passes' in output")
+	}
+}
+
+func TestCLI_Wipe_WithRandom(t *testing.T) {
+	var capturedOpts luks2.WipeOptions
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--random", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			capturedOpts = opts
+			return nil
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !capturedOpts.Random {
+		t.Error("Expected Random to be true")
+	}
+
+	if !strings.Contains(stdout.String(), "Data: Random") {
+		t.Error("Expected 'Data: Random' in output")
+	}
+}
+
+func TestCLI_Wipe_WithTrim(t *testing.T) {
+	var capturedOpts luks2.WipeOptions
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--trim", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			capturedOpts = opts
+			return nil
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !capturedOpts.Trim {
+		t.Error("Expected Trim to be true")
+	}
+
+	if !strings.Contains(stdout.String(), "TRIM: Enabled") {
+		t.Error("Expected 'TRIM: Enabled' in output")
+	}
+}
+
+func TestCLI_Wipe_AllOptions(t *testing.T) {
+	var capturedOpts luks2.WipeOptions
+	cli, _, _ := newTestCLI([]string{"luks2", "wipe", "--full", "--passes", "5", "--random", "--trim", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("YES\n")
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			capturedOpts = opts
+			return nil
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if capturedOpts.HeaderOnly {
+		t.Error("Expected HeaderOnly to be false")
+	}
+	if capturedOpts.Passes != 5 {
+		t.Errorf("Expected 5 passes, got %d", capturedOpts.Passes)
+	}
+	if !capturedOpts.Random {
+		t.Error("Expected Random to be true")
+	}
+	if !capturedOpts.Trim {
+		t.Error("Expected Trim to be true")
+	}
+	if capturedOpts.Device != "/dev/sda1" {
+		t.Errorf("Expected device /dev/sda1, got %s", capturedOpts.Device)
+	}
+}
+
+func TestCLI_Wipe_InvalidPasses(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--passes", "invalid", "/dev/sda1"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Invalid passes value") {
+		t.Error("Expected 'Invalid passes value' error")
+	}
+}
+
+func TestCLI_Wipe_MissingPassesValue(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--passes"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "--passes requires a value") {
+		t.Error("Expected '--passes requires a value' error")
+	}
+}
+
+func TestCLI_Wipe_UnknownOption(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--unknown", "/dev/sda1"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Unknown option") {
+		t.Error("Expected 'Unknown option' error")
+	}
+}
+
+func TestCLI_Wipe_MissingDevice(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "wipe", "--full"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "device path required") {
+		t.Error("Expected 'device path required' error")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		hasError bool
+	}{
+		{"100", 100, false},
+		{"100K", 100 * 1024, false},
+		{"100k", 100 * 1024, false},
+		{"100M", 100 * 1024 * 1024, false},
+		{"100m", 100 * 1024 * 1024, false},
+		{"1G", 1024 * 1024 * 1024, false},
+		{"1g", 1024 * 1024 * 1024, false},
+		{"1T", 1024 * 1024 * 1024 * 1024, false},
+		{"1t", 1024 * 1024 * 1024 * 1024, false},
+		{"", 0, true},
+		{"invalid", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseSize(tt.input)
+			if tt.hasError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if result != tt.expected {
+					t.Errorf("Expected %d, got %d", tt.expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestClearBytes(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5}
+	ClearBytes(data)
+
+	for i, b := range data {
+		if b != 0 {
+			t.Errorf("Byte at index %d is not zero: %d", i, b)
+		}
+	}
+}
+
+func TestCLI_PasswordReadError(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "/dev/sda1", "myvolume"})
+	cli.Terminal = &MockTerminal{Err: errors.New("read error")}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "failed to read passphrase") {
+		t.Error("Expected password read error")
+	}
+}
+
+func TestCLI_CreateBlockDevice_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("\n") // empty label
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "LUKS2 volume created successfully") {
+		t.Error("Expected success message")
+	}
+}
+
+func TestCLI_CreateBlockDevice_OverLUKS(t *testing.T) {
+	const uuid = "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1"
+	for _, tt := range []struct {
+		stdin string
+		force bool
+	}{
+		{"NO\n", false},
+		{"YES\n", false},
+		{uuid + "\n\n", true},
+	} {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
+		cli.Stdin = strings.NewReader(tt.stdin)
+		var formatted *luks2.FormatOptions
+		cli.Luks = &MockLuksOperations{
+			GetUUIDFunc: func(device string) (string, error) { return uuid, nil },
+			FormatFunc: func(opts luks2.FormatOptions) error {
+				formatted = &opts
+				return nil
+			},
+		}
+
+		if code := cli.Run(); code != 0 {
+			t.Errorf("%q: expected exit code 0, got %d", tt.stdin, code)
+		}
+		if !strings.Contains(stdout.String(), "already holds LUKS volume "+uuid) {
+			t.Errorf("%q: expected a warning, got:\n%s", tt.stdin, stdout.String())
+		}
+		if (formatted != nil) != tt.force || (formatted != nil && !formatted.Force) {
+			t.Errorf("%q: formatted with %+v", tt.stdin, formatted)
+		}
+	}
+}
+
+func TestCLI_CreateBlockDevice_OverSignatures(t *testing.T) {
+	for _, tt := range []struct {
+		stdin string
+		force bool
+	}{
+		{"NO\n", false},
+		{"YES\n\n", true},
+	} {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
+		cli.Stdin = strings.NewReader(tt.stdin)
+		var formatted *luks2.FormatOptions
+		cli.Luks = &MockLuksOperations{
+			ProbeSignaturesFunc: func(device string) ([]luks2.Signature, error) {
+				return []luks2.Signature{{Type: "ext4", Usage: luks2.SignatureUsageFilesystem, Offset: 0x438}}, nil
+			},
+			FormatFunc: func(opts luks2.FormatOptions) error {
+				formatted = &opts
+				return nil
+			},
+		}
+
+		if code := cli.Run(); code != 0 {
+			t.Errorf("%q: expected exit code 0, got %d", tt.stdin, code)
+		}
+		if !strings.Contains(stdout.String(), "  ext4 at offset 0x438") {
+			t.Errorf("%q: expected the signature listed, got:\n%s", tt.stdin, stdout.String())
+		}
+		if (formatted != nil) != tt.force || (formatted != nil && !formatted.Force) {
+			t.Errorf("%q: formatted with %+v", tt.stdin, formatted)
+		}
+	}
+}
+
+func TestCLI_Create_StrengthMeter(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("\n")
+
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	// "testpassword" is two dictionary words
+	out := stdout.String()
+	if !strings.Contains(out, "Strength: [#----] very weak") {
+		t.Errorf("Expected strength meter, got:\n%s", out)
+	}
+	if !strings.Contains(out, "  - contains a common word or password") {
+		t.Errorf("Expected strength feedback, got:\n%s", out)
+	}
+	if strings.Index(out, "Strength:") > strings.Index(out, "Confirm passphrase:") {
+		t.Error("Expected meter before the confirmation prompt")
+	}
+}
+
+func TestCLI_CreateBlockDevice_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "create", "/dev/sda1"})
+	cli.Stdin = strings.NewReader("\n")
+	cli.Luks = &MockLuksOperations{
+		FormatFunc: func(opts luks2.FormatOptions) error {
+			return errors.New("format failed")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Failed to create volume") {
+		t.Error("Expected failure message")
+	}
+}
+
+func TestCLI_Mount_CreateMountpoint(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/newdir"})
+	// Mountpoint doesn't exist, should be created
+
+	code := cli.Run()
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Creating mountpoint") {
+		t.Error("Expected creating mountpoint message")
+	}
+}
+
+func TestCLI_Mount_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
+	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
+	cli.Luks = &MockLuksOperations{
+		MountFunc: func(opts luks2.MountOptions) error {
+			return errors.New("mount failed")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Failed to mount") {
+		t.Error("Expected failure message")
+	}
+}
+
+func TestCLI_Unmount_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
+	cli.Luks = &MockLuksOperations{
+		IsMountedFunc: func(mountPoint string) (bool, error) {
+			return true, nil
+		},
+		UnmountFunc: func(mountPoint string, flags int) error {
+			return errors.New("unmount failed")
+		},
+	}
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stderr.String(), "Failed to unmount") {
+		t.Error("Expected failure message")
+	}
+}
+
+func TestCLI_Unmount_Flags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"/mnt/test"}, 0},
+		{[]string{"--force", "/mnt/test"}, unix.MNT_FORCE},
+		{[]string{"/mnt/test", "-l"}, unix.MNT_DETACH},
+		{[]string{"-f", "--lazy", "/mnt/test"}, unix.MNT_FORCE | unix.MNT_DETACH},
+	}
+	for _, tt := range tests {
+		got := -1
+		cli, stdout, _ := newTestCLI(append([]string{"luks2", "unmount"}, tt.args...))
+		cli.Luks = &MockLuksOperations{
+			IsMountedFunc: func(mountPoint string) (bool, error) {
+				return mountPoint == "/mnt/test", nil
+			},
+			UnmountFunc: func(mountPoint string, flags int) error {
+				got = flags
+				return nil
+			},
+		}
+
+		if code := cli.Run(); code != 0 {
+			t.Errorf("%v: expected exit code 0, got %d", tt.args, code)
+		}
+		if got != tt.want {
+			t.Errorf("%v: flags = %#x, want %#x", tt.args, got, tt.want)
+		}
+		if tt.want&unix.MNT_DETACH != 0 && !strings.Contains(stdout.String(), "Volume detached") {
+			t.Errorf("%v: expected lazy unmount message, got %q", tt.args, stdout.String())
+		}
+	}
+}
+
+func TestCLI_Unmount_UnknownOption(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "--now", "/mnt/test"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Unknown option: --now") {
+		t.Errorf("Expected unknown option error, got %q", stderr.String())
+	}
+}
+
+func TestCLI_Unmount_Busy(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "unmount", "/mnt/test"})
+	cli.Luks = &MockLuksOperations{
+		IsMountedFunc: func(mountPoint string) (bool, error) {
+			return true, nil
+		},
+		UnmountFunc: func(mountPoint string, flags int) error {
+			return fmt.Errorf("unmount syscall failed: %w", unix.EBUSY)
+		},
+		FindMountUsersFunc: func(mountPoint string) ([]luks2.MountUser, error) {
+			return []luks2.MountUser{
+				{PID: 42, Command: "bash", Access: []string{"cwd"}},
+				{PID: 300, Command: "vim", Access: []string{"file", "mmap"}},
+			}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	for _, want := range []string{"Processes using /mnt/test", "42", "bash", "300", "vim", "file,mmap", "luks2 unmount --lazy /mnt/test"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, stderr.String())
+		}
+	}
+}
+
+func TestCLI_Mount_Options(t *testing.T) {
+	var got luks2.MountOptions
+	cli, _, _ := newTestCLI([]string{"luks2", "mount", "-t", "ext4", "-o", "noatime,discard", "--data-safety", "journal", "myvolume", "/mnt/test"})
+	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
+	cli.Luks = &MockLuksOperations{
+		MountFunc: func(opts luks2.MountOptions) error {
+			got = opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	if got.Device != "myvolume" || got.MountPoint != "/mnt/test" {
+		t.Errorf("Unexpected device/mountpoint: %s %s", got.Device, got.MountPoint)
+	}
+	if got.FSType != "ext4" || got.Data != "noatime,discard" || got.DataSafety != luks2.DataSafetyJournal {
+		t.Errorf("Unexpected mount options: %+v", got)
+	}
+}
+
+func TestCLI_Mount_DetectsFilesystemByDefault(t *testing.T) {
+	var got luks2.MountOptions
+	cli, _, _ := newTestCLI([]string{"luks2", "mount", "myvolume", "/mnt/test"})
+	cli.FS = &MockFileSystem{Files: map[string]bool{"/mnt/test": true}}
+	cli.Luks = &MockLuksOperations{
+		MountFunc: func(opts luks2.MountOptions) error {
+			got = opts
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got.FSType != "" {
+		t.Errorf("Expected empty FSType for detection, got %q", got.FSType)
+	}
+}
+
+func TestCLI_Mount_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown option", []string{"luks2", "mount", "--bogus", "myvolume", "/mnt/test"}, "Unknown option"},
+		{"missing value", []string{"luks2", "mount", "myvolume", "/mnt/test", "-o"}, "requires a value"},
+		{"extra argument", []string{"luks2", "mount", "myvolume", "/mnt/test", "extra"}, "volume name and mountpoint required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, _, stderr := newTestCLI(tt.args)
+			if code := cli.Run(); code != 1 {
+				t.Errorf("Expected exit code 1, got %d", code)
+			}
+			if !strings.Contains(stderr.String(), tt.want) {
+				t.Errorf("Expected %q in stderr, got %q", tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLI_Repair_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "repair"})
+
+	code := cli.Run()
+
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+
+	if !strings.Contains(stdout.String(), "Usage: luks2 repair") {
+		t.Error("Expected usage message")
+	}
+}
+
+func TestCLI_Repair_UnknownOption(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "repair", "--force", "/dev/sdb1"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Unknown option: --force") {
+		t.Errorf("Expected unknown option error, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Repair_Clean(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "repair", "/dev/sdb1"})
+	repaired := false
+	cli.Luks = &MockLuksOperations{
+		RepairFunc: func(device string) error {
+			repaired = true
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if repaired {
+		t.Error("Repair should not run for a clean volume")
+	}
+	if !strings.Contains(stdout.String(), "No problems found") {
+		t.Errorf("Expected clean report, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Repair_Success(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "repair", "/dev/sdb1"})
+	repaired := false
+	cli.Luks = &MockLuksOperations{
+		ValidateFunc: func(device string) (*luks2.ValidationReport, error) {
+			report := &luks2.ValidationReport{Device: device}
+			if !repaired {
+				report.Problems = []luks2.Problem{{
+					Severity:   luks2.SeverityError,
+					Object:     "primary header",
+					Message:    "header checksum mismatch",
+					Repairable: true,
+				}}
+			}
+			return report, nil
+		},
+		RepairFunc: func(device string) error {
+			repaired = true
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if !repaired {
+		t.Error("Expected Repair to be called")
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "error: primary header: header checksum mismatch [repairable]") {
+		t.Errorf("Expected problem listing, got: %s", out)
+	}
+	if !strings.Contains(out, "Repair complete") {
+		t.Errorf("Expected repair confirmation, got: %s", out)
+	}
+}
+
+func TestCLI_Repair_DryRun(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "repair", "--dry-run", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		ValidateFunc: func(device string) (*luks2.ValidationReport, error) {
+			return &luks2.ValidationReport{Problems: []luks2.Problem{{
+				Severity: luks2.SeverityError, Object: "secondary header", Message: "damaged", Repairable: true,
+			}}}, nil
+		},
+		RepairFunc: func(device string) error {
+			t.Error("Repair must not run in dry-run mode")
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1 for unrepaired errors, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Dry run") {
+		t.Errorf("Expected dry run note, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Repair_Unrepairable(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "repair", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		ValidateFunc: func(device string) (*luks2.ValidationReport, error) {
+			return &luks2.ValidationReport{Problems: []luks2.Problem{{
+				Severity: luks2.SeverityError, Object: "keyslot 1", Message: "area overlaps keyslot 0",
+			}}}, nil
+		},
+		RepairFunc: func(device string) error {
+			t.Error("Repair must not run without repairable problems")
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "manual recovery") {
+		t.Errorf("Expected manual recovery note, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Repair_ValidateFailure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "repair", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		ValidateFunc: func(device string) (*luks2.ValidationReport, error) {
+			return nil, errors.New("no valid header copy")
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to check volume") {
+		t.Errorf("Expected failure message, got: %s", stderr.String())
+	}
+}
+
+// auditReport is the report the audit command tests print
+func auditReport(device string) (*luks2.AuditReport, error) {
+	return &luks2.AuditReport{
+		Device: device,
+		UUID:   "12345678-1234-1234-1234-123456789abc",
+		Score:  75,
+		Findings: []luks2.AuditFinding{{
+			Severity: luks2.AuditHigh,
+			Check:    luks2.AuditCheckSecondaryHeader,
+			Object:   "secondary header",
+			Message:  "missing or damaged",
+		}},
+		Keyslots: []luks2.KeyslotKDFReport{{Keyslot: 0, Type: "pbkdf2", Hash: "sha1", Iterations: 1000, Weak: true}},
+	}, nil
+}
+
+func TestCLI_Audit(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "audit", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{AuditFunc: auditReport}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1 for a high finding, got %d", code)
+	}
+	out := stdout.String()
+	for _, want := range []string{"Score:          75/100", "pbkdf2-sha1, 1000 iterations", "weak", "high: secondary header: missing or damaged"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output, got: %s", want, out)
+		}
+	}
+
+	cli, stdout, _ = newTestCLI([]string{"luks2", "audit", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{}
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0 without findings, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "No findings") {
+		t.Errorf("Expected clean report, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Audit_JSON(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "audit", "--json", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{AuditFunc: auditReport}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1 for a high finding, got %d", code)
+	}
+	var report luks2.AuditReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Output is not a JSON report: %v\n%s", err, stdout.String())
+	}
+	if report.Device != "/dev/sdb1" || report.Score != 75 || len(report.Findings) != 1 || report.Findings[0].Check != luks2.AuditCheckSecondaryHeader || len(report.Keyslots) != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
+
+func TestCLI_Audit_Failure(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "audit", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		AuditFunc: func(device string) (*luks2.AuditReport, error) {
+			return nil, errors.New("no valid header copy")
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to audit volume") {
+		t.Errorf("Expected failure message, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Doctor(t *testing.T) {
+	var gotCrypttab, gotFstab string
+	cli, stdout, _ := newTestCLI([]string{"luks2", "doctor", "--fstab", "/mnt/image/etc/fstab"})
+	cli.Luks = &MockLuksOperations{
+		CheckTabFilesFunc: func(crypttab, fstab string) (*luks2.TabReport, error) {
+			gotCrypttab, gotFstab = crypttab, fstab
+			return &luks2.TabReport{Crypttab: 2, Fstab: 3, Findings: []luks2.AuditFinding{{
+				Severity: luks2.AuditCritical,
+				Check:    luks2.TabCheckRandomKey,
+				Object:   "crypttab cryptswap",
+				Message:  "/dev/sda3 holds a LUKS volume",
+			}}}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1 for a critical finding, got %d", code)
+	}
+	if gotCrypttab != "/etc/crypttab" || gotFstab != "/mnt/image/etc/fstab" {
+		t.Errorf("checked %s and %s", gotCrypttab, gotFstab)
+	}
+	out := stdout.String()
+	for _, want := range []string{"Checked 2 crypttab entries", "1 problem(s) found", "critical: crypttab cryptswap: /dev/sda3 holds a LUKS volume"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output, got: %s", want, out)
+		}
+	}
+
+	cli, stdout, _ = newTestCLI([]string{"luks2", "doctor", "--json"})
+	cli.Luks = &MockLuksOperations{}
+	if code := cli.Run(); code != 0 {
+		t.Errorf("Expected exit code 0 without findings, got %d", code)
+	}
+	var report luks2.TabReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || report.Findings == nil {
+		t.Errorf("Output is not a JSON report (%v): %s", err, stdout.String())
+	}
+}
+
+func TestCLI_Fstab(t *testing.T) {
+	var got *luks2.FstabOptions
+	cli, stdout, _ := newTestCLI([]string{"luks2", "fstab", "--uuid", "-o", "noatime,nofail", "--pass", "2", "data", "/srv/data"})
+	cli.Luks = &MockLuksOperations{
+		FstabEntryForFunc: func(name string, opts *luks2.FstabOptions) (*luks2.FstabEntry, error) {
+			got = opts
+			return &luks2.FstabEntry{Device: "UUID=1f2e", MountPoint: opts.MountPoint, Type: "xfs", Options: opts.Options, Pass: opts.Pass}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !got.ByUUID || got.MountPoint != "/srv/data" {
+		t.Errorf("options = %+v", got)
+	}
+	if want := "UUID=1f2e\t/srv/data\txfs\tnoatime,nofail\t0\t2\n"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "fstab", "--pass", "3", "data", "/srv/data"})
+	cli.Luks = &MockLuksOperations{}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "invalid --pass") {
+		t.Errorf("Expected --pass to be rejected, got code %d: %s", code, stderr.String())
+	}
+
+	cli, _, stderr = newTestCLI([]string{"luks2", "fstab", "--uuid", "data"})
+	cli.Luks = &MockLuksOperations{}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "mountpoint required") {
+		t.Errorf("Expected missing mountpoint error, got code %d: %s", code, stderr.String())
+	}
+}
+
+// writeSpec writes a provisioning spec for the provision command tests
+func writeSpec(t *testing.T, spec string) string {
+	t.Helper()
+	path := t.TempDir() + "/spec.json"
+	if err := os.WriteFile(path, []byte(spec), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLI_Provision_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "provision"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stdout.String(), "Usage: luks2 provision") {
+		t.Errorf("Expected usage, got code %d: %s", code, stdout.String())
+	}
+}
+
+func TestCLI_Provision(t *testing.T) {
+	path := writeSpec(t, `{"device": "/dev/vdb", "keyslots": [{"key_file": "/run/key"}], "filesystem": {"type": "ext4"}, "fstab": {"mount_point": "/srv"}}`)
+	cli, stdout, _ := newTestCLI([]string{"luks2", "provision", "--root", "/mnt/image", "--force", path})
+	var gotOpts *provision.Options
+	cli.Luks = &MockLuksOperations{
+		ProvisionFunc: func(plan *provision.Plan, opts *provision.Options) *provision.Summary {
+			gotOpts = opts
+			res := &provision.Result{Device: plan.Specs[0].Device, UUID: "1234", Name: "luks-1234", Formatted: true, Enrolled: []int{1}, FilesystemCreated: true, FstabChanged: true}
+			return &provision.Summary{Devices: []provision.DeviceResult{{Spec: plan.Specs[0].Device, Result: res}}, Changed: 1}
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotOpts == nil || gotOpts.Root != "/mnt/image" || !gotOpts.Force {
+		t.Errorf("Provision options = %+v", gotOpts)
+	}
+	for _, want := range []string{"Formatted /dev/vdb (UUID 1234)", "Enrolled keyslot 1", "Created ext4 filesystem", "Updated fstab entry /srv"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q in output: %s", want, stdout.String())
+		}
+	}
+}
+
+func TestCLI_Provision_UpToDate(t *testing.T) {
+	path := writeSpec(t, `{"device": "/dev/vdb", "keyslots": [{"key_file": "/run/key"}]}`)
+	cli, stdout, _ := newTestCLI([]string{"luks2", "provision", path})
+	if code := cli.Run(); code != 0 || !strings.Contains(stdout.String(), "/dev/vdb is up to date") {
+		t.Errorf("Expected up to date, got code %d: %s", code, stdout.String())
+	}
+}
+
+func TestCLI_Provision_Errors(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "provision", writeSpec(t, `{"device": "/dev/vdb"}`)})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "at least one keyslot") {
+		t.Errorf("Expected invalid spec error, got code %d: %s", code, stderr.String())
+	}
+
+	path := writeSpec(t, `{"device": "/dev/vdb", "keyslots": [{"key_file": "/run/key"}]}`)
+	cli, _, stderr = newTestCLI([]string{"luks2", "provision", path})
+	cli.Luks = &MockLuksOperations{
+		ProvisionFunc: func(plan *provision.Plan, opts *provision.Options) *provision.Summary {
+			d := provision.DeviceResult{Spec: plan.Specs[0].Device, Result: &provision.Result{Device: plan.Specs[0].Device}, Err: provision.ErrConflict}
+			return &provision.Summary{Devices: []provision.DeviceResult{d}, Failed: 1}
+		},
+	}
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "Failed to provision /dev/vdb: device conflicts with spec") {
+		t.Errorf("Expected provision failure, got code %d: %s", code, stderr.String())
+	}
+
+	cli, _, stderr = newTestCLI([]string{"luks2", "provision", "--root"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "--root requires") {
+		t.Errorf("Expected missing --root argument error, got code %d: %s", code, stderr.String())
+	}
+
+	cli, _, stderr = newTestCLI([]string{"luks2", "provision", "--spec", path, path})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "one spec file required") {
+		t.Errorf("Expected spec file error, got code %d: %s", code, stderr.String())
+	}
+
+	cli, _, stderr = newTestCLI([]string{"luks2", "provision", "--parallel", "0", path})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "Invalid parallel: 0") {
+		t.Errorf("Expected invalid parallel error, got code %d: %s", code, stderr.String())
+	}
+}
+
+func TestCLI_Provision_Plan(t *testing.T) {
+	path := t.TempDir() + "/fleet.yaml"
+	plan := "defaults:\n  keyslots: [{passphrase_env: DISK_PASSPHRASE}]\ndevices:\n  - device: /dev/vdb\n  - device: /dev/vdc\n"
+	if err := os.WriteFile(path, []byte(plan), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mock := &MockLuksOperations{
+		ProvisionFunc: func(plan *provision.Plan, opts *provision.Options) *provision.Summary {
+			if len(plan.Specs) != 2 || opts.Parallel != 2 {
+				t.Errorf("Provision(%+v, %+v)", plan, opts)
+			}
+			return &provision.Summary{
+				Devices: []provision.DeviceResult{
+					{Spec: "/dev/vdb", Result: &provision.Result{Device: "/dev/vdb", UUID: "1234", Formatted: true}},
+					{Spec: "/dev/vdc", Err: provision.ErrConflict, Error: provision.ErrConflict.Error()},
+				},
+				Changed: 1,
+				Failed:  1,
+			}
+		},
+	}
+
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "provision", "--spec", path, "--parallel", "2"})
+	cli.Luks = mock
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Formatted /dev/vdb (UUID 1234)") || !strings.Contains(stdout.String(), "Provisioned 2 devices: 1 changed, 1 failed") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Failed to provision /dev/vdc: device conflicts with spec") {
+		t.Errorf("Unexpected errors: %s", stderr.String())
+	}
+
+	cli, stdout, _ = newTestCLI([]string{"luks2", "provision", "--json", "--parallel", "2", path})
+	cli.Luks = mock
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	var summary provision.Summary
+	if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, stdout.String())
+	}
+	if len(summary.Devices) != 2 || summary.Devices[0].Result.UUID != "1234" || summary.Devices[1].Error == "" || summary.Failed != 1 {
+		t.Errorf("Unexpected summary: %s", stdout.String())
+	}
+}
+
+func TestCLI_Escrow_NoArgs(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "escrow", "aws"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Usage: luks2 escrow") {
+		t.Error("Expected escrow usage message")
+	}
+}
+
+func TestCLI_Escrow(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "escrow", "gcp", "/dev/sdb1"})
+	var gotService string
+	var gotPassphrase []byte
+	cli.Luks = &MockLuksOperations{
+		EscrowKeyslotFunc: func(device string, passphrase []byte, service string) (int, int, error) {
+			gotService, gotPassphrase = service, append([]byte(nil), passphrase...)
+			return 2, 1, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotService != "gcp" || string(gotPassphrase) != "testpassword" {
+		t.Errorf("EscrowKeyslot got service %q, passphrase %q", gotService, gotPassphrase)
+	}
+	if !strings.Contains(stdout.String(), "Added keyslot 2, escrowed in token 1") {
+		t.Errorf("Expected keyslot and token, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Escrow_NotEscrowed(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "escrow", "aws", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		EscrowKeyslotFunc: func(device string, passphrase []byte, service string) (int, int, error) {
+			return 3, -1, errors.New("AccessDeniedException")
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Keyslot 3 was added") {
+		t.Errorf("Expected keyslot cleanup hint, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Open_PKCS11(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "open", "--pkcs11-token-uri", "auto", "/dev/sda1", "myvolume"})
+	var gotURI, gotPIN string
+	cli.Luks = &MockLuksOperations{
+		UnlockWithPKCS11Func: func(device, name, uri string, pin []byte, opts *luks2.UnlockOptions) error {
+			gotURI, gotPIN = uri, string(pin)
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotURI != "auto" || gotPIN != "testpassword" {
+		t.Errorf("UnlockWithPKCS11 got uri %q, pin %q", gotURI, gotPIN)
+	}
+	if !strings.Contains(stdout.String(), "Enter PIN for security token") {
+		t.Error("Expected PIN prompt")
+	}
+}
+
+func TestCLI_Open_PKCS11AndEscrow(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "--pkcs11-token-uri", "auto", "--escrow", "aws", "/dev/sda1", "myvolume"})
+
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "mutually exclusive") {
+		t.Errorf("Expected conflict error, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Enroll_PKCS11(t *testing.T) {
+	uri := "pkcs11:token=card;id=%03"
+	cli, stdout, _ := newTestCLI([]string{"luks2", "enroll", "--pkcs11-token-uri", uri, "--rsa-oaep", "/dev/sdb1"})
+	var gotURI string
+	var gotOAEP bool
+	cli.Luks = &MockLuksOperations{
+		EnrollPKCS11Func: func(device string, passphrase []byte, uri string, oaep bool) (int, int, error) {
+			gotURI, gotOAEP = uri, oaep
+			return 2, 1, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotURI != uri || !gotOAEP {
+		t.Errorf("EnrollPKCS11 got uri %q, oaep %v", gotURI, gotOAEP)
+	}
+	if !strings.Contains(stdout.String(), "Added keyslot 2") {
+		t.Errorf("Expected keyslot, got: %s", stdout.String())
+	}
+}
+
+func TestCLI_Enroll_Errors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "enroll", "/dev/sdb1"},
+		{"luks2", "enroll", "--pkcs11-token-uri"},
+		{"luks2", "enroll", "--tpm2", "/dev/sdb1"},
+	}
+	for _, args := range tests {
+		cli, _, _ := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[2:], code)
+		}
+	}
+}
+
+// writeTestKeyPair writes a self-signed server certificate and its key and
+// returns their paths
+func writeTestKeyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCLI_UnlockServer(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir)
+	pinFile := filepath.Join(dir, "authorized_keys")
+	if err := os.WriteFile(pinFile, []byte("sha256//"+strings.Repeat("A", 43)+"=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, stdout, _ := newTestCLI([]string{"luks2", "unlock-server", "--cert", certFile, "--key", keyFile,
+		"--authorized-keys", pinFile, "--listen", ":2222", "root=/dev/sda2", "data=UUID=1234"})
+	var got unlockserver.Config
+	cli.Luks = &MockLuksOperations{
+		ResolveDeviceFunc: func(spec string) (string, error) {
+			return strings.Replace(spec, "UUID=1234", "/dev/sdb", 1), nil
+		},
+		ServeUnlockFunc: func(ctx context.Context, cfg unlockserver.Config) ([]unlockserver.Volume, error) {
+			got = cfg
+			return nil, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	want := []unlockserver.Volume{{Device: "/dev/sda2", Name: "root"}, {Device: "/dev/sdb", Name: "data"}}
+	if !reflect.DeepEqual(got.Volumes, want) || got.Addr != ":2222" || len(got.AuthorizedKeys) != 1 {
+		t.Errorf("ServeUnlock got %+v", got)
+	}
+	if !strings.Contains(stdout.String(), "Server key: sha256//") || !strings.Contains(stdout.String(), "All volumes unlocked") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestCLI_UnlockServer_StillLocked(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir)
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "unlock-server", "--cert", certFile, "--key", keyFile,
+		"--authorized-keys", certFile, "root=/dev/sda2"})
+	cli.Luks = &MockLuksOperations{
+		ServeUnlockFunc: func(ctx context.Context, cfg unlockserver.Config) ([]unlockserver.Volume, error) {
+			return cfg.Volumes, nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "still locked: root") {
+		t.Errorf("Expected pending volumes, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_UnlockServer_Errors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "unlock-server", "root=/dev/sda2"},
+		{"luks2", "unlock-server", "--cert"},
+		{"luks2", "unlock-server", "--bogus", "root=/dev/sda2"},
+		{"luks2", "unlock-server", "--cert", "c", "--key", "k", "--authorized-keys", "a", "/dev/sda2"},
+		{"luks2", "unlock-server", "--cert", "/nonexistent", "--key", "k", "--authorized-keys", "a", "root=/dev/sda2"},
+	}
+	for _, args := range tests {
+		cli, _, _ := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[2:], code)
+		}
+	}
+}
+
+func TestCLI_Keyslots(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "keyslots", "/dev/sdb1"})
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	cli.Luks = &MockLuksOperations{
+		ListKeyslotsFunc: func(device string) ([]luks2.KeyslotInfo, error) {
+			return []luks2.KeyslotInfo{
+				{ID: 1, KDFType: "argon2id", Priority: luks2.KeyslotPriorityPrefer,
+					Annotation: &luks2.KeyslotAnnotation{Label: "alice-laptop", Owner: "alice", CreatedAt: created}},
+				{ID: 0, KDFType: "pbkdf2", Priority: luks2.KeyslotPriorityNormal},
+			}, nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 keyslots, got: %s", stdout.String())
+	}
+	if !strings.HasPrefix(lines[1], "0 ") || !strings.Contains(lines[1], "normal") {
+		t.Errorf("Unexpected keyslot 0 line: %q", lines[1])
+	}
+	for _, want := range []string{"1 ", "prefer", "alice-laptop", "alice", "2025-03-01 12:00"} {
+		if !strings.Contains(lines[2], want) {
+			t.Errorf("Keyslot 1 line %q lacks %q", lines[2], want)
+		}
+	}
+}
+
+func TestCLI_Keyslots_Annotate(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "keyslots", "annotate", "--label", "backup", "--owner", "ops", "/dev/sdb1", "2"})
+	var gotSlot int
+	var got luks2.KeyslotAnnotation
+	cli.Luks = &MockLuksOperations{
+		SetKeyslotAnnotationFunc: func(device string, keyslot int, ann luks2.KeyslotAnnotation) error {
+			gotSlot, got = keyslot, ann
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if gotSlot != 2 || got.Label != "backup" || got.Owner != "ops" {
+		t.Errorf("SetKeyslotAnnotation got slot %d, %+v", gotSlot, got)
+	}
+	if !strings.Contains(stdout.String(), "Annotated keyslot 2") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestCLI_Keyslots_AnnotateClear(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "keyslots", "annotate", "--clear", "/dev/sdb1", "2"})
+	cli.Luks = &MockLuksOperations{
+		RemoveKeyslotAnnotationFunc: func(device string, keyslot int) error {
+			return luks2.ErrTokenNotFound
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to annotate keyslot 2") {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+}
+
+func TestCLI_Keyslots_Errors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "keyslots"},
+		{"luks2", "keyslots", "annotate", "/dev/sdb1", "1"},
+		{"luks2", "keyslots", "annotate", "--label", "x", "--clear", "/dev/sdb1", "1"},
+		{"luks2", "keyslots", "annotate", "--label", "x", "/dev/sdb1"},
+		{"luks2", "keyslots", "annotate", "--label", "x", "/dev/sdb1", "one"},
+		{"luks2", "keyslots", "annotate", "--owner"},
+		{"luks2", "keyslots", "annotate", "--bogus", "/dev/sdb1", "1"},
+	}
+	for _, args := range tests {
+		cli, _, _ := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[2:], code)
+		}
+	}
+}
+
+func TestCLI_Label(t *testing.T) {
+	info := func(device string) (*luks2.VolumeInfo, error) {
+		return &luks2.VolumeInfo{Label: "data", Subsystem: "archive"}, nil
+	}
+
+	cli, stdout, _ := newTestCLI([]string{"luks2", "label", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{GetVolumeInfoFunc: info}
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Label:     data") || !strings.Contains(stdout.String(), "Subsystem: archive") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+
+	tests := []struct {
+		args             []string
+		label, subsystem string
+	}{
+		{[]string{"/dev/sdb1", "backup"}, "backup", "archive"},
+		{[]string{"--subsystem", "", "/dev/sdb1"}, "data", ""},
+		{[]string{"--subsystem", "tape", "/dev/sdb1", ""}, "", "tape"},
+	}
+	for _, tt := range tests {
+		var gotLabel, gotSubsystem string
+		cli, _, _ := newTestCLI(append([]string{"luks2", "label"}, tt.args...))
+		cli.Luks = &MockLuksOperations{
+			GetVolumeInfoFunc: info,
+			SetLabelFunc: func(device, label, subsystem string) error {
+				gotLabel, gotSubsystem = label, subsystem
+				return nil
+			},
+		}
+		if code := cli.Run(); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d", tt.args, code)
+		}
+		if gotLabel != tt.label || gotSubsystem != tt.subsystem {
+			t.Errorf("%v: SetLabel got %q, %q; want %q, %q", tt.args, gotLabel, gotSubsystem, tt.label, tt.subsystem)
+		}
+	}
+}
+
+func TestCLI_Label_Errors(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "label", "/dev/sdb1", "x"})
+	cli.Luks = &MockLuksOperations{
+		GetVolumeInfoFunc: func(device string) (*luks2.VolumeInfo, error) {
+			return &luks2.VolumeInfo{}, nil
+		},
+		SetLabelFunc: func(device, label, subsystem string) error {
+			return luks2.ErrInvalidLabel
+		},
+	}
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to set label") {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+
+	cli, _, _ = newTestCLI([]string{"luks2", "label"})
+	if code := cli.Run(); code != 1 {
+		t.Errorf("Expected exit code 1 without a device, got %d", code)
+	}
+}
+
+func TestCLI_UUID(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "uuid", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		GetUUIDFunc: func(device string) (string, error) {
+			return "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if stdout.String() != "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1\n" {
+		t.Errorf("Unexpected output: %q", stdout.String())
+	}
+}
+
+func TestCLI_UUID_Set(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "uuid", "--uuid", "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", "/dev/sdb1"})
+	var got string
+	cli.Luks = &MockLuksOperations{
+		SetUUIDFunc: func(device, uuid string) error {
+			got = uuid
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if got != "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1" {
+		t.Errorf("SetUUID got %q", got)
+	}
+	if !strings.Contains(stdout.String(), "set to 2b1bd3c0") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestCLI_UUID_Random(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "uuid", "--random", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		RegenerateUUIDFunc: func(device string) (string, error) {
+			return "9f0c1e52-7d1a-4f0e-8a55-3c2b6e4d1f00", nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "set to 9f0c1e52-7d1a-4f0e-8a55-3c2b6e4d1f00") {
+		t.Errorf("Unexpected output: %s", stdout.String())
+	}
+}
+
+func TestCLI_UUID_Match(t *testing.T) {
+	for _, matched := range []bool{true, false} {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "uuid", "--match", "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", "/dev/sdb1"})
+		cli.Luks = &MockLuksOperations{
+			MatchUUIDFunc: func(device, uuid string) (bool, error) {
+				return matched, nil
+			},
+		}
+
+		want := 1
+		if matched {
+			want = 0
+		}
+		if code := cli.Run(); code != want {
+			t.Errorf("matched=%v: expected exit code %d, got %d", matched, want, code)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("Unexpected output: %s", stdout.String())
+		}
+	}
+}
+
+func TestCLI_UUID_Errors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "uuid"},
+		{"luks2", "uuid", "--random", "--uuid", "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", "/dev/sdb1"},
+		{"luks2", "uuid", "--random", "--match", "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1", "/dev/sdb1"},
+		{"luks2", "uuid", "--uuid"},
+	}
+	for _, args := range tests {
+		cli, _, _ := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[2:], code)
+		}
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "uuid", "--uuid", "bogus", "/dev/sdb1"})
+	cli.Luks = &MockLuksOperations{
+		SetUUIDFunc: func(device, uuid string) error {
+			return luks2.ErrInvalidUUID
+		},
+	}
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "Failed to set UUID") {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+}
+
+// writeSecretFile writes a file for --key-file or --env-file
+func writeSecretFile(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCLI_KeyFile_Create(t *testing.T) {
+	keyFile := writeSecretFile(t, "file-pass-123\n", 0600)
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "create", "--key-file", keyFile, "--label", "data", "--batch", "/dev/sda1"})
+	cli.Terminal = &MockTerminal{Err: errors.New("terminal used")}
+	var got luks2.FormatOptions
+	cli.Luks = &MockLuksOperations{
+		FormatFunc: func(opts luks2.FormatOptions) error {
+			got = opts
+			got.Passphrase = bytes.Clone(opts.Passphrase)
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if string(got.Passphrase) != "file-pass-123" || got.Label != "data" {
+		t.Errorf("Unexpected format options: passphrase %q, label %q", got.Passphrase, got.Label)
+	}
+	if out := stdout.String(); strings.Contains(out, "Confirm passphrase") || strings.Contains(out, "volume label") {
+		t.Errorf("Expected no prompts, got:\n%s", out)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Unexpected stderr: %s", stderr.String())
+	}
+}
+
+func TestCLI_KeyFile_Permissions(t *testing.T) {
+	keyFile := writeSecretFile(t, "file-pass-123", 0644)
+	cli, _, stderr := newTestCLI([]string{"luks2", "--key-file", keyFile, "create", "--label", "x", "/dev/sda1"})
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "accessible by other users") {
+		t.Errorf("Expected permission warning, got: %s", stderr.String())
+	}
+}
+
+func TestCLI_Stdin_Open(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "--stdin", "/dev/sda1", "data"})
+	cli.Stdin = strings.NewReader("stdin-pass\r\nnext line\n")
+	cli.Terminal = &MockTerminal{Err: errors.New("terminal used")}
+	var attempts []string
+	cli.Luks = &MockLuksOperations{
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			attempts = append(attempts, string(passphrase))
+			return luks2.ErrInvalidPassphrase
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	// A rejected scripted passphrase is not retried
+	if len(attempts) != 1 || attempts[0] != "stdin-pass" {
+		t.Errorf("Unexpected attempts %q", attempts)
+	}
+	if !strings.Contains(stderr.String(), "no key available") {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+}
+
+func TestCLI_EnvFile(t *testing.T) {
+	envFile := writeSecretFile(t, "# provisioning secrets\nOTHER=1\nexport LUKS2_PASSPHRASE=\"env pass 123\"\n", 0600)
+	cli, _, stderr := newTestCLI([]string{"luks2", "--env-file", envFile, "open", "/dev/sda1", "data"})
+	var got string
+	cli.Luks = &MockLuksOperations{
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			got = string(passphrase)
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if got != "env pass 123" {
+		t.Errorf("Expected passphrase from env file, got %q", got)
+	}
+
+	envFile = writeSecretFile(t, "OTHER=1\n", 0600)
+	cli, _, stderr = newTestCLI([]string{"luks2", "--env-file", envFile, "open", "/dev/sda1", "data"})
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "does not set LUKS2_PASSPHRASE") {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+}
+
+func TestCLI_Batch_NeedsPassphrase(t *testing.T) {
+	cli, _, stderr := newTestCLI([]string{"luks2", "--batch", "create", "/dev/sda1"})
+	formatted := false
+	cli.Luks = &MockLuksOperations{
+		FormatFunc: func(opts luks2.FormatOptions) error {
+			formatted = true
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if formatted || !strings.Contains(stderr.String(), "--batch was given") {
+		t.Errorf("Unexpected result: formatted %v, stderr %s", formatted, stderr.String())
+	}
+}
+
+func TestCLI_GlobalFlags_Errors(t *testing.T) {
+	tests := [][]string{
+		{"luks2", "--stdin", "--key-file", "/tmp/key", "open", "/dev/sda1", "data"},
+		{"luks2", "open", "/dev/sda1", "data", "--key-file"},
+		{"luks2", "--key-file", "/nonexistent/key", "open", "/dev/sda1", "data"},
+		{"luks2", "create", "/dev/sda1", "--label"},
+	}
+	for _, args := range tests {
+		cli, _, _ := newTestCLI(args)
+		if code := cli.Run(); code != 1 {
+			t.Errorf("%v: expected exit code 1, got %d", args[1:], code)
+		}
+	}
+}
+
+func TestCLI_Wipe_Yes(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "wipe", "--yes", "/dev/sda1"})
+	wiped := false
+	cli.Luks = &MockLuksOperations{
+		WipeFunc: func(opts luks2.WipeOptions) error {
+			wiped = true
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !wiped || strings.Contains(stdout.String(), "Type 'YES'") {
+		t.Errorf("Expected wipe without confirmation prompt, got:\n%s", stdout.String())
+	}
+}
+
+func TestCLI_Askpass(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "prompts")
+	program := writeSecretFile(t, "#!/bin/sh\necho \"$1\" >> "+logPath+"\necho helper-pass-123\n", 0700) // #nosec G306 -- test executable
+	t.Setenv("LUKS_ASKPASS", program)
+
+	cli, stdout, stderr := newTestCLI([]string{"luks2", "create", "--label", "data", "/dev/sda1"})
+	cli.Terminal = &MockTerminal{Err: errors.New("terminal used")}
+	var got string
+	cli.Luks = &MockLuksOperations{
+		FormatFunc: func(opts luks2.FormatOptions) error {
+			got = string(opts.Passphrase)
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if got != "helper-pass-123" {
+		t.Errorf("Expected passphrase from askpass, got %q", got)
+	}
+	prompts, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(prompts) != "Enter passphrase for new volume\nConfirm passphrase\n" {
+		t.Errorf("Unexpected askpass prompts:\n%s", prompts)
+	}
+	if strings.Contains(stdout.String(), "Enter passphrase") {
+		t.Errorf("Expected no terminal prompt, got:\n%s", stdout.String())
+	}
+}
+
+func TestCLI_Askpass_Cancelled(t *testing.T) {
+	program := writeSecretFile(t, "#!/bin/sh\nexit 1\n", 0700) // #nosec G306 -- test executable
+	t.Setenv("LUKS_ASKPASS", program)
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "open", "/dev/sda1", "data"})
+	unlocked := false
+	cli.Luks = &MockLuksOperations{
+		UnlockWithOptionsFunc: func(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+			unlocked = true
+			return nil
+		},
+	}
+
+	if code := cli.Run(); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	if unlocked || !strings.Contains(stderr.String(), "cancelled") {
+		t.Errorf("Unexpected result: unlocked %v, stderr %s", unlocked, stderr.String())
 	}
 }
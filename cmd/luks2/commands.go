@@ -0,0 +1,1183 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command describes a luks2 subcommand. The table drives argument parsing,
+// "luks2 help <command>" and shell completion, so a flag declared here is
+// accepted, documented and completed in one place.
+type command struct {
+	Name        string
+	Args        string // Positional arguments in the usage line
+	Summary     string // One line for the command list
+	Description string // Paragraphs for "luks2 help <command>"
+	Flags       []flag
+	Examples    []string
+	Complete    []completion // Positional arguments; the last one repeats
+	MinArgs     int          // Fewer without any flags prints the help
+	MaxArgs     int          // Completion stops after MaxArgs; -1 = unlimited
+	Privileged  bool         // Needs device-mapper access for everything it does
+	Hidden      bool
+	Run         func(c *CLI, args *cmdArgs) int
+	Subcommands []*command
+
+	parent *command
+}
+
+// flag describes a command option
+type flag struct {
+	Name     string // Long name, used as --name
+	Short    string // Optional one-letter alias, used as -s
+	Value    string // Value placeholder; empty for switches
+	Usage    string
+	Complete completion
+}
+
+// completion tells the shell how to complete a value
+type completion struct {
+	files    bool     // Paths
+	dirs     bool     // Directories only
+	mappings bool     // Active device-mapper names
+	commands bool     // luks2 commands
+	values   []string // Fixed choices
+}
+
+var (
+	compFile    = completion{files: true}
+	compDir     = completion{dirs: true}
+	compMapping = completion{mappings: true}
+)
+
+// choices completes one of a fixed set of values
+func choices(values ...string) completion {
+	return completion{values: values}
+}
+
+// escrowServices are the short service names escrow.FromEnv accepts
+var escrowServices = []string{"vault", "kms", "aws", "gcp", "azure"}
+
+// mapperDir lists the active device-mapper names. A variable so tests can
+// substitute it.
+var mapperDir = "/dev/mapper"
+
+// cmdArgs holds the parsed arguments of a command
+type cmdArgs struct {
+	flags      map[string]string
+	positional []string
+}
+
+// Has reports whether a flag was given
+func (a *cmdArgs) Has(name string) bool {
+	_, ok := a.flags[name]
+	return ok
+}
+
+// Value returns the value of a flag, or "" if it was not given
+func (a *cmdArgs) Value(name string) string {
+	return a.flags[name]
+}
+
+// Lookup returns the value of a flag and whether it was given
+func (a *cmdArgs) Lookup(name string) (string, bool) {
+	v, ok := a.flags[name]
+	return v, ok
+}
+
+// globalFlags are accepted by every command; parseGlobalFlags removes them
+// before the command's own flags are parsed
+var globalFlags = []flag{
+	{Name: "yes", Short: "y", Usage: "Skip YES confirmations (not the UUID of a LUKS volume)"},
+	{Name: "batch", Usage: "--yes, and fail instead of prompting"},
+	{Name: "key-file", Value: "FILE", Usage: "Read the passphrase from FILE", Complete: compFile},
+	{Name: "stdin", Usage: "Read the passphrase from the first line of stdin"},
+	{Name: "env-file", Value: "FILE", Usage: "Read LUKS2_PASSPHRASE from a KEY=VALUE file", Complete: compFile},
+	{Name: "confirm-uuid", Usage: "Require the UUID to destroy a LUKS volume even if LUKS2_CONFIRM_UUID=0"},
+}
+
+const deviceSpecHelp = "The device may also be given as UUID=<uuid> or LABEL=<label>."
+
+// commands lists the luks2 commands in the order of the command list
+var commands []*command
+
+func init() {
+	mountFlags := []flag{
+		{Name: "type", Short: "t", Value: "TYPE", Usage: "Filesystem type (default: detect)", Complete: choices("ext4", "ext3", "ext2", "xfs", "btrfs", "vfat")},
+		{Name: "options", Short: "o", Value: "OPTS", Usage: "Comma-separated mount options (e.g. noatime,discard)"},
+	}
+	allowDiscards := flag{Name: "allow-discards", Usage: "Pass TRIM/discard requests to the device (leaks free-space layout)"}
+
+	commands = []*command{
+		{
+			Name:    "create",
+			Args:    "<path> [size] [filesystem]",
+			Summary: "Create a LUKS2 volume on a device or in a file",
+			Description: "Paths under /dev/ are formatted in place, as is partition N of a partitioned\n" +
+				"image file given as <image>:<N>. Any other path creates an image file of the\n" +
+				"given size, formats it, opens it as luks-auto and creates a filesystem.\n\n" +
+				"Size suffixes: K, M, G, T\n" +
+				"Filesystem types: ext4, ext3, ext2 (default: ext4)",
+			Flags: []flag{
+				{Name: "label", Value: "LABEL", Usage: "Volume label (prompted for when omitted)"},
+				{Name: "sparse", Usage: "Files: allocate blocks as they are written (default)"},
+				{Name: "preallocate", Usage: "Files: reserve the full size on disk up front"},
+			},
+			Examples: []string{
+				"luks2 create /dev/sdb1",
+				"luks2 create encrypted.luks 100M",
+				"luks2 create encrypted.luks 1G ext4",
+				"luks2 create --preallocate encrypted.luks 1G",
+				"luks2 create vm-disk.img:2",
+			},
+			Complete: []completion{compFile, {}, choices("ext4", "ext3", "ext2")},
+			MinArgs:  1,
+			MaxArgs:  3,
+			Run:      (*CLI).cmdCreate,
+		},
+		{
+			Name:        "open",
+			Args:        "<device> <name>",
+			Summary:     "Unlock and open a LUKS volume",
+			Description: deviceSpecHelp + "\n<image>:<N> opens partition N of a partitioned image file.",
+			Flags: []flag{
+				allowDiscards,
+				{Name: "perf-same_cpu_crypt", Usage: "Encrypt on the CPU that issued the I/O"},
+				{Name: "perf-submit_from_crypt_cpus", Usage: "Submit writes from the crypt threads"},
+				{Name: "perf-no_read_workqueue", Usage: "Bypass the read workqueue (fast NVMe)"},
+				{Name: "perf-no_write_workqueue", Usage: "Bypass the write workqueue (fast NVMe)"},
+				{Name: "key-slot", Short: "S", Value: "N", Usage: "Try only this keyslot (even one with priority ignore)"},
+				{Name: "tries", Value: "N", Usage: "Passphrase attempts before giving up (default: 3)"},
+				{Name: "retry-state", Value: "FILE", Usage: "Persist failed-attempt counters across runs", Complete: compFile},
+				{Name: "lockout", Value: "N", Usage: "Lock out after N consecutive failures (needs --retry-state)"},
+				{Name: "escrow", Value: "SERVICE", Usage: "Unlock with the secret escrowed with vault, kms, aws, gcp or azure", Complete: choices(escrowServices...)},
+				{Name: "pkcs11-token-uri", Value: "URI", Usage: "Unlock with the key on a smartcard or HSM (a PKCS#11 URI or auto)", Complete: choices("auto")},
+				{Name: "token-only", Usage: "Unlock with the external handlers of the volume's tokens, without a passphrase"},
+				{Name: "token-id", Value: "N", Usage: "Unlock with the handler of token N only"},
+				{Name: "token-type", Value: "TYPE", Usage: "Unlock with tokens of this type only"},
+			},
+			Examples: []string{
+				"luks2 open /dev/sdb1 my-encrypted-disk",
+				"luks2 open LABEL=backup backup",
+				"luks2 open --key-slot 2 /dev/sdb1 my-encrypted-disk",
+				"luks2 open vm-disk.img:2 vm-root",
+			},
+			Complete:   []completion{compFile, {}},
+			MinArgs:    2,
+			MaxArgs:    2,
+			Privileged: true,
+			Run:        (*CLI).cmdOpen,
+		},
+		{
+			Name:       "close",
+			Args:       "<name>",
+			Summary:    "Lock and close a LUKS volume",
+			Flags:      []flag{{Name: "deferred", Usage: "If the volume is in use, remove it once its last user closes it"}},
+			Examples:   []string{"luks2 close my-encrypted-disk"},
+			Complete:   []completion{compMapping},
+			MinArgs:    1,
+			MaxArgs:    1,
+			Privileged: true,
+			Run:        (*CLI).cmdClose,
+		},
+		{
+			Name:    "test",
+			Args:    "<device>",
+			Summary: "Check a passphrase without unlocking",
+			Description: "Reports which keyslot the passphrase opens, like cryptsetup open\n" +
+				"--test-passphrase. No mapping is created. Exits 1 if no keyslot opens.",
+			Flags: []flag{{Name: "key-slot", Short: "S", Value: "N", Usage: "Try only this keyslot"}},
+			Examples: []string{
+				"luks2 test /dev/sdb1",
+				"luks2 test --key-slot 1 disk.img",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdTest,
+		},
+		{
+			Name:    "ephemeral",
+			Args:    "<device> <name>",
+			Summary: "Open a plain volume with a fresh random key (swap, /tmp)",
+			Description: "Maps the device with a random key that is never stored, like a crypttab entry\n" +
+				"with /dev/urandom as key file: nothing survives closing the mapping. No header\n" +
+				"is written. A device holding a LUKS header or a filesystem is refused unless\n" +
+				"--force is given.\n\n" +
+				"--options takes crypttab options: swap, tmp[=fstype], cipher=, size=,\n" +
+				"sector-size=, offset= and discard. " + deviceSpecHelp,
+			Flags: []flag{
+				{Name: "swap", Usage: "Write a swap signature to the mapping"},
+				{Name: "tmp", Value: "FSTYPE", Usage: "Create a filesystem on the mapping (e.g. ext4)", Complete: choices("ext4", "ext3", "ext2", "xfs")},
+				{Name: "cipher", Value: "SPEC", Usage: "dm-crypt cipher (default: aes-xts-plain64)"},
+				{Name: "key-size", Value: "BITS", Usage: "Key size (default: 512 for XTS, otherwise 256)"},
+				{Name: "label", Value: "LABEL", Usage: "Swap or filesystem label"},
+				{Name: "options", Short: "o", Value: "OPTS", Usage: "Comma-separated crypttab options"},
+				allowDiscards,
+				{Name: "force", Usage: "Use a device that holds a LUKS header or a filesystem"},
+			},
+			Examples: []string{
+				"luks2 ephemeral --swap /dev/sda3 cryptswap",
+				"luks2 ephemeral --tmp ext4 /dev/nvme0n1p4 crypttmp",
+				"luks2 ephemeral -o swap,cipher=aes-xts-plain64,size=512 /dev/disk/by-partlabel/swap cryptswap",
+			},
+			Complete:   []completion{compFile, {}},
+			MinArgs:    2,
+			MaxArgs:    2,
+			Privileged: true,
+			Run:        (*CLI).cmdEphemeral,
+		},
+		{
+			Name:    "mount",
+			Args:    "<name> <mountpoint>",
+			Summary: "Mount an unlocked volume",
+			Flags: append(mountFlags[:2:2],
+				flag{Name: "data-safety", Value: "MODE", Usage: "Journaling data mode: journal, ordered, writeback (ext3/ext4)", Complete: choices("journal", "ordered", "writeback")}),
+			Examples:   []string{"luks2 mount my-encrypted-disk /mnt/encrypted"},
+			Complete:   []completion{compMapping, compDir},
+			MinArgs:    2,
+			MaxArgs:    2,
+			Privileged: true,
+			Run:        (*CLI).cmdMount,
+		},
+		{
+			Name:    "fstab",
+			Args:    "<name> <mountpoint>",
+			Summary: "Print the fstab line for an unlocked volume",
+			Description: "Detects the filesystem of /dev/mapper/<name> and prints an /etc/fstab line\n" +
+				"that mounts it. For volumes made by create, add a crypttab entry too so the\n" +
+				"mapping exists at boot; luks2 doctor checks the pair.",
+			Flags: []flag{
+				{Name: "uuid", Usage: "Name the filesystem by UUID instead of /dev/mapper/<name>"},
+				{Name: "options", Short: "o", Value: "OPTS", Usage: "Comma-separated mount options (default: defaults)"},
+				{Name: "pass", Value: "N", Usage: "fsck pass: 0, 1 or 2 (default: 0)"},
+			},
+			Examples: []string{
+				"luks2 fstab luks-auto /mnt/encrypted",
+				"luks2 fstab --uuid -o noatime,nofail data /srv/data | sudo tee -a /etc/fstab",
+			},
+			Complete: []completion{compMapping, compDir},
+			MinArgs:  2,
+			MaxArgs:  2,
+			Run:      (*CLI).cmdFstab,
+		},
+		{
+			Name:    "unmount",
+			Args:    "<mountpoint>",
+			Summary: "Unmount a volume (lists processes when busy)",
+			Flags: []flag{
+				{Name: "force", Short: "f", Usage: "Force the unmount (MNT_FORCE; mainly for unreachable network filesystems)"},
+				{Name: "lazy", Short: "l", Usage: "Detach now, finish once the mount is no longer busy (MNT_DETACH)"},
+			},
+			Examples:   []string{"luks2 unmount /mnt/encrypted"},
+			Complete:   []completion{compDir},
+			MinArgs:    1,
+			MaxArgs:    1,
+			Privileged: true,
+			Run:        (*CLI).cmdUnmount,
+		},
+		{
+			Name:    "up",
+			Args:    "<device|file> <mountpoint>",
+			Summary: "Open and mount a volume in one step",
+			Description: deviceSpecHelp + "\n\n" +
+				"Without root, the volume is opened through UDisks2, which chooses the mapping\n" +
+				"name and mount point.",
+			Flags: append([]flag{{Name: "name", Value: "NAME", Usage: "Mapping name (default: luks-<uuid>)"}},
+				append(mountFlags[:2:2], allowDiscards)...),
+			Examples: []string{"luks2 up encrypted.luks /mnt/encrypted"},
+			Complete: []completion{compFile, compDir},
+			MinArgs:  2,
+			MaxArgs:  2,
+			Run:      (*CLI).cmdUp,
+		},
+		{
+			Name:     "down",
+			Args:     "<mountpoint>",
+			Summary:  "Unmount and close a volume in one step",
+			Examples: []string{"luks2 down /mnt/encrypted"},
+			Complete: []completion{compDir},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdDown,
+		},
+		{
+			Name:    "resize",
+			Args:    "<name>",
+			Summary: "Resize an active mapping after the device grew",
+			Flags: []flag{
+				{Name: "size", Value: "S", Usage: "New mapping size, e.g. 10G (default: fill the device)"},
+				{Name: "grow-fs", Usage: "Grow the ext2/3/4 or XFS filesystem to the new size"},
+			},
+			Examples:   []string{"truncate -s 2G encrypted.luks && luks2 resize --grow-fs my-volume"},
+			Complete:   []completion{compMapping},
+			MinArgs:    1,
+			MaxArgs:    1,
+			Privileged: true,
+			Run:        (*CLI).cmdResize,
+		},
+		{
+			Name:        "trim",
+			Args:        "<mountpoint>",
+			Summary:     "Discard free space of a mounted volume",
+			Description: "The volume must have been opened with --allow-discards.",
+			Examples:    []string{"luks2 trim /mnt/encrypted"},
+			Complete:    []completion{compDir},
+			MinArgs:     1,
+			MaxArgs:     1,
+			Privileged:  true,
+			Run:         (*CLI).cmdTrim,
+		},
+		{
+			Name:        "info",
+			Args:        "<device>",
+			Summary:     "Show volume information",
+			Description: "<image>:<N> reads partition N of a partitioned image file.",
+			Examples:    []string{"luks2 info /dev/sdb1", "luks2 info vm-disk.img:2"},
+			Complete:    []completion{compFile},
+			MinArgs:     1,
+			MaxArgs:     1,
+			Run:         (*CLI).cmdInfo,
+		},
+		{
+			Name:    "list",
+			Summary: "List all LUKS volumes on the system",
+			Run:     (*CLI).cmdList,
+		},
+		{
+			Name:       "status",
+			Args:       "<name>",
+			Summary:    "Show details of an active mapping",
+			Examples:   []string{"luks2 status my-encrypted-disk"},
+			Complete:   []completion{compMapping},
+			MinArgs:    1,
+			MaxArgs:    1,
+			Privileged: true,
+			Run:        (*CLI).cmdStatus,
+		},
+		{
+			Name:    "wipe",
+			Args:    "<device>",
+			Summary: "Securely wipe a volume",
+			Flags: []flag{
+				{Name: "full", Usage: "Wipe entire device (default: headers only)"},
+				{Name: "crypto-erase", Usage: "Destroy headers and all keyslots; data becomes unrecoverable instantly"},
+				{Name: "passes", Value: "N", Usage: "Number of overwrite passes (default: 1)"},
+				{Name: "random", Usage: "Use random data instead of zeros"},
+				{Name: "trim", Usage: "Issue TRIM/DISCARD after wipe (for SSDs)"},
+				{Name: "workers", Value: "N", Usage: "Concurrent writers per pass (default: 4)"},
+				{Name: "buffer-size", Value: "S", Usage: "Write size per writer, e.g. 16M (default: 4M)"},
+				{Name: "direct", Usage: "Bypass the page cache with O_DIRECT"},
+				{Name: "io-uring", Usage: "Queue writes on io_uring instead of pwrite workers (Linux 5.6+)"},
+				{Name: "queue-depth", Value: "N", Usage: "Writes in flight with --io-uring (default: 32)"},
+			},
+			Examples: []string{
+				"luks2 wipe /dev/sdb1                    # Wipe headers only (fast)",
+				"luks2 wipe --full /dev/sdb1             # Wipe entire device",
+				"luks2 wipe --crypto-erase /dev/sdb1     # Instant erase of an encrypted volume",
+				"luks2 wipe --full --passes 3 /dev/sdb1  # DoD-style 3-pass wipe",
+				"luks2 wipe --full --random /dev/sdb1    # Random data wipe",
+				"luks2 wipe --full --trim /dev/ssd1      # Full wipe + TRIM for SSD",
+				"luks2 wipe --full --direct --workers 8 --buffer-size 16M /dev/sdb",
+				"luks2 wipe --full --direct --io-uring --queue-depth 64 /dev/nvme0n1",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdWipe,
+		},
+		{
+			Name:    "erase",
+			Args:    "<device>",
+			Summary: "Destroy the headers and keyslots of a LUKS volume",
+			Description: "Like cryptsetup luksErase, or wipe --crypto-erase limited to LUKS volumes.\n" +
+				"The volume UUID must be typed, or given as --i-know-what-i-am-doing-<uuid>;\n" +
+				"--yes and LUKS2_CONFIRM_UUID=0 do not confirm it.",
+			Flags: []flag{
+				{Name: "trim", Usage: "Issue TRIM/DISCARD over the erased range (for SSDs)"},
+			},
+			Examples: []string{
+				"luks2 erase /dev/sdb1",
+				"luks2 --batch --i-know-what-i-am-doing-<uuid> erase /dev/sdb1",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdErase,
+		},
+		{
+			Name:    "repair",
+			Args:    "<device>",
+			Summary: "Check metadata and repair damaged headers",
+			Flags:   []flag{{Name: "dry-run", Short: "n", Usage: "Only report problems, do not repair"}},
+			Examples: []string{
+				"luks2 repair --dry-run /dev/sdb1        # Check metadata only",
+				"luks2 repair /dev/sdb1                  # Check and repair",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdRepair,
+		},
+		{
+			Name:    "audit",
+			Args:    "<device>",
+			Summary: "Review the security of a volume's configuration",
+			Description: "Checks for weak ciphers, small keys, low KDF costs, PBKDF2-SHA1\n" +
+				"keyslots, a missing secondary header and header downgrade indicators,\n" +
+				"and scores the volume out of 100. No passphrase is needed. Exits 1 if a\n" +
+				"finding is high or critical.\n" +
+				"<image>:<N> audits partition N of a partitioned image file.",
+			Flags: []flag{{Name: "json", Usage: "Print the report as JSON"}},
+			Examples: []string{
+				"luks2 audit /dev/sdb1",
+				"luks2 audit --json /dev/sdb1 | jq .score",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdAudit,
+		},
+		{
+			Name:    "doctor",
+			Summary: "Cross-check crypttab, fstab and volume headers",
+			Description: "Reports what would fail or destroy data at boot: crypttab devices that are\n" +
+				"missing, hold no LUKS header or another volume than their UUID= names,\n" +
+				"random-key (swap, tmp) entries on a LUKS volume, fstab entries for mappings\n" +
+				"crypttab does not create or naming a LUKS UUID instead of the filesystem's,\n" +
+				"and fstab types that differ from the filesystem of an open volume.\n" +
+				"Exits 1 if a finding is high or critical.",
+			Flags: []flag{
+				{Name: "crypttab", Value: "FILE", Usage: "crypttab to check (default: /etc/crypttab)", Complete: compFile},
+				{Name: "fstab", Value: "FILE", Usage: "fstab to check (default: /etc/fstab)", Complete: compFile},
+				{Name: "json", Usage: "Print the report as JSON"},
+			},
+			Examples: []string{
+				"luks2 doctor",
+				"luks2 doctor --crypttab /mnt/image/etc/crypttab --fstab /mnt/image/etc/fstab",
+			},
+			Run: (*CLI).cmdDoctor,
+		},
+		{
+			Name:       "gc",
+			Summary:    "Clean up volumes left behind by crashes",
+			Privileged: true,
+			Run:        (*CLI).cmdGC,
+		},
+		{
+			Name:    "provision",
+			Args:    "<spec>",
+			Summary: "Create/converge volumes from a JSON or YAML spec",
+			Description: "The spec lists the keys, filesystem and crypttab/fstab entries of a volume, or\n" +
+				"of many devices under \"devices\" with shared \"defaults\". Running it again\n" +
+				"only applies what is missing.",
+			Flags: []flag{
+				{Name: "spec", Value: "FILE", Usage: "Spec file (instead of the argument)", Complete: compFile},
+				{Name: "root", Value: "DIR", Usage: "Write crypttab and fstab under DIR (image builds)", Complete: compDir},
+				{Name: "force", Usage: "Format a device that holds a filesystem or LUKS1"},
+				{Name: "parallel", Value: "N", Usage: "Provision N devices at once (default: spec, else 4)"},
+				{Name: "json", Usage: "Print the results as JSON"},
+			},
+			Examples: []string{
+				"luks2 provision /etc/luks2/data.json",
+				"luks2 provision --root /mnt/image data.json",
+				"luks2 provision --spec fleet.yaml --parallel 8 --json",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdProvision,
+		},
+		{
+			Name:    "escrow",
+			Args:    "<service> <device>",
+			Summary: "Add a keyslot wrapped by a key service",
+			Description: "Adds a keyslot with a random passphrase wrapped by the service:\n" +
+				"  vault   Vault transit (VAULT_ADDR, VAULT_TOKEN, VAULT_TRANSIT_KEY)\n" +
+				"  kms     HTTP KMS (LUKS2_KMS_URL, LUKS2_KMS_KEY_ID, LUKS2_KMS_TOKEN)\n" +
+				"  aws     AWS KMS (LUKS2_AWS_KMS_KEY_ID; instance profile credentials)\n" +
+				"  gcp     Cloud KMS (LUKS2_GCP_KMS_KEY; VM service account)\n" +
+				"  azure   Key Vault (LUKS2_AZURE_VAULT_URL, LUKS2_AZURE_KEY; managed identity)\n\n" +
+				"Open the volume with: luks2 open --escrow <service> <device> <name>",
+			Examples: []string{"luks2 escrow aws /dev/nvme1n1"},
+			Complete: []completion{choices(escrowServices...), compFile},
+			MinArgs:  2,
+			MaxArgs:  2,
+			Run:      (*CLI).cmdEscrow,
+		},
+		{
+			Name:        "enroll",
+			Args:        "<device>",
+			Summary:     "Add a keyslot unlocked by a smartcard or HSM",
+			Description: "The token is compatible with systemd-cryptenroll --pkcs11-token-uri.\n" + deviceSpecHelp,
+			Flags: []flag{
+				{Name: "pkcs11-token-uri", Value: "URI", Usage: "Key on a smartcard or HSM (RFC 7512 URI with id= or object=)"},
+				{Name: "rsa-oaep", Usage: "Wrap with RSA-OAEP (not unlockable by systemd-cryptsetup)"},
+			},
+			Examples: []string{"luks2 enroll --pkcs11-token-uri 'pkcs11:token=YubiKey%20PIV;id=%03' /dev/sdb1"},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdEnroll,
+		},
+		{
+			Name:     "keyslots",
+			Args:     "<device>",
+			Summary:  "List keyslots with their annotations",
+			Examples: []string{"luks2 keyslots /dev/sdb1"},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdKeyslots,
+			Subcommands: []*command{
+				{
+					Name:    "annotate",
+					Args:    "<device> <keyslot>",
+					Summary: "Label a keyslot with its owner",
+					Flags: []flag{
+						{Name: "label", Value: "TEXT", Usage: "Short name (e.g. alice-laptop)"},
+						{Name: "owner", Value: "TEXT", Usage: "Person or system holding the key"},
+						{Name: "description", Value: "TEXT", Usage: "Free-form notes"},
+						{Name: "clear", Usage: "Remove the annotation"},
+					},
+					Examples: []string{"luks2 keyslots annotate --label alice-laptop --owner alice /dev/sdb1 1"},
+					Complete: []completion{compFile, {}},
+					MinArgs:  2,
+					MaxArgs:  2,
+					Run:      (*CLI).cmdAnnotateKeyslot,
+				},
+				{
+					Name:    "kill",
+					Args:    "<device> <keyslot>",
+					Summary: "Destroy a keyslot",
+					Description: "Asks for the passphrase of any keyslot, like cryptsetup luksKillSlot, and\n" +
+						"for confirmation by the volume UUID.",
+					Examples: []string{
+						"luks2 keyslots kill /dev/sdb1 2",
+						"luks2 --key-file admin.key --i-know-what-i-am-doing-<uuid> keyslots kill /dev/sdb1 2",
+					},
+					Complete:   []completion{compFile, {}},
+					MinArgs:    2,
+					MaxArgs:    2,
+					Privileged: true,
+					Run:        (*CLI).cmdKillKeyslot,
+				},
+			},
+		},
+		{
+			Name:    "label",
+			Args:    "<device> [label]",
+			Summary: "Show or change the volume label",
+			Description: "Without a label or --subsystem, prints the label and subsystem. An empty\n" +
+				"label (\"\") clears it. Only the binary headers are rewritten.",
+			Flags: []flag{{Name: "subsystem", Value: "NAME", Usage: "Set the subsystem label (\"\" clears it)"}},
+			Examples: []string{
+				"luks2 label /dev/sdb1",
+				"luks2 label /dev/sdb1 backup-2025",
+				"luks2 label --subsystem archive /dev/sdb1",
+			},
+			Complete: []completion{compFile, {}},
+			MinArgs:  1,
+			MaxArgs:  2,
+			Run:      (*CLI).cmdLabel,
+		},
+		{
+			Name:    "uuid",
+			Args:    "<device>",
+			Summary: "Show or change the volume UUID",
+			Description: "Without flags, prints the header UUID. --match exits 0 if the UUID matches\n" +
+				"and 1 otherwise. A new UUID is written to both header copies; update crypttab\n" +
+				"and fstab entries that name the old one.",
+			Flags: []flag{
+				{Name: "uuid", Value: "UUID", Usage: "Set the UUID"},
+				{Name: "random", Usage: "Set a new random UUID"},
+				{Name: "match", Value: "UUID", Usage: "Only check whether the volume has UUID"},
+			},
+			Examples: []string{
+				"luks2 uuid /dev/sdb1",
+				"luks2 uuid --uuid 2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1 disk.img",
+				"luks2 uuid --random /dev/sdb1",
+				"luks2 uuid --match 2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1 /dev/sdb1 && echo same",
+			},
+			Complete: []completion{compFile},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdUUID,
+		},
+		{
+			Name:    "unlock-server",
+			Args:    "<name>=<device>...",
+			Summary: "Unlock volumes with passphrases sent over TLS",
+			Description: "Accepts passphrases from clients with a pinned key until every volume is\n" +
+				"unlocked, for unlocking remote machines from the initramfs.",
+			Flags: []flag{
+				{Name: "cert", Value: "FILE", Usage: "Server certificate (PEM)", Complete: compFile},
+				{Name: "key", Value: "FILE", Usage: "Server private key (PEM)", Complete: compFile},
+				{Name: "authorized-keys", Value: "FILE", Usage: "Client key pins (sha256//...) or PEM certificates", Complete: compFile},
+				{Name: "listen", Value: "ADDR", Usage: "Address to listen on (default: :4443)"},
+			},
+			Examples: []string{
+				"luks2 unlock-server --cert /etc/luks2/server.pem --key /etc/luks2/server.key \\\n" +
+					"      --authorized-keys /etc/luks2/authorized_keys root=/dev/sda2",
+			},
+			MinArgs:    1,
+			MaxArgs:    -1,
+			Privileged: true,
+			Run:        (*CLI).cmdUnlockServer,
+		},
+		{
+			Name:    "completion",
+			Args:    "<bash|zsh|fish>",
+			Summary: "Print a shell completion script",
+			Description: "Load the script in the current shell, or install it where the shell looks for\n" +
+				"completions.",
+			Examples: []string{
+				"source <(luks2 completion bash)",
+				"luks2 completion bash > /etc/bash_completion.d/luks2",
+				"luks2 completion zsh > \"${fpath[1]}/_luks2\"",
+				"luks2 completion fish > ~/.config/fish/completions/luks2.fish",
+			},
+			Complete: []completion{choices("bash", "zsh", "fish")},
+			MinArgs:  1,
+			MaxArgs:  1,
+			Run:      (*CLI).cmdCompletion,
+		},
+		{
+			Name:     "help",
+			Args:     "[command]",
+			Summary:  "Show help for luks2 or a command",
+			Examples: []string{"luks2 help open", "luks2 help keyslots annotate"},
+			Complete: []completion{{commands: true}, {}},
+			MaxArgs:  2,
+			Run:      (*CLI).cmdHelp,
+		},
+		{
+			Name:    "version",
+			Summary: "Show version information",
+			Run: func(c *CLI, _ *cmdArgs) int {
+				_, _ = fmt.Fprintf(c.Stdout, "luks2 version %s\n", Version)
+				return 0
+			},
+		},
+		{
+			Name:    "__complete",
+			Hidden:  true,
+			MaxArgs: -1,
+			Run:     (*CLI).cmdComplete,
+		},
+	}
+	for _, cmd := range commands {
+		for _, sub := range cmd.Subcommands {
+			sub.parent = cmd
+		}
+	}
+}
+
+// commandAliases are alternative spellings of commands
+var commandAliases = map[string]string{
+	"--help":    "help",
+	"-h":        "help",
+	"--version": "version",
+	"-v":        "version",
+}
+
+// findCommand returns the command called name, or nil
+func findCommand(name string) *command {
+	if alias, ok := commandAliases[name]; ok {
+		name = alias
+	}
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// subcommand returns the subcommand of cmd called name, or nil
+func (cmd *command) subcommand(name string) *command {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// path returns the command as typed after luks2, e.g. "keyslots annotate"
+func (cmd *command) path() string {
+	if cmd.parent != nil {
+		return cmd.parent.path() + " " + cmd.Name
+	}
+	return cmd.Name
+}
+
+// usageLine returns the command with its options and arguments
+func (cmd *command) usageLine() string {
+	parts := []string{cmd.path()}
+	if len(cmd.Flags) > 0 {
+		parts = append(parts, "[options]")
+	}
+	if cmd.Args != "" {
+		parts = append(parts, cmd.Args)
+	}
+	return strings.Join(parts, " ")
+}
+
+// lookupFlag returns the flag of cmd spelled arg (--name or -s), or nil
+func (cmd *command) lookupFlag(arg string) *flag {
+	for i := range cmd.Flags {
+		f := &cmd.Flags[i]
+		if arg == "--"+f.Name || (f.Short != "" && arg == "-"+f.Short) {
+			return f
+		}
+	}
+	return nil
+}
+
+// runCommand parses the arguments of cmd and runs it. A command called
+// without the arguments it needs prints its help; handlers report other
+// wrong argument counts themselves.
+func (c *CLI) runCommand(cmd *command, args []string) int {
+	if len(args) > 0 && len(cmd.Subcommands) > 0 {
+		if sub := cmd.subcommand(args[0]); sub != nil {
+			return c.runCommand(sub, args[1:])
+		}
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--help" || arg == "-h" {
+			c.printCommandHelp(cmd)
+			return 0
+		}
+	}
+
+	parsed, ok := c.parseArgs(cmd, args)
+	if !ok {
+		return 1
+	}
+	if len(parsed.positional) < cmd.MinArgs && len(parsed.flags) == 0 {
+		c.printCommandHelp(cmd)
+		return 1
+	}
+
+	// Fail before prompting for a passphrase; up and down fall back to
+	// UDisks2 instead
+	if cmd.Privileged {
+		if err := c.Luks.Privileges().Check(cmd.Name, false); err != nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %v\n", err)
+			_, _ = fmt.Fprintln(c.Stderr, "Run it with sudo. Without root, 'luks2 up' and 'luks2 down' work through UDisks2 on desktop systems.")
+			return 1
+		}
+	}
+
+	return cmd.Run(c, parsed)
+}
+
+// parseArgs splits args into the flags of cmd and positional arguments.
+// Flags may appear anywhere; values follow as the next argument or after
+// "=". Everything after "--" is positional.
+func (c *CLI) parseArgs(cmd *command, args []string) (*cmdArgs, bool) {
+	parsed := &cmdArgs{flags: make(map[string]string)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.positional = append(parsed.positional, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			parsed.positional = append(parsed.positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(name, "--") {
+			name, hasValue = arg, false
+		}
+		f := cmd.lookupFlag(name)
+		if f == nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Unknown option: %s\n", arg)
+			_, _ = fmt.Fprintf(c.Stderr, "Run 'luks2 help %s' for usage.\n", cmd.path())
+			return nil, false
+		}
+		switch {
+		case f.Value == "" && hasValue:
+			_, _ = fmt.Fprintf(c.Stderr, "Error: %s does not take a value\n", name)
+			return nil, false
+		case f.Value != "" && !hasValue:
+			if i+1 >= len(args) {
+				_, _ = fmt.Fprintf(c.Stderr, "Error: %s requires a value (%s)\n", name, f.Value)
+				return nil, false
+			}
+			i++
+			value = args[i]
+		}
+		parsed.flags[f.Name] = value
+	}
+	return parsed, true
+}
+
+// printUsage prints the command list and global options
+func (c *CLI) printUsage() {
+	w := c.Stdout
+	_, _ = fmt.Fprint(w, "\nUSAGE:\n    luks2 <command> [options]\n\nCOMMANDS:\n")
+	for _, cmd := range commands {
+		if cmd.Hidden {
+			continue
+		}
+		printListEntry(w, cmd.usageLine(), cmd.Summary)
+		for _, sub := range cmd.Subcommands {
+			printListEntry(w, sub.usageLine(), sub.Summary)
+		}
+	}
+
+	_, _ = fmt.Fprint(w, "\nGLOBAL OPTIONS (any command, for scripts):\n")
+	for _, f := range globalFlags {
+		printListEntry(w, f.spelling(true), f.Usage)
+	}
+	_, _ = fmt.Fprint(w, "\n    --i-know-what-i-am-doing-<uuid> confirms destroying the volume with that\n")
+	_, _ = fmt.Fprint(w, "    UUID without a prompt; destroying a LUKS volume otherwise needs its UUID\n")
+	_, _ = fmt.Fprint(w, "    typed. LUKS2_CONFIRM_UUID=0 lets YES and --yes confirm again.\n")
+	_, _ = fmt.Fprint(w, "\n    Other prompts use the program in $LUKS_ASKPASS if set, or\n")
+	_, _ = fmt.Fprint(w, "    systemd-ask-password (Plymouth, desktop agents) without a terminal.\n")
+	_, _ = fmt.Fprint(w, "\nRun 'luks2 help <command>' for the options of a command.\n")
+	_, _ = fmt.Fprint(w, usageExamples)
+}
+
+// printListEntry prints a command or option with its description, on the
+// next line if the name is too long
+func printListEntry(w io.Writer, name, desc string) {
+	const width = 28
+	if len(name) > width {
+		_, _ = fmt.Fprintf(w, "    %s\n    %-*s %s\n", name, width, "", desc)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "    %-*s %s\n", width, name, desc)
+}
+
+// spelling returns how a flag is written, e.g. "-t, --type TYPE". Long
+// first puts the name users search for at the left margin of the list.
+func (f *flag) spelling(longFirst bool) string {
+	s := "--" + f.Name
+	if f.Short != "" {
+		if longFirst {
+			s += ", -" + f.Short
+		} else {
+			s = "-" + f.Short + ", " + s
+		}
+	}
+	if f.Value != "" {
+		s += " " + f.Value
+	}
+	return s
+}
+
+// printCommandHelp prints the usage, options and examples of a command
+func (c *CLI) printCommandHelp(cmd *command) {
+	w := c.Stdout
+	_, _ = fmt.Fprintf(w, "Usage: luks2 %s\n", cmd.usageLine())
+	for _, sub := range cmd.Subcommands {
+		_, _ = fmt.Fprintf(w, "       luks2 %s\n", sub.usageLine())
+	}
+	_, _ = fmt.Fprintf(w, "\n%s\n", cmd.Summary)
+	if cmd.Description != "" {
+		_, _ = fmt.Fprintf(w, "\n%s\n", cmd.Description)
+	}
+
+	if len(cmd.Flags) > 0 {
+		width := 0
+		for i := range cmd.Flags {
+			width = max(width, len(cmd.Flags[i].spelling(false)))
+		}
+		_, _ = fmt.Fprintln(w, "\nOptions:")
+		for i := range cmd.Flags {
+			f := &cmd.Flags[i]
+			_, _ = fmt.Fprintf(w, "  %-*s   %s\n", width, f.spelling(false), f.Usage)
+		}
+	}
+	if len(cmd.Subcommands) > 0 {
+		_, _ = fmt.Fprintln(w, "\nSubcommands:")
+		for _, sub := range cmd.Subcommands {
+			_, _ = fmt.Fprintf(w, "  %-10s %s (luks2 help %s)\n", sub.Name, sub.Summary, sub.path())
+		}
+	}
+	if len(cmd.Examples) > 0 {
+		_, _ = fmt.Fprintln(w, "\nExamples:")
+		for _, ex := range cmd.Examples {
+			_, _ = fmt.Fprintf(w, "  %s\n", ex)
+		}
+	}
+}
+
+// cmdHelp shows the command list, or the help of a command
+func (c *CLI) cmdHelp(args *cmdArgs) int {
+	if len(args.positional) == 0 {
+		c.showBanner()
+		c.printUsage()
+		return 0
+	}
+	cmd := findCommand(args.positional[0])
+	if cmd == nil || cmd.Hidden {
+		_, _ = fmt.Fprintf(c.Stderr, "Unknown command: %s\n", args.positional[0])
+		return 1
+	}
+	if len(args.positional) > 1 {
+		sub := cmd.subcommand(args.positional[1])
+		if sub == nil {
+			_, _ = fmt.Fprintf(c.Stderr, "Unknown command: %s %s\n", cmd.Name, args.positional[1])
+			return 1
+		}
+		cmd = sub
+	}
+	c.printCommandHelp(cmd)
+	return 0
+}
+
+// cmdCompletion prints the completion script of a shell. The scripts ask
+// "luks2 __complete" for candidates, so they follow the command table.
+func (c *CLI) cmdCompletion(args *cmdArgs) int {
+	script, ok := completionScripts[args.positional[0]]
+	if !ok {
+		_, _ = fmt.Fprintf(c.Stderr, "Error: unsupported shell %q (bash, zsh or fish)\n", args.positional[0])
+		return 1
+	}
+	_, _ = fmt.Fprint(c.Stdout, script)
+	return 0
+}
+
+// cmdComplete prints completion candidates for the words after "luks2",
+// the last being the word under the cursor. The final line is a directive
+// for the shell: ":files" or ":dirs" to add paths, ":" for none.
+func (c *CLI) cmdComplete(args *cmdArgs) int {
+	candidates, directive := complete(args.positional)
+	for _, s := range candidates {
+		_, _ = fmt.Fprintln(c.Stdout, s)
+	}
+	_, _ = fmt.Fprintf(c.Stdout, ":%s\n", directive)
+	return 0
+}
+
+// complete returns the candidates for the last of words and whether the
+// shell should add file or directory names
+func complete(words []string) ([]string, string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+
+	// Global flags may precede the command
+	global := &command{Flags: globalFlags}
+	for len(words) > 1 && strings.HasPrefix(words[0], "-") {
+		if f := global.lookupFlag(words[0]); f != nil && f.Value != "" {
+			if len(words) == 2 {
+				return expand(f.Complete, cur)
+			}
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	if len(words) == 1 {
+		if strings.HasPrefix(cur, "-") {
+			return filterPrefix(flagNames(globalFlags), cur), ""
+		}
+		return filterPrefix(commandNames(), cur), ""
+	}
+
+	cmd := findCommand(words[0])
+	if cmd == nil {
+		return nil, ""
+	}
+	positional := 0
+	var pending *flag // Flag whose value is under the cursor
+	for _, w := range words[1 : len(words)-1] {
+		if pending != nil {
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(w, "-") && len(w) > 1 {
+			if f := completionFlag(cmd, w); f != nil && f.Value != "" && !strings.Contains(w, "=") {
+				pending = f
+			}
+			continue
+		}
+		if positional == 0 && len(cmd.Subcommands) > 0 {
+			if sub := cmd.subcommand(w); sub != nil {
+				cmd = sub
+				continue
+			}
+		}
+		positional++
+	}
+
+	if pending != nil {
+		return expand(pending.Complete, cur)
+	}
+	if strings.HasPrefix(cur, "-") {
+		return filterPrefix(append(flagNames(cmd.Flags), flagNames(globalFlags)...), cur), ""
+	}
+
+	var candidates []string
+	if positional == 0 {
+		for _, sub := range cmd.Subcommands {
+			candidates = append(candidates, sub.Name)
+		}
+	}
+	if len(cmd.Complete) == 0 || (cmd.MaxArgs >= 0 && positional >= cmd.MaxArgs) {
+		return filterPrefix(candidates, cur), ""
+	}
+	comp := cmd.Complete[min(positional, len(cmd.Complete)-1)]
+	more, directive := expand(comp, cur)
+	return append(filterPrefix(candidates, cur), more...), directive
+}
+
+// completionFlag returns the command or global flag spelled w
+func completionFlag(cmd *command, w string) *flag {
+	name, _, _ := strings.Cut(w, "=")
+	if f := cmd.lookupFlag(name); f != nil {
+		return f
+	}
+	global := &command{Flags: globalFlags}
+	return global.lookupFlag(name)
+}
+
+// flagNames returns the spellings of flags
+func flagNames(flags []flag) []string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, "--"+f.Name)
+		if f.Short != "" {
+			names = append(names, "-"+f.Short)
+		}
+	}
+	return names
+}
+
+// expand returns the candidates of a completion matching cur
+func expand(comp completion, cur string) ([]string, string) {
+	var candidates []string
+	candidates = append(candidates, comp.values...)
+	if comp.commands {
+		candidates = append(candidates, commandNames()...)
+	}
+	if comp.mappings {
+		candidates = append(candidates, mappingNames()...)
+	}
+	directive := ""
+	if comp.files {
+		directive = "files"
+	} else if comp.dirs {
+		directive = "dirs"
+	}
+	return filterPrefix(candidates, cur), directive
+}
+
+// commandNames returns the names of the visible commands
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		if !cmd.Hidden {
+			names = append(names, cmd.Name)
+		}
+	}
+	return names
+}
+
+// mappingNames returns the active device-mapper names
+func mappingNames() []string {
+	entries, err := os.ReadDir(mapperDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name() != "control" {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filterPrefix returns the words starting with prefix
+func filterPrefix(words []string, prefix string) []string {
+	var matched []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matched = append(matched, w)
+		}
+	}
+	return matched
+}
+
+// completionScripts holds the completion script of each supported shell
+var completionScripts = map[string]string{
+	"bash": `# bash completion for luks2
+_luks2() {
+    local cur=${COMP_WORDS[COMP_CWORD]} line directive=
+    COMPREPLY=()
+    while IFS= read -r line; do
+        case $line in
+            :*) directive=${line#:} ;;
+            *) COMPREPLY+=("$line") ;;
+        esac
+    done < <(luks2 __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)
+    case $directive in
+        files) mapfile -t -O "${#COMPREPLY[@]}" COMPREPLY < <(compgen -f -- "$cur") ;;
+        dirs) mapfile -t -O "${#COMPREPLY[@]}" COMPREPLY < <(compgen -d -- "$cur") ;;
+    esac
+}
+complete -o filenames -F _luks2 luks2
+`,
+	"zsh": `#compdef luks2
+# zsh completion for luks2
+_luks2() {
+    local -a candidates
+    local line directive
+    for line in "${(@f)$(luks2 __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        case $line in
+            :*) directive=${line#:} ;;
+            *) candidates+=("$line") ;;
+        esac
+    done
+    case $directive in
+        files) _files ;;
+        dirs) _files -/ ;;
+    esac
+    (( ${#candidates} )) && compadd -a candidates
+}
+if [ "$funcstack[1]" = "_luks2" ]; then
+    _luks2 "$@"
+else
+    compdef _luks2 luks2
+fi
+`,
+	"fish": `# fish completion for luks2
+function __luks2_complete
+    set -l words (commandline -opc) (commandline -ct)
+    set -e words[1]
+    for line in (luks2 __complete $words 2>/dev/null)
+        switch $line
+            case ':files'
+                __fish_complete_path (commandline -ct)
+            case ':dirs'
+                __fish_complete_directories (commandline -ct)
+            case ':*'
+            case '*'
+                echo $line
+        end
+    end
+end
+complete -c luks2 -f -a '(__luks2_complete)'
+`,
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandTable(t *testing.T) {
+	seen := make(map[string]bool)
+	var check func(cmd *command)
+	check = func(cmd *command) {
+		if seen[cmd.path()] {
+			t.Errorf("duplicate command %q", cmd.path())
+		}
+		seen[cmd.path()] = true
+		if cmd.Run == nil {
+			t.Errorf("%s: no handler", cmd.path())
+		}
+		if !cmd.Hidden && cmd.Summary == "" {
+			t.Errorf("%s: no summary", cmd.path())
+		}
+		flags := make(map[string]bool)
+		for _, f := range append(cmd.Flags, globalFlags...) {
+			for _, name := range []string{"--" + f.Name, "-" + f.Short} {
+				if name != "-" && flags[name] {
+					t.Errorf("%s: %s declared twice or shadows a global option", cmd.path(), name)
+				}
+				flags[name] = true
+			}
+		}
+		for _, sub := range cmd.Subcommands {
+			check(sub)
+		}
+	}
+	for _, cmd := range commands {
+		check(cmd)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	cli, _, _ := newTestCLI(nil)
+	args, ok := cli.parseArgs(findCommand("wipe"), []string{"--full", "/dev/sda1", "--passes=3", "--workers", "8", "--", "--not-a-flag"})
+	if !ok {
+		t.Fatal("parseArgs failed")
+	}
+	if !args.Has("full") || args.Has("random") || args.Value("passes") != "3" || args.Value("workers") != "8" {
+		t.Errorf("unexpected flags %v", args.flags)
+	}
+	if !reflect.DeepEqual(args.positional, []string{"/dev/sda1", "--not-a-flag"}) {
+		t.Errorf("unexpected positional arguments %q", args.positional)
+	}
+
+	// Short aliases are stored under the long name
+	args, ok = cli.parseArgs(findCommand("mount"), []string{"-t", "xfs", "data", "/mnt"})
+	if !ok || args.Value("type") != "xfs" {
+		t.Errorf("expected -t to set --type, got %v", args.flags)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--bogus"}, "Unknown option: --bogus"},
+		{[]string{"--full=yes"}, "--full does not take a value"},
+		{[]string{"/dev/sda1", "--passes"}, "--passes requires a value"},
+	}
+	for _, tt := range tests {
+		cli, _, stderr := newTestCLI(nil)
+		if _, ok := cli.parseArgs(findCommand("wipe"), tt.args); ok {
+			t.Errorf("%q: expected failure", tt.args)
+		}
+		if !strings.Contains(stderr.String(), tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.args, tt.want, stderr.String())
+		}
+	}
+}
+
+func TestCLI_CommandHelp(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"luks2", "help"}, []string{"USAGE:", "keyslots annotate [options] <device> <keyslot>", "--key-file FILE", "EXAMPLES:"}},
+		{[]string{"luks2", "help", "wipe"}, []string{"Usage: luks2 wipe [options] <device>", "--passes N", "Number of overwrite passes"}},
+		{[]string{"luks2", "wipe", "--help"}, []string{"Usage: luks2 wipe [options] <device>"}},
+		{[]string{"luks2", "help", "keyslots"}, []string{"luks2 keyslots annotate [options]", "Subcommands:"}},
+		{[]string{"luks2", "help", "keyslots", "annotate"}, []string{"Usage: luks2 keyslots annotate", "--owner TEXT"}},
+		{[]string{"luks2", "keyslots", "annotate", "-h"}, []string{"Usage: luks2 keyslots annotate"}},
+	}
+	for _, tt := range tests {
+		cli, stdout, stderr := newTestCLI(tt.args)
+		if code := cli.Run(); code != 0 {
+			t.Errorf("%v: expected exit code 0, got %d: %s", tt.args[1:], code, stderr.String())
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%v: expected %q in:\n%s", tt.args[1:], want, stdout.String())
+			}
+		}
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "help", "frobnicate"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "Unknown command: frobnicate") {
+		t.Errorf("expected unknown command error, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestCLI_Help_NoPrivilegeCheck(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "open", "--help"})
+	cli.Luks = &MockLuksOperations{PrivilegesFunc: unprivileged}
+	if code := cli.Run(); code != 0 || !strings.Contains(stdout.String(), "Usage: luks2 open") {
+		t.Errorf("expected help without root, got %d:\n%s", code, stdout.String())
+	}
+}
+
+func TestCLI_Completion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		cli, stdout, _ := newTestCLI([]string{"luks2", "completion", shell})
+		if code := cli.Run(); code != 0 {
+			t.Errorf("%s: expected exit code 0, got %d", shell, code)
+		}
+		if !strings.Contains(stdout.String(), "luks2 __complete") {
+			t.Errorf("%s: script does not call luks2 __complete:\n%s", shell, stdout.String())
+		}
+	}
+
+	cli, _, stderr := newTestCLI([]string{"luks2", "completion", "tcsh"})
+	if code := cli.Run(); code != 1 || !strings.Contains(stderr.String(), "unsupported shell") {
+		t.Errorf("expected unsupported shell error, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"control", "data", "backup"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := mapperDir
+	mapperDir = dir
+	t.Cleanup(func() { mapperDir = saved })
+
+	tests := []struct {
+		words     []string
+		want      []string
+		directive string
+	}{
+		{[]string{"un"}, []string{"unmount", "unlock-server"}, ""},
+		{[]string{"wipe", "--p"}, []string{"--passes"}, ""},
+		{[]string{"wipe", "--passes", ""}, nil, ""},
+		{[]string{"wipe", "--full", ""}, nil, "files"},
+		{[]string{"wipe", "/dev/sda1", ""}, nil, ""},
+		{[]string{"open", "--escrow", "a"}, []string{"aws", "azure"}, ""},
+		{[]string{"close", ""}, []string{"backup", "data"}, ""},
+		{[]string{"mount", "data", ""}, nil, "dirs"},
+		{[]string{"mount", "-t", "x"}, []string{"xfs"}, ""},
+		{[]string{"keyslots", "a"}, []string{"annotate"}, "files"},
+		{[]string{"keyslots", "annotate", "--c"}, []string{"--clear", "--confirm-uuid"}, ""},
+		{[]string{"--batch", "--key-file", ""}, nil, "files"},
+		{[]string{"--batch", "--key-file", "key", "cl"}, []string{"close"}, ""},
+		{[]string{"help", "keys"}, []string{"keyslots"}, ""},
+		{[]string{"completion", ""}, []string{"bash", "zsh", "fish"}, ""},
+		{[]string{"frobnicate", ""}, nil, ""},
+	}
+	for _, tt := range tests {
+		got, directive := complete(tt.words)
+		if !reflect.DeepEqual(got, tt.want) || directive != tt.directive {
+			t.Errorf("complete(%q) = %q, %q; want %q, %q", tt.words, got, directive, tt.want, tt.directive)
+		}
+	}
+
+	// Hidden commands are not offered
+	if got, _ := complete([]string{"__"}); len(got) != 0 {
+		t.Errorf("expected no hidden commands, got %q", got)
+	}
+}
+
+func TestCLI_CompleteCommand(t *testing.T) {
+	cli, stdout, _ := newTestCLI([]string{"luks2", "__complete", "--key-file", "/tmp/key", "wipe", "--cr"})
+	if code := cli.Run(); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if stdout.String() != "--crypto-erase\n:\n" {
+		t.Errorf("Unexpected completion output %q", stdout.String())
+	}
+}
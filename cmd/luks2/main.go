@@ -2,6 +2,8 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package main
 
 // Version is set at build time via -ldflags
@@ -12,24 +14,9 @@ LUKS2 Volume Manager
 Pure Go LUKS2 Implementation
 `
 
-const usage = `
-USAGE:
-    luks2 <command> [options]
-
-COMMANDS:
-    create <path> [size]         Create a new LUKS2 volume
-                                 - Block device: luks2 create /dev/sdb1
-                                 - File volume:  luks2 create encrypted.luks 100M
-    open <device> <name>         Unlock and open a LUKS volume
-    close <name>                 Lock and close a LUKS volume
-    mount <name> <mountpoint>    Mount an unlocked volume
-    unmount <mountpoint>         Unmount a volume
-    info <device>                Show volume information
-    wipe [options] <device>      Securely wipe a volume
-                                 Options: --full, --passes N, --random, --trim
-    help                         Show this help message
-    version                      Show version information
-
+// usageExamples follows the command list and global options in the
+// output of "luks2 help"
+const usageExamples = `
 EXAMPLES:
     # Create a new LUKS2 encrypted volume on a block device
     sudo luks2 create /dev/sdb1
@@ -40,12 +27,20 @@ EXAMPLES:
     # Open (unlock) the volume
     sudo luks2 open /dev/sdb1 my-encrypted-disk
 
+    # Open by header UUID or label instead of device path
+    sudo luks2 open UUID=5f2c0c1e-8a7b-4e0f-9d3a-0c1b2a3d4e5f my-encrypted-disk
+    sudo luks2 open LABEL=backup my-encrypted-disk
+
     # Mount the unlocked volume
     sudo luks2 mount my-encrypted-disk /mnt/encrypted
 
     # Use your encrypted storage
     ls /mnt/encrypted
 
+    # Or open and mount an image file in one step, and tear it down again
+    sudo luks2 up encrypted.luks /mnt/encrypted
+    sudo luks2 down /mnt/encrypted
+
     # Unmount when done
     sudo luks2 unmount /mnt/encrypted
 
@@ -55,9 +50,26 @@ EXAMPLES:
     # View volume information
     sudo luks2 info /dev/sdb1
 
+    # Check metadata and repair a damaged header copy
+    sudo luks2 repair /dev/sdb1
+
+    # Converge a volume to a declarative spec (safe to re-run)
+    sudo luks2 provision --root /mnt/image data.json
+
+    # Provision a fleet of disks from one YAML plan, eight at a time
+    sudo luks2 provision --spec fleet.yaml --parallel 8 --json
+
+    # Let a cloud VM unlock through its KMS key instead of a passphrase
+    sudo LUKS2_AWS_KMS_KEY_ID=alias/luks luks2 escrow aws /dev/nvme1n1
+    sudo luks2 open --escrow aws /dev/nvme1n1 data
+
     # Securely wipe (CAUTION: destroys data!)
     sudo luks2 wipe /dev/sdb1
 
+    # Unattended, e.g. in a provisioning script
+    echo "$PASS" | sudo luks2 --batch --stdin create --label data /dev/sdb1
+    sudo luks2 --batch --key-file /root/data.key open /dev/sdb1 data
+
 WORKFLOW (Block Device):
     1. Create:  luks2 create /dev/sdb1
     2. Open:    luks2 open /dev/sdb1 myvolume
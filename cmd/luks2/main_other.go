@@ -0,0 +1,20 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// The CLI unlocks through device-mapper and sets up loop devices and
+// mounts, so it only does anything on Linux. On other platforms the luks2
+// package still reads LUKS2 images in userspace with OpenVolume.
+func main() {
+	_, _ = fmt.Fprintln(os.Stderr, "luks2: this command requires Linux (device-mapper)")
+	os.Exit(1)
+}
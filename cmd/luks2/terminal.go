@@ -2,6 +2,8 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package main
 
 import (
@@ -14,3 +16,7 @@ type DefaultTerminal struct{}
 func (d *DefaultTerminal) ReadPassword(fd int) ([]byte, error) {
 	return term.ReadPassword(fd)
 }
+
+func (d *DefaultTerminal) IsTerminal(fd int) bool {
+	return term.IsTerminal(fd)
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Command luks2d manages LUKS2 volumes on behalf of local services over a
+// Unix domain socket. Callers are authorized by their peer credentials, so
+// they can unlock, lock and inspect volumes without running as root.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/daemon"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/metrics"
+)
+
+// Version is set at build time via -ldflags
+var Version = "dev"
+
+// generatorName is the name luks2d runs as a systemd generator under,
+// through a symlink in /usr/lib/systemd/system-generators
+const generatorName = "luks2-generator"
+
+func main() {
+	if filepath.Base(os.Args[0]) == generatorName {
+		os.Exit(runGenerator(os.Args[1:], daemon.DefaultBootConfigPath, os.Stderr))
+	}
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run parses flags and serves until SIGINT or SIGTERM
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("luks2d", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	socket := fs.String("socket", daemon.DefaultSocketPath, "Unix socket to listen on")
+	mode := fs.String("mode", "0660", "socket file permissions (octal)")
+	socketGroup := fs.String("socket-group", "", "group owning the socket file (default: the first of -allow-groups)")
+	users := fs.String("allow-users", "", "comma-separated users or UIDs allowed in addition to root")
+	groups := fs.String("allow-groups", "", "comma-separated groups or GIDs allowed in addition to root")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address (e.g. 127.0.0.1:9464)")
+	version := fs.Bool("version", false, "print version and exit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *version {
+		_, _ = fmt.Fprintf(stderr, "luks2d version %s\n", Version)
+		return 0
+	}
+
+	perm, err := strconv.ParseUint(*mode, 8, 32)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: invalid -mode %q\n", *mode)
+		return 2
+	}
+
+	uids, err := parseIDs(*users, lookupUID)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+	gids, err := parseIDs(*groups, lookupGID)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+	owner, err := parseIDs(*socketGroup, lookupGID)
+	if err != nil || len(owner) > 1 {
+		_, _ = fmt.Fprintf(stderr, "Error: invalid -socket-group %q\n", *socketGroup)
+		return 2
+	}
+	if len(owner) == 0 && len(gids) > 0 {
+		owner = gids[:1]
+	}
+	var sockGID uint32
+	if len(owner) == 1 {
+		sockGID = owner[0]
+	}
+
+	logger := log.New(stderr, "luks2d: ", log.LstdFlags)
+	server := daemon.NewServer(daemon.Config{
+		SocketPath:  *socket,
+		SocketMode:  os.FileMode(perm),
+		SocketGroup: sockGID,
+		AllowedUIDs: uids,
+		AllowedGIDs: gids,
+		ErrorLog:    logger,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *metricsAddr != "" {
+		addr, err := serveMetrics(ctx, *metricsAddr, logger)
+		if err != nil {
+			logger.Printf("metrics: %v", err)
+			return 1
+		}
+		logger.Printf("serving metrics on http://%s/metrics", addr)
+	}
+
+	l, err := listen(server, *socket, logger)
+	if err != nil {
+		logger.Printf("%v", err)
+		return 1
+	}
+	notify(logger, "READY=1")
+	defer notify(logger, "STOPPING=1")
+
+	if err := server.Serve(ctx, l); err != nil {
+		logger.Printf("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// listen returns the socket passed by systemd socket activation, or
+// creates the configured one
+func listen(server *daemon.Server, socket string, logger *log.Logger) (*net.UnixListener, error) {
+	l, err := daemon.ActivationListener()
+	if err != nil {
+		return nil, err
+	}
+	if l != nil {
+		logger.Printf("listening on %s (socket activation)", l.Addr())
+		return l, nil
+	}
+
+	if l, err = server.Listen(); err != nil {
+		return nil, err
+	}
+	logger.Printf("listening on %s", socket)
+	return l, nil
+}
+
+// notify reports a state change to systemd when running under it
+func notify(logger *log.Logger, state string) {
+	if _, err := daemon.Notify(state); err != nil {
+		logger.Printf("sd_notify: %v", err)
+	}
+}
+
+// runGenerator writes the units of the volumes in config to the first
+// directory systemd passes to generators. A missing config is not an
+// error: there is nothing to bring up.
+func runGenerator(args []string, config string, stderr io.Writer) int {
+	if len(args) != 1 && len(args) != 3 {
+		_, _ = fmt.Fprintf(stderr, "usage: %s <normal-dir> [<early-dir> <late-dir>]\n", generatorName)
+		return 2
+	}
+
+	cfg, err := daemon.LoadBootConfig(config)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %v\n", generatorName, err)
+		return 1
+	}
+	if err := daemon.GenerateUnits(args[0], cfg); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %v\n", generatorName, err)
+		return 1
+	}
+	return 0
+}
+
+// serveMetrics registers a metrics registry with the library and serves it
+// on addr until ctx is canceled. It returns the bound address.
+func serveMetrics(ctx context.Context, addr string, logger *log.Logger) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := metrics.New()
+	luks2.SetMetricsRecorder(reg)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", reg)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second, ErrorLog: logger}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Printf("metrics: %v", err)
+		}
+	}()
+	return ln.Addr(), nil
+}
+
+// parseIDs resolves a comma-separated list of names or numeric IDs
+func parseIDs(list string, lookup func(string) (string, error)) ([]uint32, error) {
+	var ids []uint32
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		idStr := item
+		if _, err := strconv.ParseUint(item, 10, 32); err != nil {
+			if idStr, err = lookup(item); err != nil {
+				return nil, fmt.Errorf("unknown user or group %q: %w", item, err)
+			}
+		}
+
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", idStr)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+// lookupUID resolves a user name to its UID
+func lookupUID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// lookupGID resolves a group name to its GID
+func lookupGID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/daemon"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+func TestParseIDs(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "luks" {
+			return "998", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	ids, err := parseIDs(" 1000, luks ,,0", lookup)
+	if err != nil {
+		t.Fatalf("parseIDs failed: %v", err)
+	}
+	if !slices.Equal(ids, []uint32{1000, 998, 0}) {
+		t.Errorf("ids = %v", ids)
+	}
+
+	if ids, err := parseIDs("", lookup); err != nil || len(ids) != 0 {
+		t.Errorf("empty list = %v, %v", ids, err)
+	}
+	if _, err := parseIDs("nobody-here", lookup); err == nil {
+		t.Error("Expected error for unknown name")
+	}
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	tests := [][]string{
+		{"-mode", "999"},
+		{"-allow-groups", "no-such-group-luks2d-test"},
+		{"-socket-group", "0,1"},
+		{"-bogus"},
+	}
+	for _, args := range tests {
+		var stderr bytes.Buffer
+		if code := run(args, &stderr); code != 2 {
+			t.Errorf("run(%v) = %d, want 2", args, code)
+		}
+	}
+}
+
+func TestRun_Version(t *testing.T) {
+	var stderr bytes.Buffer
+	if code := run([]string{"-version"}, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "luks2d version") {
+		t.Errorf("Unexpected output: %s", stderr.String())
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.Cleanup(func() { luks2.SetMetricsRecorder(nil) })
+
+	addr, err := serveMetrics(ctx, "127.0.0.1:0", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("serveMetrics failed: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr.String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "luks2_unlock_duration_seconds") {
+		t.Errorf("status %d, body:\n%s", resp.StatusCode, body)
+	}
+
+	if _, err := serveMetrics(ctx, addr.String(), log.New(io.Discard, "", 0)); err == nil {
+		t.Error("Expected error for an address in use")
+	}
+}
+
+func TestRunGenerator(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "volumes.json")
+
+	// Nothing configured is not an error
+	var stderr bytes.Buffer
+	if code := runGenerator([]string{dir, dir, dir}, config, &stderr); code != 0 {
+		t.Errorf("missing config: exit %d: %s", code, stderr.String())
+	}
+
+	data := `{"volumes": [{"name": "data", "device": "/dev/sdb1", "key_file": "/etc/luks2/data.key", "mount_point": "/srv/data"}]}`
+	if err := os.WriteFile(config, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := runGenerator([]string{dir, dir, dir}, config, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	for _, unit := range []string{"luks2-open-data.service", "srv-data.mount"} {
+		if _, err := os.Stat(filepath.Join(dir, unit)); err != nil {
+			t.Errorf("unit %s: %v", unit, err)
+		}
+	}
+
+	if code := runGenerator(nil, config, &stderr); code != 2 {
+		t.Errorf("no arguments: exit %d, want 2", code)
+	}
+	if err := os.WriteFile(config, []byte(`{"volumes": [{"name": "data"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := runGenerator([]string{dir}, config, &stderr); code != 1 || !strings.Contains(stderr.String(), "device is required") {
+		t.Errorf("invalid config: exit %d: %s", code, stderr.String())
+	}
+}
+
+func TestListen(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+	socket := filepath.Join(t.TempDir(), "luks2d.sock")
+	server := daemon.NewServer(daemon.Config{SocketPath: socket})
+
+	l, err := listen(server, socket, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	if fi, err := os.Stat(socket); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		t.Errorf("socket not created: %v", err)
+	}
+	_ = l.Close()
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("socket file left behind after Close")
+	}
+}
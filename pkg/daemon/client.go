@@ -0,0 +1,128 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// Client talks to a luks2d daemon. It is safe for concurrent use; requests
+// on one client are serialized over a single connection.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+// Dial connects to the daemon socket at path (DefaultSocketPath if empty)
+func Dial(path string) (*Client, error) {
+	if path == "" {
+		path = DefaultSocketPath
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+	return &Client{conn: conn, scanner: scanner}, nil
+}
+
+// Close closes the connection to the daemon
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Unlock asks the daemon to unlock device as /dev/mapper/name
+func (c *Client) Unlock(device string, passphrase []byte, name string) error {
+	_, err := c.do(&Request{Op: OpUnlock, Device: device, Name: name, Passphrase: passphrase})
+	return err
+}
+
+// UnlockWithOptions is Unlock with a keyslot selection and discard support
+func (c *Client) UnlockWithOptions(device string, passphrase []byte, name string, keyslot *int, allowDiscards bool) error {
+	_, err := c.do(&Request{
+		Op:            OpUnlock,
+		Device:        device,
+		Name:          name,
+		Passphrase:    passphrase,
+		Keyslot:       keyslot,
+		AllowDiscards: allowDiscards,
+	})
+	return err
+}
+
+// Lock asks the daemon to close the mapping name
+func (c *Client) Lock(name string) error {
+	_, err := c.do(&Request{Op: OpLock, Name: name})
+	return err
+}
+
+// Status returns the dm-crypt details of the active mapping name
+func (c *Client) Status(name string) (*luks2.VolumeStatus, error) {
+	resp, err := c.do(&Request{Op: OpStatus, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// AddKey asks the daemon to add newPassphrase to device, authorized by
+// existingPassphrase. keyslot selects the slot (nil = first free).
+func (c *Client) AddKey(device string, existingPassphrase, newPassphrase []byte, keyslot *int) error {
+	_, err := c.do(&Request{
+		Op:            OpAddKey,
+		Device:        device,
+		Passphrase:    existingPassphrase,
+		NewPassphrase: newPassphrase,
+		Keyslot:       keyslot,
+	})
+	return err
+}
+
+// do sends a request and waits for its response
+func (c *Client) do(req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	// The request holds passphrases; keep a single copy and wipe it
+	line := make([]byte, len(data)+1)
+	copy(line, data)
+	line[len(data)] = '\n'
+	clear(data)
+	defer clear(line)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.conn.Write(line); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, fmt.Errorf("daemon closed the connection")
+	}
+
+	var resp Response
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("malformed response: %w", err)
+	}
+
+	return &resp, resp.err()
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBootConfigPath is where the unit generator reads the volumes to
+// bring up at boot
+const DefaultBootConfigPath = "/etc/luks2/volumes.json"
+
+// DefaultCLIPath is the luks2 command the generated units run
+const DefaultCLIPath = "/usr/bin/luks2"
+
+// maxVolumeNameLen is the longest device-mapper name (DM_NAME_LEN - 1)
+const maxVolumeNameLen = 127
+
+// BootConfig lists the volumes unlocked, and optionally mounted, at boot by
+// the units GenerateUnits writes. It is JSON:
+//
+//	{
+//	  "volumes": [
+//	    {"name": "data", "device": "UUID=2b1bd3c0-...", "key_file": "/etc/luks2/data.key",
+//	     "mount_point": "/srv/data", "fs_type": "ext4", "mount_options": ["noatime"]}
+//	  ]
+//	}
+type BootConfig struct {
+	// CLIPath is the luks2 command run by the units (default: DefaultCLIPath)
+	CLIPath string `json:"luks2_path,omitempty"`
+
+	Volumes []BootVolume `json:"volumes"`
+}
+
+// BootVolume is one volume of a BootConfig
+type BootVolume struct {
+	// Name is the device-mapper name
+	Name string `json:"name"`
+
+	// Device is a device path, an image file, or UUID=/LABEL= of the volume
+	Device string `json:"device"`
+
+	// KeyFile unlocks the volume; there is no one to type a passphrase at
+	// boot. Volumes that need one are unlocked through luks2d later.
+	KeyFile string `json:"key_file"`
+
+	// MountPoint, if set, gets a mount unit for /dev/mapper/<Name>
+	MountPoint   string   `json:"mount_point,omitempty"`
+	FSType       string   `json:"fs_type,omitempty"` // "" = detect
+	MountOptions []string `json:"mount_options,omitempty"`
+
+	// AllowDiscards passes TRIM requests to the device
+	AllowDiscards bool `json:"allow_discards,omitempty"`
+
+	// NoFail lets the boot continue when the device is missing or cannot
+	// be unlocked, as the crypttab and fstab option of the same name does
+	NoFail bool `json:"nofail,omitempty"`
+}
+
+// LoadBootConfig reads and validates a BootConfig. Unknown fields are
+// rejected.
+func LoadBootConfig(path string) (*BootConfig, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- config path supplied by caller
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg BootConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid boot config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid boot config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks for missing fields and clashing names or mount points
+func (c *BootConfig) Validate() error {
+	if c.CLIPath != "" && !filepath.IsAbs(c.CLIPath) {
+		return fmt.Errorf("luks2_path must be absolute: %q", c.CLIPath)
+	}
+
+	names := make(map[string]bool)
+	mounts := make(map[string]bool)
+	for i, v := range c.Volumes {
+		switch {
+		case v.Name == "" || len(v.Name) > maxVolumeNameLen || strings.ContainsAny(v.Name, "/ \t\n") || v.Name == "." || v.Name == "..":
+			return fmt.Errorf("volume %d: invalid name %q", i, v.Name)
+		case names[v.Name]:
+			return fmt.Errorf("volume %q is listed twice", v.Name)
+		case v.Device == "":
+			return fmt.Errorf("volume %q: device is required", v.Name)
+		case v.KeyFile == "" || !filepath.IsAbs(v.KeyFile):
+			return fmt.Errorf("volume %q: key_file must be an absolute path", v.Name)
+		case v.MountPoint != "" && !filepath.IsAbs(v.MountPoint):
+			return fmt.Errorf("volume %q: mount_point must be absolute", v.Name)
+		case v.MountPoint == "" && (v.FSType != "" || len(v.MountOptions) > 0):
+			return fmt.Errorf("volume %q: fs_type and mount_options need a mount_point", v.Name)
+		}
+		names[v.Name] = true
+
+		if v.MountPoint != "" {
+			mp := path.Clean(v.MountPoint)
+			if mounts[mp] {
+				return fmt.Errorf("volume %q: mount point %s is used twice", v.Name, mp)
+			}
+			mounts[mp] = true
+		}
+	}
+	return nil
+}
+
+// GenerateUnits writes a service unit that unlocks each volume and a mount
+// unit for each mount point into dir, as a systemd generator does with its
+// first argument, and hooks them into cryptsetup.target and local-fs.target.
+// The units bind to the device, so a volume on removable media is unlocked
+// when it appears and locked when it goes away.
+func GenerateUnits(dir string, cfg *BootConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cli := cfg.CLIPath
+	if cli == "" {
+		cli = DefaultCLIPath
+	}
+
+	for _, v := range cfg.Volumes {
+		service := serviceUnitName(v.Name)
+		dep := "requires"
+		if v.NoFail {
+			dep = "wants"
+		}
+		if err := writeUnit(dir, service, serviceUnit(cli, &v), "cryptsetup.target."+dep); err != nil {
+			return err
+		}
+
+		if v.MountPoint != "" {
+			if err := writeUnit(dir, escapeUnitPath(v.MountPoint)+".mount", mountUnit(service, &v), "local-fs.target."+dep); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeUnit writes a unit file into dir and links it from dir/<wantedBy>
+func writeUnit(dir, name, content, wantedBy string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil { // #nosec G306 -- unit files are world-readable
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	depDir := filepath.Join(dir, wantedBy)
+	if err := os.MkdirAll(depDir, 0755); err != nil { // #nosec G301 -- unit directories are world-readable
+		return fmt.Errorf("failed to create %s: %w", wantedBy, err)
+	}
+	link := filepath.Join(depDir, name)
+	if err := os.Symlink(filepath.Join("..", name), link); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to link %s: %w", name, err)
+	}
+	return nil
+}
+
+// serviceUnitName returns the name of the service unlocking a volume
+func serviceUnitName(name string) string {
+	return "luks2-open-" + escapeUnitName(name) + ".service"
+}
+
+// serviceUnit returns the service that unlocks v at boot and locks it at
+// shutdown, ordered like systemd-cryptsetup@.service
+func serviceUnit(cli string, v *BootVolume) string {
+	var b strings.Builder
+	b.WriteString("# Automatically generated by luks2-generator\n\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Unlock LUKS2 volume %s\n", escapeSpecifiers(v.Name))
+	b.WriteString("Documentation=https://github.com/jeremyhahn/go-luks2\n")
+	b.WriteString("DefaultDependencies=no\n")
+	b.WriteString("IgnoreOnIsolate=true\n")
+	b.WriteString("Conflicts=umount.target\n")
+	b.WriteString("Before=cryptsetup.target umount.target\n")
+	b.WriteString("After=cryptsetup-pre.target systemd-udevd-kernel.socket\n")
+	if dev := deviceUnitName(v.Device); dev != "" {
+		fmt.Fprintf(&b, "BindsTo=%s\nAfter=%s\n", dev, dev)
+	} else {
+		// An image file needs the filesystem holding it
+		fmt.Fprintf(&b, "RequiresMountsFor=%s\n", escapeSpecifiers(quoteExecArg(v.Device)))
+	}
+	fmt.Fprintf(&b, "RequiresMountsFor=%s\n", escapeSpecifiers(quoteExecArg(v.KeyFile)))
+
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("RemainAfterExit=yes\n")
+	b.WriteString("TimeoutSec=0\n")
+	args := []string{cli, "open", "--batch", "--key-file", v.KeyFile}
+	if v.AllowDiscards {
+		args = append(args, "--allow-discards")
+	}
+	args = append(args, v.Device, v.Name)
+	fmt.Fprintf(&b, "ExecStart=%s\n", execLine(args...))
+	fmt.Fprintf(&b, "ExecStop=%s\n", execLine(cli, "close", v.Name))
+	return b.String()
+}
+
+// mountUnit returns the mount unit of v's filesystem
+func mountUnit(service string, v *BootVolume) string {
+	var b strings.Builder
+	b.WriteString("# Automatically generated by luks2-generator\n\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Mount LUKS2 volume %s\n", escapeSpecifiers(v.Name))
+	b.WriteString("Documentation=https://github.com/jeremyhahn/go-luks2\n")
+	fmt.Fprintf(&b, "Requires=%s\nAfter=%s\n", service, service)
+	if !v.NoFail {
+		b.WriteString("Before=local-fs.target\n")
+	}
+
+	b.WriteString("\n[Mount]\n")
+	fmt.Fprintf(&b, "What=/dev/mapper/%s\n", escapeSpecifiers(v.Name))
+	fmt.Fprintf(&b, "Where=%s\n", escapeSpecifiers(path.Clean(v.MountPoint)))
+	if v.FSType != "" {
+		fmt.Fprintf(&b, "Type=%s\n", escapeSpecifiers(v.FSType))
+	}
+	if len(v.MountOptions) > 0 {
+		fmt.Fprintf(&b, "Options=%s\n", escapeSpecifiers(strings.Join(v.MountOptions, ",")))
+	}
+	return b.String()
+}
+
+// deviceUnitName returns the device unit of a device path or UUID=/LABEL=
+// spec, or "" for an image file, which has none
+func deviceUnitName(device string) string {
+	var node string
+	switch {
+	case strings.HasPrefix(device, "UUID="):
+		node = "/dev/disk/by-uuid/" + udevEncode(strings.ToLower(strings.TrimPrefix(device, "UUID=")))
+	case strings.HasPrefix(device, "LABEL="):
+		node = "/dev/disk/by-label/" + udevEncode(strings.TrimPrefix(device, "LABEL="))
+	case strings.HasPrefix(device, "/dev/"):
+		node = device
+	default:
+		return ""
+	}
+	return escapeUnitPath(node) + ".device"
+}
+
+// udevEncode escapes a label the way udev does for /dev/disk/by-label links
+func udevEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAlnum(c) || strings.IndexByte("#+-.:=@_", c) >= 0 || c >= 0x80 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// escapeUnitPath escapes a path for use in a unit name, as
+// systemd-escape --path does
+func escapeUnitPath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return "-"
+	}
+	return escapeUnitName(p)
+}
+
+// escapeUnitName escapes a string for use in a unit name, as
+// systemd-escape does
+func escapeUnitName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && i == 0, !isAlnum(c) && c != ':' && c != '_' && c != '.':
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isAlnum reports whether c is an ASCII letter or digit
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// execLine joins a command line for ExecStart=, quoting and escaping
+// specifiers so every argument reaches the command unchanged
+func execLine(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = escapeSpecifiers(quoteExecArg(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteExecArg quotes an argument holding whitespace, quotes or
+// backslashes
+func quoteExecArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// escapeSpecifiers doubles % so systemd does not expand specifiers
+func escapeSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBootConfig writes a boot config file and returns its path
+func writeBootConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "volumes.json")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readUnit returns a generated unit file
+func readUnit(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name)) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("unit %s missing: %v", name, err)
+	}
+	return string(data)
+}
+
+// assertLines checks that unit contains every line of want
+func assertLines(t *testing.T, unit string, want ...string) {
+	t.Helper()
+	lines := strings.Split(unit, "\n")
+	for _, w := range want {
+		found := false
+		for _, l := range lines {
+			found = found || l == w
+		}
+		if !found {
+			t.Errorf("missing line %q in:\n%s", w, unit)
+		}
+	}
+}
+
+func TestLoadBootConfig(t *testing.T) {
+	path := writeBootConfig(t, `{
+		"luks2_path": "/usr/local/bin/luks2",
+		"volumes": [
+			{"name": "data", "device": "UUID=2B1BD3C0-4C5E", "key_file": "/etc/luks2/data.key", "mount_point": "/srv/data"},
+			{"name": "scratch", "device": "/dev/sdc1", "key_file": "/etc/luks2/scratch.key", "nofail": true}
+		]
+	}`)
+	cfg, err := LoadBootConfig(path)
+	if err != nil {
+		t.Fatalf("LoadBootConfig failed: %v", err)
+	}
+	if cfg.CLIPath != "/usr/local/bin/luks2" || len(cfg.Volumes) != 2 || !cfg.Volumes[1].NoFail {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	if _, err := LoadBootConfig(writeBootConfig(t, `{"volumes": [], "bogus": 1}`)); err == nil {
+		t.Error("Expected error for an unknown field")
+	}
+	if _, err := LoadBootConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
+
+func TestBootConfigValidate(t *testing.T) {
+	ok := BootVolume{Name: "data", Device: "/dev/sdb1", KeyFile: "/etc/luks2/data.key"}
+	tests := map[string]func(c *BootConfig){
+		"relative cli":       func(c *BootConfig) { c.CLIPath = "luks2" },
+		"empty name":         func(c *BootConfig) { c.Volumes[0].Name = "" },
+		"slash in name":      func(c *BootConfig) { c.Volumes[0].Name = "a/b" },
+		"long name":          func(c *BootConfig) { c.Volumes[0].Name = strings.Repeat("x", 128) },
+		"no device":          func(c *BootConfig) { c.Volumes[0].Device = "" },
+		"no key file":        func(c *BootConfig) { c.Volumes[0].KeyFile = "" },
+		"relative key":       func(c *BootConfig) { c.Volumes[0].KeyFile = "data.key" },
+		"relative mount":     func(c *BootConfig) { c.Volumes[0].MountPoint = "srv" },
+		"type without mount": func(c *BootConfig) { c.Volumes[0].FSType = "ext4" },
+		"duplicate name":     func(c *BootConfig) { c.Volumes = append(c.Volumes, ok) },
+		"duplicate mount": func(c *BootConfig) {
+			other := ok
+			other.Name = "other"
+			c.Volumes[0].MountPoint, other.MountPoint = "/srv", "/srv/"
+			c.Volumes = append(c.Volumes, other)
+		},
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &BootConfig{Volumes: []BootVolume{ok}}
+			mutate(cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+
+	if err := (&BootConfig{Volumes: []BootVolume{ok}}).Validate(); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+}
+
+func TestGenerateUnits(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &BootConfig{Volumes: []BootVolume{
+		{
+			Name: "data", Device: "UUID=2B1BD3C0-4C5E", KeyFile: "/etc/luks2/data key",
+			MountPoint: "/srv/my data/", FSType: "ext4", MountOptions: []string{"noatime", "x-50%"},
+			AllowDiscards: true,
+		},
+		{Name: "backup", Device: "LABEL=off site", KeyFile: "/etc/luks2/backup.key", NoFail: true, MountPoint: "/mnt/backup"},
+		{Name: "image", Device: "/var/lib/images/vm.luks", KeyFile: "/etc/luks2/vm.key"},
+	}}
+	if err := GenerateUnits(dir, cfg); err != nil {
+		t.Fatalf("GenerateUnits failed: %v", err)
+	}
+
+	data := readUnit(t, dir, "luks2-open-data.service")
+	assertLines(t, data,
+		"BindsTo=dev-disk-by\\x2duuid-2b1bd3c0\\x2d4c5e.device",
+		"After=dev-disk-by\\x2duuid-2b1bd3c0\\x2d4c5e.device",
+		"Before=cryptsetup.target umount.target",
+		`RequiresMountsFor="/etc/luks2/data key"`,
+		`ExecStart=/usr/bin/luks2 open --batch --key-file "/etc/luks2/data key" --allow-discards UUID=2B1BD3C0-4C5E data`,
+		"ExecStop=/usr/bin/luks2 close data",
+	)
+	assertLines(t, readUnit(t, dir, `srv-my\x20data.mount`),
+		"Requires=luks2-open-data.service",
+		"After=luks2-open-data.service",
+		"Before=local-fs.target",
+		"What=/dev/mapper/data",
+		"Where=/srv/my data",
+		"Type=ext4",
+		"Options=noatime,x-50%%",
+	)
+
+	assertLines(t, readUnit(t, dir, "luks2-open-backup.service"), `BindsTo=dev-disk-by\x2dlabel-off\x5cx20site.device`)
+	if strings.Contains(readUnit(t, dir, "mnt-backup.mount"), "Before=local-fs.target") {
+		t.Error("a nofail mount must not hold up local-fs.target")
+	}
+
+	image := readUnit(t, dir, "luks2-open-image.service")
+	assertLines(t, image, "RequiresMountsFor=/var/lib/images/vm.luks")
+	if strings.Contains(image, "BindsTo=") {
+		t.Error("an image file has no device unit")
+	}
+
+	for _, link := range []string{
+		"cryptsetup.target.requires/luks2-open-data.service",
+		`local-fs.target.requires/srv-my\x20data.mount`,
+		"cryptsetup.target.wants/luks2-open-backup.service",
+		"local-fs.target.wants/mnt-backup.mount",
+		"cryptsetup.target.requires/luks2-open-image.service",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, link)); err != nil {
+			t.Errorf("link %s: %v", link, err)
+		}
+	}
+
+	// Running again over the same directory is harmless
+	if err := GenerateUnits(dir, cfg); err != nil {
+		t.Errorf("second GenerateUnits failed: %v", err)
+	}
+	if err := GenerateUnits(dir, &BootConfig{CLIPath: "luks2"}); err == nil {
+		t.Error("Expected error for an invalid config")
+	}
+}
+
+func TestEscapeUnitPath(t *testing.T) {
+	tests := map[string]string{
+		"/srv/my data":              `srv-my\x20data`,
+		"/":                         "-",
+		"/dev/disk/by-uuid/2b1b-aa": `dev-disk-by\x2duuid-2b1b\x2daa`,
+		"/.hidden/x":                `\x2ehidden-x`,
+		"//a//b/":                   "a-b",
+	}
+	for in, want := range tests {
+		if got := escapeUnitPath(in); got != want {
+			t.Errorf("escapeUnitPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// Cross-check with systemd where it is installed
+	if _, err := exec.LookPath("systemd-escape"); err == nil {
+		for in := range tests {
+			out, err := exec.Command("systemd-escape", "--path", in).Output() // #nosec G204 -- test command
+			if err == nil && strings.TrimSpace(string(out)) != escapeUnitPath(in) {
+				t.Errorf("systemd-escape --path %q = %q, we give %q", in, strings.TrimSpace(string(out)), escapeUnitPath(in))
+			}
+		}
+	}
+}
+
+func TestEscapeUnitName(t *testing.T) {
+	for in, want := range map[string]string{
+		"data-1": `data\x2d1`,
+		"my.vol": "my.vol",
+		".x":     `\x2ex`,
+		"a%b":    `a\x25b`,
+	} {
+		if got := escapeUnitName(in); got != want {
+			t.Errorf("escapeUnitName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExecLine(t *testing.T) {
+	got := execLine("/usr/bin/luks2", "open", `a "b"`, `c\d`, "50%", "")
+	want := `/usr/bin/luks2 open "a \"b\"" "c\\d" 50%% ""`
+	if got != want {
+		t.Errorf("execLine = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Package daemon implements the luks2d control protocol: a server that
+// manages LUKS2 volumes on behalf of local callers over a Unix domain socket,
+// and a client for it.
+//
+// Requests and responses are newline-delimited JSON objects. Callers are
+// identified by their socket peer credentials (SO_PEERCRED), so services can
+// unlock and lock volumes without running as root themselves.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// DefaultSocketPath is where luks2d listens by default
+const DefaultSocketPath = "/run/luks2d.sock"
+
+// maxRequestSize bounds a single request line
+const maxRequestSize = 64 * 1024
+
+// Operations supported by the daemon
+const (
+	OpUnlock = "unlock"
+	OpLock   = "lock"
+	OpStatus = "status"
+	OpAddKey = "addkey"
+)
+
+// Error codes carried in responses so clients can map failures back to the
+// luks2 sentinel errors
+const (
+	CodePermissionDenied = "permission_denied"
+	CodeNotUnlocked      = "not_unlocked"
+	CodeInvalidRequest   = "invalid_request"
+	CodeFailed           = "failed"
+)
+
+// Request is a single operation sent to the daemon
+type Request struct {
+	Op            string `json:"op"`
+	Device        string `json:"device,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Passphrase    []byte `json:"passphrase,omitempty"`
+	NewPassphrase []byte `json:"new_passphrase,omitempty"`
+	Keyslot       *int   `json:"keyslot,omitempty"`
+	AllowDiscards bool   `json:"allow_discards,omitempty"`
+}
+
+// clear wipes the passphrases carried by the request
+func (r *Request) clear() {
+	clear(r.Passphrase)
+	clear(r.NewPassphrase)
+}
+
+// validate checks that the fields required by the operation are present
+func (r *Request) validate() error {
+	switch r.Op {
+	case OpUnlock:
+		if r.Device == "" || r.Name == "" || len(r.Passphrase) == 0 {
+			return errors.New("unlock requires device, name and passphrase")
+		}
+	case OpLock, OpStatus:
+		if r.Name == "" {
+			return fmt.Errorf("%s requires name", r.Op)
+		}
+	case OpAddKey:
+		if r.Device == "" || len(r.Passphrase) == 0 || len(r.NewPassphrase) == 0 {
+			return errors.New("addkey requires device, passphrase and new passphrase")
+		}
+	default:
+		return fmt.Errorf("unknown operation: %q", r.Op)
+	}
+	return nil
+}
+
+// Response is the daemon's reply to a Request
+type Response struct {
+	Error  string              `json:"error,omitempty"`
+	Code   string              `json:"code,omitempty"`
+	Status *luks2.VolumeStatus `json:"status,omitempty"`
+}
+
+// err converts a failed response into an error wrapping the matching luks2
+// sentinel where one exists
+func (r *Response) err() error {
+	if r.Error == "" {
+		return nil
+	}
+
+	switch r.Code {
+	case CodePermissionDenied:
+		return fmt.Errorf("%w: %s", luks2.ErrPermissionDenied, r.Error)
+	case CodeNotUnlocked:
+		return fmt.Errorf("%w: %s", luks2.ErrVolumeNotUnlocked, r.Error)
+	}
+	return errors.New(r.Error)
+}
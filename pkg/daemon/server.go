@@ -0,0 +1,369 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"golang.org/x/sys/unix"
+)
+
+// connIdleTimeout closes connections that send no request for this long
+const connIdleTimeout = time.Minute
+
+// userGroups returns the groups of a user from the user database
+// (overridable for tests)
+var userGroups = lookupUserGroups
+
+// Backend performs the volume operations requested through the daemon
+type Backend interface {
+	UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error
+	Lock(name string) error
+	Status(name string) (*luks2.VolumeStatus, error)
+	AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error
+}
+
+// luks2Backend implements Backend with the luks2 package
+type luks2Backend struct{}
+
+func (luks2Backend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	return luks2.UnlockWithOptions(device, passphrase, name, opts)
+}
+
+func (luks2Backend) Lock(name string) error {
+	return luks2.Lock(name)
+}
+
+func (luks2Backend) Status(name string) (*luks2.VolumeStatus, error) {
+	return luks2.Status(name)
+}
+
+func (luks2Backend) AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error {
+	return luks2.AddKey(device, existingPassphrase, newPassphrase, opts)
+}
+
+// PeerCred identifies the process on the other end of a connection
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Config configures a Server
+type Config struct {
+	// SocketPath is the Unix socket to listen on (default: DefaultSocketPath)
+	SocketPath string
+
+	// SocketMode is the permission of the socket file (default: 0660).
+	// Only root and SocketGroup can connect by default; use 0666 to let
+	// AllowedUIDs outside that group in, since access is still decided by
+	// peer credentials.
+	SocketMode os.FileMode
+
+	// SocketGroup, if non-zero, is the GID that owns the socket file, so
+	// its members can connect under the default SocketMode
+	SocketGroup uint32
+
+	// AllowedUIDs and AllowedGIDs list the callers allowed to use the daemon
+	// in addition to root. A GID matches the caller's primary group, taken
+	// from SO_PEERCRED, or a supplementary group of the caller's UID in the
+	// user database.
+	AllowedUIDs []uint32
+	AllowedGIDs []uint32
+
+	// Authorize is an optional per-request check run after the UID/GID
+	// allowlist (e.g. to restrict which devices a caller may unlock)
+	Authorize func(peer PeerCred, req *Request) error
+
+	// Backend performs the operations (default: the luks2 package)
+	Backend Backend
+
+	// ErrorLog receives access denials and failed operations (default: discard).
+	// Passphrases are never logged.
+	ErrorLog *log.Logger
+}
+
+// Server serves the daemon protocol on a Unix socket
+type Server struct {
+	cfg Config
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewServer creates a server, applying defaults to cfg
+func NewServer(cfg Config) *Server {
+	if cfg.SocketPath == "" {
+		cfg.SocketPath = DefaultSocketPath
+	}
+	if cfg.SocketMode == 0 {
+		cfg.SocketMode = 0660
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = luks2Backend{}
+	}
+	return &Server{cfg: cfg, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe listens on the configured socket and serves connections
+// until ctx is canceled. A stale socket file left by a crashed daemon is
+// replaced; a socket with a live daemon behind it is an error.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	l, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(s.cfg.SocketPath) }()
+
+	return s.Serve(ctx, l)
+}
+
+// Listen creates the configured socket with its permissions, replacing a
+// stale socket file, for callers that report readiness between listening
+// and Serve. The socket file is removed when the listener is closed, as
+// Serve does when its context is canceled.
+func (s *Server) Listen() (*net.UnixListener, error) {
+	if err := removeStaleSocket(s.cfg.SocketPath); err != nil {
+		return nil, err
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: s.cfg.SocketPath, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.cfg.SocketPath, err)
+	}
+
+	if err := os.Chmod(s.cfg.SocketPath, s.cfg.SocketMode); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if s.cfg.SocketGroup != 0 {
+		if err := os.Chown(s.cfg.SocketPath, -1, int(s.cfg.SocketGroup)); err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("failed to set socket group: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Serve accepts connections on l until ctx is canceled, then closes l and
+// all open connections and waits for in-flight requests to finish
+func (s *Server) Serve(ctx context.Context, l *net.UnixListener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+		s.mu.Lock()
+		for c := range s.conns {
+			_ = c.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	defer s.wg.Wait()
+	for {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept failed: %w", err)
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// handleConn serves requests from one connection until it is closed
+func (s *Server) handleConn(conn *net.UnixConn) {
+	defer func() { _ = conn.Close() }()
+
+	peer, err := peerCred(conn)
+	if err != nil {
+		s.logf("rejecting connection: %v", err)
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxRequestSize)
+	enc := json.NewEncoder(conn)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(connIdleTimeout))
+		if !scanner.Scan() {
+			return
+		}
+
+		var req Request
+		line := scanner.Bytes()
+		err := json.Unmarshal(line, &req)
+		clear(line)
+
+		var resp *Response
+		if err != nil {
+			resp = &Response{Error: "malformed request", Code: CodeInvalidRequest}
+		} else {
+			resp = s.handle(peer, &req)
+		}
+		req.clear()
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle authorizes and executes a single request
+func (s *Server) handle(peer PeerCred, req *Request) *Response {
+	if err := req.validate(); err != nil {
+		return &Response{Error: err.Error(), Code: CodeInvalidRequest}
+	}
+
+	if err := s.authorize(peer, req); err != nil {
+		s.logf("denied %s for uid %d (pid %d): %v", req.Op, peer.UID, peer.PID, err)
+		return &Response{Error: err.Error(), Code: CodePermissionDenied}
+	}
+
+	var status *luks2.VolumeStatus
+	var err error
+	switch req.Op {
+	case OpUnlock:
+		err = s.cfg.Backend.UnlockWithOptions(req.Device, req.Passphrase, req.Name,
+			&luks2.UnlockOptions{Keyslot: req.Keyslot, AllowDiscards: req.AllowDiscards})
+	case OpLock:
+		err = s.cfg.Backend.Lock(req.Name)
+	case OpStatus:
+		status, err = s.cfg.Backend.Status(req.Name)
+	case OpAddKey:
+		err = s.cfg.Backend.AddKey(req.Device, req.Passphrase, req.NewPassphrase,
+			&luks2.AddKeyOptions{Keyslot: req.Keyslot})
+	}
+
+	if err != nil {
+		s.logf("%s failed for uid %d (pid %d): %v", req.Op, peer.UID, peer.PID, err)
+		code := CodeFailed
+		if errors.Is(err, luks2.ErrVolumeNotUnlocked) {
+			code = CodeNotUnlocked
+		}
+		return &Response{Error: err.Error(), Code: code}
+	}
+
+	return &Response{Status: status}
+}
+
+// authorize checks the caller against the UID/GID allowlist and the
+// optional Authorize hook. Root is always allowed by the allowlist.
+func (s *Server) authorize(peer PeerCred, req *Request) error {
+	allowed := peer.UID == 0 || slices.Contains(s.cfg.AllowedUIDs, peer.UID)
+	if !allowed && len(s.cfg.AllowedGIDs) > 0 {
+		groups := append(userGroups(peer.UID), peer.GID)
+		allowed = slices.ContainsFunc(groups, func(gid uint32) bool {
+			return slices.Contains(s.cfg.AllowedGIDs, gid)
+		})
+	}
+	if !allowed {
+		return fmt.Errorf("uid %d is not allowed", peer.UID)
+	}
+
+	if s.cfg.Authorize != nil {
+		return s.cfg.Authorize(peer, req)
+	}
+	return nil
+}
+
+// logf writes to the configured error log, if any
+func (s *Server) logf(format string, args ...any) {
+	if s.cfg.ErrorLog != nil {
+		s.cfg.ErrorLog.Printf(format, args...)
+	}
+}
+
+// peerCred returns the credentials of the process connected to conn
+func peerCred(conn *net.UnixConn) (PeerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED) // #nosec G115 - fd fits in int
+	}); err != nil {
+		return PeerCred{}, err
+	}
+	if credErr != nil {
+		return PeerCred{}, fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	return PeerCred{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
+
+// lookupUserGroups returns the groups of uid in the user database,
+// returning nil if the user is unknown. Unlike /proc/<pid>/status, this
+// cannot be raced by the peer exiting and its PID being reused.
+func lookupUserGroups(uid uint32) []uint32 {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+
+	var groups []uint32
+	for _, id := range ids {
+		if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+			groups = append(groups, uint32(gid))
+		}
+	}
+	return groups
+}
+
+// removeStaleSocket deletes a socket file nobody is listening on
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("another daemon is listening on %s", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// fakeBackend records the operations it receives
+type fakeBackend struct {
+	mu         sync.Mutex
+	calls      []string
+	passphrase string
+	opts       *luks2.UnlockOptions
+	unlocked   map[string]bool
+}
+
+func (b *fakeBackend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "unlock "+device+" "+name)
+	b.passphrase, b.opts = string(passphrase), opts
+	if string(passphrase) != "correct-horse" {
+		return errors.New("incorrect passphrase")
+	}
+	b.unlocked[name] = true
+	return nil
+}
+
+func (b *fakeBackend) Lock(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "lock "+name)
+	delete(b.unlocked, name)
+	return nil
+}
+
+func (b *fakeBackend) Status(name string) (*luks2.VolumeStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.unlocked[name] {
+		return nil, fmt.Errorf("%w: %s", luks2.ErrVolumeNotUnlocked, name)
+	}
+	return &luks2.VolumeStatus{Name: name, Cipher: "aes-xts-plain64", KeySize: 512}, nil
+}
+
+func (b *fakeBackend) AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "addkey "+device+" "+string(newPassphrase))
+	return nil
+}
+
+// startServer runs a server on a temporary socket until the test ends
+func startServer(t *testing.T, cfg Config) (*Client, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{unlocked: make(map[string]bool)}
+	cfg.Backend = backend
+	cfg.SocketPath = filepath.Join(t.TempDir(), "luks2d.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewServer(cfg).ListenAndServe(ctx) }()
+
+	var client *Client
+	var err error
+	for i := 0; i < 100; i++ {
+		if client, err = Dial(cfg.SocketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		cancel()
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = client.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ListenAndServe returned %v", err)
+		}
+		if _, err := os.Stat(cfg.SocketPath); !os.IsNotExist(err) {
+			t.Error("socket file not removed on shutdown")
+		}
+	})
+	return client, backend
+}
+
+// TestClientServer tests the full request cycle for every operation
+func TestClientServer(t *testing.T) {
+	client, backend := startServer(t, Config{})
+
+	if err := client.Unlock("/dev/sdb1", []byte("wrong-passphrase"), "data"); err == nil {
+		t.Error("Expected unlock with wrong passphrase to fail")
+	}
+
+	slot := 1
+	if err := client.UnlockWithOptions("/dev/sdb1", []byte("correct-horse"), "data", &slot, true); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if backend.opts == nil || backend.opts.Keyslot == nil || *backend.opts.Keyslot != 1 || !backend.opts.AllowDiscards {
+		t.Errorf("Unlock options not forwarded: %+v", backend.opts)
+	}
+
+	status, err := client.Status("data")
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Name != "data" || status.KeySize != 512 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	if err := client.AddKey("/dev/sdb1", []byte("correct-horse"), []byte("battery-staple"), nil); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	if err := client.Lock("data"); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	if _, err := client.Status("data"); !errors.Is(err, luks2.ErrVolumeNotUnlocked) {
+		t.Errorf("Expected ErrVolumeNotUnlocked, got %v", err)
+	}
+
+	want := []string{
+		"unlock /dev/sdb1 data",
+		"unlock /dev/sdb1 data",
+		"addkey /dev/sdb1 battery-staple",
+		"lock data",
+	}
+	if strings.Join(backend.calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %v, want %v", backend.calls, want)
+	}
+}
+
+// TestClientServer_InvalidRequest tests validation of missing fields
+func TestClientServer_InvalidRequest(t *testing.T) {
+	client, backend := startServer(t, Config{})
+
+	if err := client.Unlock("/dev/sdb1", nil, "data"); err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("Expected missing passphrase error, got %v", err)
+	}
+	if _, err := client.do(&Request{Op: "format"}); err == nil || !strings.Contains(err.Error(), "unknown operation") {
+		t.Errorf("Expected unknown operation error, got %v", err)
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Invalid requests reached the backend: %v", backend.calls)
+	}
+}
+
+// TestClientServer_AuthorizeHook tests that a denial maps to ErrPermissionDenied
+func TestClientServer_AuthorizeHook(t *testing.T) {
+	client, backend := startServer(t, Config{
+		Authorize: func(peer PeerCred, req *Request) error {
+			if peer.PID != int32(os.Getpid()) {
+				t.Errorf("unexpected peer pid %d", peer.PID)
+			}
+			if req.Op == OpLock {
+				return errors.New("lock not permitted")
+			}
+			return nil
+		},
+	})
+
+	if err := client.Lock("data"); !errors.Is(err, luks2.ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied, got %v", err)
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Denied request reached the backend: %v", backend.calls)
+	}
+}
+
+// TestAuthorize tests the UID/GID allowlist
+func TestAuthorize(t *testing.T) {
+	userGroups = func(uid uint32) []uint32 {
+		if uid == 1001 {
+			return []uint32{1001, 27, 998}
+		}
+		return nil
+	}
+	t.Cleanup(func() { userGroups = lookupUserGroups })
+
+	s := NewServer(Config{AllowedUIDs: []uint32{1000}, AllowedGIDs: []uint32{998}})
+	req := &Request{Op: OpStatus, Name: "data"}
+
+	tests := []struct {
+		name    string
+		peer    PeerCred
+		allowed bool
+	}{
+		{"root", PeerCred{UID: 0}, true},
+		{"allowed uid", PeerCred{UID: 1000, GID: 1000}, true},
+		{"primary gid", PeerCred{UID: 1002, GID: 998}, true},
+		{"supplementary gid", PeerCred{UID: 1001, GID: 1001}, true},
+		{"other user", PeerCred{PID: 1, UID: 1003, GID: 1003}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.authorize(tt.peer, req); (err == nil) != tt.allowed {
+				t.Errorf("authorize() = %v, allowed = %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+// TestListen_SocketPermissions tests the default mode and socket group
+func TestListen_SocketPermissions(t *testing.T) {
+	gid := uint32(os.Getgid()) // #nosec G115 -- GIDs fit in uint32
+	if os.Geteuid() == 0 {
+		gid = 4242 // root may give the socket to any group
+	}
+	path := filepath.Join(t.TempDir(), "luks2d.sock")
+	l, err := NewServer(Config{SocketPath: path, SocketGroup: gid}).Listen()
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %o, want 660", fi.Mode().Perm())
+	}
+	if st := fi.Sys().(*syscall.Stat_t); st.Gid != gid {
+		t.Errorf("socket group = %d, want %d", st.Gid, gid)
+	}
+}
+
+// TestRemoveStaleSocket tests replacing dead sockets and refusing live ones
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("missing socket: %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil {
+		t.Error("Expected error for a regular file")
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	l, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(live); err == nil {
+		t.Error("Expected error for a live socket")
+	}
+
+	// Closing without unlinking leaves a stale socket file behind
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = l.Close()
+	if err := removeStaleSocket(live); err != nil {
+		t.Errorf("stale socket: %v", err)
+	}
+	if _, err := os.Stat(live); !os.IsNotExist(err) {
+		t.Error("stale socket not removed")
+	}
+}
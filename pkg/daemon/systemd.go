@@ -0,0 +1,102 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation
+// (SD_LISTEN_FDS_START; overridable for tests)
+var listenFDsStart = 3
+
+// Notify sends a state change such as "READY=1" or "STOPPING=1" to the
+// service manager (sd_notify). It reports false, without an error, when the
+// process was not started by systemd with Type=notify.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		// Abstract namespace socket
+		socket = "\x00" + socket[1:]
+	} else if !strings.HasPrefix(socket, "/") {
+		return false, fmt.Errorf("unsupported NOTIFY_SOCKET %q", socket)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify the service manager: %w", err)
+	}
+	return true, nil
+}
+
+// ActivationListener returns the Unix socket passed by systemd socket
+// activation (LISTEN_FDS), or nil when the daemon was started without one.
+// The environment variables are cleared so child processes do not inherit
+// them. Exactly one stream socket is accepted, as luks2d.socket declares.
+func ActivationListener() (*net.UnixListener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// Meant for another process, e.g. inherited through exec
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("expected one activation socket, got %d", n)
+	}
+
+	fd := listenFDsStart
+	unix.CloseOnExec(fd)
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd)) // #nosec G115 -- fd is a small positive number
+	defer func() { _ = f.Close() }()
+
+	// FileListener accepts any bound Unix socket, datagram ones included
+	if typ, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE); err != nil || typ != unix.SOCK_STREAM {
+		return nil, errors.New("activation socket is not a Unix stream socket")
+	}
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation socket: %w", err)
+	}
+	ul, ok := l.(*net.UnixListener)
+	if !ok {
+		_ = l.Close()
+		return nil, errors.New("activation socket is not a Unix stream socket")
+	}
+	// The socket file belongs to the socket unit
+	ul.SetUnlinkOnClose(false)
+	return ul, nil
+}
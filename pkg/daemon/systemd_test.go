@@ -0,0 +1,174 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify("READY=1"); sent || err != nil {
+		t.Errorf("Notify without NOTIFY_SOCKET = %v, %v", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if sent, err := Notify("READY=1"); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "relative/path")
+	if _, err := Notify("READY=1"); err == nil {
+		t.Error("Expected error for a relative NOTIFY_SOCKET")
+	}
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Notify("READY=1"); err == nil {
+		t.Error("Expected error for a missing socket")
+	}
+}
+
+func TestNotify_Abstract(t *testing.T) {
+	name := "luks2d-test-" + strconv.Itoa(os.Getpid())
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "@" + name, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("abstract sockets not available: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	t.Setenv("NOTIFY_SOCKET", "@"+name)
+	if sent, err := Notify("STOPPING=1"); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+}
+
+// passFD hands a duplicate of the socket of f to ActivationListener, which
+// takes ownership of it, as it does of the descriptor systemd passes
+func passFD(t *testing.T, f *os.File) {
+	t.Helper()
+	fd, err := unix.Dup(int(f.Fd())) // #nosec G115 -- test descriptor
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	saved := listenFDsStart
+	listenFDsStart = fd
+	t.Cleanup(func() { listenFDsStart = saved })
+}
+
+// setActivationEnv sets the socket activation variables for this process
+func setActivationEnv(t *testing.T, pid int, fds string) {
+	t.Helper()
+	t.Setenv("LISTEN_PID", strconv.Itoa(pid))
+	t.Setenv("LISTEN_FDS", fds)
+}
+
+func TestActivationListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "luks2d.sock")
+	orig, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = orig.Close() }()
+	f, err := orig.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passFD(t, f)
+
+	setActivationEnv(t, os.Getpid(), "1")
+	l, err := ActivationListener()
+	if err != nil || l == nil {
+		t.Fatalf("ActivationListener = %v, %v", l, err)
+	}
+	defer func() { _ = l.Close() }()
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("activation variables were not cleared")
+	}
+
+	go func() {
+		if c, err := net.Dial("unix", path); err == nil {
+			_ = c.Close()
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	_ = conn.Close()
+
+	// Closing the listener leaves the socket file to the socket unit
+	_ = l.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("socket file removed: %v", err)
+	}
+}
+
+func TestActivationListener_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+	if l, err := ActivationListener(); l != nil || err != nil {
+		t.Errorf("ActivationListener = %v, %v", l, err)
+	}
+
+	// Variables inherited from a parent are meant for it
+	setActivationEnv(t, os.Getpid()+1, "1")
+	if l, err := ActivationListener(); l != nil || err != nil {
+		t.Errorf("ActivationListener for another pid = %v, %v", l, err)
+	}
+
+	setActivationEnv(t, os.Getpid(), "0")
+	if l, err := ActivationListener(); l != nil || err != nil {
+		t.Errorf("ActivationListener with no sockets = %v, %v", l, err)
+	}
+}
+
+func TestActivationListener_Invalid(t *testing.T) {
+	for _, fds := range []string{"2", "x", "-1"} {
+		setActivationEnv(t, os.Getpid(), fds)
+		if _, err := ActivationListener(); err == nil {
+			t.Errorf("Expected error for LISTEN_FDS=%s", fds)
+		}
+	}
+
+	// A datagram socket cannot serve the protocol
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(t.TempDir(), "dgram"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	f, err := conn.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	passFD(t, f)
+
+	setActivationEnv(t, os.Getpid(), "1")
+	if _, err := ActivationListener(); err == nil {
+		t.Error("Expected error for a datagram socket")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// afalgBind returns an AF_ALG socket bound to an algorithm of the kernel
+// crypto API. The kernel loads the modules the algorithm needs; ENOENT
+// means it has no such algorithm.
+func afalgBind(algType, name string) (int, error) {
+	fd, err := unix.Socket(unix.AF_ALG, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("AF_ALG not available: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrALG{Type: algType, Name: name}); err != nil {
+		_ = unix.Close(fd)
+		return -1, fmt.Errorf("AF_ALG %s %s: %w", algType, name, err)
+	}
+	return fd, nil
+}
+
+// afalgOpen binds an algorithm, sets its key and returns the socket that
+// performs operations along with the bound one, which must stay open
+func afalgOpen(algType, name string, key []byte) (tfm, op int, err error) {
+	tfm, err = afalgBind(algType, name)
+	if err != nil {
+		return -1, -1, err
+	}
+	if len(key) > 0 {
+		// Set the key without copying it into a string
+		// #nosec G103 -- unsafe.Pointer required for setsockopt
+		if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(tfm), unix.SOL_ALG, unix.ALG_SET_KEY,
+			uintptr(unsafe.Pointer(&key[0])), uintptr(len(key)), 0); errno != 0 {
+			_ = unix.Close(tfm)
+			return -1, -1, fmt.Errorf("AF_ALG %s: failed to set key: %w", name, errno)
+		}
+	}
+	// accept4 without an address: AF_ALG sockets have none, and
+	// unix.Accept4 fails trying to decode it
+	fd, _, errno := unix.Syscall6(unix.SYS_ACCEPT4, uintptr(tfm), 0, 0, unix.SOCK_CLOEXEC, 0, 0)
+	if errno != 0 {
+		_ = unix.Close(tfm)
+		return -1, -1, fmt.Errorf("AF_ALG %s: %w", name, errno)
+	}
+	return tfm, int(fd), nil
+}
+
+// afalgAvailable reports whether the kernel can instantiate an algorithm
+func afalgAvailable(algType, name string) (bool, error) {
+	fd, err := afalgBind(algType, name)
+	if errors.Is(err, unix.ENOENT) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_ = unix.Close(fd)
+	return true, nil
+}
+
+// afalgXTS is AES-XTS on the kernel crypto API
+type afalgXTS struct {
+	tfm, op int
+	control [2][]byte // Control messages setting the operation and IV, by direction
+}
+
+func newAFALGXTS(key []byte) (*afalgXTS, error) {
+	tfm, op, err := afalgOpen("skcipher", "xts(aes)", key)
+	if err != nil {
+		return nil, err
+	}
+	return &afalgXTS{
+		tfm: tfm,
+		op:  op,
+		control: [2][]byte{
+			algControl(unix.ALG_OP_DECRYPT, xtsIVSize),
+			algControl(unix.ALG_OP_ENCRYPT, xtsIVSize),
+		},
+	}, nil
+}
+
+// xtsIVSize is the size of the XTS tweak: one AES block
+const xtsIVSize = 16
+
+func (c *afalgXTS) Encrypt(dst, src []byte, sector uint64) error {
+	return c.crypt(dst, src, sector, unix.ALG_OP_ENCRYPT)
+}
+
+func (c *afalgXTS) Decrypt(dst, src []byte, sector uint64) error {
+	return c.crypt(dst, src, sector, unix.ALG_OP_DECRYPT)
+}
+
+// crypt processes one sector; the tweak is the sector number in little
+// endian (plain64), as Go's xts package and dm-crypt use
+func (c *afalgXTS) crypt(dst, src []byte, sector uint64, op int) error {
+	control := c.control[op]
+	binary.LittleEndian.PutUint64(control[len(control)-xtsIVSize:], sector)
+	if err := unix.Sendmsg(c.op, src, control, nil, 0); err != nil {
+		return fmt.Errorf("AF_ALG xts(aes): %w", err)
+	}
+	n, err := unix.Read(c.op, dst[:len(src)])
+	if err != nil {
+		return fmt.Errorf("AF_ALG xts(aes): %w", err)
+	}
+	if n != len(src) {
+		return fmt.Errorf("AF_ALG xts(aes): short read of %d bytes", n)
+	}
+	return nil
+}
+
+func (c *afalgXTS) Close() error {
+	return errors.Join(unix.Close(c.op), unix.Close(c.tfm))
+}
+
+// algControl builds the ALG_SET_OP and ALG_SET_IV control messages of an
+// skcipher operation; the IV is left zero at the end of the buffer
+func algControl(op, ivSize int) []byte {
+	opSpace := unix.CmsgSpace(4)
+	b := make([]byte, opSpace+unix.CmsgSpace(4+ivSize))
+
+	// #nosec G103 -- unsafe.Pointer required to lay out cmsghdr
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = unix.SOL_ALG
+	h.Type = unix.ALG_SET_OP
+	h.SetLen(unix.CmsgLen(4))
+	binary.NativeEndian.PutUint32(b[unix.CmsgLen(0):], uint32(op)) // #nosec G115 -- ALG_OP_* constants
+
+	// struct af_alg_iv { __u32 ivlen; __u8 iv[]; }
+	// #nosec G103 -- unsafe.Pointer required to lay out cmsghdr
+	h = (*unix.Cmsghdr)(unsafe.Pointer(&b[opSpace]))
+	h.Level = unix.SOL_ALG
+	h.Type = unix.ALG_SET_IV
+	h.SetLen(unix.CmsgLen(4 + ivSize))
+	binary.NativeEndian.PutUint32(b[opSpace+unix.CmsgLen(0):], uint32(ivSize)) // #nosec G115 -- AES block size
+
+	// Trim the padding after the IV so it sits at the end
+	return b[:opSpace+unix.CmsgLen(4+ivSize)]
+}
+
+// afalgPBKDF2 runs PBKDF2 (RFC 8018) with the kernel's hmac(hashAlgo) as
+// PRF. The password is set once as the HMAC key; each iteration is then a
+// write and a read on the same socket.
+func afalgPBKDF2(password, salt []byte, iterations, keySize int, hashAlgo string, hashSize int) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("AF_ALG HMAC needs a non-empty key")
+	}
+	tfm, op, err := afalgOpen("hash", "hmac("+hashAlgo+")", password)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = unix.Close(op)
+		_ = unix.Close(tfm)
+	}()
+
+	prf := func(out, in []byte) error {
+		if _, err := unix.Write(op, in); err != nil {
+			return fmt.Errorf("AF_ALG hmac(%s): %w", hashAlgo, err)
+		}
+		n, err := unix.Read(op, out)
+		if err != nil {
+			return fmt.Errorf("AF_ALG hmac(%s): %w", hashAlgo, err)
+		}
+		if n != len(out) {
+			return fmt.Errorf("AF_ALG hmac(%s): short digest of %d bytes", hashAlgo, n)
+		}
+		return nil
+	}
+
+	key := make([]byte, 0, (keySize+hashSize-1)/hashSize*hashSize)
+	u := make([]byte, hashSize)
+	t := make([]byte, hashSize)
+	block := make([]byte, len(salt)+4)
+	copy(block, salt)
+	defer clearBytes(u)
+	defer clearBytes(t)
+
+	for i := uint32(1); len(key) < keySize; i++ {
+		binary.BigEndian.PutUint32(block[len(salt):], i)
+		if err := prf(u, block); err != nil {
+			clearBytes(key)
+			return nil, err
+		}
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			if err := prf(u, u); err != nil {
+				clearBytes(key)
+				return nil, err
+			}
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	clearBytes(key[keySize:])
+	return key[:keySize], nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/sys/unix"
+)
+
+func TestAlgControl(t *testing.T) {
+	b := algControl(unix.ALG_OP_ENCRYPT, xtsIVSize)
+	binary.LittleEndian.PutUint64(b[len(b)-xtsIVSize:], 0x0102)
+
+	msgs, err := unix.ParseSocketControlMessage(b)
+	if err != nil {
+		t.Fatalf("ParseSocketControlMessage failed: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 control messages, got %d", len(msgs))
+	}
+	if h := msgs[0].Header; h.Level != unix.SOL_ALG || h.Type != unix.ALG_SET_OP ||
+		binary.NativeEndian.Uint32(msgs[0].Data) != unix.ALG_OP_ENCRYPT {
+		t.Errorf("Unexpected operation message: %+v", msgs[0])
+	}
+	iv := msgs[1].Data
+	if h := msgs[1].Header; h.Level != unix.SOL_ALG || h.Type != unix.ALG_SET_IV || len(iv) != 4+xtsIVSize {
+		t.Fatalf("Unexpected IV message: %+v", msgs[1])
+	}
+	if binary.NativeEndian.Uint32(iv) != xtsIVSize || !bytes.Equal(iv[4:6], []byte{0x02, 0x01}) {
+		t.Errorf("IV = %x", iv)
+	}
+}
+
+// TestAFALGPBKDF2 compares the AF_ALG PBKDF2 with Go's, for key sizes
+// below and above the digest size
+func TestAFALGPBKDF2(t *testing.T) {
+	if _, err := afalgAvailable("hash", "hmac(sha256)"); err != nil {
+		t.Skipf("AF_ALG not available: %v", err)
+	}
+
+	password, salt := []byte("passphrase"), []byte("salt")
+	for _, tt := range []struct {
+		hash     string
+		hashSize int
+		keySize  int
+		want     []byte
+	}{
+		{"sha1", sha1.Size, 16, pbkdf2.Key(password, salt, 100, 16, sha1.New)},
+		{"sha512", sha512.Size, 100, pbkdf2.Key(password, salt, 100, 100, sha512.New)},
+	} {
+		got, err := afalgPBKDF2(password, salt, 100, tt.keySize, tt.hash, tt.hashSize)
+		if err != nil {
+			t.Fatalf("afalgPBKDF2(%s) failed: %v", tt.hash, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("afalgPBKDF2(%s) = %x, want %x", tt.hash, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Allocation selects how the blocks of a new image file are reserved
+type Allocation int
+
+const (
+	// AllocateSparse only sets the file size. Blocks are allocated as they
+	// are written, so the file starts out using almost no disk space and a
+	// full filesystem surfaces later as write errors inside the volume.
+	AllocateSparse Allocation = iota
+
+	// AllocatePreallocate reserves every block up front with fallocate, or by
+	// writing zeros on filesystems without fallocate support
+	AllocatePreallocate
+)
+
+// String returns the allocation name used by the CLI
+func (a Allocation) String() string {
+	switch a {
+	case AllocateSparse:
+		return "sparse"
+	case AllocatePreallocate:
+		return "preallocated"
+	}
+	return fmt.Sprintf("Allocation(%d)", int(a))
+}
+
+// AllocateFile sizes an image file to size bytes using the given allocation.
+// Any existing contents past size are discarded.
+func AllocateFile(f *os.File, size int64, alloc Allocation) error {
+	if size <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidSize, size)
+	}
+
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to size %s: %w", f.Name(), err)
+	}
+
+	switch alloc {
+	case AllocateSparse:
+		return nil
+	case AllocatePreallocate:
+		err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size) // #nosec G115 - fd fits in int
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			// tmpfs on old kernels, NFSv3 and friends cannot fallocate
+			return fillZeros(f, size)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to preallocate %s: %w", f.Name(), err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown allocation %d", int(alloc))
+}
+
+// fillZeros allocates a file by writing zeros over its first size bytes
+func fillZeros(f *os.File, size int64) error {
+	buf := make([]byte, min(size, int64(DefaultWipeBufferSize)))
+	for offset := int64(0); offset < size; {
+		n, err := f.WriteAt(buf[:min(int64(len(buf)), size-offset)], offset)
+		if err != nil {
+			return fmt.Errorf("failed to preallocate %s: %w", f.Name(), err)
+		}
+		offset += int64(n)
+	}
+	return f.Sync()
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAllocateFile tests sparse and preallocated image files
+func TestAllocateFile(t *testing.T) {
+	const size = 8 * mib
+
+	tests := []struct {
+		alloc Allocation
+		full  bool
+	}{
+		{AllocateSparse, false},
+		{AllocatePreallocate, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alloc.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "volume.luks")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+
+			if err := AllocateFile(f, size, tt.alloc); err != nil {
+				t.Fatalf("AllocateFile failed: %v", err)
+			}
+
+			desc, err := DescribeDevice(path)
+			if err != nil {
+				t.Fatalf("DescribeDevice failed: %v", err)
+			}
+			if desc.Size != size {
+				t.Errorf("Size = %d, want %d", desc.Size, size)
+			}
+			if tt.full && desc.AllocatedSize < size {
+				t.Errorf("AllocatedSize = %d, want at least %d", desc.AllocatedSize, size)
+			}
+			if !tt.full && desc.AllocatedSize >= size {
+				t.Errorf("AllocatedSize = %d, want a sparse file", desc.AllocatedSize)
+			}
+		})
+	}
+}
+
+// TestAllocateFile_Errors tests invalid sizes and allocations
+func TestAllocateFile_Errors(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "volume.luks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := AllocateFile(f, 0, AllocateSparse); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("expected ErrInvalidSize, got %v", err)
+	}
+	if err := AllocateFile(f, mib, Allocation(7)); err == nil {
+		t.Error("expected error for unknown allocation")
+	}
+}
+
+// TestFillZeros tests the fallback for filesystems without fallocate
+func TestFillZeros(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	size := int64(DefaultWipeBufferSize) + 4096
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if err := fillZeros(f, size); err != nil {
+		t.Fatalf("fillZeros failed: %v", err)
+	}
+
+	desc, err := DescribeDevice(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Size != size || desc.AllocatedSize < size {
+		t.Errorf("size %d, allocated %d; want %d fully allocated", desc.Size, desc.AllocatedSize, size)
+	}
+}
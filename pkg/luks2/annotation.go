@@ -0,0 +1,203 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+)
+
+// TokenTypeAnnotation is the token type holding a keyslot annotation
+const TokenTypeAnnotation = "luks2-annotation"
+
+// Annotation field limits, which keep annotations from crowding other
+// tokens out of the JSON area
+const (
+	MaxAnnotationLabelLength       = 64
+	MaxAnnotationOwnerLength       = 128
+	MaxAnnotationDescriptionLength = 512
+)
+
+// KeyslotAnnotation tells administrators which person or system a keyslot
+// belongs to. It is stored in a token linked to the keyslot and does not
+// affect unlocking; cryptsetup shows it as an unknown token type.
+type KeyslotAnnotation struct {
+	Label       string    // Short name (e.g. "alice-laptop")
+	Owner       string    // Person or system holding the key
+	Description string    // Free-form notes
+	CreatedAt   time.Time // When the key was enrolled (zero = unknown)
+}
+
+// SetKeyslotAnnotation attaches ann to an existing keyslot, replacing any
+// annotation it has. A zero CreatedAt keeps the time already recorded. Only
+// metadata changes, so no passphrase is needed.
+func SetKeyslotAnnotation(device string, keyslot int, ann KeyslotAnnotation) error {
+	// Validate inputs
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if keyslot < 0 || keyslot >= MaxKeyslots {
+		return fmt.Errorf("invalid keyslot: %d (must be 0-%d)", keyslot, MaxKeyslots-1)
+	}
+	if err := validateAnnotation(&ann); err != nil {
+		return err
+	}
+
+	// Acquire exclusive lock
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	slotID := strconv.Itoa(keyslot)
+	if _, exists := metadata.Keyslots[slotID]; !exists {
+		return fmt.Errorf("keyslot %d does not exist", keyslot)
+	}
+
+	if ann.CreatedAt.IsZero() {
+		if _, token := findAnnotation(metadata, slotID); token != nil {
+			ann.CreatedAt = tokenAnnotation(token).CreatedAt
+		}
+	}
+	if err := setAnnotation(metadata, slotID, &ann); err != nil {
+		return err
+	}
+
+	hdr.SequenceID++
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	return nil
+}
+
+// RemoveKeyslotAnnotation removes the annotation of a keyslot. It returns
+// ErrTokenNotFound if the keyslot has none.
+func RemoveKeyslotAnnotation(device string, keyslot int) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if !dropAnnotation(metadata, strconv.Itoa(keyslot)) {
+		return ErrTokenNotFound
+	}
+
+	hdr.SequenceID++
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	return nil
+}
+
+// validateAnnotation checks field lengths and rejects control characters,
+// which would garble or inject escape sequences into terminal listings
+func validateAnnotation(ann *KeyslotAnnotation) error {
+	fields := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"label", ann.Label, MaxAnnotationLabelLength},
+		{"owner", ann.Owner, MaxAnnotationOwnerLength},
+		{"description", ann.Description, MaxAnnotationDescriptionLength},
+	}
+	for _, f := range fields {
+		if len(f.value) > f.max {
+			return fmt.Errorf("annotation %s is longer than %d bytes", f.name, f.max)
+		}
+		for _, r := range f.value {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("annotation %s contains control characters", f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// findAnnotation returns the annotation token of a keyslot and its ID
+func findAnnotation(metadata *LUKS2Metadata, slotID string) (string, *Token) {
+	for _, id := range sortedIDs(metadata.Tokens) {
+		token := metadata.Tokens[id]
+		if token.Type == TokenTypeAnnotation && len(token.Keyslots) == 1 && token.Keyslots[0] == slotID {
+			return id, token
+		}
+	}
+	return "", nil
+}
+
+// setAnnotation stores ann in the annotation token of a keyslot, creating
+// the token in the first free slot if needed
+func setAnnotation(metadata *LUKS2Metadata, slotID string, ann *KeyslotAnnotation) error {
+	token := &Token{
+		Type:                  TokenTypeAnnotation,
+		Keyslots:              []string{slotID},
+		AnnotationLabel:       ann.Label,
+		AnnotationOwner:       ann.Owner,
+		AnnotationDescription: ann.Description,
+	}
+	if !ann.CreatedAt.IsZero() {
+		token.AnnotationCreated = ann.CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	id, existing := findAnnotation(metadata, slotID)
+	if existing == nil {
+		n, err := freeTokenSlot(metadata)
+		if err != nil {
+			return err
+		}
+		id = strconv.Itoa(n)
+	}
+	if metadata.Tokens == nil {
+		metadata.Tokens = make(map[string]*Token)
+	}
+	metadata.Tokens[id] = token
+	return nil
+}
+
+// dropAnnotation removes the annotation token of a keyslot, so that a new
+// key in the same slot does not inherit it. It reports whether there was one.
+func dropAnnotation(metadata *LUKS2Metadata, slotID string) bool {
+	id, token := findAnnotation(metadata, slotID)
+	if token == nil {
+		return false
+	}
+	delete(metadata.Tokens, id)
+	if len(metadata.Tokens) == 0 {
+		metadata.Tokens = nil
+	}
+	return true
+}
+
+// tokenAnnotation decodes an annotation token. An unparsable creation time
+// is reported as unknown.
+func tokenAnnotation(token *Token) *KeyslotAnnotation {
+	ann := &KeyslotAnnotation{
+		Label:       token.AnnotationLabel,
+		Owner:       token.AnnotationOwner,
+		Description: token.AnnotationDescription,
+	}
+	if t, err := time.Parse(time.RFC3339, token.AnnotationCreated); err == nil {
+		ann.CreatedAt = t
+	}
+	return ann
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyslotAnnotation returns the annotation ListKeyslots reports for a slot
+func keyslotAnnotation(t *testing.T, device string, keyslot int) *KeyslotAnnotation {
+	t.Helper()
+	slots, err := ListKeyslots(device)
+	if err != nil {
+		t.Fatalf("ListKeyslots failed: %v", err)
+	}
+	for _, s := range slots {
+		if s.ID == keyslot {
+			return s.Annotation
+		}
+	}
+	t.Fatalf("keyslot %d not listed", keyslot)
+	return nil
+}
+
+func TestSetKeyslotAnnotation(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	if ann := keyslotAnnotation(t, device, 0); ann != nil {
+		t.Fatalf("expected no annotation, got %+v", ann)
+	}
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := SetKeyslotAnnotation(device, 0, KeyslotAnnotation{
+		Label:     "alice-laptop",
+		Owner:     "alice@example.com",
+		CreatedAt: created,
+	}); err != nil {
+		t.Fatalf("SetKeyslotAnnotation failed: %v", err)
+	}
+	ann := keyslotAnnotation(t, device, 0)
+	if ann == nil || ann.Label != "alice-laptop" || ann.Owner != "alice@example.com" || !ann.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected annotation %+v", ann)
+	}
+
+	// Replacing keeps the recorded creation time and a single token
+	if err := SetKeyslotAnnotation(device, 0, KeyslotAnnotation{Label: "alice-desktop", Description: "moved"}); err != nil {
+		t.Fatalf("SetKeyslotAnnotation failed: %v", err)
+	}
+	ann = keyslotAnnotation(t, device, 0)
+	if ann.Label != "alice-desktop" || ann.Owner != "" || ann.Description != "moved" || !ann.CreatedAt.Equal(created) {
+		t.Errorf("unexpected replaced annotation %+v", ann)
+	}
+	if n, err := CountTokens(device); err != nil || n != 1 {
+		t.Errorf("expected 1 token, got %d (%v)", n, err)
+	}
+
+	if err := RemoveKeyslotAnnotation(device, 0); err != nil {
+		t.Fatalf("RemoveKeyslotAnnotation failed: %v", err)
+	}
+	if ann := keyslotAnnotation(t, device, 0); ann != nil {
+		t.Errorf("expected annotation removed, got %+v", ann)
+	}
+	if err := RemoveKeyslotAnnotation(device, 0); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound, got %v", err)
+	}
+}
+
+func TestSetKeyslotAnnotationErrors(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	tests := []struct {
+		name    string
+		device  string
+		keyslot int
+		ann     KeyslotAnnotation
+	}{
+		{"invalid device", "relative/path", 0, KeyslotAnnotation{Label: "x"}},
+		{"keyslot out of range", device, MaxKeyslots, KeyslotAnnotation{Label: "x"}},
+		{"missing keyslot", device, 5, KeyslotAnnotation{Label: "x"}},
+		{"label too long", device, 0, KeyslotAnnotation{Label: strings.Repeat("x", MaxAnnotationLabelLength+1)}},
+		{"control characters", device, 0, KeyslotAnnotation{Owner: "evil\x1b[2J"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetKeyslotAnnotation(tt.device, tt.keyslot, tt.ann); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestAddKeyAnnotation(t *testing.T) {
+	first := []byte("first-password")
+	second := []byte("second-password")
+	device := formatTestVolume(t, first)
+
+	before := time.Now().Add(-time.Second)
+	if err := AddKey(device, first, second, &AddKeyOptions{
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		Annotation:    &KeyslotAnnotation{Label: "backup-server", Owner: "ops"},
+	}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	ann := keyslotAnnotation(t, device, 1)
+	if ann == nil || ann.Label != "backup-server" || ann.Owner != "ops" {
+		t.Fatalf("unexpected annotation %+v", ann)
+	}
+	if ann.CreatedAt.Before(before) || ann.CreatedAt.After(time.Now()) {
+		t.Errorf("expected creation time to be now, got %v", ann.CreatedAt)
+	}
+
+	// Removing the keyslot drops its annotation, so a key added later in
+	// the same slot does not inherit it
+	if err := RemoveKey(device, second, 1); err != nil {
+		t.Fatalf("RemoveKey failed: %v", err)
+	}
+	if n, err := CountTokens(device); err != nil || n != 0 {
+		t.Errorf("expected annotation token removed, got %d tokens (%v)", n, err)
+	}
+	if err := AddKey(device, first, second, &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if ann := keyslotAnnotation(t, device, 1); ann != nil {
+		t.Errorf("new keyslot inherited annotation %+v", ann)
+	}
+
+	if err := AddKey(device, first, []byte("third-password"), &AddKeyOptions{
+		Annotation: &KeyslotAnnotation{Label: "bad\nlabel"},
+	}); err == nil {
+		t.Error("expected invalid annotation to be rejected")
+	}
+}
@@ -6,13 +6,29 @@ package luks2
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
-	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
 	"hash"
 )
 
+// afMaterialSize returns the size of a keySize-byte key split into stripes.
+// Both values may come from a foreign header, so they are checked rather
+// than assumed: at least one stripe, and no more key material than the
+// largest keyslots area holds.
+func afMaterialSize(keySize, stripes int) (int, error) {
+	if keySize <= 0 {
+		return 0, fmt.Errorf("invalid key size: %d", keySize)
+	}
+	if stripes < 1 {
+		return 0, fmt.Errorf("%w: %d (must be at least 1)", ErrInvalidAFStripes, stripes)
+	}
+	if stripes > LUKS2MaxKeyslotsSize/keySize {
+		return 0, fmt.Errorf("%w: %d stripes of a %d-byte key exceed the %d-byte keyslots area limit", ErrInvalidAFStripes, stripes, keySize, LUKS2MaxKeyslotsSize)
+	}
+	return keySize * stripes, nil
+}
+
 // AFSplit performs anti-forensic information splitting
 // Splits the input data into stripes using the specified hash algorithm
 // This is the LUKS standard AF splitter (AFSplit)
@@ -21,6 +37,12 @@ func AFSplit(data []byte, stripes int, hashAlgo string) ([]byte, error) {
 		return nil, fmt.Errorf("stripes must be positive")
 	}
 
+	// Calculate the last block using diffusion
+	hashFunc, err := getHashFunc(hashAlgo)
+	if err != nil {
+		return nil, err
+	}
+
 	blockSize := len(data)
 	totalSize := blockSize * stripes
 	result := make([]byte, totalSize)
@@ -31,19 +53,11 @@ func AFSplit(data []byte, stripes int, hashAlgo string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to generate random data: %w", err)
 	}
 
-	// Calculate the last block using diffusion
-	hashFunc, err := getHashFunc(hashAlgo)
-	if err != nil {
-		return nil, err
-	}
-
 	buffer := make([]byte, blockSize)
 	defer clearBytes(buffer)
-	for i := 0; i < stripes-1; i++ {
-		block := result[i*blockSize : (i+1)*blockSize]
-		xorBytes(block, buffer, buffer)
-		diffuse(buffer, hashFunc, blockSize)
-	}
+	d := newAFDiffuser(hashFunc)
+	defer d.wipe()
+	d.chain(buffer, result[:randomSize])
 
 	// XOR with input data to get final block
 	xorBytes(data, buffer, result[randomSize:])
@@ -54,6 +68,9 @@ func AFSplit(data []byte, stripes int, hashAlgo string) ([]byte, error) {
 // AFMerge performs anti-forensic information merging
 // Recovers the original data from the split stripes
 func AFMerge(splitData []byte, stripes int, blockSize int, hashAlgo string) ([]byte, error) {
+	if stripes <= 0 {
+		return nil, fmt.Errorf("stripes must be positive")
+	}
 	if len(splitData) != blockSize*stripes {
 		return nil, fmt.Errorf("invalid split data size")
 	}
@@ -65,11 +82,9 @@ func AFMerge(splitData []byte, stripes int, blockSize int, hashAlgo string) ([]b
 
 	buffer := make([]byte, blockSize)
 	defer clearBytes(buffer)
-	for i := 0; i < stripes-1; i++ {
-		block := splitData[i*blockSize : (i+1)*blockSize]
-		xorBytes(block, buffer, buffer)
-		diffuse(buffer, hashFunc, blockSize)
-	}
+	d := newAFDiffuser(hashFunc)
+	defer d.wipe()
+	d.chain(buffer, splitData[:(stripes-1)*blockSize])
 
 	// XOR with final block to recover data
 	result := make([]byte, blockSize)
@@ -79,61 +94,76 @@ func AFMerge(splitData []byte, stripes int, blockSize int, hashAlgo string) ([]b
 	return result, nil
 }
 
-// diffuse performs diffusion using the hash function
-func diffuse(data []byte, hashFunc func() hash.Hash, blockSize int) {
-	h := hashFunc()
-	digestSize := h.Size()
-	numBlocks := blockSize / digestSize
+// afDiffuser runs the AF diffusion with one hash state and fixed buffers,
+// so splitting and merging allocate nothing per stripe. Each stripe depends
+// on the one before it and a stripe is the size of a key (one or two digest
+// blocks), so the work is not spread across CPU cores.
+type afDiffuser struct {
+	h   hash.Hash
+	iv  [4]byte
+	sum []byte
+}
 
-	result := make([]byte, 0, blockSize)
+// newAFDiffuser returns a diffuser using hashFunc
+func newAFDiffuser(hashFunc func() hash.Hash) *afDiffuser {
+	h := hashFunc()
+	return &afDiffuser{h: h, sum: make([]byte, 0, h.Size())}
+}
 
-	for i := 0; i < numBlocks; i++ {
-		block := data[i*digestSize : (i+1)*digestSize]
-		result = append(result, hashBlock(block, h, i)...)
+// chain folds the stripes into buffer: each stripe is XORed in and the
+// result diffused, as AFSplit and AFMerge require
+func (d *afDiffuser) chain(buffer, stripes []byte) {
+	blockSize := len(buffer)
+	if blockSize == 0 {
+		return
 	}
-
-	// Handle remaining bytes if blockSize isn't a multiple of digestSize
-	if remainder := blockSize % digestSize; remainder != 0 {
-		lastBlock := data[blockSize-remainder:]
-		hashed := hashBlock(lastBlock, h, numBlocks)
-		result = append(result, hashed[:remainder]...)
+	for off := 0; off+blockSize <= len(stripes); off += blockSize {
+		xorBytes(stripes[off:off+blockSize], buffer, buffer)
+		d.diffuse(buffer)
 	}
+}
 
-	copy(data, result)
-	clearBytes(result)
+// diffuse replaces each digest-sized block of data in place with the hash
+// of its index and contents; a short final block takes the leading bytes of
+// its hash
+func (d *afDiffuser) diffuse(data []byte) {
+	digestSize := d.h.Size()
+	for i, off := 0, 0; off < len(data); i, off = i+1, off+digestSize {
+		block := data[off:min(off+digestSize, len(data))]
+		copy(block, d.hashBlock(i, block))
+	}
 }
 
-// hashBlock hashes a block with an IV
-func hashBlock(block []byte, h hash.Hash, iv int) []byte {
-	h.Reset()
+// hashBlock hashes a block with an IV. The result is only valid until the
+// next call.
+func (d *afDiffuser) hashBlock(iv int, block []byte) []byte {
+	d.h.Reset()
 
 	// Write IV as big-endian uint32
-	ivBytes := make([]byte, 4)
-	defer clearBytes(ivBytes)
-	binary.BigEndian.PutUint32(ivBytes, uint32(iv)) // #nosec G115 - iv bounded by stripe count (max ~4000)
-	h.Write(ivBytes)
+	binary.BigEndian.PutUint32(d.iv[:], uint32(iv)) // #nosec G115 - iv bounded by block size / digest size
+	d.h.Write(d.iv[:])
 
 	// Write block data
-	h.Write(block)
+	d.h.Write(block)
 
-	return h.Sum(nil)
+	d.sum = d.h.Sum(d.sum[:0])
+	return d.sum
+}
+
+// wipe clears the last digest and IV
+func (d *afDiffuser) wipe() {
+	clearBytes(d.sum[:cap(d.sum)])
+	clearBytes(d.iv[:])
+	d.h.Reset()
 }
 
 // xorBytes XORs two byte slices into dest
 func xorBytes(a, b, dest []byte) {
-	for i := range dest {
-		dest[i] = a[i] ^ b[i]
-	}
+	subtle.XORBytes(dest, a[:len(dest)], b[:len(dest)])
 }
 
-// getHashFunc returns a hash function by name
+// getHashFunc returns the AF hash function af.hash names. Keyslots
+// converted from LUKS1 commonly use sha1, so the set is that of PBKDF2.
 func getHashFunc(name string) (func() hash.Hash, error) {
-	switch name {
-	case "sha256":
-		return sha256.New, nil
-	case "sha512":
-		return sha512.New, nil
-	default:
-		return nil, fmt.Errorf("unsupported hash algorithm: %s", name)
-	}
+	return getPBKDF2HashFunc(name)
 }
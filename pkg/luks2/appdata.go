@@ -0,0 +1,410 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidAppName indicates an application name that cannot be used as a
+// directory and device-mapper name component
+var ErrInvalidAppName = errors.New("invalid application name")
+
+const (
+	// DefaultAppDataSize is the initial size of a new app data container
+	DefaultAppDataSize = 64 * 1024 * 1024 // 64MB
+
+	// DefaultAppDataGrowThreshold is the free space fraction below which an
+	// app data container is grown on open
+	DefaultAppDataGrowThreshold = 0.10
+
+	// appDataContainerName is the container file inside the app directory
+	appDataContainerName = "data.luks"
+
+	// appDataMountName is the mount point directory inside the app directory
+	appDataMountName = "data"
+)
+
+// appNamePattern restricts app names to safe path and dm-name characters
+var appNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// AppDataOptions configures OpenAppData
+type AppDataOptions struct {
+	AppName       string           // Application name, e.g. "org.example.Notes"
+	Credentials   CredentialSource // Passphrase sources (key file, agent, prompt, ...)
+	DataHome      string           // Base directory (default: $XDG_DATA_HOME or ~/.local/share)
+	Size          int64            // Initial container size in bytes (default: 64MB)
+	MaxSize       int64            // Auto-grow limit in bytes (0 = never grow automatically)
+	GrowThreshold float64          // Grow when the free fraction drops below this (default: 0.10)
+	FSType        FilesystemType   // Filesystem for new containers (default: ext4)
+	Format        *FormatOptions   // Cipher/KDF settings for new containers; Device and Passphrase are ignored
+}
+
+// AppData is an open, mounted per-application encrypted data directory
+type AppData struct {
+	AppName       string // Application name
+	ContainerPath string // LUKS2 container file
+	MountPoint    string // Directory the decrypted filesystem is mounted on
+	LoopDevice    string // Loop device backing the container
+	MapperName    string // Device-mapper name of the unlocked volume
+
+	fstype FilesystemType
+	opts   AppDataOptions
+}
+
+// AppDataPaths returns the container file and mount point used for appName
+// under dataHome (empty = $XDG_DATA_HOME, falling back to ~/.local/share)
+func AppDataPaths(appName, dataHome string) (container, mountPoint string, err error) {
+	if !appNamePattern.MatchString(appName) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidAppName, appName)
+	}
+
+	if dataHome == "" {
+		dataHome, err = xdgDataHome()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	dir := filepath.Join(dataHome, appName)
+	return filepath.Join(dir, appDataContainerName), filepath.Join(dir, appDataMountName), nil
+}
+
+// xdgDataHome resolves $XDG_DATA_HOME per the XDG base directory spec:
+// relative values are ignored and the default is ~/.local/share
+func xdgDataHome() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine data home: %w", err)
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+// appDataMapperName returns the device-mapper name for an app container.
+// The uid keeps containers of different users with the same app apart.
+func appDataMapperName(appName string) string {
+	return fmt.Sprintf("appdata-%d-%s", os.Getuid(), appName)
+}
+
+// OpenAppData opens the encrypted data directory for an application,
+// creating it on first use. The container is a LUKS2 file under
+// $XDG_DATA_HOME/<app>/ that is attached to a loop device, unlocked with
+// the first credential in opts.Credentials that opens a keyslot and mounted
+// on $XDG_DATA_HOME/<app>/data. A new container is formatted with the first
+// passphrase the credential sources provide.
+//
+// When MaxSize is set and the filesystem's free space has dropped below
+// GrowThreshold, the container is doubled in size (up to MaxSize) before
+// OpenAppData returns. On failure everything set up by this call is undone.
+func OpenAppData(ctx context.Context, opts AppDataOptions) (*AppData, error) {
+	container, mountPoint, err := AppDataPaths(opts.AppName, opts.DataHome)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Size == 0 {
+		opts.Size = DefaultAppDataSize
+	}
+	if opts.GrowThreshold == 0 {
+		opts.GrowThreshold = DefaultAppDataGrowThreshold
+	}
+	if opts.FSType == "" {
+		opts.FSType = FilesystemExt4
+	}
+	if opts.Size < 0 || (opts.MaxSize > 0 && opts.MaxSize < opts.Size) {
+		return nil, fmt.Errorf("%w: size %d, max size %d", ErrInvalidSize, opts.Size, opts.MaxSize)
+	}
+
+	if mounted, err := IsMounted(mountPoint); err == nil && mounted {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyMounted, mountPoint)
+	}
+
+	if err := os.MkdirAll(mountPoint, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", mountPoint, err)
+	}
+
+	a := &AppData{
+		AppName:       opts.AppName,
+		ContainerPath: container,
+		MountPoint:    mountPoint,
+		MapperName:    appDataMapperName(opts.AppName),
+		fstype:        opts.FSType,
+		opts:          opts,
+	}
+
+	created := false
+	if _, err := os.Stat(container); os.IsNotExist(err) {
+		if err := a.create(ctx); err != nil {
+			_ = os.Remove(container)
+			return nil, err
+		}
+		created = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", container, err)
+	}
+
+	if err := a.open(ctx); err != nil {
+		if created {
+			_ = os.Remove(container)
+		}
+		return nil, err
+	}
+
+	if opts.MaxSize > 0 {
+		if err := a.autoGrow(ctx); err != nil {
+			_ = a.Close()
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// create formats a new container file with a fresh filesystem
+func (a *AppData) create(ctx context.Context) error {
+	f, err := os.OpenFile(a.ContainerPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600) // #nosec G304 -- path built from validated app name
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	err = f.Truncate(a.opts.Size)
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to size container: %w", err)
+	}
+
+	req := CredentialRequest{Device: a.ContainerPath, Label: a.AppName, Name: a.MapperName}
+	pass, err := CredentialChain(credentialSources(a.opts.Credentials)).Passphrase(ctx, req)
+	if err != nil {
+		return fmt.Errorf("no passphrase for new container: %w", err)
+	}
+	defer clearBytes(pass)
+
+	formatOpts := FormatOptions{}
+	if a.opts.Format != nil {
+		formatOpts = *a.opts.Format
+	}
+	formatOpts.Device = a.ContainerPath
+	formatOpts.Passphrase = pass
+	if formatOpts.Label == "" {
+		formatOpts.Label = a.AppName
+	}
+	if err := Format(formatOpts); err != nil {
+		return err
+	}
+
+	if err := a.attach(); err != nil {
+		return err
+	}
+	defer func() { _ = a.detach() }()
+
+	if err := Unlock(a.LoopDevice, pass, a.MapperName); err != nil {
+		return err
+	}
+	defer func() { _ = Lock(a.MapperName) }()
+
+	return MakeFilesystem(a.MapperName, string(a.fstype), a.AppName)
+}
+
+// open attaches, unlocks and mounts an existing container
+func (a *AppData) open(ctx context.Context) error {
+	if err := a.attach(); err != nil {
+		return err
+	}
+
+	if err := a.unlock(ctx); err != nil {
+		_ = a.detach()
+		return err
+	}
+
+	if err := mountMapped(ctx, a.MapperName, a.MountPoint); err != nil {
+		_ = Lock(a.MapperName)
+		_ = a.detach()
+		return err
+	}
+
+	// The mounted filesystem decides the type for later resizes
+	if path, err := GetMappedDevicePath(a.MapperName); err == nil {
+		if fstype, err := DetectFilesystem(path); err == nil {
+			a.fstype = fstype
+		}
+	}
+
+	return nil
+}
+
+// attach finds or creates the loop device for the container
+func (a *AppData) attach() error {
+	if loop, err := FindLoopDevice(a.ContainerPath); err == nil {
+		a.LoopDevice = loop
+		return nil
+	}
+
+	loop, err := SetupLoopDevice(a.ContainerPath)
+	if err != nil {
+		return err
+	}
+	a.LoopDevice = loop
+	return nil
+}
+
+// detach releases the container's loop device
+func (a *AppData) detach() error {
+	if a.LoopDevice == "" {
+		return nil
+	}
+	err := DetachLoopDevice(a.LoopDevice)
+	a.LoopDevice = ""
+	return err
+}
+
+// unlock opens the container with the configured credentials
+func (a *AppData) unlock(ctx context.Context) error {
+	if IsUnlocked(a.MapperName) {
+		return nil
+	}
+
+	req := CredentialRequest{Device: a.LoopDevice, Label: a.AppName, Name: a.MapperName}
+	if id, err := readLUKS2Identity(a.LoopDevice); err == nil {
+		req.UUID = id.UUID
+		req.Label = id.Label
+	}
+	return unlockWithCredentials(ctx, a.LoopDevice, a.MapperName, req, a.opts.Credentials)
+}
+
+// Close unmounts the data directory, locks the volume and detaches the loop
+// device
+func (a *AppData) Close() error {
+	if mounted, err := IsMounted(a.MountPoint); err == nil && mounted {
+		if err := Unmount(a.MountPoint, 0); err != nil {
+			return err
+		}
+	}
+	if IsUnlocked(a.MapperName) {
+		if err := Lock(a.MapperName); err != nil {
+			return err
+		}
+	}
+	return a.detach()
+}
+
+// Usage returns the used and total bytes of the mounted filesystem
+func (a *AppData) Usage() (used, total uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(a.MountPoint, &st); err != nil {
+		return 0, 0, fmt.Errorf("statfs %s failed: %w", a.MountPoint, err)
+	}
+	bsize := uint64(st.Bsize) // #nosec G115 - block size is positive
+	total = st.Blocks * bsize
+	used = total - st.Bavail*bsize
+	return used, total, nil
+}
+
+// autoGrow doubles the container (up to MaxSize) when free space is low
+func (a *AppData) autoGrow(ctx context.Context) error {
+	used, total, err := a.Usage()
+	if err != nil || total == 0 {
+		return err
+	}
+	if float64(total-used)/float64(total) >= a.opts.GrowThreshold {
+		return nil
+	}
+
+	fi, err := os.Stat(a.ContainerPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat container: %w", err)
+	}
+	size := min(fi.Size()*2, a.opts.MaxSize)
+	if size <= fi.Size() {
+		return nil // Already at the limit
+	}
+	return a.Grow(ctx, size)
+}
+
+// Grow enlarges the container to size bytes and resizes the filesystem.
+// The volume is briefly unmounted and locked, then unlocked again with the
+// configured credentials, so the credential sources may be asked again.
+func (a *AppData) Grow(ctx context.Context, size int64) error {
+	if a.fstype != FilesystemExt2 && a.fstype != FilesystemExt3 && a.fstype != FilesystemExt4 && a.fstype != FilesystemXFS {
+		return fmt.Errorf("growing %s filesystems is not supported", a.fstype)
+	}
+
+	fi, err := os.Stat(a.ContainerPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat container: %w", err)
+	}
+	if size <= fi.Size() {
+		return fmt.Errorf("%w: new size %d must exceed current size %d", ErrInvalidSize, size, fi.Size())
+	}
+	if a.opts.MaxSize > 0 && size > a.opts.MaxSize {
+		return fmt.Errorf("%w: new size %d exceeds max size %d", ErrInvalidSize, size, a.opts.MaxSize)
+	}
+
+	if err := Unmount(a.MountPoint, 0); err != nil {
+		return err
+	}
+	if err := Lock(a.MapperName); err != nil {
+		return err
+	}
+
+	if err := os.Truncate(a.ContainerPath, size); err != nil {
+		return fmt.Errorf("failed to extend container: %w", err)
+	}
+	if err := refreshLoopCapacity(a.LoopDevice); err != nil {
+		return err
+	}
+
+	// The crypt segment is dynamic, so the new mapping spans the larger device
+	if err := a.unlock(ctx); err != nil {
+		return err
+	}
+	devicePath, err := waitForMappedDevice(ctx, a.MapperName)
+	if err != nil {
+		return err
+	}
+
+	// ext* is resized offline; XFS can only grow while mounted
+	if a.fstype != FilesystemXFS {
+		// e2fsck exits with 1 when it corrected errors, which is fine here
+		var exitErr *exec.ExitError
+		if err := runResizeCommand("e2fsck", "-f", "-p", devicePath); err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() != 1) {
+			return err
+		}
+		if err := runResizeCommand("resize2fs", devicePath); err != nil {
+			return err
+		}
+	}
+
+	if err := mountMapped(ctx, a.MapperName, a.MountPoint); err != nil {
+		return err
+	}
+
+	if a.fstype == FilesystemXFS {
+		return runResizeCommand("xfs_growfs", a.MountPoint)
+	}
+	return nil
+}
+
+// runResizeCommand runs a filesystem resize tool
+func runResizeCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...) // #nosec G204 -- fixed tool names with internal device paths
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\nOutput: %s", name, err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package luks2
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenAppData tests creating, reopening and growing an app data container
+func TestOpenAppData(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	ctx := context.Background()
+	opts := AppDataOptions{
+		AppName:     "luks2-appdata-test",
+		Credentials: StaticCredential("test-appdata-pass"),
+		DataHome:    t.TempDir(),
+		Size:        32 * 1024 * 1024,
+		MaxSize:     64 * 1024 * 1024,
+		Format:      &FormatOptions{KDFType: "pbkdf2", PBKDFIterTime: 100},
+	}
+
+	app, err := OpenAppData(ctx, opts)
+	if err != nil {
+		t.Fatalf("OpenAppData (create) failed: %v", err)
+	}
+
+	secret := filepath.Join(app.MountPoint, "secret.txt")
+	if err := os.WriteFile(secret, []byte("app data"), 0600); err != nil {
+		_ = app.Close()
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	app, err = OpenAppData(ctx, opts)
+	if err != nil {
+		t.Fatalf("OpenAppData (reopen) failed: %v", err)
+	}
+	defer app.Close()
+
+	data, err := os.ReadFile(secret)
+	if err != nil || string(data) != "app data" {
+		t.Fatalf("Data not preserved: %q, %v", data, err)
+	}
+
+	_, before, err := app.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if err := app.Grow(ctx, 64*1024*1024); err != nil {
+		t.Fatalf("Grow failed: %v", err)
+	}
+	_, after, err := app.Usage()
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if after <= before {
+		t.Errorf("filesystem did not grow: %d -> %d", before, after)
+	}
+
+	if err := app.Grow(ctx, 128*1024*1024); err == nil {
+		t.Error("expected error growing beyond MaxSize")
+	}
+}
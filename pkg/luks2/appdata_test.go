@@ -0,0 +1,79 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppDataPaths(t *testing.T) {
+	container, mountPoint, err := AppDataPaths("org.example.Notes", "/data")
+	if err != nil {
+		t.Fatalf("AppDataPaths failed: %v", err)
+	}
+	if container != "/data/org.example.Notes/data.luks" {
+		t.Errorf("unexpected container path: %s", container)
+	}
+	if mountPoint != "/data/org.example.Notes/data" {
+		t.Errorf("unexpected mount point: %s", mountPoint)
+	}
+}
+
+func TestAppDataPaths_XDG(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	t.Setenv("XDG_DATA_HOME", "/xdg")
+	container, _, err := AppDataPaths("app", "")
+	if err != nil {
+		t.Fatalf("AppDataPaths failed: %v", err)
+	}
+	if container != "/xdg/app/data.luks" {
+		t.Errorf("expected XDG_DATA_HOME to be used, got %s", container)
+	}
+
+	// Relative XDG_DATA_HOME values are ignored per the spec
+	t.Setenv("XDG_DATA_HOME", "relative/dir")
+	container, _, err = AppDataPaths("app", "")
+	if err != nil {
+		t.Fatalf("AppDataPaths failed: %v", err)
+	}
+	if want := filepath.Join(home, ".local", "share", "app", "data.luks"); container != want {
+		t.Errorf("expected %s, got %s", want, container)
+	}
+}
+
+func TestAppDataPaths_InvalidName(t *testing.T) {
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "with space", strings.Repeat("a", 65)} {
+		if _, _, err := AppDataPaths(name, "/data"); !errors.Is(err, ErrInvalidAppName) {
+			t.Errorf("%q: expected ErrInvalidAppName, got %v", name, err)
+		}
+	}
+}
+
+func TestAppDataMapperName(t *testing.T) {
+	name := appDataMapperName("notes")
+	if !strings.HasPrefix(name, "appdata-") || !strings.HasSuffix(name, "-notes") {
+		t.Errorf("unexpected mapper name: %s", name)
+	}
+}
+
+func TestOpenAppData_InvalidSize(t *testing.T) {
+	_, err := OpenAppData(context.Background(), AppDataOptions{
+		AppName:  "app",
+		DataHome: t.TempDir(),
+		Size:     64 * 1024 * 1024,
+		MaxSize:  32 * 1024 * 1024,
+	})
+	if !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("expected ErrInvalidSize, got %v", err)
+	}
+}
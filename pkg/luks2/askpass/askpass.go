@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package askpass obtains passphrases without reading a terminal: from an
+// askpass program named by $LUKS_ASKPASS, in the manner of ssh-askpass and
+// sudo -A, or from systemd-ask-password. The latter hands the question to
+// whichever password agent is running: Plymouth on the boot splash, the
+// console agent, or a desktop agent in a graphical session.
+//
+//	passphrase, err := askpass.Ask(ctx, "Passphrase for /dev/sda2", &askpass.SystemdOptions{
+//	    ID:      "luks2:/dev/sda2",
+//	    KeyName: "cryptsetup",
+//	})
+package askpass
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// EnvVar names the environment variable holding the askpass program
+const EnvVar = "LUKS_ASKPASS"
+
+// DefaultIcon is the icon graphical agents show when none is given
+const DefaultIcon = "drive-harddisk"
+
+// systemdAskPassword is the systemd-ask-password binary. A variable so
+// tests can substitute it.
+var systemdAskPassword = "systemd-ask-password"
+
+// ErrNotAvailable is returned by Ask when neither $LUKS_ASKPASS nor
+// systemd-ask-password is available
+var ErrNotAvailable = errors.New("no askpass program available (set " + EnvVar + " or install systemd-ask-password)")
+
+// ErrCancelled is returned when the user dismisses the question
+var ErrCancelled = errors.New("passphrase entry cancelled")
+
+// SystemdOptions contains optional settings for systemd-ask-password
+type SystemdOptions struct {
+	ID           string        // Identifies the question to agents (e.g. "luks2:/dev/sda2")
+	Icon         string        // Icon for graphical agents ("" = DefaultIcon)
+	KeyName      string        // Kernel keyring name caching the answer; "cryptsetup" shares systemd-cryptsetup's cache
+	AcceptCached bool          // Answer from the KeyName cache without asking, if possible
+	Timeout      time.Duration // How long to wait for an answer (0 = forever)
+}
+
+// Ask asks with the program in $LUKS_ASKPASS if set, otherwise with
+// systemd-ask-password. It returns ErrNotAvailable if neither exists.
+func Ask(ctx context.Context, prompt string, opts *SystemdOptions) ([]byte, error) {
+	if program := os.Getenv(EnvVar); program != "" {
+		return Program(ctx, program, prompt)
+	}
+	if SystemdAvailable() {
+		return Systemd(ctx, prompt, opts)
+	}
+	return nil, ErrNotAvailable
+}
+
+// Program runs an askpass program with prompt as its only argument and
+// returns the first line it prints. A non-zero exit status, which is how
+// dialogs report Cancel, yields ErrCancelled.
+func Program(ctx context.Context, program, prompt string) ([]byte, error) {
+	return run(exec.CommandContext(ctx, program, prompt)) // #nosec G204 -- program configured by the user
+}
+
+// SystemdAvailable reports whether systemd-ask-password is installed
+func SystemdAvailable() bool {
+	_, err := exec.LookPath(systemdAskPassword)
+	return err == nil
+}
+
+// Systemd asks through systemd-ask-password. Its standard input is not a
+// terminal, so the question always goes to the password agents.
+func Systemd(ctx context.Context, prompt string, opts *SystemdOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &SystemdOptions{}
+	}
+	icon := opts.Icon
+	if icon == "" {
+		icon = DefaultIcon
+	}
+
+	args := []string{
+		"--icon=" + icon,
+		"--timeout=" + strconv.FormatInt(int64(opts.Timeout/time.Second), 10),
+	}
+	if opts.ID != "" {
+		args = append(args, "--id="+opts.ID)
+	}
+	if opts.KeyName != "" {
+		args = append(args, "--keyname="+opts.KeyName)
+	}
+	if opts.AcceptCached {
+		args = append(args, "--accept-cached")
+	}
+	// "--" keeps a prompt starting with "-" from being taken as an option
+	args = append(args, "--", prompt)
+
+	return run(exec.CommandContext(ctx, systemdAskPassword, args...)) // #nosec G204 -- fixed binary, arguments built here
+}
+
+// run runs cmd and returns the first line of its output, clearing the rest
+func run(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	defer clear(out)
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+				return nil, fmt.Errorf("%w: %s: %s", ErrCancelled, cmd.Path, msg)
+			}
+			return nil, fmt.Errorf("%w: %s exited with status %d", ErrCancelled, cmd.Path, exitErr.ExitCode())
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", cmd.Path, err)
+	}
+
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return bytes.Clone(line), nil
+}
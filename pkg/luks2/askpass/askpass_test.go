@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package askpass
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript creates an executable shell script
+func writeScript(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil { // #nosec G306 -- test executable
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakeSystemd installs a systemd-ask-password stand-in that logs its
+// arguments and answers "agent-pass"
+func fakeSystemd(t *testing.T) (logPath string) {
+	t.Helper()
+	logPath = filepath.Join(t.TempDir(), "log")
+	tool := writeScript(t, "systemd-ask-password", `for a in "$@"; do echo "$a" >> "`+logPath+`"; done
+echo agent-pass
+`)
+	saved := systemdAskPassword
+	systemdAskPassword = tool
+	t.Cleanup(func() { systemdAskPassword = saved })
+	return logPath
+}
+
+func TestProgram(t *testing.T) {
+	program := writeScript(t, "askpass", `[ "$1" = "Passphrase for data" ] || exit 3
+printf 'helper pass\r\nignored\n'
+`)
+	got, err := Program(context.Background(), program, "Passphrase for data")
+	if err != nil {
+		t.Fatalf("Program failed: %v", err)
+	}
+	if string(got) != "helper pass" {
+		t.Errorf("Program = %q, want %q", got, "helper pass")
+	}
+}
+
+func TestProgram_Cancelled(t *testing.T) {
+	program := writeScript(t, "askpass", "echo 'user pressed cancel' >&2\nexit 1\n")
+	_, err := Program(context.Background(), program, "Passphrase")
+	if !errors.Is(err, ErrCancelled) || !strings.Contains(err.Error(), "user pressed cancel") {
+		t.Errorf("expected ErrCancelled with the helper's message, got %v", err)
+	}
+
+	if _, err := Program(context.Background(), "/nonexistent/askpass", "Passphrase"); err == nil || errors.Is(err, ErrCancelled) {
+		t.Errorf("expected a run error for a missing program, got %v", err)
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	logPath := fakeSystemd(t)
+
+	got, err := Systemd(context.Background(), "-Passphrase for /dev/sda2", &SystemdOptions{
+		ID:           "luks2:/dev/sda2",
+		KeyName:      "cryptsetup",
+		AcceptCached: true,
+		Timeout:      90 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Systemd failed: %v", err)
+	}
+	if string(got) != "agent-pass" {
+		t.Errorf("Systemd = %q, want %q", got, "agent-pass")
+	}
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--icon=drive-harddisk\n--timeout=90\n--id=luks2:/dev/sda2\n--keyname=cryptsetup\n--accept-cached\n--\n-Passphrase for /dev/sda2\n"
+	if string(log) != want {
+		t.Errorf("arguments:\n%s\nwant:\n%s", log, want)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	fakeSystemd(t)
+	t.Setenv(EnvVar, "")
+	if got, err := Ask(context.Background(), "Passphrase", nil); err != nil || string(got) != "agent-pass" {
+		t.Errorf("Ask without %s = %q, %v; want systemd-ask-password's answer", EnvVar, got, err)
+	}
+
+	// The askpass program takes precedence
+	t.Setenv(EnvVar, writeScript(t, "askpass", "echo helper-pass\n"))
+	if got, err := Ask(context.Background(), "Passphrase", nil); err != nil || string(got) != "helper-pass" {
+		t.Errorf("Ask with %s = %q, %v; want the helper's answer", EnvVar, got, err)
+	}
+
+	t.Setenv(EnvVar, "")
+	systemdAskPassword = "/nonexistent/systemd-ask-password"
+	if _, err := Ask(context.Background(), "Passphrase", nil); !errors.Is(err, ErrNotAvailable) {
+		t.Errorf("expected ErrNotAvailable, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JSONFileSink appends one JSON object per event to a file. The file is
+// opened in append mode and synced after every event so records survive a
+// crash; rotate it with copytruncate or by reopening.
+type JSONFileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONFileSink opens (or creates with mode 0600) an append-only audit log
+func NewJSONFileSink(path string) (*JSONFileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600) // #nosec G304 -- audit log path chosen by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &JSONFileSink{f: f}, nil
+}
+
+// Emit appends e as a single JSON line
+func (s *JSONFileSink) Emit(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	// One write per record keeps lines intact when several processes share the log
+	if _, err := s.f.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return s.f.Sync()
+}
+
+// Close closes the audit log
+func (s *JSONFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// syslogWriter is the subset of *syslog.Writer used by SyslogSink
+type syslogWriter interface {
+	Notice(msg string) error
+	Warning(msg string) error
+	Close() error
+}
+
+// SyslogSink sends events to the local syslog daemon on the authpriv
+// facility, as JSON so they can be parsed downstream. Failures are logged at
+// warning severity, everything else at notice.
+type SyslogSink struct {
+	w syslogWriter
+}
+
+// NewSyslogSink connects to the local syslog daemon. tag defaults to the
+// program name when empty.
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Emit logs e
+func (s *SyslogSink) Emit(e Event) error {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.Type == EventUnlockFailed || e.Error != "" {
+		return s.w.Warning(string(msg))
+	}
+	return s.w.Notice(string(msg))
+}
+
+// Close disconnects from syslog
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
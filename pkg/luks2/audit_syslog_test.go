@@ -0,0 +1,42 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeSyslog records messages by severity
+type fakeSyslog struct {
+	notices  []string
+	warnings []string
+}
+
+func (f *fakeSyslog) Notice(msg string) error  { f.notices = append(f.notices, msg); return nil }
+func (f *fakeSyslog) Warning(msg string) error { f.warnings = append(f.warnings, msg); return nil }
+func (f *fakeSyslog) Close() error             { return nil }
+
+// TestSyslogSink_Severity tests that failures are logged at warning severity
+func TestSyslogSink_Severity(t *testing.T) {
+	w := &fakeSyslog{}
+	sink := &SyslogSink{w: w}
+
+	if err := sink.Emit(Event{Type: EventUnlockSucceeded, Op: "unlock", Name: "data"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Emit(Event{Type: EventUnlockFailed, Op: "unlock", Name: "data", Error: "incorrect passphrase"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w.notices) != 1 || !strings.Contains(w.notices[0], `"type":"unlock-succeeded"`) {
+		t.Errorf("notices = %v", w.notices)
+	}
+	if len(w.warnings) != 1 || !strings.Contains(w.warnings[0], `"error":"incorrect passphrase"`) {
+		t.Errorf("warnings = %v", w.warnings)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestJSONFileSink tests that events are appended as JSON lines across reopens
+func TestJSONFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	slot := 2
+
+	for _, e := range []Event{
+		{Type: EventKeyslotAdded, Op: "addkey", Device: "/dev/sdb", Keyslot: &slot, Time: time.Now()},
+		{Type: EventUnlockFailed, Op: "unlock", Device: "/dev/sdb", Name: "data", Error: "incorrect passphrase", Time: time.Now()},
+	} {
+		sink, err := NewJSONFileSink(path)
+		if err != nil {
+			t.Fatalf("NewJSONFileSink failed: %v", err)
+		}
+		if err := sink.Emit(e); err != nil {
+			t.Fatalf("Emit failed: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	f, err := os.Open(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != EventKeyslotAdded || events[0].Keyslot == nil || *events[0].Keyslot != 2 {
+		t.Errorf("Unexpected first event: %+v", events[0])
+	}
+	if events[1].Type != EventUnlockFailed || events[1].Name != "data" || events[1].Keyslot != nil {
+		t.Errorf("Unexpected second event: %+v", events[1])
+	}
+}
+
+// TestJSONFileSink_Closed tests that emitting to a closed sink fails
+func TestJSONFileSink_Closed(t *testing.T) {
+	sink, err := NewJSONFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Close()
+
+	if err := sink.Emit(Event{Type: EventWipeCompleted}); err == nil {
+		t.Error("Expected error after Close")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Second Close should be a no-op: %v", err)
+	}
+}
+
+// TestNewJSONFileSink_BadPath tests the error for an unwritable path
+func TestNewJSONFileSink_BadPath(t *testing.T) {
+	if _, err := NewJSONFileSink(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Error("Expected error for missing directory")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// CryptoBackend selects the implementation of the keyslot area cipher
+// (AES-XTS) and of PBKDF2, which derives digests and PBKDF2 keyslot keys
+type CryptoBackend int
+
+const (
+	// CryptoBackendGo uses Go's crypto packages (the default)
+	CryptoBackendGo CryptoBackend = iota
+
+	// CryptoBackendAFALG uses the kernel crypto API through AF_ALG sockets,
+	// so the drivers of hardware accelerators (CAAM, CESA, QAT, ...) do the
+	// work on platforms where Go's AES is slow. Each sector and each PBKDF2
+	// iteration costs a system call, so it only pays off with such
+	// hardware. Where AF_ALG or an algorithm is missing, Go's
+	// implementation is used and WarnCryptoBackend is emitted.
+	CryptoBackendAFALG
+)
+
+func (b CryptoBackend) String() string {
+	switch b {
+	case CryptoBackendGo:
+		return "go"
+	case CryptoBackendAFALG:
+		return "afalg"
+	default:
+		return fmt.Sprintf("CryptoBackend(%d)", int(b))
+	}
+}
+
+// cryptoBackend is the backend in use; building with -tags afalg makes
+// CryptoBackendAFALG the default where the kernel offers it
+var (
+	cryptoBackendMu sync.RWMutex
+	cryptoBackend   = CryptoBackendGo
+)
+
+// SetCryptoBackend selects the implementation of keyslot encryption and
+// PBKDF2 for all subsequent operations. PBKDF2 iteration counts are still
+// calibrated with Go's implementation.
+func SetCryptoBackend(b CryptoBackend) {
+	cryptoBackendMu.Lock()
+	defer cryptoBackendMu.Unlock()
+	cryptoBackend = b
+}
+
+func currentCryptoBackend() CryptoBackend {
+	cryptoBackendMu.RLock()
+	defer cryptoBackendMu.RUnlock()
+	return cryptoBackend
+}
+
+// backendFallback reports that the AF_ALG backend could not serve an
+// operation and Go's implementation is used instead
+func backendFallback(op string, err error) {
+	emitWarning(Warning{
+		Code:    WarnCryptoBackend,
+		Op:      op,
+		Message: fmt.Sprintf("AF_ALG crypto backend unavailable, using Go: %v", err),
+	})
+}
+
+// sectorCipher encrypts and decrypts keyslot material one sector at a time
+type sectorCipher interface {
+	Encrypt(dst, src []byte, sector uint64) error
+	Decrypt(dst, src []byte, sector uint64) error
+	Close() error
+}
+
+// newSectorCipher returns an AES-XTS cipher for key on the selected backend.
+// key holds both XTS keys: 32 bytes for AES-128, 64 for AES-256.
+func newSectorCipher(key []byte) (sectorCipher, error) {
+	if currentCryptoBackend() == CryptoBackendAFALG {
+		c, err := newAFALGXTS(key)
+		if err == nil {
+			return c, nil
+		}
+		backendFallback("keyslot", err)
+	}
+
+	c, err := newXTSCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create XTS cipher: %w", err)
+	}
+	return goXTS{c}, nil
+}
+
+// goXTS adapts the userspace XTS implementation to sectorCipher
+type goXTS struct {
+	c *xtsCipher
+}
+
+func (g goXTS) Encrypt(dst, src []byte, sector uint64) error {
+	g.c.Encrypt(dst, src, sector)
+	return nil
+}
+
+func (g goXTS) Decrypt(dst, src []byte, sector uint64) error {
+	g.c.Decrypt(dst, src, sector)
+	return nil
+}
+
+func (g goXTS) Close() error {
+	g.c.Clear()
+	return nil
+}
+
+// pbkdf2Key runs PBKDF2 with HMAC over hashAlgo on the selected backend
+func pbkdf2Key(password, salt []byte, iterations, keySize int, hashAlgo string) ([]byte, error) {
+	hashFunc, err := getPBKDF2HashFunc(hashAlgo)
+	if err != nil {
+		return nil, err
+	}
+
+	if currentCryptoBackend() == CryptoBackendAFALG {
+		key, err := afalgPBKDF2(password, salt, iterations, keySize, strings.ToLower(hashAlgo), hashFunc().Size())
+		if err == nil {
+			return key, nil
+		}
+		backendFallback("pbkdf2", err)
+	}
+	return pbkdf2.Key(password, salt, iterations, keySize, hashFunc), nil
+}
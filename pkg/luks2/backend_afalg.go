@@ -0,0 +1,17 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build afalg && linux
+
+package luks2
+
+// Built with -tags afalg, keyslot encryption and PBKDF2 run on the kernel
+// crypto API unless SetCryptoBackend says otherwise. A kernel without
+// AF_ALG or xts(aes) keeps the Go backend rather than warning on every
+// operation.
+func init() {
+	if ok, err := afalgAvailable("skcipher", "xts(aes)"); ok && err == nil {
+		cryptoBackend = CryptoBackendAFALG
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// withCryptoBackend selects b for the duration of the test and collects the
+// warnings emitted meanwhile
+func withCryptoBackend(t *testing.T, b CryptoBackend) *[]Warning {
+	t.Helper()
+	saved := currentCryptoBackend()
+	SetCryptoBackend(b)
+	var warnings []Warning
+	SetWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	SetWarningInterval(0)
+	t.Cleanup(func() {
+		SetCryptoBackend(saved)
+		SetWarningHandler(nil)
+		SetWarningInterval(DefaultWarningInterval)
+	})
+	return &warnings
+}
+
+func TestCryptoBackend_String(t *testing.T) {
+	if CryptoBackendGo.String() != "go" || CryptoBackendAFALG.String() != "afalg" || CryptoBackend(7).String() != "CryptoBackend(7)" {
+		t.Error("Unexpected backend names")
+	}
+}
+
+func TestCryptoBackend_KeyMaterial(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42, 0x17}, 32)
+	data := make([]byte, 4000*32+100) // Partial last sector
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	withCryptoBackend(t, CryptoBackendGo)
+	want, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
+	if err != nil {
+		t.Fatalf("encryptKeyMaterial failed: %v", err)
+	}
+
+	warnings := withCryptoBackend(t, CryptoBackendAFALG)
+	got, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
+	if err != nil {
+		t.Fatalf("encryptKeyMaterial with AF_ALG failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("AF_ALG ciphertext differs from Go's")
+	}
+	plain, err := decryptKeyMaterial(got, key, "aes-xts-plain64", 512)
+	if err != nil {
+		t.Fatalf("decryptKeyMaterial with AF_ALG failed: %v", err)
+	}
+	if !bytes.Equal(plain[:len(data)-100], data[:len(data)-100]) {
+		t.Error("Round trip does not restore the data")
+	}
+
+	// Where AF_ALG is missing every operation falls back, with a warning
+	for _, w := range *warnings {
+		if w.Code != WarnCryptoBackend {
+			t.Errorf("Unexpected warning: %+v", w)
+		}
+	}
+}
+
+func TestCryptoBackend_PBKDF2(t *testing.T) {
+	password := []byte("correct horse battery staple")
+	salt := []byte("0123456789abcdef0123456789abcdef")
+	want := pbkdf2.Key(password, salt, 1000, 64, sha256.New)
+
+	withCryptoBackend(t, CryptoBackendAFALG)
+	got, err := pbkdf2Key(password, salt, 1000, 64, "SHA256")
+	if err != nil {
+		t.Fatalf("pbkdf2Key failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pbkdf2Key = %x, want %x", got, want)
+	}
+
+	if _, err := pbkdf2Key(password, salt, 1000, 64, "md5"); err == nil {
+		t.Error("Expected error for an unsupported hash")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2 auto-tuning limits (same bounds cryptsetup uses)
+const (
+	// DefaultArgon2IterTime is the default target unlock time in ms
+	DefaultArgon2IterTime = 2000
+
+	// Argon2MinTime is the minimum Argon2 time cost
+	Argon2MinTime = 4
+
+	// Argon2MinMemory is the minimum Argon2 memory cost in KB
+	Argon2MinMemory = 32 * 1024 // 32MB
+
+	// Argon2MaxMemory is the default Argon2 memory ceiling in KB
+	Argon2MaxMemory = 1024 * 1024 // 1GB
+
+	// Argon2MaxParallel is the default maximum Argon2 parallelism
+	Argon2MaxParallel = 4
+)
+
+// Argon2Params are calibrated Argon2 cost parameters
+type Argon2Params struct {
+	Time     int           // Time cost (iterations)
+	Memory   int           // Memory cost in KB
+	Parallel int           // Parallelism (lanes)
+	Elapsed  time.Duration // Expected derivation time with these parameters
+}
+
+// BenchmarkArgon2 calibrates Argon2 time and memory costs so a single key
+// derivation takes about targetMs on this machine, like cryptsetup
+// --iter-time. Memory is raised first, up to maxMemoryKB (0 = 1GB) and never
+// beyond half of the currently available RAM; once memory is capped the time
+// cost is raised instead. parallel of 0 uses min(4, NumCPU).
+func BenchmarkArgon2(kdfType string, keySize, targetMs, maxMemoryKB, parallel int) (*Argon2Params, error) {
+	kdfType = normalizeKDFType(kdfType)
+	if kdfType != KDFTypeArgon2i && kdfType != KDFTypeArgon2id {
+		return nil, fmt.Errorf("unsupported Argon2 type: %s (supported: argon2i, argon2id)", kdfType)
+	}
+	if keySize <= 0 {
+		return nil, fmt.Errorf("invalid key size: %d", keySize)
+	}
+	if targetMs <= 0 {
+		targetMs = DefaultArgon2IterTime
+	}
+	if parallel <= 0 {
+		parallel = min(Argon2MaxParallel, runtime.NumCPU())
+	}
+	if parallel > 255 {
+		return nil, fmt.Errorf("argon2 parallelism must be between 1 and 255")
+	}
+
+	ceiling := argon2MemoryCeiling(maxMemoryKB)
+	target := time.Duration(targetMs) * time.Millisecond
+
+	// Probe with the cheapest parameters to estimate cost per KB-iteration
+	probe := measureArgon2(kdfType, keySize, 1, Argon2MinMemory, parallel)
+	perUnit := float64(probe) / float64(Argon2MinMemory)
+
+	// Total (time * memory) work that fits in the target
+	budget := float64(target) / perUnit
+
+	memory := int(budget / Argon2MinTime)
+	memory = max(Argon2MinMemory, min(memory, ceiling))
+	iterations := max(Argon2MinTime, int(budget/float64(memory)))
+
+	// Verify and correct the time cost; memory scaling is not perfectly linear
+	elapsed := measureArgon2(kdfType, keySize, iterations, memory, parallel)
+	if elapsed > 0 {
+		corrected := max(Argon2MinTime, int(float64(iterations)*float64(target)/float64(elapsed)))
+		elapsed = time.Duration(float64(elapsed) * float64(corrected) / float64(iterations))
+		iterations = corrected
+	}
+
+	return &Argon2Params{
+		Time:     iterations,
+		Memory:   memory,
+		Parallel: parallel,
+		Elapsed:  elapsed,
+	}, nil
+}
+
+// argon2MemoryCeiling returns the memory limit in KB for auto-tuning
+func argon2MemoryCeiling(maxMemoryKB int) int {
+	ceiling := maxMemoryKB
+	if ceiling <= 0 {
+		ceiling = Argon2MaxMemory
+	}
+
+	// Never tune beyond half of the memory that is available right now
+	if avail, err := availableMemory(); err == nil {
+		if half := int(avail / 1024 / 2); half < ceiling {
+			ceiling = half
+		}
+	}
+
+	return max(ceiling, Argon2MinMemory)
+}
+
+// measureArgon2 times a single Argon2 derivation
+func measureArgon2(kdfType string, keySize, iterations, memory, parallel int) time.Duration {
+	pass := []byte("benchmark")
+	salt := make([]byte, 32)
+
+	start := time.Now()
+	// #nosec G115 - parameters bounded by BenchmarkArgon2
+	if kdfType == KDFTypeArgon2i {
+		clearBytes(argon2.Key(pass, salt, uint32(iterations), uint32(memory), uint8(parallel), uint32(keySize)))
+	} else {
+		clearBytes(argon2.IDKey(pass, salt, uint32(iterations), uint32(memory), uint8(parallel), uint32(keySize)))
+	}
+	return time.Since(start)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"testing"
+)
+
+func TestBenchmarkArgon2(t *testing.T) {
+	fakeMeminfo(t, "MemAvailable:    8388608 kB\n")
+
+	params, err := BenchmarkArgon2("argon2id", 64, 50, 64*1024, 2)
+	if err != nil {
+		t.Fatalf("BenchmarkArgon2 failed: %v", err)
+	}
+	if params.Time < Argon2MinTime {
+		t.Errorf("time cost %d below minimum %d", params.Time, Argon2MinTime)
+	}
+	if params.Memory < Argon2MinMemory || params.Memory > 64*1024 {
+		t.Errorf("memory cost %d outside [%d, %d]", params.Memory, Argon2MinMemory, 64*1024)
+	}
+	if params.Parallel != 2 {
+		t.Errorf("expected parallel 2, got %d", params.Parallel)
+	}
+}
+
+func TestBenchmarkArgon2_InvalidArgs(t *testing.T) {
+	if _, err := BenchmarkArgon2("pbkdf2", 64, 50, 0, 1); err == nil {
+		t.Error("expected error for non-Argon2 KDF type")
+	}
+	if _, err := BenchmarkArgon2("argon2id", 0, 50, 0, 1); err == nil {
+		t.Error("expected error for zero key size")
+	}
+	if _, err := BenchmarkArgon2("argon2id", 64, 50, 0, 256); err == nil {
+		t.Error("expected error for parallelism above 255")
+	}
+}
+
+func TestArgon2MemoryCeiling(t *testing.T) {
+	// 256MB available: ceiling is half of it
+	fakeMeminfo(t, "MemAvailable:     262144 kB\n")
+	if got := argon2MemoryCeiling(0); got != 131072 {
+		t.Errorf("expected 131072 KB, got %d", got)
+	}
+	if got := argon2MemoryCeiling(65536); got != 65536 {
+		t.Errorf("expected explicit ceiling 65536 KB, got %d", got)
+	}
+
+	// Never below the minimum memory cost
+	fakeMeminfo(t, "MemAvailable:      16384 kB\n")
+	if got := argon2MemoryCeiling(0); got != Argon2MinMemory {
+		t.Errorf("expected minimum %d KB, got %d", Argon2MinMemory, got)
+	}
+
+	// Without meminfo the requested ceiling is used as is
+	fakeMeminfo(t, "MemTotal:        8000000 kB\n")
+	if got := argon2MemoryCeiling(0); got != Argon2MaxMemory {
+		t.Errorf("expected default %d KB, got %d", Argon2MaxMemory, got)
+	}
+}
+
+func TestCreateKDF_Argon2Auto(t *testing.T) {
+	fakeMeminfo(t, "MemAvailable:    8388608 kB\n")
+
+	kdf, err := CreateKDF(FormatOptions{
+		KDFType:        "argon2i",
+		Argon2Auto:     true,
+		Argon2IterTime: 50,
+		Argon2Memory:   32 * 1024,
+		Argon2Parallel: 1,
+	}, 64)
+	if err != nil {
+		t.Fatalf("CreateKDF failed: %v", err)
+	}
+	if kdf.Type != "argon2i" || kdf.Time == nil || kdf.Memory == nil || kdf.CPUs == nil {
+		t.Fatalf("unexpected KDF: %+v", kdf)
+	}
+	if *kdf.Memory != 32*1024 {
+		t.Errorf("expected memory capped at 32768 KB, got %d", *kdf.Memory)
+	}
+	if *kdf.CPUs != 1 {
+		t.Errorf("expected 1 cpu, got %d", *kdf.CPUs)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// BlkidInfo is what blkid reports for a LUKS volume: the ID_FS_* udev
+// properties /dev/disk/by-uuid and /dev/disk/by-label links are made from
+type BlkidInfo struct {
+	Type      string // ID_FS_TYPE, "crypto_LUKS"
+	Usage     string // ID_FS_USAGE, "crypto"
+	Version   string // ID_FS_VERSION, "2"
+	UUID      string // ID_FS_UUID
+	Label     string // ID_FS_LABEL_ENC decoded: the label as in the header
+	LabelEnc  string // ID_FS_LABEL_ENC: the name of the /dev/disk/by-label link
+	Subsystem string // ID_FS_SUBSYSTEM; empty with blkid versions that do not report it
+}
+
+// VerifyBlkidVisibility probes device with blkid, bypassing its cache, and
+// checks that it reports a LUKS2 volume with the UUID, label and subsystem
+// label of the header: what udev rules rely on for the by-uuid and
+// by-label links. A difference fails with ErrBlkidMismatch, along with
+// what blkid reported. Requires the blkid binary.
+func VerifyBlkidVisibility(device string) (*BlkidInfo, error) {
+	hdr, _, err := ReadHeader(device)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("blkid", "-p", "-o", "udev", device) // #nosec G204 -- fixed binary, device path supplied by caller
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("blkid failed: %w", err)
+	}
+	info, reported := parseBlkidUdev(output)
+
+	label := string(bytes.TrimRight(hdr.Label[:], "\x00"))
+	subsystem := string(bytes.TrimRight(hdr.SubsystemLabel[:], "\x00"))
+	var problems []string
+	check := func(field, got, want string) {
+		if got != want {
+			problems = append(problems, fmt.Sprintf("%s is %q, want %q", field, got, want))
+		}
+	}
+	check("TYPE", info.Type, "crypto_LUKS")
+	check("VERSION", info.Version, strconv.Itoa(int(hdr.Version)))
+	check("UUID", info.UUID, headerUUID(hdr))
+	check("LABEL", info.Label, label)
+	if reported["ID_FS_SUBSYSTEM"] || subsystem == "" {
+		check("SUBSYSTEM", info.Subsystem, subsystem)
+	}
+	if len(problems) > 0 {
+		return info, fmt.Errorf("%w: %s: %s", ErrBlkidMismatch, device, strings.Join(problems, "; "))
+	}
+	return info, nil
+}
+
+// parseBlkidUdev parses blkid -o udev output, returning the properties
+// found and which were reported at all
+func parseBlkidUdev(output []byte) (*BlkidInfo, map[string]bool) {
+	info := &BlkidInfo{}
+	reported := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		reported[key] = true
+		switch key {
+		case "ID_FS_TYPE":
+			info.Type = value
+		case "ID_FS_USAGE":
+			info.Usage = value
+		case "ID_FS_VERSION":
+			info.Version = value
+		case "ID_FS_UUID":
+			info.UUID = value
+		case "ID_FS_LABEL_ENC":
+			info.LabelEnc = value
+			info.Label = decodeUdevString(value)
+		case "ID_FS_SUBSYSTEM":
+			info.Subsystem = value
+		}
+	}
+	return info, reported
+}
+
+// decodeUdevString reverses udev's string encoding, which writes unsafe
+// bytes as \xNN
+func decodeUdevString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if n, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package luks2
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestVerifyBlkidVisibility formats a volume and checks blkid reports it
+// with the header's UUID, label and subsystem, also after a relabel
+func TestVerifyBlkidVisibility(t *testing.T) {
+	if _, err := exec.LookPath("blkid"); err != nil {
+		t.Skip("blkid not available")
+	}
+
+	device := filepath.Join(t.TempDir(), "blkid.img")
+	if err := os.WriteFile(device, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(device, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(FormatOptions{
+		Device:        device,
+		Passphrase:    []byte("test-password"),
+		Label:         "My Volume/1",
+		Subsystem:     "backup",
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	info, err := VerifyBlkidVisibility(device)
+	if err != nil {
+		t.Fatalf("VerifyBlkidVisibility failed: %v", err)
+	}
+	uuid, err := GetUUID(device)
+	if err != nil {
+		t.Fatalf("GetUUID failed: %v", err)
+	}
+	if info.Type != "crypto_LUKS" || info.Usage != "crypto" || info.UUID != uuid {
+		t.Errorf("unexpected blkid info: %+v", info)
+	}
+	if info.Label != "My Volume/1" || info.LabelEnc != `My\x20Volume\x2f1` {
+		t.Errorf("label = %q (%q), want the header label", info.Label, info.LabelEnc)
+	}
+
+	if err := SetLabel(device, "relabeled", ""); err != nil {
+		t.Fatalf("SetLabel failed: %v", err)
+	}
+	info, err = VerifyBlkidVisibility(device)
+	if err != nil {
+		t.Fatalf("VerifyBlkidVisibility after SetLabel failed: %v", err)
+	}
+	if info.Label != "relabeled" || info.Subsystem != "" {
+		t.Errorf("unexpected blkid info after SetLabel: %+v", info)
+	}
+}
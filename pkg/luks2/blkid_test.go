@@ -0,0 +1,79 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseBlkidUdev(t *testing.T) {
+	output := []byte(`ID_FS_VERSION=2
+ID_FS_UUID=889900a2-f33a-4c09-9645-ba85c6485b93
+ID_FS_UUID_ENC=889900a2-f33a-4c09-9645-ba85c6485b93
+ID_FS_LABEL=My_Vol$'x"
+ID_FS_LABEL_ENC=My\x20Vol\x24\x27x\x22\x2f
+ID_FS_SUBSYSTEM=sub sys
+ID_FS_TYPE=crypto_LUKS
+ID_FS_USAGE=crypto
+`)
+	info, reported := parseBlkidUdev(output)
+	want := &BlkidInfo{
+		Type:      "crypto_LUKS",
+		Usage:     "crypto",
+		Version:   "2",
+		UUID:      "889900a2-f33a-4c09-9645-ba85c6485b93",
+		Label:     `My Vol$'x"/`,
+		LabelEnc:  `My\x20Vol\x24\x27x\x22\x2f`,
+		Subsystem: "sub sys",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("parseBlkidUdev() = %+v, want %+v", info, want)
+	}
+	if !reported["ID_FS_SUBSYSTEM"] || reported["ID_FS_PART_ENTRY_NAME"] {
+		t.Errorf("unexpected reported properties: %v", reported)
+	}
+
+	for in, want := range map[string]string{`a\x2`: `a\x2`, `\xzz`: `\xzz`, `\\x41`: `\A`} {
+		if got := decodeUdevString(in); got != want {
+			t.Errorf("decodeUdevString(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestFormat_BlkidFields checks the label, UUID and subsystem label land at
+// the offsets of libblkid's struct luks2_phdr in both header copies
+func TestFormat_BlkidFields(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	if err := SetLabel(device, "data", "backup"); err != nil {
+		t.Fatalf("SetLabel failed: %v", err)
+	}
+	hdr, _, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := func(b []byte) string { return string(bytes.TrimRight(b, "\x00")) }
+	for _, off := range []uint64{0, hdr.HeaderSize} {
+		phdr := raw[off:]
+		if got := field(phdr[24:72]); got != "data" {
+			t.Errorf("header at %d: label = %q", off, got)
+		}
+		if got := field(phdr[168:208]); got != headerUUID(hdr) {
+			t.Errorf("header at %d: uuid = %q", off, got)
+		}
+		if got := field(phdr[208:256]); got != "backup" {
+			t.Errorf("header at %d: subsystem = %q", off, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procRoot is the procfs mount (overridable for tests)
+var procRoot = "/proc"
+
+// MountUser is a process keeping a mount point busy
+type MountUser struct {
+	PID     int
+	Command string   // Process name from /proc/<pid>/comm
+	Access  []string // How it uses the mount: "cwd", "root", "exe", "file" and/or "mmap"
+}
+
+// FindMountUsers lists the processes using files below mountPoint, which is
+// what makes Unmount fail with EBUSY. Like lsof +D it scans /proc for working
+// and root directories, executables, open files and memory-mapped files whose
+// path lies under the mount point. Processes that cannot be inspected (other
+// users' processes without root) are skipped. The result is sorted by PID.
+func FindMountUsers(mountPoint string) ([]MountUser, error) {
+	mountPoint, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", procRoot, err)
+	}
+
+	var users []MountUser
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(procRoot, entry.Name())
+
+		access := processAccess(dir, mountPoint)
+		if len(access) == 0 {
+			continue
+		}
+
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm")) // #nosec G304 -- procfs path
+		users = append(users, MountUser{
+			PID:     pid,
+			Command: strings.TrimSpace(string(comm)),
+			Access:  access,
+		})
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].PID < users[j].PID })
+	return users, nil
+}
+
+// processAccess returns how the process at procfs directory dir uses files
+// below mountPoint
+func processAccess(dir, mountPoint string) []string {
+	var access []string
+	for _, link := range []string{"cwd", "root", "exe"} {
+		if target, err := os.Readlink(filepath.Join(dir, link)); err == nil && isBelow(target, mountPoint) {
+			access = append(access, link)
+		}
+	}
+
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name())); err == nil && isBelow(target, mountPoint) {
+				access = append(access, "file")
+				break
+			}
+		}
+	}
+
+	if mappedBelow(filepath.Join(dir, "maps"), mountPoint) {
+		access = append(access, "mmap")
+	}
+
+	return access
+}
+
+// mappedBelow reports whether a /proc/<pid>/maps file lists a file below
+// mountPoint
+func mappedBelow(mapsPath, mountPoint string) bool {
+	f, err := os.Open(mapsPath) // #nosec G304 -- procfs path
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode path
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) == 6 && isBelow(strings.TrimSpace(fields[5]), mountPoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBelow reports whether a path read from procfs is mountPoint or lies
+// below it. The kernel marks unlinked files with a " (deleted)" suffix.
+func isBelow(path, mountPoint string) bool {
+	path = strings.TrimSuffix(path, " (deleted)")
+	if !strings.HasPrefix(path, "/") {
+		// socket:[...], pipe:[...], anon_inode:... and the like
+		return false
+	}
+	if mountPoint == "/" {
+		return true
+	}
+	return path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+}
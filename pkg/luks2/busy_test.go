@@ -0,0 +1,119 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeProcess creates /proc/<pid> under root with the given comm, symlinks
+// (cwd, root, exe, fd/N) and maps contents
+func fakeProcess(t *testing.T, root, pid, comm string, links map[string]string, maps string) {
+	t.Helper()
+	dir := filepath.Join(root, pid)
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "maps"), []byte(maps), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestFindMountUsers tests finding the processes holding a mount point
+func TestFindMountUsers(t *testing.T) {
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = old })
+
+	fakeProcess(t, root, "300", "vim", map[string]string{
+		"cwd":  "/home/user",
+		"root": "/",
+		"exe":  "/usr/bin/vim",
+		"fd/0": "/dev/pts/0",
+		"fd/3": "/mnt/secret/notes.txt",
+		"fd/4": "/mnt/secret/.notes.swp (deleted)",
+	}, "")
+	fakeProcess(t, root, "42", "bash", map[string]string{
+		"cwd":  "/mnt/secret",
+		"root": "/",
+		"exe":  "/usr/bin/bash",
+		"fd/1": "pipe:[1234]",
+	}, "")
+	fakeProcess(t, root, "77", "tool", map[string]string{
+		"cwd":  "/",
+		"root": "/",
+		"exe":  "/mnt/secret/bin/tool",
+	}, "55d0-55d1 r--p 00000000 fd:01 12 /mnt/secret/bin/tool\n7f00-7f01 r-xp 00000000 fd:00 34 /usr/lib/libc.so.6\n")
+	fakeProcess(t, root, "80", "other", map[string]string{
+		"cwd":  "/mnt/secret2",
+		"root": "/",
+		"exe":  "/usr/bin/other",
+		"fd/3": "/mnt/secretive/file",
+	}, "7f00-7f01 r-xp 00000000 fd:00 34 /usr/lib/libc.so.6\n")
+	if err := os.Mkdir(filepath.Join(root, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := FindMountUsers("/mnt/secret/")
+	if err != nil {
+		t.Fatalf("FindMountUsers failed: %v", err)
+	}
+
+	want := []MountUser{
+		{PID: 42, Command: "bash", Access: []string{"cwd"}},
+		{PID: 77, Command: "tool", Access: []string{"exe", "mmap"}},
+		{PID: 300, Command: "vim", Access: []string{"file"}},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("FindMountUsers() = %+v, want %+v", users, want)
+	}
+}
+
+// TestFindMountUsers_NoProc tests the error for an unreadable procfs
+func TestFindMountUsers_NoProc(t *testing.T) {
+	old := procRoot
+	procRoot = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { procRoot = old })
+
+	if _, err := FindMountUsers("/mnt"); err == nil {
+		t.Error("expected error for missing procfs")
+	}
+}
+
+// TestIsBelow tests matching procfs paths against a mount point
+func TestIsBelow(t *testing.T) {
+	tests := []struct {
+		path, mountPoint string
+		want             bool
+	}{
+		{"/mnt/a", "/mnt/a", true},
+		{"/mnt/a/b/c", "/mnt/a", true},
+		{"/mnt/a/gone (deleted)", "/mnt/a", true},
+		{"/mnt/ab", "/mnt/a", false},
+		{"/mnt", "/mnt/a", false},
+		{"socket:[99]", "/mnt/a", false},
+		{"/anything", "/", true},
+		{"[heap]", "/", false},
+	}
+	for _, tt := range tests {
+		if got := isBelow(tt.path, tt.mountPoint); got != tt.want {
+			t.Errorf("isBelow(%q, %q) = %v, want %v", tt.path, tt.mountPoint, got, tt.want)
+		}
+	}
+}
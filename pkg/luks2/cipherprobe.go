@@ -0,0 +1,221 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// procCryptoPath lists the algorithms registered with the kernel crypto API
+var procCryptoPath = "/proc/crypto"
+
+// CommonCiphers are the dm-crypt ciphers ProbeKernelCiphers checks by default
+var CommonCiphers = []string{
+	"aes-xts-plain64",
+	"aes-cbc-essiv:sha256",
+	"serpent-xts-plain64",
+	"twofish-xts-plain64",
+	"camellia-xts-plain64",
+	"sm4-xts-plain64",
+	"xchacha12,aes-adiantum-plain64",
+	"xchacha20,aes-adiantum-plain64",
+}
+
+// KernelCipher reports whether the running kernel can service a dm-crypt
+// cipher
+type KernelCipher struct {
+	Cipher    string // dm-crypt specification, e.g. aes-xts-plain64
+	Algorithm string // Kernel crypto API name, e.g. xts(aes)
+	Hash      string // Hash the IV generator needs (essiv:sha256), if any
+	Loaded    bool   // Algorithm (and hash) listed in /proc/crypto
+	Available bool   // Loaded, or instantiated on request through AF_ALG
+	Driver    string // Preferred implementation listed in /proc/crypto, e.g. xts-aes-aesni
+}
+
+// Suggestion returns what to do about a cipher that is not available
+func (k *KernelCipher) Suggestion() string {
+	if k.Available {
+		return ""
+	}
+	modules := algorithmComponents(k.Algorithm)
+	if k.Hash != "" {
+		modules = append(modules, k.Hash)
+	}
+	return fmt.Sprintf("load its modules (modprobe %s) or use a kernel with them built in", strings.Join(modules, " "))
+}
+
+// CipherProbeOptions configures ProbeKernelCiphers
+type CipherProbeOptions struct {
+	Ciphers []string // dm-crypt specifications to check (nil = CommonCiphers)
+
+	// AFALG asks the kernel through an AF_ALG socket about ciphers that
+	// are not in /proc/crypto, which lists only algorithms already in use.
+	// This loads the modules they need, as dm-crypt would.
+	AFALG bool
+}
+
+// cipherAlgorithm returns the kernel crypto API name of a dm-crypt cipher
+// specification (cipher-chainmode-ivmode[:ivopts] or capi:name-ivmode),
+// its AF_ALG type and the hash its IV generator uses, if any
+func cipherAlgorithm(spec string) (algorithm, algType, hash string, err error) {
+	var iv string
+	if rest, ok := strings.CutPrefix(spec, "capi:"); ok {
+		end := strings.LastIndex(rest, ")")
+		dash := strings.LastIndex(rest, "-")
+		if end < 0 || dash < end {
+			return "", "", "", fmt.Errorf("invalid cipher specification %q", spec)
+		}
+		algorithm, iv = rest[:dash], rest[dash+1:]
+	} else {
+		parts := strings.SplitN(spec, "-", 3)
+		if slices.Contains(parts, "") {
+			return "", "", "", fmt.Errorf("invalid cipher specification %q", spec)
+		}
+		// A bare cipher name is cbc-plain, as in the original dm-crypt
+		chain := "cbc"
+		if len(parts) > 1 {
+			chain = parts[1]
+		}
+		if len(parts) > 2 {
+			iv = parts[2]
+		}
+		algorithm = chain + "(" + parts[0] + ")"
+	}
+
+	algType = "skcipher"
+	if name, _, _ := strings.Cut(algorithm, "("); slices.Contains([]string{"gcm", "ccm", "rfc4106", "rfc4309", "authenc"}, name) {
+		algType = "aead"
+	}
+	if mode, opts, ok := strings.Cut(iv, ":"); ok && mode == "essiv" {
+		hash = opts
+	}
+	return algorithm, algType, hash, nil
+}
+
+// algorithmComponents splits a crypto API name into the templates and
+// ciphers it is built from: xts(aes) is xts and aes
+func algorithmComponents(algorithm string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(algorithm, func(r rune) bool { return r == '(' || r == ')' || r == ',' }) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// cryptoAlg is an entry of /proc/crypto
+type cryptoAlg struct {
+	name     string
+	driver   string
+	algType  string
+	priority int
+	usable   bool // Neither internal nor failing its self-test
+}
+
+// parseProcCrypto reads the entries of /proc/crypto, which are blocks of
+// "key : value" lines separated by blank lines
+func parseProcCrypto(r io.Reader) ([]cryptoAlg, error) {
+	var algs []cryptoAlg
+	cur := cryptoAlg{usable: true}
+	flush := func() {
+		if cur.name != "" {
+			algs = append(algs, cur)
+		}
+		cur = cryptoAlg{usable: true}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			flush()
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "name":
+			flush()
+			cur.name = value
+		case "driver":
+			cur.driver = value
+		case "type":
+			cur.algType = value
+		case "priority":
+			cur.priority, _ = strconv.Atoi(value)
+		case "internal":
+			cur.usable = cur.usable && value != "yes"
+		case "selftest":
+			cur.usable = cur.usable && value != "failed"
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", procCryptoPath, err)
+	}
+	return algs, nil
+}
+
+// procCryptoTypes are the /proc/crypto types that can serve each AF_ALG
+// type; older kernels list ciphers as blkcipher or ablkcipher
+var procCryptoTypes = map[string][]string{
+	"skcipher": {"skcipher", "lskcipher", "blkcipher", "ablkcipher", "givcipher"},
+	"aead":     {"aead", "nivaead"},
+	"hash":     {"shash", "ahash"},
+}
+
+// findAlgorithm returns the preferred usable implementation of name
+func findAlgorithm(algs []cryptoAlg, name, algType string) *cryptoAlg {
+	var best *cryptoAlg
+	for i := range algs {
+		a := &algs[i]
+		if a.name != name || !a.usable || !slices.Contains(procCryptoTypes[algType], a.algType) {
+			continue
+		}
+		if best == nil || a.priority > best.priority {
+			best = a
+		}
+	}
+	return best
+}
+
+// probeCipher checks a dm-crypt cipher against the /proc/crypto entries
+// and, for what is not listed, against ask (nil = do not ask). ask reports
+// whether the kernel can instantiate an algorithm of an AF_ALG type.
+func probeCipher(spec string, algs []cryptoAlg, ask func(algType, name string) (bool, error)) (*KernelCipher, error) {
+	algorithm, algType, hash, err := cipherAlgorithm(spec)
+	if err != nil {
+		return nil, err
+	}
+	k := &KernelCipher{Cipher: spec, Algorithm: algorithm, Hash: hash}
+
+	cipherOK, hashOK := false, hash == ""
+	if a := findAlgorithm(algs, algorithm, algType); a != nil {
+		cipherOK = true
+		k.Driver = a.driver
+	}
+	if !hashOK {
+		hashOK = findAlgorithm(algs, hash, "hash") != nil
+	}
+	k.Loaded = cipherOK && hashOK
+
+	if ask != nil && !cipherOK {
+		if cipherOK, err = ask(algType, algorithm); err != nil {
+			return nil, err
+		}
+	}
+	if ask != nil && !hashOK {
+		if hashOK, err = ask("hash", hash); err != nil {
+			return nil, err
+		}
+	}
+	k.Available = cipherOK && hashOK
+	return k, nil
+}
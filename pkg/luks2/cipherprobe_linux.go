@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+)
+
+// ProbeKernelCiphers reports which dm-crypt ciphers the running kernel can
+// service. Without opts.AFALG only /proc/crypto is consulted, so a cipher
+// whose modules are not loaded yet is reported unavailable even though
+// dm-crypt would load them.
+func ProbeKernelCiphers(opts *CipherProbeOptions) ([]KernelCipher, error) {
+	if opts == nil {
+		opts = &CipherProbeOptions{}
+	}
+	ciphers := opts.Ciphers
+	if ciphers == nil {
+		ciphers = CommonCiphers
+	}
+
+	algs, err := readProcCrypto()
+	if err != nil {
+		return nil, err
+	}
+	var ask func(algType, name string) (bool, error)
+	if opts.AFALG {
+		ask = afalgAvailable
+	}
+
+	result := make([]KernelCipher, 0, len(ciphers))
+	for _, spec := range ciphers {
+		k, err := probeCipher(spec, algs, ask)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *k)
+	}
+	return result, nil
+}
+
+func readProcCrypto() ([]cryptoAlg, error) {
+	f, err := os.Open(procCryptoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel ciphers: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return parseProcCrypto(f)
+}
+
+// checkKernelCipher fails when the kernel cannot service a dm-crypt cipher,
+// so an unlock stops before deriving any key instead of at the table load
+// with EINVAL. It only fails on a definite answer: when neither
+// /proc/crypto nor AF_ALG can tell, dm-crypt decides.
+func checkKernelCipher(spec string) error {
+	algs, err := readProcCrypto()
+	if err != nil {
+		return nil
+	}
+	k, err := probeCipher(spec, algs, afalgAvailable)
+	if err != nil || k.Available {
+		return nil
+	}
+	return fmt.Errorf("%w: the kernel cannot service %s (%s); %s", ErrUnsupportedCipher, spec, k.Algorithm, k.Suggestion())
+}
+
+// checkKernelCiphers runs checkKernelCipher on the cipher of every crypt
+// segment the volume maps
+func checkKernelCiphers(metadata *LUKS2Metadata) error {
+	segs, err := mappedSegments(metadata)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if seg.Type != SegmentTypeCrypt {
+			continue
+		}
+		if err := checkKernelCipher(seg.Encryption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProbeKernelCiphers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crypto")
+	if err := os.WriteFile(path, []byte(testProcCrypto), 0600); err != nil {
+		t.Fatal(err)
+	}
+	saved := procCryptoPath
+	procCryptoPath = path
+	defer func() { procCryptoPath = saved }()
+
+	ciphers, err := ProbeKernelCiphers(&CipherProbeOptions{Ciphers: []string{"aes-xts-plain64", "serpent-xts-plain64"}})
+	if err != nil {
+		t.Fatalf("ProbeKernelCiphers failed: %v", err)
+	}
+	if len(ciphers) != 2 || !ciphers[0].Available || ciphers[1].Available {
+		t.Errorf("ProbeKernelCiphers = %+v", ciphers)
+	}
+
+	all, err := ProbeKernelCiphers(nil)
+	if err != nil || len(all) != len(CommonCiphers) {
+		t.Errorf("ProbeKernelCiphers(nil) = %d ciphers, %v", len(all), err)
+	}
+
+	if _, err := ProbeKernelCiphers(&CipherProbeOptions{Ciphers: []string{"aes--plain64"}}); err == nil {
+		t.Error("Expected error for an invalid cipher")
+	}
+
+	procCryptoPath = filepath.Join(t.TempDir(), "missing")
+	if _, err := ProbeKernelCiphers(nil); err == nil {
+		t.Error("Expected error without /proc/crypto")
+	}
+	if err := checkKernelCipher("serpent-xts-plain64"); err != nil {
+		t.Errorf("checkKernelCipher without /proc/crypto = %v, want nil", err)
+	}
+}
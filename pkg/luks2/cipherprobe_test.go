@@ -0,0 +1,178 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testProcCrypto = `name         : xts(aes)
+driver       : xts-aes-aesni
+module       : aesni_intel
+priority     : 401
+refcnt       : 1
+selftest     : passed
+internal     : no
+type         : skcipher
+
+name         : xts(aes)
+driver       : xts(ecb(aes-generic))
+module       : kernel
+priority     : 100
+refcnt       : 1
+selftest     : passed
+internal     : no
+type         : skcipher
+
+name         : __xts(aes)
+driver       : __xts-aes-aesni
+module       : aesni_intel
+priority     : 401
+selftest     : passed
+internal     : yes
+type         : skcipher
+
+name         : cbc(aes)
+driver       : cbc(ecb(aes-fixed-time))
+module       : kernel
+priority     : 101
+selftest     : passed
+internal     : no
+type         : lskcipher
+
+name         : cbc(serpent)
+driver       : cbc-serpent-broken
+module       : serpent_generic
+priority     : 100
+selftest     : failed
+internal     : no
+type         : skcipher
+
+name         : sha256
+driver       : sha256-generic
+module       : kernel
+priority     : 100
+selftest     : passed
+internal     : no
+type         : shash
+`
+
+func TestCipherAlgorithm(t *testing.T) {
+	tests := []struct {
+		spec      string
+		algorithm string
+		algType   string
+		hash      string
+	}{
+		{"aes-xts-plain64", "xts(aes)", "skcipher", ""},
+		{"aes-cbc-essiv:sha256", "cbc(aes)", "skcipher", "sha256"},
+		{"serpent-xts-plain", "xts(serpent)", "skcipher", ""},
+		{"xchacha12,aes-adiantum-plain64", "adiantum(xchacha12,aes)", "skcipher", ""},
+		{"aes-gcm-random", "gcm(aes)", "aead", ""},
+		{"cipher_null-ecb", "ecb(cipher_null)", "skcipher", ""},
+		{"aes", "cbc(aes)", "skcipher", ""},
+		{"capi:xts(aes)-plain64", "xts(aes)", "skcipher", ""},
+		{"capi:authenc(hmac(sha256),xts(aes))-random", "authenc(hmac(sha256),xts(aes))", "aead", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			algorithm, algType, hash, err := cipherAlgorithm(tt.spec)
+			if err != nil {
+				t.Fatalf("cipherAlgorithm failed: %v", err)
+			}
+			if algorithm != tt.algorithm || algType != tt.algType || hash != tt.hash {
+				t.Errorf("got %q %q %q, want %q %q %q", algorithm, algType, hash, tt.algorithm, tt.algType, tt.hash)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "aes--plain64", "-xts", "capi:xts(aes)", "capi:aes-plain64"} {
+		if _, _, _, err := cipherAlgorithm(spec); err == nil {
+			t.Errorf("cipherAlgorithm(%q): expected error", spec)
+		}
+	}
+}
+
+func TestParseProcCrypto(t *testing.T) {
+	algs, err := parseProcCrypto(strings.NewReader(testProcCrypto))
+	if err != nil {
+		t.Fatalf("parseProcCrypto failed: %v", err)
+	}
+	if len(algs) != 6 {
+		t.Fatalf("Expected 6 entries, got %d", len(algs))
+	}
+
+	if a := findAlgorithm(algs, "xts(aes)", "skcipher"); a == nil || a.driver != "xts-aes-aesni" {
+		t.Errorf("xts(aes) = %+v, want the aesni driver", a)
+	}
+	if a := findAlgorithm(algs, "cbc(aes)", "skcipher"); a == nil {
+		t.Error("lskcipher cbc(aes) not found")
+	}
+	if a := findAlgorithm(algs, "__xts(aes)", "skcipher"); a != nil {
+		t.Error("Internal algorithm returned")
+	}
+	if a := findAlgorithm(algs, "cbc(serpent)", "skcipher"); a != nil {
+		t.Error("Algorithm failing its self-test returned")
+	}
+	if a := findAlgorithm(algs, "sha256", "skcipher"); a != nil {
+		t.Error("Hash returned as a cipher")
+	}
+}
+
+func TestProbeCipher(t *testing.T) {
+	algs, err := parseProcCrypto(strings.NewReader(testProcCrypto))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := probeCipher("aes-cbc-essiv:sha256", algs, nil)
+	if err != nil {
+		t.Fatalf("probeCipher failed: %v", err)
+	}
+	if !k.Loaded || !k.Available || k.Driver != "cbc(ecb(aes-fixed-time))" || k.Suggestion() != "" {
+		t.Errorf("aes-cbc-essiv:sha256 = %+v", k)
+	}
+
+	k, err = probeCipher("twofish-xts-plain64", algs, nil)
+	if err != nil {
+		t.Fatalf("probeCipher failed: %v", err)
+	}
+	if k.Loaded || k.Available {
+		t.Errorf("twofish-xts-plain64 = %+v, want unavailable", k)
+	}
+	if s := k.Suggestion(); !strings.Contains(s, "modprobe xts twofish") {
+		t.Errorf("Suggestion() = %q", s)
+	}
+
+	var asked []string
+	ask := func(algType, name string) (bool, error) {
+		asked = append(asked, algType+":"+name)
+		return name != "sha512", nil
+	}
+	k, err = probeCipher("twofish-cbc-essiv:sha512", algs, ask)
+	if err != nil {
+		t.Fatalf("probeCipher failed: %v", err)
+	}
+	if k.Loaded || k.Available || strings.Join(asked, " ") != "skcipher:cbc(twofish) hash:sha512" {
+		t.Errorf("twofish-cbc-essiv:sha512 = %+v, asked %v", k, asked)
+	}
+	if s := k.Suggestion(); !strings.Contains(s, "modprobe cbc twofish sha512") {
+		t.Errorf("Suggestion() = %q", s)
+	}
+
+	asked = nil
+	if k, err = probeCipher("aes-xts-plain64", algs, ask); err != nil || !k.Available || len(asked) != 0 {
+		t.Errorf("aes-xts-plain64 = %+v, %v; asked %v", k, err, asked)
+	}
+
+	failing := func(algType, name string) (bool, error) { return false, errors.New("no AF_ALG") }
+	if _, err := probeCipher("serpent-xts-plain64", algs, failing); err == nil {
+		t.Error("Expected error from ask")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNoCredential is returned by a CredentialSource that has nothing to offer
+// for a request. Unlock helpers skip such sources instead of failing.
+var ErrNoCredential = errors.New("no credential available")
+
+// CredentialRequest describes the volume a credential is requested for
+type CredentialRequest struct {
+	Device string // Resolved device path
+	UUID   string // LUKS2 header UUID
+	Label  string // LUKS2 header label (may be empty)
+	Name   string // Device-mapper name the volume will be opened as
+}
+
+// CredentialSource supplies passphrases for unlocking a volume. The caller
+// clears the returned slice after use, so implementations must return a copy
+// of any passphrase they retain.
+type CredentialSource interface {
+	Passphrase(ctx context.Context, req CredentialRequest) ([]byte, error)
+}
+
+// CredentialFunc adapts an ordinary function to a CredentialSource
+type CredentialFunc func(ctx context.Context, req CredentialRequest) ([]byte, error)
+
+// Passphrase calls f(ctx, req)
+func (f CredentialFunc) Passphrase(ctx context.Context, req CredentialRequest) ([]byte, error) {
+	return f(ctx, req)
+}
+
+// StaticCredential is a fixed passphrase
+type StaticCredential []byte
+
+// Passphrase returns a copy of the static passphrase
+func (s StaticCredential) Passphrase(_ context.Context, _ CredentialRequest) ([]byte, error) {
+	if len(s) == 0 {
+		return nil, ErrNoCredential
+	}
+	return append([]byte(nil), s...), nil
+}
+
+// KeyFileCredential reads the passphrase from a key file. The whole file is
+// used verbatim, matching cryptsetup --key-file.
+type KeyFileCredential string
+
+// Passphrase reads the key file. A missing file yields ErrNoCredential so the
+// chain can move on to the next source.
+func (k KeyFileCredential) Passphrase(_ context.Context, _ CredentialRequest) ([]byte, error) {
+	data, err := os.ReadFile(string(k)) // #nosec G304 -- key file path supplied by caller
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoCredential
+		}
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, ErrNoCredential
+	}
+	return data, nil
+}
+
+// CredentialChain tries each source in order. When used with the unlock
+// helpers, every source's passphrase is tried against the volume before
+// moving on to the next source, so a chain like {key file, agent, prompt}
+// only prompts when the earlier sources fail.
+type CredentialChain []CredentialSource
+
+// Passphrase returns the first passphrase any source in the chain provides
+func (c CredentialChain) Passphrase(ctx context.Context, req CredentialRequest) ([]byte, error) {
+	for _, src := range c.sources() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pass, err := src.Passphrase(ctx, req)
+		if err == nil {
+			return pass, nil
+		}
+	}
+	return nil, ErrNoCredential
+}
+
+// sources flattens nested chains into a single ordered list
+func (c CredentialChain) sources() []CredentialSource {
+	var out []CredentialSource
+	for _, src := range c {
+		switch s := src.(type) {
+		case nil:
+			continue
+		case CredentialChain:
+			out = append(out, s.sources()...)
+		default:
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// credentialSources returns the individual sources to try for an unlock
+func credentialSources(creds CredentialSource) []CredentialSource {
+	if creds == nil {
+		return nil
+	}
+	if chain, ok := creds.(CredentialChain); ok {
+		return chain.sources()
+	}
+	return []CredentialSource{creds}
+}
+
+// unlockWithCredentials unlocks device as name, trying each credential source
+// in order until one passphrase opens a keyslot
+func unlockWithCredentials(ctx context.Context, device, name string, req CredentialRequest, creds CredentialSource) error {
+	sources := credentialSources(creds)
+	if len(sources) == 0 {
+		return fmt.Errorf("no credential sources configured: %w", ErrNoCredential)
+	}
+
+	var lastErr error
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pass, err := src.Passphrase(ctx, req)
+		if err != nil {
+			if !errors.Is(err, ErrNoCredential) {
+				lastErr = err
+			}
+			continue
+		}
+
+		err = Unlock(device, pass, name)
+		clearBytes(pass)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		lastErr = ErrNoCredential
+	}
+	return fmt.Errorf("no credential unlocked %s: %w", device, lastErr)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStaticCredential tests that static credentials return independent copies
+func TestStaticCredential(t *testing.T) {
+	src := StaticCredential("secret")
+
+	pass, err := src.Passphrase(context.Background(), CredentialRequest{})
+	if err != nil {
+		t.Fatalf("Passphrase failed: %v", err)
+	}
+	clearBytes(pass)
+
+	if string(src) != "secret" {
+		t.Error("Clearing the returned passphrase modified the source")
+	}
+
+	if _, err := StaticCredential(nil).Passphrase(context.Background(), CredentialRequest{}); !errors.Is(err, ErrNoCredential) {
+		t.Errorf("Expected ErrNoCredential for empty credential, got %v", err)
+	}
+}
+
+// TestKeyFileCredential tests reading passphrases from key files
+func TestKeyFileCredential(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, []byte("key\x00data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pass, err := KeyFileCredential(path).Passphrase(context.Background(), CredentialRequest{})
+	if err != nil {
+		t.Fatalf("Passphrase failed: %v", err)
+	}
+	if string(pass) != "key\x00data" {
+		t.Errorf("Key file should be used verbatim, got %q", pass)
+	}
+
+	missing := KeyFileCredential(filepath.Join(dir, "missing"))
+	if _, err := missing.Passphrase(context.Background(), CredentialRequest{}); !errors.Is(err, ErrNoCredential) {
+		t.Errorf("Expected ErrNoCredential for missing key file, got %v", err)
+	}
+}
+
+// TestCredentialChain tests source ordering and nested chain flattening
+func TestCredentialChain(t *testing.T) {
+	var calls []string
+	source := func(name string, err error) CredentialSource {
+		return CredentialFunc(func(_ context.Context, _ CredentialRequest) ([]byte, error) {
+			calls = append(calls, name)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(name), nil
+		})
+	}
+
+	chain := CredentialChain{
+		source("a", ErrNoCredential),
+		nil,
+		CredentialChain{source("b", errors.New("agent unavailable")), source("c", nil)},
+		source("d", nil),
+	}
+
+	if got := len(credentialSources(chain)); got != 4 {
+		t.Errorf("Expected 4 flattened sources, got %d", got)
+	}
+
+	pass, err := chain.Passphrase(context.Background(), CredentialRequest{})
+	if err != nil {
+		t.Fatalf("Passphrase failed: %v", err)
+	}
+	if string(pass) != "c" {
+		t.Errorf("Expected first available passphrase %q, got %q", "c", pass)
+	}
+	if len(calls) != 3 {
+		t.Errorf("Expected chain to stop after first success, got calls %v", calls)
+	}
+}
+
+// TestUnlockWithCredentials_NoCredential tests failure when no source offers a passphrase
+func TestUnlockWithCredentials_NoCredential(t *testing.T) {
+	ctx := context.Background()
+
+	if err := unlockWithCredentials(ctx, "/dev/null", "test", CredentialRequest{}, nil); !errors.Is(err, ErrNoCredential) {
+		t.Errorf("Expected ErrNoCredential for nil source, got %v", err)
+	}
+
+	chain := CredentialChain{StaticCredential(nil), KeyFileCredential("/nonexistent/key")}
+	if err := unlockWithCredentials(ctx, "/dev/null", "test", CredentialRequest{}, chain); !errors.Is(err, ErrNoCredential) {
+		t.Errorf("Expected ErrNoCredential for empty chain, got %v", err)
+	}
+}
+
+// TestUnlockWithCredentials_Canceled tests that a canceled context stops the chain
+func TestUnlockWithCredentials_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	src := CredentialFunc(func(_ context.Context, _ CredentialRequest) ([]byte, error) {
+		called = true
+		return []byte("secret"), nil
+	})
+
+	if err := unlockWithCredentials(ctx, "/dev/null", "test", CredentialRequest{}, src); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if called {
+		t.Error("Source should not be consulted after cancellation")
+	}
+}
@@ -25,42 +25,42 @@ func TestEncryptDecryptKeyMaterial(t *testing.T) {
 			name:     "AES-XTS with 256-bit key (32 bytes)",
 			dataSize: 4096,
 			keySize:  32,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 		{
 			name:     "AES-XTS with 512-bit key (64 bytes)",
 			dataSize: 8192,
 			keySize:  64,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 		{
 			name:     "Small data with 256-bit key",
 			dataSize: 512,
 			keySize:  32,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 		{
 			name:     "Large data with 512-bit key",
 			dataSize: 16384,
 			keySize:  64,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 		{
 			name:     "Single sector with 256-bit key",
 			dataSize: 512,
 			keySize:  32,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 		{
 			name:     "Multiple sectors with 512-bit key",
 			dataSize: 2048,
 			keySize:  64,
-			cipher:   "aes",
+			cipher:   "aes-xts-plain64",
 			wantErr:  false,
 		},
 	}
@@ -188,7 +188,7 @@ func TestEncryptKeyMaterialInvalidKeySize(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			key := make([]byte, tt.keySize)
-			_, err := encryptKeyMaterial(data, key, "aes")
+			_, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 			if err == nil {
 				t.Fatal("Expected error for invalid key size, got nil")
 			}
@@ -214,7 +214,7 @@ func TestDecryptKeyMaterialInvalidKeySize(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			key := make([]byte, tt.keySize)
-			_, err := decryptKeyMaterial(data, key, "aes", 512)
+			_, err := decryptKeyMaterial(data, key, "aes-xts-plain64", 512)
 			if err == nil {
 				t.Fatal("Expected error for invalid key size, got nil")
 			}
@@ -248,12 +248,12 @@ func TestEncryptKeyMaterialDifferentSectorSizes(t *testing.T) {
 				t.Fatalf("Failed to generate test data: %v", err)
 			}
 
-			encrypted, err := encryptKeyMaterial(data, key, "aes")
+			encrypted, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 			if err != nil {
 				t.Fatalf("Encryption failed: %v", err)
 			}
 
-			decrypted, err := decryptKeyMaterial(encrypted, key, "aes", 512)
+			decrypted, err := decryptKeyMaterial(encrypted, key, "aes-xts-plain64", 512)
 			if err != nil {
 				t.Fatalf("Decryption failed: %v", err)
 			}
@@ -278,12 +278,12 @@ func TestEncryptKeyMaterialDeterministic(t *testing.T) {
 	}
 
 	// Encrypt same data multiple times
-	encrypted1, err := encryptKeyMaterial(data, key, "aes")
+	encrypted1, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("First encryption failed: %v", err)
 	}
 
-	encrypted2, err := encryptKeyMaterial(data, key, "aes")
+	encrypted2, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("Second encryption failed: %v", err)
 	}
@@ -307,7 +307,7 @@ func TestDecryptKeyMaterialCorruptedData(t *testing.T) {
 	}
 
 	// Encrypt
-	encrypted, err := encryptKeyMaterial(originalData, key, "aes")
+	encrypted, err := encryptKeyMaterial(originalData, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("Encryption failed: %v", err)
 	}
@@ -318,7 +318,7 @@ func TestDecryptKeyMaterialCorruptedData(t *testing.T) {
 	corrupted[100] ^= 0xFF // Flip bits
 
 	// Decrypt corrupted data (XTS doesn't have authentication, so no error expected)
-	decrypted, err := decryptKeyMaterial(corrupted, key, "aes", 512)
+	decrypted, err := decryptKeyMaterial(corrupted, key, "aes-xts-plain64", 512)
 	if err != nil {
 		t.Fatalf("Decryption of corrupted data failed: %v", err)
 	}
@@ -347,13 +347,13 @@ func TestDecryptKeyMaterialWrongKey(t *testing.T) {
 	}
 
 	// Encrypt with correct key
-	encrypted, err := encryptKeyMaterial(originalData, correctKey, "aes")
+	encrypted, err := encryptKeyMaterial(originalData, correctKey, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("Encryption failed: %v", err)
 	}
 
 	// Decrypt with wrong key (no error expected, but data will be garbage)
-	decrypted, err := decryptKeyMaterial(encrypted, wrongKey, "aes", 512)
+	decrypted, err := decryptKeyMaterial(encrypted, wrongKey, "aes-xts-plain64", 512)
 	if err != nil {
 		t.Fatalf("Decryption with wrong key failed: %v", err)
 	}
@@ -405,7 +405,7 @@ func TestCreateDigest(t *testing.T) {
 				t.Fatalf("Failed to generate master key: %v", err)
 			}
 
-			kdf, digestValue, err := createDigest(tt.masterKey, tt.hashAlgo)
+			kdf, digestValue, err := createDigest(tt.masterKey, tt.hashAlgo, DigestIterations)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("Expected error, got nil")
@@ -468,12 +468,12 @@ func TestCreateDigestDeterministic(t *testing.T) {
 		t.Fatalf("Failed to generate master key: %v", err)
 	}
 
-	kdf1, digest1, err := createDigest(masterKey, "sha256")
+	kdf1, digest1, err := createDigest(masterKey, "sha256", DigestIterations)
 	if err != nil {
 		t.Fatalf("First createDigest failed: %v", err)
 	}
 
-	kdf2, digest2, err := createDigest(masterKey, "sha256")
+	kdf2, digest2, err := createDigest(masterKey, "sha256", DigestIterations)
 	if err != nil {
 		t.Fatalf("Second createDigest failed: %v", err)
 	}
@@ -496,7 +496,7 @@ func TestCreateDigestVerification(t *testing.T) {
 		t.Fatalf("Failed to generate master key: %v", err)
 	}
 
-	kdf, expectedDigest, err := createDigest(masterKey, "sha256")
+	kdf, expectedDigest, err := createDigest(masterKey, "sha256", DigestIterations)
 	if err != nil {
 		t.Fatalf("createDigest failed: %v", err)
 	}
@@ -533,7 +533,7 @@ func TestCreateDigestInvalidHashAlgo(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, _, err := createDigest(masterKey, tt.hashAlgo)
+			_, _, err := createDigest(masterKey, tt.hashAlgo, DigestIterations)
 			if err == nil {
 				t.Fatal("Expected error for unsupported hash algorithm, got nil")
 			}
@@ -716,7 +716,7 @@ func TestCreateMetadata(t *testing.T) {
 	if metadata.Config.JSONSize != expectedJSONSize {
 		t.Fatalf("Expected JSON size %s, got %s", expectedJSONSize, metadata.Config.JSONSize)
 	}
-	expectedKeyslotsSize := formatSize(int64(keyslotOffset + keyslotSize))
+	expectedKeyslotsSize := formatSize(int64(keyslotsAreaSize))
 	if metadata.Config.KeyslotsSize != expectedKeyslotsSize {
 		t.Fatalf("Expected keyslots size %s, got %s", expectedKeyslotsSize, metadata.Config.KeyslotsSize)
 	}
@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import "sync"
+
+// volumeCryptBatch is how much one worker encrypts or decrypts at a time: a
+// whole number of sectors of every LUKS2 sector size, small enough to
+// spread a chunk over the workers and large enough to outweigh the hand-off
+const volumeCryptBatch = 64 * 1024
+
+// cryptJob is a batch of whole sectors of an extent
+type cryptJob struct {
+	ext     *volumeExtent
+	buf     []byte
+	rel     int64
+	encrypt bool
+	done    *sync.WaitGroup
+}
+
+// cryptPool spreads the sectors of large reads and writes over a fixed set
+// of goroutines, so a single core's AES throughput does not cap a Volume
+type cryptPool struct {
+	jobs chan cryptJob
+}
+
+// newCryptPool starts workers goroutines; the caller is one more, so a pool
+// for n cores has n-1 workers
+func newCryptPool(workers int) *cryptPool {
+	p := &cryptPool{jobs: make(chan cryptJob, workers)}
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+func (p *cryptPool) work() {
+	for job := range p.jobs {
+		job.ext.crypt(job.buf, job.rel, job.encrypt)
+		job.done.Done()
+	}
+}
+
+// crypt encrypts or decrypts buf, whole sectors at offset rel of ext, in
+// place and returns once every batch is done. Batches are queued in order,
+// so the front of the buffer is ready first; the caller does the last one.
+func (p *cryptPool) crypt(ext *volumeExtent, buf []byte, rel int64, encrypt bool) {
+	var wg sync.WaitGroup
+	for len(buf) > volumeCryptBatch {
+		wg.Add(1)
+		p.jobs <- cryptJob{ext: ext, buf: buf[:volumeCryptBatch], rel: rel, encrypt: encrypt, done: &wg}
+		buf = buf[volumeCryptBatch:]
+		rel += volumeCryptBatch
+	}
+	ext.crypt(buf, rel, encrypt)
+	wg.Wait()
+}
+
+// close stops the workers once no crypt call is running
+func (p *cryptPool) close() {
+	close(p.jobs)
+}
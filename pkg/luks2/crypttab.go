@@ -0,0 +1,187 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// randomKeyFiles are the crypttab key files that key a volume with random
+// data on every boot
+var randomKeyFiles = []string{"/dev/urandom", "/dev/random", "/dev/hw_random"}
+
+// CrypttabEntry is an entry of /etc/crypttab (crypttab(5))
+type CrypttabEntry struct {
+	Name    string   // Mapping name
+	Device  string   // Device path, UUID=<uuid> or LABEL=<label>
+	KeyFile string   // Key file ("" for none, - or none)
+	Options []string // Options in the order listed
+}
+
+// ParseCrypttab reads crypttab entries. Blank lines and comments are
+// skipped and octal escapes such as \040 are decoded in every field.
+func ParseCrypttab(r io.Reader) ([]CrypttabEntry, error) {
+	var entries []CrypttabEntry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("crypttab line %d: expected 2 to 4 fields, got %d", n, len(fields))
+		}
+		for i := range fields {
+			fields[i] = unescapeField(fields[i])
+		}
+
+		entry := CrypttabEntry{Name: fields[0], Device: fields[1]}
+		if len(fields) > 2 && fields[2] != "-" && fields[2] != "none" {
+			entry.KeyFile = fields[2]
+		}
+		if len(fields) > 3 {
+			entry.Options = strings.Split(fields[3], ",")
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read crypttab: %w", err)
+	}
+	return entries, nil
+}
+
+// String formats the entry as a tab-separated crypttab line. An empty key
+// file is written as none.
+func (e CrypttabEntry) String() string {
+	keyFile := e.KeyFile
+	if keyFile == "" {
+		keyFile = "none"
+	}
+	fields := []string{escapeField(e.Name), escapeField(e.Device), escapeField(keyFile)}
+	if len(e.Options) > 0 {
+		fields = append(fields, escapeField(strings.Join(e.Options, ",")))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// unescapeField decodes the \NNN octal escapes of a crypttab field
+func unescapeField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Ephemeral reports whether the entry is keyed by fresh random data on
+// every boot, as encrypted swap and /tmp are. Such entries are opened with
+// CreateEphemeralWithOptions and the options from EphemeralOptions.
+func (e *CrypttabEntry) Ephemeral() bool {
+	for _, f := range randomKeyFiles {
+		if e.KeyFile == f {
+			return true
+		}
+	}
+	return false
+}
+
+// EphemeralOptions converts the options of an ephemeral entry, see
+// ParseEphemeralOptions
+func (e *CrypttabEntry) EphemeralOptions() (*EphemeralOptions, error) {
+	if !e.Ephemeral() {
+		return nil, fmt.Errorf("crypttab entry %s is not keyed by a random key file", e.Name)
+	}
+	opts, err := ParseEphemeralOptions(e.Options)
+	if err != nil {
+		return nil, fmt.Errorf("crypttab entry %s: %w", e.Name, err)
+	}
+	return opts, nil
+}
+
+// ParseEphemeralOptions converts crypttab options to EphemeralOptions:
+//
+//	swap                    write a swap signature
+//	tmp[=fstype]            create a filesystem (default: ext4)
+//	cipher=, size=          cipher specification and key size in bits
+//	sector-size=            encryption sector size
+//	offset=                 start of the mapping, in 512-byte sectors
+//	discard, same-cpu-crypt, submit-from-crypt-cpus,
+//	no-read-workqueue, no-write-workqueue
+//	                        dm-crypt flags
+//
+// plain is accepted since it is implied. Options that only concern when an
+// entry is activated (noauto, nofail, x-systemd.*, ...) or how a key file
+// is read are ignored, like systemd-cryptsetup ignores unknown options.
+// Options that ask for a header or a mapping an ephemeral volume cannot be
+// (luks, tcrypt, skip=, read-only, ...) are rejected.
+//
+// Unlike systemd-cryptsetup, whose plain mode defaults to aes-cbc-essiv
+// with a 256-bit key, the default cipher is DefaultEphemeralCipher.
+func ParseEphemeralOptions(options []string) (*EphemeralOptions, error) {
+	opts := &EphemeralOptions{Unlock: &UnlockOptions{}}
+	for _, option := range options {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(option), "=")
+		var err error
+		switch key {
+		case "", "plain":
+		case "swap":
+			opts.Swap = true
+		case "tmp":
+			opts.Filesystem = "ext4"
+			if hasValue && value != "" {
+				opts.Filesystem = value
+			}
+		case "cipher":
+			opts.Cipher = value
+		case "size":
+			opts.KeySize, err = strconv.Atoi(value)
+		case "sector-size":
+			opts.SectorSize, err = strconv.Atoi(value)
+		case "offset":
+			var sectors int64
+			sectors, err = strconv.ParseInt(value, 10, 64)
+			if err == nil && (sectors < 0 || sectors > math.MaxInt64/LUKS2SectorSize) {
+				err = ErrInvalidSize
+			}
+			opts.Offset = sectors * LUKS2SectorSize
+		case "discard":
+			opts.Unlock.AllowDiscards = true
+		case "same-cpu-crypt":
+			opts.Unlock.SameCPUCrypt = true
+		case "submit-from-crypt-cpus":
+			opts.Unlock.SubmitFromCryptCPUs = true
+		case "no-read-workqueue":
+			opts.Unlock.NoReadWorkqueue = true
+		case "no-write-workqueue":
+			opts.Unlock.NoWriteWorkqueue = true
+		case "luks", "tcrypt", "bitlk", "fvault2", "header", "skip", "read-only", "readonly",
+			"tpm2-device", "fido2-device", "pkcs11-uri", "integrity":
+			return nil, fmt.Errorf("option %q does not apply to a volume with a random key", option)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid option %q: %w", option, err)
+		}
+	}
+	if opts.Swap && opts.Filesystem != "" {
+		return nil, errors.New("options swap and tmp are mutually exclusive")
+	}
+	return opts, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCrypttab(t *testing.T) {
+	table := `# <name> <device> <key file> <options>
+cryptswap  /dev/sda3  /dev/urandom  swap,cipher=aes-xts-plain64,size=512
+
+tmp        PARTUUID=1234  /dev/urandom  tmp=xfs,discard
+data       UUID=2b1bd3c0  none
+backup     LABEL=off\040site  /etc/keys/backup\040key  luks,nofail
+`
+	entries, err := ParseCrypttab(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("ParseCrypttab failed: %v", err)
+	}
+	want := []CrypttabEntry{
+		{Name: "cryptswap", Device: "/dev/sda3", KeyFile: "/dev/urandom", Options: []string{"swap", "cipher=aes-xts-plain64", "size=512"}},
+		{Name: "tmp", Device: "PARTUUID=1234", KeyFile: "/dev/urandom", Options: []string{"tmp=xfs", "discard"}},
+		{Name: "data", Device: "UUID=2b1bd3c0"},
+		{Name: "backup", Device: "LABEL=off site", KeyFile: "/etc/keys/backup key", Options: []string{"luks", "nofail"}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v", entries)
+	}
+	if !entries[0].Ephemeral() || entries[2].Ephemeral() || entries[3].Ephemeral() {
+		t.Error("only random key files are ephemeral")
+	}
+
+	if _, err := ParseCrypttab(strings.NewReader("lonely\n")); err == nil {
+		t.Error("Expected error for a single field")
+	}
+}
+
+func TestCrypttabEphemeralOptions(t *testing.T) {
+	entry := CrypttabEntry{Name: "cryptswap", Device: "/dev/sda3", KeyFile: "/dev/urandom",
+		Options: []string{"plain", "swap", "cipher=aes-cbc-essiv:sha256", "size=256", "sector-size=4096", "offset=2048", "discard", "nofail", "x-systemd.device-timeout=10s"}}
+	opts, err := entry.EphemeralOptions()
+	if err != nil {
+		t.Fatalf("EphemeralOptions failed: %v", err)
+	}
+	if !opts.Swap || opts.Cipher != "aes-cbc-essiv:sha256" || opts.KeySize != 256 || opts.SectorSize != 4096 ||
+		opts.Offset != 2048*512 || !opts.Unlock.AllowDiscards {
+		t.Errorf("options = %+v", opts)
+	}
+
+	if opts, err := ParseEphemeralOptions([]string{"tmp"}); err != nil || opts.Filesystem != "ext4" {
+		t.Errorf("tmp = %+v, %v", opts, err)
+	}
+	if opts, err := ParseEphemeralOptions([]string{"tmp=xfs"}); err != nil || opts.Filesystem != "xfs" {
+		t.Errorf("tmp=xfs = %+v, %v", opts, err)
+	}
+
+	for _, bad := range [][]string{{"luks"}, {"swap", "tmp"}, {"size=x"}, {"offset=-1"}, {"skip=8"}} {
+		if _, err := ParseEphemeralOptions(bad); err == nil {
+			t.Errorf("Expected error for %v", bad)
+		}
+	}
+
+	entry.KeyFile = "/etc/keys/swap.key"
+	if _, err := entry.EphemeralOptions(); err == nil {
+		t.Error("Expected error for a key file")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import "fmt"
+
+// DeviceTransport identifies how a device reaches its backing storage
+type DeviceTransport string
+
+const (
+	// TransportFile is a regular file (disk image)
+	TransportFile DeviceTransport = "file"
+
+	// TransportLocal is a locally attached block device (SATA, NVMe, virtio, ...)
+	TransportLocal DeviceTransport = "local"
+
+	// TransportLoop is a loop device backed by a file
+	TransportLoop DeviceTransport = "loop"
+
+	// TransportDeviceMapper is a device-mapper device (LVM, dm-crypt, ...)
+	TransportDeviceMapper DeviceTransport = "device-mapper"
+
+	// TransportNBD is a Network Block Device
+	TransportNBD DeviceTransport = "nbd"
+
+	// TransportISCSI is an iSCSI-attached SCSI disk
+	TransportISCSI DeviceTransport = "iscsi"
+
+	// TransportRBD is a Ceph RADOS block device
+	TransportRBD DeviceTransport = "rbd"
+)
+
+// DefaultWipeBufferSize is the write size used when wiping local devices
+const DefaultWipeBufferSize = 4 * 1024 * 1024 // 4MB
+
+// NetworkWipeBufferSize is the write size used when wiping network-backed
+// devices, where each request pays a round-trip and larger batches amortize it
+const NetworkWipeBufferSize = 8 * 1024 * 1024 // 8MB
+
+// DeviceDescription describes a device or disk image and how it is attached
+type DeviceDescription struct {
+	// Path is the path that was described
+	Path string
+
+	// ResolvedPath is Path with symlinks resolved
+	ResolvedPath string
+
+	// KernelName is the kernel block device name (e.g. "sda1", "nbd0"); empty for regular files
+	KernelName string
+
+	// IsBlockDevice is true for block devices, false for regular files
+	IsBlockDevice bool
+
+	// Size is the device or file size in bytes
+	Size int64
+
+	// AllocatedSize is the disk space an image file occupies in bytes, which
+	// is less than Size for sparse files; 0 for block devices
+	AllocatedSize int64
+
+	// Transport is how the device reaches its backing storage
+	Transport DeviceTransport
+
+	// Network is true when the backing storage is reached over the network.
+	// This includes NBD/iSCSI/RBD devices, device-mapper or loop devices stacked
+	// on top of them, and image files stored on network filesystems.
+	Network bool
+
+	// Rotational is true when the kernel reports a rotational (spinning) device
+	Rotational bool
+
+	// LogicalBlockSize is the smallest unit the device can address, in bytes.
+	// The LUKS2 encryption sector size must be at least this large.
+	LogicalBlockSize int
+
+	// PhysicalBlockSize is the device's native write unit in bytes
+	PhysicalBlockSize int
+}
+
+// checkSectorSize rejects an encryption sector size smaller than the
+// device's logical block size, which dm-crypt cannot map
+func checkSectorSize(desc *DeviceDescription, sectorSize int) error {
+	if desc.LogicalBlockSize > sectorSize {
+		return fmt.Errorf("%w: %s has %d-byte logical blocks, larger than the %d-byte encryption sector",
+			ErrInvalidSectorSize, desc.Path, desc.LogicalBlockSize, sectorSize)
+	}
+	return nil
+}
+
+// describeForWrite describes a device before a write-heavy operation and
+// emits a rate-limited warning when it is network-backed. Description
+// failures are not fatal; the caller falls back to local-device behavior.
+func describeForWrite(device, op string) *DeviceDescription {
+	desc, err := DescribeDevice(device)
+	if err != nil {
+		return &DeviceDescription{Path: device}
+	}
+
+	if desc.Network {
+		emitWarning(Warning{
+			Code:    WarnNetworkDevice,
+			Op:      op,
+			Device:  device,
+			Message: fmt.Sprintf("%s is network-backed (%s); I/O latency and connection loss can affect %s", device, desc.Transport, op),
+		})
+	}
+
+	return desc
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeSysfsDevice creates a fake sysfs block device directory with optional attributes
+func makeSysfsDevice(t *testing.T, root, rel string, attrs map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(root, rel)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatalf("Failed to create %s: %v", dir, err)
+	}
+	for name, value := range attrs {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatalf("Failed to create attribute dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(value+"\n"), 0600); err != nil {
+			t.Fatalf("Failed to write attribute %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// TestDescribeDevice_RegularFile tests describing a disk image file
+func TestDescribeDevice_RegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.luks")
+	if err := os.WriteFile(path, make([]byte, 8192), 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	desc, err := DescribeDevice(path)
+	if err != nil {
+		t.Fatalf("DescribeDevice failed: %v", err)
+	}
+
+	if desc.IsBlockDevice {
+		t.Error("Expected regular file, got block device")
+	}
+	if desc.Transport != TransportFile {
+		t.Errorf("Expected transport %q, got %q", TransportFile, desc.Transport)
+	}
+	if desc.Size != 8192 {
+		t.Errorf("Expected size 8192, got %d", desc.Size)
+	}
+	if desc.Network {
+		t.Error("Temp file should not be network-backed")
+	}
+	if desc.LogicalBlockSize != LUKS2SectorSize {
+		t.Errorf("Expected logical block size %d, got %d", LUKS2SectorSize, desc.LogicalBlockSize)
+	}
+}
+
+// TestDescribeDevice_InvalidPath tests error handling for invalid paths
+func TestDescribeDevice_InvalidPath(t *testing.T) {
+	if _, err := DescribeDevice("relative/path"); err == nil {
+		t.Error("Expected error for relative path")
+	}
+	if _, err := DescribeDevice("/nonexistent/device"); err == nil {
+		t.Error("Expected error for nonexistent device")
+	}
+}
+
+// TestClassifySysfsDevice tests transport classification against a fake sysfs tree
+func TestClassifySysfsDevice(t *testing.T) {
+	root := t.TempDir()
+
+	nbd := makeSysfsDevice(t, root, "devices/virtual/block/nbd0", nil)
+	nbdPart := makeSysfsDevice(t, root, "devices/virtual/block/nbd0/nbd0p1", map[string]string{"partition": "1"})
+	rbd := makeSysfsDevice(t, root, "devices/virtual/block/rbd0", nil)
+	iscsi := makeSysfsDevice(t, root, "devices/platform/host3/session1/target3:0:0/3:0:0:0/block/sdb", nil)
+	local := makeSysfsDevice(t, root, "devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda", nil)
+	localPart := makeSysfsDevice(t, root, "devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda/sda1", map[string]string{"partition": "1"})
+	loop := makeSysfsDevice(t, root, "devices/virtual/block/loop0", map[string]string{"loop/backing_file": root})
+
+	dmNet := makeSysfsDevice(t, root, "devices/virtual/block/dm-0", nil)
+	if err := os.MkdirAll(filepath.Join(dmNet, "slaves"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(nbd, filepath.Join(dmNet, "slaves", "nbd0")); err != nil {
+		t.Fatal(err)
+	}
+
+	dmLocal := makeSysfsDevice(t, root, "devices/virtual/block/dm-1", nil)
+	if err := os.MkdirAll(filepath.Join(dmLocal, "slaves"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(local, filepath.Join(dmLocal, "slaves", "sda")); err != nil {
+		t.Fatal(err)
+	}
+
+	// dm-2 stacked on dm-0 (e.g. dm-crypt on LVM on NBD)
+	dmStacked := makeSysfsDevice(t, root, "devices/virtual/block/dm-2", nil)
+	if err := os.MkdirAll(filepath.Join(dmStacked, "slaves"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dmNet, filepath.Join(dmStacked, "slaves", "dm-0")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		dir           string
+		wantTransport DeviceTransport
+		wantNetwork   bool
+	}{
+		{"nbd", nbd, TransportNBD, true},
+		{"nbd partition", nbdPart, TransportNBD, true},
+		{"rbd", rbd, TransportRBD, true},
+		{"iscsi", iscsi, TransportISCSI, true},
+		{"local disk", local, TransportLocal, false},
+		{"local partition", localPart, TransportLocal, false},
+		{"loop on local file", loop, TransportLoop, false},
+		{"dm on nbd", dmNet, TransportDeviceMapper, true},
+		{"dm on local", dmLocal, TransportDeviceMapper, false},
+		{"dm on dm on nbd", dmStacked, TransportDeviceMapper, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, network := classifySysfsDevice(tt.dir, 0)
+			if transport != tt.wantTransport {
+				t.Errorf("transport = %q, want %q", transport, tt.wantTransport)
+			}
+			if network != tt.wantNetwork {
+				t.Errorf("network = %v, want %v", network, tt.wantNetwork)
+			}
+		})
+	}
+}
+
+// TestReadSysfsQueueAttr_PartitionFallback tests that partitions read queue attributes from their parent
+func TestReadSysfsQueueAttr_PartitionFallback(t *testing.T) {
+	root := t.TempDir()
+	disk := makeSysfsDevice(t, root, "block/sda", map[string]string{"queue/rotational": "1"})
+	part := makeSysfsDevice(t, root, "block/sda/sda1", map[string]string{"partition": "1"})
+
+	if got := readSysfsQueueAttr(disk, "rotational"); got != "1" {
+		t.Errorf("disk rotational = %q, want %q", got, "1")
+	}
+	if got := readSysfsQueueAttr(part, "rotational"); got != "1" {
+		t.Errorf("partition rotational = %q, want %q", got, "1")
+	}
+	if got := readSysfsQueueAttr(part, "nonexistent"); got != "" {
+		t.Errorf("missing attribute = %q, want empty", got)
+	}
+}
+
+// TestSysfsBlockSizes tests block size discovery, including the partition fallback and defaults
+func TestSysfsBlockSizes(t *testing.T) {
+	root := t.TempDir()
+	disk := makeSysfsDevice(t, root, "block/nvme0n1", map[string]string{
+		"queue/logical_block_size":  "4096",
+		"queue/physical_block_size": "4096",
+	})
+	part := makeSysfsDevice(t, root, "block/nvme0n1/nvme0n1p1", map[string]string{"partition": "1"})
+	bare := makeSysfsDevice(t, root, "block/sdz", nil)
+
+	tests := []struct {
+		name         string
+		dir          string
+		wantLogical  int
+		wantPhysical int
+	}{
+		{"4Kn disk", disk, 4096, 4096},
+		{"4Kn partition", part, 4096, 4096},
+		{"missing attributes", bare, 512, 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logical, physical := sysfsBlockSizes(tt.dir)
+			if logical != tt.wantLogical || physical != tt.wantPhysical {
+				t.Errorf("sysfsBlockSizes() = %d/%d, want %d/%d", logical, physical, tt.wantLogical, tt.wantPhysical)
+			}
+		})
+	}
+}
+
+// TestCheckSectorSize tests that sector sizes below the logical block size are rejected
+func TestCheckSectorSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		logical    int
+		sectorSize int
+		wantErr    bool
+	}{
+		{"512e with 512", 512, 512, false},
+		{"512e with 4096", 512, 4096, false},
+		{"4Kn with 4096", 4096, 4096, false},
+		{"4Kn with 512", 4096, 512, true},
+		{"unknown geometry", 0, 512, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := &DeviceDescription{Path: "/dev/test", LogicalBlockSize: tt.logical}
+			err := checkSectorSize(desc, tt.sectorSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkSectorSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSectorSize) {
+				t.Errorf("expected ErrInvalidSectorSize, got %v", err)
+			}
+		})
+	}
+}
+
+// TestDescribeForWrite_InvalidDevice tests that description failures fall back to local behavior
+func TestDescribeForWrite_InvalidDevice(t *testing.T) {
+	desc := describeForWrite("/nonexistent/device", "wipe")
+	if desc == nil {
+		t.Fatal("describeForWrite returned nil")
+	}
+	if desc.Network {
+		t.Error("Fallback description should not be network-backed")
+	}
+}
+
+// TestWipePassBuffered_InvalidBufferSize tests buffer size validation
+func TestWipePassBuffered_InvalidBufferSize(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "wipe")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := wipePassBuffered(f, 4096, false, 0); err == nil {
+		t.Error("Expected error for zero buffer size")
+	}
+}
+
+// TestWipePassBuffered_LargeBuffer tests wiping with the network buffer size
+func TestWipePassBuffered_LargeBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wipe")
+	data := make([]byte, 3*4096+17)
+	for i := range data {
+		data[i] = 0xAA
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := wipePassBuffered(f, int64(len(data)), false, NetworkWipeBufferSize); err != nil {
+		t.Fatalf("wipePassBuffered failed: %v", err)
+	}
+
+	result, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	for i, b := range result {
+		if b != 0 {
+			t.Fatalf("Byte %d not wiped: 0x%02x", i, b)
+		}
+	}
+}
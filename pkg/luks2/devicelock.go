@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// deviceMutex serializes the goroutines of this process that lock one
+// device. File locks belong to open files rather than goroutines, so on
+// their own they leave goroutines polling each other's descriptors; the
+// mutex makes them wait for each other directly.
+type deviceMutex struct {
+	sync.RWMutex
+	key  string
+	refs int // Guarded by deviceMutexes.mu
+}
+
+// deviceMutexes holds the mutex of every device currently being locked,
+// keyed by canonical path. Entries are dropped when the last user is done,
+// so the map does not grow with every device ever opened.
+var deviceMutexes = struct {
+	mu sync.Mutex
+	m  map[string]*deviceMutex
+}{m: make(map[string]*deviceMutex)}
+
+// canonicalDevicePath resolves symlinks (e.g. /dev/disk/by-uuid links), so
+// every name of a device maps to the same mutex
+func canonicalDevicePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return filepath.Clean(path)
+}
+
+// getDeviceMutex returns the mutex of a device, creating it if needed. Each
+// call must be balanced by put.
+func getDeviceMutex(path string) *deviceMutex {
+	key := canonicalDevicePath(path)
+
+	deviceMutexes.mu.Lock()
+	defer deviceMutexes.mu.Unlock()
+	dev, ok := deviceMutexes.m[key]
+	if !ok {
+		dev = &deviceMutex{key: key}
+		deviceMutexes.m[key] = dev
+	}
+	dev.refs++
+	return dev
+}
+
+// put drops a reference taken by getDeviceMutex
+func (d *deviceMutex) put() {
+	deviceMutexes.mu.Lock()
+	defer deviceMutexes.mu.Unlock()
+	d.refs--
+	if d.refs == 0 {
+		delete(deviceMutexes.m, d.key)
+	}
+}
+
+// tryLock takes the mutex without blocking
+func (d *deviceMutex) tryLock(shared bool) bool {
+	if shared {
+		return d.TryRLock()
+	}
+	return d.TryLock()
+}
+
+// unlock releases a mutex taken with tryLock
+func (d *deviceMutex) unlock(shared bool) {
+	if shared {
+		d.RUnlock()
+	} else {
+		d.Unlock()
+	}
+}
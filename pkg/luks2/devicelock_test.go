@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDeviceMutex_Symlink(t *testing.T) {
+	path := lockTestFile(t)
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := AcquireFileLockWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireFileLockWithOptions(link, nil); !errors.Is(err, ErrDeviceLocked) {
+		t.Errorf("lock through symlink: got %v, want ErrDeviceLocked", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	deviceMutexes.mu.Lock()
+	n := len(deviceMutexes.m)
+	deviceMutexes.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d device mutexes left after release", n)
+	}
+}
+
+func TestConcurrentAddKey(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	setLockTimeout(t, -1) // Key derivation is slow under the race detector
+
+	const workers = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pass := []byte(fmt.Sprintf("worker-password-%d", i))
+			errs <- AddKey(device, admin, pass, &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("AddKey failed: %v", err)
+		}
+	}
+
+	slots, err := ListKeyslots(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != workers+1 {
+		t.Errorf("expected %d keyslots, got %d", workers+1, len(slots))
+	}
+	for i := 0; i < workers; i++ {
+		if err := TestKey(device, []byte(fmt.Sprintf("worker-password-%d", i))); err != nil {
+			t.Errorf("worker %d passphrase does not unlock: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LUKS1 binary header field offsets used for discovery
+const (
+	luks1UUIDOffset = 168
+	luks1UUIDLen    = 40
+)
+
+// DiscoveredVolume describes a LUKS volume found on the system
+type DiscoveredVolume struct {
+	Device     string // Device node path (e.g. /dev/sdb1)
+	UUID       string // Header UUID
+	Label      string // Header label (LUKS2 only)
+	Version    int    // LUKS version (1 or 2)
+	Unlocked   bool   // Whether a dm-crypt mapping is active on the device
+	MappedName string // Device-mapper name when unlocked
+}
+
+// Discover enumerates the block devices known to sysfs, probes each one for a
+// LUKS header and returns the volumes found, sorted by device path. Active
+// dm-crypt mappings are matched to their backing device so the result shows
+// which volumes are unlocked and under which name.
+func Discover() ([]DiscoveredVolume, error) {
+	blockDir := filepath.Join(sysfsRoot, "class", "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list block devices: %w", err)
+	}
+
+	mappings := cryptMappings(blockDir, entries)
+
+	var volumes []DiscoveredVolume
+	for _, entry := range entries {
+		name := entry.Name()
+		if readSysfsAttr(filepath.Join(blockDir, name), "size") == "0" {
+			continue
+		}
+
+		device := filepath.Join(devRoot, name)
+		id, version, err := probeLUKS(device)
+		if err != nil {
+			continue
+		}
+
+		vol := DiscoveredVolume{
+			Device:  device,
+			UUID:    id.UUID,
+			Label:   id.Label,
+			Version: version,
+		}
+		if mapped, ok := mappings[name]; ok {
+			vol.Unlocked = true
+			vol.MappedName = mapped
+		}
+		volumes = append(volumes, vol)
+	}
+
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Device < volumes[j].Device })
+	return volumes, nil
+}
+
+// ActiveMappings returns the sorted device-mapper names of all active LUKS
+// dm-crypt mappings
+func ActiveMappings() ([]string, error) {
+	blockDir := filepath.Join(sysfsRoot, "class", "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list block devices: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "dm-") {
+			continue
+		}
+		dmDir := filepath.Join(blockDir, entry.Name())
+		if strings.HasPrefix(readSysfsAttr(dmDir, "dm/uuid"), "CRYPT-LUKS") {
+			names = append(names, readSysfsAttr(dmDir, "dm/name"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// cryptMappings maps the kernel name of each device backing an active LUKS
+// dm-crypt mapping to the mapping's name
+func cryptMappings(blockDir string, entries []os.DirEntry) map[string]string {
+	mappings := make(map[string]string)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "dm-") {
+			continue
+		}
+
+		dmDir := filepath.Join(blockDir, entry.Name())
+		if !strings.HasPrefix(readSysfsAttr(dmDir, "dm/uuid"), "CRYPT-LUKS") {
+			continue
+		}
+		name := readSysfsAttr(dmDir, "dm/name")
+
+		slaves, err := os.ReadDir(filepath.Join(dmDir, "slaves"))
+		if err != nil {
+			continue
+		}
+		for _, slave := range slaves {
+			mappings[slave.Name()] = name
+		}
+	}
+	return mappings
+}
+
+// probeLUKS reads the identity and version of a LUKS1 or LUKS2 header.
+// Only the fixed-size binary header is read; checksums are not verified.
+func probeLUKS(device string) (*luks2Identity, int, error) {
+	f, err := os.Open(device) // #nosec G304 -- device path from sysfs scan
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, LUKS2HeaderSize)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return nil, 0, err
+	}
+
+	if !bytes.Equal(buf[:LUKS2MagicLen], []byte(LUKS2Magic)) {
+		return nil, 0, fmt.Errorf("not a LUKS device")
+	}
+
+	switch version := binary.BigEndian.Uint16(buf[LUKS2MagicLen:]); version {
+	case 1:
+		uuid := buf[luks1UUIDOffset : luks1UUIDOffset+luks1UUIDLen]
+		return &luks2Identity{UUID: string(bytes.TrimRight(uuid, "\x00"))}, 1, nil
+	case LUKS2Version:
+		var hdr LUKS2BinaryHeader
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &hdr); err != nil {
+			return nil, 0, err
+		}
+		return &luks2Identity{
+			UUID:  string(bytes.TrimRight(hdr.UUID[:], "\x00")),
+			Label: string(bytes.TrimRight(hdr.Label[:], "\x00")),
+		}, LUKS2Version, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported LUKS version %d", version)
+	}
+}
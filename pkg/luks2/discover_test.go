@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeLUKS1Header returns a minimal LUKS1 header with the given UUID
+func fakeLUKS1Header(uuid string) []byte {
+	data := make([]byte, LUKS2HeaderSize)
+	copy(data, LUKS2Magic)
+	binary.BigEndian.PutUint16(data[LUKS2MagicLen:], 1)
+	copy(data[luks1UUIDOffset:], uuid)
+	return data
+}
+
+// TestDiscover tests finding LUKS1 and LUKS2 volumes and their mappings
+func TestDiscover(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+
+	luks2Data, luks2UUID := fakeLUKS2Header(t, "backup")
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", make([]byte, LUKS2HeaderSize))
+	addFakeBlockDevice(t, sys, dev, "sdb", "2048", luks2Data)
+	addFakeBlockDevice(t, sys, dev, "sdc", "2048", fakeLUKS1Header("0b7e6f1c-1111-2222-3333-444455556666"))
+	// Empty device with a header must be skipped
+	addFakeBlockDevice(t, sys, dev, "loop0", "0", luks2Data)
+
+	// sdb is unlocked as "backup"; a non-crypt dm device is ignored
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-0"), map[string]string{
+		"size":    "2048",
+		"dm/name": "backup",
+		"dm/uuid": "CRYPT-LUKS2-0000-backup",
+	})
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-0", "slaves", "sdb"), nil)
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-1"), map[string]string{
+		"size":    "2048",
+		"dm/name": "vg-root",
+		"dm/uuid": "LVM-abc",
+	})
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-1", "slaves", "sdc"), nil)
+
+	volumes, err := Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	want := []DiscoveredVolume{
+		{Device: filepath.Join(dev, "sdb"), UUID: luks2UUID, Label: "backup", Version: 2, Unlocked: true, MappedName: "backup"},
+		{Device: filepath.Join(dev, "sdc"), UUID: "0b7e6f1c-1111-2222-3333-444455556666", Version: 1},
+	}
+	if len(volumes) != len(want) {
+		t.Fatalf("Expected %d volumes, got %+v", len(want), volumes)
+	}
+	for i := range want {
+		if volumes[i] != want[i] {
+			t.Errorf("volume %d = %+v, want %+v", i, volumes[i], want[i])
+		}
+	}
+
+	names, err := ActiveMappings()
+	if err != nil {
+		t.Fatalf("ActiveMappings failed: %v", err)
+	}
+	if len(names) != 1 || names[0] != "backup" {
+		t.Errorf("ActiveMappings = %v, want [backup]", names)
+	}
+}
+
+// TestDiscover_NoSysfs tests the error when block devices cannot be listed
+func TestDiscover_NoSysfs(t *testing.T) {
+	sys, _ := fakeBlockRoots(t)
+	if err := os.RemoveAll(sys); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Discover(); err == nil {
+		t.Error("Expected error without sysfs")
+	}
+}
+
+// TestProbeLUKS_UnsupportedVersion tests that unknown versions are rejected
+func TestProbeLUKS_UnsupportedVersion(t *testing.T) {
+	data := fakeLUKS1Header("x")
+	binary.BigEndian.PutUint16(data[LUKS2MagicLen:], 3)
+	path := filepath.Join(t.TempDir(), "hdr")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := probeLUKS(path); err == nil {
+		t.Error("Expected error for LUKS version 3")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anatol/devmapper.go"
+	"github.com/google/uuid"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// Swap signature layout (struct swap_header in the kernel)
+const (
+	swapVersion       = 1
+	swapInfoOffset    = 1024 // After the boot bits: version
+	swapLastPageField = swapInfoOffset + 4
+	swapUUIDOffset    = swapInfoOffset + 12 // After nr_badpages
+	swapLabelOffset   = swapUUIDOffset + 16
+	swapLabelSize     = 16
+	swapMinPages      = 10 // As mkswap requires
+)
+
+// CreateEphemeral maps device as a plain dm-crypt volume keyed by a fresh
+// random key, the equivalent of a crypttab entry with /dev/urandom as key
+// file. Nothing is written to the device: the key only lives in the kernel,
+// so the contents are lost for good once the mapping is closed. Meant for
+// swap and scratch space whose contents must not outlive a boot.
+//
+// cipher is a dm-crypt cipher specification ("" = aes-xts-plain64). The
+// device is refused if it holds a LUKS header or a filesystem; see
+// CreateEphemeralWithOptions.
+func CreateEphemeral(name, device, cipher string) error {
+	return CreateEphemeralWithOptions(name, device, &EphemeralOptions{Cipher: cipher})
+}
+
+// CreateEphemeralWithOptions maps device like CreateEphemeral and then
+// writes a swap signature or creates a filesystem on the mapping, as the
+// crypttab swap and tmp options do.
+func CreateEphemeralWithOptions(name, device string, opts *EphemeralOptions) (err error) {
+	if opts == nil {
+		opts = &EphemeralOptions{}
+	}
+
+	defer func() {
+		event := Event{Type: EventUnlockSucceeded, Op: "ephemeral", Device: device, Name: name}
+		if err != nil {
+			event.Type = EventUnlockFailed
+			event.Error = err.Error()
+		}
+		emitEvent(event)
+	}()
+
+	cipher, keySize, sectorSize, err := ephemeralParams(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Swap && opts.Filesystem != "" {
+		return errors.New("swap and filesystem are mutually exclusive")
+	}
+	if err := checkKernelCipher(cipher); err != nil {
+		return err
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if IsUnlocked(name) {
+		return fmt.Errorf("%w: %s", ErrVolumeAlreadyUnlocked, name)
+	}
+	realDevice, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		realDevice = device
+	}
+	if !opts.Force {
+		if err := checkEphemeralTarget(realDevice); err != nil {
+			return err
+		}
+	}
+
+	size, err := getBlockDeviceSize(realDevice)
+	if err != nil {
+		return fmt.Errorf("failed to get device size: %w", err)
+	}
+	length := size - opts.Offset
+	length -= length % int64(sectorSize)
+	if opts.Offset < 0 || length <= 0 {
+		return fmt.Errorf("%w: nothing to map after offset %d of %s", ErrInvalidSize, opts.Offset, device)
+	}
+
+	key, err := securemem.NewRandom(keySize / 8)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	defer key.Destroy()
+
+	flags := cryptFlags(&LUKS2Metadata{}, opts.Unlock)
+	if sectorSize > LUKS2SectorSize {
+		flags = append(flags, CryptFlagIVLargeSectors)
+	}
+	table := devmapper.CryptTable{
+		Length:        uint64(length), // #nosec G115 -- positive, checked above
+		BackendDevice: realDevice,
+		BackendOffset: uint64(opts.Offset), // #nosec G115 -- not negative, checked above
+		Encryption:    cipher,
+		Key:           key.Bytes(),
+		Flags:         flags,
+		SectorSize:    uint64(sectorSize), // #nosec G115 -- 512 or 4096
+	}
+	if err := devmapper.CreateAndLoad(name, "CRYPT-PLAIN-"+name, 0, table); err != nil {
+		return fmt.Errorf("failed to create device-mapper: %w", privilegeError("ephemeral", false, err))
+	}
+	_ = ensureDeviceNode(name)
+	if err := waitForDeviceReady(name); err != nil {
+		_ = Lock(name)
+		return fmt.Errorf("device not ready after unlock: %w", err)
+	}
+
+	switch {
+	case opts.Swap:
+		err = writeSwapSignature("/dev/mapper/"+name, opts.Label)
+	case opts.Filesystem != "":
+		err = MakeFilesystemWithOptions(name, FilesystemType(opts.Filesystem), &FilesystemOptions{Label: opts.Label})
+	}
+	if err != nil {
+		_ = Lock(name)
+		return err
+	}
+	return nil
+}
+
+// ephemeralParams applies the defaults of opts and checks them
+func ephemeralParams(opts *EphemeralOptions) (cipher string, keySize, sectorSize int, err error) {
+	cipher = opts.Cipher
+	if cipher == "" {
+		cipher = DefaultEphemeralCipher
+	}
+	if !strings.Contains(cipher, "-") || strings.ContainsAny(cipher, " \t\n") {
+		return "", 0, 0, fmt.Errorf("invalid cipher specification %q (e.g. aes-xts-plain64)", cipher)
+	}
+
+	keySize = opts.KeySize
+	if keySize == 0 {
+		keySize = 256
+		if strings.Contains(cipher, "-xts-") {
+			keySize = DefaultKeySize
+		}
+	}
+	if keySize <= 0 || keySize%8 != 0 || keySize > 1024 {
+		return "", 0, 0, fmt.Errorf("invalid key size %d bits", keySize)
+	}
+
+	sectorSize = opts.SectorSize
+	if sectorSize == 0 {
+		sectorSize = LUKS2SectorSize
+	}
+	if sectorSize != LUKS2SectorSize && sectorSize != 4096 {
+		return "", 0, 0, fmt.Errorf("invalid sector size %d (512 or 4096)", sectorSize)
+	}
+	return cipher, keySize, sectorSize, nil
+}
+
+// checkEphemeralTarget refuses a device holding a LUKS header or a
+// filesystem. An unencrypted swap signature is fine: encrypting an existing
+// swap partition is the usual setup.
+func checkEphemeralTarget(device string) error {
+	f, err := os.Open(device) // #nosec G304 -- device path validated by caller
+	if err != nil {
+		return fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, fsProbeSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read device: %w", err)
+	}
+	buf = buf[:n]
+
+	if bytes.HasPrefix(buf, []byte(LUKS2Magic)) {
+		return fmt.Errorf("%w: %s holds a LUKS header", ErrDeviceNotEmpty, device)
+	}
+	if fs, err := detectFilesystemSignature(buf); err == nil {
+		return fmt.Errorf("%w: %s holds a %s filesystem", ErrDeviceNotEmpty, device, fs)
+	}
+	return nil
+}
+
+// writeSwapSignature makes device a swap area, like mkswap. The first page
+// is cleared and carries the version 1 header with a new UUID.
+func writeSwapSignature(device, label string) error {
+	if len(label) > swapLabelSize {
+		return fmt.Errorf("swap label longer than %d bytes: %q", swapLabelSize, label)
+	}
+
+	f, err := os.OpenFile(device, os.O_RDWR, 0) // #nosec G304 -- device path validated by caller
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", device, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to get size of %s: %w", device, err)
+	}
+	pageSize := os.Getpagesize()
+	pages := size / int64(pageSize)
+	if pages < swapMinPages {
+		return fmt.Errorf("%w: %s is too small for swap (%d bytes)", ErrInvalidSize, device, size)
+	}
+	lastPage := min(pages-1, 1<<32-1)
+
+	page := make([]byte, pageSize)
+	binary.NativeEndian.PutUint32(page[swapInfoOffset:], swapVersion)
+	binary.NativeEndian.PutUint32(page[swapLastPageField:], uint32(lastPage)) // #nosec G115 -- capped above
+	id := uuid.New()
+	copy(page[swapUUIDOffset:], id[:])
+	copy(page[swapLabelOffset:], label)
+	copy(page[pageSize-len(swapMagic):], swapMagic)
+
+	if _, err := f.WriteAt(page, 0); err != nil {
+		return fmt.Errorf("failed to write swap signature: %w", err)
+	}
+	return f.Sync()
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCreateEphemeral tests that an ephemeral swap volume is readable only
+// while mapped: a new mapping has a new key
+func TestCreateEphemeral(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	path := filepath.Join(t.TempDir(), "swap.img")
+	if err := os.WriteFile(path, make([]byte, 16*1024*1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loopDev, err := SetupLoopDevice(path)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	name := "test-ephemeral-swap"
+	if err := CreateEphemeralWithOptions(name, loopDev, &EphemeralOptions{Swap: true, Label: "swap"}); err != nil {
+		t.Fatalf("CreateEphemeral failed: %v", err)
+	}
+	mapped, err := GetMappedDevicePath(name)
+	if err != nil {
+		_ = Lock(name)
+		t.Fatalf("GetMappedDevicePath failed: %v", err)
+	}
+	page := make([]byte, os.Getpagesize())
+	f, err := os.Open(mapped)
+	if err == nil {
+		_, err = f.ReadAt(page, 0)
+		_ = f.Close()
+	}
+	if err != nil || !bytes.HasSuffix(page, []byte(swapMagic)) {
+		t.Errorf("no swap signature on the mapping: %v", err)
+	}
+	if status, err := Status(name); err != nil || status.Type != "PLAIN" {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+	if err := Lock(name); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// The swap signature was encrypted with the old key
+	if err := CreateEphemeral(name, loopDev, ""); err != nil {
+		t.Fatalf("second CreateEphemeral failed: %v", err)
+	}
+	defer Lock(name)
+	f, err = os.Open(mapped)
+	if err == nil {
+		_, err = f.ReadAt(page, 0)
+		_ = f.Close()
+	}
+	if err != nil || bytes.HasSuffix(page, []byte(swapMagic)) {
+		t.Errorf("old contents readable under a new key: %v", err)
+	}
+
+	if err := CreateEphemeral(name, loopDev, ""); !errors.Is(err, ErrVolumeAlreadyUnlocked) {
+		t.Errorf("Expected ErrVolumeAlreadyUnlocked, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeImage writes data to a new file in a temp directory
+func writeImage(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEphemeralParams(t *testing.T) {
+	tests := []struct {
+		opts          EphemeralOptions
+		cipher        string
+		keySize, sect int
+	}{
+		{EphemeralOptions{}, "aes-xts-plain64", 512, 512},
+		{EphemeralOptions{Cipher: "aes-cbc-essiv:sha256"}, "aes-cbc-essiv:sha256", 256, 512},
+		{EphemeralOptions{Cipher: "aes-xts-plain64", KeySize: 256, SectorSize: 4096}, "aes-xts-plain64", 256, 4096},
+	}
+	for _, tt := range tests {
+		cipher, keySize, sect, err := ephemeralParams(&tt.opts)
+		if err != nil || cipher != tt.cipher || keySize != tt.keySize || sect != tt.sect {
+			t.Errorf("ephemeralParams(%+v) = %s, %d, %d, %v", tt.opts, cipher, keySize, sect, err)
+		}
+	}
+
+	for _, opts := range []EphemeralOptions{
+		{Cipher: "aes"},
+		{Cipher: "aes-xts plain64"},
+		{KeySize: 100},
+		{KeySize: -8},
+		{SectorSize: 1024},
+	} {
+		if _, _, _, err := ephemeralParams(&opts); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+}
+
+func TestCheckEphemeralTarget(t *testing.T) {
+	random := make([]byte, 64*1024)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEphemeralTarget(writeImage(t, random)); err != nil {
+		t.Errorf("random data refused: %v", err)
+	}
+
+	// An unencrypted swap area is what encrypted swap usually replaces
+	swap := writeImage(t, make([]byte, 64*1024))
+	if err := writeSwapSignature(swap, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEphemeralTarget(swap); err != nil {
+		t.Errorf("swap area refused: %v", err)
+	}
+
+	header, _ := fakeLUKS2Header(t, "data")
+	if err := checkEphemeralTarget(writeImage(t, header)); !errors.Is(err, ErrDeviceNotEmpty) {
+		t.Errorf("Expected ErrDeviceNotEmpty for a LUKS header, got %v", err)
+	}
+	if err := checkEphemeralTarget(writeImage(t, extImage(0, 0x40, 0))); !errors.Is(err, ErrDeviceNotEmpty) {
+		t.Errorf("Expected ErrDeviceNotEmpty for ext4, got %v", err)
+	}
+}
+
+func TestWriteSwapSignature(t *testing.T) {
+	pageSize := os.Getpagesize()
+	junk := bytes.Repeat([]byte{0xAA}, 16*pageSize)
+	path := writeImage(t, junk)
+	if err := writeSwapSignature(path, "cryptswap"); err != nil {
+		t.Fatalf("writeSwapSignature failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := data[:pageSize]
+	if string(page[pageSize-10:]) != "SWAPSPACE2" {
+		t.Errorf("magic = %q", page[pageSize-10:])
+	}
+	if v := binary.NativeEndian.Uint32(page[1024:]); v != 1 {
+		t.Errorf("version = %d", v)
+	}
+	if last := binary.NativeEndian.Uint32(page[1028:]); last != 15 {
+		t.Errorf("last_page = %d, want 15", last)
+	}
+	if bad := binary.NativeEndian.Uint32(page[1032:]); bad != 0 {
+		t.Errorf("nr_badpages = %d", bad)
+	}
+	if bytes.Equal(page[1036:1052], make([]byte, 16)) {
+		t.Error("no UUID")
+	}
+	if label := string(bytes.TrimRight(page[1052:1068], "\x00")); label != "cryptswap" {
+		t.Errorf("label = %q", label)
+	}
+	if !bytes.Equal(page[:1024], make([]byte, 1024)) || !bytes.Equal(data[pageSize:], junk[pageSize:]) {
+		t.Error("only the first page should change, cleared")
+	}
+
+	if err := writeSwapSignature(path, "a label that is far too long"); err == nil {
+		t.Error("Expected error for a long label")
+	}
+	if err := writeSwapSignature(writeImage(t, make([]byte, 4*pageSize)), ""); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("Expected ErrInvalidSize for a tiny device, got %v", err)
+	}
+}
+
+func TestCreateEphemeral_Invalid(t *testing.T) {
+	if err := CreateEphemeral("eph", "/dev/null", "aes"); err == nil {
+		t.Error("Expected error for an invalid cipher")
+	}
+	err := CreateEphemeralWithOptions("eph", "/dev/null", &EphemeralOptions{Swap: true, Filesystem: "ext4"})
+	if err == nil {
+		t.Error("Expected error for swap and a filesystem")
+	}
+}
@@ -7,6 +7,8 @@ package luks2
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Common errors that can be checked using errors.Is()
@@ -38,6 +40,9 @@ var (
 	// ErrUnsupportedHash indicates the hash algorithm is not supported
 	ErrUnsupportedHash = errors.New("unsupported hash algorithm")
 
+	// ErrInvalidVolumeKey indicates a volume key does not match the header digest
+	ErrInvalidVolumeKey = errors.New("invalid volume key")
+
 	// ErrInvalidKeyslot indicates the keyslot is invalid or unavailable
 	ErrInvalidKeyslot = errors.New("invalid keyslot")
 
@@ -49,6 +54,58 @@ var (
 
 	// ErrPermissionDenied indicates insufficient permissions
 	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrInsufficientMemory indicates a key derivation needs more memory than
+	// is available or allowed
+	ErrInsufficientMemory = errors.New("insufficient memory for key derivation")
+
+	// ErrWeakPassphrase indicates a new passphrase violates the registered
+	// PassphrasePolicy
+	ErrWeakPassphrase = errors.New("weak passphrase")
+
+	// ErrWeakKDF indicates an unlock refused by an enforcing KDFPolicy
+	ErrWeakKDF = errors.New("keyslot KDF below policy")
+
+	// ErrLockedOut indicates unlocking is refused after too many failed attempts
+	ErrLockedOut = errors.New("too many failed unlock attempts")
+
+	// ErrKeyslotAreaFull indicates there is no room left for a new keyslot
+	ErrKeyslotAreaFull = errors.New("keyslots area full")
+
+	// ErrRotationInProgress indicates a volume whose data RotateVolumeKey
+	// has not finished reencrypting
+	ErrRotationInProgress = errors.New("volume key rotation in progress")
+
+	// ErrInvalidSegmentLayout indicates data segments that cannot be mapped
+	ErrInvalidSegmentLayout = errors.New("invalid segment layout")
+
+	// ErrUnsupportedCipher indicates a data segment cipher the userspace
+	// Volume reader cannot decrypt, or a keyslot area encryption no keyslot
+	// can be unlocked with
+	ErrUnsupportedCipher = errors.New("unsupported cipher")
+
+	// ErrNotSupported indicates an operation that needs Linux (device-mapper,
+	// loop devices, mounts) on another platform
+	ErrNotSupported = errors.New("not supported on this platform")
+
+	// ErrVolumeClosed indicates use of an UnlockedVolume after Close
+	ErrVolumeClosed = errors.New("volume closed")
+
+	// ErrHeaderClosed indicates use of a HeaderEditor after Close
+	ErrHeaderClosed = errors.New("header editor closed")
+
+	// ErrUnsupportedFilesystem indicates a filesystem whose allocation
+	// ExportUsed cannot read
+	ErrUnsupportedFilesystem = errors.New("unsupported filesystem")
+
+	// ErrDeviceNotEmpty indicates a device that holds a LUKS header, a
+	// filesystem or another signature where its contents would be destroyed
+	// (Format and CreateEphemeral without Force)
+	ErrDeviceNotEmpty = errors.New("device holds data")
+
+	// ErrBlkidMismatch indicates blkid does not report a volume the way its
+	// header describes it, so udev would not create the expected links
+	ErrBlkidMismatch = errors.New("blkid does not match header")
 )
 
 // DeviceError represents an error related to a specific device
@@ -109,3 +166,110 @@ func (e *CryptoError) Error() string {
 func (e *CryptoError) Unwrap() error {
 	return e.Err
 }
+
+// MemoryError reports a memory-hard key derivation that was refused because
+// it would exceed the available memory or the configured limit
+type MemoryError struct {
+	Required  int64 // Bytes the derivation needs
+	Available int64 // Bytes currently available (0 = unknown)
+	Limit     int64 // Configured limit in bytes (0 = none)
+}
+
+func (e *MemoryError) Error() string {
+	if e.Limit > 0 && e.Required > e.Limit {
+		return fmt.Sprintf("%v: needs %d MiB, limit is %d MiB", ErrInsufficientMemory, e.Required>>20, e.Limit>>20)
+	}
+	return fmt.Sprintf("%v: needs %d MiB, %d MiB available", ErrInsufficientMemory, e.Required>>20, e.Available>>20)
+}
+
+func (e *MemoryError) Unwrap() error {
+	return ErrInsufficientMemory
+}
+
+// WeakPassphraseError reports why a new passphrase was rejected by the
+// registered PassphrasePolicy
+type WeakPassphraseError struct {
+	Reasons  []string
+	Strength PassphraseStrength
+}
+
+func (e *WeakPassphraseError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrWeakPassphrase, strings.Join(e.Reasons, "; "))
+}
+
+func (e *WeakPassphraseError) Unwrap() error {
+	return ErrWeakPassphrase
+}
+
+// WeakKDFError reports the keyslots an enforcing KDFPolicy refused to
+// unlock through
+type WeakKDFError struct {
+	Device  string
+	Reasons []string // One per refused keyslot
+}
+
+func (e *WeakKDFError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrWeakKDF, e.Device, strings.Join(e.Reasons, "; "))
+}
+
+func (e *WeakKDFError) Unwrap() error {
+	return ErrWeakKDF
+}
+
+// LockoutError reports a volume locked out by UnlockWithRetry
+type LockoutError struct {
+	Device   string
+	Failures int       // Consecutive failed attempts
+	Until    time.Time // When attempts are allowed again
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%v: %s locked after %d failures, retry after %s", ErrLockedOut, e.Device, e.Failures, e.Until.Format(time.RFC3339))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrLockedOut
+}
+
+// PrivilegeError reports an operation refused because the process lacks the
+// privileges it needs, typically because it is not running as root
+type PrivilegeError struct {
+	Op      string   // Operation attempted (e.g. "unlock")
+	Missing []string // What is missing (e.g. "CAP_SYS_ADMIN")
+	Err     error    // Error returned by the kernel, if the operation was attempted
+}
+
+func (e *PrivilegeError) Error() string {
+	msg := fmt.Sprintf("%v: %s requires %s", ErrPermissionDenied, e.Op, strings.Join(e.Missing, " and "))
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return msg + "; run as root"
+}
+
+// Unwrap matches both ErrPermissionDenied and the kernel error
+func (e *PrivilegeError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrPermissionDenied}
+	}
+	return []error{ErrPermissionDenied, e.Err}
+}
+
+// BadRegionError reports a device region that could not be read after every
+// attempt allowed by ReadRetry. Offset and Length cover the first run of
+// unreadable 4 KiB sectors, or the whole read when no single sector failed.
+type BadRegionError struct {
+	Device   string
+	Offset   int64 // Byte offset of the region
+	Length   int64 // Length of the region in bytes
+	Attempts int   // Attempts made before giving up
+	Err      error // Error of the last attempt
+}
+
+func (e *BadRegionError) Error() string {
+	return fmt.Sprintf("unreadable region of %s at %d (%d bytes) after %d attempts: %v", e.Device, e.Offset, e.Length, e.Attempts, e.Err)
+}
+
+func (e *BadRegionError) Unwrap() error {
+	return e.Err
+}
@@ -28,6 +28,7 @@ func TestSentinelErrors(t *testing.T) {
 		ErrNoKeyslots,
 		ErrInvalidSize,
 		ErrPermissionDenied,
+		ErrInsufficientMemory,
 	}
 
 	for _, err := range sentinelErrors {
@@ -519,6 +520,42 @@ func TestCryptoErrorNilHandling(t *testing.T) {
 	}
 }
 
+// TestMemoryError tests MemoryError messages and unwrapping
+func TestMemoryError(t *testing.T) {
+	available := &MemoryError{Required: 4 << 30, Available: 1 << 30}
+	if got := available.Error(); got != "insufficient memory for key derivation: needs 4096 MiB, 1024 MiB available" {
+		t.Fatalf("Error() = %q", got)
+	}
+
+	limited := &MemoryError{Required: 1 << 30, Available: 8 << 30, Limit: 512 << 20}
+	if got := limited.Error(); got != "insufficient memory for key derivation: needs 1024 MiB, limit is 512 MiB" {
+		t.Fatalf("Error() = %q", got)
+	}
+
+	if !errors.Is(fmt.Errorf("unlock: %w", available), ErrInsufficientMemory) {
+		t.Fatal("errors.Is() failed for ErrInsufficientMemory")
+	}
+}
+
+func TestPrivilegeError(t *testing.T) {
+	err := &PrivilegeError{Op: "unlock", Missing: []string{"CAP_SYS_ADMIN", "access to /dev/mapper/control"}}
+	if got := err.Error(); got != "permission denied: unlock requires CAP_SYS_ADMIN and access to /dev/mapper/control; run as root" {
+		t.Fatalf("Error() = %q", got)
+	}
+
+	err.Err = errors.New("operation not permitted")
+	if got := err.Error(); got != "permission denied: unlock requires CAP_SYS_ADMIN and access to /dev/mapper/control (operation not permitted); run as root" {
+		t.Fatalf("Error() = %q", got)
+	}
+
+	if !errors.Is(fmt.Errorf("open: %w", err), ErrPermissionDenied) {
+		t.Fatal("errors.Is() failed for ErrPermissionDenied")
+	}
+	if !errors.Is(err, err.Err) {
+		t.Fatal("errors.Is() failed for the kernel error")
+	}
+}
+
 // TestErrorChaining tests error wrapping and chaining
 func TestErrorChaining(t *testing.T) {
 	// Create a chain of errors
@@ -0,0 +1,246 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// TokenTypeEscrow is the token type holding a secret wrapped by a KeyEscrow
+const TokenTypeEscrow = "luks2-escrow"
+
+// Secrets an escrow token can hold
+const (
+	// EscrowSecretVolumeKey is the volume key itself; it opens the volume
+	// even after every keyslot is gone
+	EscrowSecretVolumeKey = "volume-key"
+
+	// EscrowSecretPassphrase is the passphrase of the keyslots listed in
+	// the token, typically a recovery key
+	EscrowSecretPassphrase = "passphrase"
+)
+
+// ErrNoEscrow is returned when a volume has no escrow token for the service
+var ErrNoEscrow = errors.New("no escrow token")
+
+// KeyEscrow wraps secrets with a key held by an external key management
+// service (Vault transit, a cloud KMS) and unwraps them again. The wrapped
+// secret is stored in a LUKS2 token, so the service only ever holds the
+// wrapping key. Implementations are in the escrow subpackage.
+type KeyEscrow interface {
+	// Service identifies the service in escrow tokens (e.g. "vault-transit")
+	Service() string
+
+	// Wrap encrypts secret for the volume with header UUID uuid. Services
+	// that support it bind the ciphertext to the UUID.
+	Wrap(ctx context.Context, uuid string, secret []byte) (*EscrowRecord, error)
+
+	// Unwrap decrypts a record produced by Wrap for the same volume. The
+	// caller clears the returned secret.
+	Unwrap(ctx context.Context, uuid string, rec *EscrowRecord) ([]byte, error)
+}
+
+// EscrowRecord is a secret wrapped by a KeyEscrow
+type EscrowRecord struct {
+	KeyID   string // Wrapping key within the service
+	Wrapped []byte // Wrapped secret, opaque to this package
+}
+
+// EscrowVolumeKey recovers the volume key with passphrase, wraps it with
+// escrow and stores the result in a new token, whose ID is returned.
+//
+// WARNING: whoever can unwrap the token through the service can decrypt the
+// volume, regardless of later passphrase changes. Protect access to the
+// wrapping key accordingly.
+func EscrowVolumeKey(ctx context.Context, device string, passphrase []byte, escrow KeyEscrow) (int, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return -1, err
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return -1, err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return -1, err
+	}
+	masterKey, err := getMasterKey(device, passphrase, metadata)
+	if err != nil {
+		return -1, fmt.Errorf("failed to unlock any keyslot: %w", ErrInvalidPassphrase)
+	}
+	defer masterKey.Destroy()
+
+	return storeEscrow(ctx, device, escrow, EscrowSecretVolumeKey, masterKey.Bytes(), nil)
+}
+
+// EscrowRecoveryKey adds a recovery key to the volume like AddRecoveryKey
+// and escrows it with escrow instead of the volume key. Unlike an escrowed
+// volume key it can be revoked by removing its keyslot. The recovery key is
+// returned so it can also be kept offline; clear its Key when done.
+func EscrowRecoveryKey(ctx context.Context, device string, existingPassphrase []byte, escrow KeyEscrow, opts *RecoveryKeyOptions) (*RecoveryKey, int, error) {
+	recoveryKey, err := AddRecoveryKey(device, existingPassphrase, opts)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	tokenID, err := storeEscrow(ctx, device, escrow, EscrowSecretPassphrase, recoveryKey.Key, []string{strconv.Itoa(recoveryKey.Keyslot)})
+	if err != nil {
+		return recoveryKey, -1, fmt.Errorf("recovery key added to keyslot %d but not escrowed: %w", recoveryKey.Keyslot, err)
+	}
+	return recoveryKey, tokenID, nil
+}
+
+// storeEscrow wraps secret and imports the escrow token into the first free
+// token slot
+func storeEscrow(ctx context.Context, device string, escrow KeyEscrow, kind string, secret []byte, keyslots []string) (int, error) {
+	hdr, _, err := readHeader(device)
+	if err != nil {
+		return -1, err
+	}
+
+	token, err := wrapEscrow(ctx, escrow, headerUUID(hdr), kind, secret, keyslots)
+	if err != nil {
+		return -1, err
+	}
+
+	tokenID, err := FindFreeTokenSlot(device)
+	if err != nil {
+		return -1, err
+	}
+	if err := ImportToken(device, tokenID, token); err != nil {
+		return -1, err
+	}
+	return tokenID, nil
+}
+
+// wrapEscrow wraps secret and builds its escrow token
+func wrapEscrow(ctx context.Context, escrow KeyEscrow, uuid, kind string, secret []byte, keyslots []string) (*Token, error) {
+	rec, err := escrow.Wrap(ctx, uuid, secret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to wrap %s: %w", escrow.Service(), kind, err)
+	}
+	if keyslots == nil {
+		keyslots = []string{}
+	}
+	return &Token{
+		Type:          TokenTypeEscrow,
+		Keyslots:      keyslots,
+		EscrowService: escrow.Service(),
+		EscrowSecret:  kind,
+		EscrowKeyID:   rec.KeyID,
+		EscrowWrapped: base64.StdEncoding.EncodeToString(rec.Wrapped),
+	}, nil
+}
+
+// unwrapEscrow unwraps the secret of the first escrow token of the service
+// that the service accepts, trying tokens in ID order
+func unwrapEscrow(ctx context.Context, escrow KeyEscrow, uuid string, tokens map[string]*Token) ([]byte, *Token, error) {
+	var errs []error
+	for _, id := range sortedIDs(tokens) {
+		token := tokens[id]
+		if token.Type != TokenTypeEscrow || token.EscrowService != escrow.Service() {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(token.EscrowWrapped)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token %s: %w", id, err))
+			continue
+		}
+		secret, err := escrow.Unwrap(ctx, uuid, &EscrowRecord{KeyID: token.EscrowKeyID, Wrapped: wrapped})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token %s: %w", id, err))
+			continue
+		}
+		return secret, token, nil
+	}
+	if len(errs) == 0 {
+		return nil, nil, fmt.Errorf("%w for %s", ErrNoEscrow, escrow.Service())
+	}
+	return nil, nil, fmt.Errorf("%s: failed to unwrap: %w", escrow.Service(), errors.Join(errs...))
+}
+
+// UnlockWithEscrow opens a volume with a secret escrowed for escrow's
+// service, for when local passphrases are lost. An escrowed volume key is
+// verified against the header digest; an escrowed passphrase only tries the
+// keyslots of its token. The dm-crypt flags of opts apply (nil = defaults).
+func UnlockWithEscrow(ctx context.Context, device, name string, escrow KeyEscrow, opts *UnlockOptions) error {
+	if unlocksRegion(opts) {
+		return unlockRegion(device, opts, func(loop string, region *UnlockOptions) error {
+			return UnlockWithEscrow(ctx, loop, name, escrow, region)
+		})
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if IsUnlocked(name) {
+		return fmt.Errorf("device mapper '%s' already exists - close it first with: luks close %s", name, name)
+	}
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+
+	if err := checkKernelCiphers(metadata); err != nil {
+		return err
+	}
+
+	secret, token, err := unwrapEscrow(ctx, escrow, headerUUID(hdr), metadata.Tokens)
+	if err != nil {
+		return err
+	}
+	defer clearBytes(secret)
+
+	volumeKey := secret
+	if token.EscrowSecret == EscrowSecretPassphrase {
+		masterKey, err := escrowedPassphraseKey(device, secret, metadata, token)
+		if err != nil {
+			return err
+		}
+		defer masterKey.Destroy()
+		volumeKey = masterKey.Bytes()
+	} else if err := verifyVolumeKey(volumeKey, metadata); err != nil {
+		return err
+	}
+
+	realDevice, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		realDevice = device
+	}
+	if err := activateVolume(device, realDevice, hdr, metadata, volumeKey, name, cryptFlags(metadata, opts)); err != nil {
+		return err
+	}
+	return autoDetachLoop(realDevice, name, opts)
+}
+
+// escrowedPassphraseKey recovers the master key with an escrowed passphrase
+// from the keyslots its token lists
+func escrowedPassphraseKey(device string, passphrase []byte, metadata *LUKS2Metadata, token *Token) (*securemem.Buffer, error) {
+	var errs []error
+	for _, slot := range token.Keyslots {
+		n, err := strconv.Atoi(slot)
+		if err != nil {
+			continue
+		}
+		masterKey, _, err := getMasterKeyWithOptions(device, passphrase, metadata, &UnlockOptions{Keyslot: &n})
+		if err == nil {
+			return masterKey, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("escrowed passphrase opens none of keyslots %v: %w", token.Keyslots, errors.Join(append(errs, ErrInvalidPassphrase)...))
+}
+
+// headerUUID returns the UUID of a binary header as a string
+func headerUUID(hdr *LUKS2BinaryHeader) string {
+	return string(TrimRight(hdr.UUID[:], "\x00"))
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ServiceAWSKMS identifies AWS KMS in escrow tokens
+const ServiceAWSKMS = "aws-kms"
+
+// awsContextKey is the encryption context key holding the volume UUID
+const awsContextKey = "luks2-volume"
+
+// awsRegionPattern guards the region, which becomes part of the host name
+var awsRegionPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// AWSCredentials are AWS access keys
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // For temporary credentials
+}
+
+// AWSKMS wraps secrets with a symmetric AWS KMS key, calling the KMS API
+// directly. The volume UUID is the encryption context, so a ciphertext only
+// decrypts for its volume; key policies can also condition on
+// kms:EncryptionContext:luks2-volume. The identity needs kms:Encrypt to
+// escrow and kms:Decrypt to unlock.
+//
+// On EC2 no configuration is needed to unlock: the region comes from the key
+// ARN recorded in the token and credentials from the instance profile.
+type AWSKMS struct {
+	// KeyID is the key ID, ARN or alias that Wrap uses. Unwrap uses the key
+	// ARN recorded in the token.
+	KeyID string
+
+	// Region is used when the key is not given as an ARN ("" = AWS_REGION,
+	// AWS_DEFAULT_REGION or the instance's region)
+	Region string
+
+	// Endpoint overrides https://kms.<region>.amazonaws.com, e.g. for a VPC
+	// endpoint
+	Endpoint string
+
+	// Credentials returns the credentials to sign requests with (nil =
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, or the
+	// instance profile through IMDSv2)
+	Credentials func(ctx context.Context) (*AWSCredentials, error)
+
+	Client *http.Client // HTTP client (nil = 30s timeout)
+}
+
+// AWSKMSFromEnv configures AWSKMS from LUKS2_AWS_KMS_KEY_ID, AWS_REGION and
+// AWS_DEFAULT_REGION. Nothing is required; a key ID is only needed to escrow.
+func AWSKMSFromEnv() (*AWSKMS, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return &AWSKMS{KeyID: os.Getenv("LUKS2_AWS_KMS_KEY_ID"), Region: region}, nil
+}
+
+// Service returns ServiceAWSKMS
+func (k *AWSKMS) Service() string {
+	return ServiceAWSKMS
+}
+
+// Wrap encrypts secret with KeyID
+func (k *AWSKMS) Wrap(ctx context.Context, uuid string, secret []byte) (*luks2.EscrowRecord, error) {
+	if k.KeyID == "" {
+		return nil, fmt.Errorf("aws kms key ID not configured")
+	}
+
+	req := map[string]any{
+		"KeyId":             k.KeyID,
+		"Plaintext":         base64.StdEncoding.EncodeToString(secret),
+		"EncryptionContext": map[string]string{awsContextKey: uuid},
+	}
+	var resp struct {
+		CiphertextBlob string `json:"CiphertextBlob"`
+		KeyID          string `json:"KeyId"`
+	}
+	if err := k.call(ctx, "Encrypt", k.KeyID, req, &resp); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.CiphertextBlob)
+	if err != nil || len(wrapped) == 0 {
+		return nil, fmt.Errorf("aws kms returned no valid ciphertext")
+	}
+	keyID := resp.KeyID
+	if keyID == "" {
+		keyID = k.KeyID
+	}
+	return &luks2.EscrowRecord{KeyID: keyID, Wrapped: wrapped}, nil
+}
+
+// Unwrap decrypts a ciphertext produced by Wrap
+func (k *AWSKMS) Unwrap(ctx context.Context, uuid string, rec *luks2.EscrowRecord) ([]byte, error) {
+	req := map[string]any{
+		"KeyId":             rec.KeyID,
+		"CiphertextBlob":    base64.StdEncoding.EncodeToString(rec.Wrapped),
+		"EncryptionContext": map[string]string{awsContextKey: uuid},
+	}
+	var resp struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := k.call(ctx, "Decrypt", rec.KeyID, req, &resp); err != nil {
+		return nil, err
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from aws kms: %w", err)
+	}
+	return secret, nil
+}
+
+// call invokes a KMS API action on key
+func (k *AWSKMS) call(ctx context.Context, action, key string, in, out any) error {
+	err := func() error {
+		region, err := k.region(ctx, key)
+		if err != nil {
+			return err
+		}
+		creds, err := k.credentials(ctx)
+		if err != nil {
+			return fmt.Errorf("no credentials: %w", err)
+		}
+
+		endpoint := k.Endpoint
+		if endpoint == "" {
+			endpoint = "https://kms." + region + ".amazonaws.com"
+		}
+		body, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		defer clear(body)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, joinURL(endpoint, ""), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "TrentService."+action)
+		signV4(req, body, creds, region, "kms", time.Now())
+
+		return doJSON(k.Client, req, out, awsError)
+	}()
+	if err != nil {
+		return fmt.Errorf("aws kms %s with key %s: %w", action, key, err)
+	}
+	return nil
+}
+
+// region picks the region of key: that of its ARN, else the configured
+// one, else the instance's
+func (k *AWSKMS) region(ctx context.Context, key string) (string, error) {
+	region := k.Region
+	if parts := strings.Split(key, ":"); len(parts) >= 6 && parts[0] == "arn" && parts[2] == "kms" {
+		region = parts[3]
+	}
+	if region == "" {
+		token, err := imdsToken(ctx)
+		if err != nil {
+			return "", fmt.Errorf("region not configured and instance metadata unavailable: %w", err)
+		}
+		data, err := metadata(ctx, http.MethodGet, awsMetadataURL+"/latest/meta-data/placement/region", http.Header{"X-Aws-Ec2-Metadata-Token": {token}})
+		if err != nil {
+			return "", fmt.Errorf("region not configured and instance metadata unavailable: %w", err)
+		}
+		region = strings.TrimSpace(string(data))
+	}
+	if !awsRegionPattern.MatchString(region) {
+		return "", fmt.Errorf("invalid region %q", region)
+	}
+	return region, nil
+}
+
+// credentials returns the configured credentials, those in the environment
+// or those of the instance profile
+func (k *AWSKMS) credentials(ctx context.Context) (*AWSCredentials, error) {
+	if k.Credentials != nil {
+		return k.Credentials(ctx)
+	}
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &AWSCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	return instanceCredentials(ctx)
+}
+
+// imdsToken gets an IMDSv2 session token
+func imdsToken(ctx context.Context) (string, error) {
+	data, err := metadata(ctx, http.MethodPut, awsMetadataURL+"/latest/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"300"}})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// instanceCredentials fetches the temporary credentials of the EC2 instance
+// profile
+func instanceCredentials(ctx context.Context) (*AWSCredentials, error) {
+	token, err := imdsToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	base := awsMetadataURL + "/latest/meta-data/iam/security-credentials/"
+
+	roles, err := metadata(ctx, http.MethodGet, base, header)
+	if err != nil {
+		return nil, err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return nil, fmt.Errorf("instance has no IAM role")
+	}
+
+	data, err := metadata(ctx, http.MethodGet, base+role, header)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+
+	var resp struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid instance credentials: %w", err)
+	}
+	return &AWSCredentials{AccessKeyID: resp.AccessKeyID, SecretAccessKey: resp.SecretAccessKey, SessionToken: resp.Token}, nil
+}
+
+// signV4 signs req with AWS Signature Version 4, covering the host and
+// every header already set
+func signV4(req *http.Request, body []byte, creds *AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsError extracts the type and message of an AWS JSON error response
+func awsError(body []byte) string {
+	var resp struct {
+		Type        string `json:"__type"`
+		Message     string `json:"message"`
+		MessageCaps string `json:"Message"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return ""
+	}
+	msg := resp.Message
+	if msg == "" {
+		msg = resp.MessageCaps
+	}
+	errType := resp.Type[strings.LastIndex(resp.Type, "#")+1:]
+	switch {
+	case errType != "" && msg != "":
+		return errType + ": " + msg
+	case errType != "":
+		return errType
+	}
+	return msg
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ServiceAzureKeyVault identifies Azure Key Vault in escrow tokens
+const ServiceAzureKeyVault = "azure-keyvault"
+
+// azureAPIVersion is the Key Vault REST API version used
+const azureAPIVersion = "7.4"
+
+// azureVaultDomains are the Key Vault DNS suffixes of the Azure clouds. Key
+// IDs read from a token must point into one of them (or VaultURL), since
+// the access token is sent there.
+var azureVaultDomains = []string{
+	".vault.azure.net",
+	".vault.azure.cn",
+	".vault.usgovcloudapi.net",
+}
+
+// AzureKeyVault wraps secrets with an RSA key in Azure Key Vault using the
+// wrapkey and unwrapkey operations. RSA key wrapping has no
+// associated data, so unlike the other services the ciphertext is not bound
+// to the volume. The identity needs the wrapKey permission (Key Vault
+// Crypto User role) to escrow and unwrapKey to unlock.
+//
+// On Azure VMs no configuration is needed to unlock: the key ID is recorded
+// in the token and the access token comes from the managed identity.
+type AzureKeyVault struct {
+	// VaultURL is the vault that Wrap uses, e.g.
+	// https://myvault.vault.azure.net. Unwrap uses the versioned key ID
+	// recorded in the token.
+	VaultURL string
+
+	// KeyName and KeyVersion select the key ("" version = current)
+	KeyName    string
+	KeyVersion string
+
+	// Algorithm is the wrapping algorithm (default: RSA-OAEP-256)
+	Algorithm string
+
+	// AccessToken returns an OAuth2 access token for https://vault.azure.net
+	// (nil = AZURE_ACCESS_TOKEN, or the VM's managed identity, selected by
+	// AZURE_CLIENT_ID if set)
+	AccessToken func(ctx context.Context) (string, error)
+
+	Client *http.Client // HTTP client (nil = 30s timeout)
+}
+
+// AzureKeyVaultFromEnv configures AzureKeyVault from LUKS2_AZURE_VAULT_URL
+// and LUKS2_AZURE_KEY (name[/version]). Nothing is required; a vault and
+// key are only needed to escrow.
+func AzureKeyVaultFromEnv() (*AzureKeyVault, error) {
+	name, version, _ := strings.Cut(os.Getenv("LUKS2_AZURE_KEY"), "/")
+	return &AzureKeyVault{VaultURL: os.Getenv("LUKS2_AZURE_VAULT_URL"), KeyName: name, KeyVersion: version}, nil
+}
+
+// Service returns ServiceAzureKeyVault
+func (k *AzureKeyVault) Service() string {
+	return ServiceAzureKeyVault
+}
+
+// Wrap wraps secret with the configured key
+func (k *AzureKeyVault) Wrap(ctx context.Context, uuid string, secret []byte) (*luks2.EscrowRecord, error) {
+	if k.VaultURL == "" || k.KeyName == "" {
+		return nil, fmt.Errorf("azure key vault URL and key name not configured")
+	}
+
+	keyID := joinURL(k.VaultURL, "keys", url.PathEscape(k.KeyName))
+	if k.KeyVersion != "" {
+		keyID = joinURL(keyID, url.PathEscape(k.KeyVersion))
+	}
+	var resp struct {
+		KeyID string `json:"kid"`
+		Value string `json:"value"`
+	}
+	if err := k.call(ctx, "wrapkey", keyID, secret, &resp); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(resp.Value)
+	if err != nil || len(wrapped) == 0 {
+		return nil, fmt.Errorf("azure key vault returned no valid ciphertext")
+	}
+	// The returned key ID includes the version, which unwrapping needs
+	if resp.KeyID != "" {
+		keyID = resp.KeyID
+	}
+	return &luks2.EscrowRecord{KeyID: keyID, Wrapped: wrapped}, nil
+}
+
+// Unwrap unwraps a ciphertext produced by Wrap
+func (k *AzureKeyVault) Unwrap(ctx context.Context, uuid string, rec *luks2.EscrowRecord) ([]byte, error) {
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := k.call(ctx, "unwrapkey", rec.KeyID, rec.Wrapped, &resp); err != nil {
+		return nil, err
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from azure key vault: %w", err)
+	}
+	return secret, nil
+}
+
+// call invokes a key operation on the key with ID keyID
+func (k *AzureKeyVault) call(ctx context.Context, op, keyID string, value []byte, out any) error {
+	err := func() error {
+		if err := k.checkKeyID(keyID); err != nil {
+			return err
+		}
+		token, err := k.accessToken(ctx)
+		if err != nil {
+			return fmt.Errorf("no access token: %w", err)
+		}
+
+		alg := k.Algorithm
+		if alg == "" {
+			alg = "RSA-OAEP-256"
+		}
+		req := map[string]string{"alg": alg, "value": base64.RawURLEncoding.EncodeToString(value)}
+		header := http.Header{"Authorization": {"Bearer " + token}}
+		return postJSON(ctx, k.Client, joinURL(keyID, op)+"?api-version="+azureAPIVersion, header, req, out, cloudError)
+	}()
+	if err != nil {
+		return fmt.Errorf("azure key vault %s with key %s: %w", op, keyID, err)
+	}
+	return nil
+}
+
+// checkKeyID makes sure a key ID points into VaultURL or a Key Vault domain
+// over HTTPS, so a tampered token cannot collect the access token
+func (k *AzureKeyVault) checkKeyID(keyID string) error {
+	if k.VaultURL != "" && strings.HasPrefix(keyID, strings.TrimRight(k.VaultURL, "/")+"/") {
+		return nil
+	}
+	u, err := url.Parse(keyID)
+	if err != nil || u.Scheme != "https" {
+		return fmt.Errorf("invalid key ID")
+	}
+	for _, domain := range azureVaultDomains {
+		if strings.HasSuffix(u.Hostname(), domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("key ID is not in an Azure Key Vault domain or the configured vault")
+}
+
+// accessToken returns the configured token, the one in the environment or
+// one for the VM's managed identity
+func (k *AzureKeyVault) accessToken(ctx context.Context) (string, error) {
+	if k.AccessToken != nil {
+		return k.AccessToken(ctx)
+	}
+	if token := os.Getenv("AZURE_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {"https://vault.azure.net"}}
+	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+		query.Set("client_id", clientID)
+	}
+	return metadataToken(ctx, azureMetadataURL+"/metadata/identity/oauth2/token?"+query.Encode(),
+		http.Header{"Metadata": {"true"}})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Instance metadata services, which hand out credentials of the identity
+// attached to a cloud VM. Variables so tests can point them elsewhere.
+var (
+	awsMetadataURL   = "http://169.254.169.254"
+	gcpMetadataURL   = "http://metadata.google.internal"
+	azureMetadataURL = "http://169.254.169.254"
+)
+
+// errNoAccessToken is returned when a metadata service response lacks a
+// token
+var errNoAccessToken = errors.New("metadata service returned no access token")
+
+// metadataClient talks to instance metadata services. They are link-local,
+// so requests never go through a proxy and fail fast off the cloud.
+var metadataClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{Proxy: nil},
+}
+
+// metadata sends a request to an instance metadata service and returns the
+// response body
+func metadata(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return do(metadataClient, req, nil)
+}
+
+// metadataToken fetches an OAuth2 access token from a metadata service
+func metadataToken(ctx context.Context, url string, header http.Header) (string, error) {
+	data, err := metadata(ctx, http.MethodGet, url, header)
+	if err != nil {
+		return "", err
+	}
+	defer clear(data)
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || resp.AccessToken == "" {
+		return "", errNoAccessToken
+	}
+	return resp.AccessToken, nil
+}
+
+// cloudError extracts the message of a Google or Azure API error response
+// ({"error": {"code": ..., "message": ...}})
+func cloudError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Code    any    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return ""
+	}
+	return strings.TrimSpace(resp.Error.Message)
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package escrow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+const testKeyARN = "arn:aws:kms:us-east-1:111122223333:key/1234abcd"
+
+// fakeMetadata serves the AWS, GCP and Azure instance metadata endpoints
+// and points the package at it
+func fakeMetadata(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("imds-token"))
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token" && strings.HasPrefix(r.URL.Path, "/latest/"):
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte("us-east-1"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("luks-role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/luks-role":
+			_ = json.NewEncoder(w).Encode(map[string]string{"AccessKeyId": "AKIDINSTANCE", "SecretAccessKey": "secret", "Token": "session"})
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token" && r.Header.Get("Metadata-Flavor") == "Google":
+			_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "gcp-token"})
+		case r.URL.Path == "/metadata/identity/oauth2/token" && r.Header.Get("Metadata") == "true" && r.URL.Query().Get("resource") == "https://vault.azure.net":
+			_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "azure-token"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	saved := []string{awsMetadataURL, gcpMetadataURL, azureMetadataURL}
+	awsMetadataURL, gcpMetadataURL, azureMetadataURL = srv.URL, srv.URL, srv.URL
+	t.Cleanup(func() { awsMetadataURL, gcpMetadataURL, azureMetadataURL = saved[0], saved[1], saved[2] })
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "GOOGLE_OAUTH_ACCESS_TOKEN", "AZURE_ACCESS_TOKEN", "AZURE_CLIENT_ID"} {
+		t.Setenv(name, "")
+	}
+}
+
+// fakeAWSKMS serves the Encrypt and Decrypt actions, checking that requests
+// are signed with the instance credentials
+func fakeAWSKMS(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := newSealer(t)
+	fail := func(w http.ResponseWriter, errType, msg string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": errType, "message": msg})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDINSTANCE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-east-1/kms/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			fail(w, "UnrecognizedClientException", "bad signature")
+			return
+		}
+		var req struct {
+			KeyID             string            `json:"KeyId"`
+			Plaintext         string            `json:"Plaintext"`
+			CiphertextBlob    string            `json:"CiphertextBlob"`
+			EncryptionContext map[string]string `json:"EncryptionContext"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		context := []byte(req.EncryptionContext[awsContextKey])
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			plaintext, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+			_ = json.NewEncoder(w).Encode(map[string]string{"KeyId": testKeyARN, "CiphertextBlob": base64.StdEncoding.EncodeToString(s.seal(plaintext, context))})
+		case "TrentService.Decrypt":
+			sealed, _ := base64.StdEncoding.DecodeString(req.CiphertextBlob)
+			plaintext, err := s.open(sealed, context)
+			if err != nil || req.KeyID != testKeyARN {
+				fail(w, "com.amazonaws.kms#InvalidCiphertextException", "")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"KeyId": testKeyARN, "Plaintext": base64.StdEncoding.EncodeToString(plaintext)})
+		default:
+			fail(w, "UnknownOperationException", "")
+		}
+	}))
+}
+
+// TestAWSKMS tests wrapping with instance credentials and region
+func TestAWSKMS(t *testing.T) {
+	fakeMetadata(t)
+	srv := fakeAWSKMS(t)
+	defer srv.Close()
+
+	rec := testRoundTrip(t, &AWSKMS{KeyID: "alias/luks", Endpoint: srv.URL})
+	if rec.KeyID != testKeyARN {
+		t.Errorf("KeyID = %s, want the key ARN", rec.KeyID)
+	}
+
+	_, err := (&AWSKMS{Endpoint: srv.URL}).Unwrap(context.Background(), "uuid-2", rec)
+	if err == nil || !strings.Contains(err.Error(), "InvalidCiphertextException") {
+		t.Errorf("Unwrap for another volume = %v, want the AWS error type", err)
+	}
+}
+
+// TestAWSKMS_Region tests picking the region of a request
+func TestAWSKMS_Region(t *testing.T) {
+	ctx := context.Background()
+	k := &AWSKMS{Region: "eu-west-1"}
+
+	if region, _ := k.region(ctx, testKeyARN); region != "us-east-1" {
+		t.Errorf("region of an ARN = %s, want us-east-1", region)
+	}
+	if region, _ := k.region(ctx, "alias/luks"); region != "eu-west-1" {
+		t.Errorf("region of an alias = %s, want eu-west-1", region)
+	}
+	if _, err := k.region(ctx, "arn:aws:kms:evil.example.com/x:1:key/1"); err == nil {
+		t.Error("region accepted a host name")
+	}
+}
+
+// TestSignV4 tests signing against the get-vanilla case of the AWS
+// Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestGCPKMS tests wrapping with the VM's service account
+func TestGCPKMS(t *testing.T) {
+	fakeMetadata(t)
+	const key = "projects/p/locations/global/keyRings/r/cryptoKeys/luks"
+	s := newSealer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"code": 401, "message": "Request had invalid authentication credentials."}}`))
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		aad, _ := base64.StdEncoding.DecodeString(req["additionalAuthenticatedData"])
+
+		switch r.URL.Path {
+		case "/v1/" + key + ":encrypt":
+			plaintext, _ := base64.StdEncoding.DecodeString(req["plaintext"])
+			_ = json.NewEncoder(w).Encode(map[string]string{"name": key + "/cryptoKeyVersions/1", "ciphertext": base64.StdEncoding.EncodeToString(s.seal(plaintext, aad))})
+		case "/v1/" + key + ":decrypt":
+			sealed, _ := base64.StdEncoding.DecodeString(req["ciphertext"])
+			plaintext, err := s.open(sealed, aad)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error": {"code": 400, "message": "Decryption failed: the ciphertext is invalid.", "status": "INVALID_ARGUMENT"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	rec := testRoundTrip(t, &GCPKMS{KeyName: key, Endpoint: srv.URL})
+	if rec.KeyID != key {
+		t.Errorf("KeyID = %s, want %s", rec.KeyID, key)
+	}
+
+	_, err := (&GCPKMS{Endpoint: srv.URL, AccessToken: func(context.Context) (string, error) { return "expired", nil }}).Unwrap(context.Background(), "uuid-1", rec)
+	if err == nil || !strings.Contains(err.Error(), "invalid authentication credentials") {
+		t.Errorf("Unwrap with a bad token = %v, want the API error", err)
+	}
+	if _, err := (&GCPKMS{KeyName: "../../other", Endpoint: srv.URL}).Wrap(context.Background(), "uuid-1", []byte("x")); err == nil {
+		t.Error("Wrap accepted an invalid key name")
+	}
+}
+
+// TestAzureKeyVault tests wrapping with the VM's managed identity
+func TestAzureKeyVault(t *testing.T) {
+	fakeMetadata(t)
+	s := newSealer(t)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer azure-token" || r.URL.Query().Get("api-version") != azureAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		value, _ := base64.RawURLEncoding.DecodeString(req["value"])
+
+		switch r.URL.Path {
+		case "/keys/luks/wrapkey":
+			_ = json.NewEncoder(w).Encode(map[string]string{"kid": srv.URL + "/keys/luks/v1", "value": base64.RawURLEncoding.EncodeToString(s.seal(value, nil))})
+		case "/keys/luks/v1/unwrapkey":
+			plaintext, err := s.open(value, nil)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error": {"code": "BadParameter", "message": "Invalid ciphertext"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"kid": srv.URL + "/keys/luks/v1", "value": base64.RawURLEncoding.EncodeToString(plaintext)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	k := &AzureKeyVault{VaultURL: srv.URL, KeyName: "luks"}
+	secret := []byte("volume key material")
+	rec, err := k.Wrap(ctx, "uuid-1", secret)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if rec.KeyID != srv.URL+"/keys/luks/v1" {
+		t.Errorf("KeyID = %s, want the versioned key", rec.KeyID)
+	}
+	if got, err := k.Unwrap(ctx, "uuid-1", rec); err != nil || string(got) != string(secret) {
+		t.Errorf("Unwrap = %q, %v", got, err)
+	}
+
+	bad := &luks2.EscrowRecord{KeyID: rec.KeyID, Wrapped: []byte("garbage")}
+	if _, err := k.Unwrap(ctx, "uuid-1", bad); err == nil || !strings.Contains(err.Error(), "Invalid ciphertext") {
+		t.Errorf("Unwrap of garbage = %v, want the API error", err)
+	}
+}
+
+// TestAzureKeyVault_CheckKeyID tests that tokens cannot redirect the access
+// token outside Key Vault
+func TestAzureKeyVault_CheckKeyID(t *testing.T) {
+	k := &AzureKeyVault{VaultURL: "https://private.example.com"}
+	tests := map[string]bool{
+		"https://myvault.vault.azure.net/keys/luks/v1":         true,
+		"https://myvault.vault.usgovcloudapi.net/keys/luks/v1": true,
+		"https://private.example.com/keys/luks/v1":             true,
+		"http://myvault.vault.azure.net/keys/luks/v1":          false,
+		"https://vault.azure.net.evil.example/keys/luks/v1":    false,
+		"https://private.example.com.evil/keys/luks/v1":        false,
+	}
+	for keyID, ok := range tests {
+		if err := k.checkKeyID(keyID); (err == nil) != ok {
+			t.Errorf("checkKeyID(%s) = %v, want ok=%v", keyID, err, ok)
+		}
+	}
+}
+
+// TestFromEnv_Cloud tests configuring the cloud escrows from the
+// environment
+func TestFromEnv_Cloud(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-central-1")
+	t.Setenv("LUKS2_AWS_KMS_KEY_ID", "alias/luks")
+	t.Setenv("LUKS2_GCP_KMS_KEY", "projects/p/locations/l/keyRings/r/cryptoKeys/k")
+	t.Setenv("LUKS2_AZURE_VAULT_URL", "https://myvault.vault.azure.net")
+	t.Setenv("LUKS2_AZURE_KEY", "luks/v2")
+
+	e, _ := FromEnv("aws")
+	if k := e.(*AWSKMS); k.KeyID != "alias/luks" || k.Region != "eu-central-1" {
+		t.Errorf("FromEnv(aws) = %+v", k)
+	}
+	e, _ = FromEnv(ServiceGCPKMS)
+	if k := e.(*GCPKMS); k.KeyName != "projects/p/locations/l/keyRings/r/cryptoKeys/k" {
+		t.Errorf("FromEnv(gcp-kms) = %+v", k)
+	}
+	e, _ = FromEnv("azure")
+	if k := e.(*AzureKeyVault); k.VaultURL != "https://myvault.vault.azure.net" || k.KeyName != "luks" || k.KeyVersion != "v2" {
+		t.Errorf("FromEnv(azure) = %+v", k)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package escrow implements luks2.KeyEscrow for HashiCorp Vault's transit
+// secrets engine, AWS KMS, Google Cloud KMS, Azure Key Vault and a generic
+// HTTP key management service. Pass one to
+// luks2.FormatOptions.Escrow, luks2.EscrowVolumeKey or
+// luks2.EscrowRecoveryKey to store a wrapped secret in the volume header,
+// and to luks2.UnlockWithEscrow to open the volume with it later.
+//
+// The cloud services authenticate with the identity attached to the VM
+// through its instance metadata service, and record the key in the token.
+// Unlocking a cloud VM at boot therefore needs no local secret and no
+// configuration; access is controlled entirely by the KMS key policy.
+//
+// Secrets cross the network inside JSON request bodies. The encoded bodies
+// are cleared after each request, but the base64 strings and copies made by
+// the HTTP stack cannot be. Always use TLS.
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// defaultTimeout bounds a request when no http.Client is configured
+const defaultTimeout = 30 * time.Second
+
+// maxResponseSize caps how much of a response is read
+const maxResponseSize = 1 << 20
+
+// FromEnv returns the escrow for service configured from the environment.
+// Services are named by their short name or token service name: "vault"
+// (vault-transit), "kms" (http-kms), "aws" (aws-kms), "gcp" (gcp-kms) and
+// "azure" (azure-keyvault).
+func FromEnv(service string) (luks2.KeyEscrow, error) {
+	switch service {
+	case "vault", ServiceVaultTransit:
+		return VaultFromEnv()
+	case "kms", ServiceHTTPKMS:
+		return HTTPKMSFromEnv()
+	case "aws", ServiceAWSKMS:
+		return AWSKMSFromEnv()
+	case "gcp", ServiceGCPKMS:
+		return GCPKMSFromEnv()
+	case "azure", ServiceAzureKeyVault:
+		return AzureKeyVaultFromEnv()
+	}
+	return nil, fmt.Errorf("unknown escrow service %q (want vault, kms, aws, gcp or azure)", service)
+}
+
+// getenv returns the value of an environment variable that must be set
+func getenv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return value, nil
+}
+
+// postJSON sends in as a JSON POST request and decodes the response into
+// out. The encoded request body is cleared afterwards since it may hold a
+// secret. errMsg extracts the service's error message from a failed
+// response body.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, in, out any, errMsg func([]byte) string) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	defer clear(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doJSON(client, req, out, errMsg)
+}
+
+// doJSON sends req and decodes the JSON response into out
+func doJSON(client *http.Client, req *http.Request, out any, errMsg func([]byte) string) error {
+	data, err := do(client, req, errMsg)
+	if err != nil {
+		return err
+	}
+	defer clear(data)
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// do sends req and returns the response body, or an error for a non-2xx
+// status. The caller clears the body if it holds a secret.
+func do(client *http.Client, req *http.Request, errMsg func([]byte) string) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req) // #nosec G107 -- URL configured by the caller
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer clear(data)
+		if errMsg != nil {
+			if msg := errMsg(data); msg != "" {
+				return nil, fmt.Errorf("%s: %s", resp.Status, msg)
+			}
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return data, nil
+}
+
+// joinURL appends path segments to a base URL
+func joinURL(base string, segments ...string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package escrow
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// sealer is the fake services' key: AES-GCM with the context as associated
+// data and a zero nonce, which is fine for a test
+type sealer struct{ aead cipher.AEAD }
+
+func newSealer(t *testing.T) *sealer {
+	t.Helper()
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sealer{aead: aead}
+}
+
+func (s *sealer) seal(plaintext, context []byte) []byte {
+	return s.aead.Seal(nil, make([]byte, s.aead.NonceSize()), plaintext, context)
+}
+
+func (s *sealer) open(ciphertext, context []byte) ([]byte, error) {
+	return s.aead.Open(nil, make([]byte, s.aead.NonceSize()), ciphertext, context)
+}
+
+// fakeVault serves the transit encrypt and decrypt endpoints for key "luks"
+func fakeVault(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := newSealer(t)
+	fail := func(w http.ResponseWriter, code int, msg string) {
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			fail(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		context, _ := base64.StdEncoding.DecodeString(req["context"])
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/luks":
+			plaintext, _ := base64.StdEncoding.DecodeString(req["plaintext"])
+			ciphertext := "vault:v1:" + base64.StdEncoding.EncodeToString(s.seal(plaintext, context))
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": ciphertext}})
+		case "/v1/transit/decrypt/luks":
+			sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(req["ciphertext"], "vault:v1:"))
+			plaintext, err := s.open(sealed, context)
+			if err != nil {
+				fail(w, http.StatusBadRequest, "cipher: message authentication failed")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}})
+		default:
+			fail(w, http.StatusNotFound, "no handler for route")
+		}
+	}))
+}
+
+// fakeKMS serves the wrap and unwrap endpoints of the HTTP KMS protocol
+func fakeKMS(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := newSealer(t)
+	fail := func(w http.ResponseWriter, code int, msg string) {
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			fail(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var req kmsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		switch r.URL.Path {
+		case "/wrap":
+			plaintext, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+			_ = json.NewEncoder(w).Encode(kmsResponse{KeyID: req.KeyID + "/v2", Ciphertext: base64.StdEncoding.EncodeToString(s.seal(plaintext, []byte(req.Context)))})
+		case "/unwrap":
+			if req.KeyID != "luks/v2" {
+				fail(w, http.StatusNotFound, "unknown key "+req.KeyID)
+				return
+			}
+			sealed, _ := base64.StdEncoding.DecodeString(req.Ciphertext)
+			plaintext, err := s.open(sealed, []byte(req.Context))
+			if err != nil {
+				fail(w, http.StatusBadRequest, "context mismatch")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(kmsResponse{Plaintext: base64.StdEncoding.EncodeToString(plaintext)})
+		default:
+			fail(w, http.StatusNotFound, "not found")
+		}
+	}))
+}
+
+// testRoundTrip wraps and unwraps a secret, and checks that the ciphertext
+// is bound to the volume
+func testRoundTrip(t *testing.T, escrow luks2.KeyEscrow) *luks2.EscrowRecord {
+	t.Helper()
+	ctx := context.Background()
+	secret := []byte("volume key material")
+
+	rec, err := escrow.Wrap(ctx, "uuid-1", secret)
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	got, err := escrow.Unwrap(ctx, "uuid-1", rec)
+	if err != nil {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+	if string(got) != string(secret) {
+		t.Errorf("Unwrap = %q, want %q", got, secret)
+	}
+	if _, err := escrow.Unwrap(ctx, "uuid-2", rec); err == nil {
+		t.Error("Unwrap succeeded for another volume")
+	}
+	return rec
+}
+
+// TestVaultTransit tests wrapping through the transit engine
+func TestVaultTransit(t *testing.T) {
+	srv := fakeVault(t)
+	defer srv.Close()
+
+	rec := testRoundTrip(t, &VaultTransit{Address: srv.URL + "/", Token: "root", KeyName: "luks"})
+	if rec.KeyID != "luks" || !strings.HasPrefix(string(rec.Wrapped), "vault:v1:") {
+		t.Errorf("record = %s, %q", rec.KeyID, rec.Wrapped)
+	}
+
+	// Unwrapping needs no configured key name
+	if _, err := (&VaultTransit{Address: srv.URL, Token: "root"}).Unwrap(context.Background(), "uuid-1", rec); err != nil {
+		t.Errorf("Unwrap without key name failed: %v", err)
+	}
+
+	_, err := (&VaultTransit{Address: srv.URL, Token: "wrong", KeyName: "luks"}).Wrap(context.Background(), "uuid-1", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Wrap with a bad token = %v, want vault's error", err)
+	}
+	if _, err := (&VaultTransit{Address: srv.URL, Token: "root"}).Wrap(context.Background(), "uuid-1", []byte("x")); err == nil {
+		t.Error("Wrap without key name succeeded")
+	}
+}
+
+// TestHTTPKMS tests wrapping through the generic KMS protocol
+func TestHTTPKMS(t *testing.T) {
+	srv := fakeKMS(t)
+	defer srv.Close()
+
+	kms := &HTTPKMS{URL: srv.URL, KeyID: "luks", Header: http.Header{"Authorization": {"Bearer secret"}}}
+	if rec := testRoundTrip(t, kms); rec.KeyID != "luks/v2" {
+		t.Errorf("KeyID = %s, want the key returned by the service", rec.KeyID)
+	}
+
+	kms.Header = nil
+	if _, err := kms.Wrap(context.Background(), "uuid-1", []byte("x")); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("Wrap without credentials = %v, want the service's error", err)
+	}
+}
+
+// TestFromEnv tests configuring escrows from the environment
+func TestFromEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "https://vault:8200")
+	t.Setenv("VAULT_TOKEN", "s.token")
+	t.Setenv("VAULT_TRANSIT_KEY", "luks")
+	t.Setenv("LUKS2_KMS_URL", "https://kms")
+	t.Setenv("LUKS2_KMS_TOKEN", "secret")
+
+	e, err := FromEnv("vault")
+	if err != nil {
+		t.Fatalf("FromEnv(vault) failed: %v", err)
+	}
+	if v := e.(*VaultTransit); v.Address != "https://vault:8200" || v.Token != "s.token" || v.KeyName != "luks" {
+		t.Errorf("FromEnv(vault) = %+v", v)
+	}
+
+	e, err = FromEnv("kms")
+	if err != nil {
+		t.Fatalf("FromEnv(kms) failed: %v", err)
+	}
+	if k := e.(*HTTPKMS); k.URL != "https://kms" || k.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("FromEnv(kms) = %+v", k)
+	}
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := FromEnv("vault"); err == nil || !strings.Contains(err.Error(), "VAULT_TOKEN") {
+		t.Errorf("FromEnv without a token = %v", err)
+	}
+	if _, err := FromEnv("tang"); err == nil {
+		t.Error("FromEnv accepted an unknown service")
+	}
+}
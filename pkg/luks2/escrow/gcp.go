@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ServiceGCPKMS identifies Google Cloud KMS in escrow tokens
+const ServiceGCPKMS = "gcp-kms"
+
+// gcpKeyPattern matches the resource name of a crypto key, which becomes
+// part of the request URL
+var gcpKeyPattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// GCPKMS wraps secrets with a symmetric Cloud KMS key through the REST API.
+// The volume UUID is passed as additional authenticated data, so a
+// ciphertext only decrypts for its volume. The identity needs
+// cloudkms.cryptoKeyVersions.useToEncrypt to escrow and useToDecrypt to
+// unlock.
+//
+// On Compute Engine no configuration is needed to unlock: the key is
+// recorded in the token and the access token comes from the VM's service
+// account.
+type GCPKMS struct {
+	// KeyName is the crypto key that Wrap uses, as
+	// projects/P/locations/L/keyRings/R/cryptoKeys/K. Unwrap uses the key
+	// recorded in the token.
+	KeyName string
+
+	// Endpoint overrides https://cloudkms.googleapis.com
+	Endpoint string
+
+	// AccessToken returns an OAuth2 access token (nil =
+	// GOOGLE_OAUTH_ACCESS_TOKEN, or the VM's service account through the
+	// metadata server)
+	AccessToken func(ctx context.Context) (string, error)
+
+	Client *http.Client // HTTP client (nil = 30s timeout)
+}
+
+// GCPKMSFromEnv configures GCPKMS from LUKS2_GCP_KMS_KEY. Nothing is
+// required; a key name is only needed to escrow.
+func GCPKMSFromEnv() (*GCPKMS, error) {
+	return &GCPKMS{KeyName: os.Getenv("LUKS2_GCP_KMS_KEY")}, nil
+}
+
+// Service returns ServiceGCPKMS
+func (k *GCPKMS) Service() string {
+	return ServiceGCPKMS
+}
+
+// Wrap encrypts secret with KeyName
+func (k *GCPKMS) Wrap(ctx context.Context, uuid string, secret []byte) (*luks2.EscrowRecord, error) {
+	if k.KeyName == "" {
+		return nil, fmt.Errorf("gcp kms key name not configured")
+	}
+
+	req := map[string]string{
+		"plaintext":                   base64.StdEncoding.EncodeToString(secret),
+		"additionalAuthenticatedData": base64.StdEncoding.EncodeToString([]byte(uuid)),
+	}
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := k.call(ctx, "encrypt", k.KeyName, req, &resp); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil || len(wrapped) == 0 {
+		return nil, fmt.Errorf("gcp kms returned no valid ciphertext")
+	}
+	// The ciphertext names its key version, so decrypt takes the key
+	return &luks2.EscrowRecord{KeyID: k.KeyName, Wrapped: wrapped}, nil
+}
+
+// Unwrap decrypts a ciphertext produced by Wrap
+func (k *GCPKMS) Unwrap(ctx context.Context, uuid string, rec *luks2.EscrowRecord) ([]byte, error) {
+	req := map[string]string{
+		"ciphertext":                  base64.StdEncoding.EncodeToString(rec.Wrapped),
+		"additionalAuthenticatedData": base64.StdEncoding.EncodeToString([]byte(uuid)),
+	}
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := k.call(ctx, "decrypt", rec.KeyID, req, &resp); err != nil {
+		return nil, err
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from gcp kms: %w", err)
+	}
+	return secret, nil
+}
+
+// call invokes the encrypt or decrypt method of key
+func (k *GCPKMS) call(ctx context.Context, method, key string, in, out any) error {
+	err := func() error {
+		if !gcpKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid key name")
+		}
+		token, err := k.accessToken(ctx)
+		if err != nil {
+			return fmt.Errorf("no access token: %w", err)
+		}
+
+		endpoint := k.Endpoint
+		if endpoint == "" {
+			endpoint = "https://cloudkms.googleapis.com"
+		}
+		header := http.Header{"Authorization": {"Bearer " + token}}
+		return postJSON(ctx, k.Client, joinURL(endpoint, "v1", key+":"+method), header, in, out, cloudError)
+	}()
+	if err != nil {
+		return fmt.Errorf("gcp kms %s with key %s: %w", method, key, err)
+	}
+	return nil
+}
+
+// accessToken returns the configured token, the one in the environment or
+// one for the VM's service account
+func (k *GCPKMS) accessToken(ctx context.Context) (string, error) {
+	if k.AccessToken != nil {
+		return k.AccessToken(ctx)
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	return metadataToken(ctx, gcpMetadataURL+"/computeMetadata/v1/instance/service-accounts/default/token",
+		http.Header{"Metadata-Flavor": {"Google"}})
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ServiceHTTPKMS identifies the generic HTTP KMS in escrow tokens
+const ServiceHTTPKMS = "http-kms"
+
+// HTTPKMS wraps secrets through a minimal JSON protocol that a thin proxy in
+// front of any cloud KMS or HSM can implement:
+//
+//	POST <URL>/wrap   {"key_id": "...", "plaintext": "<base64>", "context": "<volume UUID>"}
+//	               -> {"key_id": "...", "ciphertext": "<base64>"}
+//	POST <URL>/unwrap {"key_id": "...", "ciphertext": "<base64>", "context": "<volume UUID>"}
+//	               -> {"plaintext": "<base64>"}
+//
+// The service should bind the ciphertext to the context (e.g. as AEAD
+// associated data). It may return a different key_id from wrap, such as a
+// versioned key name, which is then passed to unwrap. Errors are non-2xx
+// responses, optionally with {"error": "..."}.
+type HTTPKMS struct {
+	URL    string       // Base URL of the service
+	KeyID  string       // Key that Wrap uses; Unwrap uses the key recorded in the token
+	Header http.Header  // Extra request headers, e.g. Authorization
+	Client *http.Client // HTTP client (nil = 30s timeout)
+}
+
+// HTTPKMSFromEnv configures HTTPKMS from LUKS2_KMS_URL, LUKS2_KMS_KEY_ID and
+// LUKS2_KMS_TOKEN, which is sent as a bearer token if set. Only the URL is
+// required; a key ID is only needed to escrow.
+func HTTPKMSFromEnv() (*HTTPKMS, error) {
+	url, err := getenv("LUKS2_KMS_URL")
+	if err != nil {
+		return nil, err
+	}
+	kms := &HTTPKMS{URL: url, KeyID: os.Getenv("LUKS2_KMS_KEY_ID"), Header: http.Header{}}
+	if token := os.Getenv("LUKS2_KMS_TOKEN"); token != "" {
+		kms.Header.Set("Authorization", "Bearer "+token)
+	}
+	return kms, nil
+}
+
+// kmsRequest is the body of wrap and unwrap requests
+type kmsRequest struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+	Context    string `json:"context"`
+}
+
+// kmsResponse is the body of wrap and unwrap responses
+type kmsResponse struct {
+	KeyID      string `json:"key_id"`
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Service returns ServiceHTTPKMS
+func (k *HTTPKMS) Service() string {
+	return ServiceHTTPKMS
+}
+
+// Wrap has the service encrypt secret with KeyID
+func (k *HTTPKMS) Wrap(ctx context.Context, uuid string, secret []byte) (*luks2.EscrowRecord, error) {
+	if k.KeyID == "" {
+		return nil, fmt.Errorf("kms key ID not configured")
+	}
+
+	req := kmsRequest{KeyID: k.KeyID, Plaintext: base64.StdEncoding.EncodeToString(secret), Context: uuid}
+	var resp kmsResponse
+	if err := k.post(ctx, "wrap", &req, &resp); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil || len(wrapped) == 0 {
+		return nil, fmt.Errorf("kms returned no valid ciphertext")
+	}
+	keyID := resp.KeyID
+	if keyID == "" {
+		keyID = k.KeyID
+	}
+	return &luks2.EscrowRecord{KeyID: keyID, Wrapped: wrapped}, nil
+}
+
+// Unwrap has the service decrypt a record produced by Wrap
+func (k *HTTPKMS) Unwrap(ctx context.Context, uuid string, rec *luks2.EscrowRecord) ([]byte, error) {
+	req := kmsRequest{KeyID: rec.KeyID, Ciphertext: base64.StdEncoding.EncodeToString(rec.Wrapped), Context: uuid}
+	var resp kmsResponse
+	if err := k.post(ctx, "unwrap", &req, &resp); err != nil {
+		return nil, err
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from kms: %w", err)
+	}
+	return secret, nil
+}
+
+// post calls a KMS endpoint
+func (k *HTTPKMS) post(ctx context.Context, op string, req *kmsRequest, resp *kmsResponse) error {
+	if err := postJSON(ctx, k.Client, joinURL(k.URL, op), k.Header, req, resp, kmsError); err != nil {
+		return fmt.Errorf("kms %s with key %s: %w", op, req.KeyID, err)
+	}
+	return nil
+}
+
+// kmsError extracts the message of a KMS error response
+func kmsError(body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return ""
+	}
+	return resp.Error
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package escrow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ServiceVaultTransit identifies Vault transit in escrow tokens
+const ServiceVaultTransit = "vault-transit"
+
+// VaultTransit wraps secrets with a key of Vault's transit secrets engine.
+// The token needs update on <mount>/encrypt/<key> to escrow and on
+// <mount>/decrypt/<key> to unlock. Create the key with derived=true to bind
+// each ciphertext to its volume: the volume UUID is sent as the derivation
+// context, which Vault ignores for keys without derivation.
+type VaultTransit struct {
+	Address   string       // Vault address, e.g. https://vault.example.com:8200
+	Token     string       // Vault token
+	Namespace string       // Enterprise namespace (optional)
+	Mount     string       // Transit mount path (default: transit)
+	KeyName   string       // Key that Wrap uses; Unwrap uses the key recorded in the token
+	Client    *http.Client // HTTP client (nil = 30s timeout)
+}
+
+// VaultFromEnv configures VaultTransit from VAULT_ADDR, VAULT_TOKEN,
+// VAULT_NAMESPACE, VAULT_TRANSIT_MOUNT and VAULT_TRANSIT_KEY. Only the
+// address and token are required; a key name is only needed to escrow.
+func VaultFromEnv() (*VaultTransit, error) {
+	address, err := getenv("VAULT_ADDR")
+	if err != nil {
+		return nil, err
+	}
+	token, err := getenv("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	return &VaultTransit{
+		Address:   address,
+		Token:     token,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     os.Getenv("VAULT_TRANSIT_MOUNT"),
+		KeyName:   os.Getenv("VAULT_TRANSIT_KEY"),
+	}, nil
+}
+
+// Service returns ServiceVaultTransit
+func (v *VaultTransit) Service() string {
+	return ServiceVaultTransit
+}
+
+// Wrap encrypts secret with the transit key KeyName
+func (v *VaultTransit) Wrap(ctx context.Context, uuid string, secret []byte) (*luks2.EscrowRecord, error) {
+	if v.KeyName == "" {
+		return nil, fmt.Errorf("vault transit key name not configured")
+	}
+
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	req := map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(secret),
+		"context":   base64.StdEncoding.EncodeToString([]byte(uuid)),
+	}
+	if err := v.post(ctx, "encrypt", v.KeyName, req, &resp); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(resp.Data.Ciphertext, "vault:") {
+		return nil, fmt.Errorf("vault returned no ciphertext")
+	}
+
+	return &luks2.EscrowRecord{KeyID: v.KeyName, Wrapped: []byte(resp.Data.Ciphertext)}, nil
+}
+
+// Unwrap decrypts a ciphertext produced by Wrap
+func (v *VaultTransit) Unwrap(ctx context.Context, uuid string, rec *luks2.EscrowRecord) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	req := map[string]string{
+		"ciphertext": string(rec.Wrapped),
+		"context":    base64.StdEncoding.EncodeToString([]byte(uuid)),
+	}
+	if err := v.post(ctx, "decrypt", rec.KeyID, req, &resp); err != nil {
+		return nil, err
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from vault: %w", err)
+	}
+	return secret, nil
+}
+
+// post calls a transit endpoint for key
+func (v *VaultTransit) post(ctx context.Context, op, key string, req, resp any) error {
+	mount := v.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+	header := http.Header{"X-Vault-Token": {v.Token}}
+	if v.Namespace != "" {
+		header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	if err := postJSON(ctx, v.Client, joinURL(v.Address, "v1", strings.Trim(mount, "/"), op, key), header, req, resp, vaultError); err != nil {
+		return fmt.Errorf("vault transit %s with key %s: %w", op, key, err)
+	}
+	return nil
+}
+
+// vaultError extracts the messages of a Vault error response
+func vaultError(body []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return ""
+	}
+	return strings.Join(resp.Errors, "; ")
+}
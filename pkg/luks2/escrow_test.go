@@ -0,0 +1,186 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// xorEscrow is a KeyEscrow that "wraps" by XOR with the volume UUID
+type xorEscrow struct {
+	fail bool
+}
+
+func (x *xorEscrow) Service() string { return "test-xor" }
+
+func (x *xorEscrow) Wrap(_ context.Context, uuid string, secret []byte) (*EscrowRecord, error) {
+	if x.fail {
+		return nil, errors.New("service unavailable")
+	}
+	return &EscrowRecord{KeyID: "xor", Wrapped: xorUUID(uuid, secret)}, nil
+}
+
+func (x *xorEscrow) Unwrap(_ context.Context, uuid string, rec *EscrowRecord) ([]byte, error) {
+	if x.fail {
+		return nil, errors.New("service unavailable")
+	}
+	return xorUUID(uuid, rec.Wrapped), nil
+}
+
+// escrowTestImage creates an empty image file for Format
+func escrowTestImage(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func xorUUID(uuid string, data []byte) []byte {
+	out := make([]byte, len(data))
+	for i := range data {
+		out[i] = data[i] ^ uuid[i%len(uuid)]
+	}
+	return out
+}
+
+// TestFormat_Escrow tests escrowing the volume key while formatting
+func TestFormat_Escrow(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := escrowTestImage(t)
+	if err := Format(FormatOptions{Device: device, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 10, Escrow: &xorEscrow{}}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	token, err := GetToken(device, 0)
+	if err != nil {
+		t.Fatalf("GetToken failed: %v", err)
+	}
+	if token.Type != TokenTypeEscrow || token.EscrowService != "test-xor" || token.EscrowSecret != EscrowSecretVolumeKey || token.EscrowKeyID != "xor" {
+		t.Errorf("escrow token = %+v", token)
+	}
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := GetVolumeInfo(device)
+	secret, _, err := unwrapEscrow(context.Background(), &xorEscrow{}, info.UUID, metadata.Tokens)
+	if err != nil {
+		t.Fatalf("unwrapEscrow failed: %v", err)
+	}
+	want, _ := ExtractVolumeKey(device, passphrase)
+	if !bytes.Equal(secret, want) {
+		t.Error("escrowed key differs from the volume key")
+	}
+	if err := VerifyVolumeKey(device, secret); err != nil {
+		t.Errorf("VerifyVolumeKey failed: %v", err)
+	}
+}
+
+// TestFormat_EscrowFailure tests that a failing escrow leaves the device
+// untouched
+func TestFormat_EscrowFailure(t *testing.T) {
+	device := escrowTestImage(t)
+
+	err := Format(FormatOptions{Device: device, Passphrase: []byte("test-password"), KDFType: "pbkdf2", PBKDFIterTime: 10, Escrow: &xorEscrow{fail: true}})
+	if err == nil {
+		t.Fatal("Format succeeded with a failing escrow")
+	}
+	if isLUKS, _ := IsLUKS(device); isLUKS {
+		t.Error("Format wrote a header although escrow failed")
+	}
+}
+
+// TestEscrowVolumeKey tests escrowing the key of an existing volume
+func TestEscrowVolumeKey(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	if _, err := EscrowVolumeKey(context.Background(), device, []byte("wrong-password"), &xorEscrow{}); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("EscrowVolumeKey with a wrong passphrase = %v", err)
+	}
+
+	tokenID, err := EscrowVolumeKey(context.Background(), device, passphrase, &xorEscrow{})
+	if err != nil {
+		t.Fatalf("EscrowVolumeKey failed: %v", err)
+	}
+	token, err := GetToken(device, tokenID)
+	if err != nil || token.EscrowSecret != EscrowSecretVolumeKey || len(token.Keyslots) != 0 {
+		t.Errorf("token %d = %+v, %v", tokenID, token, err)
+	}
+}
+
+// TestEscrowRecoveryKey tests escrowing a recovery passphrase
+func TestEscrowRecoveryKey(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	recoveryKey, tokenID, err := EscrowRecoveryKey(context.Background(), device, passphrase, &xorEscrow{}, &RecoveryKeyOptions{KDFType: "pbkdf2"})
+	if err != nil {
+		t.Fatalf("EscrowRecoveryKey failed: %v", err)
+	}
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := GetVolumeInfo(device)
+	secret, token, err := unwrapEscrow(context.Background(), &xorEscrow{}, info.UUID, metadata.Tokens)
+	if err != nil {
+		t.Fatalf("unwrapEscrow failed: %v", err)
+	}
+	if token != metadata.Tokens[strconv.Itoa(tokenID)] || token.EscrowSecret != EscrowSecretPassphrase {
+		t.Errorf("unwrapped token = %+v", token)
+	}
+	if !bytes.Equal(secret, recoveryKey.Key) {
+		t.Error("escrowed passphrase differs from the recovery key")
+	}
+
+	masterKey, err := escrowedPassphraseKey(device, secret, metadata, token)
+	if err != nil {
+		t.Fatalf("escrowedPassphraseKey failed: %v", err)
+	}
+	masterKey.Destroy()
+
+	// The passphrase is only tried against the token's keyslots
+	token.Keyslots = []string{"0"}
+	if _, err := escrowedPassphraseKey(device, secret, metadata, token); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("escrowedPassphraseKey on keyslot 0 = %v, want ErrInvalidPassphrase", err)
+	}
+}
+
+// TestUnwrapEscrow_Errors tests volumes without usable escrow tokens
+func TestUnwrapEscrow_Errors(t *testing.T) {
+	ctx := context.Background()
+	if _, _, err := unwrapEscrow(ctx, &xorEscrow{}, "uuid", nil); !errors.Is(err, ErrNoEscrow) {
+		t.Errorf("no tokens = %v, want ErrNoEscrow", err)
+	}
+
+	tokens := map[string]*Token{
+		"0": {Type: "systemd-tpm2"},
+		"1": {Type: TokenTypeEscrow, EscrowService: "vault-transit", EscrowWrapped: "AAAA"},
+	}
+	if _, _, err := unwrapEscrow(ctx, &xorEscrow{}, "uuid", tokens); !errors.Is(err, ErrNoEscrow) {
+		t.Errorf("tokens of other services = %v, want ErrNoEscrow", err)
+	}
+
+	tokens["2"] = &Token{Type: TokenTypeEscrow, EscrowService: "test-xor", EscrowWrapped: "AAAA"}
+	if _, _, err := unwrapEscrow(ctx, &xorEscrow{fail: true}, "uuid", tokens); err == nil || errors.Is(err, ErrNoEscrow) {
+		t.Errorf("failing service = %v, want its error", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType identifies an auditable library operation
+type EventType string
+
+const (
+	// EventFormatStarted is emitted when Format begins writing a new volume
+	EventFormatStarted EventType = "format-started"
+
+	// EventUnlockSucceeded is emitted when a volume is unlocked and mapped
+	EventUnlockSucceeded EventType = "unlock-succeeded"
+
+	// EventUnlockFailed is emitted when an unlock attempt fails
+	EventUnlockFailed EventType = "unlock-failed"
+
+	// EventKeyslotAdded is emitted when a passphrase is added to a keyslot
+	EventKeyslotAdded EventType = "keyslot-added"
+
+	// EventKeyslotRewrapped is emitted when a keyslot is re-enrolled with a
+	// new salt and KDF under the same number
+	EventKeyslotRewrapped EventType = "keyslot-rewrapped"
+
+	// EventVolumeKeyRotated is emitted when RotateVolumeKey has reencrypted
+	// the data and re-enrolled every keyslot for the new volume key
+	EventVolumeKeyRotated EventType = "volume-key-rotated"
+
+	// EventKeyslotRemoved is emitted when a keyslot is removed, killed or wiped
+	EventKeyslotRemoved EventType = "keyslot-removed"
+
+	// EventWipeCompleted is emitted when a full or header-only wipe completes
+	EventWipeCompleted EventType = "wipe-completed"
+)
+
+// Event is a structured audit record of a library operation. Events never
+// contain passphrases or key material.
+type Event struct {
+	Type    EventType `json:"type"`
+	Op      string    `json:"op"`                // Operation that raised the event (e.g. "unlock", "killslot")
+	Device  string    `json:"device,omitempty"`  // Device operated on
+	Name    string    `json:"name,omitempty"`    // Device-mapper name (unlock events)
+	Keyslot *int      `json:"keyslot,omitempty"` // Keyslot affected, opened or attempted; nil for failed unlocks that tried every keyslot
+	Error   string    `json:"error,omitempty"`   // Failure reason (failure events)
+	Time    time.Time `json:"time"`
+}
+
+// EventSink receives audit events emitted by library operations.
+// Implementations must be safe for concurrent use.
+type EventSink interface {
+	Emit(Event) error
+}
+
+// eventState holds the registered sink
+var eventState struct {
+	mu   sync.RWMutex
+	sink EventSink
+}
+
+// SetEventSink registers the sink that receives audit events. Passing nil
+// disables event delivery (the default). A sink error never fails the
+// operation that raised the event; it is reported as a WarnAuditFailed
+// warning instead.
+func SetEventSink(s EventSink) {
+	eventState.mu.Lock()
+	defer eventState.mu.Unlock()
+	eventState.sink = s
+}
+
+// emitEvent delivers an event to the registered sink
+func emitEvent(e Event) {
+	eventState.mu.RLock()
+	sink := eventState.sink
+	eventState.mu.RUnlock()
+	if sink == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := sink.Emit(e); err != nil {
+		emitWarning(Warning{
+			Code:    WarnAuditFailed,
+			Op:      e.Op,
+			Device:  e.Device,
+			Message: fmt.Sprintf("failed to record %s event: %v", e.Type, err),
+		})
+	}
+}
+
+// multiSink fans events out to several sinks
+type multiSink []EventSink
+
+// MultiSink returns a sink that delivers every event to all of sinks, e.g. a
+// local JSON-lines file and syslog. All sinks are tried; their errors are
+// joined.
+func MultiSink(sinks ...EventSink) EventSink {
+	return multiSink(sinks)
+}
+
+// Emit delivers e to every sink
+func (m multiSink) Emit(e Event) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Emit(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
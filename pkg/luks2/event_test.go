@@ -0,0 +1,159 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink is an EventSink that keeps every event
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+}
+
+func (s *recordingSink) Emit(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return s.err
+}
+
+// types returns the recorded event types in order
+func (s *recordingSink) types() []EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []EventType
+	for _, e := range s.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+// captureEvents installs a recording sink for the duration of a test
+func captureEvents(t *testing.T) *recordingSink {
+	t.Helper()
+	s := &recordingSink{}
+	SetEventSink(s)
+	t.Cleanup(func() { SetEventSink(nil) })
+	return s
+}
+
+// TestEmitEvent_NoSink tests that events are dropped without a sink
+func TestEmitEvent_NoSink(t *testing.T) {
+	SetEventSink(nil)
+	// Must not panic
+	emitEvent(Event{Type: EventWipeCompleted, Device: "/dev/sdb"})
+}
+
+// TestEmitEvent_SinkError tests that sink failures surface as warnings
+func TestEmitEvent_SinkError(t *testing.T) {
+	sink := captureEvents(t)
+	sink.err = errors.New("disk full")
+	warnings := captureWarnings(t, 0)
+
+	emitEvent(Event{Type: EventWipeCompleted, Op: "wipe", Device: "/dev/sdb"})
+
+	if len(sink.events) != 1 || sink.events[0].Time.IsZero() {
+		t.Errorf("Unexpected events: %+v", sink.events)
+	}
+	if len(*warnings) != 1 || (*warnings)[0].Code != WarnAuditFailed || !strings.Contains((*warnings)[0].Message, "disk full") {
+		t.Errorf("Unexpected warnings: %+v", *warnings)
+	}
+}
+
+// TestMultiSink tests that every sink receives events and errors are joined
+func TestMultiSink(t *testing.T) {
+	a := &recordingSink{err: errors.New("a failed")}
+	b := &recordingSink{}
+
+	err := MultiSink(a, b).Emit(Event{Type: EventFormatStarted, Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "a failed") {
+		t.Errorf("Expected joined error, got %v", err)
+	}
+	if len(a.events) != 1 || len(b.events) != 1 {
+		t.Errorf("Expected both sinks to receive the event: %d, %d", len(a.events), len(b.events))
+	}
+}
+
+// TestEvents_Operations tests the events raised by format, keyslot changes
+// and wipes on a file-backed volume
+func TestEvents_Operations(t *testing.T) {
+	sink := captureEvents(t)
+	pass := []byte("audit-test-passphrase")
+	device := formatTestVolume(t, pass)
+
+	slot := 3
+	if err := AddKey(device, pass, []byte("second-passphrase"), &AddKeyOptions{Keyslot: &slot, KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if err := KillSlot(device, pass, slot); err != nil {
+		t.Fatalf("KillSlot failed: %v", err)
+	}
+	if err := Wipe(WipeOptions{Device: device, Passes: 1, HeaderOnly: true}); err != nil {
+		t.Fatalf("Wipe failed: %v", err)
+	}
+
+	want := []EventType{EventFormatStarted, EventKeyslotAdded, EventKeyslotRemoved, EventWipeCompleted}
+	got := sink.types()
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	for _, e := range sink.events[1:3] {
+		if e.Keyslot == nil || *e.Keyslot != slot || e.Device != device {
+			t.Errorf("Unexpected keyslot event: %+v", e)
+		}
+	}
+}
+
+// TestEvents_UnlockFailed tests that failed unlocks record the attempted keyslot
+func TestEvents_UnlockFailed(t *testing.T) {
+	sink := captureEvents(t)
+
+	slot := 1
+	err := UnlockWithOptions("/nonexistent/device", []byte("passphrase"), "audit-test", &UnlockOptions{Keyslot: &slot})
+	if err == nil {
+		t.Fatal("Expected unlock to fail")
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected 1 event, got %+v", sink.events)
+	}
+	e := sink.events[0]
+	if e.Type != EventUnlockFailed || e.Name != "audit-test" || e.Keyslot == nil || *e.Keyslot != 1 || e.Error != err.Error() {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+}
+
+// TestEvents_UnlockWithVolumeKey tests that volume-key unlocks are audited
+func TestEvents_UnlockWithVolumeKey(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	sink := captureEvents(t)
+
+	err := UnlockWithVolumeKey(device, make([]byte, DefaultKeySize/8), "audit-test")
+	if err == nil {
+		t.Fatal("Expected unlock with a wrong volume key to fail")
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected 1 event, got %+v", sink.events)
+	}
+	e := sink.events[0]
+	if e.Type != EventUnlockFailed || e.Op != "unlock-volume-key" || e.Device != device || e.Keyslot != nil || e.Error != err.Error() {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+}
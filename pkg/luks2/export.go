@@ -0,0 +1,192 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ExportMode selects what ExportUsed writes
+type ExportMode int
+
+const (
+	// ExportDecrypted writes the used blocks of the decrypted filesystem,
+	// giving a plain filesystem image
+	ExportDecrypted ExportMode = iota
+
+	// ExportEncrypted writes the LUKS2 header and keyslots and the
+	// ciphertext of the used blocks, giving a LUKS2 image that opens with
+	// the same passphrases
+	ExportEncrypted
+)
+
+// String returns the name of the mode
+func (m ExportMode) String() string {
+	switch m {
+	case ExportDecrypted:
+		return "decrypted"
+	case ExportEncrypted:
+		return "encrypted"
+	default:
+		return fmt.Sprintf("ExportMode(%d)", int(m))
+	}
+}
+
+// validate rejects unknown modes
+func (m ExportMode) validate() error {
+	if m != ExportDecrypted && m != ExportEncrypted {
+		return fmt.Errorf("invalid export mode %d", int(m))
+	}
+	return nil
+}
+
+// ExportOptions contains optional settings for ExportUsed
+type ExportOptions struct {
+	Mode ExportMode // Default: ExportDecrypted
+}
+
+// ExportResult describes an image written by ExportUsed
+type ExportResult struct {
+	Size   int64 // Size of the image in bytes
+	Copied int64 // Bytes copied; the rest of the image is a hole
+}
+
+// exportCopyBufferSize is the buffer size used to copy used ranges
+const exportCopyBufferSize = 1024 * 1024
+
+// byteRange is the half-open byte range [start, end)
+type byteRange struct {
+	start, end int64
+}
+
+// mergeRanges sorts ranges and joins those that overlap or touch
+func mergeRanges(ranges []byteRange) []byteRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	var merged []byteRange
+	for _, r := range ranges {
+		if r.end <= r.start {
+			continue
+		}
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, r.end)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// deviceRanges maps ranges of the decrypted volume to the device, widened to
+// whole encryption sectors, and adds the header and keyslots area in front
+// of the first data segment
+func deviceRanges(extents []volumeExtent, ranges []byteRange) []byteRange {
+	var out []byteRange
+	if len(extents) > 0 {
+		dataOffset := extents[0].offset
+		for _, ext := range extents[1:] {
+			dataOffset = min(dataOffset, ext.offset)
+		}
+		out = append(out, byteRange{0, dataOffset})
+	}
+
+	for _, r := range ranges {
+		for _, ext := range extents {
+			start := max(r.start, ext.start) - ext.start
+			end := min(r.end, ext.start+ext.length) - ext.start
+			if start >= end {
+				continue
+			}
+			if ext.sectorSize > 0 {
+				start -= start % ext.sectorSize
+				end = min((end+ext.sectorSize-1)/ext.sectorSize*ext.sectorSize, ext.length)
+			}
+			out = append(out, byteRange{ext.offset + start, ext.offset + end})
+		}
+	}
+	return mergeRanges(out)
+}
+
+// writeSparse copies ranges of src to the same offsets of w and seeks over
+// everything else, so a new file becomes a sparse image of size bytes. It
+// returns the number of bytes copied.
+func writeSparse(w io.WriteSeeker, src io.ReaderAt, ranges []byteRange, size int64) (int64, error) {
+	buf := make([]byte, exportCopyBufferSize)
+	var copied int64
+	for _, r := range ranges {
+		end := min(r.end, size)
+		if r.start >= end {
+			continue
+		}
+		if _, err := w.Seek(r.start, io.SeekStart); err != nil {
+			return copied, fmt.Errorf("failed to seek to %d: %w", r.start, err)
+		}
+		n, err := io.CopyBuffer(w, io.NewSectionReader(src, r.start, end-r.start), buf)
+		copied += n
+		if err != nil {
+			return copied, fmt.Errorf("failed to copy %d-%d: %w", r.start, end, err)
+		}
+	}
+
+	// Extend the image to its full size; the tail reads back as zeros
+	if n := len(ranges); size > 0 && (n == 0 || ranges[n-1].end < size) {
+		if _, err := w.Seek(size-1, io.SeekStart); err != nil {
+			return copied, fmt.Errorf("failed to seek to %d: %w", size-1, err)
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			return copied, fmt.Errorf("failed to extend image: %w", err)
+		}
+	}
+	return copied, nil
+}
+
+// ExportUsed writes an image of the volume to w holding only the blocks its
+// filesystem uses; unused blocks are skipped with Seek, so w should be a new
+// file, which becomes sparse. opts.Mode chooses a plain filesystem image or
+// a LUKS2 image carrying the ciphertext (nil = ExportDecrypted). ext2, ext3
+// and ext4 are supported; other filesystems fail with
+// ErrUnsupportedFilesystem. Filesystem detection is Linux-only; elsewhere
+// ExportUsed returns ErrNotSupported.
+//
+// The filesystem must not change during the export: export an unmounted
+// volume, or one whose filesystem is frozen or mounted read-only.
+func (v *Volume) ExportUsed(w io.WriteSeeker, opts *ExportOptions) (*ExportResult, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if err := opts.Mode.validate(); err != nil {
+		return nil, err
+	}
+
+	used, err := extUsedRanges(v, v.size)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Mode == ExportDecrypted {
+		copied, err := writeSparse(w, v, used, v.size)
+		if err != nil {
+			return nil, err
+		}
+		return &ExportResult{Size: v.size, Copied: copied}, nil
+	}
+
+	size, err := getBlockDeviceSize(v.device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device size: %w", err)
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.f == nil {
+		return nil, os.ErrClosed
+	}
+	copied, err := writeSparse(w, v.f, deviceRanges(v.extents, used), size)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportResult{Size: size, Copied: copied}, nil
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ext2/3/4 superblock fields and feature flags used to walk the block
+// allocation
+const (
+	extBlocksCountLoField  = 0x04
+	extFirstDataBlockField = 0x14
+	extLogBlockSizeField   = 0x18
+	extBlocksPerGroupField = 0x20
+	extInodesPerGroupField = 0x28
+	extRevLevelField       = 0x4C
+	extInodeSizeField      = 0x58
+	extReservedGDTField    = 0xCE
+	extDescSizeField       = 0xFE
+	extBlocksCountHiField  = 0x150
+
+	extCompatSparseSuper2   = 0x0200
+	extIncompatMetaBG       = 0x0010
+	extIncompat64Bit        = 0x0080
+	extRoCompatSparseSuper  = 0x0001
+	extRoCompatGDTCsum      = 0x0010
+	extRoCompatBigalloc     = 0x0200
+	extRoCompatMetadataCsum = 0x0400
+)
+
+// ext2/3/4 group descriptor fields
+const (
+	extGroupDescMinSize     = 32
+	extGroupDesc64Size      = 64
+	extGDBlockBitmapLoField = 0x00
+	extGDInodeBitmapLoField = 0x04
+	extGDInodeTableLoField  = 0x08
+	extGDFlagsField         = 0x12
+	extGDBlockBitmapHiField = 0x20
+	extGDInodeBitmapHiField = 0x24
+	extGDInodeTableHiField  = 0x28
+
+	extGroupBlockUninit = 0x0002
+)
+
+// extUsedRanges returns the byte ranges of the ext2/3/4 filesystem on r that
+// hold data or metadata, from the block bitmaps of its block groups. The
+// boot block, superblocks, group descriptors, bitmaps and inode tables are
+// always included; groups whose bitmap was never initialized contribute
+// only their metadata. size is the size of the volume r reads.
+func extUsedRanges(r io.ReaderAt, size int64) ([]byteRange, error) {
+	buf := make([]byte, fsProbeSize)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	fs, err := detectFilesystemSignature(buf[:n])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFilesystem, err)
+	}
+	if fs != FilesystemExt2 && fs != FilesystemExt3 && fs != FilesystemExt4 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilesystem, fs)
+	}
+
+	sb := buf[extSuperblockOffset:]
+	le := binary.LittleEndian
+	compat := le.Uint32(sb[extCompatField:])
+	incompat := le.Uint32(sb[extIncompatField:])
+	roCompat := le.Uint32(sb[extRoCompatField:])
+	if roCompat&extRoCompatBigalloc != 0 {
+		// The bitmaps track clusters rather than blocks
+		return nil, fmt.Errorf("%w: ext4 with bigalloc", ErrUnsupportedFilesystem)
+	}
+
+	logBlockSize := le.Uint32(sb[extLogBlockSizeField:])
+	if logBlockSize > 6 {
+		return nil, fmt.Errorf("invalid ext superblock: block size 2^%d KiB", logBlockSize)
+	}
+	blockSize := int64(1024) << logBlockSize
+	blocks := int64(le.Uint32(sb[extBlocksCountLoField:]))
+	descSize := int64(extGroupDescMinSize)
+	if incompat&extIncompat64Bit != 0 {
+		blocks |= int64(le.Uint32(sb[extBlocksCountHiField:])) << 32
+		descSize = int64(le.Uint16(sb[extDescSizeField:]))
+		if descSize < extGroupDescMinSize {
+			return nil, fmt.Errorf("invalid ext superblock: group descriptor size %d", descSize)
+		}
+	}
+	firstDataBlock := int64(le.Uint32(sb[extFirstDataBlockField:]))
+	perGroup := int64(le.Uint32(sb[extBlocksPerGroupField:]))
+	if perGroup == 0 || perGroup > blockSize*8 || firstDataBlock >= blocks {
+		return nil, fmt.Errorf("invalid ext superblock: %d blocks, %d per group, first data block %d", blocks, perGroup, firstDataBlock)
+	}
+	if blocks > size/blockSize {
+		return nil, fmt.Errorf("filesystem of %d bytes is larger than the volume (%d bytes)", blocks*blockSize, size)
+	}
+
+	inodeSize := int64(128)
+	if le.Uint32(sb[extRevLevelField:]) > 0 {
+		inodeSize = int64(le.Uint16(sb[extInodeSizeField:]))
+	}
+	inodeTableBlocks := (int64(le.Uint32(sb[extInodesPerGroupField:]))*inodeSize + blockSize - 1) / blockSize
+	reservedGDT := int64(le.Uint16(sb[extReservedGDTField:]))
+
+	groups := (blocks - firstDataBlock + perGroup - 1) / perGroup
+	gdt := make([]byte, groups*descSize)
+	if _, err := r.ReadAt(gdt, (firstDataBlock+1)*blockSize); err != nil {
+		return nil, fmt.Errorf("failed to read group descriptors: %w", err)
+	}
+	gdtBlocks := (int64(len(gdt)) + blockSize - 1) / blockSize
+
+	// BLOCK_UNINIT is only meaningful with group descriptor checksums
+	uninitValid := roCompat&(extRoCompatGDTCsum|extRoCompatMetadataCsum) != 0
+	sparse := roCompat&extRoCompatSparseSuper != 0
+
+	blockRange := func(block, count int64) byteRange {
+		return byteRange{block * blockSize, (block + count) * blockSize}
+	}
+
+	// The boot block and primary superblock
+	used := []byteRange{blockRange(0, firstDataBlock+1)}
+	bitmap := make([]byte, blockSize)
+	for g := int64(0); g < groups; g++ {
+		desc := gdt[g*descSize : (g+1)*descSize]
+		blockBitmap := int64(le.Uint32(desc[extGDBlockBitmapLoField:]))
+		inodeBitmap := int64(le.Uint32(desc[extGDInodeBitmapLoField:]))
+		inodeTable := int64(le.Uint32(desc[extGDInodeTableLoField:]))
+		if descSize >= extGroupDesc64Size {
+			blockBitmap |= int64(le.Uint32(desc[extGDBlockBitmapHiField:])) << 32
+			inodeBitmap |= int64(le.Uint32(desc[extGDInodeBitmapHiField:])) << 32
+			inodeTable |= int64(le.Uint32(desc[extGDInodeTableHiField:])) << 32
+		}
+		for _, block := range []int64{blockBitmap, inodeBitmap, inodeTable} {
+			if block < firstDataBlock || block+1 > blocks {
+				return nil, fmt.Errorf("invalid ext group descriptor %d: block %d is outside the filesystem", g, block)
+			}
+		}
+
+		// With flex_bg these may lie in another group, whose bitmap may
+		// be uninitialized, so they are added wherever they are
+		used = append(used, blockRange(blockBitmap, 1), blockRange(inodeBitmap, 1), blockRange(inodeTable, inodeTableBlocks))
+
+		first := firstDataBlock + g*perGroup
+		count := min(perGroup, blocks-first)
+		if uninitValid && le.Uint16(desc[extGDFlagsField:])&extGroupBlockUninit != 0 {
+			switch {
+			case compat&extCompatSparseSuper2 != 0 || incompat&extIncompatMetaBG != 0:
+				// Backup placement differs; copy the whole group
+				used = append(used, blockRange(first, count))
+			case extGroupHasSuper(g, sparse):
+				used = append(used, blockRange(first, min(1+gdtBlocks+reservedGDT, count)))
+			}
+			continue
+		}
+
+		if _, err := r.ReadAt(bitmap, blockBitmap*blockSize); err != nil {
+			return nil, fmt.Errorf("failed to read block bitmap of group %d: %w", g, err)
+		}
+		used = appendBitmapRanges(used, bitmap, count, first, blockSize)
+	}
+
+	return mergeRanges(used), nil
+}
+
+// appendBitmapRanges appends the byte range of each run of set bits among
+// the first count bits of a block bitmap whose first bit is block first
+func appendBitmapRanges(ranges []byteRange, bitmap []byte, count, first, blockSize int64) []byteRange {
+	toRange := func(bit, n int64) byteRange {
+		return byteRange{(first + bit) * blockSize, (first + bit + n) * blockSize}
+	}
+	runStart := int64(-1)
+	for bit := int64(0); bit < count; bit++ {
+		b := bitmap[bit/8]
+		if bit%8 == 0 && count-bit >= 8 && (b == 0 || b == 0xFF) {
+			// Whole byte: extend or end the run at once
+			if b == 0 && runStart >= 0 {
+				ranges = append(ranges, toRange(runStart, bit-runStart))
+				runStart = -1
+			} else if b == 0xFF && runStart < 0 {
+				runStart = bit
+			}
+			bit += 7
+			continue
+		}
+		set := b&(1<<(bit%8)) != 0
+		if set && runStart < 0 {
+			runStart = bit
+		} else if !set && runStart >= 0 {
+			ranges = append(ranges, toRange(runStart, bit-runStart))
+			runStart = -1
+		}
+	}
+	if runStart >= 0 {
+		ranges = append(ranges, toRange(runStart, count-runStart))
+	}
+	return ranges
+}
+
+// extGroupHasSuper reports whether block group g holds a superblock copy:
+// every group, or with sparse_super only groups 0, 1 and powers of 3, 5
+// and 7
+func extGroupHasSuper(g int64, sparse bool) bool {
+	if !sparse || g <= 1 {
+		return true
+	}
+	for _, base := range []int64{3, 5, 7} {
+		n := g
+		for n%base == 0 {
+			n /= base
+		}
+		if n == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportUsed writes an image of the unlocked volume name holding only the
+// blocks its filesystem uses; unused blocks are skipped with Seek, so w
+// should be a new file, which becomes sparse. With ExportDecrypted
+// (opts nil) the decrypted filesystem is read from /dev/mapper/<name>;
+// with ExportEncrypted the header, keyslots and ciphertext of the used
+// blocks are read from the underlying device. ext2, ext3 and ext4 are
+// supported; other filesystems fail with ErrUnsupportedFilesystem.
+//
+// The filesystem must not change during the export: freeze it (fsfreeze)
+// or remount it read-only first, or the image may be inconsistent.
+func ExportUsed(name string, w io.WriteSeeker, opts *ExportOptions) (*ExportResult, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if err := opts.Mode.validate(); err != nil {
+		return nil, err
+	}
+
+	status, err := Status(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mapperPath := fmt.Sprintf("/dev/mapper/%s", name)
+	mapper, err := os.Open(mapperPath) // #nosec G304 -- device-mapper node of a checked mapping
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", mapperPath, err)
+	}
+	defer func() { _ = mapper.Close() }()
+	size, err := getBlockDeviceSize(mapperPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device size: %w", err)
+	}
+
+	used, err := extUsedRanges(mapper, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Mode == ExportDecrypted {
+		copied, err := writeSparse(w, mapper, used, size)
+		if err != nil {
+			return nil, err
+		}
+		return &ExportResult{Size: size, Copied: copied}, nil
+	}
+
+	_, metadata, err := readHeader(status.Device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	extents, _, err := volumeLayout(status.Device, metadata)
+	if err != nil {
+		return nil, err
+	}
+	var mapped int64
+	for _, ext := range extents {
+		mapped += ext.length
+	}
+	if mapped != size {
+		// e.g. a reencryption changed the segments after the mapping was made
+		return nil, fmt.Errorf("%w: the segments of %s map %d bytes, %s has %d", ErrInvalidSegmentLayout, status.Device, mapped, mapperPath, size)
+	}
+
+	dev, err := os.Open(status.Device) // #nosec G304 -- backing device of a checked mapping
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", status.Device, err)
+	}
+	defer func() { _ = dev.Close() }()
+	devSize, err := getBlockDeviceSize(status.Device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device size: %w", err)
+	}
+
+	copied, err := writeSparse(w, dev, deviceRanges(extents, used), devSize)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportResult{Size: devSize, Copied: copied}, nil
+}
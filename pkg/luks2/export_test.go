@@ -0,0 +1,269 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeExtImage creates an ext filesystem image of size bytes holding data
+// as /data.bin, using mkfs with extra options
+func makeExtImage(t *testing.T, size int64, data []byte, mkfsArgs ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not available")
+	}
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data.bin"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	image := filepath.Join(dir, "fs.img")
+	if err := os.WriteFile(image, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(image, size); err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"-q", "-F", "-d", root}, mkfsArgs...)
+	if out, err := exec.Command("mkfs.ext4", append(args, image)...).CombinedOutput(); err != nil { // #nosec G204 -- test command
+		t.Fatalf("mkfs.ext4 failed: %v: %s", err, out)
+	}
+	return image
+}
+
+// checkExtImage runs e2fsck on image and compares /data.bin with data
+func checkExtImage(t *testing.T, image string, data []byte) {
+	t.Helper()
+	if out, err := exec.Command("e2fsck", "-fn", image).CombinedOutput(); err != nil { // #nosec G204 -- test command
+		t.Fatalf("e2fsck found problems in the exported image: %v: %s", err, out)
+	}
+	out, err := exec.Command("debugfs", "-R", "cat /data.bin", image).Output() // #nosec G204 -- test command
+	if err != nil {
+		t.Fatalf("debugfs failed: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("/data.bin differs in the exported image (%d bytes, want %d)", len(out), len(data))
+	}
+}
+
+// exportFile returns a new file for an export
+func exportFile(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), name)) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// TestExtUsedRanges tests exporting plain ext images with different layouts
+func TestExtUsedRanges(t *testing.T) {
+	data := make([]byte, 3*1024*1024+123)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, args := range map[string][]string{
+		"ext4":        nil,
+		"ext2 1k":     {"-t", "ext2", "-b", "1024"},
+		"ext4 64bit":  {"-O", "64bit,^flex_bg", "-b", "2048"},
+		"ext4 1k":     {"-b", "1024"},
+		"ext4 nocsum": {"-O", "^metadata_csum,^uninit_bg"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			const size = 64 * 1024 * 1024
+			image := makeExtImage(t, size, data, args...)
+			src, err := os.Open(image) // #nosec G304 -- test temp file
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = src.Close() }()
+
+			used, err := extUsedRanges(src, size)
+			if err != nil {
+				t.Fatalf("extUsedRanges failed: %v", err)
+			}
+
+			out := exportFile(t, "export.img")
+			copied, err := writeSparse(out, src, used, size)
+			if err != nil {
+				t.Fatalf("writeSparse failed: %v", err)
+			}
+			if copied < int64(len(data)) || copied > size/2 {
+				t.Errorf("copied %d of %d bytes", copied, size)
+			}
+			if fi, _ := out.Stat(); fi.Size() != size {
+				t.Errorf("image size = %d, want %d", fi.Size(), size)
+			}
+			checkExtImage(t, out.Name(), data)
+
+			// e2fsck only reads the backup superblocks when the primary is
+			// damaged, so check the one in group 1 directly
+			sb := make([]byte, 1024)
+			if _, err := src.ReadAt(sb, extSuperblockOffset); err != nil {
+				t.Fatal(err)
+			}
+			blockSize := int64(1024) << binary.LittleEndian.Uint32(sb[extLogBlockSizeField:])
+			group1 := int64(binary.LittleEndian.Uint32(sb[extFirstDataBlockField:])+binary.LittleEndian.Uint32(sb[extBlocksPerGroupField:])) * blockSize
+			magic := make([]byte, 2)
+			if _, err := out.ReadAt(magic, group1+extSuperblockMagicField); err != nil {
+				t.Fatal(err)
+			}
+			if binary.LittleEndian.Uint16(magic) != extMagic {
+				t.Errorf("backup superblock at %d is missing from the export", group1)
+			}
+		})
+	}
+}
+
+// TestVolumeExportUsed tests decrypted and encrypted exports of a volume
+func TestVolumeExportUsed(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := escrowTestImage(t)
+	if err := os.Truncate(device, 48*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(FormatOptions{Device: device, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	v, err := OpenVolume(device, passphrase, &VolumeOptions{Writable: true})
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = v.Close() }()
+
+	data := make([]byte, 2*1024*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := os.ReadFile(makeExtImage(t, v.Size(), data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.WriteAt(fs, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	t.Run("decrypted", func(t *testing.T) {
+		out := exportFile(t, "plain.img")
+		res, err := v.ExportUsed(out, nil)
+		if err != nil {
+			t.Fatalf("ExportUsed failed: %v", err)
+		}
+		if res.Size != v.Size() || res.Copied >= res.Size/2 {
+			t.Errorf("result = %+v for a %d-byte volume", res, v.Size())
+		}
+		checkExtImage(t, out.Name(), data)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		out := exportFile(t, "luks.img")
+		res, err := v.ExportUsed(out, &ExportOptions{Mode: ExportEncrypted})
+		if err != nil {
+			t.Fatalf("ExportUsed failed: %v", err)
+		}
+		if res.Size != 48*1024*1024 {
+			t.Errorf("image size = %d, want the device size", res.Size)
+		}
+
+		// The export opens with the same passphrase and holds the filesystem
+		exported, err := OpenVolume(out.Name(), passphrase, nil)
+		if err != nil {
+			t.Fatalf("OpenVolume on the export failed: %v", err)
+		}
+		defer func() { _ = exported.Close() }()
+		plain := exportFile(t, "decrypted.img")
+		if _, err := exported.WriteTo(plain); err != nil {
+			t.Fatal(err)
+		}
+		checkExtImage(t, plain.Name(), data)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		if _, err := v.ExportUsed(exportFile(t, "x.img"), &ExportOptions{Mode: ExportMode(7)}); err == nil {
+			t.Error("expected an error for an unknown mode")
+		}
+	})
+}
+
+// TestVolumeExportUsed_Unsupported tests a volume without an ext filesystem
+func TestVolumeExportUsed_Unsupported(t *testing.T) {
+	passphrase := []byte("test-password")
+	v, err := OpenVolume(formatTestVolume(t, passphrase), passphrase, nil)
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = v.Close() }()
+
+	if _, err := v.ExportUsed(exportFile(t, "x.img"), nil); !errors.Is(err, ErrUnsupportedFilesystem) {
+		t.Errorf("expected ErrUnsupportedFilesystem, got %v", err)
+	}
+}
+
+// TestAppendBitmapRanges tests turning bitmap runs into byte ranges
+func TestAppendBitmapRanges(t *testing.T) {
+	bitmap := []byte{0x0F, 0xFF, 0x00, 0x81, 0xFF}
+	got := appendBitmapRanges(nil, bitmap, 36, 10, 1024)
+	want := []byteRange{
+		{10 * 1024, 14 * 1024}, // bits 0-3
+		{18 * 1024, 26 * 1024}, // bits 8-15
+		{34 * 1024, 35 * 1024}, // bit 24
+		{41 * 1024, 46 * 1024}, // bits 31-35, cut at count
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges = %v, want %v", got, want)
+	}
+}
+
+// TestExtGroupHasSuper tests the sparse_super backup group rule
+func TestExtGroupHasSuper(t *testing.T) {
+	var groups []int64
+	for g := int64(0); g < 130; g++ {
+		if extGroupHasSuper(g, true) {
+			groups = append(groups, g)
+		}
+	}
+	want := []int64{0, 1, 3, 5, 7, 9, 25, 27, 49, 81, 125}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("backup groups = %v, want %v", groups, want)
+	}
+	if !extGroupHasSuper(2, false) {
+		t.Error("without sparse_super every group has a backup")
+	}
+}
+
+// TestDeviceRanges tests mapping volume ranges to the device
+func TestDeviceRanges(t *testing.T) {
+	extents := []volumeExtent{
+		{start: 0, length: 8192, offset: 16384, sectorSize: 4096},
+		{start: 8192, length: 8192, offset: 40960},
+	}
+	got := deviceRanges(extents, []byteRange{{100, 200}, {8000, 8300}})
+	want := []byteRange{
+		{0, 24576},     // Header and keyslots, joined with both sectors of the first extent
+		{40960, 41068}, // Linear segment, not widened
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockHolders describes the processes holding a lock on path, from
+// /proc/locks. It returns nil when they cannot be determined.
+func lockHolders(path string) []string {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return nil
+	}
+	data, err := os.ReadFile("/proc/locks")
+	if err != nil {
+		return nil
+	}
+
+	var holders []string
+	for _, pid := range parseProcLocks(data, unix.Major(st.Dev), unix.Minor(st.Dev), st.Ino) {
+		holder := "pid " + strconv.Itoa(pid)
+		if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+			holder += " (" + strings.TrimSpace(string(comm)) + ")"
+		}
+		holders = append(holders, holder)
+	}
+	return holders
+}
+
+// parseProcLocks returns the PIDs holding locks on the inode identified by
+// major, minor and ino. Lines look like
+//
+//	1: FLOCK  ADVISORY  WRITE 1234 08:01:5678 0 EOF
+//
+// Waiters are listed with a "->" marker and skipped, as are locks without
+// an owning process (open file description locks report -1).
+func parseProcLocks(data []byte, major, minor uint32, ino uint64) []int {
+	var pids []int
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] == "->" {
+			continue
+		}
+		id := strings.Split(fields[5], ":")
+		if len(id) != 3 {
+			continue
+		}
+		maj, err1 := strconv.ParseUint(id[0], 16, 32)
+		mnr, err2 := strconv.ParseUint(id[1], 16, 32)
+		n, err3 := strconv.ParseUint(id[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		if uint32(maj) != major || uint32(mnr) != minor || n != ino {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil || pid <= 0 || seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		pids = append(pids, pid)
+	}
+	return pids
+}
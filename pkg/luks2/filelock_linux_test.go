@@ -0,0 +1,53 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseProcLocks(t *testing.T) {
+	data := []byte(`1: FLOCK  ADVISORY  WRITE 1234 fd:01:5678 0 EOF
+1: -> FLOCK  ADVISORY  WRITE 4321 fd:01:5678 0 EOF
+2: FLOCK  ADVISORY  READ 2222 fd:01:5678 0 EOF
+3: FLOCK  ADVISORY  READ 2222 fd:01:5678 0 EOF
+4: POSIX  ADVISORY  WRITE 3333 08:02:5678 0 EOF
+5: OFDLCK ADVISORY  READ -1 fd:01:5678 0 EOF
+6: FLOCK  ADVISORY  WRITE 4444 fd:01:999 0 EOF
+garbage
+`)
+	got := parseProcLocks(data, 0xfd, 1, 5678)
+	if want := []int{1234, 2222}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcLocks() = %v, want %v", got, want)
+	}
+}
+
+func TestLockHeldError(t *testing.T) {
+	if _, err := os.Stat("/proc/locks"); err != nil {
+		t.Skip("/proc/locks not available")
+	}
+	path := lockTestFile(t)
+
+	lock, err := AcquireFileLockWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	_, err = AcquireFileLockWithOptions(path, nil)
+	if !errors.Is(err, ErrDeviceLocked) {
+		t.Fatalf("got %v, want ErrDeviceLocked", err)
+	}
+	if want := "pid " + strconv.Itoa(os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not name the holder (%s)", err, want)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package luks2
+
+// lockHolders is not supported on this platform
+func lockHolders(path string) []string {
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Persistent activation flags stored in the config section of the metadata
+// (cryptsetup --persistent). They are applied on every Unlock in addition to
+// the flags requested in UnlockOptions.
+const (
+	// FlagAllowDiscards passes TRIM/discard requests to the device
+	FlagAllowDiscards = "allow-discards"
+
+	// FlagSameCPUCrypt encrypts on the CPU that issued the I/O
+	FlagSameCPUCrypt = "same-cpu-crypt"
+
+	// FlagSubmitFromCryptCPUs submits writes from the crypt threads
+	FlagSubmitFromCryptCPUs = "submit-from-crypt-cpus"
+
+	// FlagNoReadWorkqueue bypasses the dm-crypt read workqueue
+	FlagNoReadWorkqueue = "no-read-workqueue"
+
+	// FlagNoWriteWorkqueue bypasses the dm-crypt write workqueue
+	FlagNoWriteWorkqueue = "no-write-workqueue"
+)
+
+// persistentFlags are the flags SetPersistentFlags accepts
+var persistentFlags = []string{
+	FlagAllowDiscards,
+	FlagSameCPUCrypt,
+	FlagSubmitFromCryptCPUs,
+	FlagNoReadWorkqueue,
+	FlagNoWriteWorkqueue,
+}
+
+// GetPersistentFlags returns the activation flags stored in the volume config
+func GetPersistentFlags(device string) ([]string, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if metadata.Config == nil {
+		return nil, nil
+	}
+	return slices.Clone(metadata.Config.Flags), nil
+}
+
+// SetPersistentFlags replaces the activation flags stored in the volume config,
+// equivalent to cryptsetup refresh --persistent. An empty list clears them.
+// Discards weaken confidentiality; see UnlockOptions.AllowDiscards.
+func SetPersistentFlags(device string, flags []string) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+
+	var normalized []string
+	for _, flag := range flags {
+		if !slices.Contains(persistentFlags, flag) {
+			return fmt.Errorf("unsupported persistent flag: %q", flag)
+		}
+		if !slices.Contains(normalized, flag) {
+			normalized = append(normalized, flag)
+		}
+	}
+
+	// Acquire exclusive lock
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if metadata.Config == nil {
+		metadata.Config = &Config{}
+	}
+	metadata.Config.Flags = normalized
+
+	hdr.SequenceID++
+
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestPersistentFlags tests storing, replacing and clearing persistent flags
+func TestPersistentFlags(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	flags, err := GetPersistentFlags(device)
+	if err != nil {
+		t.Fatalf("GetPersistentFlags failed: %v", err)
+	}
+	if len(flags) != 0 {
+		t.Errorf("fresh volume has flags: %v", flags)
+	}
+
+	want := []string{FlagAllowDiscards, FlagNoReadWorkqueue}
+	if err := SetPersistentFlags(device, []string{FlagAllowDiscards, FlagNoReadWorkqueue, FlagAllowDiscards}); err != nil {
+		t.Fatalf("SetPersistentFlags failed: %v", err)
+	}
+
+	flags, err = GetPersistentFlags(device)
+	if err != nil {
+		t.Fatalf("GetPersistentFlags failed: %v", err)
+	}
+	if !slices.Equal(flags, want) {
+		t.Errorf("flags = %v, want %v", flags, want)
+	}
+
+	// The flags are applied on activation
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cryptFlags(metadata, nil); !slices.Equal(got, []string{"allow_discards", "no_read_workqueue"}) {
+		t.Errorf("cryptFlags = %v", got)
+	}
+
+	// Both header copies carry the update
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NeedsRepair() {
+		t.Errorf("headers out of sync after SetPersistentFlags: %+v", status)
+	}
+
+	if err := SetPersistentFlags(device, nil); err != nil {
+		t.Fatalf("clearing flags failed: %v", err)
+	}
+	flags, err = GetPersistentFlags(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 0 {
+		t.Errorf("flags not cleared: %v", flags)
+	}
+}
+
+// TestSetPersistentFlags_Unsupported tests that unknown flags are rejected
+func TestSetPersistentFlags_Unsupported(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	err := SetPersistentFlags(device, []string{FlagSameCPUCrypt, "bogus"})
+	if err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Fatalf("expected unsupported flag error, got %v", err)
+	}
+
+	flags, err := GetPersistentFlags(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 0 {
+		t.Errorf("rejected call modified flags: %v", flags)
+	}
+}
+
+// TestConfigFlagsJSON tests that flags round-trip through the config JSON and
+// are omitted when empty
+func TestConfigFlagsJSON(t *testing.T) {
+	data, err := json.Marshal(&Config{JSONSize: "12288", KeyslotsSize: "16744448"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "flags") {
+		t.Errorf("empty flags serialized: %s", data)
+	}
+
+	in := `{"json_size":"12288","keyslots_size":"16744448","flags":["allow-discards","no-write-workqueue"]}`
+	var cfg Config
+	if err := json.Unmarshal([]byte(in), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.Flags, []string{FlagAllowDiscards, FlagNoWriteWorkqueue}) {
+		t.Errorf("flags = %v", cfg.Flags)
+	}
+
+	out, err := json.Marshal(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("round trip mismatch:\n got %s\nwant %s", out, in)
+	}
+}
@@ -5,11 +5,11 @@
 package luks2
 
 import (
-	"crypto/aes"
+	"context"
 	"fmt"
 	"os"
 
-	"golang.org/x/crypto/xts"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
 )
 
 // Format creates a new LUKS2 volume
@@ -18,6 +18,14 @@ func Format(opts FormatOptions) error {
 	if err := ValidateFormatOptions(opts); err != nil {
 		return err
 	}
+	if err := checkPassphrasePolicy(opts.Passphrase); err != nil {
+		return err
+	}
+
+	// A byte range of the device is formatted through a loop device over it
+	if opts.Offset != 0 || opts.Size != 0 {
+		return formatRegion(opts)
+	}
 
 	// Acquire file lock for exclusive access
 	lock, err := AcquireFileLock(opts.Device)
@@ -26,6 +34,22 @@ func Format(opts FormatOptions) error {
 	}
 	defer func() { _ = lock.Release() }()
 
+	if err := checkFormatTarget(opts.Device, opts.Force); err != nil {
+		return err
+	}
+
+	// Warn when formatting network-backed storage: KDF costs are calibrated
+	// locally and unlock time will additionally include network latency
+	desc := describeForWrite(opts.Device, "format")
+	if desc.Network {
+		emitWarning(Warning{
+			Code:    WarnNetworkKDF,
+			Op:      "format",
+			Device:  opts.Device,
+			Message: "KDF parameters are calibrated for CPU and memory cost only; unlocking over the network will take longer than the target time",
+		})
+	}
+
 	// Set defaults
 	if opts.Cipher == "" {
 		opts.Cipher = DefaultCipher
@@ -40,7 +64,14 @@ func Format(opts FormatOptions) error {
 		opts.HashAlgo = DefaultHashAlgo
 	}
 	if opts.SectorSize == 0 {
-		opts.SectorSize = DefaultSectorSize
+		// Devices with 4K logical blocks (4Kn) cannot use 512-byte sectors
+		opts.SectorSize = max(DefaultSectorSize, desc.LogicalBlockSize)
+		if err := validateSegmentSpecs(opts.Segments, opts.SectorSize); err != nil {
+			return err
+		}
+	}
+	if err := checkSectorSize(desc, opts.SectorSize); err != nil {
+		return err
 	}
 
 	// Open device
@@ -50,13 +81,16 @@ func Format(opts FormatOptions) error {
 	}
 	defer func() { _ = f.Close() }()
 
+	emitEvent(Event{Type: EventFormatStarted, Op: "format", Device: opts.Device})
+
 	// Generate master key
 	masterKeySize := opts.KeySize / 8 // Convert bits to bytes
-	masterKey, err := randomBytes(masterKeySize)
+	masterKeyBuf, err := securemem.NewRandom(masterKeySize)
 	if err != nil {
 		return fmt.Errorf("failed to generate master key: %w", err)
 	}
-	defer clearBytes(masterKey)
+	defer masterKeyBuf.Destroy()
+	masterKey := masterKeyBuf.Bytes()
 
 	// Create binary header
 	hdr, err := CreateBinaryHeader(opts)
@@ -71,34 +105,44 @@ func Format(opts FormatOptions) error {
 	}
 
 	// Derive key from passphrase
-	passphraseKey, err := DeriveKey(opts.Passphrase, kdf, masterKeySize)
+	passphraseKey, err := deriveSecureKey(opts.Passphrase, kdf, masterKeySize)
 	if err != nil {
 		return err
 	}
-	defer clearBytes(passphraseKey)
+	defer passphraseKey.Destroy()
 
 	// Create digest KDF and digest
-	digestKDF, digestValue, err := createDigest(masterKey, opts.HashAlgo)
+	iterations, err := digestIterations(opts)
+	if err != nil {
+		return err
+	}
+	digestKDF, digestValue, err := createDigest(masterKey, opts.HashAlgo, iterations)
 	if err != nil {
 		return err
 	}
 
 	// Apply anti-forensic split to master key
-	afData, err := AFSplit(masterKey, AFStripes, opts.HashAlgo)
+	if opts.AFStripes == 0 {
+		opts.AFStripes = AFStripes
+	}
+	afData, err := AFSplit(masterKey, opts.AFStripes, opts.HashAlgo)
 	if err != nil {
 		return err
 	}
 	defer clearBytes(afData)
 
 	// Encrypt AF-split key material with passphrase-derived key
-	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey, opts.Cipher)
+	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey.Bytes(), opts.Cipher+"-"+opts.CipherMode)
 	if err != nil {
 		return err
 	}
 	defer clearBytes(encryptedKeyMaterial)
 
 	// Calculate offsets and sizes
-	const keyslotAreaStart = 0x8000 // 32KB (after both headers)
+	if opts.MetadataSize == 0 {
+		opts.MetadataSize = LUKS2HeaderMinSize
+	}
+	keyslotAreaStart := 2 * int64(opts.MetadataSize) // after both header copies
 	keyMaterialSize := len(encryptedKeyMaterial)
 	alignedKeyMaterialSize := alignTo(int64(keyMaterialSize), 4096)
 
@@ -112,11 +156,13 @@ func Format(opts FormatOptions) error {
 	// cryptsetup formula: keyslots_size = LUKS2_DEFAULT_HDR_SIZE - 2 * metadata_size
 	// With default 16 KiB metadata: keyslots_size ≈ 16 MiB (LUKS2DefaultKeyslotsSize)
 	//
-	// We use keyslotAreaStart (0x8000 = 32KB) which accounts for 2 header copies,
-	// so keyslots area starts at 32KB and data_offset = 32KB + keyslotsAreaSize
-	keyslotsAreaSize := alignedKeyMaterialSize
-	if keyslotsAreaSize < LUKS2DefaultKeyslotsSize {
-		keyslotsAreaSize = LUKS2DefaultKeyslotsSize
+	// keyslotAreaStart accounts for the 2 header copies, so the keyslots area
+	// starts right after them and data_offset = keyslotAreaStart + keyslotsAreaSize
+	keyslotsAreaSize := opts.KeyslotsSize
+	if keyslotsAreaSize == 0 {
+		keyslotsAreaSize = max(alignedKeyMaterialSize, LUKS2HeaderDefaultSize-keyslotAreaStart)
+	} else if keyslotsAreaSize < alignedKeyMaterialSize {
+		return fmt.Errorf("%w: %d bytes cannot hold a %d-byte keyslot", ErrInvalidKeyslotsSize, keyslotsAreaSize, alignedKeyMaterialSize)
 	}
 
 	dataOffset := keyslotAreaStart + keyslotsAreaSize
@@ -125,39 +171,63 @@ func Format(opts FormatOptions) error {
 	// keyslot0Size is the actual size of keyslot 0's area
 	// keyslotsAreaSize is the total reserved space for keyslots (allows adding more keys)
 	metadata := createMetadata(kdf, digestKDF, digestValue, opts, masterKeySize,
-		keyslotAreaStart, int(alignedKeyMaterialSize), int(keyslotsAreaSize), int(dataOffset))
+		int(keyslotAreaStart), int(alignedKeyMaterialSize), int(keyslotsAreaSize), int(dataOffset))
+
+	// Replace the default dynamic segment with an explicit layout
+	if len(opts.Segments) > 0 {
+		segments, err := layoutSegments(opts.Segments, dataOffset, opts)
+		if err != nil {
+			return err
+		}
+		end, err := segmentsEnd(segments)
+		if err != nil {
+			return err
+		}
+		if devSize, err := getBlockDeviceSize(opts.Device); err == nil && end > devSize {
+			return fmt.Errorf("%w: segments end at %d, beyond the end of the device (%d bytes)", ErrInvalidSegmentLayout, end, devSize)
+		}
+		applySegments(metadata, segments)
+	}
+
+	if opts.Escrow != nil {
+		token, err := wrapEscrow(context.Background(), opts.Escrow, headerUUID(hdr), EscrowSecretVolumeKey, masterKey, nil)
+		if err != nil {
+			return err
+		}
+		metadata.Tokens = map[string]*Token{"0": token}
+	}
+
+	// Segments laid out by the caller must leave room for keyslot 0
+	if err := checkKeyslotArea(metadata, "0", keyslotAreaStart, alignedKeyMaterialSize); err != nil {
+		return err
+	}
 
 	// Write headers
 	if err := writeHeaderInternal(opts.Device, hdr, metadata); err != nil {
 		return err
 	}
 
-	// Write encrypted key material
-	if _, err := f.Seek(int64(keyslotAreaStart), 0); err != nil {
-		return fmt.Errorf("failed to seek to keyslot area: %w", err)
-	}
-	if _, err := f.Write(encryptedKeyMaterial); err != nil {
+	// Write encrypted key material, padded to the aligned size
+	if err := writeKeyslotArea(f, keyslotAreaStart, encryptedKeyMaterial, alignedKeyMaterialSize); err != nil {
 		return fmt.Errorf("failed to write key material: %w", err)
 	}
 
-	// Pad to aligned size
-	padding := make([]byte, alignedKeyMaterialSize-int64(keyMaterialSize))
-	if _, err := f.Write(padding); err != nil {
-		return fmt.Errorf("failed to write padding: %w", err)
-	}
-
 	return f.Sync()
 }
 
 // createMetadata creates the JSON metadata structure
 // keyslot0Size is the actual size of keyslot 0's area
-// keyslotsAreaSize is the total reserved space for all keyslots (for Config.KeyslotsSize)
+// keyslotsAreaSize is the total reserved space for all keyslots (Config.KeyslotsSize)
 func createMetadata(kdf, digestKDF *KDF, digestValue string, opts FormatOptions,
 	masterKeySize, keyslotOffset, keyslot0Size, keyslotsAreaSize, dataOffset int) *LUKS2Metadata {
 
 	// Create keyslot
 	keyslots := make(map[string]*Keyslot)
 	priority := 1
+	stripes := opts.AFStripes
+	if stripes == 0 {
+		stripes = AFStripes
+	}
 	keyslots["0"] = &Keyslot{
 		Type:     "luks2",
 		KeySize:  masterKeySize,
@@ -172,7 +242,7 @@ func createMetadata(kdf, digestKDF *KDF, digestValue string, opts FormatOptions,
 		KDF: kdf,
 		AF: &AntiForensic{
 			Type:    "luks1",
-			Stripes: AFStripes,
+			Stripes: stripes,
 			Hash:    opts.HashAlgo,
 		},
 	}
@@ -200,11 +270,15 @@ func createMetadata(kdf, digestKDF *KDF, digestValue string, opts FormatOptions,
 		Digest:     digestValue,
 	}
 
-	// Create config - KeyslotsSize reflects the total reserved area for all keyslots
+	// Create config - KeyslotsSize is the area reserved for all keyslots,
+	// starting right after the second header copy
 	jsonSize := LUKS2DefaultSize
+	if opts.MetadataSize > 0 {
+		jsonSize = opts.MetadataSize - LUKS2HeaderSize
+	}
 	config := &Config{
 		JSONSize:     formatSize(int64(jsonSize)),
-		KeyslotsSize: formatSize(int64(keyslotOffset + keyslotsAreaSize)),
+		KeyslotsSize: formatSize(int64(keyslotsAreaSize)),
 	}
 
 	return &LUKS2Metadata{
@@ -215,11 +289,9 @@ func createMetadata(kdf, digestKDF *KDF, digestValue string, opts FormatOptions,
 	}
 }
 
-// createDigest creates a digest for master key verification
-func createDigest(masterKey []byte, hashAlgo string) (*KDF, string, error) {
-	// Use PBKDF2 for digest with 600000 iterations (NIST recommendation)
-	digestIterations := 600000
-
+// createDigest creates a digest for master key verification, a PBKDF2 of
+// the key with iterations iterations
+func createDigest(masterKey []byte, hashAlgo string, iterations int) (*KDF, string, error) {
 	salt, err := randomBytes(32)
 	if err != nil {
 		return nil, "", err
@@ -229,7 +301,7 @@ func createDigest(masterKey []byte, hashAlgo string) (*KDF, string, error) {
 		Type:       "pbkdf2",
 		Hash:       hashAlgo,
 		Salt:       encodeBase64(salt),
-		Iterations: &digestIterations,
+		Iterations: &iterations,
 	}
 
 	digest, err := DeriveKey(masterKey, kdf, 32) // 32 bytes digest
@@ -241,19 +313,60 @@ func createDigest(masterKey []byte, hashAlgo string) (*KDF, string, error) {
 	return kdf, encodeBase64(digest), nil
 }
 
-// encryptKeyMaterial encrypts the key material using AES-XTS
-func encryptKeyMaterial(data, key []byte, cipherAlgo string) ([]byte, error) {
-	if cipherAlgo != "aes" {
-		return nil, fmt.Errorf("unsupported cipher: %s", cipherAlgo)
+// digestIterations returns the PBKDF2 iterations of the volume key digest:
+// opts.DigestIterations if set, otherwise what takes DigestIterTime on this
+// machine, like cryptsetup, raised to the DigestIterations constant so a
+// slow machine does not weaken the digest
+func digestIterations(opts FormatOptions) (int, error) {
+	if opts.DigestIterations != 0 {
+		return opts.DigestIterations, nil
+	}
+	iterTime := opts.DigestIterTime
+	if iterTime == 0 {
+		iterTime = DefaultDigestIterTime
 	}
+	iterations, err := BenchmarkPBKDF2(opts.HashAlgo, 32, iterTime)
+	if err != nil {
+		return 0, err
+	}
+	return max(iterations, DigestIterations), nil
+}
 
-	// XTS requires key length to be 32, 64 bytes (for AES-128-XTS, AES-256-XTS)
-	// The key is already the correct size (64 bytes for 512-bit keys)
-	// XTS will internally split it: first half for cipher, second half for tweak
-	xtsCipher, err := xts.NewCipher(aes.NewCipher, key)
+// checkFormatTarget refuses a device holding any signature ProbeSignatures
+// finds, such as a LUKS header (primary or secondary) or a filesystem:
+// formatting would destroy it. With force the signatures are reported as a
+// warning instead.
+func checkFormatTarget(device string, force bool) error {
+	sigs, err := ProbeSignatures(device)
+	if err != nil || len(sigs) == 0 {
+		return err
+	}
+	if !force {
+		return &SignatureError{Device: device, Signatures: sigs}
+	}
+
+	emitWarning(Warning{
+		Code:    WarnExistingSignatures,
+		Op:      "format",
+		Device:  device,
+		Message: "formatting over " + joinSignatures(sigs),
+	})
+	return nil
+}
+
+// encryptKeyMaterial encrypts the key material with the keyslot area
+// encryption, e.g. "aes-xts-plain64"; XTS runs on the selected
+// CryptoBackend
+func encryptKeyMaterial(data, key []byte, encryption string) ([]byte, error) {
+	enc, err := parseKeyslotEncryption(encryption, len(key))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create XTS cipher: %w", err)
+		return nil, err
 	}
+	c, err := enc.newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.Close() }()
 
 	// Encrypt in 512-byte sectors
 	encrypted := make([]byte, len(data))
@@ -271,7 +384,13 @@ func encryptKeyMaterial(data, key []byte, cipherAlgo string) ([]byte, error) {
 		copy(sector, data[start:end])
 
 		encSector := make([]byte, sectorSize)
-		xtsCipher.Encrypt(encSector, sector, uint64(i)) // #nosec G115 - loop counter bounded by data length
+		err := c.Encrypt(encSector, sector, uint64(i)) // #nosec G115 - loop counter bounded by data length
+		if err != nil {
+			clearBytes(sector)
+			clearBytes(encSector)
+			clearBytes(encrypted)
+			return nil, err
+		}
 
 		copy(encrypted[start:end], encSector[:end-start])
 
@@ -283,19 +402,19 @@ func encryptKeyMaterial(data, key []byte, cipherAlgo string) ([]byte, error) {
 	return encrypted, nil
 }
 
-// decryptKeyMaterial decrypts the key material using AES-XTS
-func decryptKeyMaterial(data, key []byte, cipherAlgo string, sectorSize int) ([]byte, error) {
-	if cipherAlgo != "aes" {
-		return nil, fmt.Errorf("unsupported cipher: %s", cipherAlgo)
+// decryptKeyMaterial decrypts the key material with the keyslot area
+// encryption, e.g. "aes-xts-plain64"; XTS runs on the selected
+// CryptoBackend
+func decryptKeyMaterial(data, key []byte, encryption string, sectorSize int) ([]byte, error) {
+	enc, err := parseKeyslotEncryption(encryption, len(key))
+	if err != nil {
+		return nil, err
 	}
-
-	// XTS requires key length to be 32, 64 bytes (for AES-128-XTS, AES-256-XTS)
-	// The key is already the correct size (64 bytes for 512-bit keys)
-	// XTS will internally split it: first half for cipher, second half for tweak
-	xtsCipher, err := xts.NewCipher(aes.NewCipher, key)
+	c, err := enc.newCipher(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create XTS cipher: %w", err)
+		return nil, err
 	}
+	defer func() { _ = c.Close() }()
 
 	// Decrypt in sectors
 	decrypted := make([]byte, len(data))
@@ -312,7 +431,13 @@ func decryptKeyMaterial(data, key []byte, cipherAlgo string, sectorSize int) ([]
 		copy(sector, data[start:end])
 
 		decSector := make([]byte, sectorSize)
-		xtsCipher.Decrypt(decSector, sector, uint64(i)) // #nosec G115 - loop counter bounded by data length
+		err := c.Decrypt(decSector, sector, uint64(i)) // #nosec G115 - loop counter bounded by data length
+		if err != nil {
+			clearBytes(sector)
+			clearBytes(decSector)
+			clearBytes(decrypted)
+			return nil, err
+		}
 
 		copy(decrypted[start:end], decSector[:end-start])
 
@@ -7,7 +7,10 @@
 package luks2
 
 import (
+	"bytes"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -170,3 +173,54 @@ func TestFormatErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestFormatRegion tests formatting a byte range of a larger image
+func TestFormatRegion(t *testing.T) {
+	const offset, size = 4 << 20, 20 << 20
+	image := make([]byte, offset+size+(4<<20))
+	for i := range image {
+		image[i] = 0xa5
+	}
+	tmpfile := filepath.Join(t.TempDir(), "region.img")
+	if err := os.WriteFile(tmpfile, image, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := FormatOptions{
+		Device:        tmpfile,
+		Passphrase:    []byte("test-password"),
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		Offset:        offset,
+		Size:          size,
+	}
+	if err := Format(opts); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	got, err := os.ReadFile(tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:offset], image[:offset]) || !bytes.Equal(got[offset+size:], image[offset+size:]) {
+		t.Error("Format wrote outside the region")
+	}
+	if string(got[offset:offset+LUKS2MagicLen]) != LUKS2Magic {
+		t.Error("no LUKS2 header at the start of the region")
+	}
+
+	loop, err := SetupLoopDeviceWithOptions(tmpfile, &LoopOptions{ReadOnly: true, Offset: offset, SizeLimit: size})
+	if err != nil {
+		t.Fatalf("SetupLoopDeviceWithOptions failed: %v", err)
+	}
+	defer DetachLoopDevice(loop)
+	if _, _, err := ReadHeader(loop); err != nil {
+		t.Fatalf("ReadHeader of the region failed: %v", err)
+	}
+
+	// A region running past the end of the image is refused
+	opts.Offset = int64(len(image)) - size/2
+	if err := Format(opts); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("Format past the end error = %v, want ErrInvalidSize", err)
+	}
+}
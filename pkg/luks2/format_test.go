@@ -7,7 +7,10 @@
 package luks2
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -23,7 +26,7 @@ func TestEncryptKeyMaterial(t *testing.T) {
 		key[i] = byte(i)
 	}
 
-	encrypted, err := encryptKeyMaterial(data, key, "aes")
+	encrypted, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("encryptKeyMaterial() error = %v", err)
 	}
@@ -67,12 +70,12 @@ func TestDecryptKeyMaterial(t *testing.T) {
 	}
 
 	// Encrypt then decrypt
-	encrypted, err := encryptKeyMaterial(data, key, "aes")
+	encrypted, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("encryptKeyMaterial() error = %v", err)
 	}
 
-	decrypted, err := decryptKeyMaterial(encrypted, key, "aes", 512)
+	decrypted, err := decryptKeyMaterial(encrypted, key, "aes-xts-plain64", 512)
 	if err != nil {
 		t.Fatalf("decryptKeyMaterial() error = %v", err)
 	}
@@ -111,13 +114,13 @@ func TestDecryptKeyMaterial_DifferentDataSizes(t *testing.T) {
 				key[i] = byte(i)
 			}
 
-			encrypted, err := encryptKeyMaterial(data, key, "aes")
+			encrypted, err := encryptKeyMaterial(data, key, "aes-xts-plain64")
 			if err != nil {
 				t.Fatalf("encryptKeyMaterial() error = %v", err)
 			}
 
 			// Always use 512-byte sectors for decryption (matches encryptKeyMaterial)
-			decrypted, err := decryptKeyMaterial(encrypted, key, "aes", 512)
+			decrypted, err := decryptKeyMaterial(encrypted, key, "aes-xts-plain64", 512)
 			if err != nil {
 				t.Fatalf("decryptKeyMaterial() error = %v", err)
 			}
@@ -144,12 +147,12 @@ func TestEncryptDecryptRoundTrip(t *testing.T) {
 		key[i] = byte((i + 17) % 256)
 	}
 
-	encrypted, err := encryptKeyMaterial(testData, key, "aes")
+	encrypted, err := encryptKeyMaterial(testData, key, "aes-xts-plain64")
 	if err != nil {
 		t.Fatalf("encrypt error: %v", err)
 	}
 
-	decrypted, err := decryptKeyMaterial(encrypted, key, "aes", 512)
+	decrypted, err := decryptKeyMaterial(encrypted, key, "aes-xts-plain64", 512)
 	if err != nil {
 		t.Fatalf("decrypt error: %v", err)
 	}
@@ -160,3 +163,93 @@ func TestEncryptDecryptRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestDigestIterations(t *testing.T) {
+	iterations, err := digestIterations(FormatOptions{HashAlgo: "sha256", DigestIterations: 5000})
+	if err != nil || iterations != 5000 {
+		t.Errorf("explicit iterations = %d, %v; want 5000", iterations, err)
+	}
+
+	// Benchmarked iterations never drop below the DigestIterations floor
+	iterations, err = digestIterations(FormatOptions{HashAlgo: "sha256", DigestIterTime: 1})
+	if err != nil || iterations != DigestIterations {
+		t.Errorf("1 ms iterations = %d, %v; want %d", iterations, err, DigestIterations)
+	}
+	iterations, err = digestIterations(FormatOptions{HashAlgo: "sha256", DigestIterTime: 10000})
+	if err != nil || iterations < DigestIterations {
+		t.Errorf("10 s iterations = %d, %v; want at least %d", iterations, err, DigestIterations)
+	}
+
+	if _, err := digestIterations(FormatOptions{HashAlgo: "md5"}); err == nil {
+		t.Error("unsupported hash accepted")
+	}
+}
+
+func TestFormat_DigestIterations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{
+		Device:           path,
+		Passphrase:       passphrase,
+		KDFType:          "pbkdf2",
+		PBKDFIterTime:    10,
+		DigestIterations: 12345,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	_, metadata, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metadata.Digests["0"].Iterations; got != 12345 {
+		t.Errorf("digest iterations = %d, want 12345", got)
+	}
+	if err := TestKey(path, passphrase); err != nil {
+		t.Errorf("TestKey failed: %v", err)
+	}
+}
+
+func TestFormat_RefusesExistingHeader(t *testing.T) {
+	first := []byte("test-password")
+	path := formatTestVolume(t, first)
+	opts := FormatOptions{Device: path, Passphrase: []byte("new-password"), KDFType: "pbkdf2", PBKDFIterTime: 10}
+
+	if err := Format(opts); !errors.Is(err, ErrDeviceNotEmpty) {
+		t.Fatalf("Format over a LUKS header error = %v, want ErrDeviceNotEmpty", err)
+	}
+	if err := TestKey(path, first); err != nil {
+		t.Fatalf("refused Format damaged the volume: %v", err)
+	}
+
+	// The secondary header alone is still a volume
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(make([]byte, LUKS2HeaderMinSize), 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(opts); !errors.Is(err, ErrDeviceNotEmpty) {
+		t.Fatalf("Format over a secondary header error = %v, want ErrDeviceNotEmpty", err)
+	}
+
+	opts.Force = true
+	if err := Format(opts); err != nil {
+		t.Fatalf("Format with Force failed: %v", err)
+	}
+	if err := TestKey(path, opts.Passphrase); err != nil {
+		t.Errorf("forced Format did not create a new volume: %v", err)
+	}
+}
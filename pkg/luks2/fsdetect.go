@@ -0,0 +1,140 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUnknownFilesystem indicates no supported filesystem signature was found
+var ErrUnknownFilesystem = errors.New("unknown filesystem")
+
+// fsProbeSize is how much of a device is read to identify its filesystem
+const fsProbeSize = 4096
+
+// XFS signature
+const xfsMagic = "XFSB"
+
+// ext2/3/4 superblock signature and feature flags
+const (
+	extSuperblockOffset     = 1024
+	extSuperblockMagicField = 0x38
+	extCompatField          = 0x5C
+	extIncompatField        = 0x60
+	extRoCompatField        = 0x64
+	extMagic                = 0xEF53
+
+	// Feature flags that distinguish ext2/ext3/ext4 (same rules as blkid)
+	extCompatHasJournal   = 0x0004
+	extIncompatJournalDev = 0x0008
+	ext3IncompatSupported = 0x0002 | 0x0004 | 0x0010 // filetype, recover, meta_bg
+	ext3RoCompatSupported = 0x0001 | 0x0002 | 0x0004 // sparse_super, large_file, btree_dir
+)
+
+// FAT boot sector signatures
+const (
+	fatBootSignatureOffset = 510
+	fatBootSignature       = "\x55\xaa"
+	fat32TypeOffset        = 82
+	fat1xTypeOffset        = 54
+	fat32TypeString        = "FAT32   "
+	fat16TypeString        = "FAT16   "
+	fat12TypeString        = "FAT12   "
+)
+
+// DetectFilesystem identifies the filesystem on a device (typically an
+// unlocked /dev/mapper device) by its on-disk signature. Unlike
+// GetFilesystemInfo it does not require blkid.
+func DetectFilesystem(devicePath string) (FilesystemType, error) {
+	f, err := os.Open(devicePath) // #nosec G304 -- device path supplied by caller
+	if err != nil {
+		return "", fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, fsProbeSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read device: %w", err)
+	}
+
+	return detectFilesystemSignature(buf[:n])
+}
+
+// detectFilesystemSignature identifies a filesystem from the first bytes of a device
+func detectFilesystemSignature(buf []byte) (FilesystemType, error) {
+	if len(buf) >= len(xfsMagic) && string(buf[:len(xfsMagic)]) == xfsMagic {
+		return FilesystemXFS, nil
+	}
+
+	if len(buf) >= extSuperblockOffset+extRoCompatField+4 {
+		sb := buf[extSuperblockOffset:]
+		if binary.LittleEndian.Uint16(sb[extSuperblockMagicField:]) == extMagic {
+			return classifyExt(
+				binary.LittleEndian.Uint32(sb[extCompatField:]),
+				binary.LittleEndian.Uint32(sb[extIncompatField:]),
+				binary.LittleEndian.Uint32(sb[extRoCompatField:]),
+			)
+		}
+	}
+
+	if len(buf) >= fatBootSignatureOffset+2 && string(buf[fatBootSignatureOffset:fatBootSignatureOffset+2]) == fatBootSignature {
+		if bytes.HasPrefix(buf[fat32TypeOffset:], []byte(fat32TypeString)) ||
+			bytes.HasPrefix(buf[fat1xTypeOffset:], []byte(fat16TypeString)) ||
+			bytes.HasPrefix(buf[fat1xTypeOffset:], []byte(fat12TypeString)) {
+			return FilesystemFAT32, nil
+		}
+	}
+
+	return "", ErrUnknownFilesystem
+}
+
+// probeFilesystem names the filesystem whose signature starts buf, or
+// returns "". The second result reports that detection is available.
+func probeFilesystem(buf []byte) (string, bool) {
+	fs, err := detectFilesystemSignature(buf)
+	if err != nil {
+		return "", true
+	}
+	return string(fs), true
+}
+
+// filesystemSignature returns the signature of the filesystem that starts
+// buf, if any
+func filesystemSignature(buf []byte) (Signature, bool) {
+	fs, err := detectFilesystemSignature(buf)
+	if err != nil {
+		return Signature{}, false
+	}
+	sig := Signature{Type: string(fs), Usage: SignatureUsageFilesystem}
+	switch fs {
+	case FilesystemExt2, FilesystemExt3, FilesystemExt4:
+		sig.Offset = extSuperblockOffset + extSuperblockMagicField
+	case FilesystemFAT32:
+		sig.Offset = fatBootSignatureOffset
+	}
+	return sig, true
+}
+
+// classifyExt distinguishes ext2, ext3 and ext4 from superblock feature flags
+func classifyExt(compat, incompat, roCompat uint32) (FilesystemType, error) {
+	if incompat&extIncompatJournalDev != 0 {
+		return "", fmt.Errorf("%w: external ext journal device", ErrUnknownFilesystem)
+	}
+	if incompat&^ext3IncompatSupported != 0 || roCompat&^ext3RoCompatSupported != 0 {
+		return FilesystemExt4, nil
+	}
+	if compat&extCompatHasJournal != 0 {
+		return FilesystemExt3, nil
+	}
+	return FilesystemExt2, nil
+}
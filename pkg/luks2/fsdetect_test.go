@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// extImage builds a minimal ext superblock with the given feature flags
+func extImage(compat, incompat, roCompat uint32) []byte {
+	buf := make([]byte, fsProbeSize)
+	sb := buf[extSuperblockOffset:]
+	binary.LittleEndian.PutUint16(sb[extSuperblockMagicField:], extMagic)
+	binary.LittleEndian.PutUint32(sb[extCompatField:], compat)
+	binary.LittleEndian.PutUint32(sb[extIncompatField:], incompat)
+	binary.LittleEndian.PutUint32(sb[extRoCompatField:], roCompat)
+	return buf
+}
+
+// fatImage builds a minimal FAT boot sector with the given type string
+func fatImage(offset int, fsType string) []byte {
+	buf := make([]byte, fsProbeSize)
+	copy(buf[offset:], fsType)
+	copy(buf[fatBootSignatureOffset:], fatBootSignature)
+	return buf
+}
+
+// TestDetectFilesystemSignature tests filesystem identification by signature
+func TestDetectFilesystemSignature(t *testing.T) {
+	xfs := make([]byte, fsProbeSize)
+	copy(xfs, xfsMagic)
+
+	tests := []struct {
+		name string
+		data []byte
+		want FilesystemType
+	}{
+		{"ext2", extImage(0, 0x0002, 0x0001), FilesystemExt2},
+		{"ext3", extImage(extCompatHasJournal, 0x0002, 0x0003), FilesystemExt3},
+		{"ext4 extents", extImage(extCompatHasJournal, 0x0002|0x0040, 0x0003), FilesystemExt4},
+		{"ext4 metadata_csum", extImage(extCompatHasJournal, 0x0002, 0x0400), FilesystemExt4},
+		{"xfs", xfs, FilesystemXFS},
+		{"fat32", fatImage(fat32TypeOffset, fat32TypeString), FilesystemFAT32},
+		{"fat16", fatImage(fat1xTypeOffset, fat16TypeString), FilesystemFAT32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectFilesystemSignature(tt.data)
+			if err != nil {
+				t.Fatalf("detectFilesystemSignature failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestDetectFilesystemSignature_Unknown tests rejection of unrecognized data
+func TestDetectFilesystemSignature_Unknown(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"zeros", make([]byte, fsProbeSize)},
+		{"short", []byte("XF")},
+		{"fat without type", fatImage(0, "")},
+		{"ext journal device", extImage(0, extIncompatJournalDev, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := detectFilesystemSignature(tt.data); !errors.Is(err, ErrUnknownFilesystem) {
+				t.Errorf("Expected ErrUnknownFilesystem, got %v", err)
+			}
+		})
+	}
+}
+
+// TestDetectFilesystem_File tests detection on a disk image file
+func TestDetectFilesystem_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fs.img")
+	if err := os.WriteFile(path, extImage(extCompatHasJournal, 0x0040, 0), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DetectFilesystem(path)
+	if err != nil {
+		t.Fatalf("DetectFilesystem failed: %v", err)
+	}
+	if got != FilesystemExt4 {
+		t.Errorf("Expected ext4, got %s", got)
+	}
+
+	if _, err := DetectFilesystem("/nonexistent/device"); err == nil {
+		t.Error("Expected error for missing device")
+	}
+}
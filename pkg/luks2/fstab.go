@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FstabEntry is an entry of /etc/fstab (fstab(5))
+type FstabEntry struct {
+	Device     string   // /dev/mapper/<name>, UUID=<uuid>, LABEL=<label> or a path
+	MountPoint string   // Mount point, or none for swap
+	Type       string   // Filesystem type
+	Options    []string // Mount options in the order listed
+	Freq       int      // dump(8) frequency
+	Pass       int      // fsck(8) pass (0 = not checked)
+}
+
+// ParseFstab reads fstab entries. Blank lines and comments are skipped,
+// octal escapes such as \040 are decoded and missing trailing fields take
+// their fstab(5) defaults.
+func ParseFstab(r io.Reader) ([]FstabEntry, error) {
+	var entries []FstabEntry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 6 {
+			return nil, fmt.Errorf("fstab line %d: expected 2 to 6 fields, got %d", n, len(fields))
+		}
+		for i := range fields {
+			fields[i] = unescapeField(fields[i])
+		}
+
+		entry := FstabEntry{Device: fields[0], MountPoint: fields[1], Type: "auto", Options: []string{"defaults"}}
+		if len(fields) > 2 {
+			entry.Type = fields[2]
+		}
+		if len(fields) > 3 {
+			entry.Options = strings.Split(fields[3], ",")
+		}
+		for i, p := range []*int{&entry.Freq, &entry.Pass} {
+			if len(fields) <= 4+i {
+				break
+			}
+			v, err := strconv.Atoi(fields[4+i])
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("fstab line %d: invalid number %q", n, fields[4+i])
+			}
+			*p = v
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fstab: %w", err)
+	}
+	return entries, nil
+}
+
+// String formats the entry as a tab-separated fstab line. Options default
+// to "defaults".
+func (e FstabEntry) String() string {
+	options := e.Options
+	if len(options) == 0 {
+		options = []string{"defaults"}
+	}
+	return strings.Join([]string{
+		escapeField(e.Device), escapeField(e.MountPoint), escapeField(e.Type),
+		escapeField(strings.Join(options, ",")), strconv.Itoa(e.Freq), strconv.Itoa(e.Pass),
+	}, "\t")
+}
+
+// escapeField escapes whitespace and backslashes in a crypttab or fstab
+// field as octal, the way getmntent and systemd expect it
+func escapeField(s string) string {
+	return strings.NewReplacer(" ", `\040`, "\t", `\011`, "\n", `\012`, `\`, `\134`).Replace(s)
+}
+
+// FstabOptions controls FstabEntryFor
+type FstabOptions struct {
+	// MountPoint is where the filesystem is mounted (an absolute path)
+	MountPoint string
+
+	// Options are the mount options (default: defaults)
+	Options []string
+
+	// Pass is the fsck pass (0 = not checked, 2 = after the root filesystem)
+	Pass int
+
+	// ByUUID names the filesystem by UUID=<uuid> instead of
+	// /dev/mapper/<name>, so the entry does not depend on the mapping name
+	ByUUID bool
+}
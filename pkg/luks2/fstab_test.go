@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFstab(t *testing.T) {
+	table := `# <device> <mount point> <type> <options> <dump> <pass>
+UUID=1f2e  /  ext4  errors=remount-ro  0  1
+
+/dev/mapper/data  /srv/my\040data  xfs  defaults,nofail  0  2
+/dev/mapper/cryptswap  none  swap  sw
+LABEL=scratch  /scratch
+`
+	entries, err := ParseFstab(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("ParseFstab failed: %v", err)
+	}
+	want := []FstabEntry{
+		{Device: "UUID=1f2e", MountPoint: "/", Type: "ext4", Options: []string{"errors=remount-ro"}, Pass: 1},
+		{Device: "/dev/mapper/data", MountPoint: "/srv/my data", Type: "xfs", Options: []string{"defaults", "nofail"}, Pass: 2},
+		{Device: "/dev/mapper/cryptswap", MountPoint: "none", Type: "swap", Options: []string{"sw"}},
+		{Device: "LABEL=scratch", MountPoint: "/scratch", Type: "auto", Options: []string{"defaults"}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	for _, bad := range []string{"lonely\n", "a b c d e f g\n", "a /b ext4 defaults x 0\n", "a /b ext4 defaults 0 -1\n"} {
+		if _, err := ParseFstab(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestTabEntryString(t *testing.T) {
+	fstab := FstabEntry{Device: "/dev/mapper/data", MountPoint: "/srv/my data", Type: "ext4", Pass: 2}
+	if got := fstab.String(); got != "/dev/mapper/data\t/srv/my\\040data\text4\tdefaults\t0\t2" {
+		t.Errorf("FstabEntry.String() = %q", got)
+	}
+	crypttab := CrypttabEntry{Name: "data", Device: "UUID=1234", KeyFile: "/etc/keys/my key", Options: []string{"luks", "discard"}}
+	if got := crypttab.String(); got != "data\tUUID=1234\t/etc/keys/my\\040key\tluks,discard" {
+		t.Errorf("CrypttabEntry.String() = %q", got)
+	}
+	if got := (CrypttabEntry{Name: "data", Device: "/dev/sdb"}).String(); got != "data\t/dev/sdb\tnone" {
+		t.Errorf("CrypttabEntry.String() = %q", got)
+	}
+
+	// Formatted entries parse back unchanged
+	fstab.Options = []string{"defaults"}
+	if parsed, err := ParseFstab(strings.NewReader(fstab.String())); err != nil || !reflect.DeepEqual(parsed[0], fstab) {
+		t.Errorf("ParseFstab(String()) = %+v, %v", parsed, err)
+	}
+	if parsed, err := ParseCrypttab(strings.NewReader(crypttab.String())); err != nil || !reflect.DeepEqual(parsed[0], crypttab) {
+		t.Errorf("ParseCrypttab(String()) = %+v, %v", parsed, err)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// OpenOptions contains optional settings for Open
+type OpenOptions struct {
+	// Name is the device-mapper name (empty = MapperNameForUUID of the
+	// volume's UUID)
+	Name string
+
+	// Unlock holds the dm-crypt options for the mapping (nil = defaults)
+	Unlock *UnlockOptions
+}
+
+// VolumeMountOptions contains optional settings for UnlockedVolume.Mount
+type VolumeMountOptions struct {
+	// FSType, Flags, Data and DataSafety are passed to Mount. An empty
+	// FSType is detected.
+	FSType     string
+	Flags      uintptr
+	Data       string
+	DataSafety DataSafety
+
+	// CreateMountPoint creates a missing mount point directory
+	CreateMountPoint bool
+}
+
+// UnlockedVolume is a handle to a volume unlocked by Open. It remembers the
+// mapping, loop device and mount point it set up, so
+//
+//	vol, err := luks2.Open(device, passphrase, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer vol.Close()
+//
+// tears down exactly what was set up, without the caller tracking names.
+// Its methods are safe for concurrent use.
+type UnlockedVolume struct {
+	mu         sync.Mutex
+	device     string
+	name       string
+	loopDevice string
+	mountPoint string
+	fsType     FilesystemType
+	closed     bool
+}
+
+// Open unlocks a LUKS2 device or image file and returns a handle to the
+// mapping. An image file is attached to a loop device that detaches itself
+// when the volume is closed. The device may also be given as UUID=<uuid> or
+// LABEL=<label>. If unlocking fails, the loop device is detached again.
+func Open(device string, passphrase []byte, opts *OpenOptions) (*UnlockedVolume, error) {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+
+	device, err := ResolveDevice(device)
+	if err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		id, err := readLUKS2Identity(device)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidHeader, device, err)
+		}
+		name = MapperNameForUUID(id.UUID)
+	}
+	if IsUnlocked(name) {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeAlreadyUnlocked, name)
+	}
+
+	vol := &UnlockedVolume{device: device, name: name}
+
+	unlockOpts := UnlockOptions{}
+	if opts.Unlock != nil {
+		unlockOpts = *opts.Unlock
+	}
+
+	target := device
+	fi, err := os.Stat(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, device)
+	}
+	if fi.Mode().IsRegular() {
+		loop, err := SetupLoopDevice(device)
+		if err != nil {
+			return nil, err
+		}
+		vol.loopDevice = loop
+		target = loop
+		// Lock takes the loop device down with the mapping
+		unlockOpts.AutoDetachLoop = true
+	}
+
+	if err := UnlockWithOptions(target, passphrase, name, &unlockOpts); err != nil {
+		if vol.loopDevice != "" {
+			_ = DetachLoopDevice(vol.loopDevice)
+		}
+		return nil, err
+	}
+
+	return vol, nil
+}
+
+// Device returns the device or image file that was opened
+func (v *UnlockedVolume) Device() string {
+	return v.device
+}
+
+// Name returns the device-mapper name of the volume
+func (v *UnlockedVolume) Name() string {
+	return v.name
+}
+
+// LoopDevice returns the loop device attached for an image file, or "" for
+// block devices
+func (v *UnlockedVolume) LoopDevice() string {
+	return v.loopDevice
+}
+
+// MountPoint returns where the volume is mounted, or "" if it is not
+func (v *UnlockedVolume) MountPoint() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.mountPoint
+}
+
+// FSType returns the type of the mounted filesystem, or "" if the volume is
+// not mounted
+func (v *UnlockedVolume) FSType() FilesystemType {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.fsType
+}
+
+// MappedPath returns the device node of the mapping, /dev/mapper/<name>
+// or /dev/dm-N without udev
+func (v *UnlockedVolume) MappedPath() (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return "", ErrVolumeClosed
+	}
+	return GetMappedDevicePath(v.name)
+}
+
+// Status reports the state of the mapping
+func (v *UnlockedVolume) Status() (*VolumeStatus, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return nil, ErrVolumeClosed
+	}
+	return Status(v.name)
+}
+
+// Mount waits for the mapper node, detects the filesystem unless opts names
+// one and mounts it at mountPoint. A volume is mounted at most once.
+func (v *UnlockedVolume) Mount(ctx context.Context, mountPoint string, opts *VolumeMountOptions) error {
+	if opts == nil {
+		opts = &VolumeMountOptions{}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return ErrVolumeClosed
+	}
+	if v.mountPoint != "" {
+		return fmt.Errorf("%w: %s at %s", ErrAlreadyMounted, v.name, v.mountPoint)
+	}
+	if err := prepareMountPoint(mountPoint, opts.CreateMountPoint); err != nil {
+		return err
+	}
+
+	devicePath, err := waitForMappedDevice(ctx, v.name)
+	if err != nil {
+		return err
+	}
+
+	fsType := FilesystemType(opts.FSType)
+	if fsType == "" {
+		fsType, err = DetectFilesystem(devicePath)
+		if err != nil {
+			return fmt.Errorf("failed to detect filesystem on %s: %w", devicePath, err)
+		}
+	}
+
+	if err := Mount(MountOptions{
+		Device:     v.name,
+		MountPoint: mountPoint,
+		FSType:     string(fsType),
+		Flags:      opts.Flags,
+		Data:       opts.Data,
+		DataSafety: opts.DataSafety,
+	}); err != nil {
+		return err
+	}
+
+	v.mountPoint, v.fsType = mountPoint, fsType
+	return nil
+}
+
+// Unmount unmounts the filesystem mounted by Mount. The volume stays
+// unlocked.
+func (v *UnlockedVolume) Unmount() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return ErrVolumeClosed
+	}
+	return v.unmount()
+}
+
+// unmount unmounts the volume; the caller holds v.mu
+func (v *UnlockedVolume) unmount() error {
+	if v.mountPoint == "" {
+		return fmt.Errorf("%w: %s", ErrNotMounted, v.name)
+	}
+	if err := Unmount(v.mountPoint, 0); err != nil {
+		return err
+	}
+	v.mountPoint, v.fsType = "", ""
+	return nil
+}
+
+// Close unmounts the volume if it is mounted and locks it. Its loop device,
+// if any, detaches along with the mapping. Closing a closed volume does
+// nothing, so an explicit Close may be followed by a deferred one; if
+// teardown fails, Close can be retried.
+func (v *UnlockedVolume) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return nil
+	}
+
+	if v.mountPoint != "" {
+		if err := v.unmount(); err != nil {
+			return err
+		}
+	}
+	if err := Lock(v.name); err != nil {
+		return err
+	}
+	v.closed = true
+	return nil
+}
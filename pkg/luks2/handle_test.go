@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpen_Errors tests failures before anything is set up
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "plain.img")
+	if err := os.WriteFile(image, make([]byte, 64*1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pass := []byte("test-passphrase")
+
+	if _, err := Open(image, pass, nil); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+	if _, err := Open(filepath.Join(dir, "missing.img"), pass, &OpenOptions{Name: "test-missing"}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+// TestUnlockedVolume_State tests the handle's bookkeeping without a mapping
+func TestUnlockedVolume_State(t *testing.T) {
+	ctx := context.Background()
+
+	vol := &UnlockedVolume{name: "test-handle"}
+	if err := vol.Unmount(); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("Unmount of unmounted volume: expected ErrNotMounted, got %v", err)
+	}
+
+	vol.mountPoint = "/mnt/test-handle"
+	if err := vol.Mount(ctx, t.TempDir(), nil); !errors.Is(err, ErrAlreadyMounted) {
+		t.Errorf("second Mount: expected ErrAlreadyMounted, got %v", err)
+	}
+
+	closed := &UnlockedVolume{name: "test-handle", closed: true}
+	if err := closed.Close(); err != nil {
+		t.Errorf("Close of closed volume: %v", err)
+	}
+	if err := closed.Mount(ctx, t.TempDir(), nil); !errors.Is(err, ErrVolumeClosed) {
+		t.Errorf("Mount: expected ErrVolumeClosed, got %v", err)
+	}
+	if err := closed.Unmount(); !errors.Is(err, ErrVolumeClosed) {
+		t.Errorf("Unmount: expected ErrVolumeClosed, got %v", err)
+	}
+	if _, err := closed.Status(); !errors.Is(err, ErrVolumeClosed) {
+		t.Errorf("Status: expected ErrVolumeClosed, got %v", err)
+	}
+	if _, err := closed.MappedPath(); !errors.Is(err, ErrVolumeClosed) {
+		t.Errorf("MappedPath: expected ErrVolumeClosed, got %v", err)
+	}
+}
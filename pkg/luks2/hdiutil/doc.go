@@ -0,0 +1,13 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hdiutil attaches LUKS2 image files as disks on macOS.
+//
+// macOS has no dm-crypt, so the volume is decrypted in userspace by
+// luks2.Volume and exposed as a plain image file on a private FUSE
+// filesystem (macFUSE must be installed). hdiutil then attaches that file
+// as a raw disk image, which gives a /dev/diskN device that Finder and
+// mount(8) handle like any other disk. Nothing decrypted is written to
+// disk.
+package hdiutil
@@ -0,0 +1,135 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build darwin
+
+package hdiutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// Options contains optional settings for Attach
+type Options struct {
+	// ReadOnly attaches the disk read-only
+	ReadOnly bool
+
+	// NoMount attaches the disk without mounting its filesystems
+	NoMount bool
+
+	// MountPoint mounts the filesystem there instead of under /Volumes
+	MountPoint string
+
+	// Unlock selects the keyslot and derivation parallelism (nil = defaults)
+	Unlock *luks2.UnlockOptions
+}
+
+// Disk is a LUKS2 image attached with Attach
+type Disk struct {
+	Device     string // Whole disk device (e.g. /dev/disk4)
+	MountPoint string // Where the filesystem was mounted ("" with NoMount)
+	ImagePath  string // Decrypted image file on the FUSE filesystem
+
+	vol    *luks2.Volume
+	server *fuse.Server
+	dir    string
+}
+
+// Attach unlocks a LUKS2 image file in userspace and attaches its decrypted
+// contents with hdiutil. If any step fails, the steps before it are undone.
+func Attach(image string, passphrase []byte, opts *Options) (*Disk, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	vol, err := luks2.OpenVolume(image, passphrase, &luks2.VolumeOptions{Unlock: opts.Unlock, Writable: !opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "luks2-")
+	if err != nil {
+		_ = vol.Close()
+		return nil, err
+	}
+
+	server, err := serveImage(dir, vol)
+	if err != nil {
+		_ = os.Remove(dir)
+		_ = vol.Close()
+		return nil, fmt.Errorf("failed to mount FUSE filesystem (is macFUSE installed?): %w", err)
+	}
+
+	d := &Disk{ImagePath: filepath.Join(dir, ImageName), vol: vol, server: server, dir: dir}
+
+	args := []string{"attach", "-plist", "-imagekey", "diskimage-class=CRawDiskImage"}
+	if opts.ReadOnly {
+		args = append(args, "-readonly")
+	}
+	if opts.NoMount {
+		args = append(args, "-nomount")
+	} else if opts.MountPoint != "" {
+		args = append(args, "-mountpoint", opts.MountPoint)
+	}
+	out, err := hdiutil(append(args, d.ImagePath)...)
+	if err == nil {
+		var entities []entity
+		if entities, err = parseAttach(out); err == nil {
+			d.Device = entities[0].DevEntry
+			for _, e := range entities {
+				if e.MountPoint != "" {
+					d.MountPoint = e.MountPoint
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		d.release()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Detach unmounts and detaches the disk, then closes the volume. The disk
+// must not be in use; force detaches it anyway.
+func (d *Disk) Detach(force bool) error {
+	args := []string{"detach", d.Device}
+	if force {
+		args = append(args, "-force")
+	}
+	if _, err := hdiutil(args...); err != nil {
+		return err
+	}
+	return d.release()
+}
+
+// release unmounts the FUSE filesystem and closes the volume
+func (d *Disk) release() error {
+	err := d.server.Unmount()
+	_ = os.Remove(d.dir)
+	return errors.Join(err, d.vol.Close())
+}
+
+// hdiutil runs hdiutil and returns its standard output
+func hdiutil(args ...string) ([]byte, error) {
+	out, err := exec.Command("hdiutil", args...).Output() // #nosec G204 -- fixed binary, arguments built here
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("hdiutil %s: %s", args[0], bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("hdiutil %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin
+
+package hdiutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// ImageName is the name of the decrypted image file in the FUSE filesystem
+const ImageName = "volume.img"
+
+// imageRoot is the root directory of the FUSE filesystem; it holds a single
+// file exposing the decrypted volume
+type imageRoot struct {
+	fs.Inode
+	vol *luks2.Volume
+}
+
+var _ = (fs.NodeOnAdder)((*imageRoot)(nil))
+
+// OnAdd creates the image file
+func (r *imageRoot) OnAdd(ctx context.Context) {
+	file := r.NewPersistentInode(ctx, &imageFile{vol: r.vol}, fs.StableAttr{Mode: fuse.S_IFREG})
+	r.AddChild(ImageName, file, false)
+}
+
+// imageFile reads and writes the decrypted volume through luks2.Volume
+type imageFile struct {
+	fs.Inode
+	vol *luks2.Volume
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*imageFile)(nil))
+	_ = (fs.NodeOpener)((*imageFile)(nil))
+	_ = (fs.NodeReader)((*imageFile)(nil))
+	_ = (fs.NodeWriter)((*imageFile)(nil))
+	_ = (fs.NodeFsyncer)((*imageFile)(nil))
+)
+
+// Getattr reports the size of the decrypted volume
+func (f *imageFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	size := f.vol.Size()
+	out.Mode = 0600
+	out.Size = uint64(size)             // #nosec G115 -- sizes are non-negative
+	out.Blocks = uint64(size+511) / 512 // #nosec G115 -- sizes are non-negative
+	return 0
+}
+
+// Open bypasses the kernel page cache so every access goes through Volume
+func (f *imageFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read decrypts the requested range
+func (f *imageFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := f.vol.ReadAt(dest, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fs.ToErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// Write encrypts data into the volume
+func (f *imageFile) Write(ctx context.Context, fh fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	n, err := f.vol.WriteAt(data, off)
+	if errors.Is(err, luks2.ErrPermissionDenied) {
+		return uint32(n), syscall.EROFS // #nosec G115 -- n <= len(data)
+	}
+	if errors.Is(err, luks2.ErrInvalidSize) {
+		return uint32(n), syscall.ENOSPC // #nosec G115 -- n <= len(data)
+	}
+	return uint32(n), fs.ToErrno(err) // #nosec G115 -- n <= len(data)
+}
+
+// Fsync commits written data to the image file
+func (f *imageFile) Fsync(ctx context.Context, fh fs.FileHandle, flags uint32) syscall.Errno {
+	return fs.ToErrno(f.vol.Sync())
+}
+
+// serveImage mounts a FUSE filesystem at dir exposing vol as dir/ImageName
+func serveImage(dir string, vol *luks2.Volume) (*fuse.Server, error) {
+	return fs.Mount(dir, &imageRoot{vol: vol}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "luks2",
+			Name:   "luks2",
+		},
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package hdiutil
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// openTestVolume formats a small image file and opens it in userspace
+func openTestVolume(t *testing.T, writable bool) *luks2.Volume {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("test-password")
+	if err := luks2.Format(luks2.FormatOptions{Device: path, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	vol, err := luks2.OpenVolume(path, passphrase, &luks2.VolumeOptions{Writable: writable})
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	t.Cleanup(func() { _ = vol.Close() })
+	return vol
+}
+
+// TestImageFile tests the FUSE file operations without mounting
+func TestImageFile(t *testing.T) {
+	ctx := context.Background()
+	f := &imageFile{vol: openTestVolume(t, true)}
+
+	var attr fuse.AttrOut
+	if errno := f.Getattr(ctx, nil, &attr); errno != 0 || attr.Size != uint64(f.vol.Size()) {
+		t.Errorf("Getattr = %v, size %d; want size %d", errno, attr.Size, f.vol.Size())
+	}
+
+	data := []byte("written through FUSE")
+	if n, errno := f.Write(ctx, nil, data, 1000); errno != 0 || int(n) != len(data) {
+		t.Fatalf("Write = %d, %v", n, errno)
+	}
+	if errno := f.Fsync(ctx, nil, 0); errno != 0 {
+		t.Errorf("Fsync = %v", errno)
+	}
+
+	res, errno := f.Read(ctx, nil, make([]byte, len(data)), 1000)
+	if errno != 0 {
+		t.Fatalf("Read = %v", errno)
+	}
+	if got, _ := res.Bytes(nil); !bytes.Equal(got, data) {
+		t.Errorf("Read = %q, want %q", got, data)
+	}
+
+	// A read crossing the end is cut short rather than failing
+	res, errno = f.Read(ctx, nil, make([]byte, 100), f.vol.Size()-10)
+	if got, _ := res.Bytes(nil); errno != 0 || len(got) != 10 {
+		t.Errorf("Read at the end = %d bytes, %v", len(got), errno)
+	}
+
+	if _, errno := f.Write(ctx, nil, data, f.vol.Size()-1); errno != syscall.ENOSPC {
+		t.Errorf("Write past the end = %v, want ENOSPC", errno)
+	}
+}
+
+// TestImageFile_ReadOnly tests that writes to a read-only volume fail
+func TestImageFile_ReadOnly(t *testing.T) {
+	f := &imageFile{vol: openTestVolume(t, false)}
+	if _, errno := f.Write(context.Background(), nil, []byte("data"), 0); errno != syscall.EROFS {
+		t.Errorf("Write = %v, want EROFS", errno)
+	}
+}
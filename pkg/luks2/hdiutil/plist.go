@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hdiutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// entity is one entry of the system-entities array printed by
+// "hdiutil attach -plist": the whole disk first, then its partitions
+type entity struct {
+	DevEntry   string
+	MountPoint string
+}
+
+// parseAttach extracts the system entities from "hdiutil attach -plist"
+// output. Only string values of the entity dictionaries are kept.
+func parseAttach(out []byte) ([]entity, error) {
+	dec := xml.NewDecoder(bytes.NewReader(out))
+	// hdiutil prints a DOCTYPE that the decoder need not resolve
+	dec.Strict = false
+
+	var (
+		entities []entity
+		inArray  bool
+		current  *entity
+		key      string
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid hdiutil plist: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "array":
+				inArray = key == "system-entities"
+			case "dict":
+				if inArray {
+					entities = append(entities, entity{})
+					current = &entities[len(entities)-1]
+				}
+			case "key", "string":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("invalid hdiutil plist: %w", err)
+				}
+				if t.Name.Local == "key" {
+					key = text
+					continue
+				}
+				if current != nil {
+					switch key {
+					case "dev-entry":
+						current.DevEntry = text
+					case "mount-point":
+						current.MountPoint = text
+					}
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "array":
+				inArray = false
+			case "dict":
+				current = nil
+			}
+		}
+	}
+
+	if len(entities) == 0 || entities[0].DevEntry == "" {
+		return nil, fmt.Errorf("hdiutil attached no disk")
+	}
+	return entities, nil
+}
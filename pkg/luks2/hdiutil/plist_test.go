@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package hdiutil
+
+import "testing"
+
+// attachOutput is trimmed "hdiutil attach -plist" output for a GPT disk
+// with one mounted APFS partition
+const attachOutput = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>system-entities</key>
+	<array>
+		<dict>
+			<key>content-hint</key>
+			<string>GUID_partition_scheme</string>
+			<key>dev-entry</key>
+			<string>/dev/disk4</string>
+			<key>potentially-mountable</key>
+			<false/>
+		</dict>
+		<dict>
+			<key>content-hint</key>
+			<string>7C3457EF-0000-11AA-AA11-00306543ECAC</string>
+			<key>dev-entry</key>
+			<string>/dev/disk4s1</string>
+			<key>mount-point</key>
+			<string>/Volumes/secret</string>
+			<key>unmapped-content-hint</key>
+			<string>Apple_APFS</string>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+// TestParseAttach tests extracting devices and mount points
+func TestParseAttach(t *testing.T) {
+	entities, err := parseAttach([]byte(attachOutput))
+	if err != nil {
+		t.Fatalf("parseAttach failed: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("got %d entities, want 2", len(entities))
+	}
+	if entities[0] != (entity{DevEntry: "/dev/disk4"}) {
+		t.Errorf("whole disk = %+v", entities[0])
+	}
+	if entities[1] != (entity{DevEntry: "/dev/disk4s1", MountPoint: "/Volumes/secret"}) {
+		t.Errorf("partition = %+v", entities[1])
+	}
+}
+
+// TestParseAttach_Invalid tests rejecting output without a disk
+func TestParseAttach_Invalid(t *testing.T) {
+	for _, out := range []string{"", "<plist><dict></dict></plist>", "<plist><dict><key>system-entities</key><array>"} {
+		if _, err := parseAttach([]byte(out)); err == nil {
+			t.Errorf("parseAttach(%q) succeeded", out)
+		}
+	}
+}
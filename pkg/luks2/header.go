@@ -13,31 +13,110 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 
 	"github.com/google/uuid"
 )
 
-// ReadHeader reads and validates a LUKS2 header from a device
+// ReadHeader reads and validates a LUKS2 header from a device.
+// If the primary header fails magic, checksum or JSON validation, or the
+// secondary copy is newer, the secondary header is used instead and a
+// WarnHeaderRecovered warning is emitted. Use CheckHeaders to see which copy
+// is damaged and Repair to rewrite it.
+//
+// ReadHeader takes a shared lock on the device, so concurrent readers do
+// not block each other but wait up to LockTimeout for a writer to finish.
 func ReadHeader(device string) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
+	return readHeaderLocked(device, &LockOptions{Shared: true, Timeout: LockTimeout})
+}
+
+// readHeader reads the header without locking. Operations that already
+// hold the exclusive lock must use it: flock locks belong to an open file,
+// so a shared lock taken through a second descriptor would conflict with
+// the caller's own lock.
+func readHeader(device string) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
+	return readHeaderLocked(device, nil)
+}
+
+// readHeaderLocked reads the header, first locking the device as described
+// by lock unless it is nil
+func readHeaderLocked(device string, lock *LockOptions) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
 	// Validate device path
 	if err := ValidateDevicePath(device); err != nil {
 		return nil, nil, err
 	}
 
-	f, err := os.Open(device) // #nosec G304 -- device path validated above
+	var f *os.File
+	if lock != nil {
+		l, err := AcquireFileLockWithOptions(device, lock)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() { _ = l.Release() }()
+		f = l.file
+	} else {
+		var err error
+		f, err = os.Open(device) // #nosec G304 -- device path validated above
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open device: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+	}
+
+	r, done := openSectorReader(device, f)
+	defer done()
+	status := checkHeaderCopies(r, true)
+	hdr, metadata, err := status.active()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open device: %w", err)
+		return nil, nil, err
 	}
-	defer func() { _ = f.Close() }()
 
+	if status.Active == HeaderCopySecondary {
+		reason := "is older than the secondary copy"
+		if status.PrimaryErr != nil {
+			reason = "is damaged: " + status.PrimaryErr.Error()
+		}
+		emitWarning(Warning{
+			Code:    WarnHeaderRecovered,
+			Op:      "read header",
+			Device:  device,
+			Message: "primary LUKS2 header " + reason + "; using the secondary header (run Repair to rewrite it)",
+		})
+	}
+
+	return hdr, metadata, nil
+}
+
+// ParseHeaderBytes parses a LUKS2 header from memory, e.g. a header backup
+// or the first megabytes of an image, for offline analysis. Both header
+// copies are checked and the active one is chosen as ReadHeader does, but
+// no warning is emitted when the secondary copy is used.
+func ParseHeaderBytes(data []byte) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
+	return checkHeaderCopies(bytes.NewReader(data), true).active()
+}
+
+// readHeaderAt reads and validates one header copy at offset. magics lists
+// the magic values accepted for this copy. With schema set, metadata that
+// does not conform to the on-disk format makes the copy invalid; without
+// it any metadata that parses is returned, for tools that must inspect or
+// erase damaged volumes.
+func readHeaderAt(r io.ReaderAt, offset int64, schema bool, magics ...string) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
 	// Read binary header (LUKS2 uses big-endian for integer fields)
 	var hdr LUKS2BinaryHeader
-	if err := binary.Read(f, binary.BigEndian, &hdr); err != nil {
+	if err := binary.Read(io.NewSectionReader(r, offset, LUKS2HeaderSize), binary.BigEndian, &hdr); err != nil {
 		return nil, nil, fmt.Errorf("failed to read header: %w", err)
 	}
 
 	// Validate magic
-	if !bytes.Equal(hdr.Magic[:], []byte(LUKS2Magic)) {
+	validMagic := false
+	for _, magic := range magics {
+		if bytes.Equal(hdr.Magic[:], []byte(magic)) {
+			validMagic = true
+			break
+		}
+	}
+	if !validMagic {
 		return nil, nil, fmt.Errorf("invalid LUKS magic: not a LUKS2 device")
 	}
 
@@ -46,16 +125,36 @@ func ReadHeader(device string) (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
 		return nil, nil, fmt.Errorf("unsupported LUKS version: %d", hdr.Version)
 	}
 
+	// Validate placement and size before allocating the header area
+	// #nosec G115 - offset is one of the fixed header offsets
+	if hdr.HeaderOffset != uint64(offset) {
+		return nil, nil, fmt.Errorf("header offset mismatch: header at %d claims offset %d", offset, hdr.HeaderOffset)
+	}
+	if hdr.HeaderSize < LUKS2HeaderMinSize || hdr.HeaderSize > LUKS2HeaderMaxOffset {
+		return nil, nil, fmt.Errorf("invalid header size: %d", hdr.HeaderSize)
+	}
+	// In-memory headers must hold the whole area, so a forged size cannot
+	// allocate more than the caller supplied
+	// #nosec G115 - header size validated above
+	if sized, ok := r.(interface{ Size() int64 }); ok && offset+int64(hdr.HeaderSize) > sized.Size() {
+		return nil, nil, fmt.Errorf("header area truncated: %d bytes claimed at offset %d, %d available", hdr.HeaderSize, offset, sized.Size()-offset)
+	}
+
 	// Validate checksum
-	if err := validateHeaderChecksum(&hdr, f); err != nil {
+	if err := validateHeaderChecksum(&hdr, r); err != nil {
 		return nil, nil, err
 	}
 
 	// Read JSON metadata
-	metadata, err := readJSONMetadata(f, &hdr)
+	metadata, err := readJSONMetadata(r, &hdr)
 	if err != nil {
 		return nil, nil, err
 	}
+	if schema {
+		if err := validateMetadataSchema(&hdr, metadata); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	return &hdr, metadata, nil
 }
@@ -76,9 +175,11 @@ func IsLUKS(device string) (bool, error) {
 	defer func() { _ = f.Close() }()
 
 	// Read first 6 bytes (LUKS magic)
+	r, done := openSectorReader(device, f)
+	defer done()
 	magic := make([]byte, LUKS2MagicLen)
-	n, err := f.Read(magic)
-	if err != nil {
+	n, err := r.ReadAt(magic, 0)
+	if err != nil && (err != io.EOF || n == 0) {
 		return false, fmt.Errorf("failed to read device: %w", err)
 	}
 	if n < LUKS2MagicLen {
@@ -105,9 +206,11 @@ func IsLUKS2(device string) (bool, error) {
 	defer func() { _ = f.Close() }()
 
 	// Read first 8 bytes (magic + version)
+	r, done := openSectorReader(device, f)
+	defer done()
 	header := make([]byte, 8)
-	n, err := f.Read(header)
-	if err != nil {
+	n, err := r.ReadAt(header, 0)
+	if err != nil && (err != io.EOF || n == 0) {
 		return false, fmt.Errorf("failed to read device: %w", err)
 	}
 	if n < 8 {
@@ -151,16 +254,37 @@ func writeHeaderInternal(device string, hdr *LUKS2BinaryHeader, metadata *LUKS2M
 	}
 	defer func() { _ = f.Close() }()
 
+	r, done := openSectorReader(device, f)
+	defer done()
+	return writeHeaderCopies(f, r, hdr, metadata)
+}
+
+// headerWriter is where writeHeaderCopies writes: a device, or in tests a
+// disk that loses power
+type headerWriter interface {
+	io.WriterAt
+	Sync() error
+}
+
+// writeHeaderCopies writes both header copies so that a crash at any point
+// leaves at least one valid copy on disk. The copy ReadHeader currently
+// uses is written last: the other one is written, synced and read back
+// first, so until the second write starts the old header is intact, and
+// once it starts the new one is. Normally that means the secondary first,
+// as cryptsetup does; after the primary was damaged or left stale, the
+// primary is rewritten before the only good copy is touched.
+func writeHeaderCopies(w headerWriter, r io.ReaderAt, hdr *LUKS2BinaryHeader, metadata *LUKS2Metadata) error {
 	// Marshal JSON metadata
 	jsonData, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	// Calculate JSON size (must be power of 2, at least 16KB)
-	jsonSize := nextPowerOf2(len(jsonData) + 1) // +1 for null terminator
-	if jsonSize < LUKS2DefaultSize {
-		jsonSize = LUKS2DefaultSize
+	// The JSON area size is fixed at format time; metadata that outgrows it
+	// would spill into the secondary header or keyslot area
+	jsonSize := jsonAreaSize(metadata)
+	if len(jsonData)+1 > jsonSize { // +1 for null terminator
+		return fmt.Errorf("metadata is %d bytes but the JSON area holds %d (reformat with a larger metadata size)", len(jsonData), jsonSize-1)
 	}
 
 	// Update header size
@@ -171,50 +295,79 @@ func writeHeaderInternal(device string, hdr *LUKS2BinaryHeader, metadata *LUKS2M
 		return err
 	}
 
-	// Write binary header (LUKS2 uses big-endian for integer fields)
-	if err := binary.Write(f, binary.BigEndian, hdr); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
+	// The backup copy follows the primary, with its own magic and offset
+	backupHdr := *hdr
+	copy(backupHdr.Magic[:], LUKS2MagicBackup)
+	backupHdr.HeaderOffset = hdr.HeaderSize
+	if err := calculateHeaderChecksum(&backupHdr, jsonData, jsonSize); err != nil {
+		return err
 	}
 
-	// Write JSON metadata with padding
-	if _, err := f.Write(jsonData); err != nil {
-		return fmt.Errorf("failed to write metadata: %w", err)
+	copies := []*LUKS2BinaryHeader{&backupHdr, hdr}
+	if checkHeaderCopies(r, true).Active == HeaderCopySecondary {
+		copies[0], copies[1] = copies[1], copies[0]
 	}
-
-	// Null-terminate and pad to jsonSize
-	padding := make([]byte, jsonSize-len(jsonData))
-	if _, err := f.Write(padding); err != nil {
-		return fmt.Errorf("failed to write padding: %w", err)
+	for _, h := range copies {
+		if err := writeHeaderCopy(w, r, h, jsonData, jsonSize); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Write backup header at offset 0x4000
-	if _, err := f.Seek(0x4000, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek to backup header: %w", err)
+// writeHeaderCopy writes one header copy at its offset, syncs it and reads
+// it back, so the next copy is only touched once this one is durable
+func writeHeaderCopy(w headerWriter, r io.ReaderAt, hdr *LUKS2BinaryHeader, jsonData []byte, jsonSize int) error {
+	name, magic := HeaderCopyPrimary, LUKS2Magic
+	if hdr.HeaderOffset != 0 {
+		name, magic = HeaderCopySecondary, LUKS2MagicBackup
 	}
 
-	// Update header offset for backup
-	backupHdr := *hdr
-	backupHdr.HeaderOffset = 0x4000
-
-	// Recalculate checksum for backup header
-	if err := calculateHeaderChecksum(&backupHdr, jsonData, jsonSize); err != nil {
-		return err
+	// LUKS2 uses big-endian for integer fields; the JSON area is
+	// null-terminated and padded to jsonSize
+	buf := bytes.NewBuffer(make([]byte, 0, LUKS2HeaderSize+jsonSize))
+	if err := binary.Write(buf, binary.BigEndian, hdr); err != nil {
+		return fmt.Errorf("failed to encode %s header: %w", name, err)
 	}
+	buf.Write(jsonData)
+	buf.Write(make([]byte, jsonSize-len(jsonData)))
 
-	// Write backup header (LUKS2 uses big-endian for integer fields)
-	if err := binary.Write(f, binary.BigEndian, &backupHdr); err != nil {
-		return fmt.Errorf("failed to write backup header: %w", err)
+	offset, err := SafeUint64ToInt64(hdr.HeaderOffset)
+	if err != nil {
+		return fmt.Errorf("invalid header offset: %w", err)
+	}
+	if _, err := w.WriteAt(buf.Bytes(), offset); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if err := w.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s header: %w", name, err)
 	}
 
-	// Write backup JSON metadata
-	if _, err := f.Write(jsonData); err != nil {
-		return fmt.Errorf("failed to write backup metadata: %w", err)
+	written, _, err := readHeaderAt(r, offset, false, magic)
+	if err != nil {
+		return fmt.Errorf("%s header did not verify after writing: %w", name, err)
 	}
-	if _, err := f.Write(padding); err != nil {
-		return fmt.Errorf("failed to write backup padding: %w", err)
+	if written.SequenceID != hdr.SequenceID || written.Checksum != hdr.Checksum {
+		return fmt.Errorf("%s header did not verify after writing: read back sequence %d, wrote %d", name, written.SequenceID, hdr.SequenceID)
 	}
+	return nil
+}
+
+// validMetadataSize reports whether size is an allowed size for one header
+// copy: a power of two from 16 KiB to 4 MiB
+func validMetadataSize(size int64) bool {
+	return size >= LUKS2HeaderMinSize && size <= LUKS2HeaderMaxOffset && size&(size-1) == 0
+}
 
-	return f.Sync()
+// jsonAreaSize returns the JSON area size recorded in the metadata config,
+// falling back to the default when it is missing or not a valid size
+func jsonAreaSize(metadata *LUKS2Metadata) int {
+	if metadata.Config != nil {
+		if size, err := parseSize(metadata.Config.JSONSize); err == nil && validMetadataSize(size+LUKS2HeaderSize) {
+			return int(size)
+		}
+	}
+	return LUKS2DefaultSize
 }
 
 // CreateBinaryHeader creates a new LUKS2 binary header
@@ -229,8 +382,14 @@ func CreateBinaryHeader(opts FormatOptions) (*LUKS2BinaryHeader, error) {
 	// Set checksum algorithm
 	copy(hdr.ChecksumAlgorithm[:], "sha256")
 
-	// Generate UUID
+	// Use the caller's UUID or generate one
 	u := uuid.New()
+	if opts.UUID != "" {
+		var err error
+		if u, err = parseVolumeUUID(opts.UUID); err != nil {
+			return nil, err
+		}
+	}
 	copy(hdr.UUID[:], u.String())
 
 	// Set label if provided
@@ -353,7 +512,8 @@ func readJSONMetadata(r io.ReaderAt, hdr *LUKS2BinaryHeader) (*LUKS2Metadata, er
 	return &metadata, nil
 }
 
-// GetVolumeInfo extracts volume information from a LUKS device
+// GetVolumeInfo extracts volume information from a LUKS device. Like
+// ReadHeader it reads under a shared lock.
 func GetVolumeInfo(device string) (*VolumeInfo, error) {
 	hdr, metadata, err := ReadHeader(device)
 	if err != nil {
@@ -361,29 +521,111 @@ func GetVolumeInfo(device string) (*VolumeInfo, error) {
 	}
 
 	info := &VolumeInfo{
-		UUID:     string(bytes.TrimRight(hdr.UUID[:], "\x00")),
-		Label:    string(bytes.TrimRight(hdr.Label[:], "\x00")),
-		Version:  int(hdr.Version),
-		Metadata: metadata,
+		UUID:      string(bytes.TrimRight(hdr.UUID[:], "\x00")),
+		Label:     string(bytes.TrimRight(hdr.Label[:], "\x00")),
+		Subsystem: string(bytes.TrimRight(hdr.SubsystemLabel[:], "\x00")),
+		Version:   int(hdr.Version),
+		Metadata:  metadata,
+	}
+	info.HeaderSize = int64(hdr.HeaderSize) // #nosec G115 - header size validated by readHeaderAt
+
+	if metadata.Config != nil {
+		info.Flags = metadata.Config.Flags
+		if metadata.Config.Requirements != nil {
+			info.RequiresFlags = metadata.Config.Requirements.Mandatory
+		}
+		info.KeyslotsSize, _ = parseSize(metadata.Config.KeyslotsSize)
 	}
 
 	// Extract cipher info from first segment
-	for _, seg := range metadata.Segments {
+	for _, id := range sortedIDs(metadata.Segments) {
+		seg := metadata.Segments[id]
 		if seg.Type == "crypt" {
 			info.Cipher = seg.Encryption
 			info.SectorSize = seg.SectorSize
+			info.DataOffset, _ = parseSize(seg.Offset)
+			if seg.Size != "dynamic" {
+				info.DataSize, _ = parseSize(seg.Size)
+			}
+			info.Integrity = segmentIntegrity(seg)
+			info.KeySize = segmentKeySize(metadata, id)
 			break
 		}
 	}
 
-	// Find active keyslots
-	for id := range metadata.Keyslots {
-		// Parse keyslot ID
-		var slotNum int
-		if _, err := fmt.Sscanf(id, "%d", &slotNum); err == nil {
-			info.ActiveKeyslots = append(info.ActiveKeyslots, slotNum)
+	if desc, err := DescribeDevice(device); err == nil {
+		info.DeviceLogicalBlockSize = desc.LogicalBlockSize
+		info.DevicePhysicalBlockSize = desc.PhysicalBlockSize
+		if !desc.IsBlockDevice {
+			info.FileSize = desc.Size
+			info.FileAllocatedSize = desc.AllocatedSize
 		}
 	}
 
+	if status, err := CheckHeaders(device); err == nil {
+		info.Headers = status
+		info.SecondaryHeaderHealthy = status.SecondaryErr == nil && status.SecondarySequence == hdr.SequenceID
+	}
+
+	for _, idStr := range sortedIDs(metadata.Keyslots) {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			info.ActiveKeyslots = append(info.ActiveKeyslots, id)
+			info.Keyslots = append(info.Keyslots, keyslotInfo(metadata, id, metadata.Keyslots[idStr]))
+		}
+	}
+
+	for _, idStr := range sortedIDs(metadata.Tokens) {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		token := metadata.Tokens[idStr]
+		summary := TokenSummary{ID: id, Type: token.Type}
+		for _, ks := range token.Keyslots {
+			if n, err := strconv.Atoi(ks); err == nil {
+				summary.Keyslots = append(summary.Keyslots, n)
+			}
+		}
+		info.Tokens = append(info.Tokens, summary)
+	}
+
 	return info, nil
 }
+
+// segmentIntegrity returns the integrity section of seg, or nil
+func segmentIntegrity(seg *Segment) *IntegrityInfo {
+	raw, ok := seg.Extra["integrity"]
+	if !ok {
+		return nil
+	}
+	var integrity struct {
+		Type              string `json:"type"`
+		JournalEncryption string `json:"journal_encryption"`
+		JournalIntegrity  string `json:"journal_integrity"`
+	}
+	if err := json.Unmarshal(raw, &integrity); err != nil {
+		return nil
+	}
+	return &IntegrityInfo{
+		Type:              integrity.Type,
+		JournalEncryption: integrity.JournalEncryption,
+		JournalIntegrity:  integrity.JournalIntegrity,
+	}
+}
+
+// segmentKeySize returns the volume key size of segment id: that of a
+// keyslot whose digest covers the segment, or 0 if none does
+func segmentKeySize(metadata *LUKS2Metadata, id string) int {
+	for _, digestID := range sortedIDs(metadata.Digests) {
+		digest := metadata.Digests[digestID]
+		if !slices.Contains(digest.Segments, id) {
+			continue
+		}
+		for _, ksID := range digest.Keyslots {
+			if ks := metadata.Keyslots[ksID]; ks != nil {
+				return ks.KeySize
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// headerCorpusDir holds JSON metadata in the layouts written by different
+// cryptsetup versions (see testdata/headers/README.md)
+const headerCorpusDir = "testdata/headers"
+
+// loadHeaderCorpus returns the JSON documents of the header corpus by file name
+func loadHeaderCorpus(tb testing.TB) map[string][]byte {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join(headerCorpusDir, "*.json"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no header corpus in %s (%v)", headerCorpusDir, err)
+	}
+	corpus := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := os.ReadFile(path) // #nosec G304 -- test corpus
+		if err != nil {
+			tb.Fatal(err)
+		}
+		corpus[filepath.Base(path)] = bytes.TrimSpace(data)
+	}
+	return corpus
+}
+
+// encodeHeaders builds both header copies around jsonData, the way
+// cryptsetup lays them out at the start of a device
+func encodeHeaders(tb testing.TB, jsonData []byte, headerSize int, sequence uint64) []byte {
+	tb.Helper()
+	jsonSize := headerSize - LUKS2HeaderSize
+	if len(jsonData) >= jsonSize {
+		tb.Fatalf("metadata is %d bytes but the JSON area holds %d", len(jsonData), jsonSize-1)
+	}
+
+	var buf bytes.Buffer
+	for i, magic := range []string{LUKS2Magic, LUKS2MagicBackup} {
+		// #nosec G115 - test header sizes are small and positive
+		hdr := LUKS2BinaryHeader{
+			Version:      LUKS2Version,
+			HeaderSize:   uint64(headerSize),
+			SequenceID:   sequence,
+			HeaderOffset: uint64(i * headerSize),
+		}
+		copy(hdr.Magic[:], magic)
+		copy(hdr.ChecksumAlgorithm[:], "sha256")
+		copy(hdr.UUID[:], "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1")
+		if err := calculateHeaderChecksum(&hdr, jsonData, jsonSize); err != nil {
+			tb.Fatal(err)
+		}
+		if err := binary.Write(&buf, binary.BigEndian, &hdr); err != nil {
+			tb.Fatal(err)
+		}
+		buf.Write(jsonData)
+		buf.Write(make([]byte, jsonSize-len(jsonData)))
+	}
+	return buf.Bytes()
+}
+
+// corpusHeaderSize returns the header size recorded in a corpus document
+func corpusHeaderSize(tb testing.TB, jsonData []byte) int {
+	tb.Helper()
+	var doc struct {
+		Config struct {
+			JSONSize string `json:"json_size"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		tb.Fatal(err)
+	}
+	size, err := parseSize(doc.Config.JSONSize)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return int(size) + LUKS2HeaderSize
+}
+
+// checkParsedMetadata runs the consumers of parsed metadata that must cope
+// with anything the parser accepts
+func checkParsedMetadata(hdr *LUKS2BinaryHeader, metadata *LUKS2Metadata) {
+	report := &ValidationReport{}
+	validateConfig(report, hdr, metadata)
+	areas := validateKeyslots(report, hdr, metadata)
+	validateSegments(report, metadata, areas)
+	validateDigests(report, metadata)
+	validateDeviceSize(report, metadata, 64<<20)
+	_ = jsonAreaSize(metadata)
+	_, _ = json.Marshal(metadata)
+}
+
+func TestParseHeaderBytes_Corpus(t *testing.T) {
+	for name, jsonData := range loadHeaderCorpus(t) {
+		t.Run(name, func(t *testing.T) {
+			data := encodeHeaders(t, jsonData, corpusHeaderSize(t, jsonData), 3)
+			hdr, metadata, err := ParseHeaderBytes(data)
+			if err != nil {
+				t.Fatalf("ParseHeaderBytes failed: %v", err)
+			}
+			if hdr.SequenceID != 3 || hdr.HeaderOffset != 0 {
+				t.Errorf("expected the primary header, got sequence %d at offset %d", hdr.SequenceID, hdr.HeaderOffset)
+			}
+
+			var raw map[string]map[string]json.RawMessage
+			if err := json.Unmarshal(jsonData, &raw); err != nil {
+				t.Fatal(err)
+			}
+			if len(metadata.Keyslots) != len(raw["keyslots"]) || len(metadata.Segments) != len(raw["segments"]) ||
+				len(metadata.Digests) != len(raw["digests"]) || len(metadata.Tokens) != len(raw["tokens"]) {
+				t.Errorf("parsed %d keyslots, %d segments, %d digests, %d tokens; corpus has %d, %d, %d, %d",
+					len(metadata.Keyslots), len(metadata.Segments), len(metadata.Digests), len(metadata.Tokens),
+					len(raw["keyslots"]), len(raw["segments"]), len(raw["digests"]), len(raw["tokens"]))
+			}
+			checkParsedMetadata(hdr, metadata)
+		})
+	}
+}
+
+func TestParseHeaderBytes_Requirements(t *testing.T) {
+	jsonData := loadHeaderCorpus(t)["cryptsetup-2.4-reencrypt.json"]
+	_, metadata, err := ParseHeaderBytes(encodeHeaders(t, jsonData, corpusHeaderSize(t, jsonData), 1))
+	if err != nil {
+		t.Fatalf("ParseHeaderBytes failed: %v", err)
+	}
+	if metadata.Config.Requirements == nil || len(metadata.Config.Requirements.Mandatory) != 1 ||
+		metadata.Config.Requirements.Mandatory[0] != "online-reencrypt-v2" {
+		t.Errorf("expected the online-reencrypt-v2 requirement, got %+v", metadata.Config.Requirements)
+	}
+	if metadata.Keyslots["1"].Type != "reencrypt" || string(metadata.Keyslots["1"].Extra["mode"]) != `"reencrypt"` {
+		t.Errorf("expected the reencrypt keyslot, got %+v", metadata.Keyslots["1"])
+	}
+}
+
+func TestParseHeaderBytes_Errors(t *testing.T) {
+	jsonData := loadHeaderCorpus(t)["cryptsetup-2.0-argon2i.json"]
+	headerSize := corpusHeaderSize(t, jsonData)
+	data := encodeHeaders(t, jsonData, headerSize, 1)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "failed to read header"},
+		{"not LUKS", make([]byte, 2*headerSize), "invalid LUKS magic"},
+		{"truncated", data[:headerSize-1], "header area truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseHeaderBytes(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// A damaged primary falls back to the secondary copy
+	damaged := bytes.Clone(data)
+	damaged[LUKS2HeaderSize] ^= 0xff
+	hdr, _, err := ParseHeaderBytes(damaged)
+	if err != nil {
+		t.Fatalf("ParseHeaderBytes failed: %v", err)
+	}
+	if string(bytes.TrimRight(hdr.Magic[:], "\x00")) != LUKS2Magic || hdr.HeaderOffset != 0 {
+		t.Errorf("expected the secondary copy presented as primary, got magic %q at offset %d", hdr.Magic, hdr.HeaderOffset)
+	}
+}
+
+// FuzzParseHeaderBytes feeds mutated header areas to the parser. Run it with
+// go test -run '^$' -fuzz FuzzParseHeaderBytes ./pkg/luks2/
+func FuzzParseHeaderBytes(f *testing.F) {
+	for _, jsonData := range loadHeaderCorpus(f) {
+		data := encodeHeaders(f, jsonData, corpusHeaderSize(f, jsonData), 1)
+		f.Add(data)
+		// Secondary copy only, as after the primary was wiped
+		f.Add(append(make([]byte, len(data)/2), data[len(data)/2:]...))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		hdr, metadata, err := ParseHeaderBytes(data)
+		if err != nil {
+			return
+		}
+		// #nosec G115 - header size validated by the parser
+		if int(hdr.HeaderSize) > len(data) {
+			t.Fatalf("accepted a %d byte header from %d bytes", hdr.HeaderSize, len(data))
+		}
+		checkParsedMetadata(hdr, metadata)
+	})
+}
+
+// FuzzReadJSONMetadata feeds arbitrary JSON to the metadata parser. Unlike
+// FuzzParseHeaderBytes it needs no valid checksum, so mutations reach the
+// JSON decoder directly.
+func FuzzReadJSONMetadata(f *testing.F) {
+	for _, jsonData := range loadHeaderCorpus(f) {
+		f.Add(jsonData)
+	}
+	f.Add([]byte(`{"keyslots":{"0":null},"segments":{"0":null},"digests":{"0":null},"tokens":{"0":null}}`))
+
+	hdr := &LUKS2BinaryHeader{HeaderSize: LUKS2HeaderMinSize}
+	f.Fuzz(func(t *testing.T, jsonData []byte) {
+		area := make([]byte, LUKS2HeaderMinSize)
+		copy(area[LUKS2HeaderSize:], jsonData)
+		metadata, err := readJSONMetadata(bytes.NewReader(area), hdr)
+		if err != nil {
+			return
+		}
+		// Validate and the wipe code see metadata that fails the schema check
+		_ = validateMetadataSchema(hdr, metadata)
+		checkParsedMetadata(hdr, metadata)
+	})
+}
@@ -90,7 +90,7 @@ func TestHeaderWriteRead(t *testing.T) {
 				Segments:   []string{"0"},
 				Hash:       "sha256",
 				Salt:       "ZGlnZXN0c2FsdDEyMzQ1Njc4", // base64
-				Digest:     "dGVzdGRpZ2VzdDE",
+				Digest:     "dGVzdGRpZ2VzdDE=",
 				Iterations: 100000,
 			},
 		},
@@ -98,7 +98,7 @@ func TestHeaderWriteRead(t *testing.T) {
 			JSONSize:     "16384",
 			KeyslotsSize: "3145728",
 			Flags:        []string{},
-			Requirements: []string{},
+			Requirements: &Requirements{},
 		},
 	}
 
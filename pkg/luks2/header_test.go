@@ -2,7 +2,7 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
-//go:build !integration
+//go:build !integration && linux
 
 package luks2
 
@@ -11,7 +11,11 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"unsafe"
 
@@ -751,3 +755,215 @@ func TestCalculateHeaderChecksumEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// formatSizedVolume formats a 20MB image with the given header sizes
+func formatSizedVolume(t *testing.T, metadataSize int, keyslotsSize int64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    []byte("test-password"),
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		MetadataSize:  metadataSize,
+		KeyslotsSize:  keyslotsSize,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	return path
+}
+
+func TestFormat_MetadataSize(t *testing.T) {
+	const metadataSize = 64 * 1024
+	const keyslotsSize = 1024 * 1024
+	device := formatSizedVolume(t, metadataSize, keyslotsSize)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if hdr.HeaderSize != metadataSize {
+		t.Errorf("HeaderSize = %d, want %d", hdr.HeaderSize, metadataSize)
+	}
+	if metadata.Config.JSONSize != formatSize(metadataSize-LUKS2HeaderSize) {
+		t.Errorf("json_size = %s", metadata.Config.JSONSize)
+	}
+	if metadata.Config.KeyslotsSize != formatSize(keyslotsSize) {
+		t.Errorf("keyslots_size = %s", metadata.Config.KeyslotsSize)
+	}
+	if metadata.Keyslots["0"].Area.Offset != formatSize(2*metadataSize) {
+		t.Errorf("keyslot 0 offset = %s, want %d", metadata.Keyslots["0"].Area.Offset, 2*metadataSize)
+	}
+	if metadata.Segments["0"].Offset != formatSize(2*metadataSize+keyslotsSize) {
+		t.Errorf("segment offset = %s, want %d", metadata.Segments["0"].Offset, 2*metadataSize+keyslotsSize)
+	}
+
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatalf("CheckHeaders failed: %v", err)
+	}
+	if status.SecondaryErr != nil || status.SecondaryOffset != metadataSize {
+		t.Errorf("secondary header at %d: %v", status.SecondaryOffset, status.SecondaryErr)
+	}
+
+	// A second keyslot is placed after the first, past both header copies
+	if err := AddKey(device, []byte("test-password"), []byte("second-password"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if err := TestKey(device, []byte("second-password")); err != nil {
+		t.Errorf("TestKey failed: %v", err)
+	}
+
+	report, err := Validate(device)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected clean report, got %v", report.Problems)
+	}
+}
+
+func TestFormat_InvalidHeaderSizes(t *testing.T) {
+	tests := []struct {
+		name         string
+		metadataSize int
+		keyslotsSize int64
+		want         error
+	}{
+		{"metadata not a power of 2", 20000, 0, ErrInvalidMetadataSize},
+		{"metadata too small", 8192, 0, ErrInvalidMetadataSize},
+		{"metadata too large", 8 * 1024 * 1024, 0, ErrInvalidMetadataSize},
+		{"keyslots unaligned", 0, 1000, ErrInvalidKeyslotsSize},
+		{"keyslots too large", 0, LUKS2MaxKeyslotsSize + 4096, ErrInvalidKeyslotsSize},
+		{"keyslots too small for a keyslot", 0, 4096, ErrInvalidKeyslotsSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "volume.luks")
+			if err := os.WriteFile(path, make([]byte, 1024*1024), 0600); err != nil {
+				t.Fatal(err)
+			}
+			err := Format(FormatOptions{
+				Device:        path,
+				Passphrase:    []byte("test-password"),
+				KDFType:       "pbkdf2",
+				PBKDFIterTime: 10,
+				MetadataSize:  tt.metadataSize,
+				KeyslotsSize:  tt.keyslotsSize,
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestWriteHeader_JSONAreaFull(t *testing.T) {
+	device := formatSizedVolume(t, 0, 0)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Tokens = map[string]*Token{
+		"0": {Type: "big", Keyslots: []string{strings.Repeat("x", LUKS2DefaultSize)}},
+	}
+	if err := WriteHeader(device, hdr, metadata); err == nil {
+		t.Fatal("expected error for metadata larger than the JSON area")
+	}
+
+	// The on-disk header is untouched
+	if _, _, err := ReadHeader(device); err != nil {
+		t.Errorf("header damaged by rejected write: %v", err)
+	}
+}
+
+func TestWipeHeaders_MetadataSize(t *testing.T) {
+	const metadataSize = 256 * 1024
+	device := formatSizedVolume(t, metadataSize, 0)
+
+	if err := Wipe(WipeOptions{Device: device, Passes: 1, HeaderOnly: true}); err != nil {
+		t.Fatalf("Wipe failed: %v", err)
+	}
+
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatalf("CheckHeaders failed: %v", err)
+	}
+	if status.PrimaryErr == nil || status.SecondaryErr == nil {
+		t.Errorf("expected both header copies wiped, got %+v", status)
+	}
+}
+
+func TestGetVolumeInfo_Details(t *testing.T) {
+	const metadataSize = 64 * 1024
+	const keyslotsSize = 1024 * 1024
+	device := formatSizedVolume(t, metadataSize, keyslotsSize)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.Config.Flags = []string{"allow-discards"}
+	metadata.Config.Requirements = &Requirements{Mandatory: []string{"online-reencrypt-v2"}}
+	metadata.Segments["0"].Extra = map[string]json.RawMessage{
+		"integrity": json.RawMessage(`{"type":"hmac(sha256)","journal_encryption":"none","journal_integrity":"none"}`),
+	}
+	metadata.Tokens = map[string]*Token{"0": {Type: "systemd-tpm2", Keyslots: []string{"0"}}}
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := GetVolumeInfo(device)
+	if err != nil {
+		t.Fatalf("GetVolumeInfo failed: %v", err)
+	}
+	if info.KeySize != 64 {
+		t.Errorf("KeySize = %d, want 64", info.KeySize)
+	}
+	if strings.Join(info.Flags, ",") != "allow-discards" || strings.Join(info.RequiresFlags, ",") != "online-reencrypt-v2" {
+		t.Errorf("Flags = %v, RequiresFlags = %v", info.Flags, info.RequiresFlags)
+	}
+	if want := int64(2*metadataSize + keyslotsSize); info.DataOffset != want || info.DataSize != 0 {
+		t.Errorf("data segment at %d, size %d; want %d, dynamic", info.DataOffset, info.DataSize, want)
+	}
+	if info.Integrity == nil || info.Integrity.Type != "hmac(sha256)" || info.Integrity.JournalEncryption != "none" {
+		t.Errorf("Integrity = %+v", info.Integrity)
+	}
+	if info.HeaderSize != metadataSize || info.KeyslotsSize != keyslotsSize {
+		t.Errorf("HeaderSize = %d, KeyslotsSize = %d", info.HeaderSize, info.KeyslotsSize)
+	}
+	if !info.SecondaryHeaderHealthy || info.Headers == nil {
+		t.Errorf("secondary header reported unhealthy: %+v", info.Headers)
+	}
+	if len(info.Tokens) != 1 || info.Tokens[0].Type != "systemd-tpm2" || len(info.Tokens[0].Keyslots) != 1 || info.Tokens[0].Keyslots[0] != 0 {
+		t.Errorf("Tokens = %+v", info.Tokens)
+	}
+	if len(info.Keyslots) != 1 {
+		t.Fatalf("Keyslots = %+v", info.Keyslots)
+	}
+	ks := info.Keyslots[0]
+	if ks.KDFType != "pbkdf2" || ks.KDFHash != "sha256" || ks.KDFIterations <= 0 || ks.KDFMemory != 0 {
+		t.Errorf("KDF parameters = %+v", ks)
+	}
+	if ks.AFStripes != AFStripes || ks.AFHash != "sha256" || ks.AreaKeySize != 64 || ks.Encryption != "aes-xts-plain64" {
+		t.Errorf("keyslot area = %+v", ks)
+	}
+
+	// A damaged secondary copy is reported, while the primary keeps working
+	corruptAt(t, device, metadataSize+LUKS2HeaderSize)
+	info, err = GetVolumeInfo(device)
+	if err != nil {
+		t.Fatalf("GetVolumeInfo failed: %v", err)
+	}
+	if info.SecondaryHeaderHealthy || info.Headers.SecondaryErr == nil {
+		t.Error("damaged secondary header reported healthy")
+	}
+}
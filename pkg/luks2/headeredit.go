@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import "fmt"
+
+// HeaderEditor holds the header of a LUKS2 device, image or header backup
+// open for offline editing. The device stays exclusively locked until
+// Close, so no other luks2 operation changes the header in between:
+//
+//	e, err := luks2.OpenHeader("/dev/sdb1")
+//	if err != nil {
+//		return err
+//	}
+//	defer e.Close()
+//	delete(e.Metadata.Tokens, "2")
+//	return e.Commit()
+//
+// Header and Metadata may be changed freely; Commit checks the result
+// against the LUKS2 format before writing. Changes to keyslots, digests or
+// segments are not checked against the key material: a keyslot whose KDF
+// parameters no longer match its area cannot be opened. Escrowed secrets
+// are bound to the header UUID. A HeaderEditor is not safe for concurrent
+// use.
+type HeaderEditor struct {
+	Header   *LUKS2BinaryHeader
+	Metadata *LUKS2Metadata
+
+	device   string
+	jsonSize int
+	lock     *FileLock
+}
+
+// OpenHeader locks device and reads its active header copy for editing.
+// The secondary copy is used, with a WarnHeaderRecovered warning, when the
+// primary is damaged; Commit rewrites both.
+func OpenHeader(device string) (*HeaderEditor, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		_ = lock.Release()
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	return &HeaderEditor{
+		Header:   hdr,
+		Metadata: metadata,
+		device:   device,
+		jsonSize: jsonAreaSize(metadata),
+		lock:     lock,
+	}, nil
+}
+
+// Device returns the path the editor was opened on
+func (e *HeaderEditor) Device() string {
+	return e.device
+}
+
+// Validate checks the edited header against the LUKS2 format, as Commit
+// does before writing. It returns a *MetadataError for a violation.
+func (e *HeaderEditor) Validate() error {
+	if e.lock == nil {
+		return ErrHeaderClosed
+	}
+	if e.Header == nil || e.Metadata == nil {
+		return fmt.Errorf("%w: header or metadata is nil", ErrInvalidHeader)
+	}
+	if e.Metadata.Config != nil && jsonAreaSize(e.Metadata) != e.jsonSize {
+		// The JSON area size fixes where the second copy and the keyslots
+		// area start; changing it would overwrite key material
+		return metadataErrorf("config.json_size", "cannot change from %d", e.jsonSize)
+	}
+	return validateMetadataSchema(e.Header, e.Metadata)
+}
+
+// Commit validates the edits and writes both header copies with a new
+// sequence ID and checksums. The editor stays open, so further edits can
+// be committed.
+func (e *HeaderEditor) Commit() error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	e.Header.SequenceID++
+	if err := writeHeaderInternal(e.device, e.Header, e.Metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	return nil
+}
+
+// Close releases the device lock. Uncommitted edits are discarded. Close is
+// idempotent.
+func (e *HeaderEditor) Close() error {
+	if e.lock == nil {
+		return nil
+	}
+	err := e.lock.Release()
+	e.lock = nil
+	return err
+}
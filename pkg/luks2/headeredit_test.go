@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestHeaderEditor tests stripping a token offline and migrating it to
+// another volume
+func TestHeaderEditor(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	if err := ImportToken(device, 0, &Token{Type: "systemd-tpm2", Keyslots: []string{"0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportToken(device, 1, &Token{Type: "x-vendor", Keyslots: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := OpenHeader(device)
+	if err != nil {
+		t.Fatalf("OpenHeader failed: %v", err)
+	}
+	seq := e.Header.SequenceID
+	tpm2 := e.Metadata.Tokens["0"]
+	delete(e.Metadata.Tokens, "0")
+	if err := e.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	// The device stays locked until Close
+	if _, err := AcquireFileLockWithOptions(device, &LockOptions{Timeout: 10 * time.Millisecond}); err == nil {
+		t.Error("device not locked while the editor is open")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+	if err := e.Commit(); !errors.Is(err, ErrHeaderClosed) {
+		t.Errorf("expected ErrHeaderClosed after Close, got %v", err)
+	}
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if hdr.SequenceID != seq+1 || len(metadata.Tokens) != 1 || metadata.Tokens["1"] == nil {
+		t.Errorf("expected sequence %d with token 1 only, got %d with %v", seq+1, hdr.SequenceID, metadata.Tokens)
+	}
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NeedsRepair() {
+		t.Errorf("headers out of sync after Commit: %+v", status)
+	}
+	if _, err := ExtractVolumeKey(device, passphrase); err != nil {
+		t.Errorf("ExtractVolumeKey failed after editing: %v", err)
+	}
+
+	// Migrate the stripped token to another volume
+	other := formatTestVolume(t, passphrase)
+	dst, err := OpenHeader(other)
+	if err != nil {
+		t.Fatalf("OpenHeader failed: %v", err)
+	}
+	dst.Metadata.Tokens = map[string]*Token{"0": tpm2}
+	if err := dst.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	_ = dst.Close()
+	if token, err := GetToken(other, 0); err != nil || token.Type != "systemd-tpm2" {
+		t.Errorf("migrated token = %+v, %v", token, err)
+	}
+}
+
+// TestHeaderEditor_Invalid tests that Commit refuses edits ReadHeader
+// would reject, and leaves the device unchanged
+func TestHeaderEditor_Invalid(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	tests := []struct {
+		name   string
+		modify func(e *HeaderEditor)
+		path   string
+	}{
+		{"dangling digest keyslot", func(e *HeaderEditor) {
+			e.Metadata.Digests["0"].Keyslots = append(e.Metadata.Digests["0"].Keyslots, "9")
+		}, "digests.0.keyslots[1]"},
+		{"kdf without iterations", func(e *HeaderEditor) { e.Metadata.Keyslots["0"].KDF.Iterations = nil }, "keyslots.0.kdf.iterations"},
+		{"json_size changed", func(e *HeaderEditor) { e.Metadata.Config.JSONSize = "1044480" }, "config.json_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := OpenHeader(device)
+			if err != nil {
+				t.Fatalf("OpenHeader failed: %v", err)
+			}
+			defer func() { _ = e.Close() }()
+			seq := e.Header.SequenceID
+
+			tt.modify(e)
+			var merr *MetadataError
+			if err := e.Commit(); !errors.As(err, &merr) || merr.Path != tt.path {
+				t.Fatalf("expected a MetadataError for %s, got %v", tt.path, err)
+			}
+			if e.Header.SequenceID != seq {
+				t.Errorf("sequence ID changed by a rejected Commit")
+			}
+		})
+	}
+
+	if _, _, err := ReadHeader(device); err != nil {
+		t.Errorf("device damaged by rejected edits: %v", err)
+	}
+}
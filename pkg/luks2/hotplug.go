@@ -0,0 +1,420 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Netlink multicast groups of NETLINK_KOBJECT_UEVENT
+const (
+	ueventGroupKernel = 1 // Raw kernel events, sent before udev has run
+	ueventGroupUdev   = 2 // Events re-broadcast by udevd once it has processed them
+)
+
+// udevMonitorMagic identifies the header libudev puts in front of the
+// properties of a re-broadcast event (stored big-endian)
+const udevMonitorMagic = 0xfeedcafe
+
+// ueventBufferSize is the largest uevent accepted; the kernel limits its
+// events to 2048 bytes and udev adds its header and properties
+const ueventBufferSize = 8192
+
+// HotplugEventType identifies what a HotplugEvent reports
+type HotplugEventType string
+
+const (
+	// HotplugAttached is emitted when a block device with a LUKS header
+	// appears, or an existing device gains one (new media, a fresh Format)
+	HotplugAttached HotplugEventType = "attached"
+
+	// HotplugDetached is emitted when a device reported as attached is
+	// removed or no longer holds a LUKS header
+	HotplugDetached HotplugEventType = "detached"
+)
+
+// HotplugEvent reports a LUKS volume appearing or disappearing
+type HotplugEvent struct {
+	Type      HotplugEventType
+	Volume    DiscoveredVolume // The volume, as last probed
+	Removable bool             // Removable media or a USB-attached disk
+	Time      time.Time
+}
+
+// WatcherOptions contains optional settings for NewWatcher
+type WatcherOptions struct {
+	// Existing reports the LUKS volumes already attached as HotplugAttached
+	// events before any hotplug event
+	Existing bool
+
+	// RemovableOnly ignores devices that are neither removable media nor
+	// attached over USB
+	RemovableOnly bool
+}
+
+// Watcher watches for block devices with LUKS headers being attached and
+// detached, so an agent can prompt for a passphrase when an encrypted USB
+// stick is plugged in:
+//
+//	w, err := luks2.NewWatcher(&luks2.WatcherOptions{RemovableOnly: true})
+//	if err != nil {
+//		return err
+//	}
+//	defer w.Close()
+//	for ev := range w.Events() {
+//		if ev.Type == luks2.HotplugAttached && !ev.Volume.Unlocked {
+//			promptAndUnlock(ev.Volume.Device)
+//		}
+//	}
+//
+// Events come from udev once it has set up the device node, or from the
+// kernel when udevd is not running. Only events sent by the kernel or by
+// root are accepted.
+type Watcher struct {
+	opts   WatcherOptions
+	events chan HotplugEvent
+	known  map[string]HotplugEvent // Attached volumes by kernel device name
+
+	sock  int
+	wake  int
+	group uint32
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+	err       error
+}
+
+// NewWatcher starts watching for LUKS volumes (nil opts = defaults). Close
+// stops it.
+func NewWatcher(opts *WatcherOptions) (*Watcher, error) {
+	if opts == nil {
+		opts = &WatcherOptions{}
+	}
+
+	group := uint32(ueventGroupKernel)
+	if udevRunning() {
+		group = ueventGroupUdev
+	}
+	sock, err := openUeventSocket(group)
+	if err != nil {
+		return nil, err
+	}
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		_ = unix.Close(sock)
+		return nil, fmt.Errorf("failed to create eventfd: %w", err)
+	}
+
+	w := &Watcher{
+		opts:    *opts,
+		events:  make(chan HotplugEvent, 16),
+		known:   make(map[string]HotplugEvent),
+		sock:    sock,
+		wake:    wake,
+		group:   group,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// openUeventSocket opens a netlink socket subscribed to group
+func openUeventSocket(group uint32) (int, error) {
+	sock, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open uevent socket: %w", err)
+	}
+	// Bursts of events (a hub with several disks) overflow the default
+	// buffer; an overflow is recovered from by rescanning, so this is
+	// best effort
+	_ = unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_RCVBUF, 1024*1024)
+	if err := unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_PASSCRED, 1); err != nil {
+		_ = unix.Close(sock)
+		return -1, fmt.Errorf("failed to enable sender credentials: %w", err)
+	}
+	if err := unix.Bind(sock, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: group}); err != nil {
+		_ = unix.Close(sock)
+		return -1, fmt.Errorf("failed to subscribe to uevents: %w", err)
+	}
+	return sock, nil
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the watcher stops; Err then reports why.
+func (w *Watcher) Events() <-chan HotplugEvent {
+	return w.events
+}
+
+// Err returns the error that stopped the watcher, or nil while it runs and
+// after Close
+func (w *Watcher) Err() error {
+	select {
+	case <-w.stopped:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the watcher and closes the Events channel. Close is
+// idempotent.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		var one [8]byte
+		binary.NativeEndian.PutUint64(one[:], 1)
+		_, _ = unix.Write(w.wake, one[:])
+		<-w.stopped
+		_ = unix.Close(w.sock)
+		_ = unix.Close(w.wake)
+	})
+	return nil
+}
+
+// run reads uevents until Close or a socket error
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	defer close(w.events)
+
+	if w.opts.Existing {
+		w.rescan()
+	}
+
+	buf := make([]byte, ueventBufferSize)
+	oob := make([]byte, unix.CmsgSpace(unix.SizeofUcred))
+	for {
+		fds := []unix.PollFd{
+			{Fd: int32(w.sock), Events: unix.POLLIN}, // #nosec G115 -- file descriptors fit in int32
+			{Fd: int32(w.wake), Events: unix.POLLIN}, // #nosec G115 -- file descriptors fit in int32
+		}
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			w.err = fmt.Errorf("failed to poll uevent socket: %w", err)
+			return
+		}
+		if w.closed() {
+			return
+		}
+		if fds[0].Revents == 0 {
+			continue
+		}
+
+		n, oobn, _, from, err := unix.Recvmsg(w.sock, buf, oob, unix.MSG_DONTWAIT)
+		switch {
+		case errors.Is(err, unix.ENOBUFS):
+			// Events were dropped; find out what changed meanwhile
+			w.rescan()
+			continue
+		case errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			w.err = fmt.Errorf("failed to read uevent: %w", err)
+			return
+		}
+
+		if !w.trusted(from, oob[:oobn]) {
+			continue
+		}
+		props, err := parseUevent(buf[:n])
+		if err != nil {
+			continue
+		}
+		w.handle(props)
+	}
+}
+
+// closed reports whether Close was called
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// trusted reports whether a uevent was sent by the kernel or, for udev
+// events, by a root process; anyone may send to the multicast groups
+func (w *Watcher) trusted(from unix.Sockaddr, oob []byte) bool {
+	sa, ok := from.(*unix.SockaddrNetlink)
+	if !ok {
+		return false
+	}
+	if w.group == ueventGroupKernel {
+		return sa.Pid == 0
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return false
+	}
+	for i := range msgs {
+		if cred, err := unix.ParseUnixCredentials(&msgs[i]); err == nil {
+			return cred.Uid == 0
+		}
+	}
+	return false
+}
+
+// parseUevent returns the properties of a kernel uevent ("add@/devices/...\0
+// ACTION=add\0...") or of a libudev-encoded event re-broadcast by udevd
+func parseUevent(msg []byte) (map[string]string, error) {
+	var props []byte
+	if bytes.HasPrefix(msg, []byte("libudev\x00")) {
+		if len(msg) < 24 || binary.BigEndian.Uint32(msg[8:]) != udevMonitorMagic {
+			return nil, errors.New("invalid udev monitor header")
+		}
+		off := binary.NativeEndian.Uint32(msg[16:])
+		length := binary.NativeEndian.Uint32(msg[20:])
+		if uint64(off)+uint64(length) > uint64(len(msg)) || off < 24 {
+			return nil, errors.New("udev properties out of bounds")
+		}
+		props = msg[off : off+length]
+	} else {
+		head, rest, ok := bytes.Cut(msg, []byte{0})
+		if !ok || !bytes.Contains(head, []byte("@")) {
+			return nil, errors.New("invalid uevent header")
+		}
+		props = rest
+	}
+
+	result := make(map[string]string)
+	for _, field := range bytes.Split(props, []byte{0}) {
+		if key, value, ok := bytes.Cut(field, []byte("=")); ok && len(key) > 0 {
+			result[string(key)] = string(value)
+		}
+	}
+	if result["ACTION"] == "" || result["DEVPATH"] == "" {
+		return nil, errors.New("uevent without ACTION or DEVPATH")
+	}
+	return result, nil
+}
+
+// handle acts on the properties of one uevent
+func (w *Watcher) handle(props map[string]string) {
+	if props["SUBSYSTEM"] != "block" {
+		return
+	}
+	name := filepath.Base(props["DEVNAME"])
+	if props["DEVNAME"] == "" {
+		name = filepath.Base(props["DEVPATH"])
+	}
+
+	switch props["ACTION"] {
+	case "add", "change":
+		w.probe(name, nil)
+	case "remove":
+		w.detach(name)
+	}
+}
+
+// probe checks whether the block device name holds a LUKS header and emits
+// the resulting attach or detach. mappings, from a rescan, fills in the
+// unlocked state; a device that was just plugged in has none.
+func (w *Watcher) probe(name string, mappings map[string]string) {
+	sysDir := filepath.Join(sysfsRoot, "class", "block", name)
+	if readSysfsAttr(sysDir, "size") == "0" {
+		w.detach(name)
+		return
+	}
+	removable := isRemovableDevice(sysDir)
+	if w.opts.RemovableOnly && !removable {
+		return
+	}
+
+	device := filepath.Join(devRoot, name)
+	id, version, err := probeLUKS(device)
+	if err != nil {
+		w.detach(name)
+		return
+	}
+
+	vol := DiscoveredVolume{Device: device, UUID: id.UUID, Label: id.Label, Version: version}
+	if mapped, ok := mappings[name]; ok {
+		vol.Unlocked, vol.MappedName = true, mapped
+	}
+	if old, ok := w.known[name]; ok {
+		if old.Volume.UUID == vol.UUID {
+			return
+		}
+		// Other media in the same reader, or the device was reformatted
+		w.detach(name)
+	}
+
+	ev := HotplugEvent{Type: HotplugAttached, Volume: vol, Removable: removable}
+	w.known[name] = ev
+	w.emit(ev)
+}
+
+// detach emits HotplugDetached for name if it was reported as attached
+func (w *Watcher) detach(name string) {
+	ev, ok := w.known[name]
+	if !ok {
+		return
+	}
+	delete(w.known, name)
+	ev.Type = HotplugDetached
+	w.emit(ev)
+}
+
+// rescan probes every block device, for the initial report and after the
+// socket dropped events
+func (w *Watcher) rescan() {
+	blockDir := filepath.Join(sysfsRoot, "class", "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return
+	}
+	mappings := cryptMappings(blockDir, entries)
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[entry.Name()] = true
+		w.probe(entry.Name(), mappings)
+	}
+	for name := range w.known {
+		if !present[name] {
+			w.detach(name)
+		}
+	}
+}
+
+// emit delivers an event unless the watcher is being closed
+func (w *Watcher) emit(ev HotplugEvent) {
+	ev.Time = time.Now()
+	select {
+	case w.events <- ev:
+	case <-w.done:
+	}
+}
+
+// isRemovableDevice reports whether the device at sysDir, or the disk of a
+// partition, has removable media or is attached over USB
+func isRemovableDevice(sysDir string) bool {
+	resolved, err := filepath.EvalSymlinks(sysDir)
+	if err != nil {
+		return false
+	}
+	if readSysfsAttr(resolved, "partition") != "" {
+		resolved = filepath.Dir(resolved)
+	}
+	return readSysfsAttr(resolved, "removable") == "1" || strings.Contains(resolved, "/usb")
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// newTestWatcher returns a Watcher without a socket, for driving handle
+// and rescan directly
+func newTestWatcher(opts WatcherOptions) *Watcher {
+	return &Watcher{
+		opts:   opts,
+		events: make(chan HotplugEvent, 16),
+		known:  make(map[string]HotplugEvent),
+		done:   make(chan struct{}),
+	}
+}
+
+// drainEvents returns the events delivered so far
+func drainEvents(w *Watcher) []HotplugEvent {
+	var got []HotplugEvent
+	for {
+		select {
+		case ev := <-w.events:
+			got = append(got, ev)
+		default:
+			return got
+		}
+	}
+}
+
+// uevent builds the properties of a block device uevent
+func uevent(action, name string) map[string]string {
+	return map[string]string{
+		"ACTION":    action,
+		"DEVPATH":   "/devices/virtual/block/" + name,
+		"SUBSYSTEM": "block",
+		"DEVNAME":   name,
+	}
+}
+
+// TestParseUevent tests decoding kernel and udev events
+func TestParseUevent(t *testing.T) {
+	t.Run("kernel", func(t *testing.T) {
+		msg := []byte("add@/devices/pci0000:00/usb1/1-1/block/sdb\x00ACTION=add\x00DEVPATH=/devices/pci0000:00/usb1/1-1/block/sdb\x00SUBSYSTEM=block\x00DEVNAME=sdb\x00DEVTYPE=disk\x00SEQNUM=4242\x00")
+		props, err := parseUevent(msg)
+		if err != nil {
+			t.Fatalf("parseUevent failed: %v", err)
+		}
+		if props["ACTION"] != "add" || props["DEVNAME"] != "sdb" || props["SEQNUM"] != "4242" {
+			t.Errorf("props = %v", props)
+		}
+	})
+
+	t.Run("udev", func(t *testing.T) {
+		properties := []byte("ACTION=remove\x00DEVPATH=/devices/virtual/block/loop0\x00SUBSYSTEM=block\x00DEVNAME=/dev/loop0\x00")
+		msg := make([]byte, 40, 40+len(properties))
+		copy(msg, "libudev\x00")
+		binary.BigEndian.PutUint32(msg[8:], udevMonitorMagic)
+		binary.NativeEndian.PutUint32(msg[12:], 40)
+		binary.NativeEndian.PutUint32(msg[16:], 40)
+		binary.NativeEndian.PutUint32(msg[20:], uint32(len(properties))) // #nosec G115 -- test data
+		msg = append(msg, properties...)
+
+		props, err := parseUevent(msg)
+		if err != nil {
+			t.Fatalf("parseUevent failed: %v", err)
+		}
+		if props["ACTION"] != "remove" || props["DEVNAME"] != "/dev/loop0" {
+			t.Errorf("props = %v", props)
+		}
+
+		binary.NativeEndian.PutUint32(msg[20:], 4096)
+		if _, err := parseUevent(msg); err == nil {
+			t.Error("expected an error for properties past the message")
+		}
+		binary.BigEndian.PutUint32(msg[8:], 0)
+		if _, err := parseUevent(msg); err == nil {
+			t.Error("expected an error for a bad magic")
+		}
+	})
+
+	for name, msg := range map[string]string{
+		"no header":  "ACTION=add\x00DEVPATH=/x\x00",
+		"no action":  "add@/x\x00DEVPATH=/x\x00",
+		"empty":      "",
+		"short udev": "libudev\x00\xfe\xed",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseUevent([]byte(msg)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// TestWatcherHandle tests the events emitted for hotplug actions
+func TestWatcherHandle(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	w := newTestWatcher(WatcherOptions{})
+
+	backup, backupUUID := fakeLUKS2Header(t, "backup")
+	path := addFakeBlockDevice(t, sys, dev, "sdb", "2048", backup)
+	addFakeBlockDevice(t, sys, dev, "sdc", "2048", make([]byte, LUKS2HeaderSize))
+
+	// A plain device and other subsystems are ignored
+	w.handle(uevent("add", "sdc"))
+	w.handle(map[string]string{"ACTION": "add", "DEVPATH": "/devices/x", "SUBSYSTEM": "usb"})
+	if got := drainEvents(w); len(got) != 0 {
+		t.Fatalf("unexpected events %+v", got)
+	}
+
+	w.handle(uevent("add", "sdb"))
+	got := drainEvents(w)
+	if len(got) != 1 || got[0].Type != HotplugAttached || got[0].Volume.Device != path || got[0].Volume.UUID != backupUUID || got[0].Volume.Label != "backup" {
+		t.Fatalf("add events = %+v", got)
+	}
+	if got[0].Time.IsZero() {
+		t.Error("event has no time")
+	}
+
+	// A change that leaves the header alone is not reported again
+	w.handle(uevent("change", "sdb"))
+	if got := drainEvents(w); len(got) != 0 {
+		t.Fatalf("unexpected events %+v", got)
+	}
+
+	// Other media in the same reader
+	other, otherUUID := fakeLUKS2Header(t, "photos")
+	if err := os.WriteFile(path, other, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.handle(uevent("change", "sdb"))
+	got = drainEvents(w)
+	if len(got) != 2 || got[0].Type != HotplugDetached || got[0].Volume.UUID != backupUUID || got[1].Type != HotplugAttached || got[1].Volume.UUID != otherUUID {
+		t.Fatalf("media change events = %+v", got)
+	}
+
+	w.handle(uevent("remove", "sdb"))
+	got = drainEvents(w)
+	if len(got) != 1 || got[0].Type != HotplugDetached || got[0].Volume.UUID != otherUUID {
+		t.Fatalf("remove events = %+v", got)
+	}
+	w.handle(uevent("remove", "sdb"))
+	if got := drainEvents(w); len(got) != 0 {
+		t.Fatalf("a second remove reported %+v", got)
+	}
+}
+
+// TestWatcherHandle_HeaderWiped tests a detach when the header disappears
+func TestWatcherHandle_HeaderWiped(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	w := newTestWatcher(WatcherOptions{})
+
+	data, _ := fakeLUKS2Header(t, "")
+	path := addFakeBlockDevice(t, sys, dev, "sdb", "2048", data)
+	w.handle(uevent("add", "sdb"))
+	if err := os.WriteFile(path, make([]byte, LUKS2HeaderSize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.handle(uevent("change", "sdb"))
+
+	got := drainEvents(w)
+	if len(got) != 2 || got[1].Type != HotplugDetached {
+		t.Fatalf("events = %+v", got)
+	}
+}
+
+// TestWatcherRescan tests the initial report and catching up after dropped
+// events
+func TestWatcherRescan(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	w := newTestWatcher(WatcherOptions{})
+
+	data, _ := fakeLUKS2Header(t, "backup")
+	addFakeBlockDevice(t, sys, dev, "sdb", "2048", data)
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-0"), map[string]string{
+		"size":    "2048",
+		"dm/name": "backup",
+		"dm/uuid": "CRYPT-LUKS2-0000-backup",
+	})
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", "dm-0", "slaves", "sdb"), nil)
+
+	w.rescan()
+	got := drainEvents(w)
+	if len(got) != 1 || !got[0].Volume.Unlocked || got[0].Volume.MappedName != "backup" {
+		t.Fatalf("rescan events = %+v", got)
+	}
+
+	// The remove event was lost
+	if err := os.RemoveAll(filepath.Join(sys, "class", "block", "sdb")); err != nil {
+		t.Fatal(err)
+	}
+	w.rescan()
+	got = drainEvents(w)
+	if len(got) != 1 || got[0].Type != HotplugDetached {
+		t.Fatalf("rescan events = %+v", got)
+	}
+}
+
+// TestWatcherRemovableOnly tests filtering out fixed disks
+func TestWatcherRemovableOnly(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	w := newTestWatcher(WatcherOptions{RemovableOnly: true})
+	data, _ := fakeLUKS2Header(t, "")
+
+	// sda is a fixed disk; sdb1 is a partition of a USB stick
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", data)
+	usb := makeSysfsDevice(t, sys, filepath.Join("devices", "pci0000:00", "usb1", "1-1", "block", "sdb", "sdb1"), map[string]string{
+		"size":      "2048",
+		"partition": "1",
+	})
+	if err := os.Symlink(usb, filepath.Join(sys, "class", "block", "sdb1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dev, "sdb1"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w.handle(uevent("add", "sda"))
+	w.handle(uevent("add", "sdb1"))
+	got := drainEvents(w)
+	if len(got) != 1 || got[0].Volume.Device != filepath.Join(dev, "sdb1") || !got[0].Removable {
+		t.Fatalf("events = %+v", got)
+	}
+}
+
+// TestIsRemovableDevice tests the removable attribute of a disk
+func TestIsRemovableDevice(t *testing.T) {
+	sys := t.TempDir()
+	card := makeSysfsDevice(t, sys, "mmcblk0", map[string]string{"removable": "1"})
+	fixed := makeSysfsDevice(t, sys, "sda", map[string]string{"removable": "0"})
+	part := makeSysfsDevice(t, sys, filepath.Join("mmcblk0", "mmcblk0p1"), map[string]string{"partition": "1"})
+
+	if !isRemovableDevice(card) || isRemovableDevice(fixed) || !isRemovableDevice(part) {
+		t.Error("wrong removable classification")
+	}
+	if isRemovableDevice(filepath.Join(sys, "missing")) {
+		t.Error("a missing device is not removable")
+	}
+}
+
+// TestWatcherTrusted tests rejecting events from unprivileged senders
+func TestWatcherTrusted(t *testing.T) {
+	kernel := &Watcher{group: ueventGroupKernel}
+	if !kernel.trusted(&unix.SockaddrNetlink{Pid: 0}, nil) || kernel.trusted(&unix.SockaddrNetlink{Pid: 1234}, nil) {
+		t.Error("kernel events must come from pid 0")
+	}
+
+	udev := &Watcher{group: ueventGroupUdev}
+	for uid, want := range map[uint32]bool{0: true, 1000: false} {
+		oob := unix.UnixCredentials(&unix.Ucred{Pid: 1, Uid: uid})
+		if got := udev.trusted(&unix.SockaddrNetlink{Pid: 1}, oob); got != want {
+			t.Errorf("uid %d trusted = %v, want %v", uid, got, want)
+		}
+	}
+	if udev.trusted(&unix.SockaddrNetlink{Pid: 1}, nil) {
+		t.Error("udev events without credentials must be rejected")
+	}
+	if udev.trusted(&unix.SockaddrUnix{}, nil) {
+		t.Error("non-netlink senders must be rejected")
+	}
+}
+
+// TestNewWatcher tests starting and stopping a watcher on the real socket
+func TestNewWatcher(t *testing.T) {
+	fakeBlockRoots(t)
+	w, err := NewWatcher(&WatcherOptions{Existing: true})
+	if err != nil {
+		t.Skipf("uevent socket not available: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Error("unexpected event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events was not closed")
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("Err = %v after Close", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import "fmt"
+
+// IOEngine selects how bulk writes of Wipe and Volume are issued
+type IOEngine int
+
+const (
+	// IOEngineDefault is IOEngineURing in builds with -tags iouring on
+	// kernels that have io_uring, and IOEngineSync otherwise
+	IOEngineDefault IOEngine = iota
+
+	// IOEngineSync writes with pwrite, from several goroutines for a wipe
+	IOEngineSync
+
+	// IOEngineURing queues writes on an io_uring (Linux 5.6+), so one
+	// goroutine keeps QueueDepth of them in flight and the device sees a
+	// deep queue, as NVMe drives need to reach their throughput. Where
+	// io_uring is unavailable (older kernels, kernel.io_uring_disabled,
+	// seccomp filters, other platforms), IOEngineSync is used and
+	// WarnIOEngine is emitted.
+	IOEngineURing
+)
+
+// DefaultQueueDepth is how many writes the io_uring engine keeps in flight
+const DefaultQueueDepth = 32
+
+// maxQueueDepth is the largest ring io_uring_setup accepts
+const maxQueueDepth = 32768
+
+func (e IOEngine) String() string {
+	switch e {
+	case IOEngineDefault:
+		return "default"
+	case IOEngineSync:
+		return "sync"
+	case IOEngineURing:
+		return "io_uring"
+	default:
+		return fmt.Sprintf("IOEngine(%d)", int(e))
+	}
+}
+
+// defaultIOEngine is what IOEngineDefault stands for; -tags iouring makes
+// it IOEngineURing where the kernel has io_uring
+var defaultIOEngine = IOEngineSync
+
+// queueDepth returns the io_uring queue depth to use for engine and depth
+// (0 = DefaultQueueDepth), or 0 for synchronous writes. An unavailable
+// io_uring is reported against op and device.
+func queueDepth(engine IOEngine, depth int, op, device string) (int, error) {
+	if depth < 0 || depth > maxQueueDepth {
+		return 0, fmt.Errorf("invalid queue depth: %d (must be between 0 and %d)", depth, maxQueueDepth)
+	}
+	if engine == IOEngineDefault {
+		engine = defaultIOEngine
+	}
+	switch engine {
+	case IOEngineSync:
+		return 0, nil
+	case IOEngineURing:
+	default:
+		return 0, fmt.Errorf("unknown I/O engine %v", engine)
+	}
+
+	if err := uringAvailable(); err != nil {
+		emitWarning(Warning{
+			Code:    WarnIOEngine,
+			Op:      op,
+			Device:  device,
+			Message: fmt.Sprintf("io_uring unavailable, using pwrite: %v", err),
+		})
+		return 0, nil
+	}
+	if depth == 0 {
+		depth = DefaultQueueDepth
+	}
+	return depth, nil
+}
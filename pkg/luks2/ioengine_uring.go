@@ -0,0 +1,15 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build iouring && linux
+
+package luks2
+
+// Built with -tags iouring, wipes and Volume writes use io_uring unless
+// their options say otherwise, on kernels where a ring can be set up
+func init() {
+	if uringAvailable() == nil {
+		defaultIOEngine = IOEngineURing
+	}
+}
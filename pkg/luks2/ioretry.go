@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how reads are retried after transient I/O errors
+type RetryPolicy struct {
+	Attempts int           // Total attempts per read (<= 1 = no retries)
+	Delay    time.Duration // Wait before the first retry; doubled for each further one
+	MaxDelay time.Duration // Upper bound on the wait (0 = unbounded)
+}
+
+// ReadRetry is the retry policy for header and keyslot reads. EIO and
+// EAGAIN are retried with backoff, which rides out USB enclosures and
+// bridges that drop off the bus for a moment. When every attempt fails the
+// read returns a *BadRegionError naming the unreadable sectors.
+var ReadRetry = RetryPolicy{Attempts: 3, Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+// retryableIOError reports whether err may go away when the read is repeated
+func retryableIOError(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EAGAIN)
+}
+
+// readRetrying reads len(p) bytes at off, retrying transient errors as
+// ReadRetry says. device names the device in warnings and errors.
+func readRetrying(r io.ReaderAt, p []byte, off int64, device string) (int, error) {
+	policy := ReadRetry
+	delay := policy.Delay
+	for attempt := 1; ; attempt++ {
+		n, err := r.ReadAt(p, off)
+		if err == nil || !retryableIOError(err) {
+			if attempt > 1 && err == nil {
+				emitWarning(Warning{
+					Code:    WarnReadRetried,
+					Op:      "read",
+					Device:  device,
+					Message: fmt.Sprintf("read of %d bytes at offset %d succeeded after %d attempts; the device may be failing", len(p), off, attempt),
+				})
+			}
+			return n, err
+		}
+		if attempt >= policy.Attempts {
+			start, length := locateBadRegion(r, off, int64(len(p)))
+			return n, &BadRegionError{Device: device, Offset: start, Length: length, Attempts: attempt, Err: err}
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if policy.MaxDelay > 0 {
+			delay = min(delay, policy.MaxDelay)
+		}
+	}
+}
+
+// locateBadRegion reads [off, off+length) one sector at a time and returns
+// the first run of sectors that fail. The whole range is returned when no
+// single sector fails, as happens when the device recovered in between.
+func locateBadRegion(r io.ReaderAt, off, length int64) (int64, int64) {
+	if off%directIOAlignment != 0 || length%directIOAlignment != 0 {
+		return off, length
+	}
+	sector := alignedBuffer(directIOAlignment, directIOAlignment)
+
+	badStart, badEnd := int64(-1), int64(-1)
+	for pos := off; pos < off+length; pos += directIOAlignment {
+		_, err := r.ReadAt(sector, pos)
+		if err != nil && retryableIOError(err) {
+			if badStart < 0 {
+				badStart = pos
+			}
+			badEnd = pos + directIOAlignment
+		} else if badStart >= 0 {
+			break
+		}
+	}
+	clearBytes(sector)
+	if badStart < 0 {
+		return off, length
+	}
+	return badStart, badEnd - badStart
+}
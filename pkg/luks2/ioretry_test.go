@@ -0,0 +1,131 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyReader fails reads that touch [badStart, badEnd) with err, and every
+// read while failures is above zero
+type flakyReader struct {
+	data             []byte
+	failures         int
+	badStart, badEnd int64
+	err              error
+	reads            int
+}
+
+func (r *flakyReader) ReadAt(p []byte, off int64) (int, error) {
+	r.reads++
+	if r.failures > 0 {
+		r.failures--
+		return 0, r.err
+	}
+	if off < r.badEnd && off+int64(len(p)) > r.badStart {
+		return 0, r.err
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// setReadRetry overrides ReadRetry for the duration of a test
+func setReadRetry(t *testing.T, p RetryPolicy) {
+	t.Helper()
+	saved := ReadRetry
+	ReadRetry = p
+	t.Cleanup(func() { ReadRetry = saved })
+}
+
+// TestReadRetry_Transient tests that transient errors are retried with a
+// warning
+func TestReadRetry_Transient(t *testing.T) {
+	setReadRetry(t, RetryPolicy{Attempts: 3, Delay: time.Millisecond})
+	warnings := captureWarnings(t, 0)
+
+	data := bytes.Repeat([]byte{0xA5}, 4*directIOAlignment)
+	for _, errno := range []error{syscall.EIO, syscall.EAGAIN} {
+		src := &flakyReader{data: data, failures: 2, err: errno, badStart: -1, badEnd: -1}
+		p := make([]byte, 100)
+		n, err := (&sectorReader{r: src, device: "/dev/sdz"}).ReadAt(p, 5000)
+		if err != nil || n != len(p) || !bytes.Equal(p, data[:100]) {
+			t.Fatalf("%v: ReadAt = %d, %v", errno, n, err)
+		}
+		if src.reads != 3 {
+			t.Errorf("%v: %d reads, want 3", errno, src.reads)
+		}
+	}
+	if len(*warnings) != 2 || (*warnings)[0].Code != WarnReadRetried || (*warnings)[0].Device != "/dev/sdz" {
+		t.Errorf("warnings = %+v", *warnings)
+	}
+}
+
+// TestReadRetry_BadRegion tests the report for a region that stays
+// unreadable
+func TestReadRetry_BadRegion(t *testing.T) {
+	setReadRetry(t, RetryPolicy{Attempts: 2, Delay: time.Millisecond})
+
+	src := &flakyReader{
+		data:     make([]byte, 8*directIOAlignment),
+		badStart: 3*directIOAlignment + 17,
+		badEnd:   5*directIOAlignment - 1,
+		err:      &os.PathError{Op: "read", Path: "/dev/sdz", Err: syscall.EIO},
+	}
+	_, err := (&sectorReader{r: src, device: "/dev/sdz"}).ReadAt(make([]byte, 6*directIOAlignment), 100)
+
+	var bad *BadRegionError
+	if !errors.As(err, &bad) {
+		t.Fatalf("expected a *BadRegionError, got %v", err)
+	}
+	want := BadRegionError{Device: "/dev/sdz", Offset: 3 * directIOAlignment, Length: 2 * directIOAlignment, Attempts: 2}
+	if bad.Device != want.Device || bad.Offset != want.Offset || bad.Length != want.Length || bad.Attempts != want.Attempts {
+		t.Errorf("got %+v, want %+v", *bad, want)
+	}
+	if !errors.Is(err, syscall.EIO) {
+		t.Error("BadRegionError should unwrap to the I/O error")
+	}
+}
+
+// TestReadRetry_Permanent tests that other errors fail without retrying
+func TestReadRetry_Permanent(t *testing.T) {
+	setReadRetry(t, RetryPolicy{Attempts: 5, Delay: time.Hour})
+
+	src := &flakyReader{data: make([]byte, directIOAlignment), failures: 1, err: syscall.EINVAL, badStart: -1, badEnd: -1}
+	_, err := (&sectorReader{r: src}).ReadAt(make([]byte, 10), 0)
+	if !errors.Is(err, syscall.EINVAL) || src.reads != 1 {
+		t.Errorf("ReadAt = %v after %d reads, want EINVAL after 1", err, src.reads)
+	}
+	var bad *BadRegionError
+	if errors.As(err, &bad) {
+		t.Error("a non-transient error is not a bad region")
+	}
+}
+
+// TestReadRetry_Disabled tests that one attempt reports the region at once
+func TestReadRetry_Disabled(t *testing.T) {
+	setReadRetry(t, RetryPolicy{Attempts: 1, Delay: time.Hour})
+
+	src := &flakyReader{data: make([]byte, directIOAlignment), failures: 1, err: syscall.EIO, badStart: -1, badEnd: -1}
+	_, err := (&sectorReader{r: src}).ReadAt(make([]byte, 10), 0)
+	var bad *BadRegionError
+	if !errors.As(err, &bad) || bad.Attempts != 1 {
+		t.Fatalf("expected a *BadRegionError after 1 attempt, got %v", err)
+	}
+	// The device recovered before the sectors were probed
+	if bad.Offset != 0 || bad.Length != directIOAlignment {
+		t.Errorf("region = %d+%d, want the whole read", bad.Offset, bad.Length)
+	}
+}
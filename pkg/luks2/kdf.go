@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -65,31 +66,43 @@ func DeriveKey(passphrase []byte, kdf *KDF, keySize int) ([]byte, error) {
 		return nil, fmt.Errorf("invalid salt: %w", err)
 	}
 
+	defer observeKDF(kdf.Type, time.Now())
+
 	switch kdf.Type {
 	case "pbkdf2":
 		return derivePBKDF2(passphrase, salt, kdf, keySize)
 	case "argon2i":
+		if err := checkKDFMemory(kdf); err != nil {
+			return nil, err
+		}
 		return deriveArgon2i(passphrase, salt, kdf, keySize)
 	case "argon2id":
+		if err := checkKDFMemory(kdf); err != nil {
+			return nil, err
+		}
 		return deriveArgon2id(passphrase, salt, kdf, keySize)
 	default:
 		return nil, fmt.Errorf("unsupported KDF type: %s", kdf.Type)
 	}
 }
 
+// deriveSecureKey derives a key like DeriveKey and moves it into locked
+// memory; the caller must Destroy the returned buffer
+func deriveSecureKey(passphrase []byte, kdf *KDF, keySize int) (*securemem.Buffer, error) {
+	key, err := DeriveKey(passphrase, kdf, keySize)
+	if err != nil {
+		return nil, err
+	}
+	return securemem.NewFromBytes(key)
+}
+
 // derivePBKDF2 derives a key using PBKDF2
 func derivePBKDF2(passphrase, salt []byte, kdf *KDF, keySize int) ([]byte, error) {
 	if kdf.Iterations == nil {
 		return nil, fmt.Errorf("PBKDF2 requires iterations")
 	}
 
-	hashFunc, err := getPBKDF2HashFunc(kdf.Hash)
-	if err != nil {
-		return nil, err
-	}
-
-	key := pbkdf2.Key(passphrase, salt, *kdf.Iterations, keySize, hashFunc)
-	return key, nil
+	return pbkdf2Key(passphrase, salt, *kdf.Iterations, keySize, kdf.Hash)
 }
 
 // getPBKDF2HashFunc returns the hash function for PBKDF2 key derivation
@@ -205,7 +218,7 @@ func CreateKDF(opts FormatOptions, keySize int) (*KDF, error) {
 	// Handle Argon2 variants
 	switch kdfType {
 	case KDFTypeArgon2i, KDFTypeArgon2id:
-		return createArgon2KDF(kdfType, opts, saltB64)
+		return createArgon2KDF(kdfType, opts, saltB64, keySize)
 	default:
 		return nil, fmt.Errorf("unsupported KDF type: %s (supported: pbkdf2, pbkdf2-sha1, pbkdf2-sha256, pbkdf2-sha384, pbkdf2-sha512, argon2i, argon2id)", kdfType)
 	}
@@ -268,7 +281,21 @@ func getHashAlgoForKDFType(kdfType, hashAlgoOverride string) string {
 }
 
 // createArgon2KDF creates an Argon2 KDF structure
-func createArgon2KDF(kdfType string, opts FormatOptions, saltB64 string) (*KDF, error) {
+func createArgon2KDF(kdfType string, opts FormatOptions, saltB64 string, keySize int) (*KDF, error) {
+	if opts.Argon2Auto {
+		params, err := BenchmarkArgon2(kdfType, keySize, opts.Argon2IterTime, opts.Argon2Memory, opts.Argon2Parallel)
+		if err != nil {
+			return nil, err
+		}
+		return &KDF{
+			Type:   kdfType,
+			Salt:   saltB64,
+			Time:   &params.Time,
+			Memory: &params.Memory,
+			CPUs:   &params.Parallel,
+		}, nil
+	}
+
 	time := opts.Argon2Time
 	if time == 0 {
 		time = 4 // Default
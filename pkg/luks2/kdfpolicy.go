@@ -0,0 +1,199 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KDFPolicy holds the minimum keyslot KDF costs expected of volumes being
+// unlocked, including volumes created by other tools. Zero fields are not
+// enforced.
+type KDFPolicy struct {
+	// MinPBKDF2Iterations is the minimum PBKDF2 iteration count
+	MinPBKDF2Iterations int
+
+	// MinArgon2Time is the minimum Argon2 time cost (passes)
+	MinArgon2Time int
+
+	// MinArgon2Memory is the minimum Argon2 memory cost in KiB
+	MinArgon2Memory int
+
+	// Enforce refuses to unlock through keyslots below the floors; they
+	// are not tried and ErrWeakKDF is returned if no other keyslot opens.
+	// Otherwise a WarnWeakKDF warning is emitted when such a keyslot opens.
+	Enforce bool
+}
+
+// DefaultKDFPolicy is the policy in effect until SetKDFPolicy is called:
+// it warns about PBKDF2 keyslots under 100,000 iterations and Argon2
+// keyslots under cryptsetup's minimum of 4 passes or under 64 MiB, the
+// smallest memory cost Format accepts
+var DefaultKDFPolicy = KDFPolicy{
+	MinPBKDF2Iterations: 100000,
+	MinArgon2Time:       4,
+	MinArgon2Memory:     65536,
+}
+
+// Check returns why kdf falls below the policy, or nil if it does not
+func (p *KDFPolicy) Check(kdf *KDF) []string {
+	if kdf == nil {
+		return []string{"keyslot has no KDF"}
+	}
+
+	var reasons []string
+	switch kdf.Type {
+	case "pbkdf2":
+		if iterations := intValue(kdf.Iterations); p.MinPBKDF2Iterations > 0 && iterations < p.MinPBKDF2Iterations {
+			reasons = append(reasons, fmt.Sprintf("pbkdf2 iterations %d are below %d", iterations, p.MinPBKDF2Iterations))
+		}
+	case "argon2i", "argon2id":
+		if t := intValue(kdf.Time); p.MinArgon2Time > 0 && t < p.MinArgon2Time {
+			reasons = append(reasons, fmt.Sprintf("%s time cost %d is below %d", kdf.Type, t, p.MinArgon2Time))
+		}
+		if m := intValue(kdf.Memory); p.MinArgon2Memory > 0 && m < p.MinArgon2Memory {
+			reasons = append(reasons, fmt.Sprintf("%s memory %d KiB is below %d KiB", kdf.Type, m, p.MinArgon2Memory))
+		}
+	default:
+		reasons = append(reasons, fmt.Sprintf("unknown KDF type %q", kdf.Type))
+	}
+	return reasons
+}
+
+// kdfPolicyState holds the registered KDF policy, initially a copy of
+// DefaultKDFPolicy
+var kdfPolicyState = struct {
+	mu     sync.RWMutex
+	policy *KDFPolicy
+}{policy: func() *KDFPolicy { p := DefaultKDFPolicy; return &p }()}
+
+// SetKDFPolicy registers the policy the KDFs of keyslots are checked
+// against when they are unlocked. Passing nil disables the checks.
+func SetKDFPolicy(p *KDFPolicy) {
+	kdfPolicyState.mu.Lock()
+	defer kdfPolicyState.mu.Unlock()
+	if p != nil {
+		cp := *p
+		p = &cp
+	}
+	kdfPolicyState.policy = p
+}
+
+// GetKDFPolicy returns a copy of the registered policy, or nil
+func GetKDFPolicy() *KDFPolicy {
+	kdfPolicyState.mu.RLock()
+	defer kdfPolicyState.mu.RUnlock()
+	if kdfPolicyState.policy == nil {
+		return nil
+	}
+	cp := *kdfPolicyState.policy
+	return &cp
+}
+
+// KeyslotKDFReport describes the KDF strength of one keyslot
+type KeyslotKDFReport struct {
+	Keyslot    int      `json:"keyslot"`
+	Type       string   `json:"type"`                 // "pbkdf2", "argon2i" or "argon2id"
+	Hash       string   `json:"hash,omitempty"`       // PBKDF2 hash
+	Iterations int      `json:"iterations,omitempty"` // PBKDF2 iterations
+	Time       int      `json:"time,omitempty"`       // Argon2 time cost
+	Memory     int      `json:"memory,omitempty"`     // Argon2 memory in KiB
+	CPUs       int      `json:"cpus,omitempty"`       // Argon2 parallelism
+	Weak       bool     `json:"weak"`                 // Below the policy
+	Reasons    []string `json:"reasons,omitempty"`    // Why it is weak
+}
+
+// AuditKDF reports the KDF parameters of every keyslot of device, in
+// keyslot order, checked against the registered policy (DefaultKDFPolicy
+// if checks are disabled). It needs no passphrase.
+func AuditKDF(device string) ([]KeyslotKDFReport, error) {
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		return nil, err
+	}
+	policy := GetKDFPolicy()
+	if policy == nil {
+		policy = &DefaultKDFPolicy
+	}
+	return auditKDF(metadata, policy), nil
+}
+
+// auditKDF checks the KDF of each LUKS2 keyslot in metadata against policy
+func auditKDF(metadata *LUKS2Metadata, policy *KDFPolicy) []KeyslotKDFReport {
+	var reports []KeyslotKDFReport
+	for _, id := range sortedIDs(metadata.Keyslots) {
+		keyslot := metadata.Keyslots[id]
+		n, err := strconv.Atoi(id)
+		if err != nil || keyslot.Type != "luks2" {
+			continue
+		}
+		report := KeyslotKDFReport{Keyslot: n, Reasons: policy.Check(keyslot.KDF)}
+		if kdf := keyslot.KDF; kdf != nil {
+			report.Type = kdf.Type
+			report.Hash = kdf.Hash
+			report.Iterations = intValue(kdf.Iterations)
+			report.Time = intValue(kdf.Time)
+			report.Memory = intValue(kdf.Memory)
+			report.CPUs = intValue(kdf.CPUs)
+		}
+		report.Weak = len(report.Reasons) > 0
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// keyslotsMeetingKDFPolicy returns the keyslots an unlock may try. With an
+// enforcing policy the keyslots below it are dropped, and the error to
+// report if the passphrase opens none of the others is returned as well.
+func keyslotsMeetingKDFPolicy(device string, metadata *LUKS2Metadata, keyslots []*Keyslot) ([]*Keyslot, error) {
+	policy := GetKDFPolicy()
+	if policy == nil || !policy.Enforce {
+		return keyslots, nil
+	}
+
+	var allowed []*Keyslot
+	var refused []string
+	for _, keyslot := range keyslots {
+		if reasons := policy.Check(keyslot.KDF); len(reasons) > 0 {
+			refused = append(refused, fmt.Sprintf("keyslot %s: %s", keyslotID(metadata, keyslot), strings.Join(reasons, ", ")))
+			continue
+		}
+		allowed = append(allowed, keyslot)
+	}
+	if len(refused) == 0 {
+		return keyslots, nil
+	}
+	return allowed, &WeakKDFError{Device: device, Reasons: refused}
+}
+
+// warnWeakKDF emits WarnWeakKDF if the KDF of the keyslot that opened
+// device falls below the registered policy
+func warnWeakKDF(device string, metadata *LUKS2Metadata, keyslot *Keyslot) {
+	policy := GetKDFPolicy()
+	if policy == nil {
+		return
+	}
+	if reasons := policy.Check(keyslot.KDF); len(reasons) > 0 {
+		emitWarning(Warning{
+			Code:    WarnWeakKDF,
+			Op:      "unlock",
+			Device:  device,
+			Message: fmt.Sprintf("keyslot %s is below the KDF policy: %s", keyslotID(metadata, keyslot), strings.Join(reasons, ", ")),
+		})
+	}
+}
+
+// keyslotID returns the ID of keyslot in metadata
+func keyslotID(metadata *LUKS2Metadata, keyslot *Keyslot) string {
+	for id, k := range metadata.Keyslots {
+		if k == keyslot {
+			return id
+		}
+	}
+	return "?"
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"testing"
+)
+
+// useKDFPolicy registers a KDF policy for the duration of a test
+func useKDFPolicy(t *testing.T, p *KDFPolicy) {
+	t.Helper()
+	prev := GetKDFPolicy()
+	SetKDFPolicy(p)
+	t.Cleanup(func() { SetKDFPolicy(prev) })
+}
+
+// keyslotIterations returns the PBKDF2 iterations of keyslot 0 of device
+func keyslotIterations(t *testing.T, device string) int {
+	t.Helper()
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	return intValue(metadata.Keyslots["0"].KDF.Iterations)
+}
+
+func TestKDFPolicy_Check(t *testing.T) {
+	n := func(v int) *int { return &v }
+
+	tests := []struct {
+		name    string
+		kdf     *KDF
+		reasons int
+	}{
+		{"strong pbkdf2", &KDF{Type: "pbkdf2", Iterations: n(1000000)}, 0},
+		{"weak pbkdf2", &KDF{Type: "pbkdf2", Iterations: n(1000)}, 1},
+		{"strong argon2id", &KDF{Type: "argon2id", Time: n(4), Memory: n(1048576)}, 0},
+		{"weak argon2i", &KDF{Type: "argon2i", Time: n(1), Memory: n(32)}, 2},
+		{"unknown", &KDF{Type: "scrypt"}, 1},
+		{"missing", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultKDFPolicy.Check(tt.kdf); len(got) != tt.reasons {
+				t.Errorf("Check() = %q, want %d reasons", got, tt.reasons)
+			}
+		})
+	}
+
+	// Zero fields are not enforced
+	var empty KDFPolicy
+	if got := empty.Check(&KDF{Type: "pbkdf2", Iterations: n(1)}); got != nil {
+		t.Errorf("empty policy Check() = %q", got)
+	}
+}
+
+func TestSetKDFPolicy(t *testing.T) {
+	if p := GetKDFPolicy(); p == nil || *p != DefaultKDFPolicy {
+		t.Fatalf("initial policy = %+v, want DefaultKDFPolicy", p)
+	}
+
+	p := &KDFPolicy{MinPBKDF2Iterations: 5}
+	useKDFPolicy(t, p)
+	p.MinPBKDF2Iterations = 6
+	if got := GetKDFPolicy(); got.MinPBKDF2Iterations != 5 {
+		t.Errorf("Policy not copied: %+v", got)
+	}
+
+	SetKDFPolicy(nil)
+	if GetKDFPolicy() != nil {
+		t.Error("Expected no policy after SetKDFPolicy(nil)")
+	}
+}
+
+func TestAuditKDF(t *testing.T) {
+	pass := []byte("test-password")
+	device := formatTestVolume(t, pass)
+	addTestKeys(t, device, pass, 1)
+	floor := keyslotIterations(t, device)
+	useKDFPolicy(t, &KDFPolicy{MinPBKDF2Iterations: floor})
+
+	reports, err := AuditKDF(device)
+	if err != nil {
+		t.Fatalf("AuditKDF failed: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("AuditKDF returned %d reports, want 2", len(reports))
+	}
+	for i, r := range reports {
+		if r.Keyslot != i || r.Type != "pbkdf2" || r.Hash == "" || r.Iterations == 0 {
+			t.Errorf("unexpected report: %+v", r)
+		}
+		if weak := r.Iterations < floor; r.Weak != weak || (len(r.Reasons) > 0) != weak {
+			t.Errorf("keyslot %d: Weak = %v with reasons %q, want %v", r.Keyslot, r.Weak, r.Reasons, weak)
+		}
+	}
+
+	// With checks disabled the default floors apply
+	SetKDFPolicy(nil)
+	reports, err = AuditKDF(device)
+	if err != nil {
+		t.Fatalf("AuditKDF failed: %v", err)
+	}
+	if want := reports[0].Iterations < DefaultKDFPolicy.MinPBKDF2Iterations; reports[0].Weak != want {
+		t.Errorf("Weak = %v against DefaultKDFPolicy, want %v", reports[0].Weak, want)
+	}
+}
+
+func TestKDFPolicy_Unlock(t *testing.T) {
+	pass := []byte("test-password")
+	device := formatTestVolume(t, pass)
+	weak := &KDFPolicy{MinPBKDF2Iterations: keyslotIterations(t, device) + 1}
+
+	// A warning names the weak keyslot that opened
+	warnings := captureWarnings(t, 0)
+	useKDFPolicy(t, weak)
+	vol, err := OpenVolume(device, pass, nil)
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	_ = vol.Close()
+	if len(*warnings) != 1 || (*warnings)[0].Code != WarnWeakKDF || (*warnings)[0].Device != device {
+		t.Errorf("warnings = %+v, want one %s", *warnings, WarnWeakKDF)
+	}
+
+	// An enforcing policy does not try the keyslot
+	enforce := *weak
+	enforce.Enforce = true
+	SetKDFPolicy(&enforce)
+	_, err = OpenVolume(device, pass, nil)
+	var kdfErr *WeakKDFError
+	if !errors.As(err, &kdfErr) || !errors.Is(err, ErrWeakKDF) || kdfErr.Device != device || len(kdfErr.Reasons) != 1 {
+		t.Errorf("OpenVolume error = %v, want a WeakKDFError", err)
+	}
+
+	// A wrong passphrase is still reported as such once a keyslot meets
+	// the policy
+	enforce.MinPBKDF2Iterations = 1
+	SetKDFPolicy(&enforce)
+	if _, err := OpenVolume(device, []byte("wrong-password"), nil); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("OpenVolume error = %v, want ErrInvalidPassphrase", err)
+	}
+}
@@ -5,9 +5,13 @@
 package luks2
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
 )
 
 // LUKS2 keyslot constants
@@ -19,6 +23,20 @@ const (
 	KeyslotAreaAlignment = 4096
 )
 
+// Keyslot priorities (cryptsetup semantics)
+const (
+	// KeyslotPriorityIgnore excludes the keyslot from passphrase unlock
+	// unless it is selected explicitly
+	KeyslotPriorityIgnore = 0
+
+	// KeyslotPriorityNormal is the default priority (also assumed when the
+	// priority field is absent from the metadata)
+	KeyslotPriorityNormal = 1
+
+	// KeyslotPriorityPrefer keyslots are tried before normal ones
+	KeyslotPriorityPrefer = 2
+)
+
 // AddKeyOptions contains options for adding a new key
 type AddKeyOptions struct {
 	// Keyslot specifies which keyslot to use (nil = auto-select)
@@ -38,246 +56,134 @@ type AddKeyOptions struct {
 	Argon2Memory   int
 	Argon2Parallel int
 
+	// Argon2Auto calibrates Argon2 time/memory to Argon2IterTime ms instead
+	// of using fixed parameters; Argon2Memory then acts as the memory ceiling
+	Argon2Auto     bool
+	Argon2IterTime int
+
 	// PBKDF2 parameters (for pbkdf2 KDF type)
 	PBKDFIterTime int
+
+	// AFStripes is the number of anti-forensic stripes (0 = AFStripes). The
+	// keyslot area is sized to the key size times the stripes.
+	AFStripes int
+
+	// Priority sets the keyslot priority (nil = KeyslotPriorityNormal)
+	Priority *int
+
+	// Annotation is stored with the keyslot (nil = none). A zero CreatedAt
+	// is set to the current time.
+	Annotation *KeyslotAnnotation
 }
 
 // TestKey verifies that a passphrase can unlock the LUKS volume
 // Returns nil if the passphrase is valid, error otherwise
+//
+// Deprecated: Use TestPassphrase, which also reports the keyslot and can
+// limit the check to one.
 func TestKey(device string, passphrase []byte) error {
-	// Validate inputs
-	if err := ValidateDevicePath(device); err != nil {
-		return err
-	}
-	if err := ValidatePassphrase(passphrase); err != nil {
-		return err
-	}
-
-	// Read header and metadata
-	_, metadata, err := ReadHeader(device)
-	if err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
-	}
-
-	// Try to get master key with the passphrase
-	masterKey, err := getMasterKey(device, passphrase, metadata)
-	if err != nil {
+	if _, err := TestPassphrase(device, passphrase, nil); err != nil {
 		return fmt.Errorf("passphrase does not unlock any keyslot: %w", err)
 	}
-	defer clearBytes(masterKey)
-
 	return nil
 }
 
-// AddKey adds a new passphrase to an available keyslot
-// existingPassphrase is used to unlock the volume and retrieve the master key
-// newPassphrase is the new passphrase to add
-func AddKey(device string, existingPassphrase, newPassphrase []byte, opts *AddKeyOptions) error {
-	// Validate inputs
-	if err := ValidateDevicePath(device); err != nil {
-		return err
-	}
-	if err := ValidatePassphrase(existingPassphrase); err != nil {
-		return fmt.Errorf("invalid existing passphrase: %w", err)
-	}
-	if err := ValidatePassphrase(newPassphrase); err != nil {
-		return fmt.Errorf("invalid new passphrase: %w", err)
+// VerifyPassphrase reports whether passphrase opens a keyslot of the volume
+// and, if so, which one. A wrong passphrase is reported as (false, -1,
+// nil); an error means the check could not be made.
+//
+// Deprecated: Use TestPassphrase, which reports a wrong passphrase as
+// ErrInvalidPassphrase.
+func VerifyPassphrase(device string, passphrase []byte) (bool, int, error) {
+	slot, err := TestPassphrase(device, passphrase, nil)
+	if errors.Is(err, ErrInvalidPassphrase) {
+		return false, -1, nil
 	}
-
-	// Acquire exclusive lock
-	lock, err := AcquireFileLock(device)
 	if err != nil {
-		return fmt.Errorf("failed to acquire lock: %w", err)
+		return false, -1, err
 	}
-	defer func() { _ = lock.Release() }()
+	return true, slot, nil
+}
 
-	// Read existing header and metadata
-	hdr, metadata, err := ReadHeader(device)
-	if err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
+// TestPassphrase checks passphrase against the keyslots of the volume, like
+// cryptsetup open --test-passphrase, and returns the keyslot it opens. No
+// mapping is created and the header is not modified. Keyslots are tried in
+// unlock order; each candidate runs the full derive, decrypt, merge and
+// constant-time digest check, so a mismatch gives no timing hint about
+// where it failed. opts.Keyslot limits
+// the check to one keyslot; the other options do not apply (nil = try
+// every keyslot in unlock order). A wrong passphrase fails with
+// ErrInvalidPassphrase.
+func TestPassphrase(device string, passphrase []byte, opts *UnlockOptions) (int, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return -1, err
 	}
-
-	// Unlock with existing passphrase to get master key
-	masterKey, err := getMasterKey(device, existingPassphrase, metadata)
-	if err != nil {
-		return fmt.Errorf("failed to unlock with existing passphrase: %w", err)
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return -1, err
 	}
-	defer clearBytes(masterKey)
 
-	// Find available keyslot
-	targetSlot, err := findAvailableKeyslot(metadata, opts)
+	_, metadata, err := readHeader(device)
 	if err != nil {
-		return err
-	}
-
-	// Get existing keyslot for reference (cipher, key size, etc.)
-	var referenceKeyslot *Keyslot
-	for _, ks := range metadata.Keyslots {
-		referenceKeyslot = ks
-		break
+		return -1, fmt.Errorf("failed to read header: %w", err)
 	}
-	if referenceKeyslot == nil {
-		return fmt.Errorf("no existing keyslot found for reference")
-	}
-
-	// Calculate new keyslot area offset
-	newOffset, err := calculateNextKeyslotOffset(metadata)
+	keyslots, err := selectKeyslots(metadata, opts)
 	if err != nil {
-		return err
-	}
-
-	// Create KDF for new keyslot
-	kdfType := "argon2id"
-	if opts != nil && opts.KDFType != "" {
-		kdfType = opts.KDFType
-	}
-
-	// Determine hash algorithm - use provided value or default to sha256
-	hashAlgo := DefaultHashAlgo
-	if opts != nil && opts.Hash != "" {
-		hashAlgo = opts.Hash
+		return -1, err
 	}
+	return matchKeyslot(device, passphrase, metadata, keyslots)
+}
 
-	formatOpts := FormatOptions{
-		KDFType:        kdfType,
-		HashAlgo:       hashAlgo,
-		Argon2Time:     4,
-		Argon2Memory:   1048576,
-		Argon2Parallel: 4,
-	}
-	if opts != nil {
-		if opts.Argon2Time > 0 {
-			formatOpts.Argon2Time = opts.Argon2Time
-		}
-		if opts.Argon2Memory > 0 {
-			formatOpts.Argon2Memory = opts.Argon2Memory
-		}
-		if opts.Argon2Parallel > 0 {
-			formatOpts.Argon2Parallel = opts.Argon2Parallel
-		}
-		if opts.PBKDFIterTime > 0 {
-			formatOpts.PBKDFIterTime = opts.PBKDFIterTime
+// matchKeyslot tries keyslots in order and returns the ID of the first one
+// passphrase opens, or the error of unlockFailure
+func matchKeyslot(device string, passphrase []byte, metadata *LUKS2Metadata, keyslots []*Keyslot) (int, error) {
+	ids := make(map[*Keyslot]int, len(metadata.Keyslots))
+	for idStr, ks := range metadata.Keyslots {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			ids[ks] = id
 		}
 	}
 
-	kdf, err := CreateKDF(formatOpts, referenceKeyslot.KeySize)
-	if err != nil {
-		return fmt.Errorf("failed to create KDF: %w", err)
-	}
-
-	// Derive key from new passphrase
-	passphraseKey, err := DeriveKey(newPassphrase, kdf, referenceKeyslot.KeySize)
-	if err != nil {
-		return fmt.Errorf("failed to derive key: %w", err)
-	}
-	defer clearBytes(passphraseKey)
-
-	// Apply anti-forensic split to master key
-	afData, err := AFSplit(masterKey, AFStripes, DefaultHashAlgo)
-	if err != nil {
-		return fmt.Errorf("failed to apply AF split: %w", err)
-	}
-	defer clearBytes(afData)
-
-	// Encrypt AF-split key material with new passphrase-derived key
-	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey, DefaultCipher)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt key material: %w", err)
-	}
-	defer clearBytes(encryptedKeyMaterial)
-
-	// Calculate aligned size
-	alignedSize := alignTo(int64(len(encryptedKeyMaterial)), KeyslotAreaAlignment)
-
-	// CRITICAL: Check that new keyslot area doesn't overlap with data segment
-	// This prevents data corruption when keyslot area would extend into encrypted data
-	newKeyslotsEnd := newOffset + alignedSize
-	for _, segment := range metadata.Segments {
-		segmentOffset, err := parseSize(segment.Offset)
+	var skipErr error
+	for _, keyslot := range keyslots {
+		masterKey, err := unlockKeyslot(device, passphrase, keyslot, metadata.Digests)
 		if err != nil {
-			continue
-		}
-		if newKeyslotsEnd > segmentOffset {
-			return fmt.Errorf("not enough space for new keyslot: keyslot area would end at offset %d but data segment starts at %d (need to reformat with larger header)", newKeyslotsEnd, segmentOffset)
-		}
-	}
-
-	// Create new keyslot metadata
-	priority := 2 // Lower priority than original keyslot
-	newKeyslot := &Keyslot{
-		Type:     "luks2",
-		KeySize:  referenceKeyslot.KeySize,
-		Priority: &priority,
-		Area: &KeyslotArea{
-			Type:       "raw",
-			KeySize:    referenceKeyslot.KeySize,
-			Offset:     formatSize(newOffset),
-			Size:       formatSize(alignedSize),
-			Encryption: referenceKeyslot.Area.Encryption,
-		},
-		KDF: kdf,
-		AF: &AntiForensic{
-			Type:    "luks1",
-			Stripes: AFStripes,
-			Hash:    DefaultHashAlgo,
-		},
-	}
-
-	// Add keyslot to metadata
-	slotIDStr := strconv.Itoa(targetSlot)
-	metadata.Keyslots[slotIDStr] = newKeyslot
-
-	// Update digest to include new keyslot
-	for _, digest := range metadata.Digests {
-		found := false
-		for _, ks := range digest.Keyslots {
-			if ks == slotIDStr {
-				found = true
-				break
+			if keyslotSkipped(err) {
+				skipErr = err
 			}
+			continue
 		}
-		if !found {
-			digest.Keyslots = append(digest.Keyslots, slotIDStr)
-		}
+		masterKey.Destroy()
+		return ids[keyslot], nil
 	}
+	return -1, unlockFailure(skipErr)
+}
 
-	// Update keyslots size in config (reusing newKeyslotsEnd calculated above)
-	metadata.Config.KeyslotsSize = formatSize(newKeyslotsEnd)
-
-	// Increment sequence ID
-	hdr.SequenceID++
-
-	// Write encrypted key material to device
-	f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- device path validated by caller
-	if err != nil {
-		return fmt.Errorf("failed to open device: %w", err)
-	}
-	defer func() { _ = f.Close() }()
-
-	if _, err := f.Seek(newOffset, 0); err != nil {
-		return fmt.Errorf("failed to seek to keyslot area: %w", err)
+// AddKey adds a new passphrase to an available keyslot
+// existingPassphrase is used to unlock the volume and retrieve the master key
+// newPassphrase is the new passphrase to add
+func AddKey(device string, existingPassphrase, newPassphrase []byte, opts *AddKeyOptions) error {
+	// Validate inputs
+	if err := ValidateDevicePath(device); err != nil {
+		return err
 	}
-
-	if _, err := f.Write(encryptedKeyMaterial); err != nil {
-		return fmt.Errorf("failed to write key material: %w", err)
+	if err := ValidatePassphrase(existingPassphrase); err != nil {
+		return fmt.Errorf("invalid existing passphrase: %w", err)
 	}
-
-	// Pad to aligned size
-	padding := make([]byte, alignedSize-int64(len(encryptedKeyMaterial)))
-	if _, err := f.Write(padding); err != nil {
-		return fmt.Errorf("failed to write padding: %w", err)
+	if err := validateNewKey(newPassphrase, opts); err != nil {
+		return err
 	}
 
-	if err := f.Sync(); err != nil {
-		return fmt.Errorf("failed to sync: %w", err)
+	tx, err := BeginTransaction(device, existingPassphrase)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+	tx.op = "addkey"
 
-	// Write updated headers
-	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
+	if _, err := tx.stageKey(newPassphrase, opts); err != nil {
+		return err
 	}
-
-	return nil
+	return tx.Commit()
 }
 
 // RemoveKey removes a passphrase from a keyslot
@@ -302,10 +208,13 @@ func RemoveKey(device string, passphrase []byte, keyslot int) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read existing header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
+	if err := checkNotRotating(metadata); err != nil {
+		return err
+	}
 
 	// Check that keyslot exists
 	slotIDStr := strconv.Itoa(keyslot)
@@ -315,10 +224,11 @@ func RemoveKey(device string, passphrase []byte, keyslot int) error {
 	}
 
 	// Verify passphrase unlocks this specific keyslot
-	_, err = unlockKeyslot(device, passphrase, targetKeyslot, metadata.Digests)
+	masterKey, err := unlockKeyslot(device, passphrase, targetKeyslot, metadata.Digests)
 	if err != nil {
 		return fmt.Errorf("passphrase does not match keyslot %d: %w", keyslot, err)
 	}
+	masterKey.Destroy()
 
 	// Ensure at least one keyslot remains
 	if len(metadata.Keyslots) <= 1 {
@@ -343,6 +253,7 @@ func RemoveKey(device string, passphrase []byte, keyslot int) error {
 		}
 		digest.Keyslots = newKeyslots
 	}
+	dropAnnotation(metadata, slotIDStr)
 
 	// Increment sequence ID
 	hdr.SequenceID++
@@ -352,6 +263,7 @@ func RemoveKey(device string, passphrase []byte, keyslot int) error {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
+	emitEvent(Event{Type: EventKeyslotRemoved, Op: "removekey", Device: device, Keyslot: &keyslot})
 	return nil
 }
 
@@ -383,16 +295,20 @@ func KillSlot(device string, authPassphrase []byte, targetSlot int) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read existing header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
+	if err := checkNotRotating(metadata); err != nil {
+		return err
+	}
 
 	// Verify the auth passphrase works with any keyslot (authentication check)
 	authValid := false
 	for slotID, keyslot := range metadata.Keyslots {
-		_, err := unlockKeyslot(device, authPassphrase, keyslot, metadata.Digests)
+		masterKey, err := unlockKeyslot(device, authPassphrase, keyslot, metadata.Digests)
 		if err == nil {
+			masterKey.Destroy()
 			authValid = true
 			// Make sure we're not removing the only keyslot we can authenticate with
 			if slotID == strconv.Itoa(targetSlot) && len(metadata.Keyslots) == 1 {
@@ -435,6 +351,7 @@ func KillSlot(device string, authPassphrase []byte, targetSlot int) error {
 		}
 		digest.Keyslots = newKeyslots
 	}
+	dropAnnotation(metadata, slotIDStr)
 
 	// Increment sequence ID
 	hdr.SequenceID++
@@ -444,6 +361,7 @@ func KillSlot(device string, authPassphrase []byte, targetSlot int) error {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
+	emitEvent(Event{Type: EventKeyslotRemoved, Op: "killslot", Device: device, Keyslot: &targetSlot})
 	return nil
 }
 
@@ -459,6 +377,9 @@ func ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int)
 	if err := ValidatePassphrase(newPassphrase); err != nil {
 		return fmt.Errorf("invalid new passphrase: %w", err)
 	}
+	if err := checkPassphrasePolicy(newPassphrase); err != nil {
+		return fmt.Errorf("invalid new passphrase: %w", err)
+	}
 	if keyslot < 0 || keyslot >= MaxKeyslots {
 		return fmt.Errorf("invalid keyslot: %d (must be 0-%d)", keyslot, MaxKeyslots-1)
 	}
@@ -471,10 +392,13 @@ func ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int)
 	defer func() { _ = lock.Release() }()
 
 	// Read existing header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
+	if err := checkNotRotating(metadata); err != nil {
+		return err
+	}
 
 	// Check that keyslot exists
 	slotIDStr := strconv.Itoa(keyslot)
@@ -488,7 +412,7 @@ func ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int)
 	if err != nil {
 		return fmt.Errorf("old passphrase does not match keyslot %d: %w", keyslot, err)
 	}
-	defer clearBytes(masterKey)
+	defer masterKey.Destroy()
 
 	// Create new KDF (keep same type as existing)
 	kdfType := targetKeyslot.KDF.Type
@@ -513,27 +437,30 @@ func ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int)
 		}
 	}
 
-	kdf, err := CreateKDF(formatOpts, targetKeyslot.KeySize)
+	// The area keeps its cipher and key size
+	keySize := areaKeySize(targetKeyslot)
+	kdf, err := CreateKDF(formatOpts, keySize)
 	if err != nil {
 		return fmt.Errorf("failed to create KDF: %w", err)
 	}
 
 	// Derive key from new passphrase
-	passphraseKey, err := DeriveKey(newPassphrase, kdf, targetKeyslot.KeySize)
+	passphraseKey, err := deriveSecureKey(newPassphrase, kdf, keySize)
 	if err != nil {
 		return fmt.Errorf("failed to derive key: %w", err)
 	}
-	defer clearBytes(passphraseKey)
+	defer passphraseKey.Destroy()
 
 	// Apply anti-forensic split to master key
-	afData, err := AFSplit(masterKey, AFStripes, targetKeyslot.AF.Hash)
+	// Keep the keyslot's stripes: its area was sized for them
+	afData, err := AFSplit(masterKey.Bytes(), targetKeyslot.AF.Stripes, targetKeyslot.AF.Hash)
 	if err != nil {
 		return fmt.Errorf("failed to apply AF split: %w", err)
 	}
 	defer clearBytes(afData)
 
 	// Encrypt AF-split key material with new passphrase-derived key
-	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey, DefaultCipher)
+	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey.Bytes(), targetKeyslot.Area.Encryption)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt key material: %w", err)
 	}
@@ -555,35 +482,21 @@ func ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int)
 		return fmt.Errorf("new key material too large for existing keyslot area")
 	}
 
-	// Wipe existing keyslot area first
-	if err := wipeKeyslotArea(device, targetKeyslot); err != nil {
-		return fmt.Errorf("failed to wipe existing keyslot: %w", err)
+	if err := checkKeyslotArea(metadata, slotIDStr, existingOffset, existingSize); err != nil {
+		return err
 	}
 
-	// Write new encrypted key material
+	// Write new encrypted key material, padding over the rest of the old
 	f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- device path validated by caller
 	if err != nil {
 		return fmt.Errorf("failed to open device: %w", err)
 	}
 	defer func() { _ = f.Close() }()
 
-	if _, err := f.Seek(existingOffset, 0); err != nil {
-		return fmt.Errorf("failed to seek to keyslot area: %w", err)
-	}
-
-	if _, err := f.Write(encryptedKeyMaterial); err != nil {
+	if err := writeKeyslotArea(f, existingOffset, encryptedKeyMaterial, existingSize); err != nil {
 		return fmt.Errorf("failed to write key material: %w", err)
 	}
 
-	// Pad remaining area
-	remaining := existingSize - int64(len(encryptedKeyMaterial))
-	if remaining > 0 {
-		padding := make([]byte, remaining)
-		if _, err := f.Write(padding); err != nil {
-			return fmt.Errorf("failed to write padding: %w", err)
-		}
-	}
-
 	if err := f.Sync(); err != nil {
 		return fmt.Errorf("failed to sync: %w", err)
 	}
@@ -621,10 +534,13 @@ func KillKeyslot(device string, keyslot int) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read existing header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
+	if err := checkNotRotating(metadata); err != nil {
+		return err
+	}
 
 	// Check that keyslot exists
 	slotIDStr := strconv.Itoa(keyslot)
@@ -656,6 +572,7 @@ func KillKeyslot(device string, keyslot int) error {
 		}
 		digest.Keyslots = newKeyslots
 	}
+	dropAnnotation(metadata, slotIDStr)
 
 	// Increment sequence ID
 	hdr.SequenceID++
@@ -665,6 +582,7 @@ func KillKeyslot(device string, keyslot int) error {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
+	emitEvent(Event{Type: EventKeyslotRemoved, Op: "killkeyslot", Device: device, Keyslot: &keyslot})
 	return nil
 }
 
@@ -674,7 +592,7 @@ func ListKeyslots(device string) ([]KeyslotInfo, error) {
 		return nil, err
 	}
 
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
@@ -686,19 +604,7 @@ func ListKeyslots(device string) ([]KeyslotInfo, error) {
 			continue
 		}
 
-		priority := 0
-		if ks.Priority != nil {
-			priority = *ks.Priority
-		}
-
-		slots = append(slots, KeyslotInfo{
-			ID:         id,
-			Type:       ks.Type,
-			KeySize:    ks.KeySize,
-			Priority:   priority,
-			KDFType:    ks.KDF.Type,
-			Encryption: ks.Area.Encryption,
-		})
+		slots = append(slots, keyslotInfo(metadata, id, ks))
 	}
 
 	return slots, nil
@@ -712,24 +618,182 @@ type KeyslotInfo struct {
 	Priority   int
 	KDFType    string
 	Encryption string
+	Annotation *KeyslotAnnotation // nil = not annotated
+
+	// KDF parameters; those the KDF type does not use are zero
+	KDFHash       string // pbkdf2
+	KDFIterations int    // pbkdf2
+	KDFTime       int    // argon2
+	KDFMemory     int    // argon2, in KiB
+	KDFCPUs       int    // argon2
+
+	AFStripes   int
+	AFHash      string
+	AreaKeySize int // Key size of the area encryption, which may differ from KeySize
+}
+
+// keyslotInfo describes keyslot id of metadata
+func keyslotInfo(metadata *LUKS2Metadata, id int, ks *Keyslot) KeyslotInfo {
+	info := KeyslotInfo{
+		ID:       id,
+		Type:     ks.Type,
+		KeySize:  ks.KeySize,
+		Priority: keyslotPriority(ks),
+	}
+	if ks.KDF != nil {
+		info.KDFType = ks.KDF.Type
+		info.KDFHash = ks.KDF.Hash
+		info.KDFIterations = intValue(ks.KDF.Iterations)
+		info.KDFTime = intValue(ks.KDF.Time)
+		info.KDFMemory = intValue(ks.KDF.Memory)
+		info.KDFCPUs = intValue(ks.KDF.CPUs)
+	}
+	if ks.AF != nil {
+		info.AFStripes = ks.AF.Stripes
+		info.AFHash = ks.AF.Hash
+	}
+	if ks.Area != nil {
+		info.Encryption = ks.Area.Encryption
+		info.AreaKeySize = areaKeySize(ks)
+	}
+	if _, token := findAnnotation(metadata, strconv.Itoa(id)); token != nil {
+		info.Annotation = tokenAnnotation(token)
+	}
+	return info
+}
+
+// SetKeyslotPriority changes the priority of an existing keyslot, equivalent to
+// cryptsetup config --priority. Keyslots with KeyslotPriorityIgnore are skipped
+// during passphrase unlock; KeyslotPriorityPrefer keyslots are tried first.
+func SetKeyslotPriority(device string, keyslot int, priority int) error {
+	// Validate inputs
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if keyslot < 0 || keyslot >= MaxKeyslots {
+		return fmt.Errorf("invalid keyslot: %d (must be 0-%d)", keyslot, MaxKeyslots-1)
+	}
+	if err := validateKeyslotPriority(priority); err != nil {
+		return err
+	}
+
+	// Acquire exclusive lock
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	// Read existing header and metadata
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	// Check that keyslot exists
+	targetKeyslot, exists := metadata.Keyslots[strconv.Itoa(keyslot)]
+	if !exists {
+		return fmt.Errorf("keyslot %d does not exist", keyslot)
+	}
+
+	targetKeyslot.Priority = &priority
+
+	// Increment sequence ID
+	hdr.SequenceID++
+
+	// Write updated headers
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return nil
 }
 
-// getMasterKey unlocks the volume and returns the master key
-func getMasterKey(device string, passphrase []byte, metadata *LUKS2Metadata) ([]byte, error) {
-	for _, keyslot := range metadata.Keyslots {
-		if keyslot.Type != "luks2" {
+// validateKeyslotPriority checks that a priority is ignore, normal or prefer
+func validateKeyslotPriority(priority int) error {
+	if priority < KeyslotPriorityIgnore || priority > KeyslotPriorityPrefer {
+		return fmt.Errorf("invalid keyslot priority: %d (must be %d-%d)", priority, KeyslotPriorityIgnore, KeyslotPriorityPrefer)
+	}
+	return nil
+}
+
+// intValue returns *p, or 0 for nil
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// keyslotPriority returns the effective priority of a keyslot
+func keyslotPriority(ks *Keyslot) int {
+	if ks.Priority == nil {
+		return KeyslotPriorityNormal
+	}
+	return *ks.Priority
+}
+
+// unlockOrder returns the luks2 keyslots eligible for passphrase unlock:
+// prefer before normal, ascending keyslot number within a priority, and
+// ignore-priority keyslots omitted
+func unlockOrder(metadata *LUKS2Metadata) []*Keyslot {
+	type candidate struct {
+		id       int
+		priority int
+		keyslot  *Keyslot
+	}
+
+	candidates := make([]candidate, 0, len(metadata.Keyslots))
+	for idStr, ks := range metadata.Keyslots {
+		if ks.Type != "luks2" {
+			continue
+		}
+		priority := keyslotPriority(ks)
+		if priority == KeyslotPriorityIgnore {
+			continue
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
 			continue
 		}
+		candidates = append(candidates, candidate{id: id, priority: priority, keyslot: ks})
+	}
 
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	keyslots := make([]*Keyslot, len(candidates))
+	for i, c := range candidates {
+		keyslots[i] = c.keyslot
+	}
+	return keyslots
+}
+
+// getMasterKey unlocks the volume and returns the master key, trying
+// keyslots in priority order
+func getMasterKey(device string, passphrase []byte, metadata *LUKS2Metadata) (*securemem.Buffer, error) {
+	if err := checkNotRotating(metadata); err != nil {
+		return nil, err
+	}
+
+	var skipErr error
+	for _, keyslot := range unlockOrder(metadata) {
 		masterKey, err := unlockKeyslot(device, passphrase, keyslot, metadata.Digests)
 		if err != nil {
+			if keyslotSkipped(err) {
+				skipErr = err
+			}
 			continue
 		}
 
 		return masterKey, nil
 	}
 
-	return nil, fmt.Errorf("incorrect passphrase")
+	return nil, unlockFailure(skipErr)
 }
 
 // findAvailableKeyslot finds the next available keyslot number
@@ -758,27 +822,134 @@ func findAvailableKeyslot(metadata *LUKS2Metadata, opts *AddKeyOptions) (int, er
 	return 0, fmt.Errorf("no available keyslots")
 }
 
-// calculateNextKeyslotOffset calculates the offset for the next keyslot area
-func calculateNextKeyslotOffset(metadata *LUKS2Metadata) (int64, error) {
-	var maxEnd int64 = 0x8000 // Start after headers (32KB)
+// keyslotsAreaBounds returns the byte range keyslot areas may occupy: from
+// the end of the second header copy to the end of the configured keyslots
+// area, never reaching into a data segment
+func keyslotsAreaBounds(metadata *LUKS2Metadata) (int64, int64) {
+	start := 2 * int64(jsonAreaSize(metadata)+LUKS2HeaderSize)
+	end := start + LUKS2MaxKeyslotsSize
+	if metadata.Config != nil {
+		if size, err := parseSize(metadata.Config.KeyslotsSize); err == nil {
+			end = start + size
+		}
+	}
+	for _, seg := range metadata.Segments {
+		if seg == nil {
+			continue
+		}
+		if offset, err := parseSize(seg.Offset); err == nil && offset < end {
+			end = offset
+		}
+	}
+	return start, end
+}
 
+// allocateKeyslotArea finds room for a keyslot area of size bytes. The
+// first gap between existing areas that fits is used, so regions freed by
+// RemoveKey or KillSlot are reused before the area grows. The areas of
+// reserved keyslots, which metadata no longer lists, are avoided as well.
+func allocateKeyslotArea(metadata *LUKS2Metadata, size int64, reserved ...*Keyslot) (int64, error) {
+	start, end := keyslotsAreaBounds(metadata)
+
+	type span struct{ start, end int64 }
+	var used []span
+	keyslots := append([]*Keyslot(nil), reserved...)
 	for _, ks := range metadata.Keyslots {
+		keyslots = append(keyslots, ks)
+	}
+	for _, ks := range keyslots {
+		if ks == nil || ks.Area == nil {
+			continue
+		}
+		// An area that cannot be located could be anywhere, so nothing
+		// is known to be free
 		offset, err := parseSize(ks.Area.Offset)
 		if err != nil {
-			continue
+			return 0, fmt.Errorf("%w: keyslot area offset %q: %w", ErrInvalidHeader, ks.Area.Offset, err)
 		}
-		size, err := parseSize(ks.Area.Size)
+		areaSize, err := parseSize(ks.Area.Size)
 		if err != nil {
+			return 0, fmt.Errorf("%w: keyslot area size %q: %w", ErrInvalidHeader, ks.Area.Size, err)
+		}
+		used = append(used, span{offset, offset + areaSize})
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].start < used[j].start })
+
+	cursor := start
+	for _, u := range used {
+		if u.start-cursor >= size {
+			return cursor, nil
+		}
+		cursor = max(cursor, alignTo(u.end, KeyslotAreaAlignment))
+	}
+	if end-cursor >= size {
+		return cursor, nil
+	}
+
+	return 0, fmt.Errorf("%w: no free %d-byte region between offsets %d and %d (reformat with a larger keyslots size)", ErrKeyslotAreaFull, size, start, end)
+}
+
+// checkKeyslotArea verifies, right before key material is written, that
+// size bytes at offset for keyslot id lie inside the keyslots area, end
+// before every data segment and overlap no other keyslot. Crafted or
+// inconsistent metadata could otherwise point the write at user data or at
+// another keyslot's material, so nothing it says is taken on trust: config
+// values and offsets that do not parse fail the check instead of being
+// skipped. Violations are reported as a *MetadataError.
+func checkKeyslotArea(metadata *LUKS2Metadata, id string, offset, size int64) error {
+	path := "keyslots." + id + ".area"
+	if offset < 0 || size <= 0 {
+		return metadataErrorf(path, "invalid area of %d bytes at %d", size, offset)
+	}
+	if metadata.Config == nil {
+		return metadataErrorf("config", "missing")
+	}
+	jsonSize, err := parseSize(metadata.Config.JSONSize)
+	if err != nil || !validMetadataSize(jsonSize+LUKS2HeaderSize) {
+		return metadataErrorf("config.json_size", "invalid value %q", metadata.Config.JSONSize)
+	}
+	keyslotsSize, err := parseSize(metadata.Config.KeyslotsSize)
+	if err != nil || keyslotsSize <= 0 {
+		return metadataErrorf("config.keyslots_size", "invalid value %q", metadata.Config.KeyslotsSize)
+	}
+
+	start := 2 * (jsonSize + LUKS2HeaderSize)
+	if offset < start || size > start+keyslotsSize-offset {
+		return metadataErrorf(path, "%d bytes at %d are outside the keyslots area [%d, %d)", size, offset, start, start+keyslotsSize)
+	}
+
+	for _, segID := range sortedIDs(metadata.Segments) {
+		seg := metadata.Segments[segID]
+		if seg == nil {
 			continue
 		}
-		end := offset + size
-		if end > maxEnd {
-			maxEnd = end
+		segOffset, err := parseSize(seg.Offset)
+		if err != nil || segOffset < 0 {
+			return metadataErrorf("segments."+segID+".offset", "invalid value %q", seg.Offset)
+		}
+		if offset+size > segOffset {
+			return metadataErrorf(path, "%d bytes at %d reach into data segment %s at %d", size, offset, segID, segOffset)
 		}
 	}
 
-	// Align to 4KB boundary
-	return alignTo(maxEnd, KeyslotAreaAlignment), nil
+	for _, otherID := range sortedIDs(metadata.Keyslots) {
+		other := metadata.Keyslots[otherID]
+		if otherID == id || other == nil || other.Area == nil {
+			continue
+		}
+		otherOffset, err := parseSize(other.Area.Offset)
+		if err != nil || otherOffset < 0 {
+			return metadataErrorf("keyslots."+otherID+".area.offset", "invalid value %q", other.Area.Offset)
+		}
+		otherSize, err := parseSize(other.Area.Size)
+		if err != nil || otherSize < 0 {
+			return metadataErrorf("keyslots."+otherID+".area.size", "invalid value %q", other.Area.Size)
+		}
+		if offset < otherOffset+otherSize && otherOffset < offset+size {
+			return metadataErrorf(path, "%d bytes at %d overlap keyslot %s (%d bytes at %d)", size, offset, otherID, otherSize, otherOffset)
+		}
+	}
+	return nil
 }
 
 // wipeKeyslotArea securely wipes a keyslot area
@@ -800,12 +971,7 @@ func wipeKeyslotArea(device string, keyslot *Keyslot) error {
 	defer func() { _ = f.Close() }()
 
 	// Wipe with zeros
-	if _, err := f.Seek(offset, 0); err != nil {
-		return err
-	}
-
-	zeros := make([]byte, size)
-	if _, err := f.Write(zeros); err != nil {
+	if err := writeKeyslotArea(f, offset, nil, size); err != nil {
 		return err
 	}
 
@@ -7,6 +7,10 @@
 package luks2
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 )
@@ -103,11 +107,18 @@ func TestFindAvailableKeyslot(t *testing.T) {
 	}
 }
 
-func TestCalculateNextKeyslotOffset(t *testing.T) {
+func TestAllocateKeyslotArea(t *testing.T) {
+	area := func(offset, size string) *Keyslot {
+		return &Keyslot{Area: &KeyslotArea{Offset: offset, Size: size}}
+	}
+
 	tests := []struct {
 		name           string
 		keyslots       map[string]*Keyslot
+		config         *Config
+		segments       map[string]*Segment
 		expectedOffset int64
+		expectFull     bool
 	}{
 		{
 			name:           "no existing keyslots",
@@ -117,42 +128,73 @@ func TestCalculateNextKeyslotOffset(t *testing.T) {
 		{
 			name: "one keyslot",
 			keyslots: map[string]*Keyslot{
-				"0": {
-					Area: &KeyslotArea{
-						Offset: "32768",  // 0x8000
-						Size:   "262144", // 256KB
-					},
-				},
+				"0": area("32768", "262144"), // 0x8000, 256KB
 			},
 			expectedOffset: 294912, // 32768 + 262144 = 294912
 		},
 		{
 			name: "multiple keyslots",
 			keyslots: map[string]*Keyslot{
-				"0": {
-					Area: &KeyslotArea{
-						Offset: "32768",
-						Size:   "262144",
-					},
-				},
-				"1": {
-					Area: &KeyslotArea{
-						Offset: "294912",
-						Size:   "262144",
-					},
-				},
+				"0": area("32768", "262144"),
+				"1": area("294912", "262144"),
 			},
 			expectedOffset: 557056, // 294912 + 262144 = 557056
 		},
+		{
+			name: "reuses hole left by removed keyslot",
+			keyslots: map[string]*Keyslot{
+				"0": area("32768", "262144"),
+				"2": area("557056", "262144"),
+			},
+			expectedOffset: 294912,
+		},
+		{
+			name: "hole too small is skipped",
+			keyslots: map[string]*Keyslot{
+				"0": area("32768", "262144"),
+				"1": area("425984", "262144"), // 128KB gap before it
+			},
+			expectedOffset: 688128,
+		},
+		{
+			name: "keyslots_size limit",
+			keyslots: map[string]*Keyslot{
+				"0": area("32768", "262144"),
+			},
+			config:     &Config{JSONSize: "12288", KeyslotsSize: "393216"},
+			expectFull: true,
+		},
+		{
+			name: "data segment limit",
+			keyslots: map[string]*Keyslot{
+				"0": area("32768", "262144"),
+			},
+			segments:   map[string]*Segment{"0": {Offset: "524288"}},
+			expectFull: true,
+		},
+		{
+			name:           "larger metadata size",
+			keyslots:       map[string]*Keyslot{},
+			config:         &Config{JSONSize: "61440", KeyslotsSize: "16777216"},
+			expectedOffset: 131072, // 2 * 64KB
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			metadata := &LUKS2Metadata{
 				Keyslots: tt.keyslots,
+				Config:   tt.config,
+				Segments: tt.segments,
 			}
 
-			offset, err := calculateNextKeyslotOffset(metadata)
+			offset, err := allocateKeyslotArea(metadata, 262144)
+			if tt.expectFull {
+				if !errors.Is(err, ErrKeyslotAreaFull) {
+					t.Fatalf("expected ErrKeyslotAreaFull, got offset %d, err %v", offset, err)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -164,6 +206,215 @@ func TestCalculateNextKeyslotOffset(t *testing.T) {
 	}
 }
 
+// TestAllocateKeyslotArea_AllSlots tests that the default keyslots area
+// holds all 32 keyslots with 512-bit keys
+func TestAllocateKeyslotArea_AllSlots(t *testing.T) {
+	metadata := &LUKS2Metadata{
+		Keyslots: map[string]*Keyslot{},
+		Config:   &Config{JSONSize: formatSize(LUKS2DefaultSize), KeyslotsSize: formatSize(LUKS2DefaultKeyslotsSize)},
+		Segments: map[string]*Segment{"0": {Offset: formatSize(LUKS2HeaderDefaultSize)}},
+	}
+	size := alignTo(64*AFStripes, KeyslotAreaAlignment)
+
+	for i := 0; i < MaxKeyslots; i++ {
+		offset, err := allocateKeyslotArea(metadata, size)
+		if err != nil {
+			t.Fatalf("keyslot %d: %v", i, err)
+		}
+		metadata.Keyslots[strconv.Itoa(i)] = &Keyslot{Area: &KeyslotArea{Offset: formatSize(offset), Size: formatSize(size)}}
+	}
+}
+
+// TestAddKey_ReusesFreedArea tests that a removed keyslot's area is reused
+// and that AddKey honors keyslots_size
+func TestAddKey_ReusesFreedArea(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for exactly three 512-bit keyslots
+	slotSize := alignTo(64*AFStripes, KeyslotAreaAlignment)
+	first := []byte("test-password")
+	if err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    first,
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		KeyslotsSize:  3 * slotSize,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	addTestKeys(t, path, first, 2)
+
+	addOpts := &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}
+	if err := AddKey(path, first, []byte("overflow-password"), addOpts); !errors.Is(err, ErrKeyslotAreaFull) {
+		t.Fatalf("expected ErrKeyslotAreaFull, got %v", err)
+	}
+
+	_, metadata, err := ReadHeader(path)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	freed := metadata.Keyslots["1"].Area.Offset
+
+	if err := KillSlot(path, first, 1); err != nil {
+		t.Fatalf("KillSlot failed: %v", err)
+	}
+	if err := AddKey(path, first, []byte("replacement-password"), addOpts); err != nil {
+		t.Fatalf("AddKey after KillSlot failed: %v", err)
+	}
+
+	_, metadata, err = ReadHeader(path)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if got := metadata.Keyslots["1"].Area.Offset; got != freed {
+		t.Errorf("new keyslot at offset %s, want reused offset %s", got, freed)
+	}
+	if err := TestKey(path, []byte("replacement-password")); err != nil {
+		t.Errorf("replacement passphrase does not unlock: %v", err)
+	}
+}
+
+// TestAllocateKeyslotArea_UnparseableArea tests that an existing area that
+// cannot be located stops allocation instead of being ignored
+func TestAllocateKeyslotArea_UnparseableArea(t *testing.T) {
+	metadata := &LUKS2Metadata{
+		Keyslots: map[string]*Keyslot{"0": {Area: &KeyslotArea{Offset: "32768x", Size: "262144"}}},
+	}
+	if offset, err := allocateKeyslotArea(metadata, 262144); !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader, got offset %d, err %v", offset, err)
+	}
+}
+
+func TestCheckKeyslotArea(t *testing.T) {
+	const slotSize = 262144
+	valid := func() *LUKS2Metadata {
+		return &LUKS2Metadata{
+			Keyslots: map[string]*Keyslot{
+				"0": {Area: &KeyslotArea{Offset: "32768", Size: formatSize(slotSize)}},
+			},
+			Segments: map[string]*Segment{"0": {Offset: "16777216"}},
+			Config:   &Config{JSONSize: "12288", KeyslotsSize: "16744448"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *LUKS2Metadata)
+		offset int64
+		path   string // Expected MetadataError path; empty = valid
+	}{
+		{"after keyslot 0", func(m *LUKS2Metadata) {}, 294912, ""},
+		{"rewrite in place", func(m *LUKS2Metadata) {}, 32768, ""},
+		{"inside the headers", func(m *LUKS2Metadata) {}, 16384, "keyslots.1.area"},
+		{"past keyslots_size", func(m *LUKS2Metadata) {}, 16777216 - 4096, "keyslots.1.area"},
+		{"overlaps keyslot 0", func(m *LUKS2Metadata) {}, 32768 + 4096, "keyslots.1.area"},
+		{"keyslots_size beyond data", func(m *LUKS2Metadata) {
+			m.Config.KeyslotsSize = "33521664"
+		}, 16777216 - 4096, "keyslots.1.area"},
+		{"data segment inside the keyslots area", func(m *LUKS2Metadata) {
+			m.Segments["0"].Offset = "524288"
+		}, 294912, "keyslots.1.area"},
+		{"unparseable segment offset", func(m *LUKS2Metadata) {
+			m.Segments["0"].Offset = "dynamic"
+		}, 294912, "segments.0.offset"},
+		{"unparseable keyslots_size", func(m *LUKS2Metadata) {
+			m.Config.KeyslotsSize = ""
+		}, 294912, "config.keyslots_size"},
+		{"invalid json_size", func(m *LUKS2Metadata) {
+			m.Config.JSONSize = "1000"
+		}, 294912, "config.json_size"},
+		{"unparseable neighbour", func(m *LUKS2Metadata) {
+			m.Keyslots["0"].Area.Size = "256k"
+		}, 294912, "keyslots.0.area.size"},
+		{"missing config", func(m *LUKS2Metadata) {
+			m.Config = nil
+		}, 294912, "config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := valid()
+			tt.modify(metadata)
+			id := "1"
+			if tt.offset == 32768 {
+				id = "0"
+			}
+
+			err := checkKeyslotArea(metadata, id, tt.offset, slotSize)
+			if tt.path == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var merr *MetadataError
+			if !errors.As(err, &merr) || merr.Path != tt.path {
+				t.Fatalf("expected MetadataError at %s, got %v", tt.path, err)
+			}
+			if !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("error does not match ErrInvalidHeader: %v", err)
+			}
+		})
+	}
+}
+
+// TestChangeKey_AreaOverlapsData tests that crafted metadata moving a
+// keyslot into the data segment is refused before anything is written
+func TestChangeKey_AreaOverlapsData(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	// Move keyslot 0's material so it straddles the start of the data
+	// segment, and grow keyslots_size so the area still passes the schema
+	e, err := OpenHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := e.Metadata.Keyslots["0"]
+	offset, _ := parseSize(ks.Area.Offset)
+	size, _ := parseSize(ks.Area.Size)
+	dataOffset, _ := parseSize(e.Metadata.Segments["0"].Offset)
+	moved := dataOffset - KeyslotAreaAlignment
+
+	data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[moved:], data[offset:offset+size])
+	if err := os.WriteFile(device, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ks.Area.Offset = formatSize(moved)
+	e.Metadata.Config.KeyslotsSize = formatSize(moved + size - 2*int64(e.Header.HeaderSize))
+	if err := e.Commit(); err != nil {
+		t.Fatalf("Commit of crafted metadata failed: %v", err)
+	}
+	_ = e.Close()
+
+	before, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ChangeKey(device, passphrase, []byte("new-password"), 0)
+	var merr *MetadataError
+	if !errors.As(err, &merr) || merr.Path != "keyslots.0.area" {
+		t.Fatalf("expected MetadataError for keyslots.0.area, got %v", err)
+	}
+	after, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("refused ChangeKey modified the device")
+	}
+}
+
 func TestKeyslotInfoList(t *testing.T) {
 	// Test KeyslotInfo struct fields
 	info := KeyslotInfo{
@@ -227,3 +478,279 @@ func TestKeyslotAreaAlignment(t *testing.T) {
 		t.Errorf("expected KeyslotAreaAlignment to be 4096, got %d", KeyslotAreaAlignment)
 	}
 }
+
+func TestValidateKeyslotPriority(t *testing.T) {
+	for _, p := range []int{KeyslotPriorityIgnore, KeyslotPriorityNormal, KeyslotPriorityPrefer} {
+		if err := validateKeyslotPriority(p); err != nil {
+			t.Errorf("priority %d should be valid: %v", p, err)
+		}
+	}
+	for _, p := range []int{-1, 3, 100} {
+		if err := validateKeyslotPriority(p); err == nil {
+			t.Errorf("priority %d should be invalid", p)
+		}
+	}
+}
+
+func TestKeyslotPriorityDefault(t *testing.T) {
+	if got := keyslotPriority(&Keyslot{}); got != KeyslotPriorityNormal {
+		t.Errorf("expected missing priority to be normal, got %d", got)
+	}
+	prefer := KeyslotPriorityPrefer
+	if got := keyslotPriority(&Keyslot{Priority: &prefer}); got != KeyslotPriorityPrefer {
+		t.Errorf("expected prefer, got %d", got)
+	}
+}
+
+func TestUnlockOrder(t *testing.T) {
+	ignore, normal, prefer := KeyslotPriorityIgnore, KeyslotPriorityNormal, KeyslotPriorityPrefer
+	slots := map[string]*Keyslot{
+		"0":  {Type: "luks2", Priority: &normal},
+		"1":  {Type: "luks2", Priority: &ignore},
+		"2":  {Type: "luks2", Priority: &prefer},
+		"3":  {Type: "luks2"}, // absent = normal
+		"10": {Type: "luks2", Priority: &prefer},
+		"4":  {Type: "reencrypt", Priority: &prefer},
+	}
+	metadata := &LUKS2Metadata{Keyslots: slots}
+
+	order := unlockOrder(metadata)
+	want := []*Keyslot{slots["2"], slots["10"], slots["0"], slots["3"]}
+
+	if len(order) != len(want) {
+		t.Fatalf("expected %d keyslots, got %d", len(want), len(order))
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("position %d: unexpected keyslot", i)
+		}
+	}
+}
+
+func TestSetKeyslotPriority(t *testing.T) {
+	first := []byte("first-password")
+	second := []byte("second-password")
+	device := formatTestVolume(t, first)
+
+	prefer := KeyslotPriorityPrefer
+	if err := AddKey(device, first, second, &AddKeyOptions{
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		Priority:      &prefer,
+	}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	slots, err := ListKeyslots(device)
+	if err != nil {
+		t.Fatalf("ListKeyslots failed: %v", err)
+	}
+	for _, s := range slots {
+		want := KeyslotPriorityNormal
+		if s.ID == 1 {
+			want = KeyslotPriorityPrefer
+		}
+		if s.Priority != want {
+			t.Errorf("keyslot %d: expected priority %d, got %d", s.ID, want, s.Priority)
+		}
+	}
+
+	// Ignored keyslots are skipped during passphrase unlock
+	if err := SetKeyslotPriority(device, 0, KeyslotPriorityIgnore); err != nil {
+		t.Fatalf("SetKeyslotPriority failed: %v", err)
+	}
+	if err := TestKey(device, first); err == nil {
+		t.Error("expected ignored keyslot passphrase to be rejected")
+	}
+	if err := TestKey(device, second); err != nil {
+		t.Errorf("expected keyslot 1 passphrase to unlock: %v", err)
+	}
+
+	// Restoring normal priority re-enables the keyslot
+	if err := SetKeyslotPriority(device, 0, KeyslotPriorityNormal); err != nil {
+		t.Fatalf("SetKeyslotPriority failed: %v", err)
+	}
+	if err := TestKey(device, first); err != nil {
+		t.Errorf("expected keyslot 0 passphrase to unlock: %v", err)
+	}
+}
+
+func TestSetKeyslotPriorityErrors(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	tests := []struct {
+		name     string
+		device   string
+		keyslot  int
+		priority int
+	}{
+		{"invalid device", "relative/path", 0, KeyslotPriorityNormal},
+		{"negative keyslot", device, -1, KeyslotPriorityNormal},
+		{"keyslot out of range", device, MaxKeyslots, KeyslotPriorityNormal},
+		{"missing keyslot", device, 5, KeyslotPriorityNormal},
+		{"invalid priority", device, 0, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetKeyslotPriority(tt.device, tt.keyslot, tt.priority); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// TestVerifyPassphrase tests matching passphrases to keyslots
+func TestVerifyPassphrase(t *testing.T) {
+	first := []byte("test-password")
+	device := formatTestVolume(t, first)
+	extra := addTestKeys(t, device, first, 1)
+
+	tests := []struct {
+		name    string
+		pass    []byte
+		ok      bool
+		keyslot int
+	}{
+		{"keyslot 0", first, true, 0},
+		{"keyslot 1", extra[0], true, 1},
+		{"wrong passphrase", []byte("wrong-password"), false, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, keyslot, err := VerifyPassphrase(device, tt.pass)
+			if err != nil {
+				t.Fatalf("VerifyPassphrase failed: %v", err)
+			}
+			if ok != tt.ok || keyslot != tt.keyslot {
+				t.Errorf("got (%v, %d), want (%v, %d)", ok, keyslot, tt.ok, tt.keyslot)
+			}
+		})
+	}
+
+	if _, _, err := VerifyPassphrase("relative/path", first); err == nil {
+		t.Error("expected error for invalid device path")
+	}
+	if _, _, err := VerifyPassphrase(device, nil); err == nil {
+		t.Error("expected error for empty passphrase")
+	}
+}
+
+func TestTestPassphrase(t *testing.T) {
+	first := []byte("test-password")
+	device := formatTestVolume(t, first)
+	extra := addTestKeys(t, device, first, 1)
+	slot := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		pass    []byte
+		opts    *UnlockOptions
+		keyslot int
+		wantErr error
+	}{
+		{"any keyslot", extra[0], nil, 1, nil},
+		{"selected keyslot", first, &UnlockOptions{Keyslot: slot(0)}, 0, nil},
+		{"other keyslot selected", first, &UnlockOptions{Keyslot: slot(1)}, -1, ErrInvalidPassphrase},
+		{"missing keyslot", first, &UnlockOptions{Keyslot: slot(5)}, -1, ErrInvalidKeyslot},
+		{"wrong passphrase", []byte("wrong-password"), nil, -1, ErrInvalidPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyslot, err := TestPassphrase(device, tt.pass, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TestPassphrase() error = %v, want %v", err, tt.wantErr)
+			}
+			if keyslot != tt.keyslot {
+				t.Errorf("TestPassphrase() = %d, want %d", keyslot, tt.keyslot)
+			}
+		})
+	}
+}
+
+// TestAFStripes tests keyslots with other than the default stripes: their
+// areas are sized for them, they unlock, and ChangeKey keeps them
+func TestAFStripes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	first := []byte("test-password")
+	if err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    first,
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		AFStripes:     1000,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	second := []byte("second-password")
+	if err := AddKey(path, first, second, &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10, AFStripes: 1}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	check := func(id string, stripes int) {
+		t.Helper()
+		_, metadata, err := ReadHeader(path)
+		if err != nil {
+			t.Fatalf("ReadHeader failed: %v", err)
+		}
+		ks := metadata.Keyslots[id]
+		if ks.AF.Stripes != stripes {
+			t.Errorf("keyslot %s: %d stripes, want %d", id, ks.AF.Stripes, stripes)
+		}
+		if want := formatSize(alignTo(int64(ks.KeySize*stripes), KeyslotAreaAlignment)); ks.Area.Size != want {
+			t.Errorf("keyslot %s: area of %s bytes, want %s", id, ks.Area.Size, want)
+		}
+	}
+	check("0", 1000)
+	check("1", 1)
+
+	for _, passphrase := range [][]byte{first, second} {
+		if err := TestKey(path, passphrase); err != nil {
+			t.Errorf("%q does not unlock: %v", passphrase, err)
+		}
+	}
+
+	third := []byte("third-password")
+	if err := ChangeKey(path, second, third, 1); err != nil {
+		t.Fatalf("ChangeKey failed: %v", err)
+	}
+	check("1", 1)
+	if err := TestKey(path, third); err != nil {
+		t.Errorf("changed passphrase does not unlock: %v", err)
+	}
+
+	report, err := Validate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || !hasProblem(report, "keyslot 1", "af stripes 1 differ") {
+		t.Errorf("expected only a stripes warning, got %v", report.Problems)
+	}
+}
+
+func TestAFStripes_Invalid(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	err := AddKey(device, []byte("test-password"), []byte("second-password"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10, AFStripes: -1})
+	if !errors.Is(err, ErrInvalidAFStripes) {
+		t.Errorf("AddKey with negative stripes: expected ErrInvalidAFStripes, got %v", err)
+	}
+	err = AddKey(device, []byte("test-password"), []byte("second-password"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10, AFStripes: LUKS2MaxKeyslotsSize})
+	if !errors.Is(err, ErrInvalidAFStripes) {
+		t.Errorf("AddKey with too many stripes: expected ErrInvalidAFStripes, got %v", err)
+	}
+
+	err = ValidateFormatOptions(FormatOptions{Device: device, Passphrase: []byte("test-password"), AFStripes: -5})
+	if !errors.Is(err, ErrInvalidAFStripes) {
+		t.Errorf("ValidateFormatOptions with negative stripes: expected ErrInvalidAFStripes, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// keyslotEncryption is a parsed keyslot area.encryption value. cryptsetup
+// writes "aes-xts-plain64" by default, but --keyslot-cipher picks others
+// and volumes converted from LUKS1 keep the LUKS1 cipher, often
+// "aes-cbc-essiv:sha256".
+type keyslotEncryption struct {
+	spec      string
+	mode      string // "xts" or "cbc"
+	iv        string // "plain", "plain64" or "essiv"
+	essivHash string
+}
+
+// parseKeyslotEncryption parses spec and checks that keySize bytes are a
+// valid key for it, so a volume whose keyslots this package cannot decrypt
+// fails before any key is derived
+func parseKeyslotEncryption(spec string, keySize int) (*keyslotEncryption, error) {
+	unsupported := func(reason string) error {
+		return fmt.Errorf("%w: keyslot area encryption %q: %s", ErrUnsupportedCipher, spec, reason)
+	}
+
+	parts := strings.SplitN(spec, "-", 3)
+	if len(parts) != 3 {
+		return nil, unsupported("expected cipher-mode-iv")
+	}
+	if parts[0] != "aes" {
+		return nil, unsupported("only aes is supported")
+	}
+	e := &keyslotEncryption{spec: spec, mode: parts[1], iv: parts[2]}
+	if hash, ok := strings.CutPrefix(e.iv, "essiv:"); ok {
+		e.iv, e.essivHash = "essiv", hash
+	}
+
+	switch e.mode {
+	case "xts":
+		// Keyslot areas are far below 2^32 sectors, so plain and plain64
+		// tweaks are the same
+		if e.iv != "plain" && e.iv != "plain64" {
+			return nil, unsupported("xts needs a plain or plain64 IV")
+		}
+		if keySize != 32 && keySize != 48 && keySize != 64 {
+			return nil, unsupported(fmt.Sprintf("%d-byte key, xts needs 32, 48 or 64", keySize))
+		}
+	case "cbc":
+		if e.iv != "plain" && e.iv != "plain64" && e.iv != "essiv" {
+			return nil, unsupported("cbc needs a plain, plain64 or essiv IV")
+		}
+		if keySize != 16 && keySize != 24 && keySize != 32 {
+			return nil, unsupported(fmt.Sprintf("%d-byte key, cbc needs 16, 24 or 32", keySize))
+		}
+		if e.iv == "essiv" {
+			hashFunc, err := getPBKDF2HashFunc(e.essivHash)
+			if err != nil {
+				return nil, unsupported(err.Error())
+			}
+			// The ESSIV key is the hash of the key, so it must be an AES key
+			if size := hashFunc().Size(); size != 16 && size != 24 && size != 32 {
+				return nil, unsupported(fmt.Sprintf("%s digests are not an AES key size", e.essivHash))
+			}
+		}
+	default:
+		return nil, unsupported("only xts and cbc modes are supported")
+	}
+	return e, nil
+}
+
+// newCipher returns the sector cipher of the encryption keyed with key.
+// XTS runs on the selected crypto backend; CBC always uses Go.
+func (e *keyslotEncryption) newCipher(key []byte) (sectorCipher, error) {
+	if e.mode == "xts" {
+		return newSectorCipher(key)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	c := &cbcSector{block: block, plain64: e.iv != "plain"}
+	if e.iv == "essiv" {
+		hashFunc, err := getPBKDF2HashFunc(e.essivHash)
+		if err != nil {
+			return nil, err
+		}
+		h := hashFunc()
+		h.Write(key)
+		salt := h.Sum(nil)
+		defer clearBytes(salt)
+		if c.essiv, err = aes.NewCipher(salt); err != nil {
+			return nil, fmt.Errorf("failed to create ESSIV cipher: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// cbcSector is AES-CBC with a per-sector IV as dm-crypt computes it: the
+// sector number (32-bit for plain, 64-bit for plain64), encrypted with the
+// hash of the key for ESSIV
+type cbcSector struct {
+	block   cipher.Block
+	essiv   cipher.Block // nil unless ESSIV
+	plain64 bool
+}
+
+func (c *cbcSector) iv(sector uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	if c.plain64 {
+		binary.LittleEndian.PutUint64(iv, sector)
+	} else {
+		binary.LittleEndian.PutUint32(iv, uint32(sector)) // #nosec G115 -- plain IVs truncate, as in dm-crypt
+	}
+	if c.essiv != nil {
+		c.essiv.Encrypt(iv, iv)
+	}
+	return iv
+}
+
+func (c *cbcSector) Encrypt(dst, src []byte, sector uint64) error {
+	cipher.NewCBCEncrypter(c.block, c.iv(sector)).CryptBlocks(dst, src)
+	return nil
+}
+
+func (c *cbcSector) Decrypt(dst, src []byte, sector uint64) error {
+	cipher.NewCBCDecrypter(c.block, c.iv(sector)).CryptBlocks(dst, src)
+	return nil
+}
+
+func (c *cbcSector) Close() error {
+	return nil
+}
+
+// areaKeySize returns the size of the key that encrypts the area of ks.
+// cryptsetup records it apart from the volume key size, and the two differ
+// with --keyslot-key-size or integrity (a 96-byte volume key with a 64-byte
+// area key); headers without it use the volume key size.
+func areaKeySize(ks *Keyslot) int {
+	if ks.Area != nil && ks.Area.KeySize > 0 {
+		return ks.Area.KeySize
+	}
+	return ks.KeySize
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- LUKS1-converted keyslots use sha1 for AF
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/xts"
+)
+
+func TestParseKeyslotEncryption(t *testing.T) {
+	tests := []struct {
+		spec    string
+		keySize int
+		wantErr bool
+	}{
+		{"aes-xts-plain64", 64, false},
+		{"aes-xts-plain64", 48, false},
+		{"aes-xts-plain64", 32, false},
+		{"aes-xts-plain", 64, false},
+		{"aes-cbc-essiv:sha256", 32, false},
+		{"aes-cbc-essiv:sha256", 16, false},
+		{"aes-cbc-plain64", 24, false},
+		{"aes-cbc-plain", 16, false},
+		{"aes-xts-plain64", 16, true},
+		{"aes-xts-essiv:sha256", 64, true},
+		{"aes-cbc-plain64", 64, true},
+		{"aes-cbc-essiv:sha512", 32, true}, // 64-byte digest is no AES key
+		{"aes-cbc-essiv:md5", 32, true},
+		{"aes-cbc-benbi", 32, true},
+		{"serpent-xts-plain64", 64, true},
+		{"aes-ecb-plain64", 32, true},
+		{"aes", 64, true},
+		{"", 64, true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseKeyslotEncryption(tt.spec, tt.keySize)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseKeyslotEncryption(%q, %d) error = %v, wantErr %v", tt.spec, tt.keySize, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrUnsupportedCipher) {
+			t.Errorf("parseKeyslotEncryption(%q, %d) error = %v, want ErrUnsupportedCipher", tt.spec, tt.keySize, err)
+		}
+	}
+}
+
+// referenceSectorEncrypt encrypts data sector by sector as dm-crypt does,
+// using only the standard library and x/crypto
+func referenceSectorEncrypt(t *testing.T, spec string, key, data []byte) []byte {
+	t.Helper()
+	out := make([]byte, len(data))
+	for sector := 0; sector*512 < len(data); sector++ {
+		src := data[sector*512 : (sector+1)*512]
+		dst := out[sector*512 : (sector+1)*512]
+		switch spec {
+		case "aes-xts-plain64":
+			c, err := xts.NewCipher(aes.NewCipher, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Encrypt(dst, src, uint64(sector))
+		case "aes-cbc-essiv:sha256", "aes-cbc-plain64", "aes-cbc-plain":
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			iv := make([]byte, aes.BlockSize)
+			if spec == "aes-cbc-plain" {
+				binary.LittleEndian.PutUint32(iv, uint32(sector))
+			} else {
+				binary.LittleEndian.PutUint64(iv, uint64(sector))
+			}
+			if spec == "aes-cbc-essiv:sha256" {
+				salt := sha256.Sum256(key)
+				essiv, err := aes.NewCipher(salt[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				essiv.Encrypt(iv, iv)
+			}
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(dst, src)
+		default:
+			t.Fatalf("no reference for %q", spec)
+		}
+	}
+	return out
+}
+
+func TestKeyMaterialMatchesReference(t *testing.T) {
+	data := make([]byte, 4*512)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec    string
+		keySize int
+	}{
+		{"aes-xts-plain64", 64},
+		{"aes-cbc-essiv:sha256", 32},
+		{"aes-cbc-essiv:sha256", 16},
+		{"aes-cbc-plain64", 32},
+		{"aes-cbc-plain", 24},
+	}
+
+	for _, tt := range tests {
+		key := make([]byte, tt.keySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		want := referenceSectorEncrypt(t, tt.spec, key, data)
+
+		got, err := encryptKeyMaterial(data, key, tt.spec)
+		if err != nil {
+			t.Fatalf("%s: encryptKeyMaterial() error = %v", tt.spec, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s/%d: ciphertext differs from the reference", tt.spec, tt.keySize)
+		}
+		plain, err := decryptKeyMaterial(want, key, tt.spec, 512)
+		if err != nil {
+			t.Fatalf("%s: decryptKeyMaterial() error = %v", tt.spec, err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Errorf("%s/%d: reference ciphertext does not decrypt", tt.spec, tt.keySize)
+		}
+	}
+}
+
+func TestCBCSector_PlainIVTruncates(t *testing.T) {
+	key := make([]byte, 32)
+	enc, err := parseKeyslotEncryption("aes-cbc-plain", len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := enc.newCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 512)
+	low, high := make([]byte, 512), make([]byte, 512)
+	if err := c.Encrypt(low, data, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Encrypt(high, data, 1<<32+7); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(low, high) {
+		t.Error("plain IV should use only the low 32 bits of the sector")
+	}
+}
+
+// referenceAFSplit splits key as the LUKS1 specification describes,
+// independently of AFSplit
+func referenceAFSplit(t *testing.T, key []byte, stripes int, newHash func() hash.Hash) []byte {
+	t.Helper()
+	size := len(key)
+	split := make([]byte, size*stripes)
+	if _, err := rand.Read(split[:size*(stripes-1)]); err != nil {
+		t.Fatal(err)
+	}
+
+	d := make([]byte, size)
+	for i := 0; i < stripes-1; i++ {
+		for j := range d {
+			d[j] ^= split[i*size+j]
+		}
+		// diffuse: hash each digest-sized block with its big-endian index
+		var diffused []byte
+		digestSize := newHash().Size()
+		for block := 0; block*digestSize < size; block++ {
+			h := newHash()
+			_ = binary.Write(h, binary.BigEndian, uint32(block))
+			h.Write(d[block*digestSize : min((block+1)*digestSize, size)])
+			sum := h.Sum(nil)
+			diffused = append(diffused, sum[:min(digestSize, size-block*digestSize)]...)
+		}
+		d = diffused
+	}
+	for j := range d {
+		split[(stripes-1)*size+j] = d[j] ^ key[j]
+	}
+	return split
+}
+
+// TestUnlock_ForeignKeyslots rewrites keyslot 0 the way other tools lay it
+// out, with every step computed by reference code, and checks it unlocks
+func TestUnlock_ForeignKeyslots(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption string
+		areaKey    int
+		afHash     string
+		newHash    func() hash.Hash
+	}{
+		{"xts with a smaller area key and sha512 AF", "aes-xts-plain64", 32, "sha512", sha512.New},
+		{"LUKS1-converted cbc-essiv with sha1 AF", "aes-cbc-essiv:sha256", 32, "sha1", sha1.New},
+		{"cbc-plain64 with a 128-bit area key", "aes-cbc-plain64", 16, "sha256", sha256.New},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password")
+			path := formatTestVolume(t, passphrase)
+			volumeKey, err := ExtractVolumeKey(path, passphrase)
+			if err != nil {
+				t.Fatalf("ExtractVolumeKey failed: %v", err)
+			}
+
+			hdr, metadata, err := ReadHeader(path)
+			if err != nil {
+				t.Fatalf("ReadHeader failed: %v", err)
+			}
+			ks := metadata.Keyslots["0"]
+			offset, err := parseSize(ks.Area.Offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			salt := make([]byte, 32)
+			if _, err := rand.Read(salt); err != nil {
+				t.Fatal(err)
+			}
+			iterations := 1000
+			areaKey := pbkdf2.Key(passphrase, salt, iterations, tt.areaKey, sha256.New)
+			split := referenceAFSplit(t, volumeKey, ks.AF.Stripes, tt.newHash)
+			material := referenceSectorEncrypt(t, tt.encryption, areaKey, split)
+
+			ks.KDF = &KDF{Type: "pbkdf2", Hash: "sha256", Salt: encodeBase64(salt), Iterations: &iterations}
+			ks.AF.Hash = tt.afHash
+			ks.Area.Encryption = tt.encryption
+			ks.Area.KeySize = tt.areaKey
+			if err := writeHeaderInternal(path, hdr, metadata); err != nil {
+				t.Fatalf("writeHeaderInternal failed: %v", err)
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 -- test temp file
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.WriteAt(material, offset)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ExtractVolumeKey(path, passphrase)
+			if err != nil {
+				t.Fatalf("foreign keyslot does not unlock: %v", err)
+			}
+			if !bytes.Equal(got, volumeKey) {
+				t.Error("foreign keyslot unlocks the wrong volume key")
+			}
+
+			// New keyslots copy the area layout of the one they unlock with
+			second := []byte("second-password")
+			if err := AddKey(path, passphrase, second, &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+				t.Fatalf("AddKey failed: %v", err)
+			}
+			if err := TestKey(path, second); err != nil {
+				t.Errorf("added keyslot does not unlock: %v", err)
+			}
+			_, metadata, err = ReadHeader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if area := metadata.Keyslots["1"].Area; area.Encryption != tt.encryption || area.KeySize != tt.areaKey {
+				t.Errorf("added keyslot area is %s/%d, want %s/%d", area.Encryption, area.KeySize, tt.encryption, tt.areaKey)
+			}
+		})
+	}
+}
+
+func TestUnlock_UnsupportedAreaEncryption(t *testing.T) {
+	passphrase := []byte("test-password")
+	path := formatTestVolume(t, passphrase)
+
+	hdr, metadata, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.Keyslots["0"].Area.Encryption = "serpent-xts-plain64"
+	if err := writeHeaderInternal(path, hdr, metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := TestKey(path, passphrase); !errors.Is(err, ErrUnsupportedCipher) {
+		t.Errorf("TestKey() error = %v, want ErrUnsupportedCipher", err)
+	}
+	report, err := Validate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasProblem(report, "keyslot 0", "cannot be unlocked here") {
+		t.Errorf("Validate did not flag the keyslot: %+v", report.Problems)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Keyslot areas are read and written at explicit offsets (pread/pwrite), so
+// no file position is shared between operations. Key material and its zero
+// padding go out in one vectored write where the platform has one.
+
+// keyslotPadding is a block of zeros used as padding after key material. It
+// is shared and never written to.
+var keyslotPadding = make([]byte, 64*1024)
+
+// keyslotBufferPool holds buffers for reading keyslot areas, which are the
+// same few sizes on every unlock attempt
+var keyslotBufferPool sync.Pool // *[]byte
+
+// readKeyslotArea reads size bytes of key material at offset into a pooled
+// buffer. The caller returns it with putKeyslotBuffer.
+func readKeyslotArea(r io.ReaderAt, offset, size int64) (*[]byte, error) {
+	buf := getKeyslotBuffer(int(size))
+	if _, err := r.ReadAt(*buf, offset); err != nil {
+		putKeyslotBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// getKeyslotBuffer returns a buffer of n bytes, reusing a pooled one when it
+// is large enough
+func getKeyslotBuffer(n int) *[]byte {
+	if buf, ok := keyslotBufferPool.Get().(*[]byte); ok && cap(*buf) >= n {
+		*buf = (*buf)[:n]
+		return buf
+	}
+	buf := make([]byte, n)
+	return &buf
+}
+
+// putKeyslotBuffer clears a buffer and returns it to the pool
+func putKeyslotBuffer(buf *[]byte) {
+	clearBytes((*buf)[:cap(*buf)])
+	keyslotBufferPool.Put(buf)
+}
+
+// writeKeyslotArea writes material at offset followed by zeros up to
+// areaSize, overwriting the whole area. A nil material wipes the area.
+func writeKeyslotArea(f *os.File, offset int64, material []byte, areaSize int64) error {
+	if int64(len(material)) > areaSize {
+		return fmt.Errorf("%d bytes of key material do not fit a %d-byte keyslot area", len(material), areaSize)
+	}
+
+	iovs := make([][]byte, 0, 2+(areaSize-int64(len(material)))/int64(len(keyslotPadding)))
+	if len(material) > 0 {
+		iovs = append(iovs, material)
+	}
+	for remaining := areaSize - int64(len(material)); remaining > 0; {
+		n := min(remaining, int64(len(keyslotPadding)))
+		iovs = append(iovs, keyslotPadding[:n])
+		remaining -= n
+	}
+	return writeVectored(f, iovs, offset)
+}
+
+// advanceIovecs drops the first n written bytes from iovs
+func advanceIovecs(iovs [][]byte, n int) [][]byte {
+	for len(iovs) > 0 && n >= len(iovs[0]) {
+		n -= len(iovs[0])
+		iovs = iovs[1:]
+	}
+	if len(iovs) > 0 && n > 0 {
+		iovs[0] = iovs[0][n:]
+	}
+	return iovs
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIovecs is the most buffers one pwritev call takes (IOV_MAX)
+const maxIovecs = 1024
+
+// writeVectored writes iovs back to back at offset with pwritev, retrying
+// short writes
+func writeVectored(f *os.File, iovs [][]byte, offset int64) error {
+	fd := int(f.Fd()) // #nosec G115 - fd fits in int
+	for len(iovs) > 0 {
+		n, err := unix.Pwritev(fd, iovs[:min(len(iovs), maxIovecs)], offset)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		offset += int64(n)
+		iovs = advanceIovecs(iovs, n)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package luks2
+
+import "os"
+
+// writeVectored writes iovs back to back at offset, one pwrite each
+func writeVectored(f *os.File, iovs [][]byte, offset int64) error {
+	for _, iov := range iovs {
+		if _, err := f.WriteAt(iov, offset); err != nil {
+			return err
+		}
+		offset += int64(len(iov))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// keyslotTestFile returns an open file of size bytes filled with 0xFF
+func keyslotTestFile(t testing.TB, size int) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keyslots")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xFF}, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0600) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// TestWriteKeyslotArea tests writing key material with padding and wiping
+func TestWriteKeyslotArea(t *testing.T) {
+	const offset, areaSize = 4096, 258048 // 64-byte key, 4000 stripes, aligned
+	f := keyslotTestFile(t, offset+areaSize+4096)
+
+	material := bytes.Repeat([]byte{0xA5}, 64*AFStripes)
+	if err := writeKeyslotArea(f, offset, material, areaSize); err != nil {
+		t.Fatalf("writeKeyslotArea failed: %v", err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[offset:offset+len(material)], material) {
+		t.Error("key material not written at the area offset")
+	}
+	if !allZero(data[offset+len(material) : offset+areaSize]) {
+		t.Error("the rest of the area is not zero padding")
+	}
+	if data[offset-1] != 0xFF || data[offset+areaSize] != 0xFF {
+		t.Error("bytes outside the area were changed")
+	}
+
+	// nil material wipes the whole area
+	if err := writeKeyslotArea(f, offset, nil, areaSize); err != nil {
+		t.Fatalf("wipe failed: %v", err)
+	}
+	data, _ = os.ReadFile(f.Name())
+	if !allZero(data[offset : offset+areaSize]) {
+		t.Error("area not wiped")
+	}
+
+	if err := writeKeyslotArea(f, offset, material, int64(len(material)-1)); err == nil {
+		t.Error("expected an error for material larger than the area")
+	}
+}
+
+// TestReadKeyslotArea tests reading into pooled buffers
+func TestReadKeyslotArea(t *testing.T) {
+	f := keyslotTestFile(t, 8192)
+
+	buf, err := readKeyslotArea(f, 1024, 4096)
+	if err != nil {
+		t.Fatalf("readKeyslotArea failed: %v", err)
+	}
+	if len(*buf) != 4096 || !bytes.Equal(*buf, bytes.Repeat([]byte{0xFF}, 4096)) {
+		t.Fatalf("read %d bytes with unexpected contents", len(*buf))
+	}
+	data := (*buf)[:cap(*buf)]
+	putKeyslotBuffer(buf)
+	if !allZero(data) {
+		t.Error("buffer not cleared when returned to the pool")
+	}
+
+	if _, err := readKeyslotArea(f, 8000, 4096); err == nil {
+		t.Error("expected an error reading past the end")
+	}
+}
+
+// TestAdvanceIovecs tests dropping written bytes after a short write
+func TestAdvanceIovecs(t *testing.T) {
+	iovs := [][]byte{[]byte("abc"), []byte("de"), []byte("fghi")}
+	iovs = advanceIovecs(iovs, 4)
+	if len(iovs) != 2 || string(iovs[0]) != "e" || string(iovs[1]) != "fghi" {
+		t.Fatalf("after 4 bytes: %q", iovs)
+	}
+	iovs = advanceIovecs(iovs, 1)
+	if len(iovs) != 1 || string(iovs[0]) != "fghi" {
+		t.Fatalf("after 5 bytes: %q", iovs)
+	}
+	if iovs = advanceIovecs(iovs, 4); len(iovs) != 0 {
+		t.Fatalf("after all bytes: %q", iovs)
+	}
+}
+
+// BenchmarkKeyslotAreaWrite compares one vectored write of key material
+// and padding with a seek, a write and a freshly allocated padding write
+func BenchmarkKeyslotAreaWrite(b *testing.B) {
+	const areaSize = 258048
+	material := bytes.Repeat([]byte{0xA5}, 64*AFStripes)
+
+	b.Run("vectored", func(b *testing.B) {
+		f := keyslotTestFile(b, areaSize)
+		b.SetBytes(areaSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			if err := writeKeyslotArea(f, 0, material, areaSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("seek_write", func(b *testing.B) {
+		f := keyslotTestFile(b, areaSize)
+		b.SetBytes(areaSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := f.Seek(0, 0); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := f.Write(material); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := f.Write(make([]byte, areaSize-len(material))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkKeyslotAreaRead compares pooled and freshly allocated buffers
+// for reading a keyslot area, as every unlock attempt does
+func BenchmarkKeyslotAreaRead(b *testing.B) {
+	const areaSize = 258048
+	f := keyslotTestFile(b, areaSize)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.SetBytes(areaSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			buf, err := readKeyslotArea(f, 0, areaSize)
+			if err != nil {
+				b.Fatal(err)
+			}
+			putKeyslotBuffer(buf)
+		}
+	})
+
+	b.Run("alloc", func(b *testing.B) {
+		b.SetBytes(areaSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := make([]byte, areaSize)
+			if _, err := f.ReadAt(buf, 0); err != nil {
+				b.Fatal(err)
+			}
+			clearBytes(buf)
+		}
+	})
+}
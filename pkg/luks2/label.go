@@ -0,0 +1,62 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxLabelLength is the maximum length in bytes of the volume label and the
+// subsystem label. Both header fields are 48 bytes and NUL-terminated.
+const MaxLabelLength = 47
+
+// validateHeaderLabel checks that a label fits its binary header field
+func validateHeaderLabel(label string) error {
+	if len(label) > MaxLabelLength || strings.ContainsRune(label, 0) {
+		return fmt.Errorf("%w: %q", ErrInvalidLabel, label)
+	}
+	return nil
+}
+
+// SetLabel replaces the volume label and subsystem label, equivalent to
+// cryptsetup config --label --subsystem. An empty string clears a label.
+// Only the binary headers change; both copies are rewritten under the
+// device lock.
+func SetLabel(device, label, subsystem string) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if err := validateHeaderLabel(label); err != nil {
+		return err
+	}
+	if err := validateHeaderLabel(subsystem); err != nil {
+		return err
+	}
+
+	// Acquire exclusive lock
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	hdr.Label = [48]byte{}
+	copy(hdr.Label[:], label)
+	hdr.SubsystemLabel = [48]byte{}
+	copy(hdr.SubsystemLabel[:], subsystem)
+	hdr.SequenceID++
+
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSetLabel tests renaming, clearing and validating labels
+func TestSetLabel(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	if err := SetLabel(device, "backup-2025", "archive"); err != nil {
+		t.Fatalf("SetLabel failed: %v", err)
+	}
+	info, err := GetVolumeInfo(device)
+	if err != nil {
+		t.Fatalf("GetVolumeInfo failed: %v", err)
+	}
+	if info.Label != "backup-2025" || info.Subsystem != "archive" {
+		t.Errorf("label = %q, subsystem = %q", info.Label, info.Subsystem)
+	}
+
+	// Both header copies carry the update
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NeedsRepair() {
+		t.Errorf("headers out of sync after SetLabel: %+v", status)
+	}
+
+	// A shorter label leaves nothing of the longer one behind
+	if err := SetLabel(device, "db", ""); err != nil {
+		t.Fatalf("SetLabel failed: %v", err)
+	}
+	info, err = GetVolumeInfo(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Label != "db" || info.Subsystem != "" {
+		t.Errorf("label = %q, subsystem = %q", info.Label, info.Subsystem)
+	}
+
+	// Renaming touches no key material
+	if _, err := ExtractVolumeKey(device, passphrase); err != nil {
+		t.Errorf("ExtractVolumeKey failed after SetLabel: %v", err)
+	}
+
+	for _, label := range []string{strings.Repeat("x", MaxLabelLength+1), "a\x00b"} {
+		if err := SetLabel(device, label, ""); !errors.Is(err, ErrInvalidLabel) {
+			t.Errorf("SetLabel(%q): expected ErrInvalidLabel, got %v", label, err)
+		}
+		if err := SetLabel(device, "", label); !errors.Is(err, ErrInvalidLabel) {
+			t.Errorf("SetLabel subsystem %q: expected ErrInvalidLabel, got %v", label, err)
+		}
+	}
+	if err := SetLabel(device, strings.Repeat("x", MaxLabelLength), ""); err != nil {
+		t.Errorf("SetLabel with a %d byte label failed: %v", MaxLabelLength, err)
+	}
+}
+
+// TestFormat_LabelTooLong tests that Format rejects a label that does not
+// fit the header
+func TestFormat_LabelTooLong(t *testing.T) {
+	device := escrowTestImage(t)
+	err := Format(FormatOptions{Device: device, Passphrase: []byte("test-password"), Label: strings.Repeat("x", 48)})
+	if !errors.Is(err, ErrInvalidLabel) {
+		t.Errorf("expected ErrInvalidLabel, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// devRoot is the device node directory (overridable for tests)
+var devRoot = "/dev"
+
+// luks2Identity is the subset of the binary header used to locate volumes
+type luks2Identity struct {
+	UUID  string
+	Label string
+}
+
+// readLUKS2Identity reads the UUID and label from a LUKS2 binary header.
+// Only the fixed-size binary header is read; checksums are not verified.
+func readLUKS2Identity(device string) (*luks2Identity, error) {
+	f, err := os.Open(device) // #nosec G304 -- device path from sysfs scan or caller
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var hdr LUKS2BinaryHeader
+	if err := binary.Read(f, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(hdr.Magic[:], []byte(LUKS2Magic)) || hdr.Version != LUKS2Version {
+		return nil, fmt.Errorf("not a LUKS2 device")
+	}
+
+	return &luks2Identity{
+		UUID:  string(bytes.TrimRight(hdr.UUID[:], "\x00")),
+		Label: string(bytes.TrimRight(hdr.Label[:], "\x00")),
+	}, nil
+}
+
+// FindDeviceByUUID locates the block device holding the LUKS2 volume with
+// the given header UUID. The udev /dev/disk/by-uuid link is used when
+// present; otherwise every block device listed in sysfs is probed, which
+// also works in containers and initramfs environments without udev.
+func FindDeviceByUUID(uuid string) (string, error) {
+	uuid = strings.ToLower(strings.TrimSpace(uuid))
+	if uuid == "" {
+		return "", fmt.Errorf("UUID cannot be empty")
+	}
+
+	// Fast path: udev symlink
+	link := filepath.Join(devRoot, "disk", "by-uuid", uuid)
+	if id, err := readLUKS2Identity(link); err == nil && strings.EqualFold(id.UUID, uuid) {
+		if resolved, err := filepath.EvalSymlinks(link); err == nil {
+			return resolved, nil
+		}
+		return link, nil
+	}
+
+	for _, device := range listBlockDevices() {
+		id, err := readLUKS2Identity(device)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(id.UUID, uuid) {
+			return device, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no LUKS2 volume with UUID %s", ErrDeviceNotFound, uuid)
+}
+
+// listBlockDevices returns device node paths for every non-empty block
+// device known to sysfs
+func listBlockDevices() []string {
+	entries, err := os.ReadDir(filepath.Join(sysfsRoot, "class", "block"))
+	if err != nil {
+		return nil
+	}
+
+	var devices []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// Skip empty devices (unused loop devices, empty optical drives)
+		if readSysfsAttr(filepath.Join(sysfsRoot, "class", "block", name), "size") == "0" {
+			continue
+		}
+		devices = append(devices, filepath.Join(devRoot, name))
+	}
+	return devices
+}
+
+// FindDeviceByLabel locates the block device holding the LUKS2 volume with
+// the given header label. Like FindDeviceByUUID it tries the udev
+// /dev/disk/by-label link first and falls back to probing every block device.
+// Labels are not guaranteed to be unique, so a label shared by several
+// volumes is an error rather than an arbitrary pick.
+func FindDeviceByLabel(label string) (string, error) {
+	if label == "" {
+		return "", fmt.Errorf("label cannot be empty")
+	}
+
+	link := filepath.Join(devRoot, "disk", "by-label", encodeUdevLabel(label))
+	linkTarget := ""
+	if id, err := readLUKS2Identity(link); err == nil && id.Label == label {
+		linkTarget = link
+		if resolved, err := filepath.EvalSymlinks(link); err == nil {
+			linkTarget = resolved
+		}
+	}
+
+	var matches []string
+	for _, device := range listBlockDevices() {
+		id, err := readLUKS2Identity(device)
+		if err != nil || id.Label != label {
+			continue
+		}
+		matches = append(matches, device)
+	}
+
+	switch {
+	case len(matches) > 1:
+		return "", fmt.Errorf("label %q is ambiguous: %s", label, strings.Join(matches, ", "))
+	case len(matches) == 1:
+		return matches[0], nil
+	case linkTarget != "":
+		return linkTarget, nil
+	}
+
+	return "", fmt.Errorf("%w: no LUKS2 volume with label %q", ErrDeviceNotFound, label)
+}
+
+// encodeUdevLabel escapes a label the way udev names /dev/disk/by-label
+// links: bytes outside [A-Za-z0-9#+-.:=@_] become \xNN, except bytes of
+// multi-byte UTF-8 characters which are kept as-is
+func encodeUdevLabel(label string) string {
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("#+-.:=@_", c) >= 0, c >= 0x80:
+			b.WriteByte(c)
+		default:
+			_, _ = fmt.Fprintf(&b, "\\x%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// ResolveDevice turns a device specification into a device path. Besides
+// plain paths it accepts the fstab/crypttab forms UUID=<uuid> and
+// LABEL=<label>.
+func ResolveDevice(spec string) (string, error) {
+	switch {
+	case strings.HasPrefix(spec, "UUID="):
+		return FindDeviceByUUID(strings.TrimPrefix(spec, "UUID="))
+	case strings.HasPrefix(spec, "LABEL="):
+		return FindDeviceByLabel(strings.TrimPrefix(spec, "LABEL="))
+	}
+	return spec, nil
+}
+
+// UnlockByUUID unlocks the LUKS2 volume with the given header UUID as name
+func UnlockByUUID(uuid string, passphrase []byte, name string) error {
+	device, err := FindDeviceByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	return Unlock(device, passphrase, name)
+}
+
+// UnlockByLabel unlocks the LUKS2 volume with the given header label as name
+func UnlockByLabel(label string, passphrase []byte, name string) error {
+	device, err := FindDeviceByLabel(label)
+	if err != nil {
+		return err
+	}
+	return Unlock(device, passphrase, name)
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBlockRoots points sysfsRoot and devRoot at temporary directories
+func fakeBlockRoots(t *testing.T) (sys, dev string) {
+	t.Helper()
+	sys, dev = t.TempDir(), t.TempDir()
+	oldSys, oldDev := sysfsRoot, devRoot
+	sysfsRoot, devRoot = sys, dev
+	t.Cleanup(func() { sysfsRoot, devRoot = oldSys, oldDev })
+	return sys, dev
+}
+
+// addFakeBlockDevice creates a sysfs entry and a device node file holding data
+func addFakeBlockDevice(t *testing.T, sys, dev, name, size string, data []byte) string {
+	t.Helper()
+	makeSysfsDevice(t, sys, filepath.Join("class", "block", name), map[string]string{"size": size})
+	path := filepath.Join(dev, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write device %s: %v", name, err)
+	}
+	return path
+}
+
+// fakeLUKS2Header returns a serialized binary header and its UUID
+func fakeLUKS2Header(t *testing.T, label string) ([]byte, string) {
+	t.Helper()
+	hdr, err := CreateBinaryHeader(FormatOptions{Label: label})
+	if err != nil {
+		t.Fatalf("CreateBinaryHeader failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, hdr); err != nil {
+		t.Fatalf("Failed to serialize header: %v", err)
+	}
+	return buf.Bytes(), string(bytes.TrimRight(hdr.UUID[:], "\x00"))
+}
+
+// TestReadLUKS2Identity tests reading UUID and label from a binary header
+func TestReadLUKS2Identity(t *testing.T) {
+	data, uuid := fakeLUKS2Header(t, "data")
+	path := filepath.Join(t.TempDir(), "hdr")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := readLUKS2Identity(path)
+	if err != nil {
+		t.Fatalf("readLUKS2Identity failed: %v", err)
+	}
+	if id.UUID != uuid || id.Label != "data" {
+		t.Errorf("Unexpected identity: %+v", id)
+	}
+
+	if err := os.WriteFile(path, make([]byte, 4096), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readLUKS2Identity(path); err == nil {
+		t.Error("Expected error for non-LUKS data")
+	}
+}
+
+// TestFindDeviceByUUID_Scan tests locating a volume by scanning sysfs
+func TestFindDeviceByUUID_Scan(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+
+	data, uuid := fakeLUKS2Header(t, "")
+	other, _ := fakeLUKS2Header(t, "")
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", make([]byte, 4096))
+	addFakeBlockDevice(t, sys, dev, "sdb", "2048", other)
+	want := addFakeBlockDevice(t, sys, dev, "sdc", "2048", data)
+	// Empty device with a matching header must be skipped
+	addFakeBlockDevice(t, sys, dev, "loop0", "0", data)
+
+	got, err := FindDeviceByUUID(strings.ToUpper(uuid))
+	if err != nil {
+		t.Fatalf("FindDeviceByUUID failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestFindDeviceByUUID_ByUUIDLink tests the udev symlink fast path
+func TestFindDeviceByUUID_ByUUIDLink(t *testing.T) {
+	_, dev := fakeBlockRoots(t)
+
+	data, uuid := fakeLUKS2Header(t, "")
+	target := filepath.Join(dev, "vdb")
+	if err := os.WriteFile(target, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dev, "disk", "by-uuid"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dev, "disk", "by-uuid", uuid)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindDeviceByUUID(uuid)
+	if err != nil {
+		t.Fatalf("FindDeviceByUUID failed: %v", err)
+	}
+	if got != target {
+		t.Errorf("Expected %s, got %s", target, got)
+	}
+}
+
+// TestFindDeviceByUUID_NotFound tests the not-found and invalid-input errors
+func TestFindDeviceByUUID_NotFound(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", make([]byte, 4096))
+
+	if _, err := FindDeviceByUUID("00000000-0000-0000-0000-000000000000"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+	if _, err := FindDeviceByUUID("  "); err == nil {
+		t.Error("Expected error for empty UUID")
+	}
+}
+
+// TestFindDeviceByLabel tests locating a volume by header label
+func TestFindDeviceByLabel(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+
+	data, _ := fakeLUKS2Header(t, "backup")
+	other, _ := fakeLUKS2Header(t, "root")
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", other)
+	want := addFakeBlockDevice(t, sys, dev, "sdb", "2048", data)
+
+	got, err := FindDeviceByLabel("backup")
+	if err != nil {
+		t.Fatalf("FindDeviceByLabel failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if _, err := FindDeviceByLabel("missing"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+	if _, err := FindDeviceByLabel(""); err == nil {
+		t.Error("Expected error for empty label")
+	}
+
+	// A second volume with the same label makes the lookup ambiguous
+	dup, _ := fakeLUKS2Header(t, "backup")
+	addFakeBlockDevice(t, sys, dev, "sdc", "2048", dup)
+	if _, err := FindDeviceByLabel("backup"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous label error, got %v", err)
+	}
+}
+
+// TestFindDeviceByLabel_ByLabelLink tests the udev symlink with an escaped label
+func TestFindDeviceByLabel_ByLabelLink(t *testing.T) {
+	_, dev := fakeBlockRoots(t)
+
+	data, _ := fakeLUKS2Header(t, "my data")
+	target := filepath.Join(dev, "vdb")
+	if err := os.WriteFile(target, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dev, "disk", "by-label"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dev, "disk", "by-label", `my\x20data`)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindDeviceByLabel("my data")
+	if err != nil {
+		t.Fatalf("FindDeviceByLabel failed: %v", err)
+	}
+	if got != target {
+		t.Errorf("Expected %s, got %s", target, got)
+	}
+}
+
+// TestEncodeUdevLabel tests udev's by-label escaping
+func TestEncodeUdevLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"data", "data"},
+		{"my data", `my\x20data`},
+		{"a/b", `a\x2fb`},
+		{"v1.0_x-y:z", "v1.0_x-y:z"},
+		{"données", "données"},
+	}
+	for _, tt := range tests {
+		if got := encodeUdevLabel(tt.label); got != tt.want {
+			t.Errorf("encodeUdevLabel(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+// TestResolveDevice tests UUID=, LABEL= and plain path specifications
+func TestResolveDevice(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	data, uuid := fakeLUKS2Header(t, "vault")
+	want := addFakeBlockDevice(t, sys, dev, "sda", "2048", data)
+
+	for _, spec := range []string{"UUID=" + uuid, "LABEL=vault"} {
+		got, err := ResolveDevice(spec)
+		if err != nil {
+			t.Fatalf("ResolveDevice(%q) failed: %v", spec, err)
+		}
+		if got != want {
+			t.Errorf("ResolveDevice(%q) = %s, want %s", spec, got, want)
+		}
+	}
+
+	if got, err := ResolveDevice("/dev/sdz"); err != nil || got != "/dev/sdz" {
+		t.Errorf("ResolveDevice(path) = %s, %v", got, err)
+	}
+	if _, err := ResolveDevice("LABEL=none"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
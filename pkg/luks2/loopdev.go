@@ -7,51 +7,308 @@
 package luks2
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"golang.org/x/sys/unix"
 )
 
+// loopMajor is the block device major number of loop devices
+const loopMajor = 7
+
+// loopSetupAttempts bounds retries when another process claims the free
+// loop device between LOOP_CTL_GET_FREE and attaching to it
+const loopSetupAttempts = 5
+
+// LoopOptions controls how SetupLoopDeviceWithOptions attaches a file
+type LoopOptions struct {
+	// ReadOnly attaches the file read-only (LO_FLAGS_READ_ONLY). The file is
+	// opened read-only, so images without write permission can be attached.
+	ReadOnly bool
+
+	// PartScan makes the kernel scan the file for a partition table and
+	// create /dev/loopNpM nodes for its partitions (LO_FLAGS_PARTSCAN)
+	PartScan bool
+
+	// Offset is the byte offset in the file at which the loop device starts
+	// (lo_offset)
+	Offset int64
+
+	// SizeLimit is the size of the loop device in bytes (lo_sizelimit; 0 =
+	// to the end of the file)
+	SizeLimit int64
+}
+
 // SetupLoopDevice creates a loop device for a file
 func SetupLoopDevice(file string) (string, error) {
-	// Open the backing file read-write
-	backingFile, err := os.OpenFile(file, os.O_RDWR, 0) // #nosec G304 -- user-provided file path for disk image
+	return SetupLoopDeviceWithOptions(file, nil)
+}
+
+// SetupLoopDeviceWithOptions attaches a file to a free loop device using the
+// given options (nil = read-write, no partition scan) and returns the loop
+// device path.
+func SetupLoopDeviceWithOptions(file string, opts *LoopOptions) (string, error) {
+	if opts == nil {
+		opts = &LoopOptions{}
+	}
+
+	flag := os.O_RDWR
+	var info unix.LoopInfo64
+	if opts.ReadOnly {
+		flag = os.O_RDONLY
+		info.Flags |= unix.LO_FLAGS_READ_ONLY
+	}
+	if opts.PartScan {
+		info.Flags |= unix.LO_FLAGS_PARTSCAN
+	}
+	if opts.Offset < 0 || opts.SizeLimit < 0 {
+		return "", fmt.Errorf("%w: negative loop offset or size limit", ErrInvalidSize)
+	}
+	info.Offset = uint64(opts.Offset)       // #nosec G115 -- checked non-negative
+	info.Sizelimit = uint64(opts.SizeLimit) // #nosec G115 -- checked non-negative
+
+	// Open the backing file
+	backingFile, err := os.OpenFile(file, flag, 0) // #nosec G304 -- user-provided file path for disk image
 	if err != nil {
 		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() { _ = backingFile.Close() }()
 
+	if abs, err := filepath.Abs(file); err == nil {
+		copy(info.File_name[:len(info.File_name)-1], abs)
+	}
+
 	// Open loop control to get free device
 	loopControl, err := os.OpenFile("/dev/loop-control", os.O_RDWR, 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to open loop-control: %w", err)
+		return "", fmt.Errorf("failed to open loop-control: %w", privilegeError("loop device setup", true, err))
 	}
 	defer func() { _ = loopControl.Close() }()
 
-	// Get free loop device number
-	devNum, _, errno := unix.Syscall(unix.SYS_IOCTL, loopControl.Fd(), unix.LOOP_CTL_GET_FREE, 0)
-	if errno != 0 {
-		return "", fmt.Errorf("LOOP_CTL_GET_FREE failed: %v", errno)
-	}
+	for attempt := 1; ; attempt++ {
+		// Get free loop device number
+		devNum, _, errno := unix.Syscall(unix.SYS_IOCTL, loopControl.Fd(), unix.LOOP_CTL_GET_FREE, 0)
+		if errno != 0 {
+			return "", fmt.Errorf("LOOP_CTL_GET_FREE failed: %v", errno)
+		}
 
-	loopDevice := fmt.Sprintf("/dev/loop%d", devNum)
+		loopDevice := fmt.Sprintf("/dev/loop%d", devNum)
+		err := attachLoopDevice(loopDevice, backingFile, info)
+		if errors.Is(err, unix.EBUSY) && attempt < loopSetupAttempts {
+			// Lost the race for this device; ask for another one
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return loopDevice, nil
+	}
+}
 
-	// Open loop device
+// attachLoopDevice binds backingFile to a loop device with LOOP_CONFIGURE,
+// falling back to LOOP_SET_FD and LOOP_SET_STATUS64 on kernels before 5.8
+func attachLoopDevice(loopDevice string, backingFile *os.File, info unix.LoopInfo64) error {
 	loopFile, err := os.OpenFile(loopDevice, os.O_RDWR, 0) // #nosec G304 -- loop device path constructed from kernel
 	if err != nil {
-		return "", fmt.Errorf("failed to open %s: %w", loopDevice, err)
+		return fmt.Errorf("failed to open %s: %w", loopDevice, err)
 	}
 	defer func() { _ = loopFile.Close() }()
 
+	fd := int(loopFile.Fd())              // #nosec G115 - fd fits in int
+	backingFd := uint32(backingFile.Fd()) // #nosec G115 - fd fits in uint32
+	err = unix.IoctlLoopConfigure(fd, &unix.LoopConfig{Fd: backingFd, Info: info})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOTTY) {
+		return fmt.Errorf("LOOP_CONFIGURE failed: %w", err)
+	}
+
 	// Attach backing file to loop device
-	_, _, errno = unix.Syscall(unix.SYS_IOCTL, loopFile.Fd(), unix.LOOP_SET_FD, backingFile.Fd())
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, loopFile.Fd(), unix.LOOP_SET_FD, backingFile.Fd())
 	if errno != 0 {
-		return "", fmt.Errorf("LOOP_SET_FD failed: %v", errno)
+		return fmt.Errorf("LOOP_SET_FD failed: %w", errno)
+	}
+	if info.Flags&^unix.LO_FLAGS_READ_ONLY != 0 {
+		// LOOP_SET_FD derives read-only from the file mode; the other flags
+		// need a separate status update
+		if err := unix.IoctlLoopSetStatus64(fd, &info); err != nil {
+			_, _, _ = unix.Syscall(unix.SYS_IOCTL, loopFile.Fd(), unix.LOOP_CLR_FD, 0)
+			return fmt.Errorf("LOOP_SET_STATUS64 failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setLoopAutoclear sets LO_FLAGS_AUTOCLEAR on a loop device, so the kernel
+// detaches it as soon as its last user closes it. Setting it before anything
+// holds the device open would detach it immediately.
+func setLoopAutoclear(device string) error {
+	loopFile, err := os.OpenFile(device, os.O_RDONLY, 0) // #nosec G304 -- loop device path from the unlocked mapping
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", device, err)
 	}
+	defer func() { _ = loopFile.Close() }()
 
-	return loopDevice, nil
+	fd := int(loopFile.Fd()) // #nosec G115 - fd fits in int
+	info, err := unix.IoctlLoopGetStatus64(fd)
+	if err != nil {
+		return fmt.Errorf("LOOP_GET_STATUS64 failed: %w", err)
+	}
+	if info.Flags&unix.LO_FLAGS_AUTOCLEAR != 0 {
+		return nil
+	}
+	info.Flags |= unix.LO_FLAGS_AUTOCLEAR
+	if err := unix.IoctlLoopSetStatus64(fd, info); err != nil {
+		return fmt.Errorf("LOOP_SET_STATUS64 failed: %w", err)
+	}
+
+	return nil
+}
+
+// isLoopDevice reports whether path is a loop block device
+func isLoopDevice(path string) bool {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false
+	}
+	return st.Mode&unix.S_IFMT == unix.S_IFBLK && unix.Major(uint64(st.Rdev)) == loopMajor // #nosec G115 - Rdev is a kernel device number
+}
+
+// loopDeviceOf returns the loop device path is, or whose partition it is
+// (/dev/loop0 for /dev/loop0p1), or "" for any other device. Loop
+// partitions have the extended major, so they are found through sysfs.
+func loopDeviceOf(path string) string {
+	if isLoopDevice(path) {
+		return path
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil || st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return ""
+	}
+	dev := uint64(st.Rdev) // #nosec G115 - Rdev is a kernel device number
+	sysDir, err := sysfsDeviceDir(unix.Major(dev), unix.Minor(dev))
+	if err != nil || readSysfsAttr(sysDir, "partition") == "" {
+		return ""
+	}
+	parent := filepath.Join(devRoot, filepath.Base(filepath.Dir(sysDir)))
+	if !isLoopDevice(parent) {
+		return ""
+	}
+	return parent
+}
+
+// SplitPartitionSpec splits a partition of an image file, "disk.img:2",
+// into the file and the partition number. ok is false for anything else:
+// no ":N" suffix, N below 1, a file that is not a regular file, or a spec
+// that exists as a path of its own (a file name containing ":2").
+func SplitPartitionSpec(spec string) (file string, partition int, ok bool) {
+	i := strings.LastIndexByte(spec, ':')
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(spec[i+1:])
+	if err != nil || n < 1 {
+		return "", 0, false
+	}
+	if _, err := os.Stat(spec); err == nil {
+		return "", 0, false
+	}
+	if fi, err := os.Stat(spec[:i]); err != nil || !fi.Mode().IsRegular() {
+		return "", 0, false
+	}
+	return spec[:i], n, true
+}
+
+// SetupLoopPartition attaches file to a loop device with its partitions
+// scanned (PartScan is implied) and returns the loop device and the node of
+// its partition-th partition, e.g. /dev/loop0 and /dev/loop0p1, once the
+// node exists. An image without that partition is detached again and
+// reported as ErrDeviceNotFound. Detach the loop device, not the
+// partition, when done.
+func SetupLoopPartition(file string, partition int, opts *LoopOptions) (loop, device string, err error) {
+	scan := LoopOptions{PartScan: true}
+	if opts != nil {
+		scan.ReadOnly = opts.ReadOnly
+	}
+	if loop, err = SetupLoopDeviceWithOptions(file, &scan); err != nil {
+		return "", "", err
+	}
+
+	// The kernel has read the partition table by the time the loop device
+	// is configured; only the device node may still be on its way
+	name := fmt.Sprintf("%sp%d", filepath.Base(loop), partition)
+	device = filepath.Join(devRoot, name)
+	if _, err := os.Stat(filepath.Join(sysfsRoot, "block", filepath.Base(loop), name)); err != nil {
+		_ = DetachLoopDevice(loop)
+		return "", "", fmt.Errorf("%w: %s has no partition %d", ErrDeviceNotFound, file, partition)
+	}
+	if !waitForPath(devRoot, func() bool { return isDeviceNode(device) }, udevWaitTimeout) {
+		_ = DetachLoopDevice(loop)
+		return "", "", fmt.Errorf("%w: %s did not appear", ErrDeviceNotFound, device)
+	}
+	return loop, device, nil
+}
+
+// setupRegionLoop attaches the byte range of device starting at offset and
+// size bytes long (0 = to the end) to a loop device. A range running past
+// the end of device is refused rather than silently shortened.
+func setupRegionLoop(device string, offset, size int64) (string, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return "", err
+	}
+	if err := validateRegion(offset, size); err != nil {
+		return "", err
+	}
+	loop, err := SetupLoopDeviceWithOptions(device, &LoopOptions{Offset: offset, SizeLimit: size})
+	if err != nil {
+		return "", err
+	}
+	got, err := getBlockDeviceSize(loop)
+	if err == nil && (got == 0 || (size != 0 && got != size)) {
+		err = fmt.Errorf("%w: region at offset %d of %d bytes does not fit in %s", ErrInvalidSize, offset, size, device)
+	}
+	if err != nil {
+		_ = DetachLoopDevice(loop)
+		return "", err
+	}
+	return loop, nil
+}
+
+// formatRegion formats the byte range of opts.Device given by opts.Offset
+// and opts.Size through a loop device over it
+func formatRegion(opts FormatOptions) error {
+	loop, err := setupRegionLoop(opts.Device, opts.Offset, opts.Size)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = DetachLoopDevice(loop) }()
+
+	opts.Device, opts.Offset, opts.Size = loop, 0, 0
+	return Format(opts)
+}
+
+// unlockRegion unlocks the byte range of device given by opts.Offset and
+// opts.Size: unlock is called with a loop device over the range, which
+// detaches itself when the mapping is locked
+func unlockRegion(device string, opts *UnlockOptions, unlock func(loop string, opts *UnlockOptions) error) error {
+	loop, err := setupRegionLoop(device, opts.Offset, opts.Size)
+	if err != nil {
+		return err
+	}
+
+	region := *opts
+	region.Offset, region.Size, region.AutoDetachLoop = 0, 0, true
+	if err := unlock(loop, &region); err != nil {
+		_ = DetachLoopDevice(loop)
+		return err
+	}
+	return nil
 }
 
 // DetachLoopDevice detaches a loop device
@@ -71,47 +328,56 @@ func DetachLoopDevice(device string) error {
 	return nil
 }
 
-// FindLoopDevice finds the loop device for a given file by reading /sys
+// FindLoopDevice returns the loop device a file is attached to, found by
+// comparing the backing_file each loop device reports in sysfs. It returns
+// ErrDeviceNotFound when the file is not attached.
 func FindLoopDevice(file string) (string, error) {
 	absFile, err := filepath.Abs(file)
 	if err != nil {
 		return "", err
 	}
+	// The kernel reports the canonical path of the backing file
+	if resolved, err := filepath.EvalSymlinks(absFile); err == nil {
+		absFile = resolved
+	}
 
-	// Read /sys/block to find loop devices
-	entries, err := os.ReadDir("/sys/block")
+	blockDir := filepath.Join(sysfsRoot, "block")
+	entries, err := os.ReadDir(blockDir)
 	if err != nil {
 		return "", err
 	}
 
 	for _, entry := range entries {
 		name := entry.Name()
-		if len(name) < 4 || name[:4] != "loop" {
+		if !strings.HasPrefix(name, "loop") {
 			continue
 		}
 
-		// Read backing_file
-		backingFilePath := fmt.Sprintf("/sys/block/%s/loop/backing_file", name)
-		data, err := os.ReadFile(backingFilePath) // #nosec G304 -- sysfs path constructed from known prefix
+		data, err := os.ReadFile(filepath.Join(blockDir, name, "loop", "backing_file")) // #nosec G304 -- sysfs path constructed from known prefix
 		if err != nil {
 			continue
 		}
 
-		// Trim newline
-		backingFile := string(data)
-		if len(backingFile) > 0 && backingFile[len(backingFile)-1] == '\n' {
-			backingFile = backingFile[:len(backingFile)-1]
+		if strings.TrimSuffix(string(data), "\n") == absFile {
+			return filepath.Join(devRoot, name), nil
 		}
+	}
 
-		absBackingFile, err := filepath.Abs(backingFile)
-		if err != nil {
-			continue
-		}
+	return "", fmt.Errorf("%w: no loop device found for %s", ErrDeviceNotFound, file)
+}
 
-		if absFile == absBackingFile {
-			return "/dev/" + name, nil
-		}
+// refreshLoopCapacity makes a loop device pick up its backing file's new size
+func refreshLoopCapacity(device string) error {
+	loopFile, err := os.OpenFile(device, os.O_RDWR, 0) // #nosec G304 -- loop device path from SetupLoopDevice
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", device, err)
+	}
+	defer func() { _ = loopFile.Close() }()
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, loopFile.Fd(), unix.LOOP_SET_CAPACITY, 0)
+	if errno != 0 {
+		return fmt.Errorf("LOOP_SET_CAPACITY failed: %v", errno)
 	}
 
-	return "", fmt.Errorf("no loop device found for %s", file)
+	return nil
 }
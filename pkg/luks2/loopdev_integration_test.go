@@ -7,6 +7,8 @@
 package luks2
 
 import (
+	"encoding/binary"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -54,6 +56,98 @@ func TestSetupLoopDevice(t *testing.T) {
 	t.Logf("Loop device verified successfully")
 }
 
+// TestSetupLoopDeviceWithOptions tests read-only and partition-scanning loop devices
+func TestSetupLoopDeviceWithOptions(t *testing.T) {
+	tmpfile := filepath.Join(t.TempDir(), "test-loop-opts.img")
+	if err := os.WriteFile(tmpfile, make([]byte, 10*1024*1024), 0400); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	loopDev, err := SetupLoopDeviceWithOptions(tmpfile, &LoopOptions{ReadOnly: true, PartScan: true})
+	if err != nil {
+		t.Fatalf("SetupLoopDeviceWithOptions failed: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	name := filepath.Base(loopDev)
+	if ro, err := os.ReadFile(filepath.Join("/sys/block", name, "ro")); err != nil || strings.TrimSpace(string(ro)) != "1" {
+		t.Errorf("Expected %s to be read-only, got %q (%v)", loopDev, ro, err)
+	}
+	if scan, err := os.ReadFile(filepath.Join("/sys/block", name, "loop", "partscan")); err != nil || strings.TrimSpace(string(scan)) != "1" {
+		t.Errorf("Expected partition scanning on %s, got %q (%v)", loopDev, scan, err)
+	}
+
+	found, err := FindLoopDevice(tmpfile)
+	if err != nil || found != loopDev {
+		t.Errorf("FindLoopDevice() = %s, %v; want %s", found, err, loopDev)
+	}
+}
+
+// TestSetupLoopPartition formats, unlocks and locks a LUKS partition of an
+// image with an MBR partition table
+func TestSetupLoopPartition(t *testing.T) {
+	// One Linux partition from sector 2048 to the end of a 40 MiB image
+	const sectors = 40 * 2048
+	image := make([]byte, sectors*512)
+	entry := image[446:]
+	entry[4] = 0x83
+	binary.LittleEndian.PutUint32(entry[8:], 2048)
+	binary.LittleEndian.PutUint32(entry[12:], sectors-2048)
+	copy(image[510:], "\x55\xaa")
+	tmpfile := filepath.Join(t.TempDir(), "partitioned.img")
+	if err := os.WriteFile(tmpfile, image, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if _, _, err := SetupLoopPartition(tmpfile, 2, nil); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("SetupLoopPartition(2) error = %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := FindLoopDevice(tmpfile); err == nil {
+		t.Error("Expected the loop device to be detached after a missing partition")
+	}
+
+	loopDev, partDev, err := SetupLoopPartition(tmpfile, 1, nil)
+	if err != nil {
+		t.Fatalf("SetupLoopPartition failed: %v", err)
+	}
+	if partDev != loopDev+"p1" {
+		t.Fatalf("Expected partition %sp1, got %s", loopDev, partDev)
+	}
+	if got := loopDeviceOf(partDev); got != loopDev {
+		t.Errorf("loopDeviceOf(%s) = %q, want %s", partDev, got, loopDev)
+	}
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{Device: partDev, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		DetachLoopDevice(loopDev)
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	// The partition's loop device goes away with the mapping
+	name := "test-loop-partition"
+	if err := UnlockWithOptions(partDev, passphrase, name, &UnlockOptions{AutoDetachLoop: true}); err != nil {
+		DetachLoopDevice(loopDev)
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if err := Lock(name); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, err := FindLoopDevice(tmpfile); err == nil {
+		t.Error("Expected the loop device to be detached after Lock")
+	}
+
+	// The header was written at the partition's offset in the image
+	f, err := os.Open(tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	magic := make([]byte, LUKS2MagicLen)
+	if _, err := f.ReadAt(magic, 2048*512); err != nil || string(magic) != LUKS2Magic {
+		t.Errorf("Expected a LUKS header at the partition offset, got %q (%v)", magic, err)
+	}
+}
+
 // TestSetupLoopDeviceErrors tests error conditions when setting up loop devices
 func TestSetupLoopDeviceErrors(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFindLoopDevice_Sysfs tests matching backing files reported by sysfs
+func TestFindLoopDevice_Sysfs(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "volume.luks")
+	if err := os.WriteFile(image, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.luks")
+	if err := os.Symlink(image, link); err != nil {
+		t.Fatal(err)
+	}
+
+	makeSysfsDevice(t, sys, filepath.Join("block", "loop0"), map[string]string{"loop/backing_file": filepath.Join(dir, "other.img")})
+	makeSysfsDevice(t, sys, filepath.Join("block", "loop3"), map[string]string{"loop/backing_file": image})
+	makeSysfsDevice(t, sys, filepath.Join("block", "sda"), nil)
+
+	for _, path := range []string{image, link} {
+		got, err := FindLoopDevice(path)
+		if err != nil {
+			t.Fatalf("FindLoopDevice(%s) failed: %v", path, err)
+		}
+		if want := filepath.Join(dev, "loop3"); got != want {
+			t.Errorf("FindLoopDevice(%s) = %s, want %s", path, got, want)
+		}
+	}
+
+	if _, err := FindLoopDevice(filepath.Join(dir, "missing.img")); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+// TestIsLoopDevice tests rejecting paths that are not loop devices
+func TestIsLoopDevice(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, "/dev/null", filepath.Join(t.TempDir(), "missing")} {
+		if isLoopDevice(path) {
+			t.Errorf("isLoopDevice(%s) = true", path)
+		}
+	}
+}
+
+func TestSplitPartitionSpec(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "disk.img")
+	colon := filepath.Join(dir, "odd.img:2")
+	for _, path := range []string{image, colon} {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, n, ok := SplitPartitionSpec(image + ":3")
+	if !ok || file != image || n != 3 {
+		t.Errorf("SplitPartitionSpec(%s:3) = %q, %d, %v", image, file, n, ok)
+	}
+	for _, spec := range []string{
+		image,                            // no partition
+		image + ":0",                     // partitions count from 1
+		image + ":p1",                    // not a number
+		colon,                            // an existing file named like a spec
+		filepath.Join(dir, "none.img:1"), // no such image
+		dir + ":1",                       // not a regular file
+		":1",
+	} {
+		if _, _, ok := SplitPartitionSpec(spec); ok {
+			t.Errorf("SplitPartitionSpec(%s) accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// DefaultRegistryPath is where VolumeManager records the volumes it opened.
+// /run is a tmpfs, so the registry is cleared on reboot together with the
+// mappings and loop devices it describes.
+const DefaultRegistryPath = "/run/luks2/volumes.json"
+
+// ManagedVolume is the registry entry of a volume opened by VolumeManager
+type ManagedVolume struct {
+	Name       string    `json:"name"`                  // Device-mapper name
+	Device     string    `json:"device"`                // Device or image file that was opened
+	LoopDevice string    `json:"loop_device,omitempty"` // Loop device attached for an image file
+	MountPoint string    `json:"mount_point,omitempty"` // Where the volume is mounted, if anywhere
+	Opened     time.Time `json:"opened"`
+}
+
+// VolumeManager opens, mounts and closes volumes while recording what it set
+// up for each one (loop device, mapping, mount point) in a registry file.
+// Every operation is idempotent, and the registry lets Close tear a volume
+// down by name from another process and GC clean up after crashes. The
+// registry is locked while it is updated, so concurrent managers sharing a
+// path are safe.
+type VolumeManager struct {
+	// Path is the registry file (created 0600, with its directory 0700)
+	Path string
+}
+
+// NewVolumeManager returns a manager using the registry at path
+// (empty = DefaultRegistryPath)
+func NewVolumeManager(path string) *VolumeManager {
+	if path == "" {
+		path = DefaultRegistryPath
+	}
+	return &VolumeManager{Path: path}
+}
+
+// Open attaches device to a loop device if it is an image file, unlocks it
+// as name and records the volume. Opening a volume that is already open as
+// name from the same device returns its existing record; name being taken
+// by another device is an ErrVolumeAlreadyUnlocked error. If unlocking
+// fails the loop device is detached again.
+func (m *VolumeManager) Open(device string, passphrase []byte, name string, opts *UnlockOptions) (*ManagedVolume, error) {
+	var vol *ManagedVolume
+	err := m.update(func(volumes map[string]ManagedVolume) error {
+		if rec, ok := volumes[name]; ok && IsUnlocked(name) {
+			if rec.Device != device {
+				return fmt.Errorf("%w: %s is open from %s", ErrVolumeAlreadyUnlocked, name, rec.Device)
+			}
+			vol = &rec
+			return nil
+		}
+
+		rec := ManagedVolume{Name: name, Device: device, Opened: time.Now().UTC()}
+		unlockOpts := UnlockOptions{}
+		if opts != nil {
+			unlockOpts = *opts
+		}
+
+		target := device
+		fi, err := os.Stat(device)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrDeviceNotFound, device)
+		}
+		if fi.Mode().IsRegular() {
+			if rec.LoopDevice, err = SetupLoopDevice(device); err != nil {
+				return err
+			}
+			target = rec.LoopDevice
+			// Lock detaches the loop device even if the registry is lost
+			unlockOpts.AutoDetachLoop = true
+		}
+
+		if err := UnlockWithOptions(target, passphrase, name, &unlockOpts); err != nil {
+			if rec.LoopDevice != "" {
+				_ = DetachLoopDevice(rec.LoopDevice)
+			}
+			return err
+		}
+
+		volumes[name] = rec
+		vol = &rec
+		return nil
+	})
+	return vol, err
+}
+
+// Register records a volume that was opened without the manager, so Close
+// and GC can take care of it. An existing record for the name is replaced.
+func (m *VolumeManager) Register(vol ManagedVolume) error {
+	if vol.Opened.IsZero() {
+		vol.Opened = time.Now().UTC()
+	}
+	return m.update(func(volumes map[string]ManagedVolume) error {
+		volumes[vol.Name] = vol
+		return nil
+	})
+}
+
+// Mount mounts a managed volume as described by opts (opts.Device is set to
+// name) and records the mount point. Mounting a volume again at the mount
+// point it is already mounted on does nothing.
+func (m *VolumeManager) Mount(name string, opts MountOptions) error {
+	return m.update(func(volumes map[string]ManagedVolume) error {
+		rec, ok := volumes[name]
+		if !ok {
+			return fmt.Errorf("%w: %s is not a managed volume", ErrVolumeNotUnlocked, name)
+		}
+		if rec.MountPoint == opts.MountPoint && rec.mounted() {
+			return nil
+		}
+
+		opts.Device = name
+		if err := Mount(opts); err != nil {
+			return err
+		}
+		rec.MountPoint = opts.MountPoint
+		volumes[name] = rec
+		return nil
+	})
+}
+
+// SetMountPoint records where a managed volume was mounted without the
+// manager. Names that are not registered are ignored.
+func (m *VolumeManager) SetMountPoint(name, mountPoint string) error {
+	return m.update(func(volumes map[string]ManagedVolume) error {
+		if rec, ok := volumes[name]; ok {
+			rec.MountPoint = mountPoint
+			volumes[name] = rec
+		}
+		return nil
+	})
+}
+
+// Close tears down everything recorded for name: the volume is unmounted,
+// locked and its loop device detached, then the record is removed. Steps
+// that were already undone are skipped, so Close can be repeated after a
+// partial failure. A name that is not registered is simply locked if it is
+// unlocked.
+//
+// opts are passed to Lock. If WithDeferred leaves the removal pending, the
+// record is kept until GC finds the mapping gone and detaches the loop
+// device.
+func (m *VolumeManager) Close(name string, opts ...LockOption) error {
+	return m.update(func(volumes map[string]ManagedVolume) error {
+		rec, ok := volumes[name]
+		if !ok {
+			rec = ManagedVolume{Name: name}
+		}
+
+		if rec.mounted() {
+			if err := Unmount(rec.MountPoint, 0); err != nil {
+				return err
+			}
+		}
+		if IsUnlocked(name) {
+			if err := Lock(name, opts...); err != nil {
+				return err
+			}
+			if IsUnlocked(name) {
+				// Deferred removal is pending
+				if ok {
+					rec.MountPoint = ""
+					volumes[name] = rec
+				}
+				return nil
+			}
+		}
+		if err := rec.detachLoop(); err != nil {
+			return err
+		}
+
+		delete(volumes, name)
+		return nil
+	})
+}
+
+// List returns the registered volumes sorted by name
+func (m *VolumeManager) List() ([]ManagedVolume, error) {
+	var list []ManagedVolume
+	err := m.update(func(volumes map[string]ManagedVolume) error {
+		for _, rec := range volumes {
+			list = append(list, rec)
+		}
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, err
+}
+
+// GC reconciles the registry with the system after crashes or manual
+// cleanup. Records whose mapping is gone are removed and their loop device
+// detached if it is still attached; unmounted mount points are cleared; and
+// unmounted volumes whose image file was deleted are closed. It returns the
+// names of the removed records.
+func (m *VolumeManager) GC() ([]string, error) {
+	var removed []string
+	err := m.update(func(volumes map[string]ManagedVolume) error {
+		for name, rec := range volumes {
+			if rec.MountPoint != "" && !rec.mounted() {
+				rec.MountPoint = ""
+				volumes[name] = rec
+			}
+
+			unlocked := IsUnlocked(name)
+			if unlocked && rec.LoopDevice != "" && rec.MountPoint == "" {
+				if _, err := os.Stat(rec.Device); os.IsNotExist(err) {
+					// Nothing can reopen a mapping of a deleted image
+					if err := Lock(name); err != nil {
+						return err
+					}
+					unlocked = false
+				}
+			}
+			if unlocked {
+				continue
+			}
+
+			if err := rec.detachLoop(); err != nil {
+				return err
+			}
+			delete(volumes, name)
+			removed = append(removed, name)
+		}
+		return nil
+	})
+	sort.Strings(removed)
+	return removed, err
+}
+
+// mounted reports whether the volume is mounted at its recorded mount point
+func (v *ManagedVolume) mounted() bool {
+	if v.MountPoint == "" {
+		return false
+	}
+	mounted, err := IsMounted(v.MountPoint)
+	return err == nil && mounted
+}
+
+// detachLoop detaches the volume's loop device if it is still attached to
+// the volume's image file. The kernel reuses loop numbers, so a loop device
+// now backing another file is left alone.
+func (v *ManagedVolume) detachLoop() error {
+	if v.LoopDevice == "" {
+		return nil
+	}
+	if loop, err := FindLoopDevice(v.Device); err != nil || loop != v.LoopDevice {
+		return nil
+	}
+	return DetachLoopDevice(v.LoopDevice)
+}
+
+// update applies fn to the registry while holding an exclusive lock on it,
+// then writes it back
+func (m *VolumeManager) update(fn func(volumes map[string]ManagedVolume) error) error {
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create registry directory: %w", err)
+	}
+	f, err := os.OpenFile(m.Path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- registry path chosen by the caller
+	if err != nil {
+		return fmt.Errorf("failed to open volume registry: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock volume registry: %w", err)
+	}
+	defer func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read volume registry: %w", err)
+	}
+	volumes := make(map[string]ManagedVolume)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &volumes); err != nil {
+			return fmt.Errorf("corrupt volume registry %s: %w", m.Path, err)
+		}
+	}
+
+	// Records changed before a failure still describe the system, so the
+	// registry is written back either way
+	fnErr := fn(volumes)
+
+	if data, err = json.MarshalIndent(volumes, "", "  "); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write volume registry: %w", err)
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write volume registry: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	return fnErr
+}
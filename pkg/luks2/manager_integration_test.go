@@ -0,0 +1,84 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestVolumeManagerLifecycle tests opening, mounting and closing an image file by name
+func TestVolumeManagerLifecycle(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	dir := t.TempDir()
+	volumePath := filepath.Join(dir, "managed.img")
+	if err := os.WriteFile(volumePath, nil, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Truncate(volumePath, 100*1024*1024); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	passphrase := []byte("test-manager-pass")
+	if err := Format(FormatOptions{Device: volumePath, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 100}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	m := NewVolumeManager(filepath.Join(dir, "volumes.json"))
+	name := "test-managed"
+	_ = Lock(name)
+	defer m.Close(name)
+
+	vol, err := m.Open(volumePath, passphrase, name, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if vol.LoopDevice == "" {
+		t.Fatal("Expected a loop device for an image file")
+	}
+
+	// Opening again is a no-op
+	again, err := m.Open(volumePath, passphrase, name, nil)
+	if err != nil || again.LoopDevice != vol.LoopDevice {
+		t.Fatalf("Second Open = %+v, %v; want the existing volume", again, err)
+	}
+
+	if err := MakeFilesystem(name, "ext4", "managed"); err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+	mountPoint := filepath.Join(dir, "mnt")
+	if err := os.Mkdir(mountPoint, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Mount(name, MountOptions{MountPoint: mountPoint}); err != nil {
+			t.Fatalf("Mount #%d failed: %v", i+1, err)
+		}
+	}
+
+	// A fresh manager on the same registry tears everything down by name
+	if err := NewVolumeManager(m.Path).Close(name); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if mounted, _ := IsMounted(mountPoint); mounted {
+		t.Error("Volume still mounted")
+	}
+	if IsUnlocked(name) {
+		t.Error("Mapping still active")
+	}
+	if loop, err := FindLoopDevice(volumePath); err == nil {
+		_ = DetachLoopDevice(loop)
+		t.Errorf("Loop device %s still attached", loop)
+	}
+	if list, _ := m.List(); len(list) != 0 {
+		t.Errorf("Registry not cleared: %+v", list)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// newTestManager returns a manager with a registry in a temporary directory
+func newTestManager(t *testing.T) *VolumeManager {
+	t.Helper()
+	return NewVolumeManager(filepath.Join(t.TempDir(), "luks2", "volumes.json"))
+}
+
+// TestVolumeManager_Registry tests recording and listing volumes
+func TestVolumeManager_Registry(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.Register(ManagedVolume{Name: "b", Device: "/tmp/b.luks", LoopDevice: "/dev/loop9"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := m.Register(ManagedVolume{Name: "a", Device: "/dev/sdb1"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := m.SetMountPoint("a", "/mnt/a"); err != nil {
+		t.Fatalf("SetMountPoint failed: %v", err)
+	}
+	if err := m.SetMountPoint("unknown", "/mnt/x"); err != nil {
+		t.Fatalf("SetMountPoint on unknown name failed: %v", err)
+	}
+
+	list, err := m.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "b" {
+		t.Fatalf("List() = %+v", list)
+	}
+	if list[0].MountPoint != "/mnt/a" || list[1].LoopDevice != "/dev/loop9" || list[0].Opened.IsZero() {
+		t.Errorf("unexpected records %+v", list)
+	}
+
+	fi, err := os.Stat(m.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("registry mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+// TestVolumeManager_DefaultPath tests the default registry location
+func TestVolumeManager_DefaultPath(t *testing.T) {
+	if m := NewVolumeManager(""); m.Path != DefaultRegistryPath {
+		t.Errorf("Path = %s, want %s", m.Path, DefaultRegistryPath)
+	}
+}
+
+// TestVolumeManager_CloseStale tests closing volumes whose mapping is gone
+func TestVolumeManager_CloseStale(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.Register(ManagedVolume{Name: "luks2-test-gone", Device: filepath.Join(t.TempDir(), "gone.luks"), LoopDevice: "/dev/loop99"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Close("luks2-test-gone"); err != nil {
+			t.Fatalf("Close #%d failed: %v", i+1, err)
+		}
+	}
+	if list, _ := m.List(); len(list) != 0 {
+		t.Errorf("record not removed: %+v", list)
+	}
+}
+
+// TestVolumeManager_GC tests dropping records of closed mappings
+func TestVolumeManager_GC(t *testing.T) {
+	m := newTestManager(t)
+	for _, name := range []string{"luks2-test-gc-b", "luks2-test-gc-a"} {
+		if err := m.Register(ManagedVolume{Name: name, Device: "/dev/null", MountPoint: t.TempDir()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := m.GC()
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if !slices.Equal(removed, []string{"luks2-test-gc-a", "luks2-test-gc-b"}) {
+		t.Errorf("GC() = %v", removed)
+	}
+	if list, _ := m.List(); len(list) != 0 {
+		t.Errorf("records left after GC: %+v", list)
+	}
+}
+
+// TestVolumeManager_Errors tests failures that leave the registry untouched
+func TestVolumeManager_Errors(t *testing.T) {
+	m := newTestManager(t)
+
+	if _, err := m.Open(filepath.Join(t.TempDir(), "missing.luks"), []byte("test-passphrase"), "luks2-test-missing", nil); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+	if err := m.Mount("luks2-test-missing", MountOptions{MountPoint: t.TempDir()}); !errors.Is(err, ErrVolumeNotUnlocked) {
+		t.Errorf("expected ErrVolumeNotUnlocked, got %v", err)
+	}
+	if list, err := m.List(); err != nil || len(list) != 0 {
+		t.Errorf("List() = %+v, %v; want empty", list, err)
+	}
+
+	if err := os.WriteFile(m.Path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.List(); err == nil {
+		t.Error("expected error for corrupt registry")
+	}
+}
+
+// TestVolumeManager_Concurrent tests that concurrent updates are not lost
+func TestVolumeManager_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volumes.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate managers, as in separate processes
+			if err := NewVolumeManager(path).Register(ManagedVolume{Name: fmt.Sprintf("vol%d", i)}); err != nil {
+				t.Errorf("Register failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if list, err := NewVolumeManager(path).List(); err != nil || len(list) != 8 {
+		t.Errorf("expected 8 records, got %d (%v)", len(list), err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// keyslotSkipped reports whether a keyslot failed to unlock for a reason
+// other than the passphrase: too little memory for its KDF, or an area
+// encryption this package cannot decrypt
+func keyslotSkipped(err error) bool {
+	return errors.Is(err, ErrInsufficientMemory) || errors.Is(err, ErrUnsupportedCipher)
+}
+
+// unlockFailure returns the error for a passphrase that opened no keyslot.
+// If a keyslot was skipped the passphrase may well be right, so that is
+// reported instead of a wrong passphrase.
+func unlockFailure(skipErr error) error {
+	if skipErr != nil {
+		return skipErr
+	}
+	return ErrInvalidPassphrase
+}
+
+// getMasterKeyWithOptions recovers the master key honoring keyslot selection
+// and parallelism options, and returns the ID of the keyslot that opened
+func getMasterKeyWithOptions(device string, passphrase []byte, metadata *LUKS2Metadata, opts *UnlockOptions) (*securemem.Buffer, int, error) {
+	if err := checkNotRotating(metadata); err != nil {
+		return nil, -1, err
+	}
+
+	keyslots, err := selectKeyslots(metadata, opts)
+	if err != nil {
+		return nil, -1, err
+	}
+	keyslots, refused := keyslotsMeetingKDFPolicy(device, metadata, keyslots)
+
+	var mk *securemem.Buffer
+	var keyslot *Keyslot
+	if opts.Parallel <= 1 || len(keyslots) <= 1 {
+		mk, keyslot, err = getMasterKeySequential(device, passphrase, metadata, keyslots)
+	} else {
+		memoryLimit := opts.MemoryLimit
+		if memoryLimit == 0 {
+			if avail, err := availableMemory(); err == nil {
+				memoryLimit = avail / 2
+			}
+		}
+		mk, keyslot, err = getMasterKeyParallel(device, passphrase, metadata, keyslots, opts.Parallel, memoryLimit)
+	}
+	if err != nil {
+		// The passphrase may belong to a refused keyslot
+		if refused != nil && errors.Is(err, ErrInvalidPassphrase) {
+			return nil, -1, refused
+		}
+		return nil, -1, err
+	}
+
+	warnWeakKDF(device, metadata, keyslot)
+	// selectKeyslots only yields keyslots with numeric IDs
+	id, _ := strconv.Atoi(keyslotID(metadata, keyslot))
+	return mk, id, nil
+}
+
+// getMasterKeySequential tries the given keyslots one at a time and returns
+// the master key and the keyslot that opened
+func getMasterKeySequential(device string, passphrase []byte, metadata *LUKS2Metadata, keyslots []*Keyslot) (*securemem.Buffer, *Keyslot, error) {
+	var skipErr error
+	for _, keyslot := range keyslots {
+		mk, err := unlockKeyslot(device, passphrase, keyslot, metadata.Digests)
+		if err == nil {
+			return mk, keyslot, nil
+		}
+		if keyslotSkipped(err) {
+			skipErr = err
+		}
+	}
+	return nil, nil, unlockFailure(skipErr)
+}
+
+// selectKeyslots returns the keyslots an unlock tries: the one selected by
+// opts.Keyslot, or all of them in unlock order
+func selectKeyslots(metadata *LUKS2Metadata, opts *UnlockOptions) ([]*Keyslot, error) {
+	if opts == nil || opts.Keyslot == nil {
+		return unlockOrder(metadata), nil
+	}
+	keyslot, exists := metadata.Keyslots[strconv.Itoa(*opts.Keyslot)]
+	if !exists || keyslot.Type != "luks2" {
+		return nil, fmt.Errorf("%w: keyslot %d does not exist", ErrInvalidKeyslot, *opts.Keyslot)
+	}
+	return []*Keyslot{keyslot}, nil
+}
+
+// unlockKeyslot attempts to unlock a keyslot with the given passphrase
+//
+// Everything that can fail for reasons unrelated to the passphrase (header
+// parsing, I/O, sizes) is checked before the key is derived. Once the KDF
+// has run, every candidate goes through decrypt, AF merge and digest
+// verification in full, so a wrong passphrase is indistinguishable by timing
+// from one that fails at any particular stage.
+func unlockKeyslot(device string, passphrase []byte, keyslot *Keyslot, digests map[string]*Digest) (*securemem.Buffer, error) {
+	// Read encrypted key material from keyslot area
+	offset, err := parseSize(keyslot.Area.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := parseSize(keyslot.Area.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(device) // #nosec G304 -- device path validated by caller
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r, done := openSectorReader(device, f)
+	defer done()
+	buf, err := readKeyslotArea(r, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	defer putKeyslotBuffer(buf)
+	encryptedKeyMaterial := *buf
+
+	// The area has its own cipher and key size, which need not match the
+	// data segment's or the volume key's
+	keySize := areaKeySize(keyslot)
+	if _, err := parseKeyslotEncryption(keyslot.Area.Encryption, keySize); err != nil {
+		return nil, err
+	}
+
+	// The keyslot area may be larger than the actual AF-split data due to
+	// alignment; only keySize * stripes bytes are needed for AF merge
+	afSplitSize, err := afMaterialSize(keyslot.KeySize, keyslot.AF.Stripes)
+	if err != nil {
+		return nil, err
+	}
+	if int64(afSplitSize) > size {
+		return nil, fmt.Errorf("keyslot area too small: got %d, need %d", size, afSplitSize)
+	}
+
+	// Derive key from passphrase
+	passphraseKey, err := deriveSecureKey(passphrase, keyslot.KDF, keySize)
+	if err != nil {
+		return nil, err
+	}
+	defer passphraseKey.Destroy()
+
+	// Decrypt key material
+	sectorSize := 512 // Default for key material
+	decrypted, err := decryptKeyMaterial(encryptedKeyMaterial, passphraseKey.Bytes(), keyslot.Area.Encryption, sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	decryptedBuf, err := securemem.NewFromBytes(decrypted)
+	if err != nil {
+		return nil, err
+	}
+	defer decryptedBuf.Destroy()
+	decryptedKeyMaterial := decryptedBuf.Bytes()
+
+	// Merge anti-forensic split
+	if len(decryptedKeyMaterial) < afSplitSize {
+		return nil, fmt.Errorf("decrypted data too small: got %d, need %d", len(decryptedKeyMaterial), afSplitSize)
+	}
+	merged, err := AFMerge(decryptedKeyMaterial[:afSplitSize], keyslot.AF.Stripes, keyslot.KeySize, keyslot.AF.Hash)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := securemem.NewFromBytes(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify master key using digest
+	if err := verifyMasterKey(masterKey.Bytes(), digests); err != nil {
+		masterKey.Destroy()
+		return nil, err
+	}
+
+	return masterKey, nil
+}
+
+// verifyMasterKey verifies the master key against stored digests. Every
+// digest is evaluated and the results are combined without branching, so the
+// time taken does not reveal whether or which digest matched.
+func verifyMasterKey(masterKey []byte, digests map[string]*Digest) error {
+	match := 0
+	var firstErr error
+	for _, digest := range digests {
+		ok, err := compareDigest(masterKey, digest)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		match |= ok
+	}
+
+	if match == 1 {
+		return nil
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return fmt.Errorf("master key verification failed")
+}
+
+// compareDigest derives the digest of masterKey and compares it to the
+// stored value in constant time, returning 1 on a match and 0 otherwise
+func compareDigest(masterKey []byte, digest *Digest) (int, error) {
+	// Decode expected digest
+	expected, err := decodeBase64(digest.Digest)
+	if err != nil {
+		return 0, err
+	}
+	defer clearBytes(expected)
+
+	kdf := &KDF{
+		Type:       digest.Type,
+		Hash:       digest.Hash,
+		Salt:       digest.Salt,
+		Iterations: &digest.Iterations,
+	}
+
+	// Derive digest from master key
+	derived, err := DeriveKey(masterKey, kdf, 32) // 32 bytes digest
+	if err != nil {
+		return 0, err
+	}
+	defer clearBytes(derived)
+
+	return subtle.ConstantTimeCompare(derived, expected), nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// meminfoPath is the kernel memory statistics file (overridable for tests)
+var meminfoPath = "/proc/meminfo"
+
+// kdfMemoryLimit caps the memory a single key derivation may use in bytes
+var (
+	kdfMemoryLimitMu sync.RWMutex
+	kdfMemoryLimit   int64
+)
+
+// SetKDFMemoryLimit caps the memory a single Argon2 key derivation may use in
+// bytes. Derivations above the limit, or above the currently available
+// memory, fail with a *MemoryError wrapping ErrInsufficientMemory instead of
+// risking the OOM killer. A limit of 0 (the default) checks available memory
+// only.
+func SetKDFMemoryLimit(limit int64) {
+	kdfMemoryLimitMu.Lock()
+	defer kdfMemoryLimitMu.Unlock()
+	kdfMemoryLimit = limit
+}
+
+// checkKDFMemory returns a *MemoryError if kdf cannot be derived within the
+// configured limit and the available memory. When available memory cannot
+// be determined only the limit is enforced.
+func checkKDFMemory(kdf *KDF) error {
+	required := kdfMemoryCost(kdf)
+	if required == 0 {
+		return nil
+	}
+
+	kdfMemoryLimitMu.RLock()
+	limit := kdfMemoryLimit
+	kdfMemoryLimitMu.RUnlock()
+
+	avail, err := availableMemory()
+	if err != nil {
+		avail = 0
+	}
+
+	if (limit > 0 && required > limit) || (avail > 0 && required > avail) {
+		return &MemoryError{Required: required, Available: avail, Limit: limit}
+	}
+	return nil
+}
+
+// availableMemory returns the memory available for new allocations in bytes,
+// as reported by MemAvailable in /proc/meminfo
+func availableMemory() (int64, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", meminfoPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable value: %w", err)
+		}
+		return kb * 1024, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", meminfoPath, err)
+	}
+
+	return 0, fmt.Errorf("MemAvailable not found in %s", meminfoPath)
+}
+
+// kdfMemoryCost returns the approximate memory a key derivation needs in bytes
+func kdfMemoryCost(kdf *KDF) int64 {
+	if kdf == nil || kdf.Memory == nil {
+		return 0 // PBKDF2 needs negligible memory
+	}
+	return int64(*kdf.Memory) * 1024
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeMeminfo points meminfoPath at a temporary file with the given content
+func fakeMeminfo(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "meminfo")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := meminfoPath
+	meminfoPath = path
+	t.Cleanup(func() { meminfoPath = old })
+}
+
+func TestAvailableMemory(t *testing.T) {
+	fakeMeminfo(t, "MemTotal:        8000000 kB\nMemFree:          100000 kB\nMemAvailable:    2097152 kB\n")
+
+	avail, err := availableMemory()
+	if err != nil {
+		t.Fatalf("availableMemory failed: %v", err)
+	}
+	if avail != 2*1024*1024*1024 {
+		t.Errorf("expected 2GiB, got %d", avail)
+	}
+}
+
+func TestAvailableMemory_Errors(t *testing.T) {
+	fakeMeminfo(t, "MemTotal:        8000000 kB\n")
+	if _, err := availableMemory(); err == nil {
+		t.Error("expected error when MemAvailable is missing")
+	}
+
+	fakeMeminfo(t, "MemAvailable:    lots kB\n")
+	if _, err := availableMemory(); err == nil {
+		t.Error("expected error for invalid value")
+	}
+
+	meminfoPath = "/nonexistent/meminfo"
+	if _, err := availableMemory(); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestKDFMemoryCost(t *testing.T) {
+	memory := 65536
+	if got := kdfMemoryCost(&KDF{Type: "argon2id", Memory: &memory}); got != 64*1024*1024 {
+		t.Errorf("expected 64MiB, got %d", got)
+	}
+	if got := kdfMemoryCost(&KDF{Type: "pbkdf2"}); got != 0 {
+		t.Errorf("expected 0 for pbkdf2, got %d", got)
+	}
+	if got := kdfMemoryCost(nil); got != 0 {
+		t.Errorf("expected 0 for nil KDF, got %d", got)
+	}
+}
+
+func TestCheckKDFMemory(t *testing.T) {
+	memory := 65536 // 64MiB
+	kdf := &KDF{Type: "argon2id", Memory: &memory}
+
+	fakeMeminfo(t, "MemAvailable:    1048576 kB\n")
+	if err := checkKDFMemory(kdf); err != nil {
+		t.Errorf("expected derivation to fit, got %v", err)
+	}
+
+	// Less available memory than the derivation needs
+	fakeMeminfo(t, "MemAvailable:      32768 kB\n")
+	err := checkKDFMemory(kdf)
+	if !errors.Is(err, ErrInsufficientMemory) {
+		t.Fatalf("expected ErrInsufficientMemory, got %v", err)
+	}
+	var memErr *MemoryError
+	if !errors.As(err, &memErr) || memErr.Required != 64*1024*1024 || memErr.Available != 32*1024*1024 {
+		t.Errorf("unexpected MemoryError: %+v", memErr)
+	}
+
+	// Configured limit below the requirement
+	fakeMeminfo(t, "MemAvailable:    1048576 kB\n")
+	SetKDFMemoryLimit(16 * 1024 * 1024)
+	t.Cleanup(func() { SetKDFMemoryLimit(0) })
+	if err := checkKDFMemory(kdf); !errors.As(err, &memErr) || memErr.Limit != 16*1024*1024 {
+		t.Errorf("expected limit MemoryError, got %v", err)
+	}
+
+	// PBKDF2 needs no memory check
+	if err := checkKDFMemory(&KDF{Type: "pbkdf2"}); err != nil {
+		t.Errorf("expected nil for pbkdf2, got %v", err)
+	}
+}
+
+func TestGetMasterKey_InsufficientMemory(t *testing.T) {
+	passphrase := []byte("test-password")
+	argonPass := []byte("argon2-password")
+	device := formatTestVolume(t, passphrase)
+
+	if err := AddKey(device, passphrase, argonPass, &AddKeyOptions{
+		KDFType:        "argon2id",
+		Argon2Time:     1,
+		Argon2Memory:   8192,
+		Argon2Parallel: 1,
+	}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	SetKDFMemoryLimit(4 * 1024 * 1024)
+	t.Cleanup(func() { SetKDFMemoryLimit(0) })
+
+	if _, err := getMasterKey(device, argonPass, metadata); !errors.Is(err, ErrInsufficientMemory) {
+		t.Errorf("expected ErrInsufficientMemory for argon2 keyslot, got %v", err)
+	}
+
+	// The PBKDF2 keyslot still unlocks
+	mk, err := getMasterKey(device, passphrase, metadata)
+	if err != nil {
+		t.Fatalf("expected pbkdf2 keyslot to unlock, got %v", err)
+	}
+	mk.Destroy()
+
+	if _, _, err := getMasterKeyWithOptions(device, argonPass, metadata, &UnlockOptions{Parallel: 2}); !errors.Is(err, ErrInsufficientMemory) {
+		t.Errorf("expected ErrInsufficientMemory from parallel unlock, got %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metadata written by cryptsetup, systemd and other tools carries members
+// the types in types.go do not model. Each metadata type keeps them in its
+// Extra field and writes them back, so rewriting a header never drops data
+// another tool relies on.
+
+// jsonField describes a struct field as encoding/json sees it
+type jsonField struct {
+	index     int
+	omitempty bool
+}
+
+// jsonFieldCache maps a struct type to its fields by lower-cased JSON name
+var jsonFieldCache sync.Map // reflect.Type -> map[string]jsonField
+
+// jsonFields returns the JSON members of struct type t. encoding/json
+// matches member names case-insensitively on decode, so the names are
+// lower-cased.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	if fields, ok := jsonFieldCache.Load(t); ok {
+		return fields.(map[string]jsonField)
+	}
+
+	fields := make(map[string]jsonField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = jsonField{index: i, omitempty: strings.Contains(opts, "omitempty")}
+	}
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// decodeMembers decodes data into v, a pointer to a struct without JSON
+// methods, and returns the members to carry over to the next encoding:
+// those v has no field for, and those present but empty that the encoder
+// would omit (systemd tells "tpm2-pcrs": [] apart from no member at all).
+// Values are compacted. It returns nil when there are none.
+func decodeMembers(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	fields := jsonFields(rv.Type())
+	var extra map[string]json.RawMessage
+	for name, value := range members {
+		f, known := fields[strings.ToLower(name)]
+		if known && !(f.omitempty && emptyJSONValue(rv.Field(f.index))) {
+			continue
+		}
+		// Compact, since the header is written indented
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return nil, err
+		}
+		if extra == nil {
+			extra = make(map[string]json.RawMessage)
+		}
+		extra[name] = buf.Bytes()
+	}
+	return extra, nil
+}
+
+// unknownMembers decodes the members of extra that struct type t has no
+// field for, leaving out the empty known members decodeMembers keeps. It
+// returns nil when there are none.
+func unknownMembers(extra map[string]json.RawMessage, t reflect.Type) (map[string]interface{}, error) {
+	fields := jsonFields(t)
+	var members map[string]interface{}
+	for name, value := range extra {
+		if _, known := fields[strings.ToLower(name)]; known {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, err
+		}
+		if members == nil {
+			members = make(map[string]interface{})
+		}
+		members[name] = v
+	}
+	return members, nil
+}
+
+// emptyJSONValue reports whether encoding/json treats v as empty for
+// omitempty
+func emptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// encodeMembers encodes v, a pointer to a struct without JSON methods, and
+// appends the members of extra the encoding does not already contain, in
+// name order. A field set since decoding takes precedence over its old
+// value in extra.
+func encodeMembers(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	emitted := make(map[string]bool, len(members))
+	for name := range members {
+		emitted[strings.ToLower(name)] = true
+	}
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		if !emitted[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1]) // Without the closing brace
+	for _, name := range names {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(extra[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a LUKS2Metadata and keeps unknown members in Extra
+func (m *LUKS2Metadata) UnmarshalJSON(data []byte) error {
+	type plain LUKS2Metadata
+	extra, err := decodeMembers(data, (*plain)(m))
+	m.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a LUKS2Metadata including the members in Extra
+func (m LUKS2Metadata) MarshalJSON() ([]byte, error) {
+	type plain LUKS2Metadata
+	return encodeMembers((*plain)(&m), m.Extra)
+}
+
+// UnmarshalJSON decodes a Keyslot and keeps unknown members in Extra, and
+// decoded in the deprecated Custom
+func (k *Keyslot) UnmarshalJSON(data []byte) error {
+	type plain Keyslot
+	extra, err := decodeMembers(data, (*plain)(k))
+	k.Extra = extra
+	if err != nil {
+		return err
+	}
+	k.Custom, err = unknownMembers(extra, reflect.TypeOf(plain{}))
+	return err
+}
+
+// MarshalJSON encodes a Keyslot including the members in Extra
+func (k Keyslot) MarshalJSON() ([]byte, error) {
+	type plain Keyslot
+	return encodeMembers((*plain)(&k), k.Extra)
+}
+
+// UnmarshalJSON decodes a KeyslotArea and keeps unknown members in Extra
+func (k *KeyslotArea) UnmarshalJSON(data []byte) error {
+	type plain KeyslotArea
+	extra, err := decodeMembers(data, (*plain)(k))
+	k.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a KeyslotArea including the members in Extra
+func (k KeyslotArea) MarshalJSON() ([]byte, error) {
+	type plain KeyslotArea
+	return encodeMembers((*plain)(&k), k.Extra)
+}
+
+// UnmarshalJSON decodes a KDF and keeps unknown members in Extra
+func (k *KDF) UnmarshalJSON(data []byte) error {
+	type plain KDF
+	extra, err := decodeMembers(data, (*plain)(k))
+	k.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a KDF including the members in Extra
+func (k KDF) MarshalJSON() ([]byte, error) {
+	type plain KDF
+	return encodeMembers((*plain)(&k), k.Extra)
+}
+
+// UnmarshalJSON decodes a AntiForensic and keeps unknown members in Extra
+func (a *AntiForensic) UnmarshalJSON(data []byte) error {
+	type plain AntiForensic
+	extra, err := decodeMembers(data, (*plain)(a))
+	a.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a AntiForensic including the members in Extra
+func (a AntiForensic) MarshalJSON() ([]byte, error) {
+	type plain AntiForensic
+	return encodeMembers((*plain)(&a), a.Extra)
+}
+
+// UnmarshalJSON decodes a Token and keeps unknown members in Extra
+func (t *Token) UnmarshalJSON(data []byte) error {
+	type plain Token
+	extra, err := decodeMembers(data, (*plain)(t))
+	t.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a Token including the members in Extra
+func (t Token) MarshalJSON() ([]byte, error) {
+	type plain Token
+	return encodeMembers((*plain)(&t), t.Extra)
+}
+
+// UnmarshalJSON decodes a Segment and keeps unknown members in Extra
+func (s *Segment) UnmarshalJSON(data []byte) error {
+	type plain Segment
+	extra, err := decodeMembers(data, (*plain)(s))
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a Segment including the members in Extra
+func (s Segment) MarshalJSON() ([]byte, error) {
+	type plain Segment
+	return encodeMembers((*plain)(&s), s.Extra)
+}
+
+// UnmarshalJSON decodes a Digest and keeps unknown members in Extra
+func (d *Digest) UnmarshalJSON(data []byte) error {
+	type plain Digest
+	extra, err := decodeMembers(data, (*plain)(d))
+	d.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a Digest including the members in Extra
+func (d Digest) MarshalJSON() ([]byte, error) {
+	type plain Digest
+	return encodeMembers((*plain)(&d), d.Extra)
+}
+
+// UnmarshalJSON decodes a Config and keeps unknown members in Extra
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	extra, err := decodeMembers(data, (*plain)(c))
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a Config including the members in Extra
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return encodeMembers((*plain)(&c), c.Extra)
+}
+
+// UnmarshalJSON decodes a Requirements and keeps unknown members in Extra
+func (r *Requirements) UnmarshalJSON(data []byte) error {
+	type plain Requirements
+	extra, err := decodeMembers(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a Requirements including the members in Extra
+func (r Requirements) MarshalJSON() ([]byte, error) {
+	type plain Requirements
+	return encodeMembers((*plain)(&r), r.Extra)
+}
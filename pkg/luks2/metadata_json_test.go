@@ -0,0 +1,157 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// containsMembers reports the first member of want, at any depth, that got
+// lost or changed in got
+func containsMembers(path string, want, got interface{}) string {
+	wantObj, ok := want.(map[string]interface{})
+	if !ok {
+		if !reflect.DeepEqual(want, got) {
+			return path
+		}
+		return ""
+	}
+	gotObj, ok := got.(map[string]interface{})
+	if !ok {
+		return path
+	}
+	for name, value := range wantObj {
+		if lost := containsMembers(path+"."+name, value, gotObj[name]); lost != "" {
+			return lost
+		}
+	}
+	return ""
+}
+
+func TestMetadataRoundTrip_Corpus(t *testing.T) {
+	for name, jsonData := range loadHeaderCorpus(t) {
+		t.Run(name, func(t *testing.T) {
+			var metadata LUKS2Metadata
+			if err := json.Unmarshal(jsonData, &metadata); err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(&metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want, got interface{}
+			if err := json.Unmarshal(jsonData, &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			if lost := containsMembers("", want, got); lost != "" {
+				t.Errorf("member %s lost or changed on rewrite:\n%s", lost, encoded)
+			}
+		})
+	}
+}
+
+func TestToken_ExplicitEmptyMembers(t *testing.T) {
+	var token Token
+	if err := json.Unmarshal([]byte(`{"type":"systemd-tpm2","keyslots":["1"],"tpm2-pcrs":[],"tpm2-pin":false}`), &token); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(&token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"tpm2-pcrs":[]`) || !strings.Contains(string(encoded), `"tpm2-pin":false`) {
+		t.Errorf("explicit empty members dropped: %s", encoded)
+	}
+
+	// A field set since decoding replaces the carried-over value
+	token.TPM2PCRs = []int{7}
+	encoded, err = json.Marshal(&token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(encoded), `"tpm2-pcrs"`) != 1 || !strings.Contains(string(encoded), `"tpm2-pcrs":[7]`) {
+		t.Errorf("expected tpm2-pcrs [7] once, got %s", encoded)
+	}
+}
+
+// TestKeyslot_Custom tests that the deprecated Custom holds the unknown
+// members only
+func TestKeyslot_Custom(t *testing.T) {
+	var keyslot Keyslot
+	data := `{"type":"luks2","key_size":64,"priority":null,"x-vendor":{"id":7}}`
+	if err := json.Unmarshal([]byte(data), &keyslot); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"x-vendor": map[string]interface{}{"id": float64(7)}}
+	if !reflect.DeepEqual(keyslot.Custom, want) {
+		t.Errorf("Custom = %v, want %v", keyslot.Custom, want)
+	}
+	if _, ok := keyslot.Extra["priority"]; !ok {
+		t.Error("Expected the empty priority member to be kept in Extra")
+	}
+}
+
+func TestMetadataRoundTrip_KeyOperations(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Extra = map[string]json.RawMessage{"x-vendor": json.RawMessage(`{"version":3}`)}
+	metadata.Keyslots["0"].Extra = map[string]json.RawMessage{"x-enrolled-by": json.RawMessage(`"provisioner"`)}
+	metadata.Segments["0"].Extra = map[string]json.RawMessage{
+		"integrity": json.RawMessage(`{"type":"hmac(sha256)","journal_encryption":"none","journal_integrity":"none"}`),
+	}
+	metadata.Tokens = map[string]*Token{"0": {
+		Type:     "systemd-fido2",
+		Keyslots: []string{"0"},
+		Extra:    map[string]json.RawMessage{"fido2-clientPin-required": json.RawMessage(`true`)},
+	}}
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	if err := AddKey(device, passphrase, []byte("second-password"), testAddKeyOptions); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if err := ChangeKey(device, passphrase, []byte("new-password"), 0); err != nil {
+		t.Fatalf("ChangeKey failed: %v", err)
+	}
+
+	_, metadata, err = ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	checks := []struct {
+		name string
+		got  json.RawMessage
+		want string
+	}{
+		{"metadata x-vendor", metadata.Extra["x-vendor"], `{"version":3}`},
+		{"keyslot 0 x-enrolled-by", metadata.Keyslots["0"].Extra["x-enrolled-by"], `"provisioner"`},
+		{"segment 0 integrity", metadata.Segments["0"].Extra["integrity"], `{"type":"hmac(sha256)","journal_encryption":"none","journal_integrity":"none"}`},
+		{"token 0 fido2-clientPin-required", metadata.Tokens["0"].Extra["fido2-clientPin-required"], `true`},
+	}
+	for _, c := range checks {
+		if string(c.got) != c.want {
+			t.Errorf("%s: expected %s after rewrite, got %s", c.name, c.want, c.got)
+		}
+	}
+	if len(metadata.Keyslots["1"].Extra) != 0 {
+		t.Errorf("new keyslot inherited unknown members: %v", metadata.Keyslots["1"].Extra)
+	}
+}
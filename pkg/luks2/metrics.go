@@ -0,0 +1,69 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsRecorder receives timing and throughput observations from library
+// operations. Implementations must be safe for concurrent use. See the
+// metrics subpackage for a recorder that exports Prometheus metrics.
+type MetricsRecorder interface {
+	// ObserveUnlock is called once per UnlockWithOptions call with its total
+	// duration and result
+	ObserveUnlock(d time.Duration, err error)
+
+	// ObserveKDF is called for every key derivation with the KDF type
+	// ("pbkdf2", "argon2i" or "argon2id") and the time it took
+	ObserveKDF(kdfType string, d time.Duration)
+
+	// ObserveWipe is called after a successful full-device wipe with the
+	// number of bytes written across all passes and the time it took
+	ObserveWipe(bytes int64, d time.Duration)
+}
+
+// metricsState holds the registered recorder
+var metricsState struct {
+	mu       sync.RWMutex
+	recorder MetricsRecorder
+}
+
+// SetMetricsRecorder registers the recorder that receives library metrics.
+// Passing nil disables metrics collection (the default).
+func SetMetricsRecorder(r MetricsRecorder) {
+	metricsState.mu.Lock()
+	defer metricsState.mu.Unlock()
+	metricsState.recorder = r
+}
+
+// metricsRecorder returns the registered recorder, or nil
+func metricsRecorder() MetricsRecorder {
+	metricsState.mu.RLock()
+	defer metricsState.mu.RUnlock()
+	return metricsState.recorder
+}
+
+// observeUnlock reports an unlock that started at start
+func observeUnlock(start time.Time, err error) {
+	if r := metricsRecorder(); r != nil {
+		r.ObserveUnlock(time.Since(start), err)
+	}
+}
+
+// observeKDF reports a key derivation that started at start
+func observeKDF(kdfType string, start time.Time) {
+	if r := metricsRecorder(); r != nil {
+		r.ObserveKDF(kdfType, time.Since(start))
+	}
+}
+
+// observeWipe reports a wipe of n bytes that started at start
+func observeWipe(n int64, start time.Time) {
+	if r := metricsRecorder(); r != nil {
+		r.ObserveWipe(n, time.Since(start))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics collects LUKS2 operation metrics and exports them in the
+// Prometheus text exposition format, without depending on a Prometheus
+// client library.
+//
+// Register a Registry with the library and serve it on /metrics:
+//
+//	reg := metrics.New()
+//	luks2.SetMetricsRecorder(reg)
+//	http.Handle("/metrics", reg)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds, used for unlock
+// and KDF durations. Argon2 unlocks typically take 0.5-4s; the upper
+// buckets catch cost drift and contention during unlock storms.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32}
+
+// Registry records library observations and serves them to Prometheus. It
+// implements luks2.MetricsRecorder and http.Handler.
+type Registry struct {
+	// Mappings lists the active LUKS mappings for the luks2_active_mappings
+	// gauge (default: luks2.ActiveMappings). It is called on every scrape.
+	Mappings func() ([]string, error)
+
+	mu             sync.Mutex
+	buckets        []float64
+	unlock         map[string]*histogram // by result
+	kdf            map[string]*histogram // by KDF type
+	wipeBytes      int64
+	wipeSeconds    float64
+	wipeThroughput float64
+}
+
+var _ luks2.MetricsRecorder = (*Registry)(nil)
+
+// New creates a registry using DefaultBuckets
+func New() *Registry {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets creates a registry with custom histogram bounds (seconds)
+func NewWithBuckets(buckets []float64) *Registry {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Registry{
+		Mappings: luks2.ActiveMappings,
+		buckets:  b,
+		unlock:   make(map[string]*histogram),
+		kdf:      make(map[string]*histogram),
+	}
+}
+
+// ObserveUnlock records the duration of an unlock attempt
+func (r *Registry) ObserveUnlock(d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histogram(r.unlock, result).observe(d.Seconds())
+}
+
+// ObserveKDF records the duration of a key derivation
+func (r *Registry) ObserveKDF(kdfType string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histogram(r.kdf, kdfType).observe(d.Seconds())
+}
+
+// ObserveWipe records a completed wipe
+func (r *Registry) ObserveWipe(bytes int64, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.wipeBytes += bytes
+	r.wipeSeconds += d.Seconds()
+	if d > 0 {
+		r.wipeThroughput = float64(bytes) / d.Seconds()
+	}
+}
+
+// histogram returns the histogram for label in m, creating it if needed.
+// The caller must hold r.mu.
+func (r *Registry) histogram(m map[string]*histogram, label string) *histogram {
+	h, ok := m[label]
+	if !ok {
+		h = &histogram{bounds: r.buckets, counts: make([]uint64, len(r.buckets))}
+		m[label] = h
+	}
+	return h
+}
+
+// ServeHTTP writes the current metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Write writes the current metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	// Count mappings before taking the lock; it reads sysfs
+	mappings := math.NaN()
+	if r.Mappings != nil {
+		if names, err := r.Mappings(); err == nil {
+			mappings = float64(len(names))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	r.mu.Lock()
+	writeHistograms(bw, "luks2_unlock_duration_seconds", "Duration of unlock attempts.", "result", r.unlock)
+	writeHistograms(bw, "luks2_kdf_duration_seconds", "Duration of keyslot key derivations.", "kdf", r.kdf)
+	writeSingle(bw, "luks2_wipe_bytes_total", "Bytes written by completed wipes.", "counter", float64(r.wipeBytes))
+	writeSingle(bw, "luks2_wipe_duration_seconds_total", "Time spent in completed wipes.", "counter", r.wipeSeconds)
+	writeSingle(bw, "luks2_wipe_throughput_bytes_per_second", "Throughput of the most recent wipe.", "gauge", r.wipeThroughput)
+	r.mu.Unlock()
+
+	if !math.IsNaN(mappings) {
+		writeSingle(bw, "luks2_active_mappings", "Number of active LUKS dm-crypt mappings.", "gauge", mappings)
+	}
+	return bw.Flush()
+}
+
+// writeHistograms writes one histogram family. The caller must hold r.mu.
+func writeHistograms(w io.Writer, name, help, labelName string, m map[string]*histogram) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		h := m[label]
+		lv := labelName + "=" + strconv.Quote(label)
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, lv, formatFloat(bound), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, lv, h.count)
+		_, _ = fmt.Fprintf(w, "%s_sum{%s} %s\n", name, lv, formatFloat(h.sum))
+		_, _ = fmt.Fprintf(w, "%s_count{%s} %d\n", name, lv, h.count)
+	}
+}
+
+// writeSingle writes an unlabeled counter or gauge
+func writeSingle(w io.Writer, name, help, typ string, v float64) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, typ, name, formatFloat(v))
+}
+
+// formatFloat formats a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// histogram counts observations per bucket. counts are per-bucket (not
+// cumulative); observations above the last bound only appear in count.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe records one value
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRegistry returns a registry reporting two active mappings
+func newTestRegistry() *Registry {
+	r := NewWithBuckets([]float64{1, 0.5, 2})
+	r.Mappings = func() ([]string, error) { return []string{"data", "home"}, nil }
+	return r
+}
+
+func TestRegistry_Histograms(t *testing.T) {
+	r := newTestRegistry()
+	r.ObserveUnlock(300*time.Millisecond, nil)
+	r.ObserveUnlock(1500*time.Millisecond, nil)
+	r.ObserveUnlock(5*time.Second, errors.New("bad passphrase"))
+	r.ObserveKDF("argon2id", 750*time.Millisecond)
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+
+	for _, want := range []string{
+		"# TYPE luks2_unlock_duration_seconds histogram\n",
+		`luks2_unlock_duration_seconds_bucket{result="success",le="0.5"} 1` + "\n",
+		`luks2_unlock_duration_seconds_bucket{result="success",le="1"} 1` + "\n",
+		`luks2_unlock_duration_seconds_bucket{result="success",le="2"} 2` + "\n",
+		`luks2_unlock_duration_seconds_bucket{result="success",le="+Inf"} 2` + "\n",
+		`luks2_unlock_duration_seconds_sum{result="success"} 1.8` + "\n",
+		`luks2_unlock_duration_seconds_bucket{result="failure",le="2"} 0` + "\n",
+		`luks2_unlock_duration_seconds_count{result="failure"} 1` + "\n",
+		`luks2_kdf_duration_seconds_bucket{kdf="argon2id",le="1"} 1` + "\n",
+		"luks2_active_mappings 2\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Missing %q in:\n%s", want, text)
+		}
+	}
+
+	// Labels are sorted so scrapes are stable
+	if strings.Index(text, `result="failure"`) > strings.Index(text, `result="success"`) {
+		t.Error("Expected failure series before success series")
+	}
+}
+
+func TestRegistry_Wipe(t *testing.T) {
+	r := newTestRegistry()
+	r.ObserveWipe(4<<20, 2*time.Second)
+	r.ObserveWipe(1<<20, time.Second)
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"luks2_wipe_bytes_total 5.24288e+06\n",
+		"luks2_wipe_duration_seconds_total 3\n",
+		"luks2_wipe_throughput_bytes_per_second 1.048576e+06\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Missing %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRegistry_MappingsError(t *testing.T) {
+	r := newTestRegistry()
+	r.Mappings = func() ([]string, error) { return nil, errors.New("no sysfs") }
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "luks2_active_mappings") {
+		t.Error("Gauge should be omitted when mappings cannot be listed")
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestRegistry().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "luks2_active_mappings 2") {
+		t.Errorf("Unexpected body:\n%s", rec.Body.String())
+	}
+}
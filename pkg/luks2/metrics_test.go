@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics is a MetricsRecorder that keeps every observation
+type recordingMetrics struct {
+	mu         sync.Mutex
+	unlocks    []error
+	kdfs       []string
+	wipedBytes []int64
+}
+
+func (m *recordingMetrics) ObserveUnlock(d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unlocks = append(m.unlocks, err)
+}
+
+func (m *recordingMetrics) ObserveKDF(kdfType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kdfs = append(m.kdfs, kdfType)
+}
+
+func (m *recordingMetrics) ObserveWipe(bytes int64, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wipedBytes = append(m.wipedBytes, bytes)
+}
+
+// captureMetrics installs a recording metrics recorder for the duration of a test
+func captureMetrics(t *testing.T) *recordingMetrics {
+	t.Helper()
+	m := &recordingMetrics{}
+	SetMetricsRecorder(m)
+	t.Cleanup(func() { SetMetricsRecorder(nil) })
+	return m
+}
+
+// TestMetrics_NoRecorder tests that observations are dropped without a recorder
+func TestMetrics_NoRecorder(t *testing.T) {
+	SetMetricsRecorder(nil)
+	// Must not panic
+	observeUnlock(time.Now(), nil)
+	observeKDF("pbkdf2", time.Now())
+	observeWipe(1, time.Now())
+}
+
+// TestMetrics_KDF tests that key derivations are observed with their type
+func TestMetrics_KDF(t *testing.T) {
+	m := captureMetrics(t)
+
+	iterations := 1000
+	kdf := &KDF{Type: "pbkdf2", Hash: "sha256", Salt: encodeBase64([]byte("testsalt12345678")), Iterations: &iterations}
+	if _, err := DeriveKey([]byte("passphrase"), kdf, 32); err != nil {
+		t.Fatalf("DeriveKey failed: %v", err)
+	}
+
+	if len(m.kdfs) != 1 || m.kdfs[0] != "pbkdf2" {
+		t.Errorf("kdf observations = %v", m.kdfs)
+	}
+}
+
+// TestMetrics_UnlockFailure tests that failed unlocks are observed with their error
+func TestMetrics_UnlockFailure(t *testing.T) {
+	m := captureMetrics(t)
+
+	err := Unlock("/nonexistent/device", []byte("passphrase"), "metrics-test")
+	if err == nil {
+		t.Fatal("Expected unlock to fail")
+	}
+
+	if len(m.unlocks) != 1 || m.unlocks[0] != err {
+		t.Errorf("unlock observations = %v, want [%v]", m.unlocks, err)
+	}
+}
+
+// TestMetrics_Wipe tests that full wipes report the bytes written across passes
+func TestMetrics_Wipe(t *testing.T) {
+	m := captureMetrics(t)
+
+	path := filepath.Join(t.TempDir(), "wipe.img")
+	if err := os.WriteFile(path, make([]byte, 64*1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Wipe(WipeOptions{Device: path, Passes: 2}); err != nil {
+		t.Fatalf("Wipe failed: %v", err)
+	}
+	if err := Wipe(WipeOptions{Device: path, Passes: 1, HeaderOnly: true}); err != nil {
+		t.Fatalf("header wipe failed: %v", err)
+	}
+
+	if len(m.wipedBytes) != 1 || m.wipedBytes[0] != 2*64*1024 {
+		t.Errorf("wipe observations = %v", m.wipedBytes)
+	}
+}
@@ -2,10 +2,13 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package luks2
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -15,14 +18,18 @@ import (
 
 // MountOptions contains options for mounting
 type MountOptions struct {
-	Device     string  // Device mapper name (e.g., "my-volume")
-	MountPoint string  // Where to mount (e.g., "/mnt/encrypted")
-	FSType     string  // Filesystem type (e.g., "ext4", "xfs")
-	Flags      uintptr // Mount flags (unix.MS_RDONLY, etc.)
-	Data       string  // Mount data/options
+	Device     string     // Device mapper name (e.g., "my-volume")
+	MountPoint string     // Where to mount (e.g., "/mnt/encrypted")
+	FSType     string     // Filesystem type (e.g., "ext4", "xfs"; empty = detect)
+	Flags      uintptr    // Mount flags (unix.MS_RDONLY, etc.)
+	Data       string     // Mount options (e.g., "noatime,discard"), validated against FSType
+	DataSafety DataSafety // Journaling data mode preset (ext3/ext4 only)
 }
 
-// Mount mounts an unlocked LUKS volume using syscall
+// Mount mounts an unlocked LUKS volume using syscall.
+// Generic options in Data (ro, noatime, nosuid, ...) are converted to mount
+// flags; the remaining options are validated against the filesystem type
+// before being passed to the kernel.
 func Mount(opts MountOptions) error {
 	// Get the device path (handles both udev and non-udev environments)
 	devicePath, err := GetMappedDevicePath(opts.Device)
@@ -40,8 +47,26 @@ func Mount(opts MountOptions) error {
 		return fmt.Errorf("mount point %s does not exist", opts.MountPoint)
 	}
 
+	// Detect the filesystem when no type was given
+	fstype := FilesystemType(opts.FSType)
+	if fstype == "" {
+		fstype, err = DetectFilesystem(devicePath)
+		if err != nil {
+			return fmt.Errorf("failed to detect filesystem on %s: %w", devicePath, err)
+		}
+	}
+
+	flags, data, err := buildMountData(fstype, opts)
+	if err != nil {
+		return err
+	}
+
 	// Use syscall to mount
-	err = unix.Mount(devicePath, opts.MountPoint, opts.FSType, opts.Flags, opts.Data)
+	err = unix.Mount(devicePath, opts.MountPoint, string(fstype), flags, data)
+	if errors.Is(err, unix.EPERM) {
+		// EACCES means a read-only device here, not missing privileges
+		return fmt.Errorf("mount syscall failed: %w", privilegeError("mount", false, err))
+	}
 	if err != nil {
 		return fmt.Errorf("mount syscall failed: %w", err)
 	}
@@ -7,6 +7,8 @@
 package luks2
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -145,3 +147,138 @@ func TestMountErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestOpenAndMount tests the one-shot open and teardown of an image file
+func TestOpenAndMount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	volumePath := filepath.Join(t.TempDir(), "luks-up.img")
+	if err := os.WriteFile(volumePath, nil, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Truncate(volumePath, 100*1024*1024); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	passphrase := []byte("test-up-pass")
+	if err := Format(FormatOptions{Device: volumePath, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 100}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	// Put a filesystem on the volume
+	loopDev, err := SetupLoopDevice(volumePath)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	if err := Unlock(loopDev, passphrase, "test-up-mkfs"); err != nil {
+		_ = DetachLoopDevice(loopDev)
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	err = MakeFilesystem("test-up-mkfs", "ext4", "up")
+	_ = Lock("test-up-mkfs")
+	_ = DetachLoopDevice(loopDev)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+
+	mountPoint := filepath.Join(t.TempDir(), "mnt")
+	vol, err := OpenAndMount(context.Background(), volumePath, mountPoint, passphrase, &OpenMountOptions{Name: "test-up", CreateMountPoint: true})
+	if err != nil {
+		t.Fatalf("OpenAndMount failed: %v", err)
+	}
+	if vol.LoopDevice == "" || vol.FSType != FilesystemExt4 {
+		t.Errorf("Unexpected volume %+v", vol)
+	}
+	if mounted, _ := IsMounted(mountPoint); !mounted {
+		t.Fatal("Volume should be mounted")
+	}
+
+	if err := UnmountAndClose(mountPoint); err != nil {
+		t.Fatalf("UnmountAndClose failed: %v", err)
+	}
+	if IsUnlocked("test-up") {
+		t.Error("Mapping should be closed")
+	}
+	if found, err := FindLoopDevice(volumePath); err == nil {
+		_ = DetachLoopDevice(found)
+		t.Errorf("Loop device %s left attached", found)
+	}
+
+	// A wrong passphrase leaves nothing behind
+	if _, err := OpenAndMount(context.Background(), volumePath, mountPoint, []byte("wrong-pass"), &OpenMountOptions{Name: "test-up"}); err == nil {
+		t.Fatal("Expected error for wrong passphrase")
+	}
+	if _, err := FindLoopDevice(volumePath); err == nil {
+		t.Error("Loop device left attached after failed open")
+	}
+}
+
+// TestOpenHandle tests the lifecycle of an UnlockedVolume for an image file
+func TestOpenHandle(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	volumePath := filepath.Join(t.TempDir(), "luks-handle.img")
+	if err := os.WriteFile(volumePath, nil, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Truncate(volumePath, 100*1024*1024); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	passphrase := []byte("test-handle-pass")
+	if err := Format(FormatOptions{Device: volumePath, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 100}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	vol, err := Open(volumePath, passphrase, &OpenOptions{Name: "test-handle"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer vol.Close()
+
+	if vol.LoopDevice() == "" {
+		t.Error("Expected a loop device for an image file")
+	}
+	if status, err := vol.Status(); err != nil || status.Name != "test-handle" {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+	if err := MakeFilesystem(vol.Name(), "ext4", "handle"); err != nil {
+		t.Fatalf("Failed to create filesystem: %v", err)
+	}
+
+	mountPoint := filepath.Join(t.TempDir(), "mnt")
+	if err := vol.Mount(context.Background(), mountPoint, &VolumeMountOptions{CreateMountPoint: true}); err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	if vol.FSType() != FilesystemExt4 || vol.MountPoint() != mountPoint {
+		t.Errorf("Unexpected mount %s on %s", vol.FSType(), vol.MountPoint())
+	}
+	if err := vol.Unmount(); err != nil {
+		t.Fatalf("Unmount failed: %v", err)
+	}
+	if mounted, _ := IsMounted(mountPoint); mounted {
+		t.Error("Volume should be unmounted")
+	}
+
+	// Close tears down the mount, mapping and loop device
+	if err := vol.Mount(context.Background(), mountPoint, nil); err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	if err := vol.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if IsUnlocked("test-handle") {
+		t.Error("Mapping should be closed")
+	}
+	if found, err := FindLoopDevice(volumePath); err == nil {
+		_ = DetachLoopDevice(found)
+		t.Errorf("Loop device %s left attached", found)
+	}
+	if _, err := vol.Status(); !errors.Is(err, ErrVolumeClosed) {
+		t.Errorf("Status after Close: expected ErrVolumeClosed, got %v", err)
+	}
+}
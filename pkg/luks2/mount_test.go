@@ -2,7 +2,7 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
-//go:build !integration
+//go:build !integration && linux
 
 package luks2
 
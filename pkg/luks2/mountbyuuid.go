@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// mapperWaitTimeout bounds how long MountByUUID waits for the mapper node
+// when the context has no earlier deadline
+const mapperWaitTimeout = 10 * time.Second
+
+// MapperNameForUUID returns the device-mapper name MountByUUID opens a
+// volume as ("luks-<uuid>", the same convention as systemd-cryptsetup)
+func MapperNameForUUID(uuid string) string {
+	return "luks-" + strings.ToLower(strings.TrimSpace(uuid))
+}
+
+// MountByUUID locates the LUKS2 volume with the given header UUID, unlocks it
+// with the first credential in creds that opens a keyslot, waits for the
+// mapper node, detects the filesystem and mounts it at mountpoint.
+//
+// The volume is opened as MapperNameForUUID(uuid). If it is already unlocked
+// the existing mapping is reused. If a later step fails, a mapping created by
+// this call is closed again so no half-open volume is left behind.
+func MountByUUID(ctx context.Context, uuid, mountpoint string, creds CredentialSource) error {
+	if _, err := os.Stat(mountpoint); err != nil {
+		return fmt.Errorf("mount point %s does not exist", mountpoint)
+	}
+	if mounted, err := IsMounted(mountpoint); err == nil && mounted {
+		return fmt.Errorf("%w: %s", ErrAlreadyMounted, mountpoint)
+	}
+
+	device, err := FindDeviceByUUID(uuid)
+	if err != nil {
+		return err
+	}
+
+	name := MapperNameForUUID(uuid)
+	unlockedHere := false
+	if !IsUnlocked(name) {
+		req := CredentialRequest{Device: device, UUID: uuid, Name: name}
+		if id, err := readLUKS2Identity(device); err == nil {
+			req.UUID = id.UUID
+			req.Label = id.Label
+		}
+
+		if err := unlockWithCredentials(ctx, device, name, req, creds); err != nil {
+			return err
+		}
+		unlockedHere = true
+	}
+
+	if err := mountMapped(ctx, name, mountpoint); err != nil {
+		if unlockedHere {
+			_ = Lock(name)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// mountMapped waits for an unlocked volume's device node and mounts it,
+// letting Mount detect the filesystem
+func mountMapped(ctx context.Context, name, mountpoint string) error {
+	if _, err := waitForMappedDevice(ctx, name); err != nil {
+		return err
+	}
+
+	return Mount(MountOptions{
+		Device:     name,
+		MountPoint: mountpoint,
+	})
+}
+
+// waitForMappedDevice polls until the mapper device node for name exists
+func waitForMappedDevice(ctx context.Context, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, mapperWaitTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	mapperPath := "/dev/mapper/" + name
+	for {
+		if fi, err := os.Stat(mapperPath); err == nil && fi.Mode()&os.ModeDevice != 0 {
+			return mapperPath, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			// Fall back to the dm-N node for environments without udev
+			if path, err := GetMappedDevicePath(name); err == nil {
+				if _, err := os.Stat(path); err == nil {
+					return path, nil
+				}
+			}
+			return "", fmt.Errorf("device %s not ready: %w", mapperPath, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMapperNameForUUID(t *testing.T) {
+	got := MapperNameForUUID(" 0F8B2A6C-1D2E-4F3A-9B8C-7D6E5F4A3B2C ")
+	want := "luks-0f8b2a6c-1d2e-4f3a-9b8c-7d6e5f4a3b2c"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestMountByUUID_MissingMountPoint(t *testing.T) {
+	err := MountByUUID(context.Background(), "0f8b2a6c-1d2e-4f3a-9b8c-7d6e5f4a3b2c", "/nonexistent/mountpoint", StaticCredential("secret"))
+	if err == nil {
+		t.Error("expected error for missing mount point")
+	}
+}
+
+func TestMountByUUID_DeviceNotFound(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	addFakeBlockDevice(t, sys, dev, "sda", "2048", make([]byte, 4096))
+
+	err := MountByUUID(context.Background(), "0f8b2a6c-1d2e-4f3a-9b8c-7d6e5f4a3b2c", t.TempDir(), StaticCredential("secret"))
+	if !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrInvalidMountOption indicates a mount option is not valid for the filesystem
+var ErrInvalidMountOption = errors.New("invalid mount option")
+
+// DataSafety selects the journaling data mode for a mount
+type DataSafety string
+
+const (
+	// DataSafetyDefault leaves the filesystem's default data mode in place
+	DataSafetyDefault DataSafety = ""
+
+	// DataSafetyJournal journals file data as well as metadata (safest, slowest)
+	DataSafetyJournal DataSafety = "journal"
+
+	// DataSafetyOrdered writes file data before committing the metadata that
+	// references it (ext3/ext4 default)
+	DataSafetyOrdered DataSafety = "ordered"
+
+	// DataSafetyWriteback journals metadata only; after a crash, recently
+	// written files may contain stale data (fastest)
+	DataSafetyWriteback DataSafety = "writeback"
+)
+
+// genericMountFlag maps a filesystem-independent option to the mount(2)
+// flag it sets or clears
+type genericMountFlag struct {
+	set   uintptr
+	clear uintptr
+}
+
+// genericMountFlags are VFS-level options that mount(8) translates to
+// mount(2) flags; the kernel filesystem drivers reject them as data
+var genericMountFlags = map[string]genericMountFlag{
+	"ro":          {set: unix.MS_RDONLY},
+	"rw":          {clear: unix.MS_RDONLY},
+	"nosuid":      {set: unix.MS_NOSUID},
+	"suid":        {clear: unix.MS_NOSUID},
+	"nodev":       {set: unix.MS_NODEV},
+	"dev":         {clear: unix.MS_NODEV},
+	"noexec":      {set: unix.MS_NOEXEC},
+	"exec":        {clear: unix.MS_NOEXEC},
+	"sync":        {set: unix.MS_SYNCHRONOUS},
+	"async":       {clear: unix.MS_SYNCHRONOUS},
+	"dirsync":     {set: unix.MS_DIRSYNC},
+	"noatime":     {set: unix.MS_NOATIME},
+	"atime":       {clear: unix.MS_NOATIME},
+	"nodiratime":  {set: unix.MS_NODIRATIME},
+	"diratime":    {clear: unix.MS_NODIRATIME},
+	"relatime":    {set: unix.MS_RELATIME},
+	"norelatime":  {clear: unix.MS_RELATIME},
+	"strictatime": {set: unix.MS_STRICTATIME},
+	"lazytime":    {set: unix.MS_LAZYTIME},
+	"nolazytime":  {clear: unix.MS_LAZYTIME},
+}
+
+// ext2MountOptions are the options accepted by the ext2 driver
+var ext2MountOptions = []string{
+	"acl", "noacl", "user_xattr", "nouser_xattr", "errors", "resuid", "resgid",
+	"sb", "grpid", "nogrpid", "bsdgroups", "sysvgroups", "minixdf", "bsddf",
+	"check", "nocheck", "debug", "nouid32", "usrquota", "grpquota", "quota",
+	"noquota", "dax",
+}
+
+// ext3MountOptions are the options the ext4 driver accepts for ext3 volumes
+var ext3MountOptions = append([]string{
+	"data", "journal_dev", "journal_path", "commit", "barrier", "nobarrier",
+	"noload", "norecovery", "journal_checksum", "nojournal_checksum",
+	"usrjquota", "grpjquota", "jqfmt",
+}, ext2MountOptions...)
+
+// ext4MountOptions are the options accepted by the ext4 driver
+var ext4MountOptions = append([]string{
+	"data_err", "journal_async_commit", "journal_ioprio", "discard", "nodiscard",
+	"delalloc", "nodelalloc", "inode_readahead_blks", "stripe", "max_batch_time",
+	"min_batch_time", "init_itable", "noinit_itable", "block_validity",
+	"noblock_validity", "auto_da_alloc", "noauto_da_alloc", "i_version",
+	"nombcache", "prjquota", "dioread_lock", "dioread_nolock", "max_dir_size_kb",
+	"test_dummy_encryption", "inlinecrypt",
+}, ext3MountOptions...)
+
+// filesystemMountOptions lists the data options each filesystem accepts.
+// Filesystems without an entry are passed through unvalidated.
+var filesystemMountOptions = map[FilesystemType][]string{
+	FilesystemExt2: ext2MountOptions,
+	FilesystemExt3: ext3MountOptions,
+	FilesystemExt4: ext4MountOptions,
+	FilesystemXFS: {
+		"allocsize", "attr2", "noattr2", "dax", "discard", "nodiscard", "grpid",
+		"nogrpid", "bsdgroups", "sysvgroups", "filestreams", "ikeep", "noikeep",
+		"inode32", "inode64", "largeio", "nolargeio", "logbufs", "logbsize",
+		"logdev", "rtdev", "noalign", "norecovery", "nouuid", "noquota",
+		"uquota", "usrquota", "uqnoenforce", "quota", "gquota", "grpquota",
+		"gqnoenforce", "pquota", "prjquota", "pqnoenforce", "sunit", "swidth",
+		"swalloc", "wsync",
+	},
+	FilesystemFAT32: {
+		"uid", "gid", "umask", "dmask", "fmask", "allow_utime", "codepage",
+		"iocharset", "tz", "time_offset", "quiet", "showexec", "sys_immutable",
+		"flush", "usefree", "dots", "nodots", "dotsOK", "check", "shortname",
+		"uni_xlate", "posix", "nonumtail", "utf8", "errors", "discard", "nfs",
+		"rodir", "debug",
+	},
+}
+
+// dataSafetyFilesystems lists the filesystems that support data= modes
+var dataSafetyFilesystems = map[FilesystemType]bool{
+	FilesystemExt3: true,
+	FilesystemExt4: true,
+}
+
+// ValidateMountOptions checks a comma-separated mount option string against
+// the options supported by fstype. Generic options (ro, noatime, nosuid, ...)
+// are accepted for every filesystem.
+func ValidateMountOptions(fstype FilesystemType, data string) error {
+	_, _, err := parseMountOptions(fstype, data, 0)
+	return err
+}
+
+// parseMountOptions applies the generic options in data to flags and returns
+// the updated flags and the remaining filesystem-specific data string
+func parseMountOptions(fstype FilesystemType, data string, flags uintptr) (uintptr, string, error) {
+	var fsOptions []string
+
+	allowed, validated := filesystemMountOptions[fstype]
+
+	for _, opt := range strings.Split(data, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		if flag, ok := genericMountFlags[opt]; ok {
+			flags = (flags | flag.set) &^ flag.clear
+			continue
+		}
+
+		if validated {
+			key, _, _ := strings.Cut(opt, "=")
+			if !slices.Contains(allowed, key) {
+				return 0, "", fmt.Errorf("%w: %q is not supported by %s", ErrInvalidMountOption, key, fstype)
+			}
+		}
+
+		fsOptions = append(fsOptions, opt)
+	}
+
+	return flags, strings.Join(fsOptions, ","), nil
+}
+
+// buildMountData validates MountOptions for fstype and returns the final
+// mount(2) flags and data string, applying the DataSafety preset
+func buildMountData(fstype FilesystemType, opts MountOptions) (uintptr, string, error) {
+	flags, data, err := parseMountOptions(fstype, opts.Data, opts.Flags)
+	if err != nil {
+		return 0, "", err
+	}
+
+	switch opts.DataSafety {
+	case DataSafetyDefault:
+		return flags, data, nil
+	case DataSafetyJournal, DataSafetyOrdered, DataSafetyWriteback:
+	default:
+		return 0, "", fmt.Errorf("%w: unknown data safety mode %q (supported: %s)", ErrInvalidMountOption, opts.DataSafety, strings.Join(dataSafetyModes(), ", "))
+	}
+
+	if !dataSafetyFilesystems[fstype] {
+		return 0, "", fmt.Errorf("%w: data safety mode %q is not supported by %s", ErrInvalidMountOption, opts.DataSafety, fstype)
+	}
+
+	for _, opt := range strings.Split(data, ",") {
+		if strings.HasPrefix(opt, "data=") {
+			return 0, "", fmt.Errorf("%w: %q conflicts with DataSafety %q", ErrInvalidMountOption, opt, opts.DataSafety)
+		}
+	}
+
+	mode := "data=" + string(opts.DataSafety)
+	if data == "" {
+		return flags, mode, nil
+	}
+	return flags, data + "," + mode, nil
+}
+
+// dataSafetyModes returns the supported DataSafety values
+func dataSafetyModes() []string {
+	return []string{string(DataSafetyJournal), string(DataSafetyOrdered), string(DataSafetyWriteback)}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestValidateMountOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		fstype  FilesystemType
+		data    string
+		wantErr bool
+	}{
+		{"empty", FilesystemExt4, "", false},
+		{"generic on vfat", FilesystemFAT32, "ro,noatime", false},
+		{"ext4 options", FilesystemExt4, "discard,commit=30,data=ordered,errors=remount-ro", false},
+		{"vfat options", FilesystemFAT32, "uid=1000,gid=1000,umask=077,utf8", false},
+		{"xfs options", FilesystemXFS, "inode64,logbufs=8,nouuid", false},
+		{"ext4 option on vfat", FilesystemFAT32, "data=journal", true},
+		{"ext4-only option on ext2", FilesystemExt2, "delalloc", true},
+		{"journal option on ext2", FilesystemExt2, "data=ordered", true},
+		{"vfat option on xfs", FilesystemXFS, "umask=077", true},
+		{"unknown option", FilesystemExt4, "bogus", true},
+		{"unvalidated filesystem", FilesystemZFS, "anything=goes", false},
+		{"whitespace and empty entries", FilesystemExt4, " noatime, ,discard ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMountOptions(tt.fstype, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMountOptions(%s, %q) error = %v, wantErr %v", tt.fstype, tt.data, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidMountOption) {
+				t.Errorf("expected ErrInvalidMountOption, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildMountData(t *testing.T) {
+	tests := []struct {
+		name      string
+		fstype    FilesystemType
+		opts      MountOptions
+		wantFlags uintptr
+		wantData  string
+		wantErr   bool
+	}{
+		{
+			name:      "generic options become flags",
+			fstype:    FilesystemExt4,
+			opts:      MountOptions{Data: "ro,noatime,discard"},
+			wantFlags: unix.MS_RDONLY | unix.MS_NOATIME,
+			wantData:  "discard",
+		},
+		{
+			name:      "rw clears caller flag",
+			fstype:    FilesystemExt4,
+			opts:      MountOptions{Flags: unix.MS_RDONLY | unix.MS_NOSUID, Data: "rw"},
+			wantFlags: unix.MS_NOSUID,
+		},
+		{
+			name:     "data safety preset",
+			fstype:   FilesystemExt4,
+			opts:     MountOptions{Data: "discard", DataSafety: DataSafetyJournal},
+			wantData: "discard,data=journal",
+		},
+		{
+			name:     "data safety without other options",
+			fstype:   FilesystemExt3,
+			opts:     MountOptions{DataSafety: DataSafetyWriteback},
+			wantData: "data=writeback",
+		},
+		{
+			name:    "data safety on vfat",
+			fstype:  FilesystemFAT32,
+			opts:    MountOptions{DataSafety: DataSafetyOrdered},
+			wantErr: true,
+		},
+		{
+			name:    "data safety conflicts with data option",
+			fstype:  FilesystemExt4,
+			opts:    MountOptions{Data: "data=ordered", DataSafety: DataSafetyJournal},
+			wantErr: true,
+		},
+		{
+			name:    "unknown data safety",
+			fstype:  FilesystemExt4,
+			opts:    MountOptions{DataSafety: "paranoid"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, data, err := buildMountData(tt.fstype, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMountData error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidMountOption) {
+					t.Errorf("expected ErrInvalidMountOption, got %v", err)
+				}
+				return
+			}
+			if flags != tt.wantFlags {
+				t.Errorf("flags = %#x, want %#x", flags, tt.wantFlags)
+			}
+			if data != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
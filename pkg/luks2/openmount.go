@@ -0,0 +1,189 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenMountOptions contains optional settings for OpenAndMount
+type OpenMountOptions struct {
+	// Name is the device-mapper name (empty = MapperNameForUUID of the
+	// volume's UUID)
+	Name string
+
+	// Unlock holds the dm-crypt options for the mapping (nil = defaults)
+	Unlock *UnlockOptions
+
+	// FSType, Flags, Data and DataSafety are passed to Mount. An empty
+	// FSType is detected.
+	FSType     string
+	Flags      uintptr
+	Data       string
+	DataSafety DataSafety
+
+	// CreateMountPoint creates a missing mount point directory
+	CreateMountPoint bool
+}
+
+// MountedVolume is a volume opened and mounted by OpenAndMount
+type MountedVolume struct {
+	Device     string         // Device or image file that was opened
+	LoopDevice string         // Loop device attached for an image file ("" for block devices)
+	Name       string         // Device-mapper name
+	MountPoint string         // Where the filesystem is mounted
+	FSType     FilesystemType // Mounted filesystem type
+}
+
+// OpenAndMount opens a LUKS2 device or image file and mounts its filesystem
+// in one call: an image file is attached to a loop device, the volume is
+// unlocked, its filesystem detected and mounted at mountPoint. The device may
+// also be given as UUID=<uuid> or LABEL=<label>.
+//
+// A loop device attached by this call detaches itself when the volume is
+// locked. If any step fails, everything set up by this call is undone.
+// Open returns a handle for callers that want to keep track of the volume.
+func OpenAndMount(ctx context.Context, device, mountPoint string, passphrase []byte, opts *OpenMountOptions) (*MountedVolume, error) {
+	if opts == nil {
+		opts = &OpenMountOptions{}
+	}
+
+	// Check the mount point before anything is set up
+	if err := prepareMountPoint(mountPoint, opts.CreateMountPoint); err != nil {
+		return nil, err
+	}
+
+	vol, err := Open(device, passphrase, &OpenOptions{Name: opts.Name, Unlock: opts.Unlock})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vol.Mount(ctx, mountPoint, &VolumeMountOptions{
+		FSType:     opts.FSType,
+		Flags:      opts.Flags,
+		Data:       opts.Data,
+		DataSafety: opts.DataSafety,
+	}); err != nil {
+		_ = vol.Close()
+		return nil, err
+	}
+
+	return &MountedVolume{
+		Device:     vol.Device(),
+		LoopDevice: vol.LoopDevice(),
+		Name:       vol.Name(),
+		MountPoint: mountPoint,
+		FSType:     vol.FSType(),
+	}, nil
+}
+
+// prepareMountPoint checks that mountPoint exists, creating it if create is
+// set, and that nothing is mounted on it
+func prepareMountPoint(mountPoint string, create bool) error {
+	if _, err := os.Stat(mountPoint); os.IsNotExist(err) && create {
+		if err := os.MkdirAll(mountPoint, 0750); err != nil {
+			return fmt.Errorf("failed to create %s: %w", mountPoint, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("mount point %s does not exist", mountPoint)
+	}
+	if mounted, err := IsMounted(mountPoint); err == nil && mounted {
+		return fmt.Errorf("%w: %s", ErrAlreadyMounted, mountPoint)
+	}
+	return nil
+}
+
+// Close unmounts and locks the volume. Its loop device, if any, detaches
+// along with the mapping.
+func (v *MountedVolume) Close() error {
+	if err := Unmount(v.MountPoint, 0); err != nil {
+		return err
+	}
+	return Lock(v.Name)
+}
+
+// UnmountAndClose reverses OpenAndMount for whatever is mounted at
+// mountPoint: the filesystem is unmounted and the device-mapper mapping
+// behind it locked. Loop devices attached by OpenAndMount detach with the
+// mapping.
+func UnmountAndClose(mountPoint string) error {
+	source, err := mountSourceOf(mountPoint)
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		return fmt.Errorf("%w: %s", ErrNotMounted, mountPoint)
+	}
+
+	name, err := dmNameOf(source)
+	if err != nil {
+		return err
+	}
+
+	if err := Unmount(mountPoint, 0); err != nil {
+		return err
+	}
+	return Lock(name)
+}
+
+// mountSourceOf returns the device mounted at mountPoint, or "" if nothing is
+func mountSourceOf(mountPoint string) (string, error) {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return "", fmt.Errorf("failed to open /proc/mounts: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return findMountSource(file, filepath.Clean(mountPoint))
+}
+
+// findMountSource scans a mounts table for the source of the last mount on
+// mountPoint, which is the one visible when mounts are stacked
+func findMountSource(r io.Reader, mountPoint string) (string, error) {
+	var source string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[1] == mountPoint {
+			source = fields[0]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading /proc/mounts: %w", err)
+	}
+
+	return source, nil
+}
+
+// dmNameOf returns the device-mapper name of a /dev/mapper/<name> or
+// /dev/dm-N device node
+func dmNameOf(devicePath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		resolved = devicePath
+	}
+
+	kernelName := filepath.Base(resolved)
+	if strings.HasPrefix(kernelName, "dm-") {
+		if name := readSysfsAttr(filepath.Join(sysfsRoot, "block", kernelName), "dm/name"); name != "" {
+			return name, nil
+		}
+	}
+	// Without udev, /dev/mapper/<name> may be a device node of its own
+	if filepath.Dir(devicePath) == filepath.Join(devRoot, "mapper") {
+		return filepath.Base(devicePath), nil
+	}
+
+	return "", fmt.Errorf("%s is not a device-mapper device", devicePath)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFindMountSource tests finding the device mounted on a path
+func TestFindMountSource(t *testing.T) {
+	mounts := "/dev/sda1 / ext4 rw 0 0\n" +
+		"/dev/mapper/data /mnt/data ext4 rw 0 0\n" +
+		"/dev/mapper/over /mnt/data xfs rw 0 0\n"
+
+	got, err := findMountSource(strings.NewReader(mounts), "/mnt/data")
+	if err != nil || got != "/dev/mapper/over" {
+		t.Errorf("findMountSource() = %q, %v; want the topmost mount", got, err)
+	}
+
+	got, err = findMountSource(strings.NewReader(mounts), "/mnt/other")
+	if err != nil || got != "" {
+		t.Errorf("findMountSource() = %q, %v; want not mounted", got, err)
+	}
+}
+
+// TestDMNameOf tests resolving device-mapper names from device nodes
+func TestDMNameOf(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	makeSysfsDevice(t, sys, filepath.Join("block", "dm-2"), map[string]string{"dm/name": "secret"})
+
+	dmNode := filepath.Join(dev, "dm-2")
+	if err := os.WriteFile(dmNode, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dev, "mapper"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dev, "mapper", "secret")
+	if err := os.Symlink(dmNode, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{dmNode, "secret", false},
+		{link, "secret", false},
+		{filepath.Join(dev, "mapper", "nodev"), "nodev", false},
+		{filepath.Join(dev, "sda1"), "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := dmNameOf(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("dmNameOf(%s) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+// TestOpenAndMount_Errors tests failures before anything is set up
+func TestOpenAndMount_Errors(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "plain.img")
+	if err := os.WriteFile(image, make([]byte, 64*1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	pass := []byte("test-passphrase")
+
+	if _, err := OpenAndMount(ctx, image, filepath.Join(dir, "missing"), pass, nil); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected missing mount point error, got %v", err)
+	}
+	if _, err := OpenAndMount(ctx, image, "/", pass, nil); !errors.Is(err, ErrAlreadyMounted) {
+		t.Errorf("expected ErrAlreadyMounted, got %v", err)
+	}
+	if _, err := OpenAndMount(ctx, image, dir, pass, nil); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+
+	created := filepath.Join(dir, "created")
+	if _, err := OpenAndMount(ctx, image, created, pass, &OpenMountOptions{CreateMountPoint: true}); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+	if _, err := os.Stat(created); err != nil {
+		t.Errorf("mount point was not created: %v", err)
+	}
+}
+
+// TestUnmountAndClose_NotMounted tests tearing down a path with nothing mounted
+func TestUnmountAndClose_NotMounted(t *testing.T) {
+	if err := UnmountAndClose(t.TempDir()); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("expected ErrNotMounted, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// memoryBudget limits the total memory held by concurrent key derivations.
+// A single derivation is always admitted, even if it exceeds the budget on
+// its own, so unlocking never deadlocks on an oversized keyslot.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64 // <= 0 means unlimited
+	used  int64
+	count int
+}
+
+// newMemoryBudget creates a budget of limit bytes
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until cost bytes fit in the budget or ctx is done
+func (b *memoryBudget) acquire(ctx context.Context, cost int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.count > 0 && b.limit > 0 && b.used+cost > b.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		b.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	b.used += cost
+	b.count++
+	return true
+}
+
+// release returns cost bytes to the budget
+func (b *memoryBudget) release(cost int64) {
+	b.mu.Lock()
+	b.used -= cost
+	b.count--
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// wake unblocks waiters so they can observe cancellation
+func (b *memoryBudget) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// getMasterKeyParallel tries the given keyslots with up to parallel
+// concurrent key derivations whose combined Argon2 memory stays within
+// memoryLimit bytes. It returns as soon as one keyslot yields a master key
+// that matches the digest, along with that keyslot; derivations already in
+// flight finish in the background and their results are zeroized.
+func getMasterKeyParallel(device string, passphrase []byte, metadata *LUKS2Metadata, keyslots []*Keyslot, parallel int, memoryLimit int64) (*securemem.Buffer, *Keyslot, error) {
+	if len(keyslots) == 0 {
+		return nil, nil, ErrInvalidPassphrase
+	}
+	if parallel > len(keyslots) {
+		parallel = len(keyslots)
+	}
+
+	// Workers may outlive this call, so they use a private copy of the
+	// passphrase that is destroyed once the last derivation finishes
+	passBuf, err := securemem.New(len(passphrase))
+	if err != nil {
+		return nil, nil, err
+	}
+	pass := passBuf.Bytes()
+	copy(pass, passphrase)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	budget := newMemoryBudget(memoryLimit)
+	work := make(chan *Keyslot)
+	type result struct {
+		mk      *securemem.Buffer
+		keyslot *Keyslot
+	}
+	found := make(chan result, 1)
+
+	var (
+		skipErrMu sync.Mutex
+		skipErr   error
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for keyslot := range work {
+				cost := kdfMemoryCost(keyslot.KDF)
+				if !budget.acquire(ctx, cost) {
+					continue
+				}
+				mk, err := unlockKeyslot(device, pass, keyslot, metadata.Digests)
+				budget.release(cost)
+				if err != nil {
+					if keyslotSkipped(err) {
+						skipErrMu.Lock()
+						skipErr = err
+						skipErrMu.Unlock()
+					}
+					continue
+				}
+
+				select {
+				case found <- result{mk, keyslot}:
+					cancel()
+				default:
+					// Another worker already won; discard this copy
+					mk.Destroy()
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(work)
+		for _, keyslot := range keyslots {
+			select {
+			case work <- keyslot:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		budget.wake()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		passBuf.Destroy()
+		close(done)
+	}()
+
+	select {
+	case r := <-found:
+		return r.mk, r.keyslot, nil
+	case <-done:
+		// All workers finished; a match may have raced with completion
+		select {
+		case r := <-found:
+			return r.mk, r.keyslot, nil
+		default:
+			skipErrMu.Lock()
+			defer skipErrMu.Unlock()
+			return nil, nil, unlockFailure(skipErr)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// addTestKeys adds count extra passphrases ("extra-passphrase-0", ...) to a volume
+func addTestKeys(t *testing.T, device string, existing []byte, count int) [][]byte {
+	t.Helper()
+	var passphrases [][]byte
+	for i := 0; i < count; i++ {
+		pass := []byte(fmt.Sprintf("extra-passphrase-%d", i))
+		if err := AddKey(device, existing, pass, &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+			t.Fatalf("AddKey failed: %v", err)
+		}
+		passphrases = append(passphrases, pass)
+	}
+	return passphrases
+}
+
+// TestGetMasterKeyWithOptions_Parallel tests that parallel and serial unlock agree
+func TestGetMasterKeyWithOptions_Parallel(t *testing.T) {
+	first := []byte("test-password")
+	device := formatTestVolume(t, first)
+	extra := addTestKeys(t, device, first, 3)
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	serial, _, err := getMasterKeyWithOptions(device, first, metadata, &UnlockOptions{})
+	if err != nil {
+		t.Fatalf("serial unlock failed: %v", err)
+	}
+	defer serial.Destroy()
+
+	for i, pass := range append([][]byte{first}, extra...) {
+		mk, slot, err := getMasterKeyWithOptions(device, pass, metadata, &UnlockOptions{Parallel: 4})
+		if err != nil {
+			t.Fatalf("parallel unlock with %q failed: %v", pass, err)
+		}
+		if slot != i {
+			t.Errorf("parallel unlock with %q opened keyslot %d, want %d", pass, slot, i)
+		}
+		if !bytes.Equal(mk.Bytes(), serial.Bytes()) {
+			t.Errorf("parallel unlock with %q returned a different master key", pass)
+		}
+		mk.Destroy()
+	}
+
+	if _, _, err := getMasterKeyWithOptions(device, []byte("wrong-password"), metadata, &UnlockOptions{Parallel: 4, MemoryLimit: 1}); err == nil {
+		t.Error("expected parallel unlock with wrong passphrase to fail")
+	}
+}
+
+// TestGetMasterKeyWithOptions_Keyslot tests explicit keyslot selection
+func TestGetMasterKeyWithOptions_Keyslot(t *testing.T) {
+	first := []byte("test-password")
+	device := formatTestVolume(t, first)
+	addTestKeys(t, device, first, 1)
+
+	if err := SetKeyslotPriority(device, 0, KeyslotPriorityIgnore); err != nil {
+		t.Fatalf("SetKeyslotPriority failed: %v", err)
+	}
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	if _, _, err := getMasterKeyWithOptions(device, first, metadata, &UnlockOptions{}); err == nil {
+		t.Error("expected ignored keyslot to be skipped")
+	}
+
+	slot := 0
+	mk, _, err := getMasterKeyWithOptions(device, first, metadata, &UnlockOptions{Keyslot: &slot})
+	if err != nil {
+		t.Fatalf("explicit keyslot unlock failed: %v", err)
+	}
+	mk.Destroy()
+
+	missing := 9
+	if _, _, err := getMasterKeyWithOptions(device, first, metadata, &UnlockOptions{Keyslot: &missing}); !errors.Is(err, ErrInvalidKeyslot) {
+		t.Errorf("missing keyslot error = %v, want ErrInvalidKeyslot", err)
+	}
+}
+
+// TestMemoryBudget tests that the budget serializes oversized derivations
+func TestMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBudget(100)
+
+	// An oversized first request is always admitted
+	if !b.acquire(ctx, 500) {
+		t.Fatal("first acquire should succeed")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- b.acquire(ctx, 10) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("second acquire should block while over budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.release(500)
+	if !<-acquired {
+		t.Error("second acquire should succeed after release")
+	}
+	b.release(10)
+}
+
+// TestMemoryBudget_Cancel tests that waiters observe cancellation
+func TestMemoryBudget_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := newMemoryBudget(100)
+	if !b.acquire(ctx, 100) {
+		t.Fatal("first acquire should succeed")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- b.acquire(ctx, 100) }()
+
+	cancel()
+	b.wake()
+	if <-acquired {
+		t.Error("acquire should fail after cancellation")
+	}
+}
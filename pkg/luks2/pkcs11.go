@@ -0,0 +1,328 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// TokenTypePKCS11 is the token type of keyslots unlocked with a key on a
+// PKCS#11 token. The format is that of systemd-cryptenroll --pkcs11-token-uri.
+const TokenTypePKCS11 = "systemd-pkcs11"
+
+// Schemes wrapping the keyslot secret of a PKCS#11 token
+const (
+	// PKCS11WrapRSAPKCS1 encrypts the secret with RSAES-PKCS1-v1_5, as
+	// systemd does for RSA keys
+	PKCS11WrapRSAPKCS1 = "rsa-pkcs1"
+
+	// PKCS11WrapRSAOAEP encrypts the secret with RSA-OAEP using SHA-256.
+	// systemd-cryptsetup cannot unlock these tokens.
+	PKCS11WrapRSAOAEP = "rsa-oaep-sha256"
+
+	// PKCS11WrapECDH derives the secret by ECDH between the token key and
+	// an ephemeral key stored in the token, as systemd does for EC keys
+	PKCS11WrapECDH = "ecdh"
+)
+
+// pkcs11SecretSize is the size of the random secret wrapped for RSA keys
+const pkcs11SecretSize = 32
+
+// ErrNoPKCS11Token is returned when a volume has no PKCS#11 token the key
+// can be used with
+var ErrNoPKCS11Token = errors.New("no PKCS#11 token")
+
+// PKCS11Key is a private key on a smartcard or HSM, as exposed by a PKCS#11
+// binding such as the pkcs11 subpackage. RSA keys implement crypto.Decrypter
+// and EC keys PKCS11ECDH. Software keys (*rsa.PrivateKey, *ecdh.PrivateKey)
+// satisfy it too.
+type PKCS11Key interface {
+	Public() crypto.PublicKey
+}
+
+// PKCS11ECDH is implemented by EC keys that perform ECDH on the token
+type PKCS11ECDH interface {
+	ECDH(remote *ecdh.PublicKey) ([]byte, error)
+}
+
+// PKCS11Options contains optional settings for EnrollPKCS11
+type PKCS11Options struct {
+	// OAEP wraps the secret for an RSA key with RSA-OAEP instead of
+	// systemd's PKCS#1 v1.5, which systemd-cryptsetup then cannot unlock
+	OAEP bool
+
+	// AddKey configures the new keyslot (nil = PBKDF2 with minimal cost,
+	// since the passphrase is a random secret, as systemd-cryptenroll does)
+	AddKey *AddKeyOptions
+}
+
+// EnrollPKCS11 adds a keyslot unlocked by the private key belonging to pub,
+// which lives on the PKCS#11 token at uri, and stores the wrapped secret in
+// a new token. Only the public key is needed (typically from the token's
+// certificate), so no PIN is asked for. It returns the keyslot and token IDs.
+func EnrollPKCS11(device string, existingPassphrase []byte, uri string, pub crypto.PublicKey, opts *PKCS11Options) (int, int, error) {
+	if opts == nil {
+		opts = &PKCS11Options{}
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return -1, -1, err
+	}
+
+	token, secret, err := wrapPKCS11Secret(pub, opts.OAEP)
+	if err != nil {
+		return -1, -1, err
+	}
+	defer clearBytes(secret)
+	token.PKCS11URI = uri
+
+	passphrase := pkcs11Passphrase(secret)
+	defer clearBytes(passphrase)
+
+	addOpts := &AddKeyOptions{KDFType: "pbkdf2", Hash: "sha512", PBKDFIterTime: 1}
+	if opts.AddKey != nil {
+		copied := *opts.AddKey
+		addOpts = &copied
+	}
+	if addOpts.Keyslot == nil {
+		_, metadata, err := readHeader(device)
+		if err != nil {
+			return -1, -1, err
+		}
+		slot, err := findAvailableKeyslot(metadata, addOpts)
+		if err != nil {
+			return -1, -1, err
+		}
+		addOpts.Keyslot = &slot
+	}
+	keyslot := *addOpts.Keyslot
+
+	if err := AddKey(device, existingPassphrase, passphrase, addOpts); err != nil {
+		return -1, -1, err
+	}
+	token.Keyslots = []string{strconv.Itoa(keyslot)}
+
+	tokenID, err := FindFreeTokenSlot(device)
+	if err == nil {
+		err = ImportToken(device, tokenID, token)
+	}
+	if err != nil {
+		return keyslot, -1, fmt.Errorf("keyslot %d added but token not stored: %w", keyslot, err)
+	}
+	return keyslot, tokenID, nil
+}
+
+// wrapPKCS11Secret creates the keyslot secret for pub and the token holding
+// it in wrapped form
+func wrapPKCS11Secret(pub crypto.PublicKey, oaep bool) (*Token, []byte, error) {
+	token := &Token{Type: TokenTypePKCS11}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		secret := make([]byte, pkcs11SecretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		var wrapped []byte
+		var err error
+		if oaep {
+			token.PKCS11KeyWrap = PKCS11WrapRSAOAEP
+			wrapped, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, secret, nil)
+		} else {
+			wrapped, err = rsa.EncryptPKCS1v15(rand.Reader, pub, secret)
+		}
+		if err != nil {
+			clearBytes(secret)
+			return nil, nil, fmt.Errorf("failed to wrap secret: %w", err)
+		}
+		token.PKCS11Key = base64.StdEncoding.EncodeToString(wrapped)
+		return token, secret, nil
+
+	case *ecdsa.PublicKey, *ecdh.PublicKey:
+		remote, err := toECDH(pub)
+		if err != nil {
+			return nil, nil, err
+		}
+		ephemeral, err := remote.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		secret, err := ephemeral.ECDH(remote)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.PKCS11Key = base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes())
+		return token, secret, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported PKCS#11 key type %T (want RSA or EC)", pub)
+}
+
+// toECDH converts an EC public key for use with crypto/ecdh
+func toECDH(pub crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch pub := pub.(type) {
+	case *ecdh.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		return pub.ECDH()
+	}
+	return nil, fmt.Errorf("not an EC key: %T", pub)
+}
+
+// unwrapPKCS11Secret recovers the keyslot secret of token with key
+func unwrapPKCS11Secret(key PKCS11Key, token *Token) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(token.PKCS11Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs11-key: %w", err)
+	}
+
+	switch token.PKCS11KeyWrap {
+	case "", PKCS11WrapRSAPKCS1, PKCS11WrapRSAOAEP:
+		if _, isRSA := key.Public().(*rsa.PublicKey); isRSA {
+			decrypter, ok := key.(crypto.Decrypter)
+			if !ok {
+				return nil, fmt.Errorf("RSA key %T cannot decrypt", key)
+			}
+			var opts crypto.DecrypterOpts = &rsa.PKCS1v15DecryptOptions{}
+			if token.PKCS11KeyWrap == PKCS11WrapRSAOAEP {
+				opts = &rsa.OAEPOptions{Hash: crypto.SHA256}
+			}
+			return decrypter.Decrypt(rand.Reader, data, opts)
+		}
+		if token.PKCS11KeyWrap != "" {
+			return nil, fmt.Errorf("token wraps for an RSA key")
+		}
+		fallthrough
+	case PKCS11WrapECDH:
+		deriver, ok := key.(PKCS11ECDH)
+		if !ok {
+			return nil, fmt.Errorf("key %T cannot perform ECDH", key)
+		}
+		pub, err := toECDH(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := pub.Curve().NewPublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("token wraps for another curve: %w", err)
+		}
+		return deriver.ECDH(ephemeral)
+	}
+	return nil, fmt.Errorf("unknown pkcs11-key-wrap %q", token.PKCS11KeyWrap)
+}
+
+// pkcs11Passphrase encodes a keyslot secret as its passphrase. systemd
+// base64-encodes the secret the same way.
+func pkcs11Passphrase(secret []byte) []byte {
+	passphrase := make([]byte, base64.StdEncoding.EncodedLen(len(secret)))
+	base64.StdEncoding.Encode(passphrase, secret)
+	return passphrase
+}
+
+// PKCS11TokenURI returns the URI of the first PKCS#11 token of a volume,
+// for unlocking without naming the token (systemd's pkcs11-uri=auto)
+func PKCS11TokenURI(device string) (string, error) {
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range sortedIDs(metadata.Tokens) {
+		if token := metadata.Tokens[id]; token.Type == TokenTypePKCS11 && token.PKCS11URI != "" {
+			return token.PKCS11URI, nil
+		}
+	}
+	return "", ErrNoPKCS11Token
+}
+
+// UnlockWithPKCS11 opens a volume with a key on a PKCS#11 token enrolled by
+// EnrollPKCS11 or systemd-cryptenroll. Tokens are tried in ID order; each
+// costs one private key operation on the device. The dm-crypt flags of opts
+// apply (nil = defaults).
+func UnlockWithPKCS11(device, name string, key PKCS11Key, opts *UnlockOptions) error {
+	if unlocksRegion(opts) {
+		return unlockRegion(device, opts, func(loop string, region *UnlockOptions) error {
+			return UnlockWithPKCS11(loop, name, key, region)
+		})
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if IsUnlocked(name) {
+		return fmt.Errorf("device mapper '%s' already exists - close it first with: luks close %s", name, name)
+	}
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+
+	if err := checkKernelCiphers(metadata); err != nil {
+		return err
+	}
+
+	masterKey, err := pkcs11MasterKey(device, metadata, key)
+	if err != nil {
+		return err
+	}
+	defer masterKey.Destroy()
+
+	realDevice, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		realDevice = device
+	}
+	if err := activateVolume(device, realDevice, hdr, metadata, masterKey.Bytes(), name, cryptFlags(metadata, opts)); err != nil {
+		return err
+	}
+	return autoDetachLoop(realDevice, name, opts)
+}
+
+// pkcs11MasterKey recovers the master key through the first PKCS#11 token
+// whose secret key can unwrap
+func pkcs11MasterKey(device string, metadata *LUKS2Metadata, key PKCS11Key) (*securemem.Buffer, error) {
+	var errs []error
+	for _, id := range sortedIDs(metadata.Tokens) {
+		token := metadata.Tokens[id]
+		if token.Type != TokenTypePKCS11 {
+			continue
+		}
+
+		secret, err := unwrapPKCS11Secret(key, token)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token %s: %w", id, err))
+			continue
+		}
+		passphrase := pkcs11Passphrase(secret)
+		clearBytes(secret)
+
+		for _, slot := range token.Keyslots {
+			n, err := strconv.Atoi(slot)
+			if err != nil {
+				continue
+			}
+			masterKey, _, err := getMasterKeyWithOptions(device, passphrase, metadata, &UnlockOptions{Keyslot: &n})
+			if err == nil {
+				clearBytes(passphrase)
+				return masterKey, nil
+			}
+			errs = append(errs, fmt.Errorf("token %s: keyslot %s: %w", id, slot, err))
+		}
+		clearBytes(passphrase)
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoPKCS11Token
+	}
+	return nil, fmt.Errorf("no PKCS#11 token could be unlocked with the key: %w", errors.Join(errs...))
+}
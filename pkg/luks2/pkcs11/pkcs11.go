@@ -0,0 +1,202 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pkcs11 exposes a private key on a smartcard, YubiKey or HSM as a
+// luks2.PKCS11Key by driving OpenSC's pkcs11-tool, so no cgo binding is
+// needed. The key is selected with a PKCS#11 URI, as with
+// systemd-cryptenroll --pkcs11-token-uri:
+//
+//	key, err := pkcs11.Open("pkcs11:token=YubiKey%20PIV;id=%03", pin)
+//	keyslot, tokenID, err := luks2.EnrollPKCS11(device, passphrase, key.URI(), key.Public(), nil)
+//	err = luks2.UnlockWithPKCS11(device, "data", key, nil)
+//
+// The token must hold a certificate with the same ID or label as the key,
+// which is where the public key is read from. Programs that already link a
+// PKCS#11 binding can pass its crypto.Decrypter instead.
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// toolPath is the pkcs11-tool binary. A variable so tests can substitute it.
+var toolPath = "pkcs11-tool"
+
+// pinEnv passes the PIN to pkcs11-tool, keeping it out of the process list
+const pinEnv = "LUKS2_PKCS11_PIN"
+
+// Key is a private key on a PKCS#11 token. RSA keys decrypt and EC keys
+// derive with ECDH; each operation logs in with the PIN.
+type Key struct {
+	uri  *URI
+	pin  []byte
+	cert *x509.Certificate
+}
+
+// Open selects the key named by uri and reads its certificate. pin is used
+// for private key operations (nil = the URI's pin-value, if any); Close
+// clears it.
+func Open(uri string, pin []byte) (*Key, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.ID) == 0 && u.Object == "" {
+		return nil, fmt.Errorf("PKCS#11 URI %q names no object (id= or object=)", uri)
+	}
+	if pin == nil && u.PINValue != "" {
+		pin = []byte(u.PINValue)
+	}
+
+	k := &Key{uri: u, pin: pin}
+	der, err := k.run(nil, false, "--read-object", "--type", "cert")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	if k.cert, err = x509.ParseCertificate(der); err != nil {
+		return nil, fmt.Errorf("invalid certificate on token: %w", err)
+	}
+	switch pub := k.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("unsupported curve: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (want RSA or EC)", pub)
+	}
+	return k, nil
+}
+
+// URI returns the key's URI without PIN, for storing in the volume header
+func (k *Key) URI() string {
+	return k.uri.String()
+}
+
+// Certificate returns the certificate read from the token
+func (k *Key) Certificate() *x509.Certificate {
+	return k.cert
+}
+
+// Public returns the public key of the certificate
+func (k *Key) Public() crypto.PublicKey {
+	return k.cert.PublicKey
+}
+
+// Decrypt decrypts msg with an RSA key on the token, with RSA-OAEP (SHA-256)
+// for *rsa.OAEPOptions and PKCS#1 v1.5 otherwise
+func (k *Key) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	args := []string{"--decrypt", "--mechanism", "RSA-PKCS"}
+	if oaep, ok := opts.(*rsa.OAEPOptions); ok {
+		if oaep.Hash != crypto.SHA256 || len(oaep.Label) > 0 {
+			return nil, fmt.Errorf("only RSA-OAEP with SHA-256 and no label is supported")
+		}
+		args = []string{"--decrypt", "--mechanism", "RSA-PKCS-OAEP", "--hash-algorithm", "SHA256", "--mgf", "MGF1-SHA256"}
+	}
+	return k.run(msg, true, args...)
+}
+
+// ECDH derives the shared secret of an EC key on the token with remote
+func (k *Key) ECDH(remote *ecdh.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(remote)
+	if err != nil {
+		return nil, err
+	}
+	return k.run(der, true, "--derive", "--mechanism", "ECDH1-DERIVE")
+}
+
+// Close clears the PIN
+func (k *Key) Close() error {
+	clear(k.pin)
+	k.pin = nil
+	return nil
+}
+
+// run invokes pkcs11-tool on the key's object with input and returns its
+// output. Input and output pass through files in a private temporary
+// directory, which is removed afterwards.
+func (k *Key) run(input []byte, login bool, op ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "luks2-pkcs11-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	args := k.baseArgs()
+	if login {
+		if k.pin == nil {
+			return nil, fmt.Errorf("PIN required for %s", k.uri)
+		}
+		args = append(args, "--login", "--pin", "env:"+pinEnv)
+	}
+	args = append(args, op...)
+	if input != nil {
+		in := filepath.Join(dir, "in")
+		if err := os.WriteFile(in, input, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "--input-file", in)
+	}
+	out := filepath.Join(dir, "out")
+	args = append(args, "--output-file", out)
+
+	cmd := exec.Command(toolPath, args...) // #nosec G204 -- fixed binary, arguments built here
+	if login {
+		cmd.Env = append(os.Environ(), pinEnv+"="+string(k.pin))
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("pkcs11-tool: %s", msg)
+		}
+		return nil, fmt.Errorf("pkcs11-tool: %w", err)
+	}
+
+	data, err := os.ReadFile(out) // #nosec G304 -- file in our temporary directory
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11-tool produced no output: %w", err)
+	}
+	clearFile(out, len(data))
+	return data, nil
+}
+
+// baseArgs selects the module, token and object of the key
+func (k *Key) baseArgs() []string {
+	var args []string
+	if module := k.uri.ModulePath; module != "" {
+		args = append(args, "--module", module)
+	} else if k.uri.ModuleName != "" {
+		args = append(args, "--module", k.uri.ModuleName)
+	}
+	if k.uri.SlotID != "" {
+		args = append(args, "--slot", k.uri.SlotID)
+	}
+	if k.uri.Token != "" {
+		args = append(args, "--token-label", k.uri.Token)
+	}
+	if len(k.uri.ID) > 0 {
+		args = append(args, "--id", hex.EncodeToString(k.uri.ID))
+	}
+	if k.uri.Object != "" {
+		args = append(args, "--label", k.uri.Object)
+	}
+	return args
+}
+
+// clearFile overwrites a file holding secret output before it is removed
+func clearFile(path string, size int) {
+	_ = os.WriteFile(path, make([]byte, size), 0600)
+}
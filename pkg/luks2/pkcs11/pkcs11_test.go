@@ -0,0 +1,152 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTool installs a pkcs11-tool stand-in that logs its arguments and PIN
+// and writes the certificate for --read-object and "secret" otherwise
+func fakeTool(t *testing.T, certDER []byte) (logPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.der")
+	if err := os.WriteFile(certPath, certDER, 0600); err != nil {
+		t.Fatal(err)
+	}
+	logPath = filepath.Join(dir, "log")
+
+	script := `#!/bin/sh
+echo "$* pin=$` + pinEnv + `" >> "` + logPath + `"
+out=""
+read=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--output-file) out="$2"; shift ;;
+	--read-object) read=1 ;;
+	esac
+	shift
+done
+if [ -n "$read" ]; then cp "` + certPath + `" "$out"; else printf secret > "$out"; fi
+`
+	tool := filepath.Join(dir, "pkcs11-tool")
+	if err := os.WriteFile(tool, []byte(script), 0700); err != nil { // #nosec G306 -- test executable
+		t.Fatal(err)
+	}
+
+	saved := toolPath
+	toolPath = tool
+	t.Cleanup(func() { toolPath = saved })
+	return logPath
+}
+
+// selfSigned returns a DER certificate for pub signed by priv
+func selfSigned(t *testing.T, pub crypto.PublicKey, priv crypto.Signer) []byte {
+	t.Helper()
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "luks"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// TestKey_RSA tests reading the certificate and decrypting on the token
+func TestKey_RSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := fakeTool(t, selfSigned(t, priv.Public(), priv))
+
+	key, err := Open("pkcs11:token=card;id=%03?module-path=/usr/lib/opensc-pkcs11.so", []byte("123456"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	if pub, ok := key.Public().(*rsa.PublicKey); !ok || !pub.Equal(priv.Public()) {
+		t.Error("Public does not return the certificate key")
+	}
+	if key.URI() != "pkcs11:token=card;id=%03?module-path=/usr/lib/opensc-pkcs11.so" {
+		t.Errorf("URI = %s", key.URI())
+	}
+
+	got, err := key.Decrypt(nil, []byte("wrapped"), &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil || string(got) != "secret" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	data, _ := os.ReadFile(log) // #nosec G304 -- test file
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 invocations, got %q", lines)
+	}
+	if !strings.Contains(lines[0], "--module /usr/lib/opensc-pkcs11.so --token-label card --id 03 --read-object --type cert") ||
+		strings.Contains(lines[0], "--login") || !strings.HasSuffix(lines[0], "pin=") {
+		t.Errorf("read-object invocation = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "--login --pin env:"+pinEnv+" --decrypt --mechanism RSA-PKCS-OAEP --hash-algorithm SHA256") ||
+		!strings.HasSuffix(lines[1], "pin=123456") {
+		t.Errorf("decrypt invocation = %s", lines[1])
+	}
+}
+
+// TestKey_ECDH tests deriving on the token
+func TestKey_ECDH(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := fakeTool(t, selfSigned(t, priv.Public(), priv))
+
+	key, err := Open("pkcs11:object=luks?pin-value=0000", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	ephemeral, _ := ecdh.P256().GenerateKey(rand.Reader)
+	if got, err := key.ECDH(ephemeral.PublicKey()); err != nil || string(got) != "secret" {
+		t.Fatalf("ECDH = %q, %v", got, err)
+	}
+
+	data, _ := os.ReadFile(log) // #nosec G304 -- test file
+	if !strings.Contains(string(data), "--label luks --login --pin env:"+pinEnv+" --derive --mechanism ECDH1-DERIVE --input-file") ||
+		!strings.Contains(string(data), "pin=0000") {
+		t.Errorf("derive invocation = %s", data)
+	}
+
+	_ = key.Close()
+	if _, err := key.ECDH(ephemeral.PublicKey()); err == nil {
+		t.Error("ECDH succeeded after Close cleared the PIN")
+	}
+}
+
+// TestOpen_Errors tests URIs that select no key
+func TestOpen_Errors(t *testing.T) {
+	fakeTool(t, []byte("not a certificate"))
+
+	if _, err := Open("pkcs11:token=card", nil); err == nil {
+		t.Error("Open accepted a URI without an object")
+	}
+	if _, err := Open("pkcs11:id=%01", nil); err == nil || !strings.Contains(err.Error(), "invalid certificate") {
+		t.Errorf("Open with a bad certificate = %v", err)
+	}
+}
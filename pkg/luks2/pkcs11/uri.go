@@ -0,0 +1,172 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pkcs11
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URI is a PKCS#11 URI (RFC 7512) naming a token and a key on it, e.g.
+// pkcs11:token=YubiKey%20PIV;id=%03;type=private?module-path=/usr/lib/libykcs11.so
+type URI struct {
+	// Token attributes
+	Token        string // Token label
+	Manufacturer string
+	Serial       string
+	Model        string
+	SlotID       string
+
+	// Object attributes
+	Object string // Object label
+	ID     []byte // Object ID (CKA_ID)
+	Type   string // cert, private, public, secret-key or data
+
+	// Query attributes
+	ModulePath string // PKCS#11 module to load
+	ModuleName string // Module name looked up in the library path
+	PINValue   string // PIN embedded in the URI (discouraged)
+	PINSource  string // Where to read the PIN from
+}
+
+// ParseURI parses a PKCS#11 URI. Vendor attributes (x-...) are ignored;
+// other unknown attributes are rejected so that a typo cannot widen the
+// selection to another key.
+func ParseURI(s string) (*URI, error) {
+	rest, ok := strings.CutPrefix(s, "pkcs11:")
+	if !ok {
+		return nil, fmt.Errorf("invalid PKCS#11 URI %q: missing pkcs11: scheme", s)
+	}
+	path, query, _ := strings.Cut(rest, "?")
+
+	u := &URI{}
+	for _, attr := range splitAttrs(path, ";") {
+		name, value, err := parseAttr(attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS#11 URI %q: %w", s, err)
+		}
+		switch name {
+		case "token":
+			u.Token = value
+		case "manufacturer":
+			u.Manufacturer = value
+		case "serial":
+			u.Serial = value
+		case "model":
+			u.Model = value
+		case "slot-id":
+			u.SlotID = value
+		case "object":
+			u.Object = value
+		case "id":
+			u.ID = []byte(value)
+		case "type":
+			u.Type = value
+		case "library-manufacturer", "library-description", "library-version", "slot-description", "slot-manufacturer":
+			// Identify the module or slot, which the module choice already does
+		default:
+			if !strings.HasPrefix(name, "x-") {
+				return nil, fmt.Errorf("invalid PKCS#11 URI %q: unknown attribute %q", s, name)
+			}
+		}
+	}
+	for _, attr := range splitAttrs(query, "&") {
+		name, value, err := parseAttr(attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS#11 URI %q: %w", s, err)
+		}
+		switch name {
+		case "module-path":
+			u.ModulePath = value
+		case "module-name":
+			u.ModuleName = value
+		case "pin-value":
+			u.PINValue = value
+		case "pin-source":
+			u.PINSource = value
+		default:
+			if !strings.HasPrefix(name, "x-") {
+				return nil, fmt.Errorf("invalid PKCS#11 URI %q: unknown query attribute %q", s, name)
+			}
+		}
+	}
+	return u, nil
+}
+
+// String formats the URI, percent-encoding values. The PIN value is
+// omitted so the URI can be stored in a header or logged.
+func (u *URI) String() string {
+	var path []string
+	add := func(list *[]string, name, value string) {
+		if value != "" {
+			*list = append(*list, name+"="+escape(value))
+		}
+	}
+	add(&path, "token", u.Token)
+	add(&path, "manufacturer", u.Manufacturer)
+	add(&path, "serial", u.Serial)
+	add(&path, "model", u.Model)
+	add(&path, "slot-id", u.SlotID)
+	add(&path, "object", u.Object)
+	if len(u.ID) > 0 {
+		var id strings.Builder
+		for _, b := range u.ID {
+			fmt.Fprintf(&id, "%%%02X", b)
+		}
+		path = append(path, "id="+id.String())
+	}
+	add(&path, "type", u.Type)
+
+	var query []string
+	add(&query, "module-path", u.ModulePath)
+	add(&query, "module-name", u.ModuleName)
+	add(&query, "pin-source", u.PINSource)
+
+	s := "pkcs11:" + strings.Join(path, ";")
+	if len(query) > 0 {
+		s += "?" + strings.Join(query, "&")
+	}
+	return s
+}
+
+// splitAttrs splits an attribute list, skipping empty entries
+func splitAttrs(s, sep string) []string {
+	var attrs []string
+	for _, attr := range strings.Split(s, sep) {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// parseAttr splits a name=value attribute and decodes the value
+func parseAttr(attr string) (string, string, error) {
+	name, value, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("attribute %q has no value", attr)
+	}
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("attribute %s: %w", name, err)
+	}
+	return name, decoded, nil
+}
+
+// escape percent-encodes a value, leaving the characters RFC 7512 allows
+// in both path and query values as they are
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~:[]@!$'()*+,/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package pkcs11
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestParseURI tests parsing RFC 7512 URIs
+func TestParseURI(t *testing.T) {
+	u, err := ParseURI("pkcs11:token=YubiKey%20PIV%20%2312345;id=%03;type=private;x-vendor=1?module-path=/usr/lib/libykcs11.so&pin-value=123456")
+	if err != nil {
+		t.Fatalf("ParseURI failed: %v", err)
+	}
+	if u.Token != "YubiKey PIV #12345" || !bytes.Equal(u.ID, []byte{3}) || u.Type != "private" ||
+		u.ModulePath != "/usr/lib/libykcs11.so" || u.PINValue != "123456" {
+		t.Errorf("ParseURI = %+v", u)
+	}
+
+	for _, bad := range []string{
+		"token=x",
+		"pkcs11:tokn=x",
+		"pkcs11:token",
+		"pkcs11:id=%zz",
+		"pkcs11:id=%01?module=x",
+	} {
+		if _, err := ParseURI(bad); err == nil {
+			t.Errorf("ParseURI(%q) succeeded", bad)
+		}
+	}
+}
+
+// TestURI_String tests that formatting round-trips and drops the PIN
+func TestURI_String(t *testing.T) {
+	u := &URI{Token: "My Card;1", Object: "key=a", ID: []byte{0x01, 0xab}, ModulePath: "/usr/lib/opensc-pkcs11.so", PINValue: "1234"}
+	s := u.String()
+	if s != "pkcs11:token=My%20Card%3B1;object=key%3Da;id=%01%AB?module-path=/usr/lib/opensc-pkcs11.so" {
+		t.Errorf("String = %s", s)
+	}
+
+	parsed, err := ParseURI(s)
+	if err != nil {
+		t.Fatalf("ParseURI(String) failed: %v", err)
+	}
+	if parsed.Token != u.Token || parsed.Object != u.Object || !bytes.Equal(parsed.ID, u.ID) || parsed.PINValue != "" {
+		t.Errorf("round trip = %+v", parsed)
+	}
+}
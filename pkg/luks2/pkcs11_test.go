@@ -0,0 +1,137 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// ecdsaTokenKey is an EC key as PKCS#11 bindings expose it: an ECDSA public
+// key with ECDH performed by the token
+type ecdsaTokenKey struct {
+	priv *ecdsa.PrivateKey
+}
+
+func (k *ecdsaTokenKey) Public() crypto.PublicKey { return k.priv.Public() }
+
+func (k *ecdsaTokenKey) ECDH(remote *ecdh.PublicKey) ([]byte, error) {
+	priv, err := k.priv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(remote)
+}
+
+// TestPKCS11_EnrollAndUnlock tests each wrapping scheme end to end
+func TestPKCS11_EnrollAndUnlock(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdh.P384().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  PKCS11Key
+		oaep bool
+		wrap string
+	}{
+		{"rsa-pkcs1", rsaKey, false, ""},
+		{"rsa-oaep", rsaKey, true, PKCS11WrapRSAOAEP},
+		{"ecdsa", &ecdsaTokenKey{ecKey}, false, ""},
+		{"ecdh", p384Key, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password")
+			device := formatTestVolume(t, passphrase)
+			uri := "pkcs11:token=card;id=%01"
+
+			keyslot, tokenID, err := EnrollPKCS11(device, passphrase, uri, tt.key.Public(), &PKCS11Options{OAEP: tt.oaep})
+			if err != nil {
+				t.Fatalf("EnrollPKCS11 failed: %v", err)
+			}
+			token, err := GetToken(device, tokenID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Type != TokenTypePKCS11 || token.PKCS11URI != uri || token.PKCS11KeyWrap != tt.wrap ||
+				len(token.Keyslots) != 1 || token.Keyslots[0] != strconv.Itoa(keyslot) {
+				t.Errorf("token = %+v", token)
+			}
+
+			_, metadata, err := ReadHeader(device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			masterKey, err := pkcs11MasterKey(device, metadata, tt.key)
+			if err != nil {
+				t.Fatalf("pkcs11MasterKey failed: %v", err)
+			}
+			defer masterKey.Destroy()
+
+			if got, err := PKCS11TokenURI(device); err != nil || got != uri {
+				t.Errorf("PKCS11TokenURI = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+// TestPKCS11_WrongKey tests that another key unlocks nothing
+func TestPKCS11_WrongKey(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	enrolled, _ := ecdh.P256().GenerateKey(rand.Reader)
+	other, _ := ecdh.P256().GenerateKey(rand.Reader)
+	if _, _, err := EnrollPKCS11(device, passphrase, "pkcs11:id=%01", enrolled.Public(), nil); err != nil {
+		t.Fatalf("EnrollPKCS11 failed: %v", err)
+	}
+
+	_, metadata, _ := ReadHeader(device)
+	if _, err := pkcs11MasterKey(device, metadata, other); err == nil || errors.Is(err, ErrNoPKCS11Token) {
+		t.Errorf("pkcs11MasterKey with another key = %v", err)
+	}
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := pkcs11MasterKey(device, metadata, rsaKey); err == nil {
+		t.Error("pkcs11MasterKey with an RSA key succeeded for an EC token")
+	}
+}
+
+// TestPKCS11_NoToken tests volumes without PKCS#11 tokens
+func TestPKCS11_NoToken(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	key, _ := ecdh.P256().GenerateKey(rand.Reader)
+
+	_, metadata, _ := ReadHeader(device)
+	if _, err := pkcs11MasterKey(device, metadata, key); !errors.Is(err, ErrNoPKCS11Token) {
+		t.Errorf("pkcs11MasterKey = %v, want ErrNoPKCS11Token", err)
+	}
+	if _, err := PKCS11TokenURI(device); !errors.Is(err, ErrNoPKCS11Token) {
+		t.Errorf("PKCS11TokenURI = %v, want ErrNoPKCS11Token", err)
+	}
+	if _, _, err := EnrollPKCS11(device, []byte("test-password"), "pkcs11:", "not a key", nil); err == nil {
+		t.Error("EnrollPKCS11 accepted an unsupported key")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// PassphrasePolicy describes the passphrases Format, AddKey and ChangeKey
+// accept for new keyslots. Zero fields are not enforced.
+type PassphrasePolicy struct {
+	// MinLength is the minimum length in characters
+	MinLength int
+
+	// MinEntropy is the minimum estimated entropy in bits (see EstimateStrength)
+	MinEntropy float64
+
+	// Denylist contains passphrases that are always rejected, compared
+	// case-insensitively (e.g. organization names, breached passwords)
+	Denylist []string
+
+	// RequireConfirmation tells interactive front ends to ask for a new
+	// passphrase twice. The library itself never prompts.
+	RequireConfirmation bool
+}
+
+// RecommendedPassphrasePolicy rejects passphrases scoring below
+// StrengthStrong. Register it with SetPassphrasePolicy.
+var RecommendedPassphrasePolicy = PassphrasePolicy{
+	MinLength:           12,
+	MinEntropy:          strengthThresholds[StrengthStrong-1],
+	RequireConfirmation: true,
+}
+
+// Check returns a *WeakPassphraseError if passphrase violates the policy
+func (p *PassphrasePolicy) Check(passphrase []byte) error {
+	var reasons []string
+
+	if n := utf8.RuneCount(passphrase); p.MinLength > 0 && n < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("shorter than %d characters", p.MinLength))
+	}
+	for _, denied := range p.Denylist {
+		if bytes.EqualFold(passphrase, []byte(denied)) {
+			reasons = append(reasons, "passphrase is on the denylist")
+			break
+		}
+	}
+
+	strength := EstimateStrength(passphrase)
+	if p.MinEntropy > 0 && strength.Entropy < p.MinEntropy {
+		reasons = append(reasons, fmt.Sprintf("estimated entropy %.0f bits is below %.0f", strength.Entropy, p.MinEntropy))
+	}
+
+	if len(reasons) > 0 {
+		return &WeakPassphraseError{Reasons: reasons, Strength: strength}
+	}
+	return nil
+}
+
+// policyState holds the registered passphrase policy
+var policyState struct {
+	mu     sync.RWMutex
+	policy *PassphrasePolicy
+}
+
+// SetPassphrasePolicy registers the policy new passphrases are checked
+// against. Passing nil disables policy checks (the default); passphrases
+// still have to satisfy ValidatePassphrase.
+func SetPassphrasePolicy(p *PassphrasePolicy) {
+	policyState.mu.Lock()
+	defer policyState.mu.Unlock()
+	if p != nil {
+		cp := *p
+		cp.Denylist = append([]string(nil), p.Denylist...)
+		p = &cp
+	}
+	policyState.policy = p
+}
+
+// GetPassphrasePolicy returns a copy of the registered policy, or nil
+func GetPassphrasePolicy() *PassphrasePolicy {
+	policyState.mu.RLock()
+	defer policyState.mu.RUnlock()
+	if policyState.policy == nil {
+		return nil
+	}
+	cp := *policyState.policy
+	return &cp
+}
+
+// checkPassphrasePolicy validates a new passphrase against the registered policy
+func checkPassphrasePolicy(passphrase []byte) error {
+	policyState.mu.RLock()
+	p := policyState.policy
+	policyState.mu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	return p.Check(passphrase)
+}
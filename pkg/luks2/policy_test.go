@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// usePolicy registers a passphrase policy for the duration of a test
+func usePolicy(t *testing.T, p *PassphrasePolicy) {
+	t.Helper()
+	SetPassphrasePolicy(p)
+	t.Cleanup(func() { SetPassphrasePolicy(nil) })
+}
+
+// TestPassphrasePolicy_Check tests each policy rule
+func TestPassphrasePolicy_Check(t *testing.T) {
+	policy := &PassphrasePolicy{MinLength: 12, MinEntropy: 60, Denylist: []string{"Acme-Corp-2025!"}}
+
+	tests := []struct {
+		passphrase string
+		reason     string
+	}{
+		{"xK9#mQ2$", "shorter than 12"},
+		{"acme-corp-2025!", "denylist"},
+		{"passwordpassword", "entropy"},
+		{"correct horse battery staple", ""},
+	}
+	for _, tt := range tests {
+		err := policy.Check([]byte(tt.passphrase))
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.passphrase, err)
+			}
+			continue
+		}
+
+		var weak *WeakPassphraseError
+		if !errors.As(err, &weak) || !errors.Is(err, ErrWeakPassphrase) {
+			t.Errorf("%q: expected WeakPassphraseError, got %v", tt.passphrase, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%q: error %q does not mention %q", tt.passphrase, err, tt.reason)
+		}
+	}
+}
+
+// TestSetPassphrasePolicy tests registering and clearing the policy
+func TestSetPassphrasePolicy(t *testing.T) {
+	denylist := []string{"hunter2hunter2"}
+	usePolicy(t, &PassphrasePolicy{MinLength: 10, Denylist: denylist})
+	denylist[0] = "modified"
+
+	p := GetPassphrasePolicy()
+	if p == nil || p.MinLength != 10 || p.Denylist[0] != "hunter2hunter2" {
+		t.Errorf("Policy not copied: %+v", p)
+	}
+	if err := checkPassphrasePolicy([]byte("hunter2hunter2")); !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("Expected denylisted passphrase to fail, got %v", err)
+	}
+
+	SetPassphrasePolicy(nil)
+	if GetPassphrasePolicy() != nil || checkPassphrasePolicy([]byte("short")) != nil {
+		t.Error("Expected no policy after SetPassphrasePolicy(nil)")
+	}
+}
+
+// TestPassphrasePolicy_Enforced tests that Format, AddKey and ChangeKey
+// reject weak new passphrases
+func TestPassphrasePolicy_Enforced(t *testing.T) {
+	pass := []byte("correct horse battery staple")
+	device := formatTestVolume(t, pass)
+	usePolicy(t, &RecommendedPassphrasePolicy)
+
+	if err := AddKey(device, pass, []byte("password1234"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("AddKey: expected ErrWeakPassphrase, got %v", err)
+	}
+	if err := ChangeKey(device, pass, []byte("qwertyuiop12"), 0); !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("ChangeKey: expected ErrWeakPassphrase, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "weak.luks")
+	if err := os.WriteFile(path, make([]byte, 20*1024*1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err := Format(FormatOptions{Device: path, Passphrase: []byte("Summer2024!!"), KDFType: "pbkdf2", PBKDFIterTime: 10})
+	if !errors.Is(err, ErrWeakPassphrase) {
+		t.Errorf("Format: expected ErrWeakPassphrase, got %v", err)
+	}
+
+	if err := AddKey(device, pass, []byte("xK9#mQ2$vL7&nR4z"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Errorf("AddKey with strong passphrase failed: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Privileges describes what the process may do with device-mapper, loop
+// devices and mounts, which all require root on a stock system
+type Privileges struct {
+	SysAdmin      bool // CAP_SYS_ADMIN is in the effective capability set
+	MapperControl bool // /dev/mapper/control can be opened read-write
+	LoopControl   bool // /dev/loop-control can be opened read-write
+}
+
+// ProbePrivileges checks the capabilities of the process and its access to
+// the device-mapper and loop control nodes without changing anything
+func ProbePrivileges() Privileges {
+	return Privileges{
+		SysAdmin:      hasCapability(unix.CAP_SYS_ADMIN),
+		MapperControl: canOpenRW(filepath.Join(devRoot, "mapper", "control")),
+		LoopControl:   canOpenRW(filepath.Join(devRoot, "loop-control")),
+	}
+}
+
+// Missing lists the privileges that are missing to open, close and mount
+// volumes; image files (needLoop) also need loop devices
+func (p Privileges) Missing(needLoop bool) []string {
+	var missing []string
+	if !p.SysAdmin {
+		missing = append(missing, "CAP_SYS_ADMIN")
+	}
+	if !p.MapperControl {
+		missing = append(missing, "access to /dev/mapper/control")
+	}
+	if needLoop && !p.LoopControl {
+		missing = append(missing, "access to /dev/loop-control")
+	}
+	return missing
+}
+
+// Check returns a *PrivilegeError naming what is missing if the process
+// cannot perform op, so callers can fail before prompting for a passphrase
+// or running the KDF
+func (p Privileges) Check(op string, needLoop bool) error {
+	if missing := p.Missing(needLoop); len(missing) > 0 {
+		return &PrivilegeError{Op: op, Missing: missing}
+	}
+	return nil
+}
+
+// privilegeError turns an EPERM or EACCES from the kernel into a
+// *PrivilegeError describing what the process lacks; other errors are
+// returned unchanged
+func privilegeError(op string, needLoop bool, err error) error {
+	if !errors.Is(err, unix.EPERM) && !errors.Is(err, unix.EACCES) {
+		return err
+	}
+	missing := ProbePrivileges().Missing(needLoop)
+	if len(missing) == 0 {
+		// Refused for another reason (LSM policy, user namespace)
+		missing = []string{"privileges this process lacks"}
+	}
+	return &PrivilegeError{Op: op, Missing: missing, Err: err}
+}
+
+// hasCapability reports whether capability bit cap is in the effective set
+// listed in /proc/self/status
+func hasCapability(cap int) bool {
+	f, err := os.Open(filepath.Join(procRoot, "self", "status")) // #nosec G304 -- procfs path
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "CapEff:"); ok {
+			mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+			return err == nil && mask&(1<<cap) != 0
+		}
+	}
+	return false
+}
+
+// canOpenRW reports whether path can be opened read-write
+func canOpenRW(path string) bool {
+	f, err := os.OpenFile(path, os.O_RDWR, 0) // #nosec G304 -- fixed control node paths
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
+}
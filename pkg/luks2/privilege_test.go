@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakePrivileges points procRoot and devRoot at a temporary tree with the
+// given effective capability mask and control nodes
+func fakePrivileges(t *testing.T, capEff string, nodes ...string) {
+	t.Helper()
+	root := t.TempDir()
+	oldProc, oldDev := procRoot, devRoot
+	procRoot = filepath.Join(root, "proc")
+	devRoot = filepath.Join(root, "dev")
+	t.Cleanup(func() { procRoot, devRoot = oldProc, oldDev })
+
+	status := fmt.Sprintf("Name:\tluks2\nCapInh:\t0000000000000000\nCapPrm:\t%s\nCapEff:\t%s\n", capEff, capEff)
+	if err := os.MkdirAll(filepath.Join(procRoot, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "self", "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range nodes {
+		path := filepath.Join(devRoot, node)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestProbePrivileges tests capability and control node detection
+func TestProbePrivileges(t *testing.T) {
+	fakePrivileges(t, "000001ffffffffff", "mapper/control", "loop-control")
+	if got, want := ProbePrivileges(), (Privileges{SysAdmin: true, MapperControl: true, LoopControl: true}); got != want {
+		t.Errorf("ProbePrivileges() = %+v, want %+v", got, want)
+	}
+
+	fakePrivileges(t, "0000000000000000", "loop-control")
+	if got, want := ProbePrivileges(), (Privileges{LoopControl: true}); got != want {
+		t.Errorf("ProbePrivileges() = %+v, want %+v", got, want)
+	}
+
+	// CAP_SYS_ADMIN alone (bit 21)
+	fakePrivileges(t, "0000000000200000")
+	if !ProbePrivileges().SysAdmin {
+		t.Error("CAP_SYS_ADMIN not detected")
+	}
+}
+
+// TestPrivilegesCheck tests the errors for missing privileges
+func TestPrivilegesCheck(t *testing.T) {
+	all := Privileges{SysAdmin: true, MapperControl: true, LoopControl: true}
+	if err := all.Check("unlock", true); err != nil {
+		t.Errorf("Check() = %v with all privileges", err)
+	}
+
+	noLoop := Privileges{SysAdmin: true, MapperControl: true}
+	if err := noLoop.Check("unlock", false); err != nil {
+		t.Errorf("Check() = %v for a block device", err)
+	}
+
+	var perr *PrivilegeError
+	if err := (Privileges{}).Check("unlock", true); !errors.As(err, &perr) || !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("Check() = %v, want *PrivilegeError", err)
+	}
+	want := []string{"CAP_SYS_ADMIN", "access to /dev/mapper/control", "access to /dev/loop-control"}
+	if perr.Op != "unlock" || !reflect.DeepEqual(perr.Missing, want) {
+		t.Errorf("PrivilegeError = %+v", perr)
+	}
+}
+
+// TestPrivilegeErrorMapping tests turning kernel permission errors into
+// *PrivilegeError
+func TestPrivilegeErrorMapping(t *testing.T) {
+	fakePrivileges(t, "0000000000000000")
+
+	other := errors.New("device busy")
+	if err := privilegeError("lock", false, other); err != other {
+		t.Errorf("privilegeError() changed an unrelated error: %v", err)
+	}
+
+	err := privilegeError("lock", false, fmt.Errorf("ioctl: %w", unix.EPERM))
+	var perr *PrivilegeError
+	if !errors.As(err, &perr) || !errors.Is(err, unix.EPERM) {
+		t.Fatalf("privilegeError() = %v, want *PrivilegeError wrapping EPERM", err)
+	}
+	if !reflect.DeepEqual(perr.Missing, []string{"CAP_SYS_ADMIN", "access to /dev/mapper/control"}) {
+		t.Errorf("Missing = %v", perr.Missing)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// DefaultParallel is how many devices ApplyPlan provisions at once when
+// neither the plan nor the options say. Each one derives keys with the
+// KDF of its spec, so large Argon2 memory costs call for fewer.
+const DefaultParallel = 4
+
+// Plan is a set of specs provisioned together
+type Plan struct {
+	// Parallel is how many specs are applied at once (0 = DefaultParallel)
+	Parallel int
+
+	// Specs are the devices, in the order of the file
+	Specs []*Spec
+}
+
+// planFile is the layout of a plan file before the defaults are merged
+// into each device
+type planFile struct {
+	Parallel int                          `json:"parallel,omitempty"`
+	Defaults map[string]json.RawMessage   `json:"defaults,omitempty"`
+	Devices  []map[string]json.RawMessage `json:"devices"`
+}
+
+// LoadPlan reads a JSON or YAML plan from a file
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- plan path supplied by caller
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlan(data)
+}
+
+// ParsePlan decodes and validates a JSON or YAML plan. A document without
+// a "devices" member is a single spec and becomes a plan of one. Members of
+// a device replace the same members of "defaults" as a whole, so a device
+// that lists keyslots does not inherit any.
+func ParsePlan(data []byte) (*Plan, error) {
+	data, err := toJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	if _, ok := top["devices"]; !ok {
+		spec, err := parseJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Plan{Specs: []*Spec{spec}}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var file planFile
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	if len(file.Devices) == 0 {
+		return nil, fmt.Errorf("invalid plan: no devices")
+	}
+	if file.Parallel < 0 {
+		return nil, fmt.Errorf("invalid plan: parallel must not be negative")
+	}
+
+	plan := &Plan{Parallel: file.Parallel}
+	for i, device := range file.Devices {
+		merged := maps.Clone(file.Defaults)
+		if merged == nil {
+			merged = make(map[string]json.RawMessage)
+		}
+		maps.Copy(merged, device)
+
+		specJSON, err := json.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan: devices[%d]: %w", i, err)
+		}
+		spec, err := parseJSON(specJSON)
+		if err != nil {
+			return nil, fmt.Errorf("devices[%d]: %w", i, err)
+		}
+		plan.Specs = append(plan.Specs, spec)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Validate checks every spec and that no two specs name the same device
+// or device-mapper name
+func (p *Plan) Validate() error {
+	if p.Parallel < 0 {
+		return fmt.Errorf("invalid plan: parallel must not be negative")
+	}
+	devices := make(map[string]int)
+	names := make(map[string]int)
+	for i, spec := range p.Specs {
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("devices[%d]: %w", i, err)
+		}
+		if j, ok := devices[spec.Device]; ok {
+			return fmt.Errorf("invalid plan: devices[%d] and devices[%d] are both %s", j, i, spec.Device)
+		}
+		devices[spec.Device] = i
+		if spec.Name == "" {
+			continue
+		}
+		if j, ok := names[spec.Name]; ok {
+			return fmt.Errorf("invalid plan: devices[%d] and devices[%d] are both named %s", j, i, spec.Name)
+		}
+		names[spec.Name] = i
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParsePlan tests merging the defaults of a plan into its devices
+func TestParsePlan(t *testing.T) {
+	plan, err := ParsePlan([]byte(`
+parallel: 2
+defaults:
+  cipher: aes-xts-plain64
+  keyslots:
+    - passphrase_env: DISK_PASSPHRASE
+  filesystem: {type: ext4}
+devices:
+  - {device: /dev/vdb, name: data1}
+  - device: /dev/vdc
+    name: data2
+    keyslots:
+      - key_file: /run/secrets/data2.key
+`))
+	if err != nil {
+		t.Fatalf("ParsePlan failed: %v", err)
+	}
+	if plan.Parallel != 2 || len(plan.Specs) != 2 {
+		t.Fatalf("ParsePlan() = %+v", plan)
+	}
+	first, second := plan.Specs[0], plan.Specs[1]
+	if first.Device != "/dev/vdb" || first.Cipher != "aes-xts-plain64" || first.Keyslots[0].PassphraseEnv != "DISK_PASSPHRASE" || first.Filesystem.Type != "ext4" {
+		t.Errorf("first spec = %+v", first)
+	}
+	if second.Name != "data2" || len(second.Keyslots) != 1 || second.Keyslots[0].KeyFile == "" || second.Filesystem == nil {
+		t.Errorf("second spec = %+v", second)
+	}
+
+	// A document without devices is a plan of one spec
+	plan, err = ParsePlan([]byte(`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}]}`))
+	if err != nil || len(plan.Specs) != 1 || plan.Specs[0].Device != "/dev/vdb" {
+		t.Errorf("ParsePlan(spec) = %+v, %v", plan, err)
+	}
+}
+
+// TestParsePlan_Invalid tests rejecting plans with bad or clashing devices
+func TestParsePlan_Invalid(t *testing.T) {
+	tests := []struct {
+		plan string
+		want string
+	}{
+		{`{"devices": []}`, "no devices"},
+		{`{"devices": [{"device": "/dev/vdb"}]}`, "devices[0]: invalid spec: at least one keyslot"},
+		{`{"parallel": -1, "devices": [{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}]}]}`, "negative"},
+		{`{"defaults": {"keyslots": [{"key_file": "k"}]}, "devices": [{"device": "/dev/vdb"}, {"device": "/dev/vdb"}]}`, "are both /dev/vdb"},
+		{`{"defaults": {"keyslots": [{"key_file": "k"}]}, "devices": [{"device": "/dev/vdb", "name": "d"}, {"device": "/dev/vdc", "name": "d"}]}`, "both named d"},
+		{`{"defaults": {"keyslots": [{"key_file": "k"}]}, "devices": [{"device": "/dev/vdb"}], "device": "/dev/vdc"}`, "unknown field"},
+		{`{"devices": [{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}], "keyslot": 1}]}`, "unknown field"},
+		{"- /dev/vdb\n", "not a mapping"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePlan([]byte(tt.plan))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParsePlan(%s) = %v, want error containing %q", tt.plan, err, tt.want)
+		}
+	}
+}
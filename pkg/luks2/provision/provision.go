@@ -0,0 +1,496 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// Options contains optional settings for Apply
+type Options struct {
+	// Root is prepended to /etc/crypttab and /etc/fstab, for writing into
+	// an image being built ("" = the running system). Devices are always
+	// looked up on the running system.
+	Root string
+
+	// Force formats a device that holds a recognizable filesystem or a
+	// LUKS1 header. Without it Apply refuses with ErrConflict.
+	Force bool
+
+	// Parallel overrides Plan.Parallel in ApplyPlan (0 = the plan's)
+	Parallel int
+}
+
+// Result reports what Apply changed
+type Result struct {
+	Device            string   `json:"device"`                  // Resolved device path
+	UUID              string   `json:"uuid"`                    // LUKS2 header UUID
+	Name              string   `json:"name"`                    // Device-mapper name
+	Formatted         bool     `json:"formatted"`               // A new volume was created
+	Enrolled          []int    `json:"enrolled,omitempty"`      // Keyslots added
+	RecoveryKeys      []string `json:"recovery_keys,omitempty"` // Recovery key files written
+	FilesystemCreated bool     `json:"filesystem_created"`      // A filesystem was made inside the volume
+	CrypttabChanged   bool     `json:"crypttab_changed"`        // The crypttab entry was added or updated
+	FstabChanged      bool     `json:"fstab_changed"`           // The fstab entry was added or updated
+}
+
+// Changed reports whether Apply changed anything
+func (r *Result) Changed() bool {
+	return r.Formatted || len(r.Enrolled) > 0 || r.FilesystemCreated || r.CrypttabChanged || r.FstabChanged
+}
+
+// Apply converges the system to spec (opts nil = defaults). Steps already
+// in the desired state are skipped, so Apply can run on every boot or build.
+// Every key in the spec is tried against the volume, which costs one key
+// derivation each. On error the Result describes the steps completed.
+func Apply(spec *Spec, opts *Options) (*Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	keys, err := spec.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	defer clearKeys(keys)
+
+	device, err := luks2.ResolveDevice(spec.Device)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Device: device}
+
+	isLUKS2, err := luks2.IsLUKS2(device)
+	if err != nil {
+		return res, err
+	}
+	if !isLUKS2 {
+		if err := format(device, spec, keys[0], opts.Force); err != nil {
+			return res, err
+		}
+		res.Formatted = true
+	}
+
+	info, err := luks2.GetVolumeInfo(device)
+	if err != nil {
+		return res, err
+	}
+	if err := checkVolume(info, spec); err != nil {
+		return res, err
+	}
+	res.UUID = info.UUID
+	res.Name = spec.Name
+	if res.Name == "" {
+		res.Name = luks2.MapperNameForUUID(info.UUID)
+	}
+
+	unlockKey, err := enrollKeys(device, spec, keys, res)
+	if err != nil {
+		return res, err
+	}
+
+	if spec.Filesystem != nil {
+		if res.FilesystemCreated, err = ensureFilesystem(device, res.Name, unlockKey, spec.Filesystem); err != nil {
+			return res, err
+		}
+	}
+
+	if spec.Crypttab != nil {
+		path := filepath.Join(opts.Root, "/etc/crypttab")
+		if res.CrypttabChanged, err = updateTable(path, 0, crypttabLine(res.Name, res.UUID, spec.Crypttab), 0600); err != nil {
+			return res, err
+		}
+	}
+	if spec.Fstab != nil {
+		path := filepath.Join(opts.Root, "/etc/fstab")
+		if res.FstabChanged, err = updateTable(path, 1, fstabLine(res.Name, spec.Filesystem.Type, spec.Fstab), 0644); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// format creates the volume with the first key after making sure nothing
+// recognizable is overwritten
+func format(device string, spec *Spec, key []byte, force bool) error {
+	if !force {
+		if isLUKS, err := luks2.IsLUKS(device); err == nil && isLUKS {
+			return fmt.Errorf("%w: %s holds a LUKS1 volume", ErrConflict, device)
+		}
+		if fsType, err := luks2.DetectFilesystem(device); err == nil {
+			return fmt.Errorf("%w: %s holds a %s filesystem", ErrConflict, device, fsType)
+		}
+	}
+
+	opts := luks2.FormatOptions{
+		Device:     device,
+		Passphrase: key,
+		Label:      spec.Label,
+		KeySize:    spec.KeySize,
+		SectorSize: spec.SectorSize,
+		Force:      force,
+	}
+	if spec.Cipher != "" {
+		opts.Cipher, opts.CipherMode, _ = strings.Cut(spec.Cipher, "-")
+	}
+	if kdf := spec.KDF; kdf != nil {
+		opts.KDFType = kdf.Type
+		opts.HashAlgo = kdf.Hash
+		opts.PBKDFIterTime = kdf.IterTime
+		opts.Argon2Time = kdf.Time
+		opts.Argon2Memory = kdf.Memory
+		opts.Argon2Parallel = kdf.Parallel
+	}
+
+	if err := luks2.Format(opts); err != nil {
+		return fmt.Errorf("failed to format %s: %w", device, err)
+	}
+	return nil
+}
+
+// checkVolume fails if an existing volume was created with settings other
+// than those in spec, since converging would mean reformatting it
+func checkVolume(info *luks2.VolumeInfo, spec *Spec) error {
+	if spec.Cipher != "" && info.Cipher != spec.Cipher {
+		return fmt.Errorf("%w: volume cipher is %s, spec wants %s", ErrConflict, info.Cipher, spec.Cipher)
+	}
+	if spec.SectorSize != 0 && info.SectorSize != spec.SectorSize {
+		return fmt.Errorf("%w: volume sector size is %d, spec wants %d", ErrConflict, info.SectorSize, spec.SectorSize)
+	}
+	if spec.KeySize != 0 {
+		for _, ks := range info.Metadata.Keyslots {
+			if ks.KeySize*8 != spec.KeySize {
+				return fmt.Errorf("%w: volume key size is %d bits, spec wants %d", ErrConflict, ks.KeySize*8, spec.KeySize)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// enrollKeys adds the keys that do not unlock the volume yet, using one
+// that does, and returns that key. Recovery keys are generated and TPM2
+// keys sealed as needed.
+func enrollKeys(device string, spec *Spec, keys [][]byte, res *Result) ([]byte, error) {
+	var unlockKey []byte
+	missing := make(map[int]bool)
+	for i, key := range keys {
+		if key == nil {
+			continue
+		}
+		ok, err := opens(device, key)
+		if err != nil {
+			return nil, fmt.Errorf("keyslot %d: %w", i, err)
+		}
+		if !ok {
+			missing[i] = true
+		} else if unlockKey == nil {
+			unlockKey = key
+		}
+	}
+	if unlockKey == nil {
+		return nil, fmt.Errorf("%w: none of the keys in the spec unlock %s", ErrConflict, device)
+	}
+
+	for i, ks := range spec.Keyslots {
+		addOpts := addKeyOptions(spec.KDF, ks.Slot)
+		var err error
+		switch {
+		case ks.Recovery != nil:
+			err = enrollRecovery(device, unlockKey, ks.Recovery, addOpts, res)
+		case ks.TPM2 != nil:
+			err = trackEnrolled(device, res, func() error { return enrollTPM2(device, unlockKey, ks.TPM2) })
+		case missing[i]:
+			err = trackEnrolled(device, res, func() error { return luks2.AddKey(device, unlockKey, keys[i], addOpts) })
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to enroll keyslot %d: %w", i, err)
+		}
+	}
+	slices.Sort(res.Enrolled)
+
+	return unlockKey, nil
+}
+
+// addKeyOptions returns the AddKey settings of a keyslot
+func addKeyOptions(kdf *KDFSpec, slot *int) *luks2.AddKeyOptions {
+	opts := &luks2.AddKeyOptions{Keyslot: slot}
+	if kdf != nil {
+		opts.KDFType = kdf.Type
+		opts.Hash = kdf.Hash
+		opts.PBKDFIterTime = kdf.IterTime
+		opts.Argon2Time = kdf.Time
+		opts.Argon2Memory = kdf.Memory
+		opts.Argon2Parallel = kdf.Parallel
+	}
+	return opts
+}
+
+// opens reports whether key opens a keyslot of device
+func opens(device string, key []byte) (bool, error) {
+	_, err := luks2.TestPassphrase(device, key, nil)
+	if errors.Is(err, luks2.ErrInvalidPassphrase) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// trackEnrolled runs enroll and records the keyslots it added in res
+func trackEnrolled(device string, res *Result, enroll func() error) error {
+	before, err := luks2.GetVolumeInfo(device)
+	if err != nil {
+		return err
+	}
+	if err := enroll(); err != nil {
+		return err
+	}
+	after, err := luks2.GetVolumeInfo(device)
+	if err != nil {
+		return err
+	}
+	for _, slot := range after.ActiveKeyslots {
+		if !slices.Contains(before.ActiveKeyslots, slot) {
+			res.Enrolled = append(res.Enrolled, slot)
+		}
+	}
+	return nil
+}
+
+// enrollRecovery makes sure the recovery key of rs unlocks the volume. If
+// its file does not exist yet a key is generated, enrolled and saved; the
+// keyslot is removed again if the key cannot be saved.
+func enrollRecovery(device string, unlockKey []byte, rs *RecoverySpec, addOpts *luks2.AddKeyOptions, res *Result) error {
+	path := rs.keyPath(res.UUID, res.Name)
+	key, err := luks2.LoadRecoveryKey(path)
+	if err == nil {
+		defer clear(key)
+		ok, err := opens(device, key)
+		if err != nil || ok {
+			return err
+		}
+		return trackEnrolled(device, res, func() error { return luks2.AddKey(device, unlockKey, key, addOpts) })
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	rk, err := luks2.GenerateRecoveryKey(luks2.RecoveryKeyLength, luks2.RecoveryKeyFormat(rs.Format))
+	if err != nil {
+		return err
+	}
+	defer clear(rk.Key)
+
+	enrolled := len(res.Enrolled)
+	if err := trackEnrolled(device, res, func() error { return luks2.AddKey(device, unlockKey, rk.Key, addOpts) }); err != nil {
+		return err
+	}
+	if len(res.Enrolled) > enrolled {
+		rk.Keyslot = res.Enrolled[len(res.Enrolled)-1]
+	}
+	rk.VolumeUUID = res.UUID
+	if err := luks2.SaveRecoveryKey(rk, path); err != nil {
+		if len(res.Enrolled) > enrolled {
+			_ = luks2.KillKeyslot(device, rk.Keyslot)
+			res.Enrolled = res.Enrolled[:enrolled]
+		}
+		return err
+	}
+	res.RecoveryKeys = append(res.RecoveryKeys, path)
+	return nil
+}
+
+// cryptenroll is the tool TPM2 keyslots are sealed with
+var cryptenroll = "systemd-cryptenroll"
+
+// enrollTPM2 seals a new keyslot to the TPM with systemd-cryptenroll, which
+// links it to a systemd-tpm2 token, unless the volume has such a token
+func enrollTPM2(device string, unlockKey []byte, tpm *TPM2Spec) error {
+	tokens, err := luks2.ListTokens(device)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.Type == "systemd-tpm2" {
+			return nil
+		}
+	}
+
+	tpmDevice := tpm.Device
+	if tpmDevice == "" {
+		tpmDevice = "auto"
+	}
+	args := []string{"--tpm2-device=" + tpmDevice}
+	if len(tpm.PCRs) > 0 {
+		pcrs := make([]string, len(tpm.PCRs))
+		for i, pcr := range tpm.PCRs {
+			pcrs[i] = strconv.Itoa(pcr)
+		}
+		args = append(args, "--tpm2-pcrs="+strings.Join(pcrs, "+"))
+	}
+	args = append(args, "--unlock-key-file=/dev/fd/3", device)
+
+	// The key reaches systemd-cryptenroll through a pipe, which keeps it out
+	// of the environment and argument list and allows any bytes in it
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		_, _ = w.Write(unlockKey)
+		_ = w.Close()
+	}()
+
+	cmd := exec.Command(cryptenroll, args...) // #nosec G204 -- fixed tool, arguments from a validated spec
+	cmd.ExtraFiles = []*os.File{r}
+	out, err := cmd.CombinedOutput()
+	// Closing the read end unblocks the writer if the tool did not read it all
+	_ = r.Close()
+	<-written
+	if err != nil {
+		if msg := bytes.TrimSpace(out); len(msg) > 0 {
+			return fmt.Errorf("%s: %w: %s", cryptenroll, err, msg)
+		}
+		return fmt.Errorf("%s: %w", cryptenroll, err)
+	}
+	return nil
+}
+
+// ensureFilesystem makes fs inside the volume unless it already holds a
+// filesystem. A volume that is not open is unlocked as name for the check
+// and locked again afterwards.
+func ensureFilesystem(device, name string, key []byte, fs *FilesystemSpec) (bool, error) {
+	if !luks2.IsUnlocked(name) {
+		target := device
+		unlockOpts := &luks2.UnlockOptions{}
+		if fi, err := os.Stat(device); err == nil && fi.Mode().IsRegular() {
+			loop, err := luks2.SetupLoopDevice(device)
+			if err != nil {
+				return false, err
+			}
+			target = loop
+			unlockOpts.AutoDetachLoop = true
+		}
+		if err := luks2.UnlockWithOptions(target, key, name, unlockOpts); err != nil {
+			if target != device {
+				_ = luks2.DetachLoopDevice(target)
+			}
+			return false, err
+		}
+		defer func() { _ = luks2.Lock(name) }()
+	}
+
+	devicePath, err := luks2.GetMappedDevicePath(name)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := luks2.DetectFilesystem(devicePath)
+	switch {
+	case err == nil && string(existing) == fs.Type:
+		return false, nil
+	case err == nil:
+		return false, fmt.Errorf("%w: volume holds a %s filesystem, spec wants %s", ErrConflict, existing, fs.Type)
+	case !errors.Is(err, luks2.ErrUnknownFilesystem):
+		return false, err
+	}
+
+	if err := luks2.MakeFilesystemWithOptions(name, luks2.FilesystemType(fs.Type), &luks2.FilesystemOptions{Label: fs.Label}); err != nil {
+		return false, fmt.Errorf("failed to create filesystem: %w", err)
+	}
+	return true, nil
+}
+
+// DeviceResult is the outcome of one spec of a plan
+type DeviceResult struct {
+	Spec   string  `json:"spec"`             // Device as written in the spec
+	Result *Result `json:"result,omitempty"` // What was done, nil if nothing was
+	Error  string  `json:"error,omitempty"`  // Why the spec failed
+
+	// Err is the error of Apply
+	Err error `json:"-"`
+}
+
+// Summary reports the outcome of ApplyPlan
+type Summary struct {
+	Devices []DeviceResult `json:"devices"` // In plan order
+	Changed int            `json:"changed"` // Devices changed, failed ones included
+	Failed  int            `json:"failed"`  // Devices that failed
+}
+
+// Err returns the errors of the failed specs joined, or nil
+func (s *Summary) Err() error {
+	var errs []error
+	for _, d := range s.Devices {
+		if d.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Spec, d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ApplyPlan applies every spec of plan, several at once (opts nil =
+// defaults). A failing spec does not stop the others; the Summary lists
+// the outcome of each.
+func ApplyPlan(plan *Plan, opts *Options) *Summary {
+	if opts == nil {
+		opts = &Options{}
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = plan.Parallel
+	}
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	summary := &Summary{Devices: make([]DeviceResult, len(plan.Specs))}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, spec := range plan.Specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := Apply(spec, opts)
+			d := DeviceResult{Spec: spec.Device, Result: res, Err: err}
+			if err != nil {
+				d.Error = err.Error()
+			}
+			summary.Devices[i] = d
+		}()
+	}
+	wg.Wait()
+
+	for _, d := range summary.Devices {
+		if d.Err != nil {
+			summary.Failed++
+		}
+		if d.Result != nil && d.Result.Changed() {
+			summary.Changed++
+		}
+	}
+	return summary
+}
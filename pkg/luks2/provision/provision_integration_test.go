@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package provision
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// TestApply_Filesystem tests creating a filesystem and fstab entry once
+func TestApply_Filesystem(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "volume.luks")
+	if err := os.WriteFile(image, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(image, 100*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "volume.key")
+	if err := os.WriteFile(keyFile, []byte("provision-integration"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &Spec{
+		Device:     image,
+		Name:       "test-provision",
+		KDF:        &KDFSpec{Type: "pbkdf2", IterTime: 100},
+		Keyslots:   []KeyslotSpec{{KeyFile: keyFile}},
+		Filesystem: &FilesystemSpec{Type: "ext4", Label: "provisioned"},
+		Fstab:      &FstabSpec{MountPoint: "/srv/data", Options: []string{"defaults", "nofail"}},
+	}
+	root := t.TempDir()
+	_ = luks2.Lock(spec.Name)
+
+	res, err := Apply(spec, &Options{Root: root})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !res.Formatted || !res.FilesystemCreated || !res.FstabChanged {
+		t.Errorf("first Apply = %+v", res)
+	}
+	if luks2.IsUnlocked(spec.Name) {
+		t.Error("Apply left the volume unlocked")
+	}
+
+	fstab, err := os.ReadFile(filepath.Join(root, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(fstab), "/dev/mapper/test-provision\t/srv/data\text4\tdefaults,nofail") {
+		t.Errorf("fstab = %q", fstab)
+	}
+
+	res, err = Apply(spec, &Options{Root: root})
+	if err != nil {
+		t.Fatalf("second Apply failed: %v", err)
+	}
+	if res.Changed() {
+		t.Errorf("second Apply changed something: %+v", res)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// testSpec returns a spec for a fresh image file with a key file and a
+// passphrase from the environment
+func testSpec(t *testing.T) *Spec {
+	t.Helper()
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "volume.luks")
+	writeFile(t, image, "")
+	if err := os.Truncate(image, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "volume.key")
+	writeFile(t, keyFile, "provision-key-file")
+	t.Setenv("PROVISION_TEST_RECOVERY", "recovery-passphrase")
+
+	two := 2
+	return &Spec{
+		Device:   image,
+		Label:    "data",
+		KDF:      &KDFSpec{Type: "pbkdf2", IterTime: 10},
+		Keyslots: []KeyslotSpec{{KeyFile: keyFile}, {Slot: &two, PassphraseEnv: "PROVISION_TEST_RECOVERY"}},
+		Crypttab: &CrypttabSpec{KeyFile: "/etc/luks/data.key"},
+	}
+}
+
+// TestApply tests creating a volume and converging it again
+func TestApply(t *testing.T) {
+	spec := testSpec(t)
+	root := t.TempDir()
+
+	res, err := Apply(spec, &Options{Root: root})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !res.Formatted || !slices.Equal(res.Enrolled, []int{2}) || !res.CrypttabChanged {
+		t.Errorf("first Apply = %+v", res)
+	}
+	if res.Name != luks2.MapperNameForUUID(res.UUID) {
+		t.Errorf("Name = %s, want the UUID-based default", res.Name)
+	}
+	for _, key := range []string{"provision-key-file", "recovery-passphrase"} {
+		if ok, _, err := luks2.VerifyPassphrase(spec.Device, []byte(key)); err != nil || !ok {
+			t.Errorf("key %q does not unlock the volume: %v", key, err)
+		}
+	}
+
+	crypttab, err := os.ReadFile(filepath.Join(root, "etc", "crypttab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := res.Name + "\tUUID=" + res.UUID + "\t/etc/luks/data.key\tluks\n"; string(crypttab) != want {
+		t.Errorf("crypttab = %q, want %q", crypttab, want)
+	}
+
+	res, err = Apply(spec, &Options{Root: root})
+	if err != nil {
+		t.Fatalf("second Apply failed: %v", err)
+	}
+	if res.Changed() {
+		t.Errorf("second Apply changed something: %+v", res)
+	}
+}
+
+// TestApply_Conflicts tests that existing data is never overwritten
+func TestApply_Conflicts(t *testing.T) {
+	spec := testSpec(t)
+	if _, err := Apply(spec, nil); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	other := *spec
+	other.Cipher = "aes-cbc-essiv:sha256"
+	if _, err := Apply(&other, nil); !errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), "cipher") {
+		t.Errorf("Apply with another cipher = %v, want ErrConflict", err)
+	}
+
+	t.Setenv("PROVISION_TEST_OTHER", "some-other-passphrase")
+	other = *spec
+	other.Keyslots = []KeyslotSpec{{PassphraseEnv: "PROVISION_TEST_OTHER"}}
+	if _, err := Apply(&other, nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("Apply with foreign keys = %v, want ErrConflict", err)
+	}
+}
+
+// TestApply_Recovery tests generating a recovery key once and reusing it
+func TestApply_Recovery(t *testing.T) {
+	spec := testSpec(t)
+	dir := t.TempDir()
+	spec.Keyslots = append(spec.Keyslots, KeyslotSpec{Recovery: &RecoverySpec{Path: filepath.Join(dir, "{uuid}.key")}})
+
+	res, err := Apply(spec, nil)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	path := filepath.Join(dir, res.UUID+".key")
+	if !slices.Equal(res.Enrolled, []int{1, 2}) || !slices.Equal(res.RecoveryKeys, []string{path}) {
+		t.Errorf("first Apply = %+v", res)
+	}
+	key, err := luks2.LoadRecoveryKey(path)
+	if err != nil {
+		t.Fatalf("LoadRecoveryKey failed: %v", err)
+	}
+	if ok, _, err := luks2.VerifyPassphrase(spec.Device, key); err != nil || !ok {
+		t.Errorf("recovery key does not unlock the volume: %v", err)
+	}
+
+	res, err = Apply(spec, nil)
+	if err != nil || res.Changed() {
+		t.Errorf("second Apply = %+v, %v", res, err)
+	}
+}
+
+// TestApply_TPM2 tests the systemd-cryptenroll invocation with a binary
+// key file and that a volume with a systemd-tpm2 token is left alone
+func TestApply_TPM2(t *testing.T) {
+	spec := testSpec(t)
+	key := []byte("binary\x00key\x00\xff\n")
+	writeFile(t, spec.Keyslots[0].KeyFile, string(key))
+	spec.Keyslots = []KeyslotSpec{spec.Keyslots[0], {TPM2: &TPM2Spec{PCRs: []int{7, 11}}}}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	keyOut := filepath.Join(dir, "key")
+	script := filepath.Join(dir, "cryptenroll")
+	writeFile(t, script, `#!/bin/sh
+for arg; do
+	case "$arg" in --unlock-key-file=*) cat "${arg#--unlock-key-file=}" > `+keyOut+`;; esac
+done
+echo "$*" >> `+log+`
+`)
+	if err := os.Chmod(script, 0700); err != nil {
+		t.Fatal(err)
+	}
+	prev := cryptenroll
+	cryptenroll = script
+	t.Cleanup(func() { cryptenroll = prev })
+
+	if _, err := Apply(spec, nil); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got, err := os.ReadFile(keyOut); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("cryptenroll read key %q, want %q (%v)", got, key, err)
+	}
+
+	if err := luks2.ImportToken(spec.Device, 0, &luks2.Token{Type: "systemd-tpm2", Keyslots: []string{"0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(spec, nil); err != nil {
+		t.Fatalf("second Apply failed: %v", err)
+	}
+
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--tpm2-device=auto --tpm2-pcrs=7+11 --unlock-key-file=/dev/fd/3 " + spec.Device + "\n"; string(got) != want {
+		t.Errorf("cryptenroll ran with %q, want %q", got, want)
+	}
+}
+
+// TestApplyPlan tests that every spec is applied and failures are reported
+// per device
+func TestApplyPlan(t *testing.T) {
+	root := t.TempDir()
+	var specs []*Spec
+	for range 3 {
+		spec := testSpec(t)
+		spec.Keyslots = spec.Keyslots[:1]
+		specs = append(specs, spec)
+	}
+	specs[1].Keyslots = []KeyslotSpec{{PassphraseEnv: "PROVISION_TEST_UNSET"}}
+
+	summary := ApplyPlan(&Plan{Specs: specs}, &Options{Root: root, Parallel: 3})
+	if len(summary.Devices) != 3 || summary.Changed != 2 || summary.Failed != 1 {
+		t.Fatalf("summary = %+v", summary)
+	}
+	for i, d := range summary.Devices {
+		if d.Spec != specs[i].Device || (d.Err != nil) != (i == 1) || (d.Error != "") != (i == 1) {
+			t.Errorf("devices[%d] = %+v", i, d)
+		}
+	}
+	if err := summary.Err(); err == nil || !strings.Contains(err.Error(), "PROVISION_TEST_UNSET") {
+		t.Errorf("Err() = %v", err)
+	}
+
+	crypttab, err := os.ReadFile(filepath.Join(root, "etc", "crypttab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(crypttab), "\n"); lines != 2 {
+		t.Errorf("crypttab has %d entries, want 2:\n%s", lines, crypttab)
+	}
+}
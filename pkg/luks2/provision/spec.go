@@ -0,0 +1,370 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package provision converges a device to a declarative spec: the LUKS2
+// volume is created if absent, missing keys are enrolled, a filesystem is
+// made if the volume has none and crypttab/fstab entries are written. Every
+// step checks the current state first, so applying the same spec again
+// changes nothing. It is meant for image-build pipelines, cloud-init and
+// ignition hooks that would otherwise script cryptsetup.
+//
+// Specs are JSON or YAML:
+//
+//	{
+//	  "device": "/dev/vdb",
+//	  "label": "data",
+//	  "kdf": {"type": "argon2id", "memory_kb": 262144},
+//	  "keyslots": [
+//	    {"key_file": "/run/secrets/data.key"},
+//	    {"passphrase_env": "RECOVERY_PASSPHRASE"},
+//	    {"recovery": {"path": "/root/recovery/{uuid}.key"}},
+//	    {"tpm2": {"pcrs": [7]}}
+//	  ],
+//	  "filesystem": {"type": "ext4", "label": "data"},
+//	  "crypttab": {"key_file": "/etc/luks/data.key", "options": ["luks", "discard"]},
+//	  "fstab": {"mount_point": "/srv/data", "options": ["defaults", "nofail"], "pass": 2}
+//	}
+//
+// A plan provisions many devices from one file. Each entry of "devices"
+// is a spec whose members replace those of "defaults":
+//
+//	parallel: 4
+//	defaults:
+//	  cipher: aes-xts-plain64
+//	  keyslots:
+//	    - passphrase_env: DISK_PASSPHRASE
+//	    - recovery: {path: "/root/recovery/{name}.key"}
+//	  filesystem: {type: xfs}
+//	devices:
+//	  - {device: /dev/nvme1n1, name: data1}
+//	  - {device: /dev/nvme2n1, name: data2, label: scratch}
+//
+// A volume that already exists is never reformatted. If its cipher, key
+// size or sector size differ from the spec, Apply fails with ErrConflict
+// instead of guessing.
+package provision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrConflict is returned when the device holds something the spec cannot
+// be converged to without destroying data
+var ErrConflict = errors.New("device conflicts with spec")
+
+// Spec declares the desired state of one encrypted volume
+type Spec struct {
+	// Device is a device path or image file, or UUID=/LABEL= of an existing
+	// volume
+	Device string `json:"device"`
+
+	// Name is the device-mapper name used for the filesystem step and in
+	// crypttab (default: luks-<uuid>)
+	Name string `json:"name,omitempty"`
+
+	// Label is the LUKS2 header label of a new volume
+	Label string `json:"label,omitempty"`
+
+	// Cipher, KeySize (bits) and SectorSize of a new volume (defaults:
+	// aes-xts-plain64, 512, 512). They are checked against an existing one.
+	Cipher     string `json:"cipher,omitempty"`
+	KeySize    int    `json:"key_size,omitempty"`
+	SectorSize int    `json:"sector_size,omitempty"`
+
+	// KDF configures key derivation for every keyslot created (nil =
+	// library defaults)
+	KDF *KDFSpec `json:"kdf,omitempty"`
+
+	// Keyslots lists the keys that must unlock the volume. A new volume is
+	// formatted with the first one; the others are enrolled with any key
+	// that already unlocks the volume.
+	Keyslots []KeyslotSpec `json:"keyslots"`
+
+	// Filesystem is created inside the volume if it holds none (nil = leave
+	// the volume contents alone)
+	Filesystem *FilesystemSpec `json:"filesystem,omitempty"`
+
+	// Crypttab and Fstab entries are written for the volume (nil = none)
+	Crypttab *CrypttabSpec `json:"crypttab,omitempty"`
+	Fstab    *FstabSpec    `json:"fstab,omitempty"`
+}
+
+// KDFSpec configures key derivation for new keyslots
+type KDFSpec struct {
+	Type     string `json:"type,omitempty"`         // pbkdf2, argon2i or argon2id
+	Hash     string `json:"hash,omitempty"`         // PBKDF2 hash
+	IterTime int    `json:"iter_time_ms,omitempty"` // PBKDF2 target time in ms
+	Time     int    `json:"time,omitempty"`         // Argon2 time cost
+	Memory   int    `json:"memory_kb,omitempty"`    // Argon2 memory cost in KB
+	Parallel int    `json:"parallel,omitempty"`     // Argon2 parallelism
+}
+
+// KeyslotSpec is one key that must unlock the volume. Exactly one of
+// KeyFile, PassphraseEnv, Recovery and TPM2 is set; the first keyslot of a
+// spec must be a key file or passphrase, which formats and unlocks the
+// volume for the other steps.
+type KeyslotSpec struct {
+	// Slot pins the keyslot number (nil = first free). The first keyslot of
+	// a new volume is always 0. TPM2 keyslots cannot be pinned.
+	Slot *int `json:"slot,omitempty"`
+
+	// KeyFile is read whole, trailing newline included, as cryptsetup
+	// --key-file does
+	KeyFile string `json:"key_file,omitempty"`
+
+	// PassphraseEnv names an environment variable holding the passphrase,
+	// which keeps secrets out of the spec file
+	PassphraseEnv string `json:"passphrase_env,omitempty"`
+
+	// Recovery is a generated recovery key saved to a file
+	Recovery *RecoverySpec `json:"recovery,omitempty"`
+
+	// TPM2 is a key sealed to the TPM by systemd-cryptenroll
+	TPM2 *TPM2Spec `json:"tpm2,omitempty"`
+}
+
+// RecoverySpec is a recovery key generated on the first run. Once its file
+// exists the key in it is treated like a key file.
+type RecoverySpec struct {
+	// Path is where the key is saved; {uuid} and {name} are replaced with
+	// the volume UUID and device-mapper name
+	Path string `json:"path"`
+
+	// Format is dashed, hex or base64 (default: dashed)
+	Format string `json:"format,omitempty"`
+}
+
+// TPM2Spec is a keyslot sealed to a TPM2 chip. A volume with a
+// systemd-tpm2 token is considered enrolled.
+type TPM2Spec struct {
+	Device string `json:"device,omitempty"` // TPM2 device (default: auto)
+	PCRs   []int  `json:"pcrs,omitempty"`   // PCRs the key is bound to
+}
+
+// keyPath returns the recovery key file of the volume uuid mapped as name
+func (r *RecoverySpec) keyPath(uuid, name string) string {
+	return strings.NewReplacer("{uuid}", uuid, "{name}", name).Replace(r.Path)
+}
+
+// sources counts the key sources set in ks
+func (ks *KeyslotSpec) sources() int {
+	n := 0
+	for _, set := range []bool{ks.KeyFile != "", ks.PassphraseEnv != "", ks.Recovery != nil, ks.TPM2 != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// FilesystemSpec is the filesystem inside the volume
+type FilesystemSpec struct {
+	Type  string `json:"type"` // ext2, ext3, ext4, xfs or vfat
+	Label string `json:"label,omitempty"`
+}
+
+// CrypttabSpec is the /etc/crypttab entry of the volume
+type CrypttabSpec struct {
+	// KeyFile is the key file path on the target system ("" = none, which
+	// prompts at boot)
+	KeyFile string `json:"key_file,omitempty"`
+
+	// Options are the crypttab options (default: luks)
+	Options []string `json:"options,omitempty"`
+}
+
+// FstabSpec is the /etc/fstab entry of the filesystem inside the volume
+type FstabSpec struct {
+	MountPoint string   `json:"mount_point"`
+	Options    []string `json:"options,omitempty"` // default: defaults
+	Pass       int      `json:"pass,omitempty"`    // fsck order (0 = not checked)
+}
+
+// Load reads a JSON or YAML spec from a file
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- spec path supplied by caller
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a JSON or YAML spec. Unknown fields are
+// rejected so that typos do not silently drop part of the desired state.
+func Parse(data []byte) (*Spec, error) {
+	data, err := toJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	return parseJSON(data)
+}
+
+// parseJSON decodes and validates a JSON spec
+func parseJSON(data []byte) (*Spec, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var spec Spec
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// toJSON converts a YAML document to JSON so that both formats are decoded
+// with the same field names and checks. JSON input is returned as is.
+func toJSON(data []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return data, nil
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, errors.New("document is not a mapping")
+	}
+	return json.Marshal(doc)
+}
+
+// Validate checks the spec for missing and contradictory settings
+func (s *Spec) Validate() error {
+	if s.Device == "" {
+		return fmt.Errorf("invalid spec: device is required")
+	}
+	if len(s.Keyslots) == 0 {
+		return fmt.Errorf("invalid spec: at least one keyslot is required")
+	}
+	if s.Cipher != "" && !strings.Contains(s.Cipher, "-") {
+		return fmt.Errorf("invalid spec: cipher %q is not of the form cipher-mode (e.g. aes-xts-plain64)", s.Cipher)
+	}
+
+	slots := make(map[int]bool)
+	for i, ks := range s.Keyslots {
+		if ks.sources() != 1 {
+			return fmt.Errorf("invalid spec: keyslot %d needs exactly one of key_file, passphrase_env, recovery and tpm2", i)
+		}
+		if err := ks.validateSource(); err != nil {
+			return fmt.Errorf("invalid spec: keyslot %d: %w", i, err)
+		}
+		if ks.Slot == nil {
+			continue
+		}
+		if *ks.Slot < 0 || *ks.Slot >= luks2.LUKS2MaxKeyslots {
+			return fmt.Errorf("invalid spec: keyslot %d: slot %d out of range", i, *ks.Slot)
+		}
+		if slots[*ks.Slot] {
+			return fmt.Errorf("invalid spec: slot %d used twice", *ks.Slot)
+		}
+		slots[*ks.Slot] = true
+	}
+	if first := s.Keyslots[0]; first.KeyFile == "" && first.PassphraseEnv == "" {
+		return fmt.Errorf("invalid spec: the first keyslot must be a key_file or passphrase_env")
+	}
+	if first := s.Keyslots[0].Slot; first != nil && *first != 0 {
+		return fmt.Errorf("invalid spec: the first keyslot is created in slot 0")
+	}
+	if s.Keyslots[0].Slot == nil && slots[0] {
+		return fmt.Errorf("invalid spec: slot 0 belongs to the first keyslot")
+	}
+
+	if s.Filesystem != nil && !detectable[s.Filesystem.Type] {
+		return fmt.Errorf("invalid spec: unsupported filesystem type %q", s.Filesystem.Type)
+	}
+	if s.Fstab != nil {
+		if s.Filesystem == nil {
+			return fmt.Errorf("invalid spec: fstab needs a filesystem")
+		}
+		if !strings.HasPrefix(s.Fstab.MountPoint, "/") {
+			return fmt.Errorf("invalid spec: fstab mount point must be an absolute path")
+		}
+	}
+	if s.Name != "" && strings.ContainsAny(s.Name, "/ \t\n") {
+		return fmt.Errorf("invalid spec: invalid name %q", s.Name)
+	}
+	return nil
+}
+
+// validateSource checks the settings of a recovery or TPM2 keyslot
+func (ks *KeyslotSpec) validateSource() error {
+	switch {
+	case ks.Recovery != nil:
+		if ks.Recovery.Path == "" {
+			return errors.New("recovery needs a path")
+		}
+		switch luks2.RecoveryKeyFormat(ks.Recovery.Format) {
+		case "", luks2.RecoveryKeyFormatDashed, luks2.RecoveryKeyFormatHex, luks2.RecoveryKeyFormatBase64:
+		default:
+			return fmt.Errorf("unknown recovery key format %q", ks.Recovery.Format)
+		}
+	case ks.TPM2 != nil:
+		if ks.Slot != nil {
+			return errors.New("tpm2 keyslots cannot be pinned")
+		}
+		for _, pcr := range ks.TPM2.PCRs {
+			if pcr < 0 || pcr > 23 {
+				return fmt.Errorf("PCR %d out of range", pcr)
+			}
+		}
+	}
+	return nil
+}
+
+// detectable lists the filesystems DetectFilesystem recognizes. Others
+// cannot be provisioned: Apply could not tell that one already exists and
+// would format the volume again on every run.
+var detectable = map[string]bool{
+	"ext2": true,
+	"ext3": true,
+	"ext4": true,
+	"xfs":  true,
+	"vfat": true,
+}
+
+// readKeys loads the key of every key file and passphrase keyslot; the
+// keys of recovery and TPM2 keyslots are nil. The caller clears them.
+func (s *Spec) readKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(s.Keyslots))
+	for i, ks := range s.Keyslots {
+		var key []byte
+		switch {
+		case ks.Recovery != nil, ks.TPM2 != nil:
+			// Generated or sealed by Apply
+		case ks.KeyFile != "":
+			data, err := os.ReadFile(ks.KeyFile)
+			if err != nil {
+				clearKeys(keys)
+				return nil, fmt.Errorf("keyslot %d: %w", i, err)
+			}
+			key = data
+		default:
+			value, ok := os.LookupEnv(ks.PassphraseEnv)
+			if !ok || value == "" {
+				clearKeys(keys)
+				return nil, fmt.Errorf("keyslot %d: environment variable %s is not set", i, ks.PassphraseEnv)
+			}
+			key = []byte(value)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// clearKeys zeroes keys read by readKeys
+func clearKeys(keys [][]byte) {
+	for _, key := range keys {
+		clear(key)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParse tests decoding a complete spec
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(`{
+		"device": "/dev/vdb",
+		"cipher": "aes-xts-plain64",
+		"kdf": {"type": "argon2id", "memory_kb": 262144},
+		"keyslots": [{"key_file": "/run/secrets/data.key"}, {"slot": 3, "passphrase_env": "RECOVERY"}],
+		"filesystem": {"type": "ext4", "label": "data"},
+		"crypttab": {"options": ["luks", "discard"]},
+		"fstab": {"mount_point": "/srv/data", "pass": 2}
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if spec.Device != "/dev/vdb" || spec.KDF.Memory != 262144 || len(spec.Keyslots) != 2 || *spec.Keyslots[1].Slot != 3 {
+		t.Errorf("Parse() = %+v", spec)
+	}
+	if spec.Filesystem.Type != "ext4" || spec.Fstab.MountPoint != "/srv/data" || spec.Fstab.Pass != 2 {
+		t.Errorf("Parse() filesystem = %+v, fstab = %+v", spec.Filesystem, spec.Fstab)
+	}
+}
+
+// TestParse_YAML tests decoding a YAML spec with the JSON field names
+func TestParse_YAML(t *testing.T) {
+	spec, err := Parse([]byte(`
+device: /dev/vdb
+keyslots:
+  - passphrase_env: DISK_PASSPHRASE
+  - recovery: {path: "/root/recovery/{uuid}.key", format: hex}
+  - tpm2: {pcrs: [7, 11]}
+filesystem: {type: xfs}
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if spec.Device != "/dev/vdb" || len(spec.Keyslots) != 3 || spec.Filesystem.Type != "xfs" {
+		t.Errorf("Parse() = %+v", spec)
+	}
+	if r := spec.Keyslots[1].Recovery; r == nil || r.keyPath("1234", "data") != "/root/recovery/1234.key" || r.Format != "hex" {
+		t.Errorf("recovery = %+v", r)
+	}
+	if tpm := spec.Keyslots[2].TPM2; tpm == nil || len(tpm.PCRs) != 2 {
+		t.Errorf("tpm2 = %+v", tpm)
+	}
+
+	if _, err := Parse([]byte("device: /dev/vdb\nkeyslots: [{key_file: k}]\nmountpoint: /srv\n")); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("Parse accepted an unknown YAML field: %v", err)
+	}
+}
+
+// TestParse_Invalid tests rejecting incomplete and contradictory specs
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{`{"keyslots": [{"key_file": "k"}]}`, "device is required"},
+		{`{"device": "/dev/vdb"}`, "at least one keyslot"},
+		{`{"device": "/dev/vdb", "keyslots": [{}]}`, "exactly one of"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k", "passphrase_env": "P"}]}`, "exactly one of"},
+		{`{"device": "/dev/vdb", "keyslots": [{"slot": 2, "key_file": "k"}]}`, "slot 0"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"slot": 0, "key_file": "j"}]}`, "slot 0"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"slot": 40, "key_file": "j"}]}`, "out of range"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"slot": 1, "key_file": "j"}, {"slot": 1, "key_file": "l"}]}`, "used twice"},
+		{`{"device": "/dev/vdb", "cipher": "aes", "keyslots": [{"key_file": "k"}]}`, "cipher-mode"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}], "filesystem": {"type": "zfs"}}`, "unsupported filesystem"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}], "fstab": {"mount_point": "/srv"}}`, "needs a filesystem"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}], "filesystem": {"type": "ext4"}, "fstab": {"mount_point": "srv"}}`, "absolute"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}], "mountpoint": "/srv"}`, "unknown field"},
+		{`{"device": "/dev/vdb", "keyslots": [{"tpm2": {}}]}`, "first keyslot"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"recovery": {}}]}`, "needs a path"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"recovery": {"path": "r", "format": "words"}}]}`, "recovery key format"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"slot": 1, "tpm2": {}}]}`, "cannot be pinned"},
+		{`{"device": "/dev/vdb", "keyslots": [{"key_file": "k"}, {"tpm2": {"pcrs": [24]}}]}`, "out of range"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.spec))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%s) = %v, want error containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+// TestReadKeys tests loading keys from files and the environment
+func TestReadKeys(t *testing.T) {
+	keyFile := t.TempDir() + "/key"
+	writeFile(t, keyFile, "file-key\n")
+	t.Setenv("PROVISION_TEST_PASSPHRASE", "env-passphrase")
+
+	spec := &Spec{Keyslots: []KeyslotSpec{{KeyFile: keyFile}, {PassphraseEnv: "PROVISION_TEST_PASSPHRASE"}}}
+	keys, err := spec.readKeys()
+	if err != nil {
+		t.Fatalf("readKeys failed: %v", err)
+	}
+	if string(keys[0]) != "file-key\n" || string(keys[1]) != "env-passphrase" {
+		t.Errorf("readKeys() = %q", keys)
+	}
+
+	spec.Keyslots[1].PassphraseEnv = "PROVISION_TEST_UNSET"
+	if _, err := spec.readKeys(); err == nil {
+		t.Error("readKeys accepted an unset environment variable")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// crypttabLine formats the crypttab entry of a volume
+func crypttabLine(name, uuid string, spec *CrypttabSpec) string {
+	options := spec.Options
+	if len(options) == 0 {
+		options = []string{"luks"}
+	}
+	return luks2.CrypttabEntry{Name: name, Device: "UUID=" + uuid, KeyFile: spec.KeyFile, Options: options}.String()
+}
+
+// fstabLine formats the fstab entry of the filesystem inside a volume
+func fstabLine(name, fsType string, spec *FstabSpec) string {
+	return luks2.FstabEntry{Device: "/dev/mapper/" + name, MountPoint: spec.MountPoint, Type: fsType, Options: spec.Options, Pass: spec.Pass}.String()
+}
+
+// upsertLine replaces the entry of table whose field number key (0-based)
+// equals the same field of line, or appends line if there is none. Comments
+// and other entries are kept as they are. It reports whether table changed.
+func upsertLine(table []byte, key int, line string) ([]byte, bool) {
+	want := strings.Fields(line)[key]
+	lines := strings.SplitAfter(string(table), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	found := false
+	var out []string
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if len(fields) <= key || strings.HasPrefix(fields[0], "#") || fields[key] != want {
+			out = append(out, l)
+			continue
+		}
+		if found {
+			// Drop duplicates so the entry is unambiguous
+			continue
+		}
+		found = true
+		out = append(out, line+"\n")
+	}
+	if !found {
+		if n := len(out); n > 0 && !strings.HasSuffix(out[n-1], "\n") {
+			out[n-1] += "\n"
+		}
+		out = append(out, line+"\n")
+	}
+
+	updated := []byte(strings.Join(out, ""))
+	return updated, !bytes.Equal(updated, table)
+}
+
+// tabMu serializes table updates, which ApplyPlan makes from several
+// goroutines
+var tabMu sync.Mutex
+
+// updateTable makes sure path has line as the entry keyed by field key,
+// creating the file with perm if needed. The file is replaced atomically and
+// only when its contents change.
+func updateTable(path string, key int, line string, perm os.FileMode) (bool, error) {
+	tabMu.Lock()
+	defer tabMu.Unlock()
+
+	table, err := os.ReadFile(path) // #nosec G304 -- fixed path under the target root
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	updated, changed := upsertLine(table, key, line)
+	if !changed {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { // #nosec G301 -- /etc must stay world-readable
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(updated); err != nil {
+		_ = tmp.Close()
+		return false, err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return false, err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package provision
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes a test file
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTabLines tests formatting crypttab and fstab entries
+func TestTabLines(t *testing.T) {
+	if got := crypttabLine("data", "1234", &CrypttabSpec{}); got != "data\tUUID=1234\tnone\tluks" {
+		t.Errorf("crypttabLine() = %q", got)
+	}
+	if got := crypttabLine("data", "1234", &CrypttabSpec{KeyFile: "/etc/luks/my key", Options: []string{"luks", "discard"}}); got != `data	UUID=1234	/etc/luks/my\040key	luks,discard` {
+		t.Errorf("crypttabLine() = %q", got)
+	}
+	if got := fstabLine("data", "ext4", &FstabSpec{MountPoint: "/srv/data", Pass: 2}); got != "/dev/mapper/data\t/srv/data\text4\tdefaults\t0\t2" {
+		t.Errorf("fstabLine() = %q", got)
+	}
+}
+
+// TestUpsertLine tests adding and replacing table entries
+func TestUpsertLine(t *testing.T) {
+	table := "# /etc/crypttab\nswap /dev/sda2 /dev/urandom swap\ndata UUID=old none luks\n"
+
+	updated, changed := upsertLine([]byte(table), 0, "data\tUUID=new\tnone\tluks")
+	if !changed || string(updated) != "# /etc/crypttab\nswap /dev/sda2 /dev/urandom swap\ndata\tUUID=new\tnone\tluks\n" {
+		t.Errorf("replace: changed = %v, table = %q", changed, updated)
+	}
+
+	if again, changed := upsertLine(updated, 0, "data\tUUID=new\tnone\tluks"); changed || string(again) != string(updated) {
+		t.Errorf("second upsert changed the table: %q", again)
+	}
+
+	updated, changed = upsertLine([]byte("swap /dev/sda2 /dev/urandom swap"), 0, "data\tUUID=new\tnone\tluks")
+	if !changed || string(updated) != "swap /dev/sda2 /dev/urandom swap\ndata\tUUID=new\tnone\tluks\n" {
+		t.Errorf("append: table = %q", updated)
+	}
+
+	// Commented-out entries and duplicates
+	updated, _ = upsertLine([]byte("#data UUID=x none\ndata UUID=a none\ndata UUID=b none\n"), 0, "data\tUUID=c\tnone\tluks")
+	if string(updated) != "#data UUID=x none\ndata\tUUID=c\tnone\tluks\n" {
+		t.Errorf("duplicates: table = %q", updated)
+	}
+
+	// fstab entries are keyed by mount point
+	updated, _ = upsertLine([]byte("/dev/sda1 / ext4 defaults 0 1\n/dev/sdb1 /srv/data xfs defaults 0 2\n"), 1, "/dev/mapper/data\t/srv/data\text4\tdefaults\t0\t2")
+	if string(updated) != "/dev/sda1 / ext4 defaults 0 1\n/dev/mapper/data\t/srv/data\text4\tdefaults\t0\t2\n" {
+		t.Errorf("fstab: table = %q", updated)
+	}
+}
+
+// TestUpdateTable tests creating and rewriting a table file in place
+func TestUpdateTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etc", "fstab")
+
+	if changed, err := updateTable(path, 1, "/dev/mapper/data\t/srv\text4\tdefaults\t0\t2", 0644); err != nil || !changed {
+		t.Fatalf("updateTable = %v, %v", changed, err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("new table mode = %v, want 0644", fi.Mode().Perm())
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := updateTable(path, 1, "/dev/mapper/data\t/srv\text4\tdefaults\t0\t2", 0644); err != nil || changed {
+		t.Errorf("unchanged updateTable = %v, %v", changed, err)
+	}
+	if changed, err := updateTable(path, 1, "/dev/mapper/data\t/srv\text4\tnofail\t0\t2", 0644); err != nil || !changed {
+		t.Errorf("updateTable = %v, %v", changed, err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Errorf("rewritten table mode = %v, want the existing 0600", fi.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,596 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// volumeReadChunk caps how much ciphertext ReadAt and WriteAt process at once
+const volumeReadChunk = 1024 * 1024 // 1MB
+
+// Volume reads and writes the decrypted contents of a LUKS2 volume in
+// userspace, without device-mapper, loop devices or root. It works on every
+// platform the package builds on, which makes it the way to get data in and
+// out of an image file on Windows and macOS. Volume implements io.ReaderAt
+// and io.WriterAt over the data segments exactly as the mapping created by
+// Unlock would expose them; wrap it in an io.SectionReader for sequential
+// access or hand it to a filesystem reader.
+//
+// Only aes-xts-plain64 segments can be decrypted. A Volume is read-only
+// unless opened with VolumeOptions.Writable, and is safe for concurrent use.
+// Large reads and writes are encrypted on all cores; see
+// VolumeOptions.Concurrency. Small random reads can be served from a cache
+// of decrypted blocks; see VolumeOptions.CacheSize.
+// The expanded AES key schedule lives in the Go heap until Close, where it
+// cannot be wiped.
+type Volume struct {
+	mu       sync.RWMutex
+	device   string
+	f        *os.File
+	writable bool
+	extents  []volumeExtent
+	size     int64
+	pool     *cryptPool   // nil when sectors are processed by the caller only
+	cache    *volumeCache // nil without VolumeOptions.CacheSize
+	ring     *uringWriter // nil when ciphertext is written with pwrite
+}
+
+// VolumeOptions contains optional settings for OpenVolume and
+// OpenVolumeWithKey
+type VolumeOptions struct {
+	// Unlock selects the keyslot and the derivation parallelism for
+	// OpenVolume (nil = defaults); its dm-crypt flags do not apply
+	Unlock *UnlockOptions
+
+	// Writable opens the device read-write so WriteAt can encrypt data into
+	// the volume
+	Writable bool
+
+	// Concurrency is how many goroutines encrypt and decrypt the sectors of
+	// large reads and writes (0 = GOMAXPROCS, 1 = the calling goroutine
+	// only)
+	Concurrency int
+
+	// CacheSize keeps up to this many bytes of decrypted data in memory, in
+	// 64KB blocks evicted least recently used first, so repeated small reads
+	// do not decrypt their sectors again (0 = no cache). Writes invalidate
+	// the blocks they touch; Close zeroes the cache.
+	CacheSize int64
+
+	// ReadAhead loads this many bytes past a read that continues the
+	// previous one into the cache (0 = none). It needs CacheSize.
+	ReadAhead int64
+
+	// IOEngine selects how a writable volume writes ciphertext. With
+	// IOEngineURing the 1MB chunks of a large WriteAt are queued with up to
+	// QueueDepth in flight (0 = DefaultQueueDepth) while the next ones are
+	// encrypted; WriteAt returns once all of them are written.
+	IOEngine   IOEngine
+	QueueDepth int
+}
+
+// volumeExtent is one data segment as it appears in the decrypted volume
+type volumeExtent struct {
+	start      int64      // Offset in the decrypted volume
+	length     int64      // Length in bytes
+	offset     int64      // Offset on the device
+	sectorSize int64      // Encryption sector size (crypt segments only)
+	ivTweak    uint64     // IV of the segment's first sector
+	cipher     *xtsCipher // nil for linear segments
+}
+
+// OpenVolume recovers the volume key with passphrase and opens the volume
+// (opts nil = read-only, default keyslot order)
+func OpenVolume(device string, passphrase []byte, opts *VolumeOptions) (*Volume, error) {
+	if opts == nil {
+		opts = &VolumeOptions{}
+	}
+	unlockOpts := opts.Unlock
+	if unlockOpts == nil {
+		unlockOpts = &UnlockOptions{}
+	}
+
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, _, err := getMasterKeyWithOptions(device, passphrase, metadata, unlockOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock any keyslot: %w", err)
+	}
+	defer masterKey.Destroy()
+
+	return newVolume(device, metadata, masterKey.Bytes(), opts)
+}
+
+// OpenVolumeWithKey opens a volume with a volume key escrowed by
+// ExtractVolumeKey (opts nil = read-only). The key is verified against the
+// header digest first.
+func OpenVolumeWithKey(device string, volumeKey []byte, opts *VolumeOptions) (*Volume, error) {
+	if opts == nil {
+		opts = &VolumeOptions{}
+	}
+
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyVolumeKey(volumeKey, metadata); err != nil {
+		return nil, err
+	}
+
+	return newVolume(device, metadata, volumeKey, opts)
+}
+
+// newVolume lays out the data segments of metadata and sets up their ciphers
+func newVolume(device string, metadata *LUKS2Metadata, masterKey []byte, opts *VolumeOptions) (*Volume, error) {
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	if concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency %d", opts.Concurrency)
+	}
+	if opts.CacheSize < 0 || opts.ReadAhead < 0 {
+		return nil, fmt.Errorf("invalid cache size %d or read-ahead %d", opts.CacheSize, opts.ReadAhead)
+	}
+	if opts.ReadAhead > 0 && opts.CacheSize == 0 {
+		return nil, errors.New("read-ahead needs a cache size")
+	}
+	var depth int
+	if opts.Writable {
+		var err error
+		if depth, err = queueDepth(opts.IOEngine, opts.QueueDepth, "volume-write", device); err != nil {
+			return nil, err
+		}
+	}
+
+	extents, segs, err := volumeLayout(device, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Volume{device: device, writable: opts.Writable, extents: extents}
+	for i, seg := range segs {
+		ext := &v.extents[i]
+		if seg.Type == SegmentTypeCrypt {
+			if seg.Encryption != "aes-xts-plain64" {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedCipher, seg.Encryption)
+			}
+			if ext.cipher, err = newXTSCipher(masterKey); err != nil {
+				return nil, fmt.Errorf("failed to create XTS cipher: %w", err)
+			}
+		}
+		v.size += ext.length
+	}
+
+	flag := os.O_RDONLY
+	if opts.Writable {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(device, flag, 0) // #nosec G304 -- device path validated by caller
+	if err != nil {
+		return nil, err
+	}
+	v.f = f
+
+	if concurrency > 1 {
+		v.pool = newCryptPool(concurrency - 1)
+	}
+	if opts.CacheSize > 0 {
+		v.cache = newVolumeCache(opts.CacheSize, opts.ReadAhead)
+	}
+	if depth > 0 {
+		if v.ring, err = newURingWriter(f, depth, clearBytes); err != nil {
+			_ = v.Close()
+			return nil, fmt.Errorf("failed to set up io_uring: %w", err)
+		}
+	}
+	return v, nil
+}
+
+// volumeLayout places the data segments of metadata in the decrypted volume
+// and on device, without ciphers. The segments are returned alongside
+// their extents.
+func volumeLayout(device string, metadata *LUKS2Metadata) ([]volumeExtent, []*Segment, error) {
+	segs, err := mappedSegments(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var extents []volumeExtent
+	var start int64
+	for _, seg := range segs {
+		offset, err := parseSize(seg.Offset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid segment offset: %w", err)
+		}
+
+		var length int64
+		if seg.Size == "dynamic" {
+			devSize, err := getBlockDeviceSize(device)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get device size: %w", err)
+			}
+			length = devSize - offset
+		} else if length, err = parseSize(seg.Size); err != nil {
+			return nil, nil, fmt.Errorf("invalid segment size: %w", err)
+		}
+
+		ext := volumeExtent{start: start, offset: offset}
+		if seg.Type == SegmentTypeCrypt {
+			ext.sectorSize = int64(seg.SectorSize)
+			if ext.sectorSize == 0 {
+				ext.sectorSize = LUKS2SectorSize
+			}
+			ext.ivTweak = parseIVTweak(seg.IVTweak)
+			// Only whole encryption sectors are readable, as with dm-crypt
+			length -= length % ext.sectorSize
+		}
+		if length < 0 {
+			return nil, nil, fmt.Errorf("%w: segment extends past the end of %s", ErrInvalidSegmentLayout, device)
+		}
+
+		ext.length = length
+		extents = append(extents, ext)
+		start += length
+	}
+	return extents, segs, nil
+}
+
+// Size returns the size of the decrypted volume in bytes
+func (v *Volume) Size() int64 {
+	return v.size
+}
+
+// ReadAt reads decrypted data at offset off of the volume
+func (v *Volume) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%w: negative offset %d", ErrInvalidSize, off)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.f == nil {
+		return 0, os.ErrClosed
+	}
+	if v.cache != nil {
+		return v.readCached(p, off)
+	}
+	return v.readUncached(p, off)
+}
+
+// readUncached reads and decrypts p from the device
+func (v *Volume) readUncached(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		if off >= v.size {
+			return read, io.EOF
+		}
+		n, err := v.readExtent(p[read:], off)
+		read += n
+		off += int64(n)
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// readCached copies p out of the cache, loading the blocks it misses
+func (v *Volume) readCached(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		if off >= v.size {
+			return read, io.EOF
+		}
+		index := off / volumeCacheBlock
+		n, ok := v.cache.get(index, p[read:], int(off%volumeCacheBlock))
+		if !ok {
+			if err := v.fillCache(index); err != nil {
+				return read, err
+			}
+			continue
+		}
+		read += n
+		off += int64(n)
+	}
+	return read, nil
+}
+
+// fillCache decrypts block index, and the read-ahead following it, in one
+// read and caches each block
+func (v *Volume) fillCache(index int64) error {
+	start := index * volumeCacheBlock
+	end := min(start+v.cache.loadCount(index)*volumeCacheBlock, v.size)
+	buf := make([]byte, end-start)
+	if _, err := v.readUncached(buf, start); err != nil {
+		clearBytes(buf)
+		return err
+	}
+	for len(buf) > 0 {
+		n := min(len(buf), volumeCacheBlock)
+		v.cache.put(index, buf[:n:n])
+		buf = buf[n:]
+		index++
+	}
+	return nil
+}
+
+// readExtent reads from the extent containing off, at most up to its end
+func (v *Volume) readExtent(p []byte, off int64) (int, error) {
+	ext, rel, n := v.locate(off, len(p))
+	if ext.cipher == nil {
+		return v.f.ReadAt(p[:n], ext.offset+rel)
+	}
+
+	first, buf, err := v.readSectors(ext, rel, n)
+	if err != nil {
+		return 0, err
+	}
+	defer clearBytes(buf)
+
+	return copy(p[:n], buf[rel-first:]), nil
+}
+
+// WriteAt encrypts p into the volume at offset off. Partial sectors are read,
+// decrypted and merged first. Writes past the end of the volume fail.
+func (v *Volume) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > v.size {
+		return 0, fmt.Errorf("%w: write of %d bytes at %d outside the %d-byte volume", ErrInvalidSize, len(p), off, v.size)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.f == nil {
+		return 0, os.ErrClosed
+	}
+	if !v.writable {
+		return 0, fmt.Errorf("%w: volume opened read-only", ErrPermissionDenied)
+	}
+
+	if v.cache != nil && len(p) > 0 {
+		defer v.cache.invalidate(off/volumeCacheBlock, (off+int64(len(p))-1)/volumeCacheBlock)
+	}
+
+	written := 0
+	for written < len(p) {
+		n, err := v.writeExtent(p[written:], off)
+		written += n
+		off += int64(n)
+		if err != nil {
+			v.flushQueued()
+			return written, err
+		}
+	}
+	// A queued write that failed may be any of them
+	if err := v.flushQueued(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// flushQueued waits for the queued ciphertext writes. A failure leaves the
+// ring unusable, so further writes go through pwrite.
+func (v *Volume) flushQueued() error {
+	if v.ring == nil {
+		return nil
+	}
+	err := v.ring.flush()
+	if err != nil {
+		_ = v.ring.close()
+		v.ring = nil
+	}
+	return err
+}
+
+// writeExtent writes to the extent containing off, at most up to its end
+func (v *Volume) writeExtent(p []byte, off int64) (int, error) {
+	ext, rel, n := v.locate(off, len(p))
+	if ext.cipher == nil {
+		return v.f.WriteAt(p[:n], ext.offset+rel)
+	}
+
+	// End the chunk on a sector boundary, so only the first and the last
+	// chunk of a write have partial sectors to merge and no chunk reads a
+	// sector an earlier one is still writing
+	if end := (rel + n) % ext.sectorSize; end != 0 && n > ext.sectorSize-rel%ext.sectorSize {
+		n -= end
+	}
+
+	var first int64
+	var buf []byte
+	if rel%ext.sectorSize == 0 && n%ext.sectorSize == 0 {
+		first, buf = rel, make([]byte, n)
+	} else {
+		var err error
+		if first, buf, err = v.readSectors(ext, rel, n); err != nil {
+			return 0, err
+		}
+	}
+
+	copy(buf[rel-first:], p[:n])
+	v.crypt(ext, buf, first, true)
+	if v.ring != nil {
+		// Cleared once written
+		return int(n), v.ring.write(buf, ext.offset+first)
+	}
+	defer clearBytes(buf)
+	if _, err := v.f.WriteAt(buf, ext.offset+first); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// locate returns the extent containing off, the offset within it and how
+// many of size bytes to transfer there in one go
+func (v *Volume) locate(off int64, size int) (*volumeExtent, int64, int64) {
+	var ext *volumeExtent
+	for i := range v.extents {
+		if off < v.extents[i].start+v.extents[i].length {
+			ext = &v.extents[i]
+			break
+		}
+	}
+
+	rel := off - ext.start
+	return ext, rel, min(int64(size), ext.length-rel, volumeReadChunk)
+}
+
+// readSectors reads and decrypts the whole sectors of ext covering
+// [rel, rel+n) and returns the offset of the first one
+func (v *Volume) readSectors(ext *volumeExtent, rel, n int64) (int64, []byte, error) {
+	first := rel - rel%ext.sectorSize
+	last := rel + n + (ext.sectorSize-(rel+n)%ext.sectorSize)%ext.sectorSize
+	buf := make([]byte, last-first)
+	if _, err := v.f.ReadAt(buf, ext.offset+first); err != nil {
+		clearBytes(buf)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	v.crypt(ext, buf, first, false)
+	return first, buf, nil
+}
+
+// crypt encrypts or decrypts whole sectors of ext in place, on the workers
+// when there is more than a batch for each of two
+func (v *Volume) crypt(ext *volumeExtent, buf []byte, rel int64, encrypt bool) {
+	if v.pool == nil || len(buf) < 2*volumeCryptBatch {
+		ext.crypt(buf, rel, encrypt)
+		return
+	}
+	v.pool.crypt(ext, buf, rel, encrypt)
+}
+
+// crypt encrypts or decrypts whole sectors in place; rel is the offset of
+// buf within the extent
+func (ext *volumeExtent) crypt(buf []byte, rel int64, encrypt bool) {
+	sectorSize := int(ext.sectorSize)
+	sector := uint64(rel/ext.sectorSize) + ext.ivTweak // #nosec G115 -- offsets are non-negative
+	for i := 0; i < len(buf); i += sectorSize {
+		if encrypt {
+			ext.cipher.Encrypt(buf[i:i+sectorSize], buf[i:i+sectorSize], sector)
+		} else {
+			ext.cipher.Decrypt(buf[i:i+sectorSize], buf[i:i+sectorSize], sector)
+		}
+		sector++
+	}
+}
+
+// Sync commits written data to stable storage
+func (v *Volume) Sync() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.f == nil {
+		return os.ErrClosed
+	}
+	return v.f.Sync()
+}
+
+// volumeChunk is a chunk of the volume read ahead by WriteTo
+type volumeChunk struct {
+	buf []byte
+	err error
+}
+
+// WriteTo writes the whole decrypted volume to w, implementing io.WriterTo.
+// The next chunk is read and decrypted while the current one is written.
+func (v *Volume) WriteTo(w io.Writer) (int64, error) {
+	chunks := make(chan volumeChunk, 1)
+	stop := make(chan struct{})
+	go func() {
+		defer close(chunks)
+		for off := int64(0); off < v.size; off += volumeReadChunk {
+			buf := make([]byte, min(volumeReadChunk, v.size-off))
+			n, err := v.ReadAt(buf, off)
+			select {
+			case chunks <- volumeChunk{buf: buf[:n], err: err}:
+			case <-stop:
+				clearBytes(buf)
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// Stop the reader and wipe what it read ahead before returning
+	defer func() {
+		close(stop)
+		for c := range chunks {
+			clearBytes(c.buf)
+		}
+	}()
+
+	var written int64
+	for c := range chunks {
+		n, err := w.Write(c.buf)
+		written += int64(n)
+		clearBytes(c.buf)
+		if err == nil && n < len(c.buf) {
+			err = io.ErrShortWrite
+		}
+		if err == nil && c.err != nil {
+			err = c.err
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close closes the device and drops the ciphers. It is safe to call more than
+// once.
+func (v *Volume) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.f == nil {
+		return nil
+	}
+	if v.ring != nil {
+		_ = v.ring.close()
+		v.ring = nil
+	}
+	err := v.f.Close()
+	v.f = nil
+	if v.pool != nil {
+		v.pool.close()
+		v.pool = nil
+	}
+	if v.cache != nil {
+		v.cache.clear()
+		v.cache = nil
+	}
+	for _, ext := range v.extents {
+		if ext.cipher != nil {
+			ext.cipher.Clear()
+		}
+	}
+	v.extents = nil
+	return err
+}
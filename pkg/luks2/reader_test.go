@@ -0,0 +1,524 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/xts"
+)
+
+// writeTestData fills the data segment of device with a pattern encrypted the
+// way dm-crypt would and returns the plaintext
+func writeTestData(t *testing.T, device string, volumeKey []byte) []byte {
+	t.Helper()
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	seg := metadata.Segments["0"]
+	offset, _ := parseSize(seg.Offset)
+	fi, err := os.Stat(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectorSize := seg.SectorSize
+	length := (fi.Size() - offset) / int64(sectorSize) * int64(sectorSize)
+
+	plain := make([]byte, length)
+	for i := range plain {
+		plain[i] = byte(i*7 + i/4096)
+	}
+
+	c, err := xts.NewCipher(aes.NewCipher, volumeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := make([]byte, len(plain))
+	sector := parseIVTweak(seg.IVTweak)
+	for i := 0; i < len(plain); i += sectorSize {
+		c.Encrypt(enc[i:i+sectorSize], plain[i:i+sectorSize], sector)
+		sector++
+	}
+
+	f, err := os.OpenFile(device, os.O_RDWR, 0) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.WriteAt(enc, offset); err != nil {
+		t.Fatal(err)
+	}
+
+	return plain
+}
+
+// formatSectorVolume formats a small test volume with the given encryption
+// sector size
+func formatSectorVolume(t *testing.T, passphrase []byte, sectorSize int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    passphrase,
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		SectorSize:    sectorSize,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	return path
+}
+
+// TestVolume_ReadAt tests decrypting data in userspace at arbitrary offsets
+func TestVolume_ReadAt(t *testing.T) {
+	passphrase := []byte("test-password")
+
+	for _, sectorSize := range []int{512, 4096} {
+		device := formatSectorVolume(t, passphrase, sectorSize)
+		key, err := ExtractVolumeKey(device, passphrase)
+		if err != nil {
+			t.Fatalf("ExtractVolumeKey failed: %v", err)
+		}
+		plain := writeTestData(t, device, key)
+
+		vol, err := OpenVolume(device, passphrase, nil)
+		if err != nil {
+			t.Fatalf("OpenVolume failed: %v", err)
+		}
+		if vol.Size() != int64(len(plain)) {
+			t.Fatalf("Size() = %d, want %d", vol.Size(), len(plain))
+		}
+
+		// Aligned, unaligned and sector-spanning reads
+		for _, r := range []struct{ off, n int }{{0, 512}, {1000, 100}, {4000, 9000}, {len(plain) - 4096, 4096}} {
+			buf := make([]byte, r.n)
+			if _, err := vol.ReadAt(buf, int64(r.off)); err != nil {
+				t.Fatalf("sector size %d: ReadAt(%d, %d) failed: %v", sectorSize, r.off, r.n, err)
+			}
+			if !bytes.Equal(buf, plain[r.off:r.off+r.n]) {
+				t.Errorf("sector size %d: ReadAt(%d, %d) returned wrong data", sectorSize, r.off, r.n)
+			}
+		}
+
+		// Reading past the end stops at the end of the volume
+		buf := make([]byte, 20)
+		if n, err := vol.ReadAt(buf, vol.Size()-10); n != 10 || err != io.EOF {
+			t.Errorf("ReadAt at the end = %d, %v; want 10, EOF", n, err)
+		}
+
+		var out bytes.Buffer
+		if n, err := vol.WriteTo(&out); err != nil || n != vol.Size() || !bytes.Equal(out.Bytes(), plain) {
+			t.Errorf("WriteTo = %d, %v; want the whole plaintext", n, err)
+		}
+
+		if err := vol.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+		if _, err := vol.ReadAt(buf, 0); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("ReadAt after Close = %v, want os.ErrClosed", err)
+		}
+		if err := vol.Close(); err != nil {
+			t.Errorf("second Close failed: %v", err)
+		}
+	}
+}
+
+// TestVolume_WriteAt tests encrypting data in userspace
+func TestVolume_WriteAt(t *testing.T) {
+	passphrase := []byte("test-password")
+
+	for _, sectorSize := range []int{512, 4096} {
+		device := formatSectorVolume(t, passphrase, sectorSize)
+
+		vol, err := OpenVolume(device, passphrase, nil)
+		if err != nil {
+			t.Fatalf("OpenVolume failed: %v", err)
+		}
+		if _, err := vol.WriteAt([]byte("data"), 0); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("WriteAt on a read-only volume = %v, want ErrPermissionDenied", err)
+		}
+		_ = vol.Close()
+
+		vol, err = OpenVolume(device, passphrase, &VolumeOptions{Writable: true})
+		if err != nil {
+			t.Fatalf("OpenVolume failed: %v", err)
+		}
+		// Unaligned writes spanning sectors, and a whole sector
+		data := bytes.Repeat([]byte("luks2 userspace "), 700)
+		if n, err := vol.WriteAt(data, 300); err != nil || n != len(data) {
+			t.Fatalf("WriteAt = %d, %v", n, err)
+		}
+		if _, err := vol.WriteAt(data[:sectorSize], int64(sectorSize)); err != nil {
+			t.Fatalf("WriteAt of a whole sector failed: %v", err)
+		}
+		if _, err := vol.WriteAt(data, vol.Size()-10); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("WriteAt past the end = %v, want ErrInvalidSize", err)
+		}
+		if err := vol.Sync(); err != nil {
+			t.Errorf("Sync failed: %v", err)
+		}
+		_ = vol.Close()
+
+		vol, err = OpenVolume(device, passphrase, nil)
+		if err != nil {
+			t.Fatalf("OpenVolume failed: %v", err)
+		}
+		buf := make([]byte, len(data))
+		if _, err := vol.ReadAt(buf, 300); err != nil {
+			t.Fatalf("ReadAt failed: %v", err)
+		}
+		want := append([]byte(nil), data...)
+		copy(want[sectorSize-300:], data[:sectorSize])
+		if !bytes.Equal(buf, want) {
+			t.Errorf("sector size %d: data read back differs from data written", sectorSize)
+		}
+		_ = vol.Close()
+	}
+}
+
+// TestOpenVolume_WrongPassphrase tests that a wrong passphrase opens nothing
+func TestOpenVolume_WrongPassphrase(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	if _, err := OpenVolume(device, []byte("wrong-password"), nil); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("OpenVolume = %v, want ErrInvalidPassphrase", err)
+	}
+}
+
+// TestOpenVolumeWithKey tests opening a volume with an escrowed volume key
+func TestOpenVolumeWithKey(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	key, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	plain := writeTestData(t, device, key)
+
+	vol, err := OpenVolumeWithKey(device, key, nil)
+	if err != nil {
+		t.Fatalf("OpenVolumeWithKey failed: %v", err)
+	}
+	defer func() { _ = vol.Close() }()
+
+	buf := make([]byte, 4096)
+	if _, err := vol.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, plain[:4096]) {
+		t.Errorf("ReadAt = %v or wrong data", err)
+	}
+
+	wrong := bytes.Repeat([]byte{0x42}, len(key))
+	if _, err := OpenVolumeWithKey(device, wrong, nil); err == nil {
+		t.Error("OpenVolumeWithKey accepted a wrong key")
+	}
+}
+
+// TestOpenVolume_UnsupportedCipher tests rejecting ciphers other than
+// aes-xts-plain64
+func TestOpenVolume_UnsupportedCipher(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Segments["0"].Encryption = "serpent-xts-plain64"
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	if _, err := OpenVolume(device, passphrase, nil); !errors.Is(err, ErrUnsupportedCipher) {
+		t.Errorf("OpenVolume = %v, want ErrUnsupportedCipher", err)
+	}
+}
+
+// TestVolume_Concurrency tests that large reads and writes spread over
+// workers give the same data as the calling goroutine alone
+func TestVolume_Concurrency(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatSectorVolume(t, passphrase, 4096)
+	key, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	plain := writeTestData(t, device, key)
+
+	for _, concurrency := range []int{1, 2, 4, 0} {
+		vol, err := OpenVolumeWithKey(device, key, &VolumeOptions{Writable: true, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("OpenVolumeWithKey failed: %v", err)
+		}
+		if (vol.pool != nil) != (concurrency > 1 || concurrency == 0 && runtime.GOMAXPROCS(0) > 1) {
+			t.Errorf("concurrency %d: pool = %v", concurrency, vol.pool)
+		}
+
+		// Whole chunks, a read ending mid-batch and one spanning chunks
+		for _, r := range []struct{ off, n int }{{0, len(plain)}, {4096, 3*volumeCryptBatch + 100}, {volumeReadChunk - 5000, 300000}} {
+			buf := make([]byte, r.n)
+			if _, err := vol.ReadAt(buf, int64(r.off)); err != nil {
+				t.Fatalf("concurrency %d: ReadAt(%d, %d) failed: %v", concurrency, r.off, r.n, err)
+			}
+			if !bytes.Equal(buf, plain[r.off:r.off+r.n]) {
+				t.Errorf("concurrency %d: ReadAt(%d, %d) returned wrong data", concurrency, r.off, r.n)
+			}
+		}
+
+		var out bytes.Buffer
+		if n, err := vol.WriteTo(&out); err != nil || n != vol.Size() || !bytes.Equal(out.Bytes(), plain) {
+			t.Errorf("concurrency %d: WriteTo = %d, %v; want the whole plaintext", concurrency, n, err)
+		}
+
+		// Writing the plaintext back leaves the ciphertext as it was
+		if _, err := vol.WriteAt(plain[1000:1000+5*volumeCryptBatch], 1000); err != nil {
+			t.Fatalf("concurrency %d: WriteAt failed: %v", concurrency, err)
+		}
+		if err := vol.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	}
+
+	vol, err := OpenVolumeWithKey(device, key, &VolumeOptions{Concurrency: 1})
+	if err != nil {
+		t.Fatalf("OpenVolumeWithKey failed: %v", err)
+	}
+	defer func() { _ = vol.Close() }()
+	buf := make([]byte, len(plain))
+	if _, err := vol.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, plain) {
+		t.Errorf("data changed by parallel writes: %v", err)
+	}
+
+	if _, err := OpenVolumeWithKey(device, key, &VolumeOptions{Concurrency: -1}); err == nil {
+		t.Error("negative concurrency accepted")
+	}
+}
+
+// failingWriter accepts limit bytes and then fails
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errors.New("disk full")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+// TestVolume_WriteToError tests that WriteTo stops reading ahead when the
+// writer fails
+func TestVolume_WriteToError(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	vol, err := OpenVolume(device, passphrase, &VolumeOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = vol.Close() }()
+
+	n, err := vol.WriteTo(&failingWriter{limit: volumeReadChunk + 10})
+	if err == nil || n != volumeReadChunk+10 {
+		t.Errorf("WriteTo = %d, %v; want %d and the writer's error", n, err, volumeReadChunk+10)
+	}
+}
+
+// BenchmarkVolume_ReadAt compares decrypting 1MB reads on the calling
+// goroutine with spreading them over GOMAXPROCS
+func BenchmarkVolume_ReadAt(b *testing.B) {
+	passphrase := []byte("test-password")
+	path := filepath.Join(b.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*1024*1024); err != nil {
+		b.Fatal(err)
+	}
+	if err := Format(FormatOptions{Device: path, Passphrase: passphrase, KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		b.Fatal(err)
+	}
+	key, err := ExtractVolumeKey(path, passphrase)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			vol, err := OpenVolumeWithKey(path, key, &VolumeOptions{Concurrency: concurrency})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() { _ = vol.Close() }()
+
+			buf := make([]byte, volumeReadChunk)
+			b.SetBytes(volumeReadChunk)
+			for b.Loop() {
+				if _, err := vol.ReadAt(buf, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestVolume_Cache tests serving reads from the block cache, read-ahead,
+// invalidation by writes and zeroing on Close
+func TestVolume_Cache(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatSectorVolume(t, passphrase, 512)
+	key, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	plain := writeTestData(t, device, key)
+
+	vol, err := OpenVolumeWithKey(device, key, &VolumeOptions{
+		Writable:  true,
+		CacheSize: 4 * volumeCacheBlock,
+		ReadAhead: 2 * volumeCacheBlock,
+	})
+	if err != nil {
+		t.Fatalf("OpenVolumeWithKey failed: %v", err)
+	}
+	cached := func() []int64 {
+		var indexes []int64
+		for e := vol.cache.lru.Front(); e != nil; e = e.Next() {
+			indexes = append(indexes, e.Value.(*cachedBlock).index)
+		}
+		return indexes
+	}
+	read := func(off, n int) {
+		t.Helper()
+		buf := make([]byte, n)
+		if _, err := vol.ReadAt(buf, int64(off)); err != nil {
+			t.Fatalf("ReadAt(%d, %d) failed: %v", off, n, err)
+		}
+		if !bytes.Equal(buf, plain[off:off+n]) {
+			t.Fatalf("ReadAt(%d, %d) returned wrong data", off, n)
+		}
+	}
+
+	// A read at the start continues nothing and loads two blocks ahead
+	read(100, 10)
+	if got := cached(); len(got) != 3 {
+		t.Fatalf("cached blocks after the first read = %v, want 0-2", got)
+	}
+	// Served from the cache, then a sequential miss reads ahead again,
+	// evicting the least recently used blocks
+	read(volumeCacheBlock+5, 2*volumeCacheBlock)
+	read(3*volumeCacheBlock, 100)
+	if got := cached(); len(got) != 4 || got[0] != 3 {
+		t.Errorf("cached blocks = %v, want 4 blocks, most recently 3", got)
+	}
+	// A random miss loads only its block
+	read(50*volumeCacheBlock+7, 1000)
+	if got := cached(); got[0] != 50 || slices.Contains(got, 51) {
+		t.Errorf("cached blocks after a random read = %v, want 50 without read-ahead", got)
+	}
+	// Reads spanning blocks and reaching the end of the volume
+	read(50*volumeCacheBlock-50, 100)
+	read(len(plain)-3000, 3000)
+	buf := make([]byte, 20)
+	if n, err := vol.ReadAt(buf, vol.Size()-10); n != 10 || err != io.EOF {
+		t.Errorf("ReadAt at the end = %d, %v; want 10, EOF", n, err)
+	}
+
+	// Writes are seen by later reads
+	data := bytes.Repeat([]byte("cache "), 100)
+	if _, err := vol.WriteAt(data, 50*volumeCacheBlock+10); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	copy(plain[50*volumeCacheBlock+10:], data)
+	read(50*volumeCacheBlock, 2000)
+
+	block := vol.cache.blocks[50].Value.(*cachedBlock).data
+	if err := vol.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !allZero(block) {
+		t.Error("cached block not zeroed on Close")
+	}
+
+	for _, opts := range []*VolumeOptions{{CacheSize: -1}, {CacheSize: 1, ReadAhead: -1}, {ReadAhead: volumeCacheBlock}} {
+		if _, err := OpenVolumeWithKey(device, key, opts); err == nil {
+			t.Errorf("options %+v accepted", *opts)
+		}
+	}
+}
+
+// TestVolume_IOURing tests queued ciphertext writes: unaligned, spanning
+// chunks and in whole sectors. Without io_uring the volume falls back to
+// pwrite with a warning.
+func TestVolume_IOURing(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatSectorVolume(t, passphrase, 512)
+	key, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	plain := writeTestData(t, device, key)
+
+	var warnings []Warning
+	SetWarningHandler(func(w Warning) { warnings = append(warnings, w) })
+	SetWarningInterval(0)
+	defer func() {
+		SetWarningHandler(nil)
+		SetWarningInterval(DefaultWarningInterval)
+	}()
+
+	vol, err := OpenVolumeWithKey(device, key, &VolumeOptions{Writable: true, IOEngine: IOEngineURing, QueueDepth: 2})
+	if err != nil {
+		t.Fatalf("OpenVolumeWithKey failed: %v", err)
+	}
+	if (vol.ring == nil) != (uringAvailable() != nil) {
+		t.Errorf("ring = %v with io_uring available: %v", vol.ring, uringAvailable())
+	}
+	if vol.ring == nil && (len(warnings) != 1 || warnings[0].Code != WarnIOEngine) {
+		t.Errorf("fallback warnings = %+v, want one %s", warnings, WarnIOEngine)
+	}
+
+	data := bytes.Repeat([]byte("io_uring volume "), 3*volumeReadChunk/16)
+	for _, off := range []int{300, volumeReadChunk, 0} {
+		if n, err := vol.WriteAt(data[:len(data)-off/2], int64(off)); err != nil || n != len(data)-off/2 {
+			t.Fatalf("WriteAt(%d) = %d, %v", off, n, err)
+		}
+		copy(plain[off:], data[:len(data)-off/2])
+	}
+	if err := vol.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	vol, err = OpenVolumeWithKey(device, key, nil)
+	if err != nil {
+		t.Fatalf("OpenVolumeWithKey failed: %v", err)
+	}
+	defer func() { _ = vol.Close() }()
+	buf := make([]byte, len(plain))
+	if _, err := vol.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, plain) {
+		t.Errorf("data read back differs from data written: %v", err)
+	}
+}
@@ -140,47 +140,24 @@ func AddRecoveryKey(device string, existingPassphrase []byte, opts *RecoveryKeyO
 		opts.Format = RecoveryKeyFormatDashed
 	}
 
-	// Generate recovery key
-	recoveryKey, err := GenerateRecoveryKey(opts.Length, opts.Format)
+	// Stage the keyslot in a transaction, which reports the keyslot it
+	// allocated rather than leaving it to be guessed afterwards
+	tx, err := BeginTransaction(device, existingPassphrase)
 	if err != nil {
-		return nil, err
-	}
-
-	// Add the recovery key to the volume
-	addOpts := &AddKeyOptions{
-		Keyslot:        opts.Keyslot,
-		KDFType:        opts.KDFType,
-		Argon2Time:     opts.Argon2Time,
-		Argon2Memory:   opts.Argon2Memory,
-		Argon2Parallel: opts.Argon2Parallel,
-	}
-
-	if err := AddKey(device, existingPassphrase, recoveryKey.Key, addOpts); err != nil {
-		clearBytes(recoveryKey.Key)
 		return nil, fmt.Errorf("failed to add recovery key: %w", err)
 	}
+	defer tx.Rollback()
+	tx.op = "addkey"
 
-	// Get volume info for UUID
-	info, err := GetVolumeInfo(device)
-	if err == nil {
-		recoveryKey.VolumeUUID = info.UUID
+	txOpts := *opts
+	txOpts.OutputPath = ""
+	recoveryKey, err := tx.AddRecoveryKey(&txOpts)
+	if err != nil {
+		return nil, err
 	}
-
-	// Determine which keyslot was used
-	if opts.Keyslot != nil {
-		recoveryKey.Keyslot = *opts.Keyslot
-	} else {
-		// Find the newly added keyslot
-		slots, err := ListKeyslots(device)
-		if err == nil {
-			maxSlot := 0
-			for _, s := range slots {
-				if s.ID > maxSlot {
-					maxSlot = s.ID
-				}
-			}
-			recoveryKey.Keyslot = maxSlot
-		}
+	if err := tx.Commit(); err != nil {
+		recoveryKey.Clear()
+		return nil, fmt.Errorf("failed to add recovery key: %w", err)
 	}
 
 	// Save to file if path specified
@@ -297,14 +274,18 @@ func VerifyRecoveryKey(device string, key []byte) (bool, error) {
 		return false, err
 	}
 
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return false, err
 	}
 
 	// Try to unlock with the key
-	_, err = getMasterKey(device, key, metadata)
-	return err == nil, nil
+	masterKey, err := getMasterKey(device, key, metadata)
+	if err != nil {
+		return false, nil
+	}
+	masterKey.Destroy()
+	return true, nil
 }
 
 // formatDashedKey formats a key as dash-separated hex groups
@@ -483,3 +483,27 @@ func TestRecoveryKeySaveError(t *testing.T) {
 		t.Errorf("expected SaveError to be ErrPermission, got %v", key.SaveError)
 	}
 }
+
+// TestAddRecoveryKey_ReportsKeyslot tests that the reported keyslot is the
+// one the key was added to, not the highest in use
+func TestAddRecoveryKey_ReportsKeyslot(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	addTestKeys(t, device, passphrase, 2)
+	if err := KillKeyslot(device, 1); err != nil {
+		t.Fatalf("KillKeyslot failed: %v", err)
+	}
+
+	recoveryKey, err := AddRecoveryKey(device, passphrase, &RecoveryKeyOptions{KDFType: "pbkdf2"})
+	if err != nil {
+		t.Fatalf("AddRecoveryKey failed: %v", err)
+	}
+	defer recoveryKey.Clear()
+
+	if recoveryKey.Keyslot != 1 {
+		t.Errorf("Keyslot = %d, want 1", recoveryKey.Keyslot)
+	}
+	if slot, err := TestPassphrase(device, recoveryKey.Key, nil); err != nil || slot != recoveryKey.Keyslot {
+		t.Errorf("TestPassphrase = %d, %v; want %d", slot, err, recoveryKey.Keyslot)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Byte offsets of binary header fields that differ between the two copies
+const (
+	headerOffsetField   = 0x100 // HeaderOffset (uint64, big-endian)
+	headerChecksumField = 0x1C0 // Checksum (64 bytes)
+)
+
+// HeaderCopy identifies one of the two on-disk LUKS2 header copies
+type HeaderCopy int
+
+const (
+	// HeaderCopyPrimary is the header at offset 0
+	HeaderCopyPrimary HeaderCopy = iota
+
+	// HeaderCopySecondary is the backup header following the primary
+	HeaderCopySecondary
+)
+
+// String returns "primary" or "secondary"
+func (c HeaderCopy) String() string {
+	if c == HeaderCopySecondary {
+		return "secondary"
+	}
+	return "primary"
+}
+
+// HeaderStatus reports the state of both header copies of a device
+type HeaderStatus struct {
+	Active            HeaderCopy // Copy ReadHeader uses
+	PrimaryErr        error      // Why the primary copy is invalid (nil = valid)
+	SecondaryErr      error      // Why the secondary copy is invalid (nil = valid)
+	SecondaryOffset   int64      // Offset of the secondary copy (0 = not found)
+	PrimarySequence   uint64     // Sequence ID of the primary copy (if valid)
+	SecondarySequence uint64     // Sequence ID of the secondary copy (if valid)
+
+	primaryHdr      *LUKS2BinaryHeader
+	primaryMeta     *LUKS2Metadata
+	secondaryHdr    *LUKS2BinaryHeader
+	secondaryMeta   *LUKS2Metadata
+	secondaryOffset int64 // Where the secondary copy belongs (primary header size)
+}
+
+// NeedsRepair reports whether one copy is damaged or out of date
+func (s *HeaderStatus) NeedsRepair() bool {
+	return s.PrimaryErr != nil || s.SecondaryErr != nil || s.PrimarySequence != s.SecondarySequence
+}
+
+// active returns the header and metadata ReadHeader should use. A secondary
+// header is returned in primary form (primary magic, offset 0) so callers
+// that modify and write it back produce a valid primary copy.
+func (s *HeaderStatus) active() (*LUKS2BinaryHeader, *LUKS2Metadata, error) {
+	switch {
+	case s.primaryHdr == nil && s.secondaryHdr == nil:
+		return nil, nil, s.PrimaryErr
+	case s.Active == HeaderCopyPrimary:
+		return s.primaryHdr, s.primaryMeta, nil
+	}
+
+	hdr := *s.secondaryHdr
+	copy(hdr.Magic[:], LUKS2Magic)
+	hdr.HeaderOffset = 0
+	return &hdr, s.secondaryMeta, nil
+}
+
+// secondaryHeaderOffsets are the offsets the secondary header may live at,
+// matching cryptsetup's probe list (16 KiB doubling up to 4 MiB)
+func secondaryHeaderOffsets() []int64 {
+	var offsets []int64
+	for off := int64(LUKS2HeaderMinSize); off <= LUKS2HeaderMaxOffset; off *= 2 {
+		offsets = append(offsets, off)
+	}
+	return offsets
+}
+
+// checkHeaderCopies validates both header copies and picks the active one:
+// the valid copy with the higher sequence ID, preferring the primary on a tie.
+// schema is passed on to readHeaderAt.
+func checkHeaderCopies(r io.ReaderAt, schema bool) *HeaderStatus {
+	s := &HeaderStatus{secondaryOffset: LUKS2HeaderMinSize}
+
+	s.primaryHdr, s.primaryMeta, s.PrimaryErr = readHeaderAt(r, 0, schema, LUKS2Magic)
+	if s.PrimaryErr == nil {
+		s.PrimarySequence = s.primaryHdr.SequenceID
+		// #nosec G115 - header size validated by readHeaderAt
+		s.secondaryOffset = int64(s.primaryHdr.HeaderSize)
+	}
+
+	s.SecondaryErr = errors.New("secondary header not found")
+	magic := make([]byte, LUKS2MagicLen)
+	for _, off := range secondaryHeaderOffsets() {
+		if _, err := r.ReadAt(magic, off); err != nil {
+			break
+		}
+		if !bytes.Equal(magic, []byte(LUKS2MagicBackup)) && !bytes.Equal(magic, []byte(LUKS2Magic)) {
+			continue
+		}
+
+		hdr, metadata, err := readHeaderAt(r, off, schema, LUKS2MagicBackup, LUKS2Magic)
+		if err != nil {
+			s.SecondaryErr = err
+			continue
+		}
+
+		s.secondaryHdr, s.secondaryMeta, s.SecondaryErr = hdr, metadata, nil
+		s.SecondaryOffset = off
+		s.SecondarySequence = hdr.SequenceID
+		break
+	}
+
+	if s.secondaryHdr != nil && (s.primaryHdr == nil || s.SecondarySequence > s.PrimarySequence) {
+		s.Active = HeaderCopySecondary
+	}
+
+	return s
+}
+
+// CheckHeaders validates both header copies of a device without modifying it.
+// A copy whose metadata does not conform to the on-disk format is reported
+// as invalid with a *MetadataError.
+func CheckHeaders(device string) (*HeaderStatus, error) {
+	return checkDeviceHeaders(device, true)
+}
+
+// checkDeviceHeaders opens device and runs checkHeaderCopies on it
+func checkDeviceHeaders(device string, schema bool) (*HeaderStatus, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(device) // #nosec G304 -- device path validated above
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r, done := openSectorReader(device, f)
+	defer done()
+	return checkHeaderCopies(r, schema), nil
+}
+
+// Repair rewrites a damaged or stale header copy from the good one. The good
+// copy's header area is copied byte for byte; only the magic, offset and
+// checksum are adjusted for the destination. Repair is a no-op when both
+// copies are valid and in sync, and fails with ErrInvalidHeader when neither
+// copy is usable.
+func Repair(device string) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- device path validated above
+	if err != nil {
+		return fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	status := checkHeaderCopies(&sectorReader{r: f, device: f.Name()}, true)
+	if status.primaryHdr == nil && status.secondaryHdr == nil {
+		return fmt.Errorf("%w: both header copies are damaged (primary: %v; secondary: %v)",
+			ErrInvalidHeader, status.PrimaryErr, status.SecondaryErr)
+	}
+	if !status.NeedsRepair() {
+		return nil
+	}
+
+	var src *LUKS2BinaryHeader
+	var dstOffset int64
+	var dstMagic string
+	if status.Active == HeaderCopyPrimary {
+		src, dstOffset, dstMagic = status.primaryHdr, status.secondaryOffset, LUKS2MagicBackup
+	} else {
+		src, dstOffset, dstMagic = status.secondaryHdr, 0, LUKS2Magic
+	}
+
+	area, err := copyHeaderArea(&sectorReader{r: f, device: f.Name()}, src, dstOffset, dstMagic)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt(area, dstOffset); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return f.Sync()
+}
+
+// copyHeaderArea reads the full header area of src and rebuilds it for
+// placement at dstOffset with the given magic
+func copyHeaderArea(r io.ReaderAt, src *LUKS2BinaryHeader, dstOffset int64, magic string) ([]byte, error) {
+	srcOffset, err := SafeUint64ToInt64(src.HeaderOffset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header offset: %w", err)
+	}
+
+	area := make([]byte, src.HeaderSize)
+	if _, err := r.ReadAt(area, srcOffset); err != nil {
+		return nil, fmt.Errorf("failed to read header area: %w", err)
+	}
+
+	copy(area[:LUKS2MagicLen], magic)
+	binary.BigEndian.PutUint64(area[headerOffsetField:], uint64(dstOffset)) // #nosec G115 - offset is non-negative
+
+	clear(area[headerChecksumField : headerChecksumField+64])
+	sum := sha256.Sum256(area)
+	copy(area[headerChecksumField:], sum[:])
+
+	return area, nil
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// corruptAt flips a byte of device at offset
+func corruptAt(t *testing.T, device string, offset int64) {
+	t.Helper()
+	f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xFF
+	if _, err := f.WriteAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWriteHeader_SecondaryMagic tests that the backup header uses the
+// secondary magic like cryptsetup
+func TestWriteHeader_SecondaryMagic(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data[LUKS2HeaderMinSize : LUKS2HeaderMinSize+LUKS2MagicLen]); got != LUKS2MagicBackup {
+		t.Errorf("secondary magic = %q, want %q", got, LUKS2MagicBackup)
+	}
+
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatalf("CheckHeaders failed: %v", err)
+	}
+	if status.NeedsRepair() || status.Active != HeaderCopyPrimary || status.SecondaryOffset != LUKS2HeaderMinSize {
+		t.Errorf("unexpected status for fresh volume: %+v", status)
+	}
+}
+
+// TestReadHeader_SecondaryFallback tests that a damaged primary header is
+// replaced by the secondary copy transparently
+func TestReadHeader_SecondaryFallback(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	_, want, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	// Damage the primary JSON area
+	corruptAt(t, device, LUKS2HeaderSize+2)
+	warnings := captureWarnings(t, 0)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader did not fall back to secondary: %v", err)
+	}
+	if string(hdr.Magic[:]) != LUKS2Magic || hdr.HeaderOffset != 0 {
+		t.Errorf("secondary header not returned in primary form: magic %q offset %d", hdr.Magic[:], hdr.HeaderOffset)
+	}
+	if len(metadata.Keyslots) != len(want.Keyslots) {
+		t.Errorf("metadata mismatch: %d keyslots, want %d", len(metadata.Keyslots), len(want.Keyslots))
+	}
+	if len(*warnings) != 1 || (*warnings)[0].Code != WarnHeaderRecovered {
+		t.Errorf("expected one %s warning, got %+v", WarnHeaderRecovered, *warnings)
+	}
+
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatalf("CheckHeaders failed: %v", err)
+	}
+	if status.Active != HeaderCopySecondary || status.PrimaryErr == nil || status.SecondaryErr != nil {
+		t.Errorf("unexpected status: active %s, primary %v, secondary %v", status.Active, status.PrimaryErr, status.SecondaryErr)
+	}
+
+	// The volume still works through the secondary header
+	mk, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey via secondary header failed: %v", err)
+	}
+	clearBytes(mk)
+}
+
+// TestRepair tests rewriting each damaged copy from the other
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+	}{
+		{"primary binary header", 0x10},
+		{"primary JSON", LUKS2HeaderSize + 2},
+		{"secondary binary header", LUKS2HeaderMinSize + 0x10},
+		{"secondary JSON", LUKS2HeaderMinSize + LUKS2HeaderSize + 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password")
+			device := formatTestVolume(t, passphrase)
+			corruptAt(t, device, tt.offset)
+
+			status, err := CheckHeaders(device)
+			if err != nil {
+				t.Fatalf("CheckHeaders failed: %v", err)
+			}
+			if !status.NeedsRepair() {
+				t.Fatal("expected damaged header to need repair")
+			}
+
+			if err := Repair(device); err != nil {
+				t.Fatalf("Repair failed: %v", err)
+			}
+
+			status, err = CheckHeaders(device)
+			if err != nil {
+				t.Fatalf("CheckHeaders failed: %v", err)
+			}
+			if status.NeedsRepair() {
+				t.Errorf("headers still need repair: primary %v, secondary %v", status.PrimaryErr, status.SecondaryErr)
+			}
+
+			mk, err := ExtractVolumeKey(device, passphrase)
+			if err != nil {
+				t.Fatalf("ExtractVolumeKey after repair failed: %v", err)
+			}
+			clearBytes(mk)
+		})
+	}
+}
+
+// TestRepair_Stale tests that an outdated copy is brought up to date
+func TestRepair_Stale(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	// Restore an old primary header after an update
+	data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPrimary := append([]byte(nil), data[:LUKS2HeaderMinSize]...)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.SequenceID++
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(oldPrimary, 0)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Active != HeaderCopySecondary || status.SecondarySequence != status.PrimarySequence+1 {
+		t.Fatalf("expected newer secondary to be active: %+v", status)
+	}
+
+	if err := Repair(device); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	status, err = CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NeedsRepair() || status.PrimarySequence != hdr.SequenceID {
+		t.Errorf("stale primary not updated: %+v", status)
+	}
+}
+
+// TestRepair_BothDamaged tests that Repair refuses when no copy is valid
+func TestRepair_BothDamaged(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	corruptAt(t, device, LUKS2HeaderSize+2)
+	corruptAt(t, device, LUKS2HeaderMinSize+LUKS2HeaderSize+2)
+
+	if _, _, err := ReadHeader(device); err == nil {
+		t.Error("expected ReadHeader to fail with both copies damaged")
+	}
+	if err := Repair(device); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+// errPowerCut is returned by powerCutDisk once the power is gone
+var errPowerCut = errors.New("power cut")
+
+// powerCutDisk is an in-memory disk that loses power after budget bytes
+// were written. Whether the writes since the last Sync reached the media
+// is up to the hardware, so both outcomes are kept: written has every byte
+// that was written, synced only those that were synced.
+type powerCutDisk struct {
+	written []byte
+	synced  []byte
+	budget  int
+	lie     bool // Acknowledge writes without storing them
+}
+
+func newPowerCutDisk(image []byte, budget int) *powerCutDisk {
+	return &powerCutDisk{
+		written: bytes.Clone(image),
+		synced:  bytes.Clone(image),
+		budget:  budget,
+	}
+}
+
+func (d *powerCutDisk) WriteAt(p []byte, off int64) (int, error) {
+	if d.lie {
+		return len(p), nil
+	}
+	n := min(len(p), d.budget)
+	copy(d.written[off:], p[:n])
+	d.budget -= n
+	if n < len(p) {
+		return n, errPowerCut
+	}
+	return n, nil
+}
+
+func (d *powerCutDisk) Sync() error {
+	if d.budget <= 0 {
+		return errPowerCut
+	}
+	copy(d.synced, d.written)
+	return nil
+}
+
+func (d *powerCutDisk) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(d.written).ReadAt(p, off)
+}
+
+// TestWriteHeader_PowerCut cuts the power at every point of a header
+// update, including mid-sector, and checks that the disk always holds a
+// valid header: the old one or the new one
+func TestWriteHeader_PowerCut(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, device string)
+	}{
+		{"both copies valid", func(t *testing.T, device string) {}},
+		{"primary damaged", func(t *testing.T, device string) {
+			corruptAt(t, device, LUKS2HeaderSize+2)
+		}},
+		{"primary stale", func(t *testing.T, device string) {
+			// Put back the primary from before an update
+			data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+			if err != nil {
+				t.Fatal(err)
+			}
+			hdr, metadata, err := ReadHeader(device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hdr.SequenceID++
+			if err := WriteHeader(device, hdr, metadata); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(device, os.O_RDWR, 0600) // #nosec G304 -- test temp file
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.WriteAt(data[:LUKS2HeaderMinSize], 0)
+			_ = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := formatTestVolume(t, []byte("test-password"))
+			tt.prepare(t, device)
+
+			hdr, metadata, err := readHeader(device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+			if err != nil {
+				t.Fatal(err)
+			}
+			image := data[:2*hdr.HeaderSize]
+			oldSeq := hdr.SequenceID
+			newSeq := oldSeq + 1
+
+			// Every 256 bytes of both copies, and one byte into each step
+			for budget := 0; budget <= len(image); budget += 256 {
+				for _, cut := range []int{budget, budget + 1} {
+					disk := newPowerCutDisk(image, cut)
+					h := *hdr
+					h.SequenceID = newSeq
+					werr := writeHeaderCopies(disk, disk, &h, metadata)
+
+					for name, media := range map[string][]byte{"written": disk.written, "synced": disk.synced} {
+						status := checkHeaderCopies(bytes.NewReader(media), true)
+						got, _, err := status.active()
+						if err != nil {
+							t.Fatalf("cut after %d bytes (%s): no valid header left: %v", cut, name, err)
+						}
+						if got.SequenceID != oldSeq && got.SequenceID != newSeq {
+							t.Fatalf("cut after %d bytes (%s): sequence %d, want %d or %d", cut, name, got.SequenceID, oldSeq, newSeq)
+						}
+						if werr == nil && (got.SequenceID != newSeq || status.NeedsRepair()) {
+							t.Fatalf("cut after %d bytes (%s): write succeeded but headers are %+v", cut, name, status)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestWriteHeader_VerifyFailure tests that a disk which acknowledges writes
+// without storing them is caught by the read-back
+func TestWriteHeader_VerifyFailure(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(device) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disk := newPowerCutDisk(data[:2*hdr.HeaderSize], len(data))
+	disk.lie = true
+	hdr.SequenceID++
+	if err := writeHeaderCopies(disk, disk, hdr, metadata); err == nil {
+		t.Fatal("expected the lost write to fail verification")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anatol/devmapper.go"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+	"golang.org/x/sys/unix"
+)
+
+// ResizeOptions controls how an active mapping is resized
+type ResizeOptions struct {
+	// Size is the new size of the mapping in bytes. Zero grows the mapping
+	// to fill the underlying device.
+	Size uint64
+
+	// GrowFilesystem grows the ext2/3/4 or XFS filesystem on the mapping to
+	// its new size. Mounted filesystems are grown online; XFS must be
+	// mounted.
+	GrowFilesystem bool
+}
+
+// Resize changes the size of an active mapping, equivalent to cryptsetup
+// resize. A newSize of 0 grows the mapping to fill the underlying device,
+// which is what is needed after a partition, LV or image file was enlarged.
+func Resize(name string, newSize uint64) error {
+	return ResizeWithOptions(name, &ResizeOptions{Size: newSize})
+}
+
+// ResizeWithOptions changes the size of an active mapping. Only the last
+// target of the mapping (the dynamic data segment) changes; its table is
+// rebuilt from the live mapping, so no passphrase is needed. Image files
+// attached through a loop device are picked up after the file was grown.
+//
+// Shrinking a mapping below the size of its filesystem destroys data; shrink
+// the filesystem first.
+func ResizeWithOptions(name string, opts *ResizeOptions) error {
+	if opts == nil {
+		opts = &ResizeOptions{}
+	}
+
+	info, err := devmapper.InfoByName(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrVolumeNotUnlocked, name)
+	}
+
+	var (
+		tables []devmapper.Table
+		keys   []*securemem.Buffer
+	)
+	defer func() {
+		for _, key := range keys {
+			key.Destroy()
+		}
+	}()
+
+	err = withDMTable(name, func(targets []dmTarget) error {
+		for _, target := range targets {
+			table, key, err := dmTargetTable(target)
+			if err != nil {
+				return err
+			}
+			if key != nil {
+				keys = append(keys, key)
+			}
+			tables = append(tables, table)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("%s has no device-mapper table", name)
+	}
+
+	// Only the last target can grow or shrink
+	var prefix uint64
+	for _, table := range tables[:len(tables)-1] {
+		prefix += tableLength(table)
+	}
+	last := tables[len(tables)-1]
+	backend, backendOffset, sectorSize := tableBackend(last)
+
+	backendPath := resolveDevNumber(backend)
+	if strings.HasPrefix(filepath.Base(backendPath), "loop") {
+		// Loop devices keep their old size until told the file grew
+		if err := refreshLoopCapacity(backendPath); err != nil {
+			return err
+		}
+	}
+	devSize, err := getBlockDeviceSize(backendPath)
+	if err != nil {
+		return fmt.Errorf("failed to get device size: %w", err)
+	}
+	available, err := SafeInt64ToUint64(devSize)
+	if err != nil || available < backendOffset {
+		return fmt.Errorf("%w: %s is smaller than the data offset", ErrInvalidSize, backendPath)
+	}
+
+	length, err := resizedLength(prefix, opts.Size, available-backendOffset, sectorSize)
+	if err != nil {
+		return err
+	}
+
+	if length != tableLength(last) {
+		tables[len(tables)-1] = withTableLength(last, length)
+
+		// The new table is staged and only swapped in by the resume, so a
+		// failed load leaves the mapping untouched
+		if err := devmapper.Load(name, info.Flags&unix.DM_READONLY_FLAG, tables...); err != nil {
+			return fmt.Errorf("failed to load resized table: %w", err)
+		}
+		if err := devmapper.Suspend(name); err != nil {
+			return fmt.Errorf("failed to suspend %s: %w", name, err)
+		}
+		if err := devmapper.Resume(name); err != nil {
+			return fmt.Errorf("failed to resume %s: %w", name, err)
+		}
+	}
+
+	if opts.GrowFilesystem {
+		return growFilesystem(name)
+	}
+
+	return nil
+}
+
+// resizedLength returns the length of the last target so the mapping spans
+// size bytes, or as much of the available space as fits when size is 0.
+// prefix is the combined length of the targets before it.
+func resizedLength(prefix, size, available, sectorSize uint64) (uint64, error) {
+	available -= available % sectorSize
+	if size == 0 {
+		if available == 0 {
+			return 0, fmt.Errorf("%w: no space left for the data segment", ErrInvalidSize)
+		}
+		return available, nil
+	}
+
+	if size%sectorSize != 0 {
+		return 0, fmt.Errorf("%w: %d is not a multiple of the %d-byte sector size", ErrInvalidSize, size, sectorSize)
+	}
+	if size <= prefix {
+		return 0, fmt.Errorf("%w: %d does not exceed the %d bytes of fixed-size segments", ErrInvalidSize, size, prefix)
+	}
+	if size-prefix > available {
+		return 0, fmt.Errorf("%w: %d exceeds the %d bytes the device can hold", ErrInvalidSize, size, prefix+available)
+	}
+
+	return size - prefix, nil
+}
+
+// dmTargetTable rebuilds a devmapper table from a live crypt or linear
+// target. A crypt key held in the table is copied into locked memory, which
+// the caller must destroy after the table has been loaded.
+func dmTargetTable(target dmTarget) (devmapper.Table, *securemem.Buffer, error) {
+	// devmapper tables take offsets and lengths in bytes
+	start := target.start * devmapper.SectorSize
+	length := target.length * devmapper.SectorSize
+	fields := bytes.Fields(target.params)
+
+	switch target.targetType {
+	case SegmentTypeLinear:
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("malformed linear table")
+		}
+		offset, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed linear offset: %w", err)
+		}
+		return devmapper.LinearTable{
+			Start:         start,
+			Length:        length,
+			BackendDevice: string(fields[0]),
+			BackendOffset: offset * devmapper.SectorSize,
+		}, nil, nil
+
+	case SegmentTypeCrypt:
+		// Reuse the status parser for everything except the key
+		var status VolumeStatus
+		if err := parseCryptParams(target.params, &status); err != nil {
+			return nil, nil, err
+		}
+		table := devmapper.CryptTable{
+			Start:         start,
+			Length:        length,
+			BackendDevice: string(fields[3]),
+			BackendOffset: status.Offset * devmapper.SectorSize,
+			Encryption:    status.Cipher,
+			IVTweak:       status.IVOffset,
+			Flags:         status.Flags,
+			SectorSize:    uint64(status.SectorSize), // #nosec G115 - parsed from a live table
+		}
+
+		if status.KeyLocation == "keyring" {
+			table.KeyID = string(fields[1])
+			return table, nil, nil
+		}
+
+		key, err := securemem.New(hex.DecodedLen(len(fields[1])))
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := hex.Decode(key.Bytes(), fields[1]); err != nil {
+			key.Destroy()
+			return nil, nil, fmt.Errorf("malformed dm-crypt key")
+		}
+		table.Key = key.Bytes()
+		return table, key, nil
+	}
+
+	return nil, nil, fmt.Errorf("cannot resize %s target", target.targetType)
+}
+
+// tableLength returns the length of a table built by dmTargetTable
+func tableLength(table devmapper.Table) uint64 {
+	switch t := table.(type) {
+	case devmapper.CryptTable:
+		return t.Length
+	case devmapper.LinearTable:
+		return t.Length
+	}
+	return 0
+}
+
+// withTableLength returns a copy of a table built by dmTargetTable with a
+// new length
+func withTableLength(table devmapper.Table, length uint64) devmapper.Table {
+	switch t := table.(type) {
+	case devmapper.CryptTable:
+		t.Length = length
+		return t
+	case devmapper.LinearTable:
+		t.Length = length
+		return t
+	}
+	return table
+}
+
+// tableBackend returns the backing device, its offset and the unit a table
+// maps in
+func tableBackend(table devmapper.Table) (string, uint64, uint64) {
+	switch t := table.(type) {
+	case devmapper.CryptTable:
+		return t.BackendDevice, t.BackendOffset, max(t.SectorSize, devmapper.SectorSize)
+	case devmapper.LinearTable:
+		return t.BackendDevice, t.BackendOffset, devmapper.SectorSize
+	}
+	return "", 0, devmapper.SectorSize
+}
+
+// growFilesystem grows the filesystem on a mapping to fill it. ext* grows
+// online when mounted and after a forced check otherwise; XFS only grows
+// while mounted.
+func growFilesystem(name string) error {
+	devicePath, err := GetMappedDevicePath(name)
+	if err != nil {
+		return err
+	}
+
+	fstype, err := DetectFilesystem(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to detect filesystem on %s: %w", devicePath, err)
+	}
+
+	mountPoint, err := mountPointOf(devicePath)
+	if err != nil {
+		return err
+	}
+
+	switch fstype {
+	case FilesystemExt2, FilesystemExt3, FilesystemExt4:
+		if mountPoint == "" {
+			// e2fsck exits with 1 when it corrected errors, which is fine here
+			var exitErr *exec.ExitError
+			if err := runResizeCommand("e2fsck", "-f", "-p", devicePath); err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() != 1) {
+				return err
+			}
+		}
+		return runResizeCommand("resize2fs", devicePath)
+	case FilesystemXFS:
+		if mountPoint == "" {
+			return fmt.Errorf("%w: XFS can only be grown while mounted", ErrNotMounted)
+		}
+		return runResizeCommand("xfs_growfs", mountPoint)
+	}
+
+	return fmt.Errorf("growing %s filesystems is not supported", fstype)
+}
+
+// mountPointOf returns where a device is mounted, or "" if it is not
+func mountPointOf(devicePath string) (string, error) {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return "", fmt.Errorf("failed to open /proc/mounts: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return findMountPoint(file, devicePath)
+}
+
+// findMountPoint scans a mounts table for the first mount of devicePath.
+// Sources are compared after resolving symlinks, since the mapping may be
+// listed as /dev/mapper/<name> or /dev/dm-N.
+func findMountPoint(r io.Reader, devicePath string) (string, error) {
+	want, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		want = devicePath
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		source, err := filepath.EvalSymlinks(fields[0])
+		if err != nil {
+			source = fields[0]
+		}
+		if source == want {
+			return fields[1], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading /proc/mounts: %w", err)
+	}
+
+	return "", nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anatol/devmapper.go"
+)
+
+// TestResizedLength tests the new length of the last target
+func TestResizedLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     uint64
+		size       uint64
+		available  uint64
+		sectorSize uint64
+		want       uint64
+		wantErr    bool
+	}{
+		{"fill device", 0, 0, 64 * mib, 512, 64 * mib, false},
+		{"fill rounds down to sector", 0, 0, 64*mib + 1024, 4096, 64 * mib, false},
+		{"fill after fixed segments", 2 * mib, 0, 60 * mib, 512, 60 * mib, false},
+		{"explicit grow", 0, 32 * mib, 64 * mib, 512, 32 * mib, false},
+		{"explicit after fixed segments", 2 * mib, 32 * mib, 64 * mib, 512, 30 * mib, false},
+		{"exactly the device", 0, 64 * mib, 64 * mib, 512, 64 * mib, false},
+		{"beyond device", 0, 65 * mib, 64 * mib, 512, 0, true},
+		{"unaligned", 0, 32*mib + 512, 64 * mib, 4096, 0, true},
+		{"within fixed segments", 2 * mib, mib, 64 * mib, 512, 0, true},
+		{"no space", 0, 0, 256, 512, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resizedLength(tt.prefix, tt.size, tt.available, tt.sectorSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resizedLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSize) {
+				t.Errorf("expected ErrInvalidSize, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resizedLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDMTargetTable tests rebuilding tables from live targets
+func TestDMTargetTable(t *testing.T) {
+	t.Run("crypt with hex key", func(t *testing.T) {
+		key := strings.Repeat("ab", 64)
+		target := dmTarget{
+			start:      4096,
+			length:     8192,
+			targetType: "crypt",
+			params:     []byte("aes-xts-plain64 " + key + " 16 7:3 32768 2 allow_discards sector_size:4096"),
+		}
+		table, buf, err := dmTargetTable(target)
+		if err != nil {
+			t.Fatalf("dmTargetTable failed: %v", err)
+		}
+		defer buf.Destroy()
+
+		crypt, ok := table.(devmapper.CryptTable)
+		if !ok {
+			t.Fatalf("expected CryptTable, got %T", table)
+		}
+		if crypt.Start != 4096*512 || crypt.Length != 8192*512 || crypt.BackendOffset != 32768*512 {
+			t.Errorf("unexpected geometry %+v", crypt)
+		}
+		if crypt.BackendDevice != "7:3" || crypt.IVTweak != 16 || crypt.SectorSize != 4096 {
+			t.Errorf("unexpected table %+v", crypt)
+		}
+		if !slices.Equal(crypt.Flags, []string{"allow_discards"}) {
+			t.Errorf("flags = %v", crypt.Flags)
+		}
+		if !bytes.Equal(crypt.Key, bytes.Repeat([]byte{0xab}, 64)) || crypt.KeyID != "" {
+			t.Error("key was not decoded")
+		}
+		if length := tableLength(withTableLength(table, mib)); length != mib {
+			t.Errorf("tableLength after resize = %d", length)
+		}
+		if dev, offset, unit := tableBackend(table); dev != "7:3" || offset != 32768*512 || unit != 4096 {
+			t.Errorf("tableBackend() = %s, %d, %d", dev, offset, unit)
+		}
+	})
+
+	t.Run("crypt with keyring key", func(t *testing.T) {
+		target := dmTarget{
+			length:     8192,
+			targetType: "crypt",
+			params:     []byte("aes-xts-plain64 :64:logon:cryptsetup:1234 0 8:17 4096"),
+		}
+		table, buf, err := dmTargetTable(target)
+		if err != nil {
+			t.Fatalf("dmTargetTable failed: %v", err)
+		}
+		if buf != nil {
+			t.Error("keyring tables hold no key material")
+		}
+		crypt := table.(devmapper.CryptTable)
+		if crypt.KeyID != ":64:logon:cryptsetup:1234" || crypt.Key != nil {
+			t.Errorf("unexpected key fields %q %x", crypt.KeyID, crypt.Key)
+		}
+	})
+
+	t.Run("linear", func(t *testing.T) {
+		table, buf, err := dmTargetTable(dmTarget{length: 2048, targetType: "linear", params: []byte("7:3 34816")})
+		if err != nil || buf != nil {
+			t.Fatalf("dmTargetTable() = %v, %v", buf, err)
+		}
+		linear := table.(devmapper.LinearTable)
+		if linear.Length != 2048*512 || linear.BackendDevice != "7:3" || linear.BackendOffset != 34816*512 {
+			t.Errorf("unexpected table %+v", linear)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, target := range []dmTarget{
+			{targetType: "verity", params: []byte("1 7:3 7:4 4096 4096 1 0 sha256")},
+			{targetType: "linear", params: []byte("7:3")},
+			{targetType: "crypt", params: []byte("aes-xts-plain64 zz 0 7:3 0")},
+		} {
+			if _, _, err := dmTargetTable(target); err == nil {
+				t.Errorf("expected error for %s %q", target.targetType, target.params)
+			}
+		}
+	})
+}
+
+// TestFindMountPoint tests matching mount sources through symlinks
+func TestFindMountPoint(t *testing.T) {
+	dir := t.TempDir()
+	dm := filepath.Join(dir, "dm-3")
+	if err := os.WriteFile(dm, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mapper := filepath.Join(dir, "data")
+	if err := os.Symlink(dm, mapper); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := "/dev/sda1 / ext4 rw 0 0\n" + dm + " /mnt/data ext4 rw 0 0\n"
+
+	got, err := findMountPoint(strings.NewReader(mounts), mapper)
+	if err != nil {
+		t.Fatalf("findMountPoint failed: %v", err)
+	}
+	if got != "/mnt/data" {
+		t.Errorf("findMountPoint() = %q, want /mnt/data", got)
+	}
+
+	got, err = findMountPoint(strings.NewReader(mounts), filepath.Join(dir, "other"))
+	if err != nil || got != "" {
+		t.Errorf("findMountPoint() = %q, %v; want not mounted", got, err)
+	}
+}
+
+// TestResize_NotActive tests resizing a mapping that does not exist
+func TestResize_NotActive(t *testing.T) {
+	if err := Resize("luks2-test-does-not-exist", 0); !errors.Is(err, ErrVolumeNotUnlocked) {
+		t.Errorf("expected ErrVolumeNotUnlocked, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Defaults for RetryOptions
+const (
+	DefaultUnlockAttempts  = 3
+	DefaultRetryBaseDelay  = time.Second
+	DefaultRetryMaxDelay   = 30 * time.Second
+	DefaultLockoutDuration = 15 * time.Minute
+)
+
+// PassphraseFunc supplies the passphrase for an unlock attempt (1-based).
+// The returned slice is cleared after the attempt.
+type PassphraseFunc func(attempt int) ([]byte, error)
+
+// RetryOptions controls UnlockWithRetry
+type RetryOptions struct {
+	// MaxAttempts is the number of passphrases tried per call (default: 3)
+	MaxAttempts int
+
+	// BaseDelay is the delay after the first failure; it doubles with each
+	// consecutive failure (default: 1s)
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff delay (default: 30s)
+	MaxDelay time.Duration
+
+	// StateFile, if set, persists failed-attempt counters per volume UUID so
+	// backoff and lockout survive restarts and reboots. It is created with
+	// mode 0600 and must live on persistent, root-owned storage.
+	StateFile string
+
+	// LockoutThreshold refuses further attempts after this many consecutive
+	// failures until LockoutDuration has passed since the last one. Requires
+	// StateFile; 0 disables lockout.
+	LockoutThreshold int
+
+	// LockoutDuration is how long a lockout lasts (default: 15m)
+	LockoutDuration time.Duration
+
+	// Unlock are the options for each unlock attempt (nil = defaults)
+	Unlock *UnlockOptions
+}
+
+// retrySleep is replaced in tests
+var retrySleep = time.Sleep
+
+// retryRecord is the persisted failure state of one volume
+type retryRecord struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// UnlockWithRetry unlocks a volume, asking prompt for another passphrase
+// after each wrong one up to opts.MaxAttempts times. Consecutive failures are
+// delayed with exponential backoff. With opts.StateFile the failure count is
+// kept across calls, and opts.LockoutThreshold locks the volume out for
+// opts.LockoutDuration, to resist online guessing on unattended devices.
+//
+// Errors other than a wrong passphrase are returned immediately. When all
+// attempts fail the error wraps ErrInvalidPassphrase; a lockout returns a
+// *LockoutError.
+func UnlockWithRetry(device, name string, prompt PassphraseFunc, opts *RetryOptions) error {
+	o := RetryOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultUnlockAttempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultRetryBaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultRetryMaxDelay
+	}
+	if o.LockoutDuration <= 0 {
+		o.LockoutDuration = DefaultLockoutDuration
+	}
+	if o.LockoutThreshold > 0 && o.StateFile == "" {
+		return fmt.Errorf("lockout requires a state file")
+	}
+
+	// Counters are keyed by UUID so renaming the device node does not reset them
+	var uuid string
+	var record retryRecord
+	if o.StateFile != "" {
+		hdr, _, err := readHeader(device)
+		if err != nil {
+			return err
+		}
+		uuid = string(bytes.TrimRight(hdr.UUID[:], "\x00"))
+		if record, err = loadRetryRecord(o.StateFile, uuid); err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= o.MaxAttempts; attempt++ {
+		if record.Failures > 0 {
+			if o.LockoutThreshold > 0 && record.Failures >= o.LockoutThreshold {
+				until := record.LastFailure.Add(o.LockoutDuration)
+				if time.Now().Before(until) {
+					return &LockoutError{Device: device, Failures: record.Failures, Until: until}
+				}
+			}
+			if wait := time.Until(record.LastFailure.Add(backoffDelay(record.Failures, o.BaseDelay, o.MaxDelay))); wait > 0 {
+				retrySleep(wait)
+			}
+		}
+
+		passphrase, err := prompt(attempt)
+		if err != nil {
+			return err
+		}
+		lastErr = UnlockWithOptions(device, passphrase, name, o.Unlock)
+		clearBytes(passphrase)
+
+		if lastErr == nil {
+			if o.StateFile != "" && record.Failures > 0 {
+				return updateRetryRecord(o.StateFile, uuid, func(r *retryRecord) { *r = retryRecord{} })
+			}
+			return nil
+		}
+		if !errors.Is(lastErr, ErrInvalidPassphrase) {
+			return lastErr
+		}
+
+		record.Failures++
+		record.LastFailure = time.Now()
+		if o.StateFile != "" {
+			// Re-read under the lock so concurrent unlockers count every failure
+			err := updateRetryRecord(o.StateFile, uuid, func(r *retryRecord) {
+				r.Failures++
+				r.LastFailure = record.LastFailure
+				record = *r
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return fmt.Errorf("%d failed attempts: %w", o.MaxAttempts, lastErr)
+}
+
+// backoffDelay returns base * 2^(failures-1), capped at maxDelay
+func backoffDelay(failures int, base, maxDelay time.Duration) time.Duration {
+	d := base
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if d >= maxDelay {
+			return maxDelay
+		}
+	}
+	return min(d, maxDelay)
+}
+
+// ResetUnlockFailures clears the failed-attempt counter for device in a
+// retry state file, e.g. after an administrator has verified the user
+func ResetUnlockFailures(stateFile, device string) error {
+	hdr, _, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+	return updateRetryRecord(stateFile, string(bytes.TrimRight(hdr.UUID[:], "\x00")), func(r *retryRecord) { *r = retryRecord{} })
+}
+
+// loadRetryRecord reads the record for uuid from the state file
+func loadRetryRecord(path, uuid string) (retryRecord, error) {
+	var record retryRecord
+	err := updateRetryRecord(path, uuid, func(r *retryRecord) { record = *r })
+	return record, err
+}
+
+// updateRetryRecord applies fn to the record for uuid while holding an
+// exclusive lock on the state file, then writes the file back. Records
+// reset to zero are removed.
+func updateRetryRecord(path, uuid string, fn func(*retryRecord)) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- state file path chosen by the caller
+	if err != nil {
+		return fmt.Errorf("failed to open retry state: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock retry state: %w", err)
+	}
+	defer func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read retry state: %w", err)
+	}
+	records := make(map[string]retryRecord)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return fmt.Errorf("corrupt retry state %s: %w", path, err)
+		}
+	}
+
+	before := records[uuid]
+	record := before
+	fn(&record)
+	if record == before {
+		return nil
+	}
+	if record == (retryRecord{}) {
+		delete(records, uuid)
+	} else {
+		records[uuid] = record
+	}
+
+	if data, err = json.MarshalIndent(records, "", "  "); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write retry state: %w", err)
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write retry state: %w", err)
+	}
+	return f.Sync()
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSleeps replaces the backoff sleep for the duration of a test
+func recordSleeps(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var sleeps []time.Duration
+	retrySleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { retrySleep = time.Sleep })
+	return &sleeps
+}
+
+// scriptedPrompt returns the given passphrases in order and records each
+// returned slice so tests can check they were cleared
+type scriptedPrompt struct {
+	passphrases []string
+	given       [][]byte
+}
+
+func (p *scriptedPrompt) next(attempt int) ([]byte, error) {
+	if attempt > len(p.passphrases) {
+		return nil, errors.New("no more passphrases")
+	}
+	b := []byte(p.passphrases[attempt-1])
+	p.given = append(p.given, b)
+	return b, nil
+}
+
+// TestBackoffDelay tests exponential growth and the cap
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.failures, time.Second, 30*time.Second); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// TestUnlockWithRetry_ExhaustsAttempts tests re-prompting and backoff after wrong passphrases
+func TestUnlockWithRetry_ExhaustsAttempts(t *testing.T) {
+	device := formatTestVolume(t, []byte("correct horse battery staple"))
+	sleeps := recordSleeps(t)
+	prompt := &scriptedPrompt{passphrases: []string{"wrong-one-1", "wrong-one-2", "wrong-one-3"}}
+
+	err := UnlockWithRetry(device, "retry-test", prompt.next, &RetryOptions{MaxAttempts: 3})
+	if !errors.Is(err, ErrInvalidPassphrase) || !strings.Contains(err.Error(), "3 failed attempts") {
+		t.Fatalf("Expected ErrInvalidPassphrase after 3 attempts, got %v", err)
+	}
+
+	if len(prompt.given) != 3 {
+		t.Errorf("Expected 3 prompts, got %d", len(prompt.given))
+	}
+	for i, p := range prompt.given {
+		for _, b := range p {
+			if b != 0 {
+				t.Errorf("Passphrase %d was not cleared", i+1)
+				break
+			}
+		}
+	}
+
+	if len(*sleeps) != 2 {
+		t.Fatalf("Expected 2 backoff sleeps, got %v", *sleeps)
+	}
+	if (*sleeps)[0] > time.Second || (*sleeps)[1] > 2*time.Second || (*sleeps)[1] <= (*sleeps)[0] {
+		t.Errorf("Unexpected backoff: %v", *sleeps)
+	}
+}
+
+// TestUnlockWithRetry_OtherErrors tests that non-passphrase errors end the retries
+func TestUnlockWithRetry_OtherErrors(t *testing.T) {
+	recordSleeps(t)
+
+	prompt := &scriptedPrompt{passphrases: []string{"some-passphrase", "other-passphrase"}}
+	err := UnlockWithRetry("/nonexistent/device", "retry-test", prompt.next, nil)
+	if !errors.Is(err, ErrDeviceNotFound) || len(prompt.given) != 1 {
+		t.Errorf("Expected ErrDeviceNotFound after 1 prompt, got %v after %d", err, len(prompt.given))
+	}
+
+	promptErr := errors.New("cancelled")
+	err = UnlockWithRetry("/nonexistent/device", "retry-test", func(int) ([]byte, error) { return nil, promptErr }, nil)
+	if !errors.Is(err, promptErr) {
+		t.Errorf("Expected prompt error, got %v", err)
+	}
+
+	if err := UnlockWithRetry("/nonexistent/device", "retry-test", prompt.next, &RetryOptions{LockoutThreshold: 3}); err == nil {
+		t.Error("Expected error for lockout without a state file")
+	}
+}
+
+// TestUnlockWithRetry_Lockout tests persistent counters and lockout across calls
+func TestUnlockWithRetry_Lockout(t *testing.T) {
+	device := formatTestVolume(t, []byte("correct horse battery staple"))
+	sleeps := recordSleeps(t)
+	state := filepath.Join(t.TempDir(), "unlock-state.json")
+	opts := &RetryOptions{MaxAttempts: 5, StateFile: state, LockoutThreshold: 2, LockoutDuration: time.Hour}
+
+	prompt := &scriptedPrompt{passphrases: []string{"wrong-one-1", "wrong-one-2", "wrong-one-3"}}
+	err := UnlockWithRetry(device, "retry-test", prompt.next, opts)
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) || !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("Expected LockoutError, got %v", err)
+	}
+	if len(prompt.given) != 2 || lockout.Failures != 2 || time.Until(lockout.Until) < 59*time.Minute {
+		t.Errorf("Unexpected lockout after %d prompts: %+v", len(prompt.given), lockout)
+	}
+
+	info, err := os.Stat(state)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("State file missing or wrong mode: %v %v", info, err)
+	}
+
+	// A new call is refused without prompting
+	prompt = &scriptedPrompt{passphrases: []string{"correct horse battery staple"}}
+	if err := UnlockWithRetry(device, "retry-test", prompt.next, opts); !errors.Is(err, ErrLockedOut) || len(prompt.given) != 0 {
+		t.Errorf("Expected immediate lockout, got %v after %d prompts", err, len(prompt.given))
+	}
+
+	// Resetting clears the counter, so the next call prompts without delay
+	if err := ResetUnlockFailures(state, device); err != nil {
+		t.Fatalf("ResetUnlockFailures failed: %v", err)
+	}
+	*sleeps = nil
+	prompt = &scriptedPrompt{passphrases: []string{"wrong-one-4"}}
+	opts.MaxAttempts = 1
+	if err := UnlockWithRetry(device, "retry-test", prompt.next, opts); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase after reset, got %v", err)
+	}
+	if len(prompt.given) != 1 || len(*sleeps) != 0 {
+		t.Errorf("Expected one undelayed prompt, got %d prompts and sleeps %v", len(prompt.given), *sleeps)
+	}
+
+	record, err := loadRetryRecord(state, mustVolumeUUID(t, device))
+	if err != nil || record.Failures != 1 {
+		t.Errorf("Expected 1 recorded failure, got %+v, %v", record, err)
+	}
+}
+
+// TestUpdateRetryRecord_Corrupt tests that a damaged state file is reported
+func TestUpdateRetryRecord_Corrupt(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "unlock-state.json")
+	if err := os.WriteFile(state, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRetryRecord(state, "uuid"); err == nil {
+		t.Error("Expected error for corrupt state file")
+	}
+}
+
+// mustVolumeUUID returns the header UUID of device
+func mustVolumeUUID(t *testing.T, device string) string {
+	t.Helper()
+	info, err := GetVolumeInfo(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.UUID
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RewrapOptions controls RewrapKeyslots
+type RewrapOptions struct {
+	// Passphrases opens keyslots, by number, that the passphrase passed to
+	// RewrapKeyslots does not
+	Passphrases map[int][]byte
+
+	// KDF sets the KDF, AF stripes and priority of the re-enrolled
+	// keyslots; nil or zero fields keep each keyslot's own
+	KDF *AddKeyOptions
+}
+
+// RewrapKeyslots re-enrolls every LUKS2 keyslot of device in a single
+// Transaction: its passphrase protects the same volume key again with a new
+// salt, KDF and area, and the old areas are wiped once the new header is
+// written. It is enough when keyslot material (e.g. a header backup) leaked
+// but the volume key did not; RotateVolumeKey replaces the volume key and
+// reencrypts the data. Each keyslot
+// must be opened by passphrase or by its entry in opts.Passphrases (nil
+// opts = passphrase only, same KDFs); otherwise nothing changes and the
+// error, wrapping ErrInvalidPassphrase, lists the keyslots that could not
+// be opened.
+func RewrapKeyslots(device string, passphrase []byte, opts *RewrapOptions) error {
+	if opts == nil {
+		opts = &RewrapOptions{}
+	}
+
+	tx, err := BeginTransaction(device, passphrase)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tx.op = "rewrap"
+
+	var locked []string
+	for _, id := range sortedIDs(tx.metadata.Keyslots) {
+		keyslot, err := strconv.Atoi(id)
+		if err != nil || tx.metadata.Keyslots[id].Type != "luks2" {
+			continue
+		}
+		pass := passphrase
+		if p, ok := opts.Passphrases[keyslot]; ok {
+			pass = p
+		}
+		if err := tx.RewrapKeyslot(keyslot, pass, opts.KDF); err != nil {
+			if errors.Is(err, ErrInvalidPassphrase) {
+				locked = append(locked, id)
+				continue
+			}
+			return err
+		}
+	}
+	if len(locked) > 0 {
+		return fmt.Errorf("%w: no passphrase for keyslot(s) %s; pass them in RewrapOptions.Passphrases or remove the keyslots first",
+			ErrInvalidPassphrase, strings.Join(locked, ", "))
+	}
+	return tx.Commit()
+}
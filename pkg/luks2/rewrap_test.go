@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRewrapKeyslots(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	extra := addTestKeys(t, device, admin, 1)
+	if err := SetKeyslotAnnotation(device, 1, KeyslotAnnotation{Label: "backup"}); err != nil {
+		t.Fatalf("SetKeyslotAnnotation failed: %v", err)
+	}
+	volumeKey, err := ExtractVolumeKey(device, admin)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	_, before, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	sink := captureEvents(t)
+
+	err = RewrapKeyslots(device, admin, &RewrapOptions{
+		Passphrases: map[int][]byte{1: extra[0]},
+		KDF:         testAddKeyOptions,
+	})
+	if err != nil {
+		t.Fatalf("RewrapKeyslots failed: %v", err)
+	}
+
+	_, after, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	for _, id := range []string{"0", "1"} {
+		old, ks := before.Keyslots[id], after.Keyslots[id]
+		if ks.KDF.Salt == old.KDF.Salt || ks.Area.Offset == old.Area.Offset {
+			t.Errorf("keyslot %s not rewrapped: salt and area offset unchanged", id)
+		}
+		if keyslotPriority(ks) != keyslotPriority(old) {
+			t.Errorf("keyslot %s priority changed", id)
+		}
+
+		// The old area is wiped
+		offset, _ := parseSize(old.Area.Offset)
+		area := make([]byte, 4096)
+		f, err := os.Open(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.ReadAt(area, offset)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(area, make([]byte, len(area))) {
+			t.Errorf("old area of keyslot %s not wiped", id)
+		}
+	}
+
+	for i, pass := range [][]byte{admin, extra[0]} {
+		if slot, err := TestPassphrase(device, pass, nil); err != nil || slot != i {
+			t.Errorf("passphrase %d opens keyslot %d (%v), want %d", i, slot, err, i)
+		}
+	}
+	if key, err := ExtractVolumeKey(device, extra[0]); err != nil || !bytes.Equal(key, volumeKey) {
+		t.Errorf("volume key changed by a rewrap (%v)", err)
+	}
+	if ann := keyslotAnnotation(t, device, 1); ann == nil || ann.Label != "backup" {
+		t.Errorf("annotation of keyslot 1 lost: %+v", ann)
+	}
+	if types := sink.types(); len(types) != 2 || types[0] != EventKeyslotRewrapped || types[1] != EventKeyslotRewrapped {
+		t.Errorf("events = %v, want two %s", types, EventKeyslotRewrapped)
+	}
+}
+
+func TestRewrapKeyslots_Errors(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	addTestKeys(t, device, admin, 1)
+	hdr, _, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	// Keyslot 1 has another passphrase, so nothing is rewrapped
+	for _, opts := range []*RewrapOptions{nil, {KDF: testAddKeyOptions}} {
+		if err := RewrapKeyslots(device, admin, opts); !errors.Is(err, ErrInvalidPassphrase) {
+			t.Errorf("expected ErrInvalidPassphrase, got %v", err)
+		}
+	}
+	if after, _, err := ReadHeader(device); err != nil || after.SequenceID != hdr.SequenceID {
+		t.Errorf("header changed by a failed rewrap (%v)", err)
+	}
+
+	tx, err := BeginTransaction(device, admin)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	defer tx.Rollback()
+	if err := tx.RewrapKeyslot(1, admin, testAddKeyOptions); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("expected rewrapping with another keyslot's passphrase to fail, got %v", err)
+	}
+	if err := tx.RewrapKeyslot(0, admin, testAddKeyOptions); err != nil {
+		t.Fatalf("RewrapKeyslot failed: %v", err)
+	}
+	if err := tx.RewrapKeyslot(0, admin, testAddKeyOptions); err == nil {
+		t.Error("expected rewrapping a keyslot twice to fail")
+	}
+	if err := tx.KillKeyslot(0); err == nil {
+		t.Error("expected killing a rewrapped keyslot to fail")
+	}
+}
@@ -0,0 +1,666 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// TokenTypeRotation is the type of the token that records the progress of
+// RotateVolumeKey while it reencrypts the data
+const TokenTypeRotation = "go-luks2-rotation"
+
+// rotationRequirement is the mandatory requirement set while the data is
+// reencrypted, so that cryptsetup refuses to open the volume meanwhile
+const rotationRequirement = "go-luks2-rotation"
+
+// DefaultRotateChunkSize is how much data RotateVolumeKey reencrypts per
+// journaled step
+const DefaultRotateChunkSize = 1024 * 1024 // 1MB
+
+// rotateMinChunkSize is the smallest chunk, a whole number of sectors of
+// every sector size
+const rotateMinChunkSize = 4096
+
+// RotateOptions controls RotateVolumeKey
+type RotateOptions struct {
+	// Passphrases opens keyslots, by number, that the passphrase passed to
+	// RotateVolumeKey does not
+	Passphrases map[int][]byte
+
+	// KDF sets the KDF, AF stripes and priority of the re-enrolled
+	// keyslots; nil or zero fields keep each keyslot's own
+	KDF *AddKeyOptions
+
+	// ChunkSize is how many bytes are reencrypted per step, a multiple of
+	// 4096 (0 = DefaultRotateChunkSize). Each chunk is first copied to a
+	// journal in the keyslots area; a smaller size is used when the free
+	// space there is smaller. A resumed rotation keeps its chunk size.
+	ChunkSize int64
+}
+
+// RotateVolumeKey replaces the volume key of device with a fresh random
+// key. The data segments are reencrypted in place, and every LUKS2 keyslot
+// is then re-enrolled for the new key with a new salt, KDF and area in a
+// single header write that also drops the old key's digest, so the old key
+// opens nothing afterwards. When only keyslot material leaked, RewrapKeyslots
+// is enough and leaves the data alone.
+//
+// Each keyslot must be opened by passphrase or by its entry in
+// opts.Passphrases (nil opts = passphrase only, same KDFs); otherwise
+// nothing changes and the error, wrapping ErrInvalidPassphrase, lists the
+// keyslots that could not be opened. Only aes-xts-plain64 segments can be
+// reencrypted, a token escrowing the old volume key must be removed first,
+// and the volume must not be unlocked while this runs.
+//
+// Before any data is touched, a keyslot holding the new key under
+// passphrase, a TokenTypeRotation token recording the progress and a
+// mandatory requirement are committed to the header. Every chunk is copied
+// to a journal in the keyslots area before it is rewritten, so an
+// interruption at any point loses nothing: calling RotateVolumeKey again
+// with the same passphrase resumes where it stopped. Until then the volume
+// cannot be unlocked, and functions that need its volume key return
+// ErrRotationInProgress.
+func RotateVolumeKey(device string, passphrase []byte, opts *RotateOptions) error {
+	if opts == nil {
+		opts = &RotateOptions{}
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return err
+	}
+	if opts.ChunkSize < 0 || opts.ChunkSize%rotateMinChunkSize != 0 {
+		return fmt.Errorf("invalid chunk size %d (must be a multiple of %d)", opts.ChunkSize, rotateMinChunkSize)
+	}
+	if err := validateRewrapOptions(opts.KDF); err != nil {
+		return err
+	}
+
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	r, err := openRotation(device, passphrase, opts)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	if err := r.reencrypt(); err != nil {
+		return fmt.Errorf("reencryption interrupted at offset %d (call RotateVolumeKey again to resume): %w", r.offset, err)
+	}
+	return r.finish(opts.KDF)
+}
+
+// rotation is a volume key rotation in progress. The device lock is held
+// by RotateVolumeKey.
+type rotation struct {
+	device      string
+	f           *os.File
+	hdr         *LUKS2BinaryHeader
+	metadata    *LUKS2Metadata
+	tokenID     int
+	token       *Token
+	keyslot     string // Keyslot holding the new key until the rotation finishes
+	oldDigest   string
+	newDigest   string
+	oldKey      *securemem.Buffer
+	newKey      *securemem.Buffer
+	passphrases map[string][]byte // Passphrase opening each keyslot to re-enroll
+
+	// Crypt segments under the old and the new key
+	from, to []volumeExtent
+
+	offset      int64 // Bytes of the volume reencrypted
+	hot         int64 // Bytes past offset journaled and possibly rewritten
+	hash        string
+	journal     int64
+	journalSize int64
+}
+
+// openRotation starts a rotation of device, or picks up the one recorded
+// in its header, and opens the device for reencryption
+func openRotation(device string, passphrase []byte, opts *RotateOptions) (*rotation, error) {
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	r := &rotation{device: device, hdr: hdr, metadata: metadata}
+	ok := false
+	defer func() {
+		if !ok {
+			r.close()
+		}
+	}()
+
+	r.tokenID, r.token = findRotation(metadata)
+	if r.token == nil {
+		if err := checkRotatable(metadata); err != nil {
+			return nil, err
+		}
+		r.oldDigest = sortedIDs(metadata.Digests)[0]
+	} else if err := r.parseState(); err != nil {
+		return nil, err
+	}
+
+	digests := map[string]*Digest{r.oldDigest: metadata.Digests[r.oldDigest]}
+	if r.oldKey, r.passphrases, err = openKeyslots(device, passphrase, opts.Passphrases, metadata, digests, r.keyslot); err != nil {
+		return nil, err
+	}
+
+	if r.token == nil {
+		if err := r.start(passphrase, opts); err != nil {
+			return nil, err
+		}
+	} else {
+		digests := map[string]*Digest{r.newDigest: metadata.Digests[r.newDigest]}
+		if r.newKey, err = unlockKeyslot(device, passphrase, metadata.Keyslots[r.keyslot], digests); err != nil {
+			return nil, fmt.Errorf("keyslot %s of the rotation does not open with the passphrase it was started with: %w", r.keyslot, err)
+		}
+	}
+
+	if err := r.layout(); err != nil {
+		return nil, err
+	}
+	if r.f, err = os.OpenFile(device, os.O_RDWR, 0600); err != nil { // #nosec G304 -- device path validated by RotateVolumeKey
+		return nil, fmt.Errorf("failed to open device: %w", err)
+	}
+	ok = true
+	return r, nil
+}
+
+// findRotation returns the ID and the token recording an unfinished
+// RotateVolumeKey, or -1 and nil
+func findRotation(metadata *LUKS2Metadata) (int, *Token) {
+	for _, id := range sortedIDs(metadata.Tokens) {
+		token := metadata.Tokens[id]
+		if token == nil || token.Type != TokenTypeRotation {
+			continue
+		}
+		if n, err := strconv.Atoi(id); err == nil {
+			return n, token
+		}
+	}
+	return -1, nil
+}
+
+// checkNotRotating returns ErrRotationInProgress while RotateVolumeKey has
+// not finished reencrypting the volume, whose volume key then depends on
+// the sector
+func checkNotRotating(metadata *LUKS2Metadata) error {
+	_, token := findRotation(metadata)
+	if token == nil && !hasRequirement(metadata, rotationRequirement) {
+		return nil
+	}
+	return fmt.Errorf("%w: call RotateVolumeKey again to finish it", ErrRotationInProgress)
+}
+
+// hasRequirement reports whether metadata lists a mandatory requirement
+func hasRequirement(metadata *LUKS2Metadata, requirement string) bool {
+	return metadata.Config != nil && metadata.Config.Requirements != nil &&
+		slices.Contains(metadata.Config.Requirements.Mandatory, requirement)
+}
+
+// checkRotatable refuses volumes RotateVolumeKey cannot rotate before
+// anything is written
+func checkRotatable(metadata *LUKS2Metadata) error {
+	if len(metadata.Digests) != 1 {
+		return fmt.Errorf("%w: volume has %d digests, expected 1", ErrInvalidHeader, len(metadata.Digests))
+	}
+	if metadata.Config != nil && metadata.Config.Requirements != nil && len(metadata.Config.Requirements.Mandatory) > 0 {
+		return fmt.Errorf("volume has mandatory requirements %s (is it being reencrypted?)",
+			strings.Join(metadata.Config.Requirements.Mandatory, ", "))
+	}
+	for _, id := range sortedIDs(metadata.Tokens) {
+		if token := metadata.Tokens[id]; token != nil && token.Type == TokenTypeEscrow && token.EscrowSecret == EscrowSecretVolumeKey {
+			return fmt.Errorf("token %s escrows the volume key; remove it before rotating and escrow the new key afterwards", id)
+		}
+	}
+
+	segs, err := mappedSegments(metadata)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if seg.Type == SegmentTypeCrypt && seg.Encryption != "aes-xts-plain64" {
+			return fmt.Errorf("%w: %s", ErrUnsupportedCipher, seg.Encryption)
+		}
+	}
+	return nil
+}
+
+// openKeyslots unlocks every keyslot but skip with passphrase or its entry
+// in passphrases, against digests. It returns the volume key and the
+// passphrase of each keyslot, or an error wrapping ErrInvalidPassphrase
+// that lists the keyslots that did not open.
+func openKeyslots(device string, passphrase []byte, passphrases map[int][]byte, metadata *LUKS2Metadata, digests map[string]*Digest, skip string) (*securemem.Buffer, map[string][]byte, error) {
+	var volumeKey *securemem.Buffer
+	opened := make(map[string][]byte)
+	var locked []string
+	for _, id := range sortedIDs(metadata.Keyslots) {
+		if id == skip {
+			continue
+		}
+		ks := metadata.Keyslots[id]
+		keyslot, err := strconv.Atoi(id)
+		if err != nil || ks.Type != "luks2" || ks.Area == nil {
+			if volumeKey != nil {
+				volumeKey.Destroy()
+			}
+			return nil, nil, fmt.Errorf("%w: keyslot %s has type %q and cannot be re-enrolled", ErrInvalidKeyslot, id, ks.Type)
+		}
+
+		pass := passphrase
+		if p, ok := passphrases[keyslot]; ok {
+			pass = p
+		}
+		masterKey, err := unlockKeyslot(device, pass, ks, digests)
+		if err != nil {
+			if keyslotSkipped(err) {
+				if volumeKey != nil {
+					volumeKey.Destroy()
+				}
+				return nil, nil, fmt.Errorf("keyslot %s: %w", id, err)
+			}
+			locked = append(locked, id)
+			continue
+		}
+
+		// Every keyslot matched the same digest, so holds the same key
+		if volumeKey == nil {
+			volumeKey = masterKey
+		} else {
+			masterKey.Destroy()
+		}
+		opened[id] = pass
+	}
+
+	if len(locked) > 0 || volumeKey == nil {
+		if volumeKey != nil {
+			volumeKey.Destroy()
+		}
+		return nil, nil, fmt.Errorf("%w: no passphrase for keyslot(s) %s; pass them in RotateOptions.Passphrases or remove the keyslots first",
+			ErrInvalidPassphrase, strings.Join(locked, ", "))
+	}
+	return volumeKey, opened, nil
+}
+
+// parseState reads the progress recorded in the rotation token
+func (r *rotation) parseState() error {
+	path := "tokens." + strconv.Itoa(r.tokenID)
+	token := r.token
+	if len(token.Keyslots) != 1 || r.metadata.Keyslots[token.Keyslots[0]] == nil {
+		return metadataErrorf(path+".keyslots", "rotation token must list its existing keyslot")
+	}
+	r.keyslot, r.newDigest = token.Keyslots[0], token.RotationDigest
+	if len(r.metadata.Digests) != 2 || r.metadata.Digests[r.newDigest] == nil {
+		return metadataErrorf(path+".rotation-digest", "digest %q is not one of two digests", r.newDigest)
+	}
+	for _, id := range sortedIDs(r.metadata.Digests) {
+		if id != r.newDigest {
+			r.oldDigest = id
+		}
+	}
+
+	var err error
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *int64
+	}{
+		{"rotation-offset", token.RotationOffset, &r.offset},
+		{"rotation-hot-size", token.RotationHotSize, &r.hot},
+		{"rotation-journal", token.RotationJournal, &r.journal},
+		{"rotation-journal-size", token.RotationJournalSize, &r.journalSize},
+	} {
+		if *field.dst, err = parseSize(field.value); err != nil || *field.dst < 0 {
+			return metadataErrorf(path+"."+field.name, "invalid value %q", field.value)
+		}
+	}
+	if r.journalSize < rotateMinChunkSize || r.journalSize%rotateMinChunkSize != 0 || r.hot > r.journalSize {
+		return metadataErrorf(path, "invalid journal of %d bytes for %d hot bytes", r.journalSize, r.hot)
+	}
+	if start, end := keyslotsAreaBounds(r.metadata); r.journal < start || r.journalSize > end-r.journal {
+		return metadataErrorf(path+".rotation-journal", "%d bytes at %d are outside the keyslots area [%d, %d)", r.journalSize, r.journal, start, end)
+	}
+	r.hash = token.RotationJournalHash
+	return nil
+}
+
+// start generates the new volume key and commits the keyslot, digest,
+// token and requirement that record the rotation
+func (r *rotation) start(passphrase []byte, opts *RotateOptions) error {
+	var err error
+	if r.newKey, err = securemem.NewRandom(r.oldKey.Len()); err != nil {
+		return fmt.Errorf("failed to generate volume key: %w", err)
+	}
+	old := r.metadata.Digests[r.oldDigest]
+	kdf, value, err := createDigest(r.newKey.Bytes(), old.Hash, old.Iterations)
+	if err != nil {
+		return fmt.Errorf("failed to create digest: %w", err)
+	}
+
+	tx, err := r.transaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The keyslot is a stand-in for the re-enrolled ones, protected like
+	// the first of them and never tried by a plain unlock
+	reference := r.metadata.Keyslots[sortedIDs(r.passphrases)[0]]
+	kdfOpts := rewrapOptions(reference, opts.KDF)
+	ignore := KeyslotPriorityIgnore
+	kdfOpts.Keyslot, kdfOpts.Annotation, kdfOpts.Priority = nil, nil, &ignore
+	keyslot, err := tx.stageKey(passphrase, kdfOpts)
+	if err != nil {
+		return err
+	}
+
+	// stageKey adds the keyslot to every digest, but it holds the new key
+	r.keyslot = strconv.Itoa(keyslot)
+	old.Keyslots = slices.DeleteFunc(old.Keyslots, func(id string) bool { return id == r.keyslot })
+	r.newDigest = freeDigestID(r.metadata)
+	r.metadata.Digests[r.newDigest] = &Digest{
+		Type:       kdf.Type,
+		Keyslots:   []string{r.keyslot},
+		Segments:   []string{},
+		Hash:       kdf.Hash,
+		Iterations: *kdf.Iterations,
+		Salt:       kdf.Salt,
+		Digest:     value,
+	}
+
+	if r.journal, r.journalSize, err = allocateJournal(r.metadata, cmp.Or(opts.ChunkSize, DefaultRotateChunkSize)); err != nil {
+		return err
+	}
+	if r.tokenID, err = tx.ImportToken(&Token{
+		Type:                TokenTypeRotation,
+		Keyslots:            []string{r.keyslot},
+		RotationDigest:      r.newDigest,
+		RotationOffset:      "0",
+		RotationHotSize:     "0",
+		RotationJournal:     formatSize(r.journal),
+		RotationJournalSize: formatSize(r.journalSize),
+	}); err != nil {
+		return err
+	}
+	r.token = r.metadata.Tokens[strconv.Itoa(r.tokenID)]
+
+	config := r.metadata.Config
+	if config.Requirements == nil {
+		config.Requirements = &Requirements{}
+	}
+	config.Requirements.Mandatory = append(config.Requirements.Mandatory, rotationRequirement)
+
+	return tx.Commit()
+}
+
+// freeDigestID returns the lowest digest ID not in use
+func freeDigestID(metadata *LUKS2Metadata) string {
+	for i := 0; ; i++ {
+		if _, exists := metadata.Digests[strconv.Itoa(i)]; !exists {
+			return strconv.Itoa(i)
+		}
+	}
+}
+
+// allocateJournal finds room for a journal of up to size bytes in the
+// keyslots area, halving the size while it does not fit
+func allocateJournal(metadata *LUKS2Metadata, size int64) (int64, int64, error) {
+	for {
+		offset, err := allocateKeyslotArea(metadata, size)
+		if err == nil {
+			return offset, size, nil
+		}
+		if !errors.Is(err, ErrKeyslotAreaFull) || size/2 < rotateMinChunkSize {
+			return 0, 0, fmt.Errorf("no room for the reencryption journal: %w", err)
+		}
+		size = alignTo(size/2, rotateMinChunkSize)
+	}
+}
+
+// transaction returns a Transaction on the header of r whose keyslots
+// protect the new volume key. RotateVolumeKey keeps the lock.
+func (r *rotation) transaction() (*Transaction, error) {
+	origJSON, err := json.Marshal(r.metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	masterKey, err := securemem.NewFromBytes(bytes.Clone(r.newKey.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return &Transaction{
+		device:    r.device,
+		hdr:       r.hdr,
+		metadata:  r.metadata,
+		original:  *r.hdr,
+		origJSON:  origJSON,
+		masterKey: masterKey,
+		op:        "rotate",
+	}, nil
+}
+
+// layout sets up the crypt segments under the old and the new key
+func (r *rotation) layout() error {
+	extents, segs, err := volumeLayout(r.device, r.metadata)
+	if err != nil {
+		return err
+	}
+	for i, seg := range segs {
+		if seg.Type != SegmentTypeCrypt {
+			continue
+		}
+		from, to := extents[i], extents[i]
+		if from.cipher, err = newXTSCipher(r.oldKey.Bytes()); err != nil {
+			return fmt.Errorf("failed to create XTS cipher: %w", err)
+		}
+		if to.cipher, err = newXTSCipher(r.newKey.Bytes()); err != nil {
+			return fmt.Errorf("failed to create XTS cipher: %w", err)
+		}
+		r.from, r.to = append(r.from, from), append(r.to, to)
+	}
+	return nil
+}
+
+// reencrypt rewrites the data under the new key, chunk by chunk, from the
+// recorded offset on
+func (r *rotation) reencrypt() error {
+	if err := r.recover(); err != nil {
+		return err
+	}
+	for i := range r.from {
+		from, to := &r.from[i], &r.to[i]
+		end := from.start + from.length
+		r.offset = max(r.offset, from.start)
+		for r.offset < end {
+			buf, err := r.journalChunk(from, min(r.journalSize, end-r.offset))
+			if err != nil {
+				return err
+			}
+			if err := r.rewriteChunk(from, to, buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recover undoes the rewrite of the hot chunk an interruption left behind.
+// The journal is synced before the header records a chunk, and only
+// overwritten once the chunk is rewritten, so a journal that does not
+// match the recorded hash means the hot chunk is done.
+func (r *rotation) recover() error {
+	if r.hot == 0 {
+		return nil
+	}
+	buf := make([]byte, r.hot)
+	if _, err := r.f.ReadAt(buf, r.journal); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	if journalHash(r.offset, buf) != r.hash {
+		r.offset += r.hot
+		r.hot = 0
+		return nil
+	}
+
+	for i := range r.from {
+		ext := &r.from[i]
+		if r.offset < ext.start || r.offset+r.hot > ext.start+ext.length {
+			continue
+		}
+		if _, err := r.f.WriteAt(buf, ext.offset+r.offset-ext.start); err != nil {
+			return fmt.Errorf("failed to restore journaled data: %w", err)
+		}
+		if err := r.f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+		r.hot = 0
+		return nil
+	}
+	return metadataErrorf("tokens."+strconv.Itoa(r.tokenID), "%d hot bytes at %d are not in a crypt segment", r.hot, r.offset)
+}
+
+// journalHash binds the journaled ciphertext to its offset in the volume
+func journalHash(offset int64, data []byte) string {
+	h := sha256.New()
+	_ = binary.Write(h, binary.LittleEndian, offset)
+	h.Write(data)
+	return encodeBase64(h.Sum(nil))
+}
+
+// journalChunk copies n bytes of ciphertext at the offset to the journal
+// and records them as the hot chunk, so that an interrupted rewrite can be
+// undone
+func (r *rotation) journalChunk(ext *volumeExtent, n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := r.f.ReadAt(buf, ext.offset+r.offset-ext.start); err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	if _, err := r.f.WriteAt(buf, r.journal); err != nil {
+		return nil, fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := r.f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync: %w", err)
+	}
+
+	r.hot, r.hash = n, journalHash(r.offset, buf)
+	return buf, r.save()
+}
+
+// rewriteChunk reencrypts the hot chunk in buf under the new key and
+// writes it back
+func (r *rotation) rewriteChunk(from, to *volumeExtent, buf []byte) error {
+	rel := r.offset - from.start
+	from.crypt(buf, rel, false)
+	to.crypt(buf, rel, true)
+	if _, err := r.f.WriteAt(buf, from.offset+rel); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+	if err := r.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+	r.offset += r.hot
+	r.hot = 0
+	return nil
+}
+
+// save records the progress in the rotation token
+func (r *rotation) save() error {
+	r.token.RotationOffset = formatSize(r.offset)
+	r.token.RotationHotSize = formatSize(r.hot)
+	r.token.RotationJournalHash = r.hash
+	r.hdr.SequenceID++
+	if err := writeHeaderInternal(r.device, r.hdr, r.metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	return nil
+}
+
+// finish wipes the journal, then re-enrolls every keyslot for the new key
+// and drops the rotation keyslot, the old digest, the token and the
+// requirement in one header write
+func (r *rotation) finish(kdf *AddKeyOptions) error {
+	if err := writeKeyslotArea(r.f, r.journal, nil, r.journalSize); err != nil {
+		return fmt.Errorf("failed to wipe journal: %w", err)
+	}
+	if err := r.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+
+	tx, err := r.transaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := sortedIDs(r.passphrases)
+	for _, id := range ids {
+		keyslot, _ := strconv.Atoi(id) // openKeyslots only yields numeric IDs
+		if err := tx.replaceKeyslot(keyslot, r.passphrases[id], rewrapOptions(r.metadata.Keyslots[id], kdf)); err != nil {
+			return fmt.Errorf("keyslot %d: %w", keyslot, err)
+		}
+	}
+	keyslot, _ := strconv.Atoi(r.keyslot)
+	if err := tx.KillKeyslot(keyslot); err != nil {
+		return err
+	}
+	if err := tx.RemoveToken(r.tokenID); err != nil {
+		return err
+	}
+
+	digest := r.metadata.Digests[r.newDigest]
+	digest.Keyslots = ids
+	digest.Segments = r.metadata.Digests[r.oldDigest].Segments
+	delete(r.metadata.Digests, r.oldDigest)
+
+	if requirements := r.metadata.Config.Requirements; requirements != nil {
+		requirements.Mandatory = slices.DeleteFunc(requirements.Mandatory, func(req string) bool { return req == rotationRequirement })
+		if len(requirements.Mandatory) == 0 && len(requirements.Extra) == 0 {
+			r.metadata.Config.Requirements = nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	emitEvent(Event{Type: EventVolumeKeyRotated, Op: "rotate", Device: r.device})
+	return nil
+}
+
+// close clears the keys and closes the device
+func (r *rotation) close() {
+	for i := range r.from {
+		r.from[i].cipher.Clear()
+		r.to[i].cipher.Clear()
+	}
+	if r.oldKey != nil {
+		r.oldKey.Destroy()
+	}
+	if r.newKey != nil {
+		r.newKey.Destroy()
+	}
+	if r.f != nil {
+		_ = r.f.Close()
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testRotateOptions reencrypts the test volume in several chunks
+var testRotateOptions = &RotateOptions{KDF: testAddKeyOptions, ChunkSize: 256 * 1024}
+
+// fillTestVolume writes random data over the whole decrypted volume and
+// returns it
+func fillTestVolume(t *testing.T, device string, passphrase []byte) []byte {
+	t.Helper()
+	v, err := OpenVolume(device, passphrase, &VolumeOptions{Writable: true})
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = v.Close() }()
+
+	data := make([]byte, v.Size())
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.WriteAt(data, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	return data
+}
+
+// checkTestVolume verifies the decrypted volume holds data
+func checkTestVolume(t *testing.T, device string, passphrase, data []byte) {
+	t.Helper()
+	v, err := OpenVolume(device, passphrase, nil)
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = v.Close() }()
+
+	got := make([]byte, v.Size())
+	if _, err := v.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("volume data changed by the rotation")
+	}
+}
+
+func TestRotateVolumeKey(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	extra := addTestKeys(t, device, admin, 1)
+	data := fillTestVolume(t, device, admin)
+	oldKey, err := ExtractVolumeKey(device, admin)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	sink := captureEvents(t)
+
+	opts := *testRotateOptions
+	opts.Passphrases = map[int][]byte{1: extra[0]}
+	if err := RotateVolumeKey(device, admin, &opts); err != nil {
+		t.Fatalf("RotateVolumeKey failed: %v", err)
+	}
+
+	newKey, err := ExtractVolumeKey(device, extra[0])
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	if bytes.Equal(newKey, oldKey) || len(newKey) != len(oldKey) {
+		t.Error("volume key not replaced")
+	}
+	if err := VerifyVolumeKey(device, oldKey); !errors.Is(err, ErrInvalidVolumeKey) {
+		t.Errorf("old volume key still verifies (%v)", err)
+	}
+	checkTestVolume(t, device, admin, data)
+
+	for i, pass := range [][]byte{admin, extra[0]} {
+		if slot, err := TestPassphrase(device, pass, nil); err != nil || slot != i {
+			t.Errorf("passphrase %d opens keyslot %d (%v), want %d", i, slot, err, i)
+		}
+	}
+
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if len(metadata.Keyslots) != 2 || len(metadata.Digests) != 1 || len(metadata.Tokens) != 0 || metadata.Config.Requirements != nil {
+		t.Errorf("rotation left state behind: %d keyslots, %d digests, tokens %v, requirements %v",
+			len(metadata.Keyslots), len(metadata.Digests), metadata.Tokens, metadata.Config.Requirements)
+	}
+	for _, digest := range metadata.Digests {
+		if len(digest.Keyslots) != 2 || len(digest.Segments) != 1 {
+			t.Errorf("digest lists keyslots %v and segments %v", digest.Keyslots, digest.Segments)
+		}
+	}
+
+	rotated := 0
+	for _, e := range sink.events {
+		if e.Type == EventVolumeKeyRotated && e.Op == "rotate" {
+			rotated++
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("%d %s events, want 1", rotated, EventVolumeKeyRotated)
+	}
+}
+
+func TestRotateVolumeKey_LockedKeyslot(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	addTestKeys(t, device, admin, 1)
+	_, before, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	err = RotateVolumeKey(device, admin, testRotateOptions)
+	if !errors.Is(err, ErrInvalidPassphrase) {
+		t.Fatalf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+
+	_, after, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if len(after.Tokens) != 0 || len(after.Keyslots) != len(before.Keyslots) {
+		t.Error("failed rotation changed the header")
+	}
+}
+
+// TestRotateVolumeKey_Resume tests finishing rotations interrupted while a
+// chunk was rewritten and while the next one was journaled
+func TestRotateVolumeKey_Resume(t *testing.T) {
+	tests := []struct {
+		name string
+		tear func(t *testing.T, r *rotation)
+	}{
+		{"torn chunk", func(t *testing.T, r *rotation) {
+			ext := &r.from[0]
+			if _, err := r.journalChunk(ext, r.journalSize); err != nil {
+				t.Fatalf("journalChunk failed: %v", err)
+			}
+			garbage := bytes.Repeat([]byte{0xA5}, int(r.hot/2))
+			if _, err := r.f.WriteAt(garbage, ext.offset+r.offset-ext.start); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"torn journal", func(t *testing.T, r *rotation) {
+			garbage := bytes.Repeat([]byte{0xA5}, int(r.journalSize/2))
+			if _, err := r.f.WriteAt(garbage, r.journal); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := []byte("admin-password")
+			device := formatTestVolume(t, admin)
+			data := fillTestVolume(t, device, admin)
+
+			// Rewrite one chunk, then stop partway through the next step
+			r, err := openRotation(device, admin, testRotateOptions)
+			if err != nil {
+				t.Fatalf("openRotation failed: %v", err)
+			}
+			buf, err := r.journalChunk(&r.from[0], r.journalSize)
+			if err != nil {
+				t.Fatalf("journalChunk failed: %v", err)
+			}
+			if err := r.rewriteChunk(&r.from[0], &r.to[0], buf); err != nil {
+				t.Fatalf("rewriteChunk failed: %v", err)
+			}
+			tt.tear(t, r)
+			r.close()
+
+			if _, err := OpenVolume(device, admin, nil); !errors.Is(err, ErrRotationInProgress) {
+				t.Errorf("OpenVolume during rotation: %v, want ErrRotationInProgress", err)
+			}
+			if err := KillKeyslot(device, 1); !errors.Is(err, ErrRotationInProgress) {
+				t.Errorf("KillKeyslot during rotation: %v, want ErrRotationInProgress", err)
+			}
+			if err := RotateVolumeKey(device, []byte("other-password"), nil); !errors.Is(err, ErrInvalidPassphrase) {
+				t.Errorf("resume with another passphrase: %v, want ErrInvalidPassphrase", err)
+			}
+
+			if err := RotateVolumeKey(device, admin, testRotateOptions); err != nil {
+				t.Fatalf("RotateVolumeKey failed to resume: %v", err)
+			}
+			checkTestVolume(t, device, admin, data)
+		})
+	}
+}
+
+// TestRotateVolumeKey_Unsupported tests volumes refused before anything is
+// written
+func TestRotateVolumeKey_Unsupported(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Config.Requirements = &Requirements{Mandatory: []string{"online-reencrypt-v2"}}
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	before, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateVolumeKey(device, admin, testRotateOptions); err == nil {
+		t.Error("Expected RotateVolumeKey to refuse a volume being reencrypted")
+	}
+	if after, err := os.ReadFile(device); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("refused rotation changed the device (%v)", err)
+	}
+	if err := RotateVolumeKey(device, admin, &RotateOptions{ChunkSize: 1000}); err == nil {
+		t.Error("Expected an error for a chunk size that is not a multiple of 4096")
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MetadataError reports JSON metadata that does not conform to the LUKS2
+// on-disk format. ReadHeader treats a header copy with such metadata as
+// damaged, as cryptsetup does.
+type MetadataError struct {
+	Path   string // Offending object or field, e.g. "keyslots.1.area.offset"
+	Reason string
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("%v: metadata %s: %s", ErrInvalidHeader, e.Path, e.Reason)
+}
+
+func (e *MetadataError) Unwrap() error {
+	return ErrInvalidHeader
+}
+
+// metadataErrorf returns a MetadataError for path
+func metadataErrorf(path, format string, args ...interface{}) error {
+	return &MetadataError{Path: path, Reason: fmt.Sprintf(format, args...)}
+}
+
+// validateMetadataSchema checks metadata against the requirements of the
+// LUKS2 on-disk format: required objects and fields, numeric strings,
+// keyslot areas inside the keyslots area and references between objects.
+// Objects are checked in ID order and the first violation is returned.
+// Consistency checks beyond the format (area overlaps, alignment, unbound
+// keyslots) are left to Validate.
+func validateMetadataSchema(hdr *LUKS2BinaryHeader, m *LUKS2Metadata) error {
+	if m.Keyslots == nil {
+		return metadataErrorf("keyslots", "missing")
+	}
+	if m.Segments == nil {
+		return metadataErrorf("segments", "missing")
+	}
+	if m.Digests == nil {
+		return metadataErrorf("digests", "missing")
+	}
+	if m.Config == nil {
+		return metadataErrorf("config", "missing")
+	}
+
+	keyslotsSize, err := schemaNumber("config.keyslots_size", m.Config.KeyslotsSize)
+	if err != nil {
+		return err
+	}
+	if _, err := schemaNumber("config.json_size", m.Config.JSONSize); err != nil {
+		return err
+	}
+
+	// Keyslot areas live between the second header copy and keyslots_size
+	areaStart := 2 * int64(hdr.HeaderSize) // #nosec G115 - header size validated on read
+	if err := schemaKeyslots(m, areaStart, areaStart+keyslotsSize); err != nil {
+		return err
+	}
+	if err := schemaSegments(m); err != nil {
+		return err
+	}
+	if err := schemaDigests(m); err != nil {
+		return err
+	}
+	return schemaTokens(m)
+}
+
+// schemaKeyslots checks every keyslot and that its area lies within
+// [areaStart, areaEnd)
+func schemaKeyslots(m *LUKS2Metadata, areaStart, areaEnd int64) error {
+	for _, id := range sortedIDs(m.Keyslots) {
+		path := "keyslots." + id
+		if err := schemaID(path, id, MaxKeyslots); err != nil {
+			return err
+		}
+		ks := m.Keyslots[id]
+		if ks == nil {
+			return metadataErrorf(path, "not an object")
+		}
+		if ks.KeySize <= 0 {
+			return metadataErrorf(path+".key_size", "must be positive, got %d", ks.KeySize)
+		}
+
+		switch ks.Type {
+		case "luks2":
+			if ks.Priority != nil && validateKeyslotPriority(*ks.Priority) != nil {
+				return metadataErrorf(path+".priority", "must be 0-2, got %d", *ks.Priority)
+			}
+			if err := schemaKDF(path+".kdf", ks.KDF); err != nil {
+				return err
+			}
+			if ks.AF == nil {
+				return metadataErrorf(path+".af", "missing")
+			}
+			if ks.AF.Type != "luks1" {
+				return metadataErrorf(path+".af.type", "unsupported type %q", ks.AF.Type)
+			}
+			if _, err := afMaterialSize(ks.KeySize, ks.AF.Stripes); err != nil {
+				return metadataErrorf(path+".af.stripes", "%v", err)
+			}
+			if ks.AF.Hash == "" {
+				return metadataErrorf(path+".af.hash", "missing")
+			}
+		case "reencrypt":
+			// Reencryption progress; only the area is common to both types
+		case "":
+			return metadataErrorf(path+".type", "missing")
+		default:
+			return metadataErrorf(path+".type", "unsupported type %q", ks.Type)
+		}
+
+		if ks.Area == nil {
+			return metadataErrorf(path+".area", "missing")
+		}
+		if ks.Area.Type == "" {
+			return metadataErrorf(path+".area.type", "missing")
+		}
+		offset, err := schemaNumber(path+".area.offset", ks.Area.Offset)
+		if err != nil {
+			return err
+		}
+		size, err := schemaNumber(path+".area.size", ks.Area.Size)
+		if err != nil {
+			return err
+		}
+		if offset < areaStart || size > areaEnd-offset {
+			return metadataErrorf(path+".area", "%d bytes at %d are outside the keyslots area [%d, %d)", size, offset, areaStart, areaEnd)
+		}
+		if ks.Type == "luks2" && size < int64(ks.KeySize)*int64(ks.AF.Stripes) {
+			return metadataErrorf(path+".area.size", "%d bytes cannot hold %d stripes of a %d-byte key", size, ks.AF.Stripes, ks.KeySize)
+		}
+		if ks.Type == "luks2" && ks.Area.Encryption == "" {
+			return metadataErrorf(path+".area.encryption", "missing")
+		}
+	}
+	return nil
+}
+
+// schemaKDF checks that a keyslot KDF has the parameters its type needs
+func schemaKDF(path string, kdf *KDF) error {
+	if kdf == nil {
+		return metadataErrorf(path, "missing")
+	}
+	if kdf.Salt == "" {
+		return metadataErrorf(path+".salt", "missing")
+	}
+	if _, err := decodeBase64(kdf.Salt); err != nil {
+		return metadataErrorf(path+".salt", "not base64")
+	}
+
+	switch kdf.Type {
+	case KDFTypePBKDF2:
+		if kdf.Hash == "" {
+			return metadataErrorf(path+".hash", "missing")
+		}
+		if kdf.Iterations == nil || *kdf.Iterations <= 0 {
+			return metadataErrorf(path+".iterations", "must be positive")
+		}
+	case KDFTypeArgon2i, KDFTypeArgon2id:
+		for _, p := range []struct {
+			name  string
+			value *int
+		}{{"time", kdf.Time}, {"memory", kdf.Memory}, {"cpus", kdf.CPUs}} {
+			if p.value == nil || *p.value <= 0 {
+				return metadataErrorf(path+"."+p.name, "must be positive")
+			}
+		}
+	case "":
+		return metadataErrorf(path+".type", "missing")
+	default:
+		return metadataErrorf(path+".type", "unsupported type %q", kdf.Type)
+	}
+	return nil
+}
+
+// schemaSegments checks the required fields of every segment
+func schemaSegments(m *LUKS2Metadata) error {
+	for _, id := range sortedIDs(m.Segments) {
+		path := "segments." + id
+		if err := schemaID(path, id, -1); err != nil {
+			return err
+		}
+		seg := m.Segments[id]
+		if seg == nil {
+			return metadataErrorf(path, "not an object")
+		}
+		if seg.Type == "" {
+			return metadataErrorf(path+".type", "missing")
+		}
+		if _, err := schemaNumber(path+".offset", seg.Offset); err != nil {
+			return err
+		}
+		if seg.Size != "dynamic" {
+			size, err := schemaNumber(path+".size", seg.Size)
+			if err != nil {
+				return err
+			}
+			if size == 0 {
+				return metadataErrorf(path+".size", "must be positive or \"dynamic\"")
+			}
+		}
+
+		if seg.Type != SegmentTypeCrypt {
+			continue
+		}
+		if seg.Encryption == "" {
+			return metadataErrorf(path+".encryption", "missing")
+		}
+		if _, err := schemaNumber(path+".iv_tweak", seg.IVTweak); err != nil {
+			return err
+		}
+		if seg.SectorSize < 512 || seg.SectorSize > 4096 || !isPowerOf2(seg.SectorSize) {
+			return metadataErrorf(path+".sector_size", "must be a power of two from 512 to 4096, got %d", seg.SectorSize)
+		}
+	}
+	return nil
+}
+
+// schemaDigests checks every digest and the keyslots and segments it
+// references
+func schemaDigests(m *LUKS2Metadata) error {
+	for _, id := range sortedIDs(m.Digests) {
+		path := "digests." + id
+		if err := schemaID(path, id, -1); err != nil {
+			return err
+		}
+		d := m.Digests[id]
+		if d == nil {
+			return metadataErrorf(path, "not an object")
+		}
+		if d.Type == "" {
+			return metadataErrorf(path+".type", "missing")
+		}
+		for _, f := range []struct{ name, value string }{{"salt", d.Salt}, {"digest", d.Digest}} {
+			if _, err := decodeBase64(f.value); err != nil || f.value == "" {
+				return metadataErrorf(path+"."+f.name, "missing or not base64")
+			}
+		}
+		for i, ks := range d.Keyslots {
+			if _, ok := m.Keyslots[ks]; !ok {
+				return metadataErrorf(fmt.Sprintf("%s.keyslots[%d]", path, i), "references missing keyslot %q", ks)
+			}
+		}
+		for i, seg := range d.Segments {
+			if _, ok := m.Segments[seg]; !ok {
+				return metadataErrorf(fmt.Sprintf("%s.segments[%d]", path, i), "references missing segment %q", seg)
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTokens checks token IDs and types. Token contents are up to
+// their handlers, and a token may outlive the keyslots it names.
+func schemaTokens(m *LUKS2Metadata) error {
+	for _, id := range sortedIDs(m.Tokens) {
+		path := "tokens." + id
+		if err := schemaID(path, id, MaxTokenSlots); err != nil {
+			return err
+		}
+		token := m.Tokens[id]
+		if token == nil {
+			return metadataErrorf(path, "not an object")
+		}
+		if token.Type == "" {
+			return metadataErrorf(path+".type", "missing")
+		}
+		for i, ks := range token.Keyslots {
+			if err := schemaID(fmt.Sprintf("%s.keyslots[%d]", path, i), ks, MaxKeyslots); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// schemaID checks that an object key is a decimal ID below limit (-1 = no
+// limit)
+func schemaID(path, id string, limit int) error {
+	if !validNumericID(id) {
+		return metadataErrorf(path, "ID %q is not a decimal number", id)
+	}
+	if n, _ := strconv.Atoi(id); limit >= 0 && n >= limit {
+		return metadataErrorf(path, "ID %d exceeds the maximum of %d", n, limit-1)
+	}
+	return nil
+}
+
+// schemaNumber parses a numeric string, which LUKS2 uses for 64-bit values:
+// decimal digits only, no sign
+func schemaNumber(path, s string) (int64, error) {
+	if s == "" {
+		return 0, metadataErrorf(path, "missing")
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, metadataErrorf(path, "%q is not a numeric string", s)
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, metadataErrorf(path, "%q is out of range", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// corpusMetadata decodes a document of the header corpus
+func corpusMetadata(t *testing.T, name string) (*LUKS2BinaryHeader, *LUKS2Metadata) {
+	t.Helper()
+	jsonData := loadHeaderCorpus(t)[name]
+	var metadata LUKS2Metadata
+	if err := json.Unmarshal(jsonData, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	return &LUKS2BinaryHeader{HeaderSize: uint64(corpusHeaderSize(t, jsonData))}, &metadata // #nosec G115 - test header size
+}
+
+func TestValidateMetadataSchema_Corpus(t *testing.T) {
+	for name := range loadHeaderCorpus(t) {
+		hdr, metadata := corpusMetadata(t, name)
+		if err := validateMetadataSchema(hdr, metadata); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateMetadataSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *LUKS2Metadata)
+		path   string
+	}{
+		{"missing config", func(m *LUKS2Metadata) { m.Config = nil }, "config"},
+		{"missing segments", func(m *LUKS2Metadata) { m.Segments = nil }, "segments"},
+		{"signed keyslots_size", func(m *LUKS2Metadata) { m.Config.KeyslotsSize = "+16744448" }, "config.keyslots_size"},
+		{"non-numeric keyslot ID", func(m *LUKS2Metadata) { m.Keyslots["a"] = m.Keyslots["0"] }, "keyslots.a"},
+		{"keyslot ID out of range", func(m *LUKS2Metadata) { m.Keyslots["32"] = m.Keyslots["0"] }, "keyslots.32"},
+		{"null keyslot", func(m *LUKS2Metadata) { m.Keyslots["1"] = nil }, "keyslots.1"},
+		{"missing keyslot type", func(m *LUKS2Metadata) { m.Keyslots["0"].Type = "" }, "keyslots.0.type"},
+		{"unknown keyslot type", func(m *LUKS2Metadata) { m.Keyslots["0"].Type = "luks3" }, "keyslots.0.type"},
+		{"missing kdf", func(m *LUKS2Metadata) { m.Keyslots["0"].KDF = nil }, "keyslots.0.kdf"},
+		{"argon2 without memory", func(m *LUKS2Metadata) { m.Keyslots["0"].KDF.Memory = nil }, "keyslots.0.kdf.memory"},
+		{"salt not base64", func(m *LUKS2Metadata) { m.Keyslots["0"].KDF.Salt = "!!" }, "keyslots.0.kdf.salt"},
+		{"missing af", func(m *LUKS2Metadata) { m.Keyslots["0"].AF = nil }, "keyslots.0.af"},
+		{"zero af stripes", func(m *LUKS2Metadata) { m.Keyslots["0"].AF.Stripes = 0 }, "keyslots.0.af.stripes"},
+		{"af stripes overflow", func(m *LUKS2Metadata) { m.Keyslots["0"].AF.Stripes = 1 << 30 }, "keyslots.0.af.stripes"},
+		{"area smaller than af split", func(m *LUKS2Metadata) { m.Keyslots["0"].AF.Stripes *= 2 }, "keyslots.0.area.size"},
+		{"area offset not numeric", func(m *LUKS2Metadata) { m.Keyslots["0"].Area.Offset = "0x8000" }, "keyslots.0.area.offset"},
+		{"area inside header", func(m *LUKS2Metadata) { m.Keyslots["0"].Area.Offset = "16384" }, "keyslots.0.area"},
+		{"area past keyslots area", func(m *LUKS2Metadata) { m.Keyslots["0"].Area.Size = "16748544" }, "keyslots.0.area"},
+		{"segment size zero", func(m *LUKS2Metadata) { m.Segments["0"].Size = "0" }, "segments.0.size"},
+		{"negative segment offset", func(m *LUKS2Metadata) { m.Segments["0"].Offset = "-1" }, "segments.0.offset"},
+		{"missing iv_tweak", func(m *LUKS2Metadata) { m.Segments["0"].IVTweak = "" }, "segments.0.iv_tweak"},
+		{"invalid sector size", func(m *LUKS2Metadata) { m.Segments["0"].SectorSize = 1000 }, "segments.0.sector_size"},
+		{"digest of missing keyslot", func(m *LUKS2Metadata) {
+			m.Digests["0"].Keyslots = append(m.Digests["0"].Keyslots, "5")
+		}, "digests.0.keyslots[1]"},
+		{"digest of missing segment", func(m *LUKS2Metadata) { m.Digests["0"].Segments = []string{"1"} }, "digests.0.segments[0]"},
+		{"missing digest value", func(m *LUKS2Metadata) { m.Digests["0"].Digest = "" }, "digests.0.digest"},
+		{"token without type", func(m *LUKS2Metadata) { m.Tokens = map[string]*Token{"0": {Keyslots: []string{"0"}}} }, "tokens.0.type"},
+		{"token keyslot not numeric", func(m *LUKS2Metadata) {
+			m.Tokens = map[string]*Token{"0": {Type: "x", Keyslots: []string{"zero"}}}
+		}, "tokens.0.keyslots[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr, metadata := corpusMetadata(t, "cryptsetup-2.0-argon2i.json")
+			tt.modify(metadata)
+
+			err := validateMetadataSchema(hdr, metadata)
+			var merr *MetadataError
+			if !errors.As(err, &merr) {
+				t.Fatalf("expected a MetadataError, got %v", err)
+			}
+			if merr.Path != tt.path {
+				t.Errorf("expected path %q, got %q (%v)", tt.path, merr.Path, err)
+			}
+			if !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("expected ErrInvalidHeader, got %v", err)
+			}
+		})
+	}
+}
+
+// TestReadHeader_RejectsNonConformingMetadata tests that ReadHeader refuses
+// metadata that only Validate can inspect
+func TestReadHeader_RejectsNonConformingMetadata(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Digests["0"].Keyslots = append(metadata.Digests["0"].Keyslots, "7")
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	var merr *MetadataError
+	if _, _, err := ReadHeader(device); !errors.As(err, &merr) || merr.Path != "digests.0.keyslots[1]" {
+		t.Errorf("expected a MetadataError for digests.0.keyslots[1], got %v", err)
+	}
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatalf("CheckHeaders failed: %v", err)
+	}
+	if !errors.As(status.PrimaryErr, &merr) || !errors.As(status.SecondaryErr, &merr) {
+		t.Errorf("expected both copies reported invalid, got %v / %v", status.PrimaryErr, status.SecondaryErr)
+	}
+
+	report, err := Validate(device)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !hasProblem(report, "metadata", "digests.0.keyslots[1]") || !hasProblem(report, "digest 0", "missing keyslot 7") {
+		t.Errorf("expected the schema violation and its details, got %v", report.Problems)
+	}
+}
+
+// TestParseHeaderBytes_SchemaFallback tests that a copy with non-conforming
+// metadata is passed over for the other copy
+func TestParseHeaderBytes_SchemaFallback(t *testing.T) {
+	jsonData := loadHeaderCorpus(t)["cryptsetup-2.0-argon2i.json"]
+	headerSize := corpusHeaderSize(t, jsonData)
+
+	var broken map[string]interface{}
+	if err := json.Unmarshal(jsonData, &broken); err != nil {
+		t.Fatal(err)
+	}
+	delete(broken, "digests")
+	brokenJSON, err := json.Marshal(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary has the newer sequence ID but is not valid metadata
+	data := encodeHeaders(t, brokenJSON, headerSize, 2)[:headerSize]
+	data = append(data, encodeHeaders(t, jsonData, headerSize, 1)[headerSize:]...)
+
+	hdr, metadata, err := ParseHeaderBytes(data)
+	if err != nil {
+		t.Fatalf("ParseHeaderBytes failed: %v", err)
+	}
+	if hdr.SequenceID != 1 || len(metadata.Digests) != 1 {
+		t.Errorf("expected the secondary copy, got sequence %d with %d digests", hdr.SequenceID, len(metadata.Digests))
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirect opens device read-only with O_DIRECT. It fails with EINVAL on
+// filesystems without direct I/O.
+func openDirect(device string) (*os.File, error) {
+	return os.OpenFile(device, os.O_RDONLY|unix.O_DIRECT, 0) // #nosec G304 -- device path validated by caller
+}
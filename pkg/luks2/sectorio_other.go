@@ -0,0 +1,17 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+)
+
+// openDirect is not supported: there is no O_DIRECT
+func openDirect(device string) (*os.File, error) {
+	return nil, fmt.Errorf("direct I/O on %s: %w", device, ErrNotSupported)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+// alignedOnlyReader rejects reads that are not sector-aligned in offset,
+// length and buffer address, like O_DIRECT on a 4K-native device
+type alignedOnlyReader struct {
+	data []byte
+}
+
+func (r *alignedOnlyReader) ReadAt(p []byte, off int64) (int, error) {
+	// #nosec G103 -- address is only inspected to check the alignment
+	if off%directIOAlignment != 0 || len(p)%directIOAlignment != 0 || uintptr(unsafe.Pointer(&p[0]))%directIOAlignment != 0 {
+		return 0, errors.New("EINVAL: unaligned direct read")
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// TestSectorReader tests unaligned reads through aligned sector reads
+func TestSectorReader(t *testing.T) {
+	data := make([]byte, 3*directIOAlignment+100)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	r := &sectorReader{r: &alignedOnlyReader{data: data}}
+
+	for _, tc := range []struct{ off, n int }{
+		{0, 6},
+		{1, 4096},
+		{4095, 2},
+		{4096, 4096},
+		{100, 3 * directIOAlignment},
+		{len(data) - 10, 10},
+	} {
+		t.Run(fmt.Sprintf("%d+%d", tc.off, tc.n), func(t *testing.T) {
+			p := make([]byte, tc.n)
+			n, err := r.ReadAt(p, int64(tc.off))
+			if err != nil || n != tc.n {
+				t.Fatalf("ReadAt = %d, %v", n, err)
+			}
+			if !bytes.Equal(p, data[tc.off:tc.off+tc.n]) {
+				t.Error("wrong bytes")
+			}
+		})
+	}
+
+	// Reads past the end are short with io.EOF
+	p := make([]byte, 20)
+	n, err := r.ReadAt(p, int64(len(data)-10))
+	if n != 10 || err != io.EOF || !bytes.Equal(p[:10], data[len(data)-10:]) {
+		t.Errorf("ReadAt across the end = %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(p, int64(len(data)+5000)); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v", n, err)
+	}
+}
+
+// TestSectorReader_Header tests that both header copies parse from a
+// device that only accepts aligned reads
+func TestSectorReader_Header(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	data, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := checkHeaderCopies(&sectorReader{r: &alignedOnlyReader{data: data}}, true)
+	if status.PrimaryErr != nil || status.SecondaryErr != nil {
+		t.Fatalf("header copies failed through sectorReader: %v; %v", status.PrimaryErr, status.SecondaryErr)
+	}
+}
+
+// TestDirectIO tests reading headers and unlocking keyslots with O_DIRECT
+func TestDirectIO(t *testing.T) {
+	saved := DirectIO
+	DirectIO = true
+	t.Cleanup(func() { DirectIO = saved })
+
+	device := formatTestVolume(t, []byte("test-password"))
+	if _, _, err := ReadHeader(device); err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if ok, err := IsLUKS2(device); err != nil || !ok {
+		t.Fatalf("IsLUKS2 = %v, %v", ok, err)
+	}
+	if status, err := CheckHeaders(device); err != nil || status.NeedsRepair() {
+		t.Fatalf("CheckHeaders = %+v, %v", status, err)
+	}
+	if _, err := ExtractVolumeKey(device, []byte("test-password")); err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin || windows
+
+// Package securemem allocates buffers for key material outside the Go heap.
+//
+// Each Buffer is its own anonymous mapping: the data pages are locked in RAM
+// (mlock, or VirtualLock on Windows) so they are never written to swap,
+// excluded from core dumps where the OS allows it, and surrounded by
+// inaccessible guard pages so an overrun faults instead of reading or
+// corrupting neighbouring memory. The data is placed at the end of its pages
+// so the trailing guard page catches overruns immediately. Destroy zeroes
+// and unmaps the buffer; it must be called explicitly since the garbage
+// collector does not manage this memory.
+package securemem
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Buffer is a fixed-size, locked, guarded memory region
+type Buffer struct {
+	mu        sync.Mutex
+	region    []byte // Whole mapping including guard pages
+	data      []byte
+	locked    bool
+	destroyed bool
+}
+
+// New allocates a zeroed buffer of size bytes. If the pages cannot be locked
+// (e.g. RLIMIT_MEMLOCK is exhausted) the buffer is still returned, guarded
+// and excluded from core dumps, and Locked reports false.
+func New(size int) (*Buffer, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("securemem: invalid size %d", size)
+	}
+
+	page := os.Getpagesize()
+	dataPages := (size + page - 1) / page
+	if dataPages == 0 {
+		dataPages = 1
+	}
+	region, err := allocRegion((dataPages + 2) * page)
+	if err != nil {
+		return nil, fmt.Errorf("securemem: allocation failed: %w", err)
+	}
+
+	inner := region[page : len(region)-page]
+	if err := guardPage(region[:page]); err != nil {
+		_ = freeRegion(region)
+		return nil, fmt.Errorf("securemem: guard page: %w", err)
+	}
+	if err := guardPage(region[len(region)-page:]); err != nil {
+		_ = freeRegion(region)
+		return nil, fmt.Errorf("securemem: guard page: %w", err)
+	}
+	// Best effort: keep key material out of core dumps
+	excludeFromDumps(inner)
+
+	b := &Buffer{
+		region: region,
+		data:   inner[len(inner)-size:],
+		locked: lockPages(inner) == nil,
+	}
+	return b, nil
+}
+
+// NewFromBytes moves src into a new buffer and zeroes src
+func NewFromBytes(src []byte) (*Buffer, error) {
+	b, err := New(len(src))
+	if err != nil {
+		clear(src)
+		return nil, err
+	}
+	copy(b.data, src)
+	clear(src)
+	return b, nil
+}
+
+// NewRandom allocates a buffer filled from crypto/rand
+func NewRandom(size int) (*Buffer, error) {
+	b, err := New(size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(b.data); err != nil {
+		b.Destroy()
+		return nil, fmt.Errorf("securemem: failed to generate random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// Bytes returns the buffer contents. The slice is only valid until Destroy;
+// any copy made from it is ordinary heap memory. Bytes returns nil after
+// Destroy.
+func (b *Buffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.destroyed {
+		return nil
+	}
+	return b.data
+}
+
+// Len returns the buffer size in bytes
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.destroyed {
+		return 0
+	}
+	return len(b.data)
+}
+
+// Locked reports whether the buffer's pages are locked in RAM
+func (b *Buffer) Locked() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked && !b.destroyed
+}
+
+// Destroy zeroes, unlocks and unmaps the buffer. It is safe to call more
+// than once and on a nil Buffer.
+func (b *Buffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.destroyed {
+		return
+	}
+
+	page := os.Getpagesize()
+	inner := b.region[page : len(b.region)-page]
+	clear(inner)
+	if b.locked {
+		_ = unlockPages(inner)
+	}
+	_ = freeRegion(b.region)
+
+	b.region = nil
+	b.data = nil
+	b.destroyed = true
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build darwin
+
+package securemem
+
+// excludeFromDumps is a no-op: macOS has no per-region opt-out from core
+// dumps
+func excludeFromDumps([]byte) {}
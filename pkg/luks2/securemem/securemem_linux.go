@@ -0,0 +1,14 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package securemem
+
+import "golang.org/x/sys/unix"
+
+// excludeFromDumps keeps pages out of core dumps
+func excludeFromDumps(b []byte) {
+	_ = unix.Madvise(b, unix.MADV_DONTDUMP)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package securemem
+
+import (
+	"bytes"
+	"os"
+	"runtime/debug"
+	"testing"
+	"unsafe"
+)
+
+func TestNew(t *testing.T) {
+	for _, size := range []int{0, 1, 64, os.Getpagesize(), os.Getpagesize() + 1} {
+		b, err := New(size)
+		if err != nil {
+			t.Fatalf("New(%d) failed: %v", size, err)
+		}
+		data := b.Bytes()
+		if len(data) != size || b.Len() != size {
+			t.Errorf("New(%d): len %d", size, len(data))
+		}
+		if !bytes.Equal(data, make([]byte, size)) {
+			t.Errorf("New(%d): not zeroed", size)
+		}
+		// The whole buffer must be writable
+		for i := range data {
+			data[i] = 0xAA
+		}
+		if !b.Locked() {
+			t.Logf("New(%d): pages not locked (RLIMIT_MEMLOCK?)", size)
+		}
+		b.Destroy()
+	}
+
+	if _, err := New(-1); err == nil {
+		t.Error("Expected error for negative size")
+	}
+}
+
+func TestNewFromBytes(t *testing.T) {
+	src := []byte("volume-key-material")
+	want := append([]byte(nil), src...)
+
+	b, err := NewFromBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Destroy()
+
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("Bytes = %q, want %q", b.Bytes(), want)
+	}
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Error("Source was not zeroed")
+	}
+}
+
+func TestNewRandom(t *testing.T) {
+	b, err := NewRandom(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Destroy()
+
+	if bytes.Equal(b.Bytes(), make([]byte, 64)) {
+		t.Error("Random buffer is all zeros")
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	b, err := New(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Destroy()
+	b.Destroy()
+
+	if b.Bytes() != nil || b.Len() != 0 || b.Locked() {
+		t.Error("Expected empty buffer after Destroy")
+	}
+
+	var nilBuf *Buffer
+	nilBuf.Destroy()
+}
+
+// sink keeps the guard page read from being optimized away
+var sink byte
+
+// TestGuardPage tests that reading one byte past the buffer faults
+func TestGuardPage(t *testing.T) {
+	b, err := New(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Destroy()
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	faulted := func() (faulted bool) {
+		defer func() { faulted = recover() != nil }()
+		data := b.Bytes()
+		past := (*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(data)), len(data)))
+		sink = *past
+		return false
+	}()
+	if !faulted {
+		t.Error("Expected a fault reading past the buffer")
+	}
+}
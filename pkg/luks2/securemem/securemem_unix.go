@@ -0,0 +1,34 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin
+
+package securemem
+
+import "golang.org/x/sys/unix"
+
+// allocRegion maps size bytes of anonymous, private memory
+func allocRegion(size int) ([]byte, error) {
+	return unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+}
+
+// freeRegion unmaps a region returned by allocRegion
+func freeRegion(region []byte) error {
+	return unix.Munmap(region)
+}
+
+// guardPage makes a page inaccessible
+func guardPage(page []byte) error {
+	return unix.Mprotect(page, unix.PROT_NONE)
+}
+
+// lockPages keeps pages in RAM
+func lockPages(b []byte) error {
+	return unix.Mlock(b)
+}
+
+// unlockPages undoes lockPages
+func unlockPages(b []byte) error {
+	return unix.Munlock(b)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package securemem
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocRegion commits size bytes of private memory
+func allocRegion(size int) ([]byte, error) {
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, err
+	}
+	// Reinterpret rather than convert the address so vet does not mistake
+	// memory outside the Go heap for a lost Go pointer
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr)) // #nosec G103 -- memory owned by this package
+	return unsafe.Slice((*byte)(ptr), size), nil
+}
+
+// freeRegion releases a region returned by allocRegion
+func freeRegion(region []byte) error {
+	return windows.VirtualFree(addrOf(region), 0, windows.MEM_RELEASE)
+}
+
+// guardPage makes a page inaccessible
+func guardPage(page []byte) error {
+	var old uint32
+	return windows.VirtualProtect(addrOf(page), uintptr(len(page)), windows.PAGE_NOACCESS, &old)
+}
+
+// excludeFromDumps is a no-op: Windows has no per-region opt-out from
+// crash dumps
+func excludeFromDumps([]byte) {}
+
+// lockPages keeps pages in RAM (within the process working set)
+func lockPages(b []byte) error {
+	return windows.VirtualLock(addrOf(b), uintptr(len(b)))
+}
+
+// unlockPages undoes lockPages
+func unlockPages(b []byte) error {
+	return windows.VirtualUnlock(addrOf(b), uintptr(len(b)))
+}
+
+// addrOf returns the address of the first byte of b
+func addrOf(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(b))) // #nosec G103 -- memory owned by this package
+}
@@ -12,7 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"time"
 )
 
 // Security constants
@@ -23,19 +23,26 @@ const (
 	MaxKeySize          = 512
 	MinSectorSize       = 512
 	MaxSectorSize       = 4096
-	DigestIterations    = 600000 // Increased from 100k for better security
+	DigestIterations    = 600000 // Floor of benchmarked volume key digest iterations
+	MinDigestIterations = 1000   // Fewest digest iterations FormatOptions may set, as in cryptsetup
 )
 
 // Validation errors
 var (
-	ErrInvalidPath         = errors.New("invalid device path")
-	ErrPassphraseTooShort  = errors.New("passphrase too short (minimum 8 bytes)")
-	ErrPassphraseTooLong   = errors.New("passphrase too long (maximum 512 bytes)")
-	ErrInvalidKeySize      = errors.New("invalid key size (must be 256 or 512 bits)")
-	ErrInvalidSectorSize   = errors.New("invalid sector size (must be 512 or 4096)")
-	ErrInvalidArgon2Memory = errors.New("invalid Argon2 memory (must be >= 65536 KB)")
-	ErrInvalidArgon2Time   = errors.New("invalid Argon2 time cost (must be >= 1)")
-	ErrIntegerOverflow     = errors.New("integer overflow detected")
+	ErrInvalidPath             = errors.New("invalid device path")
+	ErrPassphraseTooShort      = errors.New("passphrase too short (minimum 8 bytes)")
+	ErrPassphraseTooLong       = errors.New("passphrase too long (maximum 512 bytes)")
+	ErrInvalidKeySize          = errors.New("invalid key size (must be 256 or 512 bits)")
+	ErrInvalidSectorSize       = errors.New("invalid sector size (must be 512 or 4096)")
+	ErrInvalidMetadataSize     = errors.New("invalid metadata size (must be a power of 2 from 16 KiB to 4 MiB)")
+	ErrInvalidKeyslotsSize     = errors.New("invalid keyslots size (must be 4 KiB aligned and at most 128 MiB)")
+	ErrInvalidUUID             = errors.New("invalid UUID")
+	ErrInvalidLabel            = errors.New("invalid label (at most 47 bytes, no NUL)")
+	ErrInvalidArgon2Memory     = errors.New("invalid Argon2 memory (must be >= 65536 KB)")
+	ErrInvalidArgon2Time       = errors.New("invalid Argon2 time cost (must be >= 1)")
+	ErrIntegerOverflow         = errors.New("integer overflow detected")
+	ErrInvalidAFStripes        = errors.New("invalid anti-forensic stripes")
+	ErrInvalidDigestIterations = errors.New("invalid digest iterations (must be >= 1000)")
 )
 
 // ValidateDevicePath validates a device path for security
@@ -108,6 +115,39 @@ func ValidateFormatOptions(opts FormatOptions) error {
 		return ErrInvalidSectorSize
 	}
 
+	// Validate header and keyslots area sizes
+	if opts.MetadataSize != 0 && !validMetadataSize(int64(opts.MetadataSize)) {
+		return ErrInvalidMetadataSize
+	}
+	if opts.KeyslotsSize < 0 || opts.KeyslotsSize%KeyslotAreaAlignment != 0 || opts.KeyslotsSize > LUKS2MaxKeyslotsSize {
+		return ErrInvalidKeyslotsSize
+	}
+
+	// Validate labels, which must fit the NUL-terminated header fields
+	if err := validateHeaderLabel(opts.Label); err != nil {
+		return err
+	}
+	if err := validateHeaderLabel(opts.Subsystem); err != nil {
+		return err
+	}
+
+	// Validate a caller-provided UUID
+	if opts.UUID != "" {
+		if _, err := parseVolumeUUID(opts.UUID); err != nil {
+			return err
+		}
+	}
+
+	// Validate data segment layout
+	if err := validateSegmentSpecs(opts.Segments, opts.SectorSize); err != nil {
+		return err
+	}
+
+	// Validate the byte range holding the volume
+	if err := validateRegion(opts.Offset, opts.Size); err != nil {
+		return err
+	}
+
 	// Validate Argon2 parameters if specified
 	if opts.KDFType == "argon2id" || opts.KDFType == "argon2i" {
 		if opts.Argon2Memory != 0 && opts.Argon2Memory < 65536 {
@@ -118,12 +158,19 @@ func ValidateFormatOptions(opts FormatOptions) error {
 		}
 	}
 
-	// Check for integer overflow in size calculations
-	if opts.KeySize > 0 {
-		keyBytes := opts.KeySize / 8
-		afSize := keyBytes * AFStripes
-		if afSize/AFStripes != keyBytes {
-			return ErrIntegerOverflow
+	// Validate the digest cost
+	if (opts.DigestIterations != 0 && opts.DigestIterations < MinDigestIterations) || opts.DigestIterTime < 0 {
+		return ErrInvalidDigestIterations
+	}
+
+	// Validate stripes against the key material they produce
+	if opts.AFStripes != 0 {
+		keySize := opts.KeySize
+		if keySize == 0 {
+			keySize = DefaultKeySize
+		}
+		if _, err := afMaterialSize(keySize/8, opts.AFStripes); err != nil {
+			return err
 		}
 	}
 
@@ -143,25 +190,132 @@ func CheckOverflow(a, b int) error {
 	return nil
 }
 
+// LockTimeout is how long AcquireFileLock and ReadHeader wait for a lock
+// held by another process before failing with ErrDeviceLocked. Zero fails
+// immediately.
+var LockTimeout = 5 * time.Second
+
+// ErrDeviceLocked is returned when another process, or another goroutine of
+// this one, holds a conflicting lock on a device. The error names the
+// holding processes when they can be determined.
+var ErrDeviceLocked = errors.New("device is locked")
+
+// Lock polling interval bounds
+const (
+	lockRetryMin = 10 * time.Millisecond
+	lockRetryMax = 250 * time.Millisecond
+)
+
+// LockOptions controls how a file lock is taken
+type LockOptions struct {
+	Shared  bool          // Shared (read) lock; other shared holders are allowed
+	Timeout time.Duration // How long to wait (0 = fail immediately, negative = forever)
+}
+
 // FileLock represents a file lock for concurrent access protection
 type FileLock struct {
-	file *os.File
+	file   *os.File
+	dev    *deviceMutex
+	shared bool
 }
 
-// AcquireFileLock acquires an exclusive lock on a file
+// AcquireFileLock acquires an exclusive lock on a file, waiting up to
+// LockTimeout for other holders to release it
 func AcquireFileLock(path string) (*FileLock, error) {
-	f, err := os.OpenFile(path, os.O_RDWR, 0) // #nosec G304 -- device path for file locking
+	return AcquireFileLockWithOptions(path, &LockOptions{Timeout: LockTimeout})
+}
+
+// AcquireSharedFileLock acquires a shared (read) lock on a file. Shared
+// holders only exclude writers, so concurrent readers never wait for each
+// other.
+func AcquireSharedFileLock(path string) (*FileLock, error) {
+	return AcquireFileLockWithOptions(path, &LockOptions{Shared: true, Timeout: LockTimeout})
+}
+
+// AcquireFileLockWithOptions acquires a lock on a file as described by
+// opts. A nil opts takes an exclusive lock without waiting.
+//
+// The lock is taken in two steps: first the in-process mutex of the device,
+// which serializes goroutines of this process, then the file lock, which
+// serializes processes. opts.Timeout covers both.
+func AcquireFileLockWithOptions(path string, opts *LockOptions) (*FileLock, error) {
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+	deadline := time.Now().Add(opts.Timeout)
+
+	dev := getDeviceMutex(path)
+	locked, _ := retryLock(opts.Timeout, deadline, func() (bool, error) {
+		return dev.tryLock(opts.Shared), nil
+	})
+	if !locked {
+		dev.put()
+		return nil, lockHeldError(path)
+	}
+	lock := &FileLock{dev: dev, shared: opts.Shared}
+
+	// Shared locks only need read access, so readers of read-only images
+	// can take them
+	flag := os.O_RDWR
+	if opts.Shared {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flag, 0) // #nosec G304 -- device path for file locking
 	if err != nil {
+		lock.releaseDevice()
 		return nil, err
 	}
 
-	// Try to acquire exclusive lock
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+	locked, err = retryLock(opts.Timeout, deadline, func() (bool, error) {
+		err := lockFile(f, opts.Shared)
+		if err != nil && isLockContention(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if !locked {
 		_ = f.Close() // Ignore close error since we're returning lock error
-		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		lock.releaseDevice()
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		return nil, lockHeldError(path)
+	}
+
+	lock.file = f
+	return lock, nil
+}
+
+// retryLock calls try with backoff until it takes the lock, fails, or
+// timeout (measured to deadline) expires. A negative timeout waits forever.
+func retryLock(timeout time.Duration, deadline time.Time, try func() (bool, error)) (bool, error) {
+	delay := lockRetryMin
+	for {
+		locked, err := try()
+		if locked || err != nil {
+			return locked, err
+		}
+
+		if timeout >= 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false, nil
+			}
+			delay = min(delay, remaining)
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, lockRetryMax)
 	}
+}
 
-	return &FileLock{file: f}, nil
+// lockHeldError builds the ErrDeviceLocked error for path, naming the
+// processes holding the lock where the platform reports them
+func lockHeldError(path string) error {
+	holders := lockHolders(path)
+	if len(holders) == 0 {
+		return fmt.Errorf("%s: %w", path, ErrDeviceLocked)
+	}
+	return fmt.Errorf("%s: %w (held by %s)", path, ErrDeviceLocked, strings.Join(holders, ", "))
 }
 
 // Release releases the file lock
@@ -169,8 +323,21 @@ func (l *FileLock) Release() error {
 	if l.file == nil {
 		return nil
 	}
-	_ = syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN) // Ignore unlock error
-	return l.file.Close()
+	_ = unlockFile(l.file) // Ignore unlock error
+	err := l.file.Close()
+	l.releaseDevice()
+	return err
+}
+
+// releaseDevice releases the in-process device mutex. It is safe to call
+// more than once.
+func (l *FileLock) releaseDevice() {
+	if l.dev == nil {
+		return
+	}
+	l.dev.unlock(l.shared)
+	l.dev.put()
+	l.dev = nil
 }
 
 // OpenFileSecure opens a file with proper permissions
@@ -201,3 +368,18 @@ func SafeInt64ToUint64(v int64) (uint64, error) {
 	}
 	return uint64(v), nil
 }
+
+// validateRegion checks the byte range of a device a volume is confined to:
+// offset and size must be non-negative multiples of 512 (size 0 = to the end)
+func validateRegion(offset, size int64) error {
+	if offset < 0 || size < 0 || offset%512 != 0 || size%512 != 0 {
+		return fmt.Errorf("%w: region offset %d and size %d must be non-negative multiples of 512", ErrInvalidSize, offset, size)
+	}
+	return nil
+}
+
+// unlocksRegion reports whether opts confine an unlock to a byte range of
+// the device
+func unlocksRegion(opts *UnlockOptions) bool {
+	return opts != nil && (opts.Offset != 0 || opts.Size != 0)
+}
@@ -7,10 +7,12 @@
 package luks2
 
 import (
+	"errors"
 	"math"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestValidateDevicePath(t *testing.T) {
@@ -244,6 +246,61 @@ func TestValidateFormatOptions(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "minimum digest iterations",
+			opts: FormatOptions{
+				Device:           tmpFile.Name(),
+				Passphrase:       []byte("valid-passphrase"),
+				DigestIterations: MinDigestIterations,
+			},
+			wantErr: false,
+		},
+		{
+			name: "too few digest iterations",
+			opts: FormatOptions{
+				Device:           tmpFile.Name(),
+				Passphrase:       []byte("valid-passphrase"),
+				DigestIterations: MinDigestIterations - 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative digest iteration time",
+			opts: FormatOptions{
+				Device:         tmpFile.Name(),
+				Passphrase:     []byte("valid-passphrase"),
+				DigestIterTime: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "sector-aligned region",
+			opts: FormatOptions{
+				Device:     tmpFile.Name(),
+				Passphrase: []byte("valid-passphrase"),
+				Offset:     1 << 20,
+				Size:       32 << 20,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unaligned region offset",
+			opts: FormatOptions{
+				Device:     tmpFile.Name(),
+				Passphrase: []byte("valid-passphrase"),
+				Offset:     100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative region size",
+			opts: FormatOptions{
+				Device:     tmpFile.Name(),
+				Passphrase: []byte("valid-passphrase"),
+				Size:       -512,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -366,7 +423,27 @@ func TestCheckOverflow_EdgeCases(t *testing.T) {
 	})
 }
 
+// setLockTimeout overrides LockTimeout for the duration of a test
+func setLockTimeout(t *testing.T, d time.Duration) {
+	t.Helper()
+	saved := LockTimeout
+	LockTimeout = d
+	t.Cleanup(func() { LockTimeout = saved })
+}
+
+// lockTestFile creates an empty temp file to lock
+func lockTestFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
 func TestFileLock(t *testing.T) {
+	setLockTimeout(t, 0)
+
 	// Create a temp file
 	tmpFile, err := os.CreateTemp("", "luks-lock-test-*")
 	if err != nil {
@@ -400,6 +477,89 @@ func TestFileLock(t *testing.T) {
 	defer func() { _ = lock2.Release() }()
 }
 
+func TestFileLock_Shared(t *testing.T) {
+	path := lockTestFile(t)
+
+	first, err := AcquireSharedFileLock(path)
+	if err != nil {
+		t.Fatalf("AcquireSharedFileLock() error = %v", err)
+	}
+	second, err := AcquireSharedFileLock(path)
+	if err != nil {
+		t.Fatalf("second AcquireSharedFileLock() error = %v", err)
+	}
+
+	// Readers exclude writers
+	if _, err := AcquireFileLockWithOptions(path, nil); !errors.Is(err, ErrDeviceLocked) {
+		t.Errorf("exclusive lock over shared locks: got %v, want ErrDeviceLocked", err)
+	}
+
+	_ = first.Release()
+	_ = second.Release()
+
+	exclusive, err := AcquireFileLockWithOptions(path, nil)
+	if err != nil {
+		t.Fatalf("exclusive lock after release error = %v", err)
+	}
+	defer func() { _ = exclusive.Release() }()
+
+	// Writers exclude readers
+	if _, err := AcquireFileLockWithOptions(path, &LockOptions{Shared: true}); !errors.Is(err, ErrDeviceLocked) {
+		t.Errorf("shared lock over exclusive lock: got %v, want ErrDeviceLocked", err)
+	}
+}
+
+func TestFileLock_Timeout(t *testing.T) {
+	path := lockTestFile(t)
+
+	lock, err := AcquireFileLockWithOptions(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := AcquireFileLockWithOptions(path, &LockOptions{Timeout: 100 * time.Millisecond}); !errors.Is(err, ErrDeviceLocked) {
+		t.Errorf("got %v, want ErrDeviceLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("gave up after %v, want at least the timeout", elapsed)
+	}
+
+	// A lock released while waiting is acquired
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = lock.Release()
+	}()
+	lock2, err := AcquireFileLockWithOptions(path, &LockOptions{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("waiting for release: %v", err)
+	}
+	_ = lock2.Release()
+}
+
+func TestReadHeader_Locking(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	setLockTimeout(t, 50*time.Millisecond)
+
+	shared, err := AcquireSharedFileLock(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetVolumeInfo(device); err != nil {
+		t.Errorf("GetVolumeInfo under a shared lock: %v", err)
+	}
+	_ = shared.Release()
+
+	exclusive, err := AcquireFileLock(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = exclusive.Release() }()
+	if _, _, err := ReadHeader(device); !errors.Is(err, ErrDeviceLocked) {
+		t.Errorf("ReadHeader under an exclusive lock: got %v, want ErrDeviceLocked", err)
+	}
+}
+
 func TestFileLock_NonexistentFile(t *testing.T) {
 	_, err := AcquireFileLock("/nonexistent/file/path")
 	if err == nil {
@@ -0,0 +1,247 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AuditSeverity grades a finding of Audit
+type AuditSeverity string
+
+const (
+	// AuditCritical means the data is not meaningfully protected
+	AuditCritical AuditSeverity = "critical"
+
+	// AuditHigh means a practical weakness or a missing safeguard
+	AuditHigh AuditSeverity = "high"
+
+	// AuditMedium means a weakness that makes attacks cheaper
+	AuditMedium AuditSeverity = "medium"
+
+	// AuditLow means the volume falls short of current recommendations
+	AuditLow AuditSeverity = "low"
+)
+
+// auditPenalty is how many points a finding of each severity costs
+var auditPenalty = map[AuditSeverity]int{
+	AuditCritical: 50,
+	AuditHigh:     25,
+	AuditMedium:   10,
+	AuditLow:      3,
+}
+
+// Checks reported in AuditFinding.Check
+const (
+	AuditCheckCipher          = "cipher"
+	AuditCheckKeySize         = "key-size"
+	AuditCheckKDF             = "kdf"
+	AuditCheckPBKDF2SHA1      = "pbkdf2-sha1"
+	AuditCheckSecondaryHeader = "secondary-header"
+	AuditCheckDowngrade       = "downgrade"
+)
+
+// legacyReencryptRequirement is the requirement of the first online
+// reencryption metadata format, whose unauthenticated state let an attacker
+// with write access to the header decrypt data in place (CVE-2021-4122)
+const legacyReencryptRequirement = "online-reencrypt"
+
+// AuditFinding is a single finding of Audit
+type AuditFinding struct {
+	Severity AuditSeverity `json:"severity"`
+	Check    string        `json:"check"`  // One of the AuditCheck constants
+	Object   string        `json:"object"` // e.g. "segment 0", "keyslot 1", "header"
+	Message  string        `json:"message"`
+}
+
+// String formats the finding as "severity: object: message"
+func (f AuditFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Object, f.Message)
+}
+
+// AuditReport is the result of Audit
+type AuditReport struct {
+	Device   string             `json:"device"`
+	UUID     string             `json:"uuid"`
+	Score    int                `json:"score"` // 100 minus the penalties of the findings, at least 0
+	Findings []AuditFinding     `json:"findings"`
+	Keyslots []KeyslotKDFReport `json:"keyslots"` // KDF strength of each keyslot
+}
+
+// Worst returns the severity of the most severe finding ("" = none)
+func (r *AuditReport) Worst() AuditSeverity {
+	return worstSeverity(r.Findings)
+}
+
+// add records a finding
+func (r *AuditReport) add(severity AuditSeverity, check, object, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, AuditFinding{Severity: severity, Check: check, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+// worstSeverity returns the severity of the most severe of findings
+func worstSeverity(findings []AuditFinding) AuditSeverity {
+	var worst AuditSeverity
+	for _, f := range findings {
+		if worst == "" || auditPenalty[f.Severity] > auditPenalty[worst] {
+			worst = f.Severity
+		}
+	}
+	return worst
+}
+
+// Audit reviews the security of a volume's configuration without a
+// passphrase: weak or obsolete ciphers and small keys in the data segments
+// and keyslot areas, keyslot KDF costs below the registered KDFPolicy
+// (DefaultKDFPolicy if checks are disabled), PBKDF2-SHA1 keyslots and
+// digests, a missing or damaged secondary header, and signs of a header
+// rolled back or downgraded to an older format. Findings are scored from
+// 100 down. An error is returned only when no header copy can be read.
+func Audit(device string) (*AuditReport, error) {
+	status, err := checkDeviceHeaders(device, false)
+	if err != nil {
+		return nil, err
+	}
+	hdr, metadata, err := status.active()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no valid header copy (primary: %v; secondary: %v)",
+			ErrInvalidHeader, status.PrimaryErr, status.SecondaryErr)
+	}
+
+	policy := GetKDFPolicy()
+	if policy == nil {
+		policy = &DefaultKDFPolicy
+	}
+	report := &AuditReport{Device: device, UUID: headerUUID(hdr), Findings: []AuditFinding{}, Keyslots: auditKDF(metadata, policy)}
+
+	auditHeaders(report, status, metadata)
+	auditSegments(report, metadata)
+	auditKeyslots(report, metadata)
+	auditDigests(report, metadata)
+
+	report.Score = 100
+	for _, f := range report.Findings {
+		report.Score -= auditPenalty[f.Severity]
+	}
+	report.Score = max(report.Score, 0)
+	return report, nil
+}
+
+// auditHeaders reports a missing secondary header and downgrade indicators
+func auditHeaders(r *AuditReport, s *HeaderStatus, m *LUKS2Metadata) {
+	if s.PrimaryErr != nil {
+		r.add(AuditHigh, AuditCheckSecondaryHeader, "primary header", "damaged, the volume relies on its secondary copy alone: %v", s.PrimaryErr)
+	}
+	if s.SecondaryErr != nil {
+		r.add(AuditHigh, AuditCheckSecondaryHeader, "secondary header", "missing or damaged, there is no backup of the primary header: %v", s.SecondaryErr)
+	}
+	if s.PrimaryErr == nil && s.SecondaryErr == nil && s.PrimarySequence != s.SecondarySequence {
+		r.add(AuditMedium, AuditCheckDowngrade, "header", "copies have different sequence IDs (primary %d, secondary %d): one is an older revision that may have been restored", s.PrimarySequence, s.SecondarySequence)
+	}
+	if m.Config != nil && m.Config.Requirements != nil && slices.Contains(m.Config.Requirements.Mandatory, legacyReencryptRequirement) {
+		r.add(AuditHigh, AuditCheckDowngrade, "config", "requires %q, the unauthenticated first reencryption format (CVE-2021-4122)", legacyReencryptRequirement)
+	}
+}
+
+// auditSegments checks the cipher and key size of each crypt segment
+func auditSegments(r *AuditReport, m *LUKS2Metadata) {
+	keySize := 0
+	for _, id := range sortedIDs(m.Keyslots) {
+		if ks := m.Keyslots[id]; ks.Type == "luks2" {
+			keySize = ks.KeySize
+			break
+		}
+	}
+	for _, id := range sortedIDs(m.Segments) {
+		seg := m.Segments[id]
+		if seg.Type != "crypt" {
+			continue
+		}
+		object := "segment " + id
+		auditCipher(r, object, seg.Encryption, true)
+		if keySize > 0 {
+			auditKeySize(r, object, seg.Encryption, keySize)
+		}
+	}
+}
+
+// auditKeyslots checks the area encryption and KDF of each keyslot
+func auditKeyslots(r *AuditReport, m *LUKS2Metadata) {
+	for _, kr := range r.Keyslots {
+		object := fmt.Sprintf("keyslot %d", kr.Keyslot)
+		if kr.Weak {
+			r.add(AuditMedium, AuditCheckKDF, object, "%s", strings.Join(kr.Reasons, ", "))
+		}
+		if kr.Type == "pbkdf2" && strings.EqualFold(kr.Hash, "sha1") {
+			r.add(AuditMedium, AuditCheckPBKDF2SHA1, object, "KDF is PBKDF2-SHA1, which GPUs compute cheaply; re-add the key with pbkdf2-sha256 or argon2id")
+		}
+
+		ks := m.Keyslots[strconv.Itoa(kr.Keyslot)]
+		if ks.Area != nil {
+			auditCipher(r, object+" area", ks.Area.Encryption, false)
+			auditKeySize(r, object+" area", ks.Area.Encryption, areaKeySize(ks))
+		}
+	}
+}
+
+// auditDigests reports volume key digests computed with PBKDF2-SHA1
+func auditDigests(r *AuditReport, m *LUKS2Metadata) {
+	for _, id := range sortedIDs(m.Digests) {
+		d := m.Digests[id]
+		if d.Type == "pbkdf2" && strings.EqualFold(d.Hash, "sha1") {
+			r.add(AuditLow, AuditCheckPBKDF2SHA1, "digest "+id, "volume key digest uses PBKDF2-SHA1")
+		}
+	}
+}
+
+// weakBlockCiphers are ciphers with 64-bit blocks, which repeat after a few
+// GiB of data (Sweet32), or that are broken outright
+var weakBlockCiphers = []string{"des", "des3_ede", "blowfish", "cast5", "idea", "rc4", "arc4"}
+
+// auditCipher reports a weak cipher, mode or IV in a dm-crypt cipher
+// specification. The plain IV only matters for data segments, whose sector
+// numbers can pass 2^32.
+func auditCipher(r *AuditReport, object, spec string, data bool) {
+	parts := strings.SplitN(spec, "-", 3)
+	cipher, mode, iv := parts[0], "", ""
+	if len(parts) > 1 {
+		mode = parts[1]
+	}
+	if len(parts) > 2 {
+		iv = parts[2]
+	}
+
+	switch {
+	case cipher == "cipher_null" || cipher == "null":
+		r.add(AuditCritical, AuditCheckCipher, object, "%q does not encrypt", spec)
+	case mode == "ecb":
+		r.add(AuditCritical, AuditCheckCipher, object, "%q uses ECB, which shows identical plaintext blocks", spec)
+	case slices.Contains(weakBlockCiphers, cipher):
+		r.add(AuditHigh, AuditCheckCipher, object, "%q uses an obsolete 64-bit block cipher", spec)
+	case mode == "cbc" && (iv == "plain" || iv == "plain64"):
+		r.add(AuditMedium, AuditCheckCipher, object, "%q has predictable CBC IVs, open to watermarking; use aes-xts-plain64", spec)
+	case mode == "cbc":
+		r.add(AuditLow, AuditCheckCipher, object, "%q is malleable CBC; aes-xts-plain64 is recommended", spec)
+	case data && iv == "plain":
+		r.add(AuditLow, AuditCheckCipher, object, "%q: the plain IV repeats on devices over 2 TiB; use plain64", spec)
+	}
+}
+
+// auditKeySize reports keys under 256 bits of strength. XTS splits its key
+// in two, so aes-xts with a 256-bit key is AES-128.
+func auditKeySize(r *AuditReport, object, spec string, keyBytes int) {
+	bits := keyBytes * 8
+	if parts := strings.SplitN(spec, "-", 3); len(parts) > 1 && parts[1] == "xts" {
+		bits /= 2
+	}
+	switch {
+	case bits < 128:
+		r.add(AuditHigh, AuditCheckKeySize, object, "%d-bit effective key is too small", bits)
+	case bits < 256:
+		r.add(AuditLow, AuditCheckKeySize, object, "%d-bit effective key; 256 bits (a 512-bit XTS key) is recommended", bits)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAuditCipher(t *testing.T) {
+	tests := []struct {
+		spec string
+		data bool
+		want AuditSeverity
+	}{
+		{"aes-xts-plain64", true, ""},
+		{"aes-xts-plain", false, ""},
+		{"aes-xts-plain", true, AuditLow},
+		{"aes-cbc-essiv:sha256", true, AuditLow},
+		{"aes-cbc-plain64", true, AuditMedium},
+		{"blowfish-cbc-essiv:sha256", true, AuditHigh},
+		{"aes-ecb", true, AuditCritical},
+		{"cipher_null-ecb", true, AuditCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			r := &AuditReport{}
+			auditCipher(r, "segment 0", tt.spec, tt.data)
+			if got := r.Worst(); got != tt.want {
+				t.Errorf("auditCipher(%q) findings = %v, want severity %q", tt.spec, r.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditKeySize(t *testing.T) {
+	tests := []struct {
+		spec     string
+		keyBytes int
+		want     AuditSeverity
+	}{
+		{"aes-xts-plain64", 64, ""},
+		{"aes-xts-plain64", 32, AuditLow},
+		{"aes-cbc-essiv:sha256", 32, ""},
+		{"aes-cbc-essiv:sha256", 16, AuditLow},
+		{"aes-cbc-essiv:sha256", 8, AuditHigh},
+	}
+
+	for _, tt := range tests {
+		r := &AuditReport{}
+		auditKeySize(r, "segment 0", tt.spec, tt.keyBytes)
+		if got := r.Worst(); got != tt.want {
+			t.Errorf("auditKeySize(%q, %d) findings = %v, want severity %q", tt.spec, tt.keyBytes, r.Findings, tt.want)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	useKDFPolicy(t, &KDFPolicy{})
+
+	report, err := Audit(device)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if report.Score != 100 || len(report.Findings) != 0 || report.UUID == "" || len(report.Keyslots) != 1 {
+		t.Errorf("unexpected report for a default volume: %+v", report)
+	}
+
+	// A weak KDF and a destroyed secondary header each cost points
+	useKDFPolicy(t, &KDFPolicy{MinPBKDF2Iterations: 1 << 30})
+	f, err := os.OpenFile(device, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(make([]byte, LUKS2HeaderSize), LUKS2HeaderMinSize)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Audit(device)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	checks := map[string]AuditSeverity{}
+	for _, f := range report.Findings {
+		checks[f.Check] = f.Severity
+	}
+	if checks[AuditCheckKDF] != AuditMedium || checks[AuditCheckSecondaryHeader] != AuditHigh || len(report.Findings) != 2 {
+		t.Errorf("unexpected findings: %v", report.Findings)
+	}
+	if want := 100 - auditPenalty[AuditMedium] - auditPenalty[AuditHigh]; report.Score != want {
+		t.Errorf("Score = %d, want %d", report.Score, want)
+	}
+	if report.Worst() != AuditHigh {
+		t.Errorf("Worst() = %q, want %q", report.Worst(), AuditHigh)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment types
+const (
+	SegmentTypeCrypt  = "crypt"
+	SegmentTypeLinear = "linear"
+)
+
+// CryptFlagIVLargeSectors is the dm-crypt option that derives IVs from the
+// encryption sector number, required by LUKS2 for sectors above 512 bytes
+const CryptFlagIVLargeSectors = "iv_large_sectors"
+
+// validateSegmentSpecs checks a Format segment layout independently of
+// where the data area starts
+func validateSegmentSpecs(specs []SegmentSpec, sectorSize int) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	if sectorSize == 0 {
+		sectorSize = DefaultSectorSize
+	}
+	ss := int64(sectorSize)
+
+	hasCrypt := false
+	for i, spec := range specs {
+		switch spec.Type {
+		case "", SegmentTypeCrypt:
+			hasCrypt = true
+		case SegmentTypeLinear:
+		default:
+			return fmt.Errorf("%w: segment %d: unsupported type %q", ErrInvalidSegmentLayout, i, spec.Type)
+		}
+		if spec.Offset < 0 || spec.Offset%ss != 0 {
+			return fmt.Errorf("%w: segment %d: offset %d is not a multiple of the %d-byte sector size", ErrInvalidSegmentLayout, i, spec.Offset, ss)
+		}
+		if spec.Size < 0 || spec.Size%ss != 0 {
+			return fmt.Errorf("%w: segment %d: size %d is not a multiple of the %d-byte sector size", ErrInvalidSegmentLayout, i, spec.Size, ss)
+		}
+		if spec.Size == 0 && i != len(specs)-1 {
+			return fmt.Errorf("%w: segment %d: only the last segment may be dynamic", ErrInvalidSegmentLayout, i)
+		}
+	}
+	if !hasCrypt {
+		return fmt.Errorf("%w: at least one crypt segment is required", ErrInvalidSegmentLayout)
+	}
+
+	return nil
+}
+
+// layoutSegments places the requested segments on the device starting at
+// dataOffset. Crypt segments get an IV tweak equal to their logical start in
+// 512-byte sectors so the IV sequence is continuous across segments.
+func layoutSegments(specs []SegmentSpec, dataOffset int64, opts FormatOptions) (map[string]*Segment, error) {
+	segments := make(map[string]*Segment, len(specs))
+	cursor := dataOffset
+	var logical int64
+
+	for i, spec := range specs {
+		offset := cursor
+		if spec.Offset != 0 {
+			if spec.Offset < cursor {
+				return nil, fmt.Errorf("%w: segment %d at offset %d overlaps data ending at %d", ErrInvalidSegmentLayout, i, spec.Offset, cursor)
+			}
+			offset = spec.Offset
+		}
+
+		seg := &Segment{
+			Type:   SegmentTypeLinear,
+			Offset: formatSize(offset),
+			Size:   "dynamic",
+		}
+		if spec.Size > 0 {
+			seg.Size = formatSize(spec.Size)
+		}
+		if spec.Type != SegmentTypeLinear {
+			seg.Type = SegmentTypeCrypt
+			seg.IVTweak = strconv.FormatInt(logical/LUKS2SectorSize, 10)
+			seg.Encryption = opts.Cipher + "-" + opts.CipherMode
+			seg.SectorSize = opts.SectorSize
+		}
+
+		segments[strconv.Itoa(i)] = seg
+		cursor = offset + spec.Size
+		logical += spec.Size
+	}
+
+	return segments, nil
+}
+
+// applySegments replaces the metadata segments and binds the volume key
+// digest to the crypt segments among them
+func applySegments(metadata *LUKS2Metadata, segments map[string]*Segment) {
+	var cryptIDs []string
+	for _, id := range sortedIDs(segments) {
+		if segments[id].Type == SegmentTypeCrypt {
+			cryptIDs = append(cryptIDs, id)
+		}
+	}
+
+	metadata.Segments = segments
+	for _, digest := range metadata.Digests {
+		digest.Segments = cryptIDs
+	}
+}
+
+// segmentsEnd returns the device offset just past the last fixed-size
+// segment, or 0 if the layout ends in a dynamic segment
+func segmentsEnd(segments map[string]*Segment) (int64, error) {
+	var end int64
+	for _, seg := range segments {
+		if seg.Size == "dynamic" {
+			return 0, nil
+		}
+		offset, err := parseSize(seg.Offset)
+		if err != nil {
+			return 0, err
+		}
+		size, err := parseSize(seg.Size)
+		if err != nil {
+			return 0, err
+		}
+		end = max(end, offset+size)
+	}
+	return end, nil
+}
+
+// isBackupSegment reports whether a segment only records a layout kept for
+// reencryption recovery and must not be mapped
+func isBackupSegment(seg *Segment) bool {
+	for _, flag := range seg.Flags {
+		if strings.HasPrefix(flag, "backup-") {
+			return true
+		}
+	}
+	return false
+}
+
+// mappedSegments returns the segments that make up the active mapping, in
+// segment ID order
+func mappedSegments(metadata *LUKS2Metadata) ([]*Segment, error) {
+	var segs []*Segment
+	hasCrypt := false
+	for _, id := range sortedIDs(metadata.Segments) {
+		seg := metadata.Segments[id]
+		if seg == nil || isBackupSegment(seg) {
+			continue
+		}
+		switch seg.Type {
+		case SegmentTypeCrypt:
+			hasCrypt = true
+		case SegmentTypeLinear:
+		default:
+			return nil, fmt.Errorf("%w: segment %s has unsupported type %q", ErrInvalidSegmentLayout, id, seg.Type)
+		}
+		segs = append(segs, seg)
+	}
+
+	if !hasCrypt {
+		return nil, fmt.Errorf("no crypt segment found")
+	}
+	for i, seg := range segs[:len(segs)-1] {
+		if seg.Size == "dynamic" {
+			return nil, fmt.Errorf("%w: dynamic segment %d is not the last segment", ErrInvalidSegmentLayout, i)
+		}
+	}
+
+	return segs, nil
+}
+
+// parseIVTweak parses IV tweak value
+func parseIVTweak(s string) uint64 {
+	val, _ := strconv.ParseUint(s, 10, 64)
+	return val
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/anatol/devmapper.go"
+)
+
+const mib = 1 << 20
+
+func TestValidateSegmentSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []SegmentSpec
+		wantErr bool
+	}{
+		{"default layout", nil, false},
+		{"single dynamic crypt", []SegmentSpec{{}}, false},
+		{"crypt linear crypt", []SegmentSpec{{Size: mib}, {Type: SegmentTypeLinear, Size: mib}, {}}, false},
+		{"reserved gap", []SegmentSpec{{Size: mib}, {Offset: 32 * mib}}, false},
+		{"linear only", []SegmentSpec{{Type: SegmentTypeLinear}}, true},
+		{"unknown type", []SegmentSpec{{Type: "integrity"}}, true},
+		{"dynamic not last", []SegmentSpec{{}, {Size: mib}}, true},
+		{"unaligned size", []SegmentSpec{{Size: 1000}}, true},
+		{"unaligned offset", []SegmentSpec{{Offset: 1000}}, true},
+		{"negative size", []SegmentSpec{{Size: -512}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSegmentSpecs(tt.specs, 512)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSegmentSpecs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSegmentLayout) {
+				t.Errorf("expected ErrInvalidSegmentLayout, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormat_Segments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 24*mib); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    []byte("test-password"),
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		Segments: []SegmentSpec{
+			{Size: mib},
+			{Type: SegmentTypeLinear, Size: mib},
+			{Offset: 20 * mib},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	_, metadata, err := ReadHeader(path)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if len(metadata.Segments) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(metadata.Segments))
+	}
+
+	first, err := parseSize(metadata.Segments["0"].Offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{
+		{Type: SegmentTypeCrypt, Offset: formatSize(first), Size: formatSize(mib), IVTweak: "0", Encryption: "aes-xts-plain64", SectorSize: 512},
+		{Type: SegmentTypeLinear, Offset: formatSize(first + mib), Size: formatSize(mib)},
+		{Type: SegmentTypeCrypt, Offset: formatSize(20 * mib), Size: "dynamic", IVTweak: "4096", Encryption: "aes-xts-plain64", SectorSize: 512},
+	}
+	for i, id := range []string{"0", "1", "2"} {
+		if got := *metadata.Segments[id]; !segmentsEqual(got, want[i]) {
+			t.Errorf("segment %s = %+v, want %+v", id, got, want[i])
+		}
+	}
+
+	if got := metadata.Digests["0"].Segments; !slices.Equal(got, []string{"0", "2"}) {
+		t.Errorf("digest segments = %v, want [0 2]", got)
+	}
+
+	report, err := Validate(path)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected clean report, got %v", report.Problems)
+	}
+
+	// The volume key still unlocks through the keyslot
+	if err := TestKey(path, []byte("test-password")); err != nil {
+		t.Errorf("TestKey failed: %v", err)
+	}
+}
+
+func TestFormat_SegmentsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []SegmentSpec
+	}{
+		{"beyond device", []SegmentSpec{{Size: 64 * mib}}},
+		{"overlaps previous segment", []SegmentSpec{{Size: 2 * mib}, {Offset: 16 * mib}}},
+		{"overlaps keyslot area", []SegmentSpec{{Offset: mib}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "volume.luks")
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, 20*mib); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Format(FormatOptions{
+				Device:        path,
+				Passphrase:    []byte("test-password"),
+				KDFType:       "pbkdf2",
+				PBKDFIterTime: 10,
+				Segments:      tt.segments,
+			})
+			if !errors.Is(err, ErrInvalidSegmentLayout) {
+				t.Errorf("expected ErrInvalidSegmentLayout, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMappedSegments(t *testing.T) {
+	crypt := func(size string, flags ...string) *Segment {
+		return &Segment{Type: SegmentTypeCrypt, Offset: "16777216", Size: size, IVTweak: "0", Encryption: "aes-xts-plain64", SectorSize: 512, Flags: flags}
+	}
+
+	t.Run("backup segments are skipped", func(t *testing.T) {
+		m := &LUKS2Metadata{Segments: map[string]*Segment{
+			"0": crypt("dynamic"),
+			"1": crypt("dynamic", "backup-previous"),
+		}}
+		segs, err := mappedSegments(m)
+		if err != nil {
+			t.Fatalf("mappedSegments failed: %v", err)
+		}
+		if len(segs) != 1 {
+			t.Errorf("expected 1 mapped segment, got %d", len(segs))
+		}
+	})
+
+	t.Run("dynamic segment not last", func(t *testing.T) {
+		m := &LUKS2Metadata{Segments: map[string]*Segment{
+			"0": crypt("dynamic"),
+			"1": crypt("1048576"),
+		}}
+		if _, err := mappedSegments(m); !errors.Is(err, ErrInvalidSegmentLayout) {
+			t.Errorf("expected ErrInvalidSegmentLayout, got %v", err)
+		}
+	})
+
+	t.Run("no crypt segment", func(t *testing.T) {
+		m := &LUKS2Metadata{Segments: map[string]*Segment{
+			"0": {Type: SegmentTypeLinear, Offset: "16777216", Size: "dynamic"},
+		}}
+		if _, err := mappedSegments(m); err == nil {
+			t.Error("expected error without a crypt segment")
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		m := &LUKS2Metadata{Segments: map[string]*Segment{
+			"0": {Type: "integrity", Offset: "16777216", Size: "dynamic"},
+		}}
+		if _, err := mappedSegments(m); !errors.Is(err, ErrInvalidSegmentLayout) {
+			t.Errorf("expected ErrInvalidSegmentLayout, got %v", err)
+		}
+	})
+}
+
+func TestSegmentTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.img")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 24*mib); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &LUKS2Metadata{Segments: map[string]*Segment{
+		"0": {Type: SegmentTypeCrypt, Offset: formatSize(16 * mib), Size: formatSize(mib), IVTweak: "0", Encryption: "aes-xts-plain64", SectorSize: 512},
+		"1": {Type: SegmentTypeLinear, Offset: formatSize(17 * mib), Size: formatSize(mib)},
+		"2": {Type: SegmentTypeCrypt, Offset: formatSize(20 * mib), Size: "dynamic", IVTweak: "4096", Encryption: "aes-xts-plain64", SectorSize: 512},
+	}}
+
+	tables, err := segmentTables(path, path, m, make([]byte, 64), nil)
+	if err != nil {
+		t.Fatalf("segmentTables failed: %v", err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("expected 3 tables, got %d", len(tables))
+	}
+
+	first, ok := tables[0].(devmapper.CryptTable)
+	if !ok || first.Start != 0 || first.Length != mib || first.BackendOffset != 16*mib {
+		t.Errorf("unexpected first table %+v", tables[0])
+	}
+	linear, ok := tables[1].(devmapper.LinearTable)
+	if !ok || linear.Start != mib || linear.Length != mib || linear.BackendOffset != 17*mib {
+		t.Errorf("unexpected linear table %+v", tables[1])
+	}
+	last, ok := tables[2].(devmapper.CryptTable)
+	if !ok || last.Start != 2*mib || last.Length != 4*mib || last.IVTweak != 4096 {
+		t.Errorf("unexpected last table %+v", tables[2])
+	}
+}
+
+func TestSegmentTables_LargeSectors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.img")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Leave a partial 4K sector at the end of the device
+	if err := os.Truncate(path, 20*mib+1024); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &LUKS2Metadata{Segments: map[string]*Segment{
+		"0": {Type: SegmentTypeCrypt, Offset: formatSize(16 * mib), Size: "dynamic", IVTweak: "0", Encryption: "aes-xts-plain64", SectorSize: 4096},
+	}}
+	flags := []string{"allow_discards"}
+
+	tables, err := segmentTables(path, path, m, make([]byte, 64), flags)
+	if err != nil {
+		t.Fatalf("segmentTables failed: %v", err)
+	}
+	crypt, ok := tables[0].(devmapper.CryptTable)
+	if !ok {
+		t.Fatalf("unexpected table %+v", tables[0])
+	}
+	if crypt.SectorSize != 4096 {
+		t.Errorf("sector size = %d, want 4096", crypt.SectorSize)
+	}
+	if crypt.Length != 4*mib {
+		t.Errorf("length = %d, want %d", crypt.Length, 4*mib)
+	}
+	if !slices.Equal(crypt.Flags, []string{"allow_discards", CryptFlagIVLargeSectors}) {
+		t.Errorf("flags = %v", crypt.Flags)
+	}
+	if len(flags) != 1 {
+		t.Errorf("caller flags were modified: %v", flags)
+	}
+
+	// 512-byte sectors keep the default IV numbering
+	m.Segments["0"].SectorSize = 512
+	tables, err = segmentTables(path, path, m, make([]byte, 64), nil)
+	if err != nil {
+		t.Fatalf("segmentTables failed: %v", err)
+	}
+	if crypt := tables[0].(devmapper.CryptTable); len(crypt.Flags) != 0 || crypt.Length != 4*mib+1024 {
+		t.Errorf("unexpected 512-byte table %+v", crypt)
+	}
+}
+
+func TestFormat_LargeSectors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 20*mib); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    []byte("test-password"),
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+		SectorSize:    4096,
+	})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	info, err := GetVolumeInfo(path)
+	if err != nil {
+		t.Fatalf("GetVolumeInfo failed: %v", err)
+	}
+	if info.SectorSize != 4096 {
+		t.Errorf("sector size = %d, want 4096", info.SectorSize)
+	}
+	if info.DeviceLogicalBlockSize != LUKS2SectorSize {
+		t.Errorf("device logical block size = %d, want %d", info.DeviceLogicalBlockSize, LUKS2SectorSize)
+	}
+
+	report, err := Validate(path)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected clean report, got %v", report.Problems)
+	}
+}
+
+// segmentsEqual compares segments field by field
+func segmentsEqual(a, b Segment) bool {
+	return a.Type == b.Type && a.Offset == b.Offset && a.Size == b.Size &&
+		a.IVTweak == b.IVTweak && a.Encryption == b.Encryption &&
+		a.SectorSize == b.SectorSize && slices.Equal(a.Flags, b.Flags)
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultSelfTestSectors is how many data sectors SelfTest decrypts by
+// default
+const DefaultSelfTestSectors = 16
+
+// selfTestMinBytes is the least data SelfTest decrypts, enough for every
+// filesystem signature it recognizes
+const selfTestMinBytes = 4096
+
+// SelfTestOptions contains optional settings for SelfTestWithOptions
+type SelfTestOptions struct {
+	// Sectors is how many sectors at the start of the decrypted volume are
+	// read (0 = DefaultSelfTestSectors). At least 4 KiB is always read.
+	Sectors int
+
+	// Unlock selects the keyslot and the derivation parallelism (nil =
+	// defaults); its dm-crypt flags do not apply
+	Unlock *UnlockOptions
+}
+
+// SelfTestReport is the result of SelfTest
+type SelfTestReport struct {
+	Device string
+
+	// Validation holds the header and metadata checks of Validate
+	Validation *ValidationReport
+
+	// Problems lists findings about the volume key, segments and data
+	Problems []Problem
+
+	// BytesRead is how much data was decrypted
+	BytesRead int64
+
+	// Filesystem is the filesystem found in the decrypted data ("" = none
+	// recognized, or detection is not available on this platform)
+	Filesystem string
+}
+
+// OK reports whether neither the metadata checks nor the self-test found an
+// error (warnings are allowed)
+func (r *SelfTestReport) OK() bool {
+	if r.Validation != nil && !r.Validation.OK() {
+		return false
+	}
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// add records a problem
+func (r *SelfTestReport) add(severity ProblemSeverity, object, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Severity: severity, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+// SelfTest checks that a volume would open and mount, without device-mapper
+// or root: it validates the metadata, recovers the volume key with
+// passphrase, recomputes the key digest, sets up the data segments,
+// decrypts the first sectors, looking for a filesystem, and reads the last
+// sector, which fails for truncated images. It is a cheap health
+// check for verifying backups and images.
+//
+// An error is returned when the header cannot be read or the passphrase
+// opens no keyslot; everything else is reported in the SelfTestReport.
+func SelfTest(device string, passphrase []byte) (*SelfTestReport, error) {
+	return SelfTestWithOptions(device, passphrase, nil)
+}
+
+// SelfTestWithOptions is SelfTest with options (nil = defaults)
+func SelfTestWithOptions(device string, passphrase []byte, opts *SelfTestOptions) (*SelfTestReport, error) {
+	if opts == nil {
+		opts = &SelfTestOptions{}
+	}
+	unlockOpts := opts.Unlock
+	if unlockOpts == nil {
+		unlockOpts = &UnlockOptions{}
+	}
+	sectors := opts.Sectors
+	if sectors <= 0 {
+		sectors = DefaultSelfTestSectors
+	}
+
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	validation, err := Validate(device)
+	if err != nil {
+		return nil, err
+	}
+	report := &SelfTestReport{Device: device, Validation: validation}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		// Validate found the reason; the volume would not open
+		report.add(SeverityError, "header", "%v", err)
+		return report, nil
+	}
+
+	masterKey, _, err := getMasterKeyWithOptions(device, passphrase, metadata, unlockOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock any keyslot: %w", err)
+	}
+	defer masterKey.Destroy()
+
+	// Recompute the digest from the recovered key
+	if err := verifyVolumeKey(masterKey.Bytes(), metadata); err != nil {
+		report.add(SeverityError, "volume key", "%v", err)
+		return report, nil
+	}
+
+	v, err := newVolume(device, metadata, masterKey.Bytes(), &VolumeOptions{})
+	if errors.Is(err, ErrUnsupportedCipher) {
+		report.add(SeverityWarning, "data", "%v; the data cannot be checked in userspace", err)
+		return report, nil
+	}
+	if err != nil {
+		report.add(SeverityError, "segments", "%v", err)
+		return report, nil
+	}
+	defer func() { _ = v.Close() }()
+
+	selfTestData(report, v, sectors)
+	return report, nil
+}
+
+// selfTestData decrypts the start of the volume and looks for a filesystem
+func selfTestData(r *SelfTestReport, v *Volume, sectors int) {
+	sectorSize := int64(LUKS2SectorSize)
+	if ext := v.extents[0]; ext.cipher != nil {
+		sectorSize = ext.sectorSize
+	}
+	n := min(max(int64(sectors)*sectorSize, selfTestMinBytes), v.Size())
+	if n == 0 {
+		r.add(SeverityError, "data", "the data segments are empty")
+		return
+	}
+
+	buf := make([]byte, n)
+	read, err := v.ReadAt(buf, 0)
+	r.BytesRead = int64(read)
+	if err != nil && err != io.EOF {
+		r.add(SeverityError, "data", "failed to read the first %d bytes: %v", n, err)
+		return
+	}
+	buf = buf[:read]
+
+	// A truncated image or shrunken device ends before the segments do
+	last := make([]byte, sectorSize)
+	if off := v.Size() - sectorSize; off > 0 {
+		if _, err := v.ReadAt(last, off); err != nil {
+			r.add(SeverityError, "data", "failed to read the last sector at %d: %v; the device is smaller than its segments", off, err)
+		}
+	}
+
+	fs, probed := probeFilesystem(buf)
+	switch {
+	case fs != "":
+		r.Filesystem = fs
+	case !probed:
+		// Nothing to say without filesystem detection
+	case allZero(buf):
+		r.add(SeverityWarning, "data", "the first %d bytes decrypt to zeros; no filesystem was created", read)
+	case looksRandom(buf):
+		r.add(SeverityWarning, "data", "the first %d bytes decrypt to random-looking data; the volume was never written or was overwritten", read)
+	default:
+		r.add(SeverityWarning, "data", "no known filesystem signature in the first %d bytes", read)
+	}
+}
+
+// allZero reports whether buf holds only zero bytes
+func allZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// looksRandom reports whether the byte distribution of buf is as flat as
+// that of ciphertext or of plaintext decrypted with the wrong key, using a
+// chi-square test. Filesystem metadata is far from uniform.
+func looksRandom(buf []byte) bool {
+	if len(buf) < selfTestMinBytes {
+		return false
+	}
+	var counts [256]int
+	for _, b := range buf {
+		counts[b]++
+	}
+	expected := float64(len(buf)) / 256
+	chi2 := 0.0
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi2 += d * d / expected
+	}
+	// 255 degrees of freedom: mean 255, standard deviation about 22.6
+	return chi2 < 400
+}
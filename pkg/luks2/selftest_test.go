@@ -0,0 +1,119 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// hasSelfTestProblem reports whether the self-test found a problem in object
+// whose message contains substr
+func hasSelfTestProblem(r *SelfTestReport, severity ProblemSeverity, object, substr string) bool {
+	for _, p := range r.Problems {
+		if p.Severity == severity && p.Object == object && strings.Contains(p.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeVolumeData encrypts data into the start of the volume
+func writeVolumeData(t *testing.T, device string, passphrase, data []byte) {
+	t.Helper()
+	vol, err := OpenVolume(device, passphrase, &VolumeOptions{Writable: true})
+	if err != nil {
+		t.Fatalf("OpenVolume failed: %v", err)
+	}
+	defer func() { _ = vol.Close() }()
+	if _, err := vol.WriteAt(data, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+
+	// A fresh image decrypts to noise
+	report, err := SelfTest(device, passphrase)
+	if err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if !report.OK() || report.Filesystem != "" || !hasSelfTestProblem(report, SeverityWarning, "data", "random-looking") {
+		t.Errorf("unexpected report for a fresh volume: %+v", report)
+	}
+	if report.BytesRead != DefaultSelfTestSectors*512 {
+		t.Errorf("BytesRead = %d, want %d", report.BytesRead, DefaultSelfTestSectors*512)
+	}
+
+	data := make([]byte, 8192)
+	writeVolumeData(t, device, passphrase, data)
+	report, err = SelfTest(device, passphrase)
+	if err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if !hasSelfTestProblem(report, SeverityWarning, "data", "zeros") {
+		t.Errorf("expected the zeroed data to be reported, got %v", report.Problems)
+	}
+
+	copy(data, xfsMagic)
+	writeVolumeData(t, device, passphrase, data)
+	report, err = SelfTestWithOptions(device, passphrase, &SelfTestOptions{Sectors: 1})
+	if err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if !report.OK() || report.Filesystem != string(FilesystemXFS) || len(report.Problems) != 0 {
+		t.Errorf("expected a clean report with xfs, got %+v", report)
+	}
+	if report.BytesRead != selfTestMinBytes {
+		t.Errorf("BytesRead = %d, want at least %d", report.BytesRead, selfTestMinBytes)
+	}
+}
+
+func TestSelfTest_WrongPassphrase(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	if _, err := SelfTest(device, []byte("wrong-password")); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("expected ErrInvalidPassphrase, got %v", err)
+	}
+}
+
+func TestSelfTest_Problems(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(m *LUKS2Metadata)
+		severity ProblemSeverity
+		object   string
+		substr   string
+	}{
+		{"unsupported cipher", func(m *LUKS2Metadata) { m.Segments["0"].Encryption = "serpent-xts-plain64" }, SeverityWarning, "data", "cannot be checked"},
+		{"segment past device end", func(m *LUKS2Metadata) { m.Segments["0"].Size = "1073741824" }, SeverityError, "data", "last sector"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password")
+			device := formatTestVolume(t, passphrase)
+			hdr, metadata, err := ReadHeader(device)
+			if err != nil {
+				t.Fatalf("ReadHeader failed: %v", err)
+			}
+			tt.modify(metadata)
+			if err := WriteHeader(device, hdr, metadata); err != nil {
+				t.Fatalf("WriteHeader failed: %v", err)
+			}
+
+			report, err := SelfTest(device, passphrase)
+			if err != nil {
+				t.Fatalf("SelfTest failed: %v", err)
+			}
+			if !hasSelfTestProblem(report, tt.severity, tt.object, tt.substr) {
+				t.Errorf("expected %s %s problem containing %q, got %v", tt.severity, tt.object, tt.substr, report.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/server/luks2pb"
+)
+
+// newGRPCServer returns the gRPC form of the API. It is served through
+// ServeHTTP, so requests arrive already authenticated.
+func (s *Server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(grpc.MaxRecvMsgSize(maxBodySize))
+	luks2pb.RegisterVolumeServiceServer(g, &grpcService{s: s})
+	return g
+}
+
+// isGRPC reports whether r is a gRPC call
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// writeGRPCError answers a gRPC call that never reaches the gRPC server
+// with a trailers-only response
+func writeGRPCError(w http.ResponseWriter, code codes.Code, err error) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	w.Header().Set("Grpc-Message", err.Error())
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcService implements luks2pb.VolumeServiceServer with the Backend of a
+// Server. Each method checks its request like the matching HTTP handler.
+type grpcService struct {
+	luks2pb.UnimplementedVolumeServiceServer
+	s *Server
+}
+
+// fail logs an operation error and converts it to a gRPC status
+func (g *grpcService) fail(method string, err error) error {
+	g.s.logf("gRPC %s failed: %v", method, err)
+	return status.Error(grpcCode(err), err.Error())
+}
+
+// grpcCode maps library errors to gRPC codes, following statusCode
+func grpcCode(err error) codes.Code {
+	switch statusCode(err) {
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// invalid returns an InvalidArgument status for a malformed request
+func invalid(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+func (g *grpcService) Format(_ context.Context, req *luks2pb.FormatRequest) (*luks2pb.FormatResponse, error) {
+	defer clear(req.Passphrase)
+	if req.Device == "" || len(req.Passphrase) == 0 {
+		return nil, invalid(errMissingFields)
+	}
+
+	err := g.s.cfg.Backend.Format(luks2.FormatOptions{
+		Device:     req.Device,
+		Passphrase: req.Passphrase,
+		Label:      req.Label,
+		Subsystem:  req.Subsystem,
+		Cipher:     req.Cipher,
+		CipherMode: req.CipherMode,
+		KeySize:    int(req.KeySize),
+		KDFType:    req.KdfType,
+		SectorSize: int(req.SectorSize),
+		Force:      req.Force,
+	})
+	if err != nil {
+		return nil, g.fail("Format", err)
+	}
+	return &luks2pb.FormatResponse{}, nil
+}
+
+func (g *grpcService) Unlock(_ context.Context, req *luks2pb.UnlockRequest) (*luks2pb.UnlockResponse, error) {
+	defer clear(req.Passphrase)
+	if req.Device == "" || req.Name == "" || len(req.Passphrase) == 0 {
+		return nil, invalid(errors.New("device, name and passphrase are required"))
+	}
+
+	err := g.s.cfg.Backend.UnlockWithOptions(req.Device, req.Passphrase, req.Name, &luks2.UnlockOptions{
+		Keyslot:       optionalInt(req.Keyslot),
+		AllowDiscards: req.AllowDiscards,
+	})
+	if err != nil {
+		return nil, g.fail("Unlock", err)
+	}
+	return &luks2pb.UnlockResponse{}, nil
+}
+
+func (g *grpcService) Lock(_ context.Context, req *luks2pb.LockRequest) (*luks2pb.LockResponse, error) {
+	if req.Name == "" {
+		return nil, invalid(errors.New("name is required"))
+	}
+	if err := g.s.cfg.Backend.Lock(req.Name); err != nil {
+		return nil, g.fail("Lock", err)
+	}
+	return &luks2pb.LockResponse{}, nil
+}
+
+func (g *grpcService) GetVolumeInfo(_ context.Context, req *luks2pb.GetVolumeInfoRequest) (*luks2pb.VolumeInfo, error) {
+	if req.Device == "" {
+		return nil, invalid(errors.New("device is required"))
+	}
+
+	info, err := g.s.cfg.Backend.GetVolumeInfo(req.Device)
+	if err != nil {
+		return nil, g.fail("GetVolumeInfo", err)
+	}
+	resp := &luks2pb.VolumeInfo{
+		Uuid:       info.UUID,
+		Label:      info.Label,
+		Version:    int32(info.Version), // #nosec G115 -- header version
+		Cipher:     info.Cipher,
+		KeySize:    int32(info.KeySize),    // #nosec G115 -- key size in bytes
+		SectorSize: int32(info.SectorSize), // #nosec G115 -- sector size
+	}
+	for _, slot := range info.ActiveKeyslots {
+		resp.ActiveKeyslots = append(resp.ActiveKeyslots, int32(slot)) // #nosec G115 -- keyslot number
+	}
+	return resp, nil
+}
+
+func (g *grpcService) GetMappingStatus(_ context.Context, req *luks2pb.GetMappingStatusRequest) (*luks2pb.MappingStatus, error) {
+	if req.Name == "" {
+		return nil, invalid(errors.New("name is required"))
+	}
+
+	st, err := g.s.cfg.Backend.Status(req.Name)
+	if err != nil {
+		return nil, g.fail("GetMappingStatus", err)
+	}
+	return &luks2pb.MappingStatus{
+		Name:           st.Name,
+		Uuid:           st.UUID,
+		Type:           st.Type,
+		Cipher:         st.Cipher,
+		KeySize:        int32(st.KeySize), // #nosec G115 -- key size in bits
+		KeyLocation:    st.KeyLocation,
+		Device:         st.Device,
+		Offset:         st.Offset,
+		IvOffset:       st.IVOffset,
+		Size:           st.Size,
+		SectorSize:     int32(st.SectorSize), // #nosec G115 -- sector size
+		Flags:          st.Flags,
+		ReadOnly:       st.ReadOnly,
+		Suspended:      st.Suspended,
+		DeferredRemove: st.DeferredRemove,
+		OpenCount:      int32(st.OpenCount), // #nosec G115 -- open count
+	}, nil
+}
+
+func (g *grpcService) ListKeyslots(_ context.Context, req *luks2pb.ListKeyslotsRequest) (*luks2pb.ListKeyslotsResponse, error) {
+	if req.Device == "" {
+		return nil, invalid(errors.New("device is required"))
+	}
+
+	slots, err := g.s.cfg.Backend.ListKeyslots(req.Device)
+	if err != nil {
+		return nil, g.fail("ListKeyslots", err)
+	}
+	resp := &luks2pb.ListKeyslotsResponse{}
+	for _, ks := range slots {
+		resp.Keyslots = append(resp.Keyslots, keyslotMessage(ks))
+	}
+	return resp, nil
+}
+
+// keyslotMessage converts a KeyslotInfo to its protobuf message
+func keyslotMessage(ks luks2.KeyslotInfo) *luks2pb.Keyslot {
+	// #nosec G115 -- keyslot fields are small header values
+	msg := &luks2pb.Keyslot{
+		Id:            int32(ks.ID),
+		Type:          ks.Type,
+		KeySize:       int32(ks.KeySize),
+		Priority:      int32(ks.Priority),
+		KdfType:       ks.KDFType,
+		Encryption:    ks.Encryption,
+		KdfHash:       ks.KDFHash,
+		KdfIterations: int32(ks.KDFIterations),
+		KdfTime:       int32(ks.KDFTime),
+		KdfMemory:     int32(ks.KDFMemory),
+		KdfCpus:       int32(ks.KDFCPUs),
+		AfStripes:     int32(ks.AFStripes),
+		AfHash:        ks.AFHash,
+		AreaKeySize:   int32(ks.AreaKeySize),
+	}
+	if ann := ks.Annotation; ann != nil {
+		msg.Annotation = &luks2pb.KeyslotAnnotation{
+			Label:       ann.Label,
+			Owner:       ann.Owner,
+			Description: ann.Description,
+		}
+		if !ann.CreatedAt.IsZero() {
+			msg.Annotation.CreatedAt = timestamppb.New(ann.CreatedAt)
+		}
+	}
+	return msg
+}
+
+func (g *grpcService) AddKey(_ context.Context, req *luks2pb.AddKeyRequest) (*luks2pb.AddKeyResponse, error) {
+	defer clear(req.Passphrase)
+	defer clear(req.NewPassphrase)
+	if err := checkKeyRequest(req.Device, req.Passphrase, req.NewPassphrase, true); err != nil {
+		return nil, err
+	}
+
+	if err := g.s.cfg.Backend.AddKey(req.Device, req.Passphrase, req.NewPassphrase, &luks2.AddKeyOptions{Keyslot: optionalInt(req.Keyslot)}); err != nil {
+		return nil, g.fail("AddKey", err)
+	}
+	return &luks2pb.AddKeyResponse{}, nil
+}
+
+func (g *grpcService) RemoveKey(_ context.Context, req *luks2pb.RemoveKeyRequest) (*luks2pb.RemoveKeyResponse, error) {
+	defer clear(req.Passphrase)
+	if err := checkKeyRequest(req.Device, req.Passphrase, nil, false); err != nil {
+		return nil, err
+	}
+
+	if err := g.s.cfg.Backend.RemoveKey(req.Device, req.Passphrase, int(req.Keyslot)); err != nil {
+		return nil, g.fail("RemoveKey", err)
+	}
+	return &luks2pb.RemoveKeyResponse{}, nil
+}
+
+func (g *grpcService) ChangeKey(_ context.Context, req *luks2pb.ChangeKeyRequest) (*luks2pb.ChangeKeyResponse, error) {
+	defer clear(req.Passphrase)
+	defer clear(req.NewPassphrase)
+	if err := checkKeyRequest(req.Device, req.Passphrase, req.NewPassphrase, true); err != nil {
+		return nil, err
+	}
+
+	if err := g.s.cfg.Backend.ChangeKey(req.Device, req.Passphrase, req.NewPassphrase, int(req.Keyslot)); err != nil {
+		return nil, g.fail("ChangeKey", err)
+	}
+	return &luks2pb.ChangeKeyResponse{}, nil
+}
+
+// checkKeyRequest checks the fields the keyslot RPCs share, like
+// decodeKeyRequest
+func checkKeyRequest(device string, passphrase, newPassphrase []byte, needNew bool) error {
+	switch {
+	case device == "" || len(passphrase) == 0:
+		return invalid(errMissingFields)
+	case needNew && len(newPassphrase) == 0:
+		return invalid(errors.New("new_passphrase is required"))
+	}
+	return nil
+}
+
+// optionalInt converts an optional protobuf int32 to an *int
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	n := int(*v)
+	return &n
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/server/luks2pb"
+)
+
+// newGRPCTestClient returns a gRPC client for an HTTP/2 test server backed
+// by a fakeBackend
+func newGRPCTestClient(t *testing.T) (luks2pb.VolumeServiceClient, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{}
+	s, err := New(Config{Tokens: []string{testToken}, Backend: backend})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(s)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	conn, err := grpc.NewClient(strings.TrimPrefix(ts.URL, "https://"),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})))
+	if err != nil {
+		t.Fatalf("grpc.NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return luks2pb.NewVolumeServiceClient(conn), backend
+}
+
+// authed returns a context carrying the test token
+func authed(t *testing.T, token string) context.Context {
+	return metadata.AppendToOutgoingContext(t.Context(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC_Authentication(t *testing.T) {
+	client, backend := newGRPCTestClient(t)
+
+	for _, ctx := range []context.Context{t.Context(), authed(t, "wrong")} {
+		_, err := client.Lock(ctx, &luks2pb.LockRequest{Name: "data"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Lock: %v, want Unauthenticated", err)
+		}
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Unauthenticated calls reached the backend: %v", backend.calls)
+	}
+}
+
+func TestGRPC_VolumeService(t *testing.T) {
+	client, backend := newGRPCTestClient(t)
+	ctx := authed(t, testToken)
+
+	if _, err := client.Format(ctx, &luks2pb.FormatRequest{Device: "/dev/sdb1", Passphrase: []byte("pw"), Label: "data", KeySize: 512}); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if backend.format.Label != "data" || backend.format.KeySize != 512 {
+		t.Errorf("Format options = %+v", backend.format)
+	}
+
+	slot := int32(1)
+	if _, err := client.Unlock(ctx, &luks2pb.UnlockRequest{Device: "/dev/sdb1", Passphrase: []byte("pw"), Name: "data", Keyslot: &slot, AllowDiscards: true}); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if backend.unlock == nil || backend.unlock.Keyslot == nil || *backend.unlock.Keyslot != 1 || !backend.unlock.AllowDiscards {
+		t.Errorf("Unlock options = %+v", backend.unlock)
+	}
+
+	info, err := client.GetVolumeInfo(ctx, &luks2pb.GetVolumeInfoRequest{Device: "/dev/sdb1"})
+	if err != nil {
+		t.Fatalf("GetVolumeInfo: %v", err)
+	}
+	if info.Uuid != "1234" || len(info.ActiveKeyslots) != 2 {
+		t.Errorf("GetVolumeInfo = %v", info)
+	}
+
+	st, err := client.GetMappingStatus(ctx, &luks2pb.GetMappingStatusRequest{Name: "data"})
+	if err != nil {
+		t.Fatalf("GetMappingStatus: %v", err)
+	}
+	if st.KeySize != 512 {
+		t.Errorf("GetMappingStatus key size = %d, want 512", st.KeySize)
+	}
+
+	list, err := client.ListKeyslots(ctx, &luks2pb.ListKeyslotsRequest{Device: "/dev/sdb1"})
+	if err != nil {
+		t.Fatalf("ListKeyslots: %v", err)
+	}
+	if len(list.Keyslots) != 1 || list.Keyslots[0].KdfType != "argon2id" {
+		t.Errorf("ListKeyslots = %v", list)
+	}
+
+	if _, err := client.AddKey(ctx, &luks2pb.AddKeyRequest{Device: "/dev/sdb1", Passphrase: []byte("pw"), NewPassphrase: []byte("new")}); err != nil {
+		t.Errorf("AddKey: %v", err)
+	}
+	if _, err := client.ChangeKey(ctx, &luks2pb.ChangeKeyRequest{Device: "/dev/sdb1", Passphrase: []byte("pw"), NewPassphrase: []byte("new"), Keyslot: 2}); err != nil {
+		t.Errorf("ChangeKey: %v", err)
+	}
+	if _, err := client.RemoveKey(ctx, &luks2pb.RemoveKeyRequest{Device: "/dev/sdb1", Passphrase: []byte("pw"), Keyslot: 1}); err != nil {
+		t.Errorf("RemoveKey: %v", err)
+	}
+	if _, err := client.Lock(ctx, &luks2pb.LockRequest{Name: "data"}); err != nil {
+		t.Errorf("Lock: %v", err)
+	}
+
+	want := []string{"format /dev/sdb1", "unlock /dev/sdb1 data", "addkey /dev/sdb1", "changekey /dev/sdb1 2", "removekey /dev/sdb1 1", "lock data"}
+	if fmt.Sprint(backend.calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v", backend.calls, want)
+	}
+}
+
+func TestGRPC_Errors(t *testing.T) {
+	client, backend := newGRPCTestClient(t)
+	ctx := authed(t, testToken)
+
+	if _, err := client.Unlock(ctx, &luks2pb.UnlockRequest{Device: "/dev/sdb1", Name: "data", Passphrase: []byte("wrong-passphrase")}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unlock with wrong passphrase: %v, want InvalidArgument", err)
+	}
+	if _, err := client.GetVolumeInfo(ctx, &luks2pb.GetVolumeInfoRequest{Device: "/dev/missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetVolumeInfo of missing device: %v, want NotFound", err)
+	}
+
+	backend.calls = nil
+	if _, err := client.Format(ctx, &luks2pb.FormatRequest{Device: "/dev/sdb1"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Format without passphrase: %v, want InvalidArgument", err)
+	}
+	if _, err := client.AddKey(ctx, &luks2pb.AddKeyRequest{Device: "/dev/sdb1", Passphrase: []byte("pw")}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddKey without new passphrase: %v, want InvalidArgument", err)
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Bad requests reached the backend: %v", backend.calls)
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{luks2.ErrPermissionDenied, codes.PermissionDenied},
+		{fmt.Errorf("wrapped: %w", luks2.ErrVolumeAlreadyUnlocked), codes.FailedPrecondition},
+		{&luks2.WeakPassphraseError{Reasons: []string{"too short"}}, codes.InvalidArgument},
+		{luks2.ErrInsufficientMemory, codes.Unavailable},
+		{errors.New("device-mapper failure"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := grpcCode(tt.err); got != tt.want {
+			t.Errorf("grpcCode(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
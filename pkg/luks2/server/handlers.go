@@ -0,0 +1,255 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// FormatRequest is the body of POST /v1/volumes/format
+type FormatRequest struct {
+	Device     string `json:"device"`
+	Passphrase []byte `json:"passphrase"`
+	Label      string `json:"label,omitempty"`
+	Subsystem  string `json:"subsystem,omitempty"`
+	Cipher     string `json:"cipher,omitempty"`
+	CipherMode string `json:"cipher_mode,omitempty"`
+	KeySize    int    `json:"key_size,omitempty"` // Bits
+	KDFType    string `json:"kdf_type,omitempty"`
+	SectorSize int    `json:"sector_size,omitempty"`
+	Force      bool   `json:"force,omitempty"` // Format over an existing LUKS header
+}
+
+// UnlockRequest is the body of POST /v1/volumes/unlock
+type UnlockRequest struct {
+	Device        string `json:"device"`
+	Passphrase    []byte `json:"passphrase"`
+	Name          string `json:"name"`
+	Keyslot       *int   `json:"keyslot,omitempty"`
+	AllowDiscards bool   `json:"allow_discards,omitempty"`
+}
+
+// LockRequest is the body of POST /v1/volumes/lock
+type LockRequest struct {
+	Name string `json:"name"`
+}
+
+// KeyRequest is the body of the POST /v1/keyslots/* endpoints. Passphrase
+// authorizes the change; NewPassphrase is required by add and change.
+type KeyRequest struct {
+	Device        string `json:"device"`
+	Passphrase    []byte `json:"passphrase"`
+	NewPassphrase []byte `json:"new_passphrase,omitempty"`
+	Keyslot       *int   `json:"keyslot,omitempty"`
+}
+
+// VolumeInfoResponse is the body returned by GET /v1/volumes/info
+type VolumeInfoResponse struct {
+	UUID           string `json:"uuid"`
+	Label          string `json:"label"`
+	Version        int    `json:"version"`
+	Cipher         string `json:"cipher"`
+	KeySize        int    `json:"key_size"` // Bytes, as in luks2.VolumeInfo
+	SectorSize     int    `json:"sector_size"`
+	ActiveKeyslots []int  `json:"active_keyslots"`
+}
+
+// okResponse is the body of a successful mutating request
+type okResponse struct {
+	OK bool `json:"ok"`
+}
+
+var errMissingFields = errors.New("device and passphrase are required")
+
+func (s *Server) handleFormat(w http.ResponseWriter, r *http.Request) {
+	var req FormatRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	defer clear(req.Passphrase)
+
+	if req.Device == "" || len(req.Passphrase) == 0 {
+		writeError(w, http.StatusBadRequest, errMissingFields)
+		return
+	}
+
+	err := s.cfg.Backend.Format(luks2.FormatOptions{
+		Device:     req.Device,
+		Passphrase: req.Passphrase,
+		Label:      req.Label,
+		Subsystem:  req.Subsystem,
+		Cipher:     req.Cipher,
+		CipherMode: req.CipherMode,
+		KeySize:    req.KeySize,
+		KDFType:    req.KDFType,
+		SectorSize: req.SectorSize,
+		Force:      req.Force,
+	})
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, okResponse{OK: true})
+}
+
+func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	var req UnlockRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	defer clear(req.Passphrase)
+
+	if req.Device == "" || req.Name == "" || len(req.Passphrase) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("device, name and passphrase are required"))
+		return
+	}
+
+	err := s.cfg.Backend.UnlockWithOptions(req.Device, req.Passphrase, req.Name, &luks2.UnlockOptions{
+		Keyslot:       req.Keyslot,
+		AllowDiscards: req.AllowDiscards,
+	})
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, okResponse{OK: true})
+}
+
+func (s *Server) handleLock(w http.ResponseWriter, r *http.Request) {
+	var req LockRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+
+	if err := s.cfg.Backend.Lock(req.Name); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, okResponse{OK: true})
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		writeError(w, http.StatusBadRequest, errors.New("device is required"))
+		return
+	}
+
+	info, err := s.cfg.Backend.GetVolumeInfo(device)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, VolumeInfoResponse{
+		UUID:           info.UUID,
+		Label:          info.Label,
+		Version:        info.Version,
+		Cipher:         info.Cipher,
+		KeySize:        info.KeySize,
+		SectorSize:     info.SectorSize,
+		ActiveKeyslots: info.ActiveKeyslots,
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.cfg.Backend.Status(r.PathValue("name"))
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleListKeyslots(w http.ResponseWriter, r *http.Request) {
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		writeError(w, http.StatusBadRequest, errors.New("device is required"))
+		return
+	}
+
+	slots, err := s.cfg.Backend.ListKeyslots(device)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, slots)
+}
+
+// decodeKeyRequest reads a KeyRequest and checks its common fields. The
+// caller must clear the passphrases.
+func decodeKeyRequest(w http.ResponseWriter, r *http.Request, needNew, needSlot bool) (*KeyRequest, bool) {
+	var req KeyRequest
+	if !decode(w, r, &req) {
+		return nil, false
+	}
+
+	switch {
+	case req.Device == "" || len(req.Passphrase) == 0:
+		writeError(w, http.StatusBadRequest, errMissingFields)
+	case needNew && len(req.NewPassphrase) == 0:
+		writeError(w, http.StatusBadRequest, errors.New("new_passphrase is required"))
+	case needSlot && req.Keyslot == nil:
+		writeError(w, http.StatusBadRequest, errors.New("keyslot is required"))
+	default:
+		return &req, true
+	}
+
+	clear(req.Passphrase)
+	clear(req.NewPassphrase)
+	return nil, false
+}
+
+func (s *Server) handleAddKey(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeyRequest(w, r, true, false)
+	if !ok {
+		return
+	}
+	defer clear(req.Passphrase)
+	defer clear(req.NewPassphrase)
+
+	if err := s.cfg.Backend.AddKey(req.Device, req.Passphrase, req.NewPassphrase, &luks2.AddKeyOptions{Keyslot: req.Keyslot}); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, okResponse{OK: true})
+}
+
+func (s *Server) handleRemoveKey(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeyRequest(w, r, false, true)
+	if !ok {
+		return
+	}
+	defer clear(req.Passphrase)
+
+	if err := s.cfg.Backend.RemoveKey(req.Device, req.Passphrase, *req.Keyslot); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, okResponse{OK: true})
+}
+
+func (s *Server) handleChangeKey(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeyRequest(w, r, true, true)
+	if !ok {
+		return
+	}
+	defer clear(req.Passphrase)
+	defer clear(req.NewPassphrase)
+
+	if err := s.cfg.Backend.ChangeKey(req.Device, req.Passphrase, req.NewPassphrase, *req.Keyslot); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, okResponse{OK: true})
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package luks2pb holds the protobuf messages and the gRPC service of the
+// management API that package server serves next to its HTTPS/JSON
+// endpoints. Clients import it to call the API over gRPC.
+package luks2pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative volume.proto
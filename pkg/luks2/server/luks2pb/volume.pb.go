@@ -0,0 +1,1566 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: volume.proto
+
+// The gRPC form of the management API of package server. Every RPC maps to
+// one HTTPS/JSON endpoint and behaves the same way; both are served on the
+// same listener and authenticated with the same bearer tokens, sent as
+// "authorization: Bearer <token>" metadata.
+
+package luks2pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FormatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Passphrase    []byte                 `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	Label         string                 `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+	Subsystem     string                 `protobuf:"bytes,4,opt,name=subsystem,proto3" json:"subsystem,omitempty"`
+	Cipher        string                 `protobuf:"bytes,5,opt,name=cipher,proto3" json:"cipher,omitempty"`
+	CipherMode    string                 `protobuf:"bytes,6,opt,name=cipher_mode,json=cipherMode,proto3" json:"cipher_mode,omitempty"`
+	KeySize       int32                  `protobuf:"varint,7,opt,name=key_size,json=keySize,proto3" json:"key_size,omitempty"` // Bits
+	KdfType       string                 `protobuf:"bytes,8,opt,name=kdf_type,json=kdfType,proto3" json:"kdf_type,omitempty"`
+	SectorSize    int32                  `protobuf:"varint,9,opt,name=sector_size,json=sectorSize,proto3" json:"sector_size,omitempty"`
+	Force         bool                   `protobuf:"varint,10,opt,name=force,proto3" json:"force,omitempty"` // Format over an existing LUKS header
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FormatRequest) Reset() {
+	*x = FormatRequest{}
+	mi := &file_volume_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FormatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FormatRequest) ProtoMessage() {}
+
+func (x *FormatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FormatRequest.ProtoReflect.Descriptor instead.
+func (*FormatRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FormatRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetPassphrase() []byte {
+	if x != nil {
+		return x.Passphrase
+	}
+	return nil
+}
+
+func (x *FormatRequest) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetSubsystem() string {
+	if x != nil {
+		return x.Subsystem
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetCipher() string {
+	if x != nil {
+		return x.Cipher
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetCipherMode() string {
+	if x != nil {
+		return x.CipherMode
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetKeySize() int32 {
+	if x != nil {
+		return x.KeySize
+	}
+	return 0
+}
+
+func (x *FormatRequest) GetKdfType() string {
+	if x != nil {
+		return x.KdfType
+	}
+	return ""
+}
+
+func (x *FormatRequest) GetSectorSize() int32 {
+	if x != nil {
+		return x.SectorSize
+	}
+	return 0
+}
+
+func (x *FormatRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+type FormatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FormatResponse) Reset() {
+	*x = FormatResponse{}
+	mi := &file_volume_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FormatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FormatResponse) ProtoMessage() {}
+
+func (x *FormatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FormatResponse.ProtoReflect.Descriptor instead.
+func (*FormatResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{1}
+}
+
+type UnlockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Passphrase    []byte                 `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Keyslot       *int32                 `protobuf:"varint,4,opt,name=keyslot,proto3,oneof" json:"keyslot,omitempty"` // Try only this keyslot
+	AllowDiscards bool                   `protobuf:"varint,5,opt,name=allow_discards,json=allowDiscards,proto3" json:"allow_discards,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnlockRequest) Reset() {
+	*x = UnlockRequest{}
+	mi := &file_volume_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnlockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnlockRequest) ProtoMessage() {}
+
+func (x *UnlockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnlockRequest.ProtoReflect.Descriptor instead.
+func (*UnlockRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UnlockRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *UnlockRequest) GetPassphrase() []byte {
+	if x != nil {
+		return x.Passphrase
+	}
+	return nil
+}
+
+func (x *UnlockRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UnlockRequest) GetKeyslot() int32 {
+	if x != nil && x.Keyslot != nil {
+		return *x.Keyslot
+	}
+	return 0
+}
+
+func (x *UnlockRequest) GetAllowDiscards() bool {
+	if x != nil {
+		return x.AllowDiscards
+	}
+	return false
+}
+
+type UnlockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnlockResponse) Reset() {
+	*x = UnlockResponse{}
+	mi := &file_volume_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnlockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnlockResponse) ProtoMessage() {}
+
+func (x *UnlockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnlockResponse.ProtoReflect.Descriptor instead.
+func (*UnlockResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{3}
+}
+
+type LockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockRequest) Reset() {
+	*x = LockRequest{}
+	mi := &file_volume_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockRequest) ProtoMessage() {}
+
+func (x *LockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockRequest.ProtoReflect.Descriptor instead.
+func (*LockRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LockRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type LockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockResponse) Reset() {
+	*x = LockResponse{}
+	mi := &file_volume_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockResponse) ProtoMessage() {}
+
+func (x *LockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockResponse.ProtoReflect.Descriptor instead.
+func (*LockResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{5}
+}
+
+type GetVolumeInfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetVolumeInfoRequest) Reset() {
+	*x = GetVolumeInfoRequest{}
+	mi := &file_volume_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetVolumeInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetVolumeInfoRequest) ProtoMessage() {}
+
+func (x *GetVolumeInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetVolumeInfoRequest.ProtoReflect.Descriptor instead.
+func (*GetVolumeInfoRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetVolumeInfoRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+type VolumeInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Uuid           string                 `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Label          string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Version        int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Cipher         string                 `protobuf:"bytes,4,opt,name=cipher,proto3" json:"cipher,omitempty"`
+	KeySize        int32                  `protobuf:"varint,5,opt,name=key_size,json=keySize,proto3" json:"key_size,omitempty"` // Bytes, as in luks2.VolumeInfo
+	SectorSize     int32                  `protobuf:"varint,6,opt,name=sector_size,json=sectorSize,proto3" json:"sector_size,omitempty"`
+	ActiveKeyslots []int32                `protobuf:"varint,7,rep,packed,name=active_keyslots,json=activeKeyslots,proto3" json:"active_keyslots,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *VolumeInfo) Reset() {
+	*x = VolumeInfo{}
+	mi := &file_volume_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VolumeInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VolumeInfo) ProtoMessage() {}
+
+func (x *VolumeInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VolumeInfo.ProtoReflect.Descriptor instead.
+func (*VolumeInfo) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *VolumeInfo) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *VolumeInfo) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *VolumeInfo) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *VolumeInfo) GetCipher() string {
+	if x != nil {
+		return x.Cipher
+	}
+	return ""
+}
+
+func (x *VolumeInfo) GetKeySize() int32 {
+	if x != nil {
+		return x.KeySize
+	}
+	return 0
+}
+
+func (x *VolumeInfo) GetSectorSize() int32 {
+	if x != nil {
+		return x.SectorSize
+	}
+	return 0
+}
+
+func (x *VolumeInfo) GetActiveKeyslots() []int32 {
+	if x != nil {
+		return x.ActiveKeyslots
+	}
+	return nil
+}
+
+type GetMappingStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMappingStatusRequest) Reset() {
+	*x = GetMappingStatusRequest{}
+	mi := &file_volume_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMappingStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMappingStatusRequest) ProtoMessage() {}
+
+func (x *GetMappingStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMappingStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetMappingStatusRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetMappingStatusRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type MappingStatus struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Name           string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Uuid           string                 `protobuf:"bytes,2,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Type           string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Cipher         string                 `protobuf:"bytes,4,opt,name=cipher,proto3" json:"cipher,omitempty"`
+	KeySize        int32                  `protobuf:"varint,5,opt,name=key_size,json=keySize,proto3" json:"key_size,omitempty"` // Bits
+	KeyLocation    string                 `protobuf:"bytes,6,opt,name=key_location,json=keyLocation,proto3" json:"key_location,omitempty"`
+	Device         string                 `protobuf:"bytes,7,opt,name=device,proto3" json:"device,omitempty"`
+	Offset         uint64                 `protobuf:"varint,8,opt,name=offset,proto3" json:"offset,omitempty"` // 512-byte sectors
+	IvOffset       uint64                 `protobuf:"varint,9,opt,name=iv_offset,json=ivOffset,proto3" json:"iv_offset,omitempty"`
+	Size           uint64                 `protobuf:"varint,10,opt,name=size,proto3" json:"size,omitempty"` // 512-byte sectors
+	SectorSize     int32                  `protobuf:"varint,11,opt,name=sector_size,json=sectorSize,proto3" json:"sector_size,omitempty"`
+	Flags          []string               `protobuf:"bytes,12,rep,name=flags,proto3" json:"flags,omitempty"`
+	ReadOnly       bool                   `protobuf:"varint,13,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	Suspended      bool                   `protobuf:"varint,14,opt,name=suspended,proto3" json:"suspended,omitempty"`
+	DeferredRemove bool                   `protobuf:"varint,15,opt,name=deferred_remove,json=deferredRemove,proto3" json:"deferred_remove,omitempty"`
+	OpenCount      int32                  `protobuf:"varint,16,opt,name=open_count,json=openCount,proto3" json:"open_count,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MappingStatus) Reset() {
+	*x = MappingStatus{}
+	mi := &file_volume_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MappingStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MappingStatus) ProtoMessage() {}
+
+func (x *MappingStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MappingStatus.ProtoReflect.Descriptor instead.
+func (*MappingStatus) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MappingStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetCipher() string {
+	if x != nil {
+		return x.Cipher
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetKeySize() int32 {
+	if x != nil {
+		return x.KeySize
+	}
+	return 0
+}
+
+func (x *MappingStatus) GetKeyLocation() string {
+	if x != nil {
+		return x.KeyLocation
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *MappingStatus) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *MappingStatus) GetIvOffset() uint64 {
+	if x != nil {
+		return x.IvOffset
+	}
+	return 0
+}
+
+func (x *MappingStatus) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *MappingStatus) GetSectorSize() int32 {
+	if x != nil {
+		return x.SectorSize
+	}
+	return 0
+}
+
+func (x *MappingStatus) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+func (x *MappingStatus) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+func (x *MappingStatus) GetSuspended() bool {
+	if x != nil {
+		return x.Suspended
+	}
+	return false
+}
+
+func (x *MappingStatus) GetDeferredRemove() bool {
+	if x != nil {
+		return x.DeferredRemove
+	}
+	return false
+}
+
+func (x *MappingStatus) GetOpenCount() int32 {
+	if x != nil {
+		return x.OpenCount
+	}
+	return 0
+}
+
+type ListKeyslotsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeyslotsRequest) Reset() {
+	*x = ListKeyslotsRequest{}
+	mi := &file_volume_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeyslotsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeyslotsRequest) ProtoMessage() {}
+
+func (x *ListKeyslotsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeyslotsRequest.ProtoReflect.Descriptor instead.
+func (*ListKeyslotsRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListKeyslotsRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+type KeyslotAnnotation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Label         string                 `protobuf:"bytes,1,opt,name=label,proto3" json:"label,omitempty"`
+	Owner         string                 `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // Unset = unknown
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyslotAnnotation) Reset() {
+	*x = KeyslotAnnotation{}
+	mi := &file_volume_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyslotAnnotation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyslotAnnotation) ProtoMessage() {}
+
+func (x *KeyslotAnnotation) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyslotAnnotation.ProtoReflect.Descriptor instead.
+func (*KeyslotAnnotation) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *KeyslotAnnotation) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *KeyslotAnnotation) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *KeyslotAnnotation) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *KeyslotAnnotation) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+type Keyslot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	KeySize       int32                  `protobuf:"varint,3,opt,name=key_size,json=keySize,proto3" json:"key_size,omitempty"` // Bytes
+	Priority      int32                  `protobuf:"varint,4,opt,name=priority,proto3" json:"priority,omitempty"`
+	KdfType       string                 `protobuf:"bytes,5,opt,name=kdf_type,json=kdfType,proto3" json:"kdf_type,omitempty"`
+	Encryption    string                 `protobuf:"bytes,6,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	Annotation    *KeyslotAnnotation     `protobuf:"bytes,7,opt,name=annotation,proto3" json:"annotation,omitempty"` // Unset = not annotated
+	KdfHash       string                 `protobuf:"bytes,8,opt,name=kdf_hash,json=kdfHash,proto3" json:"kdf_hash,omitempty"`
+	KdfIterations int32                  `protobuf:"varint,9,opt,name=kdf_iterations,json=kdfIterations,proto3" json:"kdf_iterations,omitempty"`
+	KdfTime       int32                  `protobuf:"varint,10,opt,name=kdf_time,json=kdfTime,proto3" json:"kdf_time,omitempty"`
+	KdfMemory     int32                  `protobuf:"varint,11,opt,name=kdf_memory,json=kdfMemory,proto3" json:"kdf_memory,omitempty"` // KiB
+	KdfCpus       int32                  `protobuf:"varint,12,opt,name=kdf_cpus,json=kdfCpus,proto3" json:"kdf_cpus,omitempty"`
+	AfStripes     int32                  `protobuf:"varint,13,opt,name=af_stripes,json=afStripes,proto3" json:"af_stripes,omitempty"`
+	AfHash        string                 `protobuf:"bytes,14,opt,name=af_hash,json=afHash,proto3" json:"af_hash,omitempty"`
+	AreaKeySize   int32                  `protobuf:"varint,15,opt,name=area_key_size,json=areaKeySize,proto3" json:"area_key_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Keyslot) Reset() {
+	*x = Keyslot{}
+	mi := &file_volume_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Keyslot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Keyslot) ProtoMessage() {}
+
+func (x *Keyslot) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Keyslot.ProtoReflect.Descriptor instead.
+func (*Keyslot) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Keyslot) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Keyslot) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Keyslot) GetKeySize() int32 {
+	if x != nil {
+		return x.KeySize
+	}
+	return 0
+}
+
+func (x *Keyslot) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Keyslot) GetKdfType() string {
+	if x != nil {
+		return x.KdfType
+	}
+	return ""
+}
+
+func (x *Keyslot) GetEncryption() string {
+	if x != nil {
+		return x.Encryption
+	}
+	return ""
+}
+
+func (x *Keyslot) GetAnnotation() *KeyslotAnnotation {
+	if x != nil {
+		return x.Annotation
+	}
+	return nil
+}
+
+func (x *Keyslot) GetKdfHash() string {
+	if x != nil {
+		return x.KdfHash
+	}
+	return ""
+}
+
+func (x *Keyslot) GetKdfIterations() int32 {
+	if x != nil {
+		return x.KdfIterations
+	}
+	return 0
+}
+
+func (x *Keyslot) GetKdfTime() int32 {
+	if x != nil {
+		return x.KdfTime
+	}
+	return 0
+}
+
+func (x *Keyslot) GetKdfMemory() int32 {
+	if x != nil {
+		return x.KdfMemory
+	}
+	return 0
+}
+
+func (x *Keyslot) GetKdfCpus() int32 {
+	if x != nil {
+		return x.KdfCpus
+	}
+	return 0
+}
+
+func (x *Keyslot) GetAfStripes() int32 {
+	if x != nil {
+		return x.AfStripes
+	}
+	return 0
+}
+
+func (x *Keyslot) GetAfHash() string {
+	if x != nil {
+		return x.AfHash
+	}
+	return ""
+}
+
+func (x *Keyslot) GetAreaKeySize() int32 {
+	if x != nil {
+		return x.AreaKeySize
+	}
+	return 0
+}
+
+type ListKeyslotsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keyslots      []*Keyslot             `protobuf:"bytes,1,rep,name=keyslots,proto3" json:"keyslots,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeyslotsResponse) Reset() {
+	*x = ListKeyslotsResponse{}
+	mi := &file_volume_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeyslotsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeyslotsResponse) ProtoMessage() {}
+
+func (x *ListKeyslotsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeyslotsResponse.ProtoReflect.Descriptor instead.
+func (*ListKeyslotsResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListKeyslotsResponse) GetKeyslots() []*Keyslot {
+	if x != nil {
+		return x.Keyslots
+	}
+	return nil
+}
+
+type AddKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Passphrase    []byte                 `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"` // Authorizes the change
+	NewPassphrase []byte                 `protobuf:"bytes,3,opt,name=new_passphrase,json=newPassphrase,proto3" json:"new_passphrase,omitempty"`
+	Keyslot       *int32                 `protobuf:"varint,4,opt,name=keyslot,proto3,oneof" json:"keyslot,omitempty"` // Unset = first free keyslot
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddKeyRequest) Reset() {
+	*x = AddKeyRequest{}
+	mi := &file_volume_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddKeyRequest) ProtoMessage() {}
+
+func (x *AddKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddKeyRequest.ProtoReflect.Descriptor instead.
+func (*AddKeyRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AddKeyRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *AddKeyRequest) GetPassphrase() []byte {
+	if x != nil {
+		return x.Passphrase
+	}
+	return nil
+}
+
+func (x *AddKeyRequest) GetNewPassphrase() []byte {
+	if x != nil {
+		return x.NewPassphrase
+	}
+	return nil
+}
+
+func (x *AddKeyRequest) GetKeyslot() int32 {
+	if x != nil && x.Keyslot != nil {
+		return *x.Keyslot
+	}
+	return 0
+}
+
+type AddKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddKeyResponse) Reset() {
+	*x = AddKeyResponse{}
+	mi := &file_volume_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddKeyResponse) ProtoMessage() {}
+
+func (x *AddKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddKeyResponse.ProtoReflect.Descriptor instead.
+func (*AddKeyResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{15}
+}
+
+type RemoveKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Passphrase    []byte                 `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"` // Must open the keyslot removed
+	Keyslot       int32                  `protobuf:"varint,3,opt,name=keyslot,proto3" json:"keyslot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveKeyRequest) Reset() {
+	*x = RemoveKeyRequest{}
+	mi := &file_volume_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveKeyRequest) ProtoMessage() {}
+
+func (x *RemoveKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveKeyRequest.ProtoReflect.Descriptor instead.
+func (*RemoveKeyRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RemoveKeyRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *RemoveKeyRequest) GetPassphrase() []byte {
+	if x != nil {
+		return x.Passphrase
+	}
+	return nil
+}
+
+func (x *RemoveKeyRequest) GetKeyslot() int32 {
+	if x != nil {
+		return x.Keyslot
+	}
+	return 0
+}
+
+type RemoveKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveKeyResponse) Reset() {
+	*x = RemoveKeyResponse{}
+	mi := &file_volume_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveKeyResponse) ProtoMessage() {}
+
+func (x *RemoveKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveKeyResponse.ProtoReflect.Descriptor instead.
+func (*RemoveKeyResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{17}
+}
+
+type ChangeKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Passphrase    []byte                 `protobuf:"bytes,2,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	NewPassphrase []byte                 `protobuf:"bytes,3,opt,name=new_passphrase,json=newPassphrase,proto3" json:"new_passphrase,omitempty"`
+	Keyslot       int32                  `protobuf:"varint,4,opt,name=keyslot,proto3" json:"keyslot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeKeyRequest) Reset() {
+	*x = ChangeKeyRequest{}
+	mi := &file_volume_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeKeyRequest) ProtoMessage() {}
+
+func (x *ChangeKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeKeyRequest.ProtoReflect.Descriptor instead.
+func (*ChangeKeyRequest) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ChangeKeyRequest) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *ChangeKeyRequest) GetPassphrase() []byte {
+	if x != nil {
+		return x.Passphrase
+	}
+	return nil
+}
+
+func (x *ChangeKeyRequest) GetNewPassphrase() []byte {
+	if x != nil {
+		return x.NewPassphrase
+	}
+	return nil
+}
+
+func (x *ChangeKeyRequest) GetKeyslot() int32 {
+	if x != nil {
+		return x.Keyslot
+	}
+	return 0
+}
+
+type ChangeKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeKeyResponse) Reset() {
+	*x = ChangeKeyResponse{}
+	mi := &file_volume_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeKeyResponse) ProtoMessage() {}
+
+func (x *ChangeKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_volume_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeKeyResponse.ProtoReflect.Descriptor instead.
+func (*ChangeKeyResponse) Descriptor() ([]byte, []int) {
+	return file_volume_proto_rawDescGZIP(), []int{19}
+}
+
+var File_volume_proto protoreflect.FileDescriptor
+
+const file_volume_proto_rawDesc = "" +
+	"\n" +
+	"\fvolume.proto\x12\bluks2.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa1\x02\n" +
+	"\rFormatRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x02 \x01(\fR\n" +
+	"passphrase\x12\x14\n" +
+	"\x05label\x18\x03 \x01(\tR\x05label\x12\x1c\n" +
+	"\tsubsystem\x18\x04 \x01(\tR\tsubsystem\x12\x16\n" +
+	"\x06cipher\x18\x05 \x01(\tR\x06cipher\x12\x1f\n" +
+	"\vcipher_mode\x18\x06 \x01(\tR\n" +
+	"cipherMode\x12\x19\n" +
+	"\bkey_size\x18\a \x01(\x05R\akeySize\x12\x19\n" +
+	"\bkdf_type\x18\b \x01(\tR\akdfType\x12\x1f\n" +
+	"\vsector_size\x18\t \x01(\x05R\n" +
+	"sectorSize\x12\x14\n" +
+	"\x05force\x18\n" +
+	" \x01(\bR\x05force\"\x10\n" +
+	"\x0eFormatResponse\"\xad\x01\n" +
+	"\rUnlockRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x02 \x01(\fR\n" +
+	"passphrase\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x1d\n" +
+	"\akeyslot\x18\x04 \x01(\x05H\x00R\akeyslot\x88\x01\x01\x12%\n" +
+	"\x0eallow_discards\x18\x05 \x01(\bR\rallowDiscardsB\n" +
+	"\n" +
+	"\b_keyslot\"\x10\n" +
+	"\x0eUnlockResponse\"!\n" +
+	"\vLockRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x0e\n" +
+	"\fLockResponse\".\n" +
+	"\x14GetVolumeInfoRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\"\xcd\x01\n" +
+	"\n" +
+	"VolumeInfo\x12\x12\n" +
+	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\x12\x16\n" +
+	"\x06cipher\x18\x04 \x01(\tR\x06cipher\x12\x19\n" +
+	"\bkey_size\x18\x05 \x01(\x05R\akeySize\x12\x1f\n" +
+	"\vsector_size\x18\x06 \x01(\x05R\n" +
+	"sectorSize\x12'\n" +
+	"\x0factive_keyslots\x18\a \x03(\x05R\x0eactiveKeyslots\"-\n" +
+	"\x17GetMappingStatusRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\xbc\x03\n" +
+	"\rMappingStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04uuid\x18\x02 \x01(\tR\x04uuid\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x16\n" +
+	"\x06cipher\x18\x04 \x01(\tR\x06cipher\x12\x19\n" +
+	"\bkey_size\x18\x05 \x01(\x05R\akeySize\x12!\n" +
+	"\fkey_location\x18\x06 \x01(\tR\vkeyLocation\x12\x16\n" +
+	"\x06device\x18\a \x01(\tR\x06device\x12\x16\n" +
+	"\x06offset\x18\b \x01(\x04R\x06offset\x12\x1b\n" +
+	"\tiv_offset\x18\t \x01(\x04R\bivOffset\x12\x12\n" +
+	"\x04size\x18\n" +
+	" \x01(\x04R\x04size\x12\x1f\n" +
+	"\vsector_size\x18\v \x01(\x05R\n" +
+	"sectorSize\x12\x14\n" +
+	"\x05flags\x18\f \x03(\tR\x05flags\x12\x1b\n" +
+	"\tread_only\x18\r \x01(\bR\breadOnly\x12\x1c\n" +
+	"\tsuspended\x18\x0e \x01(\bR\tsuspended\x12'\n" +
+	"\x0fdeferred_remove\x18\x0f \x01(\bR\x0edeferredRemove\x12\x1d\n" +
+	"\n" +
+	"open_count\x18\x10 \x01(\x05R\topenCount\"-\n" +
+	"\x13ListKeyslotsRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\"\x9c\x01\n" +
+	"\x11KeyslotAnnotation\x12\x14\n" +
+	"\x05label\x18\x01 \x01(\tR\x05label\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"\xcf\x03\n" +
+	"\aKeyslot\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x19\n" +
+	"\bkey_size\x18\x03 \x01(\x05R\akeySize\x12\x1a\n" +
+	"\bpriority\x18\x04 \x01(\x05R\bpriority\x12\x19\n" +
+	"\bkdf_type\x18\x05 \x01(\tR\akdfType\x12\x1e\n" +
+	"\n" +
+	"encryption\x18\x06 \x01(\tR\n" +
+	"encryption\x12;\n" +
+	"\n" +
+	"annotation\x18\a \x01(\v2\x1b.luks2.v1.KeyslotAnnotationR\n" +
+	"annotation\x12\x19\n" +
+	"\bkdf_hash\x18\b \x01(\tR\akdfHash\x12%\n" +
+	"\x0ekdf_iterations\x18\t \x01(\x05R\rkdfIterations\x12\x19\n" +
+	"\bkdf_time\x18\n" +
+	" \x01(\x05R\akdfTime\x12\x1d\n" +
+	"\n" +
+	"kdf_memory\x18\v \x01(\x05R\tkdfMemory\x12\x19\n" +
+	"\bkdf_cpus\x18\f \x01(\x05R\akdfCpus\x12\x1d\n" +
+	"\n" +
+	"af_stripes\x18\r \x01(\x05R\tafStripes\x12\x17\n" +
+	"\aaf_hash\x18\x0e \x01(\tR\x06afHash\x12\"\n" +
+	"\rarea_key_size\x18\x0f \x01(\x05R\vareaKeySize\"E\n" +
+	"\x14ListKeyslotsResponse\x12-\n" +
+	"\bkeyslots\x18\x01 \x03(\v2\x11.luks2.v1.KeyslotR\bkeyslots\"\x99\x01\n" +
+	"\rAddKeyRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x02 \x01(\fR\n" +
+	"passphrase\x12%\n" +
+	"\x0enew_passphrase\x18\x03 \x01(\fR\rnewPassphrase\x12\x1d\n" +
+	"\akeyslot\x18\x04 \x01(\x05H\x00R\akeyslot\x88\x01\x01B\n" +
+	"\n" +
+	"\b_keyslot\"\x10\n" +
+	"\x0eAddKeyResponse\"d\n" +
+	"\x10RemoveKeyRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x02 \x01(\fR\n" +
+	"passphrase\x12\x18\n" +
+	"\akeyslot\x18\x03 \x01(\x05R\akeyslot\"\x13\n" +
+	"\x11RemoveKeyResponse\"\x8b\x01\n" +
+	"\x10ChangeKeyRequest\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x02 \x01(\fR\n" +
+	"passphrase\x12%\n" +
+	"\x0enew_passphrase\x18\x03 \x01(\fR\rnewPassphrase\x12\x18\n" +
+	"\akeyslot\x18\x04 \x01(\x05R\akeyslot\"\x13\n" +
+	"\x11ChangeKeyResponse2\xef\x04\n" +
+	"\rVolumeService\x12;\n" +
+	"\x06Format\x12\x17.luks2.v1.FormatRequest\x1a\x18.luks2.v1.FormatResponse\x12;\n" +
+	"\x06Unlock\x12\x17.luks2.v1.UnlockRequest\x1a\x18.luks2.v1.UnlockResponse\x125\n" +
+	"\x04Lock\x12\x15.luks2.v1.LockRequest\x1a\x16.luks2.v1.LockResponse\x12E\n" +
+	"\rGetVolumeInfo\x12\x1e.luks2.v1.GetVolumeInfoRequest\x1a\x14.luks2.v1.VolumeInfo\x12N\n" +
+	"\x10GetMappingStatus\x12!.luks2.v1.GetMappingStatusRequest\x1a\x17.luks2.v1.MappingStatus\x12M\n" +
+	"\fListKeyslots\x12\x1d.luks2.v1.ListKeyslotsRequest\x1a\x1e.luks2.v1.ListKeyslotsResponse\x12;\n" +
+	"\x06AddKey\x12\x17.luks2.v1.AddKeyRequest\x1a\x18.luks2.v1.AddKeyResponse\x12D\n" +
+	"\tRemoveKey\x12\x1a.luks2.v1.RemoveKeyRequest\x1a\x1b.luks2.v1.RemoveKeyResponse\x12D\n" +
+	"\tChangeKey\x12\x1a.luks2.v1.ChangeKeyRequest\x1a\x1b.luks2.v1.ChangeKeyResponseB9Z7github.com/jeremyhahn/go-luks2/pkg/luks2/server/luks2pbb\x06proto3"
+
+var (
+	file_volume_proto_rawDescOnce sync.Once
+	file_volume_proto_rawDescData []byte
+)
+
+func file_volume_proto_rawDescGZIP() []byte {
+	file_volume_proto_rawDescOnce.Do(func() {
+		file_volume_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_volume_proto_rawDesc), len(file_volume_proto_rawDesc)))
+	})
+	return file_volume_proto_rawDescData
+}
+
+var file_volume_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
+var file_volume_proto_goTypes = []any{
+	(*FormatRequest)(nil),           // 0: luks2.v1.FormatRequest
+	(*FormatResponse)(nil),          // 1: luks2.v1.FormatResponse
+	(*UnlockRequest)(nil),           // 2: luks2.v1.UnlockRequest
+	(*UnlockResponse)(nil),          // 3: luks2.v1.UnlockResponse
+	(*LockRequest)(nil),             // 4: luks2.v1.LockRequest
+	(*LockResponse)(nil),            // 5: luks2.v1.LockResponse
+	(*GetVolumeInfoRequest)(nil),    // 6: luks2.v1.GetVolumeInfoRequest
+	(*VolumeInfo)(nil),              // 7: luks2.v1.VolumeInfo
+	(*GetMappingStatusRequest)(nil), // 8: luks2.v1.GetMappingStatusRequest
+	(*MappingStatus)(nil),           // 9: luks2.v1.MappingStatus
+	(*ListKeyslotsRequest)(nil),     // 10: luks2.v1.ListKeyslotsRequest
+	(*KeyslotAnnotation)(nil),       // 11: luks2.v1.KeyslotAnnotation
+	(*Keyslot)(nil),                 // 12: luks2.v1.Keyslot
+	(*ListKeyslotsResponse)(nil),    // 13: luks2.v1.ListKeyslotsResponse
+	(*AddKeyRequest)(nil),           // 14: luks2.v1.AddKeyRequest
+	(*AddKeyResponse)(nil),          // 15: luks2.v1.AddKeyResponse
+	(*RemoveKeyRequest)(nil),        // 16: luks2.v1.RemoveKeyRequest
+	(*RemoveKeyResponse)(nil),       // 17: luks2.v1.RemoveKeyResponse
+	(*ChangeKeyRequest)(nil),        // 18: luks2.v1.ChangeKeyRequest
+	(*ChangeKeyResponse)(nil),       // 19: luks2.v1.ChangeKeyResponse
+	(*timestamppb.Timestamp)(nil),   // 20: google.protobuf.Timestamp
+}
+var file_volume_proto_depIdxs = []int32{
+	20, // 0: luks2.v1.KeyslotAnnotation.created_at:type_name -> google.protobuf.Timestamp
+	11, // 1: luks2.v1.Keyslot.annotation:type_name -> luks2.v1.KeyslotAnnotation
+	12, // 2: luks2.v1.ListKeyslotsResponse.keyslots:type_name -> luks2.v1.Keyslot
+	0,  // 3: luks2.v1.VolumeService.Format:input_type -> luks2.v1.FormatRequest
+	2,  // 4: luks2.v1.VolumeService.Unlock:input_type -> luks2.v1.UnlockRequest
+	4,  // 5: luks2.v1.VolumeService.Lock:input_type -> luks2.v1.LockRequest
+	6,  // 6: luks2.v1.VolumeService.GetVolumeInfo:input_type -> luks2.v1.GetVolumeInfoRequest
+	8,  // 7: luks2.v1.VolumeService.GetMappingStatus:input_type -> luks2.v1.GetMappingStatusRequest
+	10, // 8: luks2.v1.VolumeService.ListKeyslots:input_type -> luks2.v1.ListKeyslotsRequest
+	14, // 9: luks2.v1.VolumeService.AddKey:input_type -> luks2.v1.AddKeyRequest
+	16, // 10: luks2.v1.VolumeService.RemoveKey:input_type -> luks2.v1.RemoveKeyRequest
+	18, // 11: luks2.v1.VolumeService.ChangeKey:input_type -> luks2.v1.ChangeKeyRequest
+	1,  // 12: luks2.v1.VolumeService.Format:output_type -> luks2.v1.FormatResponse
+	3,  // 13: luks2.v1.VolumeService.Unlock:output_type -> luks2.v1.UnlockResponse
+	5,  // 14: luks2.v1.VolumeService.Lock:output_type -> luks2.v1.LockResponse
+	7,  // 15: luks2.v1.VolumeService.GetVolumeInfo:output_type -> luks2.v1.VolumeInfo
+	9,  // 16: luks2.v1.VolumeService.GetMappingStatus:output_type -> luks2.v1.MappingStatus
+	13, // 17: luks2.v1.VolumeService.ListKeyslots:output_type -> luks2.v1.ListKeyslotsResponse
+	15, // 18: luks2.v1.VolumeService.AddKey:output_type -> luks2.v1.AddKeyResponse
+	17, // 19: luks2.v1.VolumeService.RemoveKey:output_type -> luks2.v1.RemoveKeyResponse
+	19, // 20: luks2.v1.VolumeService.ChangeKey:output_type -> luks2.v1.ChangeKeyResponse
+	12, // [12:21] is the sub-list for method output_type
+	3,  // [3:12] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_volume_proto_init() }
+func file_volume_proto_init() {
+	if File_volume_proto != nil {
+		return
+	}
+	file_volume_proto_msgTypes[2].OneofWrappers = []any{}
+	file_volume_proto_msgTypes[14].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_volume_proto_rawDesc), len(file_volume_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   20,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_volume_proto_goTypes,
+		DependencyIndexes: file_volume_proto_depIdxs,
+		MessageInfos:      file_volume_proto_msgTypes,
+	}.Build()
+	File_volume_proto = out.File
+	file_volume_proto_goTypes = nil
+	file_volume_proto_depIdxs = nil
+}
@@ -0,0 +1,460 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: volume.proto
+
+// The gRPC form of the management API of package server. Every RPC maps to
+// one HTTPS/JSON endpoint and behaves the same way; both are served on the
+// same listener and authenticated with the same bearer tokens, sent as
+// "authorization: Bearer <token>" metadata.
+
+package luks2pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	VolumeService_Format_FullMethodName           = "/luks2.v1.VolumeService/Format"
+	VolumeService_Unlock_FullMethodName           = "/luks2.v1.VolumeService/Unlock"
+	VolumeService_Lock_FullMethodName             = "/luks2.v1.VolumeService/Lock"
+	VolumeService_GetVolumeInfo_FullMethodName    = "/luks2.v1.VolumeService/GetVolumeInfo"
+	VolumeService_GetMappingStatus_FullMethodName = "/luks2.v1.VolumeService/GetMappingStatus"
+	VolumeService_ListKeyslots_FullMethodName     = "/luks2.v1.VolumeService/ListKeyslots"
+	VolumeService_AddKey_FullMethodName           = "/luks2.v1.VolumeService/AddKey"
+	VolumeService_RemoveKey_FullMethodName        = "/luks2.v1.VolumeService/RemoveKey"
+	VolumeService_ChangeKey_FullMethodName        = "/luks2.v1.VolumeService/ChangeKey"
+)
+
+// VolumeServiceClient is the client API for VolumeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// VolumeService formats, unlocks, locks and inspects volumes and manages
+// their keyslots
+type VolumeServiceClient interface {
+	// Format creates a LUKS2 volume (POST /v1/volumes/format)
+	Format(ctx context.Context, in *FormatRequest, opts ...grpc.CallOption) (*FormatResponse, error)
+	// Unlock opens a volume and creates its device-mapper mapping
+	// (POST /v1/volumes/unlock)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error)
+	// Lock removes a mapping (POST /v1/volumes/lock)
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error)
+	// GetVolumeInfo reads the header of a volume (GET /v1/volumes/info)
+	GetVolumeInfo(ctx context.Context, in *GetVolumeInfoRequest, opts ...grpc.CallOption) (*VolumeInfo, error)
+	// GetMappingStatus describes an active mapping (GET /v1/mappings/{name})
+	GetMappingStatus(ctx context.Context, in *GetMappingStatusRequest, opts ...grpc.CallOption) (*MappingStatus, error)
+	// ListKeyslots lists the keyslots of a volume (GET /v1/keyslots)
+	ListKeyslots(ctx context.Context, in *ListKeyslotsRequest, opts ...grpc.CallOption) (*ListKeyslotsResponse, error)
+	// AddKey adds a passphrase (POST /v1/keyslots/add)
+	AddKey(ctx context.Context, in *AddKeyRequest, opts ...grpc.CallOption) (*AddKeyResponse, error)
+	// RemoveKey removes the passphrase of a keyslot (POST /v1/keyslots/remove)
+	RemoveKey(ctx context.Context, in *RemoveKeyRequest, opts ...grpc.CallOption) (*RemoveKeyResponse, error)
+	// ChangeKey replaces the passphrase of a keyslot (POST /v1/keyslots/change)
+	ChangeKey(ctx context.Context, in *ChangeKeyRequest, opts ...grpc.CallOption) (*ChangeKeyResponse, error)
+}
+
+type volumeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVolumeServiceClient(cc grpc.ClientConnInterface) VolumeServiceClient {
+	return &volumeServiceClient{cc}
+}
+
+func (c *volumeServiceClient) Format(ctx context.Context, in *FormatRequest, opts ...grpc.CallOption) (*FormatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FormatResponse)
+	err := c.cc.Invoke(ctx, VolumeService_Format_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnlockResponse)
+	err := c.cc.Invoke(ctx, VolumeService_Unlock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LockResponse)
+	err := c.cc.Invoke(ctx, VolumeService_Lock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) GetVolumeInfo(ctx context.Context, in *GetVolumeInfoRequest, opts ...grpc.CallOption) (*VolumeInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VolumeInfo)
+	err := c.cc.Invoke(ctx, VolumeService_GetVolumeInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) GetMappingStatus(ctx context.Context, in *GetMappingStatusRequest, opts ...grpc.CallOption) (*MappingStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MappingStatus)
+	err := c.cc.Invoke(ctx, VolumeService_GetMappingStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) ListKeyslots(ctx context.Context, in *ListKeyslotsRequest, opts ...grpc.CallOption) (*ListKeyslotsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListKeyslotsResponse)
+	err := c.cc.Invoke(ctx, VolumeService_ListKeyslots_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) AddKey(ctx context.Context, in *AddKeyRequest, opts ...grpc.CallOption) (*AddKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddKeyResponse)
+	err := c.cc.Invoke(ctx, VolumeService_AddKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) RemoveKey(ctx context.Context, in *RemoveKeyRequest, opts ...grpc.CallOption) (*RemoveKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveKeyResponse)
+	err := c.cc.Invoke(ctx, VolumeService_RemoveKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *volumeServiceClient) ChangeKey(ctx context.Context, in *ChangeKeyRequest, opts ...grpc.CallOption) (*ChangeKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChangeKeyResponse)
+	err := c.cc.Invoke(ctx, VolumeService_ChangeKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// VolumeServiceServer is the server API for VolumeService service.
+// All implementations must embed UnimplementedVolumeServiceServer
+// for forward compatibility.
+//
+// VolumeService formats, unlocks, locks and inspects volumes and manages
+// their keyslots
+type VolumeServiceServer interface {
+	// Format creates a LUKS2 volume (POST /v1/volumes/format)
+	Format(context.Context, *FormatRequest) (*FormatResponse, error)
+	// Unlock opens a volume and creates its device-mapper mapping
+	// (POST /v1/volumes/unlock)
+	Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error)
+	// Lock removes a mapping (POST /v1/volumes/lock)
+	Lock(context.Context, *LockRequest) (*LockResponse, error)
+	// GetVolumeInfo reads the header of a volume (GET /v1/volumes/info)
+	GetVolumeInfo(context.Context, *GetVolumeInfoRequest) (*VolumeInfo, error)
+	// GetMappingStatus describes an active mapping (GET /v1/mappings/{name})
+	GetMappingStatus(context.Context, *GetMappingStatusRequest) (*MappingStatus, error)
+	// ListKeyslots lists the keyslots of a volume (GET /v1/keyslots)
+	ListKeyslots(context.Context, *ListKeyslotsRequest) (*ListKeyslotsResponse, error)
+	// AddKey adds a passphrase (POST /v1/keyslots/add)
+	AddKey(context.Context, *AddKeyRequest) (*AddKeyResponse, error)
+	// RemoveKey removes the passphrase of a keyslot (POST /v1/keyslots/remove)
+	RemoveKey(context.Context, *RemoveKeyRequest) (*RemoveKeyResponse, error)
+	// ChangeKey replaces the passphrase of a keyslot (POST /v1/keyslots/change)
+	ChangeKey(context.Context, *ChangeKeyRequest) (*ChangeKeyResponse, error)
+	mustEmbedUnimplementedVolumeServiceServer()
+}
+
+// UnimplementedVolumeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVolumeServiceServer struct{}
+
+func (UnimplementedVolumeServiceServer) Format(context.Context, *FormatRequest) (*FormatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Format not implemented")
+}
+func (UnimplementedVolumeServiceServer) Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unlock not implemented")
+}
+func (UnimplementedVolumeServiceServer) Lock(context.Context, *LockRequest) (*LockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedVolumeServiceServer) GetVolumeInfo(context.Context, *GetVolumeInfoRequest) (*VolumeInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVolumeInfo not implemented")
+}
+func (UnimplementedVolumeServiceServer) GetMappingStatus(context.Context, *GetMappingStatusRequest) (*MappingStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMappingStatus not implemented")
+}
+func (UnimplementedVolumeServiceServer) ListKeyslots(context.Context, *ListKeyslotsRequest) (*ListKeyslotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKeyslots not implemented")
+}
+func (UnimplementedVolumeServiceServer) AddKey(context.Context, *AddKeyRequest) (*AddKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddKey not implemented")
+}
+func (UnimplementedVolumeServiceServer) RemoveKey(context.Context, *RemoveKeyRequest) (*RemoveKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveKey not implemented")
+}
+func (UnimplementedVolumeServiceServer) ChangeKey(context.Context, *ChangeKeyRequest) (*ChangeKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeKey not implemented")
+}
+func (UnimplementedVolumeServiceServer) mustEmbedUnimplementedVolumeServiceServer() {}
+func (UnimplementedVolumeServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeVolumeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VolumeServiceServer will
+// result in compilation errors.
+type UnsafeVolumeServiceServer interface {
+	mustEmbedUnimplementedVolumeServiceServer()
+}
+
+func RegisterVolumeServiceServer(s grpc.ServiceRegistrar, srv VolumeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedVolumeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VolumeService_ServiceDesc, srv)
+}
+
+func _VolumeService_Format_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FormatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).Format(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_Format_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).Format(ctx, req.(*FormatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_Unlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).Unlock(ctx, req.(*UnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_Lock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).Lock(ctx, req.(*LockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_GetVolumeInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVolumeInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).GetVolumeInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_GetVolumeInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).GetVolumeInfo(ctx, req.(*GetVolumeInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_GetMappingStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMappingStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).GetMappingStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_GetMappingStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).GetMappingStatus(ctx, req.(*GetMappingStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_ListKeyslots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKeyslotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).ListKeyslots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_ListKeyslots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).ListKeyslots(ctx, req.(*ListKeyslotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_AddKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).AddKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_AddKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).AddKey(ctx, req.(*AddKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_RemoveKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).RemoveKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_RemoveKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).RemoveKey(ctx, req.(*RemoveKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VolumeService_ChangeKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VolumeServiceServer).ChangeKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VolumeService_ChangeKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VolumeServiceServer).ChangeKey(ctx, req.(*ChangeKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// VolumeService_ServiceDesc is the grpc.ServiceDesc for VolumeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VolumeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "luks2.v1.VolumeService",
+	HandlerType: (*VolumeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Format",
+			Handler:    _VolumeService_Format_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _VolumeService_Unlock_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _VolumeService_Lock_Handler,
+		},
+		{
+			MethodName: "GetVolumeInfo",
+			Handler:    _VolumeService_GetVolumeInfo_Handler,
+		},
+		{
+			MethodName: "GetMappingStatus",
+			Handler:    _VolumeService_GetMappingStatus_Handler,
+		},
+		{
+			MethodName: "ListKeyslots",
+			Handler:    _VolumeService_ListKeyslots_Handler,
+		},
+		{
+			MethodName: "AddKey",
+			Handler:    _VolumeService_AddKey_Handler,
+		},
+		{
+			MethodName: "RemoveKey",
+			Handler:    _VolumeService_RemoveKey_Handler,
+		},
+		{
+			MethodName: "ChangeKey",
+			Handler:    _VolumeService_ChangeKey_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "volume.proto",
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Package server exposes LUKS2 volume management over an authenticated
+// HTTPS/JSON API so fleet-management systems can format, unlock, lock and
+// inspect volumes and manage keyslots on remote machines.
+//
+// The same operations are served over gRPC on the same address, as the
+// luks2.v1.VolumeService defined in the luks2pb package. Requests with a
+// Content-Type of application/grpc go to the gRPC service; all others to
+// the JSON API.
+//
+// Every request must carry a bearer token (Authorization: Bearer <token>,
+// sent as "authorization" metadata over gRPC).
+// The server refuses to listen without TLS unless explicitly told to, since
+// requests carry passphrases.
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// maxBodySize bounds request bodies
+const maxBodySize = 64 * 1024
+
+// ErrUnauthorized is returned by an Authenticator for a missing or unknown token
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Backend performs the volume operations requested through the API
+type Backend interface {
+	Format(opts luks2.FormatOptions) error
+	UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error
+	Lock(name string) error
+	GetVolumeInfo(device string) (*luks2.VolumeInfo, error)
+	Status(name string) (*luks2.VolumeStatus, error)
+	ListKeyslots(device string) ([]luks2.KeyslotInfo, error)
+	AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error
+	RemoveKey(device string, passphrase []byte, keyslot int) error
+	ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int) error
+}
+
+// luks2Backend implements Backend with the luks2 package
+type luks2Backend struct{}
+
+func (luks2Backend) Format(opts luks2.FormatOptions) error { return luks2.Format(opts) }
+
+func (luks2Backend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	return luks2.UnlockWithOptions(device, passphrase, name, opts)
+}
+
+func (luks2Backend) Lock(name string) error { return luks2.Lock(name) }
+
+func (luks2Backend) GetVolumeInfo(device string) (*luks2.VolumeInfo, error) {
+	return luks2.GetVolumeInfo(device)
+}
+
+func (luks2Backend) Status(name string) (*luks2.VolumeStatus, error) { return luks2.Status(name) }
+
+func (luks2Backend) ListKeyslots(device string) ([]luks2.KeyslotInfo, error) {
+	return luks2.ListKeyslots(device)
+}
+
+func (luks2Backend) AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error {
+	return luks2.AddKey(device, existingPassphrase, newPassphrase, opts)
+}
+
+func (luks2Backend) RemoveKey(device string, passphrase []byte, keyslot int) error {
+	return luks2.RemoveKey(device, passphrase, keyslot)
+}
+
+func (luks2Backend) ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int) error {
+	return luks2.ChangeKey(device, oldPassphrase, newPassphrase, keyslot)
+}
+
+// Config configures a Server
+type Config struct {
+	// Addr is the TCP address to listen on (default: ":8443")
+	Addr string
+
+	// TLSConfig is required unless Insecure is set. Set ClientAuth and
+	// ClientCAs to additionally require mutual TLS.
+	TLSConfig *tls.Config
+
+	// Insecure allows serving plain HTTP, e.g. behind a TLS-terminating
+	// proxy on localhost. Passphrases then cross the wire in cleartext.
+	Insecure bool
+
+	// Tokens are the accepted bearer tokens. Ignored if Authenticate is set.
+	Tokens []string
+
+	// Authenticate replaces token checking with a custom scheme. It returns
+	// an error wrapping ErrUnauthorized to reject a request.
+	Authenticate func(r *http.Request) error
+
+	// Backend performs the operations (default: the luks2 package)
+	Backend Backend
+
+	// Metrics, if set, is served on GET /metrics behind the same
+	// authentication as the API (e.g. a *metrics.Registry)
+	Metrics http.Handler
+
+	// ErrorLog receives failed operations (default: discard). Passphrases
+	// are never logged.
+	ErrorLog *log.Logger
+}
+
+// Server serves the management API
+type Server struct {
+	cfg         Config
+	tokenHashes [][sha256.Size]byte
+	mux         *http.ServeMux
+	grpc        *grpc.Server
+}
+
+// New creates a server, applying defaults to cfg. At least one token or an
+// Authenticate function is required.
+func New(cfg Config) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8443"
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = luks2Backend{}
+	}
+	if cfg.Authenticate == nil && len(cfg.Tokens) == 0 {
+		return nil, errors.New("server requires at least one token or an Authenticate function")
+	}
+
+	s := &Server{cfg: cfg, mux: http.NewServeMux()}
+	for _, token := range cfg.Tokens {
+		if token == "" {
+			return nil, errors.New("empty token")
+		}
+		s.tokenHashes = append(s.tokenHashes, sha256.Sum256([]byte(token)))
+	}
+
+	s.mux.HandleFunc("POST /v1/volumes/format", s.handleFormat)
+	s.mux.HandleFunc("POST /v1/volumes/unlock", s.handleUnlock)
+	s.mux.HandleFunc("POST /v1/volumes/lock", s.handleLock)
+	s.mux.HandleFunc("GET /v1/volumes/info", s.handleInfo)
+	s.mux.HandleFunc("GET /v1/mappings/{name}", s.handleStatus)
+	s.mux.HandleFunc("GET /v1/keyslots", s.handleListKeyslots)
+	s.mux.HandleFunc("POST /v1/keyslots/add", s.handleAddKey)
+	s.mux.HandleFunc("POST /v1/keyslots/remove", s.handleRemoveKey)
+	s.mux.HandleFunc("POST /v1/keyslots/change", s.handleChangeKey)
+	if cfg.Metrics != nil {
+		s.mux.Handle("GET /metrics", cfg.Metrics)
+	}
+	s.grpc = s.newGRPCServer()
+
+	return s, nil
+}
+
+// ServeHTTP authenticates the request and dispatches it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.authenticate(r); err != nil {
+		if isGRPC(r) {
+			writeGRPCError(w, codes.Unauthenticated, err)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="luks2"`)
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if isGRPC(r) {
+		s.grpc.ServeHTTP(w, r)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API until ctx is canceled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if s.cfg.TLSConfig == nil && !s.cfg.Insecure {
+		return errors.New("TLS configuration required (set Insecure to serve plain HTTP)")
+	}
+
+	srv := &http.Server{
+		Addr:              s.cfg.Addr,
+		Handler:           s,
+		TLSConfig:         s.cfg.TLSConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          s.cfg.ErrorLog,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	if s.cfg.TLSConfig == nil {
+		// gRPC needs HTTP/2, which plain HTTP only offers as h2c
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if s.cfg.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// authenticate checks the bearer token in constant time
+func (s *Server) authenticate(r *http.Request) error {
+	if s.cfg.Authenticate != nil {
+		return s.cfg.Authenticate(r)
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return fmt.Errorf("%w: missing bearer token", ErrUnauthorized)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	match := 0
+	for _, h := range s.tokenHashes {
+		match |= subtle.ConstantTimeCompare(sum[:], h[:])
+	}
+	if match != 1 {
+		return fmt.Errorf("%w: invalid token", ErrUnauthorized)
+	}
+	return nil
+}
+
+// logf writes to the configured error log, if any
+func (s *Server) logf(format string, args ...any) {
+	if s.cfg.ErrorLog != nil {
+		s.cfg.ErrorLog.Printf(format, args...)
+	}
+}
+
+// fail logs an operation error and writes it with the matching status code
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	s.logf("%s %s failed: %v", r.Method, r.URL.Path, err)
+	writeError(w, statusCode(err), err)
+}
+
+// statusCode maps library errors to HTTP status codes
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, luks2.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, luks2.ErrDeviceNotFound), errors.Is(err, luks2.ErrVolumeNotUnlocked):
+		return http.StatusNotFound
+	case errors.Is(err, luks2.ErrVolumeAlreadyUnlocked), errors.Is(err, luks2.ErrDeviceNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, luks2.ErrInvalidPassphrase), errors.Is(err, luks2.ErrInvalidKeyslot),
+		errors.Is(err, luks2.ErrInvalidSize), errors.Is(err, luks2.ErrUnsupportedKDF),
+		errors.Is(err, luks2.ErrWeakPassphrase):
+		return http.StatusBadRequest
+	case errors.Is(err, luks2.ErrInsufficientMemory):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeError writes a JSON error body
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decode reads a JSON request body into v, rejecting unknown fields
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/metrics"
+)
+
+const testToken = "s3cret-token"
+
+// fakeBackend records calls and fails on the passphrase "wrong-passphrase"
+type fakeBackend struct {
+	calls  []string
+	format luks2.FormatOptions
+	unlock *luks2.UnlockOptions
+}
+
+func (b *fakeBackend) check(passphrase []byte) error {
+	if string(passphrase) == "wrong-passphrase" {
+		return fmt.Errorf("%w", luks2.ErrInvalidPassphrase)
+	}
+	return nil
+}
+
+func (b *fakeBackend) Format(opts luks2.FormatOptions) error {
+	b.calls = append(b.calls, "format "+opts.Device)
+	b.format = opts
+	return nil
+}
+
+func (b *fakeBackend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	b.calls = append(b.calls, "unlock "+device+" "+name)
+	b.unlock = opts
+	return b.check(passphrase)
+}
+
+func (b *fakeBackend) Lock(name string) error {
+	b.calls = append(b.calls, "lock "+name)
+	return nil
+}
+
+func (b *fakeBackend) GetVolumeInfo(device string) (*luks2.VolumeInfo, error) {
+	if device != "/dev/sdb1" {
+		return nil, fmt.Errorf("%w: %s", luks2.ErrDeviceNotFound, device)
+	}
+	return &luks2.VolumeInfo{UUID: "1234", Label: "data", Version: 2, Cipher: "aes-xts-plain64", ActiveKeyslots: []int{0, 1}}, nil
+}
+
+func (b *fakeBackend) Status(name string) (*luks2.VolumeStatus, error) {
+	if name != "data" {
+		return nil, fmt.Errorf("%w: %s", luks2.ErrVolumeNotUnlocked, name)
+	}
+	return &luks2.VolumeStatus{Name: name, Cipher: "aes-xts-plain64", KeySize: 512}, nil
+}
+
+func (b *fakeBackend) ListKeyslots(device string) ([]luks2.KeyslotInfo, error) {
+	return []luks2.KeyslotInfo{{ID: 0, Type: "luks2", KDFType: "argon2id"}}, nil
+}
+
+func (b *fakeBackend) AddKey(device string, existingPassphrase, newPassphrase []byte, opts *luks2.AddKeyOptions) error {
+	b.calls = append(b.calls, "addkey "+device)
+	return b.check(existingPassphrase)
+}
+
+func (b *fakeBackend) RemoveKey(device string, passphrase []byte, keyslot int) error {
+	b.calls = append(b.calls, fmt.Sprintf("removekey %s %d", device, keyslot))
+	return b.check(passphrase)
+}
+
+func (b *fakeBackend) ChangeKey(device string, oldPassphrase, newPassphrase []byte, keyslot int) error {
+	b.calls = append(b.calls, fmt.Sprintf("changekey %s %d", device, keyslot))
+	return b.check(oldPassphrase)
+}
+
+// newTestServer returns an HTTP test server backed by a fakeBackend
+func newTestServer(t *testing.T) (*httptest.Server, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{}
+	s, err := New(Config{Tokens: []string{"other-token", testToken}, Backend: backend})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ts := httptest.NewTLSServer(s)
+	t.Cleanup(ts.Close)
+	return ts, backend
+}
+
+// call sends an authenticated request and decodes the JSON response into out
+func call(t *testing.T, ts *httptest.Server, method, path string, body any, out any) int {
+	t.Helper()
+	var rd *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd = bytes.NewReader(data)
+	} else {
+		rd = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decoding %s response: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestNew_RequiresAuth(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("Expected error without tokens")
+	}
+	if _, err := New(Config{Tokens: []string{""}}); err == nil {
+		t.Error("Expected error for empty token")
+	}
+	if _, err := New(Config{Authenticate: func(*http.Request) error { return nil }}); err != nil {
+		t.Errorf("Authenticate alone should be enough: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts, backend := newTestServer(t)
+
+	for _, header := range []string{"", "Bearer ", "Bearer wrong", "Basic " + testToken} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/volumes/lock", strings.NewReader(`{"name":"data"}`))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", header, resp.StatusCode)
+		}
+		if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Error("Expected WWW-Authenticate header")
+		}
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Unauthenticated requests reached the backend: %v", backend.calls)
+	}
+}
+
+func TestVolumeEndpoints(t *testing.T) {
+	ts, backend := newTestServer(t)
+
+	code := call(t, ts, http.MethodPost, "/v1/volumes/format", FormatRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("correct-horse"), Label: "data", KDFType: "pbkdf2",
+	}, nil)
+	if code != http.StatusCreated || backend.format.Label != "data" || backend.format.KDFType != "pbkdf2" {
+		t.Errorf("format: status %d, opts %+v", code, backend.format)
+	}
+
+	slot := 1
+	code = call(t, ts, http.MethodPost, "/v1/volumes/unlock", UnlockRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("correct-horse"), Name: "data", Keyslot: &slot, AllowDiscards: true,
+	}, nil)
+	if code != http.StatusOK || backend.unlock == nil || *backend.unlock.Keyslot != 1 || !backend.unlock.AllowDiscards {
+		t.Errorf("unlock: status %d, opts %+v", code, backend.unlock)
+	}
+
+	var errResp errorResponse
+	code = call(t, ts, http.MethodPost, "/v1/volumes/unlock", UnlockRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("wrong-passphrase"), Name: "data",
+	}, &errResp)
+	if code != http.StatusBadRequest || errResp.Error == "" {
+		t.Errorf("wrong passphrase: status %d, body %+v", code, errResp)
+	}
+
+	var info VolumeInfoResponse
+	if code := call(t, ts, http.MethodGet, "/v1/volumes/info?device=/dev/sdb1", nil, &info); code != http.StatusOK {
+		t.Errorf("info: status %d", code)
+	}
+	if info.UUID != "1234" || len(info.ActiveKeyslots) != 2 {
+		t.Errorf("info: %+v", info)
+	}
+	if code := call(t, ts, http.MethodGet, "/v1/volumes/info?device=/dev/sdz", nil, nil); code != http.StatusNotFound {
+		t.Errorf("info for missing device: status %d, want 404", code)
+	}
+
+	var status luks2.VolumeStatus
+	if code := call(t, ts, http.MethodGet, "/v1/mappings/data", nil, &status); code != http.StatusOK || status.KeySize != 512 {
+		t.Errorf("status: code %d, %+v", code, status)
+	}
+	if code := call(t, ts, http.MethodGet, "/v1/mappings/other", nil, nil); code != http.StatusNotFound {
+		t.Errorf("status for inactive mapping: %d, want 404", code)
+	}
+
+	if code := call(t, ts, http.MethodPost, "/v1/volumes/lock", LockRequest{Name: "data"}, nil); code != http.StatusOK {
+		t.Errorf("lock: status %d", code)
+	}
+}
+
+func TestKeyslotEndpoints(t *testing.T) {
+	ts, backend := newTestServer(t)
+
+	var slots []luks2.KeyslotInfo
+	if code := call(t, ts, http.MethodGet, "/v1/keyslots?device=/dev/sdb1", nil, &slots); code != http.StatusOK || len(slots) != 1 {
+		t.Errorf("list: code %d, slots %+v", code, slots)
+	}
+
+	slot := 2
+	if code := call(t, ts, http.MethodPost, "/v1/keyslots/add", KeyRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("correct-horse"), NewPassphrase: []byte("battery-staple"),
+	}, nil); code != http.StatusCreated {
+		t.Errorf("add: status %d", code)
+	}
+	if code := call(t, ts, http.MethodPost, "/v1/keyslots/change", KeyRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("correct-horse"), NewPassphrase: []byte("battery-staple"), Keyslot: &slot,
+	}, nil); code != http.StatusOK {
+		t.Errorf("change: status %d", code)
+	}
+	if code := call(t, ts, http.MethodPost, "/v1/keyslots/remove", KeyRequest{
+		Device: "/dev/sdb1", Passphrase: []byte("correct-horse"), Keyslot: &slot,
+	}, nil); code != http.StatusOK {
+		t.Errorf("remove: status %d", code)
+	}
+
+	want := "addkey /dev/sdb1|changekey /dev/sdb1 2|removekey /dev/sdb1 2"
+	if got := strings.Join(backend.calls, "|"); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	ts, backend := newTestServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		body any
+	}{
+		{"format without passphrase", "/v1/volumes/format", FormatRequest{Device: "/dev/sdb1"}},
+		{"unlock without name", "/v1/volumes/unlock", UnlockRequest{Device: "/dev/sdb1", Passphrase: []byte("x")}},
+		{"lock without name", "/v1/volumes/lock", LockRequest{}},
+		{"add without new passphrase", "/v1/keyslots/add", KeyRequest{Device: "/dev/sdb1", Passphrase: []byte("x")}},
+		{"remove without keyslot", "/v1/keyslots/remove", KeyRequest{Device: "/dev/sdb1", Passphrase: []byte("x")}},
+		{"unknown field", "/v1/volumes/lock", map[string]string{"name": "data", "force": "yes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := call(t, ts, http.MethodPost, tt.path, tt.body, nil); code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", code)
+			}
+		})
+	}
+
+	if code := call(t, ts, http.MethodGet, "/v1/keyslots", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("list without device: status %d, want 400", code)
+	}
+	if len(backend.calls) != 0 {
+		t.Errorf("Bad requests reached the backend: %v", backend.calls)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{luks2.ErrPermissionDenied, http.StatusForbidden},
+		{fmt.Errorf("wrapped: %w", luks2.ErrVolumeAlreadyUnlocked), http.StatusConflict},
+		{fmt.Errorf("wrapped: %w", luks2.ErrDeviceNotEmpty), http.StatusConflict},
+		{&luks2.WeakPassphraseError{Reasons: []string{"too short"}}, http.StatusBadRequest},
+		{luks2.ErrInsufficientMemory, http.StatusServiceUnavailable},
+		{errors.New("device-mapper failure"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := statusCode(tt.err); got != tt.want {
+			t.Errorf("statusCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts, _ := newTestServer(t)
+	if code := call(t, ts, http.MethodGet, "/metrics", nil, nil); code != http.StatusNotFound {
+		t.Errorf("metrics without handler: status %d, want 404", code)
+	}
+
+	reg := metrics.New()
+	reg.Mappings = func() ([]string, error) { return []string{"data"}, nil }
+	s, err := New(Config{Tokens: []string{testToken}, Backend: &fakeBackend{}, Metrics: reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts = httptest.NewTLSServer(s)
+	t.Cleanup(ts.Close)
+
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated scrape: status %d, want 401", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "luks2_active_mappings 1") {
+		t.Errorf("scrape: status %d, body:\n%s", resp.StatusCode, body)
+	}
+}
+
+func TestListenAndServe_RequiresTLS(t *testing.T) {
+	s, err := New(Config{Tokens: []string{testToken}, Backend: &fakeBackend{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ListenAndServe(context.Background()); err == nil || !strings.Contains(err.Error(), "TLS") {
+		t.Errorf("Expected TLS error, got %v", err)
+	}
+}
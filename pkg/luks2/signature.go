@@ -0,0 +1,254 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Usage classes of a Signature, as reported by blkid
+const (
+	SignatureUsageCrypto         = "crypto"
+	SignatureUsageFilesystem     = "filesystem"
+	SignatureUsageRAID           = "raid"
+	SignatureUsagePartitionTable = "partition table"
+	SignatureUsageOther          = "other"
+)
+
+// Swap signatures at the end of the first page: version 1 and the old
+// version 0
+const (
+	swapMagic   = "SWAPSPACE2"
+	swapMagicV0 = "SWAP-SPACE"
+)
+
+// swapPageSizes are the page sizes a swap signature is looked for at, since
+// the swap area may have been made on another architecture
+var swapPageSizes = []int64{4096, 8192, 16384, 65536}
+
+// MD RAID superblock magic and locations. Version 0.90 sits in the last
+// 64 KiB-aligned 64 KiB block, 1.0 8 KiB from the end aligned to 4 KiB,
+// 1.1 at the start and 1.2 4 KiB from the start.
+const (
+	mdMagic          = 0xa92b4efc
+	md1Offset        = 4096
+	md090Reserved    = 64 * 1024
+	md10FromEnd      = 8 * 1024
+	md10AlignmentEnd = 4 * 1024
+)
+
+// LVM2 physical volume label: LABELONE in one of the first four sectors,
+// with the label type 24 bytes in
+const (
+	lvmLabel          = "LABELONE"
+	lvmType           = "LVM2 001"
+	lvmTypeOffset     = 24
+	lvmLabelSectors   = 4
+	lvmLabelSectorLen = 512
+)
+
+// Partition table signatures: the GPT header in LBA 1 (512-byte or 4Kn
+// sectors) and the MBR boot signature with its partition entries
+const (
+	gptMagic            = "EFI PART"
+	mbrSignatureOffset  = 510
+	mbrSignature        = "\x55\xaa"
+	mbrPartitionOffset  = 446
+	mbrPartitionEntries = 4
+	mbrPartitionSize    = 16
+	mbrPartitionType    = 4
+)
+
+// Signature is an on-disk signature found by ProbeSignatures
+type Signature struct {
+	Type   string // blkid name, e.g. "crypto_LUKS", "ext4", "LVM2_member"
+	Usage  string // One of the SignatureUsage constants
+	Offset int64  // Byte offset of the magic on the device
+}
+
+// String describes s like wipefs: type and offset
+func (s Signature) String() string {
+	return fmt.Sprintf("%s at offset 0x%x", s.Type, s.Offset)
+}
+
+// joinSignatures lists sigs for a message
+func joinSignatures(sigs []Signature) string {
+	found := make([]string, len(sigs))
+	for i, s := range sigs {
+		found[i] = s.String()
+	}
+	return strings.Join(found, ", ")
+}
+
+// SignatureError reports the signatures that made Format refuse a device.
+// It matches ErrDeviceNotEmpty.
+type SignatureError struct {
+	Device     string
+	Signatures []Signature
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%v: %s holds %s (set Force to format it anyway)", ErrDeviceNotEmpty, e.Device, joinSignatures(e.Signatures))
+}
+
+func (e *SignatureError) Unwrap() error {
+	return ErrDeviceNotEmpty
+}
+
+// ProbeSignatures lists the filesystem, swap, RAID, LVM, partition table and
+// LUKS (primary and secondary header) signatures on device, like wipefs
+// without --all, ordered by offset. Filesystems are only recognized on
+// Linux. A device too short to hold a signature has none.
+func ProbeSignatures(device string) ([]Signature, error) {
+	f, err := os.Open(device) // #nosec G304 -- device path supplied by caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device size: %w", err)
+	}
+
+	buf := make([]byte, swapPageSizes[len(swapPageSizes)-1])
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read device: %w", err)
+	}
+	buf = buf[:n]
+
+	sigs, err := probeLUKSSignatures(f)
+	if err != nil {
+		return nil, err
+	}
+	sigs = append(sigs, probeStartSignatures(buf)...)
+	md, err := probeMDSignatures(f, size)
+	if err != nil {
+		return nil, err
+	}
+	sigs = append(sigs, md...)
+
+	sort.SliceStable(sigs, func(i, j int) bool { return sigs[i].Offset < sigs[j].Offset })
+	return sigs, nil
+}
+
+// probeLUKSSignatures finds the primary header and a secondary header at
+// any of the offsets it may sit at
+func probeLUKSSignatures(r io.ReaderAt) ([]Signature, error) {
+	var sigs []Signature
+	magic := make([]byte, LUKS2MagicLen)
+	for _, off := range append([]int64{0}, secondaryHeaderOffsets()...) {
+		if _, err := r.ReadAt(magic, off); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read device: %w", err)
+		}
+		if bytes.Equal(magic, []byte(LUKS2Magic)) || bytes.Equal(magic, []byte(LUKS2MagicBackup)) {
+			sigs = append(sigs, Signature{Type: "crypto_LUKS", Usage: SignatureUsageCrypto, Offset: off})
+		}
+	}
+	return sigs, nil
+}
+
+// probeStartSignatures finds the signatures within the first bytes of a
+// device: filesystems, swap, an LVM2 label and partition tables
+func probeStartSignatures(buf []byte) []Signature {
+	var sigs []Signature
+
+	fs, isFS := filesystemSignature(buf)
+	if isFS {
+		sigs = append(sigs, fs)
+	}
+
+	for _, page := range swapPageSizes {
+		off := page - int64(len(swapMagic))
+		if int64(len(buf)) < page {
+			break
+		}
+		if magic := string(buf[off:page]); magic == swapMagic || magic == swapMagicV0 {
+			sigs = append(sigs, Signature{Type: "swap", Usage: SignatureUsageOther, Offset: off})
+			break
+		}
+	}
+
+	for i := int64(0); i < lvmLabelSectors; i++ {
+		off := i * lvmLabelSectorLen
+		if int64(len(buf)) < off+lvmTypeOffset+int64(len(lvmType)) {
+			break
+		}
+		if string(buf[off:off+int64(len(lvmLabel))]) == lvmLabel && string(buf[off+lvmTypeOffset:off+lvmTypeOffset+int64(len(lvmType))]) == lvmType {
+			sigs = append(sigs, Signature{Type: "LVM2_member", Usage: SignatureUsageRAID, Offset: off + lvmTypeOffset})
+			break
+		}
+	}
+
+	gpt := false
+	for _, off := range []int{512, 4096} {
+		if len(buf) >= off+len(gptMagic) && string(buf[off:off+len(gptMagic)]) == gptMagic {
+			sigs = append(sigs, Signature{Type: "gpt", Usage: SignatureUsagePartitionTable, Offset: int64(off)})
+			gpt = true
+			break
+		}
+	}
+	// A FAT boot sector carries the same boot signature; a protective MBR
+	// is part of the GPT already reported
+	if !gpt && !isFS && hasMBRPartitions(buf) {
+		sigs = append(sigs, Signature{Type: "dos", Usage: SignatureUsagePartitionTable, Offset: mbrSignatureOffset})
+	}
+
+	return sigs
+}
+
+// hasMBRPartitions reports whether buf starts with an MBR listing at least
+// one partition
+func hasMBRPartitions(buf []byte) bool {
+	if len(buf) < mbrSignatureOffset+len(mbrSignature) || string(buf[mbrSignatureOffset:mbrSignatureOffset+len(mbrSignature)]) != mbrSignature {
+		return false
+	}
+	for i := 0; i < mbrPartitionEntries; i++ {
+		if buf[mbrPartitionOffset+i*mbrPartitionSize+mbrPartitionType] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// probeMDSignatures finds MD RAID superblocks of any metadata version on a
+// device of size bytes
+func probeMDSignatures(r io.ReaderAt, size int64) ([]Signature, error) {
+	offsets := []int64{0, md1Offset}
+	if size >= md090Reserved {
+		offsets = append(offsets, size&^(md090Reserved-1)-md090Reserved)
+	}
+	if size >= md10FromEnd {
+		offsets = append(offsets, (size-md10FromEnd)&^(md10AlignmentEnd-1))
+	}
+
+	var sigs []Signature
+	seen := make(map[int64]bool)
+	magic := make([]byte, 4)
+	for _, off := range offsets {
+		if seen[off] {
+			continue
+		}
+		seen[off] = true
+		if _, err := r.ReadAt(magic, off); err == io.EOF {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read device: %w", err)
+		}
+		if binary.LittleEndian.Uint32(magic) == mdMagic {
+			sigs = append(sigs, Signature{Type: "linux_raid_member", Usage: SignatureUsageRAID, Offset: off})
+		}
+	}
+	return sigs, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// signatureImageSize is the size of the images TestProbeSignatures probes
+const signatureImageSize = 1 << 20
+
+// signatureImage returns a zeroed image with data written at offset
+func signatureImage(offset int, data []byte) []byte {
+	buf := make([]byte, signatureImageSize)
+	copy(buf[offset:], data)
+	return buf
+}
+
+func TestProbeSignatures(t *testing.T) {
+	mdMagicBytes := binary.LittleEndian.AppendUint32(nil, mdMagic)
+	lvm := make([]byte, 32)
+	copy(lvm, lvmLabel)
+	copy(lvm[lvmTypeOffset:], lvmType)
+	mbr := make([]byte, 512)
+	mbr[mbrPartitionOffset+mbrPartitionType] = 0x83
+	copy(mbr[mbrSignatureOffset:], mbrSignature)
+
+	tests := []struct {
+		name  string
+		image []byte
+		want  []Signature
+	}{
+		{"empty", make([]byte, signatureImageSize), nil},
+		{"ext4", signatureImage(0, extImage(0, 0x40, 0)), []Signature{{"ext4", SignatureUsageFilesystem, 0x438}}},
+		{"fat", signatureImage(0, fatImage(fat32TypeOffset, fat32TypeString)), []Signature{{"vfat", SignatureUsageFilesystem, 0x1fe}}},
+		{"swap", signatureImage(4096-len(swapMagic), []byte(swapMagic)), []Signature{{"swap", SignatureUsageOther, 4086}}},
+		{"swap 64k pages", signatureImage(65536-len(swapMagicV0), []byte(swapMagicV0)), []Signature{{"swap", SignatureUsageOther, 65526}}},
+		{"lvm", signatureImage(512, lvm), []Signature{{"LVM2_member", SignatureUsageRAID, 536}}},
+		{"md 1.2", signatureImage(md1Offset, mdMagicBytes), []Signature{{"linux_raid_member", SignatureUsageRAID, 4096}}},
+		{"md 0.90", signatureImage(signatureImageSize-md090Reserved, mdMagicBytes), []Signature{{"linux_raid_member", SignatureUsageRAID, signatureImageSize - md090Reserved}}},
+		{"md 1.0", signatureImage(signatureImageSize-md10FromEnd, mdMagicBytes), []Signature{{"linux_raid_member", SignatureUsageRAID, signatureImageSize - md10FromEnd}}},
+		{"gpt", signatureImage(0, append(append([]byte{}, mbr...), gptMagic...)), []Signature{{"gpt", SignatureUsagePartitionTable, 512}}},
+		{"dos", signatureImage(0, mbr), []Signature{{"dos", SignatureUsagePartitionTable, 510}}},
+		{"empty mbr", signatureImage(mbrSignatureOffset, []byte(mbrSignature)), nil},
+		{"luks secondary", signatureImage(LUKS2HeaderMinSize, []byte(LUKS2MagicBackup)), []Signature{{"crypto_LUKS", SignatureUsageCrypto, LUKS2HeaderMinSize}}},
+		{"short", []byte("LUKS"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProbeSignatures(writeImage(t, tt.image))
+			if err != nil {
+				t.Fatalf("ProbeSignatures failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProbeSignatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeSignatures_Volume(t *testing.T) {
+	got, err := ProbeSignatures(formatTestVolume(t, []byte("test-password")))
+	if err != nil {
+		t.Fatalf("ProbeSignatures failed: %v", err)
+	}
+	want := []Signature{
+		{"crypto_LUKS", SignatureUsageCrypto, 0},
+		{"crypto_LUKS", SignatureUsageCrypto, LUKS2HeaderMinSize},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProbeSignatures() = %v, want %v", got, want)
+	}
+}
+
+func TestFormat_RefusesSignatures(t *testing.T) {
+	image := signatureImage(0, extImage(0, 0x40, 0))
+	copy(image[md1Offset:], binary.LittleEndian.AppendUint32(nil, mdMagic))
+	path := writeImage(t, append(image, make([]byte, 20<<20-len(image))...))
+	opts := FormatOptions{Device: path, Passphrase: []byte("new-password"), KDFType: "pbkdf2", PBKDFIterTime: 10}
+
+	err := Format(opts)
+	var sigErr *SignatureError
+	if !errors.As(err, &sigErr) || !errors.Is(err, ErrDeviceNotEmpty) {
+		t.Fatalf("Format error = %v, want a SignatureError", err)
+	}
+	if len(sigErr.Signatures) != 2 || sigErr.Signatures[0].Type != "ext4" || sigErr.Signatures[1].Type != "linux_raid_member" {
+		t.Errorf("unexpected signatures: %v", sigErr.Signatures)
+	}
+
+	warnings := captureWarnings(t, 0)
+	opts.Force = true
+	if err := Format(opts); err != nil {
+		t.Fatalf("Format with Force failed: %v", err)
+	}
+	var warned bool
+	for _, w := range *warnings {
+		warned = warned || w.Code == WarnExistingSignatures
+	}
+	if !warned {
+		t.Errorf("expected a %s warning, got %v", WarnExistingSignatures, *warnings)
+	}
+}
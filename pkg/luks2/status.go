@@ -0,0 +1,238 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/anatol/devmapper.go"
+	"golang.org/x/sys/unix"
+)
+
+// dmControlPath is the device-mapper control node
+const dmControlPath = "/dev/mapper/control"
+
+// VolumeStatus describes an active dm-crypt mapping, equivalent to the
+// output of cryptsetup status
+type VolumeStatus struct {
+	Name           string   // Device-mapper name
+	UUID           string   // Device-mapper UUID (CRYPT-LUKS2-<uuid>-<name>)
+	Type           string   // Volume type from the mapping UUID (e.g. "LUKS2")
+	Cipher         string   // Cipher specification (e.g. "aes-xts-plain64")
+	KeySize        int      // Volume key size in bits
+	KeyLocation    string   // "dm-crypt" or "keyring"
+	Device         string   // Underlying device path
+	Offset         uint64   // Data offset on the underlying device in 512-byte sectors
+	IVOffset       uint64   // IV offset in sectors
+	Size           uint64   // Mapping size in 512-byte sectors
+	SectorSize     int      // Encryption sector size in bytes
+	Flags          []string // Optional dm-crypt parameters (e.g. "allow_discards")
+	ReadOnly       bool     // Mapping is read-only
+	Suspended      bool     // Mapping is suspended
+	DeferredRemove bool     // Deferred removal pending (Lock with WithDeferred)
+	OpenCount      int      // Number of open handles (mounts, processes)
+}
+
+// InUse reports whether the mapping is held open
+func (s *VolumeStatus) InUse() bool {
+	return s.OpenCount > 0
+}
+
+// dmTarget is one target line of a device-mapper table
+type dmTarget struct {
+	start      uint64
+	length     uint64
+	targetType string
+	params     []byte
+}
+
+// Status returns the dm-crypt details of an active mapping. The volume key
+// is part of the kernel's table but is never copied out of the ioctl buffer,
+// which is wiped before Status returns.
+func Status(name string) (*VolumeStatus, error) {
+	info, err := devmapper.InfoByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeNotUnlocked, name)
+	}
+
+	status := &VolumeStatus{
+		Name:           info.Name,
+		UUID:           info.UUID,
+		Type:           mappingType(info.UUID),
+		ReadOnly:       info.Flags&unix.DM_READONLY_FLAG != 0,
+		Suspended:      info.Flags&unix.DM_SUSPEND_FLAG != 0,
+		DeferredRemove: info.Flags&unix.DM_DEFERRED_REMOVE != 0,
+		OpenCount:      int(info.OpenCount),
+	}
+
+	err = withDMTable(name, func(targets []dmTarget) error {
+		// Volumes with several data segments map to several targets; the
+		// first crypt target describes the encryption
+		var crypt *dmTarget
+		for i := range targets {
+			status.Size += targets[i].length
+			if crypt == nil && targets[i].targetType == "crypt" {
+				crypt = &targets[i]
+			}
+		}
+		if crypt == nil {
+			return fmt.Errorf("%s is not a dm-crypt mapping", name)
+		}
+		return parseCryptParams(crypt.params, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// mappingType extracts the volume type from a CRYPT-<TYPE>-... mapping UUID
+func mappingType(uuid string) string {
+	parts := strings.SplitN(uuid, "-", 3)
+	if len(parts) < 2 || parts[0] != "CRYPT" {
+		return ""
+	}
+	return parts[1]
+}
+
+// parseCryptParams parses a dm-crypt table line:
+// <cipher> <key> <iv_offset> <device> <offset> [<#opt_params> <opt_params>...]
+// The key field is only measured, never copied.
+func parseCryptParams(params []byte, status *VolumeStatus) error {
+	fields := bytes.Fields(params)
+	if len(fields) < 5 {
+		return fmt.Errorf("malformed dm-crypt table")
+	}
+
+	status.Cipher = string(fields[0])
+
+	key := fields[1]
+	if len(key) > 0 && key[0] == ':' {
+		// Kernel keyring reference: :<key_size>:<key_type>:<key_description>
+		status.KeyLocation = "keyring"
+		size, err := strconv.Atoi(string(bytes.SplitN(key[1:], []byte(":"), 2)[0]))
+		if err != nil {
+			return fmt.Errorf("malformed dm-crypt keyring key")
+		}
+		status.KeySize = size * 8
+	} else {
+		status.KeyLocation = "dm-crypt"
+		status.KeySize = len(key) / 2 * 8
+	}
+
+	var err error
+	if status.IVOffset, err = strconv.ParseUint(string(fields[2]), 10, 64); err != nil {
+		return fmt.Errorf("malformed dm-crypt iv offset: %w", err)
+	}
+	status.Device = resolveDevNumber(string(fields[3]))
+	if status.Offset, err = strconv.ParseUint(string(fields[4]), 10, 64); err != nil {
+		return fmt.Errorf("malformed dm-crypt offset: %w", err)
+	}
+
+	status.SectorSize = 512
+	if len(fields) > 5 {
+		for _, opt := range fields[6:] {
+			if size, ok := bytes.CutPrefix(opt, []byte("sector_size:")); ok {
+				if status.SectorSize, err = strconv.Atoi(string(size)); err != nil {
+					return fmt.Errorf("malformed dm-crypt sector size: %w", err)
+				}
+				continue
+			}
+			status.Flags = append(status.Flags, string(opt))
+		}
+	}
+
+	return nil
+}
+
+// resolveDevNumber maps a "major:minor" device to its /dev path using sysfs,
+// returning the input unchanged if it cannot be resolved
+func resolveDevNumber(dev string) string {
+	target, err := filepath.EvalSymlinks(filepath.Join(sysfsRoot, "dev", "block", dev))
+	if err != nil {
+		return dev
+	}
+	return filepath.Join(devRoot, filepath.Base(target))
+}
+
+// withDMTable reads the table of a device-mapper device with DM_TABLE_STATUS
+// and passes its targets to fn. The ioctl buffer holds key material and is
+// wiped when fn returns, so fn must not retain the target params.
+func withDMTable(name string, fn func(targets []dmTarget) error) error {
+	control, err := os.OpenFile(dmControlPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open device-mapper control: %w", err)
+	}
+	defer func() { _ = control.Close() }()
+
+	for size := 16 * 1024; size <= 1024*1024; size *= 2 {
+		buf := make([]byte, size)
+		ioc := (*unix.DmIoctl)(unsafe.Pointer(&buf[0]))
+		ioc.Version = [3]uint32{4, 0, 0}
+		ioc.Data_size = uint32(size) // #nosec G115 - bounded by loop condition
+		ioc.Data_start = unix.SizeofDmIoctl
+		ioc.Flags = unix.DM_STATUS_TABLE_FLAG | unix.DM_SECURE_DATA_FLAG
+		copy(ioc.Name[:], name)
+
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, control.Fd(), unix.DM_TABLE_STATUS, uintptr(unsafe.Pointer(&buf[0])))
+		if errno != 0 {
+			clear(buf)
+			return fmt.Errorf("failed to read device-mapper table: %w", errno)
+		}
+
+		if ioc.Flags&unix.DM_BUFFER_FULL_FLAG != 0 {
+			clear(buf)
+			continue
+		}
+
+		targets, err := parseDMTargets(buf, ioc.Data_start, ioc.Target_count)
+		if err == nil {
+			err = fn(targets)
+		}
+		clear(buf)
+		return err
+	}
+
+	return fmt.Errorf("device-mapper table for %s is too large", name)
+}
+
+// parseDMTargets decodes the dm_target_spec list of a DM_TABLE_STATUS reply
+func parseDMTargets(buf []byte, dataStart, count uint32) ([]dmTarget, error) {
+	data := buf[dataStart:]
+	targets := make([]dmTarget, 0, count)
+	offset := 0
+
+	for i := uint32(0); i < count; i++ {
+		if offset+unix.SizeofDmTargetSpec > len(data) {
+			return nil, fmt.Errorf("truncated device-mapper table")
+		}
+		spec := (*unix.DmTargetSpec)(unsafe.Pointer(&data[offset]))
+
+		params := data[offset+unix.SizeofDmTargetSpec:]
+		if end := bytes.IndexByte(params, 0); end >= 0 {
+			params = params[:end]
+		}
+
+		targets = append(targets, dmTarget{
+			start:      spec.Sector_start,
+			length:     spec.Length,
+			targetType: string(TrimRight(spec.Target_type[:], "\x00")),
+			params:     params,
+		})
+
+		offset = int(spec.Next)
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestParseCryptParams tests parsing dm-crypt table lines
+func TestParseCryptParams(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	loopDir := makeSysfsDevice(t, sys, filepath.Join("devices", "virtual", "block", "loop3"), nil)
+	if err := os.MkdirAll(filepath.Join(sys, "dev", "block"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(loopDir, filepath.Join(sys, "dev", "block", "7:3")); err != nil {
+		t.Fatal(err)
+	}
+
+	key := strings.Repeat("ab", 64)
+	tests := []struct {
+		name   string
+		params string
+		want   VolumeStatus
+	}{
+		{
+			"hex key without options",
+			"aes-xts-plain64 " + key + " 0 7:3 32768",
+			VolumeStatus{Cipher: "aes-xts-plain64", KeySize: 512, KeyLocation: "dm-crypt",
+				Device: filepath.Join(dev, "loop3"), Offset: 32768, SectorSize: 512},
+		},
+		{
+			"keyring key with options",
+			"capi:xts(aes)-plain64 :64:logon:cryptsetup:1234 16 8:17 4096 3 allow_discards sector_size:4096 no_read_workqueue",
+			VolumeStatus{Cipher: "capi:xts(aes)-plain64", KeySize: 512, KeyLocation: "keyring",
+				Device: "8:17", Offset: 4096, IVOffset: 16, SectorSize: 4096,
+				Flags: []string{"allow_discards", "no_read_workqueue"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got VolumeStatus
+			if err := parseCryptParams([]byte(tt.params), &got); err != nil {
+				t.Fatalf("parseCryptParams failed: %v", err)
+			}
+			flagsEqual := slices.Equal(got.Flags, tt.want.Flags)
+			got.Flags, tt.want.Flags = nil, nil
+			if got.Cipher != tt.want.Cipher || got.KeySize != tt.want.KeySize ||
+				got.KeyLocation != tt.want.KeyLocation || got.Device != tt.want.Device ||
+				got.Offset != tt.want.Offset || got.IVOffset != tt.want.IVOffset ||
+				got.SectorSize != tt.want.SectorSize || !flagsEqual {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "aes-xts-plain64 00 0 7:3", "aes-xts-plain64 00 x 7:3 0", "aes :x:logon:k 0 7:3 0"} {
+		if err := parseCryptParams([]byte(bad), &VolumeStatus{}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// TestMappingType tests extracting the volume type from a mapping UUID
+func TestMappingType(t *testing.T) {
+	tests := map[string]string{
+		"CRYPT-LUKS2-0123abcd-data": "LUKS2",
+		"CRYPT-PLAIN-swap":          "PLAIN",
+		"LVM-abcdef":                "",
+		"":                          "",
+	}
+	for uuid, want := range tests {
+		if got := mappingType(uuid); got != want {
+			t.Errorf("mappingType(%q) = %q, want %q", uuid, got, want)
+		}
+	}
+}
+
+// TestParseDMTargets tests decoding a DM_TABLE_STATUS reply buffer
+func TestParseDMTargets(t *testing.T) {
+	const dataStart = unix.SizeofDmIoctl
+	buf := make([]byte, dataStart+256)
+	data := buf[dataStart:]
+
+	params := "aes-xts-plain64 00 0 7:3 32768"
+	binary.NativeEndian.PutUint64(data[0:], 0)
+	binary.NativeEndian.PutUint64(data[8:], 2048)
+	binary.NativeEndian.PutUint32(data[20:], 240)
+	copy(data[24:], "crypt")
+	copy(data[unix.SizeofDmTargetSpec:], params)
+
+	targets, err := parseDMTargets(buf, dataStart, 1)
+	if err != nil {
+		t.Fatalf("parseDMTargets failed: %v", err)
+	}
+	if len(targets) != 1 || targets[0].targetType != "crypt" || targets[0].length != 2048 || string(targets[0].params) != params {
+		t.Errorf("unexpected targets: %+v", targets)
+	}
+
+	// The second spec would start past the end of the buffer
+	if _, err := parseDMTargets(buf, dataStart, 2); err == nil {
+		t.Error("expected error for truncated table")
+	}
+}
+
+// TestStatus_NotActive tests the error for a mapping that does not exist
+func TestStatus_NotActive(t *testing.T) {
+	if _, err := Status("luks2-test-does-not-exist"); !errors.Is(err, ErrVolumeNotUnlocked) {
+		t.Errorf("expected ErrVolumeNotUnlocked, got %v", err)
+	}
+}
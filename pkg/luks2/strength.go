@@ -0,0 +1,363 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Passphrase strength scores returned by EstimateStrength
+const (
+	StrengthVeryWeak = iota
+	StrengthWeak
+	StrengthFair
+	StrengthStrong
+	StrengthVeryStrong
+)
+
+// strengthThresholds are the minimum entropy bits for scores 1-4
+var strengthThresholds = [...]float64{30, 45, 60, 80}
+
+var strengthLabels = [...]string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// PassphraseStrength is an estimate of how hard a passphrase is to guess
+type PassphraseStrength struct {
+	Entropy  float64  // Estimated entropy in bits
+	Score    int      // StrengthVeryWeak (0) to StrengthVeryStrong (4)
+	Feedback []string // Weaknesses found, suitable for display
+}
+
+// Label returns a human-readable name for the score
+func (s PassphraseStrength) Label() string {
+	if s.Score < 0 || s.Score >= len(strengthLabels) {
+		return "unknown"
+	}
+	return strengthLabels[s.Score]
+}
+
+// commonPasswords are ranked, most common first. Matching a word costs
+// log2(rank) bits, so the top entries add almost nothing.
+var commonPasswords = strings.Fields(`
+	password 123456 qwerty letmein dragon monkey football iloveyou admin welcome
+	login princess sunshine master shadow abc123 baseball superman trustno1 hello
+	freedom whatever michael charlie jordan secret starwars batman computer
+	ninja mustang access flower passw0rd master1 hunter killer soccer hockey
+	ranger buster thomas tigger robert daniel jessica pepper ginger summer winter
+	spring autumn love lovely angel cookie cheese pokemon google apple orange
+	banana chocolate diamond silver golden purple yellow matrix internet
+	changeme default guest root toor test testing temp linux ubuntu debian
+	server system backup crypt cryptsetup luks disk encrypt encrypted
+	passphrase pass key keys open sesame mypassword family friends forever
+	qazwsx zaq1 asdf asdfgh zxcvbn money lucky happy secure security
+`)
+
+// l33tSubstitutions maps common character substitutions to the letter they replace
+var l33tSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i',
+	'!': 'i', '|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// keyboardRows are the US keyboard rows checked for straight-line patterns
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"~!@#$%^&*()_+", "qwertyuiop{}|", "asdfghjkl:\"", "zxcvbnm<>?",
+}
+
+// strengthMatch is a guessable pattern covering runes [i, j)
+type strengthMatch struct {
+	i, j     int
+	bits     float64
+	feedback string
+}
+
+// EstimateStrength estimates passphrase entropy in the style of zxcvbn: the
+// passphrase is covered by the cheapest combination of common passwords
+// (including l33t and reversed forms), keyboard runs, sequences, repeats,
+// years and brute-forced characters. It works on rune slices that are
+// cleared before returning, so no copy of the passphrase outlives the call.
+func EstimateStrength(passphrase []byte) PassphraseStrength {
+	runes := make([]rune, 0, utf8.RuneCount(passphrase))
+	for p := passphrase; len(p) > 0; {
+		r, size := utf8.DecodeRune(p)
+		runes = append(runes, r)
+		p = p[size:]
+	}
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	defer clear(runes)
+	defer clear(lower)
+
+	matches := dictionaryMatches(runes, lower)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	// best[j] is the minimum entropy of any cover of runes[:j]
+	charBits := math.Log2(float64(bruteforceCardinality(runes)))
+	best := make([]float64, len(runes)+1)
+	via := make([]int, len(runes)+1)
+	for j := 1; j <= len(runes); j++ {
+		best[j] = best[j-1] + charBits
+		via[j] = -1
+		for k, m := range matches {
+			if m.j == j && best[m.i]+m.bits < best[j] {
+				best[j] = best[m.i] + m.bits
+				via[j] = k
+			}
+		}
+	}
+
+	s := PassphraseStrength{Entropy: best[len(runes)]}
+	for s.Score < len(strengthThresholds) && s.Entropy >= strengthThresholds[s.Score] {
+		s.Score++
+	}
+
+	seen := make(map[string]bool)
+	for j := len(runes); j > 0; {
+		k := via[j]
+		if k < 0 {
+			j--
+			continue
+		}
+		if fb := matches[k].feedback; !seen[fb] {
+			seen[fb] = true
+			s.Feedback = append(s.Feedback, fb)
+		}
+		j = matches[k].i
+	}
+	slices.Reverse(s.Feedback)
+	if len(runes) < 12 {
+		s.Feedback = append(s.Feedback, "use at least 12 characters; several unrelated words work well")
+	}
+	return s
+}
+
+// bruteforceCardinality returns the size of the alphabet the passphrase draws from
+func bruteforceCardinality(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			n += class.size
+		}
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// dictionaryMatches finds common passwords, forwards, reversed and with
+// l33t substitutions
+func dictionaryMatches(runes, lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	for rank, word := range commonPasswords {
+		w := []rune(word)
+		for i := 0; i+len(w) <= len(lower); i++ {
+			span := lower[i : i+len(w)]
+			for _, reversed := range []bool{false, true} {
+				subs, ok := matchWord(span, w, reversed)
+				if !ok {
+					continue
+				}
+				bits := math.Log2(float64(rank+1)) + caseBits(runes[i:i+len(w)]) + float64(subs)
+				if reversed {
+					bits++
+				}
+				matches = append(matches, strengthMatch{i, i + len(w), bits, "contains a common word or password"})
+			}
+		}
+	}
+	return matches
+}
+
+// matchWord reports whether span spells word, allowing l33t substitutions,
+// and how many substitutions were needed
+func matchWord(span, word []rune, reversed bool) (int, bool) {
+	subs := 0
+	for k, r := range span {
+		want := word[k]
+		if reversed {
+			want = word[len(word)-1-k]
+		}
+		if r == want {
+			continue
+		}
+		if l, ok := l33tSubstitutions[r]; ok && l == want {
+			subs++
+			continue
+		}
+		return 0, false
+	}
+	return subs, true
+}
+
+// caseBits estimates the extra entropy of a word's capitalization
+func caseBits(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0 || (upper == 1 && unicode.IsUpper(word[0])):
+		return 1
+	}
+
+	// Any other placement: sum of C(upper+lower, k) for k up to the minority count
+	var variations float64
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return math.Log2(variations)
+}
+
+// binomial returns n choose k
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
+
+// keyboardMatches finds runs of 3 or more adjacent keys on one row, in
+// either direction
+func keyboardMatches(lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(lower)-1; {
+		j := i + 1
+		for j < len(lower) && keyboardAdjacent(lower[j-1], lower[j]) {
+			j++
+		}
+		if j-i >= 3 {
+			matches = append(matches, strengthMatch{i, j, math.Log2(47) + math.Log2(float64(j-i)), "contains a keyboard pattern like qwerty"})
+		}
+		if j > i+1 {
+			i = j - 1
+		} else {
+			i++
+		}
+	}
+	return matches
+}
+
+// keyboardAdjacent reports whether b is next to a on the same keyboard row
+func keyboardAdjacent(a, b rune) bool {
+	for _, row := range keyboardRows {
+		ia, ib := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if ia >= 0 && ib >= 0 && (ia-ib == 1 || ib-ia == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceMatches finds ascending or descending runs such as abc, 4321 or XYZ
+func sequenceMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes)-2; {
+		delta := runes[i+1] - runes[i]
+		if (delta != 1 && delta != -1) || sequenceClass(runes[i]) == 0 || sequenceClass(runes[i]) != sequenceClass(runes[i+1]) {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < len(runes) && runes[j]-runes[j-1] == delta && sequenceClass(runes[j]) == sequenceClass(runes[i]) {
+			j++
+		}
+		if j-i >= 3 {
+			base := float64(sequenceClass(runes[i]))
+			if strings.ContainsRune("aAzZ019", runes[i]) {
+				base = 4 // obvious starting points
+			}
+			bits := math.Log2(base) + math.Log2(float64(j-i))
+			if delta < 0 {
+				bits++
+			}
+			matches = append(matches, strengthMatch{i, j, bits, "contains a sequence like abc or 123"})
+		}
+		i = j - 1
+	}
+	return matches
+}
+
+// sequenceClass returns the alphabet size of r for sequence detection, or 0
+func sequenceClass(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	}
+	return 0
+}
+
+// repeatMatches finds a character repeated 3 or more times
+func repeatMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= 3 {
+			bits := math.Log2(float64(bruteforceCardinality(runes[i:i+1]))) + math.Log2(float64(j-i))
+			matches = append(matches, strengthMatch{i, j, bits, "contains repeated characters"})
+		}
+		i = j
+	}
+	return matches
+}
+
+// yearMatches finds four-digit years between 1900 and 2039
+func yearMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i+4 <= len(runes); i++ {
+		year := 0
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year >= 1900 && year <= 2039 {
+			matches = append(matches, strengthMatch{i, i + 4, math.Log2(140), "contains a year"})
+		}
+	}
+	return matches
+}
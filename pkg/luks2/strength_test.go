@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestEstimateStrength tests scores for common weak patterns and strong passphrases
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		maxScore   int
+		minScore   int
+		feedback   string
+	}{
+		{"password", StrengthVeryWeak, StrengthVeryWeak, "common word"},
+		{"P@ssw0rd", StrengthVeryWeak, StrengthVeryWeak, "common word"},
+		{"drowssap", StrengthVeryWeak, StrengthVeryWeak, "common word"},
+		{"qwertyuiop", StrengthVeryWeak, StrengthVeryWeak, "keyboard pattern"},
+		{"abcdefgh12345678", StrengthVeryWeak, StrengthVeryWeak, "sequence"},
+		{"aaaaaaaaaaaa", StrengthVeryWeak, StrengthVeryWeak, "repeated"},
+		{"Summer2024", StrengthVeryWeak, StrengthVeryWeak, "year"},
+		{"kq8vz3mw", StrengthWeak, StrengthWeak, "12 characters"},
+		{"xK9#mQ2$vL7&nR4", StrengthVeryStrong, StrengthVeryStrong, ""},
+		{"correct horse battery staple", StrengthVeryStrong, StrengthVeryStrong, ""},
+		{"héllo wörld ünïcode", StrengthVeryStrong, StrengthStrong, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.passphrase, func(t *testing.T) {
+			s := EstimateStrength([]byte(tt.passphrase))
+			if s.Score < tt.minScore || s.Score > tt.maxScore {
+				t.Errorf("score = %d (%.1f bits), want %d-%d", s.Score, s.Entropy, tt.minScore, tt.maxScore)
+			}
+			if tt.feedback == "" && len(s.Feedback) != 0 {
+				t.Errorf("Unexpected feedback: %v", s.Feedback)
+			}
+			if tt.feedback != "" && !slices.ContainsFunc(s.Feedback, func(f string) bool { return strings.Contains(f, tt.feedback) }) {
+				t.Errorf("feedback %v does not mention %q", s.Feedback, tt.feedback)
+			}
+		})
+	}
+}
+
+// TestEstimateStrength_Empty tests that an empty passphrase has no entropy
+func TestEstimateStrength_Empty(t *testing.T) {
+	s := EstimateStrength(nil)
+	if s.Entropy != 0 || s.Score != StrengthVeryWeak || s.Label() != "very weak" {
+		t.Errorf("Unexpected strength: %+v", s)
+	}
+}
+
+// TestEstimateStrength_CaseCostsBits tests that capitalization adds entropy to dictionary words
+func TestEstimateStrength_CaseCostsBits(t *testing.T) {
+	plain := EstimateStrength([]byte("dragon"))
+	capital := EstimateStrength([]byte("Dragon"))
+	mixed := EstimateStrength([]byte("dRaGoN"))
+	if !(plain.Entropy < capital.Entropy && capital.Entropy < mixed.Entropy) {
+		t.Errorf("Expected increasing entropy, got %.1f, %.1f, %.1f", plain.Entropy, capital.Entropy, mixed.Entropy)
+	}
+}
+
+// TestPassphraseStrength_Label tests score labels
+func TestPassphraseStrength_Label(t *testing.T) {
+	if got := (PassphraseStrength{Score: StrengthStrong}).Label(); got != "strong" {
+		t.Errorf("Label = %q", got)
+	}
+	if got := (PassphraseStrength{Score: 9}).Label(); got != "unknown" {
+		t.Errorf("Label = %q", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Network filesystem magic numbers (statfs f_type) for file-backed volumes
+const (
+	nfsSuperMagic  = 0x6969
+	smbSuperMagic  = 0x517B
+	cifsSuperMagic = 0xFF534D42
+	smb2SuperMagic = 0xFE534D42
+	cephSuperMagic = 0x00C36400
+)
+
+// sysfsRoot is the sysfs mount point (overridable for tests)
+var sysfsRoot = "/sys"
+
+// iscsiSessionPattern matches the iSCSI session component of a sysfs device path
+var iscsiSessionPattern = regexp.MustCompile(`/session[0-9]+/`)
+
+// DescribeDevice inspects a device or image file and reports how it is attached.
+// Detection uses sysfs and statfs only; it never opens the device for writing.
+func DescribeDevice(device string) (*DeviceDescription, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		resolved = device
+	}
+
+	desc := &DeviceDescription{
+		Path:         device,
+		ResolvedPath: resolved,
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(resolved, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat device: %w", err)
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		desc.Transport = TransportFile
+		desc.Size = st.Size
+		desc.AllocatedSize = st.Blocks * 512 // st_blocks counts 512-byte units
+		desc.Network = isNetworkFilesystem(resolved)
+		// Image files are attached through loop devices with 512-byte blocks
+		desc.LogicalBlockSize = LUKS2SectorSize
+		desc.PhysicalBlockSize = int(st.Blksize)
+		return desc, nil
+	}
+
+	desc.IsBlockDevice = true
+	if size, err := getBlockDeviceSize(resolved); err == nil {
+		desc.Size = size
+	}
+
+	// #nosec G115 - Rdev is a kernel device number
+	sysDir, err := sysfsDeviceDir(unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev)))
+	if err != nil {
+		// Without sysfs we cannot classify the device; assume local
+		desc.Transport = TransportLocal
+		desc.LogicalBlockSize, desc.PhysicalBlockSize = LUKS2SectorSize, LUKS2SectorSize
+		return desc, nil
+	}
+
+	desc.KernelName = filepath.Base(sysDir)
+	desc.Transport, desc.Network = classifySysfsDevice(sysDir, 0)
+	desc.Rotational = readSysfsQueueAttr(sysDir, "rotational") == "1"
+	desc.LogicalBlockSize, desc.PhysicalBlockSize = sysfsBlockSizes(sysDir)
+
+	return desc, nil
+}
+
+// sysfsBlockSizes reads the logical and physical block sizes of a block
+// device, defaulting to 512 bytes when sysfs does not report them
+func sysfsBlockSizes(sysDir string) (int, int) {
+	size := func(attr string) int {
+		n, err := strconv.Atoi(readSysfsQueueAttr(sysDir, attr))
+		if err != nil || n <= 0 {
+			return LUKS2SectorSize
+		}
+		return n
+	}
+	return size("logical_block_size"), size("physical_block_size")
+}
+
+// sysfsDeviceDir returns the resolved sysfs directory for a block device number
+func sysfsDeviceDir(major, minor uint32) (string, error) {
+	link := filepath.Join(sysfsRoot, "dev", "block", fmt.Sprintf("%d:%d", major, minor))
+	return filepath.EvalSymlinks(link)
+}
+
+// classifySysfsDevice determines the transport of a block device from its
+// resolved sysfs directory. Stacked devices (device-mapper, loop) are
+// considered network-backed when any of their backing devices are.
+func classifySysfsDevice(sysDir string, depth int) (DeviceTransport, bool) {
+	// Partitions (e.g. nbd0p1, loop0p1) inherit the transport of their parent disk
+	if readSysfsAttr(sysDir, "partition") != "" && depth < 8 {
+		return classifySysfsDevice(filepath.Dir(sysDir), depth+1)
+	}
+
+	name := filepath.Base(sysDir)
+
+	switch {
+	case strings.HasPrefix(name, "nbd"):
+		return TransportNBD, true
+	case strings.HasPrefix(name, "rbd"):
+		return TransportRBD, true
+	case iscsiSessionPattern.MatchString(filepath.ToSlash(sysDir) + "/"):
+		return TransportISCSI, true
+	case strings.HasPrefix(name, "loop"):
+		backing := readSysfsAttr(sysDir, "loop/backing_file")
+		return TransportLoop, backing != "" && isNetworkFilesystem(backing)
+	case strings.HasPrefix(name, "dm-"):
+		return TransportDeviceMapper, hasNetworkSlave(sysDir, depth)
+	}
+
+	return TransportLocal, false
+}
+
+// hasNetworkSlave reports whether any backing device of a stacked device is network-backed
+func hasNetworkSlave(sysDir string, depth int) bool {
+	if depth >= 8 {
+		return false // Guard against pathological stacking
+	}
+
+	entries, err := os.ReadDir(filepath.Join(sysDir, "slaves"))
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		slaveDir, err := filepath.EvalSymlinks(filepath.Join(sysDir, "slaves", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if _, network := classifySysfsDevice(slaveDir, depth+1); network {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readSysfsAttr reads and trims a sysfs attribute, returning "" on error
+func readSysfsAttr(sysDir, attr string) string {
+	data, err := os.ReadFile(filepath.Join(sysDir, attr)) // #nosec G304 -- sysfs path constructed from kernel device number
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysfsQueueAttr reads a queue attribute, falling back to the parent
+// device for partitions (which have no queue directory of their own)
+func readSysfsQueueAttr(sysDir, attr string) string {
+	if v := readSysfsAttr(sysDir, filepath.Join("queue", attr)); v != "" {
+		return v
+	}
+	return readSysfsAttr(filepath.Dir(sysDir), filepath.Join("queue", attr))
+}
+
+// isNetworkFilesystem reports whether path lives on a network filesystem
+func isNetworkFilesystem(path string) bool {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return false
+	}
+
+	switch uint32(fs.Type) { // #nosec G115 - filesystem magic numbers are 32-bit
+	case nfsSuperMagic, smbSuperMagic, cifsSuperMagic, smb2SuperMagic, cephSuperMagic:
+		return true
+	default:
+		return false
+	}
+}
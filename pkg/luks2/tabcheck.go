@@ -0,0 +1,78 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Checks reported by CheckTabs in AuditFinding.Check
+const (
+	TabCheckDuplicate  = "duplicate"  // Two entries for one mapping or mount point
+	TabCheckDevice     = "device"     // A crypttab device is missing or is not the volume it names
+	TabCheckRandomKey  = "random-key" // A crypttab entry keys a LUKS volume with random data
+	TabCheckMapping    = "mapping"    // An fstab entry names a mapping crypttab does not create
+	TabCheckContainer  = "container"  // An fstab entry names a LUKS volume instead of its filesystem
+	TabCheckFilesystem = "filesystem" // An fstab type differs from the filesystem in the mapping
+)
+
+// TabReport is the result of CheckTabs
+type TabReport struct {
+	Crypttab int            `json:"crypttab"` // crypttab entries checked
+	Fstab    int            `json:"fstab"`    // fstab entries checked
+	Findings []AuditFinding `json:"findings"`
+}
+
+// Worst returns the severity of the most severe finding ("" = none)
+func (r *TabReport) Worst() AuditSeverity {
+	return worstSeverity(r.Findings)
+}
+
+// add records a finding
+func (r *TabReport) add(severity AuditSeverity, check, object, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, AuditFinding{Severity: severity, Check: check, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+// CheckTabFiles reads a crypttab and an fstab file, either of which may be
+// missing, and checks them with CheckTabs
+func CheckTabFiles(crypttabPath, fstabPath string) (*TabReport, error) {
+	var crypttab []CrypttabEntry
+	err := readTab(crypttabPath, func(r io.Reader) (err error) {
+		crypttab, err = ParseCrypttab(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fstab []FstabEntry
+	err = readTab(fstabPath, func(r io.Reader) (err error) {
+		fstab, err = ParseFstab(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return CheckTabs(crypttab, fstab), nil
+}
+
+// readTab parses the table at path, if it exists
+func readTab(path string, parse func(io.Reader) error) error {
+	f, err := os.Open(path) // #nosec G304 -- table path supplied by caller
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	if err := parse(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FstabEntryFor returns the fstab entry that mounts the filesystem inside
+// the unlocked volume name, for example one opened by luks2 create. The
+// filesystem type is detected; ByUUID also reads its UUID with blkid.
+func FstabEntryFor(name string, opts *FstabOptions) (*FstabEntry, error) {
+	if opts == nil || !strings.HasPrefix(opts.MountPoint, "/") {
+		return nil, fmt.Errorf("mount point must be an absolute path")
+	}
+	if !IsUnlocked(name) {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeNotUnlocked, name)
+	}
+
+	mapperPath := "/dev/mapper/" + name
+	fsType, err := DetectFilesystem(mapperPath)
+	if err != nil {
+		return nil, fmt.Errorf("no filesystem on %s: %w", mapperPath, err)
+	}
+
+	entry := &FstabEntry{Device: mapperPath, MountPoint: opts.MountPoint, Type: string(fsType), Options: opts.Options, Pass: opts.Pass}
+	if opts.ByUUID {
+		info, err := GetFilesystemInfo(mapperPath)
+		if err != nil {
+			return nil, err
+		}
+		if info.UUID == "" {
+			return nil, fmt.Errorf("filesystem on %s has no UUID", mapperPath)
+		}
+		entry.Device = "UUID=" + info.UUID
+	}
+	return entry, nil
+}
+
+// CheckTabs cross-validates crypttab and fstab entries with each other and
+// with the devices they name, reporting what would fail or do damage at
+// boot: crypttab devices that are missing, hold no LUKS header or hold a
+// different volume than their UUID= or LABEL= names; random-key (swap,
+// tmp) entries on a LUKS volume, which would destroy it; fstab entries for
+// mappings crypttab does not create or naming a LUKS volume's UUID instead
+// of its filesystem's; and fstab types that differ from the filesystem of
+// an active mapping. Entries marked nofail or noauto do not stop the boot,
+// so their findings are graded lower.
+func CheckTabs(crypttab []CrypttabEntry, fstab []FstabEntry) *TabReport {
+	r := &TabReport{Crypttab: len(crypttab), Fstab: len(fstab), Findings: []AuditFinding{}}
+
+	names := map[string]bool{}
+	for i := range crypttab {
+		e := &crypttab[i]
+		object := "crypttab " + e.Name
+		if names[e.Name] {
+			r.add(AuditHigh, TabCheckDuplicate, object, "mapping is listed more than once")
+			continue
+		}
+		names[e.Name] = true
+		checkCrypttabEntry(r, object, e)
+	}
+
+	mountPoints := map[string]bool{}
+	for i := range fstab {
+		e := &fstab[i]
+		object := "fstab " + e.MountPoint
+		if e.MountPoint != "none" && e.MountPoint != "swap" {
+			if mountPoints[e.MountPoint] {
+				r.add(AuditMedium, TabCheckDuplicate, object, "mount point is listed more than once")
+			}
+			mountPoints[e.MountPoint] = true
+		}
+		checkFstabEntry(r, object, e, names)
+	}
+	return r
+}
+
+// bootSeverity grades a finding that stops an entry from activating: high,
+// unless the entry is optional at boot
+func bootSeverity(options []string) AuditSeverity {
+	if slices.Contains(options, "nofail") || slices.Contains(options, "noauto") {
+		return AuditMedium
+	}
+	return AuditHigh
+}
+
+// checkCrypttabEntry checks the device of a crypttab entry
+func checkCrypttabEntry(r *TabReport, object string, e *CrypttabEntry) {
+	device, err := tabDevice(e.Device)
+	if err != nil {
+		r.add(bootSeverity(e.Options), TabCheckDevice, object, "device %s not found: %v", e.Device, err)
+		return
+	}
+
+	if e.Ephemeral() {
+		if hasLUKSSignature(device) {
+			r.add(AuditCritical, TabCheckRandomKey, object, "%s holds a LUKS volume, which keying it with %s at boot would destroy", e.Device, e.KeyFile)
+		}
+		return
+	}
+
+	// Volumes of other types, and detached headers, are checked elsewhere
+	header := device
+	for _, option := range e.Options {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "plain", "tcrypt", "bitlk", "fvault2":
+			return
+		case "header":
+			if header, err = tabDevice(value); err != nil {
+				r.add(bootSeverity(e.Options), TabCheckDevice, object, "header %s not found: %v", value, err)
+				return
+			}
+		}
+	}
+
+	id, err := readLUKS2Identity(header)
+	if err != nil {
+		if !hasLUKSSignature(header) {
+			r.add(bootSeverity(e.Options), TabCheckDevice, object, "%s holds no LUKS header", header)
+		}
+		return
+	}
+	if uuid, ok := strings.CutPrefix(e.Device, "UUID="); ok && !strings.EqualFold(uuid, id.UUID) {
+		r.add(bootSeverity(e.Options), TabCheckDevice, object, "%s resolves to %s, whose header UUID is %s", e.Device, device, id.UUID)
+	}
+	if label, ok := strings.CutPrefix(e.Device, "LABEL="); ok && label != id.Label {
+		r.add(bootSeverity(e.Options), TabCheckDevice, object, "%s resolves to %s, whose header label is %q", e.Device, device, id.Label)
+	}
+}
+
+// checkFstabEntry checks the device of an fstab entry against the
+// mappings crypttab creates
+func checkFstabEntry(r *TabReport, object string, e *FstabEntry, mappings map[string]bool) {
+	if uuid, ok := strings.CutPrefix(e.Device, "UUID="); ok {
+		if device, err := FindDeviceByUUID(uuid); err == nil {
+			r.add(bootSeverity(e.Options), TabCheckContainer, object,
+				"UUID %s is the LUKS volume on %s, not the filesystem inside it; use /dev/mapper/<name> or the filesystem's UUID", uuid, device)
+		}
+		return
+	}
+
+	name, ok := strings.CutPrefix(e.Device, "/dev/mapper/")
+	if !ok {
+		return
+	}
+	if !mappings[name] {
+		if _, err := Status(name); err == nil {
+			r.add(bootSeverity(e.Options), TabCheckMapping, object, "%s was opened by hand and no crypttab entry creates it, so it will be missing after a reboot", e.Device)
+		} else if _, err := os.Stat(filepath.Join(devRoot, "mapper", name)); err != nil {
+			r.add(bootSeverity(e.Options), TabCheckMapping, object, "no crypttab entry creates %s and it does not exist", e.Device)
+		}
+		return
+	}
+
+	// The filesystem can only be checked while the volume is open
+	if e.Type == "auto" || e.Type == "swap" || !IsUnlocked(name) {
+		return
+	}
+	if fsType, err := DetectFilesystem(e.Device); err == nil && string(fsType) != e.Type {
+		r.add(bootSeverity(e.Options), TabCheckFilesystem, object, "type is %s but %s holds %s", e.Type, e.Device, fsType)
+	}
+}
+
+// tabDeviceLinks are the udev link directories of crypttab and fstab
+// device tags
+var tabDeviceLinks = []struct{ tag, dir string }{
+	{"UUID=", "by-uuid"},
+	{"LABEL=", "by-label"},
+	{"PARTUUID=", "by-partuuid"},
+	{"PARTLABEL=", "by-partlabel"},
+}
+
+// tabDevice resolves the device field of a crypttab or fstab entry. Tags
+// are looked up through their udev links; UUID= and LABEL= fall back to
+// scanning for a LUKS2 volume like ResolveDevice.
+func tabDevice(spec string) (string, error) {
+	for _, l := range tabDeviceLinks {
+		value, ok := strings.CutPrefix(spec, l.tag)
+		if !ok {
+			continue
+		}
+		if l.tag == "LABEL=" || l.tag == "PARTLABEL=" {
+			value = encodeUdevLabel(value)
+		}
+		link := filepath.Join(devRoot, "disk", l.dir, value)
+		if device, err := filepath.EvalSymlinks(link); err == nil {
+			return device, nil
+		}
+		if l.tag == "UUID=" || l.tag == "LABEL=" {
+			return ResolveDevice(spec)
+		}
+		return "", fmt.Errorf("%w: no %s", ErrDeviceNotFound, link)
+	}
+	if _, err := os.Stat(spec); err != nil {
+		return "", err
+	}
+	return spec, nil
+}
+
+// hasLUKSSignature reports whether device holds a LUKS1 or LUKS2 header
+func hasLUKSSignature(device string) bool {
+	sigs, err := ProbeSignatures(device)
+	if err != nil {
+		return false
+	}
+	for _, sig := range sigs {
+		if sig.Type == "crypto_LUKS" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckTabs(t *testing.T) {
+	sys, dev := fakeBlockRoots(t)
+	swapHeader, _ := fakeLUKS2Header(t, "")
+	dataHeader, dataUUID := fakeLUKS2Header(t, "data")
+	_, staleUUID := fakeLUKS2Header(t, "")
+	sda := addFakeBlockDevice(t, sys, dev, "sda", "8", swapHeader)
+	sdb := addFakeBlockDevice(t, sys, dev, "sdb", "8", dataHeader)
+	sdc := addFakeBlockDevice(t, sys, dev, "sdc", "8", make([]byte, 4096))
+
+	// A by-uuid link left pointing at another volume
+	links := filepath.Join(dev, "disk", "by-uuid")
+	if err := os.MkdirAll(links, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(sdb, filepath.Join(links, staleUUID)); err != nil {
+		t.Fatal(err)
+	}
+
+	crypttab := []CrypttabEntry{
+		{Name: "data", Device: "UUID=" + dataUUID},
+		{Name: "stale", Device: "UUID=" + staleUUID},
+		{Name: "cryptswap", Device: sda, KeyFile: "/dev/urandom", Options: []string{"swap"}},
+		{Name: "empty", Device: sdc, Options: []string{"luks"}},
+		{Name: "plain", Device: sdc, Options: []string{"plain"}},
+		{Name: "gone", Device: "UUID=00000000-0000-0000-0000-000000000000", Options: []string{"nofail"}},
+		{Name: "data", Device: sdb},
+	}
+	fstab := []FstabEntry{
+		{Device: "/dev/mapper/data", MountPoint: "/srv", Type: "ext4"},
+		{Device: "/dev/mapper/ghost", MountPoint: "/ghost", Type: "ext4"},
+		{Device: "UUID=" + dataUUID, MountPoint: "/container", Type: "ext4"},
+		{Device: "/dev/mapper/cryptswap", MountPoint: "none", Type: "swap"},
+		{Device: "/dev/sdd1", MountPoint: "/srv", Type: "ext4"},
+	}
+
+	r := CheckTabs(crypttab, fstab)
+	want := map[string]AuditFinding{
+		"crypttab stale":     {Severity: AuditHigh, Check: TabCheckDevice},
+		"crypttab cryptswap": {Severity: AuditCritical, Check: TabCheckRandomKey},
+		"crypttab empty":     {Severity: AuditHigh, Check: TabCheckDevice},
+		"crypttab gone":      {Severity: AuditMedium, Check: TabCheckDevice},
+		"crypttab data":      {Severity: AuditHigh, Check: TabCheckDuplicate},
+		"fstab /ghost":       {Severity: AuditHigh, Check: TabCheckMapping},
+		"fstab /container":   {Severity: AuditHigh, Check: TabCheckContainer},
+		"fstab /srv":         {Severity: AuditMedium, Check: TabCheckDuplicate},
+	}
+	if len(r.Findings) != len(want) {
+		t.Errorf("got %d findings, want %d: %v", len(r.Findings), len(want), r.Findings)
+	}
+	for _, f := range r.Findings {
+		w, ok := want[f.Object]
+		if !ok || f.Severity != w.Severity || f.Check != w.Check {
+			t.Errorf("unexpected finding: %v (%s)", f, f.Check)
+		}
+	}
+	if r.Crypttab != len(crypttab) || r.Fstab != len(fstab) || r.Worst() != AuditCritical {
+		t.Errorf("report = %d crypttab, %d fstab, worst %q", r.Crypttab, r.Fstab, r.Worst())
+	}
+}
+
+func TestCheckTabFiles(t *testing.T) {
+	dir := t.TempDir()
+	crypttab, fstab := filepath.Join(dir, "crypttab"), filepath.Join(dir, "fstab")
+	if err := os.WriteFile(fstab, []byte("/dev/mapper/ghost /ghost ext4 nofail 0 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing crypttab creates no mappings
+	r, err := CheckTabFiles(crypttab, fstab)
+	if err != nil {
+		t.Fatalf("CheckTabFiles failed: %v", err)
+	}
+	if r.Crypttab != 0 || r.Fstab != 1 || len(r.Findings) != 1 || r.Findings[0].Check != TabCheckMapping || r.Worst() != AuditMedium {
+		t.Errorf("unexpected report: %+v", r)
+	}
+
+	if err := os.WriteFile(crypttab, []byte("lonely\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckTabFiles(crypttab, fstab); err == nil {
+		t.Error("Expected error for a malformed crypttab")
+	}
+}
+
+func TestFstabEntryFor(t *testing.T) {
+	if _, err := FstabEntryFor("data", &FstabOptions{MountPoint: "srv"}); err == nil {
+		t.Error("Expected error for a relative mount point")
+	}
+	if _, err := FstabEntryFor("luks2-test-not-open", &FstabOptions{MountPoint: "/srv"}); err == nil {
+		t.Error("Expected error for a volume that is not unlocked")
+	}
+}
@@ -25,7 +25,7 @@ func GetToken(device string, tokenID int) (*Token, error) {
 		return nil, fmt.Errorf("invalid token ID: %d (must be 0-%d)", tokenID, MaxTokenSlots-1)
 	}
 
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -45,7 +45,7 @@ func GetToken(device string, tokenID int) (*Token, error) {
 
 // ListTokens returns all tokens from a LUKS2 device
 func ListTokens(device string) (map[int]*Token, error) {
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -108,7 +108,7 @@ func ImportToken(device string, tokenID int, token *Token) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read current header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -162,7 +162,7 @@ func RemoveToken(device string, tokenID int) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read current header and metadata
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -197,24 +197,20 @@ func RemoveToken(device string, tokenID int) error {
 
 // FindFreeTokenSlot finds the first available token slot
 func FindFreeTokenSlot(device string) (int, error) {
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return -1, fmt.Errorf("failed to read LUKS header: %w", err)
 	}
+	return freeTokenSlot(metadata)
+}
 
-	// If no tokens exist, slot 0 is free
-	if metadata.Tokens == nil {
-		return 0, nil
-	}
-
-	// Find first free slot
+// freeTokenSlot returns the first token slot not used in metadata
+func freeTokenSlot(metadata *LUKS2Metadata) (int, error) {
 	for i := 0; i < MaxTokenSlots; i++ {
-		tokenKey := strconv.Itoa(i)
-		if _, exists := metadata.Tokens[tokenKey]; !exists {
+		if _, exists := metadata.Tokens[strconv.Itoa(i)]; !exists {
 			return i, nil
 		}
 	}
-
 	return -1, ErrNoFreeTokenSlot
 }
 
@@ -224,7 +220,7 @@ func TokenExists(device string, tokenID int) (bool, error) {
 		return false, fmt.Errorf("invalid token ID: %d (must be 0-%d)", tokenID, MaxTokenSlots-1)
 	}
 
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return false, fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -240,7 +236,7 @@ func TokenExists(device string, tokenID int) (bool, error) {
 
 // CountTokens returns the number of tokens in the LUKS2 header
 func CountTokens(device string) (int, error) {
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read LUKS header: %w", err)
 	}
@@ -0,0 +1,279 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// TokenHandlerPrefix starts the name of external token handler binaries:
+// tokens of type T are handled by TokenHandlerPrefix+T
+const TokenHandlerPrefix = "luks2-token-"
+
+// DefaultTokenHandlerDir is where external token handlers are looked up,
+// like cryptsetup's token plugin directory. Handlers are never searched
+// for in $PATH.
+const DefaultTokenHandlerDir = "/usr/lib/luks2/tokens"
+
+// ErrNoTokenHandler is returned when no token of a volume has a handler
+var ErrNoTokenHandler = errors.New("no token handler")
+
+// tokenTypePattern limits the token types that name an external handler,
+// so a type read from the header cannot reach outside the handler directory
+var tokenTypePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// TokenRequest describes the token a passphrase is requested for
+type TokenRequest struct {
+	Device  string // Device path
+	UUID    string // LUKS2 header UUID
+	TokenID int    // ID of the token in the header
+	Token   *Token // The token; members of unknown types are in Token.Extra
+}
+
+// TokenHandler obtains the passphrase of the keyslots a token is linked
+// to, for token types this package does not handle itself. It is the Go
+// counterpart of a cryptsetup token plugin. The caller clears the returned
+// passphrase. A handler with nothing to offer returns ErrNoCredential.
+type TokenHandler interface {
+	Passphrase(ctx context.Context, req TokenRequest) ([]byte, error)
+}
+
+// TokenHandlerFunc adapts an ordinary function to a TokenHandler
+type TokenHandlerFunc func(ctx context.Context, req TokenRequest) ([]byte, error)
+
+// Passphrase calls f(ctx, req)
+func (f TokenHandlerFunc) Passphrase(ctx context.Context, req TokenRequest) ([]byte, error) {
+	return f(ctx, req)
+}
+
+// ExecTokenHandler is an external token handler binary. It is run with
+// the device path as its only argument and the token JSON on standard
+// input; LUKS2_DEVICE, LUKS2_UUID, LUKS2_TOKEN_ID and LUKS2_TOKEN_TYPE are
+// added to its environment. It prints the passphrase on standard output,
+// where one trailing newline is dropped, and exits 0. Any other exit
+// status fails the token, with standard error as the reason.
+type ExecTokenHandler string
+
+// Passphrase runs the handler for req
+func (h ExecTokenHandler) Passphrase(ctx context.Context, req TokenRequest) ([]byte, error) {
+	tokenJSON, err := json.Marshal(req.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode token: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, string(h), req.Device) // #nosec G204 -- handler from the configured handler directory
+	cmd.Stdin = bytes.NewReader(tokenJSON)
+	cmd.Env = append(os.Environ(),
+		"LUKS2_DEVICE="+req.Device,
+		"LUKS2_UUID="+req.UUID,
+		"LUKS2_TOKEN_ID="+strconv.Itoa(req.TokenID),
+		"LUKS2_TOKEN_TYPE="+req.Token.Type,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	defer clearBytes(out)
+
+	if err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("%s: %w: %s", h, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", h, err)
+	}
+	passphrase := bytes.TrimSuffix(out, []byte("\n"))
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("%s: %w", h, ErrNoCredential)
+	}
+	return bytes.Clone(passphrase), nil
+}
+
+var (
+	tokenHandlersMu sync.RWMutex
+	tokenHandlers   = map[string]TokenHandler{}
+)
+
+// RegisterTokenHandler makes h handle tokens of tokenType in
+// UnlockWithToken, taking precedence over an external handler. A nil h
+// removes the registration. The token types this package implements
+// cannot be registered.
+func RegisterTokenHandler(tokenType string, h TokenHandler) error {
+	switch tokenType {
+	case "":
+		return errors.New("token type cannot be empty")
+	case TokenTypePKCS11, TokenTypeEscrow, TokenTypeAnnotation:
+		return fmt.Errorf("token type %q is handled by this package", tokenType)
+	}
+
+	tokenHandlersMu.Lock()
+	defer tokenHandlersMu.Unlock()
+	if h == nil {
+		delete(tokenHandlers, tokenType)
+	} else {
+		tokenHandlers[tokenType] = h
+	}
+	return nil
+}
+
+// TokenUnlockOptions contains optional settings for UnlockWithToken
+type TokenUnlockOptions struct {
+	// TokenID restricts unlocking to a single token (nil = every token with
+	// a handler, in ID order)
+	TokenID *int
+
+	// TokenType restricts unlocking to tokens of this type ("" = any type)
+	TokenType string
+
+	// External runs TokenHandlerPrefix+type from HandlerDir for token types
+	// without a registered handler. Handlers run with the privileges of the
+	// caller, so only trusted directories should be used.
+	External bool
+
+	// HandlerDir is the directory of external handlers (""
+	// = DefaultTokenHandlerDir)
+	HandlerDir string
+
+	// Unlock holds the dm-crypt flags of the mapping (nil = defaults)
+	Unlock *UnlockOptions
+}
+
+// tokenHandler returns the handler for tokens of tokenType, or nil
+func tokenHandler(tokenType string, opts *TokenUnlockOptions) TokenHandler {
+	tokenHandlersMu.RLock()
+	h := tokenHandlers[tokenType]
+	tokenHandlersMu.RUnlock()
+	if h != nil || !opts.External || !tokenTypePattern.MatchString(tokenType) {
+		return h
+	}
+
+	dir := opts.HandlerDir
+	if dir == "" {
+		dir = DefaultTokenHandlerDir
+	}
+	path := filepath.Join(dir, TokenHandlerPrefix+tokenType)
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+		return nil
+	}
+	return ExecTokenHandler(path)
+}
+
+// UnlockWithToken opens a volume with a passphrase obtained by the handler
+// of one of its tokens: a handler registered with RegisterTokenHandler or,
+// with opts.External, an external handler binary. Tokens are tried in ID
+// order, and each passphrase only opens the keyslots its token lists.
+// Fails with ErrNoTokenHandler if no token has a handler (nil opts =
+// registered handlers, every token).
+func UnlockWithToken(ctx context.Context, device, name string, opts *TokenUnlockOptions) error {
+	if opts == nil {
+		opts = &TokenUnlockOptions{}
+	}
+	if unlocksRegion(opts.Unlock) {
+		return unlockRegion(device, opts.Unlock, func(loop string, region *UnlockOptions) error {
+			regionOpts := *opts
+			regionOpts.Unlock = region
+			return UnlockWithToken(ctx, loop, name, &regionOpts)
+		})
+	}
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	if IsUnlocked(name) {
+		return fmt.Errorf("device mapper '%s' already exists - close it first with: luks close %s", name, name)
+	}
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+
+	if err := checkKernelCiphers(metadata); err != nil {
+		return err
+	}
+
+	masterKey, err := tokenMasterKey(ctx, device, headerUUID(hdr), metadata, opts)
+	if err != nil {
+		return err
+	}
+	defer masterKey.Destroy()
+
+	realDevice, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		realDevice = device
+	}
+	if err := activateVolume(device, realDevice, hdr, metadata, masterKey.Bytes(), name, cryptFlags(metadata, opts.Unlock)); err != nil {
+		return err
+	}
+	return autoDetachLoop(realDevice, name, opts.Unlock)
+}
+
+// tokenMasterKey recovers the master key through the first token whose
+// handler supplies a passphrase that opens one of its keyslots
+func tokenMasterKey(ctx context.Context, device, uuid string, metadata *LUKS2Metadata, opts *TokenUnlockOptions) (*securemem.Buffer, error) {
+	var errs []error
+	for _, id := range sortedIDs(metadata.Tokens) {
+		token := metadata.Tokens[id]
+		tokenID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		if (opts.TokenID != nil && *opts.TokenID != tokenID) || (opts.TokenType != "" && opts.TokenType != token.Type) {
+			continue
+		}
+		handler := tokenHandler(token.Type, opts)
+		if handler == nil {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		passphrase, err := handler.Passphrase(ctx, TokenRequest{Device: device, UUID: uuid, TokenID: tokenID, Token: token})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token %d: %w", tokenID, err))
+			continue
+		}
+
+		masterKey, err := tokenKeyslotsKey(device, passphrase, metadata, token)
+		clearBytes(passphrase)
+		if err == nil {
+			return masterKey, nil
+		}
+		errs = append(errs, fmt.Errorf("token %d: %w", tokenID, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoTokenHandler
+	}
+	return nil, fmt.Errorf("no token could unlock the volume: %w", errors.Join(errs...))
+}
+
+// tokenKeyslotsKey recovers the master key with passphrase from the
+// keyslots token lists
+func tokenKeyslotsKey(device string, passphrase []byte, metadata *LUKS2Metadata, token *Token) (*securemem.Buffer, error) {
+	var errs []error
+	for _, slot := range token.Keyslots {
+		n, err := strconv.Atoi(slot)
+		if err != nil {
+			continue
+		}
+		masterKey, _, err := getMasterKeyWithOptions(device, passphrase, metadata, &UnlockOptions{Keyslot: &n})
+		if err == nil {
+			return masterKey, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("passphrase opens none of keyslots %v: %w", token.Keyslots, errors.Join(append(errs, ErrInvalidPassphrase)...))
+}
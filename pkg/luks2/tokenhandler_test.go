@@ -0,0 +1,173 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// tokenTestVolume formats a volume with a second keyslot whose passphrase
+// a token of tokenType stands for, and returns the device, the volume key,
+// that passphrase and the header metadata
+func tokenTestVolume(t *testing.T, tokenType string) (string, []byte, []byte, *LUKS2Metadata) {
+	t.Helper()
+	first := []byte("test-password")
+	device := formatTestVolume(t, first)
+	second := addTestKeys(t, device, first, 1)[0]
+	if err := ImportToken(device, 2, &Token{Type: tokenType, Keyslots: []string{"1"}}); err != nil {
+		t.Fatalf("ImportToken failed: %v", err)
+	}
+	volumeKey, err := ExtractVolumeKey(device, first)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	_, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	return device, volumeKey, second, metadata
+}
+
+// registerTestTokenHandler registers h for the duration of the test
+func registerTestTokenHandler(t *testing.T, tokenType string, h TokenHandler) {
+	t.Helper()
+	if err := RegisterTokenHandler(tokenType, h); err != nil {
+		t.Fatalf("RegisterTokenHandler failed: %v", err)
+	}
+	t.Cleanup(func() { _ = RegisterTokenHandler(tokenType, nil) })
+}
+
+func TestRegisterTokenHandler_Reserved(t *testing.T) {
+	h := TokenHandlerFunc(func(context.Context, TokenRequest) ([]byte, error) { return nil, ErrNoCredential })
+	for _, tokenType := range []string{"", TokenTypePKCS11, TokenTypeEscrow, TokenTypeAnnotation} {
+		if err := RegisterTokenHandler(tokenType, h); err == nil {
+			t.Errorf("RegisterTokenHandler(%q) succeeded", tokenType)
+		}
+	}
+}
+
+func TestTokenMasterKey_Registered(t *testing.T) {
+	device, volumeKey, second, metadata := tokenTestVolume(t, "test-plugin")
+
+	var got TokenRequest
+	registerTestTokenHandler(t, "test-plugin", TokenHandlerFunc(func(_ context.Context, req TokenRequest) ([]byte, error) {
+		got = req
+		return bytes.Clone(second), nil
+	}))
+
+	masterKey, err := tokenMasterKey(context.Background(), device, "uuid", metadata, &TokenUnlockOptions{})
+	if err != nil {
+		t.Fatalf("tokenMasterKey failed: %v", err)
+	}
+	defer masterKey.Destroy()
+	if !bytes.Equal(masterKey.Bytes(), volumeKey) {
+		t.Error("token unlocked the wrong volume key")
+	}
+	if got.Device != device || got.UUID != "uuid" || got.TokenID != 2 || got.Token.Type != "test-plugin" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+
+	// Filters that exclude the token leave nothing to try
+	id := 3
+	for _, opts := range []*TokenUnlockOptions{{TokenID: &id}, {TokenType: "other"}} {
+		if _, err := tokenMasterKey(context.Background(), device, "uuid", metadata, opts); !errors.Is(err, ErrNoTokenHandler) {
+			t.Errorf("tokenMasterKey(%+v) error = %v, want ErrNoTokenHandler", opts, err)
+		}
+	}
+}
+
+func TestTokenMasterKey_WrongPassphrase(t *testing.T) {
+	device, _, _, metadata := tokenTestVolume(t, "test-plugin")
+
+	// The passphrase of keyslot 0 must not be accepted through a token
+	// linked to keyslot 1
+	registerTestTokenHandler(t, "test-plugin", TokenHandlerFunc(func(context.Context, TokenRequest) ([]byte, error) {
+		return []byte("test-password"), nil
+	}))
+	if _, err := tokenMasterKey(context.Background(), device, "uuid", metadata, &TokenUnlockOptions{}); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("tokenMasterKey() error = %v, want ErrInvalidPassphrase", err)
+	}
+}
+
+func TestTokenMasterKey_NoHandler(t *testing.T) {
+	device, _, _, metadata := tokenTestVolume(t, "test-unhandled")
+
+	// External handlers are only run when asked for
+	dir := t.TempDir()
+	writeTokenHandler(t, dir, "test-unhandled", "exit 1")
+	if _, err := tokenMasterKey(context.Background(), device, "uuid", metadata, &TokenUnlockOptions{HandlerDir: dir}); !errors.Is(err, ErrNoTokenHandler) {
+		t.Errorf("tokenMasterKey() error = %v, want ErrNoTokenHandler", err)
+	}
+}
+
+// writeTokenHandler writes an external handler for tokenType running the
+// shell script body
+func writeTokenHandler(t *testing.T, dir, tokenType, body string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("external handlers are shell scripts")
+	}
+	path := filepath.Join(dir, TokenHandlerPrefix+tokenType)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0700); err != nil { // #nosec G306 -- test handler must be executable
+		t.Fatal(err)
+	}
+}
+
+func TestTokenMasterKey_External(t *testing.T) {
+	device, volumeKey, second, metadata := tokenTestVolume(t, "test-external")
+	dir := t.TempDir()
+
+	// The handler checks its arguments, environment and input before
+	// printing the passphrase
+	writeTokenHandler(t, dir, "test-external", `
+[ "$1" = "$LUKS2_DEVICE" ] || exit 3
+[ "$LUKS2_TOKEN_ID" = 2 ] && [ "$LUKS2_TOKEN_TYPE" = test-external ] && [ "$LUKS2_UUID" = uuid ] || exit 4
+grep -q '"keyslots":\["1"\]' || exit 5
+echo '`+string(second)+`'`)
+
+	masterKey, err := tokenMasterKey(context.Background(), device, "uuid", metadata, &TokenUnlockOptions{External: true, HandlerDir: dir})
+	if err != nil {
+		t.Fatalf("tokenMasterKey failed: %v", err)
+	}
+	defer masterKey.Destroy()
+	if !bytes.Equal(masterKey.Bytes(), volumeKey) {
+		t.Error("external handler unlocked the wrong volume key")
+	}
+}
+
+func TestTokenMasterKey_ExternalFails(t *testing.T) {
+	device, _, _, metadata := tokenTestVolume(t, "test-external")
+	dir := t.TempDir()
+	writeTokenHandler(t, dir, "test-external", "echo 'device not present' >&2; exit 1")
+
+	_, err := tokenMasterKey(context.Background(), device, "uuid", metadata, &TokenUnlockOptions{External: true, HandlerDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "device not present") {
+		t.Errorf("tokenMasterKey() error = %v, want the handler's message", err)
+	}
+}
+
+func TestTokenHandler_UnsafeType(t *testing.T) {
+	dir := t.TempDir()
+	writeTokenHandler(t, dir, "ok", "exit 0")
+	opts := &TokenUnlockOptions{External: true, HandlerDir: dir}
+
+	if tokenHandler("ok", opts) == nil {
+		t.Error("expected a handler for a plain type")
+	}
+	for _, tokenType := range []string{"../ok", "sub/ok", ".ok", ""} {
+		if h := tokenHandler(tokenType, opts); h != nil {
+			t.Errorf("tokenHandler(%q) = %v, want none", tokenType, h)
+		}
+	}
+}
@@ -0,0 +1,685 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2/securemem"
+)
+
+// ErrTransactionDone is returned when a committed or rolled back
+// Transaction is used again
+var ErrTransactionDone = errors.New("transaction already finished")
+
+// Transaction stages keyslot and token changes and applies them with a
+// single header write, so that a volume never ends up with only part of a
+// set of enrollments (e.g. an admin passphrase, a TPM token and a recovery
+// key). Key material of new keyslots is written to areas the header on disk
+// does not reference; the header write is the commit point. If anything
+// fails, the previous header is kept or restored and the written areas are
+// wiped.
+//
+// The volume is locked against other writers from BeginTransaction until
+// Commit or Rollback. Always call Rollback, typically deferred; it does
+// nothing after a successful Commit.
+type Transaction struct {
+	device    string
+	lock      *FileLock
+	hdr       *LUKS2BinaryHeader
+	metadata  *LUKS2Metadata
+	original  LUKS2BinaryHeader
+	origJSON  []byte
+	masterKey *securemem.Buffer
+	added     []stagedKeyslot
+	killed    []int
+	op        string
+	done      bool
+}
+
+// stagedKeyslot is the key material of a keyslot added by a transaction
+type stagedKeyslot struct {
+	id       int
+	offset   int64
+	material []byte   // Encrypted AF-split key
+	size     int64    // Area size; the rest of the area is zero padding
+	replaces *Keyslot // Keyslot rewrapped by this one, wiped after Commit
+}
+
+// BeginTransaction locks the volume, reads its header and recovers the
+// volume key with passphrase, which new keyslots will protect
+func BeginTransaction(device string, passphrase []byte) (*Transaction, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	tx := &Transaction{device: device, lock: lock, op: "transaction"}
+	if err := tx.begin(passphrase); err != nil {
+		_ = lock.Release()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// begin reads the header and recovers the volume key
+func (tx *Transaction) begin(passphrase []byte) error {
+	hdr, metadata, err := readHeader(tx.device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if tx.origJSON, err = json.Marshal(metadata); err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	tx.hdr, tx.metadata, tx.original = hdr, metadata, *hdr
+
+	if tx.masterKey, err = getMasterKey(tx.device, passphrase, metadata); err != nil {
+		return fmt.Errorf("failed to unlock with existing passphrase: %w", err)
+	}
+	return nil
+}
+
+// AddKey stages a keyslot for passphrase and returns its number. The key
+// derivation runs now, so the keyslot costs nothing at Commit.
+func (tx *Transaction) AddKey(passphrase []byte, opts *AddKeyOptions) (int, error) {
+	if tx.done {
+		return -1, ErrTransactionDone
+	}
+	if err := validateNewKey(passphrase, opts); err != nil {
+		return -1, err
+	}
+	return tx.stageKey(passphrase, opts)
+}
+
+// validateNewKey checks a new passphrase and the options of its keyslot
+func validateNewKey(passphrase []byte, opts *AddKeyOptions) error {
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return fmt.Errorf("invalid new passphrase: %w", err)
+	}
+	if err := checkPassphrasePolicy(passphrase); err != nil {
+		return fmt.Errorf("invalid new passphrase: %w", err)
+	}
+	if opts != nil && opts.Priority != nil {
+		if err := validateKeyslotPriority(*opts.Priority); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.Annotation != nil {
+		if err := validateAnnotation(opts.Annotation); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.AFStripes < 0 {
+		return fmt.Errorf("%w: %d (must be at least 1)", ErrInvalidAFStripes, opts.AFStripes)
+	}
+	return nil
+}
+
+// stageKey creates the keyslot of a validated passphrase in the staged
+// metadata and keeps its key material for Commit
+func (tx *Transaction) stageKey(passphrase []byte, opts *AddKeyOptions) (int, error) {
+	metadata := tx.metadata
+
+	// Find available keyslot
+	targetSlot, err := findAvailableKeyslot(metadata, opts)
+	if err != nil {
+		return -1, err
+	}
+
+	// Get existing keyslot for reference (cipher, key size, etc.)
+	var referenceKeyslot *Keyslot
+	for _, id := range sortedIDs(metadata.Keyslots) {
+		referenceKeyslot = metadata.Keyslots[id]
+		break
+	}
+	if referenceKeyslot == nil {
+		return -1, fmt.Errorf("no existing keyslot found for reference")
+	}
+
+	newKeyslot, staged, err := tx.sealKeyslot(passphrase, opts, referenceKeyslot)
+	if err != nil {
+		return -1, err
+	}
+
+	// Replace any annotation left behind by a keyslot removed with another
+	// tool before touching the metadata, so a failure leaves it unchanged
+	slotIDStr := strconv.Itoa(targetSlot)
+	if opts != nil && opts.Annotation != nil {
+		ann := *opts.Annotation
+		if ann.CreatedAt.IsZero() {
+			ann.CreatedAt = time.Now()
+		}
+		if err := setAnnotation(metadata, slotIDStr, &ann); err != nil {
+			clearBytes(staged.material)
+			return -1, err
+		}
+	} else {
+		dropAnnotation(metadata, slotIDStr)
+	}
+
+	// Add keyslot to metadata
+	metadata.Keyslots[slotIDStr] = newKeyslot
+
+	// Update digest to include new keyslot
+	for _, digest := range metadata.Digests {
+		found := false
+		for _, ks := range digest.Keyslots {
+			if ks == slotIDStr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			digest.Keyslots = append(digest.Keyslots, slotIDStr)
+		}
+	}
+
+	staged.id = targetSlot
+	tx.added = append(tx.added, staged)
+	return targetSlot, nil
+}
+
+// sealKeyslot derives a key from passphrase with a new KDF, encrypts the
+// AF-split volume key with it like reference's area and allocates an area
+// for it. It returns the keyslot and its staged key material, without an ID.
+func (tx *Transaction) sealKeyslot(passphrase []byte, opts *AddKeyOptions, reference *Keyslot) (*Keyslot, stagedKeyslot, error) {
+	// Create KDF for new keyslot
+	kdfType := "argon2id"
+	if opts != nil && opts.KDFType != "" {
+		kdfType = opts.KDFType
+	}
+
+	// Determine hash algorithm - use provided value or default to sha256
+	hashAlgo := DefaultHashAlgo
+	if opts != nil && opts.Hash != "" {
+		hashAlgo = opts.Hash
+	}
+
+	formatOpts := FormatOptions{
+		KDFType:        kdfType,
+		HashAlgo:       hashAlgo,
+		Argon2Time:     4,
+		Argon2Memory:   1048576,
+		Argon2Parallel: 4,
+	}
+	if opts != nil {
+		if opts.Argon2Time > 0 {
+			formatOpts.Argon2Time = opts.Argon2Time
+		}
+		if opts.Argon2Memory > 0 {
+			formatOpts.Argon2Memory = opts.Argon2Memory
+		}
+		if opts.Argon2Parallel > 0 {
+			formatOpts.Argon2Parallel = opts.Argon2Parallel
+		}
+		if opts.PBKDFIterTime > 0 {
+			formatOpts.PBKDFIterTime = opts.PBKDFIterTime
+		}
+		formatOpts.Argon2Auto = opts.Argon2Auto
+		formatOpts.Argon2IterTime = opts.Argon2IterTime
+	}
+
+	// The new area is encrypted like the reference keyslot's
+	keySize := areaKeySize(reference)
+	kdf, err := CreateKDF(formatOpts, keySize)
+	if err != nil {
+		return nil, stagedKeyslot{}, fmt.Errorf("failed to create KDF: %w", err)
+	}
+
+	// Derive key from new passphrase
+	passphraseKey, err := deriveSecureKey(passphrase, kdf, keySize)
+	if err != nil {
+		return nil, stagedKeyslot{}, fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer passphraseKey.Destroy()
+
+	// Apply anti-forensic split to master key
+	stripes := AFStripes
+	if opts != nil && opts.AFStripes != 0 {
+		stripes = opts.AFStripes
+	}
+	if _, err := afMaterialSize(reference.KeySize, stripes); err != nil {
+		return nil, stagedKeyslot{}, err
+	}
+	afData, err := AFSplit(tx.masterKey.Bytes(), stripes, DefaultHashAlgo)
+	if err != nil {
+		return nil, stagedKeyslot{}, fmt.Errorf("failed to apply AF split: %w", err)
+	}
+	defer clearBytes(afData)
+
+	// Encrypt AF-split key material with new passphrase-derived key
+	encryptedKeyMaterial, err := encryptKeyMaterial(afData, passphraseKey.Bytes(), reference.Area.Encryption)
+	if err != nil {
+		return nil, stagedKeyslot{}, fmt.Errorf("failed to encrypt key material: %w", err)
+	}
+	defer clearBytes(encryptedKeyMaterial)
+
+	// Place the new keyslot in the keyslots area, reusing freed regions.
+	// The area ends before the data segment, so this never overlaps data.
+	// Keyslots killed or rewrapped in this transaction still hold their
+	// areas, so the material never overwrites a keyslot the current header
+	// uses.
+	alignedSize := alignTo(int64(len(encryptedKeyMaterial)), KeyslotAreaAlignment)
+	newOffset, err := allocateKeyslotArea(tx.metadata, alignedSize, tx.replaced()...)
+	if err != nil {
+		return nil, stagedKeyslot{}, err
+	}
+
+	// Create new keyslot metadata
+	priority := KeyslotPriorityNormal
+	if opts != nil && opts.Priority != nil {
+		priority = *opts.Priority
+	}
+	newKeyslot := &Keyslot{
+		Type:     "luks2",
+		KeySize:  reference.KeySize,
+		Priority: &priority,
+		Area: &KeyslotArea{
+			Type:       "raw",
+			KeySize:    keySize,
+			Offset:     formatSize(newOffset),
+			Size:       formatSize(alignedSize),
+			Encryption: reference.Area.Encryption,
+		},
+		KDF: kdf,
+		AF: &AntiForensic{
+			Type:    "luks1",
+			Stripes: stripes,
+			Hash:    DefaultHashAlgo,
+		},
+	}
+	material := append([]byte(nil), encryptedKeyMaterial...)
+	return newKeyslot, stagedKeyslot{offset: newOffset, material: material, size: alignedSize}, nil
+}
+
+// replaced returns the keyslots rewrapped in this transaction, whose areas
+// the header on disk still references
+func (tx *Transaction) replaced() []*Keyslot {
+	var keyslots []*Keyslot
+	for _, staged := range tx.added {
+		if staged.replaces != nil {
+			keyslots = append(keyslots, staged.replaces)
+		}
+	}
+	return keyslots
+}
+
+// AddRecoveryKey stages a keyslot for a generated recovery key like
+// AddRecoveryKey. The key is not saved, since the keyslot does not exist
+// before Commit; opts.OutputPath must be empty. Save it with
+// SaveRecoveryKey after Commit, and clear it when done.
+func (tx *Transaction) AddRecoveryKey(opts *RecoveryKeyOptions) (*RecoveryKey, error) {
+	if opts == nil {
+		opts = &RecoveryKeyOptions{}
+	}
+	if opts.OutputPath != "" {
+		return nil, fmt.Errorf("recovery key output path is not supported in a transaction; save the key after Commit")
+	}
+	length, format := opts.Length, opts.Format
+	if length <= 0 {
+		length = RecoveryKeyLength
+	}
+	if format == "" {
+		format = RecoveryKeyFormatDashed
+	}
+
+	recoveryKey, err := GenerateRecoveryKey(length, format)
+	if err != nil {
+		return nil, err
+	}
+	keyslot, err := tx.AddKey(recoveryKey.Key, &AddKeyOptions{
+		Keyslot:        opts.Keyslot,
+		KDFType:        opts.KDFType,
+		Argon2Time:     opts.Argon2Time,
+		Argon2Memory:   opts.Argon2Memory,
+		Argon2Parallel: opts.Argon2Parallel,
+	})
+	if err != nil {
+		recoveryKey.Clear()
+		return nil, fmt.Errorf("failed to add recovery key: %w", err)
+	}
+	recoveryKey.Keyslot = keyslot
+	recoveryKey.VolumeUUID = headerUUID(tx.hdr)
+	return recoveryKey, nil
+}
+
+// ImportToken stages a token in the first free token slot and returns its
+// ID. The keyslots it lists may be ones staged in this transaction.
+func (tx *Transaction) ImportToken(token *Token) (int, error) {
+	if tx.done {
+		return -1, ErrTransactionDone
+	}
+	if token == nil || token.Type == "" {
+		return -1, fmt.Errorf("token type cannot be empty")
+	}
+	for _, id := range token.Keyslots {
+		if _, exists := tx.metadata.Keyslots[id]; !exists {
+			return -1, fmt.Errorf("token references keyslot %s, which does not exist", id)
+		}
+	}
+
+	tokenID, err := freeTokenSlot(tx.metadata)
+	if err != nil {
+		return -1, err
+	}
+	if tx.metadata.Tokens == nil {
+		tx.metadata.Tokens = make(map[string]*Token)
+	}
+	tx.metadata.Tokens[strconv.Itoa(tokenID)] = token
+	return tokenID, nil
+}
+
+// RemoveToken stages the removal of a token
+func (tx *Transaction) RemoveToken(tokenID int) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	key := strconv.Itoa(tokenID)
+	if _, exists := tx.metadata.Tokens[key]; !exists {
+		return ErrTokenNotFound
+	}
+	delete(tx.metadata.Tokens, key)
+	return nil
+}
+
+// KillKeyslot stages the removal of an existing keyslot. Its number and
+// area stay reserved until Commit, which wipes the area after the new
+// header is written.
+func (tx *Transaction) KillKeyslot(keyslot int) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if _, exists := tx.metadata.Keyslots[strconv.Itoa(keyslot)]; !exists {
+		return fmt.Errorf("keyslot %d does not exist", keyslot)
+	}
+	for _, staged := range tx.added {
+		if staged.id == keyslot {
+			return fmt.Errorf("keyslot %d was added or rewrapped in this transaction", keyslot)
+		}
+	}
+	for _, killed := range tx.killed {
+		if killed == keyslot {
+			return nil
+		}
+	}
+	tx.killed = append(tx.killed, keyslot)
+	return nil
+}
+
+// RewrapKeyslot stages a new copy of an existing keyslot under the same
+// number: the volume key is protected again by passphrase, which must open
+// the keyslot, with a new salt and KDF in a new area. opts sets the KDF, AF
+// stripes and priority; nil or zero fields keep those of the keyslot, and
+// its Keyslot and Annotation fields are ignored. The annotation and token
+// links of the keyslot are kept. The old area stays reserved until Commit,
+// which wipes it after the new header is written.
+func (tx *Transaction) RewrapKeyslot(keyslot int, passphrase []byte, opts *AddKeyOptions) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return err
+	}
+	if err := validateRewrapOptions(opts); err != nil {
+		return err
+	}
+
+	slotIDStr := strconv.Itoa(keyslot)
+	old, exists := tx.metadata.Keyslots[slotIDStr]
+	if !exists {
+		return fmt.Errorf("keyslot %d does not exist", keyslot)
+	}
+	if old.Type != "luks2" || old.Area == nil {
+		return fmt.Errorf("%w: keyslot %d has type %q", ErrInvalidKeyslot, keyslot, old.Type)
+	}
+	for _, staged := range tx.added {
+		if staged.id == keyslot {
+			return fmt.Errorf("keyslot %d was added or rewrapped in this transaction", keyslot)
+		}
+	}
+	for _, killed := range tx.killed {
+		if killed == keyslot {
+			return fmt.Errorf("keyslot %d is killed in this transaction", keyslot)
+		}
+	}
+
+	// Only the passphrase of the keyslot may replace it, or rewrapping
+	// would change which passphrase opens it
+	masterKey, err := unlockKeyslot(tx.device, passphrase, old, tx.metadata.Digests)
+	if err != nil {
+		if keyslotSkipped(err) {
+			return fmt.Errorf("keyslot %d: %w", keyslot, err)
+		}
+		return fmt.Errorf("keyslot %d: %w", keyslot, ErrInvalidPassphrase)
+	}
+	same := subtle.ConstantTimeCompare(masterKey.Bytes(), tx.masterKey.Bytes()) == 1
+	masterKey.Destroy()
+	if !same {
+		return fmt.Errorf("%w: keyslot %d holds a different volume key", ErrInvalidKeyslot, keyslot)
+	}
+
+	return tx.replaceKeyslot(keyslot, passphrase, rewrapOptions(old, opts))
+}
+
+// replaceKeyslot seals the volume key of the transaction for passphrase in
+// a new area and stages it in place of keyslot, whose passphrase the
+// caller has checked
+func (tx *Transaction) replaceKeyslot(keyslot int, passphrase []byte, opts *AddKeyOptions) error {
+	slotIDStr := strconv.Itoa(keyslot)
+	old := tx.metadata.Keyslots[slotIDStr]
+	newKeyslot, staged, err := tx.sealKeyslot(passphrase, opts, old)
+	if err != nil {
+		return err
+	}
+	tx.metadata.Keyslots[slotIDStr] = newKeyslot
+	staged.id, staged.replaces = keyslot, old
+	tx.added = append(tx.added, staged)
+	return nil
+}
+
+// validateRewrapOptions checks the priority and AF stripes a keyslot is
+// re-enrolled with
+func validateRewrapOptions(opts *AddKeyOptions) error {
+	if opts != nil && opts.Priority != nil {
+		if err := validateKeyslotPriority(*opts.Priority); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.AFStripes < 0 {
+		return fmt.Errorf("%w: %d (must be at least 1)", ErrInvalidAFStripes, opts.AFStripes)
+	}
+	return nil
+}
+
+// rewrapOptions fills the zero fields of opts with the KDF type and costs,
+// AF stripes and priority of keyslot
+func rewrapOptions(keyslot *Keyslot, opts *AddKeyOptions) *AddKeyOptions {
+	o := AddKeyOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if kdf := keyslot.KDF; kdf != nil && o.KDFType == "" {
+		o.KDFType = kdf.Type
+		if kdf.Type == "pbkdf2" && o.Hash == "" {
+			o.Hash = kdf.Hash
+		}
+		if !o.Argon2Auto {
+			o.Argon2Time = cmp.Or(o.Argon2Time, intValue(kdf.Time))
+			o.Argon2Memory = cmp.Or(o.Argon2Memory, intValue(kdf.Memory))
+			o.Argon2Parallel = cmp.Or(o.Argon2Parallel, intValue(kdf.CPUs))
+		}
+	}
+	if o.AFStripes == 0 && keyslot.AF != nil {
+		o.AFStripes = keyslot.AF.Stripes
+	}
+	if o.Priority == nil {
+		priority := keyslotPriority(keyslot)
+		o.Priority = &priority
+	}
+	return &o
+}
+
+// Commit writes the key material of new keyslots, then the header with all
+// staged changes, and finally wipes killed keyslots. The transaction is
+// finished afterwards, whether or not Commit succeeds.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	defer tx.finish()
+
+	// Apply staged kills to the metadata
+	var wipe []*Keyslot
+	for _, keyslot := range tx.killed {
+		slotIDStr := strconv.Itoa(keyslot)
+		wipe = append(wipe, tx.metadata.Keyslots[slotIDStr])
+		delete(tx.metadata.Keyslots, slotIDStr)
+		for _, digest := range tx.metadata.Digests {
+			newKeyslots := make([]string, 0, len(digest.Keyslots))
+			for _, ks := range digest.Keyslots {
+				if ks != slotIDStr {
+					newKeyslots = append(newKeyslots, ks)
+				}
+			}
+			digest.Keyslots = newKeyslots
+		}
+		dropAnnotation(tx.metadata, slotIDStr)
+	}
+	if len(tx.metadata.Keyslots) == 0 {
+		return fmt.Errorf("cannot remove last keyslot")
+	}
+	if tx.metadata.Tokens != nil && len(tx.metadata.Tokens) == 0 {
+		tx.metadata.Tokens = nil
+	}
+
+	if err := tx.writeMaterial(); err != nil {
+		tx.wipeAdded()
+		return err
+	}
+
+	tx.hdr.SequenceID++
+	if err := writeHeaderInternal(tx.device, tx.hdr, tx.metadata); err != nil {
+		if rerr := tx.restoreHeader(); rerr != nil {
+			return fmt.Errorf("failed to write header: %w (restoring the previous header also failed: %v)", err, rerr)
+		}
+		tx.wipeAdded()
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	// The new header no longer references killed keyslots or the old
+	// areas of rewrapped ones
+	for i, ks := range wipe {
+		if err := wipeKeyslotArea(tx.device, ks); err != nil {
+			return fmt.Errorf("changes committed but keyslot %d area not wiped: %w", tx.killed[i], err)
+		}
+	}
+	for _, staged := range tx.added {
+		if staged.replaces == nil {
+			continue
+		}
+		if err := wipeKeyslotArea(tx.device, staged.replaces); err != nil {
+			return fmt.Errorf("changes committed but keyslot %d old area not wiped: %w", staged.id, err)
+		}
+	}
+
+	for _, staged := range tx.added {
+		keyslot := staged.id
+		eventType := EventKeyslotAdded
+		if staged.replaces != nil {
+			eventType = EventKeyslotRewrapped
+		}
+		emitEvent(Event{Type: eventType, Op: tx.op, Device: tx.device, Keyslot: &keyslot})
+	}
+	for _, keyslot := range tx.killed {
+		keyslot := keyslot
+		emitEvent(Event{Type: EventKeyslotRemoved, Op: tx.op, Device: tx.device, Keyslot: &keyslot})
+	}
+	return nil
+}
+
+// Rollback discards the staged changes and unlocks the volume. Nothing was
+// written before Commit, so the volume is unchanged.
+func (tx *Transaction) Rollback() {
+	if !tx.done {
+		tx.finish()
+	}
+}
+
+// writeMaterial writes the key material of staged keyslots
+func (tx *Transaction) writeMaterial() error {
+	if len(tx.added) == 0 {
+		return nil
+	}
+	for _, staged := range tx.added {
+		if err := checkKeyslotArea(tx.metadata, strconv.Itoa(staged.id), staged.offset, staged.size); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(tx.device, os.O_RDWR, 0600) // #nosec G304 -- device path validated by BeginTransaction
+	if err != nil {
+		return fmt.Errorf("failed to open device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, staged := range tx.added {
+		if err := writeKeyslotArea(f, staged.offset, staged.material, staged.size); err != nil {
+			return fmt.Errorf("failed to write key material: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+	return nil
+}
+
+// wipeAdded zeroes the areas of staged keyslots after a failed commit
+func (tx *Transaction) wipeAdded() {
+	for _, staged := range tx.added {
+		if ks, ok := tx.metadata.Keyslots[strconv.Itoa(staged.id)]; ok {
+			_ = wipeKeyslotArea(tx.device, ks)
+		}
+	}
+}
+
+// restoreHeader writes back the header read by BeginTransaction, in case a
+// failed write left a copy half-updated
+func (tx *Transaction) restoreHeader() error {
+	var metadata LUKS2Metadata
+	if err := json.Unmarshal(tx.origJSON, &metadata); err != nil {
+		return err
+	}
+	hdr := tx.original
+	return writeHeaderInternal(tx.device, &hdr, &metadata)
+}
+
+// finish clears key material and releases the lock, if the transaction
+// holds it
+func (tx *Transaction) finish() {
+	tx.done = true
+	for _, staged := range tx.added {
+		clearBytes(staged.material)
+	}
+	if tx.masterKey != nil {
+		tx.masterKey.Destroy()
+	}
+	if tx.lock != nil {
+		_ = tx.lock.Release()
+	}
+}
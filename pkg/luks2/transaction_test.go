@@ -0,0 +1,235 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testAddKeyOptions keeps key derivation fast in tests
+var testAddKeyOptions = &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}
+
+func TestTransactionCommit(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	hdr, _, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+
+	tx, err := BeginTransaction(device, admin)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	second := []byte("second-password")
+	slot, err := tx.AddKey(second, testAddKeyOptions)
+	if err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	recoveryKey, err := tx.AddRecoveryKey(&RecoveryKeyOptions{KDFType: "pbkdf2"})
+	if err != nil {
+		t.Fatalf("AddRecoveryKey failed: %v", err)
+	}
+	defer recoveryKey.Clear()
+	tokenID, err := tx.ImportToken(&Token{Type: "systemd-tpm2", Keyslots: []string{"1"}, TPM2Blob: "blob"})
+	if err != nil {
+		t.Fatalf("ImportToken failed: %v", err)
+	}
+	if slot != 1 || recoveryKey.Keyslot != 2 || tokenID != 0 {
+		t.Errorf("expected keyslots 1 and 2 and token 0, got %d, %d, %d", slot, recoveryKey.Keyslot, tokenID)
+	}
+
+	// Nothing reaches the disk before Commit
+	if slots, err := ListKeyslots(device); err != nil || len(slots) != 1 {
+		t.Fatalf("expected 1 keyslot before commit, got %d (%v)", len(slots), err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	after, _, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if after.SequenceID != hdr.SequenceID+1 {
+		t.Errorf("expected a single sequence bump, got %d -> %d", hdr.SequenceID, after.SequenceID)
+	}
+	for _, pass := range [][]byte{admin, second, recoveryKey.Key} {
+		if err := TestKey(device, pass); err != nil {
+			t.Errorf("TestKey failed after commit: %v", err)
+		}
+	}
+	if token, err := GetToken(device, 0); err != nil || token.Type != "systemd-tpm2" {
+		t.Errorf("expected staged token, got %+v (%v)", token, err)
+	}
+
+	if _, err := tx.AddKey([]byte("third-password"), testAddKeyOptions); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("expected ErrTransactionDone, got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("expected ErrTransactionDone, got %v", err)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+	before, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := BeginTransaction(device, admin)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	if _, err := tx.AddKey([]byte("second-password"), testAddKeyOptions); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	tx.Rollback()
+
+	after, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("volume changed by a rolled back transaction")
+	}
+
+	// The lock was released
+	if err := AddKey(device, admin, []byte("second-password"), testAddKeyOptions); err != nil {
+		t.Errorf("AddKey after rollback failed: %v", err)
+	}
+}
+
+func TestTransactionCommitFailure(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+
+	tx, err := BeginTransaction(device, admin)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.AddKey([]byte("second-password"), testAddKeyOptions); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	staged := tx.added[0]
+	// A token too big for the JSON area makes the header write fail
+	if _, err := tx.ImportToken(&Token{Type: "oversized", TPM2Blob: strings.Repeat("x", 64*1024)}); err != nil {
+		t.Fatalf("ImportToken failed: %v", err)
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected Commit to fail")
+	}
+
+	slots, err := ListKeyslots(device)
+	if err != nil || len(slots) != 1 {
+		t.Errorf("expected the original keyslot only, got %d (%v)", len(slots), err)
+	}
+	if n, err := CountTokens(device); err != nil || n != 0 {
+		t.Errorf("expected no tokens, got %d (%v)", n, err)
+	}
+
+	// The key material written for the staged keyslot was wiped
+	f, err := os.Open(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	area := make([]byte, 4096)
+	if _, err := f.ReadAt(area, staged.offset); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(area, make([]byte, len(area))) {
+		t.Error("staged key material left on disk after failed commit")
+	}
+}
+
+func TestTransactionReplaceKeyslot(t *testing.T) {
+	old := []byte("old-admin-password")
+	device := formatTestVolume(t, old)
+	if err := SetKeyslotAnnotation(device, 0, KeyslotAnnotation{Label: "old-admin"}); err != nil {
+		t.Fatalf("SetKeyslotAnnotation failed: %v", err)
+	}
+
+	tx, err := BeginTransaction(device, old)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.KillKeyslot(0); err != nil {
+		t.Fatalf("KillKeyslot failed: %v", err)
+	}
+	replacement := []byte("new-admin-password")
+	slot, err := tx.AddKey(replacement, testAddKeyOptions)
+	if err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	if slot == 0 {
+		t.Fatal("killed keyslot reused before commit")
+	}
+	if err := tx.KillKeyslot(slot); err == nil {
+		t.Error("expected killing a staged keyslot to fail")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if err := TestKey(device, old); err == nil {
+		t.Error("killed keyslot still unlocks")
+	}
+	if err := TestKey(device, replacement); err != nil {
+		t.Errorf("replacement keyslot does not unlock: %v", err)
+	}
+	if n, err := CountTokens(device); err != nil || n != 0 {
+		t.Errorf("expected the annotation of the killed keyslot removed, got %d tokens (%v)", n, err)
+	}
+}
+
+func TestTransactionErrors(t *testing.T) {
+	admin := []byte("admin-password")
+	device := formatTestVolume(t, admin)
+
+	if _, err := BeginTransaction(device, []byte("wrong-password")); err == nil {
+		t.Fatal("expected BeginTransaction to fail with a wrong passphrase")
+	}
+
+	tx, err := BeginTransaction(device, admin)
+	if err != nil {
+		t.Fatalf("BeginTransaction failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.AddRecoveryKey(&RecoveryKeyOptions{OutputPath: "/tmp/recovery.txt"}); err == nil {
+		t.Error("expected AddRecoveryKey with an output path to fail")
+	}
+	if _, err := tx.ImportToken(&Token{Type: "systemd-tpm2", Keyslots: []string{"7"}}); err == nil {
+		t.Error("expected a token for a missing keyslot to fail")
+	}
+	if err := tx.RemoveToken(3); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound, got %v", err)
+	}
+	if err := tx.KillKeyslot(0); err != nil {
+		t.Fatalf("KillKeyslot failed: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("expected removing the last keyslot to fail")
+	}
+	if err := TestKey(device, admin); err != nil {
+		t.Errorf("volume damaged by a failed commit: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// FITRIM ioctl number for discarding the free space of a mounted filesystem
+const FITRIM = 0xc0185879
+
+// fstrimRange mirrors the kernel's struct fstrim_range
+type fstrimRange struct {
+	Start  uint64
+	Len    uint64
+	MinLen uint64
+}
+
+// Trim discards the unused blocks of the filesystem mounted at mountPoint,
+// equivalent to fstrim. It returns the number of bytes the filesystem
+// reported as trimmed.
+//
+// On an unlocked LUKS volume the discards only reach the underlying device
+// when the mapping allows them (UnlockOptions.AllowDiscards); otherwise the
+// kernel rejects the request. See the security note on issueDiscard about
+// what discards reveal on encrypted storage.
+func Trim(mountPoint string) (uint64, error) {
+	mountPoint = filepath.Clean(mountPoint)
+
+	mounted, err := IsMounted(mountPoint)
+	if err != nil {
+		return 0, err
+	}
+	if !mounted {
+		return 0, fmt.Errorf("%w: %s", ErrNotMounted, mountPoint)
+	}
+
+	f, err := os.Open(mountPoint) // #nosec G304 -- mount point confirmed via /proc/mounts
+	if err != nil {
+		return 0, fmt.Errorf("failed to open mount point: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r := fstrimRange{Len: math.MaxUint64}
+
+	// #nosec G103 -- unsafe.Pointer required for IOCTL syscall to pass struct to kernel
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		f.Fd(),
+		uintptr(FITRIM),
+		uintptr(unsafe.Pointer(&r)),
+	)
+	if errno != 0 {
+		if errors.Is(errno, unix.EOPNOTSUPP) {
+			return 0, fmt.Errorf("%s does not support discard (unlock with allow-discards to pass TRIM through dm-crypt): %w", mountPoint, errno)
+		}
+		return 0, fmt.Errorf("FITRIM ioctl failed: %w", errno)
+	}
+
+	// The kernel replaces Len with the number of bytes trimmed
+	return r.Len, nil
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+// TestTrim_NotMounted tests that Trim refuses paths that are not mount points
+func TestTrim_NotMounted(t *testing.T) {
+	if _, err := Trim(t.TempDir()); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("expected ErrNotMounted, got %v", err)
+	}
+	if _, err := Trim("/nonexistent/mount/point/"); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("expected ErrNotMounted, got %v", err)
+	}
+}
+
+// TestFITRIM_Constant verifies the FITRIM ioctl number and argument layout
+func TestFITRIM_Constant(t *testing.T) {
+	// _IOWR('X', 121, struct fstrim_range)
+	if FITRIM != 0xc0185879 {
+		t.Errorf("FITRIM = 0x%x, want 0xc0185879", uint64(FITRIM))
+	}
+	if size := unsafe.Sizeof(fstrimRange{}); size != 24 {
+		t.Errorf("fstrimRange is %d bytes, want 24", size)
+	}
+}
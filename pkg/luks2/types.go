@@ -13,12 +13,14 @@ import (
 const (
 	LUKS2Magic       = "LUKS\xba\xbe"
 	LUKS2MagicLen    = 6
+	LUKS2MagicBackup = "SKUL\xba\xbe" // Magic of the secondary header copy
 	LUKS2Version     = 2
 	LUKS2SectorSize  = 512
 	LUKS2HeaderSize  = 4096
 	LUKS2DefaultSize = 12288 // 12KB JSON size (4096 + 12288 = 16KB total per header)
 
-	// Anti-forensic stripes (LUKS standard)
+	// Anti-forensic stripes of new keyslots unless FormatOptions or
+	// AddKeyOptions set others (LUKS standard, as cryptsetup uses)
 	AFStripes = 4000
 
 	// Default encryption parameters
@@ -28,6 +30,13 @@ const (
 	DefaultKeySize    = 512 // bits (64 bytes)
 	DefaultSectorSize = 512
 
+	// DefaultDigestIterTime is the target ms of the volume key digest
+	// PBKDF2, as cryptsetup benchmarks it
+	DefaultDigestIterTime = 125
+
+	// DefaultEphemeralCipher is the dm-crypt cipher of ephemeral volumes
+	DefaultEphemeralCipher = DefaultCipher + "-" + DefaultCipherMode
+
 	// LUKS2 header size limits (matching cryptsetup)
 	// Reference: cryptsetup/lib/luks2/luks2.h
 	LUKS2HeaderMinSize     = 0x4000    // 16 KiB - minimum header size per copy
@@ -68,17 +77,25 @@ type LUKS2Metadata struct {
 	Segments map[string]*Segment `json:"segments"`
 	Digests  map[string]*Digest  `json:"digests"`
 	Config   *Config             `json:"config"`
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // Keyslot represents a key slot in LUKS2
 type Keyslot struct {
-	Type     string                 `json:"type"`     // "luks2"
-	KeySize  int                    `json:"key_size"` // Key size in bytes
-	Priority *int                   `json:"priority,omitempty"`
-	Area     *KeyslotArea           `json:"area"`
-	KDF      *KDF                   `json:"kdf"`
-	AF       *AntiForensic          `json:"af,omitempty"`
-	Custom   map[string]interface{} `json:"-"` // For unknown fields
+	Type     string        `json:"type"`     // "luks2"
+	KeySize  int           `json:"key_size"` // Key size in bytes
+	Priority *int          `json:"priority,omitempty"`
+	Area     *KeyslotArea  `json:"area"`
+	KDF      *KDF          `json:"kdf"`
+	AF       *AntiForensic `json:"af,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
+
+	// Deprecated: Custom holds the unknown members of Extra decoded into
+	// Go values when the header is read. It is never written back; read
+	// and modify Extra instead.
+	Custom map[string]interface{} `json:"-"`
 }
 
 // KeyslotArea defines the encrypted key material storage area
@@ -88,6 +105,8 @@ type KeyslotArea struct {
 	Offset     string `json:"offset"`     // Offset in bytes (as string)
 	Size       string `json:"size"`       // Size in bytes (as string)
 	Encryption string `json:"encryption"` // e.g., "aes-xts-plain64"
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // KDF represents key derivation function parameters
@@ -99,13 +118,17 @@ type KDF struct {
 	Time       *int   `json:"time,omitempty"`       // For argon2
 	Memory     *int   `json:"memory,omitempty"`     // For argon2 (KB)
 	CPUs       *int   `json:"cpus,omitempty"`       // For argon2
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // AntiForensic represents anti-forensic information splitting parameters
 type AntiForensic struct {
 	Type    string `json:"type"`    // "luks1"
-	Stripes int    `json:"stripes"` // Always 4000 for compatibility
+	Stripes int    `json:"stripes"` // AFStripes unless chosen at Format/AddKey time
 	Hash    string `json:"hash"`    // Hash algorithm
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // Token represents optional token metadata (TPM, FIDO2, etc.)
@@ -128,16 +151,56 @@ type Token struct {
 	TPM2PublicKey  string `json:"tpm2-pubkey,omitempty"`
 	TPM2SRKNV      string `json:"tpm2-srk-nv,omitempty"`
 	TPM2KeyHandle  uint64 `json:"tpm2-key-handle,omitempty"`
+
+	// PKCS#11-specific fields (for type TokenTypePKCS11)
+	PKCS11URI     string `json:"pkcs11-uri,omitempty"`      // RFC 7512 URI of the token key
+	PKCS11Key     string `json:"pkcs11-key,omitempty"`      // Base64-encoded wrapped secret or ephemeral EC public key
+	PKCS11KeyWrap string `json:"pkcs11-key-wrap,omitempty"` // PKCS11Wrap* scheme ("" = systemd's default for the key type)
+
+	// Escrow-specific fields (for type TokenTypeEscrow)
+	EscrowService string `json:"escrow-service,omitempty"` // KeyEscrow.Service of the wrapping service
+	EscrowSecret  string `json:"escrow-secret,omitempty"`  // EscrowSecretVolumeKey or EscrowSecretPassphrase
+	EscrowKeyID   string `json:"escrow-key-id,omitempty"`  // Wrapping key within the service
+	EscrowWrapped string `json:"escrow-wrapped,omitempty"` // Base64-encoded wrapped secret
+
+	// Annotation fields (for type TokenTypeAnnotation)
+	AnnotationLabel       string `json:"annotation-label,omitempty"`
+	AnnotationOwner       string `json:"annotation-owner,omitempty"`
+	AnnotationDescription string `json:"annotation-description,omitempty"`
+	AnnotationCreated     string `json:"annotation-created,omitempty"` // RFC 3339
+
+	// Rotation fields (for type TokenTypeRotation)
+	RotationDigest      string `json:"rotation-digest,omitempty"`       // Digest of the new volume key
+	RotationOffset      string `json:"rotation-offset,omitempty"`       // Bytes of the volume reencrypted
+	RotationHotSize     string `json:"rotation-hot-size,omitempty"`     // Bytes past the offset being rewritten
+	RotationJournal     string `json:"rotation-journal,omitempty"`      // Offset of the journal in the keyslots area
+	RotationJournalSize string `json:"rotation-journal-size,omitempty"` // Size of the journal
+	RotationJournalHash string `json:"rotation-journal-hash,omitempty"` // Base64-encoded SHA-256 of the journaled chunk
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // Segment represents a data segment on the device
 type Segment struct {
-	Type       string `json:"type"`       // "crypt"
-	Offset     string `json:"offset"`     // Offset in bytes (as string)
-	Size       string `json:"size"`       // Size in bytes or "dynamic"
-	IVTweak    string `json:"iv_tweak"`   // IV tweak value
-	Encryption string `json:"encryption"` // e.g., "aes-xts-plain64"
-	SectorSize int    `json:"sector_size"`
+	Type       string   `json:"type"`                 // "crypt" or "linear"
+	Offset     string   `json:"offset"`               // Offset in bytes (as string)
+	Size       string   `json:"size"`                 // Size in bytes or "dynamic"
+	IVTweak    string   `json:"iv_tweak,omitempty"`   // IV tweak value (crypt only)
+	Encryption string   `json:"encryption,omitempty"` // e.g., "aes-xts-plain64" (crypt only)
+	SectorSize int      `json:"sector_size,omitempty"`
+	Flags      []string `json:"flags,omitempty"` // e.g., "backup-previous" during reencryption
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
+}
+
+// SegmentSpec describes one data segment created by Format. Segments are
+// mapped back to back in the order given; Offset lets a segment start
+// further into the device than the end of the previous one, leaving the
+// bytes in between (a reserved region) outside the mapping.
+type SegmentSpec struct {
+	Type   string // SegmentTypeCrypt (default) or SegmentTypeLinear
+	Offset int64  // Absolute device offset in bytes (0 = right after the previous segment)
+	Size   int64  // Size in bytes (0 = dynamic, allowed for the last segment only)
 }
 
 // Digest represents a key digest for verification
@@ -149,14 +212,31 @@ type Digest struct {
 	Iterations int      `json:"iterations"`
 	Salt       string   `json:"salt"`   // Base64-encoded
 	Digest     string   `json:"digest"` // Base64-encoded digest value
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // Config represents global configuration
 type Config struct {
-	JSONSize     string   `json:"json_size"`     // JSON area size (as string)
-	KeyslotsSize string   `json:"keyslots_size"` // Keyslot area size (as string)
-	Flags        []string `json:"flags,omitempty"`
-	Requirements []string `json:"requirements,omitempty"`
+	JSONSize     string        `json:"json_size"`     // JSON area size (as string)
+	KeyslotsSize string        `json:"keyslots_size"` // Keyslot area size (as string)
+	Flags        []string      `json:"flags,omitempty"`
+	Requirements *Requirements `json:"requirements,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
+}
+
+// Requirements lists features an implementation must support to use the
+// volume, e.g. "online-reencrypt-v2" while cryptsetup reencrypts it.
+//
+// Config.Requirements used to be a []string, which could not decode the
+// object LUKS2 stores. Code that read it should read
+// Config.Requirements.Mandatory after a nil check, and code that set it
+// should set &Requirements{Mandatory: flags}.
+type Requirements struct {
+	Mandatory []string `json:"mandatory,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"` // Unknown members, written back unchanged
 }
 
 // FormatOptions contains options for formatting a LUKS2 volume
@@ -165,6 +245,7 @@ type FormatOptions struct {
 	Passphrase     []byte // Initial passphrase
 	Label          string // Volume label (optional)
 	Subsystem      string // Subsystem label (optional)
+	UUID           string // Header UUID, for reproducible image builds (default: random)
 	Cipher         string // Cipher algorithm (default: "aes")
 	CipherMode     string // Cipher mode (default: "xts-plain64")
 	KeySize        int    // Key size in bits (default: 512)
@@ -173,41 +254,195 @@ type FormatOptions struct {
 	KDFType        string // KDF type: "pbkdf2", "argon2i", "argon2id" (default: "argon2id")
 	PBKDFIterTime  int    // Target ms for PBKDF2 (default: 2000)
 	Argon2Time     int    // Argon2 time cost (default: 4)
-	Argon2Memory   int    // Argon2 memory cost in KB (default: 1048576 = 1GB)
+	Argon2Memory   int    // Argon2 memory cost in KB (default: 1048576 = 1GB); memory ceiling when Argon2Auto is set
 	Argon2Parallel int    // Argon2 parallelism (default: 4)
+	Argon2Auto     bool   // Calibrate Argon2 time/memory with BenchmarkArgon2 instead of fixed parameters
+	Argon2IterTime int    // Target ms for Argon2 auto-tuning (default: 2000)
+	MetadataSize   int    // Bytes per header copy incl. JSON area: 16 KiB-4 MiB, power of 2 (default: 16 KiB)
+	KeyslotsSize   int64  // Keyslots area size in bytes, 4 KiB aligned (default: 16 MiB minus both header copies)
+	AFStripes      int    // Anti-forensic stripes of keyslot 0; its area is key size * stripes (default: 4000)
+
+	// Offset and Size confine the volume to a byte range of Device, e.g. to
+	// embed it in a custom image: the container starts Offset bytes in and
+	// is Size bytes long (0 = to the end of Device). Both are multiples of
+	// 512. The range is formatted through a loop device over it, which
+	// needs Linux; everything outside it is left untouched.
+	Offset int64
+	Size   int64
+
+	// PBKDF2 cost of the volume key digest. DigestIterations fixes the
+	// iteration count (at least MinDigestIterations); unset, it is
+	// benchmarked to take DigestIterTime ms (default: DefaultDigestIterTime)
+	// but never set below the DigestIterations constant.
+	DigestIterations int
+	DigestIterTime   int
+
+	// Segments lays out the data area (default: one dynamic crypt segment)
+	Segments []SegmentSpec
+
+	// Escrow wraps the new volume key with an external key management
+	// service and stores it in token 0 (nil = no escrow). The key is wrapped
+	// before anything is written, so an unreachable service leaves the
+	// device untouched. See EscrowVolumeKey for the implications.
+	Escrow KeyEscrow
+
+	// Force formats a device holding a signature ProbeSignatures finds: a
+	// LUKS header (primary or secondary), filesystem, swap area, RAID or LVM
+	// member or partition table. Without it Format refuses with a
+	// SignatureError (ErrDeviceNotEmpty), since that data would be lost;
+	// with it a WarnExistingSignatures warning lists what is overwritten.
+	Force bool
+}
+
+// UnlockOptions contains optional settings for UnlockWithOptions
+type UnlockOptions struct {
+	// Keyslot restricts unlocking to a single keyslot (nil = try all keyslots
+	// by priority). An explicitly selected keyslot is tried even if its
+	// priority is KeyslotPriorityIgnore.
+	Keyslot *int
+
+	// Parallel is the maximum number of keyslots whose keys are derived
+	// concurrently (0 or 1 = one at a time, in priority order). Speeds up
+	// volumes with many Argon2 keyslots at the cost of CPU and memory.
+	Parallel int
+
+	// MemoryLimit caps the combined Argon2 memory of concurrent derivations
+	// in bytes (0 = half of the currently available memory). A single
+	// derivation is always allowed to run.
+	MemoryLimit int64
+
+	// AllowDiscards passes TRIM/DISCARD requests through dm-crypt to the
+	// underlying device (the allow_discards flag), so fstrim works on SSDs.
+	//
+	// WARNING: discards leak information about the encrypted device. Trimmed
+	// blocks read back as zeros, which reveals which blocks are free and can
+	// expose the filesystem type, usage patterns and the approximate amount of
+	// data stored. Only enable this if that is acceptable for your threat
+	// model. Volumes with the FlagAllowDiscards persistent flag get discards
+	// enabled regardless of this option.
+	AllowDiscards bool
+
+	// SameCPUCrypt performs encryption on the CPU that issued the I/O instead
+	// of spreading work across all CPUs (same_cpu_crypt)
+	SameCPUCrypt bool
+
+	// SubmitFromCryptCPUs submits writes from the crypt threads instead of a
+	// single dedicated thread (submit_from_crypt_cpus)
+	SubmitFromCryptCPUs bool
+
+	// NoReadWorkqueue processes reads synchronously instead of queuing them
+	// to the crypt workqueue (no_read_workqueue). Lowers latency on fast
+	// NVMe devices.
+	NoReadWorkqueue bool
+
+	// NoWriteWorkqueue processes writes synchronously instead of queuing them
+	// to the crypt workqueue (no_write_workqueue)
+	NoWriteWorkqueue bool
+
+	// AutoDetachLoop makes a loop device being unlocked, or the loop device
+	// of a partition being unlocked, detach itself when the mapping is
+	// locked (LO_FLAGS_AUTOCLEAR), so Lock leaves no loop device behind.
+	// Ignored for other devices.
+	AutoDetachLoop bool
+
+	// Offset and Size locate a volume formatted on a byte range of the
+	// device (see FormatOptions.Offset; Size 0 = to the end of the device).
+	// The range is unlocked through a loop device over it that detaches
+	// itself when the mapping is locked.
+	Offset int64
+	Size   int64
+}
+
+// EphemeralOptions configures a plain dm-crypt volume keyed by a fresh
+// random key (see CreateEphemeralWithOptions)
+type EphemeralOptions struct {
+	// Cipher is the dm-crypt cipher specification (default: aes-xts-plain64)
+	Cipher string
+
+	// KeySize is the key size in bits (default: 512 for XTS, 256 otherwise)
+	KeySize int
+
+	// SectorSize is the encryption sector size: 512 (default) or 4096
+	SectorSize int
+
+	// Offset is the number of bytes at the start of the device left unmapped
+	Offset int64
+
+	// Swap writes a swap signature to the mapping, like mkswap
+	Swap bool
+
+	// Filesystem, if set, creates this filesystem on the mapping (e.g. ext4
+	// for /tmp); it needs the mkfs tool of the filesystem
+	Filesystem string
+
+	// Label is the swap or filesystem label
+	Label string
+
+	// Force uses a device that holds a LUKS header or a recognizable
+	// filesystem. Without it CreateEphemeral refuses with ErrDeviceNotEmpty,
+	// since whatever is on the device is destroyed.
+	Force bool
+
+	// Unlock holds the dm-crypt flags for the mapping (nil = defaults).
+	// Keyslot options do not apply.
+	Unlock *UnlockOptions
 }
 
 // VolumeInfo contains information about a LUKS volume
 type VolumeInfo struct {
 	UUID           string
 	Label          string
+	Subsystem      string
 	Version        int
 	Cipher         string
-	KeySize        int
+	KeySize        int // Volume key size in bytes, like Keyslot.KeySize (FormatOptions and MappingStatus use bits)
 	SectorSize     int
 	ActiveKeyslots []int
-	Metadata       *LUKS2Metadata
-}
-
-// UnmarshalJSON custom unmarshaler to handle unknown fields in keyslots
-func (k *Keyslot) UnmarshalJSON(data []byte) error {
-	type Alias Keyslot
-	aux := &struct {
-		*Alias
-	}{
-		Alias: (*Alias)(k),
-	}
-
-	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
-	}
-
-	// Store in map for later if needed
-	var raw map[string]interface{}
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return err
-	}
-	k.Custom = raw
-
-	return nil
+
+	// Block sizes of the underlying device (0 when it cannot be inspected)
+	DeviceLogicalBlockSize  int
+	DevicePhysicalBlockSize int
+
+	// Apparent and allocated size of an image file (0 for block devices)
+	FileSize          int64
+	FileAllocatedSize int64
+
+	// Persistent flags and the features an implementation must support to
+	// use the volume (config.requirements.mandatory)
+	Flags         []string
+	RequiresFlags []string
+
+	// Data segment (the first crypt segment)
+	DataOffset int64
+	DataSize   int64          // 0 = dynamic, up to the end of the device
+	Integrity  *IntegrityInfo // nil = no integrity protection
+
+	// Size of each header copy (binary header and JSON area) and of the
+	// keyslots area following both copies
+	HeaderSize   int64
+	KeyslotsSize int64
+
+	// SecondaryHeaderHealthy reports whether the secondary header copy is
+	// valid and in sync with the active copy; Headers has the details
+	SecondaryHeaderHealthy bool
+	Headers                *HeaderStatus
+
+	Keyslots []KeyslotInfo  // By ID
+	Tokens   []TokenSummary // By ID
+
+	Metadata *LUKS2Metadata
+}
+
+// IntegrityInfo describes the dm-integrity protection of a data segment
+type IntegrityInfo struct {
+	Type              string // e.g. "hmac(sha256)"
+	JournalEncryption string // "none" unless the journal is encrypted
+	JournalIntegrity  string // "none" unless the journal is authenticated
+}
+
+// TokenSummary describes a token without its type-specific data
+type TokenSummary struct {
+	ID       int
+	Type     string
+	Keyslots []int
 }
@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// udevControlPath exists while udevd is running (overridable for tests)
+var udevControlPath = "/run/udev/control"
+
+// udevDataDir holds udev's database entry for every device it has
+// processed (overridable for tests)
+var udevDataDir = "/run/udev/data"
+
+// udevWaitTimeout bounds how long Unlock and Lock wait for udev to finish
+// with a mapping's device nodes before handling them directly
+var udevWaitTimeout = 3 * time.Second
+
+// udevRunning reports whether udevd is managing device nodes. Without it
+// (containers, initramfs without udev) nobody else creates or removes the
+// nodes, so there is nothing to wait for.
+func udevRunning() bool {
+	_, err := os.Stat(udevControlPath)
+	return err == nil
+}
+
+// udevDataPath returns the udev database entry of a block device. udevd
+// creates it when it has processed the device's add event and deletes it
+// when it has processed the remove event, along with the device's links.
+func udevDataPath(devNo uint64) string {
+	return filepath.Join(udevDataDir, fmt.Sprintf("b%d:%d", unix.Major(devNo), unix.Minor(devNo)))
+}
+
+// isDeviceNode reports whether path exists and resolves to a device node
+func isDeviceNode(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeDevice != 0
+}
+
+// pathGone reports whether path no longer exists (a dangling symlink still
+// counts as existing)
+func pathGone(path string) bool {
+	_, err := os.Lstat(path)
+	return os.IsNotExist(err)
+}
+
+// waitForPath waits until done reports true, re-checking whenever an entry
+// of dir is created, removed or renamed, and at least every 100ms for
+// changes inotify cannot see (such as the target of a symlink in dir
+// appearing elsewhere). This replaces udev's cookie semaphore: instead of
+// waiting for udevd to signal that it processed our event, we watch for the
+// result. It reports whether done was reached within timeout.
+func waitForPath(dir string, done func() bool, timeout time.Duration) bool {
+	if done() {
+		return true
+	}
+	deadline := time.Now().Add(timeout)
+
+	// Without inotify (or before dir exists) this degrades to polling
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err == nil {
+		const mask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_ATTRIB
+		if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+			_ = unix.Close(fd)
+			fd = -1
+		}
+	} else {
+		fd = -1
+	}
+	if fd >= 0 {
+		defer func() { _ = unix.Close(fd) }()
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return done()
+		}
+		wait := min(remaining, 100*time.Millisecond)
+
+		if fd >= 0 {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}} // #nosec G115 -- file descriptors fit in int32
+			if n, _ := unix.Poll(fds, int(wait.Milliseconds())); n > 0 {
+				// The events only wake us up; done decides
+				for {
+					if n, err := unix.Read(fd, buf); n <= 0 || err != nil {
+						break
+					}
+				}
+			}
+		} else {
+			time.Sleep(wait)
+		}
+
+		if done() {
+			return true
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestWaitForPath tests waking up on directory changes
+func TestWaitForPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "node")
+	exists := func() bool { return !pathGone(path) }
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(path, nil, 0600)
+	}()
+	start := time.Now()
+	if !waitForPath(dir, exists, 5*time.Second) {
+		t.Fatal("waitForPath missed the creation")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("waitForPath took %v", elapsed)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Remove(path)
+	}()
+	if !waitForPath(dir, func() bool { return pathGone(path) }, 5*time.Second) {
+		t.Fatal("waitForPath missed the removal")
+	}
+}
+
+// TestWaitForPath_Timeout tests giving up when the state is never reached
+func TestWaitForPath_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+	if waitForPath(dir, func() bool { return false }, 150*time.Millisecond) {
+		t.Error("waitForPath reported success")
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("waitForPath returned after %v", elapsed)
+	}
+
+	// A missing directory falls back to polling
+	calls := 0
+	done := func() bool { calls++; return calls > 2 }
+	if !waitForPath(filepath.Join(dir, "missing"), done, 5*time.Second) {
+		t.Error("waitForPath without inotify missed the change")
+	}
+}
+
+// TestUdevHelpers tests udev detection and database paths
+func TestUdevHelpers(t *testing.T) {
+	dir := t.TempDir()
+	oldControl, oldData := udevControlPath, udevDataDir
+	udevControlPath = filepath.Join(dir, "control")
+	udevDataDir = filepath.Join(dir, "data")
+	t.Cleanup(func() { udevControlPath, udevDataDir = oldControl, oldData })
+
+	if udevRunning() {
+		t.Error("udevRunning() without a control socket")
+	}
+	if err := os.WriteFile(udevControlPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !udevRunning() {
+		t.Error("udevRunning() = false with a control socket")
+	}
+
+	if got, want := udevDataPath(unix.Mkdev(253, 3)), filepath.Join(udevDataDir, "b253:3"); got != want {
+		t.Errorf("udevDataPath() = %s, want %s", got, want)
+	}
+	// Minors above 255 use the split encoding of the dm ioctl
+	if got, want := udevDataPath(unix.Mkdev(253, 300)), filepath.Join(udevDataDir, "b253:300"); got != want {
+		t.Errorf("udevDataPath() = %s, want %s", got, want)
+	}
+}
+
+// TestIsDeviceNode tests telling device nodes from other files
+func TestIsDeviceNode(t *testing.T) {
+	if !isDeviceNode("/dev/null") {
+		t.Error("/dev/null is a device node")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if isDeviceNode(file) || isDeviceNode(file+".missing") {
+		t.Error("regular and missing files are not device nodes")
+	}
+
+	link := filepath.Join(t.TempDir(), "dangling")
+	if err := os.Symlink("/nonexistent/dm-99", link); err != nil {
+		t.Fatal(err)
+	}
+	if isDeviceNode(link) || pathGone(link) {
+		t.Error("a dangling symlink is neither a device node nor gone")
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Package udisks opens and mounts LUKS volumes through the UDisks2 daemon
+// on the system D-Bus. Desktop systems let the logged-in user unlock and
+// mount removable and loop-backed volumes through UDisks2, subject to
+// polkit, so this is how luks2 works without root there.
+//
+// UDisks2 chooses the mapping name (luks-<uuid>) and the mount point
+// (typically /run/media/<user>/<label>); callers cannot pick either. The
+// passphrase crosses D-Bus as a string, which cannot be wiped afterwards.
+package udisks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busName        = "org.freedesktop.UDisks2"
+	rootPath       = dbus.ObjectPath("/org/freedesktop/UDisks2")
+	managerPath    = dbus.ObjectPath("/org/freedesktop/UDisks2/Manager")
+	ifaceManager   = "org.freedesktop.UDisks2.Manager"
+	ifaceBlock     = "org.freedesktop.UDisks2.Block"
+	ifaceEncrypted = "org.freedesktop.UDisks2.Encrypted"
+	ifaceFS        = "org.freedesktop.UDisks2.Filesystem"
+	ifaceLoop      = "org.freedesktop.UDisks2.Loop"
+)
+
+// ErrNotAvailable is returned when the system bus or the UDisks2 daemon
+// cannot be reached
+var ErrNotAvailable = errors.New("udisks2 not available")
+
+// objects is the reply of ObjectManager.GetManagedObjects: object path ->
+// interface -> property -> value
+type objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+// Client talks to the UDisks2 daemon
+type Client struct {
+	conn *dbus.Conn
+}
+
+// Volume is a volume opened and mounted through UDisks2
+type Volume struct {
+	Device     string // Device or image file that was opened
+	LoopDevice string // Loop device set up for an image file ("" for block devices)
+	Cleartext  string // Unlocked device-mapper device (e.g. /dev/dm-0)
+	MountPoint string // Mount point chosen by UDisks2
+}
+
+// Connect connects to the system bus and makes sure the UDisks2 daemon
+// answers, starting it through D-Bus activation if needed
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAvailable, err)
+	}
+	if err := conn.Object(busName, rootPath).Call("org.freedesktop.DBus.Peer.Ping", 0).Err; err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrNotAvailable, err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the D-Bus connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// OpenAndMount unlocks a LUKS device or image file and mounts its
+// filesystem. An image file is first attached to a loop device that
+// detaches itself when the volume is locked. fsType and options may be
+// empty to let UDisks2 decide. If any step fails, the steps before it are
+// undone.
+func (c *Client) OpenAndMount(device string, passphrase []byte, fsType, options string) (*Volume, error) {
+	vol := &Volume{Device: device}
+
+	fi, err := os.Stat(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var block dbus.ObjectPath
+	isFile := fi.Mode().IsRegular()
+	if isFile {
+		if block, err = c.loopSetup(device); err != nil {
+			return nil, err
+		}
+		vol.LoopDevice, _ = c.deviceOf(block)
+	} else {
+		objs, err := c.managedObjects()
+		if err != nil {
+			return nil, err
+		}
+		if block = findBlock(objs, device); block == "" {
+			return nil, fmt.Errorf("udisks2 does not know %s", device)
+		}
+	}
+
+	var cleartext dbus.ObjectPath
+	if err := c.call(block, ifaceEncrypted+".Unlock", []any{&cleartext}, string(passphrase), noOptions()); err != nil {
+		if isFile {
+			_ = c.call(block, ifaceLoop+".Delete", nil, noOptions())
+		}
+		return nil, fmt.Errorf("udisks2 unlock failed: %w", err)
+	}
+	if isFile {
+		// Set only now: an autoclear loop device detaches on its last close,
+		// which without the mapping holding it would be right away
+		_ = c.call(block, ifaceLoop+".SetAutoclear", nil, true, noOptions())
+	}
+	vol.Cleartext, _ = c.deviceOf(cleartext)
+
+	mountOpts := noOptions()
+	if fsType != "" {
+		mountOpts["fstype"] = dbus.MakeVariant(fsType)
+	}
+	if options != "" {
+		mountOpts["options"] = dbus.MakeVariant(options)
+	}
+	if err := c.call(cleartext, ifaceFS+".Mount", []any{&vol.MountPoint}, mountOpts); err != nil {
+		_ = c.call(block, ifaceEncrypted+".Lock", nil, noOptions())
+		return nil, fmt.Errorf("udisks2 mount failed: %w", err)
+	}
+
+	return vol, nil
+}
+
+// UnmountAndClose unmounts the filesystem at mountPoint and locks the LUKS
+// device behind it. A loop device set up by OpenAndMount detaches with it;
+// other loop devices are deleted explicitly.
+func (c *Client) UnmountAndClose(mountPoint string) error {
+	objs, err := c.managedObjects()
+	if err != nil {
+		return err
+	}
+
+	fs := findMountPoint(objs, filepath.Clean(mountPoint))
+	if fs == "" {
+		return fmt.Errorf("udisks2 has nothing mounted at %s", mountPoint)
+	}
+	backing, ok := objs[fs][ifaceBlock]["CryptoBackingDevice"].Value().(dbus.ObjectPath)
+	if !ok || backing == "/" {
+		return fmt.Errorf("%s is not an encrypted volume", mountPoint)
+	}
+
+	if err := c.call(fs, ifaceFS+".Unmount", nil, noOptions()); err != nil {
+		return fmt.Errorf("udisks2 unmount failed: %w", err)
+	}
+	if err := c.call(backing, ifaceEncrypted+".Lock", nil, noOptions()); err != nil {
+		return fmt.Errorf("udisks2 lock failed: %w", err)
+	}
+	if loop, ok := objs[backing][ifaceLoop]; ok {
+		if autoclear, _ := loop["Autoclear"].Value().(bool); !autoclear {
+			if err := c.call(backing, ifaceLoop+".Delete", nil, noOptions()); err != nil {
+				return fmt.Errorf("udisks2 loop delete failed: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loopSetup attaches an image file to a loop device. UDisks2 opens nothing
+// itself; it is handed our file descriptor, so the caller's access to the
+// file is what counts.
+func (c *Client) loopSetup(file string) (dbus.ObjectPath, error) {
+	f, err := os.OpenFile(file, os.O_RDWR, 0) // #nosec G304 -- image path chosen by the caller
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	fd := dbus.UnixFD(f.Fd()) // #nosec G115 -- file descriptors fit in int32
+	var loop dbus.ObjectPath
+	if err := c.call(managerPath, ifaceManager+".LoopSetup", []any{&loop}, fd, noOptions()); err != nil {
+		return "", fmt.Errorf("udisks2 loop setup failed: %w", err)
+	}
+	return loop, nil
+}
+
+// deviceOf returns the device node of a block object
+func (c *Client) deviceOf(path dbus.ObjectPath) (string, error) {
+	v, err := c.conn.Object(busName, path).GetProperty(ifaceBlock + ".Device")
+	if err != nil {
+		return "", err
+	}
+	return byteString(v), nil
+}
+
+// managedObjects returns every object UDisks2 exports
+func (c *Client) managedObjects() (objects, error) {
+	var objs objects
+	if err := c.call(rootPath, "org.freedesktop.DBus.ObjectManager.GetManagedObjects", []any{&objs}); err != nil {
+		return nil, fmt.Errorf("udisks2 object listing failed: %w", err)
+	}
+	return objs, nil
+}
+
+// call invokes a UDisks2 method and stores its results in out
+func (c *Client) call(path dbus.ObjectPath, method string, out []any, args ...any) error {
+	call := c.conn.Object(busName, path).Call(method, 0, args...)
+	if call.Err != nil || len(out) == 0 {
+		return call.Err
+	}
+	return call.Store(out...)
+}
+
+// noOptions returns an empty a{sv} options dictionary
+func noOptions() map[string]dbus.Variant {
+	return map[string]dbus.Variant{}
+}
+
+// findBlock returns the block object whose device node, preferred device or
+// one of whose symlinks (e.g. /dev/disk/by-uuid/...) is device
+func findBlock(objs objects, device string) dbus.ObjectPath {
+	target := device
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		target = resolved
+	}
+
+	for path, ifaces := range objs {
+		block, ok := ifaces[ifaceBlock]
+		if !ok {
+			continue
+		}
+		names := []string{byteString(block["Device"]), byteString(block["PreferredDevice"])}
+		names = append(names, byteStrings(block["Symlinks"])...)
+		if slices.Contains(names, device) || slices.Contains(names, target) {
+			return path
+		}
+	}
+	return ""
+}
+
+// findMountPoint returns the filesystem object mounted at mountPoint
+func findMountPoint(objs objects, mountPoint string) dbus.ObjectPath {
+	for path, ifaces := range objs {
+		if fs, ok := ifaces[ifaceFS]; ok && slices.Contains(byteStrings(fs["MountPoints"]), mountPoint) {
+			return path
+		}
+	}
+	return ""
+}
+
+// byteString decodes a NUL-terminated D-Bus byte array (type ay)
+func byteString(v dbus.Variant) string {
+	b, _ := v.Value().([]byte)
+	if i := slices.Index(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// byteStrings decodes an array of NUL-terminated byte arrays (type aay)
+func byteStrings(v dbus.Variant) []string {
+	list, _ := v.Value().([][]byte)
+	strs := make([]string, 0, len(list))
+	for _, b := range list {
+		strs = append(strs, byteString(dbus.MakeVariant(b)))
+	}
+	return strs
+}
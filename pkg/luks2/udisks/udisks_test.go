@@ -0,0 +1,92 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package udisks
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// ay encodes a string as UDisks2 does: a NUL-terminated byte array
+func ay(s string) dbus.Variant {
+	return dbus.MakeVariant(append([]byte(s), 0))
+}
+
+// aay encodes a list of strings as an array of NUL-terminated byte arrays
+func aay(strs ...string) dbus.Variant {
+	list := make([][]byte, 0, len(strs))
+	for _, s := range strs {
+		list = append(list, append([]byte(s), 0))
+	}
+	return dbus.MakeVariant(list)
+}
+
+// testObjects mimics GetManagedObjects with a LUKS partition unlocked and
+// mounted, and an unrelated disk
+func testObjects() objects {
+	return objects{
+		"/org/freedesktop/UDisks2/block_devices/sda": {
+			ifaceBlock: {"Device": ay("/dev/sda"), "PreferredDevice": ay("/dev/sda"), "Symlinks": aay("/dev/disk/by-id/ata-disk")},
+		},
+		"/org/freedesktop/UDisks2/block_devices/sdb1": {
+			ifaceBlock:     {"Device": ay("/dev/sdb1"), "PreferredDevice": ay("/dev/sdb1"), "Symlinks": aay("/dev/disk/by-uuid/1234", "/dev/disk/by-label/secret")},
+			ifaceEncrypted: {},
+		},
+		"/org/freedesktop/UDisks2/block_devices/dm_2d0": {
+			ifaceBlock: {"Device": ay("/dev/dm-0"), "PreferredDevice": ay("/dev/mapper/luks-1234"), "CryptoBackingDevice": dbus.MakeVariant(dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/sdb1"))},
+			ifaceFS:    {"MountPoints": aay("/run/media/user/secret")},
+		},
+	}
+}
+
+// TestFindBlock tests locating block objects by device node or symlink
+func TestFindBlock(t *testing.T) {
+	objs := testObjects()
+	tests := []struct {
+		device string
+		want   dbus.ObjectPath
+	}{
+		{"/dev/sdb1", "/org/freedesktop/UDisks2/block_devices/sdb1"},
+		{"/dev/disk/by-label/secret", "/org/freedesktop/UDisks2/block_devices/sdb1"},
+		{"/dev/mapper/luks-1234", "/org/freedesktop/UDisks2/block_devices/dm_2d0"},
+		{"/dev/sdz", ""},
+	}
+	for _, tt := range tests {
+		if got := findBlock(objs, tt.device); got != tt.want {
+			t.Errorf("findBlock(%s) = %q, want %q", tt.device, got, tt.want)
+		}
+	}
+}
+
+// TestFindMountPoint tests locating the filesystem mounted at a path
+func TestFindMountPoint(t *testing.T) {
+	objs := testObjects()
+	if got := findMountPoint(objs, "/run/media/user/secret"); got != "/org/freedesktop/UDisks2/block_devices/dm_2d0" {
+		t.Errorf("findMountPoint() = %q", got)
+	}
+	if got := findMountPoint(objs, "/mnt"); got != "" {
+		t.Errorf("findMountPoint(/mnt) = %q, want none", got)
+	}
+}
+
+// TestByteStrings tests decoding D-Bus byte arrays
+func TestByteStrings(t *testing.T) {
+	if got := byteString(ay("/dev/sdb1")); got != "/dev/sdb1" {
+		t.Errorf("byteString() = %q", got)
+	}
+	if got := byteString(dbus.MakeVariant([]byte("/dev/sdb1"))); got != "/dev/sdb1" {
+		t.Errorf("byteString() without NUL = %q", got)
+	}
+	if got := byteString(dbus.MakeVariant(true)); got != "" {
+		t.Errorf("byteString() of a bool = %q", got)
+	}
+	if got := byteStrings(aay("/a", "/b")); !slices.Equal(got, []string{"/a", "/b"}) {
+		t.Errorf("byteStrings() = %q", got)
+	}
+}
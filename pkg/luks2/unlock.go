@@ -2,14 +2,15 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package luks2
 
 import (
-	"crypto/subtle"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 	"unsafe"
@@ -20,6 +21,44 @@ import (
 
 // Unlock opens a LUKS2 volume and creates a device-mapper mapping
 func Unlock(device string, passphrase []byte, name string) error {
+	return UnlockWithOptions(device, passphrase, name, nil)
+}
+
+// UnlockSlot opens a LUKS2 volume trying only the given keyslot, like
+// cryptsetup open --key-slot. It skips the key derivation of every other
+// keyslot, and picks between keyslots that share the passphrase. An
+// explicitly selected keyslot is tried even if its priority is
+// KeyslotPriorityIgnore; a missing one fails with ErrInvalidKeyslot.
+func UnlockSlot(device string, passphrase []byte, slot int, name string) error {
+	return UnlockWithOptions(device, passphrase, name, &UnlockOptions{Keyslot: &slot})
+}
+
+// UnlockWithOptions opens a LUKS2 volume and creates a device-mapper mapping
+// using the given options (nil = defaults, identical to Unlock)
+func UnlockWithOptions(device string, passphrase []byte, name string, opts *UnlockOptions) (err error) {
+	if opts == nil {
+		opts = &UnlockOptions{}
+	}
+	if unlocksRegion(opts) {
+		return unlockRegion(device, opts, func(loop string, region *UnlockOptions) error {
+			return UnlockWithOptions(loop, passphrase, name, region)
+		})
+	}
+
+	// The event reports the keyslot that opened, or the one requested if
+	// the unlock failed
+	start := time.Now()
+	matched := opts.Keyslot
+	defer func() {
+		observeUnlock(start, err)
+		event := Event{Type: EventUnlockSucceeded, Op: "unlock", Device: device, Name: name, Keyslot: matched}
+		if err != nil {
+			event.Type = EventUnlockFailed
+			event.Error = err.Error()
+		}
+		emitEvent(event)
+	}()
+
 	// Validate device path
 	if err := ValidateDevicePath(device); err != nil {
 		return err
@@ -44,94 +83,86 @@ func Unlock(device string, passphrase []byte, name string) error {
 	}
 
 	// Read header and metadata (use original device for reading, symlink is fine for open())
-	hdr, metadata, err := ReadHeader(device)
+	hdr, metadata, err := readHeader(device)
 	if err != nil {
 		return err
 	}
 
-	// Try each keyslot by priority
-	var masterKey []byte
-	var unlocked bool
-
-	for _, keyslot := range metadata.Keyslots {
-		if keyslot.Type != "luks2" {
-			continue
-		}
-
-		// Try to unlock with this keyslot
-		mk, err := unlockKeyslot(device, passphrase, keyslot, metadata.Digests)
-		if err != nil {
-			continue // Try next keyslot
-		}
-
-		masterKey = mk
-		unlocked = true
-		break
+	// Fail before the expensive key derivation if the kernel cannot
+	// service the data cipher
+	if err := checkKernelCiphers(metadata); err != nil {
+		return err
 	}
 
-	if !unlocked {
-		return fmt.Errorf("failed to unlock any keyslot: incorrect passphrase")
+	// Try each keyslot by priority
+	masterKey, slot, err := getMasterKeyWithOptions(device, passphrase, metadata, opts)
+	if err != nil {
+		return fmt.Errorf("failed to unlock any keyslot: %w", err)
 	}
-	defer clearBytes(masterKey)
+	defer masterKey.Destroy()
+	matched = &slot
 
-	// Get segment information
-	var segment *Segment
-	for _, seg := range metadata.Segments {
-		if seg.Type == "crypt" {
-			segment = seg
-			break
-		}
+	if err := activateVolume(device, realDevice, hdr, metadata, masterKey.Bytes(), name, cryptFlags(metadata, opts)); err != nil {
+		return err
 	}
 
-	if segment == nil {
-		return fmt.Errorf("no crypt segment found")
-	}
+	return autoDetachLoop(realDevice, name, opts)
+}
 
-	// Parse segment offset
-	offsetBytes, err := parseSize(segment.Offset)
-	if err != nil {
-		return fmt.Errorf("invalid segment offset: %w", err)
+// autoDetachLoop applies opts.AutoDetachLoop to the mapping name just
+// activated on realDevice. The mapping now holds the loop device open,
+// through one of its partitions or directly, so autoclear only fires once
+// Lock removes it. On failure the mapping is removed again.
+func autoDetachLoop(realDevice, name string, opts *UnlockOptions) error {
+	if opts == nil || !opts.AutoDetachLoop {
+		return nil
 	}
-
-	// Get device size for dynamic segments
-	var sizeBytes int64
-	if segment.Size == "dynamic" {
-		// For block devices, we need to use ioctl to get the size
-		devSize, err := getBlockDeviceSize(device)
-		if err != nil {
-			return fmt.Errorf("failed to get device size: %w", err)
-		}
-		sizeBytes = devSize - offsetBytes
-	} else {
-		sizeBytes, err = parseSize(segment.Size)
-		if err != nil {
-			return fmt.Errorf("invalid segment size: %w", err)
+	if loop := loopDeviceOf(realDevice); loop != "" {
+		if err := setLoopAutoclear(loop); err != nil {
+			_ = Lock(name)
+			return err
 		}
 	}
+	return nil
+}
 
-	// Safe conversion of sizes to uint64
-	length, err := SafeInt64ToUint64(sizeBytes)
-	if err != nil {
-		return fmt.Errorf("invalid segment size: %w", err)
-	}
-	backendOffset, err := SafeInt64ToUint64(offsetBytes)
-	if err != nil {
-		return fmt.Errorf("invalid segment offset: %w", err)
+// cryptFlags returns the dm-crypt optional parameters for an unlock. Flags
+// persisted in the volume config (see SetPersistentFlags) are applied in
+// addition to those requested in opts, like cryptsetup does.
+func cryptFlags(metadata *LUKS2Metadata, opts *UnlockOptions) []string {
+	if opts == nil {
+		opts = &UnlockOptions{}
+	}
+
+	flags := []struct {
+		enabled    bool
+		persistent string
+		dmFlag     string
+	}{
+		{opts.AllowDiscards, FlagAllowDiscards, devmapper.CryptFlagAllowDiscards},
+		{opts.SameCPUCrypt, FlagSameCPUCrypt, devmapper.CryptFlagSameCPUCrypt},
+		{opts.SubmitFromCryptCPUs, FlagSubmitFromCryptCPUs, devmapper.CryptFlagSubmitFromCryptCPUs},
+		{opts.NoReadWorkqueue, FlagNoReadWorkqueue, devmapper.CryptFlagNoReadWorkqueue},
+		{opts.NoWriteWorkqueue, FlagNoWriteWorkqueue, devmapper.CryptFlagNoWriteWorkqueue},
+	}
+
+	var result []string
+	for _, f := range flags {
+		if f.enabled || (metadata.Config != nil && slices.Contains(metadata.Config.Flags, f.persistent)) {
+			result = append(result, f.dmFlag)
+		}
 	}
+	return result
+}
 
-	// Create device-mapper table
-	// Note: The devmapper library expects Length and BackendOffset in BYTES
-	// (it converts them to sectors internally)
-	// IMPORTANT: Use realDevice (resolved symlink) for devmapper, not the original device path
-	table := devmapper.CryptTable{
-		Start:         0,
-		Length:        length,
-		BackendDevice: realDevice,
-		BackendOffset: backendOffset,
-		Encryption:    segment.Encryption,
-		Key:           masterKey,
-		IVTweak:       parseIVTweak(segment.IVTweak),
-		SectorSize:    uint64(segment.SectorSize), // #nosec G115 - sector size is validated (512 or 4096)
+// activateVolume creates the dm-crypt mapping for the first crypt segment using
+// an already-verified master key. realDevice must be the symlink-resolved path
+// and flags are the dm-crypt optional parameters (e.g. allow_discards).
+func activateVolume(device, realDevice string, hdr *LUKS2BinaryHeader, metadata *LUKS2Metadata, masterKey []byte, name string, flags []string) error {
+	// Build one target per data segment
+	tables, err := segmentTables(device, realDevice, metadata, masterKey, flags)
+	if err != nil {
+		return err
 	}
 
 	// Generate UUID for device-mapper
@@ -140,8 +171,8 @@ func Unlock(device string, passphrase []byte, name string) error {
 		name)
 
 	// Create and load the device-mapper target
-	if err := devmapper.CreateAndLoad(name, uuid, 0, table); err != nil {
-		return fmt.Errorf("failed to create device-mapper: %w", err)
+	if err := devmapper.CreateAndLoad(name, uuid, 0, tables...); err != nil {
+		return fmt.Errorf("failed to create device-mapper: %w", privilegeError("unlock", false, err))
 	}
 
 	// Ensure device node exists (may need to create it in containerized environments)
@@ -156,23 +187,85 @@ func Unlock(device string, passphrase []byte, name string) error {
 	return nil
 }
 
-// TrimRight is a helper function to replace bytes.TrimRight
-func TrimRight(b []byte, cutset string) []byte {
-	i := len(b)
-	for i > 0 {
-		found := false
-		for _, c := range cutset {
-			if b[i-1] == byte(c) {
-				found = true
-				break
+// segmentTables builds one device-mapper target per mapped segment, laid
+// out back to back from the start of the mapping
+func segmentTables(device, realDevice string, metadata *LUKS2Metadata, masterKey []byte, flags []string) ([]devmapper.Table, error) {
+	segs, err := mappedSegments(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []devmapper.Table
+	var start uint64
+	for _, seg := range segs {
+		// Parse segment offset
+		offsetBytes, err := parseSize(seg.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment offset: %w", err)
+		}
+
+		// Get device size for dynamic segments
+		var sizeBytes int64
+		if seg.Size == "dynamic" {
+			// For block devices, we need to use ioctl to get the size
+			devSize, err := getBlockDeviceSize(device)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get device size: %w", err)
+			}
+			sizeBytes = devSize - offsetBytes
+			// dm-crypt maps whole encryption sectors only
+			if seg.Type == SegmentTypeCrypt && seg.SectorSize > 0 {
+				sizeBytes -= sizeBytes % int64(seg.SectorSize)
+			}
+		} else {
+			sizeBytes, err = parseSize(seg.Size)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment size: %w", err)
 			}
 		}
-		if !found {
-			break
+
+		// Safe conversion of sizes to uint64
+		length, err := SafeInt64ToUint64(sizeBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment size: %w", err)
+		}
+		backendOffset, err := SafeInt64ToUint64(offsetBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment offset: %w", err)
+		}
+
+		// Note: The devmapper library expects Start, Length and BackendOffset
+		// in BYTES (it converts them to sectors internally)
+		// IMPORTANT: Use realDevice (resolved symlink) for devmapper, not the original device path
+		if seg.Type == SegmentTypeLinear {
+			tables = append(tables, devmapper.LinearTable{
+				Start:         start,
+				Length:        length,
+				BackendDevice: realDevice,
+				BackendOffset: backendOffset,
+			})
+		} else {
+			// LUKS2 counts IVs in encryption sectors, not 512-byte units
+			segFlags := flags
+			if seg.SectorSize > LUKS2SectorSize {
+				segFlags = append(slices.Clone(flags), CryptFlagIVLargeSectors)
+			}
+			tables = append(tables, devmapper.CryptTable{
+				Start:         start,
+				Length:        length,
+				BackendDevice: realDevice,
+				BackendOffset: backendOffset,
+				Encryption:    seg.Encryption,
+				Key:           masterKey,
+				IVTweak:       parseIVTweak(seg.IVTweak),
+				Flags:         segFlags,
+				SectorSize:    uint64(seg.SectorSize), // #nosec G115 - sector size is validated (512 or 4096)
+			})
 		}
-		i--
+		start += length
 	}
-	return b[:i]
+
+	return tables, nil
 }
 
 // ensureDeviceNode creates the /dev/dm-X device node if it doesn't exist.
@@ -231,16 +324,16 @@ func ensureDeviceNode(name string) error {
 // If udev doesn't create the device nodes in time, it creates them manually.
 func waitForDeviceReady(name string) error {
 	mapperPath := fmt.Sprintf("/dev/mapper/%s", name)
+	mapperReady := func() bool { return isDeviceNode(mapperPath) }
 
-	// Wait up to 3 seconds for udev to create /dev/mapper/{name}
-	for i := 0; i < 30; i++ {
-		// Check if /dev/mapper/name exists and is a block device
-		if fi, err := os.Stat(mapperPath); err == nil {
-			if fi.Mode()&os.ModeDevice != 0 {
-				return nil
-			}
+	// Wait for udev to create /dev/mapper/{name}. Without udev nobody will,
+	// so the nodes are created right away.
+	if udevRunning() {
+		if waitForPath(filepath.Dir(mapperPath), mapperReady, udevWaitTimeout) {
+			return nil
 		}
-		time.Sleep(100 * time.Millisecond)
+	} else if mapperReady() {
+		return nil
 	}
 
 	// udev hasn't created the device yet - create it manually
@@ -264,17 +357,8 @@ func waitForDeviceReady(name string) error {
 	}
 	dmPath := fmt.Sprintf("/dev/dm-%d", minor)
 
-	// Wait briefly for dm-X device node to exist
-	dmExists := false
-	for i := 0; i < 20; i++ {
-		if fi, err := os.Stat(dmPath); err == nil {
-			if fi.Mode()&os.ModeDevice != 0 {
-				dmExists = true
-				break
-			}
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
+	// Wait briefly for devtmpfs to create the dm-X device node
+	dmExists := waitForPath(filepath.Dir(dmPath), func() bool { return isDeviceNode(dmPath) }, 2*time.Second)
 
 	// If dm-X doesn't exist, create it with mknod
 	if !dmExists {
@@ -327,19 +411,59 @@ func waitForDeviceReady(name string) error {
 	return fmt.Errorf("device %s not ready after creating symlink", mapperPath)
 }
 
-// Lock closes a device-mapper mapping
-func Lock(name string) error {
+// LockOption changes how Lock closes a mapping
+type LockOption func(*lockOptions)
+
+// lockOptions holds the settings applied by LockOption functions
+type lockOptions struct {
+	deferred bool
+}
+
+// WithDeferred makes Lock schedule the removal of a mapping that is still in
+// use (mounted, or held open by a process) instead of failing with EBUSY.
+// The kernel removes the mapping once its last user closes it; until then
+// IsUnlocked keeps reporting it and VolumeStatus.DeferredRemove is set. A
+// mapping that is not in use is removed right away.
+func WithDeferred() LockOption {
+	return func(o *lockOptions) {
+		o.deferred = true
+	}
+}
+
+// Lock closes a device-mapper mapping. A loop device unlocked with
+// UnlockOptions.AutoDetachLoop is detached by the kernel along with it.
+func Lock(name string, opts ...LockOption) error {
+	var o lockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// Get device info before removing (to find the device node path)
 	info, _ := devmapper.InfoByName(name)
 
-	if err := devmapper.Remove(name); err != nil {
-		return fmt.Errorf("failed to remove device-mapper: %w", err)
+	if o.deferred {
+		if err := dmRemove(name, unix.DM_DEFERRED_REMOVE); err != nil {
+			return fmt.Errorf("failed to remove device-mapper: %w", privilegeError("lock", false, err))
+		}
+		if _, err := devmapper.InfoByName(name); err == nil {
+			// Removal is pending; the device nodes are still in use
+			return nil
+		}
+	} else if err := devmapper.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove device-mapper: %w", privilegeError("lock", false, err))
+	}
+
+	// Let udev process the remove event before returning: it deletes
+	// /dev/mapper/{name} and the device's other links itself, and a mapping
+	// created under the same name right after Lock must not race with it
+	if info != nil && udevRunning() {
+		db := udevDataPath(info.DevNo)
+		waitForPath(udevDataDir, func() bool { return pathGone(db) }, udevWaitTimeout)
 	}
 
 	// Clean up device nodes that we may have created
 	if info != nil {
-		minor := info.DevNo & 0xFF
-		dmPath := fmt.Sprintf("/dev/dm-%d", minor)
+		dmPath := fmt.Sprintf("/dev/dm-%d", unix.Minor(info.DevNo))
 		_ = os.Remove(dmPath) // Ignore error - may already be gone
 	}
 	mapperPath := fmt.Sprintf("/dev/mapper/%s", name)
@@ -348,6 +472,34 @@ func Lock(name string) error {
 	return nil
 }
 
+// dmRemove issues DM_DEV_REMOVE with the given ioctl flags, which
+// devmapper.Remove does not take
+func dmRemove(name string, flags uint32) error {
+	// DM_UDEV_PRIMARY_SOURCE_FLAG in the udev cookie field, as libdevmapper
+	// sets it for removals
+	const udevPrimarySource = 0x0040 << 16
+
+	control, err := os.OpenFile(dmControlPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open device-mapper control: %w", err)
+	}
+	defer func() { _ = control.Close() }()
+
+	buf := make([]byte, unix.SizeofDmIoctl)
+	ioc := (*unix.DmIoctl)(unsafe.Pointer(&buf[0]))
+	ioc.Version = [3]uint32{4, 0, 0}
+	ioc.Data_size = unix.SizeofDmIoctl
+	ioc.Data_start = unix.SizeofDmIoctl
+	ioc.Flags = flags
+	ioc.Event_nr = udevPrimarySource
+	copy(ioc.Name[:], name)
+
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, control.Fd(), unix.DM_DEV_REMOVE, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 // IsUnlocked checks if a device-mapper mapping exists
 func IsUnlocked(name string) bool {
 	// Check dmsetup directly first - this is authoritative
@@ -409,106 +561,6 @@ func GetMappedDevicePath(name string) (string, error) {
 	return dmPath, nil
 }
 
-// unlockKeyslot attempts to unlock a keyslot with the given passphrase
-func unlockKeyslot(device string, passphrase []byte, keyslot *Keyslot, digests map[string]*Digest) ([]byte, error) {
-	// Derive key from passphrase
-	passphraseKey, err := DeriveKey(passphrase, keyslot.KDF, keyslot.KeySize)
-	if err != nil {
-		return nil, err
-	}
-	defer clearBytes(passphraseKey)
-
-	// Read encrypted key material from keyslot area
-	offset, err := parseSize(keyslot.Area.Offset)
-	if err != nil {
-		return nil, err
-	}
-
-	size, err := parseSize(keyslot.Area.Size)
-	if err != nil {
-		return nil, err
-	}
-
-	f, err := os.Open(device) // #nosec G304 -- device path validated by caller
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = f.Close() }()
-
-	encryptedKeyMaterial := make([]byte, size)
-	defer clearBytes(encryptedKeyMaterial)
-	if _, err := f.ReadAt(encryptedKeyMaterial, offset); err != nil {
-		return nil, err
-	}
-
-	// Extract cipher from area encryption (e.g., "aes-xts-plain64" -> "aes")
-	cipherAlgo := strings.Split(keyslot.Area.Encryption, "-")[0]
-
-	// Decrypt key material
-	sectorSize := 512 // Default for key material
-	decryptedKeyMaterial, err := decryptKeyMaterial(encryptedKeyMaterial, passphraseKey, cipherAlgo, sectorSize)
-	if err != nil {
-		return nil, err
-	}
-	defer clearBytes(decryptedKeyMaterial)
-
-	// Merge anti-forensic split
-	// Note: The keyslot area may be larger than the actual AF-split data due to alignment
-	// We only need keySize * stripes bytes for AF-merge
-	afSplitSize := keyslot.KeySize * keyslot.AF.Stripes
-	if len(decryptedKeyMaterial) < afSplitSize {
-		return nil, fmt.Errorf("decrypted data too small: got %d, need %d", len(decryptedKeyMaterial), afSplitSize)
-	}
-	masterKey, err := AFMerge(decryptedKeyMaterial[:afSplitSize], keyslot.AF.Stripes, keyslot.KeySize, keyslot.AF.Hash)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify master key using digest
-	if err := verifyMasterKey(masterKey, digests); err != nil {
-		clearBytes(masterKey)
-		return nil, err
-	}
-
-	return masterKey, nil
-}
-
-// verifyMasterKey verifies the master key against stored digests
-func verifyMasterKey(masterKey []byte, digests map[string]*Digest) error {
-	// Use the first digest for verification
-	for _, digest := range digests {
-		kdf := &KDF{
-			Type:       digest.Type,
-			Hash:       digest.Hash,
-			Salt:       digest.Salt,
-			Iterations: &digest.Iterations,
-		}
-
-		// Derive digest from master key
-		derived, err := DeriveKey(masterKey, kdf, 32) // 32 bytes digest
-		if err != nil {
-			return err
-		}
-		defer clearBytes(derived)
-
-		// Decode expected digest
-		expected, err := decodeBase64(digest.Digest)
-		if err != nil {
-			return err
-		}
-		defer clearBytes(expected)
-
-		// Compare using constant-time comparison to prevent timing attacks
-		if subtle.ConstantTimeCompare(derived, expected) == 1 {
-			clearBytes(derived)
-			clearBytes(expected)
-			return nil // Verification successful
-		}
-	}
-
-	return fmt.Errorf("master key verification failed")
-}
-
 // getBlockDeviceSize gets the size of a block device or file
 func getBlockDeviceSize(device string) (int64, error) {
 	f, err := os.Open(device) // #nosec G304 -- device path validated by caller
@@ -533,9 +585,3 @@ func getBlockDeviceSize(device string) (int64, error) {
 
 	return stat.Size(), nil
 }
-
-// parseIVTweak parses IV tweak value
-func parseIVTweak(s string) uint64 {
-	val, _ := strconv.ParseUint(s, 10, 64)
-	return val
-}
@@ -256,6 +256,46 @@ func TestVerifyMasterKey(t *testing.T) {
 		}
 	})
 
+	t.Run("malformed digest alongside valid digest", func(t *testing.T) {
+		iterations := 1000
+		kdf := &KDF{
+			Type:       "pbkdf2",
+			Hash:       "sha256",
+			Salt:       encodeBase64([]byte("test-salt-16byte")),
+			Iterations: &iterations,
+		}
+
+		validDigest, err := DeriveKey(testMasterKey, kdf, 32)
+		if err != nil {
+			t.Fatalf("Failed to derive test digest: %v", err)
+		}
+
+		// Every digest is evaluated, so the outcome must not depend on
+		// map iteration order
+		digests := map[string]*Digest{
+			"0": {
+				Type:       "pbkdf2",
+				Hash:       "sha256",
+				Salt:       kdf.Salt,
+				Iterations: iterations,
+				Digest:     "!!!invalid-base64!!!",
+			},
+			"1": {
+				Type:       "pbkdf2",
+				Hash:       "sha256",
+				Salt:       kdf.Salt,
+				Iterations: iterations,
+				Digest:     encodeBase64(validDigest),
+			},
+		}
+
+		for i := 0; i < 10; i++ {
+			if err := verifyMasterKey(testMasterKey, digests); err != nil {
+				t.Fatalf("verifyMasterKey failed with a valid digest present: %v", err)
+			}
+		}
+	})
+
 	t.Run("invalid base64 in digest", func(t *testing.T) {
 		iterations := 1000
 
@@ -7,6 +7,7 @@
 package luks2
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -55,36 +56,35 @@ func TestUnlockBasic(t *testing.T) {
 		t.Fatalf("Unlock failed: %v", err)
 	}
 
-	// Verify it's unlocked (wait for device-mapper to create device)
-	unlocked := false
-	for i := 0; i < 50; i++ {
-		if IsUnlocked(volumeName) {
-			unlocked = true
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-	if !unlocked {
+	// Unlock returns once the device node exists, so no waiting is needed
+	mapperPath := "/dev/mapper/" + volumeName
+	if !IsUnlocked(volumeName) {
 		t.Fatal("Volume should be unlocked")
 	}
+	if fi, err := os.Stat(mapperPath); err != nil || fi.Mode()&os.ModeDevice == 0 {
+		t.Fatalf("%s is not a device node after Unlock: %v", mapperPath, err)
+	}
 
 	// Lock it
 	if err := Lock(volumeName); err != nil {
 		t.Fatalf("Lock failed: %v", err)
 	}
 
-	// Verify it's locked (wait for device-mapper to remove device)
-	locked := false
-	for i := 0; i < 50; i++ {
-		if !IsUnlocked(volumeName) {
-			locked = true
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-	if !locked {
+	// Lock returns once the mapping and its node are gone
+	if IsUnlocked(volumeName) {
 		t.Fatal("Volume should be locked")
 	}
+	if _, err := os.Lstat(mapperPath); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after Lock", mapperPath)
+	}
+
+	// Reusing the name right away must not race with the old node's removal
+	if err := Unlock(loopDev, passphrase, volumeName); err != nil {
+		t.Fatalf("Second unlock failed: %v", err)
+	}
+	if err := Lock(volumeName); err != nil {
+		t.Fatalf("Second lock failed: %v", err)
+	}
 }
 
 // TestUnlockWithWrongPassphrase tests unlock failures with incorrect passphrase
@@ -167,3 +167,281 @@ func TestLockErrors(t *testing.T) {
 		t.Fatal("Expected error when locking nonexistent volume")
 	}
 }
+
+// TestUnlockWithVolumeKey tests activating a volume from an escrowed volume key
+func TestUnlockWithVolumeKey(t *testing.T) {
+	tmpfile := "/tmp/test-luks-volume-key.img"
+	defer os.Remove(tmpfile)
+
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(50 * 1024 * 1024); err != nil {
+		f.Close()
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	f.Close()
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{
+		Device:     tmpfile,
+		Passphrase: passphrase,
+		KDFType:    "pbkdf2",
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	volumeKey, err := ExtractVolumeKey(tmpfile, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	defer clearBytes(volumeKey)
+
+	loopDev, err := SetupLoopDevice(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	volumeName := "test-volume-key"
+	_ = Lock(volumeName)
+
+	if err := UnlockWithVolumeKey(loopDev, volumeKey, volumeName); err != nil {
+		t.Fatalf("UnlockWithVolumeKey failed: %v", err)
+	}
+	defer Lock(volumeName)
+
+	if !IsUnlocked(volumeName) {
+		t.Fatal("Volume should be unlocked")
+	}
+}
+
+// TestStatusActiveMapping tests reading the dm-crypt table of an unlocked volume
+func TestStatusActiveMapping(t *testing.T) {
+	tmpfile := "/tmp/test-luks-status.img"
+	defer os.Remove(tmpfile)
+
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(50 * 1024 * 1024); err != nil {
+		f.Close()
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	f.Close()
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{Device: tmpfile, Passphrase: passphrase, KDFType: "pbkdf2"}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	loopDev, err := SetupLoopDevice(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	volumeName := "test-status"
+	_ = Lock(volumeName)
+
+	if err := UnlockWithOptions(loopDev, passphrase, volumeName, &UnlockOptions{AllowDiscards: true}); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	defer Lock(volumeName)
+
+	status, err := Status(volumeName)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	if status.Type != "LUKS2" || status.Cipher != "aes-xts-plain64" || status.KeySize != 512 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if status.Device != loopDev {
+		t.Errorf("Expected device %s, got %s", loopDev, status.Device)
+	}
+	if status.Offset == 0 || status.Size == 0 {
+		t.Errorf("Expected non-zero offset and size: %+v", status)
+	}
+	if len(status.Flags) != 1 || status.Flags[0] != "allow_discards" {
+		t.Errorf("Expected allow_discards flag, got %v", status.Flags)
+	}
+	if status.InUse() {
+		t.Error("Freshly unlocked volume should not be in use")
+	}
+}
+
+// TestResizeAfterGrow tests growing a mapping after its image file was enlarged
+func TestResizeAfterGrow(t *testing.T) {
+	tmpfile := "/tmp/test-luks-resize.img"
+	defer os.Remove(tmpfile)
+
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(50 * 1024 * 1024); err != nil {
+		f.Close()
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	f.Close()
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{Device: tmpfile, Passphrase: passphrase, KDFType: "pbkdf2"}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	loopDev, err := SetupLoopDevice(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	volumeName := "test-resize"
+	_ = Lock(volumeName)
+
+	if err := Unlock(loopDev, passphrase, volumeName); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	defer Lock(volumeName)
+
+	before, err := Status(volumeName)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	if err := os.Truncate(tmpfile, 80*1024*1024); err != nil {
+		t.Fatalf("Failed to grow image: %v", err)
+	}
+	if err := Resize(volumeName, 0); err != nil {
+		t.Fatalf("Resize failed: %v", err)
+	}
+
+	after, err := Status(volumeName)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if after.Size != before.Size+30*1024*2 {
+		t.Errorf("Expected size %d sectors, got %d", before.Size+30*1024*2, after.Size)
+	}
+	if after.Offset != before.Offset || after.KeySize != before.KeySize {
+		t.Errorf("Resize changed the mapping: before %+v, after %+v", before, after)
+	}
+
+	// Shrink back to an explicit size
+	if err := Resize(volumeName, 16*1024*1024); err != nil {
+		t.Fatalf("Resize to explicit size failed: %v", err)
+	}
+	if after, err = Status(volumeName); err != nil || after.Size != 16*1024*2 {
+		t.Errorf("Expected 16 MiB mapping, got %+v (%v)", after, err)
+	}
+}
+
+// TestUnlockAutoDetachLoop tests that Lock takes the loop device down with the mapping
+func TestUnlockAutoDetachLoop(t *testing.T) {
+	tmpfile := "/tmp/test-luks-autodetach.img"
+	defer os.Remove(tmpfile)
+
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(50 * 1024 * 1024); err != nil {
+		f.Close()
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	f.Close()
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{Device: tmpfile, Passphrase: passphrase, KDFType: "pbkdf2"}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	loopDev, err := SetupLoopDevice(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+
+	volumeName := "test-autodetach"
+	_ = Lock(volumeName)
+
+	if err := UnlockWithOptions(loopDev, passphrase, volumeName, &UnlockOptions{AutoDetachLoop: true}); err != nil {
+		_ = DetachLoopDevice(loopDev)
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if found, err := FindLoopDevice(tmpfile); err != nil || found != loopDev {
+		t.Fatalf("Loop device detached while the mapping was active: %s, %v", found, err)
+	}
+
+	if err := Lock(volumeName); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if found, err := FindLoopDevice(tmpfile); err == nil {
+		_ = DetachLoopDevice(found)
+		t.Errorf("Loop device %s still attached after Lock", found)
+	}
+}
+
+// TestLockDeferred tests that a deferred Lock waits for the last user
+func TestLockDeferred(t *testing.T) {
+	tmpfile := "/tmp/test-luks-deferred.img"
+	defer os.Remove(tmpfile)
+
+	if err := os.WriteFile(tmpfile, nil, 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Truncate(tmpfile, 50*1024*1024); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	passphrase := []byte("test-password")
+	if err := Format(FormatOptions{Device: tmpfile, Passphrase: passphrase, KDFType: "pbkdf2"}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	loopDev, err := SetupLoopDevice(tmpfile)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer DetachLoopDevice(loopDev)
+
+	volumeName := "test-deferred"
+	_ = Lock(volumeName)
+	if err := Unlock(loopDev, passphrase, volumeName); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	defer Lock(volumeName)
+
+	devicePath, err := waitForMappedDevice(context.Background(), volumeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := os.Open(devicePath)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", devicePath, err)
+	}
+
+	if err := Lock(volumeName); err == nil {
+		t.Fatal("Lock of a busy mapping should fail")
+	}
+	if err := Lock(volumeName, WithDeferred()); err != nil {
+		t.Fatalf("Deferred Lock failed: %v", err)
+	}
+	status, err := Status(volumeName)
+	if err != nil {
+		t.Fatalf("Mapping removed while in use: %v", err)
+	}
+	if !status.DeferredRemove {
+		t.Error("Status should report the pending removal")
+	}
+
+	_ = holder.Close()
+	for i := 0; i < 50 && IsUnlocked(volumeName); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if IsUnlocked(volumeName) {
+		t.Error("Mapping not removed after its last user closed it")
+	}
+}
@@ -2,11 +2,12 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
-//go:build !integration
+//go:build !integration && linux
 
 package luks2
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -45,6 +46,25 @@ func TestIsUnlocked_NonexistentVolume(t *testing.T) {
 	}
 }
 
+func TestLockOptions(t *testing.T) {
+	var o lockOptions
+	if o.deferred {
+		t.Error("Lock should not defer removal by default")
+	}
+	WithDeferred()(&o)
+	if !o.deferred {
+		t.Error("WithDeferred() should request a deferred removal")
+	}
+}
+
+func TestLock_NonexistentVolume(t *testing.T) {
+	for _, opts := range [][]LockOption{nil, {WithDeferred()}} {
+		if err := Lock("definitely-nonexistent-volume-12345", opts...); err == nil {
+			t.Errorf("Lock(%d options) should fail for a non-existent volume", len(opts))
+		}
+	}
+}
+
 func TestSafeUint64ToInt64(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -126,3 +146,39 @@ func TestSafeInt64ToUint64(t *testing.T) {
 		})
 	}
 }
+
+func TestCryptFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		opts     *UnlockOptions
+		expected []string
+	}{
+		{"no options", &Config{}, nil, nil},
+		{"discards disabled", &Config{}, &UnlockOptions{}, nil},
+		{"discards requested", &Config{}, &UnlockOptions{AllowDiscards: true}, []string{"allow_discards"}},
+		{"persistent flag", &Config{Flags: []string{"allow-discards"}}, nil, []string{"allow_discards"}},
+		{"nil config", nil, &UnlockOptions{AllowDiscards: true}, []string{"allow_discards"}},
+		{
+			"performance flags",
+			&Config{},
+			&UnlockOptions{SameCPUCrypt: true, SubmitFromCryptCPUs: true, NoReadWorkqueue: true, NoWriteWorkqueue: true},
+			[]string{"same_cpu_crypt", "submit_from_crypt_cpus", "no_read_workqueue", "no_write_workqueue"},
+		},
+		{
+			"persistent and requested",
+			&Config{Flags: []string{"no-read-workqueue", "no-write-workqueue"}},
+			&UnlockOptions{AllowDiscards: true, NoReadWorkqueue: true},
+			[]string{"allow_discards", "no_read_workqueue", "no_write_workqueue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cryptFlags(&LUKS2Metadata{Config: tt.config}, tt.opts)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("cryptFlags() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+// Package unlockserver unlocks volumes remotely during early boot, a pure-Go
+// alternative to running dropbear in the initramfs. It serves a single
+// endpoint over TLS: POST /unlock with the passphrase as the request body.
+// The passphrase is tried against every volume that is still locked, and
+// the server stops once all of them are open so that boot can continue.
+//
+// Clients authenticate with a TLS client certificate whose public key is
+// pinned in AuthorizedKeys, the equivalent of SSH authorized_keys. Pins use
+// curl's --pinnedpubkey format, the base64 SHA-256 of the DER-encoded
+// SubjectPublicKeyInfo prefixed with "sha256//", so a client can pin the
+// server key the same way:
+//
+//	curl --cert client.pem --key client.key -k \
+//	     --pinnedpubkey sha256//<server pin> \
+//	     --data-binary @- https://host:4443/unlock
+package unlockserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// pinPrefix starts every public key pin
+const pinPrefix = "sha256//"
+
+// ErrUnauthorized is returned for a client without an authorized key
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Volume is a volume to unlock
+type Volume struct {
+	Device string // Device path
+	Name   string // Device-mapper name
+}
+
+// Backend unlocks the volumes
+type Backend interface {
+	UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error
+	IsUnlocked(name string) bool
+}
+
+// luks2Backend implements Backend with the luks2 package
+type luks2Backend struct{}
+
+func (luks2Backend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	return luks2.UnlockWithOptions(device, passphrase, name, opts)
+}
+
+func (luks2Backend) IsUnlocked(name string) bool { return luks2.IsUnlocked(name) }
+
+// Config configures a Server
+type Config struct {
+	// Addr is the TCP address to listen on (default: ":4443")
+	Addr string
+
+	// Certificate is the server certificate and private key
+	Certificate tls.Certificate
+
+	// AuthorizedKeys are the pins of the client keys allowed to submit
+	// passphrases (see PublicKeyPin)
+	AuthorizedKeys []string
+
+	// Volumes are unlocked with the submitted passphrases
+	Volumes []Volume
+
+	// Unlock selects the keyslot and dm-crypt flags (nil = defaults)
+	Unlock *luks2.UnlockOptions
+
+	// FailureDelay is slept after a passphrase that opens nothing, with
+	// further submissions waiting behind it (default: 2s)
+	FailureDelay time.Duration
+
+	// Backend performs the unlocks (default: the luks2 package)
+	Backend Backend
+
+	// ErrorLog receives connection and unlock errors (default: discard).
+	// Passphrases are never logged.
+	ErrorLog *log.Logger
+}
+
+// Server accepts passphrases until every volume is unlocked
+type Server struct {
+	cfg  Config
+	pins [][sha256.Size]byte
+
+	mu   sync.Mutex // serializes unlock attempts
+	done chan struct{}
+	once sync.Once
+}
+
+// New creates a server, applying defaults to cfg. A certificate, at least
+// one authorized key and at least one volume are required.
+func New(cfg Config) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":4443"
+	}
+	if cfg.FailureDelay == 0 {
+		cfg.FailureDelay = 2 * time.Second
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = luks2Backend{}
+	}
+	if len(cfg.Certificate.Certificate) == 0 {
+		return nil, errors.New("unlock server requires a certificate")
+	}
+	if len(cfg.AuthorizedKeys) == 0 {
+		return nil, errors.New("unlock server requires at least one authorized key")
+	}
+	if len(cfg.Volumes) == 0 {
+		return nil, errors.New("unlock server requires at least one volume")
+	}
+
+	s := &Server{cfg: cfg, done: make(chan struct{})}
+	for _, key := range cfg.AuthorizedKeys {
+		pin, err := decodePin(key)
+		if err != nil {
+			return nil, err
+		}
+		s.pins = append(s.pins, pin)
+	}
+	return s, nil
+}
+
+// Pending returns the volumes that are not unlocked yet
+func (s *Server) Pending() []Volume {
+	var pending []Volume
+	for _, v := range s.cfg.Volumes {
+		if !s.cfg.Backend.IsUnlocked(v.Name) {
+			pending = append(pending, v)
+		}
+	}
+	return pending
+}
+
+// Pin returns the pin of the server key, for clients to verify the server
+func (s *Server) Pin() (string, error) {
+	cert, err := x509.ParseCertificate(s.cfg.Certificate.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	return spkiPin(cert.RawSubjectPublicKeyInfo), nil
+}
+
+// TLSConfig returns the TLS configuration of the server. It requires a
+// client certificate and rejects keys that are not authorized during the
+// handshake.
+func (s *Server) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{s.cfg.Certificate},
+		ClientAuth:   tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			return s.authorize(cert)
+		},
+	}
+}
+
+// ServeHTTP authorizes the client certificate and handles POST /unlock
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return
+	}
+	if err := s.authorize(r.TLS.PeerCertificates[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path != "/unlock" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	passphrase, err := io.ReadAll(io.LimitReader(r.Body, luks2.MaxPassphraseLength+2))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer clear(passphrase)
+	// Drop the newline of "echo" or a terminal without copying the secret
+	trimmed := bytes.TrimSuffix(bytes.TrimSuffix(passphrase, []byte("\n")), []byte("\r"))
+	if err := luks2.ValidatePassphrase(trimmed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, report := s.unlock(trimmed)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = io.WriteString(w, report)
+}
+
+// unlock tries passphrase on every pending volume and reports the outcome
+// one line per volume
+func (s *Server) unlock(passphrase []byte) (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var report strings.Builder
+	opened, failed := 0, 0
+	for _, v := range s.Pending() {
+		err := s.cfg.Backend.UnlockWithOptions(v.Device, passphrase, v.Name, s.cfg.Unlock)
+		switch {
+		case err == nil:
+			opened++
+			fmt.Fprintf(&report, "%s: unlocked\n", v.Name)
+		case errors.Is(err, luks2.ErrInvalidPassphrase):
+			fmt.Fprintf(&report, "%s: passphrase does not match\n", v.Name)
+		default:
+			failed++
+			s.logf("failed to unlock %s (%s): %v", v.Name, v.Device, err)
+			fmt.Fprintf(&report, "%s: %v\n", v.Name, err)
+		}
+	}
+
+	pending := s.Pending()
+	if len(pending) == 0 {
+		report.WriteString("all volumes unlocked\n")
+		s.once.Do(func() { close(s.done) })
+		return http.StatusOK, report.String()
+	}
+	names := make([]string, len(pending))
+	for i, v := range pending {
+		names[i] = v.Name
+	}
+	fmt.Fprintf(&report, "still locked: %s\n", strings.Join(names, ", "))
+
+	switch {
+	case opened > 0:
+		return http.StatusOK, report.String()
+	case failed > 0:
+		return http.StatusInternalServerError, report.String()
+	}
+	time.Sleep(s.cfg.FailureDelay)
+	return http.StatusForbidden, report.String()
+}
+
+// ListenAndServe listens on the configured address and serves until every
+// volume is unlocked or ctx is canceled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves TLS on ln until every volume is unlocked or ctx is canceled.
+// It returns immediately if no volume is pending.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if len(s.Pending()) == 0 {
+		_ = ln.Close()
+		return nil
+	}
+
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		ErrorLog:          s.cfg.ErrorLog,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	if srv.ErrorLog == nil {
+		srv.ErrorLog = log.New(io.Discard, "", 0)
+	}
+
+	go func() {
+		// Volumes may also be unlocked elsewhere, e.g. on the console
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				break wait
+			case <-s.done:
+				break wait
+			case <-ticker.C:
+				if len(s.Pending()) == 0 {
+					break wait
+				}
+			}
+		}
+		// Let the request that unlocked the last volume receive its answer
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	err := srv.Serve(tls.NewListener(ln, s.TLSConfig()))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// authorize checks the public key of cert against the pins in constant time
+func (s *Server) authorize(cert *x509.Certificate) error {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	match := 0
+	for _, pin := range s.pins {
+		match |= subtle.ConstantTimeCompare(sum[:], pin[:])
+	}
+	if match != 1 {
+		return fmt.Errorf("%w: client key %s is not authorized", ErrUnauthorized, spkiPin(cert.RawSubjectPublicKeyInfo))
+	}
+	return nil
+}
+
+// logf writes to the configured error log, if any
+func (s *Server) logf(format string, args ...any) {
+	if s.cfg.ErrorLog != nil {
+		s.cfg.ErrorLog.Printf(format, args...)
+	}
+}
+
+// PublicKeyPin returns the pin of a public key: "sha256//" followed by the
+// base64 SHA-256 of its DER SubjectPublicKeyInfo
+func PublicKeyPin(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return spkiPin(der), nil
+}
+
+// spkiPin returns the pin of a DER SubjectPublicKeyInfo
+func spkiPin(spki []byte) string {
+	sum := sha256.Sum256(spki)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// decodePin parses a pin produced by PublicKeyPin
+func decodePin(pin string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	encoded, ok := strings.CutPrefix(pin, pinPrefix)
+	if !ok {
+		return sum, fmt.Errorf("invalid key pin %q: must start with %s", pin, pinPrefix)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != sha256.Size {
+		return sum, fmt.Errorf("invalid key pin %q: not a base64 SHA-256 digest", pin)
+	}
+	copy(sum[:], raw)
+	return sum, nil
+}
+
+// LoadAuthorizedKeys reads the pins of the keys allowed to connect. The file
+// holds either one pin per line (blank lines and # comments are skipped) or
+// PEM certificates and public keys, whose pins are computed.
+func LoadAuthorizedKeys(path string) ([]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path supplied by caller
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		return pemPins(data)
+	}
+
+	var pins []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := decodePin(line); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pins = append(pins, line)
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("%s: no authorized keys", path)
+	}
+	return pins, nil
+}
+
+// pemPins computes the pins of the certificates and public keys in data
+func pemPins(data []byte) ([]string, error) {
+	var pins []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var spki []byte
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			spki = cert.RawSubjectPublicKeyInfo
+		case "PUBLIC KEY":
+			if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+			spki = block.Bytes
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q in authorized keys", block.Type)
+		}
+		pins = append(pins, spkiPin(spki))
+	}
+	if len(pins) == 0 {
+		return nil, errors.New("no authorized keys")
+	}
+	return pins, nil
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package unlockserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// fakeBackend opens a volume when given the passphrase set for it
+type fakeBackend struct {
+	mu          sync.Mutex
+	passphrases map[string]string
+	unlocked    map[string]bool
+}
+
+func newFakeBackend(passphrases map[string]string) *fakeBackend {
+	return &fakeBackend{passphrases: passphrases, unlocked: make(map[string]bool)}
+}
+
+func (b *fakeBackend) UnlockWithOptions(device string, passphrase []byte, name string, opts *luks2.UnlockOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.passphrases[name] != string(passphrase) {
+		return fmt.Errorf("%w", luks2.ErrInvalidPassphrase)
+	}
+	b.unlocked[name] = true
+	return nil
+}
+
+func (b *fakeBackend) IsUnlocked(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.unlocked[name]
+}
+
+// testCertificate creates a self-signed certificate
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "unlock"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func pinOf(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	pin, err := PublicKeyPin(cert.Leaf.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pin
+}
+
+// startServer serves s on a local port and returns its address and the
+// result of Serve
+func startServer(t *testing.T, s *Server) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() { errc <- s.Serve(ctx, ln) }()
+	return ln.Addr().String(), errc
+}
+
+// submit posts passphrase with the client certificate, if any, verifying
+// the server by its pin
+func submit(addr, serverPin string, client *tls.Certificate, passphrase string) (int, string, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true, // #nosec G402 -- server verified by pin below
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			if spkiPin(cert.RawSubjectPublicKeyInfo) != serverPin {
+				return fmt.Errorf("server pin mismatch")
+			}
+			return nil
+		},
+	}
+	if client != nil {
+		tlsConfig.Certificates = []tls.Certificate{*client}
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := httpClient.Post("https://"+addr+"/unlock", "text/plain", strings.NewReader(passphrase))
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func TestServerUnlocksAllVolumes(t *testing.T) {
+	serverCert := testCertificate(t)
+	clientCert := testCertificate(t)
+	backend := newFakeBackend(map[string]string{"root": "root-passphrase", "data": "data-passphrase"})
+
+	s, err := New(Config{
+		Certificate:    serverCert,
+		AuthorizedKeys: []string{pinOf(t, clientCert)},
+		Volumes:        []Volume{{Device: "/dev/sda2", Name: "root"}, {Device: "/dev/sdb", Name: "data"}},
+		FailureDelay:   time.Millisecond,
+		Backend:        backend,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverPin, err := s.Pin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverPin != pinOf(t, serverCert) {
+		t.Errorf("Pin() = %s, want %s", serverPin, pinOf(t, serverCert))
+	}
+	addr, errc := startServer(t, s)
+
+	code, body, err := submit(addr, serverPin, &clientCert, "wrong-passphrase\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusForbidden || !strings.Contains(body, "still locked: root, data") {
+		t.Errorf("wrong passphrase: %d %q", code, body)
+	}
+
+	code, body, err = submit(addr, serverPin, &clientCert, "root-passphrase\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || !strings.Contains(body, "root: unlocked") || !strings.Contains(body, "still locked: data") {
+		t.Errorf("root passphrase: %d %q", code, body)
+	}
+
+	code, body, err = submit(addr, serverPin, &clientCert, "data-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || !strings.Contains(body, "all volumes unlocked") {
+		t.Errorf("data passphrase: %d %q", code, body)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve() did not return after all volumes were unlocked")
+	}
+}
+
+func TestServerRejectsUnauthorizedClients(t *testing.T) {
+	serverCert := testCertificate(t)
+	authorized := testCertificate(t)
+	stranger := testCertificate(t)
+	backend := newFakeBackend(map[string]string{"root": "root-passphrase"})
+
+	s, err := New(Config{
+		Certificate:    serverCert,
+		AuthorizedKeys: []string{pinOf(t, authorized)},
+		Volumes:        []Volume{{Device: "/dev/sda2", Name: "root"}},
+		Backend:        backend,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := startServer(t, s)
+	serverPin := pinOf(t, serverCert)
+
+	if _, _, err := submit(addr, serverPin, &stranger, "root-passphrase"); err == nil {
+		t.Error("unauthorized client key accepted")
+	}
+	if _, _, err := submit(addr, serverPin, nil, "root-passphrase"); err == nil {
+		t.Error("client without certificate accepted")
+	}
+	if _, _, err := submit(addr, pinOf(t, stranger), &authorized, "root-passphrase"); err == nil {
+		t.Error("server with wrong pin accepted by client")
+	}
+	if backend.IsUnlocked("root") {
+		t.Error("volume unlocked by unauthorized request")
+	}
+}
+
+func TestServeReturnsWhenNothingPending(t *testing.T) {
+	backend := newFakeBackend(nil)
+	backend.unlocked["root"] = true
+	clientCert := testCertificate(t)
+
+	s, err := New(Config{
+		Certificate:    testCertificate(t),
+		AuthorizedKeys: []string{pinOf(t, clientCert)},
+		Volumes:        []Volume{{Device: "/dev/sda2", Name: "root"}},
+		Backend:        backend,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errc := startServer(t, s)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	cert := testCertificate(t)
+	pin := pinOf(t, cert)
+	volumes := []Volume{{Device: "/dev/sda2", Name: "root"}}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no certificate", Config{AuthorizedKeys: []string{pin}, Volumes: volumes}},
+		{"no authorized keys", Config{Certificate: cert, Volumes: volumes}},
+		{"no volumes", Config{Certificate: cert, AuthorizedKeys: []string{pin}}},
+		{"bad pin prefix", Config{Certificate: cert, AuthorizedKeys: []string{"sha1//AAAA"}, Volumes: volumes}},
+		{"bad pin digest", Config{Certificate: cert, AuthorizedKeys: []string{"sha256//AAAA"}, Volumes: volumes}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("New() succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	cert := testCertificate(t)
+	pin := pinOf(t, cert)
+	dir := t.TempDir()
+
+	pinFile := filepath.Join(dir, "pins")
+	if err := os.WriteFile(pinFile, []byte("# laptop\n"+pin+"\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := LoadAuthorizedKeys(pinFile)
+	if err != nil || len(pins) != 1 || pins[0] != pin {
+		t.Errorf("LoadAuthorizedKeys(pins) = %v, %v", pins, err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(cert.Leaf.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemFile := filepath.Join(dir, "keys.pem")
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	if err := os.WriteFile(pemFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pins, err = LoadAuthorizedKeys(pemFile)
+	if err != nil || len(pins) != 2 || pins[0] != pin || pins[1] != pin {
+		t.Errorf("LoadAuthorizedKeys(pem) = %v, %v", pins, err)
+	}
+
+	badFile := filepath.Join(dir, "bad")
+	if err := os.WriteFile(badFile, []byte("not-a-pin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAuthorizedKeys(badFile); err == nil {
+		t.Error("LoadAuthorizedKeys accepted an invalid pin")
+	}
+}
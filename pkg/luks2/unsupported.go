@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package luks2
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Device-mapper, loop devices, mounts and sysfs only exist on Linux. On
+// other platforms the header, keyslot and token APIs work on image files,
+// Volume reads the decrypted contents in userspace, and the functions below
+// stand in for their Linux counterparts so the package still builds.
+
+// Unlock is not supported: there is no device-mapper. Use OpenVolume to
+// read the decrypted contents instead.
+func Unlock(device string, passphrase []byte, name string) error {
+	return fmt.Errorf("unlock %s: %w", device, ErrNotSupported)
+}
+
+// UnlockSlot is not supported: there is no device-mapper
+func UnlockSlot(device string, passphrase []byte, slot int, name string) error {
+	return fmt.Errorf("unlock %s: %w", device, ErrNotSupported)
+}
+
+// IsUnlocked always reports false: there are no device-mapper mappings
+func IsUnlocked(name string) bool {
+	return false
+}
+
+// ActiveMappings is not supported: there are no device-mapper mappings
+func ActiveMappings() ([]string, error) {
+	return nil, fmt.Errorf("active mappings: %w", ErrNotSupported)
+}
+
+// CreateEphemeral is not supported: there is no device-mapper
+func CreateEphemeral(name, device, cipher string) error {
+	return fmt.Errorf("ephemeral %s: %w", device, ErrNotSupported)
+}
+
+// CreateEphemeralWithOptions is not supported: there is no device-mapper
+func CreateEphemeralWithOptions(name, device string, opts *EphemeralOptions) error {
+	return fmt.Errorf("ephemeral %s: %w", device, ErrNotSupported)
+}
+
+// activateVolume fails: there is no device-mapper
+func activateVolume(device, realDevice string, hdr *LUKS2BinaryHeader, metadata *LUKS2Metadata, masterKey []byte, name string, flags []string) error {
+	return fmt.Errorf("unlock %s: %w", device, ErrNotSupported)
+}
+
+// autoDetachLoop has nothing to do: no mapping was activated
+func autoDetachLoop(realDevice, name string, opts *UnlockOptions) error {
+	return nil
+}
+
+// formatRegion is not supported: ranges are formatted through a loop device
+func formatRegion(opts FormatOptions) error {
+	return fmt.Errorf("format %s at offset %d: %w", opts.Device, opts.Offset, ErrNotSupported)
+}
+
+// unlockRegion is not supported: there are no loop devices
+func unlockRegion(device string, opts *UnlockOptions, unlock func(loop string, opts *UnlockOptions) error) error {
+	return fmt.Errorf("unlock %s at offset %d: %w", device, opts.Offset, ErrNotSupported)
+}
+
+// cryptFlags returns no dm-crypt flags
+func cryptFlags(metadata *LUKS2Metadata, opts *UnlockOptions) []string {
+	return nil
+}
+
+// probeFilesystem is not available: filesystem detection is Linux-only
+func probeFilesystem(buf []byte) (string, bool) {
+	return "", false
+}
+
+// filesystemSignature finds nothing: filesystem detection is Linux-only
+func filesystemSignature(buf []byte) (Signature, bool) {
+	return Signature{}, false
+}
+
+// DescribeDevice describes image files only; there is no sysfs to classify
+// block devices or statfs magic to spot network filesystems
+func DescribeDevice(device string) (*DeviceDescription, error) {
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", device, err)
+	}
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", device, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("describe %s: %w", device, ErrNotSupported)
+	}
+
+	return &DeviceDescription{
+		Path:              device,
+		ResolvedPath:      resolved,
+		Size:              fi.Size(),
+		AllocatedSize:     fi.Size(),
+		Transport:         TransportFile,
+		LogicalBlockSize:  LUKS2SectorSize,
+		PhysicalBlockSize: LUKS2SectorSize,
+	}, nil
+}
+
+// getBlockDeviceSize gets the size of an image file
+func getBlockDeviceSize(device string) (int64, error) {
+	fi, err := os.Stat(device)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get device/file size: %w", err)
+	}
+	return fi.Size(), nil
+}
+
+// extUsedRanges is not available: the ext allocation walker shares the
+// Linux-only filesystem detection
+func extUsedRanges(r io.ReaderAt, size int64) ([]byteRange, error) {
+	return nil, fmt.Errorf("export used blocks: %w", ErrNotSupported)
+}
+
+// ExportUsed is not supported: there is no device-mapper
+func ExportUsed(name string, w io.WriteSeeker, opts *ExportOptions) (*ExportResult, error) {
+	return nil, fmt.Errorf("export %s: %w", name, ErrNotSupported)
+}
+
+// ProbeKernelCiphers is not supported: dm-crypt is a Linux kernel target
+func ProbeKernelCiphers(opts *CipherProbeOptions) ([]KernelCipher, error) {
+	return nil, fmt.Errorf("probe kernel ciphers: %w", ErrNotSupported)
+}
+
+// checkKernelCiphers has nothing to check: activateVolume fails anyway
+func checkKernelCiphers(metadata *LUKS2Metadata) error {
+	return nil
+}
+
+// newAFALGXTS is not supported: AF_ALG is a Linux socket family
+func newAFALGXTS(key []byte) (sectorCipher, error) {
+	return nil, fmt.Errorf("AF_ALG: %w", ErrNotSupported)
+}
+
+// afalgPBKDF2 is not supported: AF_ALG is a Linux socket family
+func afalgPBKDF2(password, salt []byte, iterations, keySize int, hashAlgo string, hashSize int) ([]byte, error) {
+	return nil, fmt.Errorf("AF_ALG: %w", ErrNotSupported)
+}
+
+// FstabEntryFor is not supported: there is no device-mapper
+func FstabEntryFor(name string, opts *FstabOptions) (*FstabEntry, error) {
+	return nil, fmt.Errorf("fstab entry for %s: %w", name, ErrNotSupported)
+}
+
+// CheckTabs reports nothing: crypttab and fstab are read by Linux systems
+// only, whose device names it could not resolve here
+func CheckTabs(crypttab []CrypttabEntry, fstab []FstabEntry) *TabReport {
+	return &TabReport{Crypttab: len(crypttab), Fstab: len(fstab), Findings: []AuditFinding{}}
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package luks2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring ABI (include/uapi/linux/io_uring.h)
+const (
+	uringOffSQRing      = 0
+	uringOffCQRing      = 0x8000000
+	uringOffSQEs        = 0x10000000
+	uringOpWrite        = 23 // IORING_OP_WRITE, Linux 5.6
+	uringEnterGetEvents = 1
+	uringSQESize        = 64
+	uringCQESize        = 16
+)
+
+// uringParams is struct io_uring_params
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uringSQOffsets is struct io_sqring_offsets
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uringCQOffsets is struct io_cqring_offsets
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// uring is an io_uring instance for queued writes. It is not safe for
+// concurrent use.
+type uring struct {
+	fd           int
+	sq, cq, sqes []byte // Shared with the kernel
+	sqTail       *uint32
+	sqArray      []uint32
+	sqMask       uint32
+	cqHead       *uint32
+	cqTail       *uint32
+	cqMask       uint32
+	cqes         []byte
+	toSubmit     int
+}
+
+// newURing sets up a ring with room for entries submissions
+func newURing(entries int) (*uring, error) {
+	var p uringParams
+	// #nosec G103 -- unsafe.Pointer required for io_uring_setup
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r := &uring{fd: int(fd)} // #nosec G115 -- file descriptor
+
+	mmap := func(offset int64, size uint32) ([]byte, error) {
+		return unix.Mmap(r.fd, offset, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+	var err error
+	if r.sq, err = mmap(uringOffSQRing, p.sqOff.array+p.sqEntries*4); err == nil {
+		if r.cq, err = mmap(uringOffCQRing, p.cqOff.cqes+p.cqEntries*uringCQESize); err == nil {
+			r.sqes, err = mmap(uringOffSQEs, p.sqEntries*uringSQESize)
+		}
+	}
+	if err != nil {
+		_ = r.close()
+		return nil, fmt.Errorf("failed to map io_uring: %w", err)
+	}
+
+	// #nosec G103 -- the rings are shared memory laid out by the kernel
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sq[p.sqOff.tail]))
+	r.sqMask = binary.NativeEndian.Uint32(r.sq[p.sqOff.ringMask:])
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sq[p.sqOff.array])), p.sqEntries) // #nosec G103
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cq[p.cqOff.head]))                              // #nosec G103
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cq[p.cqOff.tail]))                              // #nosec G103
+	r.cqMask = binary.NativeEndian.Uint32(r.cq[p.cqOff.ringMask:])
+	r.cqes = r.cq[p.cqOff.cqes:]
+	return r, nil
+}
+
+// queueWrite fills the next submission entry with a write of buf at off.
+// The caller keeps buf alive and fewer writes in flight than the ring has
+// entries.
+func (r *uring) queueWrite(fd int, buf []byte, off int64, tag uint64) {
+	tail := atomic.LoadUint32(r.sqTail)
+	index := tail & r.sqMask
+	sqe := r.sqes[index*uringSQESize : (index+1)*uringSQESize]
+	clear(sqe)
+	sqe[0] = uringOpWrite
+	binary.NativeEndian.PutUint32(sqe[4:], uint32(fd))                                // #nosec G115 -- file descriptor
+	binary.NativeEndian.PutUint64(sqe[8:], uint64(off))                               // #nosec G115 -- offsets are non-negative
+	binary.NativeEndian.PutUint64(sqe[16:], uint64(uintptr(unsafe.Pointer(&buf[0])))) // #nosec G103 -- address for the kernel
+	binary.NativeEndian.PutUint32(sqe[24:], uint32(len(buf)))                         // #nosec G115 -- buffers are at most MaxWipeBufferSize
+	binary.NativeEndian.PutUint64(sqe[32:], tag)
+	r.sqArray[index] = index
+	atomic.StoreUint32(r.sqTail, tail+1)
+	r.toSubmit++
+}
+
+// enter submits the queued entries and waits for minComplete completions
+func (r *uring) enter(minComplete int) error {
+	flags := 0
+	if minComplete > 0 {
+		flags = uringEnterGetEvents
+	}
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(r.toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return fmt.Errorf("io_uring_enter: %w", errno)
+		}
+		r.toSubmit -= int(n)
+		return nil
+	}
+}
+
+// reap hands every available completion to fn
+func (r *uring) reap(fn func(tag uint64, res int32)) {
+	head := atomic.LoadUint32(r.cqHead)
+	for tail := atomic.LoadUint32(r.cqTail); head != tail; head++ {
+		cqe := r.cqes[(head&r.cqMask)*uringCQESize:]
+		fn(binary.NativeEndian.Uint64(cqe), int32(binary.NativeEndian.Uint32(cqe[8:]))) // #nosec G115 -- res is signed
+		// Free the slot before fn queues more
+		atomic.StoreUint32(r.cqHead, head+1)
+	}
+}
+
+func (r *uring) close() error {
+	for _, m := range [][]byte{r.sqes, r.cq, r.sq} {
+		if m != nil {
+			_ = unix.Munmap(m)
+		}
+	}
+	return unix.Close(r.fd)
+}
+
+var (
+	uringProbeOnce sync.Once
+	uringProbeErr  error
+)
+
+// uringAvailable reports why io_uring cannot be used, or nil. The answer
+// is probed once per process.
+func uringAvailable() error {
+	uringProbeOnce.Do(func() {
+		r, err := newURing(1)
+		if err != nil {
+			uringProbeErr = err
+			return
+		}
+		uringProbeErr = r.close()
+	})
+	return uringProbeErr
+}
+
+// uringWrite is a write in flight
+type uringWrite struct {
+	buf  []byte // Whole buffer, handed to release when done
+	rest []byte // Part not written yet
+	off  int64
+}
+
+// uringWriter writes buffers to a file through a ring, keeping up to depth
+// writes in flight and requeueing short writes. Each buffer goes to release
+// once written or failed. It is not safe for concurrent use.
+type uringWriter struct {
+	ring    *uring
+	fd      int
+	depth   int
+	pending map[uint64]*uringWrite
+	nextTag uint64
+	release func(buf []byte)
+	err     error // First failure; nothing is queued after it
+	broken  bool  // The ring itself failed; pending buffers may still be in use
+}
+
+// newURingWriter returns a writer to f with depth writes in flight
+func newURingWriter(f *os.File, depth int, release func([]byte)) (*uringWriter, error) {
+	ring, err := newURing(depth)
+	if err != nil {
+		return nil, err
+	}
+	return &uringWriter{
+		ring:    ring,
+		fd:      int(f.Fd()), // #nosec G115 -- fd fits in int
+		depth:   depth,
+		pending: make(map[uint64]*uringWrite, depth),
+		release: release,
+	}, nil
+}
+
+// write queues buf at off, first waiting for a write to finish when depth
+// are in flight. An error is that of an earlier write; buf is released.
+func (w *uringWriter) write(buf []byte, off int64) error {
+	for w.err == nil && len(w.pending) >= w.depth {
+		w.wait(1)
+	}
+	if w.err != nil {
+		w.release(buf)
+		return w.err
+	}
+	if len(buf) == 0 {
+		w.release(buf)
+		return nil
+	}
+
+	tag := w.nextTag
+	w.nextTag++
+	op := &uringWrite{buf: buf, rest: buf, off: off}
+	w.pending[tag] = op
+	w.ring.queueWrite(w.fd, op.rest, op.off, tag)
+	w.wait(0)
+	return w.err
+}
+
+// waitOne waits for at least one write in flight to finish and returns the
+// first failure
+func (w *uringWriter) waitOne() error {
+	if len(w.pending) > 0 && !w.broken {
+		w.wait(1)
+	}
+	return w.err
+}
+
+// flush waits for every write in flight and returns the first failure
+func (w *uringWriter) flush() error {
+	for len(w.pending) > 0 && !w.broken {
+		w.wait(1)
+	}
+	return w.err
+}
+
+// close flushes and releases the ring
+func (w *uringWriter) close() error {
+	err := w.flush()
+	if cerr := w.ring.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// wait submits what is queued, waits for minComplete completions and
+// handles those that arrived
+func (w *uringWriter) wait(minComplete int) {
+	if err := w.ring.enter(minComplete); err != nil {
+		// The kernel may still be reading the pending buffers, so they
+		// are neither released nor waited for
+		w.broken = true
+		w.fail(err)
+		return
+	}
+	w.ring.reap(w.complete)
+}
+
+func (w *uringWriter) complete(tag uint64, res int32) {
+	op := w.pending[tag]
+	switch {
+	case res == -int32(unix.EINTR) || res == -int32(unix.EAGAIN):
+		// Try again as is
+	case res < 0:
+		w.fail(fmt.Errorf("write error at offset %d: %w", op.off, unix.Errno(-res)))
+	case res == 0:
+		w.fail(fmt.Errorf("write error at offset %d: %w", op.off, io.ErrShortWrite))
+	default:
+		op.rest = op.rest[res:]
+		op.off += int64(res)
+	}
+
+	if len(op.rest) == 0 || w.err != nil {
+		delete(w.pending, tag)
+		w.release(op.buf)
+		return
+	}
+	w.ring.queueWrite(w.fd, op.rest, op.off, tag)
+}
+
+func (w *uringWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
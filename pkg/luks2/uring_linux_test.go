@@ -0,0 +1,127 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration && linux
+
+package luks2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// requireURing skips the test where io_uring is unavailable
+func requireURing(t *testing.T) {
+	t.Helper()
+	if err := uringAvailable(); err != nil {
+		t.Skipf("io_uring not available: %v", err)
+	}
+}
+
+func TestURingWriter(t *testing.T) {
+	requireURing(t)
+
+	path := filepath.Join(t.TempDir(), "out")
+	f, err := os.Create(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var released int
+	w, err := newURingWriter(f, 3, func(buf []byte) { released++ })
+	if err != nil {
+		t.Fatalf("newURingWriter failed: %v", err)
+	}
+
+	// More writes than the ring has entries, out of order
+	const blocks = 20
+	want := make([]byte, blocks*4096)
+	for _, i := range []int{5, 0, 19, 7, 1, 2, 3, 4, 6, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18} {
+		buf := bytes.Repeat([]byte{byte(i + 1)}, 4096)
+		copy(want[i*4096:], buf)
+		if err := w.write(buf, int64(i*4096)); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+		if len(w.pending) > 3 {
+			t.Fatalf("%d writes in flight with depth 3", len(w.pending))
+		}
+	}
+	if err := w.write(nil, 0); err != nil {
+		t.Errorf("empty write failed: %v", err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if released != blocks+1 {
+		t.Errorf("released %d buffers, want %d", released, blocks+1)
+	}
+
+	got, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("file contents differ from the data written")
+	}
+}
+
+func TestURingWriter_Error(t *testing.T) {
+	requireURing(t)
+
+	path := filepath.Join(t.TempDir(), "out")
+	if err := os.WriteFile(path, make([]byte, 4096), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var released int
+	w, err := newURingWriter(f, 2, func(buf []byte) { released++ })
+	if err != nil {
+		t.Fatalf("newURingWriter failed: %v", err)
+	}
+	for i := range 4 {
+		if err := w.write(make([]byte, 512), int64(i*512)); err != nil {
+			break
+		}
+	}
+	if err := w.close(); !errors.Is(err, unix.EBADF) {
+		t.Errorf("close = %v, want EBADF for a read-only file", err)
+	}
+	if released == 0 || len(w.pending) != 0 {
+		t.Errorf("released %d buffers with %d pending", released, len(w.pending))
+	}
+}
+
+func TestIOEngine(t *testing.T) {
+	if IOEngineDefault.String() != "default" || IOEngineSync.String() != "sync" || IOEngineURing.String() != "io_uring" || IOEngine(9).String() != "IOEngine(9)" {
+		t.Error("unexpected IOEngine names")
+	}
+
+	if depth, err := queueDepth(IOEngineSync, 8, "test", ""); err != nil || depth != 0 {
+		t.Errorf("sync engine: depth %d, %v", depth, err)
+	}
+	for _, depth := range []int{-1, maxQueueDepth + 1} {
+		if _, err := queueDepth(IOEngineURing, depth, "test", ""); err == nil {
+			t.Errorf("queue depth %d accepted", depth)
+		}
+	}
+	if _, err := queueDepth(IOEngine(9), 0, "test", ""); err == nil {
+		t.Error("unknown engine accepted")
+	}
+
+	requireURing(t)
+	if depth, err := queueDepth(IOEngineURing, 0, "test", ""); err != nil || depth != DefaultQueueDepth {
+		t.Errorf("io_uring engine: depth %d, %v; want %d", depth, err, DefaultQueueDepth)
+	}
+}
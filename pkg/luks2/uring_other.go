@@ -0,0 +1,40 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package luks2
+
+import (
+	"fmt"
+	"os"
+)
+
+// uringAvailable reports that io_uring is a Linux interface
+func uringAvailable() error {
+	return fmt.Errorf("io_uring: %w", ErrNotSupported)
+}
+
+// uringWriter is never created: there is no io_uring here
+type uringWriter struct{}
+
+func newURingWriter(f *os.File, depth int, release func([]byte)) (*uringWriter, error) {
+	return nil, uringAvailable()
+}
+
+func (w *uringWriter) write(buf []byte, off int64) error {
+	return uringAvailable()
+}
+
+func (w *uringWriter) waitOne() error {
+	return uringAvailable()
+}
+
+func (w *uringWriter) flush() error {
+	return uringAvailable()
+}
+
+func (w *uringWriter) close() error {
+	return uringAvailable()
+}
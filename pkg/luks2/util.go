@@ -73,3 +73,22 @@ func alignTo(value, alignment int64) int64 {
 func isPowerOf2(n int) bool {
 	return n > 0 && (n&(n-1)) == 0
 }
+
+// TrimRight is a helper function to replace bytes.TrimRight
+func TrimRight(b []byte, cutset string) []byte {
+	i := len(b)
+	for i > 0 {
+		found := false
+		for _, c := range cutset {
+			if b[i-1] == byte(c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		i--
+	}
+	return b[:i]
+}
@@ -193,7 +193,8 @@ func TestGetHashFunc(t *testing.T) {
 	}{
 		{"sha256", false},
 		{"sha512", false},
-		{"sha1", true},
+		{"sha1", false},
+		{"sha384", false},
 		{"invalid", true},
 		{"md5", true},
 	}
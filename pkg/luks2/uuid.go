@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// parseVolumeUUID parses a header UUID. Any form uuid.Parse accepts is
+// allowed; the header always stores the canonical lower-case form.
+func parseVolumeUUID(s string) (uuid.UUID, error) {
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w %q: %v", ErrInvalidUUID, s, err)
+	}
+	return u, nil
+}
+
+// GetUUID returns the header UUID of a LUKS2 volume, equivalent to
+// cryptsetup luksUUID
+func GetUUID(device string) (string, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return "", err
+	}
+
+	hdr, _, err := readHeader(device)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %w", err)
+	}
+	return headerUUID(hdr), nil
+}
+
+// MatchUUID reports whether the header UUID of a LUKS2 volume is id,
+// equivalent to cryptsetup isLuks --uuid. UUIDs are compared by value, so
+// case and formatting do not matter.
+func MatchUUID(device, id string) (bool, error) {
+	want, err := parseVolumeUUID(id)
+	if err != nil {
+		return false, err
+	}
+	current, err := GetUUID(device)
+	if err != nil {
+		return false, err
+	}
+	got, err := uuid.Parse(current)
+	if err != nil {
+		return false, nil
+	}
+	return got == want, nil
+}
+
+// SetUUID replaces the header UUID of a LUKS2 volume, equivalent to
+// cryptsetup luksUUID --uuid. Both header copies are rewritten under the
+// device lock. Udev links, crypttab and fstab entries that name the old
+// UUID must be updated by the caller.
+//
+// Escrowed secrets are bound to the UUID they were wrapped for, so SetUUID
+// refuses while escrow tokens exist: remove them, change the UUID and
+// escrow again.
+func SetUUID(device, id string) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+	u, err := parseVolumeUUID(id)
+	if err != nil {
+		return err
+	}
+
+	// Acquire exclusive lock
+	lock, err := AcquireFileLock(device)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	for _, tokenID := range sortedIDs(metadata.Tokens) {
+		if token := metadata.Tokens[tokenID]; token != nil && token.Type == TokenTypeEscrow {
+			return fmt.Errorf("token %s holds a secret escrowed for UUID %s; remove it before changing the UUID", tokenID, headerUUID(hdr))
+		}
+	}
+
+	hdr.UUID = [40]byte{}
+	copy(hdr.UUID[:], u.String())
+	hdr.SequenceID++
+
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return nil
+}
+
+// RegenerateUUID gives a LUKS2 volume a new random header UUID and returns
+// it. See SetUUID.
+func RegenerateUUID(device string) (string, error) {
+	id := uuid.New().String()
+	if err := SetUUID(device, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
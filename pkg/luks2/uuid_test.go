@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestSetUUID tests replacing, matching and regenerating the header UUID
+func TestSetUUID(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	original, err := GetUUID(device)
+	if err != nil {
+		t.Fatalf("GetUUID failed: %v", err)
+	}
+	if _, err := uuid.Parse(original); err != nil {
+		t.Fatalf("fresh volume has UUID %q: %v", original, err)
+	}
+
+	// Upper case and braces are accepted; the canonical form is stored
+	if err := SetUUID(device, "{2B1BD3C0-4C5E-4C5C-9A34-0E41B0A6D3A1}"); err != nil {
+		t.Fatalf("SetUUID failed: %v", err)
+	}
+	got, err := GetUUID(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1" {
+		t.Errorf("UUID = %q after SetUUID", got)
+	}
+
+	for id, want := range map[string]bool{
+		"2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1": true,
+		"2B1BD3C04C5E4C5C9A340E41B0A6D3A1":     true,
+		original:                               false,
+	} {
+		match, err := MatchUUID(device, id)
+		if err != nil {
+			t.Fatalf("MatchUUID(%q) failed: %v", id, err)
+		}
+		if match != want {
+			t.Errorf("MatchUUID(%q) = %v, want %v", id, match, want)
+		}
+	}
+
+	// Both header copies carry the update
+	status, err := CheckHeaders(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NeedsRepair() {
+		t.Errorf("headers out of sync after SetUUID: %+v", status)
+	}
+
+	regenerated, err := RegenerateUUID(device)
+	if err != nil {
+		t.Fatalf("RegenerateUUID failed: %v", err)
+	}
+	if got, _ := GetUUID(device); got != regenerated || regenerated == "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1" {
+		t.Errorf("RegenerateUUID returned %q, header has %q", regenerated, got)
+	}
+
+	// The volume still unlocks
+	if _, err := ExtractVolumeKey(device, []byte("test-password")); err != nil {
+		t.Errorf("ExtractVolumeKey failed after UUID change: %v", err)
+	}
+}
+
+// TestSetUUID_Invalid tests that malformed UUIDs are rejected
+func TestSetUUID_Invalid(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	before, _ := GetUUID(device)
+
+	for _, id := range []string{"", "not-a-uuid", "2b1bd3c0-4c5e-4c5c-9a34"} {
+		if err := SetUUID(device, id); !errors.Is(err, ErrInvalidUUID) {
+			t.Errorf("SetUUID(%q): expected ErrInvalidUUID, got %v", id, err)
+		}
+		if _, err := MatchUUID(device, id); !errors.Is(err, ErrInvalidUUID) {
+			t.Errorf("MatchUUID(%q): expected ErrInvalidUUID, got %v", id, err)
+		}
+	}
+	if after, _ := GetUUID(device); after != before {
+		t.Errorf("UUID changed from %q to %q", before, after)
+	}
+}
+
+// TestSetUUID_Escrow tests that the UUID of a volume with escrowed secrets
+// is left alone
+func TestSetUUID_Escrow(t *testing.T) {
+	device := escrowTestImage(t)
+	if err := Format(FormatOptions{Device: device, Passphrase: []byte("test-password"), KDFType: "pbkdf2", PBKDFIterTime: 10, Escrow: &xorEscrow{}}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	before, _ := GetUUID(device)
+
+	if err := SetUUID(device, uuid.New().String()); err == nil || !strings.Contains(err.Error(), "escrowed") {
+		t.Errorf("expected escrow error, got %v", err)
+	}
+	if after, _ := GetUUID(device); after != before {
+		t.Errorf("UUID changed from %q to %q", before, after)
+	}
+}
+
+// TestFormat_UUID tests formatting with a caller-provided UUID
+func TestFormat_UUID(t *testing.T) {
+	device := escrowTestImage(t)
+	opts := FormatOptions{Device: device, Passphrase: []byte("test-password"), KDFType: "pbkdf2", PBKDFIterTime: 10}
+
+	opts.UUID = "not-a-uuid"
+	if err := Format(opts); !errors.Is(err, ErrInvalidUUID) {
+		t.Fatalf("expected ErrInvalidUUID, got %v", err)
+	}
+
+	opts.UUID = "2B1BD3C0-4C5E-4C5C-9A34-0E41B0A6D3A1"
+	if err := Format(opts); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if got, _ := GetUUID(device); got != "2b1bd3c0-4c5e-4c5c-9a34-0e41b0a6d3a1" {
+		t.Errorf("UUID = %q, want the provided UUID", got)
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// ProblemSeverity classifies a problem found by Validate
+type ProblemSeverity string
+
+const (
+	// SeverityError means the volume is inconsistent and may not unlock
+	SeverityError ProblemSeverity = "error"
+
+	// SeverityWarning means the volume works but deviates from the spec
+	SeverityWarning ProblemSeverity = "warning"
+)
+
+// Problem is a single finding of Validate
+type Problem struct {
+	Severity   ProblemSeverity
+	Object     string // What the problem is in, e.g. "header", "keyslot 1", "digest 0"
+	Message    string
+	Repairable bool // Fixed by Repair
+}
+
+// String formats the problem as "severity: object: message"
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Object, p.Message)
+}
+
+// ValidationReport is the result of Validate
+type ValidationReport struct {
+	Device   string
+	Headers  *HeaderStatus
+	Problems []Problem
+}
+
+// OK reports whether no errors were found (warnings are allowed)
+func (r *ValidationReport) OK() bool {
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// Repairable reports whether Repair would fix at least one problem
+func (r *ValidationReport) Repairable() bool {
+	for _, p := range r.Problems {
+		if p.Repairable {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a problem
+func (r *ValidationReport) add(severity ProblemSeverity, object, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, Problem{Severity: severity, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks a LUKS2 volume's metadata without modifying it, like a
+// filesystem fsck: header checksums and copies, JSON schema conformance,
+// keyslot area overlaps, digest references and segment alignment.
+// Problems that Repair can fix are marked Repairable. An error is returned
+// only when the device cannot be read or neither header copy is valid.
+//
+// Unlike ReadHeader, Validate inspects metadata that does not conform to the
+// on-disk format instead of rejecting it; the violation ReadHeader would
+// report is listed as a "metadata" problem.
+func Validate(device string) (*ValidationReport, error) {
+	status, err := checkDeviceHeaders(device, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationReport{Device: device, Headers: status}
+	hdr, metadata, err := status.active()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no valid header copy (primary: %v; secondary: %v)",
+			ErrInvalidHeader, status.PrimaryErr, status.SecondaryErr)
+	}
+
+	validateHeaderCopies(report, status)
+	if err := validateMetadataSchema(hdr, metadata); err != nil {
+		var merr *MetadataError
+		if errors.As(err, &merr) {
+			report.add(SeverityError, "metadata", "%s: %s (ReadHeader rejects this header copy)", merr.Path, merr.Reason)
+		}
+	}
+	validateConfig(report, hdr, metadata)
+	areas := validateKeyslots(report, hdr, metadata)
+	validateSegments(report, metadata, areas)
+	validateDigests(report, metadata)
+
+	if fi, err := os.Stat(device); err == nil && fi.Mode().IsRegular() {
+		validateDeviceSize(report, metadata, fi.Size())
+	}
+
+	return report, nil
+}
+
+// validateHeaderCopies reports damaged or out-of-sync header copies
+func validateHeaderCopies(r *ValidationReport, s *HeaderStatus) {
+	if s.PrimaryErr != nil {
+		r.Problems = append(r.Problems, Problem{SeverityError, "primary header", s.PrimaryErr.Error(), true})
+	}
+	if s.SecondaryErr != nil {
+		r.Problems = append(r.Problems, Problem{SeverityError, "secondary header", s.SecondaryErr.Error(), true})
+	}
+	if s.PrimaryErr == nil && s.SecondaryErr == nil && s.PrimarySequence != s.SecondarySequence {
+		r.Problems = append(r.Problems, Problem{SeverityWarning, "header",
+			fmt.Sprintf("sequence IDs differ (primary %d, secondary %d)", s.PrimarySequence, s.SecondarySequence), true})
+	}
+}
+
+// validateConfig checks the config section against the binary header
+func validateConfig(r *ValidationReport, hdr *LUKS2BinaryHeader, m *LUKS2Metadata) {
+	if m.Config == nil {
+		r.add(SeverityError, "config", "missing config section")
+		return
+	}
+
+	jsonSize, err := parseSize(m.Config.JSONSize)
+	if err != nil {
+		r.add(SeverityError, "config", "invalid json_size %q", m.Config.JSONSize)
+	} else if uint64(jsonSize) != hdr.HeaderSize-LUKS2HeaderSize { // #nosec G115 - compared only
+		r.add(SeverityWarning, "config", "json_size %d does not match header size %d", jsonSize, hdr.HeaderSize)
+	}
+
+	if _, err := parseSize(m.Config.KeyslotsSize); err != nil {
+		r.add(SeverityError, "config", "invalid keyslots_size %q", m.Config.KeyslotsSize)
+	}
+}
+
+// keyslotArea is the on-disk byte range of a keyslot's key material
+type keyslotArea struct {
+	id         string
+	start, end int64
+}
+
+// validateKeyslots checks keyslot schema and area placement and returns the
+// valid areas
+func validateKeyslots(r *ValidationReport, hdr *LUKS2BinaryHeader, m *LUKS2Metadata) []keyslotArea {
+	if len(m.Keyslots) == 0 {
+		r.add(SeverityError, "keyslots", "no keyslots")
+		return nil
+	}
+
+	// Keyslot areas live between the second header copy and keyslots_size
+	metadataEnd := 2 * int64(hdr.HeaderSize) // #nosec G115 - header size validated on read
+	areaLimit := int64(-1)
+	if m.Config != nil {
+		if size, err := parseSize(m.Config.KeyslotsSize); err == nil {
+			areaLimit = metadataEnd + size
+		}
+	}
+
+	var areas []keyslotArea
+	for _, id := range sortedIDs(m.Keyslots) {
+		ks := m.Keyslots[id]
+		obj := "keyslot " + id
+		if !validNumericID(id) {
+			r.add(SeverityError, obj, "keyslot ID is not a number")
+		}
+		if ks == nil {
+			r.add(SeverityError, obj, "empty keyslot object")
+			continue
+		}
+		if ks.Type != "luks2" {
+			r.add(SeverityError, obj, "unsupported type %q", ks.Type)
+		}
+		if ks.KeySize <= 0 {
+			r.add(SeverityError, obj, "invalid key_size %d", ks.KeySize)
+		}
+		if ks.Priority != nil && validateKeyslotPriority(*ks.Priority) != nil {
+			r.add(SeverityError, obj, "invalid priority %d", *ks.Priority)
+		}
+		validateKDFSchema(r, obj, ks.KDF)
+
+		if ks.AF == nil {
+			r.add(SeverityError, obj, "missing af section")
+		} else {
+			if ks.AF.Type != "luks1" {
+				r.add(SeverityError, obj, "unsupported af type %q", ks.AF.Type)
+			}
+			if _, err := afMaterialSize(ks.KeySize, ks.AF.Stripes); err != nil {
+				r.add(SeverityError, obj, "af stripes: %v", err)
+			} else if ks.AF.Stripes != AFStripes {
+				r.add(SeverityWarning, obj, "af stripes %d differ from the %d other LUKS2 implementations use", ks.AF.Stripes, AFStripes)
+			}
+			if _, err := getPBKDF2HashFunc(ks.AF.Hash); err != nil {
+				r.add(SeverityError, obj, "unsupported af hash %q", ks.AF.Hash)
+			}
+		}
+
+		if ks.Area == nil {
+			r.add(SeverityError, obj, "missing area section")
+			continue
+		}
+		if ks.Area.Type != "raw" {
+			r.add(SeverityError, obj, "unsupported area type %q", ks.Area.Type)
+		}
+		if ks.Area.Encryption == "" {
+			r.add(SeverityError, obj, "missing area encryption")
+		} else if _, err := parseKeyslotEncryption(ks.Area.Encryption, areaKeySize(ks)); err != nil {
+			r.add(SeverityWarning, obj, "cannot be unlocked here: %v", err)
+		}
+		offset, errOff := parseSize(ks.Area.Offset)
+		size, errSize := parseSize(ks.Area.Size)
+		if errOff != nil || errSize != nil || offset < 0 || size <= 0 {
+			r.add(SeverityError, obj, "invalid area offset %q / size %q", ks.Area.Offset, ks.Area.Size)
+			continue
+		}
+		if offset%LUKS2SectorSize != 0 {
+			r.add(SeverityError, obj, "area offset %d is not sector aligned", offset)
+		}
+		if ks.AF != nil && ks.KeySize > 0 && size < int64(ks.KeySize)*int64(ks.AF.Stripes) {
+			r.add(SeverityError, obj, "area size %d is smaller than the AF-split key material (%d)", size, ks.KeySize*ks.AF.Stripes)
+		}
+		if offset < metadataEnd {
+			r.add(SeverityError, obj, "area at %d overlaps the header copies (end %d)", offset, metadataEnd)
+		}
+		if areaLimit >= 0 && offset+size > areaLimit {
+			r.add(SeverityError, obj, "area ends at %d, beyond the keyslots area (end %d)", offset+size, areaLimit)
+		}
+		areas = append(areas, keyslotArea{id: id, start: offset, end: offset + size})
+	}
+
+	// Pairwise overlap check on areas sorted by offset
+	sort.Slice(areas, func(i, j int) bool { return areas[i].start < areas[j].start })
+	for i := 1; i < len(areas); i++ {
+		if areas[i].start < areas[i-1].end {
+			r.add(SeverityError, "keyslot "+areas[i].id, "area overlaps keyslot %s", areas[i-1].id)
+		}
+	}
+
+	return areas
+}
+
+// validateKDFSchema checks that a keyslot KDF has the parameters its type needs
+func validateKDFSchema(r *ValidationReport, obj string, kdf *KDF) {
+	if kdf == nil {
+		r.add(SeverityError, obj, "missing kdf section")
+		return
+	}
+	if _, err := decodeBase64(kdf.Salt); err != nil || kdf.Salt == "" {
+		r.add(SeverityError, obj, "invalid kdf salt")
+	}
+
+	switch kdf.Type {
+	case "pbkdf2":
+		if kdf.Iterations == nil || *kdf.Iterations <= 0 {
+			r.add(SeverityError, obj, "pbkdf2 requires positive iterations")
+		}
+		if _, err := getPBKDF2HashFunc(kdf.Hash); err != nil {
+			r.add(SeverityError, obj, "unsupported pbkdf2 hash %q", kdf.Hash)
+		}
+	case KDFTypeArgon2i, KDFTypeArgon2id:
+		if kdf.Time == nil || *kdf.Time <= 0 || kdf.Memory == nil || *kdf.Memory <= 0 || kdf.CPUs == nil || *kdf.CPUs <= 0 {
+			r.add(SeverityError, obj, "%s requires positive time, memory and cpus", kdf.Type)
+		} else if *kdf.CPUs > 255 {
+			r.add(SeverityError, obj, "%s cpus %d exceeds 255", kdf.Type, *kdf.CPUs)
+		}
+	default:
+		r.add(SeverityError, obj, "unsupported kdf type %q", kdf.Type)
+	}
+}
+
+// validateSegments checks segment schema and alignment
+func validateSegments(r *ValidationReport, m *LUKS2Metadata, areas []keyslotArea) {
+	if len(m.Segments) == 0 {
+		r.add(SeverityError, "segments", "no segments")
+		return
+	}
+
+	areasEnd := int64(0)
+	for _, a := range areas {
+		areasEnd = max(areasEnd, a.end)
+	}
+
+	var dynamicID string
+	for _, id := range sortedIDs(m.Segments) {
+		seg := m.Segments[id]
+		obj := "segment " + id
+		if !validNumericID(id) {
+			r.add(SeverityError, obj, "segment ID is not a number")
+		}
+		if seg == nil {
+			r.add(SeverityError, obj, "empty segment object")
+			continue
+		}
+		crypt := seg.Type == SegmentTypeCrypt
+		if !crypt && seg.Type != SegmentTypeLinear {
+			r.add(SeverityWarning, obj, "unsupported type %q", seg.Type)
+			continue
+		}
+
+		sectorSize := int64(LUKS2SectorSize)
+		if crypt {
+			if seg.Encryption == "" {
+				r.add(SeverityError, obj, "missing encryption")
+			}
+			sectorSize = int64(seg.SectorSize)
+			if sectorSize < 512 || sectorSize > 4096 || !isPowerOf2(seg.SectorSize) {
+				r.add(SeverityError, obj, "invalid sector_size %d", seg.SectorSize)
+				sectorSize = LUKS2SectorSize
+			}
+		}
+
+		offset, err := parseSize(seg.Offset)
+		if err != nil || offset < 0 {
+			r.add(SeverityError, obj, "invalid offset %q", seg.Offset)
+		} else {
+			if offset%sectorSize != 0 {
+				r.add(SeverityError, obj, "offset %d is not aligned to the %d-byte sector size", offset, sectorSize)
+			}
+			if offset < areasEnd {
+				r.add(SeverityError, obj, "data at %d overlaps keyslot areas (end %d)", offset, areasEnd)
+			}
+		}
+
+		if seg.Size != "dynamic" {
+			size, err := parseSize(seg.Size)
+			if err != nil || size <= 0 {
+				r.add(SeverityError, obj, "invalid size %q", seg.Size)
+			} else if size%sectorSize != 0 {
+				r.add(SeverityError, obj, "size %d is not a multiple of the %d-byte sector size", size, sectorSize)
+			}
+		}
+
+		if crypt {
+			if _, err := strconv.ParseUint(seg.IVTweak, 10, 64); err != nil {
+				r.add(SeverityError, obj, "invalid iv_tweak %q", seg.IVTweak)
+			}
+		}
+
+		// Only the last mapped segment may extend to the end of the device
+		if !isBackupSegment(seg) {
+			if dynamicID != "" {
+				r.add(SeverityError, "segment "+dynamicID, "dynamic segment is followed by segment %s", id)
+			}
+			dynamicID = ""
+			if seg.Size == "dynamic" {
+				dynamicID = id
+			}
+		}
+	}
+}
+
+// validateDigests checks digest schema and cross-references
+func validateDigests(r *ValidationReport, m *LUKS2Metadata) {
+	if len(m.Digests) == 0 {
+		r.add(SeverityError, "digests", "no digests")
+		return
+	}
+
+	boundKeyslots := make(map[string]bool)
+	boundSegments := make(map[string]bool)
+
+	for _, id := range sortedIDs(m.Digests) {
+		d := m.Digests[id]
+		obj := "digest " + id
+		if d == nil {
+			r.add(SeverityError, obj, "empty digest object")
+			continue
+		}
+		if d.Type != "pbkdf2" {
+			r.add(SeverityError, obj, "unsupported type %q", d.Type)
+		}
+		if _, err := getPBKDF2HashFunc(d.Hash); err != nil {
+			r.add(SeverityError, obj, "unsupported hash %q", d.Hash)
+		}
+		if d.Iterations <= 0 {
+			r.add(SeverityError, obj, "invalid iterations %d", d.Iterations)
+		} else if d.Iterations < MinDigestIterations {
+			r.add(SeverityWarning, obj, "%d iterations make the digest cheap to brute-force (cryptsetup uses at least %d)", d.Iterations, MinDigestIterations)
+		}
+		if _, err := decodeBase64(d.Salt); err != nil || d.Salt == "" {
+			r.add(SeverityError, obj, "invalid salt")
+		}
+		if _, err := decodeBase64(d.Digest); err != nil || d.Digest == "" {
+			r.add(SeverityError, obj, "invalid digest value")
+		}
+
+		for _, ks := range d.Keyslots {
+			if _, ok := m.Keyslots[ks]; !ok {
+				r.add(SeverityError, obj, "references missing keyslot %s", ks)
+			}
+			boundKeyslots[ks] = true
+		}
+		for _, seg := range d.Segments {
+			if _, ok := m.Segments[seg]; !ok {
+				r.add(SeverityError, obj, "references missing segment %s", seg)
+			}
+			boundSegments[seg] = true
+		}
+	}
+
+	for _, id := range sortedIDs(m.Keyslots) {
+		if !boundKeyslots[id] {
+			r.add(SeverityError, "keyslot "+id, "not referenced by any digest")
+		}
+	}
+	for _, id := range sortedIDs(m.Segments) {
+		// Linear segments hold plaintext and carry no key
+		if seg := m.Segments[id]; seg != nil && seg.Type == SegmentTypeLinear {
+			continue
+		}
+		if !boundSegments[id] {
+			r.add(SeverityError, "segment "+id, "not referenced by any digest")
+		}
+	}
+
+	for _, id := range sortedIDs(m.Tokens) {
+		tok := m.Tokens[id]
+		if tok == nil {
+			continue
+		}
+		for _, ks := range tok.Keyslots {
+			if _, ok := m.Keyslots[ks]; !ok {
+				r.add(SeverityWarning, "token "+id, "references missing keyslot %s", ks)
+			}
+		}
+	}
+}
+
+// validateDeviceSize checks that fixed-size segments fit in an image file
+func validateDeviceSize(r *ValidationReport, m *LUKS2Metadata, deviceSize int64) {
+	for _, id := range sortedIDs(m.Segments) {
+		seg := m.Segments[id]
+		if seg == nil {
+			continue
+		}
+		offset, err := parseSize(seg.Offset)
+		if err != nil {
+			continue
+		}
+		if seg.Size == "dynamic" {
+			if offset >= deviceSize {
+				r.add(SeverityError, "segment "+id, "data offset %d is beyond the end of the device (%d bytes)", offset, deviceSize)
+			}
+			continue
+		}
+		if size, err := parseSize(seg.Size); err == nil && offset+size > deviceSize {
+			r.add(SeverityError, "segment "+id, "ends at %d, beyond the end of the device (%d bytes)", offset+size, deviceSize)
+		}
+	}
+}
+
+// validNumericID reports whether a JSON object key is a decimal ID
+func validNumericID(id string) bool {
+	n, err := strconv.Atoi(id)
+	return err == nil && n >= 0 && strconv.Itoa(n) == id
+}
+
+// sortedIDs returns the keys of a metadata object in numeric order
+func sortedIDs[V any](m map[string]V) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		ai, errA := strconv.Atoi(a)
+		bi, errB := strconv.Atoi(b)
+		if errA == nil && errB == nil {
+			return ai - bi
+		}
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	})
+	return ids
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// hasProblem reports whether the report contains a problem for object whose
+// message contains substr
+func hasProblem(report *ValidationReport, object, substr string) bool {
+	for _, p := range report.Problems {
+		if p.Object == object && strings.Contains(p.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestValidate_Clean tests that a freshly formatted volume has no problems
+func TestValidate_Clean(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	if err := AddKey(device, passphrase, []byte("second-password"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	report, err := Validate(device)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if len(report.Problems) != 0 || !report.OK() || report.Repairable() {
+		t.Errorf("expected no problems, got %v", report.Problems)
+	}
+}
+
+// TestValidate_DamagedHeader tests that a damaged copy is reported as repairable
+func TestValidate_DamagedHeader(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	corruptAt(t, device, LUKS2HeaderMinSize+LUKS2HeaderSize+2)
+
+	report, err := Validate(device)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if report.OK() || !report.Repairable() {
+		t.Fatalf("expected repairable error, got %v", report.Problems)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Object != "secondary header" {
+		t.Errorf("unexpected problems: %v", report.Problems)
+	}
+
+	if err := Repair(device); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report, err = Validate(device); err != nil || len(report.Problems) != 0 {
+		t.Errorf("problems remain after repair: %v, %v", report.Problems, err)
+	}
+}
+
+// TestValidate_BothHeadersDamaged tests that Validate fails without a valid copy
+func TestValidate_BothHeadersDamaged(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	corruptAt(t, device, LUKS2HeaderSize+2)
+	corruptAt(t, device, LUKS2HeaderMinSize+LUKS2HeaderSize+2)
+
+	if _, err := Validate(device); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
+
+// TestValidate_Metadata tests the metadata consistency checks
+func TestValidate_WeakDigest(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	hdr, metadata, err := ReadHeader(device)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	metadata.Digests["0"].Iterations = 500
+	if err := WriteHeader(device, hdr, metadata); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	report, err := Validate(device)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !report.OK() || !hasProblem(report, "digest 0", "cheap to brute-force") {
+		t.Errorf("expected a digest warning only, got %v", report.Problems)
+	}
+}
+
+func TestValidate_Metadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *LUKS2Metadata)
+		object string
+		substr string
+	}{
+		{
+			name: "overlapping keyslot areas",
+			modify: func(m *LUKS2Metadata) {
+				m.Keyslots["1"].Area.Offset = m.Keyslots["0"].Area.Offset
+			},
+			object: "keyslot 1",
+			substr: "overlaps keyslot 0",
+		},
+		{
+			name: "area inside header",
+			modify: func(m *LUKS2Metadata) {
+				m.Keyslots["0"].Area.Offset = "4096"
+			},
+			object: "keyslot 0",
+			substr: "overlaps the header copies",
+		},
+		{
+			name: "digest references missing keyslot",
+			modify: func(m *LUKS2Metadata) {
+				m.Digests["0"].Keyslots = append(m.Digests["0"].Keyslots, "7")
+			},
+			object: "digest 0",
+			substr: "missing keyslot 7",
+		},
+		{
+			name: "keyslot without digest",
+			modify: func(m *LUKS2Metadata) {
+				m.Digests["0"].Keyslots = []string{"0"}
+			},
+			object: "keyslot 1",
+			substr: "not referenced by any digest",
+		},
+		{
+			name: "unaligned segment",
+			modify: func(m *LUKS2Metadata) {
+				m.Segments["0"].Offset = "16777300"
+			},
+			object: "segment 0",
+			substr: "not aligned",
+		},
+		{
+			name: "segment overlaps keyslots",
+			modify: func(m *LUKS2Metadata) {
+				m.Segments["0"].Offset = "65536"
+			},
+			object: "segment 0",
+			substr: "overlaps keyslot areas",
+		},
+		{
+			name: "invalid sector size",
+			modify: func(m *LUKS2Metadata) {
+				m.Segments["0"].SectorSize = 1000
+			},
+			object: "segment 0",
+			substr: "invalid sector_size",
+		},
+		{
+			name: "dynamic segment not last",
+			modify: func(m *LUKS2Metadata) {
+				m.Segments["1"] = &Segment{Type: SegmentTypeLinear, Offset: "17825792", Size: "1048576"}
+			},
+			object: "segment 0",
+			substr: "dynamic segment is followed by segment 1",
+		},
+		{
+			name: "missing kdf parameters",
+			modify: func(m *LUKS2Metadata) {
+				m.Keyslots["1"].KDF.Iterations = nil
+			},
+			object: "keyslot 1",
+			substr: "requires positive iterations",
+		},
+		{
+			name: "unknown af type",
+			modify: func(m *LUKS2Metadata) {
+				m.Keyslots["0"].AF.Type = "luks3"
+			},
+			object: "keyslot 0",
+			substr: "unsupported af type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase := []byte("test-password")
+			device := formatTestVolume(t, passphrase)
+			if err := AddKey(device, passphrase, []byte("second-password"), &AddKeyOptions{KDFType: "pbkdf2", PBKDFIterTime: 10}); err != nil {
+				t.Fatalf("AddKey failed: %v", err)
+			}
+
+			hdr, metadata, err := ReadHeader(device)
+			if err != nil {
+				t.Fatalf("ReadHeader failed: %v", err)
+			}
+			tt.modify(metadata)
+			if err := WriteHeader(device, hdr, metadata); err != nil {
+				t.Fatalf("WriteHeader failed: %v", err)
+			}
+
+			report, err := Validate(device)
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if report.OK() {
+				t.Error("expected report with errors")
+			}
+			if !hasProblem(report, tt.object, tt.substr) {
+				t.Errorf("expected %s problem containing %q, got %v", tt.object, tt.substr, report.Problems)
+			}
+			if report.Repairable() {
+				t.Errorf("metadata problems must not be marked repairable: %v", report.Problems)
+			}
+		})
+	}
+}
+
+func TestSortedIDs(t *testing.T) {
+	got := sortedIDs(map[string]int{"10": 0, "2": 0, "0": 0, "x": 0})
+	want := []string{"0", "2", "10", "x"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("sortedIDs = %v, want %v", got, want)
+	}
+}
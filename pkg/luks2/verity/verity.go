@@ -0,0 +1,551 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package verity formats and opens dm-verity volumes: read-only block
+// devices whose every block is checked against a hash tree as it is read.
+// It complements pkg/luks2 on appliance images, where a LUKS2 volume holds
+// the writable data and a verity volume the read-only root filesystem.
+//
+// The on-disk format is the one of veritysetup (hash type 1): a 512-byte
+// superblock followed by the hash tree, either on a device of its own or
+// after the data on the same device, so devices formatted here open with
+// veritysetup and the other way round. Only the root hash has to come
+// from a trusted source, such as the kernel command line or a signed
+// image manifest; the superblock and the tree are checked against it.
+package verity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	_ "crypto/sha1" // #nosec G505 -- registers SHA-1 for old veritysetup volumes
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// Defaults of Format, matching veritysetup
+const (
+	DefaultAlgorithm = "sha256"
+	DefaultBlockSize = 4096
+	DefaultSaltSize  = 32
+)
+
+// Superblock layout (struct verity_sb in cryptsetup)
+const (
+	superblockSize    = 512
+	superblockMagic   = "verity\x00\x00"
+	superblockVersion = 1
+	hashTypeNormal    = 1 // Salt hashed first, digests padded to a power of two
+	maxSaltSize       = 256
+	maxLevels         = 63
+	readChunkSize     = 1 << 20
+)
+
+var (
+	// ErrCorrupted indicates data or hash blocks that do not match the root
+	// hash
+	ErrCorrupted = errors.New("verity hash tree does not match")
+
+	// ErrNoSuperblock indicates a hash device without a verity superblock
+	// where one was expected
+	ErrNoSuperblock = errors.New("no verity superblock")
+)
+
+// algorithms are the hash algorithms dm-verity volumes are created with
+var algorithms = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+// Params describes a hash tree. Format fills in the defaults; Verify and
+// Open read them from the superblock unless NoSuperblock is set.
+type Params struct {
+	Algorithm     string // Hash algorithm: sha256 (default), sha512 or sha1
+	DataBlockSize int    // Bytes per data block (default: 4096)
+	HashBlockSize int    // Bytes per hash block (default: 4096)
+	DataBlocks    uint64 // Data blocks covered (Format: 0 = the whole data device)
+	Salt          []byte // Salt (Format: nil = DefaultSaltSize random bytes, empty = none)
+	UUID          string // UUID stored in the superblock (Format: "" = random)
+	HashOffset    int64  // Byte offset of the superblock on the hash device, or of the tree without one
+	NoSuperblock  bool   // No superblock: the parameters must be kept elsewhere
+}
+
+// Corruption selects what the kernel does when a block fails verification
+type Corruption string
+
+const (
+	CorruptionError   Corruption = ""        // Fail the read with EIO (default)
+	CorruptionIgnore  Corruption = "ignore"  // Log it and return the data anyway
+	CorruptionRestart Corruption = "restart" // Restart the machine
+	CorruptionPanic   Corruption = "panic"   // Panic the kernel
+)
+
+// OpenOptions configures Open
+type OpenOptions struct {
+	// Params locates the tree on the hash device, as for Verify (nil = the
+	// superblock at its start)
+	Params *Params
+
+	OnCorruption     Corruption // What a failed verification does
+	IgnoreZeroBlocks bool       // Return zeroes for blocks whose hash covers zeroes, without reading them
+	CheckAtMostOnce  bool       // Verify each data block only the first time it is read
+}
+
+// Tree is a formatted hash tree
+type Tree struct {
+	Params
+	RootHash []byte // The hash everything else is checked against
+	HashSize int64  // Bytes used on the hash device, from its start
+}
+
+// Format computes the hash tree of dataDevice and writes it, with a
+// superblock unless opts.NoSuperblock, to hashDevice at opts.HashOffset.
+// hashDevice may be a regular file, which is created if needed, and may be
+// dataDevice itself when the hash offset lies past the data. The returned
+// root hash must be stored somewhere trusted to open the volume.
+func Format(dataDevice, hashDevice string, opts *Params) (*Tree, error) {
+	p, err := formatParams(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.Open(dataDevice) // #nosec G304 -- caller-provided device path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data device: %w", err)
+	}
+	defer func() { _ = data.Close() }()
+
+	if p.DataBlocks == 0 {
+		size, err := data.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of %s: %w", dataDevice, err)
+		}
+		p.DataBlocks = uint64(size) / uint64(p.DataBlockSize) // #nosec G115 -- sizes are not negative
+		if p.DataBlocks == 0 {
+			return nil, fmt.Errorf("data device %s is smaller than one block (%d bytes)", dataDevice, size)
+		}
+	}
+	g, err := newGeometry(p)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := os.OpenFile(hashDevice, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- caller-provided device path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash device: %w", err)
+	}
+	defer func() { _ = hash.Close() }()
+
+	if err := checkHashDevice(data, hash, p, g); err != nil {
+		return nil, err
+	}
+	if !p.NoSuperblock {
+		if _, err := hash.WriteAt(marshalSuperblock(p), p.HashOffset); err != nil {
+			return nil, fmt.Errorf("failed to write superblock: %w", err)
+		}
+	}
+	root, err := g.build(data, hash, hash, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := hash.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync hash device: %w", err)
+	}
+	return &Tree{Params: *p, RootHash: root, HashSize: g.size()}, nil
+}
+
+// Verify reads all of dataDevice and checks it and the hash tree on
+// hashDevice against rootHash, as the kernel would when every block is
+// read. p locates the tree: nil reads the superblock at the start of
+// hashDevice, otherwise at p.HashOffset, and with p.NoSuperblock p is used
+// as is. Mismatches are reported as ErrCorrupted.
+func Verify(dataDevice, hashDevice string, rootHash []byte, p *Params) error {
+	p, err := locate(hashDevice, p)
+	if err != nil {
+		return err
+	}
+	g, err := newGeometry(p)
+	if err != nil {
+		return err
+	}
+	if len(rootHash) != g.digestSize {
+		return fmt.Errorf("root hash is %d bytes, %s needs %d", len(rootHash), p.Algorithm, g.digestSize)
+	}
+
+	data, err := os.Open(dataDevice) // #nosec G304 -- caller-provided device path
+	if err != nil {
+		return fmt.Errorf("failed to open data device: %w", err)
+	}
+	defer func() { _ = data.Close() }()
+	hash, err := os.Open(hashDevice) // #nosec G304 -- caller-provided device path
+	if err != nil {
+		return fmt.Errorf("failed to open hash device: %w", err)
+	}
+	defer func() { _ = hash.Close() }()
+
+	root, err := g.build(data, hash, &compareWriter{r: hash}, p)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, rootHash) {
+		return fmt.Errorf("%w: root hash %x, expected %x", ErrCorrupted, root, rootHash)
+	}
+	return nil
+}
+
+// ReadSuperblock reads the parameters from the superblock at offset on
+// hashDevice
+func ReadSuperblock(hashDevice string, offset int64) (*Params, error) {
+	f, err := os.Open(hashDevice) // #nosec G304 -- caller-provided device path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, superblockSize)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w at offset %d of %s", ErrNoSuperblock, offset, hashDevice)
+		}
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	p, err := parseSuperblock(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hashDevice, err)
+	}
+	p.HashOffset = offset
+	return p, nil
+}
+
+// locate returns the parameters of the tree on hashDevice, see Verify
+func locate(hashDevice string, p *Params) (*Params, error) {
+	if p == nil {
+		return ReadSuperblock(hashDevice, 0)
+	}
+	if !p.NoSuperblock {
+		return ReadSuperblock(hashDevice, p.HashOffset)
+	}
+	c := *p
+	applyDefaults(&c)
+	if c.DataBlocks == 0 {
+		return nil, errors.New("DataBlocks is required without a superblock")
+	}
+	return &c, validate(&c)
+}
+
+// formatParams copies opts with the defaults applied and a random salt and
+// UUID where none is given
+func formatParams(opts *Params) (*Params, error) {
+	p := &Params{}
+	if opts != nil {
+		*p = *opts
+	}
+	applyDefaults(p)
+	if p.Salt == nil {
+		p.Salt = make([]byte, DefaultSaltSize)
+		if _, err := rand.Read(p.Salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+	if p.UUID == "" && !p.NoSuperblock {
+		p.UUID = uuid.NewString()
+	}
+	return p, validate(p)
+}
+
+func applyDefaults(p *Params) {
+	if p.Algorithm == "" {
+		p.Algorithm = DefaultAlgorithm
+	}
+	if p.DataBlockSize == 0 {
+		p.DataBlockSize = DefaultBlockSize
+	}
+	if p.HashBlockSize == 0 {
+		p.HashBlockSize = DefaultBlockSize
+	}
+}
+
+func validate(p *Params) error {
+	if _, ok := algorithms[p.Algorithm]; !ok {
+		return fmt.Errorf("unsupported hash algorithm %q", p.Algorithm)
+	}
+	for _, size := range []int{p.DataBlockSize, p.HashBlockSize} {
+		if size < 512 || size > 1<<16 || size&(size-1) != 0 {
+			return fmt.Errorf("invalid block size %d (a power of two from 512 to 65536)", size)
+		}
+	}
+	if len(p.Salt) > maxSaltSize {
+		return fmt.Errorf("salt longer than %d bytes", maxSaltSize)
+	}
+	if p.UUID != "" {
+		if _, err := uuid.Parse(p.UUID); err != nil {
+			return fmt.Errorf("invalid UUID %q: %w", p.UUID, err)
+		}
+	}
+	if p.HashOffset < 0 || p.HashOffset%512 != 0 {
+		return fmt.Errorf("hash offset %d is not a multiple of 512", p.HashOffset)
+	}
+	if p.NoSuperblock && p.HashOffset%int64(p.HashBlockSize) != 0 {
+		return fmt.Errorf("hash offset %d is not a multiple of the hash block size", p.HashOffset)
+	}
+	if p.DataBlocks > math.MaxInt64/uint64(p.DataBlockSize) { // #nosec G115 -- checked positive above
+		return fmt.Errorf("too many data blocks: %d", p.DataBlocks)
+	}
+	return nil
+}
+
+// checkHashDevice makes sure the tree fits on the hash device and, when
+// data and hash share a device, does not overwrite the data
+func checkHashDevice(data, hash *os.File, p *Params, g *geometry) error {
+	dataInfo, err := data.Stat()
+	if err != nil {
+		return err
+	}
+	hashInfo, err := hash.Stat()
+	if err != nil {
+		return err
+	}
+	if os.SameFile(dataInfo, hashInfo) && p.HashOffset < int64(p.DataBlocks)*int64(p.DataBlockSize) { // #nosec G115 -- bounded by validate
+		return fmt.Errorf("hash offset %d overlaps the %d bytes of data", p.HashOffset, int64(p.DataBlocks)*int64(p.DataBlockSize)) // #nosec G115 -- bounded by validate
+	}
+	if hashInfo.Mode()&os.ModeDevice != 0 {
+		size, err := hash.Seek(0, io.SeekEnd)
+		if err != nil {
+			return fmt.Errorf("failed to get size of hash device: %w", err)
+		}
+		if size < g.size() {
+			return fmt.Errorf("hash device too small: the tree needs %d bytes, it has %d", g.size(), size)
+		}
+	}
+	return nil
+}
+
+// marshalSuperblock encodes p as a veritysetup superblock
+func marshalSuperblock(p *Params) []byte {
+	sb := make([]byte, superblockSize)
+	copy(sb[0:8], superblockMagic)
+	binary.LittleEndian.PutUint32(sb[8:], superblockVersion)
+	binary.LittleEndian.PutUint32(sb[12:], hashTypeNormal)
+	if id, err := uuid.Parse(p.UUID); err == nil {
+		copy(sb[16:32], id[:])
+	}
+	copy(sb[32:64], p.Algorithm)
+	binary.LittleEndian.PutUint32(sb[64:], uint32(p.DataBlockSize)) // #nosec G115 -- at most 65536
+	binary.LittleEndian.PutUint32(sb[68:], uint32(p.HashBlockSize)) // #nosec G115 -- at most 65536
+	binary.LittleEndian.PutUint64(sb[72:], p.DataBlocks)
+	binary.LittleEndian.PutUint16(sb[80:], uint16(len(p.Salt))) // #nosec G115 -- at most 256
+	copy(sb[88:88+maxSaltSize], p.Salt)
+	return sb
+}
+
+// parseSuperblock decodes and checks a veritysetup superblock
+func parseSuperblock(sb []byte) (*Params, error) {
+	if string(sb[0:8]) != superblockMagic {
+		return nil, ErrNoSuperblock
+	}
+	if v := binary.LittleEndian.Uint32(sb[8:]); v != superblockVersion {
+		return nil, fmt.Errorf("unsupported verity superblock version %d", v)
+	}
+	if t := binary.LittleEndian.Uint32(sb[12:]); t != hashTypeNormal {
+		return nil, fmt.Errorf("unsupported verity hash type %d", t)
+	}
+	saltSize := int(binary.LittleEndian.Uint16(sb[80:]))
+	if saltSize > maxSaltSize {
+		return nil, fmt.Errorf("invalid salt size %d", saltSize)
+	}
+
+	p := &Params{
+		Algorithm:     string(bytes.TrimRight(sb[32:64], "\x00")),
+		DataBlockSize: int(binary.LittleEndian.Uint32(sb[64:])),
+		HashBlockSize: int(binary.LittleEndian.Uint32(sb[68:])),
+		DataBlocks:    binary.LittleEndian.Uint64(sb[72:]),
+		Salt:          bytes.Clone(sb[88 : 88+saltSize]),
+	}
+	if id, err := uuid.FromBytes(sb[16:32]); err == nil && id != uuid.Nil {
+		p.UUID = id.String()
+	}
+	if p.DataBlocks == 0 {
+		return nil, errors.New("verity superblock covers no data blocks")
+	}
+	if err := validate(p); err != nil {
+		return nil, fmt.Errorf("invalid verity superblock: %w", err)
+	}
+	return p, nil
+}
+
+// geometry is the layout of a hash tree on the hash device. Level 0 holds
+// the digests of the data blocks, each level above the digests of the one
+// below, up to a single block whose digest is the root hash. The top level
+// comes first on the device.
+type geometry struct {
+	hash        crypto.Hash
+	digestSize  int
+	digestSpace int     // digestSize rounded up to a power of two
+	perBlock    int     // Digests per hash block
+	start       int64   // First hash block of the tree
+	levelStart  []int64 // First hash block of each level
+	levelBlocks []int64 // Hash blocks of each level
+	end         int64   // Hash blocks up to the end of the tree
+	blockSize   int64   // Hash block size
+}
+
+func newGeometry(p *Params) (*geometry, error) {
+	h := algorithms[p.Algorithm]
+	if !h.Available() {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", p.Algorithm)
+	}
+	g := &geometry{
+		hash:        h,
+		digestSize:  h.Size(),
+		digestSpace: 1 << bits.Len(uint(h.Size()-1)),
+		blockSize:   int64(p.HashBlockSize),
+	}
+	perBlockBits := bits.Len(uint(p.HashBlockSize/g.digestSize)) - 1
+	if perBlockBits < 1 {
+		return nil, fmt.Errorf("hash block size %d too small for %s", p.HashBlockSize, p.Algorithm)
+	}
+	g.perBlock = 1 << perBlockBits
+
+	// The tree starts at the first hash block after the superblock
+	start := p.HashOffset
+	if !p.NoSuperblock {
+		start += superblockSize
+	}
+	g.start = (start + g.blockSize - 1) / g.blockSize
+	pos := g.start
+
+	levels := 0
+	for perBlockBits*levels < 64 && (p.DataBlocks-1)>>(perBlockBits*levels) != 0 {
+		levels++
+	}
+	if levels > maxLevels {
+		return nil, fmt.Errorf("too many data blocks: %d", p.DataBlocks)
+	}
+	g.levelStart = make([]int64, levels)
+	g.levelBlocks = make([]int64, levels)
+	for i := levels - 1; i >= 0; i-- {
+		shift := (i + 1) * perBlockBits
+		blocks := int64(1)
+		if shift < 64 {
+			blocks = int64((p.DataBlocks-1)>>shift) + 1 // #nosec G115 -- DataBlocks bounded by validate
+		}
+		g.levelStart[i] = pos
+		g.levelBlocks[i] = blocks
+		pos += blocks
+	}
+	g.end = pos
+	return g, nil
+}
+
+// size is the number of bytes of the hash device the tree ends at
+func (g *geometry) size() int64 {
+	return g.end * g.blockSize
+}
+
+// build hashes the data into each level of the tree in turn, writing a
+// level to w and reading it back from r to hash the next, and returns the
+// root hash
+func (g *geometry) build(data io.ReaderAt, r io.ReaderAt, w io.WriterAt, p *Params) ([]byte, error) {
+	if len(g.levelStart) == 0 {
+		// A single data block is its own root
+		return g.digestAt(data, 0, p.DataBlockSize, p.Salt)
+	}
+	for i := range g.levelStart {
+		var err error
+		if i == 0 {
+			err = g.hashLevel(data, 0, p.DataBlockSize, int64(p.DataBlocks), w, g.levelStart[0]*g.blockSize, p.Salt) // #nosec G115 -- bounded by validate
+		} else {
+			err = g.hashLevel(r, g.levelStart[i-1]*g.blockSize, int(g.blockSize), g.levelBlocks[i-1], w, g.levelStart[i]*g.blockSize, p.Salt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	top := g.levelStart[len(g.levelStart)-1]
+	return g.digestAt(r, top*g.blockSize, int(g.blockSize), p.Salt)
+}
+
+// hashLevel hashes count blocks of src at srcOff and writes their digests
+// as hash blocks to dst at dstOff
+func (g *geometry) hashLevel(src io.ReaderAt, srcOff int64, blockSize int, count int64, dst io.WriterAt, dstOff int64, salt []byte) error {
+	h := g.hash.New()
+	out := make([]byte, g.blockSize)
+	chunk := make([]byte, max(blockSize, readChunkSize/blockSize*blockSize))
+	filled := 0
+
+	for done := int64(0); done < count; {
+		n := min(int64(len(chunk)/blockSize), count-done)
+		buf := chunk[:n*int64(blockSize)]
+		if _, err := src.ReadAt(buf, srcOff+done*int64(blockSize)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("device ends before block %d: %w", done+n, io.ErrUnexpectedEOF)
+			}
+			return fmt.Errorf("failed to read block %d: %w", done, err)
+		}
+		for off := 0; off < len(buf); off += blockSize {
+			h.Reset()
+			h.Write(salt)
+			h.Write(buf[off : off+blockSize])
+			h.Sum(out[filled*g.digestSpace : filled*g.digestSpace])
+			if filled++; filled == g.perBlock {
+				if _, err := dst.WriteAt(out, dstOff); err != nil {
+					return err
+				}
+				dstOff += g.blockSize
+				clear(out)
+				filled = 0
+			}
+		}
+		done += n
+	}
+	if filled > 0 {
+		if _, err := dst.WriteAt(out, dstOff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// digestAt returns the salted digest of one block
+func (g *geometry) digestAt(src io.ReaderAt, off int64, blockSize int, salt []byte) ([]byte, error) {
+	block := make([]byte, blockSize)
+	if _, err := src.ReadAt(block, off); err != nil {
+		return nil, fmt.Errorf("failed to read block at %d: %w", off, err)
+	}
+	h := g.hash.New()
+	h.Write(salt)
+	h.Write(block)
+	return h.Sum(nil), nil
+}
+
+// compareWriter stands in for the hash device during Verify: instead of
+// writing a computed hash block it compares it with the stored one
+type compareWriter struct {
+	r   io.ReaderAt
+	buf []byte
+}
+
+func (c *compareWriter) WriteAt(p []byte, off int64) (int, error) {
+	if cap(c.buf) < len(p) {
+		c.buf = make([]byte, len(p))
+	}
+	stored := c.buf[:len(p)]
+	if _, err := c.r.ReadAt(stored, off); err != nil {
+		return 0, fmt.Errorf("failed to read hash block at %d: %w", off, err)
+	}
+	if !bytes.Equal(stored, p) {
+		return 0, fmt.Errorf("%w: hash block at offset %d", ErrCorrupted, off)
+	}
+	return len(p), nil
+}
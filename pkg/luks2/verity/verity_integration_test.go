@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration && linux
+
+package verity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// TestOpen tests mapping a verity volume and reading it back
+func TestOpen(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("This test requires root privileges")
+	}
+
+	dir := t.TempDir()
+	content := make([]byte, 8*1024*1024)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	dataImage := filepath.Join(dir, "data.img")
+	if err := os.WriteFile(dataImage, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	hashImage := filepath.Join(dir, "hash.img")
+
+	tree, err := Format(dataImage, hashImage, nil)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	dataDev, err := luks2.SetupLoopDevice(dataImage)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer func() { _ = luks2.DetachLoopDevice(dataDev) }()
+	hashDev, err := luks2.SetupLoopDevice(hashImage)
+	if err != nil {
+		t.Fatalf("Failed to setup loop device: %v", err)
+	}
+	defer func() { _ = luks2.DetachLoopDevice(hashDev) }()
+
+	name := "test-verity"
+	_ = Close(name)
+
+	if err := Open(name, dataDev, hashDev, tree.RootHash, &OpenOptions{CheckAtMostOnce: true}); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = Close(name) }()
+
+	if err := Open(name, dataDev, hashDev, tree.RootHash, nil); !errors.Is(err, luks2.ErrVolumeAlreadyUnlocked) {
+		t.Errorf("Second Open = %v, want ErrVolumeAlreadyUnlocked", err)
+	}
+
+	mapped, err := luks2.GetMappedDevicePath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(mapped)
+	if err != nil {
+		t.Fatalf("Failed to read verity device: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Verity device content differs from the data")
+	}
+
+	if f, err := os.OpenFile(mapped, os.O_WRONLY, 0); err == nil {
+		_ = f.Close()
+		t.Error("Verity device opened for writing")
+	}
+
+	if err := Close(name); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if luks2.IsUnlocked(name) {
+		t.Error("Mapping still present after Close")
+	}
+}
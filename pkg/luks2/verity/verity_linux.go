@@ -0,0 +1,115 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package verity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/anatol/devmapper.go"
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// Open maps dataDevice as the read-only /dev/mapper/<name>, checked
+// against the hash tree on hashDevice whose root is rootHash. Both must be
+// block devices (attach images with luks2.SetupLoopDevice). Blocks are
+// verified as they are read; see OpenOptions for what a mismatch does.
+func Open(name, dataDevice, hashDevice string, rootHash []byte, opts *OpenOptions) error {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	for _, device := range []string{dataDevice, hashDevice} {
+		if err := luks2.ValidateDevicePath(device); err != nil {
+			return err
+		}
+	}
+	if luks2.IsUnlocked(name) {
+		return fmt.Errorf("%w: %s", luks2.ErrVolumeAlreadyUnlocked, name)
+	}
+
+	p, err := locate(hashDevice, opts.Params)
+	if err != nil {
+		return err
+	}
+	g, err := newGeometry(p)
+	if err != nil {
+		return err
+	}
+	if len(rootHash) != g.digestSize {
+		return fmt.Errorf("root hash is %d bytes, %s needs %d", len(rootHash), p.Algorithm, g.digestSize)
+	}
+	args, err := opts.targetArgs()
+	if err != nil {
+		return err
+	}
+
+	salt := "-"
+	if len(p.Salt) > 0 {
+		salt = hex.EncodeToString(p.Salt)
+	}
+	table := devmapper.VerityTable{
+		Length:         p.DataBlocks * uint64(p.DataBlockSize) / 512, // #nosec G115 -- bounded by validate
+		HashType:       hashTypeNormal,
+		DataDevice:     dataDevice,
+		HashDevice:     hashDevice,
+		DataBlockSize:  uint64(p.DataBlockSize), // #nosec G115 -- bounded by validate
+		HashBlockSize:  uint64(p.HashBlockSize), // #nosec G115 -- bounded by validate
+		NumDataBlocks:  p.DataBlocks,
+		HashStartBlock: uint64(g.start), // #nosec G115 -- not negative
+		Algorithm:      p.Algorithm,
+		Digest:         hex.EncodeToString(rootHash),
+		Salt:           salt,
+		Params:         args,
+	}
+
+	// The UUID cryptsetup gives verity mappings
+	dmUUID := "CRYPT-VERITY-" + name
+	if p.UUID != "" {
+		dmUUID = fmt.Sprintf("CRYPT-VERITY-%s-%s", strings.ReplaceAll(p.UUID, "-", ""), name)
+	}
+	if err := devmapper.CreateAndLoad(name, dmUUID, devmapper.ReadOnlyFlag, table); err != nil {
+		return fmt.Errorf("failed to create device-mapper: %w", err)
+	}
+	if _, err := luks2.GetMappedDevicePath(name); err != nil {
+		_ = luks2.Lock(name)
+		return fmt.Errorf("device not ready after open: %w", err)
+	}
+	return nil
+}
+
+// Close removes the mapping created by Open
+func Close(name string) error {
+	return luks2.Lock(name)
+}
+
+// targetArgs returns the optional arguments of the verity target, led by
+// their count as the kernel expects
+func (o *OpenOptions) targetArgs() ([]string, error) {
+	var args []string
+	switch o.OnCorruption {
+	case CorruptionError:
+	case CorruptionIgnore:
+		args = append(args, "ignore_corruption")
+	case CorruptionRestart:
+		args = append(args, "restart_on_corruption")
+	case CorruptionPanic:
+		args = append(args, "panic_on_corruption")
+	default:
+		return nil, fmt.Errorf("unknown corruption mode %q", o.OnCorruption)
+	}
+	if o.IgnoreZeroBlocks {
+		args = append(args, "ignore_zero_blocks")
+	}
+	if o.CheckAtMostOnce {
+		args = append(args, "check_at_most_once")
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return append([]string{fmt.Sprint(len(args))}, args...), nil
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package verity
+
+import (
+	"fmt"
+
+	"github.com/jeremyhahn/go-luks2/pkg/luks2"
+)
+
+// Open is not supported: dm-verity needs Linux
+func Open(name, dataDevice, hashDevice string, rootHash []byte, opts *OpenOptions) error {
+	return fmt.Errorf("open %s: %w", name, luks2.ErrNotSupported)
+}
+
+// Close is not supported: dm-verity needs Linux
+func Close(name string) error {
+	return fmt.Errorf("close %s: %w", name, luks2.ErrNotSupported)
+}
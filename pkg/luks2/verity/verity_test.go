@@ -0,0 +1,308 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package verity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeData writes size random bytes to a new file and returns its path
+func writeData(t *testing.T, size int) string {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "data.img")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// corrupt flips a byte of the file at off
+func corrupt(t *testing.T, path string, off int64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatVerify(t *testing.T) {
+	data := writeData(t, 600*4096+100) // Partial last block is not covered
+	hash := filepath.Join(t.TempDir(), "hash.img")
+
+	tree, err := Format(data, hash, nil)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if tree.DataBlocks != 600 || tree.Algorithm != "sha256" || len(tree.Salt) != DefaultSaltSize || tree.UUID == "" {
+		t.Errorf("Unexpected parameters: %+v", tree.Params)
+	}
+	if len(tree.RootHash) != sha256.Size {
+		t.Errorf("Root hash is %d bytes", len(tree.RootHash))
+	}
+	// Superblock, then 1 block of level 1 and 5 blocks of level 0
+	if tree.HashSize != 7*4096 {
+		t.Errorf("HashSize = %d, want %d", tree.HashSize, 7*4096)
+	}
+	if fi, err := os.Stat(hash); err != nil || fi.Size() != tree.HashSize {
+		t.Errorf("Hash file size = %v, %v", fi, err)
+	}
+
+	if err := Verify(data, hash, tree.RootHash, nil); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	wrong := bytes.Clone(tree.RootHash)
+	wrong[0] ^= 1
+	if err := Verify(data, hash, wrong, nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Verify with wrong root hash = %v, want ErrCorrupted", err)
+	}
+
+	corrupt(t, data, 12345)
+	if err := Verify(data, hash, tree.RootHash, nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Verify of corrupted data = %v, want ErrCorrupted", err)
+	}
+}
+
+func TestFormat_CorruptedHash(t *testing.T) {
+	data := writeData(t, 300*4096)
+	hash := filepath.Join(t.TempDir(), "hash.img")
+	tree, err := Format(data, hash, nil)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	corrupt(t, hash, 3*4096+10) // Level 0
+	if err := Verify(data, hash, tree.RootHash, nil); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Verify of corrupted tree = %v, want ErrCorrupted", err)
+	}
+}
+
+// TestFormat_Layout checks the tree against one built by hand: two data
+// blocks hash into a single level 0 block, whose digest is the root
+func TestFormat_Layout(t *testing.T) {
+	data := writeData(t, 2*512)
+	hash := filepath.Join(t.TempDir(), "hash.img")
+	salt := []byte("salt")
+
+	tree, err := Format(data, hash, &Params{DataBlockSize: 512, HashBlockSize: 512, Salt: salt})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	raw, _ := os.ReadFile(data)
+	digest := func(block []byte) []byte {
+		sum := sha256.Sum256(append(bytes.Clone(salt), block...))
+		return sum[:]
+	}
+	level0 := make([]byte, 512)
+	copy(level0, digest(raw[:512]))
+	copy(level0[32:], digest(raw[512:]))
+
+	stored, _ := os.ReadFile(hash)
+	if len(stored) != 2*512 {
+		t.Fatalf("Hash file is %d bytes, want 1024", len(stored))
+	}
+	if !bytes.Equal(stored[512:], level0) {
+		t.Error("Level 0 block does not match")
+	}
+	if !bytes.Equal(tree.RootHash, digest(level0)) {
+		t.Errorf("Root hash = %x, want %x", tree.RootHash, digest(level0))
+	}
+}
+
+func TestFormat_SingleBlock(t *testing.T) {
+	data := writeData(t, 4096)
+	hash := filepath.Join(t.TempDir(), "hash.img")
+
+	tree, err := Format(data, hash, &Params{Salt: []byte{}})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	raw, _ := os.ReadFile(data)
+	if sum := sha256.Sum256(raw); !bytes.Equal(tree.RootHash, sum[:]) {
+		t.Errorf("Root hash = %x, want the digest of the block", tree.RootHash)
+	}
+	if err := Verify(data, hash, tree.RootHash, nil); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestFormat_SameDevice(t *testing.T) {
+	image := writeData(t, 64*4096)
+
+	if _, err := Format(image, image, &Params{HashOffset: 32 * 4096, DataBlocks: 64}); err == nil {
+		t.Error("Expected error for a tree overlapping the data")
+	}
+
+	tree, err := Format(image, image, &Params{HashOffset: 64 * 4096, DataBlocks: 64})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if err := Verify(image, image, tree.RootHash, &Params{HashOffset: 64 * 4096}); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	if err := Verify(image, image, tree.RootHash, nil); !errors.Is(err, ErrNoSuperblock) {
+		t.Errorf("Verify at offset 0 = %v, want ErrNoSuperblock", err)
+	}
+}
+
+func TestFormat_NoSuperblock(t *testing.T) {
+	data := writeData(t, 200*4096)
+	hash := filepath.Join(t.TempDir(), "hash.img")
+
+	tree, err := Format(data, hash, &Params{NoSuperblock: true, Algorithm: "sha512"})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if tree.UUID != "" {
+		t.Errorf("UUID = %q, want none without a superblock", tree.UUID)
+	}
+	if _, err := ReadSuperblock(hash, 0); !errors.Is(err, ErrNoSuperblock) {
+		t.Errorf("ReadSuperblock = %v, want ErrNoSuperblock", err)
+	}
+	if err := Verify(data, hash, tree.RootHash, &tree.Params); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	p := tree.Params
+	p.DataBlocks = 0
+	if err := Verify(data, hash, tree.RootHash, &p); err == nil {
+		t.Error("Expected error without DataBlocks")
+	}
+}
+
+func TestSuperblock(t *testing.T) {
+	p := &Params{
+		Algorithm:     "sha256",
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataBlocks:    12345,
+		Salt:          []byte{1, 2, 3},
+		UUID:          "6f9619ff-8b86-d011-b42d-00cf4fc964ff",
+	}
+	sb := marshalSuperblock(p)
+	if len(sb) != superblockSize || string(sb[:8]) != superblockMagic {
+		t.Fatalf("Bad superblock: %x", sb[:16])
+	}
+
+	got, err := parseSuperblock(sb)
+	if err != nil {
+		t.Fatalf("parseSuperblock failed: %v", err)
+	}
+	if got.Algorithm != p.Algorithm || got.DataBlocks != p.DataBlocks || got.UUID != p.UUID ||
+		!bytes.Equal(got.Salt, p.Salt) || got.DataBlockSize != 4096 || got.HashBlockSize != 4096 {
+		t.Errorf("Round trip = %+v, want %+v", got, p)
+	}
+
+	bad := bytes.Clone(sb)
+	bad[12] = 0 // Chrome OS hash type
+	if _, err := parseSuperblock(bad); err == nil {
+		t.Error("Expected error for hash type 0")
+	}
+	bad = bytes.Clone(sb)
+	bad[64] = 0x11 // Data block size not a power of two
+	if _, err := parseSuperblock(bad); err == nil {
+		t.Error("Expected error for invalid block size")
+	}
+	if _, err := parseSuperblock(make([]byte, superblockSize)); !errors.Is(err, ErrNoSuperblock) {
+		t.Errorf("parseSuperblock(zeroes) = %v, want ErrNoSuperblock", err)
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      Params
+		levelStart  []int64
+		levelBlocks []int64
+		end         int64
+	}{
+		{"one block", Params{DataBlocks: 1}, []int64{}, []int64{}, 1},
+		{"one level", Params{DataBlocks: 128}, []int64{1}, []int64{1}, 2},
+		{"two levels", Params{DataBlocks: 1000}, []int64{2, 1}, []int64{8, 1}, 10},
+		{"three levels", Params{DataBlocks: 128*128 + 1}, []int64{4, 2, 1}, []int64{129, 2, 1}, 133},
+		{"offset", Params{DataBlocks: 1000, HashOffset: 8192}, []int64{4, 3}, []int64{8, 1}, 12},
+		{"no superblock", Params{DataBlocks: 1000, NoSuperblock: true}, []int64{1, 0}, []int64{8, 1}, 9},
+		{"sha512", Params{DataBlocks: 1000, Algorithm: "sha512"}, []int64{2, 1}, []int64{16, 1}, 18},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.params
+			applyDefaults(&p)
+			g, err := newGeometry(&p)
+			if err != nil {
+				t.Fatalf("newGeometry failed: %v", err)
+			}
+			if !equal(g.levelStart, tt.levelStart) || !equal(g.levelBlocks, tt.levelBlocks) || g.end != tt.end {
+				t.Errorf("levels at %v of %v blocks, end %d; want %v of %v, end %d",
+					g.levelStart, g.levelBlocks, g.end, tt.levelStart, tt.levelBlocks, tt.end)
+			}
+		})
+	}
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFormat_InvalidParams(t *testing.T) {
+	data := writeData(t, 8*4096)
+	hash := filepath.Join(t.TempDir(), "hash.img")
+
+	tests := []struct {
+		name   string
+		params Params
+	}{
+		{"algorithm", Params{Algorithm: "md5"}},
+		{"block size", Params{DataBlockSize: 1000}},
+		{"hash block size", Params{HashBlockSize: 256}},
+		{"salt", Params{Salt: make([]byte, 257)}},
+		{"uuid", Params{UUID: "not-a-uuid"}},
+		{"offset", Params{HashOffset: 100}},
+		{"unaligned without superblock", Params{HashOffset: 512, NoSuperblock: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Format(data, hash, &tt.params); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+
+	small := writeData(t, 100)
+	if _, err := Format(small, hash, nil); err == nil {
+		t.Error("Expected error for a data device smaller than a block")
+	}
+}
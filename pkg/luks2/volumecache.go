@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"container/list"
+	"sync"
+)
+
+// volumeCacheBlock is the unit the Volume cache holds decrypted data in
+const volumeCacheBlock = 64 * 1024
+
+// volumeCache keeps recently read blocks of a Volume in plaintext, least
+// recently used first out. Evicted and invalidated blocks are zeroed, and
+// data is only copied out under the lock, so a block is never wiped while
+// a reader is using it.
+type volumeCache struct {
+	mu        sync.Mutex
+	blocks    map[int64]*list.Element // By block index; values are *cachedBlock
+	lru       *list.List              // Most recently used at the front
+	maxBlocks int64
+	readAhead int64 // Blocks to load past a sequential miss
+	next      int64 // Block following the last load: a miss there is sequential
+}
+
+// cachedBlock is one block of decrypted data
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+// newVolumeCache returns a cache of size bytes, at least one block, that
+// reads readAhead bytes ahead of sequential misses
+func newVolumeCache(size, readAhead int64) *volumeCache {
+	return &volumeCache{
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+		maxBlocks: max(1, size/volumeCacheBlock),
+		readAhead: (readAhead + volumeCacheBlock - 1) / volumeCacheBlock,
+	}
+}
+
+// get copies block index from offset within it into p and reports whether
+// the block was cached
+func (c *volumeCache) get(index int64, p []byte, within int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.blocks[index]
+	if !ok {
+		return 0, false
+	}
+	c.lru.MoveToFront(e)
+	return copy(p, e.Value.(*cachedBlock).data[within:]), true
+}
+
+// loadCount returns how many blocks to load for a miss at index: with
+// read-ahead when the miss continues the previous load, never more than
+// the cache holds
+func (c *volumeCache) loadCount(index int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := int64(1)
+	if index == c.next {
+		count += c.readAhead
+	}
+	count = min(count, c.maxBlocks)
+	c.next = index + count
+	return count
+}
+
+// put caches data, which the cache now owns, as block index
+func (c *volumeCache) put(index int64, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.blocks[index]; ok {
+		c.remove(e)
+	}
+	c.blocks[index] = c.lru.PushFront(&cachedBlock{index: index, data: data})
+	for int64(c.lru.Len()) > c.maxBlocks {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate drops the blocks from first to last, inclusive
+func (c *volumeCache) invalidate(first, last int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for index := first; index <= last; index++ {
+		if e, ok := c.blocks[index]; ok {
+			c.remove(e)
+		}
+	}
+}
+
+// clear zeroes and drops every block
+func (c *volumeCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.lru.Front(); e != nil; e = c.lru.Front() {
+		c.remove(e)
+	}
+}
+
+func (c *volumeCache) remove(e *list.Element) {
+	b := e.Value.(*cachedBlock)
+	clearBytes(b.data)
+	delete(c.blocks, b.index)
+	c.lru.Remove(e)
+}
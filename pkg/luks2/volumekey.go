@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// ExtractVolumeKey unlocks a keyslot with the passphrase and returns the
+// plaintext volume (master) key, equivalent to cryptsetup luksDump
+// --dump-volume-key.
+//
+// WARNING: Anyone holding the volume key can decrypt the volume without any
+// passphrase, and the key survives passphrase changes and keyslot removal.
+// Store it only in an escrow you trust as much as the data itself, and clear
+// the returned slice when finished. A WarnVolumeKeyExposed warning is emitted
+// on every successful call.
+func ExtractVolumeKey(device string, passphrase []byte) ([]byte, error) {
+	if err := ValidateDevicePath(device); err != nil {
+		return nil, err
+	}
+
+	if err := ValidatePassphrase(passphrase); err != nil {
+		return nil, err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := getMasterKey(device, passphrase, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock any keyslot: %w", err)
+	}
+	defer masterKey.Destroy()
+
+	emitWarning(Warning{
+		Code:    WarnVolumeKeyExposed,
+		Op:      "extract-volume-key",
+		Device:  device,
+		Message: fmt.Sprintf("volume key for %s was extracted in plaintext; anyone holding it can decrypt the volume", device),
+	})
+
+	// The caller asked for the key, so hand back an ordinary copy
+	return append([]byte(nil), masterKey.Bytes()...), nil
+}
+
+// VerifyVolumeKey checks a volume key against the header digest without
+// activating the volume
+func VerifyVolumeKey(device string, volumeKey []byte) error {
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+
+	_, metadata, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+
+	return verifyVolumeKey(volumeKey, metadata)
+}
+
+// verifyVolumeKey checks the key length against the keyslots and the key
+// material against the stored digests
+func verifyVolumeKey(volumeKey []byte, metadata *LUKS2Metadata) error {
+	if err := checkNotRotating(metadata); err != nil {
+		return err
+	}
+
+	if len(volumeKey) == 0 {
+		return fmt.Errorf("%w: volume key is empty", ErrInvalidVolumeKey)
+	}
+
+	// All keyslots of a volume wrap the same key, so any one gives the size
+	for _, keyslot := range metadata.Keyslots {
+		if keyslot.Type != "luks2" {
+			continue
+		}
+		if keyslot.KeySize != len(volumeKey) {
+			return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidVolumeKey, keyslot.KeySize, len(volumeKey))
+		}
+		break
+	}
+
+	if err := verifyMasterKey(volumeKey, metadata.Digests); err != nil {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidVolumeKey)
+	}
+
+	return nil
+}
+
+// UnlockWithVolumeKey opens a LUKS2 volume using the volume key directly,
+// bypassing all keyslots, equivalent to cryptsetup open --volume-key-file.
+// This is intended for recovery when every keyslot passphrase has been lost
+// but the volume key was escrowed with ExtractVolumeKey. The key is verified
+// against the header digest before any device-mapper mapping is created.
+// Like the passphrase unlocks it emits an unlock event, with Op
+// "unlock-volume-key" and no keyslot.
+func UnlockWithVolumeKey(device string, volumeKey []byte, name string) (err error) {
+	start := time.Now()
+	defer func() {
+		observeUnlock(start, err)
+		event := Event{Type: EventUnlockSucceeded, Op: "unlock-volume-key", Device: device, Name: name}
+		if err != nil {
+			event.Type = EventUnlockFailed
+			event.Error = err.Error()
+		}
+		emitEvent(event)
+	}()
+
+	if err := ValidateDevicePath(device); err != nil {
+		return err
+	}
+
+	realDevice, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		realDevice = device
+	}
+
+	if IsUnlocked(name) {
+		return fmt.Errorf("device mapper '%s' already exists - close it first with: luks close %s", name, name)
+	}
+
+	hdr, metadata, err := readHeader(device)
+	if err != nil {
+		return err
+	}
+
+	if err := checkKernelCiphers(metadata); err != nil {
+		return err
+	}
+
+	if err := verifyVolumeKey(volumeKey, metadata); err != nil {
+		return err
+	}
+
+	return activateVolume(device, realDevice, hdr, metadata, volumeKey, name, cryptFlags(metadata, nil))
+}
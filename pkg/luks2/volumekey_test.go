@@ -0,0 +1,161 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// formatTestVolume formats a small file-backed LUKS2 volume with a fast KDF
+func formatTestVolume(t *testing.T, passphrase []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "volume.luks")
+	f, err := os.Create(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := f.Truncate(20 * 1024 * 1024); err != nil {
+		_ = f.Close()
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	_ = f.Close()
+
+	if err := Format(FormatOptions{
+		Device:        path,
+		Passphrase:    passphrase,
+		KDFType:       "pbkdf2",
+		PBKDFIterTime: 10,
+	}); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	return path
+}
+
+// TestExtractVolumeKey tests extracting and verifying the volume key
+func TestExtractVolumeKey(t *testing.T) {
+	passphrase := []byte("test-password")
+	device := formatTestVolume(t, passphrase)
+	got := captureWarnings(t, 0)
+
+	key, err := ExtractVolumeKey(device, passphrase)
+	if err != nil {
+		t.Fatalf("ExtractVolumeKey failed: %v", err)
+	}
+	defer clearBytes(key)
+
+	if len(key) != DefaultKeySize/8 {
+		t.Errorf("Expected %d-byte key, got %d", DefaultKeySize/8, len(key))
+	}
+
+	if len(*got) != 1 || (*got)[0].Code != WarnVolumeKeyExposed {
+		t.Errorf("Expected a %s warning, got %+v", WarnVolumeKeyExposed, *got)
+	}
+
+	if err := VerifyVolumeKey(device, key); err != nil {
+		t.Errorf("VerifyVolumeKey rejected extracted key: %v", err)
+	}
+}
+
+// TestExtractVolumeKey_WrongPassphrase tests that a wrong passphrase yields no key
+func TestExtractVolumeKey_WrongPassphrase(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+	got := captureWarnings(t, 0)
+
+	key, err := ExtractVolumeKey(device, []byte("wrong-password"))
+	if !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if key != nil {
+		t.Error("Expected nil key on failure")
+	}
+	if len(*got) != 0 {
+		t.Errorf("Expected no warnings on failure, got %d", len(*got))
+	}
+}
+
+// TestExtractVolumeKey_InsufficientMemory tests that a keyslot skipped for
+// memory is reported as such rather than as a wrong passphrase
+func TestExtractVolumeKey_InsufficientMemory(t *testing.T) {
+	passphrase := []byte("test-password")
+	argonPass := []byte("argon2-password")
+	device := formatTestVolume(t, passphrase)
+
+	if err := AddKey(device, passphrase, argonPass, &AddKeyOptions{
+		KDFType:        "argon2id",
+		Argon2Time:     1,
+		Argon2Memory:   8192,
+		Argon2Parallel: 1,
+	}); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+
+	SetKDFMemoryLimit(4 * 1024 * 1024)
+	t.Cleanup(func() { SetKDFMemoryLimit(0) })
+
+	_, err := ExtractVolumeKey(device, argonPass)
+	if !errors.Is(err, ErrInsufficientMemory) {
+		t.Errorf("Expected ErrInsufficientMemory, got %v", err)
+	}
+	if errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected no ErrInvalidPassphrase, got %v", err)
+	}
+}
+
+// TestExtractVolumeKey_InvalidInput tests argument validation
+func TestExtractVolumeKey_InvalidInput(t *testing.T) {
+	if _, err := ExtractVolumeKey("relative/path", []byte("pass")); err == nil {
+		t.Error("Expected error for relative path")
+	}
+	if _, err := ExtractVolumeKey("/nonexistent/device", nil); err == nil {
+		t.Error("Expected error for empty passphrase")
+	}
+}
+
+// TestVerifyVolumeKey_Invalid tests rejection of wrong volume keys
+func TestVerifyVolumeKey_Invalid(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"empty", nil},
+		{"wrong length", make([]byte, 32)},
+		{"wrong key", make([]byte, DefaultKeySize/8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyVolumeKey(device, tt.key)
+			if !errors.Is(err, ErrInvalidVolumeKey) {
+				t.Errorf("Expected ErrInvalidVolumeKey, got %v", err)
+			}
+		})
+	}
+}
+
+// TestUnlockWithVolumeKey_InvalidKey tests that a wrong key is rejected before activation
+func TestUnlockWithVolumeKey_InvalidKey(t *testing.T) {
+	device := formatTestVolume(t, []byte("test-password"))
+
+	err := UnlockWithVolumeKey(device, make([]byte, DefaultKeySize/8), "test-volume-key-invalid")
+	if !errors.Is(err, ErrInvalidVolumeKey) {
+		t.Errorf("Expected ErrInvalidVolumeKey, got %v", err)
+	}
+}
+
+// TestUnlockWithVolumeKey_InvalidPath tests device path validation
+func TestUnlockWithVolumeKey_InvalidPath(t *testing.T) {
+	if err := UnlockWithVolumeKey("relative/path", make([]byte, 64), "test"); err == nil {
+		t.Error("Expected error for relative path")
+	}
+}
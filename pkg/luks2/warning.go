@@ -0,0 +1,129 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"sync"
+	"time"
+)
+
+// WarningCode identifies the kind of condition a Warning reports
+type WarningCode string
+
+const (
+	// WarnNetworkDevice is emitted when an operation runs against a device
+	// whose backing storage is reached over the network (iSCSI, NBD, RBD, NFS)
+	WarnNetworkDevice WarningCode = "network-device"
+
+	// WarnNetworkKDF is emitted when KDF parameters are calibrated for a
+	// network-backed device. Calibration only measures CPU/memory cost, so
+	// unlock time will additionally include network round-trips.
+	WarnNetworkKDF WarningCode = "network-kdf"
+
+	// WarnVolumeKeyExposed is emitted whenever the volume key leaves the
+	// library in plaintext (e.g. ExtractVolumeKey)
+	WarnVolumeKeyExposed WarningCode = "volume-key-exposed"
+
+	// WarnHeaderRecovered is emitted when the primary header is damaged or
+	// stale and the secondary copy was used instead
+	WarnHeaderRecovered WarningCode = "header-recovered"
+
+	// WarnAuditFailed is emitted when the registered EventSink fails to
+	// record an audit event
+	WarnAuditFailed WarningCode = "audit-failed"
+
+	// WarnReadRetried is emitted when a header or keyslot read succeeded
+	// only after retrying a transient I/O error (see ReadRetry)
+	WarnReadRetried WarningCode = "read-retried"
+
+	// WarnCryptoBackend is emitted when the AF_ALG crypto backend cannot
+	// serve an operation and Go's implementation is used instead
+	WarnCryptoBackend WarningCode = "crypto-backend"
+
+	// WarnIOEngine is emitted when the io_uring I/O engine was asked for
+	// but is unavailable and writes fall back to pwrite
+	WarnIOEngine WarningCode = "io-engine"
+
+	// WarnExistingSignatures is emitted when Format with Force overwrites a
+	// device holding signatures (see ProbeSignatures)
+	WarnExistingSignatures WarningCode = "existing-signatures"
+
+	// WarnWeakKDF is emitted when a volume is unlocked through a keyslot
+	// whose KDF costs fall below the registered KDFPolicy
+	WarnWeakKDF WarningCode = "weak-kdf"
+)
+
+// DefaultWarningInterval is the minimum interval between two warnings with
+// the same code for the same device
+const DefaultWarningInterval = time.Minute
+
+// Warning is a structured, non-fatal diagnostic emitted by library operations.
+// The library never prints warnings itself; register a WarningHandler to
+// receive them.
+type Warning struct {
+	Code    WarningCode
+	Op      string // Operation that raised the warning (e.g. "wipe", "format")
+	Device  string // Device the warning applies to
+	Message string
+	Time    time.Time
+}
+
+// WarningHandler receives warnings emitted by library operations
+type WarningHandler func(Warning)
+
+// warningState holds the registered handler and rate-limiting bookkeeping
+var warningState = struct {
+	mu       sync.Mutex
+	handler  WarningHandler
+	interval time.Duration
+	last     map[string]time.Time
+}{
+	interval: DefaultWarningInterval,
+	last:     make(map[string]time.Time),
+}
+
+// SetWarningHandler registers the handler that receives library warnings.
+// Passing nil disables warning delivery (the default).
+func SetWarningHandler(h WarningHandler) {
+	warningState.mu.Lock()
+	defer warningState.mu.Unlock()
+	warningState.handler = h
+}
+
+// SetWarningInterval sets the minimum interval between repeated warnings with
+// the same code for the same device. Zero or negative disables rate limiting.
+func SetWarningInterval(d time.Duration) {
+	warningState.mu.Lock()
+	defer warningState.mu.Unlock()
+	warningState.interval = d
+	warningState.last = make(map[string]time.Time)
+}
+
+// emitWarning delivers a warning to the registered handler, dropping it if an
+// identical (code, device) warning was delivered within the warning interval
+func emitWarning(w Warning) {
+	if w.Time.IsZero() {
+		w.Time = time.Now()
+	}
+
+	warningState.mu.Lock()
+	handler := warningState.handler
+	if handler == nil {
+		warningState.mu.Unlock()
+		return
+	}
+	key := string(w.Code) + "\x00" + w.Device
+	if warningState.interval > 0 {
+		if last, ok := warningState.last[key]; ok && w.Time.Sub(last) < warningState.interval {
+			warningState.mu.Unlock()
+			return
+		}
+		warningState.last[key] = w.Time
+	}
+	warningState.mu.Unlock()
+
+	// Call the handler outside the lock so it may safely call back into the package
+	handler(w)
+}
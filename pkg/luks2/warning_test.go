@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !integration
+
+package luks2
+
+import (
+	"testing"
+	"time"
+)
+
+// captureWarnings installs a recording warning handler for the duration of a test
+func captureWarnings(t *testing.T, interval time.Duration) *[]Warning {
+	t.Helper()
+	var got []Warning
+	SetWarningInterval(interval)
+	SetWarningHandler(func(w Warning) { got = append(got, w) })
+	t.Cleanup(func() {
+		SetWarningHandler(nil)
+		SetWarningInterval(DefaultWarningInterval)
+	})
+	return &got
+}
+
+// TestEmitWarning_NoHandler tests that warnings are dropped without a handler
+func TestEmitWarning_NoHandler(t *testing.T) {
+	SetWarningHandler(nil)
+	// Must not panic
+	emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd0"})
+}
+
+// TestEmitWarning_Delivered tests that warnings reach the handler with a timestamp
+func TestEmitWarning_Delivered(t *testing.T) {
+	got := captureWarnings(t, time.Minute)
+
+	emitWarning(Warning{Code: WarnNetworkDevice, Op: "wipe", Device: "/dev/nbd0", Message: "slow"})
+
+	if len(*got) != 1 {
+		t.Fatalf("Expected 1 warning, got %d", len(*got))
+	}
+	w := (*got)[0]
+	if w.Code != WarnNetworkDevice || w.Op != "wipe" || w.Device != "/dev/nbd0" {
+		t.Errorf("Unexpected warning: %+v", w)
+	}
+	if w.Time.IsZero() {
+		t.Error("Expected warning time to be set")
+	}
+}
+
+// TestEmitWarning_RateLimited tests that repeated warnings are suppressed within the interval
+func TestEmitWarning_RateLimited(t *testing.T) {
+	got := captureWarnings(t, time.Minute)
+	now := time.Now()
+
+	emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd0", Time: now})
+	emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd0", Time: now.Add(time.Second)})
+	if len(*got) != 1 {
+		t.Fatalf("Expected duplicate warning to be suppressed, got %d", len(*got))
+	}
+
+	// Different device and different code are tracked independently
+	emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd1", Time: now})
+	emitWarning(Warning{Code: WarnNetworkKDF, Device: "/dev/nbd0", Time: now})
+	if len(*got) != 3 {
+		t.Fatalf("Expected 3 warnings, got %d", len(*got))
+	}
+
+	// Same warning after the interval is delivered again
+	emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd0", Time: now.Add(2 * time.Minute)})
+	if len(*got) != 4 {
+		t.Fatalf("Expected warning after interval, got %d", len(*got))
+	}
+}
+
+// TestEmitWarning_RateLimitDisabled tests that a zero interval disables rate limiting
+func TestEmitWarning_RateLimitDisabled(t *testing.T) {
+	got := captureWarnings(t, 0)
+
+	for i := 0; i < 3; i++ {
+		emitWarning(Warning{Code: WarnNetworkDevice, Device: "/dev/nbd0"})
+	}
+	if len(*got) != 3 {
+		t.Errorf("Expected 3 warnings with rate limiting disabled, got %d", len(*got))
+	}
+}
@@ -2,12 +2,17 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build linux
+
 package luks2
 
 import (
 	"crypto/rand"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -16,13 +21,58 @@ import (
 // BLKDISCARD ioctl number for TRIM/discard on block devices
 const BLKDISCARD = 0x1277
 
+// BLKSECDISCARD ioctl number for secure discard, which also erases any copies
+// of the discarded blocks the device keeps internally (e.g. eMMC, some NVMe)
+const BLKSECDISCARD = 0x127d
+
+// DefaultWipeWorkers is the number of concurrent writers used per wipe pass
+const DefaultWipeWorkers = 4
+
+// MaxWipeBufferSize is the largest per-writer buffer a wipe accepts
+const MaxWipeBufferSize = 256 * 1024 * 1024 // 256MB
+
+// wipeProgressInterval is the minimum interval between two progress reports
+const wipeProgressInterval = 500 * time.Millisecond
+
 // WipeOptions contains options for wiping a LUKS volume
 type WipeOptions struct {
 	Device     string
 	Passes     int  // Number of wipe passes (default: 1)
 	Random     bool // Use random data (default: zeros)
 	HeaderOnly bool // Only wipe headers (default: false, wipes all data)
-	Trim       bool // Issue TRIM/DISCARD after wipe (for SSDs)
+	Trim       bool // Issue TRIM/DISCARD after wipe (for SSDs); secure discard is used when supported
+	Workers    int  // Concurrent writers per pass over disjoint ranges (default: DefaultWipeWorkers)
+	BufferSize int  // Bytes per write and per writer (default: DefaultWipeBufferSize, NetworkWipeBufferSize on network devices)
+	Direct     bool // Write with O_DIRECT, bypassing the page cache (BufferSize must be a multiple of 4096)
+
+	// IOEngine selects how a full wipe writes. With IOEngineURing one
+	// goroutine keeps QueueDepth writes of BufferSize in flight
+	// (0 = DefaultQueueDepth) and Workers is ignored; zeros are written from
+	// a single shared buffer, random data from one buffer per write.
+	IOEngine   IOEngine
+	QueueDepth int
+
+	// CryptoErase destroys both header copies and every keyslot area, leaving
+	// the encrypted data in place. Without a keyslot the volume key cannot
+	// be recovered, so the data is irrecoverable as soon as the call returns
+	// unless the volume key or a header backup was kept elsewhere. Unlike
+	// HeaderOnly, which only zeroes the headers, the keyslot areas holding
+	// the wrapped volume key are overwritten with random data too.
+	CryptoErase bool
+
+	// Progress, if set, is called periodically during a full wipe and once
+	// at the end of every pass. Calls are serialized.
+	Progress func(WipeProgress)
+}
+
+// WipeProgress reports how far a full-device wipe has got
+type WipeProgress struct {
+	Pass           int           // Current pass, starting at 1
+	Passes         int           // Total number of passes
+	Written        int64         // Bytes written in the current pass
+	Total          int64         // Bytes written by each pass
+	Elapsed        time.Duration // Time since the wipe started
+	BytesPerSecond float64       // Average throughput across all passes so far
 }
 
 // Wipe securely wipes a LUKS volume
@@ -36,6 +86,21 @@ func Wipe(opts WipeOptions) error {
 	if opts.Passes <= 0 {
 		return fmt.Errorf("invalid number of passes: %d (must be >= 1)", opts.Passes)
 	}
+	if opts.Workers < 0 {
+		return fmt.Errorf("invalid number of workers: %d (must be >= 0)", opts.Workers)
+	}
+	if opts.BufferSize < 0 || opts.BufferSize > MaxWipeBufferSize {
+		return fmt.Errorf("invalid buffer size: %d (must be between 0 and %d)", opts.BufferSize, MaxWipeBufferSize)
+	}
+	if opts.Direct && opts.BufferSize%directIOAlignment != 0 {
+		return fmt.Errorf("invalid buffer size: %d (O_DIRECT requires a multiple of %d)", opts.BufferSize, directIOAlignment)
+	}
+	if opts.CryptoErase && opts.HeaderOnly {
+		return fmt.Errorf("CryptoErase and HeaderOnly are mutually exclusive")
+	}
+	if opts.QueueDepth < 0 || opts.QueueDepth > maxQueueDepth {
+		return fmt.Errorf("invalid queue depth: %d (must be between 0 and %d)", opts.QueueDepth, maxQueueDepth)
+	}
 
 	// Acquire file lock for exclusive access
 	lock, err := AcquireFileLock(opts.Device)
@@ -51,7 +116,53 @@ func Wipe(opts WipeOptions) error {
 	defer func() { _ = f.Close() }()
 
 	if opts.HeaderOnly {
-		return wipeHeaders(f)
+		if err := wipeHeaders(f); err != nil {
+			return err
+		}
+		emitEvent(Event{Type: EventWipeCompleted, Op: "wipe-headers", Device: opts.Device})
+		return nil
+	}
+
+	if opts.CryptoErase {
+		end, err := cryptoErase(f)
+		if err != nil {
+			return err
+		}
+		emitEvent(Event{Type: EventWipeCompleted, Op: "crypto-erase", Device: opts.Device})
+
+		if opts.Trim {
+			// Best effort, as for a full wipe
+			_ = discardRange(f, 0, end)
+		}
+		return nil
+	}
+
+	cfg := wipeConfig{
+		random:     opts.Random,
+		bufferSize: opts.BufferSize,
+		workers:    opts.Workers,
+	}
+	if cfg.workers == 0 {
+		cfg.workers = DefaultWipeWorkers
+	}
+	if cfg.bufferSize == 0 {
+		// Network-backed devices pay a round-trip per write; batch larger writes
+		cfg.bufferSize = DefaultWipeBufferSize
+		if desc := describeForWrite(opts.Device, "wipe"); desc.Network {
+			cfg.bufferSize = NetworkWipeBufferSize
+		}
+	}
+
+	if cfg.queueDepth, err = queueDepth(opts.IOEngine, opts.QueueDepth, "wipe", opts.Device); err != nil {
+		return err
+	}
+
+	if opts.Direct {
+		cfg.direct, err = os.OpenFile(opts.Device, os.O_RDWR|unix.O_DIRECT, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open device with O_DIRECT: %w", err)
+		}
+		defer func() { _ = cfg.direct.Close() }()
 	}
 
 	// Get device size (handles both block devices and regular files)
@@ -65,16 +176,26 @@ func Wipe(opts WipeOptions) error {
 	}
 
 	// Wipe in passes
+	start := time.Now()
+	reporter := &wipeReporter{fn: opts.Progress, start: start, passes: opts.Passes, total: size}
 	for pass := 0; pass < opts.Passes; pass++ {
-		if err := wipePass(f, size, opts.Random); err != nil {
+		if err := wipePassParallel(f, size, cfg, reporter.pass(pass+1)); err != nil {
 			return fmt.Errorf("wipe pass %d failed: %w", pass+1, err)
 		}
+		reporter.report(pass+1, size, true)
 	}
 
 	// Sync to ensure writes are flushed
+	if cfg.direct != nil {
+		if err := cfg.direct.Sync(); err != nil {
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+	}
 	if err := f.Sync(); err != nil {
 		return fmt.Errorf("failed to sync: %w", err)
 	}
+	observeWipe(size*int64(opts.Passes), start)
+	emitEvent(Event{Type: EventWipeCompleted, Op: "wipe", Device: opts.Device})
 
 	// Issue TRIM/DISCARD if requested (for SSDs)
 	if opts.Trim {
@@ -88,9 +209,116 @@ func Wipe(opts WipeOptions) error {
 	return nil
 }
 
+// wipeReporter throttles and serializes progress callbacks from the
+// concurrent writers of a wipe
+type wipeReporter struct {
+	mu      sync.Mutex
+	fn      func(WipeProgress)
+	start   time.Time
+	last    time.Time
+	passes  int
+	total   int64
+	written int64
+}
+
+// pass returns the per-write callback for one pass, or nil when no
+// progress callback is registered
+func (r *wipeReporter) pass(pass int) func(int64) {
+	if r.fn == nil {
+		return nil
+	}
+	r.mu.Lock()
+	r.written = 0
+	r.mu.Unlock()
+	return func(written int64) { r.report(pass, written, false) }
+}
+
+// report delivers a progress update unless one was sent too recently.
+// Final updates are always delivered.
+func (r *wipeReporter) report(pass int, written int64, final bool) {
+	if r.fn == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Writers finish out of order; never report going backwards
+	r.written = max(r.written, written)
+	now := time.Now()
+	if !final && now.Sub(r.last) < wipeProgressInterval {
+		return
+	}
+	r.last = now
+
+	elapsed := now.Sub(r.start)
+	progress := WipeProgress{
+		Pass:    pass,
+		Passes:  r.passes,
+		Written: r.written,
+		Total:   r.total,
+		Elapsed: elapsed,
+	}
+	if elapsed > 0 {
+		done := int64(pass-1)*r.total + r.written
+		progress.BytesPerSecond = float64(done) / elapsed.Seconds()
+	}
+	r.fn(progress)
+}
+
+// cryptoErase overwrites every keyslot area with random data and then zeroes
+// both header copies. It returns the end of the erased region. The keyslots
+// go first so an interrupted erase never leaves key material behind headers
+// that could still be repaired from the other copy.
+func cryptoErase(f *os.File) (int64, error) {
+	_, metadata, err := checkHeaderCopies(&sectorReader{r: f, device: f.Name()}, false).active()
+	if err != nil {
+		return 0, fmt.Errorf("%w: no valid header copy to locate keyslot areas: %w", ErrInvalidHeader, err)
+	}
+
+	// The whole keyslots area, so stale areas of removed keyslots go too
+	start, end := keyslotsAreaBounds(metadata)
+	for _, ks := range metadata.Keyslots {
+		if ks == nil || ks.Area == nil {
+			continue
+		}
+		offset, err := parseSize(ks.Area.Offset)
+		if err != nil {
+			return 0, fmt.Errorf("invalid keyslot offset: %w", err)
+		}
+		size, err := parseSize(ks.Area.Size)
+		if err != nil {
+			return 0, fmt.Errorf("invalid keyslot size: %w", err)
+		}
+		start, end = min(start, offset), max(end, offset+size)
+	}
+
+	if end > start {
+		cfg := wipeConfig{random: true, bufferSize: DefaultWipeBufferSize, workers: 1}
+		if err := wipeRange(f, start, end-start, cfg); err != nil {
+			return 0, fmt.Errorf("failed to erase keyslot areas: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+
+	if err := wipeHeaders(f); err != nil {
+		return 0, err
+	}
+
+	return end, nil
+}
+
 // wipeHeaders wipes only the LUKS headers (primary and backup)
 func wipeHeaders(f *os.File) error {
-	headerSize := int64(0x8000) // 32KB (covers both headers)
+	// Both copies, sized from whichever header is still readable
+	headerSize := int64(2 * LUKS2HeaderMinSize)
+	status := checkHeaderCopies(&sectorReader{r: f, device: f.Name()}, false)
+	if status.primaryHdr != nil {
+		headerSize = 2 * int64(status.primaryHdr.HeaderSize) // #nosec G115 - header size validated on read
+	} else if status.SecondaryOffset > 0 {
+		headerSize = 2 * status.SecondaryOffset
+	}
 
 	zeros := make([]byte, headerSize)
 
@@ -105,54 +333,221 @@ func wipeHeaders(f *os.File) error {
 	return f.Sync()
 }
 
+// wipeConfig controls how a single wipe pass writes the device
+type wipeConfig struct {
+	random     bool
+	bufferSize int
+	workers    int
+	direct     *os.File // O_DIRECT handle for the aligned bulk of the device, or nil
+	queueDepth int      // Writes in flight on an io_uring, or 0 for pwrite workers
+}
+
 // wipePass performs one wipe pass over the device
 func wipePass(f *os.File, size int64, random bool) error {
-	const bufferSize = 1024 * 1024 // 1MB buffer
+	return wipePassBuffered(f, size, random, DefaultWipeBufferSize)
+}
+
+// wipePassBuffered performs one wipe pass over the device using writes of bufferSize bytes
+func wipePassBuffered(f *os.File, size int64, random bool, bufferSize int) error {
+	return wipePassParallel(f, size, wipeConfig{random: random, bufferSize: bufferSize, workers: 1}, nil)
+}
+
+// wipePassParallel performs one wipe pass over the first size bytes of the
+// device. progress, if not nil, receives the running byte count after every
+// write.
+func wipePassParallel(f *os.File, size int64, cfg wipeConfig, progress func(int64)) error {
+	return wipeSpan(f, 0, size, cfg, progress)
+}
+
+// wipeRange overwrites size bytes starting at offset
+func wipeRange(f *os.File, offset, size int64, cfg wipeConfig) error {
+	return wipeSpan(f, offset, size, cfg, nil)
+}
+
+// wipeSpan overwrites size bytes starting at base in bufferSize-sized
+// chunks, with cfg.workers concurrent pwrite writers over disjoint ranges or
+// on an io_uring when cfg.queueDepth is set.
+func wipeSpan(f *os.File, base, size int64, cfg wipeConfig, progress func(int64)) error {
+	if cfg.bufferSize <= 0 {
+		return fmt.Errorf("invalid buffer size: %d (must be > 0)", cfg.bufferSize)
+	}
 
 	// Validate size to prevent issues with negative values
 	if size < 0 {
 		return fmt.Errorf("invalid size: %d (must be >= 0)", size)
 	}
 
-	buffer := make([]byte, bufferSize)
-	// Ensure buffer is cleared when function exits (defense in depth)
-	defer clearBytes(buffer)
+	// O_DIRECT covers the aligned part of the device; any unaligned tail
+	// goes through the page cache afterwards
+	out, bulk := f, size
+	if cfg.direct != nil {
+		if cfg.bufferSize%directIOAlignment != 0 || base%directIOAlignment != 0 {
+			return fmt.Errorf("invalid buffer size or offset: %d at %d (O_DIRECT requires multiples of %d)", cfg.bufferSize, base, directIOAlignment)
+		}
+		out, bulk = cfg.direct, size-size%directIOAlignment
+	}
 
-	if _, err := f.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek: %w", err)
+	var written atomic.Int64
+	wipe := wipeWorkers
+	if cfg.queueDepth > 0 {
+		wipe = wipeURing
+	}
+	if err := wipe(out, base, bulk, cfg, &written, progress); err != nil {
+		return err
 	}
 
-	remaining := size
-	for remaining > 0 {
-		writeSize := bufferSize
-		if remaining < int64(bufferSize) {
-			writeSize = int(remaining)
+	if tail := size - bulk; tail > 0 {
+		buffer := make([]byte, tail)
+		defer clearBytes(buffer)
+		if err := writeWipeChunk(f, buffer, base+bulk, cfg.random); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(written.Add(tail))
 		}
+	}
 
-		// Fill buffer
-		if random {
-			if _, err := rand.Read(buffer[:writeSize]); err != nil {
-				return fmt.Errorf("failed to generate random data: %w", err)
+	return nil
+}
+
+// wipeWorkers overwrites size bytes of out at base with cfg.workers
+// goroutines, each claiming the next chunk and writing it with pwrite
+func wipeWorkers(out *os.File, base, size int64, cfg wipeConfig, written *atomic.Int64, progress func(int64)) error {
+	bufferSize := int64(cfg.bufferSize)
+	chunks := (size + bufferSize - 1) / bufferSize
+	workers := int(min(int64(max(cfg.workers, 1)), max(chunks, 1)))
+
+	var (
+		next     atomic.Int64
+		failed   atomic.Bool
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		failed.Store(true)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buffer := newWipeBuffer(cfg.bufferSize, cfg.direct != nil)
+			// Ensure buffer is cleared when the writer exits (defense in depth)
+			defer clearBytes(buffer)
+
+			for !failed.Load() {
+				chunk := next.Add(1) - 1
+				if chunk >= chunks {
+					return
+				}
+				offset := chunk * bufferSize
+				n := min(bufferSize, size-offset)
+
+				if err := writeWipeChunk(out, buffer[:n], base+offset, cfg.random); err != nil {
+					fail(err)
+					return
+				}
+
+				total := written.Add(n)
+				if progress != nil {
+					progress(total)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// wipeURing overwrites size bytes of out at base from one goroutine with
+// cfg.queueDepth writes in flight on an io_uring. Zeros come from one
+// shared buffer; random data needs a buffer per write in flight.
+func wipeURing(out *os.File, base, size int64, cfg wipeConfig, written *atomic.Int64, progress func(int64)) error {
+	var free [][]byte
+	allocated := 0
+	w, err := newURingWriter(out, cfg.queueDepth, func(buf []byte) {
+		total := written.Add(int64(len(buf)))
+		if progress != nil {
+			progress(total)
+		}
+		if cfg.random {
+			free = append(free, buf[:cap(buf)])
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var zeros []byte
+	if !cfg.random {
+		zeros = newWipeBuffer(cfg.bufferSize, cfg.direct != nil)
+	}
+	bufferSize := int64(cfg.bufferSize)
+	for offset := int64(0); offset < size; offset += bufferSize {
+		n := min(bufferSize, size-offset)
+		buffer := zeros
+		if cfg.random {
+			if len(free) == 0 && allocated < cfg.queueDepth {
+				free = append(free, newWipeBuffer(cfg.bufferSize, cfg.direct != nil))
+				allocated++
 			}
-		} else {
-			// Zeros - clear the portion we're using
-			for i := 0; i < writeSize; i++ {
-				buffer[i] = 0
+			// Every buffer is in flight: wait for one to come back
+			for len(free) == 0 && err == nil {
+				err = w.waitOne()
+			}
+			if err != nil {
+				break
+			}
+			buffer, free = free[len(free)-1], free[:len(free)-1]
+			if _, err = rand.Read(buffer[:n]); err != nil {
+				err = fmt.Errorf("failed to generate random data: %w", err)
+				break
 			}
 		}
+		if err = w.write(buffer[:n], base+offset); err != nil {
+			break
+		}
+	}
 
-		// Write buffer
-		n, err := f.Write(buffer[:writeSize])
-		if err != nil {
-			return fmt.Errorf("write error: %w", err)
+	if cerr := w.close(); err == nil {
+		err = cerr
+	}
+	for _, buffer := range free {
+		clearBytes(buffer)
+	}
+	return err
+}
+
+// writeWipeChunk fills buffer with the wipe pattern and writes it at offset.
+// Zero buffers are never filled with anything else, so only random data
+// needs refreshing.
+func writeWipeChunk(f *os.File, buffer []byte, offset int64, random bool) error {
+	if random {
+		if _, err := rand.Read(buffer); err != nil {
+			return fmt.Errorf("failed to generate random data: %w", err)
 		}
+	}
 
-		remaining -= int64(n)
+	if _, err := f.WriteAt(buffer, offset); err != nil {
+		return fmt.Errorf("write error at offset %d: %w", offset, err)
 	}
 
 	return nil
 }
 
+// newWipeBuffer allocates a zeroed write buffer, aligned in memory for
+// O_DIRECT when direct is set
+func newWipeBuffer(size int, direct bool) []byte {
+	if !direct {
+		return make([]byte, size)
+	}
+
+	return alignedBuffer(size, directIOAlignment)
+}
+
 // WipeKeyslot wipes a specific keyslot
 func WipeKeyslot(device string, keyslot int) error {
 	// Validate device path
@@ -168,7 +563,7 @@ func WipeKeyslot(device string, keyslot int) error {
 	defer func() { _ = lock.Release() }()
 
 	// Read metadata
-	_, metadata, err := ReadHeader(device)
+	_, metadata, err := readHeader(device)
 	if err != nil {
 		return err
 	}
@@ -198,14 +593,8 @@ func WipeKeyslot(device string, keyslot int) error {
 	}
 	defer func() { _ = f.Close() }()
 
-	// Seek to keyslot area
-	if _, err := f.Seek(offset, 0); err != nil {
-		return fmt.Errorf("failed to seek: %w", err)
-	}
-
 	// Wipe keyslot area
-	zeros := make([]byte, size)
-	if _, err := f.Write(zeros); err != nil {
+	if err := writeKeyslotArea(f, offset, nil, size); err != nil {
 		return fmt.Errorf("failed to wipe keyslot: %w", err)
 	}
 
@@ -213,41 +602,69 @@ func WipeKeyslot(device string, keyslot int) error {
 	delete(metadata.Keyslots, keyslotID)
 
 	// Re-read header for writing
-	hdr, _, err := ReadHeader(device)
+	hdr, _, err := readHeader(device)
 	if err != nil {
 		return err
 	}
 
 	// Write updated metadata (use internal version since we hold the lock)
-	return writeHeaderInternal(device, hdr, metadata)
+	if err := writeHeaderInternal(device, hdr, metadata); err != nil {
+		return err
+	}
+
+	emitEvent(Event{Type: EventKeyslotRemoved, Op: "wipe-keyslot", Device: device, Keyslot: &keyslot})
+	return nil
 }
 
-// issueDiscard issues a BLKDISCARD ioctl to inform the SSD to release blocks.
+// issueDiscard informs the device that its blocks are no longer in use,
+// using BLKSECDISCARD when the device supports it and BLKDISCARD otherwise.
 // This is a best-effort operation - failure is not fatal as the device may not support TRIM.
 //
 // Security note: TRIM on encrypted volumes can leak information about which blocks
 // are in use vs. free space. However, when used as part of a secure wipe operation
 // (after overwriting data), TRIM provides an additional layer of erasure for SSDs.
 func issueDiscard(f *os.File, size int64) error {
+	return discardRange(f, 0, size)
+}
+
+// discardRange discards length bytes starting at offset. Secure discard is
+// tried first; devices without it reject the ioctl (EOPNOTSUPP) and get a
+// plain discard instead.
+func discardRange(f *os.File, offset, length int64) error {
 	// Validate size to prevent integer overflow when converting to uint64
 	// A negative size would wrap to a very large value, potentially causing issues
-	if size <= 0 {
-		return fmt.Errorf("invalid discard size: %d (must be > 0)", size)
+	if length <= 0 {
+		return fmt.Errorf("invalid discard size: %d (must be > 0)", length)
+	}
+	if offset < 0 {
+		return fmt.Errorf("invalid discard offset: %d (must be >= 0)", offset)
+	}
+
+	// Both ioctls take a uint64[2] array: [offset, length]
+	r := [2]uint64{uint64(offset), uint64(length)}
+
+	if err := blkIoctl(f, BLKSECDISCARD, &r); err == nil {
+		return nil
+	}
+	if err := blkIoctl(f, BLKDISCARD, &r); err != nil {
+		return fmt.Errorf("BLKDISCARD ioctl failed: %w", err)
 	}
 
-	// BLKDISCARD takes a uint64[2] array: [offset, length]
-	discardRange := [2]uint64{0, uint64(size)}
+	return nil
+}
 
+// blkIoctl issues a discard-style ioctl that takes an [offset, length] range
+func blkIoctl(f *os.File, req uintptr, r *[2]uint64) error {
 	// #nosec G103 -- unsafe.Pointer required for IOCTL syscall to pass array to kernel
 	_, _, errno := unix.Syscall(
 		unix.SYS_IOCTL,
 		f.Fd(),
-		uintptr(BLKDISCARD),
-		uintptr(unsafe.Pointer(&discardRange[0])),
+		req,
+		uintptr(unsafe.Pointer(&r[0])),
 	)
 
 	if errno != 0 {
-		return fmt.Errorf("BLKDISCARD ioctl failed: %w", errno)
+		return errno
 	}
 
 	return nil
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package luks2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// xtsCipher is AES-XTS (IEEE P1619) with the tweak dm-crypt's plain64 IV
+// generator uses: the 64-bit sector number in little endian, zero padded to
+// a block. Sectors are whole numbers of blocks, so there is no ciphertext
+// stealing. Where the CPU has AES instructions the data key runs through
+// assembly that keeps eight blocks in flight; elsewhere every block goes
+// through crypto/aes.
+type xtsCipher struct {
+	k1, k2 cipher.Block // Data and tweak keys
+
+	// Expanded data key of the assembly path; rounds is 0 without it
+	rounds   int
+	enc, dec []uint32
+}
+
+// newXTSCipher returns an AES-XTS cipher for key, which holds the data and
+// tweak keys: 32 bytes for AES-128, 48 for AES-192, 64 for AES-256
+func newXTSCipher(key []byte) (*xtsCipher, error) {
+	if len(key)%2 != 0 {
+		return nil, fmt.Errorf("invalid XTS key size %d", len(key))
+	}
+	half := len(key) / 2
+	k1, err := aes.NewCipher(key[:half])
+	if err != nil {
+		return nil, err
+	}
+	k2, err := aes.NewCipher(key[half:])
+	if err != nil {
+		return nil, err
+	}
+	c := &xtsCipher{k1: k1, k2: k2}
+	c.expandKey(key[:half])
+	return c, nil
+}
+
+// Encrypt encrypts sector, a whole number of blocks, from src into dst.
+// dst and src may be the same slice.
+func (c *xtsCipher) Encrypt(dst, src []byte, sector uint64) {
+	c.crypt(dst, src, sector, true)
+}
+
+// Decrypt decrypts sector, a whole number of blocks, from src into dst.
+// dst and src may be the same slice.
+func (c *xtsCipher) Decrypt(dst, src []byte, sector uint64) {
+	c.crypt(dst, src, sector, false)
+}
+
+// Clear zeroes the expanded data key of the assembly path. The cipher must
+// not be used afterwards.
+func (c *xtsCipher) Clear() {
+	clear(c.enc)
+	clear(c.dec)
+	c.rounds = 0
+}
+
+func (c *xtsCipher) crypt(dst, src []byte, sector uint64, encrypt bool) {
+	if len(src)%aes.BlockSize != 0 {
+		panic("luks2: XTS input is not a multiple of the block size")
+	}
+	if len(dst) < len(src) {
+		panic("luks2: XTS output smaller than input")
+	}
+
+	var tweak [aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(tweak[:8], sector)
+	c.k2.Encrypt(tweak[:], tweak[:])
+
+	if c.rounds != 0 {
+		c.cryptAsm(dst[:len(src)], src, &tweak, encrypt)
+		return
+	}
+
+	block := c.k1.Decrypt
+	if encrypt {
+		block = c.k1.Encrypt
+	}
+	lo := binary.LittleEndian.Uint64(tweak[:8])
+	hi := binary.LittleEndian.Uint64(tweak[8:])
+	for i := 0; i < len(src); i += aes.BlockSize {
+		b := dst[i : i+aes.BlockSize]
+		binary.LittleEndian.PutUint64(b[:8], binary.LittleEndian.Uint64(src[i:])^lo)
+		binary.LittleEndian.PutUint64(b[8:], binary.LittleEndian.Uint64(src[i+8:])^hi)
+		block(b, b)
+		binary.LittleEndian.PutUint64(b[:8], binary.LittleEndian.Uint64(b[:8])^lo)
+		binary.LittleEndian.PutUint64(b[8:], binary.LittleEndian.Uint64(b[8:])^hi)
+		lo, hi = xtsDouble(lo, hi)
+	}
+}
+
+// xtsDouble multiplies the tweak by x in GF(2^128), the little endian
+// convention of XTS: the bit shifted out at the top folds back as 0x87
+func xtsDouble(lo, hi uint64) (uint64, uint64) {
+	carry := hi >> 63
+	return lo<<1 ^ carry*0x87, hi<<1 | lo>>63
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build amd64 && !purego
+
+package luks2
+
+import "golang.org/x/sys/cpu"
+
+// expandKeyAsm expands an AES-128 (rounds 10) or AES-256 (rounds 14) key
+// into the encryption and equivalent-inverse decryption round keys, each
+// 4*(rounds+1) words
+//
+//go:noescape
+func expandKeyAsm(rounds int, key *byte, enc, dec *uint32)
+
+// xtsEncryptAsm and xtsDecryptAsm process length bytes, a multiple of the
+// block size, starting from the encrypted tweak
+//
+//go:noescape
+func xtsEncryptAsm(rounds int, xk *uint32, dst, src *byte, length int, tweak *byte)
+
+//go:noescape
+func xtsDecryptAsm(rounds int, xk *uint32, dst, src *byte, length int, tweak *byte)
+
+// expandKey sets up the AES-NI path for AES-128 and AES-256 data keys;
+// AES-192, which XTS volumes hardly ever use, stays on crypto/aes
+func (c *xtsCipher) expandKey(key []byte) {
+	if !cpu.X86.HasAES {
+		return
+	}
+	switch len(key) {
+	case 16:
+		c.rounds = 10
+	case 32:
+		c.rounds = 14
+	default:
+		return
+	}
+	c.enc = make([]uint32, 4*(c.rounds+1))
+	c.dec = make([]uint32, 4*(c.rounds+1))
+	expandKeyAsm(c.rounds, &key[0], &c.enc[0], &c.dec[0])
+}
+
+func (c *xtsCipher) cryptAsm(dst, src []byte, tweak *[16]byte, encrypt bool) {
+	if len(src) == 0 {
+		return
+	}
+	if encrypt {
+		xtsEncryptAsm(c.rounds, &c.enc[0], &dst[0], &src[0], len(src), &tweak[0])
+	} else {
+		xtsDecryptAsm(c.rounds, &c.dec[0], &dst[0], &src[0], len(src), &tweak[0])
+	}
+}
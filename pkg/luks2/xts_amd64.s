@@ -0,0 +1,264 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// Feedback of the tweak doubling as dwords: 0x87 into the low dword for
+// the bit shifted out at the top, 1 into the third for the carry between
+// the two quadwords
+DATA xtsMask<>+0(SB)/8, $0x0000000000000087
+DATA xtsMask<>+8(SB)/8, $0x0000000000000001
+GLOBL xtsMask<>(SB), (NOPTR+RODATA), $16
+
+// EXPAND128 derives the next AES-128 round key in X1 from the previous one
+// and the AESKEYGENASSIST result in X2, and stores it at BX
+#define EXPAND128 \
+	PSHUFD $0xff, X2, X2; \
+	MOVO   X1, X3; \
+	PSLLO  $4, X3; \
+	PXOR   X3, X1; \
+	PSLLO  $4, X3; \
+	PXOR   X3, X1; \
+	PSLLO  $4, X3; \
+	PXOR   X3, X1; \
+	PXOR   X2, X1; \
+	MOVOU  X1, (BX); \
+	ADDQ   $16, BX
+
+// EXPAND256 derives the next AES-256 round key in KEY, which is two round
+// keys back, from the AESKEYGENASSIST result in X2 with its SHUF word
+#define EXPAND256(SHUF, KEY) \
+	PSHUFD $SHUF, X2, X2; \
+	MOVO   KEY, X4; \
+	PSLLO  $4, X4; \
+	PXOR   X4, KEY; \
+	PSLLO  $4, X4; \
+	PXOR   X4, KEY; \
+	PSLLO  $4, X4; \
+	PXOR   X4, KEY; \
+	PXOR   X2, KEY; \
+	MOVOU  KEY, (BX); \
+	ADDQ   $16, BX
+
+// func expandKeyAsm(rounds int, key *byte, enc, dec *uint32)
+TEXT ·expandKeyAsm(SB), NOSPLIT, $0-32
+	MOVQ  rounds+0(FP), CX
+	MOVQ  key+8(FP), AX
+	MOVQ  enc+16(FP), BX
+	MOVQ  dec+24(FP), DX
+	MOVOU (AX), X1
+	MOVOU X1, (BX)
+	ADDQ  $16, BX
+	CMPQ  CX, $14
+	JEQ   expand256
+
+	AESKEYGENASSIST $0x01, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x02, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x04, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x08, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x10, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x20, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x40, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x80, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x1b, X1, X2
+	EXPAND128
+	AESKEYGENASSIST $0x36, X1, X2
+	EXPAND128
+	JMP invert
+
+expand256:
+	MOVOU 16(AX), X3
+	MOVOU X3, (BX)
+	ADDQ  $16, BX
+	AESKEYGENASSIST $0x01, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x02, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x04, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x08, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x10, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x20, X3, X2
+	EXPAND256(0xff, X1)
+	AESKEYGENASSIST $0x00, X1, X2
+	EXPAND256(0xaa, X3)
+	AESKEYGENASSIST $0x40, X3, X2
+	EXPAND256(0xff, X1)
+
+invert:
+	// dec[0] = enc[rounds], dec[i] = InvMixColumns(enc[rounds-i]),
+	// dec[rounds] = enc[0]
+	MOVQ  enc+16(FP), BX
+	MOVQ  CX, R8
+	SHLQ  $4, R8
+	ADDQ  BX, R8
+	MOVOU (R8), X0
+	MOVOU X0, (DX)
+	MOVQ  CX, R9
+	DECQ  R9
+
+invloop:
+	ADDQ   $16, DX
+	SUBQ   $16, R8
+	MOVOU  (R8), X0
+	AESIMC X0, X0
+	MOVOU  X0, (DX)
+	DECQ   R9
+	JNZ    invloop
+
+	MOVOU (BX), X0
+	MOVOU X0, 16(DX)
+	RET
+
+// NEXT_TWEAK multiplies the tweak in X9 by x, using X10 and the mask in X12
+#define NEXT_TWEAK \
+	MOVO   X9, X10; \
+	PSRAL  $31, X10; \
+	PADDQ  X9, X9; \
+	PSHUFD $0x13, X10, X10; \
+	PAND   X12, X10; \
+	PXOR   X10, X9
+
+// LOAD_BLOCK loads block I from SI into REG whitened with the tweak, which
+// it saves on the stack for after the rounds
+#define LOAD_BLOCK(I, REG) \
+	MOVOU X9, (I*16)(SP); \
+	MOVOU (I*16)(SI), REG; \
+	PXOR  X9, REG; \
+	NEXT_TWEAK
+
+// STORE_BLOCK whitens REG again with its saved tweak and stores it to DI
+#define STORE_BLOCK(I, REG) \
+	MOVOU (I*16)(SP), X10; \
+	PXOR  X10, REG; \
+	MOVOU REG, (I*16)(DI)
+
+#define ROUND8(OP) \
+	OP X8, X0; \
+	OP X8, X1; \
+	OP X8, X2; \
+	OP X8, X3; \
+	OP X8, X4; \
+	OP X8, X5; \
+	OP X8, X6; \
+	OP X8, X7
+
+// XTS runs XTS over DX bytes from SI to DI with the round keys at AX,
+// CX rounds and the tweak at BX. Eight blocks go through the rounds
+// together so the AES units stay busy; the rest go one at a time.
+#define XTS(ROUND, LAST) \
+	MOVOU (BX), X9; \
+	MOVOU xtsMask<>(SB), X12; \
+	\
+loop8: \
+	CMPQ DX, $128; \
+	JB   tail; \
+	LOAD_BLOCK(0, X0); \
+	LOAD_BLOCK(1, X1); \
+	LOAD_BLOCK(2, X2); \
+	LOAD_BLOCK(3, X3); \
+	LOAD_BLOCK(4, X4); \
+	LOAD_BLOCK(5, X5); \
+	LOAD_BLOCK(6, X6); \
+	LOAD_BLOCK(7, X7); \
+	MOVOU (AX), X8; \
+	ROUND8(PXOR); \
+	MOVQ  AX, R8; \
+	MOVQ  CX, R9; \
+	DECQ  R9; \
+	\
+rounds8: \
+	ADDQ  $16, R8; \
+	MOVOU (R8), X8; \
+	ROUND8(ROUND); \
+	DECQ  R9; \
+	JNZ   rounds8; \
+	ADDQ  $16, R8; \
+	MOVOU (R8), X8; \
+	ROUND8(LAST); \
+	STORE_BLOCK(0, X0); \
+	STORE_BLOCK(1, X1); \
+	STORE_BLOCK(2, X2); \
+	STORE_BLOCK(3, X3); \
+	STORE_BLOCK(4, X4); \
+	STORE_BLOCK(5, X5); \
+	STORE_BLOCK(6, X6); \
+	STORE_BLOCK(7, X7); \
+	ADDQ $128, SI; \
+	ADDQ $128, DI; \
+	SUBQ $128, DX; \
+	JMP  loop8; \
+	\
+tail: \
+	TESTQ DX, DX; \
+	JZ    done; \
+	MOVOU (SI), X0; \
+	PXOR  X9, X0; \
+	MOVOU (AX), X8; \
+	PXOR  X8, X0; \
+	MOVQ  AX, R8; \
+	MOVQ  CX, R9; \
+	DECQ  R9; \
+	\
+rounds1: \
+	ADDQ  $16, R8; \
+	MOVOU (R8), X8; \
+	ROUND X8, X0; \
+	DECQ  R9; \
+	JNZ   rounds1; \
+	ADDQ  $16, R8; \
+	MOVOU (R8), X8; \
+	LAST  X8, X0; \
+	PXOR  X9, X0; \
+	MOVOU X0, (DI); \
+	NEXT_TWEAK; \
+	ADDQ  $16, SI; \
+	ADDQ  $16, DI; \
+	SUBQ  $16, DX; \
+	JMP   tail; \
+	\
+done: \
+	RET
+
+// func xtsEncryptAsm(rounds int, xk *uint32, dst, src *byte, length int, tweak *byte)
+TEXT ·xtsEncryptAsm(SB), NOSPLIT, $128-48
+	MOVQ rounds+0(FP), CX
+	MOVQ xk+8(FP), AX
+	MOVQ dst+16(FP), DI
+	MOVQ src+24(FP), SI
+	MOVQ length+32(FP), DX
+	MOVQ tweak+40(FP), BX
+	XTS(AESENC, AESENCLAST)
+
+// func xtsDecryptAsm(rounds int, xk *uint32, dst, src *byte, length int, tweak *byte)
+TEXT ·xtsDecryptAsm(SB), NOSPLIT, $128-48
+	MOVQ rounds+0(FP), CX
+	MOVQ xk+8(FP), AX
+	MOVQ dst+16(FP), DI
+	MOVQ src+24(FP), SI
+	MOVQ length+32(FP), DX
+	MOVQ tweak+40(FP), BX
+	XTS(AESDEC, AESDECLAST)
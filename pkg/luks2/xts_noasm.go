@@ -0,0 +1,14 @@
+// Copyright (c) 2025 Jeremy Hahn
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !amd64 || purego
+
+package luks2
+
+// expandKey leaves every key on crypto/aes: there is no assembly path here
+func (c *xtsCipher) expandKey(key []byte) {}
+
+func (c *xtsCipher) cryptAsm(dst, src []byte, tweak *[16]byte, encrypt bool) {
+	panic("luks2: no XTS assembly on this platform")
+}